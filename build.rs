@@ -0,0 +1,55 @@
+//! Build script: generates the gRPC service from `proto/feluda/v1/feluda.proto`
+//! and copies the SPDX license text pack into the binary when the
+//! `embedded-license-texts` feature is enabled.
+//!
+//! The service is compiled with the `protoc` shipped by `protoc-bin-vendored`,
+//! so building needs no system `protoc`.
+//!
+//! The pack is read from `$FELUDA_LICENSE_TEXTS`, or `config/license-texts.json`
+//! as written by `feluda db texts`. Without one the build carries no texts and
+//! warns, so `--all-features` builds keep working on a fresh checkout.
+
+use std::env;
+use std::fs;
+use std::path::PathBuf;
+
+const DEFAULT_PACK: &str = "config/license-texts.json";
+const PROTO: &str = "proto/feluda/v1/feluda.proto";
+
+fn main() {
+    compile_protos();
+    embed_license_texts();
+}
+
+fn compile_protos() {
+    println!("cargo:rerun-if-changed={PROTO}");
+    let protoc = protoc_bin_vendored::protoc_bin_path().expect("no vendored protoc for this host");
+    env::set_var("PROTOC", protoc);
+    tonic_build::configure()
+        .build_client(false)
+        .compile_protos(&[PROTO], &["proto"])
+        .expect("failed to compile the gRPC service");
+}
+
+fn embed_license_texts() {
+    println!("cargo:rerun-if-env-changed=FELUDA_LICENSE_TEXTS");
+    if env::var_os("CARGO_FEATURE_EMBEDDED_LICENSE_TEXTS").is_none() {
+        return;
+    }
+
+    let pack = env::var_os("FELUDA_LICENSE_TEXTS")
+        .map(PathBuf::from)
+        .unwrap_or_else(|| PathBuf::from(DEFAULT_PACK));
+    println!("cargo:rerun-if-changed={}", pack.display());
+
+    let out = PathBuf::from(env::var_os("OUT_DIR").expect("OUT_DIR is set by cargo"))
+        .join("license-texts.json");
+    let content = fs::read_to_string(&pack).unwrap_or_else(|_| {
+        println!(
+            "cargo:warning=No license texts at {}, run `feluda db texts` first; building without embedded texts",
+            pack.display()
+        );
+        "{}".to_string()
+    });
+    fs::write(&out, content).expect("failed to write the license text pack");
+}
@@ -0,0 +1,464 @@
+//! Organization-wide rollup of many scans (`feluda aggregate`)
+//!
+//! Reports of several repositories are merged into one view of license
+//! exposure. A dependency used by several projects is counted once, keyed by
+//! ecosystem, name and version, and lists every project that uses it, so the
+//! rollup answers both "how many GPL packages do we ship" and "which
+//! repositories are affected".
+
+use colored::*;
+use serde::Serialize;
+use std::collections::{BTreeMap, BTreeSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::diff::{print_table, LoadedReport};
+use crate::licenses::{is_unknown_license, LicenseCompatibility, LicenseInfo};
+use crate::vulns::osv_ecosystem;
+
+/// A dependency across all projects using it
+#[derive(Debug, Clone, Serialize)]
+pub struct SharedDependency {
+    pub name: String,
+    pub version: String,
+    /// OSV ecosystem derived from the manifest, e.g. `npm` or `crates.io`
+    pub ecosystem: Option<String>,
+    pub license: Option<String>,
+    /// Restrictive in any of the projects
+    pub is_restrictive: bool,
+    pub tier: Option<String>,
+    pub projects: Vec<String>,
+    /// Projects whose license it is incompatible with
+    pub incompatible_in: Vec<String>,
+}
+
+/// Dependency counts of one project
+#[derive(Debug, Clone, Serialize)]
+pub struct ProjectExposure {
+    pub name: String,
+    pub dependencies: usize,
+    pub restrictive: usize,
+    pub incompatible: usize,
+    pub unknown: usize,
+}
+
+/// How widely a license is used
+#[derive(Debug, Clone, Serialize)]
+pub struct LicenseExposure {
+    pub license: String,
+    pub is_restrictive: bool,
+    /// Distinct dependencies under the license
+    pub dependencies: usize,
+    pub projects: Vec<String>,
+}
+
+/// Totals over all projects, counting shared dependencies once
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct RollupSummary {
+    pub projects: usize,
+    pub dependencies: usize,
+    pub restrictive: usize,
+    pub incompatible: usize,
+    pub unknown: usize,
+    /// Dependencies used by more than one project
+    pub shared: usize,
+}
+
+/// The organization-level view of several scans
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct Rollup {
+    pub summary: RollupSummary,
+    pub projects: Vec<ProjectExposure>,
+    /// Most widely used licenses first
+    pub licenses: Vec<LicenseExposure>,
+    pub dependencies: Vec<SharedDependency>,
+}
+
+/// Report files given directly, and `.json`, `.yaml` and `.yml` files found below directories
+pub fn collect_report_files(inputs: &[PathBuf]) -> FeludaResult<Vec<PathBuf>> {
+    let mut files = Vec::new();
+    for input in inputs {
+        if !input.is_dir() {
+            files.push(input.clone());
+            continue;
+        }
+
+        let mut found = Vec::new();
+        let mut pending = vec![input.clone()];
+        while let Some(dir) = pending.pop() {
+            for entry in fs::read_dir(&dir)?.filter_map(|e| e.ok()) {
+                let path = entry.path();
+                if path.is_dir() {
+                    pending.push(path);
+                } else if matches!(
+                    path.extension().and_then(|ext| ext.to_str()),
+                    Some("json" | "yaml" | "yml")
+                ) {
+                    found.push(path);
+                }
+            }
+        }
+        if found.is_empty() {
+            log(
+                LogLevel::Warn,
+                &format!("No reports found in {}", input.display()),
+            );
+        }
+        found.sort();
+        files.extend(found);
+    }
+
+    if files.is_empty() {
+        return Err(FeludaError::Config(
+            "No reports to aggregate; pass report files or directories containing them".to_string(),
+        ));
+    }
+    Ok(files)
+}
+
+/// Give projects with the same name a numeric suffix, e.g. `api` and `api-2`
+pub fn unique_project_names(reports: &mut [LoadedReport]) {
+    let mut seen: BTreeMap<String, usize> = BTreeMap::new();
+    for report in reports {
+        let count = seen.entry(report.project.clone()).or_default();
+        *count += 1;
+        if *count > 1 {
+            report.project = format!("{}-{count}", report.project);
+        }
+    }
+}
+
+fn is_incompatible(info: &LicenseInfo) -> bool {
+    info.compatibility == LicenseCompatibility::Incompatible
+}
+
+/// Merge the reports of several projects, counting shared dependencies once
+pub fn aggregate_reports(reports: &[LoadedReport]) -> Rollup {
+    let mut dependencies: BTreeMap<(String, String, String), SharedDependency> = BTreeMap::new();
+    let mut projects = Vec::new();
+
+    for report in reports {
+        let project = &report.project;
+        projects.push(ProjectExposure {
+            name: project.clone(),
+            dependencies: report.dependencies.len(),
+            restrictive: report
+                .dependencies
+                .iter()
+                .filter(|info| info.is_restrictive)
+                .count(),
+            incompatible: report
+                .dependencies
+                .iter()
+                .filter(|info| is_incompatible(info))
+                .count(),
+            unknown: report
+                .dependencies
+                .iter()
+                .filter(|info| info.has_unknown_license())
+                .count(),
+        });
+
+        for info in &report.dependencies {
+            let ecosystem = info.source_file.as_deref().and_then(osv_ecosystem);
+            let key = (
+                ecosystem.unwrap_or_default().to_string(),
+                info.name.clone(),
+                info.version.clone(),
+            );
+            let shared = dependencies.entry(key).or_insert_with(|| SharedDependency {
+                name: info.name.clone(),
+                version: info.version.clone(),
+                ecosystem: ecosystem.map(String::from),
+                license: info.license.clone(),
+                is_restrictive: false,
+                tier: info.tier.clone(),
+                projects: Vec::new(),
+                incompatible_in: Vec::new(),
+            });
+
+            if shared.license != info.license {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "{}@{} is reported as {} in {project} but as {} elsewhere; keeping the first",
+                        info.name,
+                        info.version,
+                        info.get_license(),
+                        shared.license.as_deref().unwrap_or("No License")
+                    ),
+                );
+            }
+            shared.is_restrictive |= info.is_restrictive;
+            if !shared.projects.contains(project) {
+                shared.projects.push(project.clone());
+            }
+            if is_incompatible(info) && !shared.incompatible_in.contains(project) {
+                shared.incompatible_in.push(project.clone());
+            }
+        }
+    }
+
+    let dependencies: Vec<SharedDependency> = dependencies.into_values().collect();
+
+    let mut by_license: BTreeMap<String, (bool, usize, BTreeSet<&str>)> = BTreeMap::new();
+    for dep in &dependencies {
+        let license = dep
+            .license
+            .clone()
+            .unwrap_or_else(|| "No License".to_string());
+        let entry = by_license.entry(license).or_default();
+        entry.0 |= dep.is_restrictive;
+        entry.1 += 1;
+        entry.2.extend(dep.projects.iter().map(String::as_str));
+    }
+    let mut licenses: Vec<LicenseExposure> = by_license
+        .into_iter()
+        .map(
+            |(license, (is_restrictive, count, projects))| LicenseExposure {
+                license,
+                is_restrictive,
+                dependencies: count,
+                projects: projects.into_iter().map(String::from).collect(),
+            },
+        )
+        .collect();
+    licenses.sort_by(|a, b| {
+        b.projects
+            .len()
+            .cmp(&a.projects.len())
+            .then(b.dependencies.cmp(&a.dependencies))
+            .then(a.license.cmp(&b.license))
+    });
+
+    Rollup {
+        summary: RollupSummary {
+            projects: projects.len(),
+            dependencies: dependencies.len(),
+            restrictive: dependencies.iter().filter(|d| d.is_restrictive).count(),
+            incompatible: dependencies
+                .iter()
+                .filter(|d| !d.incompatible_in.is_empty())
+                .count(),
+            unknown: dependencies
+                .iter()
+                .filter(|d| is_unknown_license(d.license.as_deref()))
+                .count(),
+            shared: dependencies.iter().filter(|d| d.projects.len() > 1).count(),
+        },
+        projects,
+        licenses,
+        dependencies,
+    }
+}
+
+/// Print the rollup as tables
+pub fn print_rollup(rollup: &Rollup) {
+    let summary = &rollup.summary;
+    println!(
+        "\n{} {} projects, {} distinct dependencies ({} shared), {} restrictive, {} incompatible, {} without a known license\n",
+        "Organization rollup:".bold(),
+        summary.projects,
+        summary.dependencies,
+        summary.shared,
+        summary.restrictive,
+        summary.incompatible,
+        summary.unknown
+    );
+
+    let rows: Vec<_> = rollup
+        .projects
+        .iter()
+        .map(|project| {
+            (
+                vec![
+                    project.name.clone(),
+                    project.dependencies.to_string(),
+                    project.restrictive.to_string(),
+                    project.incompatible.to_string(),
+                    project.unknown.to_string(),
+                ],
+                project.restrictive > 0 || project.incompatible > 0,
+            )
+        })
+        .collect();
+    print_table(
+        "Projects",
+        &[
+            "Project",
+            "Dependencies",
+            "Restrictive",
+            "Incompatible",
+            "Unknown",
+        ],
+        &rows,
+    );
+
+    let rows: Vec<_> = rollup
+        .licenses
+        .iter()
+        .map(|exposure| {
+            (
+                vec![
+                    exposure.license.clone(),
+                    exposure.dependencies.to_string(),
+                    exposure.projects.len().to_string(),
+                ],
+                exposure.is_restrictive,
+            )
+        })
+        .collect();
+    print_table("Licenses", &["License", "Dependencies", "Projects"], &rows);
+
+    let rows: Vec<_> = rollup
+        .dependencies
+        .iter()
+        .filter(|dep| dep.is_restrictive || !dep.incompatible_in.is_empty())
+        .map(|dep| {
+            (
+                vec![
+                    dep.name.clone(),
+                    dep.version.clone(),
+                    dep.license
+                        .clone()
+                        .unwrap_or_else(|| "No License".to_string()),
+                    dep.projects.join(", "),
+                ],
+                true,
+            )
+        })
+        .collect();
+    if rows.is_empty() {
+        println!(
+            "{}\n",
+            "✅ No restrictive or incompatible licenses in any project"
+                .green()
+                .bold()
+        );
+    } else {
+        print_table(
+            "Restrictive or incompatible dependencies",
+            &["Package", "Version", "License", "Used by"],
+            &rows,
+        );
+    }
+}
+
+/// File name for the report of `project` in `--output-dir`
+pub fn report_file_name(project: &str) -> String {
+    let name: String = project
+        .chars()
+        .map(|c| {
+            if c.is_alphanumeric() || matches!(c, '-' | '_' | '.') {
+                c
+            } else {
+                '_'
+            }
+        })
+        .collect();
+    format!("{name}.json")
+}
+
+/// Directory name of a scanned path, used as its project name
+pub fn project_name(path: &Path) -> String {
+    path.canonicalize()
+        .ok()
+        .as_deref()
+        .unwrap_or(path)
+        .file_name()
+        .map(|name| name.to_string_lossy().to_string())
+        .unwrap_or_else(|| path.display().to_string())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+    use tempfile::TempDir;
+
+    fn dep(name: &str, license: Option<&str>, is_restrictive: bool) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            source_file: Some("package-lock.json".to_string()),
+            ..LicenseInfo::test(name, "1.0.0", license)
+        }
+    }
+
+    fn report(project: &str, dependencies: Vec<LicenseInfo>) -> LoadedReport {
+        LoadedReport {
+            project: project.to_string(),
+            dependencies,
+        }
+    }
+
+    #[test]
+    fn test_aggregate_reports() {
+        let mut incompatible = dep("gpl-lib", Some("GPL-3.0"), true);
+        incompatible.compatibility = LicenseCompatibility::Incompatible;
+        let mut crate_lodash = dep("lodash", Some("MIT"), false);
+        crate_lodash.source_file = Some("Cargo.lock".to_string());
+
+        let rollup = aggregate_reports(&[
+            report(
+                "web",
+                vec![dep("lodash", Some("MIT"), false), incompatible.clone()],
+            ),
+            report(
+                "api",
+                vec![
+                    dep("lodash", Some("MIT"), false),
+                    dep("gpl-lib", Some("GPL-3.0"), true),
+                    dep("mystery", None, false),
+                ],
+            ),
+            report("tools", vec![crate_lodash]),
+        ]);
+
+        assert_eq!(rollup.summary.projects, 3);
+        // lodash from npm and crates.io are different packages
+        assert_eq!(rollup.summary.dependencies, 4);
+        assert_eq!(rollup.summary.shared, 2);
+        assert_eq!(rollup.summary.restrictive, 1);
+        assert_eq!(rollup.summary.incompatible, 1);
+        assert_eq!(rollup.summary.unknown, 1);
+
+        let gpl = rollup
+            .dependencies
+            .iter()
+            .find(|d| d.name == "gpl-lib")
+            .unwrap();
+        assert_eq!(gpl.projects, vec!["web", "api"]);
+        assert_eq!(gpl.incompatible_in, vec!["web"]);
+
+        assert_eq!(rollup.licenses[0].license, "MIT");
+        assert_eq!(rollup.licenses[0].dependencies, 2);
+        assert_eq!(rollup.licenses[0].projects, vec!["api", "tools", "web"]);
+        assert_eq!(rollup.projects[1].unknown, 1);
+    }
+
+    #[test]
+    fn test_collect_report_files_and_names() {
+        let temp_dir = TempDir::new().unwrap();
+        let nested = temp_dir.path().join("team-a");
+        fs::create_dir(&nested).unwrap();
+        fs::write(nested.join("web.json"), "[]").unwrap();
+        fs::write(temp_dir.path().join("api.yaml"), "[]").unwrap();
+        fs::write(temp_dir.path().join("notes.txt"), "").unwrap();
+
+        let files = collect_report_files(&[temp_dir.path().to_path_buf()]).unwrap();
+        assert_eq!(
+            files,
+            vec![temp_dir.path().join("api.yaml"), nested.join("web.json")]
+        );
+        assert!(collect_report_files(&[nested.join("missing")]).is_ok());
+        assert!(collect_report_files(&[]).is_err());
+
+        let mut reports = vec![report("api", vec![]), report("api", vec![])];
+        unique_project_names(&mut reports);
+        assert_eq!(reports[1].project, "api-2");
+        assert_eq!(report_file_name("acme/web app"), "acme_web_app.json");
+    }
+}
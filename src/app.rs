@@ -0,0 +1,1706 @@
+//! The `feluda` command line, behind the thin `main.rs` of the binary
+//!
+//! It lives in the library so the binary can reach the modules that are not
+//! part of the public API.
+
+use crate::aggregate::{
+    aggregate_reports, collect_report_files, print_rollup, project_name, report_file_name,
+    unique_project_names,
+};
+use crate::attributions::handle_attributions_command;
+use crate::baseline::{find_baseline, handle_baseline_write_command};
+use crate::cli::{self, print_version_info, Cli, Commands, FailOn};
+use crate::completion;
+use crate::debug::{
+    log, log_debug, log_error, set_debug_mode, set_log_format, set_log_level, FeludaError,
+    FeludaResult, LogLevel,
+};
+use crate::dependency_submission::submit_dependencies;
+use crate::deps_dev::print_scorecards;
+use crate::diff::{
+    checkout_ref, diff_dependencies, load_report, load_report_file, print_diff, LoadedReport,
+};
+use crate::exit_code::{FailureThreshold, Findings, EXIT_CLEAN, EXIT_INTERRUPTED, EXIT_SCAN_ERROR};
+use crate::generate::handle_generate_command;
+use crate::golden::{handle_verify_command, VerifyOptions};
+use crate::graph_export::handle_graph_command;
+use crate::health::print_package_health;
+use crate::hook::{self, HookOptions};
+use crate::i18n;
+use crate::image::{load_filesystem, load_image};
+use crate::legal_files::print_legal_files;
+use crate::license_text::{
+    clear_license_text_cache, fetch_license_text_pack, handle_license_text_command,
+};
+use crate::licenses::{self, set_github_token, DependencyScope, LicenseCompatibility};
+use crate::limits::{self, Limits};
+use crate::lookup::handle_lookup_command;
+use crate::lookup_errors::print_lookup_errors;
+use crate::manpage::handle_man_command;
+use crate::notify::{send_notifications, ScanResult};
+use crate::policy::{print_policy_violations, print_unknown_licenses, PolicyViolation};
+use crate::policy_server;
+use crate::progress;
+use crate::registry::{self, NetworkOptions};
+use crate::remediation::handle_remediate_command;
+use crate::report_json::{render_json_report, NdjsonWriter, LATEST_SCHEMA_VERSION};
+use crate::reporter::{
+    generate_format_report, generate_report, print_project_summary, write_github_step_summary,
+    ReportConfig,
+};
+use crate::repository_license::{self, set_gitlab_token};
+use crate::reuse::handle_reuse_command;
+use crate::reviews::{
+    find_reviews, handle_review_list_command, handle_review_remove_command,
+    handle_review_set_command, needs_review, print_reviews_needed,
+};
+use crate::sbom::handle_sbom_command;
+use crate::sbom::ingest::parse_purl;
+use crate::sbom::validate::handle_sbom_validate_command;
+use crate::score::{compliance_score, print_compliance_score, write_badge};
+use crate::server::handle_serve_command;
+use crate::signing::{sign_artifacts, Signer, SigningOptions};
+use crate::source_headers::handle_headers_command;
+use crate::store::{print_package_history, print_trends, record_scan, Store};
+use crate::table::App;
+use crate::template::write_template_report;
+use crate::tickets::sync_tickets;
+use crate::tiers::{print_tier_summary, tier_exit_code};
+use crate::utils::clone_repository;
+use crate::vulns::print_vulnerabilities;
+use crate::watch::{watch, WatchOptions};
+use crate::{cache, config, offline, scan, Report, ScanOptions};
+use clap::Parser;
+use std::env;
+use std::path::{Path, PathBuf};
+use std::process;
+use std::sync::Arc;
+use std::time::Duration;
+use tempfile::TempDir;
+
+/// Configuration for the check command
+#[derive(Debug)]
+struct CheckConfig {
+    path: String,
+    json: bool,
+    yaml: bool,
+    verbose: bool,
+    restrictive: bool,
+    gui: bool,
+    language: Option<String>,
+    ci_format: Option<cli::CiFormat>,
+    output_file: Option<String>,
+    incompatible: bool,
+    project_license: Option<String>,
+    gist: bool,
+    osi: Option<cli::OsiFilter>,
+    strict: bool,
+    no_local: bool,
+    recursive: bool,
+    include: Vec<String>,
+    exclude: Vec<String>,
+    exclude_dev: bool,
+    scopes: Vec<DependencyScope>,
+    vendored: bool,
+    from_sbom: Option<String>,
+    /// Scan `path` as the root filesystem of a container image
+    container: bool,
+    /// Read the dependencies from the build info of this Go binary
+    binary: Option<String>,
+    /// Read the dependencies from the license comments and source maps of these bundles
+    bundle: Option<String>,
+    /// Check these package URLs instead of scanning the project
+    packages: Vec<String>,
+    vulns: bool,
+    /// Look up deprecated, yanked and archived packages
+    health: bool,
+    /// Enrich dependencies from deps.dev, see [`crate::deps_dev`]
+    deps_dev: bool,
+    copyright: bool,
+    /// Look for PATENTS, EULA, commercial license and CLA files, see [`crate::legal_files`]
+    legal_files: bool,
+    /// Fail on the first lookup error, see [`crate::lookup_errors`]
+    fail_fast: bool,
+    /// Summarize license obligations, see [`crate::obligations`]
+    obligations: bool,
+    /// Print the compliance score, see [`crate::score`]
+    score: bool,
+    /// Write the compliance badge to this file
+    badge: Option<String>,
+    /// Submit the dependencies to the GitHub dependency graph
+    submit_github: bool,
+    /// Send the configured notifications, see [`crate::notify`]
+    notify: bool,
+    /// Sync issue tracker tickets with the violations, see [`crate::tickets`]
+    sync_tickets: bool,
+    /// History database to record the scan in, see [`crate::store`]
+    store: Option<String>,
+    /// Findings that fail the scan and how many are tolerated
+    threshold: FailureThreshold,
+    /// Baseline of accepted violations, see [`crate::baseline`]
+    baseline: Option<String>,
+    /// Review decisions to merge, see [`crate::reviews`]
+    reviews: Option<String>,
+    /// Only report dependencies that need a review
+    unreviewed: bool,
+    format: Option<cli::OutputFormat>,
+    schema: Option<u8>,
+    template: Option<String>,
+    /// Signing and attestation of the `--output-file` report
+    signing: SigningOptions,
+}
+
+/// Configuration for the aggregate command
+#[derive(Debug)]
+struct AggregateConfig {
+    reports: Vec<String>,
+    scan: Vec<String>,
+    output_dir: Option<String>,
+    scan_options: ScanOptions,
+    json: bool,
+}
+
+/// Configuration for the diff command
+#[derive(Debug)]
+struct DiffConfig {
+    old: Option<String>,
+    new: Option<String>,
+    base: Option<String>,
+    path: String,
+    scan_options: ScanOptions,
+    json: bool,
+    fail_on_restrictive: bool,
+    fail_on_incompatible: bool,
+    fail_on_relicense: bool,
+}
+
+/// Run the `feluda` command line and exit with its status
+pub fn main() {
+    // The completion scripts call back with `COMPLETE` set
+    completion::complete_from_env();
+
+    // Check if --version or -V is passed alone
+    let args: Vec<String> = env::args().collect();
+    if args.len() == 2 && (args[1] == "--version" || args[1] == "-V") {
+        print_version_info();
+        return;
+    }
+
+    match run() {
+        Ok(_) => {}
+        Err(e) => {
+            e.report();
+            process::exit(EXIT_SCAN_ERROR);
+        }
+    }
+}
+
+fn run() -> FeludaResult<()> {
+    let args = Cli::parse_from(cli::scan_args(env::args()));
+
+    // Logging, where --debug logs everything
+    set_log_format(args.log_format);
+    if args.debug {
+        set_debug_mode(true);
+    } else {
+        set_log_level(args.log_level);
+    }
+    i18n::set_language(args.lang.unwrap_or_default());
+    // Arguments include tokens, so they are only logged at trace level
+    log_debug("Starting Feluda with args", &args);
+
+    // Set GitHub API token for authenticated requests
+    set_github_token(args.github_token.clone());
+    set_gitlab_token(args.gitlab_token.clone());
+
+    cache::set_refresh(args.refresh);
+    offline::set_offline(args.offline);
+    // A broken snapshot found in the cache directory only fails offline runs
+    if let Err(err) = offline::load_license_db(args.license_db.as_deref()) {
+        if args.offline || args.license_db.is_some() {
+            return Err(err);
+        }
+        log_error("Ignoring the license database", &err);
+    }
+    configure_concurrency(args.concurrency);
+    registry::set_network_options(NetworkOptions {
+        timeout: args.timeout.map(Duration::from_secs),
+        retries: args.retries,
+    });
+    limits::set_limits(Limits {
+        max_memory: args.max_memory,
+        max_dependencies: args
+            .max_deps
+            .map(|max| usize::try_from(max).unwrap_or(usize::MAX)),
+    });
+
+    // Handle repository cloning if --repo is provided
+    let (analysis_path, _temp_dir) = match &args.repo.clone() {
+        Some(repo_url) => {
+            log(
+                LogLevel::Info,
+                &format!("Attempting to clone repository: {repo_url}"),
+            );
+            let temp_dir = TempDir::new().map_err(|e| {
+                FeludaError::TempDir(format!("Failed to create temporary directory: {e}"))
+            })?;
+            let repo_path = temp_dir.path();
+
+            // Clone the repository
+            if let Err(e) = clone_repository(&args, repo_path) {
+                log(LogLevel::Error, &format!("Repository cloning failed: {e}"));
+                return Err(e);
+            }
+            log(
+                LogLevel::Info,
+                &format!("Repository cloned to: {}", repo_path.display()),
+            );
+            (repo_path.to_path_buf(), Some(temp_dir))
+        }
+        None => {
+            let path = Path::new(&args.path).to_path_buf();
+            log(
+                LogLevel::Info,
+                &format!("Using local path for analysis: {}", path.display()),
+            );
+            (path, None)
+        }
+    };
+
+    log(
+        LogLevel::Info,
+        &format!("Analysing project at: {}", analysis_path.display()),
+    );
+
+    // Handle the command based on whether a subcommand was provided
+    if args.is_default_command() {
+        // Ctrl-C writes a partial report rather than killing the scan
+        limits::install_interrupt_handler();
+        // Default behavior: license analysis
+        handle_check_command(check_config(
+            args,
+            analysis_path.to_string_lossy().to_string(),
+        ))
+    } else {
+        // Handle subcommands
+        let command = args.get_command_args();
+        let signing = args.signing_options();
+        match command {
+            Commands::Generate {
+                path,
+                language,
+                project_license,
+            } => {
+                handle_generate_command(path, language, project_license);
+                Ok(())
+            }
+            Commands::Sbom {
+                path,
+                format,
+                output,
+            } => {
+                // Determine which format to use
+                match format {
+                    Some(cli::SbomCommand::Spdx {
+                        path: fmt_path,
+                        output: fmt_output,
+                    }) => {
+                        // Use the subcommand path/output if provided, otherwise use the parent command's
+                        let final_path = if fmt_path != "./" {
+                            fmt_path
+                        } else {
+                            path.clone()
+                        };
+                        let final_output = fmt_output.or(output.clone());
+                        handle_sbom_command(
+                            final_path,
+                            &cli::SbomFormat::Spdx,
+                            final_output,
+                            &signing,
+                        )
+                    }
+                    Some(cli::SbomCommand::Cyclonedx {
+                        path: fmt_path,
+                        output: fmt_output,
+                    }) => {
+                        let final_path = if fmt_path != "./" {
+                            fmt_path
+                        } else {
+                            path.clone()
+                        };
+                        let final_output = fmt_output.or(output.clone());
+                        handle_sbom_command(
+                            final_path,
+                            &cli::SbomFormat::Cyclonedx,
+                            final_output,
+                            &signing,
+                        )
+                    }
+                    Some(cli::SbomCommand::Validate {
+                        sbom_file,
+                        output: validation_output,
+                        json,
+                    }) => handle_sbom_validate_command(sbom_file, validation_output, json),
+                    None => {
+                        // Default: generate both formats
+                        handle_sbom_command(path, &cli::SbomFormat::All, output, &signing)
+                    }
+                }
+            }
+            Commands::Cache { clear } => {
+                handle_cache_command(clear)?;
+                Ok(())
+            }
+            Commands::Db { command } => handle_db_command(command),
+            Commands::Config { command } => handle_config_command(command),
+            Commands::Remediate {
+                path,
+                interactive,
+                json,
+                language,
+                project_license,
+                strict,
+                no_local,
+                exclude_dev,
+            } => handle_remediate_command(
+                Path::new(&path),
+                json,
+                interactive,
+                &ScanOptions {
+                    language,
+                    project_license,
+                    strict,
+                    no_local,
+                    exclude_dev,
+                    ..ScanOptions::default()
+                },
+            ),
+            Commands::Baseline { command } => handle_baseline_command(command),
+            Commands::Review { command } => handle_review_command(command),
+            Commands::Graph {
+                path,
+                format,
+                output,
+                language,
+                project_license,
+                strict,
+                no_local,
+                exclude_dev,
+            } => handle_graph_command(
+                Path::new(&path),
+                format,
+                output,
+                &ScanOptions {
+                    language,
+                    project_license,
+                    strict,
+                    no_local,
+                    exclude_dev,
+                    ..ScanOptions::default()
+                },
+            ),
+            Commands::Serve {
+                addr,
+                grpc,
+                otlp_endpoint,
+                max_scans,
+            } => handle_serve_command(
+                &addr,
+                grpc.as_deref(),
+                otlp_endpoint.as_deref(),
+                usize::from(max_scans),
+            ),
+            Commands::Attributions {
+                path,
+                language,
+                format,
+                output,
+                no_fetch,
+            } => handle_attributions_command(path, language, format, output, no_fetch),
+            Commands::Diff {
+                old,
+                new,
+                base,
+                path,
+                language,
+                project_license,
+                strict,
+                no_local,
+                json,
+                fail_on_restrictive,
+                fail_on_incompatible,
+                fail_on_relicense,
+            } => handle_diff_command(DiffConfig {
+                old,
+                new,
+                base,
+                path,
+                scan_options: ScanOptions {
+                    language,
+                    project_license,
+                    strict,
+                    no_local,
+                    ..ScanOptions::default()
+                },
+                json,
+                fail_on_restrictive,
+                fail_on_incompatible,
+                fail_on_relicense,
+            }),
+            Commands::Verify {
+                golden,
+                path,
+                tolerance,
+                update,
+                language,
+                project_license,
+                strict,
+                no_local,
+                json,
+            } => handle_verify_command(VerifyOptions {
+                golden,
+                path,
+                scan_options: ScanOptions {
+                    language,
+                    project_license,
+                    strict,
+                    no_local,
+                    ..ScanOptions::default()
+                },
+                tolerance,
+                update,
+                json,
+            }),
+            Commands::Aggregate {
+                reports,
+                scan,
+                output_dir,
+                language,
+                project_license,
+                strict,
+                no_local,
+                json,
+            } => handle_aggregate_command(AggregateConfig {
+                reports,
+                scan,
+                output_dir,
+                scan_options: ScanOptions {
+                    language,
+                    project_license,
+                    strict,
+                    no_local,
+                    ..ScanOptions::default()
+                },
+                json,
+            }),
+            Commands::Image {
+                reference,
+                platform,
+                registry_username,
+                registry_password,
+            } => {
+                let credentials = registry_username.zip(registry_password);
+                let image = cli::with_spinner(&format!("Fetching image {reference}"), |_| {
+                    load_image(&reference, platform.as_deref(), credentials)
+                })?;
+                let config = CheckConfig {
+                    container: true,
+                    ..check_config(args, image.root.to_string_lossy().to_string())
+                };
+                handle_check_command(config)
+            }
+            Commands::Filesystem { root } => {
+                let filesystem = load_filesystem(Path::new(&root))?;
+                let config = CheckConfig {
+                    container: true,
+                    ..check_config(args, filesystem.root.to_string_lossy().to_string())
+                };
+                handle_check_command(config)
+            }
+            Commands::Binary { binary } => {
+                let project_path = args.path.clone();
+                let config = CheckConfig {
+                    binary: Some(binary),
+                    ..check_config(args, project_path)
+                };
+                handle_check_command(config)
+            }
+            Commands::Bundle { bundle } => {
+                let project_path = args.path.clone();
+                let config = CheckConfig {
+                    bundle: Some(bundle),
+                    ..check_config(args, project_path)
+                };
+                handle_check_command(config)
+            }
+            Commands::Check { packages } => {
+                let project_path = args.path.clone();
+                let config = CheckConfig {
+                    packages,
+                    ..check_config(args, project_path)
+                };
+                handle_check_command(config)
+            }
+            Commands::Lookup {
+                ecosystem,
+                name,
+                version,
+                project_license,
+                json,
+            } => handle_lookup_command(ecosystem, name, version, project_license, json),
+            Commands::LicenseText {
+                target,
+                path,
+                output,
+            } => handle_license_text_command(target, path, output),
+            Commands::Headers {
+                path,
+                project_license,
+                json,
+                fail_on_conflict,
+            } => handle_headers_command(path, project_license, json, fail_on_conflict),
+            Commands::Reuse {
+                path,
+                json,
+                generate,
+                project_license,
+                copyright,
+            } => handle_reuse_command(path, json, generate, project_license, copyright),
+            Commands::History {
+                package,
+                project,
+                json,
+            } => handle_history_command(args.store.as_deref(), &package, project.as_deref(), json),
+            Commands::Trends {
+                project,
+                limit,
+                json,
+            } => handle_trends_command(args.store.as_deref(), project.as_deref(), limit, json),
+            Commands::Watch {
+                path,
+                language,
+                project_license,
+                strict,
+                no_local,
+                recursive,
+                exclude_dev,
+                interval,
+                json,
+            } => watch(
+                Path::new(&path),
+                &WatchOptions {
+                    scan_options: ScanOptions {
+                        language,
+                        project_license,
+                        strict,
+                        no_local,
+                        recursive,
+                        exclude_dev,
+                        ..ScanOptions::default()
+                    },
+                    interval: Duration::from_secs(interval),
+                    json,
+                },
+            ),
+            Commands::Hook { command } => handle_hook_command(command),
+            Commands::Completion { shell } => {
+                print!("{}", completion::script(shell)?);
+                Ok(())
+            }
+            Commands::Docs { command } => match command {
+                cli::DocsCommand::Man { output } => handle_man_command(&output),
+            },
+        }
+    }
+}
+
+/// Check configuration from the top-level flags, scanning `path`
+fn check_config(args: Cli, path: String) -> CheckConfig {
+    // The --fail-on-* flags are shorthands for --fail-on
+    let mut fail_on = args.fail_on.clone();
+    for (flag, kind) in [
+        (args.fail_on_restrictive, FailOn::Restrictive),
+        (args.fail_on_incompatible, FailOn::Incompatible),
+        (args.fail_on_vulns, FailOn::Vulns),
+    ] {
+        if flag && !fail_on.contains(&kind) {
+            fail_on.push(kind);
+        }
+    }
+
+    let signing = args.signing_options();
+    CheckConfig {
+        path,
+        json: args.json,
+        yaml: args.yaml,
+        verbose: args.verbose,
+        restrictive: args.restrictive,
+        gui: args.gui,
+        language: args.language,
+        ci_format: args.ci_format,
+        output_file: args.output_file,
+        incompatible: args.incompatible,
+        project_license: args.project_license,
+        gist: args.gist,
+        osi: args.osi,
+        strict: args.strict,
+        no_local: args.no_local,
+        recursive: args.recursive,
+        include: args.include,
+        exclude: args.exclude,
+        exclude_dev: args.exclude_dev,
+        scopes: args.scope,
+        vendored: args.vendored,
+        from_sbom: args.from_sbom,
+        vulns: args.vulns || fail_on.contains(&FailOn::Vulns),
+        health: args.health,
+        deps_dev: args.deps_dev,
+        copyright: args.copyright,
+        legal_files: args.legal_files,
+        fail_fast: args.fail_fast,
+        obligations: args.obligations,
+        score: args.score,
+        badge: args.badge,
+        submit_github: args.submit_github,
+        notify: args.notify,
+        sync_tickets: args.sync_tickets,
+        store: args.store,
+        threshold: FailureThreshold {
+            fail_on,
+            max_violations: args.max_violations,
+        },
+        baseline: args.baseline,
+        reviews: args.reviews,
+        unreviewed: args.unreviewed,
+        format: args.format,
+        schema: args.schema,
+        template: args.template,
+        container: false,
+        binary: None,
+        bundle: None,
+        packages: Vec::new(),
+        signing,
+    }
+}
+
+fn handle_check_command(config: CheckConfig) -> FeludaResult<()> {
+    log(
+        LogLevel::Info,
+        &format!("Executing check command with path: {}", config.path),
+    );
+    if config.signing.is_enabled() && config.output_file.is_none() {
+        return Err(FeludaError::Config(
+            "--sign and --attest need --output-file".to_string(),
+        ));
+    }
+
+    // With --notify and --sync-tickets, the scan and its integrations share the configuration
+    let settings = if config.notify || config.sync_tickets {
+        let settings = config::load_config()?;
+        if config.notify && settings.notifications.is_empty() {
+            log(
+                LogLevel::Warn,
+                "--notify given, but no [[notifications]] are configured",
+            );
+        }
+        if config.sync_tickets && settings.tickets.tracker.is_none() {
+            return Err(FeludaError::Config(
+                "--sync-tickets needs a tracker in the [tickets] section".to_string(),
+            ));
+        }
+        Some(settings)
+    } else {
+        None
+    };
+
+    let baseline = find_baseline(Path::new(&config.path), config.baseline.as_deref())?;
+    let reviews = find_reviews(Path::new(&config.path), config.reviews.as_deref())?;
+
+    // NDJSON lines are written during the scan, unless a baseline, the reviews
+    // or --unreviewed still change the dependencies afterwards
+    let ndjson = match config.format {
+        Some(cli::OutputFormat::Ndjson)
+            if !config.gui && !config.unreviewed && baseline.is_none() && reviews.is_none() =>
+        {
+            Some(Arc::new(NdjsonWriter::create(
+                config.output_file.as_deref(),
+            )?))
+        }
+        _ => None,
+    };
+
+    // Parse project dependencies
+    log(
+        LogLevel::Info,
+        &format!("Parsing dependencies in path: {}", config.path),
+    );
+
+    let Report {
+        project_license,
+        dependencies: mut analyzed_data,
+        mut policy_violations,
+        tiers,
+        projects,
+    } = scan(
+        &config.path,
+        &ScanOptions {
+            language: config.language,
+            project_license: config.project_license,
+            strict: config.strict,
+            fail_fast: config.fail_fast,
+            no_local: config.no_local,
+            recursive: config.recursive,
+            include: config.include,
+            exclude: config.exclude,
+            exclude_dev: config.exclude_dev,
+            scopes: config.scopes,
+            vendored: config.vendored,
+            from_sbom: config.from_sbom.map(PathBuf::from),
+            container: config.container,
+            binary: config.binary.map(PathBuf::from),
+            bundle: config.bundle.map(PathBuf::from),
+            packages: config.packages,
+            vulns: config.vulns,
+            health: config.health,
+            deps_dev: config.deps_dev,
+            copyright: config.copyright,
+            legal_files: config.legal_files,
+            obligations: config.obligations,
+            config: settings.clone(),
+            progress: Some(progress::terminal_progress()),
+            on_dependency: ndjson.as_ref().map(NdjsonWriter::callback),
+        },
+    )?;
+
+    log_debug("Analyzed dependencies", &analyzed_data);
+    // A partial report is only shown, it doesn't replace the last scan anywhere
+    let interrupted = limits::is_interrupted();
+
+    // The last recorded scan tells which findings are new to notifications
+    let previous = match (&settings, &config.store) {
+        (Some(settings), Some(store)) if settings.notifications.iter().any(|n| n.only_new) => {
+            Store::open(store)?.last_licenses(&project_name(Path::new(&config.path)))?
+        }
+        _ => None,
+    };
+
+    // Record what was found, before the baseline hides accepted violations
+    if let Some(store) = config.store.as_ref().filter(|_| !interrupted) {
+        record_scan(
+            store,
+            Path::new(&config.path),
+            project_license.as_deref(),
+            &analyzed_data,
+            policy_violations.len(),
+        )?;
+    }
+
+    if let Some(ref baseline) = baseline {
+        let suppressed = baseline.filter_policy_violations(&mut policy_violations);
+        baseline.waive_explanations(&mut analyzed_data);
+        log(
+            LogLevel::Info,
+            &format!("Baseline suppressed {suppressed} policy violations"),
+        );
+    }
+
+    if let Some(ref reviews) = reviews {
+        let reviewed = reviews.apply(&mut analyzed_data);
+        log(
+            LogLevel::Info,
+            &format!(
+                "{reviewed} of {} dependencies have a current review",
+                analyzed_data.len()
+            ),
+        );
+    }
+
+    if let Some(settings) = settings.as_ref().filter(|_| config.notify && !interrupted) {
+        send_notifications(
+            &settings.notifications,
+            &ScanResult {
+                path: Path::new(&config.path),
+                project_license: project_license.as_deref(),
+                dependencies: &analyzed_data,
+                policy_violations: &policy_violations,
+                baseline: baseline.as_ref(),
+                previous: previous.as_ref(),
+            },
+        );
+    }
+
+    if let Some(settings) = settings
+        .as_ref()
+        .filter(|_| config.sync_tickets && !interrupted)
+    {
+        let sync = sync_tickets(
+            settings,
+            Path::new(&config.path),
+            project_license.as_deref(),
+            &analyzed_data,
+            &policy_violations,
+        )?;
+        eprintln!(
+            "Tickets: {} opened, {} closed, {} still open",
+            sync.opened.len(),
+            sync.closed.len(),
+            sync.kept
+        );
+    }
+
+    if analyzed_data.is_empty() {
+        log(LogLevel::Warn, "No dependencies found to analyze. Exiting.");
+        // A project without dependencies still gets its badge
+        return report_score(
+            config.score,
+            config.badge.as_deref(),
+            &analyzed_data,
+            &policy_violations,
+        );
+    }
+
+    // Submit the full scan before the views below filter it or exit on findings
+    if config.submit_github && !interrupted {
+        submit_dependencies(&analyzed_data, Path::new(&config.path))?;
+    }
+
+    if config.unreviewed {
+        let original_count = analyzed_data.len();
+        analyzed_data.retain(needs_review);
+        log(
+            LogLevel::Info,
+            &format!(
+                "Filtered for unreviewed dependencies: {} of {original_count} dependencies",
+                analyzed_data.len()
+            ),
+        );
+    }
+
+    // Either run the GUI or generate a report
+    if config.gui {
+        let original_count = analyzed_data.len();
+
+        // Filter for restrictive and incompatible
+        if config.restrictive || config.incompatible {
+            if project_license.is_some() {
+                log(
+                LogLevel::Info,
+                "Restrictive and incompatible mode enabled, filtering for restrictive and incompatible licenses",
+            );
+                analyzed_data.retain(|info| {
+                    (config.restrictive && *info.is_restrictive())
+                        || (config.incompatible
+                            && info.compatibility == LicenseCompatibility::Incompatible)
+                });
+
+                log(
+                    LogLevel::Info,
+                    &format!(
+                        "Filtered for restrictive and incompatible licenses: {} of {} dependencies",
+                        analyzed_data.len(),
+                        original_count
+                    ),
+                );
+            } else {
+                log(
+                LogLevel::Warn,
+                "Incompatible mode enabled but no project license specified, cannot filter for incompatible licenses",
+            );
+            }
+        } else if config.restrictive {
+            // Filter for restrictive
+            log(
+                LogLevel::Info,
+                "Restrictive mode enabled, filtering for restrictive licenses",
+            );
+            analyzed_data.retain(|info| *info.is_restrictive());
+
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Filtered for restrictive licenses: {} of {} dependencies",
+                    analyzed_data.len(),
+                    original_count
+                ),
+            );
+        } else if config.incompatible {
+            // Filter for incompatible if requested
+            if project_license.is_some() {
+                log(
+                    LogLevel::Info,
+                    "Incompatible mode enabled, filtering for incompatible licenses",
+                );
+                analyzed_data
+                    .retain(|info| info.compatibility == LicenseCompatibility::Incompatible);
+
+                log(
+                    LogLevel::Info,
+                    &format!(
+                        "Filtered for incompatible licenses: {} of {} dependencies",
+                        analyzed_data.len(),
+                        original_count
+                    ),
+                );
+            } else {
+                log(
+                LogLevel::Warn,
+                "Incompatible mode enabled but no project license specified, cannot filter for incompatible licenses",
+            );
+            }
+        }
+
+        // Apply OSI filtering
+        if let Some(osi_filter) = &config.osi {
+            let before_count = analyzed_data.len();
+            match osi_filter {
+                cli::OsiFilter::Approved => {
+                    analyzed_data.retain(|info| info.osi_status == licenses::OsiStatus::Approved);
+                    log(
+                        LogLevel::Info,
+                        &format!(
+                            "Filtered for OSI approved licenses: {} of {} dependencies",
+                            analyzed_data.len(),
+                            before_count
+                        ),
+                    );
+                }
+                cli::OsiFilter::NotApproved => {
+                    analyzed_data
+                        .retain(|info| info.osi_status == licenses::OsiStatus::NotApproved);
+                    log(
+                        LogLevel::Info,
+                        &format!(
+                            "Filtered for non-OSI approved licenses: {} of {} dependencies",
+                            analyzed_data.len(),
+                            before_count
+                        ),
+                    );
+                }
+                cli::OsiFilter::Unknown => {
+                    analyzed_data.retain(|info| info.osi_status == licenses::OsiStatus::Unknown);
+                    log(
+                        LogLevel::Info,
+                        &format!(
+                            "Filtered for unknown OSI status licenses: {} of {} dependencies",
+                            analyzed_data.len(),
+                            before_count
+                        ),
+                    );
+                }
+            }
+        }
+
+        log(LogLevel::Info, "Starting TUI mode");
+
+        // Initialize the terminal
+        color_eyre::install()
+            .map_err(|e| FeludaError::TuiInit(format!("Failed to initialize color_eyre: {e}")))?;
+
+        let terminal = ratatui::init();
+        log(LogLevel::Info, "Terminal initialized for TUI");
+
+        // TUI app with project license info
+        let app_result = App::new(analyzed_data, project_license).run(terminal);
+        ratatui::restore();
+
+        // Handle any errors from the TUI
+        app_result.map_err(|e| FeludaError::TuiRuntime(format!("TUI error: {e}")))?;
+
+        log(LogLevel::Info, "TUI session completed successfully");
+    } else {
+        let report_file = config.output_file.clone();
+        let (has_restrictive, has_incompatible) = if let Some(ndjson) = &ndjson {
+            ndjson.finish()?;
+            (
+                analyzed_data.iter().any(|info| *info.is_restrictive()),
+                analyzed_data
+                    .iter()
+                    .any(|info| info.compatibility == LicenseCompatibility::Incompatible),
+            )
+        } else if let Some(ref format) = config.format {
+            log(LogLevel::Info, &format!("Generating {format:?} report"));
+            generate_format_report(
+                &analyzed_data,
+                format,
+                &config.path,
+                project_license.as_deref(),
+                &policy_violations,
+                config.schema,
+                config.output_file.as_deref(),
+            )?
+        } else if let Some(ref template) = config.template {
+            log(LogLevel::Info, &format!("Rendering report with {template}"));
+            write_template_report(
+                template,
+                &config.path,
+                &analyzed_data,
+                project_license.as_deref(),
+                &policy_violations,
+                config.output_file.as_deref(),
+            )?;
+            (
+                analyzed_data.iter().any(|info| *info.is_restrictive()),
+                analyzed_data
+                    .iter()
+                    .any(|info| info.compatibility == LicenseCompatibility::Incompatible),
+            )
+        } else {
+            log(LogLevel::Info, "Generating dependency report");
+
+            // Inside GitHub Actions, also summarize the scan on the job's summary page
+            if matches!(config.ci_format, Some(cli::CiFormat::Github)) {
+                if let Ok(summary_path) = env::var("GITHUB_STEP_SUMMARY") {
+                    if let Err(err) = write_github_step_summary(
+                        Path::new(&summary_path),
+                        &analyzed_data,
+                        project_license.as_deref(),
+                    ) {
+                        log_error("Failed to write GitHub step summary", &err);
+                    }
+                }
+            }
+
+            let text_output =
+                !(config.json || config.yaml || config.gist || config.ci_format.is_some());
+            // Monorepo scans also get a table per project after the combined report
+            let show_projects = text_output && projects.len() > 1;
+            let show_vulns = text_output && config.vulns;
+            // Also shown when [policy.health] fails on a signal without --health
+            let show_health = text_output
+                && (config.health
+                    || analyzed_data.iter().any(|info| {
+                        info.health
+                            .as_ref()
+                            .is_some_and(|health| !health.signals().is_empty())
+                    }));
+            // Also shown when [policy.legal_files] fails on a kind without --legal-files
+            let show_legal_files = text_output
+                && (config.legal_files
+                    || analyzed_data
+                        .iter()
+                        .any(|info| info.legal_files.as_ref().is_some_and(|f| !f.is_empty())));
+
+            // Create ReportConfig from CLI arguments
+            let report_config = ReportConfig::new(
+                config.json,
+                config.yaml,
+                config.verbose,
+                config.restrictive,
+                config.incompatible,
+                config.ci_format,
+                config.output_file,
+                project_license,
+                config.gist,
+                config.osi,
+            );
+
+            // Generate a report based on the analyzed data
+            let result = generate_report(analyzed_data.clone(), report_config);
+            if show_projects {
+                print_project_summary(&projects);
+            }
+            if show_vulns {
+                print_vulnerabilities(&analyzed_data);
+            }
+            if show_health {
+                print_package_health(&analyzed_data);
+            }
+            if show_legal_files {
+                print_legal_files(&analyzed_data);
+            }
+            if text_output && config.deps_dev {
+                print_scorecards(&analyzed_data);
+            }
+            if text_output {
+                print_lookup_errors(&analyzed_data);
+                let policy = match &settings {
+                    Some(settings) => settings.policy.clone(),
+                    None => config::load_config()
+                        .map(|config| config.policy)
+                        .unwrap_or_default(),
+                };
+                print_unknown_licenses(&analyzed_data, &policy);
+            }
+            if text_output && (reviews.is_some() || config.unreviewed) {
+                print_reviews_needed(&analyzed_data);
+            }
+            result
+        };
+
+        if config.signing.is_enabled() {
+            let artifacts: Vec<PathBuf> = report_file.into_iter().map(PathBuf::from).collect();
+            sign_artifacts(&artifacts, Path::new(&config.path), &config.signing)?;
+        }
+
+        log(
+            LogLevel::Info,
+            &format!(
+                "Report generated, has_restrictive: {has_restrictive}, has_incompatible: {has_incompatible}"
+            ),
+        );
+
+        if !policy_violations.is_empty() {
+            print_policy_violations(&policy_violations);
+        }
+
+        if !tiers.is_empty() {
+            print_tier_summary(&tiers, &analyzed_data);
+        }
+
+        report_score(
+            config.score,
+            config.badge.as_deref(),
+            &analyzed_data,
+            &policy_violations,
+        )?;
+
+        if interrupted {
+            eprintln!("{}", i18n::tr("limits.partial"));
+            process::exit(EXIT_INTERRUPTED);
+        }
+
+        if let Some(exit_code) = tier_exit_code(&tiers) {
+            log(
+                LogLevel::Warn,
+                &format!("Exiting with status {exit_code} due to risk tier"),
+            );
+            process::exit(exit_code);
+        }
+
+        // Violations accepted in the baseline don't fail the check
+        let findings = Findings::collect(&analyzed_data, &policy_violations, baseline.as_ref());
+        log_debug("Findings", &findings);
+        let exit_code = config.threshold.exit_code(&findings);
+        if exit_code != EXIT_CLEAN {
+            log(
+                LogLevel::Warn,
+                &format!("Exiting with status {exit_code} due to license or vulnerability issues"),
+            );
+            process::exit(exit_code);
+        }
+    }
+
+    log(LogLevel::Info, "Feluda completed successfully");
+
+    Ok(())
+}
+
+/// Print the compliance score and write the badge, when asked for
+fn report_score(
+    print_score: bool,
+    badge: Option<&str>,
+    dependencies: &[licenses::LicenseInfo],
+    policy_violations: &[PolicyViolation],
+) -> FeludaResult<()> {
+    if !print_score && badge.is_none() {
+        return Ok(());
+    }
+    let score = compliance_score(dependencies, policy_violations);
+    if print_score {
+        print_compliance_score(&score);
+    }
+    if let Some(badge) = badge {
+        write_badge(Path::new(badge), &score)?;
+    }
+    Ok(())
+}
+
+/// Size the thread pool used to analyze dependencies
+///
+/// License lookups mostly wait on the network, so the default uses at least
+/// `MIN_DEFAULT_CONCURRENCY` threads even on machines with few CPUs.
+fn configure_concurrency(concurrency: Option<u16>) {
+    const MIN_DEFAULT_CONCURRENCY: usize = 8;
+
+    let threads = concurrency.map(usize::from).unwrap_or_else(|| {
+        std::thread::available_parallelism()
+            .map(|n| n.get())
+            .unwrap_or(1)
+            .max(MIN_DEFAULT_CONCURRENCY)
+    });
+    log(
+        LogLevel::Info,
+        &format!("Analyzing dependencies with {threads} threads"),
+    );
+
+    if let Err(err) = rayon::ThreadPoolBuilder::new()
+        .num_threads(threads)
+        .build_global()
+    {
+        log_error("Failed to configure the thread pool", &err);
+    }
+}
+
+fn handle_diff_command(config: DiffConfig) -> FeludaResult<()> {
+    let (old_deps, new_deps) = match (&config.base, config.old, config.new) {
+        (Some(base), _, _) => {
+            log(
+                LogLevel::Info,
+                &format!("Comparing {} against {base}", config.path),
+            );
+            let current = scan(&config.path, &config.scan_options)?;
+
+            // Check the base against the same project license as the working tree
+            let (_checkout, base_path) = checkout_ref(Path::new(&config.path), base)?;
+            let base_options = ScanOptions {
+                project_license: current.project_license.clone(),
+                ..config.scan_options
+            };
+            let previous = scan(&base_path, &base_options)?;
+
+            (previous.dependencies, current.dependencies)
+        }
+        (None, Some(old), Some(new)) => {
+            (load_report(Path::new(&old))?, load_report(Path::new(&new))?)
+        }
+        _ => {
+            return Err(FeludaError::Config(
+                "Provide two reports or --base <ref> to compare".to_string(),
+            ))
+        }
+    };
+
+    let diff = diff_dependencies(&old_deps, &new_deps);
+    log_debug("Scan diff", &diff);
+
+    if config.json {
+        let output = serde_json::to_string_pretty(&diff)
+            .map_err(|e| FeludaError::Serialization(format!("Failed to serialize diff: {e}")))?;
+        println!("{output}");
+    } else {
+        print_diff(&diff);
+    }
+
+    if (config.fail_on_restrictive && !diff.new_restrictive().is_empty())
+        || (config.fail_on_incompatible && !diff.new_incompatible().is_empty())
+        || (config.fail_on_relicense && diff.relicensed().iter().any(|c| c.riskier))
+    {
+        log(
+            LogLevel::Warn,
+            "Newly introduced licenses violate the requested policy, exiting with status 1",
+        );
+        process::exit(1);
+    }
+
+    Ok(())
+}
+
+fn handle_aggregate_command(config: AggregateConfig) -> FeludaResult<()> {
+    let mut reports = if config.reports.is_empty() {
+        Vec::new()
+    } else {
+        let inputs: Vec<PathBuf> = config.reports.iter().map(PathBuf::from).collect();
+        collect_report_files(&inputs)?
+            .iter()
+            .map(|path| load_report_file(path))
+            .collect::<FeludaResult<Vec<_>>>()?
+    };
+
+    let mut scanned = Vec::new();
+    for path in &config.scan {
+        log(LogLevel::Info, &format!("Scanning {path} for the rollup"));
+        scanned.push((path, scan(path, &config.scan_options)?));
+    }
+    let first_scanned = reports.len();
+    reports.extend(scanned.iter().map(|(path, report)| LoadedReport {
+        project: project_name(Path::new(path)),
+        dependencies: report.dependencies.clone(),
+    }));
+    unique_project_names(&mut reports);
+
+    if let Some(output_dir) = &config.output_dir {
+        std::fs::create_dir_all(output_dir)?;
+        for ((path, report), loaded) in scanned.iter().zip(&reports[first_scanned..]) {
+            let content = render_json_report(
+                LATEST_SCHEMA_VERSION,
+                path,
+                &report.dependencies,
+                report.project_license.as_deref(),
+                &report.policy_violations,
+            )?;
+            let file = Path::new(output_dir).join(report_file_name(&loaded.project));
+            std::fs::write(&file, content).map_err(|e| {
+                FeludaError::FileWrite(format!("Failed to write {}: {e}", file.display()))
+            })?;
+            log(
+                LogLevel::Info,
+                &format!("Report of {} written to {}", loaded.project, file.display()),
+            );
+        }
+    }
+
+    let rollup = aggregate_reports(&reports);
+    log_debug("Rollup", &rollup.summary);
+
+    if config.json {
+        let output = serde_json::to_string_pretty(&rollup)
+            .map_err(|e| FeludaError::Serialization(format!("Failed to serialize rollup: {e}")))?;
+        println!("{output}");
+    } else {
+        print_rollup(&rollup);
+    }
+    Ok(())
+}
+
+/// The `--store` database queried by `feluda history` and `feluda trends`
+fn open_store(store: Option<&str>) -> FeludaResult<Store> {
+    let store = store.ok_or_else(|| {
+        FeludaError::Config(
+            "No scan history configured, pass --store sqlite:<path> or set FELUDA_STORE"
+                .to_string(),
+        )
+    })?;
+    Store::open(store)
+}
+
+fn handle_history_command(
+    store: Option<&str>,
+    package: &str,
+    project: Option<&str>,
+    json: bool,
+) -> FeludaResult<()> {
+    // The history covers every version, so only the name of a package URL counts
+    let package =
+        &parse_purl(package).map_or_else(|| package.to_string(), |purl| purl.package_name());
+    let changes = open_store(store)?.package_history(package, project)?;
+    if json {
+        let output = serde_json::to_string_pretty(&changes).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize package history: {e}"))
+        })?;
+        println!("{output}");
+    } else {
+        print_package_history(package, &changes);
+    }
+    Ok(())
+}
+
+fn handle_trends_command(
+    store: Option<&str>,
+    project: Option<&str>,
+    limit: u64,
+    json: bool,
+) -> FeludaResult<()> {
+    let mut scans = open_store(store)?.scans(project)?;
+    let skip = scans.len().saturating_sub(limit as usize);
+    scans.drain(..skip);
+    if json {
+        let output = serde_json::to_string_pretty(&scans)
+            .map_err(|e| FeludaError::Serialization(format!("Failed to serialize scans: {e}")))?;
+        println!("{output}");
+    } else {
+        print_trends(&scans);
+    }
+    Ok(())
+}
+
+fn handle_db_command(command: cli::DbCommand) -> FeludaResult<()> {
+    match command {
+        cli::DbCommand::Download {
+            output,
+            path,
+            language,
+            packages,
+            top,
+        } => {
+            if offline::is_offline() {
+                return Err(FeludaError::Config(
+                    "`feluda db download` needs network access and cannot run with --offline"
+                        .to_string(),
+                ));
+            }
+
+            // Scanning fills the package cache with the licenses the snapshot needs
+            for project in &path {
+                log(
+                    LogLevel::Info,
+                    &format!("Scanning {project} for the license database"),
+                );
+                let report = scan(
+                    project,
+                    &ScanOptions {
+                        language: language.clone(),
+                        ..ScanOptions::default()
+                    },
+                )?;
+                println!(
+                    "✓ Scanned {project} ({} dependencies)",
+                    report.dependencies.len()
+                );
+            }
+
+            let latest = match &packages {
+                Some(list) => {
+                    let packages = offline::read_package_list(Path::new(list), top)?;
+                    println!("Looking up {} packages from {list}", packages.len());
+                    offline::fetch_package_licenses(&packages)
+                }
+                None => Default::default(),
+            };
+
+            let mut db = offline::build_license_db();
+            db.latest.extend(latest);
+            let output = match output {
+                Some(output) => std::path::PathBuf::from(output),
+                None => offline::default_license_db_path()?,
+            };
+            db.save(&output)?;
+
+            println!(
+                "✓ License database written to {} ({} licenses, {} OSI approved, {} packages, {} license texts)\n",
+                output.display(),
+                db.github_licenses.len(),
+                db.osi_licenses.len(),
+                db.packages.len(),
+                db.license_texts.texts.len()
+            );
+            Ok(())
+        }
+        cli::DbCommand::Update {
+            url,
+            output,
+            key,
+            certificate_identity,
+            certificate_oidc_issuer,
+            no_verify,
+        } => {
+            if offline::is_offline() {
+                return Err(FeludaError::Config(
+                    "`feluda db update` needs network access and cannot run with --offline"
+                        .to_string(),
+                ));
+            }
+
+            let signer = match key {
+                _ if no_verify => None,
+                Some(key) => Some(Signer::Key(key)),
+                None => Some(Signer::Identity {
+                    identity_regexp: certificate_identity,
+                    oidc_issuer: certificate_oidc_issuer,
+                }),
+            };
+            let output = match output {
+                Some(output) => std::path::PathBuf::from(output),
+                None => offline::default_license_db_path()?,
+            };
+            let (db, updated) = offline::update_license_db(&offline::UpdateOptions {
+                url,
+                output: output.clone(),
+                signer,
+            })?;
+
+            let created = chrono::DateTime::from_timestamp(db.created as i64, 0)
+                .map(|created| created.format("%Y-%m-%d").to_string())
+                .unwrap_or_default();
+            if updated {
+                println!(
+                    "✓ License database from {created} installed at {} ({} packages, {} latest releases)\n",
+                    output.display(),
+                    db.packages.len(),
+                    db.latest.len()
+                );
+            } else {
+                println!(
+                    "✓ License database at {} is up to date ({created})\n",
+                    output.display()
+                );
+            }
+            Ok(())
+        }
+        cli::DbCommand::Texts { output } => {
+            if offline::is_offline() {
+                return Err(FeludaError::Config(
+                    "`feluda db texts` needs network access and cannot run with --offline"
+                        .to_string(),
+                ));
+            }
+
+            let pack = cli::with_spinner("Downloading the SPDX license texts", |_| {
+                fetch_license_text_pack()
+            })?;
+            pack.save(Path::new(&output))?;
+            println!(
+                "✓ {} texts of SPDX license list {} written to {output}\n",
+                pack.texts.len(),
+                pack.license_list_version
+            );
+            Ok(())
+        }
+    }
+}
+
+fn handle_baseline_command(command: cli::BaselineCommand) -> FeludaResult<()> {
+    match command {
+        cli::BaselineCommand::Write {
+            path,
+            output,
+            language,
+            project_license,
+            strict,
+            no_local,
+            recursive,
+            exclude_dev,
+        } => handle_baseline_write_command(
+            Path::new(&path),
+            output,
+            &ScanOptions {
+                language,
+                project_license,
+                strict,
+                no_local,
+                recursive,
+                exclude_dev,
+                ..ScanOptions::default()
+            },
+        ),
+    }
+}
+
+fn handle_review_command(command: cli::ReviewCommand) -> FeludaResult<()> {
+    match command {
+        cli::ReviewCommand::Set {
+            package,
+            status,
+            license,
+            comment,
+            reviewer,
+            path,
+            file,
+        } => handle_review_set_command(
+            Path::new(&path),
+            file,
+            &package,
+            status,
+            license,
+            comment,
+            reviewer,
+        ),
+        cli::ReviewCommand::Remove {
+            package,
+            path,
+            file,
+        } => handle_review_remove_command(Path::new(&path), file, &package),
+        cli::ReviewCommand::List { path, file, json } => {
+            handle_review_list_command(Path::new(&path), file, json)
+        }
+    }
+}
+
+fn handle_hook_command(command: cli::HookCommand) -> FeludaResult<()> {
+    match command {
+        cli::HookCommand::Install { path, force } => {
+            let hook = hook::install(Path::new(&path), force)?;
+            println!("✓ Installed pre-commit hook {}", hook.display());
+            Ok(())
+        }
+        cli::HookCommand::Uninstall { path } => {
+            match hook::uninstall(Path::new(&path))? {
+                Some(hook) => println!("✓ Removed pre-commit hook {}", hook.display()),
+                None => println!("No feluda pre-commit hook installed"),
+            }
+            Ok(())
+        }
+        cli::HookCommand::Run {
+            path,
+            fail_on,
+            max_violations,
+            language,
+            project_license,
+            strict,
+            no_local,
+            exclude_dev,
+            no_cache,
+        } => {
+            let exit_code = hook::run(
+                Path::new(&path),
+                &HookOptions {
+                    scan_options: ScanOptions {
+                        language,
+                        project_license,
+                        strict,
+                        no_local,
+                        exclude_dev,
+                        ..ScanOptions::default()
+                    },
+                    threshold: FailureThreshold {
+                        fail_on,
+                        max_violations,
+                    },
+                    no_cache,
+                },
+            )?;
+            if exit_code != EXIT_CLEAN {
+                process::exit(exit_code);
+            }
+            Ok(())
+        }
+    }
+}
+
+fn handle_config_command(command: cli::ConfigCommand) -> FeludaResult<()> {
+    match command {
+        cli::ConfigCommand::Show { effective } => {
+            let layers = config::config_layers();
+            let settings = config::effective_settings()?;
+            let names: Vec<String> = layers.iter().map(ToString::to_string).collect();
+
+            if effective {
+                // Dotted keys keep the output a valid .feluda.toml
+                println!("# Layers, lowest precedence first: {}", names.join(", "));
+                println!("# Command-line flags override these settings for each run");
+                for setting in &settings {
+                    println!("{} = {}  # {}", setting.key, setting.value, setting.layer);
+                }
+                return Ok(());
+            }
+
+            println!("Configuration layers, lowest precedence first:");
+            for name in &names {
+                println!("  {name}");
+            }
+            println!("Command-line flags override these settings for each run.");
+            for layer in layers.iter().skip(1) {
+                println!("\n{layer}:");
+                let mut changed = settings.iter().filter(|s| &s.layer == layer).peekable();
+                if changed.peek().is_none() {
+                    println!("  (no settings)");
+                }
+                for setting in changed {
+                    println!("  {} = {}", setting.key, setting.value);
+                }
+            }
+            Ok(())
+        }
+        cli::ConfigCommand::Get { key } => {
+            let table = format!("{key}.");
+            let settings: Vec<_> = config::effective_settings()?
+                .into_iter()
+                .filter(|setting| setting.key == key || setting.key.starts_with(&table))
+                .collect();
+            if settings.is_empty() {
+                return Err(FeludaError::Config(format!(
+                    "Unknown configuration key '{key}'"
+                )));
+            }
+            for setting in &settings {
+                println!("{} = {}  # {}", setting.key, setting.value, setting.layer);
+            }
+            Ok(())
+        }
+    }
+}
+
+fn handle_cache_command(clear: bool) -> FeludaResult<()> {
+    if clear {
+        cache::clear_github_licenses_cache()?;
+        cache::clear_package_cache()?;
+        clear_license_text_cache()?;
+        hook::clear_result_cache()?;
+        repository_license::clear_response_cache()?;
+        policy_server::clear_policy_cache()?;
+        println!("✓ Cache cleared successfully\n");
+    } else {
+        let status = cache::get_cache_status()?;
+        status.print_status();
+    }
+    Ok(())
+}
@@ -0,0 +1,471 @@
+//! Third-party attribution (NOTICE) files
+//!
+//! `feluda attributions` writes one document listing every dependency with its
+//! license, the copyright lines found in its license files and source headers
+//! and the full license text, in a form that can ship alongside a binary. License
+//! texts are read from the installed packages first (`node_modules`, the cargo
+//! registry, the Go module cache) and only fetched from the package's repository
+//! when not found locally. Packages without a text of their own get the standard
+//! SPDX text of their license, which works offline with embedded texts or a
+//! license database.
+
+use colored::*;
+use rayon::prelude::*;
+use std::collections::HashSet;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::cli::{with_spinner, AttributionFormat};
+use crate::copyright::{extract_copyright_lines, merge_copyright_lines, source_header_copyrights};
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::generate::{fetch_actual_license_content, generate_package_url};
+use crate::languages::{go, node, rust};
+use crate::license_detector::find_license_files;
+use crate::license_text::expression_license_text;
+use crate::licenses::LicenseInfo;
+use crate::scan::{scan, ScanOptions};
+
+/// Attribution data for a single dependency
+#[derive(Debug, Clone, PartialEq)]
+pub struct Attribution {
+    pub name: String,
+    pub version: String,
+    pub license: String,
+    /// Copyright lines found in the license and NOTICE files and source headers
+    pub copyright: Vec<String>,
+    /// Full license text, `None` when it could not be found
+    pub license_text: Option<String>,
+    /// Whether `license_text` is the standard SPDX text rather than the package's own copy
+    pub standard_text: bool,
+    /// Contents of the package's NOTICE file, which Apache-2.0 requires to be redistributed
+    pub notice_text: Option<String>,
+}
+
+impl AttributionFormat {
+    /// File written when no `--output` is given
+    pub fn default_file_name(&self) -> &'static str {
+        match self {
+            AttributionFormat::Markdown => "THIRD_PARTY_NOTICES.md",
+            AttributionFormat::Html => "THIRD_PARTY_NOTICES.html",
+            AttributionFormat::Text => "THIRD_PARTY_NOTICES.txt",
+        }
+    }
+}
+
+/// Directory a dependency is installed in, when available locally
+pub fn local_package_dir(project_root: &Path, name: &str, version: &str) -> Option<PathBuf> {
+    if let Some(dir) = node::local_package_dir(project_root, name) {
+        return Some(dir);
+    }
+    if let Some(dir) = rust::registry_source_dir(name, version) {
+        return Some(dir);
+    }
+    go::module_cache_dir(name, version)
+}
+
+/// Concatenate files, labelling each one when there are several
+pub fn read_files(paths: &[PathBuf]) -> Option<String> {
+    let texts: Vec<(String, String)> = paths
+        .iter()
+        .filter_map(|path| {
+            let content = fs::read_to_string(path).ok()?;
+            let name = path.file_name()?.to_string_lossy().to_string();
+            (!content.trim().is_empty()).then(|| (name, content.trim_end().to_string()))
+        })
+        .collect();
+
+    match texts.as_slice() {
+        [] => None,
+        [(_, content)] => Some(content.clone()),
+        _ => Some(
+            texts
+                .iter()
+                .map(|(name, content)| format!("{name}:\n\n{content}"))
+                .collect::<Vec<_>>()
+                .join("\n\n"),
+        ),
+    }
+}
+
+/// Gather license texts and copyright lines for the dependencies
+///
+/// With `fetch` set, license texts missing locally are fetched from the
+/// package's repository.
+pub fn collect_attributions(
+    project_root: &Path,
+    dependencies: &[LicenseInfo],
+    fetch: bool,
+) -> Vec<Attribution> {
+    let mut seen = HashSet::new();
+    let mut unique: Vec<&LicenseInfo> = dependencies
+        .iter()
+        .filter(|info| seen.insert((info.name.as_str(), info.version.as_str())))
+        .collect();
+    unique.sort_by(|a, b| a.name.cmp(&b.name).then(a.version.cmp(&b.version)));
+
+    unique
+        .par_iter()
+        .map(|info| {
+            let dir = local_package_dir(project_root, &info.name, &info.version);
+            let (license_files, notice_files) =
+                dir.as_deref().map(find_license_files).unwrap_or_default();
+
+            let mut license_text = read_files(&license_files);
+            if license_text.is_none() && fetch {
+                license_text = fetch_actual_license_content(&info.name, &info.version);
+            }
+            let mut standard_text = false;
+            if license_text.is_none() {
+                license_text = info.license.as_deref().and_then(expression_license_text);
+                standard_text = license_text.is_some();
+            }
+            if license_text.is_none() {
+                log(
+                    LogLevel::Warn,
+                    &format!("No license text found for {}@{}", info.name, info.version),
+                );
+            }
+            let notice_text = read_files(&notice_files);
+
+            let mut copyright = Vec::new();
+            for text in [&license_text, &notice_text].into_iter().flatten() {
+                merge_copyright_lines(&mut copyright, extract_copyright_lines(text));
+            }
+            if let Some(dir) = &dir {
+                merge_copyright_lines(&mut copyright, source_header_copyrights(dir));
+            }
+
+            Attribution {
+                name: info.name.clone(),
+                version: info.version.clone(),
+                license: info.get_license(),
+                copyright,
+                license_text,
+                standard_text,
+                notice_text,
+            }
+        })
+        .collect()
+}
+
+/// Shortest backtick fence that does not occur in `text`
+fn markdown_fence(text: &str) -> String {
+    let longest = text
+        .split(|c| c != '`')
+        .map(str::len)
+        .max()
+        .unwrap_or_default();
+    "`".repeat(longest.max(2) + 1)
+}
+
+pub fn escape_html(text: &str) -> String {
+    text.replace('&', "&amp;")
+        .replace('<', "&lt;")
+        .replace('>', "&gt;")
+        .replace('"', "&quot;")
+}
+
+fn missing_text_note(attribution: &Attribution) -> String {
+    match generate_package_url(&attribution.name, &attribution.version) {
+        Some(url) => format!("License text not found, see {url}"),
+        None => "License text not found".to_string(),
+    }
+}
+
+fn standard_text_note(attribution: &Attribution) -> String {
+    format!(
+        "Standard text of {}, the package does not include its own copy",
+        attribution.license
+    )
+}
+
+/// Render the attribution document
+pub fn render_attributions(attributions: &[Attribution], format: &AttributionFormat) -> String {
+    match format {
+        AttributionFormat::Markdown => render_markdown(attributions),
+        AttributionFormat::Html => render_html(attributions),
+        AttributionFormat::Text => render_text(attributions),
+    }
+}
+
+const INTRO: &str = "This software includes the following third-party components. \
+Each is subject to its own license terms, reproduced below.";
+
+fn render_markdown(attributions: &[Attribution]) -> String {
+    let mut out = String::from("# Third-Party Notices\n\n");
+    out.push_str(INTRO);
+    out.push_str("\n\n");
+
+    for a in attributions {
+        out.push_str(&format!("- {} {} ({})\n", a.name, a.version, a.license));
+    }
+
+    for a in attributions {
+        out.push_str(&format!("\n---\n\n## {} {}\n\n", a.name, a.version));
+        out.push_str(&format!("**License:** {}\n\n", a.license));
+        for line in &a.copyright {
+            out.push_str(&format!("{line}  \n"));
+        }
+        if !a.copyright.is_empty() {
+            out.push('\n');
+        }
+        match &a.license_text {
+            Some(text) => {
+                if a.standard_text {
+                    out.push_str(&format!("*{}*\n\n", standard_text_note(a)));
+                }
+                let fence = markdown_fence(text);
+                out.push_str(&format!("{fence}\n{text}\n{fence}\n"));
+            }
+            None => out.push_str(&format!("*{}*\n", missing_text_note(a))),
+        }
+        if let Some(notice) = &a.notice_text {
+            let fence = markdown_fence(notice);
+            out.push_str(&format!("\n**NOTICE:**\n\n{fence}\n{notice}\n{fence}\n"));
+        }
+    }
+
+    out.push_str("\n---\n\nGenerated by Feluda (https://github.com/anistark/feluda)\n");
+    out
+}
+
+fn render_html(attributions: &[Attribution]) -> String {
+    let mut out = String::from(
+        "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Third-Party Notices</title>\n</head>\n<body>\n",
+    );
+    out.push_str(&format!(
+        "<h1>Third-Party Notices</h1>\n<p>{INTRO}</p>\n<ul>\n"
+    ));
+    for (index, a) in attributions.iter().enumerate() {
+        out.push_str(&format!(
+            "<li><a href=\"#dep-{index}\">{} {}</a> ({})</li>\n",
+            escape_html(&a.name),
+            escape_html(&a.version),
+            escape_html(&a.license)
+        ));
+    }
+    out.push_str("</ul>\n");
+
+    for (index, a) in attributions.iter().enumerate() {
+        out.push_str(&format!(
+            "<section id=\"dep-{index}\">\n<h2>{} {}</h2>\n<p><strong>License:</strong> {}</p>\n",
+            escape_html(&a.name),
+            escape_html(&a.version),
+            escape_html(&a.license)
+        ));
+        for line in &a.copyright {
+            out.push_str(&format!("<p>{}</p>\n", escape_html(line)));
+        }
+        match &a.license_text {
+            Some(text) => {
+                if a.standard_text {
+                    out.push_str(&format!(
+                        "<p><em>{}</em></p>\n",
+                        escape_html(&standard_text_note(a))
+                    ));
+                }
+                out.push_str(&format!("<pre>{}</pre>\n", escape_html(text)));
+            }
+            None => out.push_str(&format!(
+                "<p><em>{}</em></p>\n",
+                escape_html(&missing_text_note(a))
+            )),
+        }
+        if let Some(notice) = &a.notice_text {
+            out.push_str(&format!(
+                "<h3>NOTICE</h3>\n<pre>{}</pre>\n",
+                escape_html(notice)
+            ));
+        }
+        out.push_str("</section>\n");
+    }
+
+    out.push_str("<p>Generated by <a href=\"https://github.com/anistark/feluda\">Feluda</a></p>\n</body>\n</html>\n");
+    out
+}
+
+fn render_text(attributions: &[Attribution]) -> String {
+    let separator = "=".repeat(80);
+    let mut out = format!("THIRD-PARTY NOTICES\n\n{INTRO}\n\n");
+
+    for a in attributions {
+        out.push_str(&format!(
+            "{separator}\n{} {}\nLicense: {}\n",
+            a.name, a.version, a.license
+        ));
+        for line in &a.copyright {
+            out.push_str(&format!("{line}\n"));
+        }
+        out.push_str(&format!("{separator}\n\n"));
+        match &a.license_text {
+            Some(text) => {
+                if a.standard_text {
+                    out.push_str(&format!("({})\n\n", standard_text_note(a)));
+                }
+                out.push_str(&format!("{text}\n\n"));
+            }
+            None => out.push_str(&format!("{}\n\n", missing_text_note(a))),
+        }
+        if let Some(notice) = &a.notice_text {
+            out.push_str(&format!("NOTICE:\n\n{notice}\n\n"));
+        }
+    }
+
+    out.push_str("Generated by Feluda (https://github.com/anistark/feluda)\n");
+    out
+}
+
+/// Entry point for the attributions command
+pub fn handle_attributions_command(
+    path: String,
+    language: Option<String>,
+    format: AttributionFormat,
+    output: Option<String>,
+    no_fetch: bool,
+) -> FeludaResult<()> {
+    log(
+        LogLevel::Info,
+        &format!("Generating attributions for path: {path}"),
+    );
+
+    let report = scan(
+        &path,
+        &ScanOptions {
+            language,
+            ..ScanOptions::default()
+        },
+    )?;
+
+    if report.dependencies.is_empty() {
+        println!(
+            "{} {}",
+            "⚠️".yellow().bold(),
+            "No dependencies found. Nothing to attribute.".yellow()
+        );
+        return Ok(());
+    }
+
+    let attributions = with_spinner(
+        &format!(
+            "Collecting license texts for {} dependencies",
+            report.dependencies.len()
+        ),
+        |_| collect_attributions(Path::new(&path), &report.dependencies, !no_fetch),
+    );
+    let content = render_attributions(&attributions, &format);
+
+    let file_path = output
+        .map(PathBuf::from)
+        .unwrap_or_else(|| Path::new(&path).join(format.default_file_name()));
+    fs::write(&file_path, content).map_err(|e| {
+        FeludaError::FileWrite(format!("Failed to write {}: {e}", file_path.display()))
+    })?;
+
+    let missing = attributions
+        .iter()
+        .filter(|a| a.license_text.is_none())
+        .count();
+    let standard = attributions.iter().filter(|a| a.standard_text).count();
+    println!(
+        "{} Attributions for {} dependencies written to {}",
+        "✅".green().bold(),
+        attributions.len().to_string().cyan(),
+        file_path.display().to_string().blue()
+    );
+    if standard > 0 {
+        println!(
+            "   📜 Standard SPDX texts used for packages without their own: {}",
+            standard.to_string().cyan()
+        );
+    }
+    if missing > 0 {
+        println!(
+            "   ⚠️  License texts not found: {}",
+            missing.to_string().yellow()
+        );
+        println!(
+            "      {}",
+            "Add the texts for these dependencies manually before shipping the file.".dimmed()
+        );
+    }
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::{LicenseCompatibility, OsiStatus};
+    use tempfile::TempDir;
+
+    fn attribution(license_text: Option<&str>) -> Attribution {
+        Attribution {
+            name: "left-pad".to_string(),
+            version: "1.3.0".to_string(),
+            license: "MIT".to_string(),
+            copyright: vec!["Copyright (c) 2018 A <b> & C".to_string()],
+            license_text: license_text.map(str::to_string),
+            standard_text: false,
+            notice_text: None,
+        }
+    }
+
+    #[test]
+    fn test_collect_attributions_from_node_modules() {
+        let temp_dir = TempDir::new().unwrap();
+        let package_dir = temp_dir.path().join("node_modules").join("left-pad");
+        fs::create_dir_all(&package_dir).unwrap();
+        fs::write(
+            package_dir.join("LICENSE"),
+            "MIT License\n\nCopyright (c) 2018 Jane Doe\n\nPermission is hereby granted...\n",
+        )
+        .unwrap();
+        fs::write(package_dir.join("NOTICE"), "Copyright 2018 Acme Inc.\n").unwrap();
+
+        let dep = LicenseInfo {
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            ..LicenseInfo::test("left-pad", "1.3.0", Some("MIT"))
+        };
+
+        let attributions = collect_attributions(temp_dir.path(), &[dep.clone(), dep], false);
+        assert_eq!(attributions.len(), 1);
+        assert!(attributions[0]
+            .license_text
+            .as_deref()
+            .unwrap()
+            .starts_with("MIT License"));
+        assert_eq!(
+            attributions[0].copyright,
+            vec!["Copyright (c) 2018 Jane Doe", "Copyright 2018 Acme Inc."]
+        );
+        assert_eq!(
+            attributions[0].notice_text.as_deref(),
+            Some("Copyright 2018 Acme Inc.")
+        );
+    }
+
+    #[test]
+    fn test_render_formats() {
+        let found = attribution(Some("Text with ``` inside"));
+        let markdown =
+            render_attributions(std::slice::from_ref(&found), &AttributionFormat::Markdown);
+        assert!(markdown.contains("## left-pad 1.3.0"));
+        assert!(markdown.contains("````\nText with ``` inside\n````"));
+
+        let html = render_attributions(std::slice::from_ref(&found), &AttributionFormat::Html);
+        assert!(html.contains("<p>Copyright (c) 2018 A &lt;b&gt; &amp; C</p>"));
+        assert!(html.contains("<pre>Text with ``` inside</pre>"));
+
+        let text = render_attributions(&[attribution(None)], &AttributionFormat::Text);
+        assert!(text.contains("left-pad 1.3.0\nLicense: MIT\n"));
+        assert!(text.contains("License text not found"));
+
+        let mut standard = attribution(Some("MIT License"));
+        standard.standard_text = true;
+        let markdown = render_attributions(&[standard], &AttributionFormat::Markdown);
+        assert!(
+            markdown.contains("*Standard text of MIT, the package does not include its own copy*")
+        );
+    }
+}
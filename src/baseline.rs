@@ -0,0 +1,303 @@
+//! Baselines of accepted violations (`feluda baseline write`)
+//!
+//! A baseline records the restrictive and incompatible dependencies and the
+//! policy violations of a scan. Later scans of the project only fail on
+//! violations that are not in it, so an existing project can adopt Feluda
+//! without fixing every known issue first. Entries match on the dependency
+//! name, its license and the kind of violation: upgrading a dependency keeps it
+//! suppressed, while a change of license is reported again.
+
+use chrono::Utc;
+use serde::{Deserialize, Serialize};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::policy::PolicyViolation;
+use crate::scan::{scan, Report, ScanOptions};
+
+/// Baseline read from the project directory when `--baseline` is not given
+pub const DEFAULT_BASELINE_FILE: &str = ".feluda-baseline.json";
+
+const BASELINE_VERSION: u32 = 1;
+
+/// What a baseline entry suppresses
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum BaselineKind {
+    /// The dependency's license is restrictive
+    Restrictive,
+    /// The license is incompatible with the project license
+    Incompatible,
+    /// The dependency violates the `[policy]` section
+    Policy,
+}
+
+/// A violation accepted when the baseline was written
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct BaselineEntry {
+    pub name: String,
+    /// Version at the time, for reference; entries match any version
+    pub version: String,
+    pub license: Option<String>,
+    pub kind: BaselineKind,
+}
+
+/// Violations accepted for a project
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Baseline {
+    pub version: u32,
+    /// When the baseline was written, in RFC 3339
+    pub created: String,
+    pub violations: Vec<BaselineEntry>,
+}
+
+impl Baseline {
+    /// Record every violation of a scan
+    pub fn from_report(report: &Report) -> Self {
+        let mut violations = Vec::new();
+        let mut add = |name: &str, version: &str, license: &Option<String>, kind| {
+            let entry = BaselineEntry {
+                name: name.to_string(),
+                version: version.to_string(),
+                license: license.clone(),
+                kind,
+            };
+            if !violations.contains(&entry) {
+                violations.push(entry);
+            }
+        };
+
+        for info in &report.dependencies {
+            if info.is_restrictive {
+                add(
+                    &info.name,
+                    &info.version,
+                    &info.license,
+                    BaselineKind::Restrictive,
+                );
+            }
+            if info.compatibility == LicenseCompatibility::Incompatible {
+                add(
+                    &info.name,
+                    &info.version,
+                    &info.license,
+                    BaselineKind::Incompatible,
+                );
+            }
+        }
+        for violation in &report.policy_violations {
+            add(
+                &violation.name,
+                &violation.version,
+                &violation.license,
+                BaselineKind::Policy,
+            );
+        }
+
+        Self {
+            version: BASELINE_VERSION,
+            created: Utc::now().to_rfc3339(),
+            violations,
+        }
+    }
+
+    /// Read a baseline file
+    pub fn load(path: &Path) -> FeludaResult<Self> {
+        let content = fs::read_to_string(path).map_err(|e| {
+            FeludaError::FileWrite(format!("Failed to read baseline {}: {e}", path.display()))
+        })?;
+        let baseline: Baseline = serde_json::from_str(&content).map_err(|e| {
+            FeludaError::InvalidData(format!("Invalid baseline {}: {e}", path.display()))
+        })?;
+        if baseline.version != BASELINE_VERSION {
+            return Err(FeludaError::InvalidData(format!(
+                "Unsupported baseline version {} in {}",
+                baseline.version,
+                path.display()
+            )));
+        }
+        Ok(baseline)
+    }
+
+    /// Write the baseline as pretty-printed JSON
+    pub fn save(&self, path: &Path) -> FeludaResult<()> {
+        let content = serde_json::to_string_pretty(self).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize baseline: {e}"))
+        })?;
+        fs::write(path, format!("{content}\n")).map_err(|e| {
+            FeludaError::FileWrite(format!("Failed to write baseline {}: {e}", path.display()))
+        })
+    }
+
+    /// Whether a violation of `kind` by this dependency was accepted
+    pub fn suppresses(&self, name: &str, license: Option<&str>, kind: BaselineKind) -> bool {
+        self.violations.iter().any(|entry| {
+            entry.kind == kind && entry.name == name && entry.license.as_deref() == license
+        })
+    }
+
+    /// Drop the policy violations in the baseline, returning how many were dropped
+    pub fn filter_policy_violations(&self, violations: &mut Vec<PolicyViolation>) -> usize {
+        let before = violations.len();
+        violations.retain(|violation| {
+            !self.suppresses(
+                &violation.name,
+                violation.license.as_deref(),
+                BaselineKind::Policy,
+            )
+        });
+        before - violations.len()
+    }
+
+    /// Mark the failed policy decisions in the baseline as waived
+    pub fn waive_explanations(&self, dependencies: &mut [LicenseInfo]) {
+        for info in dependencies {
+            if !self.suppresses(&info.name, info.license.as_deref(), BaselineKind::Policy) {
+                continue;
+            }
+            if let Some(explanation) = &mut info.explanation {
+                explanation.waive_by_baseline();
+            }
+        }
+    }
+}
+
+/// Baseline file for a scan: `file` when given, otherwise the default file in the project
+///
+/// A missing default file means no baseline; a missing `file` is an error.
+pub fn find_baseline(project_path: &Path, file: Option<&str>) -> FeludaResult<Option<Baseline>> {
+    let path = match file {
+        Some(file) => PathBuf::from(file),
+        None => {
+            let path = project_path.join(DEFAULT_BASELINE_FILE);
+            if !path.is_file() {
+                return Ok(None);
+            }
+            path
+        }
+    };
+
+    let baseline = Baseline::load(&path)?;
+    log(
+        LogLevel::Info,
+        &format!(
+            "Using baseline {} with {} accepted violations",
+            path.display(),
+            baseline.violations.len()
+        ),
+    );
+    Ok(Some(baseline))
+}
+
+/// Entry point for `feluda baseline write`
+pub fn handle_baseline_write_command(
+    path: &Path,
+    output: Option<String>,
+    options: &ScanOptions,
+) -> FeludaResult<()> {
+    let report = scan(path, options)?;
+    let baseline = Baseline::from_report(&report);
+
+    let output = output
+        .map(PathBuf::from)
+        .unwrap_or_else(|| path.join(DEFAULT_BASELINE_FILE));
+    baseline.save(&output)?;
+
+    println!(
+        "✓ Baseline written to {} ({} accepted violations)",
+        output.display(),
+        baseline.violations.len()
+    );
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+    use crate::policy::ViolationKind;
+    use tempfile::TempDir;
+
+    fn dep(name: &str, license: &str, restrictive: bool) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: restrictive,
+            compatibility: if restrictive {
+                LicenseCompatibility::Incompatible
+            } else {
+                LicenseCompatibility::Compatible
+            },
+            osi_status: OsiStatus::Approved,
+            ..LicenseInfo::test(name, "1.0.0", Some(license))
+        }
+    }
+
+    fn violation(name: &str, license: &str) -> PolicyViolation {
+        PolicyViolation {
+            name: name.to_string(),
+            version: "1.0.0".to_string(),
+            license: Some(license.to_string()),
+            kind: ViolationKind::Denied,
+            introduced_by: None,
+        }
+    }
+
+    fn report(dependencies: Vec<LicenseInfo>, policy_violations: Vec<PolicyViolation>) -> Report {
+        Report {
+            project_license: Some("MIT".to_string()),
+            dependencies,
+            policy_violations,
+            tiers: Vec::new(),
+            projects: Vec::new(),
+        }
+    }
+
+    #[test]
+    fn test_baseline_suppresses_known_violations() {
+        let old = report(
+            vec![dep("readline", "GPL-3.0", true), dep("serde", "MIT", false)],
+            vec![violation("readline", "GPL-3.0")],
+        );
+        let baseline = Baseline::from_report(&old);
+        assert_eq!(baseline.violations.len(), 3);
+
+        // Any version with the same license is suppressed
+        assert!(baseline.suppresses("readline", Some("GPL-3.0"), BaselineKind::Restrictive));
+        assert!(baseline.suppresses("readline", Some("GPL-3.0"), BaselineKind::Incompatible));
+        assert!(!baseline.suppresses("serde", Some("MIT"), BaselineKind::Restrictive));
+
+        // New dependencies and changed licenses are not
+        assert!(!baseline.suppresses("mysql", Some("GPL-2.0"), BaselineKind::Restrictive));
+        assert!(!baseline.suppresses("readline", Some("AGPL-3.0"), BaselineKind::Restrictive));
+
+        let mut violations = vec![
+            violation("readline", "GPL-3.0"),
+            violation("mysql", "GPL-2.0"),
+        ];
+        assert_eq!(baseline.filter_policy_violations(&mut violations), 1);
+        assert_eq!(violations.len(), 1);
+        assert_eq!(violations[0].name, "mysql");
+    }
+
+    #[test]
+    fn test_find_baseline() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        assert!(find_baseline(root, None).unwrap().is_none());
+        assert!(find_baseline(root, Some("missing.json")).is_err());
+
+        let baseline =
+            Baseline::from_report(&report(vec![dep("readline", "GPL-3.0", true)], Vec::new()));
+        baseline.save(&root.join(DEFAULT_BASELINE_FILE)).unwrap();
+        assert_eq!(find_baseline(root, None).unwrap(), Some(baseline));
+
+        fs::write(
+            root.join("future.json"),
+            r#"{"version": 9, "created": "", "violations": []}"#,
+        )
+        .unwrap();
+        let future = root.join("future.json");
+        assert!(find_baseline(root, future.to_str()).is_err());
+    }
+}
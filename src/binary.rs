@@ -0,0 +1,295 @@
+//! Compiled binary scanning (`feluda binary`)
+//!
+//! Go binaries carry the modules they were built from, the information printed
+//! by `go version -m`. The build info is located by its `\xff Go buildinf:`
+//! header, so ELF, Mach-O and PE binaries are read alike without parsing their
+//! sections. Since Go 1.18 the header is followed by the Go version and the
+//! module list as length-prefixed strings; older binaries store pointers into
+//! the data segment instead and are not supported.
+
+use std::fs;
+use std::path::Path;
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::dependency_submission::format_package_url;
+use crate::languages::go::analyze_go_modules;
+use crate::licenses::LicenseInfo;
+
+const BUILD_INFO_MAGIC: &[u8] = b"\xff Go buildinf:";
+
+/// Size of the header preceding the inline strings
+const BUILD_INFO_HEADER_LEN: usize = 32;
+
+/// Header flag set when the version and module list follow the header
+const FLAG_VERSION_INLINE: u8 = 0x2;
+
+/// Version of modules built from a local directory
+const DEVEL_VERSION: &str = "(devel)";
+
+/// The module list is wrapped in 16 byte sentinels
+const MOD_INFO_SENTINEL_LEN: usize = 16;
+
+/// A module recorded in the build info
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct GoModule {
+    pub path: String,
+    /// `(devel)` for the main module and local directory replacements
+    pub version: String,
+    /// Module replacing this one through a `replace` directive
+    pub replace: Option<Box<GoModule>>,
+}
+
+impl GoModule {
+    /// Whether this is a local directory without a published version
+    fn is_local(&self) -> bool {
+        matches!(self.version.as_str(), "" | DEVEL_VERSION)
+    }
+
+    /// The module whose sources were compiled in, as `(name, version)`
+    ///
+    /// Local directory replacements keep the module name and carry the path in
+    /// place of a version, as for projects.
+    pub fn resolved(&self) -> (String, String) {
+        match self.replace.as_deref() {
+            Some(replace) if replace.is_local() => (self.path.clone(), replace.path.clone()),
+            Some(replace) => (replace.path.clone(), replace.version.clone()),
+            None => (self.path.clone(), self.version.clone()),
+        }
+    }
+}
+
+/// Build info embedded in a Go binary
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct GoBuildInfo {
+    /// Go toolchain the binary was built with, e.g. `go1.22.1`
+    pub go_version: String,
+    /// Package path of the main package
+    pub path: Option<String>,
+    pub main: Option<GoModule>,
+    pub deps: Vec<GoModule>,
+}
+
+/// Read the build info of the Go binary at `path`
+pub fn read_go_build_info(path: &Path) -> FeludaResult<GoBuildInfo> {
+    let data = fs::read(path).map_err(|e| {
+        FeludaError::InvalidData(format!("Failed to read binary {}: {e}", path.display()))
+    })?;
+    let (go_version, mod_info) = find_build_info(&data)
+        .map_err(|e| FeludaError::InvalidData(format!("{}: {e}", path.display())))?;
+
+    let mut info = parse_mod_info(&mod_info);
+    info.go_version = go_version;
+    Ok(info)
+}
+
+/// The Go version and module list following the build info header
+///
+/// The header starts the 16 byte aligned `.go.buildinfo` section. Binaries
+/// that read build info themselves, like the `go` command, also contain the
+/// magic as a string constant, which is skipped by checking the alignment and
+/// the pointer size that follows.
+fn find_build_info(data: &[u8]) -> Result<(String, String), String> {
+    let start = (0..data.len().saturating_sub(BUILD_INFO_HEADER_LEN))
+        .step_by(16)
+        .find(|&offset| {
+            data[offset..].starts_with(BUILD_INFO_MAGIC)
+                && matches!(data[offset + BUILD_INFO_MAGIC.len()], 4 | 8)
+        })
+        .ok_or("not a Go binary, or built without module support")?;
+    let header = &data[start..start + BUILD_INFO_HEADER_LEN];
+    if header[BUILD_INFO_MAGIC.len() + 1] & FLAG_VERSION_INLINE == 0 {
+        return Err("built with a Go version before 1.18, which is not supported".to_string());
+    }
+
+    let mut rest = &data[start + BUILD_INFO_HEADER_LEN..];
+    let version = read_string(&mut rest).ok_or("truncated Go version in build info")?;
+    let mod_info = read_string(&mut rest).ok_or("truncated module list in build info")?;
+
+    // Sentinels surround the module list when there is one
+    let mod_info = if mod_info.len() > 2 * MOD_INFO_SENTINEL_LEN
+        && mod_info[mod_info.len() - MOD_INFO_SENTINEL_LEN - 1] == b'\n'
+    {
+        &mod_info[MOD_INFO_SENTINEL_LEN..mod_info.len() - MOD_INFO_SENTINEL_LEN]
+    } else {
+        mod_info
+    };
+
+    Ok((
+        String::from_utf8_lossy(version).into_owned(),
+        String::from_utf8_lossy(mod_info).into_owned(),
+    ))
+}
+
+/// Read a string prefixed with its length as an unsigned varint
+fn read_string<'a>(data: &mut &'a [u8]) -> Option<&'a [u8]> {
+    let mut len: u64 = 0;
+    let mut shift = 0;
+    let mut read = 0;
+    loop {
+        let byte = *data.get(read)?;
+        read += 1;
+        len |= u64::from(byte & 0x7f) << shift;
+        if byte & 0x80 == 0 {
+            break;
+        }
+        shift += 7;
+        if shift >= 64 {
+            return None;
+        }
+    }
+
+    let len = usize::try_from(len).ok()?;
+    let value = data.get(read..read.checked_add(len)?)?;
+    *data = &data[read + len..];
+    Some(value)
+}
+
+/// Parse the module list, one tab-separated record per line as in `go version -m`
+fn parse_mod_info(mod_info: &str) -> GoBuildInfo {
+    let mut info = GoBuildInfo::default();
+    for line in mod_info.lines() {
+        let fields: Vec<&str> = line.split('\t').collect();
+        let field = |index: usize| fields.get(index).copied().unwrap_or_default().to_string();
+        let module = || GoModule {
+            path: field(1),
+            version: field(2),
+            replace: None,
+        };
+        match fields[0] {
+            "path" => info.path = Some(field(1)),
+            "mod" => info.main = Some(module()),
+            "dep" => info.deps.push(module()),
+            // A replacement applies to the dependency on the line before
+            "=>" => {
+                if let Some(replaced) = info.deps.last_mut() {
+                    replaced.replace = Some(Box::new(module()));
+                }
+            }
+            _ => {}
+        }
+    }
+    info
+}
+
+/// Analyze the licenses of the modules compiled into a Go binary
+pub fn analyze_go_binary(path: &Path, config: &FeludaConfig) -> FeludaResult<Vec<LicenseInfo>> {
+    log(
+        LogLevel::Info,
+        &format!("Reading Go build info from {}", path.display()),
+    );
+    let info = read_go_build_info(path)?;
+    log(
+        LogLevel::Info,
+        &format!(
+            "{} was built with {} from {} and embeds {} modules",
+            path.display(),
+            info.go_version,
+            info.main
+                .as_ref()
+                .map_or("an unknown module", |main| main.path.as_str()),
+            info.deps.len()
+        ),
+    );
+
+    let modules: Vec<(String, String)> = info.deps.iter().map(GoModule::resolved).collect();
+    let mut dependencies = analyze_go_modules(modules, config);
+    let source_file = path.to_string_lossy().to_string();
+    for dependency in &mut dependencies {
+        dependency.source_file = Some(source_file.clone());
+        dependency.purl = format_package_url("golang", &dependency.name, &dependency.version);
+    }
+    Ok(dependencies)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Append `value` with its length as a varint
+    fn push_string(data: &mut Vec<u8>, value: &[u8]) {
+        let mut len = value.len();
+        while len >= 0x80 {
+            data.push((len as u8 & 0x7f) | 0x80);
+            len >>= 7;
+        }
+        data.push(len as u8);
+        data.extend_from_slice(value);
+    }
+
+    fn binary(mod_info: &str) -> Vec<u8> {
+        let mut data = b"\x7fELF, then the magic as a constant \xff Go buildinf: ".to_vec();
+        data.resize(64, 0);
+        data.extend_from_slice(BUILD_INFO_MAGIC);
+        data.push(8);
+        data.push(FLAG_VERSION_INLINE);
+        data.resize(
+            data.len() + BUILD_INFO_HEADER_LEN - BUILD_INFO_MAGIC.len() - 2,
+            0,
+        );
+        push_string(&mut data, b"go1.22.1");
+
+        let mut wrapped = vec![0x30; MOD_INFO_SENTINEL_LEN];
+        wrapped.extend_from_slice(mod_info.as_bytes());
+        wrapped.extend_from_slice(&[0xf9; MOD_INFO_SENTINEL_LEN]);
+        push_string(&mut data, &wrapped);
+        data.extend_from_slice(b"trailing data");
+        data
+    }
+
+    const MOD_INFO: &str = "path\texample.com/app/cmd/app
+mod\texample.com/app\t(devel)\t
+dep\tgithub.com/spf13/cobra\tv1.8.0\th1:7aJaZx1B85qltLMc546zn58BxxfZdR/W22ej9CFoEf0=
+dep\tgolang.org/x/text\tv0.14.0\th1:ScX5w1eTa3QqT8oi6+ziP7dTV1S2+ALU0bI+0zXKWiQ=
+=>\tgithub.com/fork/text\tv0.14.1\th1:abc=
+dep\texample.com/internal\tv0.0.0-00010101000000-000000000000\t
+=>\t../internal\t(devel)\t
+build\t-compiler=gc
+build\tGOOS=linux
+";
+
+    #[test]
+    fn test_find_build_info() {
+        let (version, mod_info) = find_build_info(&binary(MOD_INFO)).unwrap();
+        assert_eq!(version, "go1.22.1");
+        assert_eq!(mod_info, MOD_INFO);
+
+        assert!(find_build_info(b"\x7fELF not go").is_err());
+
+        let mut old = binary(MOD_INFO);
+        let flags = old
+            .windows(BUILD_INFO_MAGIC.len())
+            .rposition(|w| w == BUILD_INFO_MAGIC)
+            .unwrap()
+            + BUILD_INFO_MAGIC.len()
+            + 1;
+        old[flags] = 0;
+        assert!(find_build_info(&old).unwrap_err().contains("1.18"));
+    }
+
+    #[test]
+    fn test_read_go_build_info() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let path = temp_dir.path().join("app");
+        fs::write(&path, binary(MOD_INFO)).unwrap();
+
+        let info = read_go_build_info(&path).unwrap();
+        assert_eq!(info.go_version, "go1.22.1");
+        assert_eq!(info.path.as_deref(), Some("example.com/app/cmd/app"));
+        assert_eq!(info.main.unwrap().version, "(devel)");
+        assert_eq!(info.deps.len(), 3);
+
+        let resolved: Vec<_> = info.deps.iter().map(GoModule::resolved).collect();
+        assert_eq!(
+            resolved,
+            vec![
+                ("github.com/spf13/cobra".to_string(), "v1.8.0".to_string()),
+                ("github.com/fork/text".to_string(), "v0.14.1".to_string()),
+                (
+                    "example.com/internal".to_string(),
+                    "../internal".to_string()
+                ),
+            ]
+        );
+    }
+}
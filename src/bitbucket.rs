@@ -0,0 +1,197 @@
+//! Bitbucket Code Insights report
+//!
+//! Bitbucket shows Code Insights reports and their annotations on the commit and
+//! in the pull request diff. The output holds both parts of the upload: the
+//! `report` is sent with `PUT .../commit/{commit}/reports/feluda` and the
+//! `annotations`, one per restrictive or incompatible dependency, with
+//! `POST .../reports/feluda/annotations`.
+
+use serde::Serialize;
+
+use crate::licenses::LicenseInfo;
+use crate::reporter::{introduced_by_suffix, license_violations, LicenseViolation};
+
+/// Bitbucket keeps at most this many annotations per report
+const MAX_ANNOTATIONS: usize = 1000;
+
+/// Summaries longer than this are rejected by the API
+const MAX_SUMMARY_LEN: usize = 450;
+
+#[derive(Serialize, Debug)]
+pub struct CodeInsights {
+    pub report: InsightsReport,
+    pub annotations: Vec<InsightsAnnotation>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct InsightsReport {
+    pub title: String,
+    pub details: String,
+    pub report_type: String,
+    pub reporter: String,
+    pub link: String,
+    pub result: String,
+    pub data: Vec<InsightsData>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct InsightsData {
+    pub title: String,
+    #[serde(rename = "type")]
+    pub data_type: String,
+    pub value: serde_json::Value,
+}
+
+#[derive(Serialize, Debug)]
+pub struct InsightsAnnotation {
+    pub external_id: String,
+    pub annotation_type: String,
+    pub summary: String,
+    pub details: String,
+    pub path: String,
+    pub severity: String,
+    pub result: String,
+}
+
+/// Build the report and annotations from the [`license_violations`] of
+/// analyzed dependencies
+pub fn build_code_insights(
+    license_info: &[LicenseInfo],
+    project_license: Option<&str>,
+) -> CodeInsights {
+    let violations = license_violations(license_info, project_license);
+    let count = |kind: LicenseViolation| violations.iter().filter(|(k, _)| *k == kind).count();
+    let restrictive = count(LicenseViolation::Restrictive);
+    let incompatible = count(LicenseViolation::Incompatible);
+
+    let annotations = violations
+        .into_iter()
+        .take(MAX_ANNOTATIONS)
+        .map(|(kind, info)| annotation(info, kind, project_license))
+        .collect();
+
+    let passed = restrictive == 0 && incompatible == 0;
+    let details = if passed {
+        "No restrictive or incompatible licenses found.".to_string()
+    } else {
+        format!(
+            "{restrictive} restrictive and {incompatible} incompatible dependencies out of {}.",
+            license_info.len()
+        )
+    };
+    let mut data = vec![
+        number("Dependencies", license_info.len()),
+        number("Restrictive", restrictive),
+    ];
+    if project_license.is_some() {
+        data.push(number("Incompatible", incompatible));
+    }
+
+    CodeInsights {
+        report: InsightsReport {
+            title: "Feluda license check".to_string(),
+            details,
+            report_type: "SECURITY".to_string(),
+            reporter: "feluda".to_string(),
+            link: env!("CARGO_PKG_REPOSITORY").to_string(),
+            result: if passed { "PASSED" } else { "FAILED" }.to_string(),
+            data,
+        },
+        annotations,
+    }
+}
+
+fn annotation(
+    info: &LicenseInfo,
+    kind: LicenseViolation,
+    project_license: Option<&str>,
+) -> InsightsAnnotation {
+    let (name, severity) = match kind {
+        LicenseViolation::Restrictive => ("restrictive", "MEDIUM"),
+        LicenseViolation::Incompatible => ("incompatible", "HIGH"),
+    };
+    let summary = kind.message(info, project_license);
+    let details = format!("{summary}{}", introduced_by_suffix(info));
+    InsightsAnnotation {
+        external_id: format!("feluda-{name}-{}-{}", info.name, info.version),
+        annotation_type: "VULNERABILITY".to_string(),
+        summary: truncate(summary, MAX_SUMMARY_LEN),
+        details,
+        path: info.source_file.clone().unwrap_or_default(),
+        severity: severity.to_string(),
+        result: "FAILED".to_string(),
+    }
+}
+
+fn number(title: &str, value: usize) -> InsightsData {
+    InsightsData {
+        title: title.to_string(),
+        data_type: "NUMBER".to_string(),
+        value: value.into(),
+    }
+}
+
+fn truncate(mut text: String, max_len: usize) -> String {
+    if text.len() > max_len {
+        let mut end = max_len - 1;
+        while !text.is_char_boundary(end) {
+            end -= 1;
+        }
+        text.truncate(end);
+        text.push('…');
+    }
+    text
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::{LicenseCompatibility, OsiStatus};
+
+    fn dep(name: &str, license: &str, restrictive: bool) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            source_file: Some("Cargo.toml".to_string()),
+            ..LicenseInfo::test(name, "1.0.0", Some(license))
+        }
+    }
+
+    #[test]
+    fn test_build_code_insights() {
+        let mut copyleft = dep("copyleft", "AGPL-3.0", true);
+        copyleft.compatibility = LicenseCompatibility::Incompatible;
+        copyleft.dependency_path =
+            Some(vec!["app@1.0.0".to_string(), "copyleft@1.0.0".to_string()]);
+        let data = vec![dep("serde", "MIT", false), copyleft];
+
+        let insights = build_code_insights(&data, Some("MIT"));
+        assert_eq!(insights.report.result, "FAILED");
+        assert_eq!(insights.report.data.len(), 3);
+
+        let json = serde_json::to_value(&insights).unwrap();
+        assert_eq!(json["report"]["data"][1]["type"], "NUMBER");
+        assert_eq!(json["report"]["data"][1]["value"], 1);
+
+        assert_eq!(insights.annotations.len(), 2);
+        let restrictive = &insights.annotations[0];
+        assert_eq!(restrictive.external_id, "feluda-restrictive-copyleft-1.0.0");
+        assert_eq!(restrictive.severity, "MEDIUM");
+        assert_eq!(restrictive.path, "Cargo.toml");
+        assert!(restrictive.details.contains("app@1.0.0"));
+        assert_eq!(insights.annotations[1].severity, "HIGH");
+
+        // Without a project license there is no Incompatible metric
+        let insights = build_code_insights(&data, None);
+        assert_eq!(insights.annotations.len(), 1);
+        assert_eq!(insights.report.data.len(), 2);
+    }
+
+    #[test]
+    fn test_build_code_insights_passed() {
+        let insights = build_code_insights(&[dep("serde", "MIT", false)], Some("MIT"));
+        assert_eq!(insights.report.result, "PASSED");
+        assert!(insights.annotations.is_empty());
+    }
+}
@@ -0,0 +1,672 @@
+//! Built JavaScript bundle scanning (`feluda bundle`)
+//!
+//! Libraries copied from a CDN or pasted in as snippets never appear in
+//! `package.json`, but two kinds of evidence survive bundling and minification:
+//!
+//! - Preserved license comments, `/*! ... */` and comments tagged `@license` or
+//!   `@preserve`, which bundlers keep by default. webpack moves them to a
+//!   `<bundle>.LICENSE.txt` file, which is read as well.
+//! - Source maps, whose `sources` list the `node_modules` files a bundle was
+//!   built from, including pnpm store paths that carry the version.
+//!
+//! Comments usually name the library, its version and license. Libraries found
+//! without a license are looked up like npm dependencies, from `node_modules`
+//! of the project directory first, then the registry.
+
+use ignore::WalkBuilder;
+use regex::Regex;
+use serde_json::Value;
+use std::collections::{BTreeMap, HashMap};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::OnceLock;
+
+use crate::config::FeludaConfig;
+use crate::credentials::decode_base64;
+use crate::debug::{log, log_error, time_dependency, FeludaError, FeludaResult, LogLevel};
+use crate::dependency_submission::format_package_url;
+use crate::languages::node::get_license_for_package;
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::source_headers::header_license;
+
+/// File extensions of JavaScript bundles
+const BUNDLE_EXTENSIONS: [&str; 3] = ["js", "mjs", "cjs"];
+
+/// Version of a library whose version isn't recorded anywhere
+const UNKNOWN_VERSION: &str = "unknown";
+
+/// Words that start a comment line without naming a library
+const NOT_LIBRARY_NAMES: [&str; 12] = [
+    "copyright",
+    "licensed",
+    "released",
+    "license",
+    "the",
+    "this",
+    "all",
+    "see",
+    "for",
+    "based",
+    "author",
+    "version",
+];
+
+/// License names used in banners, matched in this order
+const BANNER_LICENSES: [(&str, &str); 16] = [
+    (
+        "Apache-2.0",
+        r"(?i)\bApache(?:[- ]License)?,?[- ](?:Version[ ]?|v)?2(?:\.0)?\b",
+    ),
+    ("MPL-2.0", r"(?i)\bMPL[- ]?2(?:\.0)?\b"),
+    ("AGPL-3.0", r"\bAGPL[- ]?v?3"),
+    ("LGPL-3.0", r"\bLGPL[- ]?v?3"),
+    ("LGPL-2.1", r"\bLGPL[- ]?v?2\.1"),
+    (
+        "GPL-3.0",
+        r"\bGPL[- ]?v?3|GNU General Public License,? v(?:ersion)? ?3",
+    ),
+    (
+        "GPL-2.0",
+        r"\bGPL[- ]?v?2|GPL Version 2|GNU General Public License,? v(?:ersion)? ?2",
+    ),
+    (
+        "BSD-3-Clause",
+        r"(?i)\bBSD-3-Clause\b|3-clause BSD|\bnew BSD",
+    ),
+    (
+        "BSD-2-Clause",
+        r"(?i)\bBSD-2-Clause\b|2-clause BSD|simplified BSD",
+    ),
+    ("0BSD", r"\b0BSD\b"),
+    ("ISC", r"\bISC\b"),
+    ("Unlicense", r"\b(?:The )?Unlicense\b"),
+    ("CC0-1.0", r"\bCC0\b"),
+    ("WTFPL", r"\bWTFPL\b"),
+    ("Zlib", r"\bzlib License\b"),
+    ("MIT", r"\bMIT\b"),
+];
+
+/// How a library was found in a bundle
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Evidence {
+    LicenseComment,
+    SourceMap,
+}
+
+/// A third-party library found in a bundle
+#[derive(Debug, Clone, PartialEq)]
+pub struct BundledLibrary {
+    /// npm package name, or the lowercase name from a license comment
+    pub name: String,
+    pub version: Option<String>,
+    /// License named in the comment
+    pub license: Option<String>,
+    /// Confidence of a license classified from comment text
+    pub license_confidence: Option<f32>,
+    /// Bundle the library was found in
+    pub bundle: PathBuf,
+    pub evidence: Evidence,
+}
+
+fn comment_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| Regex::new(r"(?s)/\*(.*?)\*/").expect("valid comment pattern"))
+}
+
+fn banner_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| {
+        Regex::new(r"^([A-Za-z@][\w.@/-]*?)(?:\s+-)?\s+v?(\d+\.\d+(?:\.\d+)?(?:-[0-9A-Za-z.]+)?)\b")
+            .expect("valid banner pattern")
+    })
+}
+
+fn name_only_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| {
+        Regex::new(r"^([A-Za-z@][\w.@/-]*?)(?:\s+<[^>]*>|\s+\||\s+-\s|\s*$)")
+            .expect("valid banner name pattern")
+    })
+}
+
+fn extracted_comments_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| {
+        Regex::new(r"For license information please see (\S+?)\s*$")
+            .expect("valid extracted comments pattern")
+    })
+}
+
+fn source_map_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| {
+        Regex::new(r"[#@]\s*sourceMappingURL=(\S+)").expect("valid sourceMappingURL pattern")
+    })
+}
+
+fn banner_license_patterns() -> &'static [(&'static str, Regex)] {
+    static PATTERNS: OnceLock<Vec<(&str, Regex)>> = OnceLock::new();
+    PATTERNS.get_or_init(|| {
+        BANNER_LICENSES
+            .iter()
+            .map(|(id, pattern)| {
+                (
+                    *id,
+                    Regex::new(pattern).expect("valid banner license pattern"),
+                )
+            })
+            .collect()
+    })
+}
+
+/// Preserved license comments of a bundle, without the comment markers
+pub fn license_comments(content: &str) -> Vec<String> {
+    comment_pattern()
+        .captures_iter(content)
+        .map(|captures| captures.get(1).map_or("", |m| m.as_str()))
+        .filter(|inner| {
+            inner.starts_with('!') || inner.contains("@license") || inner.contains("@preserve")
+        })
+        .map(|inner| {
+            inner
+                .lines()
+                .map(|line| line.trim().trim_start_matches(['*', '!']).trim())
+                .filter(|line| !line.is_empty())
+                .collect::<Vec<_>>()
+                .join("\n")
+        })
+        .filter(|text| !text.is_empty())
+        .collect()
+}
+
+fn library_name(name: &str) -> Option<String> {
+    let name = name.trim_end_matches(['.', ',', ':']).to_lowercase();
+    let is_license = banner_license_patterns()
+        .iter()
+        .any(|(id, _)| id.eq_ignore_ascii_case(&name));
+    (!name.is_empty() && !is_license && !NOT_LIBRARY_NAMES.contains(&name.as_str())).then_some(name)
+}
+
+/// Library name and version from the first lines of a license comment
+pub fn parse_banner(text: &str) -> Option<(String, Option<String>)> {
+    let mut lines = text
+        .lines()
+        .map(|line| {
+            line.trim_start_matches("@license")
+                .trim_start_matches("@preserve")
+                .trim()
+        })
+        .filter(|line| !line.is_empty())
+        .take(3)
+        .peekable();
+    let first = *lines.peek()?;
+
+    for line in lines {
+        if let Some(captures) = banner_pattern().captures(line) {
+            if let Some(name) = library_name(&captures[1]) {
+                return Some((name, Some(captures[2].to_string())));
+            }
+        }
+    }
+    let captures = name_only_pattern().captures(first)?;
+    library_name(&captures[1]).map(|name| (name, None))
+}
+
+/// License of a comment: an SPDX tag, a full license text or the names it mentions
+///
+/// Several licenses are alternatives, as in "Dual licensed under the MIT or
+/// GPL Version 2 licenses".
+pub fn comment_license(text: &str) -> (Option<String>, Option<f32>) {
+    if let Some((license, _, confidence)) = header_license(text) {
+        return (Some(license), confidence);
+    }
+
+    let mut found: Vec<(usize, &str)> = banner_license_patterns()
+        .iter()
+        .filter_map(|(id, pattern)| pattern.find(text).map(|m| (m.start(), *id)))
+        .collect();
+    found.sort();
+    let ids: Vec<&str> = found.into_iter().map(|(_, id)| id).collect();
+    if ids.is_empty() {
+        (None, None)
+    } else {
+        (Some(ids.join(" OR ")), None)
+    }
+}
+
+/// npm package and, for pnpm and Yarn store paths, version of a source map entry
+pub fn source_package(source: &str) -> Option<(String, Option<String>)> {
+    let source = source.replace('\\', "/");
+    let index = source.rfind("node_modules/")?;
+    let mut segments = source[index + "node_modules/".len()..].split('/');
+    let first = segments.next().filter(|segment| !segment.is_empty())?;
+    let name = if first.starts_with('@') {
+        format!("{first}/{}", segments.next()?)
+    } else {
+        first.to_string()
+    };
+    if name.starts_with('.') {
+        return None;
+    }
+
+    let store = &source[..index];
+    let version = if let Some(pnpm) = store.rfind(".pnpm/") {
+        // .pnpm/@scope+name@1.2.3_peer@4.5.6/node_modules/@scope/name
+        let entry = store[pnpm + ".pnpm/".len()..].split('/').next()?;
+        let entry = entry.split(['_', '(']).next()?;
+        entry
+            .rsplit_once('@')
+            .filter(|(stored, _)| stored.replace('+', "/") == name)
+            .map(|(_, version)| version.to_string())
+    } else if let Some(marker) = store.find("-npm-") {
+        // .yarn/cache/name-npm-1.2.3-0123456789.zip/node_modules/name
+        let rest = &store[marker + "-npm-".len()..];
+        rest.rsplit_once('-')
+            .map(|(version, _)| version.to_string())
+    } else {
+        None
+    };
+    Some((name, version))
+}
+
+/// Source map of a bundle, inline, referenced or next to it as `<bundle>.map`
+fn read_source_map(bundle: &Path, content: &str) -> Option<Value> {
+    let reference = source_map_pattern()
+        .captures_iter(content)
+        .last()
+        .map(|captures| captures[1].to_string());
+
+    let map = match reference.as_deref() {
+        Some(data) if data.starts_with("data:") => {
+            let (header, payload) = data.split_once(',')?;
+            if header.ends_with(";base64") {
+                decode_base64(payload)?
+            } else {
+                payload.to_string()
+            }
+        }
+        Some(url) if url.contains("://") => return None,
+        Some(file) => {
+            let file = file.split(['?', '#']).next().unwrap_or(file);
+            fs::read_to_string(bundle.parent()?.join(file)).ok()?
+        }
+        None => {
+            let mut path = bundle.as_os_str().to_owned();
+            path.push(".map");
+            fs::read_to_string(PathBuf::from(path)).ok()?
+        }
+    };
+    serde_json::from_str(&map)
+        .inspect_err(|e| {
+            log(
+                LogLevel::Warn,
+                &format!("Invalid source map for {}: {e}", bundle.display()),
+            )
+        })
+        .ok()
+}
+
+/// Libraries found in one bundle
+pub fn scan_bundle(bundle: &Path, content: &str) -> Vec<BundledLibrary> {
+    let mut comments = license_comments(content);
+    // webpack replaces the comments with a pointer to the file it moved them to
+    let extracted: Vec<String> = comments
+        .iter()
+        .filter_map(|text| extracted_comments_pattern().captures(text))
+        .map(|captures| captures[1].to_string())
+        .collect();
+    let mut license_files: Vec<PathBuf> = extracted
+        .iter()
+        .filter_map(|file| bundle.parent().map(|dir| dir.join(file)))
+        .collect();
+    let mut default_file = bundle.as_os_str().to_owned();
+    default_file.push(".LICENSE.txt");
+    license_files.push(PathBuf::from(default_file));
+    license_files.dedup();
+    for file in license_files {
+        if let Ok(text) = fs::read_to_string(&file) {
+            comments.extend(license_comments(&text));
+        }
+    }
+
+    let mut libraries: Vec<BundledLibrary> = comments
+        .iter()
+        .filter(|text| !extracted_comments_pattern().is_match(text))
+        .filter_map(|text| {
+            let (name, version) = parse_banner(text)?;
+            let (license, license_confidence) = comment_license(text);
+            Some(BundledLibrary {
+                name,
+                version,
+                license,
+                license_confidence,
+                bundle: bundle.to_path_buf(),
+                evidence: Evidence::LicenseComment,
+            })
+        })
+        .collect();
+
+    if let Some(map) = read_source_map(bundle, content) {
+        let sources = map["sources"].as_array().into_iter().flatten();
+        for (name, version) in sources.filter_map(|source| source_package(source.as_str()?)) {
+            libraries.push(BundledLibrary {
+                name,
+                version,
+                license: None,
+                license_confidence: None,
+                bundle: bundle.to_path_buf(),
+                evidence: Evidence::SourceMap,
+            });
+        }
+    }
+    libraries
+}
+
+/// Merge the findings for each library, preferring license comments
+///
+/// A library seen without a version is merged into the versioned entries of
+/// the same name, if there are any.
+pub fn merge_libraries(found: Vec<BundledLibrary>) -> Vec<BundledLibrary> {
+    let mut merged: BTreeMap<(String, Option<String>), BundledLibrary> = BTreeMap::new();
+    let (versioned, unversioned): (Vec<_>, Vec<_>) = found
+        .into_iter()
+        .partition(|library| library.version.is_some());
+
+    for library in versioned.into_iter().chain(unversioned) {
+        let key = (library.name.clone(), library.version.clone());
+        let target = if library.version.is_none() {
+            merged
+                .iter_mut()
+                .find(|((name, _), _)| *name == library.name)
+                .map(|(_, existing)| existing)
+        } else {
+            merged.get_mut(&key)
+        };
+        match target {
+            Some(existing) => {
+                if existing.license.is_none() {
+                    existing.license = library.license;
+                    existing.license_confidence = library.license_confidence;
+                }
+            }
+            None => {
+                merged.insert(key, library);
+            }
+        }
+    }
+    merged.into_values().collect()
+}
+
+/// Bundles at `path`: the file itself, or the JavaScript files below a directory
+///
+/// Ignore files are not honoured, since build output is usually ignored.
+fn bundle_files(path: &Path) -> Vec<PathBuf> {
+    if path.is_file() {
+        return vec![path.to_path_buf()];
+    }
+    let walker = WalkBuilder::new(path)
+        .standard_filters(false)
+        .filter_entry(|entry| entry.file_name() != "node_modules")
+        .build();
+
+    let mut files = Vec::new();
+    for entry in walker {
+        match entry {
+            Ok(entry) => {
+                let is_bundle = entry.path().extension().is_some_and(|extension| {
+                    BUNDLE_EXTENSIONS.contains(&extension.to_str().unwrap_or_default())
+                });
+                if is_bundle
+                    && entry
+                        .file_type()
+                        .is_some_and(|file_type| file_type.is_file())
+                {
+                    files.push(entry.into_path());
+                }
+            }
+            Err(err) => log_error("Failed to read directory", &err),
+        }
+    }
+    files.sort();
+    files
+}
+
+/// Version of a library installed in the project, from its `package.json`
+fn installed_version(project_dir: &Path, name: &str) -> Option<String> {
+    let manifest = project_dir
+        .join("node_modules")
+        .join(name)
+        .join("package.json");
+    let json: Value = serde_json::from_str(&fs::read_to_string(manifest).ok()?).ok()?;
+    json["version"].as_str().map(str::to_string)
+}
+
+/// Analyze the licenses of the libraries bundled into the JavaScript at `path`
+///
+/// `project_dir` is searched for installed packages.
+pub fn analyze_bundles(
+    path: &Path,
+    project_dir: &Path,
+    config: &FeludaConfig,
+) -> FeludaResult<Vec<LicenseInfo>> {
+    if !path.exists() {
+        return Err(FeludaError::InvalidData(format!(
+            "Bundle {} does not exist",
+            path.display()
+        )));
+    }
+
+    let mut found = Vec::new();
+    let files = bundle_files(path);
+    for file in &files {
+        match fs::read(file) {
+            Ok(content) => found.extend(scan_bundle(file, &String::from_utf8_lossy(&content))),
+            Err(err) => log_error(&format!("Failed to read {}", file.display()), &err),
+        }
+    }
+    let libraries = merge_libraries(found);
+    log(
+        LogLevel::Info,
+        &format!(
+            "Found {} libraries in {} bundles under {}",
+            libraries.len(),
+            files.len(),
+            path.display()
+        ),
+    );
+
+    let known_licenses = fetch_licenses_from_github().unwrap_or_else(|err| {
+        log_error("Failed to fetch licenses from GitHub", &err);
+        HashMap::new()
+    });
+
+    Ok(libraries
+        .into_iter()
+        .map(|library| {
+            let version = library
+                .version
+                .clone()
+                .or_else(|| installed_version(project_dir, &library.name));
+            let (license, license_confidence) = match library.license {
+                Some(license) => (license, library.license_confidence),
+                None => {
+                    let lookup_version = version.as_deref().unwrap_or("latest");
+                    time_dependency("npm", &library.name, lookup_version, || {
+                        get_license_for_package(project_dir, &library.name, lookup_version, false)
+                    })
+                }
+            };
+            let license = Some(license);
+            let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
+            if is_restrictive {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "Restrictive license found: {license:?} for {}",
+                        library.name
+                    ),
+                );
+            }
+            let bundle = library
+                .bundle
+                .strip_prefix(project_dir)
+                .unwrap_or(&library.bundle)
+                .to_string_lossy()
+                .replace('\\', "/");
+            let purl =
+                format_package_url("npm", &library.name, version.as_deref().unwrap_or_default());
+
+            LicenseInfo {
+                name: library.name,
+                version: version.unwrap_or_else(|| UNKNOWN_VERSION.to_string()),
+                osi_status: match &license {
+                    Some(l) => crate::licenses::get_osi_status(l),
+                    None => crate::licenses::OsiStatus::Unknown,
+                },
+                license,
+                is_restrictive,
+                compatibility: LicenseCompatibility::Unknown,
+                license_confidence,
+                source_file: Some(bundle),
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: DependencyScope::Runtime,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
+            }
+        })
+        .collect())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_parse_license_comments() {
+        let bundle = concat!(
+            "/*! jQuery v3.7.1 | (c) OpenJS Foundation and other contributors | jquery.org/license */\n",
+            "!function(e){/* not a license */}(this);\n",
+            "/**\n * @license React\n * react.production.min.js\n *\n",
+            " * Copyright (c) Facebook, Inc. and its affiliates.\n *\n",
+            " * This source code is licensed under the MIT license found in the\n",
+            " * LICENSE file in the root directory of this source tree.\n */\n",
+            "/*!\n * Vue.js v2.6.14\n * (c) 2014-2021 Evan You\n * Released under the MIT License.\n */\n",
+            "/*! Dual licensed under the MIT or GPL Version 2 licenses. */\n",
+        );
+        let comments = license_comments(bundle);
+        assert_eq!(comments.len(), 4);
+
+        assert_eq!(
+            parse_banner(&comments[0]),
+            Some(("jquery".to_string(), Some("3.7.1".to_string())))
+        );
+        assert_eq!(comment_license(&comments[0]), (None, None));
+
+        assert_eq!(
+            parse_banner(&comments[1]),
+            Some(("react".to_string(), None))
+        );
+        assert_eq!(comment_license(&comments[1]).0.as_deref(), Some("MIT"));
+
+        assert_eq!(
+            parse_banner(&comments[2]),
+            Some(("vue.js".to_string(), Some("2.6.14".to_string())))
+        );
+        assert_eq!(comment_license(&comments[2]).0.as_deref(), Some("MIT"));
+
+        assert_eq!(parse_banner(&comments[3]), None);
+        assert_eq!(
+            comment_license(&comments[3]).0.as_deref(),
+            Some("MIT OR GPL-2.0")
+        );
+
+        assert_eq!(parse_banner("@license MIT"), None);
+        assert_eq!(
+            parse_banner("lodash.debounce 4.0.8 | MIT"),
+            Some(("lodash.debounce".to_string(), Some("4.0.8".to_string())))
+        );
+    }
+
+    #[test]
+    fn test_source_package() {
+        assert_eq!(
+            source_package(
+                "webpack://app/./node_modules/react-dom/cjs/react-dom.production.min.js"
+            ),
+            Some(("react-dom".to_string(), None))
+        );
+        assert_eq!(
+            source_package("../../node_modules/.pnpm/@vue+shared@3.4.21/node_modules/@vue/shared/dist/shared.esm-bundler.js"),
+            Some(("@vue/shared".to_string(), Some("3.4.21".to_string())))
+        );
+        assert_eq!(
+            source_package("../node_modules/.pnpm/react-dom@18.2.0_react@18.2.0/node_modules/react-dom/index.js"),
+            Some(("react-dom".to_string(), Some("18.2.0".to_string())))
+        );
+        assert_eq!(
+            source_package(
+                ".yarn/cache/left-pad-npm-1.3.0-20e9a4c3f6.zip/node_modules/left-pad/index.js"
+            ),
+            Some(("left-pad".to_string(), Some("1.3.0".to_string())))
+        );
+        assert_eq!(source_package("webpack://app/./src/index.js"), None);
+        assert_eq!(source_package("node_modules/.vite/deps/chunk.js"), None);
+    }
+
+    #[test]
+    fn test_scan_bundle_with_source_map_and_extracted_comments() {
+        let dir = TempDir::new().unwrap();
+        let bundle = dir.path().join("main.js");
+        let content = "/*! For license information please see main.js.LICENSE.txt */\n\
+                       (()=>{})();\n//# sourceMappingURL=main.js.map\n";
+        fs::write(&bundle, content).unwrap();
+        fs::write(
+            dir.path().join("main.js.LICENSE.txt"),
+            "/*! lodash 4.17.21 | MIT */\n",
+        )
+        .unwrap();
+        fs::write(
+            dir.path().join("main.js.map"),
+            r#"{"version":3,"sources":["webpack://app/./src/index.js","webpack://app/./node_modules/lodash/lodash.js","webpack://app/./node_modules/@babel/runtime/helpers/esm/defineProperty.js"]}"#,
+        )
+        .unwrap();
+
+        let libraries = merge_libraries(scan_bundle(&bundle, content));
+        let found: Vec<(&str, Option<&str>, Option<&str>)> = libraries
+            .iter()
+            .map(|library| {
+                (
+                    library.name.as_str(),
+                    library.version.as_deref(),
+                    library.license.as_deref(),
+                )
+            })
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("@babel/runtime", None, None),
+                ("lodash", Some("4.17.21"), Some("MIT")),
+            ]
+        );
+    }
+}
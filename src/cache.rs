@@ -1,12 +1,19 @@
 //! Caching functionality for license data
 //!
+//! Two caches live under the user cache directory (`~/.cache/feluda` on Linux):
+//! the GitHub license catalogue, and the per-package licenses fetched from
+//! package registries, keyed by `ecosystem:name:version`. The package cache is
+//! loaded on first use, shared between the parallel analyzers, and written back
+//! once the scan finishes.
+//!
 //! Future considerations:
-//! - Per-package license cache (language:package:version keys)
 //! - Dependency manifest cache with mtime tracking for incremental analysis
 
 use std::collections::HashMap;
 use std::fs;
 use std::path::PathBuf;
+use std::sync::atomic::{AtomicBool, AtomicU64, Ordering};
+use std::sync::{Mutex, OnceLock};
 use std::time::SystemTime;
 
 use crate::debug::{log, log_error, FeludaResult, LogLevel};
@@ -14,9 +21,18 @@ use crate::licenses::License;
 
 const CACHE_SUBDIR: &str = "feluda";
 const GITHUB_LICENSES_CACHE_FILE: &str = "github_licenses.json";
+const PACKAGE_CACHE_FILE: &str = "packages.json";
 const CACHE_TTL_SECS: u64 = 30 * 24 * 60 * 60; // 30 days
+const SECS_PER_DAY: u64 = 24 * 60 * 60;
 
 const CACHE_VERSION: u32 = 1;
+const PACKAGE_CACHE_VERSION: u32 = 1;
+
+static PACKAGE_CACHE: OnceLock<Mutex<PackageCache>> = OnceLock::new();
+static PACKAGE_CACHE_TTL_SECS: OnceLock<u64> = OnceLock::new();
+static REFRESH: AtomicBool = AtomicBool::new(false);
+static PACKAGE_CACHE_HITS: AtomicU64 = AtomicU64::new(0);
+static PACKAGE_CACHE_MISSES: AtomicU64 = AtomicU64::new(0);
 
 #[derive(serde::Serialize, serde::Deserialize, Debug)]
 struct CacheEntry {
@@ -26,7 +42,64 @@ struct CacheEntry {
     timestamp: u64,
 }
 
-fn cache_dir_path() -> FeludaResult<PathBuf> {
+/// Licenses fetched from package registries, keyed by `ecosystem:name:version`
+#[derive(serde::Serialize, serde::Deserialize, Debug, Default)]
+struct PackageCache {
+    #[serde(default)]
+    version: u32,
+    #[serde(default)]
+    entries: HashMap<String, PackageCacheEntry>,
+    #[serde(skip)]
+    dirty: bool,
+}
+
+#[derive(serde::Serialize, serde::Deserialize, Debug, Clone)]
+struct PackageCacheEntry {
+    license: String,
+    timestamp: u64,
+}
+
+impl PackageCache {
+    fn new() -> Self {
+        Self {
+            version: PACKAGE_CACHE_VERSION,
+            ..Self::default()
+        }
+    }
+
+    fn get(&self, key: &str, ttl_secs: u64, now: u64) -> Option<&str> {
+        self.entries
+            .get(key)
+            .filter(|entry| now.saturating_sub(entry.timestamp) < ttl_secs)
+            .map(|entry| entry.license.as_str())
+    }
+
+    fn insert(&mut self, key: String, license: &str, now: u64) {
+        self.entries.insert(
+            key,
+            PackageCacheEntry {
+                license: license.to_string(),
+                timestamp: now,
+            },
+        );
+        self.dirty = true;
+    }
+
+    /// Drop entries older than the TTL so the cache file doesn't grow forever
+    fn prune(&mut self, ttl_secs: u64, now: u64) {
+        self.entries
+            .retain(|_, entry| now.saturating_sub(entry.timestamp) < ttl_secs);
+    }
+}
+
+fn now_secs() -> u64 {
+    SystemTime::now()
+        .duration_since(SystemTime::UNIX_EPOCH)
+        .map(|d| d.as_secs())
+        .unwrap_or(0)
+}
+
+pub fn cache_dir_path() -> FeludaResult<PathBuf> {
     let base = dirs::cache_dir().ok_or_else(|| {
         std::io::Error::new(
             std::io::ErrorKind::NotFound,
@@ -94,7 +167,8 @@ pub fn load_github_licenses_from_cache() -> FeludaResult<Option<HashMap<String,
                     );
                     return Ok(None);
                 }
-                if !is_entry_fresh(entry.timestamp) {
+                // Offline, a stale catalogue is better than none
+                if !crate::offline::is_offline() && !is_entry_fresh(entry.timestamp) {
                     log(
                         LogLevel::Info,
                         "GitHub licenses cache is stale, will re-fetch",
@@ -176,6 +250,209 @@ pub fn clear_github_licenses_cache() -> FeludaResult<()> {
     Ok(())
 }
 
+/// Ignore cached package licenses and fetch them again (`--refresh`)
+///
+/// Fresh results are still written back to the cache.
+pub fn set_refresh(refresh: bool) {
+    REFRESH.store(refresh, Ordering::Relaxed);
+}
+
+/// Whether cached package data should be ignored and fetched again (`--refresh`)
+pub fn is_refresh() -> bool {
+    REFRESH.load(Ordering::Relaxed)
+}
+
+fn package_cache_path() -> FeludaResult<PathBuf> {
+    Ok(cache_dir_path()?.join(PACKAGE_CACHE_FILE))
+}
+
+fn package_cache_ttl_secs() -> u64 {
+    *PACKAGE_CACHE_TTL_SECS.get_or_init(|| {
+        let ttl_days = crate::config::load_config()
+            .map(|config| config.cache.ttl_days)
+            .unwrap_or_else(|_| crate::config::CacheConfig::default().ttl_days);
+        ttl_days.saturating_mul(SECS_PER_DAY)
+    })
+}
+
+fn package_cache() -> &'static Mutex<PackageCache> {
+    PACKAGE_CACHE.get_or_init(|| Mutex::new(load_package_cache()))
+}
+
+fn load_package_cache() -> PackageCache {
+    let Ok(cache_path) = package_cache_path() else {
+        return PackageCache::new();
+    };
+    if !cache_path.exists() {
+        log(LogLevel::Info, "No package license cache found");
+        return PackageCache::new();
+    }
+
+    match fs::read_to_string(&cache_path)
+        .map_err(|e| e.to_string())
+        .and_then(|content| {
+            serde_json::from_str::<PackageCache>(&content).map_err(|e| e.to_string())
+        }) {
+        Ok(cache) if cache.version == PACKAGE_CACHE_VERSION => {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Loaded {} cached package licenses from {}",
+                    cache.entries.len(),
+                    cache_path.display()
+                ),
+            );
+            cache
+        }
+        Ok(cache) => {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Package cache version mismatch (got {}, expected {PACKAGE_CACHE_VERSION}), starting fresh",
+                    cache.version
+                ),
+            );
+            PackageCache::new()
+        }
+        Err(e) => {
+            log(
+                LogLevel::Warn,
+                &format!("Corrupt package cache, starting fresh: {e}"),
+            );
+            PackageCache::new()
+        }
+    }
+}
+
+fn package_key(ecosystem: &str, name: &str, version: &str) -> String {
+    format!("{ecosystem}:{name}:{version}")
+}
+
+/// Look up a license previously fetched from a package registry
+///
+/// The license database snapshot is consulted when the cache has no entry. In
+/// offline mode entries never expire, and a version missing from the snapshot
+/// gets the license of the package's latest release in it.
+pub fn get_cached_license(ecosystem: &str, name: &str, version: &str) -> Option<String> {
+    let offline = crate::offline::is_offline();
+    if REFRESH.load(Ordering::Relaxed) && !offline {
+        PACKAGE_CACHE_MISSES.fetch_add(1, Ordering::Relaxed);
+        return None;
+    }
+
+    let key = package_key(ecosystem, name, version);
+    let ttl_secs = if offline {
+        u64::MAX
+    } else {
+        package_cache_ttl_secs()
+    };
+    let license = package_cache()
+        .lock()
+        .ok()?
+        .get(&key, ttl_secs, now_secs())
+        .map(String::from)
+        .or_else(|| crate::offline::db_package_license(&key))
+        .or_else(|| {
+            offline
+                .then(|| crate::offline::db_latest_license(ecosystem, name))
+                .flatten()
+        });
+    if let Some(license) = &license {
+        log(
+            LogLevel::Info,
+            &format!("Using cached license for {key}: {license}"),
+        );
+        PACKAGE_CACHE_HITS.fetch_add(1, Ordering::Relaxed);
+    } else {
+        PACKAGE_CACHE_MISSES.fetch_add(1, Ordering::Relaxed);
+    }
+    license
+}
+
+/// Package cache lookups since the process started, as `(hits, misses)`
+pub fn package_cache_stats() -> (u64, u64) {
+    (
+        PACKAGE_CACHE_HITS.load(Ordering::Relaxed),
+        PACKAGE_CACHE_MISSES.load(Ordering::Relaxed),
+    )
+}
+
+/// Remember a license fetched from a package registry
+///
+/// Failed lookups (`Unknown...`) are not cached so they are retried next time.
+pub fn cache_license(ecosystem: &str, name: &str, version: &str, license: &str) {
+    if license.trim().is_empty() || license.starts_with("Unknown") {
+        return;
+    }
+
+    if let Ok(mut cache) = package_cache().lock() {
+        cache.insert(package_key(ecosystem, name, version), license, now_secs());
+    }
+}
+
+/// Fresh package licenses from the cache, for the license database snapshot
+pub fn cached_package_licenses() -> std::collections::BTreeMap<String, String> {
+    let ttl_secs = package_cache_ttl_secs();
+    let now = now_secs();
+    package_cache()
+        .lock()
+        .map(|cache| {
+            cache
+                .entries
+                .iter()
+                .filter(|(_, entry)| now.saturating_sub(entry.timestamp) < ttl_secs)
+                .map(|(key, entry)| (key.clone(), entry.license.clone()))
+                .collect()
+        })
+        .unwrap_or_default()
+}
+
+/// Write the package license cache back to disk if anything changed
+pub fn save_package_cache() -> FeludaResult<()> {
+    let Some(cache) = PACKAGE_CACHE.get() else {
+        return Ok(());
+    };
+    let Ok(mut cache) = cache.lock() else {
+        return Ok(());
+    };
+    if !cache.dirty {
+        return Ok(());
+    }
+
+    cache.prune(package_cache_ttl_secs(), now_secs());
+    let cache_path = ensure_cache_dir()?.join(PACKAGE_CACHE_FILE);
+    let json = serde_json::to_string(&*cache).map_err(|e| {
+        log_error("Failed to serialize package cache", &e);
+        std::io::Error::new(std::io::ErrorKind::InvalidData, e.to_string())
+    })?;
+    fs::write(&cache_path, json)
+        .inspect_err(|e| log_error("Failed to write package cache file", e))?;
+    cache.dirty = false;
+
+    log(
+        LogLevel::Info,
+        &format!(
+            "Saved {} package licenses to cache at {}",
+            cache.entries.len(),
+            cache_path.display()
+        ),
+    );
+
+    Ok(())
+}
+
+pub fn clear_package_cache() -> FeludaResult<()> {
+    let cache_path = package_cache_path()?;
+
+    if cache_path.exists() {
+        fs::remove_file(&cache_path)
+            .inspect_err(|e| log_error("Failed to clear package cache", e))?;
+        log(LogLevel::Info, "Cleared package license cache");
+    }
+
+    Ok(())
+}
+
 #[derive(Debug, serde::Serialize)]
 pub struct CacheStatus {
     pub exists: bool,
@@ -184,6 +461,7 @@ pub struct CacheStatus {
     pub is_fresh: bool,
     pub age_secs: u64,
     pub license_count: usize,
+    pub package_count: usize,
 }
 
 impl CacheStatus {
@@ -234,6 +512,7 @@ impl CacheStatus {
         println!("   Size: {}", Self::format_size(self.size_bytes));
         println!("   Age: {}", Self::format_age(self.age_secs));
         println!("   Licenses cached: {}", self.license_count);
+        println!("   Package licenses cached: {}", self.package_count);
         println!();
     }
 }
@@ -260,6 +539,7 @@ pub fn get_cache_status() -> FeludaResult<CacheStatus> {
             is_fresh: false,
             age_secs: 0,
             license_count: 0,
+            package_count: package_cache_count(),
         });
     }
 
@@ -284,9 +564,20 @@ pub fn get_cache_status() -> FeludaResult<CacheStatus> {
         is_fresh,
         age_secs,
         license_count,
+        package_count: package_cache_count(),
     })
 }
 
+/// Number of entries in the package license cache file
+fn package_cache_count() -> usize {
+    package_cache_path()
+        .ok()
+        .and_then(|path| fs::read_to_string(path).ok())
+        .and_then(|content| serde_json::from_str::<PackageCache>(&content).ok())
+        .map(|cache| cache.entries.len())
+        .unwrap_or(0)
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -378,6 +669,41 @@ mod tests {
         assert!(load_from_content("{}").is_none());
     }
 
+    #[test]
+    fn package_cache_respects_ttl() {
+        let mut cache = PackageCache::new();
+        let now = now_secs();
+        cache.insert(package_key("npm", "left-pad", "1.3.0"), "WTFPL", now - 100);
+        assert!(cache.dirty);
+
+        assert_eq!(
+            cache.get("npm:left-pad:1.3.0", SECS_PER_DAY, now),
+            Some("WTFPL")
+        );
+        assert_eq!(cache.get("npm:left-pad:1.3.0", 50, now), None);
+        assert_eq!(cache.get("npm:left-pad:1.2.0", SECS_PER_DAY, now), None);
+
+        cache.prune(50, now);
+        assert!(cache.entries.is_empty());
+    }
+
+    #[test]
+    fn package_cache_serde_round_trip() {
+        let mut cache = PackageCache::new();
+        cache.insert(package_key("pypi", "requests", "2.31.0"), "Apache-2.0", 42);
+
+        let json = serde_json::to_string(&cache).unwrap();
+        assert!(!json.contains("dirty"));
+        let decoded: PackageCache = serde_json::from_str(&json).unwrap();
+        assert_eq!(decoded.version, PACKAGE_CACHE_VERSION);
+        assert!(!decoded.dirty);
+        assert_eq!(
+            decoded.entries["pypi:requests:2.31.0"].license,
+            "Apache-2.0"
+        );
+        assert_eq!(decoded.entries["pypi:requests:2.31.0"].timestamp, 42);
+    }
+
     #[test]
     fn format_size_bytes() {
         assert_eq!(CacheStatus::format_size(500), "500 B");
@@ -0,0 +1,416 @@
+//! Component canonicalization across ecosystems
+//!
+//! The same library can be found more than once: a Go module vendored into an
+//! npm native addon, a GitHub repository pinned both as a Bazel `http_archive`
+//! and a Swift package, or a package listed twice in one lockfile. Every
+//! dependency gets identities from its package URL and from its source
+//! repository at a revision. Dependencies sharing an identity are merged into
+//! one, which lists the others in `aliases`, so reports count the component
+//! once and the policy is applied to it once.
+//!
+//! Packages of one ecosystem found in different manifests are kept apart:
+//! each project resolved the package itself, and projects are summarized
+//! separately.
+//!
+//! [`assign_purls`] then records the package URL of every dependency, the
+//! identifier reports and other tools refer to components by.
+
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::path::Path;
+
+use crate::debug::{log, LogLevel};
+use crate::dependency_submission::{format_package_url, package_url, purl_type};
+use crate::licenses::{is_unknown_license, DependencyScope, LicenseInfo};
+
+/// Forges whose repositories are `host/owner/name`, also the hosts of Go module paths
+const FORGES: [&str; 3] = ["github.com", "gitlab.com", "bitbucket.org"];
+
+/// Length commit hashes are compared at, so short and full hashes match
+const SHORT_COMMIT: usize = 7;
+
+/// A dependency merged into another one with the same identity
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Alias {
+    pub name: String,
+    pub version: String,
+    /// Manifest or lockfile the duplicate was found in
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub source_file: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub purl: Option<String>,
+}
+
+impl Alias {
+    fn of(info: &LicenseInfo) -> Self {
+        Self {
+            name: info.name.clone(),
+            version: info.version.clone(),
+            source_file: info.source_file.clone(),
+            purl: package_url(info),
+        }
+    }
+}
+
+/// Merge dependencies that are the same component, returning how many were merged
+///
+/// The first of each set of duplicates is kept, unless only a later one has a
+/// known license. The kept dependency is a runtime dependency when any of its
+/// duplicates is.
+pub fn deduplicate(dependencies: &mut Vec<LicenseInfo>) -> usize {
+    let mut kept: Vec<LicenseInfo> = Vec::with_capacity(dependencies.len());
+    let mut owners: HashMap<String, Vec<usize>> = HashMap::new();
+    let mut merged = 0;
+
+    for info in dependencies.drain(..) {
+        let identities = identities(&info);
+        let existing = identities
+            .iter()
+            .filter_map(|identity| owners.get(identity))
+            .flatten()
+            .copied()
+            .find(|&index| is_same_component(&kept[index], &info));
+        let index = match existing {
+            Some(index) => {
+                merge(&mut kept[index], info);
+                merged += 1;
+                index
+            }
+            None => {
+                kept.push(info);
+                kept.len() - 1
+            }
+        };
+        for identity in identities {
+            let indices = owners.entry(identity).or_default();
+            if !indices.contains(&index) {
+                indices.push(index);
+            }
+        }
+    }
+
+    if merged > 0 {
+        log(
+            LogLevel::Info,
+            &format!("Merged {merged} dependencies found more than once"),
+        );
+    }
+    *dependencies = kept;
+    merged
+}
+
+/// Package URL of a dependency, `pkg:generic/<name>@<version>` when its ecosystem has no purl type
+pub fn purl(info: &LicenseInfo) -> String {
+    package_url(info).unwrap_or_else(|| {
+        format_package_url("generic", &info.name, &info.version)
+            .unwrap_or_else(|| "pkg:generic/unknown".to_string())
+    })
+}
+
+/// Record the package URL of every dependency, so each output format can report it
+pub fn assign_purls(dependencies: &mut [LicenseInfo]) {
+    for info in dependencies {
+        info.purl = Some(purl(info));
+    }
+}
+
+/// Identities of a dependency: its package URL and its repository at a revision
+pub fn identities(info: &LicenseInfo) -> Vec<String> {
+    let mut identities = Vec::new();
+    if let Some(purl) = package_url(info) {
+        identities.push(purl);
+    }
+    if let (Some(repository), Some(revision)) = (repository(info), revision(&info.version)) {
+        identities.push(format!("repo:{repository}@{revision}"));
+    }
+    identities
+}
+
+/// Canonical `host/path` of the repository a dependency was built from
+///
+/// Taken from the repository the manifest records, a git URL in the version
+/// (npm `git+https://...#commit`), the name of a Go module hosted on a forge,
+/// or the repository found by `--health`.
+pub fn repository(info: &LicenseInfo) -> Option<String> {
+    info.repository
+        .as_deref()
+        .and_then(normalize_repository)
+        .or_else(|| normalize_repository(&info.version))
+        .or_else(|| {
+            let host = info.name.split('/').next()?;
+            FORGES
+                .contains(&host.to_lowercase().as_str())
+                .then(|| normalize_repository(&format!("https://{}", info.name)))?
+        })
+        .or_else(|| {
+            let health = info.health.as_ref()?;
+            normalize_repository(health.repository.as_deref()?)
+        })
+}
+
+/// Lowercased `host/path` of a git remote, without scheme, user and `.git`
+fn normalize_repository(remote: &str) -> Option<String> {
+    let remote = remote.trim().trim_start_matches("git+");
+    let shorthand = FORGES.iter().find_map(|forge| {
+        let prefix = forge.split('.').next()?;
+        let path = remote.strip_prefix(prefix)?.strip_prefix(':')?;
+        (!path.starts_with('/')).then(|| format!("{forge}/{path}"))
+    });
+    let location = match shorthand {
+        Some(location) => location,
+        None => match remote.split_once("://") {
+            Some((_, rest)) => match rest.split_once('@') {
+                Some((user, host)) if !user.contains('/') => host.to_string(),
+                _ => rest.to_string(),
+            },
+            // scp-like syntax: git@github.com:owner/repo.git
+            None => {
+                let (user_host, path) = remote.split_once(':')?;
+                let (_, host) = user_host.split_once('@')?;
+                format!("{host}/{path}")
+            }
+        },
+    };
+
+    let (host, path) = location.split_once('/')?;
+    let host = host.split(':').next()?.to_lowercase();
+    if !host.contains('.') {
+        return None;
+    }
+    let path = path
+        .split(['#', '?'])
+        .next()?
+        .split("/-/")
+        .next()?
+        .trim_end_matches('/')
+        .trim_end_matches(".git")
+        .to_lowercase();
+    let segments: Vec<&str> = path.split('/').filter(|s| !s.is_empty()).collect();
+    let segments = match host.as_str() {
+        "github.com" | "bitbucket.org" => segments.get(..2)?,
+        _ if segments.len() >= 2 => &segments[..],
+        _ => return None,
+    };
+    Some(format!("{host}/{}", segments.join("/")))
+}
+
+/// Revision a version refers to, comparable across ecosystems
+///
+/// `v1.2.3` and `1.2.3` are the same tag; Go pseudo-versions and git URLs
+/// are reduced to their commit, and commits to their short hash.
+fn revision(version: &str) -> Option<String> {
+    let version = version.trim();
+    let version = match version.rsplit_once('#') {
+        Some((_, fragment)) => fragment,
+        None if version.contains(['/', ':']) => return None,
+        None => version,
+    };
+    let version = version.trim_end_matches("+incompatible");
+    let version = version.strip_prefix('v').unwrap_or(version);
+    if version.is_empty() || version == "unknown" {
+        return None;
+    }
+    // Go pseudo-version: 0.0.0-20230101120000-abcdef123456
+    let commit = version
+        .rsplit_once('-')
+        .map(|(_, hash)| hash)
+        .filter(|hash| hash.len() == 12 && is_hash(hash))
+        .or_else(|| (version.len() >= SHORT_COMMIT && is_hash(version)).then_some(version));
+    Some(match commit {
+        Some(commit) => commit[..SHORT_COMMIT].to_lowercase(),
+        None => version.to_string(),
+    })
+}
+
+fn is_hash(value: &str) -> bool {
+    value.chars().all(|c| c.is_ascii_hexdigit())
+}
+
+/// Ecosystem of a dependency: its purl type, else the name of its manifest
+fn ecosystem(info: &LicenseInfo) -> Option<String> {
+    let source_file = info.source_file.as_deref()?;
+    purl_type(source_file)
+        .map(str::to_string)
+        .or_else(|| Some(Path::new(source_file).file_name()?.to_str()?.to_string()))
+}
+
+/// Whether two dependencies with a common identity are one component
+fn is_same_component(kept: &LicenseInfo, other: &LicenseInfo) -> bool {
+    kept.source_file == other.source_file || ecosystem(kept) != ecosystem(other)
+}
+
+fn merge(kept: &mut LicenseInfo, mut other: LicenseInfo) {
+    if is_unknown_license(kept.license.as_deref()) && !is_unknown_license(other.license.as_deref())
+    {
+        std::mem::swap(kept, &mut other);
+    } else if !is_unknown_license(other.license.as_deref()) && kept.license != other.license {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "{}@{} was found as {}@{} with license {}, keeping {}",
+                kept.name,
+                kept.version,
+                other.name,
+                other.version,
+                other.get_license(),
+                kept.get_license()
+            ),
+        );
+    }
+
+    if other.scope.is_runtime() {
+        kept.scope = DependencyScope::Runtime;
+    }
+    if kept.repository.is_none() {
+        kept.repository = other.repository.clone();
+    }
+    let aliases = kept.aliases.get_or_insert_with(Vec::new);
+    aliases.push(Alias::of(&other));
+    aliases.extend(other.aliases.take().unwrap_or_default());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn dep(name: &str, version: &str, license: Option<&str>, source_file: &str) -> LicenseInfo {
+        LicenseInfo {
+            source_file: Some(source_file.to_string()),
+            ..LicenseInfo::test(name, version, license)
+        }
+    }
+
+    #[test]
+    fn test_normalize_repository() {
+        for remote in [
+            "https://github.com/Apple/swift-nio.git",
+            "git+ssh://git@github.com/apple/swift-nio.git#abc1234",
+            "git@github.com:apple/swift-nio.git",
+            "github:apple/swift-nio",
+            "https://github.com/apple/swift-nio/tree/main",
+        ] {
+            assert_eq!(
+                normalize_repository(remote).as_deref(),
+                Some("github.com/apple/swift-nio"),
+                "{remote}"
+            );
+        }
+        assert_eq!(
+            normalize_repository("https://gitlab.com/group/sub/project/-/tree/main").as_deref(),
+            Some("gitlab.com/group/sub/project")
+        );
+        assert_eq!(normalize_repository("1.2.3"), None);
+        assert_eq!(normalize_repository("^4.17.21"), None);
+        assert_eq!(normalize_repository("file:../local"), None);
+    }
+
+    #[test]
+    fn test_purl() {
+        let mut dependencies = vec![
+            dep("github.com/gin-gonic/gin", "v1.9.1", None, "go.mod"),
+            dep("hashicorp/aws", "5.0.0", None, ".terraform.lock.hcl"),
+        ];
+        assign_purls(&mut dependencies);
+        assert_eq!(
+            dependencies[0].purl.as_deref(),
+            Some("pkg:golang/github.com/gin-gonic/gin@v1.9.1")
+        );
+        assert_eq!(
+            dependencies[1].purl.as_deref(),
+            Some("pkg:generic/hashicorp/aws@5.0.0")
+        );
+    }
+
+    #[test]
+    fn test_revision() {
+        assert_eq!(revision("v1.2.3").as_deref(), Some("1.2.3"));
+        assert_eq!(revision("v2.0.0+incompatible").as_deref(), Some("2.0.0"));
+        assert_eq!(
+            revision("v0.0.0-20230101120000-abcdef123456").as_deref(),
+            Some("abcdef1")
+        );
+        assert_eq!(
+            revision("git+https://github.com/o/r.git#ABCDEF1234567890abcdef1234567890abcdef12")
+                .as_deref(),
+            Some("abcdef1")
+        );
+        assert_eq!(revision("https://github.com/o/r.git"), None);
+        assert_eq!(revision("unknown"), None);
+    }
+
+    #[test]
+    fn test_deduplicate_across_ecosystems() {
+        let mut swift = dep("swift-nio", "2.62.0", None, "Package.resolved");
+        swift.repository = Some("https://github.com/apple/swift-nio.git".to_string());
+        let mut dependencies = vec![
+            dep(
+                "github.com/apple/swift-nio",
+                "v2.62.0",
+                Some("Apache-2.0"),
+                "go.mod",
+            ),
+            swift,
+            dep("lodash", "4.17.21", Some("MIT"), "package-lock.json"),
+        ];
+        dependencies[0].scope = DependencyScope::Dev;
+
+        assert_eq!(deduplicate(&mut dependencies), 1);
+        assert_eq!(dependencies.len(), 2);
+        let nio = &dependencies[0];
+        assert_eq!(nio.name, "github.com/apple/swift-nio");
+        assert_eq!(nio.scope, DependencyScope::Runtime);
+        assert_eq!(
+            nio.repository.as_deref(),
+            Some("https://github.com/apple/swift-nio.git")
+        );
+        let aliases = nio.aliases.as_ref().unwrap();
+        assert_eq!(aliases.len(), 1);
+        assert_eq!(aliases[0].name, "swift-nio");
+        assert_eq!(aliases[0].source_file.as_deref(), Some("Package.resolved"));
+    }
+
+    #[test]
+    fn test_deduplicate_keeps_known_license() {
+        let mut dependencies = vec![
+            dep(
+                "native-addon-dep",
+                "git+https://github.com/owner/lib.git#0123456789abcdef",
+                None,
+                "package-lock.json",
+            ),
+            dep(
+                "github.com/owner/lib",
+                "v0.0.0-20240101000000-0123456789ab",
+                Some("MIT"),
+                "vendor/modules.txt",
+            ),
+        ];
+        assert_eq!(deduplicate(&mut dependencies), 1);
+        assert_eq!(dependencies[0].name, "github.com/owner/lib");
+        assert_eq!(dependencies[0].license.as_deref(), Some("MIT"));
+        let aliases = dependencies[0].aliases.as_ref().unwrap();
+        assert_eq!(aliases[0].name, "native-addon-dep");
+    }
+
+    #[test]
+    fn test_deduplicate_keeps_projects_of_one_ecosystem_apart() {
+        let mut dependencies = vec![
+            dep("lodash", "4.17.21", Some("MIT"), "web/package-lock.json"),
+            dep("lodash", "4.17.21", Some("MIT"), "api/package-lock.json"),
+            dep("lodash", "4.17.21", Some("MIT"), "api/package-lock.json"),
+            dep("github.com/owner/lib", "v1.0.0", Some("MIT"), "go.mod"),
+            dep(
+                "github.com/owner/lib",
+                "v1.1.0",
+                Some("MIT"),
+                "tools/go.mod",
+            ),
+        ];
+        assert_eq!(deduplicate(&mut dependencies), 1);
+        assert_eq!(dependencies.len(), 4);
+        assert_eq!(
+            dependencies[1].aliases.as_ref().unwrap()[0].purl.as_deref(),
+            Some("pkg:npm/lodash@4.17.21")
+        );
+    }
+}
@@ -8,7 +8,13 @@ use std::thread;
 use std::time::Duration;
 
 // Import from the debug module instead of defining here
-use crate::debug::{is_debug_mode, log, LogLevel};
+use crate::debug::{is_debug_mode, log, LogFormat, LogLevel};
+use crate::golden::GoldenTolerance;
+use crate::i18n::{parse_language, Language};
+use crate::licenses::DependencyScope;
+use crate::limits::parse_size;
+use crate::reviews::ReviewStatus;
+use crate::signing::SigningOptions;
 
 /// CI output format options
 #[derive(ValueEnum, Clone, Debug)]
@@ -17,6 +23,12 @@ pub enum CiFormat {
     Github,
     /// Jenkins compatible format (JUnit XML)
     Jenkins,
+    /// SARIF 2.1.0 for GitHub code scanning and other SARIF consumers
+    Sarif,
+    /// GitLab license scanning report for merge request widgets
+    Gitlab,
+    /// Bitbucket Code Insights report with annotations
+    Bitbucket,
 }
 
 /// SBOM format options
@@ -30,6 +42,71 @@ pub enum SbomFormat {
     All,
 }
 
+/// Formats for the attributions command
+#[derive(ValueEnum, Clone, Debug, PartialEq)]
+pub enum AttributionFormat {
+    /// Markdown document
+    Markdown,
+    /// Standalone HTML page
+    Html,
+    /// Plain text
+    Text,
+}
+
+/// Formats for the graph command
+#[derive(ValueEnum, Clone, Copy, Debug, PartialEq)]
+pub enum GraphFormat {
+    /// Graphviz DOT
+    Dot,
+    /// Mermaid flowchart, e.g. for Markdown docs
+    Mermaid,
+}
+
+/// Where `feluda reuse --generate` records the files lacking REUSE information
+#[derive(ValueEnum, Clone, Copy, Debug, PartialEq)]
+pub enum ReuseFormat {
+    /// Annotations in REUSE.toml (REUSE 3.2 and later)
+    Toml,
+    /// A Debian copyright file in .reuse/dep5, for older REUSE tools
+    Dep5,
+}
+
+/// Structured report formats for the scan command
+#[derive(ValueEnum, Clone, Debug, PartialEq)]
+pub enum OutputFormat {
+    /// CycloneDX 1.5 BOM (JSON)
+    Cyclonedx,
+    /// CycloneDX 1.5 BOM (XML)
+    CyclonedxXml,
+    /// SPDX 2.3 document (JSON)
+    SpdxJson,
+    /// SPDX 2.3 document (tag-value)
+    SpdxTv,
+    /// Standalone HTML report with a license chart
+    Html,
+    /// Versioned JSON report with a published schema (see --schema)
+    Json,
+    /// One JSON dependency object per line, for very large scans
+    Ndjson,
+    /// One row per dependency, for spreadsheets
+    Csv,
+    /// Excel workbook with one row per dependency (needs --output-file)
+    Xlsx,
+}
+
+/// Findings that fail the scan, see --fail-on
+#[derive(ValueEnum, Clone, Copy, Debug, PartialEq, Eq)]
+pub enum FailOn {
+    /// Restrictive licenses
+    Restrictive,
+    /// Licenses incompatible with the project license
+    Incompatible,
+    /// Dependencies without a known license
+    Unknown,
+    /// Known vulnerabilities (implies --vulns)
+    Vulns,
+}
+
 /// OSI filter options
 #[derive(ValueEnum, Clone, Debug)]
 pub enum OsiFilter {
@@ -80,6 +157,257 @@ pub enum SbomCommand {
     },
 }
 
+/// License database Subcommands
+#[derive(Subcommand, Debug, Clone)]
+pub enum DbCommand {
+    /// Download a license database snapshot for use with --offline
+    Download {
+        /// File to write [default: license-db.json in the cache directory]
+        #[arg(short, long)]
+        output: Option<String>,
+
+        /// Scan this project first so its packages' licenses are included (can be repeated)
+        #[arg(short, long, value_name = "PATH")]
+        path: Vec<String>,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Also look up the packages in this file, one package URL per line, most popular first
+        #[arg(long, value_name = "FILE")]
+        packages: Option<String>,
+
+        /// Number of packages per ecosystem to take from --packages
+        #[arg(long, value_name = "N", default_value_t = 1000, requires = "packages")]
+        top: usize,
+    },
+    /// Download and install the signed license database of the latest release
+    Update {
+        /// Snapshot to download; its cosign bundle is expected at <URL>.sigstore.json
+        #[arg(long, env = "FELUDA_LICENSE_DB_URL", default_value = crate::offline::LICENSE_DB_URL)]
+        url: String,
+
+        /// File to write [default: license-db.json in the cache directory]
+        #[arg(short, long)]
+        output: Option<String>,
+
+        /// Public key the snapshot was signed with, instead of the keyless signature of the release workflow
+        #[arg(long, value_name = "KEY")]
+        key: Option<String>,
+
+        /// Regular expression the signing certificate's identity must match
+        #[arg(long, value_name = "REGEX", conflicts_with = "key", default_value = crate::offline::RELEASE_SIGNER_IDENTITY)]
+        certificate_identity: String,
+
+        /// OIDC issuer of the signing certificate
+        #[arg(long, value_name = "URL", conflicts_with = "key", default_value = crate::offline::GITHUB_ACTIONS_ISSUER)]
+        certificate_oidc_issuer: String,
+
+        /// Install the snapshot without verifying its signature
+        #[arg(long, conflicts_with_all = ["key", "certificate_identity", "certificate_oidc_issuer"])]
+        no_verify: bool,
+    },
+    /// Download the SPDX license texts to embed with `--features embedded-license-texts`
+    Texts {
+        /// File to write
+        #[arg(short, long, default_value = "config/license-texts.json")]
+        output: String,
+    },
+}
+
+/// Configuration Subcommands
+#[derive(Subcommand, Debug, Clone)]
+pub enum ConfigCommand {
+    /// Show the configuration files in use and the settings each one changes
+    Show {
+        /// Print every setting of the merged configuration and where it comes from
+        #[arg(long)]
+        effective: bool,
+    },
+    /// Print a setting of the merged configuration and where it comes from
+    Get {
+        /// Dotted key, e.g. `licenses.restrictive`, or a table to print every setting under it
+        key: String,
+    },
+}
+
+/// Documentation Subcommands
+#[derive(Subcommand, Debug, Clone)]
+pub enum DocsCommand {
+    /// Write man pages for feluda and each of its subcommands
+    Man {
+        /// Directory to write the pages to
+        #[arg(short, long, default_value = "man")]
+        output: String,
+    },
+}
+
+/// Baseline Subcommands
+#[derive(Subcommand, Debug, Clone)]
+pub enum BaselineCommand {
+    /// Record the current violations so later scans only fail on new ones
+    Write {
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// File to write [default: .feluda-baseline.json in the project directory]
+        #[arg(short, long)]
+        output: Option<String>,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Specify the project license explicitly
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Enable strict mode for license parser
+        #[arg(long)]
+        strict: bool,
+
+        /// Skip local license detection, force network lookup only
+        #[arg(long)]
+        no_local: bool,
+
+        /// Also scan projects in subdirectories
+        #[arg(long, short)]
+        recursive: bool,
+
+        /// Leave out dev, test and build dependencies
+        #[arg(long)]
+        exclude_dev: bool,
+    },
+}
+
+/// Review Subcommands
+#[derive(Subcommand, Debug, Clone)]
+pub enum ReviewCommand {
+    /// Record a decision for a package at a version
+    Set {
+        /// The package as <name>@<version> or its package URL
+        package: String,
+
+        /// Decision of the review
+        #[arg(value_enum)]
+        status: ReviewStatus,
+
+        /// License that was reviewed, so a later change of license asks for a new review
+        #[arg(long)]
+        license: Option<String>,
+
+        /// Why the package was approved, rejected or sent to legal
+        #[arg(long, short)]
+        comment: Option<String>,
+
+        /// Who reviewed the package
+        #[arg(long)]
+        reviewer: Option<String>,
+
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Reviews file [default: .feluda-reviews.json in the project directory]
+        #[arg(short, long)]
+        file: Option<String>,
+    },
+    /// Remove the decision for a package at a version
+    Remove {
+        /// The package as <name>@<version> or its package URL
+        package: String,
+
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Reviews file [default: .feluda-reviews.json in the project directory]
+        #[arg(short, long)]
+        file: Option<String>,
+    },
+    /// List the recorded decisions
+    List {
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Reviews file [default: .feluda-reviews.json in the project directory]
+        #[arg(short, long)]
+        file: Option<String>,
+
+        /// Output the reviews in JSON format
+        #[arg(long, short)]
+        json: bool,
+    },
+}
+
+/// Hook Subcommands
+#[derive(Subcommand, Debug, Clone)]
+pub enum HookCommand {
+    /// Install a git pre-commit hook that runs `feluda hook run`
+    Install {
+        /// Path inside the git repository
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Replace an existing pre-commit hook that feluda did not install
+        #[arg(long)]
+        force: bool,
+    },
+    /// Remove the pre-commit hook installed by `feluda hook install`
+    Uninstall {
+        /// Path inside the git repository
+        #[arg(short, long, default_value = "./")]
+        path: String,
+    },
+    /// Check the manifests and lockfiles staged for the next commit
+    Run {
+        /// Path inside the git repository
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Findings that block the commit, comma separated; policy violations always do
+        #[arg(
+            long,
+            value_enum,
+            value_delimiter = ',',
+            value_name = "FINDINGS",
+            default_value = "restrictive,incompatible"
+        )]
+        fail_on: Vec<FailOn>,
+
+        /// Number of blocking findings tolerated before the commit is blocked
+        #[arg(long, default_value_t = 0, value_name = "N")]
+        max_violations: usize,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Specify the project license explicitly
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Enable strict mode for license parser
+        #[arg(long)]
+        strict: bool,
+
+        /// Skip local license detection, force network lookup only
+        #[arg(long)]
+        no_local: bool,
+
+        /// Leave out dev, test and build dependencies
+        #[arg(long)]
+        exclude_dev: bool,
+
+        /// Scan even when the result for the staged files is cached
+        #[arg(long)]
+        no_cache: bool,
+    },
+}
+
 /// CLI Commands
 #[derive(Subcommand, Debug, Clone)]
 pub enum Commands {
@@ -117,6 +445,474 @@ pub enum Commands {
         #[arg(long)]
         clear: bool,
     },
+    /// Manage the license database used by --offline
+    Db {
+        #[command(subcommand)]
+        command: DbCommand,
+    },
+    /// Inspect the layered configuration
+    Config {
+        #[command(subcommand)]
+        command: ConfigCommand,
+    },
+    /// Serve scans over HTTP
+    Serve {
+        /// Address to listen on
+        #[arg(long, default_value = "127.0.0.1:7878")]
+        addr: String,
+
+        /// Also serve the gRPC API on this address, e.g. 127.0.0.1:7879
+        #[arg(long, value_name = "ADDR")]
+        grpc: Option<String>,
+
+        /// Export a trace of every scan to this OTLP/HTTP endpoint, e.g. http://localhost:4318
+        #[arg(long, value_name = "URL")]
+        otlp_endpoint: Option<String>,
+
+        /// Maximum number of scans running at the same time
+        #[arg(long, default_value_t = 4, value_parser = clap::value_parser!(u16).range(1..))]
+        max_scans: u16,
+    },
+    /// Generate a third-party attribution (NOTICE) file with copyright lines and license texts
+    Attributions {
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Output format of the attribution file
+        #[arg(long, short, value_enum, default_value_t = AttributionFormat::Markdown)]
+        format: AttributionFormat,
+
+        /// File to write [default: THIRD_PARTY_NOTICES.<md|html|txt> in the project directory]
+        #[arg(short, long)]
+        output: Option<String>,
+
+        /// Only use license files found locally, don't fetch them from package repositories
+        #[arg(long)]
+        no_fetch: bool,
+    },
+    /// Compare two scans and report added, removed and relicensed dependencies
+    Diff {
+        /// Report from the earlier scan (`feluda --json`, `--yaml` or `--format json` output)
+        #[arg(required_unless_present = "base")]
+        old: Option<String>,
+
+        /// Report from the later scan
+        #[arg(required_unless_present = "base")]
+        new: Option<String>,
+
+        /// Compare the project against this git ref (branch, tag or commit) instead of two reports
+        #[arg(long, conflicts_with_all = ["old", "new"])]
+        base: Option<String>,
+
+        /// Path to the local project directory, used with --base
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Specify the project license explicitly
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Enable strict mode for license parser
+        #[arg(long)]
+        strict: bool,
+
+        /// Skip local license detection, force network lookup only
+        #[arg(long)]
+        no_local: bool,
+
+        /// Output the differences in JSON format
+        #[arg(long, short)]
+        json: bool,
+
+        /// Fail with non-zero exit code when new restrictive licenses are introduced
+        #[arg(long)]
+        fail_on_restrictive: bool,
+
+        /// Fail with non-zero exit code when new incompatible licenses are introduced
+        #[arg(long)]
+        fail_on_incompatible: bool,
+
+        /// Fail with non-zero exit code when a new version relicenses a dependency to a riskier license
+        #[arg(long)]
+        fail_on_relicense: bool,
+    },
+    /// Compare the scan against a reviewed golden report and fail when the license surface drifted
+    Verify {
+        /// Golden report (`--format json`, `--json` or `--yaml` output) the project's licenses are frozen at
+        #[arg(long, value_name = "REPORT")]
+        golden: String,
+
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Differences from the golden report that are accepted
+        #[arg(long, value_enum, default_value_t = GoldenTolerance::Versions)]
+        tolerance: GoldenTolerance,
+
+        /// Write the current scan to the golden report instead of comparing against it
+        #[arg(long, conflicts_with_all = ["tolerance", "json"])]
+        update: bool,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Specify the project license explicitly
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Enable strict mode for license parser
+        #[arg(long)]
+        strict: bool,
+
+        /// Skip local license detection, force network lookup only
+        #[arg(long)]
+        no_local: bool,
+
+        /// Output the differences in JSON format
+        #[arg(long, short)]
+        json: bool,
+    },
+    /// Merge the reports of many projects into an organization-wide view of license exposure
+    Aggregate {
+        /// Reports to merge (`--json`, `--yaml` or `--format json` output), or directories containing them
+        #[arg(required_unless_present = "scan")]
+        reports: Vec<String>,
+
+        /// Scan these project directories and include them in the rollup
+        #[arg(long, value_name = "PATH", num_args = 1..)]
+        scan: Vec<String>,
+
+        /// Save the report of every project scanned with --scan to this directory
+        #[arg(long, value_name = "DIR", requires = "scan")]
+        output_dir: Option<String>,
+
+        /// Specify the language to scan, used with --scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Specify the project license explicitly, used with --scan
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Enable strict mode for license parser
+        #[arg(long)]
+        strict: bool,
+
+        /// Skip local license detection, force network lookup only
+        #[arg(long)]
+        no_local: bool,
+
+        /// Output the rollup in JSON format
+        #[arg(long, short)]
+        json: bool,
+    },
+    /// Scan the Go modules compiled into a binary, like `go version -m`
+    Binary {
+        /// Go binary built with Go 1.18 or later
+        binary: String,
+    },
+    /// Find the third-party libraries in built JavaScript from license comments and source maps
+    Bundle {
+        /// JavaScript bundle, or a build directory such as `dist/`
+        bundle: String,
+    },
+    /// Check packages given by their package URL, e.g. `pkg:golang/github.com/gin-gonic/gin@v1.9.1`
+    Check {
+        /// Package URLs to check
+        #[arg(required = true)]
+        packages: Vec<String>,
+    },
+    /// Look up the license, obligations and classification of a single package
+    Lookup {
+        /// Ecosystem of the package: npm, pypi, cargo, go, gem, pub, hex, nuget or maven
+        ecosystem: String,
+
+        /// Name of the package, e.g. `lodash`, `@babel/core` or `org.slf4j:slf4j-api`
+        name: String,
+
+        /// Version to look up [default: the latest release]
+        version: Option<String>,
+
+        /// Project license to check compatibility against [default: detected in the current directory]
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Output the package in JSON format
+        #[arg(long, short)]
+        json: bool,
+    },
+    /// Scan a container image's OS packages and language dependencies
+    Image {
+        /// Image to pull (e.g. `debian:12`, `ghcr.io/acme/app:1.0`), or a `docker save` archive or OCI layout
+        reference: String,
+
+        /// Platform of a multi-platform image, as os/arch[/variant] [default: linux/<host architecture>]
+        #[arg(long)]
+        platform: Option<String>,
+
+        /// Username for the registry, exchanged for a pull token together with the password
+        #[arg(long, env = "FELUDA_REGISTRY_USERNAME", requires = "registry_password")]
+        registry_username: Option<String>,
+
+        /// Password or access token for the registry
+        #[arg(long, env = "FELUDA_REGISTRY_PASSWORD", hide_env_values = true)]
+        registry_password: Option<String>,
+    },
+    /// Scan the packages installed in a root filesystem, such as a mounted disk image or chroot
+    Filesystem {
+        /// Root directory, or a tar archive of one as written by `docker export`
+        root: String,
+    },
+    /// Print the full text of a license or of a dependency's license
+    LicenseText {
+        /// SPDX license identifier (`Apache-2.0`), `<package>@<version>` or a package URL
+        target: String,
+
+        /// Project directory whose installed packages are searched first
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Write the text to this file instead of printing it
+        #[arg(short, long)]
+        output: Option<String>,
+    },
+    /// Find first-party source files whose license header conflicts with the project license
+    Headers {
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Specify the project license explicitly
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Output every file with a license header in JSON format
+        #[arg(long, short)]
+        json: bool,
+
+        /// Fail with non-zero exit code when a file's license is incompatible with the project license
+        #[arg(long)]
+        fail_on_conflict: bool,
+    },
+    /// Check the project against the REUSE specification: copyright and license of every file and the texts in LICENSES/
+    Reuse {
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Output the report in JSON format
+        #[arg(long, short)]
+        json: bool,
+
+        /// Annotate the files lacking copyright or license, and download missing license texts into LICENSES/
+        #[arg(long, value_enum, value_name = "FORMAT", num_args = 0..=1, default_missing_value = "toml")]
+        generate: Option<ReuseFormat>,
+
+        /// License of the annotated files, instead of the project license
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Copyright of the annotated files, instead of the one in the LICENSE file
+        #[arg(long)]
+        copyright: Option<String>,
+    },
+    /// Export the dependency graph, colored by license class
+    Graph {
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Graph format
+        #[arg(long, short, value_enum, default_value_t = GraphFormat::Dot)]
+        format: GraphFormat,
+
+        /// File to write instead of printing the graph
+        #[arg(short, long)]
+        output: Option<String>,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Specify the project license explicitly
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Enable strict mode for license parser
+        #[arg(long)]
+        strict: bool,
+
+        /// Skip local license detection, force network lookup only
+        #[arg(long)]
+        no_local: bool,
+
+        /// Leave out dev, test and build dependencies
+        #[arg(long)]
+        exclude_dev: bool,
+    },
+    /// Suggest replacements, versions or reviewed exceptions for each finding
+    Remediate {
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Step through the findings and record accepted exceptions in .feluda.toml
+        #[arg(long, short, conflicts_with = "json")]
+        interactive: bool,
+
+        /// Output the suggestions in JSON format
+        #[arg(long, short)]
+        json: bool,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Specify the project license explicitly
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Enable strict mode for license parser
+        #[arg(long)]
+        strict: bool,
+
+        /// Skip local license detection, force network lookup only
+        #[arg(long)]
+        no_local: bool,
+
+        /// Leave out dev, test and build dependencies
+        #[arg(long)]
+        exclude_dev: bool,
+    },
+    /// Manage the baseline of accepted violations
+    Baseline {
+        #[command(subcommand)]
+        command: BaselineCommand,
+    },
+    /// Record manual review decisions that carry forward into later scans
+    Review {
+        #[command(subcommand)]
+        command: ReviewCommand,
+    },
+    /// Show how a package changed across the scans recorded with --store
+    History {
+        /// Name of the package, or its package URL
+        package: String,
+
+        /// Only include scans of this project (the directory name of the scanned path)
+        #[arg(long)]
+        project: Option<String>,
+
+        /// Output the changes in JSON format
+        #[arg(long, short)]
+        json: bool,
+    },
+    /// Show how license exposure changed across the scans recorded with --store
+    Trends {
+        /// Only include scans of this project (the directory name of the scanned path)
+        #[arg(long)]
+        project: Option<String>,
+
+        /// Number of most recent scans to show
+        #[arg(long, default_value_t = 20, value_parser = clap::value_parser!(u64).range(1..))]
+        limit: u64,
+
+        /// Output the scans in JSON format
+        #[arg(long, short)]
+        json: bool,
+    },
+    /// Re-run the scan whenever manifests or lockfiles change and print what changed
+    Watch {
+        /// Path to the local project directory
+        #[arg(short, long, default_value = "./")]
+        path: String,
+
+        /// Specify the language to scan
+        #[arg(long, short)]
+        language: Option<String>,
+
+        /// Specify the project license explicitly
+        #[arg(long)]
+        project_license: Option<String>,
+
+        /// Enable strict mode for license parser
+        #[arg(long)]
+        strict: bool,
+
+        /// Skip local license detection, force network lookup only
+        #[arg(long)]
+        no_local: bool,
+
+        /// Also watch and scan projects in subdirectories
+        #[arg(long, short)]
+        recursive: bool,
+
+        /// Leave out dev, test and build dependencies
+        #[arg(long)]
+        exclude_dev: bool,
+
+        /// Seconds between checks for changed files
+        #[arg(long, default_value_t = 2, value_parser = clap::value_parser!(u64).range(1..))]
+        interval: u64,
+
+        /// Print each set of changes as one line of JSON
+        #[arg(long, short)]
+        json: bool,
+    },
+    /// Run Feluda as a git pre-commit hook
+    Hook {
+        #[command(subcommand)]
+        command: HookCommand,
+    },
+    /// Print a shell completion script
+    ///
+    /// Subcommands, flags and their values complete, including SPDX license
+    /// identifiers, ecosystem names and configuration keys. The script calls
+    /// `feluda` with `COMPLETE` set to the shell's name.
+    Completion {
+        /// Shell the script is for
+        #[arg(value_enum)]
+        shell: Shell,
+    },
+    /// Generate documentation for installing Feluda system-wide
+    Docs {
+        #[command(subcommand)]
+        command: DocsCommand,
+    },
+}
+
+/// Shells `feluda completion` writes a script for
+#[derive(ValueEnum, Clone, Copy, Debug, PartialEq, Eq)]
+#[allow(clippy::enum_variant_names)]
+pub enum Shell {
+    Bash,
+    Zsh,
+    Fish,
+    #[value(name = "powershell")]
+    PowerShell,
+}
+
+impl Shell {
+    /// The name clap_complete knows the shell by
+    pub fn name(self) -> &'static str {
+        match self {
+            Self::Bash => "bash",
+            Self::Zsh => "zsh",
+            Self::Fish => "fish",
+            Self::PowerShell => "powershell",
+        }
+    }
 }
 
 #[derive(Parser, Debug, Clone)]
@@ -129,10 +925,22 @@ pub enum Commands {
 #[command(group(ArgGroup::new("source").args(["path", "repo"]).multiple(false)))] // Mutually exclusive path and repo
 #[command(before_help = format_before_help())]
 pub struct Cli {
-    /// Enable debug mode
+    /// Enable debug mode, logging everything down to trace level
     #[arg(long, short, global = true)]
     pub debug: bool,
 
+    /// Log messages up to this level to stderr
+    #[arg(long, global = true, value_enum, value_name = "LEVEL")]
+    pub log_level: Option<LogLevel>,
+
+    /// Format of log lines
+    #[arg(long, global = true, value_enum, default_value_t = LogFormat::Text)]
+    pub log_format: LogFormat,
+
+    /// Language of reports and errors: en, de, fr, es or ja
+    #[arg(long, global = true, env = "FELUDA_LANG", value_name = "LANG", value_parser = parse_language)]
+    pub lang: Option<Language>,
+
     #[command(subcommand)]
     pub command: Option<Commands>,
 
@@ -140,8 +948,8 @@ pub struct Cli {
     #[arg(short, long, default_value = "./")]
     pub path: String,
 
-    /// URL of the Git repository to analyze (HTTPS or SSH)
-    #[arg(long)]
+    /// URL of the Git repository to analyze (HTTPS or SSH), optionally with `@<ref>` for a branch, tag or commit
+    #[arg(long, conflicts_with = "offline")]
     pub repo: Option<String>,
 
     // For HTTPS authentication
@@ -160,6 +968,14 @@ pub struct Cli {
     #[arg(long, env = "GITHUB_TOKEN", global = true)]
     pub github_token: Option<String>,
 
+    /// GitLab personal access token for license lookups in GitLab repositories
+    #[arg(long, env = "GITLAB_TOKEN", global = true)]
+    pub gitlab_token: Option<String>,
+
+    /// Record every scan in this database, and read `feluda history` and `feluda trends` from it, e.g. sqlite:.feluda/history.db
+    #[arg(long, env = "FELUDA_STORE", global = true, value_name = "URL")]
+    pub store: Option<String>,
+
     /// Output in JSON format
     #[arg(long, short, group = "output")]
     /// This will override the default output format
@@ -190,8 +1006,8 @@ pub struct Cli {
     #[arg(long, short)]
     pub language: Option<String>,
 
-    /// Output format for CI systems (github, jenkins)
-    #[arg(long, value_enum)]
+    /// Output format for CI systems (github, jenkins, sarif, gitlab, bitbucket)
+    #[arg(long, value_enum, visible_alias = "ci")]
     pub ci_format: Option<CiFormat>,
 
     /// Path to write the CI report file
@@ -210,6 +1026,14 @@ pub struct Cli {
     #[arg(long)]
     pub fail_on_incompatible: bool,
 
+    /// Findings that fail the scan, comma separated
+    #[arg(long, value_enum, value_delimiter = ',', value_name = "FINDINGS")]
+    pub fail_on: Vec<FailOn>,
+
+    /// Number of failing findings tolerated before the scan fails
+    #[arg(long, default_value_t = 0, value_name = "N")]
+    pub max_violations: usize,
+
     /// Specify the project license (overrides auto-detection)
     #[arg(long)]
     pub project_license: Option<String>,
@@ -226,9 +1050,157 @@ pub struct Cli {
     #[arg(long)]
     pub strict: bool,
 
+    /// Fail the scan on the first project or license lookup error instead of reporting dependencies with status "error"
+    #[arg(long)]
+    pub fail_fast: bool,
+
     /// Skip local license detection, force network lookup only
     #[arg(long)]
     pub no_local: bool,
+
+    /// Discover and scan projects in all subdirectories (monorepos)
+    #[arg(long)]
+    pub recursive: bool,
+
+    /// With --recursive, only scan project directories matching this gitignore-style pattern
+    #[arg(long, value_name = "PATTERN")]
+    pub include: Vec<String>,
+
+    /// Skip directories and manifests matching this gitignore-style pattern
+    #[arg(long, value_name = "PATTERN")]
+    pub exclude: Vec<String>,
+
+    /// Leave out dependencies that don't ship: dev, test and build scopes
+    #[arg(long)]
+    pub exclude_dev: bool,
+
+    /// Only scan dependencies in this scope (repeatable)
+    #[arg(long, value_enum, value_name = "SCOPE")]
+    pub scope: Vec<DependencyScope>,
+
+    /// Read licenses from vendored dependencies (vendor/, node_modules/, third_party/) without resolving anything
+    #[arg(long)]
+    pub vendored: bool,
+
+    /// Take the dependencies from a CycloneDX or SPDX JSON document instead of scanning the project
+    #[arg(long, value_name = "FILE", conflicts_with_all = ["vendored", "recursive"])]
+    pub from_sbom: Option<String>,
+
+    /// Look up known vulnerabilities (CVE/GHSA) for each dependency on OSV.dev
+    #[arg(long, conflicts_with = "offline")]
+    pub vulns: bool,
+
+    /// Fail with non-zero exit code when known vulnerabilities are found (implies --vulns)
+    #[arg(long, conflicts_with = "offline")]
+    pub fail_on_vulns: bool,
+
+    /// Report deprecated, yanked and archived packages, see [policy.health] to fail on them
+    #[arg(long, conflicts_with = "offline")]
+    pub health: bool,
+
+    /// Enrich dependencies from deps.dev: missing licenses, required packages and OpenSSF Scorecard scores
+    #[arg(long, conflicts_with = "offline")]
+    pub deps_dev: bool,
+
+    /// Collect copyright statements from the license files and source headers of installed dependencies
+    #[arg(long)]
+    pub copyright: bool,
+
+    /// Look for PATENTS, EULA, commercial license and CLA files in installed dependencies, see [policy.legal_files] to fail on them
+    #[arg(long)]
+    pub legal_files: bool,
+
+    /// Summarize the obligations of each license: attribution, source disclosure, patent grant and same license
+    #[arg(long)]
+    pub obligations: bool,
+
+    /// Print a compliance score out of 100, weighted by the severity and depth of each finding
+    #[arg(long)]
+    pub score: bool,
+
+    /// Write a "License check" badge: shields.io endpoint JSON for a .json file, SVG otherwise
+    #[arg(long, value_name = "FILE")]
+    pub badge: Option<String>,
+
+    /// Submit the resolved dependencies to the GitHub dependency graph of the repository
+    #[arg(long, conflicts_with = "offline")]
+    pub submit_github: bool,
+
+    /// Send the [[notifications]] of the configuration: Slack, Microsoft Teams and webhooks
+    #[arg(long, conflicts_with = "offline")]
+    pub notify: bool,
+
+    /// Open tickets for new policy violations in the [tickets] tracker and close those that are gone
+    #[arg(long, conflicts_with = "offline")]
+    pub sync_tickets: bool,
+
+    /// Only fail on violations missing from this baseline [default: .feluda-baseline.json in the project directory]
+    #[arg(long, value_name = "FILE")]
+    pub baseline: Option<String>,
+
+    /// Merge the review decisions of this file [default: .feluda-reviews.json in the project directory]
+    #[arg(long, value_name = "FILE")]
+    pub reviews: Option<String>,
+
+    /// Only report dependencies without a review, or changed since their review
+    #[arg(long)]
+    pub unreviewed: bool,
+
+    /// Ignore cached package licenses and fetch them again
+    #[arg(long, global = true)]
+    pub refresh: bool,
+
+    /// Number of dependencies to analyze in parallel [default: number of CPUs, at least 8]
+    #[arg(long, global = true, value_parser = clap::value_parser!(u16).range(1..))]
+    pub concurrency: Option<u16>,
+
+    /// Seconds before a network request is abandoned [default: 30, or `[registries] timeout`]
+    #[arg(long, global = true, value_name = "SECS", value_parser = clap::value_parser!(u64).range(1..))]
+    pub timeout: Option<u64>,
+
+    /// Retries of a network request after timeouts, connection errors, 429 and 5xx responses
+    #[arg(long, global = true, value_name = "N")]
+    pub retries: Option<u32>,
+
+    /// Memory Feluda may use, e.g. 512M or 2G; it fails once it uses more
+    #[arg(long, global = true, value_name = "SIZE", value_parser = parse_size)]
+    pub max_memory: Option<u64>,
+
+    /// Dependencies a scan may look up before it fails, counting every project
+    #[arg(long, global = true, value_name = "N", value_parser = clap::value_parser!(u64).range(1..))]
+    pub max_deps: Option<u64>,
+
+    /// Never access the network; resolve licenses from lockfiles, vendored sources, the cache and the license database
+    #[arg(long, global = true, env = "FELUDA_OFFLINE")]
+    pub offline: bool,
+
+    /// License database snapshot, consulted before registries and instead of them with --offline [default: license-db.json in the cache directory]
+    #[arg(long, global = true, env = "FELUDA_LICENSE_DB", value_name = "FILE")]
+    pub license_db: Option<String>,
+
+    /// Output the scan result in a structured format (cyclonedx, cyclonedx-xml, spdx-json, spdx-tv, html, json, csv, xlsx)
+    #[arg(long, value_enum, group = "output")]
+    pub format: Option<OutputFormat>,
+
+    /// Schema version of --format json output [default: latest, currently 2]
+    #[arg(long, value_name = "VERSION", requires = "format", value_parser = clap::value_parser!(u8).range(1..=2))]
+    pub schema: Option<u8>,
+
+    /// Render the report through a Go text/template file, with the --format json document as data
+    #[arg(long, value_name = "FILE", group = "output")]
+    pub template: Option<String>,
+
+    /// Sign the report file or SBOMs with cosign (keyless unless --sign-key is given)
+    #[arg(long, global = true)]
+    pub sign: bool,
+
+    /// Key for cosign to sign with: a key file, KMS URI or env://VAR (implies --sign)
+    #[arg(long, global = true, value_name = "KEY")]
+    pub sign_key: Option<String>,
+
+    /// Write an in-toto attestation binding the report file or SBOMs to the scanned git commit
+    #[arg(long, global = true)]
+    pub attest: bool,
 }
 
 impl Cli {
@@ -251,6 +1223,27 @@ impl Cli {
     pub fn is_default_command(&self) -> bool {
         self.command.is_none()
     }
+
+    /// Signing and attestation of the files written by the command
+    pub fn signing_options(&self) -> SigningOptions {
+        SigningOptions {
+            sign: self.sign || self.sign_key.is_some(),
+            key: self.sign_key.clone(),
+            attest: self.attest,
+        }
+    }
+}
+
+/// Command line arguments with a leading `scan` removed
+///
+/// Scanning is what `feluda` does without a subcommand, so `feluda scan --repo <url>`
+/// is the same as `feluda --repo <url>`.
+pub fn scan_args(args: impl IntoIterator<Item = String>) -> Vec<String> {
+    let mut args: Vec<String> = args.into_iter().collect();
+    if args.get(1).is_some_and(|arg| arg == "scan") {
+        args.remove(1);
+    }
+    args
 }
 
 fn format_before_help() -> String {
@@ -419,6 +1412,9 @@ where
         let duration = start.elapsed();
         log(LogLevel::Info, &format!("Completed in {duration:?}"));
         result
+    } else if crate::progress::is_active() {
+        // The progress bar of the whole scan is drawn instead
+        f(&LoadingIndicator::new(message))
     } else {
         let mut indicator = LoadingIndicator::new(message);
         indicator.start();
@@ -459,6 +1455,8 @@ mod tests {
     fn test_cli_default_values() {
         let cli = Cli {
             debug: false,
+            log_level: None,
+            log_format: LogFormat::Text,
             command: None,
             path: "./".to_string(),
             repo: None,
@@ -482,6 +1480,48 @@ mod tests {
             osi: None,
             strict: false,
             no_local: false,
+            format: None,
+            refresh: false,
+            concurrency: None,
+            timeout: None,
+            retries: None,
+            recursive: false,
+            include: Vec::new(),
+            exclude: Vec::new(),
+            vulns: false,
+            fail_on_vulns: false,
+            exclude_dev: false,
+            offline: false,
+            license_db: None,
+            schema: None,
+            scope: Vec::new(),
+            vendored: false,
+            from_sbom: None,
+            copyright: false,
+            submit_github: false,
+            baseline: None,
+            fail_on: Vec::new(),
+            max_violations: 0,
+            sign: false,
+            sign_key: None,
+            attest: false,
+            health: false,
+            store: None,
+            template: None,
+            obligations: false,
+            fail_fast: false,
+            score: false,
+            badge: None,
+            deps_dev: false,
+            notify: false,
+            sync_tickets: false,
+            gitlab_token: None,
+            reviews: None,
+            unreviewed: false,
+            lang: None,
+            max_memory: None,
+            max_deps: None,
+            legal_files: false,
         };
 
         assert_eq!(cli.path, "./");
@@ -498,6 +1538,8 @@ mod tests {
     fn test_get_command_args_with_command() {
         let cli = Cli {
             debug: false,
+            log_level: None,
+            log_format: LogFormat::Text,
             command: Some(Commands::Generate {
                 path: "/test/path".to_string(),
                 language: Some("rust".to_string()),
@@ -525,6 +1567,48 @@ mod tests {
             osi: None,
             strict: false,
             no_local: false,
+            format: None,
+            refresh: false,
+            concurrency: None,
+            timeout: None,
+            retries: None,
+            recursive: false,
+            include: Vec::new(),
+            exclude: Vec::new(),
+            vulns: false,
+            fail_on_vulns: false,
+            exclude_dev: false,
+            offline: false,
+            license_db: None,
+            schema: None,
+            scope: Vec::new(),
+            vendored: false,
+            from_sbom: None,
+            copyright: false,
+            submit_github: false,
+            baseline: None,
+            fail_on: Vec::new(),
+            max_violations: 0,
+            sign: false,
+            sign_key: None,
+            attest: false,
+            health: false,
+            store: None,
+            template: None,
+            obligations: false,
+            fail_fast: false,
+            score: false,
+            badge: None,
+            deps_dev: false,
+            notify: false,
+            sync_tickets: false,
+            gitlab_token: None,
+            reviews: None,
+            unreviewed: false,
+            lang: None,
+            max_memory: None,
+            max_deps: None,
+            legal_files: false,
         };
 
         let cmd = cli.get_command_args();
@@ -544,6 +1628,84 @@ mod tests {
             Commands::Cache { .. } => {
                 panic!("Expected Generate command");
             }
+            Commands::Db { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Config { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Serve { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Diff { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Verify { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Aggregate { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Attributions { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Binary { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Bundle { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Check { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Lookup { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Review { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Image { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Filesystem { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Watch { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Hook { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Completion { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Docs { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::History { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Trends { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Headers { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Reuse { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::LicenseText { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Remediate { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Baseline { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Graph { .. } => {
+                panic!("Expected Generate command");
+            }
         }
         assert!(!cli.is_default_command());
     }
@@ -552,6 +1714,8 @@ mod tests {
     fn test_get_command_args_default() {
         let cli = Cli {
             debug: false,
+            log_level: None,
+            log_format: LogFormat::Text,
             command: None,
             path: "./test".to_string(),
             repo: None,
@@ -575,6 +1739,48 @@ mod tests {
             osi: None,
             strict: false,
             no_local: false,
+            format: None,
+            refresh: false,
+            concurrency: None,
+            timeout: None,
+            retries: None,
+            recursive: false,
+            include: Vec::new(),
+            exclude: Vec::new(),
+            vulns: false,
+            fail_on_vulns: false,
+            exclude_dev: false,
+            offline: false,
+            license_db: None,
+            schema: None,
+            scope: Vec::new(),
+            vendored: false,
+            from_sbom: None,
+            copyright: false,
+            submit_github: false,
+            baseline: None,
+            fail_on: Vec::new(),
+            max_violations: 0,
+            sign: false,
+            sign_key: None,
+            attest: false,
+            health: false,
+            store: None,
+            template: None,
+            obligations: false,
+            fail_fast: false,
+            score: false,
+            badge: None,
+            deps_dev: false,
+            notify: false,
+            sync_tickets: false,
+            gitlab_token: None,
+            reviews: None,
+            unreviewed: false,
+            lang: None,
+            max_memory: None,
+            max_deps: None,
+            legal_files: false,
         };
 
         let cmd = cli.get_command_args();
@@ -594,6 +1800,84 @@ mod tests {
             Commands::Cache { .. } => {
                 panic!("Expected Generate command");
             }
+            Commands::Db { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Config { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Serve { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Diff { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Verify { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Aggregate { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Attributions { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Binary { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Bundle { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Check { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Lookup { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Review { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Image { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Filesystem { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Watch { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Hook { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Completion { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Docs { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::History { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Trends { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Headers { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Reuse { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::LicenseText { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Remediate { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Baseline { .. } => {
+                panic!("Expected Generate command");
+            }
+            Commands::Graph { .. } => {
+                panic!("Expected Generate command");
+            }
         }
     }
 
@@ -665,6 +1949,460 @@ mod tests {
         assert_eq!(format!("{github:?}"), format!("{:?}", github_clone));
     }
 
+    #[test]
+    fn test_ci_alias_for_ci_format() {
+        let cli = Cli::try_parse_from(["feluda", "--ci", "github"]).unwrap();
+        assert!(matches!(cli.ci_format, Some(CiFormat::Github)));
+
+        let cli = Cli::try_parse_from(["feluda", "--ci-format", "sarif"]).unwrap();
+        assert!(matches!(cli.ci_format, Some(CiFormat::Sarif)));
+    }
+
+    #[test]
+    fn test_recursive_scan_arguments() {
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "--recursive",
+            "--include",
+            "services/*",
+            "--include",
+            "libs/*",
+            "--exclude",
+            "examples/",
+        ])
+        .unwrap();
+        assert!(cli.recursive);
+        assert_eq!(cli.include, vec!["services/*", "libs/*"]);
+        assert_eq!(cli.exclude, vec!["examples/"]);
+
+        let cli = Cli::try_parse_from(["feluda"]).unwrap();
+        assert!(!cli.recursive);
+        assert!(cli.include.is_empty());
+    }
+
+    #[test]
+    fn test_attributions_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "attributions"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Attributions {
+                format: AttributionFormat::Markdown,
+                output: None,
+                no_fetch: false,
+                ..
+            })
+        ));
+
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "attributions",
+            "--format",
+            "html",
+            "--output",
+            "NOTICE.html",
+            "--no-fetch",
+        ])
+        .unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Attributions {
+                format: AttributionFormat::Html,
+                output: Some(_),
+                no_fetch: true,
+                ..
+            })
+        ));
+    }
+
+    #[test]
+    fn test_from_sbom_argument() {
+        let cli = Cli::try_parse_from(["feluda", "--from-sbom", "bom.json"]).unwrap();
+        assert_eq!(cli.from_sbom.as_deref(), Some("bom.json"));
+        assert!(cli.is_default_command());
+
+        assert!(Cli::try_parse_from(["feluda", "--from-sbom", "bom.json", "--vendored"]).is_err());
+    }
+
+    #[test]
+    fn test_image_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "image", "alpine:3.19"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Image { ref reference, platform: None, .. }) if reference == "alpine:3.19"
+        ));
+
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "--json",
+            "image",
+            "debian:12",
+            "--platform",
+            "linux/arm64",
+        ])
+        .unwrap();
+        assert!(cli.json);
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Image {
+                platform: Some(_),
+                ..
+            })
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "image"]).is_err());
+    }
+
+    #[test]
+    fn test_binary_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "--json", "binary", "dist/app"]).unwrap();
+        assert!(cli.json);
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Binary { ref binary }) if binary == "dist/app"
+        ));
+        assert!(Cli::try_parse_from(["feluda", "binary"]).is_err());
+    }
+
+    #[test]
+    fn test_bundle_command_arguments() {
+        let cli =
+            Cli::try_parse_from(["feluda", "--fail-on-restrictive", "bundle", "dist"]).unwrap();
+        assert!(cli.fail_on_restrictive);
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Bundle { ref bundle }) if bundle == "dist"
+        ));
+        assert!(Cli::try_parse_from(["feluda", "bundle"]).is_err());
+    }
+
+    #[test]
+    fn test_check_command_arguments() {
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "--json",
+            "check",
+            "pkg:golang/github.com/gin-gonic/gin@v1.9.1",
+            "pkg:npm/lodash@4.17.21",
+        ])
+        .unwrap();
+        assert!(cli.json);
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Check { ref packages }) if packages.len() == 2
+        ));
+        assert!(Cli::try_parse_from(["feluda", "check"]).is_err());
+    }
+
+    #[test]
+    fn test_lookup_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "lookup", "npm", "lodash"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Lookup { ref ecosystem, ref name, version: None, json: false, .. })
+                if ecosystem == "npm" && name == "lodash"
+        ));
+
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "lookup",
+            "pypi",
+            "requests",
+            "2.31.0",
+            "--project-license",
+            "MIT",
+            "--json",
+        ])
+        .unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Lookup { version: Some(ref version), json: true, .. }) if version == "2.31.0"
+        ));
+        assert!(Cli::try_parse_from(["feluda", "lookup", "npm"]).is_err());
+    }
+
+    #[test]
+    fn test_license_text_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "license-text", "Apache-2.0"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::LicenseText { ref target, output: None, .. }) if target == "Apache-2.0"
+        ));
+
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "license-text",
+            "@babel/core@7.24.0",
+            "-o",
+            "LICENSE.babel",
+        ])
+        .unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::LicenseText {
+                output: Some(_),
+                ..
+            })
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "license-text"]).is_err());
+    }
+
+    #[test]
+    fn test_fail_on_arguments() {
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "--fail-on",
+            "restrictive,unknown",
+            "--max-violations",
+            "3",
+        ])
+        .unwrap();
+        assert_eq!(cli.fail_on, vec![FailOn::Restrictive, FailOn::Unknown]);
+        assert_eq!(cli.max_violations, 3);
+
+        let cli = Cli::try_parse_from(["feluda"]).unwrap();
+        assert!(cli.fail_on.is_empty());
+        assert_eq!(cli.max_violations, 0);
+
+        assert!(Cli::try_parse_from(["feluda", "--fail-on", "copyleft"]).is_err());
+    }
+
+    #[test]
+    fn test_graph_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "graph"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Graph {
+                format: GraphFormat::Dot,
+                output: None,
+                ..
+            })
+        ));
+
+        let cli = Cli::try_parse_from(["feluda", "graph", "--format", "mermaid", "-o", "deps.mmd"])
+            .unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Graph {
+                format: GraphFormat::Mermaid,
+                output: Some(_),
+                ..
+            })
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "graph", "--format", "svg"]).is_err());
+    }
+
+    #[test]
+    fn test_baseline_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "baseline", "write"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Baseline {
+                command: BaselineCommand::Write { ref path, output: None, .. }
+            }) if path == "./"
+        ));
+
+        let cli = Cli::try_parse_from(["feluda", "--baseline", "ci/baseline.json"]).unwrap();
+        assert_eq!(cli.baseline.as_deref(), Some("ci/baseline.json"));
+
+        assert!(Cli::try_parse_from(["feluda", "baseline"]).is_err());
+    }
+
+    #[test]
+    fn test_review_command_arguments() {
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "review",
+            "set",
+            "readline@8.2.0",
+            "needs-legal",
+            "--comment",
+            "Only linked by the CLI",
+        ])
+        .unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Review {
+                command: ReviewCommand::Set {
+                    ref package,
+                    status: ReviewStatus::NeedsLegal,
+                    comment: Some(_),
+                    file: None,
+                    ..
+                }
+            }) if package == "readline@8.2.0"
+        ));
+        assert!(
+            Cli::try_parse_from(["feluda", "review", "set", "readline@8.2.0", "maybe"]).is_err()
+        );
+
+        let cli = Cli::try_parse_from(["feluda", "--unreviewed", "--reviews", "ci/reviews.json"])
+            .unwrap();
+        assert!(cli.unreviewed);
+        assert_eq!(cli.reviews.as_deref(), Some("ci/reviews.json"));
+    }
+
+    #[test]
+    fn test_filesystem_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "filesystem", "/mnt/disk"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Filesystem { ref root }) if root == "/mnt/disk"
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "filesystem"]).is_err());
+    }
+
+    #[test]
+    fn test_config_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "config", "show", "--effective"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Config {
+                command: ConfigCommand::Show { effective: true }
+            })
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "config"]).is_err());
+    }
+
+    #[test]
+    fn test_watch_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "watch"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Watch { ref path, interval: 2, json: false, .. }) if path == "./"
+        ));
+
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "watch",
+            "--path",
+            "app",
+            "--interval",
+            "5",
+            "--json",
+        ])
+        .unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Watch {
+                interval: 5,
+                json: true,
+                ..
+            })
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "watch", "--interval", "0"]).is_err());
+    }
+
+    #[test]
+    fn test_diff_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "diff", "old.json", "new.json"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Diff {
+                old: Some(_),
+                new: Some(_),
+                base: None,
+                ..
+            })
+        ));
+
+        let cli = Cli::try_parse_from(["feluda", "diff", "--base", "main"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Diff { old: None, base: Some(ref base), .. }) if base == "main"
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "diff", "old.json"]).is_err());
+        assert!(
+            Cli::try_parse_from(["feluda", "diff", "a.json", "b.json", "--base", "main"]).is_err()
+        );
+    }
+
+    #[test]
+    fn test_verify_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "verify", "--golden", "golden.json"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Verify {
+                ref golden,
+                tolerance: GoldenTolerance::Versions,
+                update: false,
+                ..
+            }) if golden == "golden.json"
+        ));
+
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "verify",
+            "--golden",
+            "golden.json",
+            "--tolerance",
+            "allowed",
+        ])
+        .unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Verify {
+                tolerance: GoldenTolerance::Allowed,
+                ..
+            })
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "verify"]).is_err());
+    }
+
+    #[test]
+    fn test_aggregate_command_arguments() {
+        let cli = Cli::try_parse_from(["feluda", "aggregate", "reports/", "extra.json"]).unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Aggregate { ref reports, ref scan, .. }) if reports.len() == 2 && scan.is_empty()
+        ));
+
+        let cli = Cli::try_parse_from([
+            "feluda",
+            "aggregate",
+            "--scan",
+            "repos/web",
+            "repos/api",
+            "--output-dir",
+            "reports",
+        ])
+        .unwrap();
+        assert!(matches!(
+            cli.command,
+            Some(Commands::Aggregate { ref scan, output_dir: Some(_), .. }) if scan.len() == 2
+        ));
+
+        assert!(Cli::try_parse_from(["feluda", "aggregate"]).is_err());
+        assert!(
+            Cli::try_parse_from(["feluda", "aggregate", "a.json", "--output-dir", "out"]).is_err()
+        );
+    }
+
+    #[test]
+    fn test_scan_args() {
+        let args = |args: &[&str]| scan_args(args.iter().map(|arg| arg.to_string()));
+        assert_eq!(
+            args(&[
+                "feluda",
+                "scan",
+                "--repo",
+                "https://github.com/org/project@v1.0"
+            ]),
+            vec!["feluda", "--repo", "https://github.com/org/project@v1.0"]
+        );
+        assert_eq!(
+            args(&["feluda", "--path", "scan"]),
+            vec!["feluda", "--path", "scan"]
+        );
+        assert_eq!(args(&["feluda"]), vec!["feluda"]);
+    }
+
     #[test]
     fn test_commands_enum_clone() {
         let generate_cmd = Commands::Generate {
@@ -0,0 +1,189 @@
+//! Shell completion
+//!
+//! Completion is clap_complete's dynamic completion: `feluda completion <shell>`
+//! prints a registration script that calls the binary back with `COMPLETE` set,
+//! and [`complete_from_env`] answers those calls before the arguments are
+//! parsed. Subcommands, flags and the values of enum flags come from the clap
+//! definition of the running binary; this module adds the values clap doesn't
+//! know: SPDX license identifiers for `--project-license` and `--license`,
+//! ecosystem names for `--language`, report languages for `--lang` and
+//! configuration keys for `feluda config get`.
+
+use std::collections::BTreeSet;
+use std::ffi::OsStr;
+
+use clap::{Arg, Command, CommandFactory};
+use clap_complete::engine::{ArgValueCompleter, CompletionCandidate};
+use clap_complete::env::{CompleteEnv, Shells};
+
+use crate::cli::{Cli, Shell};
+use crate::debug::{FeludaError, FeludaResult};
+use crate::i18n::Language;
+use crate::obligations::known_licenses;
+use crate::parser::LANGUAGE_NAMES;
+use crate::{config, offline};
+
+/// Environment variable the registration scripts set to the shell's name
+const COMPLETE_VAR: &str = "COMPLETE";
+
+/// Values that complete an argument but aren't in its clap definition
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum DynamicValues {
+    Licenses,
+    Ecosystems,
+    Languages,
+    ConfigKeys,
+}
+
+impl DynamicValues {
+    fn of(command: &str, arg: &Arg) -> Option<Self> {
+        match (command, arg.get_id().as_str()) {
+            (_, "project_license" | "license") | ("license-text", "target") => Some(Self::Licenses),
+            (_, "language") => Some(Self::Ecosystems),
+            (_, "lang") => Some(Self::Languages),
+            ("get", "key") => Some(Self::ConfigKeys),
+            _ => None,
+        }
+    }
+
+    fn values(self) -> Vec<String> {
+        match self {
+            Self::Licenses => license_ids(),
+            Self::Ecosystems => LANGUAGE_NAMES.into_iter().map(String::from).collect(),
+            Self::Languages => Language::ALL
+                .iter()
+                .map(|language| language.code().to_string())
+                .collect(),
+            Self::ConfigKeys => config::setting_keys(),
+        }
+    }
+
+    /// The values starting with the word being completed
+    fn candidates(self, current: &OsStr) -> Vec<CompletionCandidate> {
+        let Some(current) = current.to_str() else {
+            return Vec::new();
+        };
+        self.values()
+            .into_iter()
+            .filter(|value| value.starts_with(current))
+            .map(CompletionCandidate::new)
+            .collect()
+    }
+}
+
+/// SPDX identifiers from the obligations table, the configuration and the
+/// offline license database
+fn license_ids() -> Vec<String> {
+    let mut ids: BTreeSet<String> = known_licenses().map(String::from).collect();
+    if let Ok(config) = config::load_local_config() {
+        ids.extend(config.licenses.restrictive);
+        ids.extend(config.licenses.ignore);
+        ids.extend(config.licenses.custom.into_keys());
+    }
+    if let Some(db) = offline::license_db() {
+        ids.extend(db.github_licenses.keys().cloned());
+        ids.extend(db.osi_licenses.iter().cloned());
+    }
+    // `SEE LICENSE IN LICENSE` isn't an identifier and would need quoting
+    ids.retain(|id| !id.is_empty() && !id.contains(char::is_whitespace));
+    ids.into_iter().collect()
+}
+
+/// The clap definition with the dynamic values attached to their arguments
+pub fn command() -> Command {
+    with_value_completers(Cli::command())
+}
+
+fn with_value_completers(command: Command) -> Command {
+    let name = command.get_name().to_string();
+    command
+        .mut_args(|arg| match DynamicValues::of(&name, &arg) {
+            Some(values) => arg.add(ArgValueCompleter::new(move |current: &OsStr| {
+                values.candidates(current)
+            })),
+            None => arg,
+        })
+        .mut_subcommands(with_value_completers)
+}
+
+/// Answer a completion request and exit when a registration script called
+/// the binary, return otherwise
+pub fn complete_from_env() {
+    CompleteEnv::with_factory(command).complete();
+}
+
+/// The registration script for `shell`
+pub fn script(shell: Shell) -> FeludaResult<String> {
+    let name = shell.name();
+    let shells = Shells::builtins();
+    let completer = shells
+        .completer(name)
+        .ok_or_else(|| FeludaError::InvalidData(format!("No completion support for {name}")))?;
+    let mut script = Vec::new();
+    completer.write_registration(COMPLETE_VAR, "feluda", "feluda", "feluda", &mut script)?;
+    String::from_utf8(script).map_err(|e| FeludaError::InvalidData(e.to_string()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn values(command: &Command, arg: &str, current: &str) -> Vec<String> {
+        let arg = command
+            .get_arguments()
+            .find(|candidate| candidate.get_id() == arg)
+            .unwrap_or_else(|| panic!("no argument {arg}"));
+        let completer = arg
+            .get::<ArgValueCompleter>()
+            .unwrap_or_else(|| panic!("{} has no value completer", arg.get_id()));
+        completer
+            .candidates(OsStr::new(current))
+            .into_iter()
+            .map(|candidate| candidate.get_value().to_string_lossy().into_owned())
+            .collect()
+    }
+
+    fn subcommand<'a>(command: &'a Command, path: &[&str]) -> &'a Command {
+        path.iter().fold(command, |command, name| {
+            command.find_subcommand(name).unwrap()
+        })
+    }
+
+    #[test]
+    fn test_dynamic_values() {
+        let root = command();
+        assert!(values(&root, "project_license", "Apache").contains(&"Apache-2.0".to_string()));
+        assert_eq!(values(&root, "language", "ca"), vec!["cabal"]);
+        assert_eq!(values(&root, "lang", "d"), vec!["de"]);
+
+        let get = subcommand(&root, &["config", "get"]);
+        assert_eq!(
+            values(get, "key", "licenses.res"),
+            vec!["licenses.restrictive"]
+        );
+
+        // Paths are left to clap_complete
+        let path = root
+            .get_arguments()
+            .find(|arg| arg.get_id() == "path")
+            .unwrap();
+        assert!(path.get::<ArgValueCompleter>().is_none());
+    }
+
+    #[test]
+    fn test_license_ids() {
+        let ids = license_ids();
+        assert!(ids.contains(&"MIT".to_string()));
+        assert!(ids.contains(&"GPL-3.0".to_string()));
+        assert!(!ids.iter().any(|id| id.contains(' ')));
+    }
+
+    #[test]
+    fn test_scripts() {
+        for shell in [Shell::Bash, Shell::Zsh, Shell::Fish, Shell::PowerShell] {
+            let script = script(shell).unwrap();
+            assert!(script.contains(COMPLETE_VAR), "{shell:?}");
+            assert!(script.contains("feluda"), "{shell:?}");
+        }
+    }
+}
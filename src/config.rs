@@ -1,11 +1,21 @@
 //! Configuration handling for Feluda
 //!
 //! This module provides functionality to load and manage configuration settings.
-//! Configuration can be provided through:
+//! Configuration is layered, each source overriding the ones before it:
 //!
 //! 1. Default values (built into the binary)
-//! 2. `.feluda.toml` file in the project root
-//! 3. Environment variables prefixed with `FELUDA_`
+//! 2. The system configuration file, for organization-wide defaults:
+//!    `/etc/feluda/config.toml`, `%PROGRAMDATA%\feluda\config.toml` on
+//!    Windows, or the file named by `FELUDA_SYSTEM_CONFIG`
+//! 3. `.feluda.toml` (or `.feluda.yml`) file in the project root
+//! 4. The `[policy]` and `[licenses]` of the organization's remote policy,
+//!    when `[policy.remote]` names one, see [`crate::policy_server`]
+//! 5. Environment variables prefixed with `FELUDA_`
+//! 6. Command-line flags, applied by each command
+//!
+//! Tables are merged key by key, so a project file only needs the settings it
+//! changes. `feluda config show --effective` prints the merged configuration
+//! and where each setting comes from.
 //!
 //! # Configuration File Example
 //!
@@ -24,6 +34,13 @@
 //!     "Apache-2.0",   # Apache License 2.0
 //! ]
 //!
+//! # An internal license that is not on the SPDX list
+//! [licenses.custom."LicenseRef-ACME-Internal"]
+//! name = "ACME Internal Use Only"
+//! text_file = "legal/acme-internal.txt"
+//! patterns = ["(?i)acme internal use only"]
+//! restrictive = true
+//!
 //! [[dependencies.ignore]]
 //! name = "github.com/opcotech/elemo-pre-mailer"
 //! version = "v1.0.0"
@@ -33,6 +50,115 @@
 //! name = "something-else"
 //! version = ""  # Empty version means ignore all versions of this dependency
 //! reason = "We have a written acknowledgment from the author that we may use their code under our license."
+//!
+//! [project]
+//! # The project's own license, used when --project-license is not given
+//! license = "Apache-2.0"
+//! # Dependencies are shared libraries, except for Go modules compiled in
+//! linking = "dynamic"
+//!
+//! [project.ecosystem_linking]
+//! go = "static"
+//!
+//! # Adjust the built-in compatibility matrix for a project license
+//! [compatibility."Apache-2.0"]
+//! compatible_with = ["MPL-2.0"]
+//! incompatible_with = ["WTFPL"]
+//!
+//! [policy]
+//! # Only these licenses are accepted (empty means anything not denied)
+//! allow = ["MIT", "Apache-2.0", "BSD-3-Clause"]
+//! # These licenses always fail the scan
+//! deny = ["AGPL-3.0"]
+//! # Use the most permissive license of dual-licensed (OR) dependencies
+//! dual_license = "prefer-permissive"
+//!
+//! # LGPL is only acceptable while it can be relinked
+//! [policy.linking.static]
+//! deny = ["LGPL-2.1-only", "LGPL-3.0-only"]
+//!
+//! # Yanked versions found with --health fail the scan
+//! [policy.health]
+//! yanked = "fail"
+//!
+//! [[policy.exceptions]]
+//! name = "some-gpl-tool"
+//! version = "2.1.0"
+//! expires = "2025-12-31"
+//! reason = "Build-time only, being replaced in Q4."
+//!
+//! [[policy.choices]]
+//! name = "jszip"
+//! license = "MIT"         # instead of GPL-3.0-or-later
+//!
+//! # The compliance team's allow and deny lists, signed with their key
+//! [policy.remote]
+//! url = "https://compliance.example.com/feluda/policy.toml"
+//! key = "/etc/feluda/compliance.pub"
+//!
+//! # A license determined by hand for a package the scanner cannot classify
+//! [overrides."left-pad@1.3.0"]
+//! license = "WTFPL"
+//! reviewed_by = "jane.doe@example.com"
+//! date = "2025-03-14"
+//! reason = "License stated in the README of the published tarball"
+//!
+//! # An external parser for a package manager Feluda doesn't support
+//! [plugins.acme]
+//! command = ["feluda-acme", "--offline"]
+//! files = ["acme.lock"]
+//!
+//! [workspace]
+//! # Discover projects in subdirectories, e.g. in a monorepo
+//! recursive = true
+//! # Gitignore-style patterns for project directories, `exclude` also
+//! # matches manifests and the dependencies of a vendored scan
+//! include = ["services/*", "libs/*"]
+//! exclude = ["examples/", "**/testdata/", "fixtures/**/package-lock.json"]
+//!
+//! [risk]
+//! # Tier for licenses that match no tier, including missing licenses
+//! default = "needs-review"
+//!
+//! # Tiers are listed from most to least severe
+//! [[risk.tiers]]
+//! name = "forbidden"
+//! licenses = ["AGPL-*", "SSPL-1.0"]
+//! exit_code = 3
+//!
+//! [[risk.tiers]]
+//! name = "needs-review"
+//! licenses = ["LGPL-*", "MPL-2.0"]
+//!
+//! [[risk.tiers]]
+//! name = "allowed"
+//! licenses = ["MIT", "Apache-2.0", "BSD-*"]
+//!
+//! [registries]
+//! # Private registries, e.g. Artifactory or Nexus repositories
+//! npm = "https://artifactory.example.com/api/npm/npm/"
+//! maven = ["https://nexus.example.com/repository/maven-public"]
+//! ca_cert = "/etc/ssl/certs/corporate-ca.pem"
+//!
+//! [[registries.credentials]]
+//! host = "artifactory.example.com"
+//! token_env = "ARTIFACTORY_TOKEN"
+//!
+//! [registries.sources]
+//! # Tried in order, each when the one before fails
+//! go = ["https://artifactory.example.com/api/go/go-remote", "https://proxy.golang.org", "deps.dev"]
+//!
+//! # Alert Slack about new restrictive licenses, in `feluda serve` and with --notify
+//! [[notifications]]
+//! kind = "slack"
+//! url_env = "SLACK_WEBHOOK_URL"
+//! on = ["restrictive"]
+//! only_new = true
+//!
+//! # Open and close GitHub issues for policy violations with --sync-tickets
+//! [tickets]
+//! tracker = "github"
+//! labels = ["legal"]
 //! ```
 //!
 //! # Environment Variables
@@ -44,16 +170,26 @@
 //! export FELUDA_LICENSES_RESTRICTIVE='["GPL-3.0","AGPL-3.0"]'
 //! # Override ignore licenses list
 //! export FELUDA_LICENSES_IGNORE='["MIT","Apache-2.0"]'
+//! # Declare the project license
+//! export FELUDA_PROJECT_LICENSE="Apache-2.0"
+//! # Scan every project in the repository
+//! export FELUDA_WORKSPACE_RECURSIVE=true
 //! ```
 
 use figment::{
-    providers::{Env, Format, Serialized, Toml},
+    providers::{Env, Format, Serialized, Toml, Yaml},
     Figment,
 };
 use serde::{Deserialize, Serialize};
-use std::path::Path;
+use std::collections::{BTreeMap, BTreeSet};
+use std::path::{Path, PathBuf};
 
 use crate::debug::{log, log_debug, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::health::HealthSignal;
+use crate::legal_files::LegalFileKind;
+use crate::licenses::{DependencyScope, UnknownLicense};
+use crate::notify::{FindingKind, NotificationKind};
+use crate::tickets::TrackerKind;
 
 /// Main configuration structure for Feluda
 #[derive(Debug, Deserialize, Serialize, Default, Clone)]
@@ -64,6 +200,36 @@ pub struct FeludaConfig {
     pub dependencies: DependencyConfig,
     #[serde(default)]
     pub strict: bool,
+    /// Fail on the first project or license lookup error instead of reporting it, see [`crate::lookup_errors`]
+    #[serde(default)]
+    pub fail_fast: bool,
+    #[serde(default)]
+    pub policy: PolicyConfig,
+    #[serde(default)]
+    pub cache: CacheConfig,
+    #[serde(default)]
+    pub project: ProjectConfig,
+    /// Changes to the built-in compatibility matrix, keyed by project license
+    #[serde(default)]
+    pub compatibility: BTreeMap<String, CompatibilityOverride>,
+    #[serde(default)]
+    pub risk: RiskConfig,
+    #[serde(default)]
+    pub workspace: WorkspaceConfig,
+    #[serde(default)]
+    pub registries: RegistriesConfig,
+    /// Manually determined licenses, keyed by `name@version` or `name`
+    #[serde(default)]
+    pub overrides: BTreeMap<String, LicenseOverride>,
+    /// External parsers for other package managers, keyed by plugin name
+    #[serde(default)]
+    pub plugins: BTreeMap<String, PluginConfig>,
+    /// Slack, Microsoft Teams and webhook notifications of scan results
+    #[serde(default)]
+    pub notifications: Vec<NotificationConfig>,
+    /// Issue tracker of `--sync-tickets`
+    #[serde(default)]
+    pub tickets: TicketsConfig,
 }
 
 impl FeludaConfig {
@@ -71,285 +237,1115 @@ impl FeludaConfig {
     pub fn validate(&self) -> FeludaResult<()> {
         self.licenses.validate()?;
         self.dependencies.validate()?;
+        self.policy.validate()?;
+        self.project.validate()?;
+        for (project_license, entry) in &self.compatibility {
+            entry.validate(project_license)?;
+        }
+        self.risk.validate()?;
+        for (id, license) in &self.licenses.custom {
+            if let Some(tier) = &license.tier {
+                if !self.risk.tiers.iter().any(|t| &t.name == tier) {
+                    return Err(FeludaError::Config(format!(
+                        "Risk tier '{tier}' of custom license '{id}' is not defined in [[risk.tiers]]"
+                    )));
+                }
+            }
+        }
+        self.workspace.validate()?;
+        self.registries.validate()?;
+        for (package, entry) in &self.overrides {
+            entry.validate(package)?;
+        }
+        for (name, plugin) in &self.plugins {
+            plugin.validate(name)?;
+        }
+        for notification in &self.notifications {
+            notification.validate()?;
+        }
+        self.tickets.validate()?;
         Ok(())
     }
+
+    /// `[risk]` with every custom license added to the tier it names
+    pub fn risk_with_custom_licenses(&self) -> RiskConfig {
+        let mut risk = self.risk.clone();
+        for (id, license) in &self.licenses.custom {
+            let Some(name) = &license.tier else {
+                continue;
+            };
+            if let Some(tier) = risk.tiers.iter_mut().find(|tier| &tier.name == name) {
+                tier.licenses.push(id.clone());
+            }
+        }
+        risk
+    }
+
+    /// The override recorded for a dependency, the one for its exact version first
+    pub fn license_override_for(&self, name: &str, version: &str) -> Option<&LicenseOverride> {
+        self.overrides
+            .get(&format!("{name}@{version}"))
+            .or_else(|| self.overrides.get(name))
+    }
 }
 
-/// Configuration for license-related settings
-///
-/// By default, the following licenses are considered restrictive:
-/// - GPL-3.0
-/// - AGPL-3.0
-/// - LGPL-3.0
-/// - MPL-2.0
-/// - SEE LICENSE IN LICENSE
-/// - CC-BY-SA-4.0
-/// - EPL-2.0
-///
-/// This can be overridden via `.feluda.toml` or environment variables.
-#[derive(Debug, Deserialize, Serialize, Clone)]
-pub struct LicenseConfig {
-    #[serde(default = "default_restrictive_licenses")]
-    pub restrictive: Vec<String>,
+/// Settings describing the scanned project itself
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct ProjectConfig {
+    /// The project's license, checked against when `--project-license` is not given.
+    /// When unset, the license is detected from the project files.
     #[serde(default)]
-    pub ignore: Vec<String>,
+    pub license: Option<String>,
+    /// How dependencies are linked into the product, see [`crate::linking`]
+    #[serde(default)]
+    pub linking: Option<Linkage>,
+    /// Linking of one ecosystem's dependencies, keyed by `--language` name, e.g. `go = "static"`
+    #[serde(default)]
+    pub ecosystem_linking: BTreeMap<String, Linkage>,
 }
 
-impl Default for LicenseConfig {
-    fn default() -> Self {
-        Self {
-            restrictive: default_restrictive_licenses(),
-            ignore: Vec::new(),
+impl ProjectConfig {
+    pub fn validate(&self) -> FeludaResult<()> {
+        if self
+            .license
+            .as_ref()
+            .is_some_and(|license| license.trim().is_empty())
+        {
+            return Err(FeludaError::Config(
+                "Empty project license in [project] section".to_string(),
+            ));
+        }
+        if self
+            .ecosystem_linking
+            .keys()
+            .any(|key| key.trim().is_empty())
+        {
+            return Err(FeludaError::Config(
+                "Empty ecosystem name in [project.ecosystem_linking] section".to_string(),
+            ));
         }
+        Ok(())
     }
 }
 
-impl LicenseConfig {
-    /// Validates the license configuration
-    pub fn validate(&self) -> FeludaResult<()> {
-        // Check for empty restrictive licenses list
-        if self.restrictive.is_empty() {
-            log(
-                LogLevel::Warn,
-                "No restrictive licenses configured - all licenses will be considered acceptable",
-            );
+/// How a dependency ends up in the product
+#[derive(Debug, Deserialize, Serialize, Clone, Copy, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum Linkage {
+    /// Compiled into the product's binary, e.g. Go modules or Rust crates
+    Static,
+    /// Loaded as a separate, replaceable library, e.g. a shared object or an npm package
+    Dynamic,
+}
+
+impl std::fmt::Display for Linkage {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Linkage::Static => write!(f, "static"),
+            Linkage::Dynamic => write!(f, "dynamic"),
         }
+    }
+}
 
-        // Check for duplicate licenses in restrictive list
-        let mut seen = std::collections::HashSet::new();
-        let mut duplicates = Vec::new();
+/// Adjustments to the compatibility matrix entry of one project license
+///
+/// Licenses in `compatible_with` are accepted in addition to the built-in
+/// list, and licenses in `incompatible_with` are removed from it. An entry
+/// for a project license without a built-in entry starts from an empty list.
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct CompatibilityOverride {
+    #[serde(default)]
+    pub compatible_with: Vec<String>,
+    #[serde(default)]
+    pub incompatible_with: Vec<String>,
+}
 
-        for license in &self.restrictive {
-            if license.trim().is_empty() {
-                return Err(FeludaError::Config(
-                    "Empty license string found in restrictive licenses list".to_string(),
-                ));
-            }
+impl CompatibilityOverride {
+    pub fn validate(&self, project_license: &str) -> FeludaResult<()> {
+        if project_license.trim().is_empty() {
+            return Err(FeludaError::Config(
+                "Empty project license in [compatibility] section".to_string(),
+            ));
+        }
 
-            if !seen.insert(license) {
-                duplicates.push(license.clone());
+        for license in self.compatible_with.iter().chain(&self.incompatible_with) {
+            if license.trim().is_empty() {
+                return Err(FeludaError::Config(format!(
+                    "Empty license string found in [compatibility.\"{project_license}\"]"
+                )));
             }
         }
 
-        if !duplicates.is_empty() {
+        let conflicting: Vec<_> = self
+            .compatible_with
+            .iter()
+            .filter(|license| self.incompatible_with.contains(license))
+            .map(|s| s.to_string())
+            .collect();
+        if !conflicting.is_empty() {
             return Err(FeludaError::Config(format!(
-                "Duplicate licenses found in restrictive list: {}",
-                duplicates.join(", ")
+                "Licenses marked both compatible and incompatible with {project_license}: {}",
+                conflicting.join(", ")
             )));
         }
+        Ok(())
+    }
+}
 
-        // Validate license format for restrictive licenses (basic SPDX-like validation)
-        for license in &self.restrictive {
-            if !Self::is_valid_license_identifier(license) {
-                log(
-                    LogLevel::Warn,
-                    &format!("License '{license}' may not be a valid SPDX identifier"),
-                );
-            }
-        }
-
-        // Validate ignore licenses list
-        let mut ignore_seen = std::collections::HashSet::new();
-        let mut ignore_duplicates = Vec::new();
-
-        for license in &self.ignore {
-            if license.trim().is_empty() {
-                return Err(FeludaError::Config(
-                    "Empty license string found in ignore licenses list".to_string(),
-                ));
-            }
+/// A license asserted for a dependency after manual review
+///
+/// The scanner reports `license` instead of what it detected and marks the
+/// dependency as manually asserted. Keying the entry by `name@version` makes
+/// a new version go through review again.
+#[derive(Debug, Deserialize, Serialize, Default, Clone, PartialEq)]
+pub struct LicenseOverride {
+    /// SPDX expression of the license, e.g. `MIT` or `MIT OR Apache-2.0`
+    pub license: String,
+    /// Who determined the license
+    #[serde(default)]
+    pub reviewed_by: Option<String>,
+    /// Date (YYYY-MM-DD) of the review
+    #[serde(default)]
+    pub date: Option<String>,
+    /// Where the license was found, e.g. a README or an email from the author
+    #[serde(default)]
+    pub reason: Option<String>,
+}
 
-            if !ignore_seen.insert(license) {
-                ignore_duplicates.push(license.clone());
-            }
+impl LicenseOverride {
+    pub fn validate(&self, package: &str) -> FeludaResult<()> {
+        if package.trim().is_empty() {
+            return Err(FeludaError::Config(
+                "Empty package name in [overrides] section".to_string(),
+            ));
         }
-
-        if !ignore_duplicates.is_empty() {
+        if self.license.trim().is_empty() {
             return Err(FeludaError::Config(format!(
-                "Duplicate licenses found in ignore list: {}",
-                ignore_duplicates.join(", ")
+                "Empty license in [overrides.\"{package}\"]"
             )));
         }
-
-        // Validate license format for ignore licenses
-        for license in &self.ignore {
-            if !Self::is_valid_license_identifier(license) {
-                log(
-                    LogLevel::Warn,
-                    &format!(
-                        "License '{license}' in ignore list may not be a valid SPDX identifier"
-                    ),
-                );
-            }
-        }
-
-        // Check for overlap between restrictive and ignore lists
-        let restrictive_set: std::collections::HashSet<_> = self.restrictive.iter().collect();
-        let ignore_set: std::collections::HashSet<_> = self.ignore.iter().collect();
-        let overlap: Vec<_> = restrictive_set
-            .intersection(&ignore_set)
-            .map(|s| s.to_string())
-            .collect();
-
-        if !overlap.is_empty() {
-            log(
-                LogLevel::Warn,
-                &format!(
-                    "Licenses found in both restrictive and ignore lists will be ignored: {}",
-                    overlap.join(", ")
-                ),
-            );
+        if let Some(date) = self.date.as_deref() {
+            chrono::NaiveDate::parse_from_str(date.trim(), "%Y-%m-%d").map_err(|e| {
+                FeludaError::Config(format!(
+                    "Invalid review date '{date}' in [overrides.\"{package}\"]: {e}"
+                ))
+            })?;
         }
-
-        log_debug("License configuration validation passed", &self.restrictive);
-        log_debug("Ignore licenses configuration", &self.ignore);
         Ok(())
     }
+}
 
-    /// Basic validation for license identifiers
-    fn is_valid_license_identifier(license: &str) -> bool {
-        let license = license.trim();
+/// An external parser plugin, see [`crate::plugins`]
+#[derive(Debug, Deserialize, Serialize, Clone, PartialEq)]
+pub struct PluginConfig {
+    /// Program and its arguments, e.g. `["feluda-acme", "--offline"]`
+    pub command: Vec<String>,
+    /// Names of the manifests or lockfiles the plugin reads; `*` matches any characters
+    pub files: Vec<String>,
+    /// Seconds to wait for the plugin before giving up on the project
+    #[serde(default = "default_plugin_timeout")]
+    pub timeout: u64,
+}
 
-        // Special cases that are valid but don't follow standard patterns
-        if matches!(
-            license,
-            "SEE LICENSE IN LICENSE" | "UNLICENSED" | "NOASSERTION"
-        ) {
-            return true;
-        }
+fn default_plugin_timeout() -> u64 {
+    300
+}
 
-        // Basic pattern: should contain only alphanumeric, dots, hyphens, plus, parentheses
-        // TODO: Improve with a full SPDX regex
-        license
-            .chars()
-            .all(|c| c.is_alphanumeric() || matches!(c, '.' | '-' | '+' | '(' | ')' | '_'))
-            && !license.is_empty()
-            && license.len() <= 100
+impl PluginConfig {
+    pub fn validate(&self, name: &str) -> FeludaResult<()> {
+        if name.trim().is_empty() {
+            return Err(FeludaError::Config(
+                "Empty plugin name in [plugins] section".to_string(),
+            ));
+        }
+        if self
+            .command
+            .first()
+            .is_none_or(|program| program.trim().is_empty())
+        {
+            return Err(FeludaError::Config(format!(
+                "Missing command in [plugins.{name}]"
+            )));
+        }
+        if self.files.is_empty() || self.files.iter().any(|file| file.trim().is_empty()) {
+            return Err(FeludaError::Config(format!(
+                "[plugins.{name}] needs the names of the files it reads in 'files'"
+            )));
+        }
+        if self.timeout == 0 {
+            return Err(FeludaError::Config(format!(
+                "Timeout of [plugins.{name}] must be at least one second"
+            )));
+        }
+        Ok(())
     }
 }
 
-/// Configuration for dependency-related settings
-#[derive(Debug, Deserialize, Serialize, Clone)]
-pub struct DependencyConfig {
-    /// Maximum depth for transitive dependency resolution
-    /// Default is 10 levels deep
-    #[serde(default = "default_max_depth")]
-    pub max_depth: u32,
-    /// Dependencies to exclude from license scanning
+/// A notification of scan results, see [`crate::notify`]
+#[derive(Debug, Deserialize, Serialize, Clone, PartialEq)]
+pub struct NotificationConfig {
+    pub kind: NotificationKind,
+    /// Webhook URL; prefer `url_env`, as webhook URLs usually embed a secret
     #[serde(default)]
-    pub ignore: Vec<IgnoreDependency>,
-}
-
-/// Configuration for a dependency to ignore
-#[derive(Debug, Deserialize, Serialize, Clone)]
-pub struct IgnoreDependency {
-    /// The name/identifier of the dependency (e.g., "github.com/opcotech/elemo-pre-mailer")
-    pub name: String,
-    /// The version of the dependency. Leave empty to ignore all versions.
+    pub url: Option<String>,
+    /// Environment variable holding the webhook URL
     #[serde(default)]
-    pub version: String,
-    /// Reason for ignoring this dependency
+    pub url_env: Option<String>,
+    /// Findings that count towards `min_findings`
+    #[serde(default = "default_notify_on")]
+    pub on: Vec<FindingKind>,
+    /// Only count findings of dependencies missing from the previous scan with that license
     #[serde(default)]
-    pub reason: String,
+    pub only_new: bool,
+    /// Findings needed to send the notification; 0 notifies about every scan
+    #[serde(default = "default_min_findings")]
+    pub min_findings: usize,
+    /// Template of the message, or of the request body for webhooks
+    #[serde(default)]
+    pub template: Option<String>,
 }
 
-impl Default for DependencyConfig {
-    fn default() -> Self {
-        Self {
-            max_depth: default_max_depth(),
-            ignore: Vec::new(),
-        }
-    }
+fn default_notify_on() -> Vec<FindingKind> {
+    vec![
+        FindingKind::Restrictive,
+        FindingKind::Incompatible,
+        FindingKind::Policy,
+    ]
 }
 
-impl DependencyConfig {
-    /// Validates the dependency configuration
+fn default_min_findings() -> usize {
+    1
+}
+
+impl NotificationConfig {
     pub fn validate(&self) -> FeludaResult<()> {
-        // Validate max_depth is within reasonable bounds
-        if self.max_depth == 0 {
-            return Err(FeludaError::Config(
-                "max_depth must be greater than 0".to_string(),
+        let kind = format!("{:?}", self.kind).to_lowercase();
+        match (&self.url, &self.url_env) {
+            (Some(_), Some(_)) | (None, None) => {
+                return Err(FeludaError::Config(format!(
+                    "[[notifications]] of kind '{kind}' needs either 'url' or 'url_env'"
+                )));
+            }
+            (Some(url), None) if !url.starts_with("https://") && !url.starts_with("http://") => {
+                return Err(FeludaError::Config(format!(
+                    "Invalid URL '{url}' in [[notifications]], expected http:// or https://"
+                )));
+            }
+            _ => {}
+        }
+        if self.on.is_empty() && self.min_findings > 0 {
+            return Err(FeludaError::Config(format!(
+                "[[notifications]] of kind '{kind}' counts no findings in 'on' and would never be sent, set min_findings = 0 to notify about every scan"
+            )));
+        }
+        Ok(())
+    }
+}
+
+/// Issue tracker tickets are opened in for policy violations, see [`crate::tickets`]
+#[derive(Debug, Deserialize, Serialize, Clone, PartialEq)]
+pub struct TicketsConfig {
+    #[serde(default)]
+    pub tracker: Option<TrackerKind>,
+    /// GitHub `owner/repo`, defaults to `GITHUB_REPOSITORY` or the `origin` remote
+    #[serde(default)]
+    pub repository: Option<String>,
+    /// Base URL of the Jira site, e.g. `https://acme.atlassian.net`
+    #[serde(default)]
+    pub url: Option<String>,
+    /// Key of the Jira project
+    #[serde(default)]
+    pub project: Option<String>,
+    #[serde(default = "default_issue_type")]
+    pub issue_type: String,
+    /// Jira account of basic authentication; without it the token is sent as a bearer token
+    #[serde(default)]
+    pub username: Option<String>,
+    /// Environment variable holding the API token, GitHub defaults to the `--github-token`
+    #[serde(default)]
+    pub token_env: Option<String>,
+    /// Labels added to every ticket besides `feluda`
+    #[serde(default)]
+    pub labels: Vec<String>,
+}
+
+impl Default for TicketsConfig {
+    fn default() -> Self {
+        Self {
+            tracker: None,
+            repository: None,
+            url: None,
+            project: None,
+            issue_type: default_issue_type(),
+            username: None,
+            token_env: None,
+            labels: Vec::new(),
+        }
+    }
+}
+
+fn default_issue_type() -> String {
+    "Task".to_string()
+}
+
+impl TicketsConfig {
+    pub fn validate(&self) -> FeludaResult<()> {
+        if let Some(repository) = &self.repository {
+            let parts: Vec<&str> = repository.split('/').collect();
+            if parts.len() != 2 || parts.iter().any(|part| part.trim().is_empty()) {
+                return Err(FeludaError::Config(format!(
+                    "Invalid repository '{repository}' in [tickets], expected owner/repo"
+                )));
+            }
+        }
+        if self.labels.iter().any(|label| label.trim().is_empty()) {
+            return Err(FeludaError::Config(
+                "Empty label in [tickets] section".to_string(),
+            ));
+        }
+        if self.tracker != Some(TrackerKind::Jira) {
+            return Ok(());
+        }
+        match &self.url {
+            None => {
+                return Err(FeludaError::Config(
+                    "Jira [tickets] need the 'url' of the Jira site".to_string(),
+                ))
+            }
+            Some(url) if !url.starts_with("https://") && !url.starts_with("http://") => {
+                return Err(FeludaError::Config(format!(
+                    "Invalid URL '{url}' in [tickets], expected http:// or https://"
+                )));
+            }
+            _ => {}
+        }
+        if self
+            .project
+            .as_deref()
+            .is_none_or(|key| key.trim().is_empty())
+        {
+            return Err(FeludaError::Config(
+                "Jira [tickets] need the key of the Jira 'project'".to_string(),
+            ));
+        }
+        if self.token_env.is_none() {
+            return Err(FeludaError::Config(
+                "Jira [tickets] need the environment variable of the API token in 'token_env'"
+                    .to_string(),
             ));
         }
+        Ok(())
+    }
+}
 
-        if self.max_depth > 100 {
+/// Project discovery for repositories containing several projects
+///
+/// Patterns use `.gitignore` syntax and are matched against project
+/// directories relative to the scanned path, `exclude` also against
+/// manifests and vendored packages. Directories ignored by
+/// `.gitignore`, hidden directories and dependency folders such as
+/// `node_modules` are never searched.
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct WorkspaceConfig {
+    /// Search subdirectories for projects instead of only the scanned directory
+    #[serde(default)]
+    pub recursive: bool,
+    /// Only scan projects in directories matching one of these patterns
+    #[serde(default)]
+    pub include: Vec<String>,
+    /// Skip directories and manifests matching any of these patterns
+    #[serde(default)]
+    pub exclude: Vec<String>,
+}
+
+impl WorkspaceConfig {
+    pub fn validate(&self) -> FeludaResult<()> {
+        if self
+            .include
+            .iter()
+            .chain(&self.exclude)
+            .any(|pattern| pattern.trim().is_empty())
+        {
             return Err(FeludaError::Config(
-                "max_depth must be 100 or less to prevent excessive resource usage".to_string(),
+                "Empty pattern found in [workspace] section".to_string(),
             ));
         }
+        Ok(())
+    }
+}
 
-        if self.max_depth > 50 {
-            log(
-                LogLevel::Warn,
-                &format!(
-                    "max_depth of {} is quite high and may impact performance",
-                    self.max_depth
-                ),
+/// Private registries and the credentials to reach them
+///
+/// Endpoints replace the public registry of an ecosystem, e.g. with an
+/// Artifactory or Nexus repository that proxies it. Credentials are matched by
+/// host and read from environment variables, so no secret has to be written to
+/// `.feluda.toml`. Hosts without credentials here fall back to `~/.netrc` and,
+/// for npm, to `.npmrc`. The network settings apply to every request Feluda
+/// sends, public registries included.
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct RegistriesConfig {
+    /// npm registry used instead of registry.npmjs.org
+    #[serde(default)]
+    pub npm: Option<String>,
+    /// PyPI repository with a JSON API (`<url>/pypi/<name>/<version>/json`)
+    #[serde(default)]
+    pub pypi: Option<String>,
+    /// Maven repositories searched before Maven Central
+    #[serde(default)]
+    pub maven: Vec<String>,
+    /// NuGet flat container (`PackageBaseAddress`) used instead of nuget.org
+    #[serde(default)]
+    pub nuget: Option<String>,
+    /// crates.io mirror serving the web API (`<url>/api/v1/crates/<name>/<version>`)
+    #[serde(default)]
+    pub crates_io: Option<String>,
+    /// RubyGems mirror serving the API (`<url>/api/v2/rubygems/...`)
+    #[serde(default)]
+    pub rubygems: Option<String>,
+    /// Hex API used instead of hex.pm/api
+    #[serde(default)]
+    pub hex: Option<String>,
+    /// Hackage mirror used instead of hackage.haskell.org
+    #[serde(default)]
+    pub hackage: Option<String>,
+    /// PEM file with additional CA certificates to trust
+    #[serde(default)]
+    pub ca_cert: Option<String>,
+    /// Proxy for all requests, in place of `HTTPS_PROXY`/`HTTP_PROXY`
+    #[serde(default)]
+    pub proxy: Option<String>,
+    /// Seconds before a request is abandoned
+    #[serde(default)]
+    pub timeout: Option<u64>,
+    /// Retries of a request after timeouts, connection errors, 429 and 5xx responses
+    #[serde(default)]
+    pub retries: Option<u32>,
+    /// Ordered metadata sources per ecosystem, each tried when the one before fails
+    ///
+    /// Keys are `npm`, `pypi`, `maven`, `nuget`, `crates_io`, `rubygems`,
+    /// `hex`, `hackage` and `go`. A list replaces the single registry of its
+    /// ecosystem, and may end with `"deps.dev"` to ask deps.dev for licenses
+    /// no other source knows.
+    #[serde(default)]
+    pub sources: BTreeMap<String, Vec<RegistrySource>>,
+    /// Enrich every scan from deps.dev, like `--deps-dev`
+    #[serde(default)]
+    pub deps_dev: bool,
+    #[serde(default)]
+    pub credentials: Vec<RegistryCredential>,
+}
+
+/// One metadata source of an ecosystem, a URL with optional network settings
+#[derive(Debug, Deserialize, Serialize, Clone, PartialEq)]
+#[serde(untagged)]
+pub enum RegistrySource {
+    Url(String),
+    Detailed {
+        url: String,
+        /// Seconds before a request to this source is abandoned
+        #[serde(default)]
+        timeout: Option<u64>,
+        /// Retries of a failed request before moving on to the next source
+        #[serde(default)]
+        retries: Option<u32>,
+    },
+}
+
+/// Source name that stands for the deps.dev API rather than a registry URL
+pub const DEPS_DEV_SOURCE: &str = "deps.dev";
+
+/// Ecosystems that accept a list in `[registries.sources]`
+const SOURCE_ECOSYSTEMS: &[&str] = &[
+    "npm",
+    "pypi",
+    "maven",
+    "nuget",
+    "crates_io",
+    "rubygems",
+    "hex",
+    "hackage",
+    "go",
+];
+
+/// Ecosystems deps.dev has license information for
+const DEPS_DEV_ECOSYSTEMS: &[&str] = &[
+    "npm",
+    "pypi",
+    "maven",
+    "nuget",
+    "crates_io",
+    "rubygems",
+    "go",
+];
+
+impl RegistrySource {
+    pub fn url(&self) -> &str {
+        match self {
+            RegistrySource::Url(url) | RegistrySource::Detailed { url, .. } => url,
+        }
+    }
+
+    pub fn timeout(&self) -> Option<u64> {
+        match self {
+            RegistrySource::Url(_) => None,
+            RegistrySource::Detailed { timeout, .. } => *timeout,
+        }
+    }
+
+    pub fn retries(&self) -> Option<u32> {
+        match self {
+            RegistrySource::Url(_) => None,
+            RegistrySource::Detailed { retries, .. } => *retries,
+        }
+    }
+
+    pub fn is_deps_dev(&self) -> bool {
+        self.url() == DEPS_DEV_SOURCE
+    }
+}
+
+/// Credentials sent to one registry host
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct RegistryCredential {
+    /// Host name, optionally with a port (`artifactory.example.com`)
+    pub host: String,
+    /// User for basic authentication, together with `password_env`
+    #[serde(default)]
+    pub username: Option<String>,
+    /// Environment variable holding the password
+    #[serde(default)]
+    pub password_env: Option<String>,
+    /// Environment variable holding a bearer token
+    #[serde(default)]
+    pub token_env: Option<String>,
+}
+
+impl RegistriesConfig {
+    pub fn validate(&self) -> FeludaResult<()> {
+        let urls = self
+            .npm
+            .iter()
+            .chain(&self.pypi)
+            .chain(&self.maven)
+            .chain(&self.nuget)
+            .chain(&self.crates_io)
+            .chain(&self.rubygems)
+            .chain(&self.hex)
+            .chain(&self.hackage)
+            .map(String::as_str)
+            .chain(
+                self.sources
+                    .values()
+                    .flatten()
+                    .filter(|source| !source.is_deps_dev())
+                    .map(|source| source.url()),
             );
+        for url in urls {
+            if !url.starts_with("https://") && !url.starts_with("http://") {
+                return Err(FeludaError::Config(format!(
+                    "Registry URL '{url}' in [registries] must start with https:// or http://"
+                )));
+            }
         }
 
-        // Validate ignore dependencies
-        for dep in self.ignore.iter() {
-            if dep.name.trim().is_empty() {
+        if let Some(proxy) = &self.proxy {
+            if reqwest::Proxy::all(proxy.as_str()).is_err() {
+                return Err(FeludaError::Config(format!(
+                    "Invalid proxy '{proxy}' in [registries]"
+                )));
+            }
+        }
+        if self.timeout == Some(0) {
+            return Err(FeludaError::Config(
+                "timeout in [registries] must be at least 1 second".to_string(),
+            ));
+        }
+
+        for (ecosystem, sources) in &self.sources {
+            if !SOURCE_ECOSYSTEMS.contains(&ecosystem.as_str()) {
+                return Err(FeludaError::Config(format!(
+                    "Unknown ecosystem '{ecosystem}' in [registries.sources], expected one of: {}",
+                    SOURCE_ECOSYSTEMS.join(", ")
+                )));
+            }
+            if let Some(position) = sources.iter().position(RegistrySource::is_deps_dev) {
+                if position + 1 != sources.len() {
+                    return Err(FeludaError::Config(format!(
+                        "\"{DEPS_DEV_SOURCE}\" must be the last source of '{ecosystem}' in [registries.sources]"
+                    )));
+                }
+                if !DEPS_DEV_ECOSYSTEMS.contains(&ecosystem.as_str()) {
+                    return Err(FeludaError::Config(format!(
+                        "deps.dev has no licenses for '{ecosystem}' in [registries.sources]"
+                    )));
+                }
+            }
+            if sources.iter().any(|source| source.timeout() == Some(0)) {
+                return Err(FeludaError::Config(format!(
+                    "timeout of a '{ecosystem}' source in [registries.sources] must be at least 1 second"
+                )));
+            }
+        }
+
+        for credential in &self.credentials {
+            if credential.host.trim().is_empty() {
                 return Err(FeludaError::Config(
-                    "Empty dependency name found in ignore list".to_string(),
+                    "Empty host found in [[registries.credentials]]".to_string(),
                 ));
             }
+            let basic = credential.username.is_some() && credential.password_env.is_some();
+            if basic == credential.token_env.is_some() {
+                return Err(FeludaError::Config(format!(
+                    "Credentials for '{}' need either username and password_env, or token_env",
+                    credential.host
+                )));
+            }
+        }
+        Ok(())
+    }
+}
 
-            // Warn if reason is empty
-            if dep.reason.trim().is_empty() {
-                log(
-                    LogLevel::Warn,
-                    &format!(
-                        "Dependency '{}' in ignore list has no reason specified",
-                        dep.name
-                    ),
-                );
+/// Custom risk tiers replacing the restrictive/permissive split in reports
+///
+/// Tiers are listed from most to least severe. A license belongs to the first
+/// tier with a matching pattern; patterns are SPDX identifiers where `*`
+/// matches any run of characters (`LGPL-*`).
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct RiskConfig {
+    /// Tier for licenses no pattern matches, including dependencies without a license
+    #[serde(default)]
+    pub default: Option<String>,
+    #[serde(default)]
+    pub tiers: Vec<RiskTier>,
+}
+
+/// A named group of licenses
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct RiskTier {
+    pub name: String,
+    /// License patterns belonging to this tier
+    #[serde(default)]
+    pub licenses: Vec<String>,
+    /// Exit status of `feluda` when a dependency falls into this tier
+    #[serde(default)]
+    pub exit_code: Option<i32>,
+}
+
+impl RiskConfig {
+    /// Returns true when no tiers are configured
+    pub fn is_empty(&self) -> bool {
+        self.tiers.is_empty()
+    }
+
+    pub fn validate(&self) -> FeludaResult<()> {
+        let mut seen = std::collections::HashSet::new();
+        for tier in &self.tiers {
+            if tier.name.trim().is_empty() {
+                return Err(FeludaError::Config(
+                    "Empty tier name found in [[risk.tiers]]".to_string(),
+                ));
+            }
+            if !seen.insert(tier.name.as_str()) {
+                return Err(FeludaError::Config(format!(
+                    "Duplicate risk tier: {}",
+                    tier.name
+                )));
+            }
+            if tier
+                .licenses
+                .iter()
+                .any(|license| license.trim().is_empty())
+            {
+                return Err(FeludaError::Config(format!(
+                    "Empty license pattern found in risk tier '{}'",
+                    tier.name
+                )));
+            }
+            if let Some(code) = tier.exit_code {
+                if !(1..=255).contains(&code) {
+                    return Err(FeludaError::Config(format!(
+                        "Exit code of risk tier '{}' must be between 1 and 255, got {code}",
+                        tier.name
+                    )));
+                }
             }
         }
 
-        // Check for duplicate dependencies in ignore list
+        if let Some(default) = &self.default {
+            if !seen.contains(default.as_str()) {
+                return Err(FeludaError::Config(format!(
+                    "Default risk tier '{default}' is not defined in [[risk.tiers]]"
+                )));
+            }
+        }
+        Ok(())
+    }
+}
+
+/// Configuration for license-related settings
+///
+/// By default, the following licenses are considered restrictive:
+/// - GPL-3.0
+/// - AGPL-3.0
+/// - LGPL-3.0
+/// - MPL-2.0
+/// - SEE LICENSE IN LICENSE
+/// - CC-BY-SA-4.0
+/// - EPL-2.0
+///
+/// This can be overridden via `.feluda.toml` or environment variables.
+#[derive(Debug, Deserialize, Serialize, Clone)]
+pub struct LicenseConfig {
+    #[serde(default = "default_restrictive_licenses")]
+    pub restrictive: Vec<String>,
+    #[serde(default)]
+    pub ignore: Vec<String>,
+    /// Licenses that are not on the SPDX list, keyed by identifier
+    #[serde(default)]
+    pub custom: BTreeMap<String, CustomLicense>,
+}
+
+impl Default for LicenseConfig {
+    fn default() -> Self {
+        Self {
+            restrictive: default_restrictive_licenses(),
+            ignore: Vec::new(),
+            custom: BTreeMap::new(),
+        }
+    }
+}
+
+impl LicenseConfig {
+    /// Validates the license configuration
+    pub fn validate(&self) -> FeludaResult<()> {
+        // Check for empty restrictive licenses list
+        if self.restrictive.is_empty() {
+            log(
+                LogLevel::Warn,
+                "No restrictive licenses configured - all licenses will be considered acceptable",
+            );
+        }
+
+        // Check for duplicate licenses in restrictive list
         let mut seen = std::collections::HashSet::new();
         let mut duplicates = Vec::new();
 
-        for dep in &self.ignore {
-            let key = (dep.name.clone(), dep.version.clone());
-            if !seen.insert(key.clone()) {
-                duplicates.push(format!("{}@{}", dep.name, dep.version));
+        for license in &self.restrictive {
+            if license.trim().is_empty() {
+                return Err(FeludaError::Config(
+                    "Empty license string found in restrictive licenses list".to_string(),
+                ));
+            }
+
+            if !seen.insert(license) {
+                duplicates.push(license.clone());
             }
         }
 
         if !duplicates.is_empty() {
             return Err(FeludaError::Config(format!(
-                "Duplicate dependencies found in ignore list: {}",
+                "Duplicate licenses found in restrictive list: {}",
                 duplicates.join(", ")
             )));
         }
 
-        if !self.ignore.is_empty() {
-            log_debug("Dependency ignore list", &self.ignore.len());
+        // Validate license format for restrictive licenses (basic SPDX-like validation)
+        for license in &self.restrictive {
+            if !Self::is_valid_license_identifier(license) {
+                log(
+                    LogLevel::Warn,
+                    &format!("License '{license}' may not be a valid SPDX identifier"),
+                );
+            }
         }
 
-        log_debug(
-            "Dependency configuration validation passed",
-            &self.max_depth,
-        );
-        Ok(())
-    }
+        // Validate ignore licenses list
+        let mut ignore_seen = std::collections::HashSet::new();
+        let mut ignore_duplicates = Vec::new();
 
-    /// Check if a dependency should be ignored based on configuration
-    /// Returns true if the dependency matches an ignore rule (name and optionally version)
-    pub fn should_ignore_dependency(&self, name: &str, version: Option<&str>) -> bool {
-        self.ignore.iter().any(|ignored| {
-            // Match by name (case-sensitive)
-            if ignored.name != name {
-                return false;
+        for license in &self.ignore {
+            if license.trim().is_empty() {
+                return Err(FeludaError::Config(
+                    "Empty license string found in ignore licenses list".to_string(),
+                ));
             }
 
-            // If version is specified in ignore rule, match exactly
-            if !ignored.version.is_empty() {
-                return version.is_some_and(|v| v == ignored.version);
-            }
+            if !ignore_seen.insert(license) {
+                ignore_duplicates.push(license.clone());
+            }
+        }
+
+        if !ignore_duplicates.is_empty() {
+            return Err(FeludaError::Config(format!(
+                "Duplicate licenses found in ignore list: {}",
+                ignore_duplicates.join(", ")
+            )));
+        }
+
+        // Validate license format for ignore licenses
+        for license in &self.ignore {
+            if !Self::is_valid_license_identifier(license) {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "License '{license}' in ignore list may not be a valid SPDX identifier"
+                    ),
+                );
+            }
+        }
+
+        // Check for overlap between restrictive and ignore lists
+        let restrictive_set: std::collections::HashSet<_> = self.restrictive.iter().collect();
+        let ignore_set: std::collections::HashSet<_> = self.ignore.iter().collect();
+        let overlap: Vec<_> = restrictive_set
+            .intersection(&ignore_set)
+            .map(|s| s.to_string())
+            .collect();
+
+        if !overlap.is_empty() {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Licenses found in both restrictive and ignore lists will be ignored: {}",
+                    overlap.join(", ")
+                ),
+            );
+        }
+
+        for (id, license) in &self.custom {
+            license.validate(id)?;
+        }
+
+        log_debug("License configuration validation passed", &self.restrictive);
+        log_debug("Ignore licenses configuration", &self.ignore);
+        Ok(())
+    }
+
+    /// Basic validation for license identifiers
+    fn is_valid_license_identifier(license: &str) -> bool {
+        let license = license.trim();
+
+        // Special cases that are valid but don't follow standard patterns
+        if matches!(
+            license,
+            "SEE LICENSE IN LICENSE" | "UNLICENSED" | "NOASSERTION"
+        ) {
+            return true;
+        }
+
+        // Basic pattern: should contain only alphanumeric, dots, hyphens, plus, parentheses
+        // TODO: Improve with a full SPDX regex
+        license
+            .chars()
+            .all(|c| c.is_alphanumeric() || matches!(c, '.' | '-' | '+' | '(' | ')' | '_'))
+            && !license.is_empty()
+            && license.len() <= 100
+    }
+}
+
+/// An internal or proprietary license, see [`crate::custom_licenses`]
+///
+/// Feluda recognizes it in license files by its reference text or patterns, and
+/// in package metadata by its identifier, its name or a pattern.
+#[derive(Debug, Deserialize, Serialize, Default, Clone, PartialEq)]
+pub struct CustomLicense {
+    /// Human-readable name, e.g. `ACME Internal Use Only`
+    #[serde(default)]
+    pub name: Option<String>,
+    /// Reference text compared with license files like the built-in SPDX texts
+    #[serde(default)]
+    pub text: Option<String>,
+    /// File holding the reference text, relative to the working directory
+    #[serde(default)]
+    pub text_file: Option<String>,
+    /// Regular expressions identifying the license in license files and metadata
+    #[serde(default)]
+    pub patterns: Vec<String>,
+    /// Whether the license is treated as restrictive
+    #[serde(default)]
+    pub restrictive: bool,
+    /// Risk tier the license belongs to, one of `[[risk.tiers]]`
+    #[serde(default)]
+    pub tier: Option<String>,
+}
+
+impl CustomLicense {
+    pub fn validate(&self, id: &str) -> FeludaResult<()> {
+        if id.trim().is_empty() || id.chars().any(char::is_whitespace) {
+            return Err(FeludaError::Config(format!(
+                "Invalid custom license identifier '{id}': identifiers cannot contain spaces"
+            )));
+        }
+        if !id.starts_with("LicenseRef-") {
+            log(
+                LogLevel::Warn,
+                &format!("Custom license '{id}' should use the LicenseRef- prefix for SBOMs"),
+            );
+        }
+        if self.text.is_some() && self.text_file.is_some() {
+            return Err(FeludaError::Config(format!(
+                "[licenses.custom.\"{id}\"] sets both 'text' and 'text_file'"
+            )));
+        }
+        if self.text.is_none() && self.text_file.is_none() && self.patterns.is_empty() {
+            return Err(FeludaError::Config(format!(
+                "[licenses.custom.\"{id}\"] needs 'text', 'text_file' or 'patterns' to be detected"
+            )));
+        }
+        for pattern in &self.patterns {
+            regex::Regex::new(pattern).map_err(|e| {
+                FeludaError::Config(format!(
+                    "Invalid pattern '{pattern}' in [licenses.custom.\"{id}\"]: {e}"
+                ))
+            })?;
+        }
+        Ok(())
+    }
+}
+
+/// Configuration for dependency-related settings
+#[derive(Debug, Deserialize, Serialize, Clone)]
+pub struct DependencyConfig {
+    /// Maximum depth for transitive dependency resolution
+    /// Default is 10 levels deep
+    #[serde(default = "default_max_depth")]
+    pub max_depth: u32,
+    /// Dependencies to exclude from license scanning
+    #[serde(default)]
+    pub ignore: Vec<IgnoreDependency>,
+    /// Leave dependencies that don't ship (dev, test and build scopes) out of the scan
+    #[serde(default)]
+    pub exclude_dev: bool,
+    /// Only scan dependencies in these scopes. Empty means all scopes.
+    #[serde(default)]
+    pub scopes: Vec<DependencyScope>,
+    /// Read licenses from vendored sources (`vendor/`, `node_modules/`,
+    /// `third_party/`) instead of resolving dependencies through package managers
+    #[serde(default)]
+    pub vendored: bool,
+}
+
+/// Configuration for a dependency to ignore
+#[derive(Debug, Deserialize, Serialize, Clone)]
+pub struct IgnoreDependency {
+    /// The name/identifier of the dependency (e.g., "github.com/opcotech/elemo-pre-mailer")
+    pub name: String,
+    /// The version of the dependency. Leave empty to ignore all versions.
+    #[serde(default)]
+    pub version: String,
+    /// Reason for ignoring this dependency
+    #[serde(default)]
+    pub reason: String,
+}
+
+impl Default for DependencyConfig {
+    fn default() -> Self {
+        Self {
+            max_depth: default_max_depth(),
+            ignore: Vec::new(),
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
+        }
+    }
+}
+
+impl DependencyConfig {
+    /// Whether dependencies in `scope` are kept in the scan
+    pub fn includes_scope(&self, scope: DependencyScope) -> bool {
+        if self.exclude_dev && !scope.is_runtime() {
+            return false;
+        }
+        self.scopes.is_empty() || self.scopes.contains(&scope)
+    }
+
+    /// Validates the dependency configuration
+    pub fn validate(&self) -> FeludaResult<()> {
+        // Validate max_depth is within reasonable bounds
+        if self.max_depth == 0 {
+            return Err(FeludaError::Config(
+                "max_depth must be greater than 0".to_string(),
+            ));
+        }
+
+        if self.max_depth > 100 {
+            return Err(FeludaError::Config(
+                "max_depth must be 100 or less to prevent excessive resource usage".to_string(),
+            ));
+        }
+
+        if self.max_depth > 50 {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "max_depth of {} is quite high and may impact performance",
+                    self.max_depth
+                ),
+            );
+        }
+
+        // Validate ignore dependencies
+        for dep in self.ignore.iter() {
+            if dep.name.trim().is_empty() {
+                return Err(FeludaError::Config(
+                    "Empty dependency name found in ignore list".to_string(),
+                ));
+            }
+
+            // Warn if reason is empty
+            if dep.reason.trim().is_empty() {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "Dependency '{}' in ignore list has no reason specified",
+                        dep.name
+                    ),
+                );
+            }
+        }
+
+        // Check for duplicate dependencies in ignore list
+        let mut seen = std::collections::HashSet::new();
+        let mut duplicates = Vec::new();
+
+        for dep in &self.ignore {
+            let key = (dep.name.clone(), dep.version.clone());
+            if !seen.insert(key.clone()) {
+                duplicates.push(format!("{}@{}", dep.name, dep.version));
+            }
+        }
+
+        if !duplicates.is_empty() {
+            return Err(FeludaError::Config(format!(
+                "Duplicate dependencies found in ignore list: {}",
+                duplicates.join(", ")
+            )));
+        }
+
+        if !self.ignore.is_empty() {
+            log_debug("Dependency ignore list", &self.ignore.len());
+        }
+
+        log_debug(
+            "Dependency configuration validation passed",
+            &self.max_depth,
+        );
+        Ok(())
+    }
+
+    /// Check if a dependency should be ignored based on configuration
+    /// Returns true if the dependency matches an ignore rule (name and optionally version)
+    pub fn should_ignore_dependency(&self, name: &str, version: Option<&str>) -> bool {
+        self.ignore.iter().any(|ignored| {
+            // Match by name (case-sensitive)
+            if ignored.name != name {
+                return false;
+            }
+
+            // If version is specified in ignore rule, match exactly
+            if !ignored.version.is_empty() {
+                return version.is_some_and(|v| v == ignored.version);
+            }
 
             // If version is empty in ignore rule, ignore all versions
             true
@@ -357,35 +1353,782 @@ impl DependencyConfig {
     }
 }
 
-/// Returns the default maximum depth for dependency resolution
-fn default_max_depth() -> u32 {
-    10
+/// License policy enforced on every scan
+///
+/// When `allow` is non-empty only the listed licenses are accepted. Licenses in
+/// `deny` are always rejected. Exceptions waive violations for a single
+/// dependency, optionally until an expiry date.
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct PolicyConfig {
+    /// Licenses that are allowed. Empty means every license not denied is allowed.
+    #[serde(default)]
+    pub allow: Vec<String>,
+    /// Licenses that are never allowed
+    #[serde(default)]
+    pub deny: Vec<String>,
+    /// Per-dependency exceptions to the policy
+    #[serde(default)]
+    pub exceptions: Vec<PolicyException>,
+    /// Scopes the policy applies to, e.g. `["runtime"]`. Empty means all scopes.
+    #[serde(default)]
+    pub scopes: Vec<DependencyScope>,
+    /// How a license is chosen for dual- and multi-licensed (`OR`) dependencies
+    #[serde(default)]
+    pub dual_license: Option<DualLicenseStrategy>,
+    /// Per-dependency license choices and strategies, taking precedence over `dual_license`
+    #[serde(default)]
+    pub choices: Vec<LicenseChoice>,
+    /// Rules for statically and dynamically linked dependencies
+    #[serde(default)]
+    pub linking: LinkingPolicy,
+    /// What to do with deprecated, yanked and archived packages found with `--health`
+    #[serde(default)]
+    pub health: HealthPolicy,
+    /// What to do with dependencies whose license is missing or unrecognized
+    #[serde(default)]
+    pub unknown: UnknownLicensePolicy,
+    /// What to do with PATENTS, EULA, commercial license and CLA files found with `--legal-files`
+    #[serde(default)]
+    pub legal_files: LegalFilesPolicy,
+    /// Where the organization's policy is fetched from
+    #[serde(default)]
+    pub remote: RemotePolicyConfig,
+}
+
+/// Policy rules that only apply to dependencies linked in a particular way
+///
+/// The linkage of a dependency comes from `[project] linking`. Licenses in
+/// `allow` are accepted even when the general lists reject them, and licenses
+/// in `deny` are rejected even when they accept them, e.g. to deny LGPL only
+/// when it is linked statically.
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct LinkingPolicy {
+    #[serde(default, rename = "static")]
+    pub static_linking: LinkageRules,
+    #[serde(default, rename = "dynamic")]
+    pub dynamic_linking: LinkageRules,
+}
+
+/// License lists of one linkage in `[policy.linking]`
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct LinkageRules {
+    #[serde(default)]
+    pub allow: Vec<String>,
+    #[serde(default)]
+    pub deny: Vec<String>,
+}
+
+impl LinkageRules {
+    pub fn is_empty(&self) -> bool {
+        self.allow.is_empty() && self.deny.is_empty()
+    }
+}
+
+impl LinkingPolicy {
+    pub fn is_empty(&self) -> bool {
+        self.static_linking.is_empty() && self.dynamic_linking.is_empty()
+    }
+
+    /// The rules for dependencies with the given linkage
+    pub fn rules(&self, linkage: Linkage) -> &LinkageRules {
+        match linkage {
+            Linkage::Static => &self.static_linking,
+            Linkage::Dynamic => &self.dynamic_linking,
+        }
+    }
+
+    pub fn validate(&self) -> FeludaResult<()> {
+        for linkage in [Linkage::Static, Linkage::Dynamic] {
+            let rules = self.rules(linkage);
+            if rules
+                .allow
+                .iter()
+                .chain(&rules.deny)
+                .any(|license| license.trim().is_empty())
+            {
+                return Err(FeludaError::Config(format!(
+                    "Empty license string found in [policy.linking.{linkage}]"
+                )));
+            }
+            let conflicting: Vec<_> = rules
+                .deny
+                .iter()
+                .filter(|license| rules.allow.contains(license))
+                .map(|s| s.to_string())
+                .collect();
+            if !conflicting.is_empty() {
+                return Err(FeludaError::Config(format!(
+                    "Licenses found in both allow and deny lists of [policy.linking.{linkage}]: {}",
+                    conflicting.join(", ")
+                )));
+            }
+        }
+        Ok(())
+    }
+}
+
+/// How a package health signal, an unknown license or a legal file is treated
+#[derive(Debug, Deserialize, Serialize, Clone, Copy, Default, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum HealthAction {
+    /// Leave the signal out of the report
+    Ignore,
+    /// Report the signal without failing the scan
+    #[default]
+    Warn,
+    /// Report the signal as a policy violation
+    Fail,
+}
+
+/// Actions for the package health signals in `[policy.health]`
+///
+/// A `fail` action also looks up package health without `--health`.
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct HealthPolicy {
+    #[serde(default)]
+    pub deprecated: HealthAction,
+    #[serde(default)]
+    pub yanked: HealthAction,
+    #[serde(default)]
+    pub archived: HealthAction,
+}
+
+impl HealthPolicy {
+    /// The action configured for a signal
+    pub fn action(&self, signal: HealthSignal) -> HealthAction {
+        match signal {
+            HealthSignal::Deprecated => self.deprecated,
+            HealthSignal::Yanked => self.yanked,
+            HealthSignal::Archived => self.archived,
+        }
+    }
+
+    /// Whether any signal fails the scan
+    pub fn fails(&self) -> bool {
+        [self.deprecated, self.yanked, self.archived].contains(&HealthAction::Fail)
+    }
+}
+
+/// Actions for the legal files besides the license in `[policy.legal_files]`
+///
+/// A `fail` action also looks for legal files without `--legal-files`.
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct LegalFilesPolicy {
+    #[serde(default)]
+    pub patents: HealthAction,
+    #[serde(default)]
+    pub eula: HealthAction,
+    #[serde(default)]
+    pub commercial: HealthAction,
+    #[serde(default)]
+    pub cla: HealthAction,
+}
+
+impl LegalFilesPolicy {
+    /// The action configured for a kind of legal file
+    pub fn action(&self, kind: LegalFileKind) -> HealthAction {
+        match kind {
+            LegalFileKind::Patents => self.patents,
+            LegalFileKind::Eula => self.eula,
+            LegalFileKind::Commercial => self.commercial,
+            LegalFileKind::Cla => self.cla,
+        }
+    }
+
+    /// Whether any kind fails the scan
+    pub fn fails(&self) -> bool {
+        [self.patents, self.eula, self.commercial, self.cla].contains(&HealthAction::Fail)
+    }
+}
+
+/// Actions for missing and unrecognized licenses in `[policy.unknown]`
+///
+/// A missing license means all rights may be reserved, which is usually a
+/// bigger risk than a license that is declared but not recognized. A kind
+/// without an action is checked against the allow and deny lists like any
+/// other license; with one, the action decides instead.
+#[derive(Debug, Deserialize, Serialize, Default, Clone)]
+pub struct UnknownLicensePolicy {
+    #[serde(default)]
+    pub missing: Option<HealthAction>,
+    #[serde(default)]
+    pub unrecognized: Option<HealthAction>,
+}
+
+impl UnknownLicensePolicy {
+    pub fn is_empty(&self) -> bool {
+        self.missing.is_none() && self.unrecognized.is_none()
+    }
+
+    /// The action configured for a kind of unknown license
+    pub fn action(&self, kind: UnknownLicense) -> Option<HealthAction> {
+        match kind {
+            UnknownLicense::Missing => self.missing,
+            UnknownLicense::Unrecognized => self.unrecognized,
+        }
+    }
+}
+
+/// A centrally managed policy in `[policy.remote]`, fetched on every run
+///
+/// The document at `url` is a Feluda configuration file; its `[policy]` and
+/// `[licenses]` tables take precedence over the configuration files, other
+/// tables are ignored. It must carry a cosign bundle at `<url>.sigstore.json`
+/// signed with `key`, or keylessly by `certificate_identity`, unless `verify`
+/// is turned off. See [`crate::policy_server`] for caching.
+#[derive(Debug, Deserialize, Serialize, Clone, PartialEq)]
+pub struct RemotePolicyConfig {
+    #[serde(default)]
+    pub url: Option<String>,
+    /// Public key the policy is signed with (file, KMS URI or `env://VAR`)
+    #[serde(default)]
+    pub key: Option<String>,
+    /// Regular expression the signing certificate's identity must match
+    #[serde(default)]
+    pub certificate_identity: Option<String>,
+    /// OIDC issuer of the signing certificate
+    #[serde(default)]
+    pub certificate_oidc_issuer: Option<String>,
+    /// Check the signature of the policy, on by default
+    #[serde(default = "default_verify_policy")]
+    pub verify: bool,
+    /// Minutes a fetched policy is used without asking the server for changes
+    #[serde(default)]
+    pub ttl_minutes: u64,
+}
+
+impl Default for RemotePolicyConfig {
+    fn default() -> Self {
+        Self {
+            url: None,
+            key: None,
+            certificate_identity: None,
+            certificate_oidc_issuer: None,
+            verify: default_verify_policy(),
+            ttl_minutes: 0,
+        }
+    }
+}
+
+fn default_verify_policy() -> bool {
+    true
+}
+
+/// Strategy for picking one license of an `OR` expression
+#[derive(Debug, Deserialize, Serialize, Clone, Copy, PartialEq, Eq)]
+#[serde(rename_all = "kebab-case")]
+pub enum DualLicenseStrategy {
+    /// Pick the most permissive alternative the policy accepts
+    PreferPermissive,
+    /// Fail the policy until a license is chosen in `[[policy.choices]]`
+    RequireExplicitChoice,
+}
+
+/// The license chosen for one dual-licensed dependency, or the strategy to choose it with
+#[derive(Debug, Deserialize, Serialize, Clone, Default)]
+pub struct LicenseChoice {
+    /// The name of the dependency
+    pub name: String,
+    /// The version of the dependency. Leave empty to cover all versions.
+    #[serde(default)]
+    pub version: String,
+    /// The alternative of the license expression to use, e.g. `MIT`
+    #[serde(default)]
+    pub license: Option<String>,
+    /// Strategy for this dependency, instead of `[policy] dual_license`
+    #[serde(default)]
+    pub strategy: Option<DualLicenseStrategy>,
+}
+
+impl LicenseChoice {
+    /// Check if the choice covers the given dependency
+    pub fn matches(&self, name: &str, version: &str) -> bool {
+        self.name == name && (self.version.is_empty() || self.version == version)
+    }
+}
+
+/// Configuration for the per-package license cache
+///
+/// Licenses fetched from package registries are cached under the user cache
+/// directory, keyed by ecosystem, name and version.
+#[derive(Debug, Deserialize, Serialize, Clone)]
+pub struct CacheConfig {
+    /// Number of days a cached license is reused before it is fetched again
+    #[serde(default = "default_cache_ttl_days")]
+    pub ttl_days: u64,
+}
+
+impl Default for CacheConfig {
+    fn default() -> Self {
+        Self {
+            ttl_days: default_cache_ttl_days(),
+        }
+    }
+}
+
+fn default_cache_ttl_days() -> u64 {
+    7
+}
+
+/// An explicit exception to the license policy
+#[derive(Debug, Deserialize, Serialize, Clone)]
+pub struct PolicyException {
+    /// The name of the dependency
+    pub name: String,
+    /// The version of the dependency. Leave empty to cover all versions.
+    #[serde(default)]
+    pub version: String,
+    /// Date (YYYY-MM-DD) after which the exception no longer applies
+    #[serde(default)]
+    pub expires: Option<String>,
+    /// Justification for the exception
+    #[serde(default)]
+    pub reason: String,
+}
+
+impl PolicyException {
+    /// Parse the expiry date, if one is set
+    pub fn expiry_date(&self) -> FeludaResult<Option<chrono::NaiveDate>> {
+        match self.expires.as_deref().map(str::trim) {
+            None | Some("") => Ok(None),
+            Some(date) => chrono::NaiveDate::parse_from_str(date, "%Y-%m-%d")
+                .map(Some)
+                .map_err(|e| {
+                    FeludaError::Config(format!(
+                        "Invalid expiry date '{date}' for policy exception '{}': {e}",
+                        self.name
+                    ))
+                }),
+        }
+    }
+
+    /// Check if the exception covers the given dependency
+    pub fn matches(&self, name: &str, version: &str) -> bool {
+        self.name == name && (self.version.is_empty() || self.version == version)
+    }
+}
+
+impl PolicyConfig {
+    /// Returns true when no policy rules are configured
+    pub fn is_empty(&self) -> bool {
+        self.allow.is_empty()
+            && self.deny.is_empty()
+            && self.dual_license.is_none()
+            && self.choices.is_empty()
+            && self.linking.is_empty()
+            && !self.health.fails()
+            && self.unknown.is_empty()
+            && !self.legal_files.fails()
+    }
+
+    /// The policy for dependencies with the given linkage
+    ///
+    /// The rules of `[policy.linking]` take precedence over the general lists.
+    /// An allowed license only extends an allow list that is already in use.
+    pub fn for_linkage(&self, linkage: Linkage) -> PolicyConfig {
+        let rules = self.linking.rules(linkage);
+        let listed = |list: &[String], license: &String| {
+            list.iter().any(|entry| entry.eq_ignore_ascii_case(license))
+        };
+
+        let mut policy = self.clone();
+        policy.deny.retain(|license| !listed(&rules.allow, license));
+        policy.deny.extend(rules.deny.iter().cloned());
+        if !policy.allow.is_empty() {
+            policy.allow.retain(|license| !listed(&rules.deny, license));
+            policy.allow.extend(rules.allow.iter().cloned());
+        }
+        policy
+    }
+
+    /// The license choice configured for a dependency
+    pub fn choice_for(&self, name: &str, version: &str) -> Option<&LicenseChoice> {
+        self.choices
+            .iter()
+            .find(|choice| choice.matches(name, version))
+    }
+
+    /// Whether the policy covers dependencies in `scope`
+    pub fn applies_to(&self, scope: DependencyScope) -> bool {
+        self.scopes.is_empty() || self.scopes.contains(&scope)
+    }
+
+    /// Validates the policy configuration
+    pub fn validate(&self) -> FeludaResult<()> {
+        for license in self.allow.iter().chain(self.deny.iter()) {
+            if license.trim().is_empty() {
+                return Err(FeludaError::Config(
+                    "Empty license string found in policy".to_string(),
+                ));
+            }
+        }
+
+        let allow_set: std::collections::HashSet<_> = self.allow.iter().collect();
+        let conflicting: Vec<_> = self
+            .deny
+            .iter()
+            .filter(|license| allow_set.contains(license))
+            .map(|s| s.to_string())
+            .collect();
+
+        if !conflicting.is_empty() {
+            return Err(FeludaError::Config(format!(
+                "Licenses found in both policy allow and deny lists: {}",
+                conflicting.join(", ")
+            )));
+        }
+
+        for exception in &self.exceptions {
+            if exception.name.trim().is_empty() {
+                return Err(FeludaError::Config(
+                    "Empty dependency name found in policy exceptions".to_string(),
+                ));
+            }
+
+            exception.expiry_date()?;
+
+            if exception.reason.trim().is_empty() {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "Policy exception for '{}' has no reason specified",
+                        exception.name
+                    ),
+                );
+            }
+        }
+
+        for choice in &self.choices {
+            if choice.name.trim().is_empty() {
+                return Err(FeludaError::Config(
+                    "Empty dependency name found in policy choices".to_string(),
+                ));
+            }
+            match (&choice.license, &choice.strategy) {
+                (Some(license), None) if !license.trim().is_empty() => {}
+                (None, Some(_)) => {}
+                _ => {
+                    return Err(FeludaError::Config(format!(
+                        "Policy choice for '{}' needs either a license or a strategy",
+                        choice.name
+                    )));
+                }
+            }
+        }
+
+        self.linking.validate()?;
+
+        if !self.is_empty() {
+            log_debug("Policy allow list", &self.allow);
+            log_debug("Policy deny list", &self.deny);
+        }
+
+        Ok(())
+    }
+}
+
+/// Returns the default maximum depth for dependency resolution
+fn default_max_depth() -> u32 {
+    10
+}
+
+/// Returns the default list of restrictive licenses
+fn default_restrictive_licenses() -> Vec<String> {
+    let licenses = vec![
+        "GPL-3.0",
+        "AGPL-3.0",
+        "LGPL-3.0",
+        "MPL-2.0",
+        "SEE LICENSE IN LICENSE",
+        "CC-BY-SA-4.0",
+        "EPL-2.0",
+    ]
+    .into_iter()
+    .map(String::from)
+    .collect();
+
+    log_debug("Default restrictive licenses", &licenses);
+    licenses
+}
+
+/// Environment variable with the path of the system configuration file
+pub const SYSTEM_CONFIG_ENV: &str = "FELUDA_SYSTEM_CONFIG";
+
+/// Project configuration files, in the order they are looked for
+pub const PROJECT_CONFIG_FILES: [&str; 3] = [".feluda.toml", ".feluda.yml", ".feluda.yaml"];
+
+/// A source of configuration, in increasing order of precedence
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord)]
+pub enum ConfigLayer {
+    Defaults,
+    System(PathBuf),
+    Project(PathBuf),
+    /// The remote policy of `[policy.remote]`, by URL
+    Remote(String),
+    Environment,
+}
+
+impl std::fmt::Display for ConfigLayer {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Defaults => write!(f, "defaults"),
+            Self::System(path) | Self::Project(path) => write!(f, "{}", path.display()),
+            Self::Remote(url) => write!(f, "{url}"),
+            Self::Environment => write!(f, "environment"),
+        }
+    }
+}
+
+/// A setting of the effective configuration and the layer it comes from
+#[derive(Debug, Clone, PartialEq)]
+pub struct Setting {
+    /// Dotted key, e.g. `licenses.restrictive`
+    pub key: String,
+    pub value: toml::Value,
+    pub layer: ConfigLayer,
+}
+
+/// The system configuration file, if there is one
+pub fn system_config_path() -> Option<PathBuf> {
+    let path = match std::env::var_os(SYSTEM_CONFIG_ENV) {
+        Some(path) => PathBuf::from(path),
+        None if cfg!(windows) => PathBuf::from(std::env::var_os("PROGRAMDATA")?)
+            .join("feluda")
+            .join("config.toml"),
+        None => PathBuf::from("/etc/feluda/config.toml"),
+    };
+    path.is_file().then_some(path)
+}
+
+/// The project configuration file in the current directory, if there is one
+pub fn project_config_path() -> Option<PathBuf> {
+    let mut found = PROJECT_CONFIG_FILES
+        .iter()
+        .map(PathBuf::from)
+        .filter(|path| path.is_file());
+    let path = found.next()?;
+    for ignored in found {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Ignoring {} because {} takes precedence",
+                ignored.display(),
+                path.display()
+            ),
+        );
+    }
+    Some(path)
+}
+
+/// Whether a configuration file is YAML rather than TOML
+pub fn is_yaml(path: &Path) -> bool {
+    matches!(
+        path.extension().and_then(|ext| ext.to_str()),
+        Some("yml" | "yaml")
+    )
+}
+
+fn merge_file(figment: Figment, path: &Path) -> Figment {
+    if is_yaml(path) {
+        figment.merge(Yaml::file(path))
+    } else {
+        figment.merge(Toml::file(path))
+    }
+}
+
+/// The configuration files and environment that apply, lowest precedence first
+pub fn config_layers() -> Vec<ConfigLayer> {
+    let mut layers = vec![ConfigLayer::Defaults];
+    layers.extend(system_config_path().map(ConfigLayer::System));
+    layers.extend(project_config_path().map(ConfigLayer::Project));
+    layers.extend(remote_policy(&file_layers()).url.map(ConfigLayer::Remote));
+    if std::env::vars_os().any(|(name, _)| name.to_string_lossy().starts_with("FELUDA_")) {
+        layers.push(ConfigLayer::Environment);
+    }
+    layers
+}
+
+/// Parse a configuration file into a table, for finding the keys it sets
+fn read_layer(path: &Path) -> FeludaResult<toml::Value> {
+    let content = std::fs::read_to_string(path)?;
+    let value = if is_yaml(path) {
+        serde_yaml::from_str::<Option<toml::Value>>(&content)
+            .map(|value| value.unwrap_or_else(|| toml::Value::Table(Default::default())))
+            .map_err(|e| e.to_string())
+    } else {
+        toml::from_str(&content).map_err(|e| e.to_string())
+    };
+    value.map_err(|e| FeludaError::Config(format!("Failed to parse {}: {e}", path.display())))
+}
+
+/// Whether a layer sets the setting at `path`, or a value that contains it
+fn sets_key(layer: &toml::Value, path: &[String]) -> bool {
+    let mut value = layer;
+    for key in path {
+        match value {
+            toml::Value::Table(table) => match table.get(key) {
+                Some(inner) => value = inner,
+                None => return false,
+            },
+            _ => return true,
+        }
+    }
+    true
+}
+
+/// Quote a key of a dotted path unless it is a bare TOML key
+fn quote_key(key: &str) -> String {
+    if !key.is_empty()
+        && key
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || c == '_' || c == '-')
+    {
+        key.to_string()
+    } else {
+        toml::Value::String(key.to_string()).to_string()
+    }
+}
+
+/// Join a path into a dotted key, e.g. `licenses.restrictive`
+fn dotted_key(path: &[String]) -> String {
+    path.iter()
+        .map(|key| quote_key(key))
+        .collect::<Vec<_>>()
+        .join(".")
+}
+
+/// Collect the leaves of a table, arrays and empty tables included as a whole
+fn flatten(path: &mut Vec<String>, value: &toml::Value, out: &mut Vec<(Vec<String>, toml::Value)>) {
+    match value {
+        toml::Value::Table(table) if !table.is_empty() => {
+            for (key, inner) in table {
+                path.push(key.clone());
+                flatten(path, inner, out);
+                path.pop();
+            }
+        }
+        _ => out.push((path.clone(), value.clone())),
+    }
+}
+
+/// Every setting of the effective configuration with the layer it comes from
+///
+/// Command-line flags are not included, they differ between commands.
+pub fn effective_settings() -> FeludaResult<Vec<Setting>> {
+    let config = load_config()?;
+    let effective = toml::Value::try_from(&config).map_err(|e| {
+        FeludaError::Serialization(format!("Failed to serialize the configuration: {e}"))
+    })?;
+
+    let mut files = Vec::new();
+    for layer in config_layers() {
+        match &layer {
+            ConfigLayer::System(path) | ConfigLayer::Project(path) => {
+                files.push((read_layer(path)?, layer.clone()));
+            }
+            ConfigLayer::Remote(_) => {
+                let policy = crate::policy_server::fetch_policy(&config.policy.remote)?;
+                files.push((toml::Value::Table(policy), layer.clone()));
+            }
+            _ => {}
+        }
+    }
+    // FELUDA_LICENSES_RESTRICTIVE sets `licenses.restrictive`
+    let env_keys: Vec<Vec<String>> = std::env::vars_os()
+        .filter_map(|(name, _)| {
+            let name = name.to_str()?.strip_prefix("FELUDA_")?.to_lowercase();
+            Some(name.split('_').map(String::from).collect())
+        })
+        .collect();
+
+    let mut leaves = Vec::new();
+    flatten(&mut Vec::new(), &effective, &mut leaves);
+    Ok(leaves
+        .into_iter()
+        .map(|(path, value)| {
+            let layer = if env_keys.iter().any(|key| path.starts_with(key)) {
+                ConfigLayer::Environment
+            } else {
+                files
+                    .iter()
+                    .rev()
+                    .find(|(file, _)| sets_key(file, &path))
+                    .map(|(_, layer)| layer.clone())
+                    .unwrap_or(ConfigLayer::Defaults)
+            };
+            Setting {
+                key: dotted_key(&path),
+                value,
+                layer,
+            }
+        })
+        .collect())
+}
+
+/// Dotted keys of the local configuration, tables included, for shell completion
+///
+/// The remote policy isn't fetched, completing a key shouldn't wait for the network.
+pub fn setting_keys() -> Vec<String> {
+    let config = load_local_config().unwrap_or_default();
+    let Ok(value) = toml::Value::try_from(&config) else {
+        return Vec::new();
+    };
+    let mut leaves = Vec::new();
+    flatten(&mut Vec::new(), &value, &mut leaves);
+
+    let mut keys = BTreeSet::new();
+    for (path, _) in leaves {
+        for end in 1..=path.len() {
+            keys.insert(dotted_key(&path[..end]));
+        }
+    }
+    keys.into_iter().collect()
+}
+
+/// Defaults, the system configuration file and the project's, in that order
+fn file_layers() -> Figment {
+    let mut figment = Figment::new().merge(Serialized::defaults(FeludaConfig::default()));
+
+    // Organization-wide defaults, then the project's own settings
+    if let Some(system_path) = system_config_path() {
+        log(
+            LogLevel::Info,
+            &format!("Found system configuration file: {}", system_path.display()),
+        );
+        figment = merge_file(figment, &system_path);
+    }
+    if let Some(config_path) = project_config_path() {
+        log(
+            LogLevel::Info,
+            &format!("Found configuration file: {}", config_path.display()),
+        );
+        figment = merge_file(figment, &config_path);
+    } else {
+        log(LogLevel::Info, "No .feluda.toml file found, using defaults");
+    }
+    figment
+}
+
+fn env_layer() -> Env {
+    Env::prefixed("FELUDA_").split("_")
 }
 
-/// Returns the default list of restrictive licenses
-fn default_restrictive_licenses() -> Vec<String> {
-    let licenses = vec![
-        "GPL-3.0",
-        "AGPL-3.0",
-        "LGPL-3.0",
-        "MPL-2.0",
-        "SEE LICENSE IN LICENSE",
-        "CC-BY-SA-4.0",
-        "EPL-2.0",
-    ]
-    .into_iter()
-    .map(String::from)
-    .collect();
-
-    log_debug("Default restrictive licenses", &licenses);
-    licenses
+/// The `[policy.remote]` settings, which the remote policy itself can't change
+fn remote_policy(files: &Figment) -> RemotePolicyConfig {
+    files
+        .clone()
+        .merge(env_layer())
+        .extract_inner("policy.remote")
+        .unwrap_or_default()
 }
 
 /// Loads the configuration using the following providers (in order of precedence):
 ///
 /// 1. Environment variables prefixed with `FELUDA_`
-/// 2. `.feluda.toml` file in the project root
-/// 3. Default values
+/// 2. The remote policy of `[policy.remote]`, see [`crate::policy_server`]
+/// 3. `.feluda.toml` (or `.feluda.yml`) file in the project root
+/// 4. The system configuration file, see [`system_config_path`]
+/// 5. Default values
 ///
 /// # Environment Variables
 ///
@@ -397,25 +2140,31 @@ fn default_restrictive_licenses() -> Vec<String> {
 /// For example:
 /// - `FELUDA_LICENSES_RESTRICTIVE` -> `licenses.restrictive`
 pub fn load_config() -> FeludaResult<FeludaConfig> {
-    log(LogLevel::Info, "Loading Feluda configuration");
+    load(true)
+}
 
-    // Start with default values
-    let mut figment = Figment::new().merge(Serialized::defaults(FeludaConfig::default()));
+/// Loads the configuration without the remote policy
+///
+/// The HTTP client takes `[registries]` from here, which a remote policy
+/// never sets, so that it can reach the policy server in the first place.
+pub fn load_local_config() -> FeludaResult<FeludaConfig> {
+    load(false)
+}
 
-    // Check if .feluda.toml exists and add it if it does
-    let config_path = Path::new(".feluda.toml");
-    if config_path.exists() {
-        log(
-            LogLevel::Info,
-            &format!("Found configuration file: {}", config_path.display()),
-        );
-        figment = figment.merge(Toml::file(config_path));
-    } else {
-        log(LogLevel::Info, "No .feluda.toml file found, using defaults");
+fn load(with_remote_policy: bool) -> FeludaResult<FeludaConfig> {
+    log(LogLevel::Info, "Loading Feluda configuration");
+
+    let mut figment = file_layers();
+    if with_remote_policy {
+        let remote = remote_policy(&figment);
+        if remote.url.is_some() {
+            let policy = crate::policy_server::fetch_policy(&remote)?;
+            figment = figment.merge(Serialized::defaults(policy));
+        }
     }
 
     // Add environment variables
-    figment = figment.merge(Env::prefixed("FELUDA_").split("_"));
+    figment = figment.merge(env_layer());
     log(LogLevel::Info, "Checking for FELUDA_ environment variables");
 
     // Extract the final configuration
@@ -544,6 +2293,79 @@ restrictive = ["TOML-1.0", "TOML-2.0"]"#,
         );
     }
 
+    #[test]
+    fn test_layered_config() {
+        let system_dir = TempDir::new().unwrap();
+        let system_path = system_dir.path().join("config.toml");
+        fs::write(
+            &system_path,
+            r#"[licenses]
+restrictive = ["SYSTEM-1.0"]
+ignore = ["MIT"]
+
+[project]
+license = "Apache-2.0""#,
+        )
+        .unwrap();
+
+        temp_env::with_vars(
+            vec![
+                (SYSTEM_CONFIG_ENV, Some(system_path.to_str().unwrap())),
+                ("FELUDA_WORKSPACE_RECURSIVE", Some("false")),
+                ("FELUDA_LICENSES_RESTRICTIVE", None),
+            ],
+            || {
+                let _dir = setup();
+                fs::write(
+                    ".feluda.yml",
+                    "licenses:\n  restrictive:\n    - YAML-1.0\nworkspace:\n  recursive: true\n",
+                )
+                .unwrap();
+
+                let config = load_config().unwrap();
+                assert_eq!(config.licenses.restrictive, vec!["YAML-1.0".to_string()]);
+                assert_eq!(config.licenses.ignore, vec!["MIT".to_string()]);
+                assert_eq!(config.project.license.as_deref(), Some("Apache-2.0"));
+                assert!(!config.workspace.recursive);
+
+                let project = ConfigLayer::Project(PathBuf::from(".feluda.yml"));
+                assert_eq!(
+                    config_layers(),
+                    vec![
+                        ConfigLayer::Defaults,
+                        ConfigLayer::System(system_path.clone()),
+                        project.clone(),
+                        ConfigLayer::Environment,
+                    ]
+                );
+                let settings = effective_settings().unwrap();
+                let layer = |key: &str| {
+                    settings
+                        .iter()
+                        .find(|setting| setting.key == key)
+                        .map(|setting| setting.layer.clone())
+                };
+                assert_eq!(layer("licenses.restrictive"), Some(project));
+                assert_eq!(
+                    layer("licenses.ignore"),
+                    Some(ConfigLayer::System(system_path.clone()))
+                );
+                assert_eq!(layer("workspace.recursive"), Some(ConfigLayer::Environment));
+                assert_eq!(layer("strict"), Some(ConfigLayer::Defaults));
+
+                let keys = setting_keys();
+                for key in ["licenses", "licenses.restrictive", "workspace.recursive"] {
+                    assert!(keys.contains(&key.to_string()), "{key} is completed");
+                }
+
+                // The TOML file wins over the YAML one
+                fs::write(".feluda.toml", "strict = true").unwrap();
+                assert_eq!(project_config_path(), Some(PathBuf::from(".feluda.toml")));
+                assert!(load_config().unwrap().strict);
+            },
+        );
+    }
+
     #[test]
     fn test_license_config_default() {
         let config = LicenseConfig::default();
@@ -713,14 +2535,30 @@ restrictive = ["TOML-LICENSE-1", "TOML-LICENSE-2"]"#,
     fn test_config_serialization() {
         let config = FeludaConfig {
             strict: false,
+            fail_fast: false,
             licenses: LicenseConfig {
                 restrictive: vec!["TEST-1.0".to_string(), "TEST-2.0".to_string()],
                 ignore: Vec::new(),
+                custom: BTreeMap::new(),
             },
             dependencies: DependencyConfig {
                 max_depth: 5,
                 ignore: Vec::new(),
+                exclude_dev: false,
+                scopes: Vec::new(),
+                vendored: false,
             },
+            policy: PolicyConfig::default(),
+            cache: CacheConfig::default(),
+            project: ProjectConfig::default(),
+            compatibility: BTreeMap::new(),
+            risk: RiskConfig::default(),
+            workspace: WorkspaceConfig::default(),
+            registries: RegistriesConfig::default(),
+            overrides: BTreeMap::new(),
+            plugins: BTreeMap::new(),
+            notifications: Vec::new(),
+            tickets: TicketsConfig::default(),
         };
 
         // Test that config can be serialized and deserialized
@@ -751,6 +2589,7 @@ restrictive = ["TOML-LICENSE-1", "TOML-LICENSE-2"]"#,
         let config = LicenseConfig {
             restrictive: vec!["MIT".to_string(), "Apache-2.0".to_string()],
             ignore: Vec::new(),
+            custom: BTreeMap::new(),
         };
 
         let json = serde_json::to_string(&config).unwrap();
@@ -848,6 +2687,7 @@ restrictive = [
         let config = LicenseConfig {
             restrictive: vec![],
             ignore: Vec::new(),
+            custom: BTreeMap::new(),
         };
         // Empty list should pass validation but generate a warning
         assert!(config.validate().is_ok());
@@ -858,6 +2698,7 @@ restrictive = [
         let config = LicenseConfig {
             restrictive: vec!["MIT".to_string(), "".to_string(), "GPL-3.0".to_string()],
             ignore: Vec::new(),
+            custom: BTreeMap::new(),
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -877,6 +2718,7 @@ restrictive = [
                 "Apache-2.0".to_string(),
             ],
             ignore: Vec::new(),
+            custom: BTreeMap::new(),
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -895,6 +2737,7 @@ restrictive = [
                 "SEE LICENSE IN LICENSE".to_string(),
             ],
             ignore: Vec::new(),
+            custom: BTreeMap::new(),
         };
         assert!(config.validate().is_ok());
     }
@@ -921,6 +2764,9 @@ restrictive = [
         let config = DependencyConfig {
             max_depth: 0,
             ignore: Vec::new(),
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -935,6 +2781,9 @@ restrictive = [
         let config = DependencyConfig {
             max_depth: 150,
             ignore: Vec::new(),
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -949,6 +2798,9 @@ restrictive = [
         let config = DependencyConfig {
             max_depth: 75,
             ignore: Vec::new(),
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         // Should pass validation but generate a warning
         assert!(config.validate().is_ok());
@@ -959,22 +2811,131 @@ restrictive = [
         let config = DependencyConfig {
             max_depth: 10,
             ignore: Vec::new(),
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         assert!(config.validate().is_ok());
     }
 
+    #[test]
+    fn test_registries_config_validation() {
+        let mut registries = RegistriesConfig {
+            npm: Some("https://artifactory.example.com/api/npm/npm/".to_string()),
+            maven: vec!["https://nexus.example.com/repository/maven-public".to_string()],
+            credentials: vec![RegistryCredential {
+                host: "artifactory.example.com".to_string(),
+                token_env: Some("ARTIFACTORY_TOKEN".to_string()),
+                ..RegistryCredential::default()
+            }],
+            ..RegistriesConfig::default()
+        };
+        assert!(registries.validate().is_ok());
+
+        registries.credentials[0].username = Some("ci".to_string());
+        registries.credentials[0].password_env = Some("ARTIFACTORY_PASSWORD".to_string());
+        assert!(registries.validate().is_err());
+
+        registries.credentials[0].token_env = None;
+        assert!(registries.validate().is_ok());
+
+        registries.pypi = Some("nexus.example.com/repository/pypi".to_string());
+        assert!(registries.validate().is_err());
+        registries.pypi = None;
+
+        registries.proxy = Some("http://proxy.example.com:3128".to_string());
+        registries.timeout = Some(60);
+        assert!(registries.validate().is_ok());
+
+        registries.timeout = Some(0);
+        assert!(registries.validate().is_err());
+        registries.timeout = None;
+
+        registries.hex = Some("hex.example.com/api".to_string());
+        assert!(registries.validate().is_err());
+    }
+
+    #[test]
+    fn test_registry_sources_config() {
+        let config: FeludaConfig = toml::from_str(
+            r#"
+[registries.sources]
+go = ["https://artifactory.example.com/api/go/go-remote", "deps.dev"]
+npm = [
+    { url = "https://artifactory.example.com/api/npm/npm-remote", timeout = 5, retries = 0 },
+    "https://registry.npmjs.org",
+]
+"#,
+        )
+        .unwrap();
+        let registries = &config.registries;
+        assert!(registries.validate().is_ok());
+        assert!(registries.sources["go"][1].is_deps_dev());
+        let npm = &registries.sources["npm"];
+        assert_eq!(
+            npm[0].url(),
+            "https://artifactory.example.com/api/npm/npm-remote"
+        );
+        assert_eq!((npm[0].timeout(), npm[0].retries()), (Some(5), Some(0)));
+        assert_eq!((npm[1].timeout(), npm[1].retries()), (None, None));
+
+        let invalid = |ecosystem: &str, sources: Vec<RegistrySource>| RegistriesConfig {
+            sources: BTreeMap::from([(ecosystem.to_string(), sources)]),
+            ..RegistriesConfig::default()
+        };
+        let url = |url: &str| RegistrySource::Url(url.to_string());
+        assert!(invalid("cocoapods", vec![url("https://cdn.cocoapods.org")])
+            .validate()
+            .is_err());
+        assert!(
+            invalid("go", vec![url("deps.dev"), url("https://proxy.golang.org")])
+                .validate()
+                .is_err()
+        );
+        assert!(invalid("hex", vec![url("deps.dev")]).validate().is_err());
+        assert!(invalid("pypi", vec![url("nexus.example.com/pypi")])
+            .validate()
+            .is_err());
+        assert!(invalid(
+            "pypi",
+            vec![RegistrySource::Detailed {
+                url: "https://nexus.example.com/pypi".to_string(),
+                timeout: Some(0),
+                retries: None,
+            }]
+        )
+        .validate()
+        .is_err());
+    }
+
     #[test]
     fn test_feluda_config_validation_success() {
         let config = FeludaConfig {
             strict: false,
+            fail_fast: false,
             licenses: LicenseConfig {
                 restrictive: vec!["MIT".to_string(), "GPL-3.0".to_string()],
                 ignore: Vec::new(),
+                custom: BTreeMap::new(),
             },
             dependencies: DependencyConfig {
                 max_depth: 10,
                 ignore: Vec::new(),
+                exclude_dev: false,
+                scopes: Vec::new(),
+                vendored: false,
             },
+            policy: PolicyConfig::default(),
+            cache: CacheConfig::default(),
+            project: ProjectConfig::default(),
+            compatibility: BTreeMap::new(),
+            risk: RiskConfig::default(),
+            workspace: WorkspaceConfig::default(),
+            registries: RegistriesConfig::default(),
+            overrides: BTreeMap::new(),
+            plugins: BTreeMap::new(),
+            notifications: Vec::new(),
+            tickets: TicketsConfig::default(),
         };
         assert!(config.validate().is_ok());
     }
@@ -983,14 +2944,30 @@ restrictive = [
     fn test_feluda_config_validation_license_failure() {
         let config = FeludaConfig {
             strict: false,
+            fail_fast: false,
             licenses: LicenseConfig {
                 restrictive: vec!["".to_string()], // Invalid empty license
                 ignore: Vec::new(),
+                custom: BTreeMap::new(),
             },
             dependencies: DependencyConfig {
                 max_depth: 10,
                 ignore: Vec::new(),
+                exclude_dev: false,
+                scopes: Vec::new(),
+                vendored: false,
             },
+            policy: PolicyConfig::default(),
+            cache: CacheConfig::default(),
+            project: ProjectConfig::default(),
+            compatibility: BTreeMap::new(),
+            risk: RiskConfig::default(),
+            workspace: WorkspaceConfig::default(),
+            registries: RegistriesConfig::default(),
+            overrides: BTreeMap::new(),
+            plugins: BTreeMap::new(),
+            notifications: Vec::new(),
+            tickets: TicketsConfig::default(),
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -1004,14 +2981,30 @@ restrictive = [
     fn test_feluda_config_validation_dependency_failure() {
         let config = FeludaConfig {
             strict: false,
+            fail_fast: false,
             licenses: LicenseConfig {
                 restrictive: vec!["MIT".to_string()],
                 ignore: Vec::new(),
+                custom: BTreeMap::new(),
             },
             dependencies: DependencyConfig {
                 max_depth: 0,
                 ignore: Vec::new(),
+                exclude_dev: false,
+                scopes: Vec::new(),
+                vendored: false,
             }, // Invalid zero depth
+            policy: PolicyConfig::default(),
+            cache: CacheConfig::default(),
+            project: ProjectConfig::default(),
+            compatibility: BTreeMap::new(),
+            risk: RiskConfig::default(),
+            workspace: WorkspaceConfig::default(),
+            registries: RegistriesConfig::default(),
+            overrides: BTreeMap::new(),
+            plugins: BTreeMap::new(),
+            notifications: Vec::new(),
+            tickets: TicketsConfig::default(),
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -1089,6 +3082,24 @@ max_depth = 5"#,
         );
     }
 
+    #[test]
+    fn test_toml_workspace_exclude() {
+        let dir = setup();
+        std::env::set_current_dir(dir.path()).unwrap();
+
+        fs::write(
+            ".feluda.toml",
+            r#"[workspace]
+exclude = ["examples/"]
+ignore = ["testdata/"]"#,
+        )
+        .unwrap();
+
+        // `exclude` is the only key for these patterns
+        let config = load_config().unwrap();
+        assert_eq!(config.workspace.exclude, vec!["examples/".to_string()]);
+    }
+
     // Tests for ignore licenses functionality
     #[test]
     fn test_toml_config_with_ignore() {
@@ -1170,6 +3181,7 @@ ignore = []"#,
         let config = LicenseConfig {
             restrictive: vec!["GPL-3.0".to_string()],
             ignore: vec!["MIT".to_string(), "".to_string(), "Apache-2.0".to_string()],
+            custom: BTreeMap::new(),
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -1188,6 +3200,7 @@ ignore = []"#,
                 "Apache-2.0".to_string(),
                 "MIT".to_string(),
             ],
+            custom: BTreeMap::new(),
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -1201,6 +3214,7 @@ ignore = []"#,
         let config = LicenseConfig {
             restrictive: vec!["GPL-3.0".to_string(), "MIT".to_string()],
             ignore: vec!["MIT".to_string(), "Apache-2.0".to_string()],
+            custom: BTreeMap::new(),
         };
         // Should pass validation but generate a warning
         assert!(config.validate().is_ok());
@@ -1211,6 +3225,7 @@ ignore = []"#,
         let config = LicenseConfig {
             restrictive: vec!["GPL-3.0".to_string(), "AGPL-3.0".to_string()],
             ignore: vec!["MIT".to_string(), "Apache-2.0".to_string()],
+            custom: BTreeMap::new(),
         };
         assert!(config.validate().is_ok());
         assert_eq!(config.restrictive.len(), 2);
@@ -1256,6 +3271,7 @@ ignore = [
         let config = LicenseConfig {
             restrictive: vec!["GPL-3.0".to_string()],
             ignore: vec!["MIT".to_string(), "Apache-2.0".to_string()],
+            custom: BTreeMap::new(),
         };
 
         let json = serde_json::to_string(&config).unwrap();
@@ -1277,6 +3293,9 @@ ignore = [
                 version: "4.17.21".to_string(),
                 reason: "Test reason".to_string(),
             }],
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         assert!(config.should_ignore_dependency("lodash", Some("4.17.21")));
         assert!(!config.should_ignore_dependency("lodash", Some("4.17.20")));
@@ -1292,6 +3311,9 @@ ignore = [
                 version: "".to_string(),
                 reason: "Ignore all versions".to_string(),
             }],
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         assert!(config.should_ignore_dependency("lodash", Some("4.17.21")));
         assert!(config.should_ignore_dependency("lodash", Some("4.17.20")));
@@ -1315,6 +3337,9 @@ ignore = [
                     reason: "All versions".to_string(),
                 },
             ],
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         assert!(config.should_ignore_dependency("lodash", Some("4.17.21")));
         assert!(!config.should_ignore_dependency("lodash", Some("4.17.20")));
@@ -1327,6 +3352,9 @@ ignore = [
         let config = DependencyConfig {
             max_depth: 10,
             ignore: Vec::new(),
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         assert!(config.validate().is_ok());
     }
@@ -1340,6 +3368,9 @@ ignore = [
                 version: "1.0.0".to_string(),
                 reason: "Test".to_string(),
             }],
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -1365,6 +3396,9 @@ ignore = [
                     reason: "Second".to_string(),
                 },
             ],
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         let result = config.validate();
         assert!(result.is_err());
@@ -1383,6 +3417,9 @@ ignore = [
                 version: "4.17.21".to_string(),
                 reason: "".to_string(),
             }],
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
         // Should pass validation but generate a warning
         assert!(config.validate().is_ok());
@@ -1430,9 +3467,11 @@ reason = "All versions ignored"
     fn test_feluda_config_with_dependency_ignore() {
         let config = FeludaConfig {
             strict: false,
+            fail_fast: false,
             licenses: LicenseConfig {
                 restrictive: vec!["GPL-3.0".to_string()],
                 ignore: Vec::new(),
+                custom: BTreeMap::new(),
             },
             dependencies: DependencyConfig {
                 max_depth: 10,
@@ -1441,7 +3480,21 @@ reason = "All versions ignored"
                     version: "4.17.21".to_string(),
                     reason: "Test".to_string(),
                 }],
+                exclude_dev: false,
+                scopes: Vec::new(),
+                vendored: false,
             },
+            policy: PolicyConfig::default(),
+            cache: CacheConfig::default(),
+            project: ProjectConfig::default(),
+            compatibility: BTreeMap::new(),
+            risk: RiskConfig::default(),
+            workspace: WorkspaceConfig::default(),
+            registries: RegistriesConfig::default(),
+            overrides: BTreeMap::new(),
+            plugins: BTreeMap::new(),
+            notifications: Vec::new(),
+            tickets: TicketsConfig::default(),
         };
         assert!(config.validate().is_ok());
         assert!(config
@@ -1491,6 +3544,9 @@ reason = "All versions ignored"
                     reason: "Ignore specific version".to_string(),
                 },
             ],
+            exclude_dev: false,
+            scopes: Vec::new(),
+            vendored: false,
         };
 
         assert!(config.should_ignore_dependency("package1", Some("any-version")));
@@ -1498,4 +3554,499 @@ reason = "All versions ignored"
         assert!(config.should_ignore_dependency("package2", Some("1.0.0")));
         assert!(!config.should_ignore_dependency("package2", Some("2.0.0")));
     }
+
+    #[test]
+    fn test_toml_config_with_policy() {
+        temp_env::with_var("FELUDA_LICENSES_RESTRICTIVE", None::<&str>, || {
+            let dir = tempfile::tempdir().unwrap();
+            std::env::set_current_dir(dir.path()).unwrap();
+
+            fs::write(
+                ".feluda.toml",
+                r#"[policy]
+allow = ["MIT", "Apache-2.0"]
+deny = ["AGPL-3.0"]
+
+[[policy.exceptions]]
+name = "legacy-lib"
+version = "0.9.0"
+expires = "2030-01-31"
+reason = "Scheduled for removal"
+"#,
+            )
+            .unwrap();
+
+            let config = load_config().unwrap();
+            assert_eq!(config.policy.allow, vec!["MIT", "Apache-2.0"]);
+            assert_eq!(config.policy.deny, vec!["AGPL-3.0"]);
+            assert_eq!(config.policy.exceptions.len(), 1);
+            let exception = &config.policy.exceptions[0];
+            assert!(exception.matches("legacy-lib", "0.9.0"));
+            assert!(!exception.matches("legacy-lib", "1.0.0"));
+            assert_eq!(
+                exception.expiry_date().unwrap(),
+                chrono::NaiveDate::from_ymd_opt(2030, 1, 31)
+            );
+        });
+    }
+
+    #[test]
+    fn test_yaml_config_with_policy() {
+        temp_env::with_var("FELUDA_LICENSES_RESTRICTIVE", None::<&str>, || {
+            let dir = tempfile::tempdir().unwrap();
+            std::env::set_current_dir(dir.path()).unwrap();
+
+            fs::write(
+                ".feluda.yml",
+                r#"policy:
+  allow:
+    - MIT
+    - Apache-2.0
+  deny:
+    - AGPL-3.0
+  exceptions:
+    - name: legacy-lib
+      version: 0.9.0
+      expires: "2030-01-31"
+      reason: Scheduled for removal
+"#,
+            )
+            .unwrap();
+
+            let config = load_config().unwrap();
+            assert_eq!(config.policy.allow, vec!["MIT", "Apache-2.0"]);
+            assert_eq!(config.policy.deny, vec!["AGPL-3.0"]);
+            assert_eq!(config.policy.exceptions.len(), 1);
+            assert!(config.policy.exceptions[0].matches("legacy-lib", "0.9.0"));
+            assert_eq!(
+                config.policy.exceptions[0].expiry_date().unwrap(),
+                chrono::NaiveDate::from_ymd_opt(2030, 1, 31)
+            );
+        });
+    }
+
+    #[test]
+    fn test_toml_config_with_project_license_and_compatibility() {
+        temp_env::with_var("FELUDA_PROJECT_LICENSE", None::<&str>, || {
+            let dir = tempfile::tempdir().unwrap();
+            std::env::set_current_dir(dir.path()).unwrap();
+
+            fs::write(
+                ".feluda.toml",
+                r#"[project]
+license = "Apache-2.0"
+
+[compatibility."Apache-2.0"]
+compatible_with = ["MPL-2.0"]
+incompatible_with = ["WTFPL"]
+"#,
+            )
+            .unwrap();
+
+            let config = load_config().unwrap();
+            assert_eq!(config.project.license.as_deref(), Some("Apache-2.0"));
+            let entry = &config.compatibility["Apache-2.0"];
+            assert_eq!(entry.compatible_with, vec!["MPL-2.0"]);
+            assert_eq!(entry.incompatible_with, vec!["WTFPL"]);
+        });
+    }
+
+    #[test]
+    fn test_project_license_from_env() {
+        temp_env::with_var("FELUDA_PROJECT_LICENSE", Some("MIT"), || {
+            let _dir = setup();
+            let config = load_config().unwrap();
+            assert_eq!(config.project.license.as_deref(), Some("MIT"));
+        });
+    }
+
+    #[test]
+    fn test_compatibility_override_validation() {
+        let entry = CompatibilityOverride {
+            compatible_with: vec!["MPL-2.0".to_string()],
+            incompatible_with: vec!["MPL-2.0".to_string()],
+        };
+        let result = entry.validate("Apache-2.0");
+        assert!(result
+            .unwrap_err()
+            .to_string()
+            .contains("both compatible and incompatible"));
+
+        let entry = CompatibilityOverride {
+            compatible_with: vec![" ".to_string()],
+            incompatible_with: Vec::new(),
+        };
+        assert!(entry.validate("Apache-2.0").is_err());
+        assert!(CompatibilityOverride::default().validate("").is_err());
+
+        let project = ProjectConfig {
+            license: Some(String::new()),
+            ..ProjectConfig::default()
+        };
+        assert!(project.validate().is_err());
+
+        let project = ProjectConfig {
+            ecosystem_linking: BTreeMap::from([(" ".to_string(), Linkage::Static)]),
+            ..ProjectConfig::default()
+        };
+        assert!(project.validate().is_err());
+    }
+
+    #[test]
+    fn test_toml_config_with_risk_tiers() {
+        temp_env::with_var("FELUDA_RISK_DEFAULT", None::<&str>, || {
+            let dir = tempfile::tempdir().unwrap();
+            std::env::set_current_dir(dir.path()).unwrap();
+
+            fs::write(
+                ".feluda.toml",
+                r#"[risk]
+default = "needs-review"
+
+[[risk.tiers]]
+name = "forbidden"
+licenses = ["AGPL-*"]
+exit_code = 3
+
+[[risk.tiers]]
+name = "needs-review"
+licenses = ["LGPL-*"]
+"#,
+            )
+            .unwrap();
+
+            let config = load_config().unwrap();
+            assert_eq!(config.risk.default.as_deref(), Some("needs-review"));
+            assert_eq!(config.risk.tiers.len(), 2);
+            assert_eq!(config.risk.tiers[0].name, "forbidden");
+            assert_eq!(config.risk.tiers[0].exit_code, Some(3));
+            assert_eq!(config.risk.tiers[1].exit_code, None);
+        });
+    }
+
+    #[test]
+    fn test_risk_config_validation() {
+        let tier = |name: &str, exit_code: Option<i32>| RiskTier {
+            name: name.to_string(),
+            licenses: vec!["GPL-*".to_string()],
+            exit_code,
+        };
+
+        let risk = RiskConfig {
+            default: None,
+            tiers: vec![tier("forbidden", Some(2)), tier("allowed", None)],
+        };
+        assert!(risk.validate().is_ok());
+
+        let risk = RiskConfig {
+            default: None,
+            tiers: vec![tier("forbidden", None), tier("forbidden", None)],
+        };
+        assert!(risk
+            .validate()
+            .unwrap_err()
+            .to_string()
+            .contains("Duplicate"));
+
+        let risk = RiskConfig {
+            default: None,
+            tiers: vec![tier("forbidden", Some(0))],
+        };
+        assert!(risk.validate().is_err());
+
+        let risk = RiskConfig {
+            default: Some("unknown".to_string()),
+            tiers: vec![tier("forbidden", None)],
+        };
+        assert!(risk
+            .validate()
+            .unwrap_err()
+            .to_string()
+            .contains("not defined"));
+    }
+
+    #[test]
+    fn test_default_policy_is_empty() {
+        let config = FeludaConfig::default();
+        assert!(config.policy.is_empty());
+        assert!(config.policy.exceptions.is_empty());
+    }
+
+    #[test]
+    fn test_policy_validation_conflicting_lists() {
+        let policy = PolicyConfig {
+            allow: vec!["MIT".to_string(), "GPL-3.0".to_string()],
+            deny: vec!["GPL-3.0".to_string()],
+            exceptions: Vec::new(),
+            scopes: Vec::new(),
+            dual_license: None,
+            choices: Vec::new(),
+            linking: LinkingPolicy::default(),
+            health: HealthPolicy::default(),
+            unknown: UnknownLicensePolicy::default(),
+            legal_files: LegalFilesPolicy::default(),
+            remote: RemotePolicyConfig::default(),
+        };
+        let result = policy.validate();
+        assert!(result.is_err());
+        assert!(result
+            .unwrap_err()
+            .to_string()
+            .contains("both policy allow and deny"));
+    }
+
+    #[test]
+    fn test_policy_choices() {
+        let toml_content = r#"
+[policy]
+dual_license = "require-explicit-choice"
+
+[[policy.choices]]
+name = "jszip"
+license = "MIT"
+
+[[policy.choices]]
+name = "ace-builds"
+version = "1.4.0"
+strategy = "prefer-permissive"
+"#;
+        let policy: PolicyConfig = toml::from_str::<FeludaConfig>(toml_content).unwrap().policy;
+        assert!(policy.validate().is_ok());
+        assert!(!policy.is_empty());
+        assert_eq!(
+            policy.dual_license,
+            Some(DualLicenseStrategy::RequireExplicitChoice)
+        );
+        assert_eq!(
+            policy
+                .choice_for("jszip", "3.10.1")
+                .unwrap()
+                .license
+                .as_deref(),
+            Some("MIT")
+        );
+        assert!(policy.choice_for("ace-builds", "1.5.0").is_none());
+
+        let invalid = PolicyConfig {
+            choices: vec![LicenseChoice {
+                name: "jszip".to_string(),
+                license: Some("MIT".to_string()),
+                strategy: Some(DualLicenseStrategy::PreferPermissive),
+                ..LicenseChoice::default()
+            }],
+            ..PolicyConfig::default()
+        };
+        assert!(invalid
+            .validate()
+            .unwrap_err()
+            .to_string()
+            .contains("either a license or a strategy"));
+    }
+
+    #[test]
+    fn test_linking_config() {
+        let toml_content = r#"
+[project]
+linking = "dynamic"
+
+[project.ecosystem_linking]
+go = "static"
+
+[policy.linking.static]
+deny = ["LGPL-2.1-only"]
+
+[policy.linking.dynamic]
+allow = ["LGPL-2.1-only"]
+"#;
+        let config: FeludaConfig = toml::from_str(toml_content).unwrap();
+        assert!(config.validate().is_ok());
+        assert_eq!(config.project.linking, Some(Linkage::Dynamic));
+        assert_eq!(config.project.ecosystem_linking["go"], Linkage::Static);
+        assert!(!config.policy.is_empty());
+
+        let policy = PolicyConfig {
+            allow: vec!["MIT".to_string()],
+            deny: vec!["LGPL-2.1-only".to_string(), "GPL-3.0".to_string()],
+            ..config.policy
+        };
+        let dynamic = policy.for_linkage(Linkage::Dynamic);
+        assert_eq!(dynamic.allow, vec!["MIT", "LGPL-2.1-only"]);
+        assert_eq!(dynamic.deny, vec!["GPL-3.0"]);
+        let linked_statically = policy.for_linkage(Linkage::Static);
+        assert_eq!(linked_statically.allow, vec!["MIT"]);
+        assert_eq!(
+            linked_statically.deny,
+            vec!["LGPL-2.1-only", "GPL-3.0", "LGPL-2.1-only"]
+        );
+
+        let invalid = LinkingPolicy {
+            static_linking: LinkageRules {
+                allow: vec!["MPL-2.0".to_string()],
+                deny: vec!["MPL-2.0".to_string()],
+            },
+            ..LinkingPolicy::default()
+        };
+        assert!(invalid
+            .validate()
+            .unwrap_err()
+            .to_string()
+            .contains("[policy.linking.static]"));
+    }
+
+    #[test]
+    fn test_license_overrides() {
+        let toml_content = r#"
+[overrides."left-pad@1.3.0"]
+license = "WTFPL"
+reviewed_by = "jane.doe@example.com"
+date = "2025-03-14"
+
+[overrides."@acme/widgets"]
+license = "MIT"
+"#;
+        let config: FeludaConfig = toml::from_str(toml_content).unwrap();
+        assert!(config.validate().is_ok());
+        let entry = config.license_override_for("left-pad", "1.3.0").unwrap();
+        assert_eq!(entry.license, "WTFPL");
+        assert_eq!(entry.reviewed_by.as_deref(), Some("jane.doe@example.com"));
+        assert!(config.license_override_for("left-pad", "1.3.1").is_none());
+        assert_eq!(
+            config
+                .license_override_for("@acme/widgets", "2.0.0")
+                .unwrap()
+                .license,
+            "MIT"
+        );
+
+        let invalid: FeludaConfig = toml::from_str(
+            r#"
+[overrides."left-pad@1.3.0"]
+license = "WTFPL"
+date = "14.03.2025"
+"#,
+        )
+        .unwrap();
+        assert!(invalid
+            .validate()
+            .unwrap_err()
+            .to_string()
+            .contains("Invalid review date"));
+    }
+
+    #[test]
+    fn test_plugins() {
+        let config: FeludaConfig = toml::from_str(
+            r#"
+[plugins.acme]
+command = ["feluda-acme", "--offline"]
+files = ["acme.lock", "*.acmepkg"]
+"#,
+        )
+        .unwrap();
+        assert!(config.validate().is_ok());
+        let plugin = &config.plugins["acme"];
+        assert_eq!(plugin.command, vec!["feluda-acme", "--offline"]);
+        assert_eq!(plugin.timeout, 300);
+
+        for invalid in [
+            "[plugins.acme]\ncommand = []\nfiles = [\"acme.lock\"]",
+            "[plugins.acme]\ncommand = [\"feluda-acme\"]\nfiles = []",
+            "[plugins.acme]\ncommand = [\"feluda-acme\"]\nfiles = [\"acme.lock\"]\ntimeout = 0",
+        ] {
+            let config: FeludaConfig = toml::from_str(invalid).unwrap();
+            assert!(config.validate().is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn test_tickets() {
+        let config: FeludaConfig = toml::from_str(
+            r#"
+[tickets]
+tracker = "jira"
+url = "https://acme.atlassian.net"
+project = "LEGAL"
+token_env = "JIRA_API_TOKEN"
+"#,
+        )
+        .unwrap();
+        assert!(config.validate().is_ok());
+        assert_eq!(config.tickets.tracker, Some(TrackerKind::Jira));
+        assert_eq!(config.tickets.issue_type, "Task");
+        assert_eq!(FeludaConfig::default().tickets.tracker, None);
+
+        for invalid in [
+            "[tickets]\ntracker = \"github\"\nrepository = \"acme\"",
+            "[tickets]\ntracker = \"jira\"\nproject = \"LEGAL\"\ntoken_env = \"T\"",
+            "[tickets]\ntracker = \"jira\"\nurl = \"acme.atlassian.net\"\nproject = \"LEGAL\"\ntoken_env = \"T\"",
+            "[tickets]\ntracker = \"jira\"\nurl = \"https://jira.acme.com\"\nproject = \"LEGAL\"",
+        ] {
+            let config: FeludaConfig = toml::from_str(invalid).unwrap();
+            assert!(config.validate().is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn test_custom_licenses() {
+        let config: FeludaConfig = toml::from_str(
+            r#"
+[licenses.custom."LicenseRef-ACME-Internal"]
+name = "ACME Internal Use Only"
+patterns = ["(?i)acme internal use only"]
+restrictive = true
+tier = "forbidden"
+
+[[risk.tiers]]
+name = "forbidden"
+licenses = ["AGPL-*"]
+"#,
+        )
+        .unwrap();
+        assert!(config.validate().is_ok());
+        let license = &config.licenses.custom["LicenseRef-ACME-Internal"];
+        assert!(license.restrictive);
+        assert_eq!(
+            config.risk_with_custom_licenses().tiers[0].licenses,
+            vec!["AGPL-*", "LicenseRef-ACME-Internal"]
+        );
+
+        for invalid in [
+            "[licenses.custom.\"LicenseRef-ACME\"]\nname = \"ACME\"",
+            "[licenses.custom.\"LicenseRef-ACME\"]\npatterns = [\"(unclosed\"]",
+            "[licenses.custom.\"LicenseRef-ACME\"]\ntext = \"a\"\ntext_file = \"b\"",
+            "[licenses.custom.\"ACME Internal\"]\npatterns = [\"acme\"]",
+            "[licenses.custom.\"LicenseRef-ACME\"]\npatterns = [\"acme\"]\ntier = \"missing\"",
+        ] {
+            let config: FeludaConfig = toml::from_str(invalid).unwrap();
+            assert!(config.validate().is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn test_policy_validation_invalid_expiry() {
+        let policy = PolicyConfig {
+            allow: Vec::new(),
+            deny: vec!["GPL-3.0".to_string()],
+            exceptions: vec![PolicyException {
+                name: "pkg".to_string(),
+                version: String::new(),
+                expires: Some("31/12/2025".to_string()),
+                reason: "Test".to_string(),
+            }],
+            scopes: Vec::new(),
+            dual_license: None,
+            choices: Vec::new(),
+            linking: LinkingPolicy::default(),
+            health: HealthPolicy::default(),
+            unknown: UnknownLicensePolicy::default(),
+            legal_files: LegalFilesPolicy::default(),
+            remote: RemotePolicyConfig::default(),
+        };
+        let result = policy.validate();
+        assert!(result.is_err());
+        assert!(result
+            .unwrap_err()
+            .to_string()
+            .contains("Invalid expiry date"));
+    }
 }
@@ -0,0 +1,224 @@
+//! Copyright statements of dependencies
+//!
+//! Lines such as `Copyright (c) 2018 Jane Doe` are collected from the license
+//! and NOTICE files of installed packages and from the header comments of
+//! their source files. Only the first lines of a limited number of source
+//! files are read, since that is where header notices live and packages can
+//! be large.
+
+use ignore::WalkBuilder;
+use rayon::prelude::*;
+use regex::Regex;
+use std::collections::HashSet;
+use std::fs::{self, File};
+use std::io::{BufRead, BufReader};
+use std::path::Path;
+use std::sync::OnceLock;
+
+use crate::attributions::local_package_dir;
+use crate::debug::{log, LogLevel};
+use crate::license_detector::find_license_files;
+use crate::licenses::LicenseInfo;
+use crate::parser::SKIPPED_DIRS;
+
+/// Extensions of source files whose headers are searched
+const SOURCE_EXTENSIONS: [&str; 22] = [
+    "rs", "go", "js", "mjs", "cjs", "ts", "jsx", "tsx", "py", "rb", "java", "kt", "scala", "c",
+    "h", "cc", "cpp", "hpp", "cs", "php", "swift", "r",
+];
+
+/// Source files read per package
+const MAX_SOURCE_FILES: usize = 50;
+
+/// Lines read from the top of each source file
+const HEADER_LINES: usize = 30;
+
+fn copyright_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| {
+        Regex::new(r"(?i)^(copyright\s*(\(c\)|©|\d{4})|\(c\)\s*\d{4}|©\s*\d{4})")
+            .expect("valid copyright pattern")
+    })
+}
+
+/// Copyright lines in a license, NOTICE or source text, without duplicates
+///
+/// Comment markers are stripped. Template placeholders such as
+/// `Copyright [yyyy] [name of copyright owner]` in the Apache-2.0 appendix
+/// are skipped.
+pub fn extract_copyright_lines(text: &str) -> Vec<String> {
+    let mut seen = HashSet::new();
+    text.lines()
+        .map(|line| {
+            line.trim()
+                .trim_start_matches(['#', '*', '/', '-', ';', '!', '<'])
+                .trim()
+        })
+        .filter(|line| copyright_pattern().is_match(line))
+        .filter(|line| !line.contains("[yyyy]") && !line.contains("<year>"))
+        .filter(|line| seen.insert(line.to_string()))
+        .map(str::to_string)
+        .collect()
+}
+
+/// Append the lines of `new` that are not in `lines` yet
+pub fn merge_copyright_lines(lines: &mut Vec<String>, new: Vec<String>) {
+    for line in new {
+        if !lines.contains(&line) {
+            lines.push(line);
+        }
+    }
+}
+
+pub(crate) fn is_source_file(path: &Path) -> bool {
+    path.extension()
+        .and_then(|ext| ext.to_str())
+        .is_some_and(|ext| SOURCE_EXTENSIONS.contains(&ext.to_ascii_lowercase().as_str()))
+}
+
+/// The first lines of a file, where header comments live
+pub(crate) fn read_header(path: &Path) -> Option<String> {
+    let reader = BufReader::new(File::open(path).ok()?);
+    let lines: Vec<String> = reader
+        .lines()
+        .take(HEADER_LINES)
+        .map_while(Result::ok)
+        .collect();
+    Some(lines.join("\n"))
+}
+
+/// Copyright lines in the header comments of the source files in `dir`
+pub fn source_header_copyrights(dir: &Path) -> Vec<String> {
+    let walker = WalkBuilder::new(dir)
+        .max_depth(Some(4))
+        .filter_entry(|entry| {
+            let name = entry.file_name().to_str().unwrap_or_default();
+            let is_dir = entry
+                .file_type()
+                .is_some_and(|file_type| file_type.is_dir());
+            !(is_dir && SKIPPED_DIRS.contains(&name))
+        })
+        .build();
+
+    let mut lines = Vec::new();
+    for entry in walker
+        .flatten()
+        .filter(|entry| entry.file_type().is_some_and(|t| t.is_file()))
+        .filter(|entry| is_source_file(entry.path()))
+        .take(MAX_SOURCE_FILES)
+    {
+        if let Some(header) = read_header(entry.path()) {
+            merge_copyright_lines(&mut lines, extract_copyright_lines(&header));
+        }
+    }
+    lines
+}
+
+/// Copyright lines of the package installed in `dir`
+///
+/// License and NOTICE files come first, followed by source file headers.
+pub fn package_copyrights(dir: &Path) -> Vec<String> {
+    let (license_files, notice_files) = find_license_files(dir);
+    let mut lines = Vec::new();
+    for file in license_files.iter().chain(&notice_files) {
+        if let Ok(text) = fs::read_to_string(file) {
+            merge_copyright_lines(&mut lines, extract_copyright_lines(&text));
+        }
+    }
+    merge_copyright_lines(&mut lines, source_header_copyrights(dir));
+    lines
+}
+
+/// Set [`LicenseInfo::copyright`] for every dependency installed locally
+///
+/// Dependencies that are not installed below `project_root`, in the cargo
+/// registry or in the Go module cache are left without copyright information.
+pub fn attach_copyrights(project_root: &Path, dependencies: &mut [LicenseInfo]) {
+    log(
+        LogLevel::Info,
+        &format!(
+            "Collecting copyright statements for {} dependencies",
+            dependencies.len()
+        ),
+    );
+
+    dependencies.par_iter_mut().for_each(|info| {
+        let Some(dir) = local_package_dir(project_root, &info.name, &info.version) else {
+            return;
+        };
+        let lines = package_copyrights(&dir);
+        if lines.is_empty() {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "No copyright statement found for {}@{}",
+                    info.name, info.version
+                ),
+            );
+        }
+        info.copyright = Some(lines);
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_extract_copyright_lines() {
+        let text = "MIT License\n\nCopyright (c) 2018 Jane Doe\n  Copyright 2019-2020 Contributors\n\
+            The above copyright notice and this permission notice shall be included\n\
+            Copyright [yyyy] [name of copyright owner]\n# © 2021 Example Corp\nCopyright (c) 2018 Jane Doe\n";
+
+        assert_eq!(
+            extract_copyright_lines(text),
+            vec![
+                "Copyright (c) 2018 Jane Doe",
+                "Copyright 2019-2020 Contributors",
+                "© 2021 Example Corp",
+            ]
+        );
+    }
+
+    #[test]
+    fn test_package_copyrights_reads_source_headers() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path();
+        fs::write(
+            dir.join("LICENSE"),
+            "MIT License\n\nCopyright (c) 2019 Jane Doe\n",
+        )
+        .unwrap();
+        fs::create_dir_all(dir.join("src/util")).unwrap();
+        fs::write(
+            dir.join("src/lib.rs"),
+            "// Copyright 2020 The Example Authors. All rights reserved.\n\npub fn f() {}\n",
+        )
+        .unwrap();
+        fs::write(
+            dir.join("src/util/parse.js"),
+            "/*\n * Copyright (c) 2019 Jane Doe\n */\nmodule.exports = {}\n",
+        )
+        .unwrap();
+        fs::write(
+            dir.join("README.md"),
+            "Copyright (c) 2001 Not A Source File\n",
+        )
+        .unwrap();
+        let body = "fn x() {}\n".repeat(HEADER_LINES);
+        fs::write(
+            dir.join("src/late.rs"),
+            format!("{body}// Copyright 2022 Below The Header\n"),
+        )
+        .unwrap();
+
+        assert_eq!(
+            package_copyrights(dir),
+            vec![
+                "Copyright (c) 2019 Jane Doe",
+                "Copyright 2020 The Example Authors. All rights reserved."
+            ]
+        );
+    }
+}
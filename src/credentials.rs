@@ -0,0 +1,454 @@
+//! Credentials for private registries
+//!
+//! Requests to package registries are authenticated from, in this order:
+//!
+//! 1. `.npmrc` auth entries (`//host/path/:_authToken=...`, `_auth`,
+//!    `username` and `_password`), matched by the longest URL prefix
+//! 2. `[[registries.credentials]]` in `.feluda.toml`, matched by host
+//! 3. `machine` entries of `~/.netrc` (or `$NETRC`), matched by host
+//!
+//! `.npmrc` files are read from the user's home directory (or
+//! `$NPM_CONFIG_USERCONFIG`) and from every scanned Node.js project, and may
+//! reference environment variables as `${NAME}`, as npm allows.
+
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::{OnceLock, RwLock};
+
+use crate::config::RegistryCredential;
+use crate::debug::{log, LogLevel};
+
+static NPMRC: OnceLock<RwLock<NpmRc>> = OnceLock::new();
+static HOST_CREDENTIALS: OnceLock<HashMap<String, Auth>> = OnceLock::new();
+
+/// How a request is authenticated
+#[derive(Debug, Clone, PartialEq)]
+pub enum Auth {
+    Basic {
+        username: String,
+        password: Option<String>,
+    },
+    Bearer(String),
+    /// A pre-encoded `user:password` pair, as in npm's `_auth`
+    EncodedBasic(String),
+}
+
+/// Registries and auth entries from `.npmrc` files
+#[derive(Debug, Default, Clone)]
+pub struct NpmRc {
+    /// `registry=`, used for unscoped packages
+    pub registry: Option<String>,
+    /// `@scope:registry=`, keyed by scope including the `@`
+    pub scopes: HashMap<String, String>,
+    /// Auth entries keyed by `//host[:port]/path/`
+    pub auth: HashMap<String, Auth>,
+}
+
+impl NpmRc {
+    /// Add entries from `other`, which take precedence
+    fn merge(&mut self, other: NpmRc) {
+        if other.registry.is_some() {
+            self.registry = other.registry;
+        }
+        self.scopes.extend(other.scopes);
+        self.auth.extend(other.auth);
+    }
+
+    /// Registry of the scope of `package`, for scoped packages such as `@acme/ui`
+    pub fn scope_registry(&self, package: &str) -> Option<&str> {
+        package
+            .split_once('/')
+            .filter(|(scope, _)| scope.starts_with('@'))
+            .and_then(|(scope, _)| self.scopes.get(scope))
+            .map(String::as_str)
+    }
+
+    /// Auth entry with the longest prefix of `url`
+    fn auth_for(&self, url: &str) -> Option<&Auth> {
+        let nerfed = url
+            .strip_prefix("https:")
+            .or_else(|| url.strip_prefix("http:"))?;
+        self.auth
+            .iter()
+            .filter(|(prefix, _)| nerfed.starts_with(prefix.as_str()))
+            .max_by_key(|(prefix, _)| prefix.len())
+            .map(|(_, auth)| auth)
+    }
+}
+
+/// Replace `${NAME}` with the value of the environment variable, as npm does
+fn expand_env(value: &str) -> String {
+    let mut expanded = String::with_capacity(value.len());
+    let mut rest = value;
+    while let Some(start) = rest.find("${") {
+        let Some(end) = rest[start..].find('}') else {
+            break;
+        };
+        expanded.push_str(&rest[..start]);
+        expanded.push_str(&std::env::var(&rest[start + 2..start + end]).unwrap_or_default());
+        rest = &rest[start + end + 1..];
+    }
+    expanded.push_str(rest);
+    expanded
+}
+
+pub(crate) fn decode_base64(input: &str) -> Option<String> {
+    let mut bits: u32 = 0;
+    let mut bit_count = 0;
+    let mut bytes = Vec::new();
+    for ch in input.trim().bytes().filter(|&b| b != b'=') {
+        let value = match ch {
+            b'A'..=b'Z' => ch - b'A',
+            b'a'..=b'z' => ch - b'a' + 26,
+            b'0'..=b'9' => ch - b'0' + 52,
+            b'+' | b'-' => 62,
+            b'/' | b'_' => 63,
+            _ => return None,
+        };
+        bits = (bits << 6) | u32::from(value);
+        bit_count += 6;
+        if bit_count >= 8 {
+            bit_count -= 8;
+            bytes.push((bits >> bit_count) as u8);
+            bits &= (1 << bit_count) - 1;
+        }
+    }
+    String::from_utf8(bytes).ok()
+}
+
+/// Standard base64 with padding
+pub(crate) fn encode_base64(bytes: &[u8]) -> String {
+    const ALPHABET: &[u8; 64] = b"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+    let mut encoded = String::with_capacity(bytes.len().div_ceil(3) * 4);
+    for chunk in bytes.chunks(3) {
+        let bits = chunk.iter().enumerate().fold(0u32, |bits, (i, &byte)| {
+            bits | u32::from(byte) << (16 - 8 * i)
+        });
+        for i in 0..4 {
+            if i <= chunk.len() {
+                encoded.push(ALPHABET[(bits >> (18 - 6 * i) & 0x3f) as usize] as char);
+            } else {
+                encoded.push('=');
+            }
+        }
+    }
+    encoded
+}
+
+/// Turn a registry URL into the `//host/path/` form used as an `.npmrc` key
+fn nerf_dart(url: &str) -> String {
+    let without_scheme = url.split_once("//").map_or(url, |(_, rest)| rest);
+    format!("//{}/", without_scheme.trim_end_matches('/'))
+}
+
+/// Parse the content of an `.npmrc` file
+pub fn parse_npmrc(content: &str) -> NpmRc {
+    let mut npmrc = NpmRc::default();
+    let mut usernames: HashMap<String, String> = HashMap::new();
+    let mut passwords: HashMap<String, String> = HashMap::new();
+    let mut default_auth: Option<Auth> = None;
+
+    for line in content.lines() {
+        let line = line.trim();
+        if line.is_empty() || line.starts_with('#') || line.starts_with(';') {
+            continue;
+        }
+        let Some((key, value)) = line.split_once('=') else {
+            continue;
+        };
+        let key = key.trim();
+        let value = expand_env(value.trim().trim_matches('"'));
+
+        if key == "registry" {
+            npmrc.registry = Some(value);
+        } else if let Some(scope) = key.strip_suffix(":registry") {
+            npmrc.scopes.insert(scope.to_string(), value);
+        } else if key == "_authToken" {
+            default_auth = Some(Auth::Bearer(value));
+        } else if key == "_auth" {
+            default_auth = Some(Auth::EncodedBasic(value));
+        } else if let Some((prefix, field)) = key.rsplit_once(':') {
+            if !prefix.starts_with("//") {
+                continue;
+            }
+            let prefix = format!("{}/", prefix.trim_end_matches('/'));
+            match field {
+                "_authToken" => {
+                    npmrc.auth.insert(prefix, Auth::Bearer(value));
+                }
+                "_auth" => {
+                    npmrc.auth.insert(prefix, Auth::EncodedBasic(value));
+                }
+                "username" => {
+                    usernames.insert(prefix, value);
+                }
+                "_password" => {
+                    passwords.insert(prefix, decode_base64(&value).unwrap_or(value));
+                }
+                _ => {}
+            }
+        }
+    }
+
+    for (prefix, username) in usernames {
+        let password = passwords.remove(&prefix);
+        npmrc
+            .auth
+            .entry(prefix)
+            .or_insert(Auth::Basic { username, password });
+    }
+    // Top-level auth belongs to the default registry
+    if let (Some(auth), Some(registry)) = (default_auth, &npmrc.registry) {
+        npmrc.auth.entry(nerf_dart(registry)).or_insert(auth);
+    }
+
+    npmrc
+}
+
+/// Parse the `machine` entries of a `.netrc` file, keyed by host
+///
+/// The `default` entry is ignored, so credentials are never sent to a host
+/// they were not written down for.
+pub fn parse_netrc(content: &str) -> HashMap<String, Auth> {
+    let mut entries = HashMap::new();
+    let mut tokens = content
+        .lines()
+        .filter(|line| !line.trim_start().starts_with('#'))
+        .flat_map(str::split_whitespace);
+
+    let mut machine: Option<String> = None;
+    let mut login: Option<String> = None;
+    let mut password: Option<String> = None;
+    let mut flush = |machine: &mut Option<String>,
+                     login: &mut Option<String>,
+                     password: &mut Option<String>| {
+        if let (Some(host), Some(username)) = (machine.take(), login.take()) {
+            entries.entry(host).or_insert(Auth::Basic {
+                username,
+                password: password.take(),
+            });
+        }
+        *password = None;
+    };
+
+    while let Some(token) = tokens.next() {
+        match token {
+            "machine" => {
+                flush(&mut machine, &mut login, &mut password);
+                machine = tokens.next().map(String::from);
+            }
+            "default" => {
+                flush(&mut machine, &mut login, &mut password);
+            }
+            "login" => login = tokens.next().map(String::from),
+            "password" => password = tokens.next().map(String::from),
+            "account" => {
+                tokens.next();
+            }
+            // Macro definitions run until an empty line, which tokens don't preserve
+            "macdef" => break,
+            _ => {}
+        }
+    }
+    flush(&mut machine, &mut login, &mut password);
+    entries
+}
+
+fn read_npmrc(path: &Path) -> Option<NpmRc> {
+    let content = fs::read_to_string(path).ok()?;
+    log(
+        LogLevel::Info,
+        &format!("Reading npm configuration: {}", path.display()),
+    );
+    Some(parse_npmrc(&content))
+}
+
+fn npmrc() -> &'static RwLock<NpmRc> {
+    NPMRC.get_or_init(|| {
+        let user_config = std::env::var("NPM_CONFIG_USERCONFIG")
+            .map(PathBuf::from)
+            .ok()
+            .or_else(|| dirs::home_dir().map(|home| home.join(".npmrc")));
+        RwLock::new(
+            user_config
+                .as_deref()
+                .and_then(read_npmrc)
+                .unwrap_or_default(),
+        )
+    })
+}
+
+/// Read the `.npmrc` of a Node.js project, whose entries win over the user's
+pub fn load_project_npmrc(project_dir: &Path) {
+    if let Some(project) = read_npmrc(&project_dir.join(".npmrc")) {
+        if let Ok(mut npmrc) = npmrc().write() {
+            npmrc.merge(project);
+        }
+    }
+}
+
+/// Registry configured in `.npmrc` for the scope of `package`, if any
+pub fn npm_scope_registry(package: &str) -> Option<String> {
+    npmrc()
+        .read()
+        .ok()?
+        .scope_registry(package)
+        .map(String::from)
+}
+
+/// Registry configured in `.npmrc` for unscoped packages, if any
+pub fn npm_default_registry() -> Option<String> {
+    npmrc().read().ok()?.registry.clone()
+}
+
+fn credential_auth(credential: &RegistryCredential) -> Option<Auth> {
+    let read_env = |name: &String| {
+        let value = std::env::var(name).ok();
+        if value.is_none() {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Environment variable {name} for registry {} is not set",
+                    credential.host
+                ),
+            );
+        }
+        value
+    };
+
+    match (&credential.token_env, &credential.username) {
+        (Some(token_env), _) => read_env(token_env).map(Auth::Bearer),
+        (None, Some(username)) => Some(Auth::Basic {
+            username: username.clone(),
+            password: credential.password_env.as_ref().and_then(read_env),
+        }),
+        (None, None) => None,
+    }
+}
+
+fn host_credentials() -> &'static HashMap<String, Auth> {
+    HOST_CREDENTIALS.get_or_init(|| {
+        let netrc_path = std::env::var("NETRC")
+            .map(PathBuf::from)
+            .ok()
+            .or_else(|| dirs::home_dir().map(|home| home.join(".netrc")));
+        let mut credentials = netrc_path
+            .and_then(|path| fs::read_to_string(path).ok())
+            .map(|content| parse_netrc(&content))
+            .unwrap_or_default();
+
+        if let Ok(config) = crate::config::load_local_config() {
+            for credential in &config.registries.credentials {
+                if let Some(auth) = credential_auth(credential) {
+                    credentials.insert(credential.host.to_lowercase(), auth);
+                }
+            }
+        }
+        credentials
+    })
+}
+
+/// Credentials for a request to `url`, if any are configured
+pub fn authorization(url: &reqwest::Url) -> Option<Auth> {
+    if let Some(auth) = npmrc()
+        .read()
+        .ok()
+        .and_then(|npmrc| npmrc.auth_for(url.as_str()).cloned())
+    {
+        return Some(auth);
+    }
+
+    let host = url.host_str()?.to_lowercase();
+    let credentials = host_credentials();
+    url.port()
+        .and_then(|port| credentials.get(&format!("{host}:{port}")))
+        .or_else(|| credentials.get(&host))
+        .cloned()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_npmrc() {
+        std::env::set_var("FELUDA_TEST_NPM_TOKEN", "secret-token");
+        let npmrc = parse_npmrc(
+            "registry=https://artifactory.example.com/api/npm/npm/
+@acme:registry=https://npm.pkg.github.com
+//npm.pkg.github.com/:_authToken=${FELUDA_TEST_NPM_TOKEN}
+//nexus.example.com/repository/npm/:username=ci
+//nexus.example.com/repository/npm/:_password=aHVudGVyMg==
+; comment
+_auth=Y2k6aHVudGVyMg==
+",
+        );
+
+        assert_eq!(
+            npmrc.registry.as_deref(),
+            Some("https://artifactory.example.com/api/npm/npm/")
+        );
+        assert_eq!(
+            npmrc.scope_registry("@acme/ui"),
+            Some("https://npm.pkg.github.com")
+        );
+        assert_eq!(npmrc.scope_registry("left-pad"), None);
+        assert_eq!(
+            npmrc.auth_for("https://npm.pkg.github.com/@acme/ui"),
+            Some(&Auth::Bearer("secret-token".to_string()))
+        );
+        assert_eq!(
+            npmrc.auth_for("https://nexus.example.com/repository/npm/left-pad"),
+            Some(&Auth::Basic {
+                username: "ci".to_string(),
+                password: Some("hunter2".to_string())
+            })
+        );
+        assert_eq!(
+            npmrc.auth_for("https://artifactory.example.com/api/npm/npm/left-pad/1.3.0"),
+            Some(&Auth::EncodedBasic("Y2k6aHVudGVyMg==".to_string()))
+        );
+        assert_eq!(npmrc.auth_for("https://registry.npmjs.org/left-pad"), None);
+    }
+
+    #[test]
+    fn test_parse_netrc() {
+        let entries = parse_netrc(
+            "# Go module proxy
+machine goproxy.example.com login ci password hunter2
+machine nexus.example.com
+  login deploy
+default login anonymous password guest
+",
+        );
+
+        assert_eq!(entries.len(), 2);
+        assert_eq!(
+            entries.get("goproxy.example.com"),
+            Some(&Auth::Basic {
+                username: "ci".to_string(),
+                password: Some("hunter2".to_string())
+            })
+        );
+        assert_eq!(
+            entries.get("nexus.example.com"),
+            Some(&Auth::Basic {
+                username: "deploy".to_string(),
+                password: None
+            })
+        );
+    }
+
+    #[test]
+    fn test_decode_base64() {
+        assert_eq!(decode_base64("aHVudGVyMg==").as_deref(), Some("hunter2"));
+        assert_eq!(
+            decode_base64("Y2k6aHVudGVyMg").as_deref(),
+            Some("ci:hunter2")
+        );
+        assert_eq!(decode_base64("not base64!"), None);
+        assert_eq!(encode_base64(b"hunter2"), "aHVudGVyMg==");
+        assert_eq!(encode_base64(b"ci:"), "Y2k6");
+    }
+}
@@ -0,0 +1,182 @@
+//! Custom license definitions
+//!
+//! Internal or proprietary licenses are not on the SPDX list, so dependencies
+//! under them would be reported with an unknown license. They can be
+//! registered in the `[licenses.custom]` section of `.feluda.toml`:
+//!
+//! ```toml
+//! [licenses.custom."LicenseRef-ACME-Internal"]
+//! name = "ACME Internal Use Only"
+//! text_file = "legal/acme-internal.txt"
+//! patterns = ["(?i)acme internal use only"]
+//! restrictive = true
+//! tier = "needs-review"
+//! ```
+//!
+//! License files are compared with the reference text alongside the built-in
+//! SPDX texts, and a file matching one of the patterns is classified with full
+//! confidence. A license declared in package metadata refers to the custom
+//! license when it is its identifier or name, ignoring case, or matches one of
+//! the patterns.
+
+use regex::Regex;
+use std::collections::BTreeMap;
+use std::fs;
+use std::sync::OnceLock;
+
+use crate::config::{CustomLicense, FeludaConfig};
+use crate::debug::{log, LogLevel};
+use crate::licenses::{get_osi_status, LicenseInfo};
+
+static CONFIGURED: OnceLock<Vec<CustomMatcher>> = OnceLock::new();
+
+/// A custom license prepared for matching
+#[derive(Debug, Clone)]
+pub struct CustomMatcher {
+    pub id: String,
+    pub name: Option<String>,
+    /// Reference text, read from `text_file` when it is not given inline
+    pub text: Option<String>,
+    pub restrictive: bool,
+    patterns: Vec<Regex>,
+}
+
+impl CustomMatcher {
+    pub fn new(id: &str, license: &CustomLicense) -> Self {
+        let text = license.text.clone().or_else(|| {
+            let path = license.text_file.as_ref()?;
+            fs::read_to_string(path)
+                .map_err(|e| {
+                    log(
+                        LogLevel::Error,
+                        &format!("Failed to read the text of custom license {id} from {path}: {e}"),
+                    )
+                })
+                .ok()
+        });
+        // Patterns are checked by `CustomLicense::validate`
+        let patterns = license
+            .patterns
+            .iter()
+            .filter_map(|pattern| Regex::new(pattern).ok())
+            .collect();
+
+        Self {
+            id: id.to_string(),
+            name: license.name.clone(),
+            text,
+            restrictive: license.restrictive,
+            patterns,
+        }
+    }
+
+    /// Whether any pattern matches `text`
+    pub fn matches_text(&self, text: &str) -> bool {
+        self.patterns.iter().any(|pattern| pattern.is_match(text))
+    }
+
+    /// Whether a license declared in package metadata refers to this license
+    pub fn matches_declared(&self, declared: &str) -> bool {
+        let declared = declared.trim();
+        declared.eq_ignore_ascii_case(&self.id)
+            || self
+                .name
+                .as_deref()
+                .is_some_and(|name| declared.eq_ignore_ascii_case(name.trim()))
+            || self.matches_text(declared)
+    }
+}
+
+/// Prepare the definitions of `[licenses.custom]` for matching
+pub fn compile(custom: &BTreeMap<String, CustomLicense>) -> Vec<CustomMatcher> {
+    custom
+        .iter()
+        .map(|(id, license)| CustomMatcher::new(id, license))
+        .collect()
+}
+
+/// The custom licenses of the configuration in the working directory
+pub fn configured() -> &'static [CustomMatcher] {
+    CONFIGURED.get_or_init(|| {
+        crate::config::load_config()
+            .map(|config| compile(&config.licenses.custom))
+            .unwrap_or_default()
+    })
+}
+
+/// Replace declared licenses referring to a custom license with its identifier
+///
+/// Dependencies under a custom license take its restrictiveness.
+pub fn apply_custom_licenses(dependencies: &mut [LicenseInfo], config: &FeludaConfig) {
+    if config.licenses.custom.is_empty() {
+        return;
+    }
+
+    let matchers = compile(&config.licenses.custom);
+    for info in dependencies.iter_mut() {
+        let Some(declared) = info.license.as_deref() else {
+            continue;
+        };
+        let Some(matcher) = matchers.iter().find(|m| m.matches_declared(declared)) else {
+            continue;
+        };
+
+        if declared != matcher.id {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Declared license '{declared}' of {}@{} is the custom license {}",
+                    info.name, info.version, matcher.id
+                ),
+            );
+            info.license = Some(matcher.id.clone());
+            info.osi_status = get_osi_status(&matcher.id);
+        }
+        info.is_restrictive = matcher.restrictive;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn acme() -> CustomLicense {
+        CustomLicense {
+            name: Some("ACME Internal Use Only".to_string()),
+            patterns: vec![r"(?i)\bacme\b.*\binternal\b".to_string()],
+            restrictive: true,
+            ..CustomLicense::default()
+        }
+    }
+
+    #[test]
+    fn test_matches_declared() {
+        let matcher = CustomMatcher::new("LicenseRef-ACME-Internal", &acme());
+        assert!(matcher.matches_declared("LicenseRef-ACME-Internal"));
+        assert!(matcher.matches_declared("acme internal use only "));
+        assert!(matcher.matches_declared("ACME Corp. internal license"));
+        assert!(!matcher.matches_declared("MIT"));
+    }
+
+    #[test]
+    fn test_apply_custom_licenses() {
+        let mut config = FeludaConfig::default();
+        config
+            .licenses
+            .custom
+            .insert("LicenseRef-ACME-Internal".to_string(), acme());
+
+        let mut dependencies = vec![
+            LicenseInfo::test("widgets", "1.0.0", Some("ACME Internal Use Only")),
+            LicenseInfo::test("gears", "1.0.0", Some("MIT")),
+        ];
+        apply_custom_licenses(&mut dependencies, &config);
+        assert_eq!(
+            dependencies[0].license.as_deref(),
+            Some("LicenseRef-ACME-Internal")
+        );
+        assert!(dependencies[0].is_restrictive);
+        assert_eq!(dependencies[1].license.as_deref(), Some("MIT"));
+        assert!(!dependencies[1].is_restrictive);
+    }
+}
@@ -1,25 +1,31 @@
-use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::atomic::{AtomicBool, AtomicU8, Ordering};
+use std::time::Instant;
 
-// Static atomic flag for debug mode
-pub static DEBUG_MODE: AtomicBool = AtomicBool::new(false);
+use serde_json::Value;
 
-// Log levels for different types of debug information
-#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+// Most verbose level that is logged, 0 when logging is off
+static LOG_LEVEL: AtomicU8 = AtomicU8::new(0);
+
+// Static atomic flag for JSON log lines
+static LOG_JSON: AtomicBool = AtomicBool::new(false);
+
+// Log levels for different types of debug information, from least to most verbose
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, clap::ValueEnum)]
 pub enum LogLevel {
-    Info,
+    Error = 1,
     Warn,
-    Error,
+    Info,
+    Debug,
     Trace,
 }
 
 impl LogLevel {
-    // We're keeping this function since it's needed for the Debug implementation
-    #[allow(dead_code)]
     fn as_str(&self) -> &'static str {
         match self {
-            LogLevel::Info => "INFO",
-            LogLevel::Warn => "WARN",
             LogLevel::Error => "ERROR",
+            LogLevel::Warn => "WARN",
+            LogLevel::Info => "INFO",
+            LogLevel::Debug => "DEBUG",
             LogLevel::Trace => "TRACE",
         }
     }
@@ -27,55 +33,110 @@ impl LogLevel {
     fn as_colored_str(&self) -> colored::ColoredString {
         use colored::*;
         match self {
-            LogLevel::Info => "INFO".green(),
-            LogLevel::Warn => "WARN".yellow(),
             LogLevel::Error => "ERROR".red(),
+            LogLevel::Warn => "WARN".yellow(),
+            LogLevel::Info => "INFO".green(),
+            LogLevel::Debug => "DEBUG".cyan(),
             LogLevel::Trace => "TRACE".blue(),
         }
     }
 }
 
-/// Set the debug mode flag
+/// Format of log lines
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, clap::ValueEnum)]
+pub enum LogFormat {
+    /// `[LEVEL] message key=value`
+    #[default]
+    Text,
+    /// One JSON object per line, for log collectors
+    Json,
+}
+
+/// Set the debug mode flag, which logs everything down to trace level
 pub fn set_debug_mode(debug: bool) {
-    DEBUG_MODE.store(debug, Ordering::Relaxed);
+    set_log_level(debug.then_some(LogLevel::Trace));
     if debug {
         log(LogLevel::Info, "Debug mode enabled");
     }
 }
 
-/// Check if debug mode is enabled
+/// Log messages up to `level`, or nothing when `None`
+pub fn set_log_level(level: Option<LogLevel>) {
+    LOG_LEVEL.store(level.map_or(0, |level| level as u8), Ordering::Relaxed);
+}
+
+/// Set the format of log lines
+pub fn set_log_format(format: LogFormat) {
+    LOG_JSON.store(format == LogFormat::Json, Ordering::Relaxed);
+}
+
+/// Check if debug mode is enabled, i.e. any logging is on
 pub fn is_debug_mode() -> bool {
-    DEBUG_MODE.load(Ordering::Relaxed)
+    LOG_LEVEL.load(Ordering::Relaxed) != 0
 }
 
-/// Log a message with the specified level if debug mode is enabled
+/// Check if messages at `level` are logged
+pub fn log_enabled(level: LogLevel) -> bool {
+    level as u8 <= LOG_LEVEL.load(Ordering::Relaxed)
+}
+
+/// Log a message with the specified level if it is enabled
 pub fn log(level: LogLevel, message: &str) {
-    if is_debug_mode() {
-        println!("[{}] {}", level.as_colored_str(), message);
+    log_event(level, message, &[]);
+}
+
+/// Log a message with structured fields if the level is enabled
+///
+/// Logs go to stderr, so they never mix with reports written to stdout. In
+/// JSON format the fields become keys of the log line, in text format they
+/// follow the message as `key=value`.
+pub fn log_event(level: LogLevel, message: &str, fields: &[(&str, Value)]) {
+    if !log_enabled(level) {
+        return;
     }
+    let json = LOG_JSON.load(Ordering::Relaxed);
+    eprintln!("{}", format_event(json, level, message, fields));
 }
 
-/// Log an error with context information if debug mode is enabled
-pub fn log_error<E: std::fmt::Display>(context: &str, error: &E) {
-    if is_debug_mode() {
-        println!(
-            "[{}] {}: {}",
-            LogLevel::Error.as_colored_str(),
-            context,
-            error
+fn format_event(json: bool, level: LogLevel, message: &str, fields: &[(&str, Value)]) -> String {
+    if json {
+        let mut line = serde_json::Map::new();
+        line.insert(
+            "timestamp".to_string(),
+            chrono::Utc::now()
+                .to_rfc3339_opts(chrono::SecondsFormat::Millis, true)
+                .into(),
         );
+        line.insert("level".to_string(), level.as_str().to_lowercase().into());
+        line.insert("message".to_string(), message.into());
+        for (key, value) in fields {
+            line.insert(key.to_string(), value.clone());
+        }
+        return Value::Object(line).to_string();
+    }
+
+    let mut line = format!("[{}] {}", level.as_colored_str(), message);
+    for (key, value) in fields {
+        // Strings are only quoted when they contain whitespace
+        match value {
+            Value::String(value) if !value.contains(char::is_whitespace) => {
+                line.push_str(&format!(" {key}={value}"))
+            }
+            value => line.push_str(&format!(" {key}={value}")),
+        }
     }
+    line
+}
+
+/// Log an error with context information if error logging is enabled
+pub fn log_error<E: std::fmt::Display>(context: &str, error: &E) {
+    log(LogLevel::Error, &format!("{context}: {error}"));
 }
 
-/// Log detailed information about a value if debug mode is enabled
+/// Log detailed information about a value at trace level
 pub fn log_debug<T: std::fmt::Debug + ?Sized>(context: &str, value: &T) {
-    if is_debug_mode() {
-        println!(
-            "[{}] {}: {:?}",
-            LogLevel::Trace.as_colored_str(),
-            context,
-            value
-        );
+    if log_enabled(LogLevel::Trace) {
+        log(LogLevel::Trace, &format!("{context}: {value:?}"));
     }
 }
 
@@ -90,11 +151,9 @@ where
         let start = std::time::Instant::now();
         let result = f();
         let duration = start.elapsed();
-        println!(
-            "[{}] {} completed in {:?}",
-            LogLevel::Info.as_colored_str(),
-            context,
-            duration
+        log(
+            LogLevel::Info,
+            &format!("{context} completed in {duration:?}"),
         );
         log_debug(context, &result);
         result
@@ -103,6 +162,44 @@ where
     }
 }
 
+/// Run the license lookup of one dependency, logging how long it took at debug level
+///
+/// Slow registries and lookups that hang on retries show up as outliers in
+/// `duration_ms`. Registry requests that fail during the lookup are recorded
+/// for the dependency, see [`crate::lookup_errors`]. Other projects of the
+/// scan reuse the result, see [`crate::shared_lookups`]. Scans with a progress
+/// callback are told about the dependency, see [`crate::scan::ScanProgress`].
+pub fn time_dependency<T: Clone + Send + Sync + 'static>(
+    ecosystem: &str,
+    name: &str,
+    version: &str,
+    lookup: impl FnOnce() -> T,
+) -> T {
+    crate::limits::count_dependency();
+    let lookup = || crate::lookup_errors::capture(name, version, lookup);
+    let started = Instant::now();
+    let result = crate::shared_lookups::resolve_once(ecosystem, name, version, lookup);
+    if log_enabled(LogLevel::Debug) {
+        log_event(
+            LogLevel::Debug,
+            "Resolved dependency license",
+            &[
+                ("ecosystem", ecosystem.into()),
+                ("package", name.into()),
+                ("version", version.into()),
+                ("duration_ms", duration_ms(started).into()),
+            ],
+        );
+    }
+    crate::scan::report_dependency_resolved(ecosystem, name, version);
+    result
+}
+
+/// Milliseconds since `started`, for `duration_ms` fields
+pub fn duration_ms(started: Instant) -> u64 {
+    u64::try_from(started.elapsed().as_millis()).unwrap_or(u64::MAX)
+}
+
 /// Create a custom error type that includes debug information
 #[derive(Debug, thiserror::Error)]
 pub enum FeludaError {
@@ -125,6 +222,9 @@ pub enum FeludaError {
     #[error("Repository clone error: {0}")]
     RepositoryClone(String),
 
+    #[error("Container image error: {0}")]
+    Image(String),
+
     #[error("Temporary directory error: {0}")]
     TempDir(String),
 
@@ -146,6 +246,12 @@ pub enum FeludaError {
     #[error("Validation error: {0}")]
     Validation(String),
 
+    #[error("Report store error: {0}")]
+    Store(String),
+
+    #[error("Template error: {0}")]
+    Template(String),
+
     #[error("Unknown error: {0}")]
     #[allow(dead_code)]
     Unknown(String),
@@ -155,6 +261,41 @@ impl FeludaError {
     pub fn log(&self) {
         log_error("Error occurred", self);
     }
+
+    /// Log a fatal error, printing it in the selected language when logging is off
+    pub fn report(&self) {
+        self.log();
+        // Without logging nothing would tell the user why Feluda failed
+        if !log_enabled(LogLevel::Error) {
+            eprintln!("{}", self.localized());
+        }
+    }
+
+    /// The error with its kind in the language picked with `--lang`
+    ///
+    /// `Display` stays in English for logs and machine-readable output.
+    pub fn localized(&self) -> String {
+        let (key, detail) = match self {
+            FeludaError::Io(err) => ("error.io", err.to_string()),
+            FeludaError::Http(err) => ("error.http", err.to_string()),
+            FeludaError::Config(detail) => ("error.config", detail.clone()),
+            FeludaError::License(detail) => ("error.license", detail.clone()),
+            FeludaError::Parser(detail) => ("error.parser", detail.clone()),
+            FeludaError::RepositoryClone(detail) => ("error.repository_clone", detail.clone()),
+            FeludaError::Image(detail) => ("error.image", detail.clone()),
+            FeludaError::TempDir(detail) => ("error.temp_dir", detail.clone()),
+            FeludaError::TuiInit(detail) => ("error.tui_init", detail.clone()),
+            FeludaError::TuiRuntime(detail) => ("error.tui_runtime", detail.clone()),
+            FeludaError::Serialization(detail) => ("error.serialization", detail.clone()),
+            FeludaError::FileWrite(detail) => ("error.file_write", detail.clone()),
+            FeludaError::InvalidData(detail) => ("error.invalid_data", detail.clone()),
+            FeludaError::Validation(detail) => ("error.validation", detail.clone()),
+            FeludaError::Store(detail) => ("error.store", detail.clone()),
+            FeludaError::Template(detail) => ("error.template", detail.clone()),
+            FeludaError::Unknown(detail) => ("error.unknown", detail.clone()),
+        };
+        format!("{}: {detail}", crate::i18n::tr(key))
+    }
 }
 
 /// Result type alias for Feluda operations
@@ -187,6 +328,39 @@ mod tests {
         assert_eq!(LogLevel::Trace.as_str(), "TRACE");
     }
 
+    #[test]
+    fn test_log_level_verbosity() {
+        assert!(LogLevel::Error < LogLevel::Warn);
+        assert!(LogLevel::Info < LogLevel::Debug);
+        assert!(LogLevel::Debug < LogLevel::Trace);
+        assert_eq!(LogLevel::Debug.as_str(), "DEBUG");
+    }
+
+    #[test]
+    fn test_format_event() {
+        let fields = [
+            ("registry", Value::from("crates.io")),
+            (
+                "url",
+                Value::from("https://crates.io/api/v1/crates/serde 1.0"),
+            ),
+            ("duration_ms", Value::from(42)),
+        ];
+
+        let line = format_event(true, LogLevel::Debug, "Registry request", &fields);
+        let json: Value = serde_json::from_str(&line).unwrap();
+        assert_eq!(json["level"], "debug");
+        assert_eq!(json["message"], "Registry request");
+        assert_eq!(json["registry"], "crates.io");
+        assert_eq!(json["duration_ms"], 42);
+        assert!(json["timestamp"].as_str().unwrap().ends_with('Z'));
+
+        let line = format_event(false, LogLevel::Debug, "Registry request", &fields);
+        assert!(line.ends_with(
+            "Registry request registry=crates.io url=\"https://crates.io/api/v1/crates/serde 1.0\" duration_ms=42"
+        ));
+    }
+
     #[test]
     fn test_log_level_equality() {
         assert_eq!(LogLevel::Info, LogLevel::Info);
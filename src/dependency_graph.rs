@@ -0,0 +1,323 @@
+//! Dependency paths ("why is this here?")
+//!
+//! Analyzers that can read the resolved dependency graph, such as `cargo metadata`,
+//! Cargo.lock or package-lock.json, build a [`DependencyGraph`] and record for every
+//! dependency the shortest chain of packages leading to it from one of the
+//! project's direct dependencies, like `npm explain` or `go mod why`.
+//!
+//! Edges and direct dependencies can carry a [`DependencyScope`], from which the
+//! graph derives the scope of every package: a package only needed through
+//! dev-dependencies is itself a dev dependency.
+
+use std::collections::{HashMap, VecDeque};
+
+use crate::licenses::{DependencyScope, LicenseInfo};
+
+/// Package graph with the project's direct dependencies as entry points
+///
+/// Nodes are identified by an ecosystem-specific id (a Cargo package id, an npm
+/// install path) and labelled `name@version`.
+#[derive(Debug, Default)]
+pub struct DependencyGraph {
+    ids: HashMap<String, usize>,
+    labels: Vec<String>,
+    edges: Vec<Vec<usize>>,
+    direct: Vec<usize>,
+    /// Scopes of edges and direct dependencies that are not runtime
+    edge_scopes: HashMap<(usize, usize), DependencyScope>,
+    direct_scopes: HashMap<usize, DependencyScope>,
+}
+
+impl DependencyGraph {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Add a package, returning its index; adding an existing id keeps the first label
+    pub fn add_package(&mut self, id: &str, name: &str, version: &str) -> usize {
+        if let Some(&index) = self.ids.get(id) {
+            return index;
+        }
+        let index = self.labels.len();
+        self.ids.insert(id.to_string(), index);
+        self.labels.push(format!("{name}@{version}"));
+        self.edges.push(Vec::new());
+        index
+    }
+
+    /// Record that `from` depends on `to`; unknown ids are ignored
+    pub fn add_dependency(&mut self, from: &str, to: &str) {
+        self.add_dependency_with_scope(from, to, DependencyScope::Runtime);
+    }
+
+    /// Record that `from` needs `to` only in `scope`, e.g. as a build dependency
+    ///
+    /// Recording the same edge again keeps the narrowest scope, so a package that
+    /// is both a dependency and a dev-dependency counts as runtime.
+    pub fn add_dependency_with_scope(&mut self, from: &str, to: &str, scope: DependencyScope) {
+        if let (Some(&from), Some(&to)) = (self.ids.get(from), self.ids.get(to)) {
+            let known = self.edges[from].contains(&to);
+            if !known {
+                self.edges[from].push(to);
+            }
+            Self::narrow_scope(&mut self.edge_scopes, (from, to), scope, known);
+        }
+    }
+
+    /// Mark a package as a direct dependency of the project
+    pub fn add_direct(&mut self, id: &str) {
+        self.add_direct_with_scope(id, DependencyScope::Runtime);
+    }
+
+    /// Mark a package as a direct dependency the project needs only in `scope`
+    pub fn add_direct_with_scope(&mut self, id: &str, scope: DependencyScope) {
+        if let Some(&index) = self.ids.get(id) {
+            let known = self.direct.contains(&index);
+            if !known {
+                self.direct.push(index);
+            }
+            Self::narrow_scope(&mut self.direct_scopes, index, scope, known);
+        }
+    }
+
+    fn narrow_scope<K: std::hash::Hash + Eq>(
+        scopes: &mut HashMap<K, DependencyScope>,
+        key: K,
+        scope: DependencyScope,
+        known: bool,
+    ) {
+        let current = if known {
+            scopes.get(&key).copied().unwrap_or_default()
+        } else {
+            scope
+        };
+        match current.min(scope) {
+            DependencyScope::Runtime => scopes.remove(&key),
+            narrowest => scopes.insert(key, narrowest),
+        };
+    }
+
+    fn edge_scope(&self, from: usize, to: usize) -> DependencyScope {
+        self.edge_scopes
+            .get(&(from, to))
+            .copied()
+            .unwrap_or_default()
+    }
+
+    /// Scope of every reachable package, keyed by `name@version`
+    ///
+    /// A package's scope is the narrowest one over all chains leading to it,
+    /// where a chain is as wide as its widest link: a runtime package pulled in
+    /// by a build dependency is only needed to build.
+    pub fn scopes(&self) -> HashMap<String, DependencyScope> {
+        let mut best: Vec<Option<DependencyScope>> = vec![None; self.labels.len()];
+        let mut queue = VecDeque::new();
+
+        for &index in &self.direct {
+            let scope = self.direct_scopes.get(&index).copied().unwrap_or_default();
+            if best[index].is_none_or(|current| scope < current) {
+                best[index] = Some(scope);
+                queue.push_back(index);
+            }
+        }
+
+        // Scopes only ever narrow and there are four of them, so every package
+        // is queued a bounded number of times
+        while let Some(index) = queue.pop_front() {
+            let Some(scope) = best[index] else { continue };
+            for &next in &self.edges[index] {
+                let candidate = scope.max(self.edge_scope(index, next));
+                if best[next].is_none_or(|current| candidate < current) {
+                    best[next] = Some(candidate);
+                    queue.push_back(next);
+                }
+            }
+        }
+
+        let mut scopes: HashMap<String, DependencyScope> = HashMap::new();
+        for (index, scope) in best.into_iter().enumerate() {
+            let Some(scope) = scope else { continue };
+            scopes
+                .entry(self.labels[index].clone())
+                .and_modify(|current| *current = (*current).min(scope))
+                .or_insert(scope);
+        }
+        scopes
+    }
+
+    /// Shortest path from a direct dependency to every reachable package
+    ///
+    /// Keyed by `name@version`; each path starts at a direct dependency and ends
+    /// with the package itself, so direct dependencies map to a single entry.
+    pub fn paths(&self) -> HashMap<String, Vec<String>> {
+        let mut parent: Vec<Option<usize>> = vec![None; self.labels.len()];
+        let mut visited = vec![false; self.labels.len()];
+        let mut queue = VecDeque::new();
+
+        for &index in &self.direct {
+            if !visited[index] {
+                visited[index] = true;
+                queue.push_back(index);
+            }
+        }
+
+        let mut order = Vec::new();
+        while let Some(index) = queue.pop_front() {
+            order.push(index);
+            for &next in &self.edges[index] {
+                if !visited[next] {
+                    visited[next] = true;
+                    parent[next] = Some(index);
+                    queue.push_back(next);
+                }
+            }
+        }
+
+        let mut paths = HashMap::new();
+        for index in order {
+            let label = &self.labels[index];
+            // Several copies of the same package version may be installed; the
+            // first one reached is the closest to the project
+            if paths.contains_key(label) {
+                continue;
+            }
+            let mut path = vec![label.clone()];
+            let mut current = index;
+            while let Some(previous) = parent[current] {
+                path.push(self.labels[previous].clone());
+                current = previous;
+            }
+            path.reverse();
+            paths.insert(label.clone(), path);
+        }
+        paths
+    }
+
+    /// Direct dependencies of every package, keyed by `name@version`
+    ///
+    /// Copies of the same package version installed in several places share
+    /// one entry with the dependencies of all of them.
+    pub fn requires(&self) -> HashMap<String, Vec<String>> {
+        let mut requires: HashMap<String, Vec<String>> = HashMap::new();
+        for (index, label) in self.labels.iter().enumerate() {
+            let entry = requires.entry(label.clone()).or_default();
+            for &next in &self.edges[index] {
+                let next = &self.labels[next];
+                if !entry.contains(next) {
+                    entry.push(next.clone());
+                }
+            }
+        }
+        requires
+    }
+}
+
+/// Set `dependency_path` on every dependency found in `paths`
+pub fn attach_dependency_paths(deps: &mut [LicenseInfo], paths: &HashMap<String, Vec<String>>) {
+    for dep in deps {
+        if let Some(path) = paths.get(&format!("{}@{}", dep.name, dep.version)) {
+            dep.dependency_path = Some(path.clone());
+        }
+    }
+}
+
+/// Set `requires` on every dependency found in `requires`
+pub fn attach_dependency_requires(
+    deps: &mut [LicenseInfo],
+    requires: &HashMap<String, Vec<String>>,
+) {
+    for dep in deps {
+        if let Some(packages) = requires.get(&format!("{}@{}", dep.name, dep.version)) {
+            dep.requires = Some(packages.clone());
+        }
+    }
+}
+
+/// Set `scope` on every dependency found in `scopes`
+pub fn attach_dependency_scopes(
+    deps: &mut [LicenseInfo],
+    scopes: &HashMap<String, DependencyScope>,
+) {
+    for dep in deps {
+        if let Some(&scope) = scopes.get(&format!("{}@{}", dep.name, dep.version)) {
+            dep.scope = scope;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_paths_use_shortest_chain_from_direct_dependencies() {
+        let mut graph = DependencyGraph::new();
+        graph.add_package("express", "express", "4.18.2");
+        graph.add_package("body-parser", "body-parser", "1.20.1");
+        graph.add_package("qs", "qs", "6.11.0");
+        graph.add_package("side-channel", "side-channel", "1.0.4");
+        graph.add_package("orphan", "orphan", "0.1.0");
+        graph.add_dependency("express", "body-parser");
+        graph.add_dependency("body-parser", "qs");
+        graph.add_dependency("express", "qs");
+        graph.add_dependency("qs", "side-channel");
+        graph.add_dependency("express", "missing");
+        graph.add_direct("express");
+
+        let paths = graph.paths();
+        assert_eq!(paths["express@4.18.2"], vec!["express@4.18.2"]);
+        assert_eq!(paths["qs@6.11.0"], vec!["express@4.18.2", "qs@6.11.0"]);
+        assert_eq!(
+            paths["side-channel@1.0.4"],
+            vec!["express@4.18.2", "qs@6.11.0", "side-channel@1.0.4"]
+        );
+        assert!(!paths.contains_key("orphan@0.1.0"));
+    }
+
+    #[test]
+    fn test_cycles_terminate() {
+        let mut graph = DependencyGraph::new();
+        graph.add_package("a", "a", "1.0.0");
+        graph.add_package("b", "b", "1.0.0");
+        graph.add_dependency("a", "b");
+        graph.add_dependency("b", "a");
+        graph.add_direct("a");
+
+        let paths = graph.paths();
+        assert_eq!(paths["b@1.0.0"], vec!["a@1.0.0", "b@1.0.0"]);
+        assert_eq!(paths["a@1.0.0"], vec!["a@1.0.0"]);
+    }
+
+    #[test]
+    fn test_scopes_take_the_narrowest_chain() {
+        let mut graph = DependencyGraph::new();
+        for id in ["app-dep", "jest", "babel", "shared", "cc", "libc"] {
+            graph.add_package(id, id, "1.0.0");
+        }
+        graph.add_direct("app-dep");
+        graph.add_direct_with_scope("jest", DependencyScope::Dev);
+        graph.add_dependency("jest", "babel");
+        graph.add_dependency("jest", "shared");
+        graph.add_dependency("app-dep", "shared");
+        graph.add_dependency_with_scope("app-dep", "cc", DependencyScope::Build);
+        graph.add_dependency("cc", "libc");
+
+        let scopes = graph.scopes();
+        assert_eq!(scopes["app-dep@1.0.0"], DependencyScope::Runtime);
+        assert_eq!(scopes["jest@1.0.0"], DependencyScope::Dev);
+        assert_eq!(scopes["babel@1.0.0"], DependencyScope::Dev);
+        assert_eq!(scopes["shared@1.0.0"], DependencyScope::Runtime);
+        assert_eq!(scopes["cc@1.0.0"], DependencyScope::Build);
+        assert_eq!(scopes["libc@1.0.0"], DependencyScope::Build);
+    }
+
+    #[test]
+    fn test_runtime_declaration_wins_over_dev() {
+        let mut graph = DependencyGraph::new();
+        graph.add_package("serde", "serde", "1.0.0");
+        graph.add_direct_with_scope("serde", DependencyScope::Dev);
+        graph.add_direct("serde");
+
+        assert_eq!(graph.scopes()["serde@1.0.0"], DependencyScope::Runtime);
+    }
+}
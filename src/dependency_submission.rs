@@ -0,0 +1,541 @@
+//! GitHub dependency submission (`--submit-github`)
+//!
+//! Uploads the resolved dependencies as a snapshot to GitHub's dependency
+//! submission API, so the dependency graph and Dependabot alerts cover the
+//! transitive dependencies Feluda resolved rather than only what GitHub reads
+//! from the manifests itself. Every manifest lists its packages by package URL,
+//! marked direct or indirect from the dependency graph, with the packages each
+//! one requires.
+//!
+//! The repository, commit and ref come from `GITHUB_REPOSITORY`, `GITHUB_SHA`
+//! and `GITHUB_REF`, set in GitHub Actions. Elsewhere they fall back to the
+//! `origin` remote and the checked out branch. The token needs the
+//! `contents: write` permission.
+
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use std::env;
+use std::path::Path;
+
+use crate::canonical::repository;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::image::os_packages::{APK_INSTALLED, DPKG_STATUS, DPKG_STATUS_DIR, RPM_DATABASES};
+use crate::licenses::{get_github_token, DependencyScope, LicenseInfo};
+use crate::registry::{self, Registry};
+
+const DEFAULT_API_URL: &str = "https://api.github.com";
+
+/// Correlator outside GitHub Actions; a snapshot replaces earlier ones with the same correlator
+const DEFAULT_CORRELATOR: &str = "feluda";
+
+#[derive(Serialize, Debug)]
+pub struct Snapshot {
+    pub version: u32,
+    pub sha: String,
+    #[serde(rename = "ref")]
+    pub git_ref: String,
+    pub job: Job,
+    pub detector: Detector,
+    pub scanned: String,
+    pub manifests: BTreeMap<String, Manifest>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct Job {
+    pub correlator: String,
+    pub id: String,
+}
+
+#[derive(Serialize, Debug)]
+pub struct Detector {
+    pub name: String,
+    pub version: String,
+    pub url: String,
+}
+
+#[derive(Serialize, Debug)]
+pub struct Manifest {
+    pub name: String,
+    pub file: ManifestFile,
+    pub resolved: BTreeMap<String, ResolvedPackage>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ManifestFile {
+    pub source_location: String,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ResolvedPackage {
+    pub package_url: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub relationship: Option<String>,
+    pub scope: String,
+    pub dependencies: Vec<String>,
+}
+
+/// Where a snapshot is submitted and the commit it describes
+#[derive(Debug, Clone, PartialEq)]
+pub struct SubmissionContext {
+    /// `owner/repo`
+    pub repository: String,
+    pub sha: String,
+    /// Fully qualified, e.g. `refs/heads/main`
+    pub git_ref: String,
+    pub correlator: String,
+    pub job_id: String,
+}
+
+impl SubmissionContext {
+    /// Read the context from the GitHub Actions environment, or the git repository containing `path`
+    pub fn detect(path: &Path) -> FeludaResult<Self> {
+        let var = |name: &str| env::var(name).ok().filter(|value| !value.is_empty());
+        let repo = git2::Repository::discover(path).ok();
+
+        let repository = var("GITHUB_REPOSITORY")
+            .or_else(|| {
+                let remote = repo.as_ref()?.find_remote("origin").ok()?;
+                github_repository(remote.url()?)
+            })
+            .ok_or_else(|| {
+                FeludaError::Config(
+                    "--submit-github needs GITHUB_REPOSITORY or a GitHub origin remote".to_string(),
+                )
+            })?;
+
+        let head = repo.as_ref().and_then(|repo| repo.head().ok());
+        let sha = var("GITHUB_SHA")
+            .or_else(|| Some(head.as_ref()?.peel_to_commit().ok()?.id().to_string()))
+            .ok_or_else(|| {
+                FeludaError::Config(
+                    "--submit-github needs GITHUB_SHA or a git repository with a commit"
+                        .to_string(),
+                )
+            })?;
+        // A detached HEAD has no ref to file the snapshot under
+        let git_ref = var("GITHUB_REF")
+            .or_else(|| {
+                head.as_ref()?
+                    .name()
+                    .filter(|name| name.starts_with("refs/"))
+                    .map(str::to_string)
+            })
+            .ok_or_else(|| {
+                FeludaError::Config(
+                    "--submit-github needs GITHUB_REF or a checked out branch".to_string(),
+                )
+            })?;
+
+        let correlator = match (var("GITHUB_WORKFLOW"), var("GITHUB_JOB")) {
+            (Some(workflow), Some(job)) => format!("{DEFAULT_CORRELATOR}_{workflow}_{job}"),
+            _ => DEFAULT_CORRELATOR.to_string(),
+        };
+        let job_id = var("GITHUB_RUN_ID").unwrap_or_else(|| sha.clone());
+
+        Ok(Self {
+            repository,
+            sha,
+            git_ref,
+            correlator,
+            job_id,
+        })
+    }
+}
+
+/// `owner/repo` of a GitHub remote URL, over HTTPS or SSH
+pub(crate) fn github_repository(url: &str) -> Option<String> {
+    let path = url
+        .strip_prefix("git@github.com:")
+        .or_else(|| url.split_once("github.com/").map(|(_, path)| path))?;
+    let path = path.trim_end_matches('/').trim_end_matches(".git");
+    let (owner, repo) = path.split_once('/')?;
+    (!owner.is_empty() && !repo.is_empty() && !repo.contains('/'))
+        .then(|| format!("{owner}/{repo}"))
+}
+
+/// Package URL type for the manifest a dependency was found in
+pub(crate) fn purl_type(source_file: &str) -> Option<&'static str> {
+    if source_file.ends_with(DPKG_STATUS) || source_file.contains(DPKG_STATUS_DIR) {
+        return Some("deb");
+    }
+    if source_file.ends_with(APK_INSTALLED) {
+        return Some("apk");
+    }
+    if RPM_DATABASES
+        .iter()
+        .any(|database| source_file.ends_with(database))
+    {
+        return Some("rpm");
+    }
+    let file_name = Path::new(source_file).file_name()?.to_str()?;
+    match file_name {
+        "Cargo.toml" | "Cargo.lock" => Some("cargo"),
+        "package.json" | "package-lock.json" | "yarn.lock" | "pnpm-lock.yaml" => Some("npm"),
+        "go.mod" | "go.sum" | "modules.txt" => Some("golang"),
+        "requirements.txt" | "Pipfile.lock" | "poetry.lock" | "pip_freeze.txt"
+        | "pyproject.toml" => Some("pypi"),
+        "pom.xml"
+        | "gradle.lockfile"
+        | "build.gradle"
+        | "build.gradle.kts"
+        | "settings.gradle"
+        | "settings.gradle.kts" => Some("maven"),
+        "DESCRIPTION" | "renv.lock" => Some("cran"),
+        "Gemfile.lock" => Some("gem"),
+        "composer.lock" | "composer.json" | "installed.json" => Some("composer"),
+        "conanfile.txt" | "conanfile.py" | "conan.lock" => Some("conan"),
+        "pubspec.lock" => Some("pub"),
+        "Package.resolved" => Some("swift"),
+        "mix.lock" => Some("hex"),
+        "cabal.project.freeze" | "stack.yaml.lock" => Some("hackage"),
+        "paket.lock" | "packages.lock.json" => Some("nuget"),
+        _ if file_name.ends_with("proj") || file_name.ends_with(".slnx") => Some("nuget"),
+        _ if file_name.ends_with("_install.json") => Some("maven"),
+        _ if file_name.ends_with(".opam.locked") => Some("opam"),
+        _ => None,
+    }
+}
+
+/// Package URL of a dependency, e.g. `pkg:npm/%40types/node@20.1.0`
+///
+/// A purl recorded by the parser or the SBOM comes first. Otherwise it is
+/// derived from the manifest the dependency was found in, or from its
+/// repository when that is on GitHub, GitLab or Bitbucket.
+pub fn package_url(info: &LicenseInfo) -> Option<String> {
+    if let Some(purl) = &info.purl {
+        return Some(purl.clone());
+    }
+    match info.source_file.as_deref().and_then(purl_type) {
+        // Swift packages are namespaced by the host and owner of their repository
+        Some("swift") => format_package_url("swift", &repository(info)?, &info.version),
+        Some(purl_type) => format_package_url(purl_type, &info.name, &info.version),
+        None => {
+            let repository = repository(info)?;
+            let (host, path) = repository.split_once('/')?;
+            let purl_type = match host {
+                "github.com" => "github",
+                "gitlab.com" => "gitlab",
+                "bitbucket.org" => "bitbucket",
+                _ => return None,
+            };
+            format_package_url(purl_type, path, &info.version)
+        }
+    }
+}
+
+/// Package URL of `name` at `version` in the ecosystem of `purl_type`
+///
+/// The version is left out when it is a range rather than a resolved version.
+pub fn format_package_url(purl_type: &str, name: &str, version: &str) -> Option<String> {
+    let name = match purl_type {
+        "maven" => name.replace(':', "/"),
+        "pypi" => name.to_lowercase().replace('_', "-"),
+        "composer" => name.to_lowercase(),
+        _ => name.to_string(),
+    };
+    let name = name
+        .split('/')
+        .filter(|segment| !segment.is_empty())
+        .map(encode)
+        .collect::<Vec<_>>()
+        .join("/");
+    if name.is_empty() {
+        return None;
+    }
+
+    let version = version.trim();
+    let is_resolved = !version.is_empty()
+        && !version.starts_with(['^', '~', '>', '<', '=', '*'])
+        && !version.contains(|c: char| c == '/' || c.is_whitespace());
+    Some(if is_resolved {
+        format!("pkg:{purl_type}/{name}@{}", encode(version))
+    } else {
+        format!("pkg:{purl_type}/{name}")
+    })
+}
+
+/// Percent-encode a package URL segment
+pub(crate) fn encode(segment: &str) -> String {
+    let mut encoded = String::with_capacity(segment.len());
+    for byte in segment.bytes() {
+        if byte.is_ascii_alphanumeric() || matches!(byte, b'.' | b'-' | b'_' | b'~') {
+            encoded.push(byte as char);
+        } else {
+            encoded.push_str(&format!("%{byte:02X}"));
+        }
+    }
+    encoded
+}
+
+/// Build the snapshot of analyzed dependencies, one manifest per source file
+///
+/// Dependencies without a package URL, such as those of unsupported
+/// ecosystems, are left out.
+pub fn build_snapshot(
+    license_info: &[LicenseInfo],
+    context: &SubmissionContext,
+    scanned: &str,
+) -> Snapshot {
+    let purls: Vec<Option<String>> = license_info.iter().map(package_url).collect();
+
+    // `requires` names packages as `name@version` within the same manifest
+    let mut by_manifest: HashMap<&str, HashMap<String, &str>> = HashMap::new();
+    for (info, purl) in license_info.iter().zip(&purls) {
+        if let (Some(source_file), Some(purl)) = (info.source_file.as_deref(), purl) {
+            by_manifest
+                .entry(source_file)
+                .or_default()
+                .insert(format!("{}@{}", info.name, info.version), purl);
+        }
+    }
+
+    let mut manifests: BTreeMap<String, Manifest> = BTreeMap::new();
+    for (info, purl) in license_info.iter().zip(&purls) {
+        let (Some(source_file), Some(purl)) = (info.source_file.as_deref(), purl) else {
+            continue;
+        };
+        let packages = &by_manifest[source_file];
+        let dependencies = info
+            .requires
+            .iter()
+            .flatten()
+            .filter_map(|required| packages.get(required).map(|purl| purl.to_string()))
+            .collect();
+        let relationship = info
+            .dependency_path
+            .as_ref()
+            .map(|path| if path.len() > 1 { "indirect" } else { "direct" }.to_string());
+        let scope = match info.scope {
+            DependencyScope::Runtime => "runtime",
+            DependencyScope::Build | DependencyScope::Test | DependencyScope::Dev => "development",
+        };
+
+        manifests
+            .entry(source_file.to_string())
+            .or_insert_with(|| Manifest {
+                name: source_file.to_string(),
+                file: ManifestFile {
+                    source_location: source_file.to_string(),
+                },
+                resolved: BTreeMap::new(),
+            })
+            .resolved
+            .insert(
+                purl.clone(),
+                ResolvedPackage {
+                    package_url: purl.clone(),
+                    relationship,
+                    scope: scope.to_string(),
+                    dependencies,
+                },
+            );
+    }
+
+    Snapshot {
+        version: 0,
+        sha: context.sha.clone(),
+        git_ref: context.git_ref.clone(),
+        job: Job {
+            correlator: context.correlator.clone(),
+            id: context.job_id.clone(),
+        },
+        detector: Detector {
+            name: "feluda".to_string(),
+            version: env!("CARGO_PKG_VERSION").to_string(),
+            url: env!("CARGO_PKG_REPOSITORY").to_string(),
+        },
+        scanned: scanned.to_string(),
+        manifests,
+    }
+}
+
+/// Submit the analyzed dependencies of the project at `path` to GitHub
+pub fn submit_dependencies(license_info: &[LicenseInfo], path: &Path) -> FeludaResult<()> {
+    let token = get_github_token().ok_or_else(|| {
+        FeludaError::Config("--submit-github needs --github-token or GITHUB_TOKEN".to_string())
+    })?;
+    let context = SubmissionContext::detect(path)?;
+    let scanned = chrono::Utc::now().to_rfc3339_opts(chrono::SecondsFormat::Secs, true);
+    let snapshot = build_snapshot(license_info, &context, &scanned);
+
+    let submitted: usize = snapshot.manifests.values().map(|m| m.resolved.len()).sum();
+    if submitted < license_info.len() {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "{} dependencies have no package URL and are not submitted to GitHub",
+                license_info.len() - submitted
+            ),
+        );
+    }
+    log(
+        LogLevel::Info,
+        &format!(
+            "Submitting {submitted} dependencies in {} manifests to {} at {}",
+            snapshot.manifests.len(),
+            context.repository,
+            context.sha
+        ),
+    );
+
+    let api_url = env::var("GITHUB_API_URL").unwrap_or_else(|_| DEFAULT_API_URL.to_string());
+    let url = format!(
+        "{}/repos/{}/dependency-graph/snapshots",
+        api_url.trim_end_matches('/'),
+        context.repository
+    );
+    let response = registry::send(Registry::GitHub, |client| {
+        client
+            .post(&url)
+            .bearer_auth(token)
+            .header(reqwest::header::ACCEPT, "application/vnd.github+json")
+            .header("X-GitHub-Api-Version", "2022-11-28")
+            .json(&snapshot)
+    })?;
+
+    let status = response.status();
+    let body: serde_json::Value = response.json().unwrap_or_default();
+    if !status.is_success() {
+        let message = body["message"].as_str().unwrap_or_default();
+        return Err(FeludaError::InvalidData(format!(
+            "GitHub rejected the dependency snapshot: HTTP {status} {message}"
+        )));
+    }
+    log(
+        LogLevel::Info,
+        &format!(
+            "Dependency snapshot {} submitted: {}",
+            body["id"],
+            body["message"].as_str().unwrap_or("accepted")
+        ),
+    );
+    println!(
+        "Submitted {submitted} dependencies to the GitHub dependency graph of {}",
+        context.repository
+    );
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::{LicenseCompatibility, OsiStatus};
+
+    fn dep(name: &str, version: &str, source_file: &str) -> LicenseInfo {
+        LicenseInfo {
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            source_file: Some(source_file.to_string()),
+            ..LicenseInfo::test(name, version, Some("MIT"))
+        }
+    }
+
+    #[test]
+    fn test_package_url() {
+        let purl = |name, version, source_file| package_url(&dep(name, version, source_file));
+        assert_eq!(
+            purl("@types/node", "20.1.0", "web/package-lock.json").as_deref(),
+            Some("pkg:npm/%40types/node@20.1.0")
+        );
+        assert_eq!(
+            purl("org.slf4j:slf4j-api", "2.0.9", "pom.xml").as_deref(),
+            Some("pkg:maven/org.slf4j/slf4j-api@2.0.9")
+        );
+        assert_eq!(
+            purl("github.com/spf13/cobra", "v1.8.0", "go.mod").as_deref(),
+            Some("pkg:golang/github.com/spf13/cobra@v1.8.0")
+        );
+        assert_eq!(
+            purl("Jinja2_Ext", "1.0+local", "requirements.txt").as_deref(),
+            Some("pkg:pypi/jinja2-ext@1.0%2Blocal")
+        );
+        assert_eq!(
+            purl("serde", "^1.0", "Cargo.toml").as_deref(),
+            Some("pkg:cargo/serde")
+        );
+        assert_eq!(purl("hashicorp/aws", "5.0.0", ".terraform.lock.hcl"), None);
+        assert_eq!(
+            purl("zlib1g", "1:1.2.13", "var/lib/dpkg/status").as_deref(),
+            Some("pkg:deb/zlib1g@1%3A1.2.13")
+        );
+
+        let mut nio = dep("swift-nio", "2.62.0", "Package.resolved");
+        nio.repository = Some("https://github.com/apple/swift-nio.git".to_string());
+        assert_eq!(
+            package_url(&nio).as_deref(),
+            Some("pkg:swift/github.com/apple/swift-nio@2.62.0")
+        );
+        let mut archive = dep("rules_foo", "v1.0", "MODULE.bazel");
+        archive.repository = Some("https://github.com/acme/rules_foo".to_string());
+        assert_eq!(
+            package_url(&archive).as_deref(),
+            Some("pkg:github/acme/rules_foo@v1.0")
+        );
+        archive.purl = Some("pkg:bazel/rules_foo@1.0".to_string());
+        assert_eq!(
+            package_url(&archive).as_deref(),
+            Some("pkg:bazel/rules_foo@1.0")
+        );
+    }
+
+    #[test]
+    fn test_github_repository() {
+        assert_eq!(
+            github_repository("https://github.com/anistark/feluda.git").as_deref(),
+            Some("anistark/feluda")
+        );
+        assert_eq!(
+            github_repository("git@github.com:anistark/feluda.git").as_deref(),
+            Some("anistark/feluda")
+        );
+        assert_eq!(github_repository("https://gitlab.com/org/project"), None);
+    }
+
+    #[test]
+    fn test_build_snapshot() {
+        let mut express = dep("express", "4.18.2", "package-lock.json");
+        express.dependency_path = Some(vec!["express@4.18.2".to_string()]);
+        express.requires = Some(vec!["qs@6.11.0".to_string(), "missing@1.0.0".to_string()]);
+        let mut qs = dep("qs", "6.11.0", "package-lock.json");
+        qs.dependency_path = Some(vec!["express@4.18.2".to_string(), "qs@6.11.0".to_string()]);
+        let mut jest = dep("jest", "29.7.0", "package-lock.json");
+        jest.scope = DependencyScope::Dev;
+        let data = vec![
+            express,
+            qs,
+            jest,
+            dep("serde", "1.0.0", "crates/core/Cargo.toml"),
+            dep("hashicorp/aws", "5.0.0", ".terraform.lock.hcl"),
+        ];
+        let context = SubmissionContext {
+            repository: "anistark/feluda".to_string(),
+            sha: "abc123".to_string(),
+            git_ref: "refs/heads/main".to_string(),
+            correlator: "feluda".to_string(),
+            job_id: "42".to_string(),
+        };
+
+        let snapshot = build_snapshot(&data, &context, "2024-01-01T00:00:00Z");
+        assert_eq!(snapshot.manifests.len(), 2);
+        let npm = &snapshot.manifests["package-lock.json"];
+        assert_eq!(npm.file.source_location, "package-lock.json");
+        let express = &npm.resolved["pkg:npm/express@4.18.2"];
+        assert_eq!(express.relationship.as_deref(), Some("direct"));
+        assert_eq!(express.dependencies, vec!["pkg:npm/qs@6.11.0"]);
+        let qs = &npm.resolved["pkg:npm/qs@6.11.0"];
+        assert_eq!(qs.relationship.as_deref(), Some("indirect"));
+        let jest = &npm.resolved["pkg:npm/jest@29.7.0"];
+        assert_eq!(jest.relationship, None);
+        assert_eq!(jest.scope, "development");
+
+        let json = serde_json::to_value(&snapshot).unwrap();
+        assert_eq!(json["ref"], "refs/heads/main");
+        assert_eq!(json["job"]["id"], "42");
+        assert_eq!(json["detector"]["name"], "feluda");
+        assert!(
+            json["manifests"]["package-lock.json"]["resolved"]["pkg:npm/jest@29.7.0"]
+                .get("relationship")
+                .is_none()
+        );
+    }
+}
@@ -0,0 +1,583 @@
+//! Cross-ecosystem metadata from deps.dev
+//!
+//! The [deps.dev API](https://docs.deps.dev/api/v3/) answers for npm, PyPI,
+//! Maven, NuGet, crates.io, RubyGems and Go modules alike. An ecosystem whose
+//! `[registries.sources]` list ends with `"deps.dev"` asks it for the licenses
+//! no other source knew, which makes it a useful last resort when the registry
+//! of an ecosystem is down or a private mirror lacks a package.
+//!
+//! With `--deps-dev` (or `[registries] deps_dev = true`) every ecosystem falls
+//! back to it, and each dependency is enriched with:
+//!
+//! - the packages it requires, when the lockfile didn't tell, for npm, Cargo,
+//!   Maven and PyPI. Versions are those of the same manifest when the package
+//!   is there too.
+//! - the OpenSSF Scorecard score of its source repository, in
+//!   [`PackageHealth::scorecard`].
+
+use colored::*;
+use rayon::prelude::*;
+use serde::de::DeserializeOwned;
+use serde::Deserialize;
+use std::collections::{BTreeMap, HashMap};
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_error, LogLevel};
+use crate::dependency_submission::{encode, purl_type};
+use crate::health::PackageHealth;
+use crate::licenses::{
+    fetch_licenses_from_github, get_osi_status, is_license_restrictive, LicenseInfo,
+};
+use crate::registry::{self, Registry};
+use crate::reporter::TableFormatter;
+
+const DEPS_DEV_API_URL: &str = "https://api.deps.dev/v3";
+
+/// License deps.dev reports for an expression it couldn't map to SPDX
+const NON_STANDARD: &str = "non-standard";
+
+/// Systems deps.dev resolves dependency graphs for
+const GRAPH_SYSTEMS: &[&str] = &["NPM", "CARGO", "MAVEN", "PYPI"];
+
+#[derive(Debug, Default, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct VersionResponse {
+    #[serde(default)]
+    licenses: Vec<String>,
+    #[serde(default)]
+    related_projects: Vec<RelatedProject>,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct RelatedProject {
+    project_key: ProjectKey,
+    #[serde(default)]
+    relation_type: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct ProjectKey {
+    /// e.g. `github.com/expressjs/express`
+    id: String,
+}
+
+impl VersionResponse {
+    fn source_repository(&self) -> Option<&str> {
+        self.related_projects
+            .iter()
+            .find(|project| project.relation_type == "SOURCE_REPO")
+            .map(|project| project.project_key.id.as_str())
+    }
+}
+
+/// The resolved dependency graph of a version, with the version itself as node 0
+#[derive(Debug, Deserialize)]
+struct DependenciesResponse {
+    #[serde(default)]
+    nodes: Vec<Node>,
+    #[serde(default)]
+    edges: Vec<Edge>,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct Node {
+    version_key: VersionKey,
+}
+
+#[derive(Debug, Deserialize)]
+struct VersionKey {
+    name: String,
+    version: String,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct Edge {
+    from_node: usize,
+    to_node: usize,
+}
+
+impl DependenciesResponse {
+    /// `name@version` of the direct dependencies of the root node
+    fn direct_requires(&self) -> Vec<String> {
+        let mut requires: Vec<String> = self
+            .edges
+            .iter()
+            .filter(|edge| edge.from_node == 0)
+            .filter_map(|edge| self.nodes.get(edge.to_node))
+            .map(|node| format!("{}@{}", node.version_key.name, node.version_key.version))
+            .collect();
+        requires.sort();
+        requires.dedup();
+        requires
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct ProjectResponse {
+    #[serde(default)]
+    scorecard: Option<Scorecard>,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct Scorecard {
+    overall_score: f64,
+}
+
+/// The `[registries.sources]` key and deps.dev system of a dependency's ecosystem
+fn ecosystem(info: &LicenseInfo) -> Option<(&'static str, &'static str)> {
+    let package_type = purl_type(info.source_file.as_deref()?)?;
+    let system = purl_system(package_type)?;
+    let key = match package_type {
+        "cargo" => "crates_io",
+        "gem" => "rubygems",
+        "golang" => "go",
+        other => other,
+    };
+    Some((key, system))
+}
+
+fn version_url(system: &str, name: &str, version: &str) -> String {
+    format!(
+        "{DEPS_DEV_API_URL}/systems/{system}/packages/{}/versions/{}",
+        encode(name),
+        encode(version)
+    )
+}
+
+fn get_json<T: DeserializeOwned>(url: &str) -> Option<T> {
+    let response = match registry::get(Registry::DepsDev, url) {
+        Ok(response) if response.status().is_success() => response,
+        Ok(response) => {
+            log(
+                LogLevel::Info,
+                &format!("deps.dev returned {} for {url}", response.status()),
+            );
+            return None;
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch {url}"), &err);
+            return None;
+        }
+    };
+    response
+        .json()
+        .map_err(|err| log_error("Failed to parse the deps.dev response", &err))
+        .ok()
+}
+
+/// Look up the licenses deps.dev lists for a package version, as one expression
+fn fetch_license(system: &str, name: &str, version: &str) -> Option<String> {
+    let cache_name = format!("{system}/{name}");
+    if let Some(license) = get_cached_license("deps.dev", &cache_name, version) {
+        return Some(license);
+    }
+
+    let response: VersionResponse = get_json(&version_url(system, name, version))?;
+    let license = license_expression(&response.licenses)?;
+    cache_license("deps.dev", &cache_name, version, &license);
+    Some(license)
+}
+
+/// Join the licenses of a version, all of which apply, into one expression
+fn license_expression(licenses: &[String]) -> Option<String> {
+    let licenses: Vec<&str> = licenses
+        .iter()
+        .map(|license| license.trim())
+        .filter(|license| !license.is_empty() && *license != NON_STANDARD)
+        .collect();
+    match licenses.as_slice() {
+        [] => None,
+        [license] => Some(license.to_string()),
+        _ => Some(
+            licenses
+                .iter()
+                .map(|license| {
+                    if license.contains(' ') {
+                        format!("({license})")
+                    } else {
+                        license.to_string()
+                    }
+                })
+                .collect::<Vec<_>>()
+                .join(" AND "),
+        ),
+    }
+}
+
+/// Fill in unknown licenses from deps.dev, for ecosystems configured to fall back to it
+///
+/// `[registries] deps_dev` makes every ecosystem fall back to it. Returns the
+/// number of dependencies whose license was found.
+pub fn apply_deps_dev_fallback(dependencies: &mut [LicenseInfo], config: &FeludaConfig) -> usize {
+    let found: Vec<(usize, String)> = dependencies
+        .par_iter()
+        .enumerate()
+        .filter(|(_, info)| info.has_unknown_license() && !info.is_manually_asserted())
+        .filter_map(|(index, info)| {
+            let (ecosystem, system) = ecosystem(info)?;
+            if !config.registries.deps_dev && !registry::falls_back_to_deps_dev(ecosystem) {
+                return None;
+            }
+            let license = fetch_license(system, &info.name, &info.version)?;
+            Some((index, license))
+        })
+        .collect();
+    if found.is_empty() {
+        return 0;
+    }
+
+    let known_licenses = fetch_licenses_from_github().unwrap_or_else(|err| {
+        log_error("Failed to fetch licenses from GitHub", &err);
+        HashMap::new()
+    });
+    for (index, license) in &found {
+        let info = &mut dependencies[*index];
+        log(
+            LogLevel::Info,
+            &format!(
+                "Found license {license} for {}@{} on deps.dev",
+                info.name, info.version
+            ),
+        );
+        info.license = Some(license.clone());
+        info.license_confidence = None;
+        info.is_restrictive = is_license_restrictive(&info.license, &known_licenses, config.strict);
+        info.osi_status = get_osi_status(license);
+    }
+    found.len()
+}
+
+#[derive(Debug, Deserialize)]
+struct PackageResponse {
+    #[serde(default)]
+    versions: Vec<PackageVersion>,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct PackageVersion {
+    version_key: PackageVersionKey,
+    #[serde(default)]
+    is_default: bool,
+}
+
+#[derive(Debug, Deserialize)]
+struct PackageVersionKey {
+    version: String,
+}
+
+/// deps.dev system of a package URL type
+pub(crate) fn purl_system(package_type: &str) -> Option<&'static str> {
+    match package_type {
+        "npm" => Some("NPM"),
+        "pypi" => Some("PYPI"),
+        "maven" => Some("MAVEN"),
+        "nuget" => Some("NUGET"),
+        "cargo" => Some("CARGO"),
+        "gem" => Some("RUBYGEMS"),
+        "golang" => Some("GO"),
+        _ => None,
+    }
+}
+
+/// The version deps.dev considers current for a package, usually its latest release
+pub(crate) fn default_version(system: &str, name: &str) -> Option<String> {
+    let url = format!(
+        "{DEPS_DEV_API_URL}/systems/{system}/packages/{}",
+        encode(name)
+    );
+    let package: PackageResponse = get_json(&url)?;
+    package
+        .versions
+        .into_iter()
+        .find(|version| version.is_default)
+        .map(|version| version.version_key.version)
+}
+
+/// Direct dependencies of a version, in the resolution of deps.dev
+fn fetch_requires(system: &str, name: &str, version: &str) -> Option<Vec<String>> {
+    let url = format!("{}:dependencies", version_url(system, name, version));
+    let graph: DependenciesResponse = get_json(&url)?;
+    Some(graph.direct_requires())
+}
+
+/// OpenSSF Scorecard score of a project such as `github.com/expressjs/express`
+fn fetch_scorecard(project: &str) -> Option<f64> {
+    let url = format!("{DEPS_DEV_API_URL}/projects/{}", encode(project));
+    let response: ProjectResponse = get_json(&url)?;
+    response.scorecard.map(|scorecard| scorecard.overall_score)
+}
+
+/// Point requirements at the versions found in the same manifest, where there is one
+fn align_requires(dependencies: &mut [LicenseInfo], resolved: &[Option<Vec<String>>]) {
+    let mut versions: HashMap<(Option<&str>, &str), &str> = HashMap::new();
+    for info in dependencies.iter() {
+        versions.insert(
+            (info.source_file.as_deref(), info.name.as_str()),
+            info.version.as_str(),
+        );
+    }
+    let aligned: Vec<Option<Vec<String>>> = dependencies
+        .iter()
+        .zip(resolved)
+        .map(|(info, requires)| {
+            let requires = requires.as_ref()?;
+            Some(
+                requires
+                    .iter()
+                    .map(|required| {
+                        let name = required
+                            .rsplit_once('@')
+                            .map_or(required.as_str(), |(name, _)| name);
+                        match versions.get(&(info.source_file.as_deref(), name)) {
+                            Some(version) => format!("{name}@{version}"),
+                            None => required.clone(),
+                        }
+                    })
+                    .collect(),
+            )
+        })
+        .collect();
+
+    for (info, requires) in dependencies.iter_mut().zip(aligned) {
+        if requires.is_some() {
+            info.requires = requires;
+        }
+    }
+}
+
+/// Add requirements and OpenSSF Scorecard scores from deps.dev, for `--deps-dev`
+pub fn enrich_with_deps_dev(dependencies: &mut [LicenseInfo]) {
+    if crate::offline::is_offline() {
+        log(LogLevel::Info, "Offline, skipping the deps.dev lookup");
+        return;
+    }
+    log(
+        LogLevel::Info,
+        &format!("Looking up {} dependencies on deps.dev", dependencies.len()),
+    );
+
+    let found: Vec<(Option<Vec<String>>, Option<String>)> = dependencies
+        .par_iter()
+        .map(|info| {
+            let Some((_, system)) = ecosystem(info) else {
+                return (None, None);
+            };
+            let version: VersionResponse =
+                get_json(&version_url(system, &info.name, &info.version)).unwrap_or_default();
+            let requires = (info.requires.is_none() && GRAPH_SYSTEMS.contains(&system))
+                .then(|| fetch_requires(system, &info.name, &info.version))
+                .flatten();
+            (requires, version.source_repository().map(str::to_string))
+        })
+        .collect();
+    let (requires, projects): (Vec<_>, Vec<_>) = found.into_iter().unzip();
+    align_requires(dependencies, &requires);
+
+    let mut unique: Vec<&String> = projects.iter().flatten().collect();
+    unique.sort();
+    unique.dedup();
+    let scores: HashMap<&String, f64> = unique
+        .into_par_iter()
+        .filter_map(|project| Some((project, fetch_scorecard(project)?)))
+        .collect();
+
+    for (info, project) in dependencies.iter_mut().zip(&projects) {
+        let Some(project) = project else {
+            continue;
+        };
+        let health = info.health.get_or_insert_with(PackageHealth::default);
+        health.scorecard = scores.get(project).copied();
+        if health.repository.is_none() {
+            health.repository = Some(format!("https://{project}"));
+        }
+    }
+}
+
+/// Print the OpenSSF Scorecard scores found on deps.dev, lowest first
+pub fn print_scorecards(dependencies: &[LicenseInfo]) {
+    // One row per repository, listing the packages built from it
+    let mut repositories: BTreeMap<&str, (f64, Vec<String>)> = BTreeMap::new();
+    for info in dependencies {
+        let Some(health) = info.health.as_ref() else {
+            continue;
+        };
+        let (Some(score), Some(repository)) = (health.scorecard, health.repository.as_deref())
+        else {
+            continue;
+        };
+        repositories
+            .entry(repository)
+            .or_insert_with(|| (score, Vec::new()))
+            .1
+            .push(format!("{}@{}", info.name, info.version));
+    }
+    if repositories.is_empty() {
+        return;
+    }
+
+    let mut rows: Vec<(f64, Vec<String>)> = repositories
+        .into_iter()
+        .map(|(repository, (score, packages))| {
+            (
+                score,
+                vec![
+                    repository.to_string(),
+                    format!("{score:.1}"),
+                    packages.join(", "),
+                ],
+            )
+        })
+        .collect();
+    rows.sort_by(|a, b| a.0.total_cmp(&b.0));
+
+    println!(
+        "\n{} {}\n",
+        "🛡️".bold(),
+        format!("OpenSSF Scorecard of {} repositories", rows.len()).bold()
+    );
+    let headers = ["Repository", "Score", "Packages"];
+    let mut formatter = TableFormatter::new(headers.iter().map(|h| h.to_string()).collect());
+    for (_, row) in &rows {
+        formatter.add_row(row);
+    }
+    println!("{}", formatter.render_header());
+    for (score, row) in &rows {
+        // Scores run from 0 to 10, below 5 deserves a look
+        println!("{}", formatter.render_row(row, *score >= 5.0));
+    }
+    println!("{}\n", formatter.render_footer());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn dep(name: &str, source_file: &str) -> LicenseInfo {
+        LicenseInfo {
+            source_file: Some(source_file.to_string()),
+            ..LicenseInfo::test(name, "1.0.0", Some("Unknown"))
+        }
+    }
+
+    #[test]
+    fn test_ecosystem() {
+        assert_eq!(
+            ecosystem(&dep("golang.org/x/text", "go.mod")),
+            Some(("go", "GO"))
+        );
+        assert_eq!(
+            ecosystem(&dep("serde", "crates/core/Cargo.lock")),
+            Some(("crates_io", "CARGO"))
+        );
+        assert_eq!(
+            ecosystem(&dep("org.slf4j:slf4j-api", "pom.xml")),
+            Some(("maven", "MAVEN"))
+        );
+        assert_eq!(ecosystem(&dep("phoenix", "mix.lock")), None);
+        let mut unknown_source = dep("left-pad", "package.json");
+        unknown_source.source_file = None;
+        assert_eq!(ecosystem(&unknown_source), None);
+    }
+
+    #[test]
+    fn test_parse_version_and_graph_responses() {
+        let version: VersionResponse = serde_json::from_str(
+            r#"{
+                "versionKey": {"system": "NPM", "name": "express", "version": "4.18.2"},
+                "licenses": ["MIT"],
+                "relatedProjects": [
+                    {"projectKey": {"id": "github.com/expressjs/express.com"}, "relationType": "ISSUE_TRACKER"},
+                    {"projectKey": {"id": "github.com/expressjs/express"}, "relationType": "SOURCE_REPO"}
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(version.licenses, vec!["MIT"]);
+        assert_eq!(
+            version.source_repository(),
+            Some("github.com/expressjs/express")
+        );
+
+        let graph: DependenciesResponse = serde_json::from_str(
+            r#"{
+                "nodes": [
+                    {"versionKey": {"system": "NPM", "name": "express", "version": "4.18.2"}, "relation": "SELF"},
+                    {"versionKey": {"system": "NPM", "name": "qs", "version": "6.11.0"}, "relation": "DIRECT"},
+                    {"versionKey": {"system": "NPM", "name": "side-channel", "version": "1.0.4"}, "relation": "INDIRECT"},
+                    {"versionKey": {"system": "NPM", "name": "body-parser", "version": "1.20.1"}, "relation": "DIRECT"}
+                ],
+                "edges": [
+                    {"fromNode": 0, "toNode": 1, "requirement": "6.11.0"},
+                    {"fromNode": 1, "toNode": 2, "requirement": "^1.0.4"},
+                    {"fromNode": 0, "toNode": 3, "requirement": "1.20.1"}
+                ]
+            }"#,
+        )
+        .unwrap();
+        assert_eq!(
+            graph.direct_requires(),
+            vec!["body-parser@1.20.1", "qs@6.11.0"]
+        );
+
+        let project: ProjectResponse = serde_json::from_str(
+            r#"{"projectKey": {"id": "github.com/expressjs/express"}, "scorecard": {"date": "2024-01-01T00:00:00Z", "overallScore": 7.4, "checks": []}}"#,
+        )
+        .unwrap();
+        assert_eq!(project.scorecard.map(|s| s.overall_score), Some(7.4));
+    }
+
+    #[test]
+    fn test_align_requires() {
+        let mut deps = vec![
+            dep("express", "package-lock.json"),
+            dep("qs", "package-lock.json"),
+            dep("serde", "Cargo.lock"),
+        ];
+        deps[1].version = "6.11.2".to_string();
+        deps[2].requires = Some(vec!["serde_derive@1.0.0".to_string()]);
+        align_requires(
+            &mut deps,
+            &[
+                Some(vec![
+                    "qs@6.11.0".to_string(),
+                    "@types/node@20.1.0".to_string(),
+                ]),
+                None,
+                None,
+            ],
+        );
+        assert_eq!(
+            deps[0].requires,
+            Some(vec![
+                "qs@6.11.2".to_string(),
+                "@types/node@20.1.0".to_string()
+            ])
+        );
+        assert_eq!(deps[1].requires, None);
+        assert_eq!(
+            deps[2].requires,
+            Some(vec!["serde_derive@1.0.0".to_string()])
+        );
+    }
+
+    #[test]
+    fn test_license_expression() {
+        let licenses = |values: &[&str]| values.iter().map(|v| v.to_string()).collect::<Vec<_>>();
+        assert_eq!(license_expression(&licenses(&[])), None);
+        assert_eq!(license_expression(&licenses(&["non-standard"])), None);
+        assert_eq!(
+            license_expression(&licenses(&["MIT", "non-standard"])),
+            Some("MIT".to_string())
+        );
+        assert_eq!(
+            license_expression(&licenses(&["Apache-2.0 OR MIT", "BSD-3-Clause"])),
+            Some("(Apache-2.0 OR MIT) AND BSD-3-Clause".to_string())
+        );
+    }
+}
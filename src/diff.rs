@@ -0,0 +1,526 @@
+//! Comparing two scans (`feluda diff`)
+//!
+//! Dependencies are matched by name, so a version bump that keeps the license
+//! is not reported, while one that changes it is. Checks can then fail only on
+//! restrictive or incompatible licenses a change introduces, leaving existing
+//! ones to be dealt with separately.
+//!
+//! A license change that comes with a new version is a relicensing by the
+//! upstream project, e.g. a release moving from Apache-2.0 to BUSL-1.1. Those
+//! are flagged separately from changes in detection for the same version, so an
+//! upgrade that quietly relicenses a dependency doesn't go unnoticed.
+
+use colored::*;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use tempfile::TempDir;
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::{LicenseCompatibility, LicenseInfo, OsiStatus};
+use crate::reporter::TableFormatter;
+
+/// Why the license of a dependency changed between two scans
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum ChangeKind {
+    /// A different version of the dependency is published under another license
+    Relicensed,
+    /// The same version is reported with another license, e.g. after an override
+    Redetected,
+}
+
+/// A dependency present in both scans whose license changed
+#[derive(Debug, Clone, Serialize)]
+pub struct LicenseChange {
+    pub old: LicenseInfo,
+    pub new: LicenseInfo,
+    pub kind: ChangeKind,
+    /// Whether the new license is restrictive, incompatible, unknown or not OSI
+    /// approved where the old one wasn't
+    pub riskier: bool,
+}
+
+impl LicenseChange {
+    pub fn new(old: LicenseInfo, new: LicenseInfo) -> Self {
+        let kind = if old.version == new.version {
+            ChangeKind::Redetected
+        } else {
+            ChangeKind::Relicensed
+        };
+        let incompatible =
+            |info: &LicenseInfo| info.compatibility == LicenseCompatibility::Incompatible;
+        let approved = |info: &LicenseInfo| info.osi_status == OsiStatus::Approved;
+        let riskier = (new.is_restrictive && !old.is_restrictive)
+            || (incompatible(&new) && !incompatible(&old))
+            || (new.has_unknown_license() && !old.has_unknown_license())
+            || (approved(&old) && !approved(&new));
+
+        Self {
+            old,
+            new,
+            kind,
+            riskier,
+        }
+    }
+}
+
+/// Differences between an earlier and a later scan
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct ScanDiff {
+    pub added: Vec<LicenseInfo>,
+    pub removed: Vec<LicenseInfo>,
+    pub changed: Vec<LicenseChange>,
+}
+
+impl ScanDiff {
+    pub fn is_empty(&self) -> bool {
+        self.added.is_empty() && self.removed.is_empty() && self.changed.is_empty()
+    }
+
+    /// Restrictive licenses that were not there before
+    ///
+    /// A license change only counts when the previous license was not
+    /// restrictive already.
+    pub fn new_restrictive(&self) -> Vec<&LicenseInfo> {
+        self.added
+            .iter()
+            .filter(|info| info.is_restrictive)
+            .chain(
+                self.changed
+                    .iter()
+                    .filter(|c| c.new.is_restrictive && !c.old.is_restrictive)
+                    .map(|c| &c.new),
+            )
+            .collect()
+    }
+
+    /// Incompatible licenses that were not there before
+    pub fn new_incompatible(&self) -> Vec<&LicenseInfo> {
+        let incompatible =
+            |info: &LicenseInfo| info.compatibility == LicenseCompatibility::Incompatible;
+        self.added
+            .iter()
+            .filter(|info| incompatible(info))
+            .chain(
+                self.changed
+                    .iter()
+                    .filter(|c| incompatible(&c.new) && !incompatible(&c.old))
+                    .map(|c| &c.new),
+            )
+            .collect()
+    }
+
+    /// Dependencies whose new version is published under another license
+    pub fn relicensed(&self) -> Vec<&LicenseChange> {
+        self.changed
+            .iter()
+            .filter(|change| change.kind == ChangeKind::Relicensed)
+            .collect()
+    }
+}
+
+/// Compare the dependencies of two scans
+pub fn diff_dependencies(old: &[LicenseInfo], new: &[LicenseInfo]) -> ScanDiff {
+    let by_name = |deps: &'_ [LicenseInfo]| {
+        let mut map: BTreeMap<String, Vec<LicenseInfo>> = BTreeMap::new();
+        for dep in deps {
+            map.entry(dep.name.clone()).or_default().push(dep.clone());
+        }
+        map
+    };
+    let mut old_by_name = by_name(old);
+    let new_by_name = by_name(new);
+
+    let mut diff = ScanDiff::default();
+    for (name, new_entries) in new_by_name {
+        let Some(old_entries) = old_by_name.remove(&name) else {
+            diff.added.extend(new_entries);
+            continue;
+        };
+
+        for entry in new_entries {
+            if old_entries.iter().any(|old| old.license == entry.license) {
+                continue;
+            }
+            let old = old_entries
+                .iter()
+                .find(|old| old.version == entry.version)
+                .unwrap_or(&old_entries[0]);
+            diff.changed.push(LicenseChange::new(old.clone(), entry));
+        }
+    }
+    diff.removed = old_by_name.into_values().flatten().collect();
+
+    diff
+}
+
+/// Report files accepted by `feluda diff`
+#[derive(Deserialize)]
+#[serde(untagged)]
+enum ReportFile {
+    /// `feluda --json` or `--yaml` output
+    Dependencies(Vec<LicenseInfo>),
+    /// A library or `feluda serve` report
+    Report { dependencies: Vec<LicenseInfo> },
+}
+
+/// The dependencies of a report file and the project it describes
+#[derive(Debug, Clone)]
+pub struct LoadedReport {
+    /// Project name recorded in the report, or the file name without extension
+    pub project: String,
+    pub dependencies: Vec<LicenseInfo>,
+}
+
+/// Load a report written by an earlier scan
+///
+/// Accepts `--json`, `--yaml` and `--format json` output as well as library
+/// and `feluda serve` reports.
+pub fn load_report_file(path: &Path) -> FeludaResult<LoadedReport> {
+    log(
+        LogLevel::Info,
+        &format!("Loading report: {}", path.display()),
+    );
+    let content = fs::read_to_string(path).map_err(|e| {
+        FeludaError::InvalidData(format!("Failed to read report {}: {e}", path.display()))
+    })?;
+    let parse_error = |e: String| {
+        FeludaError::InvalidData(format!("Failed to parse report {}: {e}", path.display()))
+    };
+
+    let is_yaml = matches!(
+        path.extension().and_then(|ext| ext.to_str()),
+        Some("yaml" | "yml")
+    );
+    let project = path
+        .file_stem()
+        .map(|stem| stem.to_string_lossy().to_string())
+        .unwrap_or_default();
+
+    if !is_yaml && content.contains("\"schema_version\"") {
+        let (project, dependencies) =
+            crate::report_json::parse_report_v2(&content).map_err(parse_error)?;
+        return Ok(LoadedReport {
+            project,
+            dependencies,
+        });
+    }
+
+    let report: ReportFile = if is_yaml {
+        serde_yaml::from_str(&content).map_err(|e| e.to_string())
+    } else {
+        serde_json::from_str(&content).map_err(|e| e.to_string())
+    }
+    .map_err(parse_error)?;
+
+    let dependencies = match report {
+        ReportFile::Dependencies(dependencies) | ReportFile::Report { dependencies } => {
+            dependencies
+        }
+    };
+    Ok(LoadedReport {
+        project,
+        dependencies,
+    })
+}
+
+/// Load the dependencies from a report written by an earlier scan
+pub fn load_report(path: &Path) -> FeludaResult<Vec<LicenseInfo>> {
+    load_report_file(path).map(|report| report.dependencies)
+}
+
+/// Check out `git_ref` of the repository containing `path` into a temporary directory
+///
+/// Returns the directory together with the location of `path` inside it. The
+/// repository's working tree, index and HEAD are left untouched.
+pub fn checkout_ref(path: &Path, git_ref: &str) -> FeludaResult<(TempDir, PathBuf)> {
+    let git_error =
+        |e: git2::Error| FeludaError::InvalidData(format!("Failed to check out {git_ref}: {e}"));
+
+    let repo = git2::Repository::discover(path).map_err(git_error)?;
+    let workdir = repo.workdir().ok_or_else(|| {
+        FeludaError::InvalidData("Cannot compare against a git ref in a bare repository".into())
+    })?;
+    let relative = path
+        .canonicalize()?
+        .strip_prefix(workdir.canonicalize()?)
+        .map(Path::to_path_buf)
+        .unwrap_or_default();
+
+    let temp_dir = TempDir::new()
+        .map_err(|e| FeludaError::TempDir(format!("Failed to create temporary directory: {e}")))?;
+    let tree = repo
+        .revparse_single(git_ref)
+        .and_then(|object| object.peel_to_tree())
+        .map_err(git_error)?;
+
+    let mut checkout = git2::build::CheckoutBuilder::new();
+    checkout
+        .target_dir(temp_dir.path())
+        .force()
+        .update_index(false);
+    repo.checkout_tree(tree.as_object(), Some(&mut checkout))
+        .map_err(git_error)?;
+
+    log(
+        LogLevel::Info,
+        &format!("Checked out {git_ref} to {}", temp_dir.path().display()),
+    );
+    let project_dir = temp_dir.path().join(relative);
+    Ok((temp_dir, project_dir))
+}
+
+/// Print the differences as tables
+pub fn print_diff(diff: &ScanDiff) {
+    println!(
+        "\n{} {} added, {} removed, {} license changes\n",
+        "Dependency changes:".bold(),
+        diff.added.len(),
+        diff.removed.len(),
+        diff.changed.len()
+    );
+
+    if diff.is_empty() {
+        println!("{}\n", "✅ No dependency or license changes".green().bold());
+        return;
+    }
+
+    let is_problem = |info: &LicenseInfo| {
+        info.is_restrictive || info.compatibility == LicenseCompatibility::Incompatible
+    };
+
+    if !diff.added.is_empty() {
+        let rows: Vec<_> = diff
+            .added
+            .iter()
+            .map(|info| {
+                (
+                    vec![info.name.clone(), info.version.clone(), info.get_license()],
+                    is_problem(info),
+                )
+            })
+            .collect();
+        print_table("Added", &["Package", "Version", "License"], &rows);
+    }
+
+    if !diff.removed.is_empty() {
+        let rows: Vec<_> = diff
+            .removed
+            .iter()
+            .map(|info| {
+                (
+                    vec![info.name.clone(), info.version.clone(), info.get_license()],
+                    false,
+                )
+            })
+            .collect();
+        print_table("Removed", &["Package", "Version", "License"], &rows);
+    }
+
+    if !diff.changed.is_empty() {
+        let rows: Vec<_> = diff
+            .changed
+            .iter()
+            .map(|change| {
+                let kind = match change.kind {
+                    ChangeKind::Relicensed => "relicensed",
+                    ChangeKind::Redetected => "same version",
+                };
+                (
+                    vec![
+                        change.new.name.clone(),
+                        format!("{} ({})", change.old.get_license(), change.old.version),
+                        format!("{} ({})", change.new.get_license(), change.new.version),
+                        kind.to_string(),
+                    ],
+                    change.riskier || is_problem(&change.new),
+                )
+            })
+            .collect();
+        print_table(
+            "License changes",
+            &["Package", "Before", "After", "Change"],
+            &rows,
+        );
+    }
+
+    for change in diff.relicensed().into_iter().filter(|c| c.riskier) {
+        println!(
+            "{} {}",
+            "⚠️".bold(),
+            format!(
+                "{} was relicensed from {} to {} in {} (was {})",
+                change.new.name,
+                change.old.get_license(),
+                change.new.get_license(),
+                change.new.version,
+                change.old.version
+            )
+            .yellow()
+            .bold()
+        );
+    }
+
+    let restrictive = diff.new_restrictive().len();
+    let incompatible = diff.new_incompatible().len();
+    if restrictive == 0 && incompatible == 0 {
+        println!(
+            "{}\n",
+            "✅ No new restrictive or incompatible licenses"
+                .green()
+                .bold()
+        );
+    } else {
+        println!(
+            "{} {}\n",
+            "⚠️".bold(),
+            format!("Newly introduced: {restrictive} restrictive, {incompatible} incompatible")
+                .yellow()
+                .bold()
+        );
+    }
+}
+
+/// Print a titled table, highlighting the rows marked as problems
+pub(crate) fn print_table(title: &str, headers: &[&str], rows: &[(Vec<String>, bool)]) {
+    println!("{}", title.bold());
+
+    let mut formatter = TableFormatter::new(headers.iter().map(|h| h.to_string()).collect());
+    for (row, _) in rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+    for (row, is_problem) in rows {
+        println!("{}", formatter.render_row(row, *is_problem));
+    }
+    println!("{}\n", formatter.render_footer());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn dep(name: &str, version: &str, license: &str, is_restrictive: bool) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            ..LicenseInfo::test(name, version, Some(license))
+        }
+    }
+
+    #[test]
+    fn test_diff_dependencies() {
+        let old = vec![
+            dep("serde", "1.0.0", "MIT", false),
+            dep("legacy", "0.1.0", "GPL-3.0", true),
+            dep("relicensed", "1.0.0", "MIT", false),
+            dep("gone", "2.0.0", "MIT", false),
+        ];
+        let new = vec![
+            dep("serde", "1.0.1", "MIT", false),
+            dep("legacy", "0.1.0", "GPL-3.0", true),
+            dep("relicensed", "2.0.0", "AGPL-3.0", true),
+            dep("fresh", "0.3.0", "LGPL-3.0", true),
+        ];
+
+        let diff = diff_dependencies(&old, &new);
+        let names = |deps: &[LicenseInfo]| deps.iter().map(|d| d.name.clone()).collect::<Vec<_>>();
+        assert_eq!(names(&diff.added), vec!["fresh"]);
+        assert_eq!(names(&diff.removed), vec!["gone"]);
+        assert_eq!(diff.changed.len(), 1);
+        assert_eq!(diff.changed[0].old.license.as_deref(), Some("MIT"));
+        assert_eq!(diff.changed[0].new.version, "2.0.0");
+
+        // "legacy" was restrictive before and is not reported
+        let restrictive: Vec<_> = diff
+            .new_restrictive()
+            .iter()
+            .map(|d| d.name.as_str())
+            .collect();
+        assert_eq!(restrictive, vec!["fresh", "relicensed"]);
+        assert!(diff.new_incompatible().is_empty());
+
+        assert!(diff_dependencies(&new, &new).is_empty());
+    }
+
+    #[test]
+    fn test_relicensed_dependencies() {
+        let mut busl = dep("vault-sdk", "1.15.0", "BUSL-1.1", false);
+        busl.osi_status = OsiStatus::NotApproved;
+        let old = vec![
+            dep("vault-sdk", "1.14.0", "MPL-2.0", false),
+            dep("overridden", "1.0.0", "NOASSERTION", false),
+            dep("loosened", "1.0.0", "GPL-3.0", true),
+        ];
+        let new = vec![
+            busl,
+            dep("overridden", "1.0.0", "MIT", false),
+            dep("loosened", "2.0.0", "MIT", false),
+        ];
+
+        let diff = diff_dependencies(&old, &new);
+        assert_eq!(diff.changed.len(), 3);
+
+        let vault = &diff.changed[2];
+        assert_eq!(vault.new.name, "vault-sdk");
+        assert_eq!(vault.kind, ChangeKind::Relicensed);
+        assert!(vault.riskier);
+
+        let overridden = &diff.changed[1];
+        assert_eq!(overridden.kind, ChangeKind::Redetected);
+        assert!(!overridden.riskier);
+
+        let loosened = &diff.changed[0];
+        assert_eq!(loosened.kind, ChangeKind::Relicensed);
+        assert!(!loosened.riskier);
+
+        let relicensed: Vec<_> = diff
+            .relicensed()
+            .iter()
+            .map(|c| c.new.name.as_str())
+            .collect();
+        assert_eq!(relicensed, vec!["loosened", "vault-sdk"]);
+
+        let json = serde_json::to_value(&diff).unwrap();
+        assert_eq!(json["changed"][2]["kind"], "relicensed");
+        assert_eq!(json["changed"][2]["riskier"], true);
+    }
+
+    #[test]
+    fn test_load_report_formats() {
+        let temp_dir = TempDir::new().unwrap();
+        let deps = vec![dep("serde", "1.0.0", "MIT", false)];
+
+        let array = temp_dir.path().join("report.json");
+        fs::write(&array, serde_json::to_string(&deps).unwrap()).unwrap();
+        assert_eq!(load_report(&array).unwrap()[0].name, "serde");
+
+        let object = temp_dir.path().join("server.json");
+        fs::write(
+            &object,
+            serde_json::json!({ "project_license": "MIT", "dependencies": deps }).to_string(),
+        )
+        .unwrap();
+        assert_eq!(load_report(&object).unwrap().len(), 1);
+
+        let versioned = temp_dir.path().join("versioned.json");
+        fs::write(
+            &versioned,
+            crate::report_json::render_json_report(2, "/src/api", &deps, None, &[]).unwrap(),
+        )
+        .unwrap();
+        let report = load_report_file(&versioned).unwrap();
+        assert_eq!(report.project, "api");
+        assert_eq!(report.dependencies[0].name, "serde");
+        assert_eq!(load_report_file(&object).unwrap().project, "server");
+
+        let invalid = temp_dir.path().join("invalid.json");
+        fs::write(&invalid, "{\"name\": \"serde\"}").unwrap();
+        assert!(load_report(&invalid).is_err());
+    }
+}
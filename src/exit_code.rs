@@ -0,0 +1,173 @@
+//! Exit codes of a scan
+//!
+//! | Code | Meaning |
+//! |------|---------|
+//! | 0 | No failing findings, or no more than `--max-violations` |
+//! | 1 | Policy violations, or restrictive, incompatible or vulnerable dependencies selected with `--fail-on` |
+//! | 2 | Only dependencies without a known license, with `--fail-on unknown` |
+//! | 3 | The scan itself failed |
+//! | 130 | The scan was interrupted with Ctrl-C, the report is partial |
+//!
+//! Exit codes of `[risk]` tiers take precedence over these.
+
+use crate::baseline::{Baseline, BaselineKind};
+use crate::cli::FailOn;
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::policy::PolicyViolation;
+
+pub const EXIT_CLEAN: i32 = 0;
+pub const EXIT_VIOLATIONS: i32 = 1;
+pub const EXIT_UNKNOWN_LICENSES: i32 = 2;
+pub const EXIT_SCAN_ERROR: i32 = 3;
+pub const EXIT_INTERRUPTED: i32 = 130;
+
+/// Number of dependencies with each kind of finding
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct Findings {
+    pub restrictive: usize,
+    pub incompatible: usize,
+    pub unknown: usize,
+    pub vulnerable: usize,
+    pub policy: usize,
+}
+
+impl Findings {
+    /// Count the findings of a scan, leaving out those accepted in `baseline`
+    pub fn collect(
+        dependencies: &[LicenseInfo],
+        policy_violations: &[PolicyViolation],
+        baseline: Option<&Baseline>,
+    ) -> Self {
+        let accepted = |info: &LicenseInfo, kind| {
+            baseline.is_some_and(|baseline| {
+                baseline.suppresses(&info.name, info.license.as_deref(), kind)
+            })
+        };
+        let count = |matches: &dyn Fn(&LicenseInfo) -> bool| {
+            dependencies.iter().filter(|info| matches(info)).count()
+        };
+
+        Self {
+            restrictive: count(&|info| {
+                info.is_restrictive && !accepted(info, BaselineKind::Restrictive)
+            }),
+            incompatible: count(&|info| {
+                info.compatibility == LicenseCompatibility::Incompatible
+                    && !accepted(info, BaselineKind::Incompatible)
+            }),
+            unknown: count(&|info| info.has_unknown_license()),
+            vulnerable: count(&|info| info.vulnerabilities.as_ref().is_some_and(|v| !v.is_empty())),
+            policy: policy_violations.len(),
+        }
+    }
+}
+
+/// When a scan fails, from `--fail-on`, the `--fail-on-*` flags and `--max-violations`
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct FailureThreshold {
+    pub fail_on: Vec<FailOn>,
+    /// Failing findings tolerated before the scan fails
+    pub max_violations: usize,
+}
+
+impl FailureThreshold {
+    /// Exit code for the findings of a scan
+    ///
+    /// Policy violations always count. When both violations and unknown
+    /// licenses are over the threshold, the violations decide the code.
+    pub fn exit_code(&self, findings: &Findings) -> i32 {
+        let selected = |kind: FailOn, count: usize| {
+            if self.fail_on.contains(&kind) {
+                count
+            } else {
+                0
+            }
+        };
+        let violations = findings.policy
+            + selected(FailOn::Restrictive, findings.restrictive)
+            + selected(FailOn::Incompatible, findings.incompatible)
+            + selected(FailOn::Vulns, findings.vulnerable);
+        let unknown = selected(FailOn::Unknown, findings.unknown);
+
+        if violations + unknown <= self.max_violations {
+            EXIT_CLEAN
+        } else if violations > 0 {
+            EXIT_VIOLATIONS
+        } else {
+            EXIT_UNKNOWN_LICENSES
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn dep(name: &str, license: Option<&str>, restrictive: bool) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            ..LicenseInfo::test(name, "1.0.0", license)
+        }
+    }
+
+    #[test]
+    fn test_collect_findings() {
+        let deps = vec![
+            dep("readline", Some("GPL-3.0"), true),
+            dep("mystery", None, false),
+            dep("lookup-failed", Some("Unknown (registry error)"), false),
+            dep("serde", Some("MIT"), false),
+        ];
+        let findings = Findings::collect(&deps, &[], None);
+        assert_eq!(findings.restrictive, 1);
+        assert_eq!(findings.unknown, 2);
+        assert_eq!(findings.policy, 0);
+    }
+
+    #[test]
+    fn test_exit_codes() {
+        let threshold = |fail_on: &[FailOn], max_violations| FailureThreshold {
+            fail_on: fail_on.to_vec(),
+            max_violations,
+        };
+        let findings = Findings {
+            restrictive: 2,
+            unknown: 1,
+            ..Findings::default()
+        };
+
+        // Findings only fail the scan when selected
+        assert_eq!(threshold(&[], 0).exit_code(&findings), EXIT_CLEAN);
+        assert_eq!(
+            threshold(&[FailOn::Restrictive], 0).exit_code(&findings),
+            EXIT_VIOLATIONS
+        );
+        assert_eq!(
+            threshold(&[FailOn::Unknown], 0).exit_code(&findings),
+            EXIT_UNKNOWN_LICENSES
+        );
+        assert_eq!(
+            threshold(&[FailOn::Restrictive, FailOn::Unknown], 0).exit_code(&findings),
+            EXIT_VIOLATIONS
+        );
+
+        // --max-violations tolerates up to N findings
+        assert_eq!(
+            threshold(&[FailOn::Restrictive, FailOn::Unknown], 3).exit_code(&findings),
+            EXIT_CLEAN
+        );
+        assert_eq!(
+            threshold(&[FailOn::Restrictive, FailOn::Unknown], 2).exit_code(&findings),
+            EXIT_VIOLATIONS
+        );
+
+        // Policy violations always count
+        let policy = Findings {
+            policy: 1,
+            ..Findings::default()
+        };
+        assert_eq!(threshold(&[], 0).exit_code(&policy), EXIT_VIOLATIONS);
+        assert_eq!(threshold(&[], 1).exit_code(&policy), EXIT_CLEAN);
+    }
+}
@@ -1,7 +1,10 @@
 use crate::cli::with_spinner;
-use crate::debug::{log, log_debug, LogLevel};
+use crate::config::{load_config, FeludaConfig};
+use crate::copyright::attach_copyrights;
+use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::license_text::expression_license_text;
 use crate::licenses::{
-    detect_project_license, is_license_compatible, LicenseCompatibility, LicenseInfo,
+    detect_project_license, is_license_compatible_with_overrides, LicenseCompatibility, LicenseInfo,
 };
 use crate::parser::parse_root;
 use colored::*;
@@ -470,6 +473,9 @@ fn generate_notice_content(license_data: &[LicenseInfo]) -> String {
 
         for dep in sorted_deps {
             content.push_str(&format!("* {} ({})\n", dep.name, dep.version));
+            for line in dep.copyright.iter().flatten() {
+                content.push_str(&format!("  {line}\n"));
+            }
         }
         content.push('\n');
     }
@@ -585,13 +591,18 @@ pub fn generate_third_party_licenses_file(license_data: &[LicenseInfo], path: &s
     }
 }
 
-/// HTTP client for API requests
+/// HTTP client for API requests, `None` in offline mode
 fn create_http_client() -> Option<Client> {
-    Client::builder()
+    if crate::offline::is_offline() {
+        return None;
+    }
+    let mut builder = Client::builder()
         .user_agent("feluda-license-checker/1.0")
-        .timeout(Duration::from_secs(10))
-        .build()
-        .ok()
+        .timeout(crate::registry::request_timeout());
+    if let Some(proxy) = crate::registry::configured_proxy() {
+        builder = builder.proxy(proxy);
+    }
+    builder.build().ok()
 }
 
 /// Rate limit delay to avoid hitting API limits
@@ -600,7 +611,7 @@ fn rate_limit_delay() {
 }
 
 /// Fetch the actual license content for a dependency
-fn fetch_actual_license_content(name: &str, version: &str) -> Option<String> {
+pub fn fetch_actual_license_content(name: &str, version: &str) -> Option<String> {
     log(
         LogLevel::Info,
         &format!("Attempting to fetch actual license content for {name} v{version}"),
@@ -1010,24 +1021,31 @@ fn generate_third_party_licenses_content(
                     ),
                 );
 
-                match dep.get_license().as_str() {
-                    "MIT" => {
+                let standard_text = dep.license.as_deref().and_then(expression_license_text);
+                match (dep.get_license().as_str(), standard_text) {
+                    (license, Some(text)) => {
+                        content.push_str(&format!("*Note: Could not fetch actual license text. Below is the standard {license} text from the SPDX License List:*\n\n"));
+                        content.push_str("```\n");
+                        content.push_str(&text);
+                        content.push_str("\n```\n");
+                    }
+                    ("MIT", None) => {
                         content.push_str("*Note: Could not fetch actual license text. Below is the standard MIT license template:*\n\n");
                         content.push_str(get_mit_license_text(&dep.name));
                     }
-                    "Apache-2.0" => {
+                    ("Apache-2.0", None) => {
                         content.push_str("*Note: Could not fetch actual license text. Below is the standard Apache 2.0 license template:*\n\n");
                         content.push_str(get_apache_license_text());
                     }
-                    "BSD-3-Clause" => {
+                    ("BSD-3-Clause", None) => {
                         content.push_str("*Note: Could not fetch actual license text. Below is the standard BSD 3-Clause license template:*\n\n");
                         content.push_str(get_bsd_license_text(&dep.name));
                     }
-                    license if license.contains("MIT") => {
+                    (license, None) if license.contains("MIT") => {
                         content.push_str("*Note: Could not fetch actual license text. Below is the standard MIT license template:*\n\n");
                         content.push_str(get_mit_license_text(&dep.name));
                     }
-                    license if license.contains("Apache") => {
+                    (license, None) if license.contains("Apache") => {
                         content.push_str("*Note: Could not fetch actual license text. Below is the standard Apache 2.0 license template:*\n\n");
                         content.push_str(get_apache_license_text());
                     }
@@ -1128,7 +1146,7 @@ fn generate_third_party_licenses_content(
 }
 
 /// Generate package repository URL
-fn generate_package_url(name: &str, version: &str) -> Option<String> {
+pub fn generate_package_url(name: &str, version: &str) -> Option<String> {
     if name.is_empty() {
         return None;
     }
@@ -1291,10 +1309,17 @@ pub fn handle_generate_command(
         &format!("Parsing dependencies for generate command in path: {path}"),
     );
 
-    // Import necessary modules for dependency parsing and license detection
-    let mut resolved_project_license = project_license;
+    let config = match load_config() {
+        Ok(config) => config,
+        Err(e) => {
+            log_error("Failed to load configuration, using defaults", &e);
+            FeludaConfig::default()
+        }
+    };
+
+    // Fall back to the license declared in the configuration, then to detection
+    let mut resolved_project_license = project_license.or_else(|| config.project.license.clone());
 
-    // If no project license is provided via CLI, try to detect it
     match resolved_project_license {
         Some(ref license) => {
             log(
@@ -1352,7 +1377,12 @@ pub fn handle_generate_command(
 
         for info in &mut analyzed_data {
             if let Some(ref dep_license) = info.license {
-                info.compatibility = is_license_compatible(dep_license, proj_license, false);
+                info.compatibility = is_license_compatible_with_overrides(
+                    dep_license,
+                    proj_license,
+                    false,
+                    &config.compatibility,
+                );
             } else {
                 info.compatibility = LicenseCompatibility::Unknown;
             }
@@ -1387,6 +1417,7 @@ pub fn handle_generate_command(
 
     match show_interactive_menu(&path) {
         Some(GenerateOption::Notice) => {
+            attach_copyrights(Path::new(&path), &mut analyzed_data);
             generate_notice_file(&analyzed_data, &path);
         }
         Some(GenerateOption::ThirdPartyLicenses) => {
@@ -1407,20 +1438,14 @@ mod tests {
     fn get_test_license_data() -> Vec<LicenseInfo> {
         vec![
             LicenseInfo {
-                name: "serde".to_string(),
-                version: "1.0.151".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("serde", "1.0.151", Some("MIT"))
             },
             LicenseInfo {
-                name: "tokio".to_string(),
-                version: "1.0.2".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("tokio", "1.0.2", Some("MIT"))
             },
         ]
     }
@@ -1652,28 +1677,19 @@ mod tests {
     fn test_generate_notice_content() {
         let test_data = vec![
             LicenseInfo {
-                name: "package1".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package1", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "package2".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package2", "2.0.0", Some("Apache-2.0"))
             },
             LicenseInfo {
-                name: "package3".to_string(),
-                version: "1.5.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package3", "1.5.0", Some("MIT"))
             },
         ];
 
@@ -1701,6 +1717,19 @@ mod tests {
         assert!(content.contains("3 third-party dependencies"));
     }
 
+    #[test]
+    fn test_generate_notice_content_includes_copyright() {
+        let mut test_data = get_test_license_data();
+        test_data[0].copyright = Some(vec!["Copyright (c) 2019 Jane Doe".to_string()]);
+
+        let content = generate_notice_content(&test_data);
+        let entry = format!(
+            "* {} ({})\n  Copyright (c) 2019 Jane Doe\n",
+            test_data[0].name, test_data[0].version
+        );
+        assert!(content.contains(&entry));
+    }
+
     #[test]
     fn test_generate_notice_content_empty() {
         let test_data = vec![];
@@ -1714,12 +1743,8 @@ mod tests {
     #[test]
     fn test_generate_notice_content_no_license() {
         let test_data = vec![LicenseInfo {
-            name: "unknown_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: None,
             is_restrictive: true,
-            compatibility: LicenseCompatibility::Unknown,
-            osi_status: crate::licenses::OsiStatus::Unknown,
+            ..LicenseInfo::test("unknown_package", "1.0.0", None)
         }];
 
         let content = generate_notice_content(&test_data);
@@ -1753,12 +1778,9 @@ mod tests {
         let path = temp_dir.path().to_str().unwrap();
 
         let license_data = vec![LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         }];
 
         generate_notice_file(&license_data, path);
@@ -1784,12 +1806,9 @@ mod tests {
         std::fs::write(&notice_path, "Old notice content").unwrap();
 
         let license_data = vec![LicenseInfo {
-            name: "new_package".to_string(),
-            version: "2.0.0".to_string(),
-            license: Some("Apache-2.0".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("new_package", "2.0.0", Some("Apache-2.0"))
         }];
 
         generate_notice_file(&license_data, path);
@@ -1807,12 +1826,9 @@ mod tests {
         let path = temp_dir.path().to_str().unwrap();
 
         let license_data = vec![LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         }];
 
         generate_third_party_licenses_file(&license_data, path);
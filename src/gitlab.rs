@@ -0,0 +1,186 @@
+//! GitLab license scanning report
+//!
+//! Writes the `gl-license-scanning-report.json` format (version 2.1) read by the
+//! license compliance widget of merge requests when the file is declared as an
+//! `artifacts:reports:license_scanning` artifact. Every dependency lists the
+//! licenses of its declared expression, e.g. `MIT OR Apache-2.0` becomes `MIT` and
+//! `Apache-2.0`, so GitLab can match them against its license approval policies.
+
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::path::Path;
+
+use crate::license_expression::LicenseExpression;
+use crate::licenses::LicenseInfo;
+
+const REPORT_VERSION: &str = "2.1";
+
+/// License id used by GitLab for dependencies without a detected license
+const UNKNOWN_LICENSE: &str = "unknown";
+
+#[derive(Serialize, Debug)]
+pub struct LicenseScanningReport {
+    pub version: String,
+    pub licenses: Vec<ReportLicense>,
+    pub dependencies: Vec<ReportDependency>,
+}
+
+#[derive(Serialize, Debug, PartialEq)]
+pub struct ReportLicense {
+    pub id: String,
+    pub name: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub url: Option<String>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ReportDependency {
+    pub name: String,
+    pub version: String,
+    pub package_manager: String,
+    pub path: String,
+    pub licenses: Vec<String>,
+}
+
+/// Build the report from analyzed dependencies
+pub fn build_license_scanning_report(license_info: &[LicenseInfo]) -> LicenseScanningReport {
+    let mut licenses = BTreeMap::new();
+    let dependencies = license_info
+        .iter()
+        .map(|info| {
+            let ids = license_ids(info);
+            for id in &ids {
+                licenses
+                    .entry(id.clone())
+                    .or_insert_with(|| report_license(id));
+            }
+            let path = info.source_file.clone().unwrap_or_default();
+            ReportDependency {
+                name: info.name.clone(),
+                version: info.version.clone(),
+                package_manager: package_manager(&path).to_string(),
+                path,
+                licenses: ids,
+            }
+        })
+        .collect();
+
+    LicenseScanningReport {
+        version: REPORT_VERSION.to_string(),
+        licenses: licenses.into_values().collect(),
+        dependencies,
+    }
+}
+
+/// The licenses of a dependency's expression, or the license as declared when it isn't one
+fn license_ids(info: &LicenseInfo) -> Vec<String> {
+    if info.has_unknown_license() {
+        return vec![UNKNOWN_LICENSE.to_string()];
+    }
+    let license = info.get_license();
+    let Ok(expression) = LicenseExpression::parse(&license) else {
+        return vec![license];
+    };
+    let mut ids: Vec<String> = Vec::new();
+    for term in expression.terms() {
+        let id = term.to_string();
+        if !ids.contains(&id) {
+            ids.push(id);
+        }
+    }
+    ids
+}
+
+fn report_license(id: &str) -> ReportLicense {
+    // Only plain SPDX identifiers have a page on the SPDX license list
+    let is_spdx_id = id != UNKNOWN_LICENSE
+        && !id.starts_with("LicenseRef-")
+        && id
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '.' | '+'));
+    ReportLicense {
+        id: id.to_string(),
+        name: id.to_string(),
+        url: is_spdx_id.then(|| format!("https://spdx.org/licenses/{id}.html")),
+    }
+}
+
+/// Package manager of the manifest a dependency was found in, as named by GitLab
+fn package_manager(source_file: &str) -> &'static str {
+    let file_name = Path::new(source_file)
+        .file_name()
+        .and_then(|name| name.to_str())
+        .unwrap_or_default();
+    match file_name {
+        "Cargo.toml" | "Cargo.lock" => "cargo",
+        "package.json" | "package-lock.json" => "npm",
+        "yarn.lock" => "yarn",
+        "pnpm-lock.yaml" => "pnpm",
+        "go.mod" | "go.sum" | "modules.txt" => "go",
+        "requirements.txt" | "pip_freeze.txt" | "pyproject.toml" => "pip",
+        "Pipfile.lock" => "pipenv",
+        "poetry.lock" => "poetry",
+        "pom.xml" => "maven",
+        "gradle.lockfile"
+        | "build.gradle"
+        | "build.gradle.kts"
+        | "settings.gradle"
+        | "settings.gradle.kts" => "gradle",
+        "Gemfile.lock" => "bundler",
+        "composer.lock" | "composer.json" | "installed.json" => "composer",
+        "conanfile.txt" | "conanfile.py" | "conan.lock" => "conan",
+        "pubspec.lock" => "pub",
+        "mix.lock" => "hex",
+        "DESCRIPTION" | "renv.lock" => "cran",
+        "paket.lock" | "packages.lock.json" => "nuget",
+        _ if file_name.ends_with("proj") || file_name.ends_with(".slnx") => "nuget",
+        _ => "unknown",
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::{LicenseCompatibility, OsiStatus};
+
+    fn dep(name: &str, license: Option<&str>, source_file: &str) -> LicenseInfo {
+        LicenseInfo {
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            source_file: Some(source_file.to_string()),
+            ..LicenseInfo::test(name, "1.0.0", license)
+        }
+    }
+
+    #[test]
+    fn test_build_license_scanning_report() {
+        let data = vec![
+            dep("serde", Some("MIT OR Apache-2.0"), "Cargo.toml"),
+            dep("left-pad", Some("MIT"), "web/package-lock.json"),
+            dep("mystery", None, "requirements.txt"),
+            dep("widgets", Some("LicenseRef-ACME-Internal"), "go.mod"),
+        ];
+
+        let report = build_license_scanning_report(&data);
+        assert_eq!(report.version, "2.1");
+
+        let ids: Vec<&str> = report.licenses.iter().map(|l| l.id.as_str()).collect();
+        assert_eq!(
+            ids,
+            vec!["Apache-2.0", "LicenseRef-ACME-Internal", "MIT", "unknown"]
+        );
+        assert_eq!(
+            report.licenses[2].url.as_deref(),
+            Some("https://spdx.org/licenses/MIT.html")
+        );
+        assert_eq!(report.licenses[1].url, None);
+        assert_eq!(report.licenses[3].url, None);
+
+        assert_eq!(report.dependencies[0].licenses, vec!["MIT", "Apache-2.0"]);
+        assert_eq!(report.dependencies[0].package_manager, "cargo");
+        assert_eq!(report.dependencies[1].package_manager, "npm");
+        assert_eq!(report.dependencies[1].path, "web/package-lock.json");
+        assert_eq!(report.dependencies[2].licenses, vec!["unknown"]);
+        assert_eq!(report.dependencies[2].package_manager, "pip");
+    }
+}
@@ -0,0 +1,390 @@
+//! Golden report comparison (`feluda verify --golden`)
+//!
+//! A golden report is a scan committed to the repository once its licenses
+//! have been reviewed. `feluda verify` scans the project again and fails when
+//! the dependency license surface drifted from it, like a snapshot test: a
+//! drift is accepted by rerunning with `--update` and committing the new
+//! golden report, so every change to the surface goes through review.
+//!
+//! Dependencies are matched by name. What fails depends on the tolerance:
+//!
+//! - `exact`: any added or removed dependency, new version or license change
+//! - `versions` (the default): new versions that keep their license, and
+//!   removed dependencies, are accepted
+//! - `allowed`: a new version is also accepted under another license, as long
+//!   as that license is allowed: it passes the policy, or without a policy it
+//!   is neither restrictive nor incompatible
+//!
+//! New dependencies and license changes of an unchanged version always fail.
+
+use colored::*;
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::Path;
+use std::process;
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::diff::{load_report, print_table};
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::policy::PolicyDecision;
+use crate::report_json::{render_json_report, LATEST_SCHEMA_VERSION};
+use crate::scan::{scan, ScanOptions};
+
+/// Differences from the golden report that don't fail `feluda verify`
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, clap::ValueEnum)]
+#[serde(rename_all = "kebab-case")]
+pub enum GoldenTolerance {
+    /// Every difference fails
+    Exact,
+    /// New versions with the same license and removed dependencies pass
+    #[default]
+    Versions,
+    /// New versions under another allowed license pass as well
+    Allowed,
+}
+
+/// How a dependency differs from the golden report
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum DriftKind {
+    /// Not in the golden report
+    Added,
+    /// In the golden report, but no longer a dependency
+    Removed,
+    /// A new version with the same license
+    VersionBump,
+    /// A new version with another license
+    Relicensed,
+    /// The same version with another license, e.g. after an override
+    Redetected,
+}
+
+impl DriftKind {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            DriftKind::Added => "added",
+            DriftKind::Removed => "removed",
+            DriftKind::VersionBump => "version bump",
+            DriftKind::Relicensed => "relicensed",
+            DriftKind::Redetected => "same version",
+        }
+    }
+}
+
+/// Version and license of a dependency on one side of the comparison
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct GoldenEntry {
+    pub version: String,
+    pub license: String,
+}
+
+impl From<&LicenseInfo> for GoldenEntry {
+    fn from(info: &LicenseInfo) -> Self {
+        Self {
+            version: info.version.clone(),
+            license: info.get_license(),
+        }
+    }
+}
+
+/// A dependency that differs from the golden report
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Drift {
+    pub name: String,
+    pub kind: DriftKind,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub golden: Option<GoldenEntry>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub current: Option<GoldenEntry>,
+    /// Whether the tolerance accepts the difference
+    pub tolerated: bool,
+}
+
+/// Result of comparing a scan against the golden report
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct GoldenCheck {
+    pub tolerance: GoldenTolerance,
+    pub drift: Vec<Drift>,
+}
+
+impl GoldenCheck {
+    /// Differences the tolerance doesn't accept
+    pub fn failures(&self) -> Vec<&Drift> {
+        self.drift.iter().filter(|drift| !drift.tolerated).collect()
+    }
+
+    pub fn passed(&self) -> bool {
+        self.drift.iter().all(|drift| drift.tolerated)
+    }
+}
+
+/// Whether a license would be accepted for a new dependency
+fn is_allowed(info: &LicenseInfo) -> bool {
+    match &info.explanation {
+        Some(explanation) => explanation.decision != PolicyDecision::Fail,
+        None => {
+            !info.is_restrictive
+                && info.compatibility != LicenseCompatibility::Incompatible
+                && !info.has_unknown_license()
+        }
+    }
+}
+
+/// Compare the dependencies of a scan against the golden report
+pub fn verify_golden(
+    golden: &[LicenseInfo],
+    current: &[LicenseInfo],
+    tolerance: GoldenTolerance,
+) -> GoldenCheck {
+    let mut golden_by_name: BTreeMap<&str, Vec<&LicenseInfo>> = BTreeMap::new();
+    for info in golden {
+        golden_by_name.entry(&info.name).or_default().push(info);
+    }
+    let mut current_names: Vec<&str> = current.iter().map(|info| info.name.as_str()).collect();
+    current_names.sort_unstable();
+
+    let mut check = GoldenCheck {
+        tolerance,
+        drift: Vec::new(),
+    };
+    for info in current {
+        let entries = golden_by_name.get(info.name.as_str());
+        let license = info.get_license();
+        let (kind, golden) = match entries {
+            None => (DriftKind::Added, None),
+            Some(entries) => {
+                let same_version = entries.iter().find(|old| old.version == info.version);
+                match same_version {
+                    Some(old) if old.get_license() == license => continue,
+                    Some(old) => (DriftKind::Redetected, Some(*old)),
+                    None => match entries.iter().find(|old| old.get_license() == license) {
+                        Some(old) => (DriftKind::VersionBump, Some(*old)),
+                        None => (DriftKind::Relicensed, Some(entries[0])),
+                    },
+                }
+            }
+        };
+        let tolerated = match kind {
+            DriftKind::Added | DriftKind::Redetected | DriftKind::Removed => false,
+            DriftKind::VersionBump => tolerance != GoldenTolerance::Exact,
+            DriftKind::Relicensed => tolerance == GoldenTolerance::Allowed && is_allowed(info),
+        };
+        check.drift.push(Drift {
+            name: info.name.clone(),
+            kind,
+            golden: golden.map(GoldenEntry::from),
+            current: Some(GoldenEntry::from(info)),
+            tolerated,
+        });
+    }
+
+    for (name, entries) in golden_by_name {
+        if current_names.binary_search(&name).is_err() {
+            check.drift.extend(entries.into_iter().map(|old| Drift {
+                name: old.name.clone(),
+                kind: DriftKind::Removed,
+                golden: Some(GoldenEntry::from(old)),
+                current: None,
+                tolerated: tolerance != GoldenTolerance::Exact,
+            }));
+        }
+    }
+    check
+}
+
+/// Print the differences from the golden report as a table
+pub fn print_golden_check(check: &GoldenCheck, golden_path: &str) {
+    let failures = check.failures().len();
+    println!(
+        "\n{} {} differences from {golden_path}, {failures} not tolerated\n",
+        "Golden report:".bold(),
+        check.drift.len(),
+    );
+
+    if !check.drift.is_empty() {
+        let side = |entry: &Option<GoldenEntry>| {
+            entry
+                .as_ref()
+                .map(|entry| format!("{} ({})", entry.license, entry.version))
+                .unwrap_or_else(|| "-".to_string())
+        };
+        let rows: Vec<_> = check
+            .drift
+            .iter()
+            .map(|drift| {
+                (
+                    vec![
+                        drift.name.clone(),
+                        side(&drift.golden),
+                        side(&drift.current),
+                        drift.kind.as_str().to_string(),
+                        if drift.tolerated {
+                            "tolerated"
+                        } else {
+                            "fails"
+                        }
+                        .to_string(),
+                    ],
+                    !drift.tolerated,
+                )
+            })
+            .collect();
+        print_table(
+            "Drift",
+            &["Package", "Golden", "Current", "Change", "Result"],
+            &rows,
+        );
+    }
+
+    if check.passed() {
+        println!(
+            "{}\n",
+            "✅ The license surface matches the golden report"
+                .green()
+                .bold()
+        );
+    } else {
+        println!(
+            "{} {}\n",
+            "⚠️".bold(),
+            "The license surface drifted, review it and rerun with --update to accept"
+                .yellow()
+                .bold()
+        );
+    }
+}
+
+/// Options of `feluda verify`
+#[derive(Debug, Clone)]
+pub struct VerifyOptions {
+    pub golden: String,
+    pub path: String,
+    pub scan_options: ScanOptions,
+    pub tolerance: GoldenTolerance,
+    /// Rewrite the golden report from the scan instead of comparing
+    pub update: bool,
+    pub json: bool,
+}
+
+pub fn handle_verify_command(options: VerifyOptions) -> FeludaResult<()> {
+    let report = scan(&options.path, &options.scan_options)?;
+
+    if options.update {
+        let content = render_json_report(
+            LATEST_SCHEMA_VERSION,
+            &options.path,
+            &report.dependencies,
+            report.project_license.as_deref(),
+            &report.policy_violations,
+        )?;
+        fs::write(&options.golden, content).map_err(|e| {
+            FeludaError::FileWrite(format!("Failed to write {}: {e}", options.golden))
+        })?;
+        println!(
+            "✓ Wrote the golden report {} with {} dependencies",
+            options.golden,
+            report.dependencies.len()
+        );
+        return Ok(());
+    }
+
+    let golden = load_report(Path::new(&options.golden))?;
+    let check = verify_golden(&golden, &report.dependencies, options.tolerance);
+    if options.json {
+        let output = serde_json::to_string_pretty(&check).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize the golden check: {e}"))
+        })?;
+        println!("{output}");
+    } else {
+        print_golden_check(&check, &options.golden);
+    }
+
+    if !check.passed() {
+        log(
+            LogLevel::Warn,
+            "The scan differs from the golden report, exiting with status 1",
+        );
+        process::exit(1);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+
+    fn dep(name: &str, version: &str, license: &str) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: license.starts_with("GPL"),
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            ..LicenseInfo::test(name, version, Some(license))
+        }
+    }
+
+    fn kinds(check: &GoldenCheck) -> Vec<(&str, DriftKind, bool)> {
+        check
+            .drift
+            .iter()
+            .map(|drift| (drift.name.as_str(), drift.kind, drift.tolerated))
+            .collect()
+    }
+
+    #[test]
+    fn test_verify_golden() {
+        let golden = vec![
+            dep("serde", "1.0.100", "MIT OR Apache-2.0"),
+            dep("left-pad", "1.3.0", "WTFPL"),
+            dep("old-lib", "0.1.0", "MIT"),
+            dep("relicensed", "1.0.0", "MIT"),
+            dep("to-gpl", "1.0.0", "MIT"),
+        ];
+        let current = vec![
+            dep("serde", "1.0.200", "MIT OR Apache-2.0"),
+            dep("left-pad", "1.3.0", "MIT"),
+            dep("relicensed", "2.0.0", "Apache-2.0"),
+            dep("to-gpl", "2.0.0", "GPL-3.0"),
+            dep("new-lib", "1.0.0", "MIT"),
+        ];
+
+        let check = verify_golden(&golden, &current, GoldenTolerance::Versions);
+        assert_eq!(
+            kinds(&check),
+            vec![
+                ("serde", DriftKind::VersionBump, true),
+                ("left-pad", DriftKind::Redetected, false),
+                ("relicensed", DriftKind::Relicensed, false),
+                ("to-gpl", DriftKind::Relicensed, false),
+                ("new-lib", DriftKind::Added, false),
+                ("old-lib", DriftKind::Removed, true),
+            ]
+        );
+        assert!(!check.passed());
+        assert_eq!(
+            check.drift[0].golden,
+            Some(GoldenEntry {
+                version: "1.0.100".to_string(),
+                license: "MIT OR Apache-2.0".to_string()
+            })
+        );
+
+        // An allowed license is accepted with a new version, a restrictive one isn't
+        let check = verify_golden(&golden, &current, GoldenTolerance::Allowed);
+        let tolerated: Vec<_> = check
+            .drift
+            .iter()
+            .filter(|drift| drift.tolerated)
+            .map(|drift| drift.name.as_str())
+            .collect();
+        assert_eq!(tolerated, vec!["serde", "relicensed", "old-lib"]);
+
+        let check = verify_golden(&golden, &current, GoldenTolerance::Exact);
+        assert!(check.drift.iter().all(|drift| !drift.tolerated));
+
+        let check = verify_golden(&golden, &golden, GoldenTolerance::Exact);
+        assert!(check.drift.is_empty());
+        assert!(check.passed());
+    }
+}
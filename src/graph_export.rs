@@ -0,0 +1,317 @@
+//! Dependency graph export (`feluda graph`)
+//!
+//! The scanned dependencies are rendered as a Graphviz DOT or Mermaid graph,
+//! with the project as the root and every package colored by its license
+//! class. Edges come from the resolved graph where the analyzer knows it
+//! (Cargo, npm) and otherwise from [`LicenseInfo::dependency_path`]; without
+//! either, dependencies hang directly off the project.
+
+use std::collections::{BTreeSet, HashMap};
+use std::fs;
+use std::path::Path;
+
+use crate::cli::GraphFormat;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::scan::{scan, ScanOptions};
+
+/// License class a package is colored by
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum LicenseClass {
+    Permissive,
+    Incompatible,
+    Restrictive,
+    Unknown,
+}
+
+impl LicenseClass {
+    pub fn of(info: &LicenseInfo) -> Self {
+        if info.has_unknown_license() {
+            LicenseClass::Unknown
+        } else if info.is_restrictive {
+            LicenseClass::Restrictive
+        } else if info.compatibility == LicenseCompatibility::Incompatible {
+            LicenseClass::Incompatible
+        } else {
+            LicenseClass::Permissive
+        }
+    }
+
+    fn name(self) -> &'static str {
+        match self {
+            LicenseClass::Permissive => "permissive",
+            LicenseClass::Incompatible => "incompatible",
+            LicenseClass::Restrictive => "restrictive",
+            LicenseClass::Unknown => "unknown",
+        }
+    }
+
+    /// Fill and border color
+    fn colors(self) -> (&'static str, &'static str) {
+        match self {
+            LicenseClass::Permissive => ("#dafbe1", "#1a7f37"),
+            LicenseClass::Incompatible => ("#fff1e5", "#bc4c00"),
+            LicenseClass::Restrictive => ("#ffebe9", "#cf222e"),
+            LicenseClass::Unknown => ("#eaeef2", "#57606a"),
+        }
+    }
+}
+
+/// A package in the graph
+struct Node {
+    label: String,
+    license: String,
+    class: LicenseClass,
+}
+
+/// Packages and edges to render; node 0 is the project
+struct Graph {
+    root: String,
+    nodes: Vec<Node>,
+    edges: BTreeSet<(usize, usize)>,
+}
+
+impl Graph {
+    fn build(root: &str, dependencies: &[LicenseInfo]) -> Self {
+        let mut nodes = Vec::new();
+        let mut index: HashMap<String, usize> = HashMap::new();
+        for info in dependencies {
+            let label = format!("{}@{}", info.name, info.version);
+            if index.contains_key(&label) {
+                continue;
+            }
+            index.insert(label.clone(), nodes.len() + 1);
+            nodes.push(Node {
+                label,
+                license: info.get_license(),
+                class: LicenseClass::of(info),
+            });
+        }
+
+        // Packages filtered out of the scan, such as workspace members, have no node
+        let mut edges = BTreeSet::new();
+        for info in dependencies {
+            let to = index[&format!("{}@{}", info.name, info.version)];
+            match info.dependency_path.as_deref() {
+                Some([.., parent, _]) => {
+                    if let Some(&from) = index.get(parent) {
+                        edges.insert((from, to));
+                    }
+                }
+                _ => {
+                    edges.insert((0, to));
+                }
+            }
+            for required in info.requires.iter().flatten() {
+                if let Some(&next) = index.get(required) {
+                    edges.insert((to, next));
+                }
+            }
+        }
+
+        Self {
+            root: root.to_string(),
+            nodes,
+            edges,
+        }
+    }
+
+    fn classes(&self) -> BTreeSet<LicenseClass> {
+        self.nodes.iter().map(|node| node.class).collect()
+    }
+}
+
+fn dot_escape(text: &str) -> String {
+    text.replace('\\', "\\\\").replace('"', "\\\"")
+}
+
+fn render_dot(graph: &Graph) -> String {
+    let mut out = String::from("digraph dependencies {\n");
+    out.push_str("  rankdir=LR;\n");
+    out.push_str("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n");
+    out.push_str(&format!(
+        "  n0 [label=\"{}\", shape=box3d, fillcolor=\"#ffffff\"];\n",
+        dot_escape(&graph.root)
+    ));
+    for (i, node) in graph.nodes.iter().enumerate() {
+        let (fill, border) = node.class.colors();
+        out.push_str(&format!(
+            "  n{} [label=\"{}\\n{}\", fillcolor=\"{fill}\", color=\"{border}\"];\n",
+            i + 1,
+            dot_escape(&node.label),
+            dot_escape(&node.license)
+        ));
+    }
+    for (from, to) in &graph.edges {
+        out.push_str(&format!("  n{from} -> n{to};\n"));
+    }
+
+    out.push_str("  subgraph cluster_legend {\n    label=\"License class\";\n");
+    for class in graph.classes() {
+        let (fill, border) = class.colors();
+        out.push_str(&format!(
+            "    legend_{0} [label=\"{0}\", fillcolor=\"{fill}\", color=\"{border}\"];\n",
+            class.name()
+        ));
+    }
+    out.push_str("  }\n}\n");
+    out
+}
+
+fn mermaid_escape(text: &str) -> String {
+    text.replace('"', "#quot;")
+        .replace('<', "#lt;")
+        .replace('>', "#gt;")
+}
+
+fn render_mermaid(graph: &Graph) -> String {
+    let mut out = String::from("graph LR\n");
+    out.push_str(&format!("  n0[[\"{}\"]]\n", mermaid_escape(&graph.root)));
+    for (i, node) in graph.nodes.iter().enumerate() {
+        out.push_str(&format!(
+            "  n{}[\"{}<br/>{}\"]:::{}\n",
+            i + 1,
+            mermaid_escape(&node.label),
+            mermaid_escape(&node.license),
+            node.class.name()
+        ));
+    }
+    for (from, to) in &graph.edges {
+        out.push_str(&format!("  n{from} --> n{to}\n"));
+    }
+    for class in graph.classes() {
+        let (fill, border) = class.colors();
+        out.push_str(&format!(
+            "  classDef {} fill:{fill},stroke:{border}\n",
+            class.name()
+        ));
+    }
+    out
+}
+
+/// Render the dependencies of the project `root` as a graph
+pub fn render_graph(root: &str, dependencies: &[LicenseInfo], format: GraphFormat) -> String {
+    let graph = Graph::build(root, dependencies);
+    match format {
+        GraphFormat::Dot => render_dot(&graph),
+        GraphFormat::Mermaid => render_mermaid(&graph),
+    }
+}
+
+/// Name of the root node: the project directory's name
+fn project_name(path: &Path) -> String {
+    fs::canonicalize(path)
+        .ok()
+        .and_then(|path| {
+            path.file_name()
+                .map(|name| name.to_string_lossy().to_string())
+        })
+        .unwrap_or_else(|| "project".to_string())
+}
+
+/// Entry point for the graph command
+pub fn handle_graph_command(
+    path: &Path,
+    format: GraphFormat,
+    output: Option<String>,
+    options: &ScanOptions,
+) -> FeludaResult<()> {
+    let report = scan(path, options)?;
+    let graph = render_graph(&project_name(path), &report.dependencies, format);
+    log(
+        LogLevel::Info,
+        &format!(
+            "Rendered {format:?} graph of {} dependencies",
+            report.dependencies.len()
+        ),
+    );
+
+    match output {
+        Some(file) => fs::write(&file, graph)
+            .map_err(|e| FeludaError::FileWrite(format!("Failed to write {file}: {e}")))?,
+        None => print!("{graph}"),
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+
+    fn dep(name: &str, license: Option<&str>, path: &[&str], requires: &[&str]) -> LicenseInfo {
+        let restrictive = license.is_some_and(|license| license.starts_with("GPL"));
+        LicenseInfo {
+            is_restrictive: restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            dependency_path: (!path.is_empty())
+                .then(|| path.iter().map(|p| p.to_string()).collect()),
+            requires: (!requires.is_empty())
+                .then(|| requires.iter().map(|r| r.to_string()).collect()),
+            ..LicenseInfo::test(name, "1.0.0", license)
+        }
+    }
+
+    fn sample() -> Vec<LicenseInfo> {
+        vec![
+            dep(
+                "express",
+                Some("MIT"),
+                &["express@1.0.0"],
+                &["qs@1.0.0", "readline@1.0.0"],
+            ),
+            dep(
+                "qs",
+                Some("BSD-3-Clause"),
+                &["express@1.0.0", "qs@1.0.0"],
+                &[],
+            ),
+            dep(
+                "readline",
+                Some("GPL-3.0"),
+                &["express@1.0.0", "readline@1.0.0"],
+                &["qs@1.0.0", "app-internal@0.1.0"],
+            ),
+            dep("mystery", None, &[], &[]),
+        ]
+    }
+
+    #[test]
+    fn test_render_dot() {
+        let dot = render_graph("app", &sample(), GraphFormat::Dot);
+
+        assert!(dot.starts_with("digraph dependencies {\n"));
+        assert!(dot.contains("n0 [label=\"app\""));
+        assert!(dot.contains(
+            "n3 [label=\"readline@1.0.0\\nGPL-3.0\", fillcolor=\"#ffebe9\", color=\"#cf222e\"];"
+        ));
+        assert!(dot.contains("n4 [label=\"mystery@1.0.0\\nNo License\""));
+        for edge in [
+            "n0 -> n1;",
+            "n1 -> n2;",
+            "n1 -> n3;",
+            "n3 -> n2;",
+            "n0 -> n4;",
+        ] {
+            assert!(dot.contains(edge), "missing {edge}");
+        }
+        // Packages that are not in the scan are left out
+        assert_eq!(dot.matches(" -> ").count(), 5);
+        assert!(dot.contains("legend_restrictive"));
+        assert!(!dot.contains("legend_incompatible"));
+        assert!(dot.ends_with("}\n"));
+    }
+
+    #[test]
+    fn test_render_mermaid() {
+        let mermaid = render_graph("my \"app\"", &sample(), GraphFormat::Mermaid);
+
+        assert!(mermaid.starts_with("graph LR\n  n0[[\"my #quot;app#quot;\"]]\n"));
+        assert!(mermaid.contains("  n1[\"express@1.0.0<br/>MIT\"]:::permissive\n"));
+        assert!(mermaid.contains("  n3[\"readline@1.0.0<br/>GPL-3.0\"]:::restrictive\n"));
+        assert!(mermaid.contains("  n4[\"mystery@1.0.0<br/>No License\"]:::unknown\n"));
+        assert!(mermaid.contains("  n1 --> n3\n"));
+        assert!(mermaid.contains("  classDef restrictive fill:#ffebe9,stroke:#cf222e\n"));
+    }
+}
@@ -0,0 +1,454 @@
+//! Package deprecation and archival signals (`--health`)
+//!
+//! Besides the license, a registry's metadata tells whether a package is still
+//! maintained. With `--health` every dependency is looked up for:
+//!
+//! - deprecation: the `deprecated` notice of the npm version, or a PyPI
+//!   release classified `Development Status :: 7 - Inactive`
+//! - yanked versions on crates.io and PyPI
+//! - an archived source repository on GitHub, found in the npm, crates.io or
+//!   PyPI metadata or, for Go, in the module path
+//!
+//! Each repository is looked up once. `[policy.health]` decides whether a
+//! signal is ignored, reported or fails the scan.
+
+use colored::*;
+use rayon::prelude::*;
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::collections::HashMap;
+
+use crate::config::{HealthAction, HealthPolicy};
+use crate::debug::{log, log_error, LogLevel};
+use crate::licenses::{get_github_token, LicenseInfo};
+use crate::registry::{self, Registry};
+use crate::reporter::TableFormatter;
+use crate::vulns::osv_ecosystem;
+
+/// Classifier of PyPI projects that are no longer maintained
+const PYPI_INACTIVE_CLASSIFIER: &str = "Development Status :: 7 - Inactive";
+
+/// Maintenance signals of a dependency
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct PackageHealth {
+    /// Deprecation notice of the package or version
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub deprecated: Option<String>,
+    /// The version was withdrawn from the registry
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub yanked: bool,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub yanked_reason: Option<String>,
+    /// The source repository is archived and read-only
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub archived: bool,
+    /// Source repository found in the registry metadata
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub repository: Option<String>,
+    /// OpenSSF Scorecard score of the repository, from 0 to 10, with `--deps-dev`
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub scorecard: Option<f64>,
+}
+
+/// A maintenance problem of a dependency
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum HealthSignal {
+    Deprecated,
+    Yanked,
+    Archived,
+}
+
+impl std::fmt::Display for HealthSignal {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            HealthSignal::Deprecated => write!(f, "deprecated"),
+            HealthSignal::Yanked => write!(f, "yanked"),
+            HealthSignal::Archived => write!(f, "archived"),
+        }
+    }
+}
+
+impl PackageHealth {
+    /// The signals raised for the dependency
+    pub fn signals(&self) -> Vec<HealthSignal> {
+        let mut signals = Vec::new();
+        if self.deprecated.is_some() {
+            signals.push(HealthSignal::Deprecated);
+        }
+        if self.yanked {
+            signals.push(HealthSignal::Yanked);
+        }
+        if self.archived {
+            signals.push(HealthSignal::Archived);
+        }
+        signals
+    }
+
+    /// Drop the signals the policy ignores
+    fn apply_policy(&mut self, policy: &HealthPolicy) {
+        if policy.action(HealthSignal::Deprecated) == HealthAction::Ignore {
+            self.deprecated = None;
+        }
+        if policy.action(HealthSignal::Yanked) == HealthAction::Ignore {
+            self.yanked = false;
+            self.yanked_reason = None;
+        }
+        if policy.action(HealthSignal::Archived) == HealthAction::Ignore {
+            self.archived = false;
+        }
+    }
+
+    fn describe(&self, signal: HealthSignal) -> String {
+        match signal {
+            HealthSignal::Deprecated => self.deprecated.clone().unwrap_or_default(),
+            HealthSignal::Yanked => self.yanked_reason.clone().unwrap_or_default(),
+            HealthSignal::Archived => self.repository.clone().unwrap_or_default(),
+        }
+    }
+}
+
+/// `owner/repo` of a GitHub repository URL as found in package metadata
+///
+/// Accepts npm's `github:owner/repo` shorthand and `git+https://` URLs.
+fn github_repository(url: &str) -> Option<String> {
+    let url = url.trim();
+    let path = match url.strip_prefix("github:") {
+        Some(shorthand) => shorthand,
+        None => url
+            .strip_prefix("git@github.com:")
+            .or_else(|| url.split_once("github.com/").map(|(_, path)| path))?,
+    };
+    let mut segments = path.split(['/', '#', '?']);
+    let owner = segments.next().filter(|owner| !owner.is_empty())?;
+    let repo = segments
+        .next()
+        .map(|repo| repo.trim_end_matches(".git"))
+        .filter(|repo| !repo.is_empty())?;
+    Some(format!("{owner}/{repo}"))
+}
+
+/// Repository URL of an npm `repository` field, a string or `{ "url": ... }`
+fn npm_repository(metadata: &Value) -> Option<String> {
+    let repository = metadata.get("repository")?;
+    repository
+        .as_str()
+        .or_else(|| repository.get("url")?.as_str())
+        .map(str::to_string)
+}
+
+pub(crate) fn get_json(registry: Registry, url: &str) -> Option<Value> {
+    match registry::get(registry, url) {
+        Ok(response) if response.status().is_success() => response.json().ok(),
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!("{url} returned {}", response.status()),
+            );
+            None
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch {url}"), &err);
+            None
+        }
+    }
+}
+
+fn npm_health(name: &str, version: &str) -> Option<PackageHealth> {
+    let url = format!("{}/{name}/{version}", registry::npm_registry(name));
+    let metadata = get_json(Registry::Npm, &url)?;
+    Some(PackageHealth {
+        deprecated: metadata
+            .get("deprecated")
+            .and_then(Value::as_str)
+            .filter(|notice| !notice.trim().is_empty())
+            .map(str::to_string),
+        repository: npm_repository(&metadata),
+        ..PackageHealth::default()
+    })
+}
+
+/// The crate endpoint lists every version with its yank state, and the repository
+fn crates_io_health(name: &str, version: &str) -> Option<PackageHealth> {
+    let url = format!("{}/api/v1/crates/{name}", registry::crates_io_url());
+    let metadata = get_json(Registry::CratesIo, &url)?;
+    let release = metadata
+        .get("versions")
+        .and_then(Value::as_array)
+        .and_then(|versions| {
+            versions
+                .iter()
+                .find(|release| release.get("num").and_then(Value::as_str) == Some(version))
+        });
+    Some(PackageHealth {
+        yanked: release
+            .and_then(|release| release.get("yanked"))
+            .and_then(Value::as_bool)
+            .unwrap_or(false),
+        yanked_reason: release
+            .and_then(|release| release.get("yank_message"))
+            .and_then(Value::as_str)
+            .map(str::to_string),
+        repository: metadata
+            .pointer("/crate/repository")
+            .and_then(Value::as_str)
+            .map(str::to_string),
+        ..PackageHealth::default()
+    })
+}
+
+fn pypi_health(name: &str, version: &str) -> Option<PackageHealth> {
+    let url = format!("{}/pypi/{name}/{version}/json", registry::pypi_url());
+    let info = get_json(Registry::PyPi, &url)?.get("info")?.clone();
+    let inactive = info
+        .get("classifiers")
+        .and_then(Value::as_array)
+        .is_some_and(|classifiers| {
+            classifiers
+                .iter()
+                .any(|classifier| classifier.as_str() == Some(PYPI_INACTIVE_CLASSIFIER))
+        });
+    // Project URLs are labelled freely, so take the first one on GitHub
+    let repository = info
+        .get("project_urls")
+        .and_then(Value::as_object)
+        .into_iter()
+        .flat_map(|urls| urls.values())
+        .chain(info.get("home_page"))
+        .filter_map(Value::as_str)
+        .find(|url| github_repository(url).is_some())
+        .map(str::to_string);
+    Some(PackageHealth {
+        deprecated: inactive.then(|| format!("Marked {PYPI_INACTIVE_CLASSIFIER}")),
+        yanked: info.get("yanked").and_then(Value::as_bool).unwrap_or(false),
+        yanked_reason: info
+            .get("yanked_reason")
+            .and_then(Value::as_str)
+            .filter(|reason| !reason.trim().is_empty())
+            .map(str::to_string),
+        repository,
+        ..PackageHealth::default()
+    })
+}
+
+/// Registry metadata of one dependency, without the archival state
+fn registry_health(info: &LicenseInfo) -> Option<PackageHealth> {
+    let ecosystem = osv_ecosystem(info.source_file.as_deref()?)?;
+    let version = info.version.trim();
+    match ecosystem {
+        "npm" => npm_health(&info.name, version),
+        "crates.io" => crates_io_health(&info.name, version),
+        "PyPI" => pypi_health(&info.name, version),
+        "Go" if info.name.starts_with("github.com/") => Some(PackageHealth {
+            repository: Some(format!("https://{}", info.name)),
+            ..PackageHealth::default()
+        }),
+        _ => None,
+    }
+}
+
+/// Whether a GitHub repository is archived, `None` when it cannot be looked up
+fn is_archived(repository: &str) -> Option<bool> {
+    let url = format!("https://api.github.com/repos/{repository}");
+    let response = registry::send(Registry::GitHub, |client| {
+        let request = client
+            .get(&url)
+            .header(reqwest::header::ACCEPT, "application/vnd.github+json");
+        match get_github_token() {
+            Some(token) => request.bearer_auth(token),
+            None => request,
+        }
+    });
+    match response {
+        Ok(response) if response.status().is_success() => response
+            .json::<Value>()
+            .ok()?
+            .get("archived")
+            .and_then(Value::as_bool),
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!("GitHub returned {} for {repository}", response.status()),
+            );
+            None
+        }
+        Err(err) => {
+            log_error(&format!("Failed to look up {repository} on GitHub"), &err);
+            None
+        }
+    }
+}
+
+/// Look up the maintenance signals of every dependency with a supported registry
+///
+/// Signals ignored by `policy` are left out.
+pub fn enrich_with_health(dependencies: &mut [LicenseInfo], policy: &HealthPolicy) {
+    if crate::offline::is_offline() {
+        log(
+            LogLevel::Warn,
+            "Offline, skipping the package health lookup",
+        );
+        return;
+    }
+    log(
+        LogLevel::Info,
+        &format!(
+            "Looking up package health of {} dependencies",
+            dependencies.len()
+        ),
+    );
+
+    dependencies
+        .par_iter_mut()
+        .for_each(|info| info.health = registry_health(info));
+
+    let mut repositories: Vec<String> = dependencies
+        .iter()
+        .filter_map(|info| info.health.as_ref()?.repository.as_deref())
+        .filter_map(github_repository)
+        .collect();
+    repositories.sort();
+    repositories.dedup();
+    let archived: HashMap<String, bool> = repositories
+        .into_par_iter()
+        .filter_map(|repository| {
+            let archived = is_archived(&repository)?;
+            Some((repository, archived))
+        })
+        .collect();
+
+    for health in dependencies
+        .iter_mut()
+        .filter_map(|info| info.health.as_mut())
+    {
+        health.archived = health
+            .repository
+            .as_deref()
+            .and_then(github_repository)
+            .and_then(|repository| archived.get(&repository).copied())
+            .unwrap_or(false);
+        health.apply_policy(policy);
+    }
+}
+
+/// Print a table of the deprecated, yanked and archived dependencies
+pub fn print_package_health(dependencies: &[LicenseInfo]) {
+    let rows: Vec<Vec<String>> = dependencies
+        .iter()
+        .flat_map(|info| {
+            let health = info.health.as_ref();
+            health
+                .map(PackageHealth::signals)
+                .unwrap_or_default()
+                .into_iter()
+                .map(move |signal| {
+                    vec![
+                        info.name.clone(),
+                        info.version.clone(),
+                        signal.to_string(),
+                        health.map(|h| h.describe(signal)).unwrap_or_default(),
+                    ]
+                })
+        })
+        .collect();
+
+    if rows.is_empty() {
+        println!(
+            "\n{}\n",
+            "✅ No deprecated, yanked or archived packages found"
+                .green()
+                .bold()
+        );
+        return;
+    }
+
+    println!(
+        "\n{} {}\n",
+        "🧹".bold(),
+        format!("Package health warnings: {}", rows.len())
+            .yellow()
+            .bold()
+    );
+
+    let headers = ["Package", "Version", "Signal", "Details"];
+    let mut formatter = TableFormatter::new(headers.iter().map(|h| h.to_string()).collect());
+    for row in &rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+    for row in &rows {
+        println!("{}", formatter.render_row(row, true));
+    }
+    println!("{}\n", formatter.render_footer());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_github_repository() {
+        for url in [
+            "git+https://github.com/expressjs/express.git",
+            "github:expressjs/express",
+            "git@github.com:expressjs/express.git",
+            "https://github.com/expressjs/express/tree/master#readme",
+        ] {
+            assert_eq!(
+                github_repository(url).as_deref(),
+                Some("expressjs/express"),
+                "{url}"
+            );
+        }
+        assert_eq!(github_repository("https://gitlab.com/org/project"), None);
+        assert_eq!(github_repository("https://github.com/expressjs"), None);
+    }
+
+    #[test]
+    fn test_npm_repository() {
+        let metadata = serde_json::json!({
+            "repository": { "type": "git", "url": "git+https://github.com/request/request.git" }
+        });
+        assert_eq!(
+            npm_repository(&metadata).as_deref(),
+            Some("git+https://github.com/request/request.git")
+        );
+        let metadata = serde_json::json!({ "repository": "github:request/request" });
+        assert_eq!(
+            npm_repository(&metadata).as_deref(),
+            Some("github:request/request")
+        );
+    }
+
+    #[test]
+    fn test_signals_and_policy() {
+        let mut health = PackageHealth {
+            deprecated: Some("request has been deprecated".to_string()),
+            yanked: true,
+            archived: true,
+            ..PackageHealth::default()
+        };
+        assert_eq!(
+            health.signals(),
+            vec![
+                HealthSignal::Deprecated,
+                HealthSignal::Yanked,
+                HealthSignal::Archived
+            ]
+        );
+
+        health.apply_policy(&HealthPolicy {
+            archived: HealthAction::Ignore,
+            yanked: HealthAction::Fail,
+            ..HealthPolicy::default()
+        });
+        assert_eq!(
+            health.signals(),
+            vec![HealthSignal::Deprecated, HealthSignal::Yanked]
+        );
+
+        let json = serde_json::to_value(&health).unwrap();
+        assert_eq!(json["yanked"], true);
+        assert!(json.get("archived").is_none());
+    }
+}
@@ -0,0 +1,664 @@
+//! Checking staged dependency changes from a git pre-commit hook (`feluda hook`)
+//!
+//! `feluda hook install` writes a pre-commit script that runs `feluda hook run`.
+//! The run only looks at manifests and lockfiles staged in the index: commits
+//! that touch none of them return at once, and otherwise only the directories
+//! of the staged files are scanned. A change to `.feluda.toml` or the baseline
+//! checks the whole repository.
+//!
+//! Results are cached under the user cache directory, keyed by the staged
+//! contents of the project's manifests, the configuration, the project license
+//! and the Feluda version. Checking the same staged files again, e.g. after a
+//! failed commit of unrelated changes, reads the cached result instead of
+//! scanning. Scans that do run take package licenses from the package cache
+//! first, see [`crate::cache`].
+//!
+//! ```yaml
+//! # .pre-commit-config.yaml
+//! repos:
+//!   - repo: local
+//!     hooks:
+//!       - id: feluda
+//!         name: feluda
+//!         entry: feluda hook run
+//!         language: system
+//!         pass_filenames: false
+//! ```
+
+use git2::{Repository, Status};
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+use std::collections::{BTreeSet, HashMap};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::time::{Instant, SystemTime};
+
+use crate::baseline::{find_baseline, Baseline, BaselineKind, DEFAULT_BASELINE_FILE};
+use crate::cache::cache_dir_path;
+use crate::cli::FailOn;
+use crate::config::load_config;
+use crate::debug::{log, log_debug, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::exit_code::{FailureThreshold, Findings, EXIT_CLEAN};
+use crate::licenses::{detect_project_license, LicenseCompatibility, LicenseInfo};
+use crate::policy::PolicyViolation;
+use crate::scan::{scan, Report, ScanOptions};
+use crate::watch::is_watched_file;
+
+/// First line after the shebang of the scripts written by [`install`]
+const HOOK_MARKER: &str = "# feluda pre-commit hook, installed by `feluda hook install`";
+const RESULT_CACHE_FILE: &str = "hook_results.json";
+const RESULT_CACHE_VERSION: u32 = 1;
+/// Cached results kept, newest first
+const MAX_CACHED_RESULTS: usize = 500;
+/// Files that change the result of every project
+const CONFIG_FILES: [&str; 4] = [
+    ".feluda.toml",
+    ".feluda.yml",
+    ".feluda.yaml",
+    DEFAULT_BASELINE_FILE,
+];
+
+/// Options for [`run`]
+#[derive(Debug, Clone, Default)]
+pub struct HookOptions {
+    pub scan_options: ScanOptions,
+    /// Findings that block the commit, in addition to policy violations
+    pub threshold: FailureThreshold,
+    /// Scan even when a result for the staged files is cached
+    pub no_cache: bool,
+}
+
+/// Directory checked by the hook, relative to the repository root
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord)]
+pub struct Target {
+    pub dir: PathBuf,
+    /// Also check projects in subdirectories
+    pub recursive: bool,
+}
+
+impl Target {
+    fn label(&self) -> String {
+        if self.dir.as_os_str().is_empty() {
+            ".".to_string()
+        } else {
+            self.dir.display().to_string()
+        }
+    }
+
+    /// Whether an index entry at `path` is one of the files this target checks
+    fn covers(&self, path: &Path) -> bool {
+        let parent = path.parent().unwrap_or(Path::new(""));
+        if self.recursive {
+            parent.starts_with(&self.dir)
+        } else {
+            parent == self.dir
+        }
+    }
+}
+
+/// Findings of one target, with the dependencies involved
+///
+/// Accepted baseline entries are already left out.
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct CheckResult {
+    pub dependencies: usize,
+    pub policy: Vec<String>,
+    pub restrictive: Vec<String>,
+    pub incompatible: Vec<String>,
+    pub unknown: Vec<String>,
+}
+
+impl CheckResult {
+    fn from_report(report: &Report, baseline: Option<&Baseline>) -> Self {
+        let accepted = |info: &LicenseInfo, kind| {
+            baseline.is_some_and(|baseline| {
+                baseline.suppresses(&info.name, info.license.as_deref(), kind)
+            })
+        };
+        let lines = |matches: &dyn Fn(&LicenseInfo) -> bool| {
+            report
+                .dependencies
+                .iter()
+                .filter(|info| matches(info))
+                .map(dependency_line)
+                .collect()
+        };
+
+        let mut violations = report.policy_violations.clone();
+        if let Some(baseline) = baseline {
+            baseline.filter_policy_violations(&mut violations);
+        }
+
+        Self {
+            dependencies: report.dependencies.len(),
+            policy: violations.iter().map(violation_line).collect(),
+            restrictive: lines(&|info| {
+                info.is_restrictive && !accepted(info, BaselineKind::Restrictive)
+            }),
+            incompatible: lines(&|info| {
+                info.compatibility == LicenseCompatibility::Incompatible
+                    && !accepted(info, BaselineKind::Incompatible)
+            }),
+            unknown: lines(&|info| info.has_unknown_license()),
+        }
+    }
+
+    pub fn findings(&self) -> Findings {
+        Findings {
+            restrictive: self.restrictive.len(),
+            incompatible: self.incompatible.len(),
+            unknown: self.unknown.len(),
+            vulnerable: 0,
+            policy: self.policy.len(),
+        }
+    }
+}
+
+fn dependency_line(info: &LicenseInfo) -> String {
+    format!("{}@{} ({})", info.name, info.version, info.get_license())
+}
+
+fn violation_line(violation: &PolicyViolation) -> String {
+    format!(
+        "{}@{} ({}): {}",
+        violation.name,
+        violation.version,
+        violation.license.as_deref().unwrap_or("No License"),
+        violation.kind.describe()
+    )
+}
+
+/// Cached [`CheckResult`]s, keyed by [`cache_key`]
+#[derive(Debug, Default, Serialize, Deserialize)]
+struct ResultCache {
+    #[serde(default)]
+    version: u32,
+    #[serde(default)]
+    entries: HashMap<String, CachedResult>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+struct CachedResult {
+    result: CheckResult,
+    timestamp: u64,
+}
+
+impl ResultCache {
+    fn load() -> Self {
+        let Ok(path) = cache_dir_path().map(|dir| dir.join(RESULT_CACHE_FILE)) else {
+            return Self::default();
+        };
+        fs::read_to_string(path)
+            .ok()
+            .and_then(|content| serde_json::from_str::<ResultCache>(&content).ok())
+            .filter(|cache| cache.version == RESULT_CACHE_VERSION)
+            .unwrap_or_default()
+    }
+
+    fn insert(&mut self, key: String, result: CheckResult) {
+        let timestamp = SystemTime::now()
+            .duration_since(SystemTime::UNIX_EPOCH)
+            .map(|elapsed| elapsed.as_secs())
+            .unwrap_or_default();
+        self.entries.insert(key, CachedResult { result, timestamp });
+
+        if self.entries.len() > MAX_CACHED_RESULTS {
+            let mut timestamps: Vec<u64> = self.entries.values().map(|e| e.timestamp).collect();
+            timestamps.sort_unstable_by(|a, b| b.cmp(a));
+            let oldest_kept = timestamps[MAX_CACHED_RESULTS - 1];
+            self.entries
+                .retain(|_, entry| entry.timestamp >= oldest_kept);
+        }
+    }
+
+    fn save(&mut self) -> FeludaResult<()> {
+        self.version = RESULT_CACHE_VERSION;
+        let dir = cache_dir_path()?;
+        fs::create_dir_all(&dir)?;
+        let content = serde_json::to_string(self).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize hook results: {e}"))
+        })?;
+        fs::write(dir.join(RESULT_CACHE_FILE), content)?;
+        Ok(())
+    }
+}
+
+/// Forget the cached hook results, for `feluda cache --clear`
+pub fn clear_result_cache() -> FeludaResult<()> {
+    let path = cache_dir_path()?.join(RESULT_CACHE_FILE);
+    if path.exists() {
+        fs::remove_file(&path).inspect_err(|e| log_error("Failed to clear hook results", e))?;
+        log(LogLevel::Info, "Cleared hook result cache");
+    }
+    Ok(())
+}
+
+fn git_error(e: git2::Error) -> FeludaError {
+    FeludaError::InvalidData(format!("feluda hook needs a git repository: {e}"))
+}
+
+/// Directory git runs hooks from, honouring `core.hooksPath`
+fn hooks_dir(repo: &Repository) -> FeludaResult<PathBuf> {
+    let configured = repo
+        .config()
+        .and_then(|config| config.get_path("core.hooksPath"))
+        .ok();
+    Ok(match configured {
+        Some(dir) if dir.is_absolute() => dir,
+        Some(dir) => repo
+            .workdir()
+            .ok_or_else(|| FeludaError::InvalidData("Bare repositories have no hooks".into()))?
+            .join(dir),
+        None => repo.commondir().join("hooks"),
+    })
+}
+
+/// The pre-commit script written by [`install`]
+pub fn hook_script() -> String {
+    format!(
+        "#!/bin/sh\n{HOOK_MARKER}\n\
+         if command -v feluda >/dev/null 2>&1; then\n    \
+         exec feluda hook run\n\
+         fi\n\
+         echo \"feluda is not on PATH, skipping the license check\" >&2\n"
+    )
+}
+
+/// Whether a hook script was written by [`install`]
+pub fn is_feluda_hook(script: &str) -> bool {
+    script.lines().take(2).any(|line| line == HOOK_MARKER)
+}
+
+/// Write the pre-commit hook of the repository containing `path`
+///
+/// An existing hook that Feluda did not write is only replaced with `force`.
+pub fn install(path: &Path, force: bool) -> FeludaResult<PathBuf> {
+    let repo = Repository::discover(path).map_err(git_error)?;
+    let dir = hooks_dir(&repo)?;
+    let hook = dir.join("pre-commit");
+
+    if let Ok(existing) = fs::read_to_string(&hook) {
+        if !is_feluda_hook(&existing) && !force {
+            return Err(FeludaError::InvalidData(format!(
+                "{} already exists; add `feluda hook run` to it or pass --force to replace it",
+                hook.display()
+            )));
+        }
+    }
+
+    fs::create_dir_all(&dir)?;
+    fs::write(&hook, hook_script())
+        .map_err(|e| FeludaError::FileWrite(format!("Failed to write {}: {e}", hook.display())))?;
+    #[cfg(unix)]
+    {
+        use std::os::unix::fs::PermissionsExt;
+        fs::set_permissions(&hook, fs::Permissions::from_mode(0o755))?;
+    }
+    log(
+        LogLevel::Info,
+        &format!("Installed pre-commit hook {}", hook.display()),
+    );
+    Ok(hook)
+}
+
+/// Remove the pre-commit hook written by [`install`], returning its path if there was one
+pub fn uninstall(path: &Path) -> FeludaResult<Option<PathBuf>> {
+    let repo = Repository::discover(path).map_err(git_error)?;
+    let hook = hooks_dir(&repo)?.join("pre-commit");
+    match fs::read_to_string(&hook) {
+        Ok(existing) if is_feluda_hook(&existing) => {
+            fs::remove_file(&hook)?;
+            Ok(Some(hook))
+        }
+        Ok(_) => Err(FeludaError::InvalidData(format!(
+            "{} was not installed by feluda, leaving it in place",
+            hook.display()
+        ))),
+        Err(_) => Ok(None),
+    }
+}
+
+/// Files staged for the next commit, relative to the repository root
+fn staged_files(repo: &Repository) -> FeludaResult<Vec<PathBuf>> {
+    let head = repo.head().ok().and_then(|head| head.peel_to_tree().ok());
+    let index = repo.index().map_err(git_error)?;
+    let diff = repo
+        .diff_tree_to_index(head.as_ref(), Some(&index), None)
+        .map_err(git_error)?;
+    Ok(diff
+        .deltas()
+        .filter_map(|delta| delta.new_file().path().or(delta.old_file().path()))
+        .map(Path::to_path_buf)
+        .collect())
+}
+
+fn file_name(path: &Path) -> &str {
+    path.file_name()
+        .and_then(|name| name.to_str())
+        .unwrap_or_default()
+}
+
+/// Directories to check for the staged files
+///
+/// Staged configuration or baseline changes at the root check everything.
+pub fn targets(staged: &[PathBuf]) -> Vec<Target> {
+    let config_changed = staged.iter().any(|path| {
+        path.parent()
+            .is_some_and(|parent| parent.as_os_str().is_empty())
+            && CONFIG_FILES.contains(&file_name(path))
+    });
+    if config_changed {
+        return vec![Target {
+            dir: PathBuf::new(),
+            recursive: true,
+        }];
+    }
+
+    staged
+        .iter()
+        .filter(|path| is_watched_file(file_name(path)))
+        .map(|path| Target {
+            dir: path.parent().unwrap_or(Path::new("")).to_path_buf(),
+            recursive: false,
+        })
+        .collect::<BTreeSet<_>>()
+        .into_iter()
+        .collect()
+}
+
+/// Key of the cached result of `target`, from the staged contents of the files it checks
+fn cache_key(
+    repo: &Repository,
+    target: &Target,
+    config: &str,
+    project_license: Option<&str>,
+) -> FeludaResult<String> {
+    let index = repo.index().map_err(git_error)?;
+    let mut hasher = Sha256::new();
+    hasher.update(env!("CARGO_PKG_VERSION"));
+    hasher.update(b"\0");
+    hasher.update(config);
+    hasher.update(b"\0");
+    hasher.update(project_license.unwrap_or_default());
+    hasher.update(b"\0");
+    hasher.update(target.label());
+    hasher.update([u8::from(target.recursive)]);
+
+    for entry in index.iter() {
+        let path = PathBuf::from(String::from_utf8_lossy(&entry.path).into_owned());
+        let name = file_name(&path);
+        let at_root = path.parent().is_some_and(|p| p.as_os_str().is_empty());
+        if (target.covers(&path) && is_watched_file(name))
+            || (at_root && CONFIG_FILES.contains(&name))
+        {
+            hasher.update(&entry.path);
+            hasher.update(entry.id.as_bytes());
+        }
+    }
+    Ok(hasher
+        .finalize()
+        .iter()
+        .map(|byte| format!("{byte:02x}"))
+        .collect())
+}
+
+/// Checked files of `target` whose working tree copy differs from the staged one
+fn unstaged_changes(repo: &Repository, target: &Target) -> Vec<PathBuf> {
+    let Ok(index) = repo.index() else {
+        return Vec::new();
+    };
+    index
+        .iter()
+        .map(|entry| PathBuf::from(String::from_utf8_lossy(&entry.path).into_owned()))
+        .filter(|path| target.covers(path) && is_watched_file(file_name(path)))
+        .filter(|path| {
+            repo.status_file(path)
+                .is_ok_and(|status| status.intersects(Status::WT_MODIFIED | Status::WT_DELETED))
+        })
+        .collect()
+}
+
+/// Check the staged dependency changes of the repository containing `path`
+///
+/// Returns the exit code for the hook: [`EXIT_CLEAN`] lets the commit through.
+pub fn run(path: &Path, options: &HookOptions) -> FeludaResult<i32> {
+    let started = Instant::now();
+    let repo = Repository::discover(path).map_err(git_error)?;
+    let root = repo
+        .workdir()
+        .ok_or_else(|| FeludaError::InvalidData("Bare repositories have no index".into()))?
+        .to_path_buf();
+
+    let targets = targets(&staged_files(&repo)?);
+    if targets.is_empty() {
+        log(LogLevel::Info, "No staged manifest or lockfile changes");
+        return Ok(EXIT_CLEAN);
+    }
+
+    let config = match &options.scan_options.config {
+        Some(config) => config.clone(),
+        None => load_config()?,
+    };
+    let project_license = options
+        .scan_options
+        .project_license
+        .clone()
+        .or_else(|| config.project.license.clone())
+        .or_else(|| {
+            detect_project_license(&root.to_string_lossy())
+                .ok()
+                .flatten()
+        });
+    let config_key = serde_json::to_string(&config).map_err(|e| {
+        FeludaError::Serialization(format!("Failed to serialize configuration: {e}"))
+    })?;
+    let baseline = find_baseline(&root, None)?;
+
+    let mut cache = if options.no_cache {
+        ResultCache::default()
+    } else {
+        ResultCache::load()
+    };
+    let mut cache_changed = false;
+    let mut results = Vec::new();
+
+    for target in &targets {
+        let key = cache_key(&repo, target, &config_key, project_license.as_deref())?;
+        if let Some(cached) = cache.entries.get(&key).filter(|_| !options.no_cache) {
+            log_debug("Cached hook result", &target.label());
+            results.push((target, cached.result.clone(), true));
+            continue;
+        }
+
+        let unstaged = unstaged_changes(&repo, target);
+        for file in &unstaged {
+            eprintln!(
+                "feluda: {} has unstaged changes, checking the working tree copy",
+                file.display()
+            );
+        }
+
+        let report = scan(
+            root.join(&target.dir),
+            &ScanOptions {
+                project_license: project_license.clone(),
+                recursive: target.recursive,
+                config: Some(config.clone()),
+                ..options.scan_options.clone()
+            },
+        )?;
+        let result = CheckResult::from_report(&report, baseline.as_ref());
+        // A result from the working tree says nothing about the staged files
+        if unstaged.is_empty() {
+            cache.insert(key, result.clone());
+            cache_changed = true;
+        }
+        results.push((target, result, false));
+    }
+
+    if cache_changed {
+        if let Err(err) = cache.save() {
+            log_error("Failed to save hook results", &err);
+        }
+    }
+
+    let fail_on = &options.threshold.fail_on;
+    let mut findings = Findings::default();
+    for (target, result, cached) in &results {
+        let found = result.findings();
+        findings.policy += found.policy;
+        findings.restrictive += found.restrictive;
+        findings.incompatible += found.incompatible;
+        findings.unknown += found.unknown;
+
+        eprintln!(
+            "feluda: {}: {} dependencies{}",
+            target.label(),
+            result.dependencies,
+            if *cached { " (cached)" } else { "" }
+        );
+        let sections = [
+            ("policy violation", &result.policy, true),
+            (
+                "restrictive",
+                &result.restrictive,
+                fail_on.contains(&FailOn::Restrictive),
+            ),
+            (
+                "incompatible",
+                &result.incompatible,
+                fail_on.contains(&FailOn::Incompatible),
+            ),
+            (
+                "unknown license",
+                &result.unknown,
+                fail_on.contains(&FailOn::Unknown),
+            ),
+        ];
+        for (kind, lines, selected) in sections {
+            for line in lines.iter().filter(|_| selected) {
+                eprintln!("  {kind}: {line}");
+            }
+        }
+    }
+
+    let exit_code = options.threshold.exit_code(&findings);
+    log(
+        LogLevel::Info,
+        &format!("Hook finished in {:?}", started.elapsed()),
+    );
+    if exit_code != EXIT_CLEAN {
+        eprintln!("feluda: commit blocked; fix the dependencies above or commit with --no-verify");
+    }
+    Ok(exit_code)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_targets() {
+        let staged = |paths: &[&str]| -> Vec<PathBuf> { paths.iter().map(PathBuf::from).collect() };
+
+        assert!(targets(&staged(&["src/main.rs", "README.md"])).is_empty());
+        assert_eq!(
+            targets(&staged(&[
+                "Cargo.lock",
+                "Cargo.toml",
+                "web/package.json",
+                "web/src/app.js"
+            ])),
+            vec![
+                Target {
+                    dir: PathBuf::new(),
+                    recursive: false,
+                },
+                Target {
+                    dir: PathBuf::from("web"),
+                    recursive: false,
+                },
+            ]
+        );
+
+        // Root configuration changes check everything
+        assert_eq!(
+            targets(&staged(&["web/package.json", ".feluda.toml"])),
+            vec![Target {
+                dir: PathBuf::new(),
+                recursive: true,
+            }]
+        );
+        assert_eq!(targets(&staged(&["web/.feluda.toml"])).len(), 1);
+        assert!(!targets(&staged(&["web/.feluda.toml"]))[0].recursive);
+    }
+
+    #[test]
+    fn test_target_covers() {
+        let web = Target {
+            dir: PathBuf::from("web"),
+            recursive: false,
+        };
+        assert!(web.covers(Path::new("web/package.json")));
+        assert!(!web.covers(Path::new("web/admin/package.json")));
+        assert!(!web.covers(Path::new("package.json")));
+
+        let all = Target {
+            dir: PathBuf::new(),
+            recursive: true,
+        };
+        assert!(all.covers(Path::new("package.json")));
+        assert!(all.covers(Path::new("web/admin/package.json")));
+    }
+
+    #[test]
+    fn test_install_and_uninstall() {
+        let dir = TempDir::new().unwrap();
+        Repository::init(dir.path()).unwrap();
+        let hook = dir.path().join(".git/hooks/pre-commit");
+
+        assert_eq!(install(dir.path(), false).unwrap(), hook);
+        assert!(is_feluda_hook(&fs::read_to_string(&hook).unwrap()));
+        // Reinstalling our own hook is fine
+        install(dir.path(), false).unwrap();
+        assert_eq!(uninstall(dir.path()).unwrap(), Some(hook.clone()));
+        assert!(!hook.exists());
+        assert_eq!(uninstall(dir.path()).unwrap(), None);
+
+        // Other hooks are kept unless forced
+        fs::write(&hook, "#!/bin/sh\nmake lint\n").unwrap();
+        assert!(install(dir.path(), false).is_err());
+        assert!(uninstall(dir.path()).is_err());
+        install(dir.path(), true).unwrap();
+        assert!(is_feluda_hook(&fs::read_to_string(&hook).unwrap()));
+    }
+
+    #[test]
+    fn test_cache_key_follows_staged_contents() {
+        let dir = TempDir::new().unwrap();
+        let repo = Repository::init(dir.path()).unwrap();
+        let stage = |name: &str, content: &str| {
+            fs::write(dir.path().join(name), content).unwrap();
+            let mut index = repo.index().unwrap();
+            index.add_path(Path::new(name)).unwrap();
+            index.write().unwrap();
+        };
+        let root = Target {
+            dir: PathBuf::new(),
+            recursive: false,
+        };
+        let key = || cache_key(&repo, &root, "{}", Some("MIT")).unwrap();
+
+        stage("package.json", r#"{"dependencies": {}}"#);
+        let first = key();
+        stage("index.js", "console.log(1)");
+        assert_eq!(key(), first);
+        stage("package.json", r#"{"dependencies": {"left-pad": "1.3.0"}}"#);
+        assert_ne!(key(), first);
+        assert_ne!(
+            cache_key(&repo, &root, "{}", Some("Apache-2.0")).unwrap(),
+            key()
+        );
+    }
+}
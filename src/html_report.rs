@@ -0,0 +1,472 @@
+//! Standalone HTML report (`--format html`)
+//!
+//! The page embeds its styles, a small script to sort the dependency table and
+//! an SVG pie chart of the license distribution, so it can be attached to a
+//! release or mailed around without any other files.
+
+use std::collections::BTreeMap;
+use std::f64::consts::PI;
+use std::fmt::Write as _;
+
+use crate::attributions::escape_html;
+use crate::canonical::purl;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::i18n::{language, tr, tr_with};
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::policy::{PolicyViolation, ViolationKind};
+
+/// Licenses beyond this many are grouped into "Other" in the chart
+const MAX_CHART_SLICES: usize = 8;
+
+const CHART_COLORS: &[&str] = &[
+    "#4e79a7", "#f28e2b", "#59a14f", "#e15759", "#76b7b2", "#edc948", "#b07aa1", "#ff9da7",
+    "#9c755f",
+];
+
+const STYLE: &str = r#"
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2rem; color: #24292f; }
+h1 { margin-bottom: 0.25rem; }
+.meta { color: #57606a; margin-top: 0; }
+.cards { display: flex; flex-wrap: wrap; gap: 1rem; margin: 1.5rem 0; }
+.card { border: 1px solid #d0d7de; border-radius: 6px; padding: 0.75rem 1.25rem; min-width: 8rem; }
+.card .value { font-size: 1.75rem; font-weight: 600; }
+.card.bad .value { color: #cf222e; }
+.chart { display: flex; flex-wrap: wrap; align-items: center; gap: 2rem; }
+.legend { list-style: none; padding: 0; }
+.legend li { margin: 0.25rem 0; }
+.swatch { display: inline-block; width: 0.8rem; height: 0.8rem; border-radius: 2px; margin-right: 0.5rem; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #d0d7de; padding: 0.4rem 0.6rem; text-align: left; }
+th { cursor: pointer; user-select: none; background: #f6f8fa; }
+th[data-order="asc"]::after { content: " ▲"; }
+th[data-order="desc"]::after { content: " ▼"; }
+tr.restrictive td, tr.incompatible td { background: #fff5f5; }
+details { border: 1px solid #d0d7de; border-radius: 6px; padding: 0.5rem 1rem; margin: 0.5rem 0; }
+summary { cursor: pointer; font-weight: 600; }
+.reason { display: inline-block; background: #ffebe9; color: #cf222e; border-radius: 1rem; padding: 0 0.6rem; margin-left: 0.5rem; font-size: 0.85em; font-weight: normal; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0.25rem 1rem; }
+dt { color: #57606a; }
+footer { margin-top: 2rem; color: #57606a; font-size: 0.85em; }
+"#;
+
+const SCRIPT: &str = r#"
+function sortTable(th) {
+  var table = th.closest("table");
+  var body = table.tBodies[0];
+  var column = Array.prototype.indexOf.call(th.parentNode.children, th);
+  var ascending = th.dataset.order !== "asc";
+  th.parentNode.querySelectorAll("th").forEach(function (h) { delete h.dataset.order; });
+  th.dataset.order = ascending ? "asc" : "desc";
+  var rows = Array.prototype.slice.call(body.rows);
+  rows.sort(function (a, b) {
+    var x = a.cells[column].textContent, y = b.cells[column].textContent;
+    var order = x.localeCompare(y, undefined, { numeric: true, sensitivity: "base" });
+    return ascending ? order : -order;
+  });
+  rows.forEach(function (row) { body.appendChild(row); });
+}
+"#;
+
+/// A dependency shown in the violations section, with every reason it is there
+struct Violation<'a> {
+    info: &'a LicenseInfo,
+    reasons: Vec<String>,
+}
+
+/// Count dependencies per license, largest first, with the tail grouped as "Other"
+fn license_distribution(data: &[LicenseInfo]) -> Vec<(String, usize)> {
+    let mut counts: BTreeMap<String, usize> = BTreeMap::new();
+    for info in data {
+        *counts.entry(info.get_license()).or_default() += 1;
+    }
+
+    let mut distribution: Vec<(String, usize)> = counts.into_iter().collect();
+    distribution.sort_by(|a, b| b.1.cmp(&a.1).then_with(|| a.0.cmp(&b.0)));
+
+    if distribution.len() > MAX_CHART_SLICES + 1 {
+        let other: usize = distribution
+            .drain(MAX_CHART_SLICES..)
+            .map(|(_, count)| count)
+            .sum();
+        distribution.push((tr("html.other"), other));
+    }
+    distribution
+}
+
+/// SVG pie chart, one slice per entry of the distribution
+fn pie_chart(distribution: &[(String, usize)]) -> String {
+    const CENTER: f64 = 100.0;
+    const RADIUS: f64 = 90.0;
+
+    let total: usize = distribution.iter().map(|(_, count)| count).sum();
+    let mut svg = format!(
+        "<svg width=\"200\" height=\"200\" viewBox=\"0 0 200 200\" role=\"img\" aria-label=\"{}\">\n",
+        tr("html.distribution")
+    );
+
+    // Start at twelve o'clock and go clockwise
+    let mut angle = -PI / 2.0;
+    for (index, (license, count)) in distribution.iter().enumerate() {
+        let color = CHART_COLORS[index % CHART_COLORS.len()];
+        let title = format!("<title>{}: {count}</title>", escape_html(license));
+
+        if *count == total {
+            let _ = writeln!(
+                svg,
+                "<circle cx=\"{CENTER}\" cy=\"{CENTER}\" r=\"{RADIUS}\" fill=\"{color}\">{title}</circle>"
+            );
+            break;
+        }
+
+        let sweep = *count as f64 / total as f64 * 2.0 * PI;
+        let (x1, y1) = (CENTER + RADIUS * angle.cos(), CENTER + RADIUS * angle.sin());
+        angle += sweep;
+        let (x2, y2) = (CENTER + RADIUS * angle.cos(), CENTER + RADIUS * angle.sin());
+        let large_arc = u8::from(sweep > PI);
+        let _ = writeln!(
+            svg,
+            "<path d=\"M{CENTER},{CENTER} L{x1:.2},{y1:.2} A{RADIUS},{RADIUS} 0 {large_arc} 1 {x2:.2},{y2:.2} Z\" fill=\"{color}\">{title}</path>"
+        );
+    }
+
+    svg.push_str("</svg>\n");
+    svg
+}
+
+fn collect_violations<'a>(
+    data: &'a [LicenseInfo],
+    project_license: Option<&str>,
+    policy_violations: &[PolicyViolation],
+) -> Vec<Violation<'a>> {
+    data.iter()
+        .filter_map(|info| {
+            let mut reasons = Vec::new();
+            if info.is_restrictive {
+                reasons.push(tr("html.restrictive_license"));
+            }
+            if info.compatibility == LicenseCompatibility::Incompatible {
+                reasons.push(match project_license {
+                    Some(project_license) => {
+                        tr_with("html.incompatible_with", &[("license", &project_license)])
+                    }
+                    None => tr("report.incompatible"),
+                });
+            }
+            if let Some(error) = &info.error {
+                reasons.push(tr_with("html.lookup_failed", &[("error", error)]));
+            }
+            for violation in policy_violations
+                .iter()
+                .filter(|v| v.name == info.name && v.version == info.version)
+            {
+                reasons.push(tr(match violation.kind {
+                    ViolationKind::Denied => "html.denied",
+                    ViolationKind::NotAllowed => "html.not_allowed",
+                    ViolationKind::ChoiceRequired => "html.choice_required",
+                    ViolationKind::Deprecated => "html.deprecated",
+                    ViolationKind::Yanked => "html.yanked",
+                    ViolationKind::Archived => "html.archived",
+                    ViolationKind::MissingLicense => "html.missing_license",
+                    ViolationKind::UnrecognizedLicense => "html.unrecognized_license",
+                    ViolationKind::PatentTerms => "html.patent_terms",
+                    ViolationKind::Eula => "html.eula",
+                    ViolationKind::CommercialLicense => "html.commercial_license",
+                    ViolationKind::ContributorAgreement => "html.contributor_agreement",
+                }));
+            }
+            if let Some(vulns) = info.vulnerabilities.as_ref().filter(|v| !v.is_empty()) {
+                reasons.push(tr_with(
+                    "html.known_vulnerabilities",
+                    &[("count", &vulns.len())],
+                ));
+            }
+
+            (!reasons.is_empty()).then_some(Violation { info, reasons })
+        })
+        .collect()
+}
+
+fn violation_details(violation: &Violation) -> String {
+    let info = violation.info;
+    let mut out = String::from("<details>\n<summary>");
+    let _ = write!(
+        out,
+        "{} {}",
+        escape_html(&info.name),
+        escape_html(&info.version)
+    );
+    for reason in &violation.reasons {
+        let _ = write!(out, "<span class=\"reason\">{}</span>", escape_html(reason));
+    }
+    out.push_str("</summary>\n<dl>\n");
+
+    let mut field = |key: &str, value: &str| {
+        let _ = writeln!(
+            out,
+            "<dt>{}</dt><dd>{}</dd>",
+            escape_html(&tr(key)),
+            escape_html(value)
+        );
+    };
+    field("report.license", &info.get_license());
+    field("html.package_url", &purl(info));
+    field("report.compatibility", &info.compatibility.to_string());
+    field("html.osi_status", &info.osi_status.to_string());
+    if let Some(tier) = &info.tier {
+        field("html.risk_tier", tier);
+    }
+    if let Some(error) = &info.error {
+        field("html.lookup_error", error);
+    }
+    if let Some(obligations) = &info.obligations {
+        field("report.obligations", &obligations.summary());
+    }
+    if let Some(chain) = info.introduced_by() {
+        field("html.introduced_by", &chain);
+    }
+    if let Some(source_file) = &info.source_file {
+        field("html.found_in", source_file);
+    }
+    if let Some(vulns) = info.vulnerabilities.as_ref().filter(|v| !v.is_empty()) {
+        let ids: Vec<String> = vulns
+            .iter()
+            .map(|v| match &v.summary {
+                Some(summary) => format!("{} ({summary})", v.id),
+                None => v.id.clone(),
+            })
+            .collect();
+        field("html.vulnerabilities", &ids.join(", "));
+    }
+
+    out.push_str("</dl>\n</details>\n");
+    out
+}
+
+/// Render the complete HTML document
+pub fn render_html_report(
+    project_name: &str,
+    data: &[LicenseInfo],
+    project_license: Option<&str>,
+    policy_violations: &[PolicyViolation],
+) -> String {
+    let violations = collect_violations(data, project_license, policy_violations);
+    let restrictive = data.iter().filter(|info| info.is_restrictive).count();
+    let incompatible = data
+        .iter()
+        .filter(|info| info.compatibility == LicenseCompatibility::Incompatible)
+        .count();
+    let unlicensed = data.iter().filter(|info| info.license.is_none()).count();
+    let has_tiers = data.iter().any(|info| info.tier.is_some());
+
+    let title = escape_html(&tr_with("html.title", &[("project", &project_name)]));
+    let mut out = String::new();
+    let _ = write!(
+        out,
+        "<!DOCTYPE html>\n<html lang=\"{}\">\n<head>\n<meta charset=\"utf-8\">\n<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n<title>{title}</title>\n<style>{STYLE}</style>\n</head>\n<body>\n<h1>{title}</h1>\n",
+        language()
+    );
+    let _ = writeln!(
+        out,
+        "<p class=\"meta\">{}</p>",
+        escape_html(&tr_with(
+            "html.meta",
+            &[
+                (
+                    "license",
+                    &project_license.map_or_else(|| tr("html.not_specified"), str::to_string)
+                ),
+                ("date", &chrono::Utc::now().format("%Y-%m-%d %H:%M UTC")),
+            ]
+        ))
+    );
+
+    out.push_str("<div class=\"cards\">\n");
+    for (label, value, bad) in [
+        ("report.dependencies", data.len(), false),
+        ("report.restrictive", restrictive, restrictive > 0),
+        ("report.incompatible", incompatible, incompatible > 0),
+        (
+            "html.policy_violations",
+            policy_violations.len(),
+            !policy_violations.is_empty(),
+        ),
+        ("html.no_license", unlicensed, unlicensed > 0),
+    ] {
+        let label = escape_html(&tr(label));
+        let class = if bad { "card bad" } else { "card" };
+        let _ = writeln!(
+            out,
+            "<div class=\"{class}\"><div class=\"value\">{value}</div>{label}</div>"
+        );
+    }
+    out.push_str("</div>\n");
+
+    if !data.is_empty() {
+        let distribution = license_distribution(data);
+        let _ = writeln!(out, "<h2>{}</h2>", escape_html(&tr("html.distribution")));
+        out.push_str("<div class=\"chart\">\n");
+        out.push_str(&pie_chart(&distribution));
+        out.push_str("<ul class=\"legend\">\n");
+        for (index, (license, count)) in distribution.iter().enumerate() {
+            let _ = writeln!(
+                out,
+                "<li><span class=\"swatch\" style=\"background: {}\"></span>{} — {count} ({:.1}%)</li>",
+                CHART_COLORS[index % CHART_COLORS.len()],
+                escape_html(license),
+                *count as f64 * 100.0 / data.len() as f64
+            );
+        }
+        out.push_str("</ul>\n</div>\n");
+    }
+
+    let _ = writeln!(
+        out,
+        "<h2>{}</h2>",
+        escape_html(&tr_with("html.violations", &[("count", &violations.len())]))
+    );
+    if violations.is_empty() {
+        let _ = writeln!(out, "<p>{}</p>", escape_html(&tr("html.no_issues")));
+    }
+    for violation in &violations {
+        out.push_str(&violation_details(violation));
+    }
+
+    let _ = writeln!(out, "<h2>{}</h2>", escape_html(&tr("report.dependencies")));
+    out.push_str("<table>\n<thead>\n<tr>");
+    let mut headers = vec![
+        "report.name",
+        "report.version",
+        "report.license",
+        "report.restrictive",
+        "report.compatibility",
+        "report.osi_status",
+    ];
+    if has_tiers {
+        headers.push("report.tier");
+    }
+    for header in headers {
+        let _ = write!(
+            out,
+            "<th onclick=\"sortTable(this)\">{}</th>",
+            escape_html(&tr(header))
+        );
+    }
+    out.push_str("</tr>\n</thead>\n<tbody>\n");
+
+    for info in data {
+        let class = if info.is_restrictive {
+            " class=\"restrictive\""
+        } else if info.compatibility == LicenseCompatibility::Incompatible {
+            " class=\"incompatible\""
+        } else {
+            ""
+        };
+        let _ = write!(
+            out,
+            "<tr{class}><td title=\"{}\">{}</td><td>{}</td><td>{}</td><td>{}</td><td>{}</td><td>{}</td>",
+            escape_html(&purl(info)),
+            escape_html(&info.name),
+            escape_html(&info.version),
+            escape_html(&info.get_license()),
+            tr(if info.is_restrictive { "html.yes" } else { "html.no" }),
+            info.compatibility,
+            info.osi_status
+        );
+        if has_tiers {
+            let _ = write!(
+                out,
+                "<td>{}</td>",
+                escape_html(info.tier.as_deref().unwrap_or(""))
+            );
+        }
+        out.push_str("</tr>\n");
+    }
+    out.push_str("</tbody>\n</table>\n");
+
+    let _ = write!(
+        out,
+        "<footer>{} <a href=\"https://github.com/anistark/feluda\">Feluda</a> {}</footer>\n<script>{SCRIPT}</script>\n</body>\n</html>\n",
+        escape_html(&tr("html.generated_by")),
+        env!("CARGO_PKG_VERSION")
+    );
+    out
+}
+
+/// Write the HTML report to `output_file`, or print it to stdout
+pub fn write_html_report(
+    project_name: &str,
+    data: &[LicenseInfo],
+    project_license: Option<&str>,
+    policy_violations: &[PolicyViolation],
+    output_file: Option<&str>,
+) -> FeludaResult<()> {
+    let content = render_html_report(project_name, data, project_license, policy_violations);
+
+    match output_file {
+        Some(file_path) => {
+            std::fs::write(file_path, &content)
+                .map_err(|e| FeludaError::FileWrite(format!("Failed to write HTML report: {e}")))?;
+            log(
+                LogLevel::Info,
+                &format!("HTML report written to: {file_path}"),
+            );
+        }
+        None => println!("{}", content.trim_end()),
+    }
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+
+    fn dep(name: &str, license: Option<&str>, is_restrictive: bool) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            ..LicenseInfo::test(name, "1.0.0", license)
+        }
+    }
+
+    #[test]
+    fn test_license_distribution_groups_tail() {
+        let mut data: Vec<LicenseInfo> = (0..12)
+            .map(|i| dep(&format!("pkg{i}"), Some(&format!("License-{i}")), false))
+            .collect();
+        data.push(dep("extra", Some("License-0"), false));
+
+        let distribution = license_distribution(&data);
+        assert_eq!(distribution.len(), MAX_CHART_SLICES + 1);
+        assert_eq!(distribution[0], ("License-0".to_string(), 2));
+        assert_eq!(distribution.last().unwrap(), &("Other".to_string(), 4));
+    }
+
+    #[test]
+    fn test_render_html_report() {
+        let mut gpl = dep("<script>", Some("GPL-3.0"), true);
+        gpl.compatibility = LicenseCompatibility::Incompatible;
+        gpl.dependency_path = Some(vec!["app".to_string(), "<script>".to_string()]);
+        let data = vec![dep("serde", Some("MIT"), false), gpl];
+
+        let html = render_html_report("demo", &data, Some("MIT"), &[]);
+        assert!(html.starts_with("<!DOCTYPE html>"));
+        assert!(html.contains("<svg"));
+        assert!(html.contains("<th onclick=\"sortTable(this)\">License</th>"));
+        assert!(html.contains("<span class=\"reason\">Incompatible with MIT</span>"));
+        assert!(html.contains("<dt>Introduced by</dt><dd>app</dd>"));
+        assert!(html.contains("<dt>Package URL</dt><dd>pkg:generic/%3Cscript%3E@"));
+        assert!(html.contains("&lt;script&gt;"));
+        assert!(!html.contains("<td><script></td>"));
+        assert_eq!(html.matches("<details>").count(), 1);
+    }
+
+    #[test]
+    fn test_pie_chart_single_license() {
+        let chart = pie_chart(&[("MIT".to_string(), 3)]);
+        assert!(chart.contains("<circle"));
+        assert!(!chart.contains("<path"));
+    }
+}
@@ -0,0 +1,219 @@
+//! Translated messages for reports and CLI errors
+//!
+//! `--lang` (or `FELUDA_LANG`) picks the language of the text reports, the
+//! obligation summaries, the HTML report and the errors printed when Feluda
+//! fails. The catalogs live in `config/i18n/<code>.toml` and are embedded in
+//! the binary; a message missing from one falls back to English.
+//!
+//! Machine-readable output (JSON, YAML, SARIF, SBOMs, CI reports) stays in
+//! English so tools parsing it keep working, and so do log lines.
+
+use std::collections::HashMap;
+use std::sync::atomic::{AtomicU8, Ordering};
+use std::sync::OnceLock;
+
+/// Languages with a message catalog
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Hash)]
+pub enum Language {
+    #[default]
+    En,
+    De,
+    Fr,
+    Es,
+    Ja,
+}
+
+impl Language {
+    pub const ALL: [Language; 5] = [
+        Language::En,
+        Language::De,
+        Language::Fr,
+        Language::Es,
+        Language::Ja,
+    ];
+
+    /// ISO 639-1 code, also the name of the catalog file
+    pub fn code(&self) -> &'static str {
+        match self {
+            Language::En => "en",
+            Language::De => "de",
+            Language::Fr => "fr",
+            Language::Es => "es",
+            Language::Ja => "ja",
+        }
+    }
+
+    fn catalog_source(&self) -> &'static str {
+        match self {
+            Language::En => include_str!("../config/i18n/en.toml"),
+            Language::De => include_str!("../config/i18n/de.toml"),
+            Language::Fr => include_str!("../config/i18n/fr.toml"),
+            Language::Es => include_str!("../config/i18n/es.toml"),
+            Language::Ja => include_str!("../config/i18n/ja.toml"),
+        }
+    }
+}
+
+impl std::fmt::Display for Language {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(self.code())
+    }
+}
+
+/// Parse `--lang`, accepting locale names like `de-DE` or `de_DE.UTF-8`
+pub fn parse_language(value: &str) -> Result<Language, String> {
+    let primary = value
+        .split(['-', '_', '.'])
+        .next()
+        .unwrap_or_default()
+        .to_ascii_lowercase();
+    Language::ALL
+        .into_iter()
+        .find(|language| language.code() == primary)
+        .ok_or_else(|| {
+            let codes: Vec<_> = Language::ALL.iter().map(Language::code).collect();
+            format!(
+                "unsupported language '{value}', expected one of {}",
+                codes.join(", ")
+            )
+        })
+}
+
+// Index into Language::ALL of the selected language
+static LANGUAGE: AtomicU8 = AtomicU8::new(0);
+
+/// Select the language of reports and errors
+pub fn set_language(language: Language) {
+    let index = Language::ALL
+        .iter()
+        .position(|candidate| *candidate == language)
+        .unwrap_or_default();
+    LANGUAGE.store(index as u8, Ordering::Relaxed);
+}
+
+/// The selected language, English unless `--lang` was given
+pub fn language() -> Language {
+    Language::ALL
+        .get(LANGUAGE.load(Ordering::Relaxed) as usize)
+        .copied()
+        .unwrap_or_default()
+}
+
+type Catalog = HashMap<String, String>;
+
+fn catalogs() -> &'static HashMap<Language, Catalog> {
+    static CATALOGS: OnceLock<HashMap<Language, Catalog>> = OnceLock::new();
+    CATALOGS.get_or_init(|| {
+        Language::ALL
+            .into_iter()
+            .map(|language| (language, parse_catalog(language.catalog_source())))
+            .collect()
+    })
+}
+
+/// Flatten `[report] name = "Name"` into `report.name`
+fn parse_catalog(source: &str) -> Catalog {
+    fn flatten(prefix: &str, table: &toml::Table, catalog: &mut Catalog) {
+        for (key, value) in table {
+            let key = if prefix.is_empty() {
+                key.clone()
+            } else {
+                format!("{prefix}.{key}")
+            };
+            match value {
+                toml::Value::Table(table) => flatten(&key, table, catalog),
+                toml::Value::String(message) => {
+                    catalog.insert(key, message.clone());
+                }
+                _ => {}
+            }
+        }
+    }
+
+    let mut catalog = Catalog::new();
+    // The catalogs are embedded and covered by tests, so this doesn't fail at runtime
+    if let Ok(table) = source.parse::<toml::Table>() {
+        flatten("", &table, &mut catalog);
+    }
+    catalog
+}
+
+/// The message for `key` in `language`, falling back to English and then to the key
+pub fn message(language: Language, key: &str) -> String {
+    let catalogs = catalogs();
+    [language, Language::En]
+        .iter()
+        .find_map(|language| catalogs.get(language)?.get(key))
+        .cloned()
+        .unwrap_or_else(|| key.to_string())
+}
+
+/// The message for `key` in the selected language
+pub fn tr(key: &str) -> String {
+    message(language(), key)
+}
+
+/// Like [`tr`], filling in `{name}` placeholders
+pub fn tr_with(key: &str, args: &[(&str, &dyn std::fmt::Display)]) -> String {
+    args.iter().fold(tr(key), |message, (name, value)| {
+        message.replace(&format!("{{{name}}}"), &value.to_string())
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::collections::BTreeSet;
+
+    fn placeholders(message: &str) -> BTreeSet<String> {
+        message
+            .split('{')
+            .skip(1)
+            .filter_map(|rest| rest.split_once('}').map(|(name, _)| name.to_string()))
+            .collect()
+    }
+
+    #[test]
+    fn test_catalogs_match_english() {
+        let catalogs = catalogs();
+        let english = &catalogs[&Language::En];
+        assert!(english.contains_key("report.license_summary"));
+
+        for language in Language::ALL {
+            let catalog = &catalogs[&language];
+            let keys: BTreeSet<_> = catalog.keys().collect();
+            let expected: BTreeSet<_> = english.keys().collect();
+            assert_eq!(keys, expected, "keys of the {language} catalog");
+
+            for (key, message) in catalog {
+                assert_eq!(
+                    placeholders(message),
+                    placeholders(&english[key]),
+                    "placeholders of {key} in the {language} catalog"
+                );
+            }
+        }
+    }
+
+    #[test]
+    fn test_message_fallback() {
+        assert_eq!(message(Language::De, "report.license"), "Lizenz");
+        assert_eq!(message(Language::En, "report.license"), "License");
+        assert_eq!(message(Language::Ja, "no.such.key"), "no.such.key");
+        assert_eq!(
+            tr_with("report.total_scanned", &[("count", &3)]),
+            "Total dependencies scanned: 3"
+        );
+    }
+
+    #[test]
+    fn test_parse_language() {
+        assert_eq!(parse_language("de"), Ok(Language::De));
+        assert_eq!(parse_language("fr-FR"), Ok(Language::Fr));
+        assert_eq!(parse_language("ja_JP.UTF-8"), Ok(Language::Ja));
+        assert_eq!(parse_language("EN"), Ok(Language::En));
+        assert!(parse_language("xx")
+            .unwrap_err()
+            .contains("en, de, fr, es, ja"));
+    }
+}
@@ -0,0 +1,303 @@
+//! Applying image layers to a root filesystem
+//!
+//! Layers are tar archives, usually gzip-compressed, applied bottom first. A
+//! file named `.wh.<name>` deletes `<name>` from the layers below, and
+//! `.wh..wh..opq` empties its directory. Only the files license detection
+//! reads are extracted, so the root filesystem stays small.
+
+use flate2::read::GzDecoder;
+use std::fs::{self, File};
+use std::io::{self, BufReader, Read};
+use std::path::{Component, Path, PathBuf};
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::license_detector::LICENSE_FILE_PREFIXES;
+
+const WHITEOUT_PREFIX: &str = ".wh.";
+const OPAQUE_WHITEOUT: &str = ".wh..wh..opq";
+
+const GZIP_MAGIC: [u8; 2] = [0x1f, 0x8b];
+const ZSTD_MAGIC: [u8; 4] = [0x28, 0xb5, 0x2f, 0xfd];
+
+/// Package databases of the supported distributions
+const PACKAGE_DATABASES: [&str; 5] = [
+    "var/lib/dpkg/status",
+    "var/lib/dpkg/status.d/",
+    "lib/apk/db/installed",
+    "var/lib/rpm/",
+    "usr/lib/sysimage/rpm/",
+];
+
+/// Open a layer, decompressing it when needed
+fn open_layer(path: &Path) -> FeludaResult<tar::Archive<Box<dyn Read>>> {
+    let mut magic = [0u8; 4];
+    let read = File::open(path)?.read(&mut magic)?;
+    let reader = BufReader::new(File::open(path)?);
+
+    let reader: Box<dyn Read> = if magic[..read].starts_with(&GZIP_MAGIC) {
+        Box::new(GzDecoder::new(reader))
+    } else if magic[..read] == ZSTD_MAGIC {
+        return Err(FeludaError::Image(format!(
+            "{} is zstd-compressed, which is not supported yet",
+            path.display()
+        )));
+    } else {
+        Box::new(reader)
+    };
+    Ok(tar::Archive::new(reader))
+}
+
+/// Relative path of a layer entry, `None` if it would escape the root
+fn entry_path(path: &Path) -> Option<PathBuf> {
+    let mut clean = PathBuf::new();
+    for component in path.components() {
+        match component {
+            Component::Normal(part) => clean.push(part),
+            Component::CurDir | Component::RootDir => {}
+            Component::ParentDir | Component::Prefix(_) => return None,
+        }
+    }
+    (!clean.as_os_str().is_empty()).then_some(clean)
+}
+
+fn is_license_file(file_name: &str) -> bool {
+    let upper = file_name.to_uppercase();
+    LICENSE_FILE_PREFIXES
+        .iter()
+        .any(|prefix| upper.starts_with(prefix))
+        || upper.starts_with("NOTICE")
+}
+
+/// Whether license detection reads the file at `path`
+pub fn is_relevant(path: &Path) -> bool {
+    let path_str = path.to_string_lossy();
+    if PACKAGE_DATABASES.iter().any(|db| {
+        if db.ends_with('/') {
+            path_str.starts_with(db)
+        } else {
+            path_str == *db
+        }
+    }) {
+        return true;
+    }
+
+    let Some(file_name) = path.file_name().map(|name| name.to_string_lossy()) else {
+        return false;
+    };
+    let parent = path
+        .parent()
+        .and_then(Path::file_name)
+        .map(|name| name.to_string_lossy())
+        .unwrap_or_default();
+    let grandparent = path
+        .parent()
+        .and_then(Path::parent)
+        .and_then(Path::file_name)
+        .map(|name| name.to_string_lossy())
+        .unwrap_or_default();
+
+    // Debian copyright files, /usr/share/doc/<package>/copyright
+    if file_name == "copyright"
+        && path.parent().and_then(Path::parent) == Some(Path::new("usr/share/doc"))
+    {
+        return true;
+    }
+    // npm packages
+    if path.components().any(|c| c.as_os_str() == "node_modules")
+        && (file_name == "package.json" || is_license_file(&file_name))
+    {
+        return true;
+    }
+    // Python distributions, including PEP 639 `licenses/` directories
+    if parent.ends_with(".dist-info") && (file_name == "METADATA" || is_license_file(&file_name)) {
+        return true;
+    }
+    if path_str.contains(".dist-info/licenses/") {
+        return true;
+    }
+    // Installed gems: specifications/<gem>.gemspec and gems/<gem>/LICENSE
+    (parent == "specifications" && file_name.ends_with(".gemspec"))
+        || (grandparent == "gems" && is_license_file(&file_name))
+}
+
+/// Remove `path` whether it is a file or a directory
+fn remove_path(path: &Path) -> io::Result<()> {
+    match fs::symlink_metadata(path) {
+        Ok(metadata) if metadata.is_dir() => fs::remove_dir_all(path),
+        Ok(_) => fs::remove_file(path),
+        Err(err) if err.kind() == io::ErrorKind::NotFound => Ok(()),
+        Err(err) => Err(err),
+    }
+}
+
+/// Apply the whiteouts of a layer to the layers below it
+fn apply_whiteouts(layer: &Path, root: &Path) -> FeludaResult<()> {
+    let mut archive = open_layer(layer)?;
+    for entry in archive.entries()? {
+        let entry = entry?;
+        let Some(path) = entry_path(&entry.path()?) else {
+            continue;
+        };
+        let Some(file_name) = path
+            .file_name()
+            .map(|name| name.to_string_lossy().to_string())
+        else {
+            continue;
+        };
+        let dir = root.join(path.parent().unwrap_or(Path::new("")));
+
+        if file_name == OPAQUE_WHITEOUT {
+            for child in fs::read_dir(&dir).into_iter().flatten().flatten() {
+                remove_path(&child.path())?;
+            }
+        } else if let Some(name) = file_name.strip_prefix(WHITEOUT_PREFIX) {
+            // `.wh.`, `.wh..` and `.wh...` would remove the directory or its parent
+            if matches!(name, "" | "." | "..") {
+                log(
+                    LogLevel::Warn,
+                    &format!("Skipping invalid whiteout {}", path.display()),
+                );
+                continue;
+            }
+            remove_path(&dir.join(name))?;
+        }
+    }
+    Ok(())
+}
+
+/// Apply one layer to the root filesystem at `root`
+pub fn apply_layer(layer: &Path, root: &Path) -> FeludaResult<()> {
+    apply_whiteouts(layer, root)?;
+
+    let mut extracted = 0;
+    let mut archive = open_layer(layer)?;
+    for entry in archive.entries()? {
+        let mut entry = entry?;
+        let Some(path) = entry_path(&entry.path()?) else {
+            log(
+                LogLevel::Warn,
+                &format!("Skipping layer entry outside the root: {:?}", entry.path()),
+            );
+            continue;
+        };
+        if path
+            .file_name()
+            .is_some_and(|name| name.to_string_lossy().starts_with(WHITEOUT_PREFIX))
+            || !is_relevant(&path)
+        {
+            continue;
+        }
+
+        let target = root.join(&path);
+        match entry.header().entry_type() {
+            tar::EntryType::Regular | tar::EntryType::Continuous => {
+                if let Some(parent) = target.parent() {
+                    fs::create_dir_all(parent)?;
+                }
+                remove_path(&target)?;
+                io::copy(&mut entry, &mut File::create(&target)?)?;
+                extracted += 1;
+            }
+            tar::EntryType::Link => {
+                // Hard links point at files earlier in the same or a lower layer
+                let source = entry
+                    .link_name()?
+                    .as_deref()
+                    .and_then(entry_path)
+                    .map(|source| root.join(source));
+                if let Some(source) = source.filter(|source| source.is_file()) {
+                    if let Some(parent) = target.parent() {
+                        fs::create_dir_all(parent)?;
+                    }
+                    fs::copy(source, &target)?;
+                    extracted += 1;
+                }
+            }
+            // Symlinks may point anywhere on the host, so they are not followed
+            _ => {}
+        }
+    }
+
+    log(
+        LogLevel::Info,
+        &format!("Extracted {extracted} files from {}", layer.display()),
+    );
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_entry_path() {
+        assert_eq!(
+            entry_path(Path::new("./var/lib/dpkg/status")),
+            Some(PathBuf::from("var/lib/dpkg/status"))
+        );
+        assert_eq!(
+            entry_path(Path::new("/lib/apk/db/installed")),
+            Some(PathBuf::from("lib/apk/db/installed"))
+        );
+        assert_eq!(entry_path(Path::new("../../etc/passwd")), None);
+        assert_eq!(entry_path(Path::new("./")), None);
+    }
+
+    #[test]
+    fn test_apply_whiteouts() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let root = temp_dir.path().join("root");
+        let status = root.join("var/lib/dpkg/status");
+        let gone = root.join("var/lib/dpkg/gone");
+        fs::create_dir_all(status.parent().unwrap()).unwrap();
+        fs::write(&status, "Package: bash\n").unwrap();
+        fs::write(&gone, "").unwrap();
+
+        let layer = temp_dir.path().join("layer.tar");
+        let mut builder = tar::Builder::new(File::create(&layer).unwrap());
+        for path in [
+            "var/lib/dpkg/.wh.gone",
+            "var/lib/dpkg/.wh.",
+            "var/lib/dpkg/.wh..",
+            "var/lib/dpkg/.wh...",
+        ] {
+            let mut header = tar::Header::new_gnu();
+            header.set_size(0);
+            header.set_mode(0o644);
+            header.set_cksum();
+            builder.append_data(&mut header, path, io::empty()).unwrap();
+        }
+        builder.finish().unwrap();
+
+        apply_whiteouts(&layer, &root).unwrap();
+        assert!(!gone.exists());
+        assert!(status.exists());
+    }
+
+    #[test]
+    fn test_is_relevant() {
+        for path in [
+            "var/lib/dpkg/status",
+            "var/lib/dpkg/status.d/base-files",
+            "usr/share/doc/libc6/copyright",
+            "lib/apk/db/installed",
+            "var/lib/rpm/rpmdb.sqlite",
+            "usr/lib/node_modules/npm/package.json",
+            "app/node_modules/@babel/core/LICENSE",
+            "usr/lib/python3/dist-packages/requests-2.31.0.dist-info/METADATA",
+            "usr/lib/python3.12/site-packages/rich-13.7.0.dist-info/licenses/LICENSE",
+            "usr/local/bundle/specifications/rake-13.1.0.gemspec",
+            "usr/local/bundle/gems/rack-3.0.8/LICENSE.md",
+        ] {
+            assert!(is_relevant(Path::new(path)), "{path}");
+        }
+        for path in [
+            "usr/bin/bash",
+            "usr/share/doc/libc6/changelog.gz",
+            "app/node_modules/express/index.js",
+            "usr/local/bundle/gems/rake-13.1.0/lib/rake.rb",
+        ] {
+            assert!(!is_relevant(Path::new(path)), "{path}");
+        }
+    }
+}
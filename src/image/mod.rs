@@ -0,0 +1,445 @@
+//! Container image and root filesystem scanning (`feluda image`, `feluda filesystem`)
+//!
+//! The image is pulled from its registry, or read from a `docker save`
+//! archive or OCI layout, and its layers are applied to a temporary root
+//! filesystem. `feluda filesystem` scans a root filesystem directory, such as
+//! a mounted disk image, or a `docker export` tarball instead. Licenses are
+//! then read from:
+//!
+//! - the distribution's package database (dpkg, apk or rpm), see [`os_packages`]
+//! - npm packages in any `node_modules` directory
+//! - Python distributions (`*.dist-info/METADATA`)
+//! - installed gems (`specifications/*.gemspec`)
+
+pub mod layers;
+pub mod oci;
+pub mod os_packages;
+
+use regex::Regex;
+use serde_json::json;
+use std::fs;
+use std::path::{Path, PathBuf};
+use tempfile::TempDir;
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::languages::python::license_from_pypi_info;
+use crate::languages::ruby::license_from_gem_licenses;
+use crate::licenses::{DependencyScope, LicenseInfo};
+use crate::vendored::{analyze_packages, node_modules_packages, VendoredPackage};
+
+use oci::{local_image_layers, pull_image_layers, ImageReference, Platform};
+
+/// Directories of a live system that hold no installed packages
+const VIRTUAL_FILESYSTEMS: [&str; 4] = ["dev", "proc", "run", "sys"];
+
+/// Root filesystem of an image, removed when dropped if it was extracted
+#[derive(Debug)]
+pub struct ImageFilesystem {
+    _work_dir: Option<TempDir>,
+    pub root: PathBuf,
+}
+
+/// Root filesystem at `path`, extracted first if it is a tar archive
+pub fn load_filesystem(path: &Path) -> FeludaResult<ImageFilesystem> {
+    if path.is_dir() {
+        return Ok(ImageFilesystem {
+            _work_dir: None,
+            root: path.to_path_buf(),
+        });
+    }
+    if !path.is_file() {
+        return Err(FeludaError::InvalidData(format!(
+            "{} is neither a directory nor a tar archive",
+            path.display()
+        )));
+    }
+
+    let work_dir = TempDir::new()
+        .map_err(|e| FeludaError::TempDir(format!("Failed to create temporary directory: {e}")))?;
+    let root = work_dir.path().join("rootfs");
+    fs::create_dir_all(&root)?;
+    log(
+        LogLevel::Info,
+        &format!("Extracting root filesystem {}", path.display()),
+    );
+    layers::apply_layer(path, &root)?;
+    Ok(ImageFilesystem {
+        _work_dir: Some(work_dir),
+        root,
+    })
+}
+
+/// Fetch an image and assemble its root filesystem
+///
+/// `reference` is a path to a local image archive or OCI layout if one exists,
+/// otherwise an image reference to pull. `platform` selects the image of a
+/// multi-platform index and defaults to Linux on the host's architecture.
+pub fn load_image(
+    reference: &str,
+    platform: Option<&str>,
+    credentials: Option<(String, String)>,
+) -> FeludaResult<ImageFilesystem> {
+    let platform = match platform {
+        Some(platform) => Platform::parse(platform)?,
+        None => Platform::host(),
+    };
+    let work_dir = TempDir::new()
+        .map_err(|e| FeludaError::TempDir(format!("Failed to create temporary directory: {e}")))?;
+
+    let local = Path::new(reference);
+    let layers = if local.exists() {
+        log(
+            LogLevel::Info,
+            &format!("Reading local image {}", local.display()),
+        );
+        local_image_layers(local, &platform, work_dir.path())?
+    } else {
+        let image = ImageReference::parse(reference)?;
+        log(
+            LogLevel::Info,
+            &format!(
+                "Pulling {}/{}:{} for {platform}",
+                image.registry, image.repository, image.reference
+            ),
+        );
+        pull_image_layers(&image, &platform, credentials.as_ref(), work_dir.path())?
+    };
+
+    let root = work_dir.path().join("rootfs");
+    fs::create_dir_all(&root)?;
+    for (index, layer) in layers.iter().enumerate() {
+        log(
+            LogLevel::Info,
+            &format!("Applying layer {}/{}", index + 1, layers.len()),
+        );
+        layers::apply_layer(layer, &root)?;
+        // Pulled layers are no longer needed once applied
+        if layer.starts_with(work_dir.path()) {
+            fs::remove_file(layer)?;
+        }
+    }
+
+    Ok(ImageFilesystem {
+        _work_dir: Some(work_dir),
+        root,
+    })
+}
+
+/// Analyze the packages installed in an image's root filesystem
+pub fn analyze_image_filesystem(root: &Path, config: &FeludaConfig) -> Vec<LicenseInfo> {
+    let mut packages = os_packages::os_packages(root);
+    let language_packages = language_packages(root);
+    log(
+        LogLevel::Info,
+        &format!(
+            "Found {} OS packages and {} language packages in the root filesystem",
+            packages.len(),
+            language_packages.len()
+        ),
+    );
+    packages.extend(language_packages);
+
+    if packages.is_empty() {
+        log(
+            LogLevel::Warn,
+            "No packages found in the root filesystem (no dpkg, apk or rpm database and no language packages)",
+        );
+        return Vec::new();
+    }
+
+    analyze_packages(packages, root, config)
+}
+
+/// Sorted subdirectories of `dir`
+///
+/// Symbolic links are not followed, absolute ones would leave the root.
+fn subdirectories(dir: &Path) -> Vec<PathBuf> {
+    let mut dirs: Vec<PathBuf> = fs::read_dir(dir)
+        .into_iter()
+        .flatten()
+        .filter_map(|entry| entry.ok())
+        .filter(|entry| entry.file_type().is_ok_and(|file_type| file_type.is_dir()))
+        .map(|entry| entry.path())
+        .collect();
+    dirs.sort();
+    dirs
+}
+
+/// npm, Python and Ruby packages anywhere in the root filesystem
+fn language_packages(root: &Path) -> Vec<VendoredPackage> {
+    let mut packages = Vec::new();
+    let mut pending = vec![root.to_path_buf()];
+    while let Some(dir) = pending.pop() {
+        for subdir in subdirectories(&dir).into_iter().rev() {
+            let name = subdir
+                .file_name()
+                .map(|name| name.to_string_lossy().to_string())
+                .unwrap_or_default();
+            if dir == root && VIRTUAL_FILESYSTEMS.contains(&name.as_str()) {
+                continue;
+            }
+            if name == "node_modules" {
+                // Nested node_modules are walked by node_modules_packages
+                packages.extend(node_modules_packages(&subdir));
+            } else if name.ends_with(".dist-info") {
+                packages.extend(python_distribution(&subdir));
+            } else if name == "specifications" {
+                packages.extend(gem_specifications(&subdir));
+            } else {
+                pending.push(subdir);
+            }
+        }
+    }
+    packages
+}
+
+/// Header fields of a core metadata file, continuation lines joined with newlines
+fn metadata_fields(content: &str) -> Vec<(String, String)> {
+    let mut fields: Vec<(String, String)> = Vec::new();
+    for line in content.lines() {
+        if line.is_empty() {
+            // The description follows the headers
+            break;
+        }
+        if line.starts_with([' ', '\t']) {
+            if let Some((_, value)) = fields.last_mut() {
+                value.push('\n');
+                value.push_str(line.trim());
+            }
+        } else if let Some((key, value)) = line.split_once(':') {
+            fields.push((key.trim().to_string(), value.trim().to_string()));
+        }
+    }
+    fields
+}
+
+/// An installed Python distribution, read from its `METADATA`
+fn python_distribution(dist_info: &Path) -> Option<VendoredPackage> {
+    let manifest = dist_info.join("METADATA");
+    let fields = metadata_fields(&fs::read_to_string(&manifest).ok()?);
+    let field = |name: &str| {
+        fields
+            .iter()
+            .find(|(key, _)| key.eq_ignore_ascii_case(name))
+            .map(|(_, value)| value.clone())
+    };
+
+    let classifiers: Vec<&str> = fields
+        .iter()
+        .filter(|(key, _)| key == "Classifier")
+        .map(|(_, value)| value.as_str())
+        .collect();
+    // Same shape as the `info` block of the PyPI JSON API
+    let info = json!({
+        "license_expression": field("License-Expression"),
+        "license": field("License"),
+        "classifiers": classifiers,
+    });
+
+    // PEP 639 puts license files in a `licenses/` subdirectory
+    let licenses_dir = dist_info.join("licenses");
+    Some(VendoredPackage {
+        name: field("Name")?,
+        version: field("Version")?,
+        license: license_from_pypi_info(&info),
+        dir: if licenses_dir.is_dir() {
+            licenses_dir
+        } else {
+            dist_info.to_path_buf()
+        },
+        manifest,
+        scope: DependencyScope::Runtime,
+    })
+}
+
+/// Installed gems, read from the gemspecs RubyGems keeps in `specifications/`
+fn gem_specifications(specifications: &Path) -> Vec<VendoredPackage> {
+    let Ok(licenses_regex) = Regex::new(r#"\.licenses?\s*=\s*(\[[^\]]*\]|"[^"]*")"#) else {
+        return Vec::new();
+    };
+    let Ok(quoted_regex) = Regex::new(r#""([^"]+)""#) else {
+        return Vec::new();
+    };
+
+    let mut specs: Vec<PathBuf> = fs::read_dir(specifications)
+        .into_iter()
+        .flatten()
+        .filter_map(|entry| entry.ok())
+        .map(|entry| entry.path())
+        .filter(|path| path.extension().is_some_and(|ext| ext == "gemspec"))
+        .collect();
+    specs.sort();
+
+    specs
+        .into_iter()
+        .filter_map(|spec| {
+            let stem = spec.file_stem()?.to_string_lossy().to_string();
+            // Named `<name>-<version>`, and gem names may contain dashes
+            let (name, version) = stem
+                .rsplit_once('-')
+                .filter(|(_, version)| version.starts_with(|c: char| c.is_ascii_digit()))?;
+            let content = fs::read_to_string(&spec).unwrap_or_default();
+            let licenses: Vec<String> = licenses_regex
+                .captures(&content)
+                .map(|cap| {
+                    quoted_regex
+                        .captures_iter(&cap[1])
+                        .map(|quoted| quoted[1].to_string())
+                        .collect()
+                })
+                .unwrap_or_default();
+
+            Some(VendoredPackage {
+                name: name.to_string(),
+                version: version.to_string(),
+                license: license_from_gem_licenses(&licenses),
+                dir: specifications.parent()?.join("gems").join(&stem),
+                manifest: spec.clone(),
+                scope: DependencyScope::Runtime,
+            })
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use flate2::write::GzEncoder;
+    use flate2::Compression;
+
+    fn write(path: &Path, content: &str) {
+        fs::create_dir_all(path.parent().unwrap()).unwrap();
+        fs::write(path, content).unwrap();
+    }
+
+    fn layer(files: &[(&str, &str)]) -> Vec<u8> {
+        let mut builder = tar::Builder::new(GzEncoder::new(Vec::new(), Compression::fast()));
+        for (path, content) in files {
+            let mut header = tar::Header::new_gnu();
+            header.set_size(content.len() as u64);
+            header.set_mode(0o644);
+            header.set_cksum();
+            builder
+                .append_data(&mut header, path, content.as_bytes())
+                .unwrap();
+        }
+        builder.into_inner().unwrap().finish().unwrap()
+    }
+
+    #[test]
+    fn test_language_packages() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        write(
+            &root.join("usr/lib/node_modules/npm/package.json"),
+            r#"{"name": "npm", "version": "10.2.4", "license": "Artistic-2.0"}"#,
+        );
+        write(
+            &root.join("usr/lib/python3/dist-packages/requests-2.31.0.dist-info/METADATA"),
+            "Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\nLicense: Apache 2.0\n\
+Classifier: License :: OSI Approved :: Apache Software License\n\nDescription",
+        );
+        write(
+            &root.join("usr/local/lib/python3.12/site-packages/rich-13.7.0.dist-info/METADATA"),
+            "Name: rich\nVersion: 13.7.0\nLicense: MIT License\n        \n        Copyright (c) Will\n\
+Classifier: License :: OSI Approved :: MIT License\n",
+        );
+        write(
+            &root.join("usr/local/bundle/specifications/net-http-0.4.1.gemspec"),
+            "Gem::Specification.new do |s|\n  s.name = \"net-http\".freeze\n  s.licenses = [\"Ruby\".freeze, \"BSD-2-Clause\".freeze]\nend\n",
+        );
+
+        let mut packages: Vec<(String, Option<String>)> = language_packages(root)
+            .into_iter()
+            .map(|p| (format!("{}@{}", p.name, p.version), p.license))
+            .collect();
+        packages.sort();
+
+        assert_eq!(
+            packages,
+            vec![
+                (
+                    "net-http@0.4.1".to_string(),
+                    Some("Ruby OR BSD-2-Clause".to_string())
+                ),
+                ("npm@10.2.4".to_string(), Some("Artistic-2.0".to_string())),
+                (
+                    "requests@2.31.0".to_string(),
+                    Some("Apache 2.0".to_string())
+                ),
+                ("rich@13.7.0".to_string(), Some("MIT".to_string())),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_scan_docker_archive_with_whiteouts() {
+        let temp_dir = TempDir::new().unwrap();
+        let base = layer(&[
+            (
+                "lib/apk/db/installed",
+                "P:musl\nV:1.2.4-r2\nL:MIT\n\nP:busybox\nV:1.36.1-r15\nL:GPL-2.0-only\n",
+            ),
+            (
+                "app/node_modules/left-pad/package.json",
+                r#"{"name": "left-pad", "version": "1.3.0", "license": "WTFPL"}"#,
+            ),
+            ("usr/bin/busybox", "binary"),
+        ]);
+        let top = layer(&[
+            ("app/node_modules/.wh.left-pad", ""),
+            (
+                "app/node_modules/is-odd/package.json",
+                r#"{"name": "is-odd", "version": "3.0.1", "license": "MIT"}"#,
+            ),
+        ]);
+
+        let archive_path = temp_dir.path().join("image.tar");
+        let mut archive = tar::Builder::new(fs::File::create(&archive_path).unwrap());
+        let manifest = r#"[{"Config": "config.json", "RepoTags": ["demo:latest"], "Layers": ["base/layer.tar", "top/layer.tar"]}]"#;
+        for (path, content) in [
+            ("manifest.json", manifest.as_bytes()),
+            ("base/layer.tar", base.as_slice()),
+            ("top/layer.tar", top.as_slice()),
+        ] {
+            let mut header = tar::Header::new_gnu();
+            header.set_size(content.len() as u64);
+            header.set_mode(0o644);
+            header.set_cksum();
+            archive.append_data(&mut header, path, content).unwrap();
+        }
+        archive.finish().unwrap();
+
+        let image = load_image(archive_path.to_str().unwrap(), None, None).unwrap();
+        assert!(!image.root.join("usr/bin/busybox").exists());
+
+        let mut deps: Vec<(String, Option<String>, String)> =
+            analyze_image_filesystem(&image.root, &FeludaConfig::default())
+                .into_iter()
+                .map(|d| (d.name, d.license, d.source_file.unwrap_or_default()))
+                .collect();
+        deps.sort();
+
+        assert_eq!(
+            deps,
+            vec![
+                (
+                    "busybox".to_string(),
+                    Some("GPL-2.0-only".to_string()),
+                    "lib/apk/db/installed".to_string()
+                ),
+                (
+                    "is-odd".to_string(),
+                    Some("MIT".to_string()),
+                    "app/node_modules/is-odd/package.json".to_string()
+                ),
+                (
+                    "musl".to_string(),
+                    Some("MIT".to_string()),
+                    "lib/apk/db/installed".to_string()
+                ),
+            ]
+        );
+    }
+}
@@ -0,0 +1,623 @@
+//! Image references, registry pulls and local image archives
+
+use reqwest::blocking::{Client, Response};
+use reqwest::header::{ACCEPT, WWW_AUTHENTICATE};
+use reqwest::StatusCode;
+use serde::Deserialize;
+use sha2::{Digest, Sha256};
+use std::fs::{self, File};
+use std::io;
+use std::path::{Path, PathBuf};
+use std::time::Duration;
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::registry::{copy_body, send, send_streamed, Registry};
+
+const DOCKER_HUB: &str = "docker.io";
+const DOCKER_HUB_API: &str = "registry-1.docker.io";
+
+/// Media types of image manifests and indexes, in order of preference
+const MANIFEST_MEDIA_TYPES: [&str; 4] = [
+    "application/vnd.oci.image.index.v1+json",
+    "application/vnd.docker.distribution.manifest.list.v2+json",
+    "application/vnd.oci.image.manifest.v1+json",
+    "application/vnd.docker.distribution.manifest.v2+json",
+];
+
+/// Layers can be hundreds of megabytes, far beyond the default request timeout
+const BLOB_TIMEOUT: Duration = Duration::from_secs(600);
+
+/// A parsed image reference such as `ghcr.io/acme/app:1.2` or `alpine@sha256:...`
+#[derive(Debug, Clone, PartialEq)]
+pub struct ImageReference {
+    /// Registry host as written, `docker.io` when omitted
+    pub registry: String,
+    pub repository: String,
+    /// Tag or digest to pull
+    pub reference: String,
+}
+
+impl ImageReference {
+    /// Parse a reference the way `docker pull` does
+    ///
+    /// The first path component is a registry when it contains a `.` or `:`, or
+    /// is `localhost`. Docker Hub images without a namespace live in `library/`,
+    /// and the tag defaults to `latest`.
+    pub fn parse(reference: &str) -> FeludaResult<Self> {
+        let reference = reference.trim();
+        let (name, digest) = match reference.split_once('@') {
+            Some((name, digest)) => (name, Some(digest)),
+            None => (reference, None),
+        };
+
+        let (registry, path) = match name.split_once('/') {
+            Some((first, rest))
+                if first.contains('.') || first.contains(':') || first == "localhost" =>
+            {
+                (first, rest)
+            }
+            _ => (DOCKER_HUB, name),
+        };
+
+        // A tag follows the last `:` after the last `/`
+        let (repository, tag) = match path.rsplit_once(':') {
+            Some((repository, tag)) if !tag.contains('/') => (repository, Some(tag)),
+            _ => (path, None),
+        };
+
+        if repository.is_empty() || tag.is_some_and(str::is_empty) {
+            return Err(FeludaError::Image(format!(
+                "Invalid image reference: {reference}"
+            )));
+        }
+
+        let repository = if registry == DOCKER_HUB && !repository.contains('/') {
+            format!("library/{repository}")
+        } else {
+            repository.to_string()
+        };
+
+        Ok(Self {
+            registry: registry.to_string(),
+            repository,
+            reference: digest.or(tag).unwrap_or("latest").to_string(),
+        })
+    }
+
+    /// Base URL of the registry's HTTP API
+    fn api_base(&self) -> String {
+        let host = if self.registry == DOCKER_HUB {
+            DOCKER_HUB_API
+        } else {
+            &self.registry
+        };
+        // Local registries started with `docker run registry` don't serve TLS
+        let scheme = if host.starts_with("localhost") || host.starts_with("127.0.0.1") {
+            "http"
+        } else {
+            "https"
+        };
+        format!("{scheme}://{host}/v2/{}", self.repository)
+    }
+}
+
+/// Operating system and architecture of an image, e.g. `linux/arm64/v8`
+#[derive(Debug, Clone, PartialEq)]
+pub struct Platform {
+    pub os: String,
+    pub architecture: String,
+    pub variant: Option<String>,
+}
+
+impl Platform {
+    pub fn parse(platform: &str) -> FeludaResult<Self> {
+        let mut parts = platform.split('/');
+        match (parts.next(), parts.next(), parts.next(), parts.next()) {
+            (Some(os), Some(architecture), variant, None)
+                if !os.is_empty() && !architecture.is_empty() =>
+            {
+                Ok(Self {
+                    os: os.to_string(),
+                    architecture: architecture.to_string(),
+                    variant: variant.map(String::from),
+                })
+            }
+            _ => Err(FeludaError::Image(format!(
+                "Invalid platform {platform}, expected os/arch[/variant]"
+            ))),
+        }
+    }
+
+    /// Linux on the architecture Feluda runs on, as named by OCI
+    pub fn host() -> Self {
+        let architecture = match std::env::consts::ARCH {
+            "x86_64" => "amd64",
+            "aarch64" => "arm64",
+            "x86" => "386",
+            "powerpc64" => "ppc64le",
+            other => other,
+        };
+        Self {
+            os: "linux".to_string(),
+            architecture: architecture.to_string(),
+            variant: None,
+        }
+    }
+
+    fn matches(&self, other: &DescriptorPlatform) -> bool {
+        self.os == other.os
+            && self.architecture == other.architecture
+            && self
+                .variant
+                .as_ref()
+                .is_none_or(|variant| other.variant.as_ref() == Some(variant))
+    }
+}
+
+impl std::fmt::Display for Platform {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "{}/{}", self.os, self.architecture)?;
+        if let Some(variant) = &self.variant {
+            write!(f, "/{variant}")?;
+        }
+        Ok(())
+    }
+}
+
+/// An image manifest or an index of manifests, Docker or OCI flavored
+#[derive(Deserialize, Debug, Default)]
+struct Manifest {
+    #[serde(default)]
+    manifests: Vec<Descriptor>,
+    #[serde(default)]
+    layers: Vec<Descriptor>,
+}
+
+#[derive(Deserialize, Debug)]
+struct Descriptor {
+    digest: String,
+    platform: Option<DescriptorPlatform>,
+}
+
+#[derive(Deserialize, Debug)]
+struct DescriptorPlatform {
+    os: String,
+    architecture: String,
+    variant: Option<String>,
+}
+
+/// Entry of the `manifest.json` written by `docker save`
+#[derive(Deserialize, Debug)]
+struct DockerArchiveEntry {
+    #[serde(rename = "Layers")]
+    layers: Vec<String>,
+}
+
+/// Pick the manifest for `platform` from an index
+fn select_manifest<'a>(index: &'a Manifest, platform: &Platform) -> FeludaResult<&'a str> {
+    let candidates: Vec<&Descriptor> = index
+        .manifests
+        .iter()
+        // Attestations are listed with an `unknown/unknown` platform
+        .filter(|m| m.platform.as_ref().is_none_or(|p| p.os != "unknown"))
+        .collect();
+
+    if let Some(manifest) = candidates
+        .iter()
+        .find(|m| m.platform.as_ref().is_some_and(|p| platform.matches(p)))
+    {
+        return Ok(&manifest.digest);
+    }
+    // An index without platform information, e.g. an OCI layout of a single image
+    if let [manifest] = candidates.as_slice() {
+        if manifest.platform.is_none() {
+            return Ok(&manifest.digest);
+        }
+    }
+
+    let available: Vec<String> = candidates
+        .iter()
+        .filter_map(|m| m.platform.as_ref())
+        .map(|p| match &p.variant {
+            Some(variant) => format!("{}/{}/{variant}", p.os, p.architecture),
+            None => format!("{}/{}", p.os, p.architecture),
+        })
+        .collect();
+    Err(FeludaError::Image(format!(
+        "No image for platform {platform}, available: {}",
+        available.join(", ")
+    )))
+}
+
+fn parse_manifest(content: &[u8]) -> FeludaResult<Manifest> {
+    serde_json::from_slice(content)
+        .map_err(|e| FeludaError::Image(format!("Invalid image manifest: {e}")))
+}
+
+/// Check that the file at `path` has the sha256 `digest`
+fn verify_digest(path: &Path, digest: &str) -> FeludaResult<()> {
+    let Some(expected) = digest.strip_prefix("sha256:") else {
+        log(
+            LogLevel::Warn,
+            &format!("Not verifying {digest}, only sha256 digests are supported"),
+        );
+        return Ok(());
+    };
+
+    let mut hasher = Sha256::new();
+    io::copy(&mut File::open(path)?, &mut hasher)?;
+    let actual: String = hasher
+        .finalize()
+        .iter()
+        .map(|byte| format!("{byte:02x}"))
+        .collect();
+
+    if actual != expected {
+        return Err(FeludaError::Image(format!(
+            "Digest mismatch for {}: expected {digest}, got sha256:{actual}",
+            path.display()
+        )));
+    }
+    Ok(())
+}
+
+/// Blob of an OCI image layout, `blobs/<algorithm>/<hex>`
+fn layout_blob(layout: &Path, digest: &str) -> FeludaResult<PathBuf> {
+    let (algorithm, hex) = digest
+        .split_once(':')
+        .filter(|(algorithm, hex)| {
+            [algorithm, hex]
+                .iter()
+                .all(|part| !part.is_empty() && part.chars().all(|c| c.is_ascii_alphanumeric()))
+        })
+        .ok_or_else(|| FeludaError::Image(format!("Invalid digest: {digest}")))?;
+    let path = layout.join("blobs").join(algorithm).join(hex);
+    verify_digest(&path, digest)?;
+    Ok(path)
+}
+
+/// Layers of a local image, bottom first
+///
+/// `path` is an archive written by `docker save` or `podman save`, or an OCI
+/// image layout as a directory or tar archive. Archives are unpacked into
+/// `work_dir`.
+pub fn local_image_layers(
+    path: &Path,
+    platform: &Platform,
+    work_dir: &Path,
+) -> FeludaResult<Vec<PathBuf>> {
+    let dir = if path.is_dir() {
+        path.to_path_buf()
+    } else {
+        log(
+            LogLevel::Info,
+            &format!("Unpacking image archive {}", path.display()),
+        );
+        let dir = work_dir.join("archive");
+        tar::Archive::new(File::open(path)?)
+            .unpack(&dir)
+            .map_err(|e| FeludaError::Image(format!("Failed to unpack {}: {e}", path.display())))?;
+        dir
+    };
+
+    let docker_manifest = dir.join("manifest.json");
+    if docker_manifest.is_file() {
+        let entries: Vec<DockerArchiveEntry> = serde_json::from_slice(&fs::read(&docker_manifest)?)
+            .map_err(|e| FeludaError::Image(format!("Invalid manifest.json: {e}")))?;
+        if entries.len() > 1 {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Archive holds {} images, scanning the first one",
+                    entries.len()
+                ),
+            );
+        }
+        let entry = entries
+            .into_iter()
+            .next()
+            .ok_or_else(|| FeludaError::Image("manifest.json lists no images".to_string()))?;
+        return entry
+            .layers
+            .iter()
+            .map(|layer| {
+                if Path::new(layer)
+                    .components()
+                    .any(|c| !matches!(c, std::path::Component::Normal(_)))
+                {
+                    return Err(FeludaError::Image(format!("Invalid layer path: {layer}")));
+                }
+                Ok(dir.join(layer))
+            })
+            .collect();
+    }
+
+    let index = dir.join("index.json");
+    if index.is_file() {
+        let mut manifest = parse_manifest(&fs::read(&index)?)?;
+        // Indexes may nest, e.g. a multi-platform image inside a layout
+        while manifest.layers.is_empty() {
+            let digest = select_manifest(&manifest, platform)?.to_string();
+            manifest = parse_manifest(&fs::read(layout_blob(&dir, &digest)?)?)?;
+        }
+        return manifest
+            .layers
+            .iter()
+            .map(|layer| layout_blob(&dir, &layer.digest))
+            .collect();
+    }
+
+    Err(FeludaError::Image(format!(
+        "{} is neither a docker save archive nor an OCI image layout",
+        path.display()
+    )))
+}
+
+/// Parameters of a `WWW-Authenticate: Bearer realm="...",service="..."` challenge
+pub fn parse_bearer_challenge(header: &str) -> Option<Vec<(String, String)>> {
+    let params = header.trim().strip_prefix("Bearer ")?;
+    let mut parsed = Vec::new();
+    let mut rest = params.trim();
+    while !rest.is_empty() {
+        let (key, value) = rest.split_once('=')?;
+        let value = value.trim_start();
+        let (value, remainder) = match value.strip_prefix('"') {
+            Some(quoted) => {
+                let end = quoted.find('"')?;
+                (&quoted[..end], &quoted[end + 1..])
+            }
+            None => value.split_once(',').unwrap_or((value, "")),
+        };
+        parsed.push((key.trim().to_string(), value.to_string()));
+        rest = remainder.trim_start_matches(|c: char| c == ',' || c.is_whitespace());
+    }
+    Some(parsed)
+}
+
+/// Pulls manifests and blobs of one repository, authenticating on demand
+struct RegistryClient<'a> {
+    image: &'a ImageReference,
+    credentials: Option<&'a (String, String)>,
+    token: Option<String>,
+}
+
+impl RegistryClient<'_> {
+    /// GET `url`; the body of a `blob` is left to [`copy_body`]
+    fn get(&mut self, url: &str, accept: &str, blob: bool) -> FeludaResult<Response> {
+        let request = |token: Option<&str>| {
+            let build = |client: &Client| {
+                let mut request = client.get(url).header(ACCEPT, accept);
+                if blob {
+                    request = request.timeout(BLOB_TIMEOUT);
+                }
+                if let Some(token) = token {
+                    request = request.bearer_auth(token);
+                }
+                request
+            };
+            if blob {
+                send_streamed(Registry::Oci, build)
+            } else {
+                send(Registry::Oci, build)
+            }
+        };
+
+        let mut response = request(self.token.as_deref())?;
+        if response.status() == StatusCode::UNAUTHORIZED && self.token.is_none() {
+            let challenge = response
+                .headers()
+                .get(WWW_AUTHENTICATE)
+                .and_then(|value| value.to_str().ok())
+                .and_then(parse_bearer_challenge);
+            if let Some(challenge) = challenge {
+                self.token = Some(self.fetch_token(&challenge)?);
+                response = request(self.token.as_deref())?;
+            }
+        }
+
+        if !response.status().is_success() {
+            return Err(FeludaError::Image(format!(
+                "{url} returned HTTP {}",
+                response.status()
+            )));
+        }
+        Ok(response)
+    }
+
+    /// Exchange a bearer challenge for a pull token
+    fn fetch_token(&self, challenge: &[(String, String)]) -> FeludaResult<String> {
+        let param = |name: &str| {
+            challenge
+                .iter()
+                .find(|(key, _)| key == name)
+                .map(|(_, value)| value.as_str())
+        };
+        let realm = param("realm")
+            .ok_or_else(|| FeludaError::Image("Registry challenge has no realm".to_string()))?;
+        let scope = param("scope")
+            .map(String::from)
+            .unwrap_or_else(|| format!("repository:{}:pull", self.image.repository));
+
+        let mut query = vec![("scope", scope.as_str())];
+        if let Some(service) = param("service") {
+            query.push(("service", service));
+        }
+
+        log(
+            LogLevel::Info,
+            &format!("Requesting a pull token from {realm}"),
+        );
+        let response = send(Registry::Oci, |client| {
+            let request = client.get(realm).query(&query);
+            match self.credentials {
+                Some((username, password)) => request.basic_auth(username, Some(password)),
+                None => request,
+            }
+        })?;
+        if !response.status().is_success() {
+            return Err(FeludaError::Image(format!(
+                "Registry refused a pull token for {}: HTTP {}",
+                self.image.repository,
+                response.status()
+            )));
+        }
+
+        let body: serde_json::Value = response.json()?;
+        body.get("token")
+            .or_else(|| body.get("access_token"))
+            .and_then(|token| token.as_str())
+            .map(String::from)
+            .ok_or_else(|| FeludaError::Image("Registry returned no token".to_string()))
+    }
+
+    fn manifest(&mut self, reference: &str) -> FeludaResult<Manifest> {
+        let url = format!("{}/manifests/{reference}", self.image.api_base());
+        let response = self.get(&url, &MANIFEST_MEDIA_TYPES.join(", "), false)?;
+        parse_manifest(&response.bytes()?)
+    }
+
+    fn download_blob(&mut self, digest: &str, path: &Path) -> FeludaResult<()> {
+        let url = format!("{}/blobs/{digest}", self.image.api_base());
+        let mut response = self.get(&url, "*/*", true)?;
+        copy_body(&mut response, &mut File::create(path)?)?;
+        verify_digest(path, digest)
+    }
+}
+
+/// Download the layers of `image` into `work_dir`, bottom first
+///
+/// Registries are accessed anonymously unless `credentials` are given, which
+/// are exchanged for a pull token.
+pub fn pull_image_layers(
+    image: &ImageReference,
+    platform: &Platform,
+    credentials: Option<&(String, String)>,
+    work_dir: &Path,
+) -> FeludaResult<Vec<PathBuf>> {
+    let mut client = RegistryClient {
+        image,
+        credentials,
+        token: None,
+    };
+
+    let mut manifest = client.manifest(&image.reference)?;
+    if manifest.layers.is_empty() {
+        let digest = select_manifest(&manifest, platform)?.to_string();
+        log(
+            LogLevel::Info,
+            &format!("Selected {digest} for platform {platform}"),
+        );
+        manifest = client.manifest(&digest)?;
+    }
+
+    let blobs = work_dir.join("blobs");
+    fs::create_dir_all(&blobs)?;
+    let mut layers = Vec::new();
+    for (index, layer) in manifest.layers.iter().enumerate() {
+        log(
+            LogLevel::Info,
+            &format!(
+                "Pulling layer {}/{}: {}",
+                index + 1,
+                manifest.layers.len(),
+                layer.digest
+            ),
+        );
+        let path = blobs.join(format!("layer-{index}"));
+        client.download_blob(&layer.digest, &path)?;
+        layers.push(path);
+    }
+    Ok(layers)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_image_reference() {
+        let parse = |reference| {
+            let image = ImageReference::parse(reference).unwrap();
+            (image.registry, image.repository, image.reference)
+        };
+        let expected = |registry: &str, repository: &str, reference: &str| {
+            (
+                registry.to_string(),
+                repository.to_string(),
+                reference.to_string(),
+            )
+        };
+
+        assert_eq!(
+            parse("alpine"),
+            expected("docker.io", "library/alpine", "latest")
+        );
+        assert_eq!(
+            parse("bitnami/redis:7.2"),
+            expected("docker.io", "bitnami/redis", "7.2")
+        );
+        assert_eq!(
+            parse("ghcr.io/acme/app:1.0@sha256:abc"),
+            expected("ghcr.io", "acme/app", "sha256:abc")
+        );
+        assert_eq!(
+            parse("localhost:5000/app"),
+            expected("localhost:5000", "app", "latest")
+        );
+        assert!(ImageReference::parse("alpine:").is_err());
+
+        assert_eq!(
+            ImageReference::parse("alpine").unwrap().api_base(),
+            "https://registry-1.docker.io/v2/library/alpine"
+        );
+        assert_eq!(
+            ImageReference::parse("localhost:5000/app")
+                .unwrap()
+                .api_base(),
+            "http://localhost:5000/v2/app"
+        );
+    }
+
+    #[test]
+    fn test_parse_bearer_challenge() {
+        let challenge = parse_bearer_challenge(
+            r#"Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull""#,
+        )
+        .unwrap();
+        assert_eq!(
+            challenge,
+            vec![
+                (
+                    "realm".to_string(),
+                    "https://auth.docker.io/token".to_string()
+                ),
+                ("service".to_string(), "registry.docker.io".to_string()),
+                (
+                    "scope".to_string(),
+                    "repository:library/alpine:pull".to_string()
+                ),
+            ]
+        );
+        assert_eq!(parse_bearer_challenge(r#"Basic realm="x""#), None);
+    }
+
+    #[test]
+    fn test_select_manifest() {
+        let index: Manifest = serde_json::from_str(
+            r#"{"manifests": [
+  {"digest": "sha256:amd", "platform": {"os": "linux", "architecture": "amd64"}},
+  {"digest": "sha256:arm7", "platform": {"os": "linux", "architecture": "arm", "variant": "v7"}},
+  {"digest": "sha256:arm8", "platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}},
+  {"digest": "sha256:att", "platform": {"os": "unknown", "architecture": "unknown"}}
+]}"#,
+        )
+        .unwrap();
+
+        let select = |platform| select_manifest(&index, &Platform::parse(platform).unwrap());
+        assert_eq!(select("linux/amd64").unwrap(), "sha256:amd");
+        assert_eq!(select("linux/arm64").unwrap(), "sha256:arm8");
+        assert_eq!(select("linux/arm/v7").unwrap(), "sha256:arm7");
+        assert!(select("windows/amd64").is_err());
+        assert!(Platform::parse("linux").is_err());
+    }
+}
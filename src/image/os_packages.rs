@@ -0,0 +1,685 @@
+//! Packages installed by the distribution's package manager
+//!
+//! - Debian and Ubuntu: `/var/lib/dpkg/status`, or `status.d/` on distroless
+//!   images, with licenses from `/usr/share/doc/<package>/copyright`
+//! - Alpine: `/lib/apk/db/installed`, which records each package's license
+//! - Fedora, RHEL and SUSE: the RPM database, read directly when it is SQLite
+//!   and with the `rpm` command otherwise
+//!
+//! Debian and older RPM distributions name licenses their own way (`GPL-2+`,
+//! `GPLv2+`, `ASL 2.0`), which are mapped to SPDX identifiers so the same
+//! policy applies as for language dependencies.
+
+use rusqlite::{Connection, OpenFlags};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+use crate::debug::{log, LogLevel};
+use crate::license_detector::classify_license_text;
+use crate::licenses::DependencyScope;
+use crate::vendored::VendoredPackage;
+
+pub(crate) const DPKG_STATUS: &str = "var/lib/dpkg/status";
+pub(crate) const DPKG_STATUS_DIR: &str = "var/lib/dpkg/status.d";
+const DPKG_DOC_DIR: &str = "usr/share/doc";
+pub(crate) const APK_INSTALLED: &str = "lib/apk/db/installed";
+pub(crate) const RPM_DATABASES: [&str; 2] = ["var/lib/rpm", "usr/lib/sysimage/rpm"];
+const RPM_SQLITE: &str = "rpmdb.sqlite";
+
+/// Magic of a header in a package file, left out of database blobs
+const RPM_HEADER_MAGIC: [u8; 8] = [0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0];
+const RPMTAG_NAME: u32 = 1000;
+const RPMTAG_VERSION: u32 = 1001;
+const RPMTAG_RELEASE: u32 = 1002;
+const RPMTAG_LICENSE: u32 = 1014;
+const RPM_STRING_TYPE: u32 = 6;
+const RPM_I18NSTRING_TYPE: u32 = 9;
+
+/// Packages of every package database found in the root filesystem
+pub fn os_packages(root: &Path) -> Vec<VendoredPackage> {
+    let mut packages = dpkg_packages(root);
+    packages.extend(apk_packages(root));
+    packages.extend(rpm_packages(root));
+    packages
+}
+
+fn package(
+    name: &str,
+    version: &str,
+    license: Option<String>,
+    dir: PathBuf,
+    manifest: PathBuf,
+) -> VendoredPackage {
+    VendoredPackage {
+        name: name.to_string(),
+        version: version.to_string(),
+        license,
+        dir,
+        manifest,
+        scope: DependencyScope::Runtime,
+    }
+}
+
+fn dpkg_packages(root: &Path) -> Vec<VendoredPackage> {
+    let mut databases = vec![root.join(DPKG_STATUS)];
+    let mut status_files: Vec<PathBuf> = fs::read_dir(root.join(DPKG_STATUS_DIR))
+        .into_iter()
+        .flatten()
+        .filter_map(|entry| entry.ok())
+        .map(|entry| entry.path())
+        .filter(|path| {
+            path.extension()
+                .is_none_or(|extension| extension != "md5sums")
+        })
+        .collect();
+    status_files.sort();
+    databases.extend(status_files);
+
+    let mut packages = Vec::new();
+    for database in databases {
+        let Ok(content) = fs::read_to_string(&database) else {
+            continue;
+        };
+        for (name, version) in parse_dpkg_status(&content) {
+            let doc_dir = root.join(DPKG_DOC_DIR).join(&name);
+            let license =
+                fs::read_to_string(doc_dir.join("copyright"))
+                    .ok()
+                    .and_then(|copyright| {
+                        parse_debian_copyright(&copyright)
+                            .or_else(|| classify_license_text(&copyright).map(|d| d.license))
+                    });
+            packages.push(package(&name, &version, license, doc_dir, database.clone()));
+        }
+    }
+    if !packages.is_empty() {
+        log(
+            LogLevel::Info,
+            &format!("Found {} dpkg packages", packages.len()),
+        );
+    }
+    packages
+}
+
+/// Installed packages of a dpkg status file, as `(name, version)`
+///
+/// Paragraphs without a `Status` field, as written to `status.d/` by
+/// distroless images, count as installed.
+pub fn parse_dpkg_status(content: &str) -> Vec<(String, String)> {
+    content
+        .split("\n\n")
+        .filter_map(|paragraph| {
+            let field = |name: &str| {
+                paragraph.lines().find_map(|line| {
+                    line.strip_prefix(name)
+                        .and_then(|rest| rest.strip_prefix(':'))
+                        .map(str::trim)
+                })
+            };
+            let installed = field("Status").is_none_or(|status| status.ends_with(" installed"));
+            if !installed {
+                return None;
+            }
+            Some((field("Package")?.to_string(), field("Version")?.to_string()))
+        })
+        .collect()
+}
+
+/// License of a machine-readable (DEP-5) Debian copyright file
+///
+/// Every distinct `License:` of the file applies to some part of the package,
+/// so they are combined with `AND`. Returns `None` for free-form copyright
+/// files, whose text is classified instead.
+pub fn parse_debian_copyright(content: &str) -> Option<String> {
+    let is_machine_readable = content
+        .lines()
+        .find(|line| !line.trim().is_empty())
+        .is_some_and(|line| line.starts_with("Format:"));
+    if !is_machine_readable {
+        return None;
+    }
+
+    let mut licenses: Vec<String> = Vec::new();
+    for line in content.lines() {
+        let Some(value) = line.strip_prefix("License:") else {
+            continue;
+        };
+        let expression: Vec<String> = value
+            .split_whitespace()
+            .map(|word| match word.to_ascii_lowercase().as_str() {
+                "or" => "OR".to_string(),
+                "and" => "AND".to_string(),
+                "with" => "WITH".to_string(),
+                _ => debian_license_to_spdx(word.trim_end_matches(',')),
+            })
+            .collect();
+        if expression.is_empty() {
+            continue;
+        }
+        let expression = expression.join(" ");
+        if !licenses.contains(&expression) {
+            licenses.push(expression);
+        }
+    }
+
+    match licenses.len() {
+        0 => None,
+        1 => licenses.pop(),
+        _ => Some(
+            licenses
+                .iter()
+                .map(|l| {
+                    if l.contains(' ') {
+                        format!("({l})")
+                    } else {
+                        l.clone()
+                    }
+                })
+                .collect::<Vec<_>>()
+                .join(" AND "),
+        ),
+    }
+}
+
+/// Map a Debian license short name to its SPDX identifier
+///
+/// Debian writes `GPL-2+` for "version 2 or later" and `Expat` for MIT.
+pub fn debian_license_to_spdx(name: &str) -> String {
+    match name.to_ascii_lowercase().as_str() {
+        "expat" => return "MIT".to_string(),
+        "bsd-2-clause" => return "BSD-2-Clause".to_string(),
+        "bsd-3-clause" => return "BSD-3-Clause".to_string(),
+        "bsd-4-clause" => return "BSD-4-Clause".to_string(),
+        "apache-2" | "apache-2.0" => return "Apache-2.0".to_string(),
+        "psf-2" => return "PSF-2.0".to_string(),
+        "artistic" => return "Artistic-1.0".to_string(),
+        "zlib" => return "Zlib".to_string(),
+        _ => {}
+    }
+
+    for family in ["GPL", "LGPL", "AGPL", "GFDL"] {
+        let Some(version) = name.strip_prefix(family).and_then(|v| v.strip_prefix('-')) else {
+            continue;
+        };
+        let (version, or_later) = match version.strip_suffix('+') {
+            Some(version) => (version, true),
+            None => (version, false),
+        };
+        if version.is_empty() || !version.chars().all(|c| c.is_ascii_digit() || c == '.') {
+            break;
+        }
+        let version = if version.contains('.') {
+            version.to_string()
+        } else {
+            format!("{version}.0")
+        };
+        let suffix = if or_later { "or-later" } else { "only" };
+        return format!("{family}-{version}-{suffix}");
+    }
+
+    name.to_string()
+}
+
+fn apk_packages(root: &Path) -> Vec<VendoredPackage> {
+    let database = root.join(APK_INSTALLED);
+    let Ok(content) = fs::read_to_string(&database) else {
+        return Vec::new();
+    };
+    let packages: Vec<VendoredPackage> = parse_apk_installed(&content)
+        .into_iter()
+        .map(|(name, version, license)| {
+            package(
+                &name,
+                &version,
+                license,
+                root.join("lib/apk/db"),
+                database.clone(),
+            )
+        })
+        .collect();
+    log(
+        LogLevel::Info,
+        &format!("Found {} apk packages", packages.len()),
+    );
+    packages
+}
+
+/// Packages of Alpine's `installed` database, as `(name, version, license)`
+///
+/// Older packages list several licenses separated by spaces, all of which apply.
+pub fn parse_apk_installed(content: &str) -> Vec<(String, String, Option<String>)> {
+    content
+        .split("\n\n")
+        .filter_map(|record| {
+            let field = |key: &str| {
+                record
+                    .lines()
+                    .find_map(|line| line.strip_prefix(key))
+                    .map(str::trim)
+                    .filter(|value| !value.is_empty())
+            };
+            let license = field("L:").map(|license| {
+                let words: Vec<&str> = license.split_whitespace().collect();
+                let is_expression = words.iter().any(|w| matches!(*w, "AND" | "OR" | "WITH"));
+                if is_expression {
+                    words.join(" ")
+                } else {
+                    words.join(" AND ")
+                }
+            });
+            Some((field("P:")?.to_string(), field("V:")?.to_string(), license))
+        })
+        .collect()
+}
+
+/// Packages of the RPM database
+///
+/// Since Fedora 33 and RHEL 9 the database is SQLite, whose header blobs are
+/// parsed here. Berkeley DB and NDB databases are left to the host's `rpm`.
+fn rpm_packages(root: &Path) -> Vec<VendoredPackage> {
+    let Some(database) = RPM_DATABASES
+        .iter()
+        .map(|dir| root.join(dir))
+        .find(|dir| fs::read_dir(dir).is_ok_and(|mut entries| entries.next().is_some()))
+    else {
+        return Vec::new();
+    };
+
+    let sqlite = database.join(RPM_SQLITE);
+    let records = match sqlite.is_file().then(|| read_rpm_sqlite(&sqlite)) {
+        Some(Ok(records)) => records,
+        Some(Err(e)) => {
+            log(
+                LogLevel::Warn,
+                &format!("Failed to read {}: {e}, trying rpm", sqlite.display()),
+            );
+            query_rpm(&database)
+        }
+        None => query_rpm(&database),
+    };
+
+    let packages: Vec<VendoredPackage> = records
+        .into_iter()
+        .map(|(name, version, license)| {
+            package(&name, &version, license, database.clone(), database.clone())
+        })
+        .collect();
+    log(
+        LogLevel::Info,
+        &format!("Found {} rpm packages", packages.len()),
+    );
+    packages
+}
+
+/// Packages of an SQLite RPM database, as `(name, version, license)`
+fn read_rpm_sqlite(database: &Path) -> rusqlite::Result<Vec<(String, String, Option<String>)>> {
+    let connection = Connection::open_with_flags(database, OpenFlags::SQLITE_OPEN_READ_ONLY)?;
+    let mut statement = connection.prepare("SELECT blob FROM Packages")?;
+    let blobs = statement.query_map([], |row| {
+        let blob: Vec<u8> = row.get(0)?;
+        Ok(blob)
+    })?;
+
+    let mut records = Vec::new();
+    for blob in blobs {
+        if let Some(record) = parse_rpm_header(&blob?) {
+            records.push(record);
+        }
+    }
+    Ok(records)
+}
+
+/// Packages of the RPM database, listed by the host's `rpm` command
+fn query_rpm(database: &Path) -> Vec<(String, String, Option<String>)> {
+    let output = Command::new("rpm")
+        .arg("--dbpath")
+        .arg(database)
+        .args([
+            "-qa",
+            "--queryformat",
+            "%{NAME}\\t%{VERSION}-%{RELEASE}\\t%{LICENSE}\\n",
+        ])
+        .output();
+    match output {
+        Ok(output) if output.status.success() => {
+            parse_rpm_query(&String::from_utf8_lossy(&output.stdout))
+        }
+        Ok(output) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Failed to read the RPM database: {}",
+                    String::from_utf8_lossy(&output.stderr).trim()
+                ),
+            );
+            Vec::new()
+        }
+        Err(_) => {
+            log(
+                LogLevel::Warn,
+                "The filesystem has an RPM database, but rpm is not installed to read it",
+            );
+            Vec::new()
+        }
+    }
+}
+
+/// Name, `version-release` and license of an RPM header blob
+///
+/// A header is a count of index entries and the size of its data, then the
+/// entries (tag, type, offset and count) and the data they point into, all
+/// big-endian.
+pub fn parse_rpm_header(blob: &[u8]) -> Option<(String, String, Option<String>)> {
+    let blob = blob.strip_prefix(&RPM_HEADER_MAGIC).unwrap_or(blob);
+    let word = |at: usize| {
+        blob.get(at..at.checked_add(4)?)
+            .map(|bytes| u32::from_be_bytes([bytes[0], bytes[1], bytes[2], bytes[3]]))
+    };
+    let entries = word(0)? as usize;
+    let data_start = entries.checked_mul(16)?.checked_add(8)?;
+    let data = blob.get(data_start..data_start.checked_add(word(4)? as usize)?)?;
+
+    let string = |tag: u32| {
+        (0..entries).find_map(|index| {
+            let entry = 8 + index * 16;
+            if word(entry)? != tag
+                || !matches!(word(entry + 4)?, RPM_STRING_TYPE | RPM_I18NSTRING_TYPE)
+            {
+                return None;
+            }
+            let value = data.get(word(entry + 8)? as usize..)?;
+            let end = value.iter().position(|&byte| byte == 0)?;
+            Some(String::from_utf8_lossy(&value[..end]).to_string())
+        })
+    };
+
+    let name = string(RPMTAG_NAME)?;
+    // Imported signing keys show up as packages
+    if name == "gpg-pubkey" {
+        return None;
+    }
+    let version = format!("{}-{}", string(RPMTAG_VERSION)?, string(RPMTAG_RELEASE)?);
+    let license = string(RPMTAG_LICENSE).and_then(|license| normalize_rpm_license(&license));
+    Some((name, version, license))
+}
+
+/// Lines of `rpm -qa` with the query format used above
+pub fn parse_rpm_query(output: &str) -> Vec<(String, String, Option<String>)> {
+    output
+        .lines()
+        .filter_map(|line| {
+            let mut fields = line.split('\t');
+            let (name, version, license) = (fields.next()?, fields.next()?, fields.next()?);
+            // Imported signing keys show up as packages
+            if name == "gpg-pubkey" {
+                return None;
+            }
+            Some((
+                name.to_string(),
+                version.to_string(),
+                normalize_rpm_license(license),
+            ))
+        })
+        .collect()
+}
+
+/// SPDX expression of an RPM `License` tag
+///
+/// RPM spells operators in lowercase (`MIT and BSD`), and packages built
+/// before the switch to SPDX use Fedora's short names, which may contain
+/// spaces (`ASL 2.0`). Each name between operators is mapped on its own.
+pub fn normalize_rpm_license(license: &str) -> Option<String> {
+    let mut tokens: Vec<String> = Vec::new();
+    let mut name: Vec<&str> = Vec::new();
+    let flush = |name: &mut Vec<&str>, tokens: &mut Vec<String>| {
+        if !name.is_empty() {
+            tokens.push(rpm_license_to_spdx(&name.join(" ")));
+            name.clear();
+        }
+    };
+
+    let spaced = license.replace('(', " ( ").replace(')', " ) ");
+    for word in spaced.split_whitespace() {
+        let operator = match word.to_ascii_lowercase().as_str() {
+            "and" => Some("AND"),
+            "or" => Some("OR"),
+            "with" => Some("WITH"),
+            _ => None,
+        };
+        match (operator, word) {
+            (Some(operator), _) => {
+                flush(&mut name, &mut tokens);
+                tokens.push(operator.to_string());
+            }
+            (None, "(" | ")") => {
+                flush(&mut name, &mut tokens);
+                tokens.push(word.to_string());
+            }
+            (None, _) => name.push(word),
+        }
+    }
+    flush(&mut name, &mut tokens);
+
+    let expression = tokens.join(" ").replace("( ", "(").replace(" )", ")");
+    (!expression.is_empty() && expression != "(none)").then_some(expression)
+}
+
+/// Map a Fedora short license name to its SPDX identifier
+///
+/// Fedora writes `GPLv2+` for "version 2 or later" and `ASL 2.0` for Apache.
+/// SPDX identifiers and unknown names are returned unchanged.
+pub fn rpm_license_to_spdx(name: &str) -> String {
+    let spdx = match name.to_ascii_lowercase().as_str() {
+        "asl 1.0" => "Apache-1.0",
+        "asl 1.1" => "Apache-1.1",
+        "asl 2.0" => "Apache-2.0",
+        "gpl+" => "GPL-1.0-or-later",
+        "lgpl+" => "LGPL-2.0-or-later",
+        "boost" => "BSL-1.0",
+        "zlib" => "Zlib",
+        "python" => "Python-2.0",
+        "cc0" => "CC0-1.0",
+        "epl" => "EPL-1.0",
+        "cddl" => "CDDL-1.0",
+        "artistic 2.0" => "Artistic-2.0",
+        "artistic clarified" => "ClArtistic",
+        "openldap" => "OLDAP-2.8",
+        "public domain" => "LicenseRef-Fedora-Public-Domain",
+        _ => "",
+    };
+    if !spdx.is_empty() {
+        return spdx.to_string();
+    }
+
+    for family in ["AGPL", "LGPL", "GPL", "GFDL", "MPL"] {
+        let Some(version) = name.strip_prefix(family).and_then(|v| v.strip_prefix('v')) else {
+            continue;
+        };
+        let (version, or_later) = match version.strip_suffix('+') {
+            Some(version) => (version, true),
+            None => (version, false),
+        };
+        if version.is_empty() || !version.chars().all(|c| c.is_ascii_digit() || c == '.') {
+            break;
+        }
+        let version = if version.contains('.') {
+            version.to_string()
+        } else {
+            format!("{version}.0")
+        };
+        // MPL has no "or later" variants
+        if family == "MPL" {
+            return format!("MPL-{version}");
+        }
+        let suffix = if or_later { "or-later" } else { "only" };
+        return format!("{family}-{version}-{suffix}");
+    }
+
+    name.to_string()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_dpkg_status() {
+        let content = "Package: libc6\n\
+Status: install ok installed\n\
+Architecture: amd64\n\
+Version: 2.36-9+deb12u4\n\
+Description: GNU C Library\n \
+Contains the standard libraries.\n\
+\n\
+Package: removed\n\
+Status: deinstall ok config-files\n\
+Version: 1.0\n\
+\n\
+Package: base-files\n\
+Version: 12.4+deb12u5\n";
+
+        assert_eq!(
+            parse_dpkg_status(content),
+            vec![
+                ("libc6".to_string(), "2.36-9+deb12u4".to_string()),
+                ("base-files".to_string(), "12.4+deb12u5".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_debian_copyright() {
+        let dep5 = "Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/\n\
+Upstream-Name: zlib\n\
+\n\
+Files: *\n\
+Copyright: 1995-2013 Jean-loup Gailly and Mark Adler\n\
+License: Zlib\n\
+\n\
+Files: contrib/*\n\
+License: GPL-2+ or Expat\n\
+\n\
+License: Zlib\n \
+This software is provided 'as-is'.\n";
+        assert_eq!(
+            parse_debian_copyright(dep5).as_deref(),
+            Some("Zlib AND (GPL-2.0-or-later OR MIT)")
+        );
+        assert_eq!(parse_debian_copyright("This is free software."), None);
+
+        assert_eq!(debian_license_to_spdx("LGPL-2.1+"), "LGPL-2.1-or-later");
+        assert_eq!(debian_license_to_spdx("GPL-3"), "GPL-3.0-only");
+        assert_eq!(debian_license_to_spdx("public-domain"), "public-domain");
+    }
+
+    #[test]
+    fn test_parse_apk_and_rpm() {
+        let installed = "C:Q1abc=\nP:musl\nV:1.2.4-r2\nL:MIT\n\n\
+P:busybox\nV:1.36.1-r15\nL:GPL-2.0-only\n\n\
+P:libcrypto3\nV:3.1.4-r5\nL:Apache-2.0 BSD-3-Clause\n";
+        let apk = parse_apk_installed(installed);
+        assert_eq!(apk.len(), 3);
+        assert_eq!(
+            apk[0],
+            (
+                "musl".to_string(),
+                "1.2.4-r2".to_string(),
+                Some("MIT".to_string())
+            )
+        );
+        assert_eq!(apk[2].2.as_deref(), Some("Apache-2.0 AND BSD-3-Clause"));
+
+        let rpm = parse_rpm_query(
+            "bash\t5.2.15-5.fc39\tGPL-3.0-or-later\n\
+gpg-pubkey\tabc-def\tpubkey\n\
+zlib\t1.2.13-4.fc39\tzlib and Boost\n",
+        );
+        assert_eq!(rpm.len(), 2);
+        assert_eq!(rpm[1].2.as_deref(), Some("Zlib AND BSL-1.0"));
+    }
+
+    #[test]
+    fn test_normalize_rpm_license() {
+        let normalize = |license: &str| normalize_rpm_license(license);
+        assert_eq!(
+            normalize("ASL 2.0 and (GPLv2+ or MPLv1.1)").as_deref(),
+            Some("Apache-2.0 AND (GPL-2.0-or-later OR MPL-1.1)")
+        );
+        assert_eq!(
+            normalize("LGPL-2.1-or-later AND MIT").as_deref(),
+            Some("LGPL-2.1-or-later AND MIT")
+        );
+        assert_eq!(normalize("GPLv3").as_deref(), Some("GPL-3.0-only"));
+        assert_eq!(normalize("(none)"), None);
+        assert_eq!(
+            rpm_license_to_spdx("Public Domain"),
+            "LicenseRef-Fedora-Public-Domain"
+        );
+        assert_eq!(rpm_license_to_spdx("BSD"), "BSD");
+    }
+
+    /// Header blob as stored in the RPM database, with string tags only
+    fn rpm_header(tags: &[(u32, &str)]) -> Vec<u8> {
+        let mut index = Vec::new();
+        let mut data = Vec::new();
+        for (tag, value) in tags {
+            for word in [*tag, RPM_STRING_TYPE, data.len() as u32, 1] {
+                index.extend(word.to_be_bytes());
+            }
+            data.extend(value.as_bytes());
+            data.push(0);
+        }
+        let mut blob = (tags.len() as u32).to_be_bytes().to_vec();
+        blob.extend((data.len() as u32).to_be_bytes());
+        blob.extend(index);
+        blob.extend(data);
+        blob
+    }
+
+    #[test]
+    fn test_read_rpm_sqlite() {
+        let bash = rpm_header(&[
+            (RPMTAG_NAME, "bash"),
+            (RPMTAG_VERSION, "5.1.8"),
+            (RPMTAG_RELEASE, "9.el9"),
+            (RPMTAG_LICENSE, "GPLv3+"),
+        ]);
+        assert_eq!(
+            parse_rpm_header(&bash),
+            Some((
+                "bash".to_string(),
+                "5.1.8-9.el9".to_string(),
+                Some("GPL-3.0-or-later".to_string())
+            ))
+        );
+        let mut with_magic = RPM_HEADER_MAGIC.to_vec();
+        with_magic.extend(&bash);
+        assert_eq!(parse_rpm_header(&with_magic), parse_rpm_header(&bash));
+        assert_eq!(parse_rpm_header(&bash[..20]), None);
+
+        let root = tempfile::tempdir().unwrap();
+        let database = root.path().join("usr/lib/sysimage/rpm");
+        fs::create_dir_all(&database).unwrap();
+        let hex = |blob: &[u8]| blob.iter().map(|b| format!("{b:02x}")).collect::<String>();
+        let key = rpm_header(&[
+            (RPMTAG_NAME, "gpg-pubkey"),
+            (RPMTAG_VERSION, "fd431d51"),
+            (RPMTAG_RELEASE, "4ae0493b"),
+        ]);
+        Connection::open(database.join(RPM_SQLITE))
+            .unwrap()
+            .execute_batch(&format!(
+                "CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL);
+                 INSERT INTO Packages (blob) VALUES (X'{}'), (X'{}');",
+                hex(&bash),
+                hex(&key)
+            ))
+            .unwrap();
+
+        let packages = rpm_packages(root.path());
+        assert_eq!(packages.len(), 1);
+        assert_eq!(packages[0].name, "bash");
+        assert_eq!(packages[0].license.as_deref(), Some("GPL-3.0-or-later"));
+    }
+}
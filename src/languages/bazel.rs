@@ -0,0 +1,1066 @@
+//! Bazel workspaces
+//!
+//! Bazel monorepos pin their third-party code in the files of the rules that
+//! fetch it rather than in language-native lockfiles:
+//!
+//! - `bazel_dep` modules of `MODULE.bazel`, looked up on the Bazel Central
+//!   Registry, and the GitHub archives of `http_archive` in `WORKSPACE`
+//! - Maven artifacts of rules_jvm_external, from its `maven_install.json`
+//!   lockfile or the coordinates of an unpinned `maven_install`
+//! - Go modules of `go_repository` rules and `go_deps.module` tags, and the
+//!   go.mod files named by `go_deps.from_file`
+//! - npm packages of the pnpm lockfiles named by rules_js' `npm_translate_lock`
+//!
+//! A go.mod or pnpm lockfile that the Go or Node.js scan already reports, and
+//! `go_repository` rules generated from the go.mod of the workspace, are left
+//! to those scans.
+
+use rayon::prelude::*;
+use regex::Regex;
+use serde_json::Value;
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::OnceLock;
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_submission::format_package_url;
+use crate::health::get_json;
+use crate::languages::go::{analyze_go_licenses, fetch_license_for_go_dependency};
+use crate::languages::java::fetch_license_for_maven_artifact;
+use crate::languages::node::{get_license_from_npm_registry_api, parse_pnpm_lock_content};
+use crate::languages::{license_info, BAZEL_PATHS};
+use crate::licenses::{fetch_licenses_from_github, DependencyScope, License, LicenseInfo};
+use crate::registry::Registry;
+use crate::repository_license::fetch_repository_license;
+
+/// The Bazel Central Registry, where `bazel_dep` modules are published
+const BCR_URL: &str = "https://bcr.bazel.build";
+
+/// Lockfile of rules_jvm_external when `maven_install` names none
+const DEFAULT_MAVEN_LOCKFILE: &str = "maven_install.json";
+
+/// Where a dependency comes from and how its license is looked up
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+enum Origin {
+    /// A module of the Bazel Central Registry
+    Module,
+    /// An `http_archive` of a GitHub repository at a tag or commit
+    Archive {
+        repository: String,
+        revision: String,
+    },
+    Maven,
+    Go,
+    Npm,
+}
+
+impl Origin {
+    /// Name used in the license cache and the dependency timings
+    fn ecosystem(&self) -> &'static str {
+        match self {
+            Origin::Module | Origin::Archive { .. } => "bazel",
+            Origin::Maven => "maven",
+            Origin::Go => "go",
+            Origin::Npm => "npm",
+        }
+    }
+}
+
+/// A third-party dependency declared to Bazel
+#[derive(Debug, Clone, PartialEq)]
+struct BazelDependency {
+    name: String,
+    version: String,
+    scope: DependencyScope,
+    origin: Origin,
+    /// Build file or lockfile it was read from, relative to the workspace
+    source_file: String,
+}
+
+impl BazelDependency {
+    fn new(name: String, version: String, origin: Origin, source_file: &str) -> Self {
+        Self {
+            name,
+            version,
+            scope: DependencyScope::Runtime,
+            origin,
+            source_file: source_file.to_string(),
+        }
+    }
+}
+
+/// A Starlark file of the workspace with its comments removed
+struct BuildFile {
+    name: String,
+    content: String,
+}
+
+/// The build file dependencies are reported from when they have no lockfile
+pub fn find_manifest(project_dir: &Path) -> Option<String> {
+    BAZEL_PATHS
+        .iter()
+        .find(|file| project_dir.join(file).is_file())
+        .map(|file| file.to_string())
+}
+
+pub fn analyze_bazel_licenses(project_dir: &Path, config: &FeludaConfig) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing Bazel workspace: {}", project_dir.display()),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let build_files = read_build_files(project_dir);
+    let dependencies = bazel_dependencies(project_dir, &build_files, config);
+    log(
+        LogLevel::Info,
+        &format!("Found {} Bazel dependencies", dependencies.len()),
+    );
+    log_debug("Bazel dependencies", &dependencies);
+
+    let mut licenses: Vec<LicenseInfo> = dependencies
+        .into_par_iter()
+        .map(|dep| {
+            let (license, confidence) =
+                time_dependency(dep.origin.ecosystem(), &dep.name, &dep.version, || {
+                    dependency_license(&dep)
+                });
+            dependency_info(dep, license, confidence, &known_licenses, config)
+        })
+        .collect();
+
+    for go_mod in go_mod_files(&build_files) {
+        if scanned_natively(project_dir, &go_mod, "go.mod", config) {
+            continue;
+        }
+        let path = project_dir.join(&go_mod);
+        let source_file = go_mod.to_string_lossy().replace('\\', "/");
+        licenses.extend(
+            analyze_go_licenses(&path.to_string_lossy(), config)
+                .into_iter()
+                .map(|mut dep| {
+                    dep.source_file = Some(source_file.clone());
+                    dep
+                }),
+        );
+    }
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} Bazel dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+/// `MODULE.bazel`, `WORKSPACE` and the Starlark files next to them
+///
+/// Dependencies are often declared in macros of a `deps.bzl` or in segments
+/// pulled into `MODULE.bazel` with `include()`, so those are read as well.
+fn read_build_files(project_dir: &Path) -> Vec<BuildFile> {
+    let mut names: Vec<String> = fs::read_dir(project_dir)
+        .map(|entries| {
+            entries
+                .filter_map(|e| e.ok())
+                .filter(|e| e.file_type().is_ok_and(|t| t.is_file()))
+                .filter_map(|e| e.file_name().to_str().map(str::to_string))
+                .filter(|name| {
+                    BAZEL_PATHS.contains(&name.as_str())
+                        || name.ends_with(".bzl")
+                        || name.ends_with(".MODULE.bazel")
+                })
+                .collect()
+        })
+        .unwrap_or_default();
+    names.sort();
+
+    names
+        .into_iter()
+        .filter_map(|name| match fs::read_to_string(project_dir.join(&name)) {
+            Ok(content) => Some(BuildFile {
+                content: strip_comments(&content),
+                name,
+            }),
+            Err(err) => {
+                log_error(&format!("Failed to read {name}"), &err);
+                None
+            }
+        })
+        .collect()
+}
+
+/// Every dependency declared in the build files, each reported once
+fn bazel_dependencies(
+    project_dir: &Path,
+    build_files: &[BuildFile],
+    config: &FeludaConfig,
+) -> Vec<BazelDependency> {
+    let mut dependencies = module_dependencies(build_files);
+    dependencies.extend(archive_dependencies(build_files));
+    dependencies.extend(maven_dependencies(project_dir, build_files));
+    if project_dir.join("go.mod").exists() {
+        log(
+            LogLevel::Info,
+            "Leaving the go_repository rules to the scan of go.mod",
+        );
+    } else {
+        dependencies.extend(go_dependencies(build_files));
+    }
+    dependencies.extend(npm_dependencies(project_dir, build_files, config));
+
+    // Workspaces migrating to Bzlmod declare some dependencies in both files
+    let mut seen = HashSet::new();
+    dependencies
+        .retain(|dep| seen.insert((dep.origin.clone(), dep.name.clone(), dep.version.clone())));
+    dependencies
+}
+
+/// `bazel_dep` modules that aren't overridden by a local directory
+fn module_dependencies(build_files: &[BuildFile]) -> Vec<BazelDependency> {
+    let local: HashSet<String> = build_files
+        .iter()
+        .flat_map(|file| calls(&file.content, "local_path_override"))
+        .filter_map(|arguments| attributes(&arguments).remove("module_name"))
+        .collect();
+
+    let mut dependencies = Vec::new();
+    for file in build_files {
+        for arguments in calls(&file.content, "bazel_dep") {
+            let attributes = attributes(&arguments);
+            let Some(name) = attributes.get("name") else {
+                continue;
+            };
+            if local.contains(name) {
+                continue;
+            }
+            let Some(version) = attributes.get("version").filter(|v| !v.is_empty()) else {
+                log(
+                    LogLevel::Warn,
+                    &format!("Skipping bazel_dep {name} without a version"),
+                );
+                continue;
+            };
+            let mut dep =
+                BazelDependency::new(name.clone(), version.clone(), Origin::Module, &file.name);
+            if attributes
+                .get("dev_dependency")
+                .is_some_and(|dev| dev == "True")
+            {
+                dep.scope = DependencyScope::Dev;
+            }
+            dependencies.push(dep);
+        }
+    }
+    dependencies
+}
+
+/// `http_archive` rules that download a GitHub repository
+fn archive_dependencies(build_files: &[BuildFile]) -> Vec<BazelDependency> {
+    let mut dependencies = Vec::new();
+    for file in build_files {
+        for arguments in calls(&file.content, "http_archive") {
+            let Some(name) = attributes(&arguments).remove("name") else {
+                continue;
+            };
+            let Some((repository, revision)) = github_archive(&arguments) else {
+                log(
+                    LogLevel::Warn,
+                    &format!("Cannot look up licenses for http_archive {name}"),
+                );
+                continue;
+            };
+            dependencies.push(BazelDependency::new(
+                name,
+                revision.clone(),
+                Origin::Archive {
+                    repository,
+                    revision,
+                },
+                &file.name,
+            ));
+        }
+    }
+    dependencies
+}
+
+/// Artifacts of rules_jvm_external, from its lockfiles or unpinned coordinates
+fn maven_dependencies(project_dir: &Path, build_files: &[BuildFile]) -> Vec<BazelDependency> {
+    let mut lockfiles = Vec::new();
+    let mut dependencies = Vec::new();
+    for file in build_files {
+        let installs = calls(&file.content, "maven_install")
+            .into_iter()
+            .chain(calls(&file.content, "maven.install"));
+        for arguments in installs {
+            let attributes = attributes(&arguments);
+            match attributes
+                .get("maven_install_json")
+                .or_else(|| attributes.get("lock_file"))
+                .and_then(|label| label_path(label))
+            {
+                Some(lockfile) => lockfiles.push(lockfile),
+                None => dependencies.extend(maven_coordinates(&arguments).into_iter().map(
+                    |(name, version)| {
+                        BazelDependency::new(name, version, Origin::Maven, &file.name)
+                    },
+                )),
+            }
+        }
+    }
+    if lockfiles.is_empty() && project_dir.join(DEFAULT_MAVEN_LOCKFILE).is_file() {
+        lockfiles.push(PathBuf::from(DEFAULT_MAVEN_LOCKFILE));
+    }
+
+    lockfiles.dedup();
+    for lockfile in lockfiles {
+        let source_file = lockfile.to_string_lossy().replace('\\', "/");
+        let content = match fs::read_to_string(project_dir.join(&lockfile)) {
+            Ok(content) => content,
+            Err(err) => {
+                log_error(&format!("Failed to read {source_file}"), &err);
+                continue;
+            }
+        };
+        match serde_json::from_str::<Value>(&content) {
+            Ok(json) => dependencies.extend(parse_maven_lockfile(&json).into_iter().map(
+                |(name, version)| BazelDependency::new(name, version, Origin::Maven, &source_file),
+            )),
+            Err(err) => log_error(&format!("Failed to parse {source_file}"), &err),
+        }
+    }
+    dependencies
+}
+
+/// `group:artifact` and version of the artifacts pinned by a `maven_install.json`
+///
+/// Lockfiles of rules_jvm_external 5 and later key artifacts by
+/// `group:artifact` with their version alongside; older ones list the full
+/// coordinates in a dependency tree.
+fn parse_maven_lockfile(json: &Value) -> Vec<(String, String)> {
+    let mut artifacts: Vec<(String, String)> = match json["artifacts"].as_object() {
+        Some(artifacts) => artifacts
+            .iter()
+            .filter_map(|(key, artifact)| {
+                let mut parts = key.split(':');
+                let name = format!("{}:{}", parts.next()?, parts.next()?);
+                Some((name, artifact["version"].as_str()?.to_string()))
+            })
+            .collect(),
+        None => json["dependency_tree"]["dependencies"]
+            .as_array()
+            .map(|dependencies| {
+                dependencies
+                    .iter()
+                    .filter_map(|dep| parse_maven_coordinate(dep["coord"].as_str()?))
+                    .collect()
+            })
+            .unwrap_or_default(),
+    };
+    // Classifiers of one artifact, e.g. its native libraries, share its license
+    artifacts.sort();
+    artifacts.dedup();
+    artifacts
+}
+
+/// The `group:artifact:version` strings of an unpinned `maven_install`
+fn maven_coordinates(arguments: &str) -> Vec<(String, String)> {
+    string_literals(arguments)
+        .filter_map(parse_maven_coordinate)
+        .collect()
+}
+
+/// `group:artifact[:packaging[:classifier]]:version` as name and version
+fn parse_maven_coordinate(coordinate: &str) -> Option<(String, String)> {
+    let parts: Vec<&str> = coordinate.split(':').collect();
+    if parts.len() < 3
+        || parts
+            .iter()
+            .any(|part| part.is_empty() || part.contains('/'))
+    {
+        return None;
+    }
+    Some((
+        format!("{}:{}", parts[0], parts[1]),
+        parts[parts.len() - 1].to_string(),
+    ))
+}
+
+/// Go modules of `go_repository` rules and `go_deps.module` tags
+fn go_dependencies(build_files: &[BuildFile]) -> Vec<BazelDependency> {
+    let mut dependencies = Vec::new();
+    for file in build_files {
+        for arguments in calls(&file.content, "go_repository") {
+            let mut attributes = attributes(&arguments);
+            let Some(importpath) = attributes.remove("importpath") else {
+                continue;
+            };
+            let Some(version) = ["version", "tag", "commit"]
+                .iter()
+                .find_map(|key| attributes.remove(*key))
+            else {
+                log(
+                    LogLevel::Warn,
+                    &format!("Skipping go_repository {importpath} without a version"),
+                );
+                continue;
+            };
+            dependencies.push(BazelDependency::new(
+                importpath,
+                version,
+                Origin::Go,
+                &file.name,
+            ));
+        }
+        for arguments in calls(&file.content, "go_deps.module") {
+            let mut attributes = attributes(&arguments);
+            if let (Some(path), Some(version)) =
+                (attributes.remove("path"), attributes.remove("version"))
+            {
+                dependencies.push(BazelDependency::new(path, version, Origin::Go, &file.name));
+            }
+        }
+    }
+    dependencies
+}
+
+/// The go.mod files Bzlmod reads Go modules from with `go_deps.from_file`
+fn go_mod_files(build_files: &[BuildFile]) -> Vec<PathBuf> {
+    let mut files: Vec<PathBuf> = build_files
+        .iter()
+        .flat_map(|file| calls(&file.content, "go_deps.from_file"))
+        .filter_map(|arguments| label_path(attributes(&arguments).get("go_mod")?))
+        .collect();
+    files.sort();
+    files.dedup();
+    files
+}
+
+/// npm packages of the pnpm lockfiles translated by rules_js
+fn npm_dependencies(
+    project_dir: &Path,
+    build_files: &[BuildFile],
+    config: &FeludaConfig,
+) -> Vec<BazelDependency> {
+    let mut lockfiles: Vec<PathBuf> = build_files
+        .iter()
+        .flat_map(|file| calls(&file.content, "npm_translate_lock"))
+        .filter_map(|arguments| label_path(attributes(&arguments).get("pnpm_lock")?))
+        .collect();
+    lockfiles.sort();
+    lockfiles.dedup();
+
+    let mut dependencies = Vec::new();
+    for lockfile in lockfiles {
+        if scanned_natively(project_dir, &lockfile, "package.json", config) {
+            continue;
+        }
+        let source_file = lockfile.to_string_lossy().replace('\\', "/");
+        match fs::read_to_string(project_dir.join(&lockfile)) {
+            Ok(content) => {
+                let mut packages: Vec<_> = parse_pnpm_lock_content(&content).into_iter().collect();
+                packages.sort();
+                dependencies.extend(packages.into_iter().map(|(name, version)| {
+                    BazelDependency::new(name, version, Origin::Npm, &source_file)
+                }));
+            }
+            Err(err) => log_error(&format!("Failed to read {source_file}"), &err),
+        }
+    }
+    dependencies
+}
+
+/// Whether the Go or Node.js scan already reports the lockfile at `relative`
+///
+/// That is the case when the manifest of that scan sits next to it, in the
+/// workspace root or in any directory of a recursive scan.
+fn scanned_natively(
+    project_dir: &Path,
+    relative: &Path,
+    manifest: &str,
+    config: &FeludaConfig,
+) -> bool {
+    let dir = relative.parent().unwrap_or(Path::new(""));
+    project_dir.join(dir).join(manifest).is_file()
+        && (dir.as_os_str().is_empty() || config.workspace.recursive)
+}
+
+fn dependency_license(dep: &BazelDependency) -> (Option<String>, Option<f32>) {
+    match &dep.origin {
+        Origin::Module => module_license(&dep.name, &dep.version),
+        Origin::Archive {
+            repository,
+            revision,
+        } => cached_github_license(&dep.name, &dep.version, repository, revision),
+        Origin::Maven => {
+            let license = dep.name.split_once(':').and_then(|(group, artifact)| {
+                fetch_license_for_maven_artifact(group, artifact, &dep.version)
+            });
+            (license, None)
+        }
+        Origin::Go => {
+            let (license, confidence) =
+                fetch_license_for_go_dependency(dep.name.as_str(), dep.version.as_str());
+            (Some(license), confidence)
+        }
+        Origin::Npm => {
+            let license = get_cached_license("npm", &dep.name, &dep.version).or_else(|| {
+                let license = get_license_from_npm_registry_api(&dep.name, &dep.version)?;
+                cache_license("npm", &dep.name, &dep.version, &license);
+                Some(license)
+            });
+            (license, None)
+        }
+    }
+}
+
+/// License of a Bazel Central Registry module, read from its GitHub repository
+///
+/// The registry metadata names the repository, and the source archive of the
+/// version usually names the tag it was cut from.
+fn module_license(name: &str, version: &str) -> (Option<String>, Option<f32>) {
+    if let Some(license) = get_cached_license("bazel", name, version) {
+        return (Some(license), None);
+    }
+
+    let Some(metadata) = get_json(
+        Registry::Bcr,
+        &format!("{BCR_URL}/modules/{name}/metadata.json"),
+    ) else {
+        return (None, None);
+    };
+    let Some(repository) = metadata["repository"]
+        .as_array()
+        .into_iter()
+        .flatten()
+        .filter_map(Value::as_str)
+        .find_map(|repository| repository.strip_prefix("github:"))
+        .map(|path| format!("https://github.com/{path}"))
+    else {
+        log(
+            LogLevel::Warn,
+            &format!("No GitHub repository known for Bazel module {name}"),
+        );
+        return (None, None);
+    };
+
+    let revision = get_json(
+        Registry::Bcr,
+        &format!("{BCR_URL}/modules/{name}/{version}/source.json"),
+    )
+    .and_then(|source| github_archive(source["url"].as_str()?))
+    .map(|(_, revision)| revision)
+    .unwrap_or_default();
+
+    cached_github_license(name, version, &repository, &revision)
+}
+
+fn cached_github_license(
+    name: &str,
+    version: &str,
+    repository: &str,
+    revision: &str,
+) -> (Option<String>, Option<f32>) {
+    if let Some(license) = get_cached_license("bazel", name, version) {
+        return (Some(license), None);
+    }
+    // A guessed tag may not exist, the default branch usually has the same license
+    let found = fetch_repository_license(repository, revision).or_else(|| {
+        (!revision.is_empty())
+            .then(|| fetch_repository_license(repository, ""))
+            .flatten()
+    });
+    match found {
+        Some((license, confidence)) => {
+            cache_license("bazel", name, version, &license);
+            (Some(license), Some(confidence))
+        }
+        None => (None, None),
+    }
+}
+
+/// [`license_info`] with the origin of `dep`
+fn dependency_info(
+    dep: BazelDependency,
+    license: Option<String>,
+    license_confidence: Option<f32>,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+) -> LicenseInfo {
+    let repository = match &dep.origin {
+        Origin::Archive { repository, .. } => Some(repository.clone()),
+        _ => None,
+    };
+    // Archives get theirs from the repository, see `package_url`
+    let purl = match dep.origin {
+        Origin::Module => format_package_url("bazel", &dep.name, &dep.version),
+        Origin::Archive { .. } => None,
+        Origin::Maven => format_package_url("maven", &dep.name, &dep.version),
+        Origin::Go => format_package_url("golang", &dep.name, &dep.version),
+        Origin::Npm => format_package_url("npm", &dep.name, &dep.version),
+    };
+
+    LicenseInfo {
+        source_file: Some(dep.source_file),
+        scope: dep.scope,
+        repository,
+        purl,
+        ..license_info(
+            dep.name,
+            dep.version,
+            license,
+            license_confidence,
+            known_licenses,
+            config,
+        )
+    }
+}
+
+/// Repository and tag or commit of the first GitHub archive URL in `text`
+fn github_archive(text: &str) -> Option<(String, String)> {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    let pattern = PATTERN.get_or_init(|| {
+        Regex::new(
+            r#"https://github\.com/([^/"\s]+)/([^/"\s]+)/(?:archive/(?:refs/tags/)?([^/"\s]+?)\.(?:tar\.gz|tgz|zip)|releases/download/([^/"\s]+)/)"#,
+        )
+        .expect("valid GitHub archive pattern")
+    });
+    let captures = pattern.captures(text)?;
+    let revision = captures.get(3).or_else(|| captures.get(4))?.as_str();
+    Some((
+        format!("https://github.com/{}/{}", &captures[1], &captures[2]),
+        revision.to_string(),
+    ))
+}
+
+/// Path of a file label of the main repository, e.g. `//frontend:pnpm-lock.yaml`
+///
+/// Labels of other repositories have no file in the workspace.
+fn label_path(label: &str) -> Option<PathBuf> {
+    let label = label.trim_start_matches('@');
+    let label = match label.split_once("//") {
+        Some(("", label)) => label,
+        Some(_) => return None,
+        None => label,
+    };
+    let (package, target) = label.split_once(':').unwrap_or(("", label));
+    (!target.is_empty()).then(|| Path::new(package).join(target))
+}
+
+/// Remove the `#` comments of a Starlark file, keeping strings intact
+fn strip_comments(content: &str) -> String {
+    let mut stripped = String::with_capacity(content.len());
+    let mut quote = None;
+    let mut chars = content.chars();
+    while let Some(c) = chars.next() {
+        match (quote, c) {
+            (None, '#') => {
+                // Skip to the end of the line
+                if chars.by_ref().any(|c| c == '\n') {
+                    stripped.push('\n');
+                }
+                continue;
+            }
+            (None, '"' | '\'') => quote = Some(c),
+            (Some(q), _) if c == q => quote = None,
+            (Some(_), '\\') => {
+                stripped.push(c);
+                if let Some(escaped) = chars.next() {
+                    stripped.push(escaped);
+                }
+                continue;
+            }
+            (Some(_), '\n') => quote = None,
+            _ => {}
+        }
+        stripped.push(c);
+    }
+    stripped
+}
+
+/// Arguments of every call to `function`, e.g. `bazel_dep` or `maven.install`
+fn calls(content: &str, function: &str) -> Vec<String> {
+    let mut found = Vec::new();
+    let mut start = 0;
+    while let Some(index) = content[start..].find(function) {
+        let begin = start + index;
+        start = begin + function.len();
+        let is_prefixed = content[..begin]
+            .chars()
+            .next_back()
+            .is_some_and(|c| c.is_alphanumeric() || c == '_');
+        let rest = content[start..].trim_start();
+        if is_prefixed || !rest.starts_with('(') {
+            continue;
+        }
+        if let Some(arguments) = call_arguments(&rest[1..]) {
+            found.push(arguments.to_string());
+        }
+    }
+    found
+}
+
+/// Text up to the parenthesis closing a call, skipping nested brackets and strings
+fn call_arguments(text: &str) -> Option<&str> {
+    let mut depth = 0;
+    let mut quote = None;
+    let mut escaped = false;
+    for (index, c) in text.char_indices() {
+        if let Some(q) = quote {
+            if escaped {
+                escaped = false;
+            } else if c == '\\' {
+                escaped = true;
+            } else if c == q {
+                quote = None;
+            }
+            continue;
+        }
+        match c {
+            '"' | '\'' => quote = Some(c),
+            '(' | '[' | '{' => depth += 1,
+            ')' if depth == 0 => return Some(&text[..index]),
+            ')' | ']' | '}' => depth -= 1,
+            _ => {}
+        }
+    }
+    None
+}
+
+/// Keyword arguments of a call with a string or boolean value
+fn attributes(arguments: &str) -> HashMap<String, String> {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    let pattern = PATTERN.get_or_init(|| {
+        Regex::new(r#"\b(\w+)\s*=\s*(?:"([^"]*)"|'([^']*)'|(True|False)\b)"#)
+            .expect("valid attribute pattern")
+    });
+
+    let mut attributes = HashMap::new();
+    for captures in pattern.captures_iter(arguments) {
+        let value = captures
+            .get(2)
+            .or_else(|| captures.get(3))
+            .or_else(|| captures.get(4))
+            .map_or("", |value| value.as_str());
+        // The first assignment is the call's own, later ones may be nested
+        attributes
+            .entry(captures[1].to_string())
+            .or_insert_with(|| value.to_string());
+    }
+    attributes
+}
+
+/// Every string literal of a call
+fn string_literals(arguments: &str) -> impl Iterator<Item = &str> {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN
+        .get_or_init(|| Regex::new(r#""([^"]*)"|'([^']*)'"#).expect("valid string pattern"))
+        .captures_iter(arguments)
+        .filter_map(|captures| captures.get(1).or_else(|| captures.get(2)))
+        .map(|literal| literal.as_str())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const MODULE_BAZEL: &str = r#"module(name = "monorepo", version = "1.0")
+
+bazel_dep(name = "abseil-cpp", version = "20240116.2")
+bazel_dep(name = "googletest", version = "1.14.0", dev_dependency = True)
+bazel_dep(name = "tools", version = "0.1")  # vendored below
+local_path_override(module_name = "tools", path = "third_party/tools")
+
+maven = use_extension("@rules_jvm_external//:extensions.bzl", "maven")
+maven.install(
+    artifacts = ["com.google.guava:guava:32.1.2-jre"],
+    lock_file = "//:maven_install.json",
+)
+
+go_deps = use_extension("@gazelle//:extensions.bzl", "go_deps")
+go_deps.from_file(go_mod = "//services:go.mod")
+go_deps.module(
+    path = "github.com/pkg/errors",
+    version = "v0.9.1",
+    sum = "h1:FEBLx1zS214owpjy7qsBeixbURkuhQAwrK5UwLGTwt4=",
+)
+
+npm = use_extension("@aspect_rules_js//npm:extensions.bzl", "npm")
+npm.npm_translate_lock(
+    name = "npm",
+    pnpm_lock = "//frontend:pnpm-lock.yaml",
+)
+"#;
+
+    const WORKSPACE: &str = r#"load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
+
+http_archive(
+    name = "com_github_gflags_gflags",
+    strip_prefix = "gflags-2.2.2",
+    urls = ["https://github.com/gflags/gflags/archive/v2.2.2.tar.gz"],
+)
+
+http_archive(
+    name = "internal_assets",
+    urls = ["https://artifacts.example.com/assets.zip"],
+)
+
+load("@rules_jvm_external//:defs.bzl", "maven_install")
+
+maven_install(
+    artifacts = [
+        "junit:junit:4.13.2",
+        "io.netty:netty-transport-native-epoll:jar:linux-x86_64:4.1.94.Final",
+    ],
+    repositories = ["https://repo1.maven.org/maven2"],
+)
+"#;
+
+    const DEPS_BZL: &str = r#"load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+def go_dependencies():
+    go_repository(
+        name = "org_golang_x_text",
+        importpath = "golang.org/x/text",
+        sum = "h1:ScX5w1eTa3QqT8oi6+ziP7dTV1S2+ALU0bI+0zXKWiQ=",
+        version = "v0.14.0",
+    )
+    # go_repository(name = "com_github_old", importpath = "github.com/old/old", version = "v1.0.0")
+"#;
+
+    const MAVEN_INSTALL_JSON: &str = r#"{
+  "__AUTOGENERATED_FILE_DO_NOT_MODIFY_THIS_FILE_MANUALLY": "THERE_IS_NO_DATA_ONLY_ZUUL",
+  "artifacts": {
+    "com.google.guava:guava": {
+      "shasums": { "jar": "abc" },
+      "version": "32.1.2-jre"
+    },
+    "com.google.guava:failureaccess": {
+      "shasums": { "jar": "def" },
+      "version": "1.0.1"
+    },
+    "io.netty:netty-transport-native-epoll:jar:linux-x86_64": {
+      "shasums": { "jar": "123" },
+      "version": "4.1.94.Final"
+    },
+    "io.netty:netty-transport-native-epoll": {
+      "shasums": { "jar": "456" },
+      "version": "4.1.94.Final"
+    }
+  },
+  "dependencies": {
+    "com.google.guava:guava": ["com.google.guava:failureaccess"]
+  },
+  "version": "2"
+}"#;
+
+    const PNPM_LOCK: &str = "lockfileVersion: '9.0'
+
+importers:
+  .:
+    dependencies:
+      react:
+        specifier: ^18.2.0
+        version: 18.2.0
+
+packages:
+  react@18.2.0:
+    resolution: {integrity: sha512-abc}
+
+  loose-envify@1.4.0:
+    resolution: {integrity: sha512-def}
+";
+
+    fn found(dependencies: &[BazelDependency]) -> Vec<(&str, &str, &str)> {
+        dependencies
+            .iter()
+            .map(|dep| {
+                (
+                    dep.name.as_str(),
+                    dep.version.as_str(),
+                    dep.source_file.as_str(),
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    fn test_starlark_calls() {
+        let content = strip_comments(DEPS_BZL);
+        let repositories = calls(&content, "go_repository");
+        assert_eq!(repositories.len(), 1);
+        let attributes = attributes(&repositories[0]);
+        assert_eq!(attributes["importpath"], "golang.org/x/text");
+        assert_eq!(attributes["version"], "v0.14.0");
+
+        assert_eq!(
+            calls(r##"f(a = ")", b = g(1)) f (c = "#")"##, "f"),
+            vec![
+                r#"a = ")", b = g(1)"#.to_string(),
+                r##"c = "#""##.to_string()
+            ]
+        );
+        assert!(calls(r#"load("@x//:defs.bzl", "maven_install")"#, "maven_install").is_empty());
+        assert!(calls("not_bazel_dep(name = \"x\")", "bazel_dep").is_empty());
+    }
+
+    #[test]
+    fn test_label_path() {
+        assert_eq!(
+            label_path("//frontend:pnpm-lock.yaml"),
+            Some(PathBuf::from("frontend/pnpm-lock.yaml"))
+        );
+        assert_eq!(
+            label_path("@//:maven_install.json"),
+            Some(PathBuf::from("maven_install.json"))
+        );
+        assert_eq!(label_path(":go.mod"), Some(PathBuf::from("go.mod")));
+        assert_eq!(label_path("@maven//:maven_install.json"), None);
+    }
+
+    #[test]
+    fn test_github_archive() {
+        assert_eq!(
+            github_archive("https://github.com/gflags/gflags/archive/v2.2.2.tar.gz"),
+            Some((
+                "https://github.com/gflags/gflags".to_string(),
+                "v2.2.2".to_string()
+            ))
+        );
+        assert_eq!(
+            github_archive(
+                "https://github.com/abseil/abseil-cpp/releases/download/20240116.2/abseil-cpp-20240116.2.tar.gz"
+            )
+            .map(|(_, revision)| revision),
+            Some("20240116.2".to_string())
+        );
+        assert_eq!(
+            github_archive("https://github.com/madler/zlib/archive/refs/tags/v1.3.1.zip")
+                .map(|(_, revision)| revision),
+            Some("v1.3.1".to_string())
+        );
+        assert_eq!(github_archive("https://example.com/archive.tar.gz"), None);
+    }
+
+    #[test]
+    fn test_parse_maven_lockfile() {
+        let json: Value = serde_json::from_str(MAVEN_INSTALL_JSON).unwrap();
+        assert_eq!(
+            parse_maven_lockfile(&json),
+            vec![
+                (
+                    "com.google.guava:failureaccess".to_string(),
+                    "1.0.1".to_string()
+                ),
+                (
+                    "com.google.guava:guava".to_string(),
+                    "32.1.2-jre".to_string()
+                ),
+                (
+                    "io.netty:netty-transport-native-epoll".to_string(),
+                    "4.1.94.Final".to_string()
+                ),
+            ]
+        );
+
+        let v1 = serde_json::json!({
+            "dependency_tree": {
+                "dependencies": [
+                    { "coord": "junit:junit:4.13.2", "dependencies": [] },
+                    { "coord": "org.hamcrest:hamcrest-core:1.3" }
+                ],
+                "version": "0.1.0"
+            }
+        });
+        assert_eq!(
+            parse_maven_lockfile(&v1),
+            vec![
+                ("junit:junit".to_string(), "4.13.2".to_string()),
+                ("org.hamcrest:hamcrest-core".to_string(), "1.3".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_bazel_dependencies() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::create_dir_all(root.join("frontend")).unwrap();
+        fs::create_dir_all(root.join("services")).unwrap();
+        fs::write(root.join("MODULE.bazel"), MODULE_BAZEL).unwrap();
+        fs::write(root.join("WORKSPACE"), WORKSPACE).unwrap();
+        fs::write(root.join("deps.bzl"), DEPS_BZL).unwrap();
+        fs::write(root.join("maven_install.json"), MAVEN_INSTALL_JSON).unwrap();
+        fs::write(root.join("frontend/pnpm-lock.yaml"), PNPM_LOCK).unwrap();
+        fs::write(
+            root.join("services/go.mod"),
+            "module example.com/services\n",
+        )
+        .unwrap();
+
+        let config = FeludaConfig::default();
+        let build_files = read_build_files(root);
+        let names: Vec<_> = build_files.iter().map(|file| file.name.as_str()).collect();
+        assert_eq!(names, vec!["MODULE.bazel", "WORKSPACE", "deps.bzl"]);
+
+        let dependencies = bazel_dependencies(root, &build_files, &config);
+        assert_eq!(
+            found(&dependencies),
+            vec![
+                ("abseil-cpp", "20240116.2", "MODULE.bazel"),
+                ("googletest", "1.14.0", "MODULE.bazel"),
+                ("com_github_gflags_gflags", "v2.2.2", "WORKSPACE"),
+                ("junit:junit", "4.13.2", "WORKSPACE"),
+                (
+                    "io.netty:netty-transport-native-epoll",
+                    "4.1.94.Final",
+                    "WORKSPACE"
+                ),
+                (
+                    "com.google.guava:failureaccess",
+                    "1.0.1",
+                    "maven_install.json"
+                ),
+                ("com.google.guava:guava", "32.1.2-jre", "maven_install.json"),
+                ("github.com/pkg/errors", "v0.9.1", "MODULE.bazel"),
+                ("golang.org/x/text", "v0.14.0", "deps.bzl"),
+                ("loose-envify", "1.4.0", "frontend/pnpm-lock.yaml"),
+                ("react", "18.2.0", "frontend/pnpm-lock.yaml"),
+            ]
+        );
+        assert_eq!(dependencies[1].scope, DependencyScope::Dev);
+        assert_eq!(
+            go_mod_files(&build_files),
+            vec![PathBuf::from("services/go.mod")]
+        );
+
+        // A pnpm project in the workspace root is reported by the Node.js scan,
+        // go_repository rules generated from its go.mod by the Go scan
+        fs::write(root.join("frontend/package.json"), "{}").unwrap();
+        fs::write(root.join("go.mod"), "module example.com/monorepo\n").unwrap();
+        let mut recursive = FeludaConfig::default();
+        recursive.workspace.recursive = true;
+        let dependencies = bazel_dependencies(root, &build_files, &recursive);
+        assert!(dependencies
+            .iter()
+            .all(|dep| !matches!(dep.origin, Origin::Npm | Origin::Go)));
+        assert!(bazel_dependencies(root, &build_files, &config)
+            .iter()
+            .any(|dep| dep.origin == Origin::Npm));
+    }
+}
@@ -5,10 +5,12 @@ use std::path::Path;
 use std::process::Command;
 
 use crate::config::FeludaConfig;
-use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
 use crate::licenses::{
-    fetch_licenses_from_github, is_license_restrictive, LicenseCompatibility, LicenseInfo,
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
 };
+use crate::lookup_errors::LookupStatus;
 
 pub fn analyze_c_licenses(project_path: &str, config: &FeludaConfig) -> Vec<LicenseInfo> {
     log(
@@ -63,7 +65,9 @@ pub fn analyze_c_licenses(project_path: &str, config: &FeludaConfig) -> Vec<Lice
                 &format!("Processing dependency: {name} ({version})"),
             );
 
-            let license_result = fetch_license_for_c_dependency(&name, &version);
+            let license_result = time_dependency("c", &name, &version, || {
+                fetch_license_for_c_dependency(&name, &version)
+            });
             let license = Some(license_result);
             let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
 
@@ -84,6 +88,26 @@ pub fn analyze_c_licenses(project_path: &str, config: &FeludaConfig) -> Vec<Lice
                     Some(l) => crate::licenses::get_osi_status(l),
                     None => crate::licenses::OsiStatus::Unknown,
                 },
+                license_confidence: None,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: DependencyScope::Runtime,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
             }
         })
         .collect()
@@ -1,25 +1,71 @@
+use rayon::prelude::*;
 use regex::Regex;
 use serde_json::Value;
-use std::collections::{HashMap, HashSet};
+use std::collections::{BTreeMap, HashMap, HashSet, VecDeque};
 use std::fs;
 use std::path::Path;
 use std::process::Command;
 
+use crate::cache::{cache_license, get_cached_license};
 use crate::config::FeludaConfig;
-use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, attach_dependency_scopes, DependencyGraph,
+};
 use crate::licenses::{
-    fetch_licenses_from_github, is_license_restrictive, LicenseCompatibility, LicenseInfo,
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
 };
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
 
-#[derive(Debug, Clone)]
+/// Recipes of ConanCenter, the default Conan remote
+const CONAN_CENTER_INDEX: &str =
+    "https://raw.githubusercontent.com/conan-io/conan-center-index/master/recipes";
+
+/// Port manifests of the vcpkg registry, at a commit of microsoft/vcpkg
+const VCPKG_PORTS: &str = "https://raw.githubusercontent.com/microsoft/vcpkg";
+
+#[derive(Debug, Clone, Copy, PartialEq)]
 enum CppPackageManager {
     Vcpkg,
     Conan,
     CMake,
-    Bazel,
     Unknown,
 }
 
+/// A native dependency as resolved by its package manager
+#[derive(Debug, Clone, PartialEq)]
+struct CppDependency {
+    name: String,
+    version: String,
+    /// License read while resolving the dependency, e.g. from its vcpkg port
+    license: Option<String>,
+    scope: DependencyScope,
+    package_manager: CppPackageManager,
+}
+
+impl CppDependency {
+    fn new(name: String, version: String, package_manager: CppPackageManager) -> Self {
+        Self {
+            name,
+            version,
+            license: None,
+            scope: DependencyScope::Runtime,
+            package_manager,
+        }
+    }
+}
+
+/// A vcpkg port visited while resolving a manifest
+struct VcpkgPort {
+    version: String,
+    license: Option<String>,
+    /// Dependencies of the port and its enabled features, with whether they are host tools
+    dependencies: Vec<(String, bool)>,
+    features: HashSet<String>,
+}
+
 pub fn analyze_cpp_licenses(project_path: &str, config: &FeludaConfig) -> Vec<LicenseInfo> {
     log(
         LogLevel::Info,
@@ -40,49 +86,71 @@ pub fn analyze_cpp_licenses(project_path: &str, config: &FeludaConfig) -> Vec<Li
         }
     };
 
-    let (direct_dependencies, package_manager) =
-        detect_cpp_dependencies_with_type(project_path, config);
-    log(
-        LogLevel::Info,
-        &format!(
-            "Found {} direct C++ dependencies",
-            direct_dependencies.len()
-        ),
-    );
-    log_debug("Direct C++ dependencies", &direct_dependencies);
-
     let max_depth = config.dependencies.max_depth;
     log(
         LogLevel::Info,
         &format!("Using max dependency depth: {max_depth}"),
     );
 
-    let all_deps = resolve_cpp_dependencies(
-        project_path,
-        &direct_dependencies,
-        package_manager,
-        max_depth,
-    );
+    // vcpkg port manifests and conan.lock describe the whole dependency graph
+    let project_dir = Path::new(project_path).parent().unwrap_or(Path::new("."));
+    let (dependencies, graph) = match resolve_vcpkg_manifest(project_dir, max_depth)
+        .or_else(|| read_conan_lock(project_dir).map(|deps| (deps, None)))
+    {
+        Some(resolved) => resolved,
+        None => {
+            let (direct_dependencies, package_manager) =
+                detect_cpp_dependencies_with_type(project_path, config);
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Found {} direct C++ dependencies",
+                    direct_dependencies.len()
+                ),
+            );
+            log_debug("Direct C++ dependencies", &direct_dependencies);
+
+            let dependencies = resolve_cpp_dependencies(
+                project_path,
+                &direct_dependencies,
+                package_manager,
+                max_depth,
+            )
+            .into_iter()
+            .map(|(name, version)| CppDependency::new(name, version, package_manager))
+            .collect();
+            (dependencies, None)
+        }
+    };
     log(
         LogLevel::Info,
         &format!(
             "Total C++ dependencies (including transitive): {}",
-            all_deps.len()
+            dependencies.len()
         ),
     );
-    log_debug("All C++ dependencies", &all_deps);
+    log_debug("All C++ dependencies", &dependencies);
 
-    let dependencies = all_deps;
-
-    dependencies
-        .into_iter()
-        .map(|(name, version)| {
+    let mut licenses: Vec<LicenseInfo> = dependencies
+        .into_par_iter()
+        .map(|dependency| {
+            let CppDependency {
+                name,
+                version,
+                license,
+                scope,
+                package_manager,
+            } = dependency;
             log(
                 LogLevel::Info,
                 &format!("Processing dependency: {name} ({version})"),
             );
 
-            let license_result = fetch_license_for_cpp_dependency(&name, &version);
+            let license_result = license.unwrap_or_else(|| {
+                time_dependency("cpp", &name, &version, || {
+                    fetch_license_for_cpp_dependency(&name, &version, package_manager)
+                })
+            });
             let license = Some(license_result);
             let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
 
@@ -103,9 +171,36 @@ pub fn analyze_cpp_licenses(project_path: &str, config: &FeludaConfig) -> Vec<Li
                     Some(l) => crate::licenses::get_osi_status(l),
                     None => crate::licenses::OsiStatus::Unknown,
                 },
+                license_confidence: None,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
             }
         })
-        .collect()
+        .collect();
+
+    if let Some(graph) = graph {
+        attach_dependency_paths(&mut licenses, &graph.paths());
+        attach_dependency_requires(&mut licenses, &graph.requires());
+        attach_dependency_scopes(&mut licenses, &graph.scopes());
+    }
+    licenses
 }
 
 fn detect_cpp_dependencies_with_type(
@@ -138,14 +233,6 @@ fn detect_cpp_dependencies_with_type(
         return (cmake_deps, CppPackageManager::CMake);
     }
 
-    if let Ok(bazel_deps) = parse_bazel_dependencies(project_dir, config) {
-        log(
-            LogLevel::Info,
-            &format!("Found {} bazel dependencies", bazel_deps.len()),
-        );
-        return (bazel_deps, CppPackageManager::Bazel);
-    }
-
     (Vec::new(), CppPackageManager::Unknown)
 }
 
@@ -245,7 +332,6 @@ fn resolve_cpp_transitive_deps(
         CppPackageManager::Vcpkg => resolve_vcpkg_transitive(package_name, version),
         CppPackageManager::Conan => resolve_conan_transitive(package_name, version),
         CppPackageManager::CMake => resolve_cmake_transitive(package_name, version),
-        CppPackageManager::Bazel => resolve_bazel_transitive(package_name, version),
         CppPackageManager::Unknown => Ok(Vec::new()),
     }
 }
@@ -255,11 +341,9 @@ fn resolve_vcpkg_transitive(
     _version: &str,
 ) -> Result<Vec<(String, String)>, String> {
     // Try to fetch dependencies from vcpkg registry
-    let url = format!(
-        "https://raw.githubusercontent.com/microsoft/vcpkg/master/ports/{package_name}/vcpkg.json"
-    );
+    let url = format!("{VCPKG_PORTS}/master/ports/{package_name}/vcpkg.json");
 
-    if let Ok(response) = reqwest::blocking::get(&url) {
+    if let Ok(response) = registry::get(Registry::Vcpkg, &url) {
         if response.status().is_success() {
             if let Ok(json) = response.json::<Value>() {
                 let mut dependencies = Vec::new();
@@ -299,7 +383,7 @@ fn resolve_conan_transitive(
     // Try to fetch dependencies from Conan Center
     let url = format!("https://conan.io/center/api/packages/{package_name}/{version}");
 
-    if let Ok(response) = reqwest::blocking::get(&url) {
+    if let Ok(response) = registry::get(Registry::Conan, &url) {
         if response.status().is_success() {
             if let Ok(json) = response.json::<Value>() {
                 let mut dependencies = Vec::new();
@@ -365,41 +449,304 @@ fn resolve_cmake_transitive(
     Ok(Vec::new())
 }
 
-fn resolve_bazel_transitive(
-    package_name: &str,
-    _version: &str,
-) -> Result<Vec<(String, String)>, String> {
-    // For Bazel, we could try to query the build graph
-    // This would require being in a Bazel workspace
+/// A dependency entry of a vcpkg manifest or port
+#[derive(Debug, Clone)]
+struct VcpkgDependency {
+    name: String,
+    /// Needed on the build machine only, e.g. `vcpkg-cmake`
+    host: bool,
+    features: Vec<String>,
+    default_features: bool,
+}
 
-    // Try to run bazel query for dependencies
-    if let Ok(output) = Command::new("bazel")
-        .args(["query", &format!("deps(@{package_name}//...)")])
-        .output()
-    {
-        if output.status.success() {
-            let stdout_str = String::from_utf8_lossy(&output.stdout);
-            let mut dependencies = Vec::new();
+/// Entries of a vcpkg `dependencies` array: port names or objects
+fn vcpkg_dependencies(list: &Value) -> Vec<VcpkgDependency> {
+    list.as_array()
+        .into_iter()
+        .flatten()
+        .filter_map(|dep| match dep {
+            Value::String(name) => Some(VcpkgDependency {
+                name: name.clone(),
+                host: false,
+                features: Vec::new(),
+                default_features: true,
+            }),
+            Value::Object(obj) => Some(VcpkgDependency {
+                name: obj.get("name")?.as_str()?.to_string(),
+                host: obj.get("host").and_then(Value::as_bool).unwrap_or(false),
+                features: vcpkg_feature_names(obj.get("features").unwrap_or(&Value::Null)),
+                default_features: obj
+                    .get("default-features")
+                    .and_then(Value::as_bool)
+                    .unwrap_or(true),
+            }),
+            _ => None,
+        })
+        .collect()
+}
 
-            for line in stdout_str.lines() {
-                let trimmed = line.trim();
-                if trimmed.starts_with('@') && trimmed.contains("//") {
-                    if let Some(at_pos) = trimmed.find('@') {
-                        if let Some(slash_pos) = trimmed.find("//") {
-                            let dep_name = &trimmed[at_pos + 1..slash_pos];
-                            if !dep_name.is_empty() && dep_name != package_name {
-                                dependencies.push((dep_name.to_string(), "bazel".to_string()));
-                            }
-                        }
-                    }
+/// Feature names in a `features` or `default-features` array
+fn vcpkg_feature_names(list: &Value) -> Vec<String> {
+    list.as_array()
+        .into_iter()
+        .flatten()
+        .filter_map(|feature| feature.as_str().or_else(|| feature.get("name")?.as_str()))
+        .map(str::to_string)
+        .collect()
+}
+
+/// Version of a port manifest or override, with its port version as in `1.3.1#2`
+fn vcpkg_version(manifest: &Value) -> Option<String> {
+    let version = [
+        "version",
+        "version-semver",
+        "version-date",
+        "version-string",
+    ]
+    .iter()
+    .find_map(|key| manifest.get(key).and_then(Value::as_str))?;
+    match manifest.get("port-version").and_then(Value::as_u64) {
+        Some(port_version) if port_version > 0 => Some(format!("{version}#{port_version}")),
+        _ => Some(version.to_string()),
+    }
+}
+
+/// Manifest of a vcpkg port at the project's `builtin-baseline`
+///
+/// Without a baseline the ports of `$VCPKG_ROOT` are read, falling back to
+/// the latest ports of the vcpkg registry.
+fn fetch_vcpkg_port(name: &str, baseline: Option<&str>) -> Option<Value> {
+    if baseline.is_none() {
+        if let Ok(root) = std::env::var("VCPKG_ROOT") {
+            let port = Path::new(&root).join("ports").join(name).join("vcpkg.json");
+            if let Ok(content) = fs::read_to_string(&port) {
+                return serde_json::from_str(&content).ok();
+            }
+        }
+    }
+
+    let url = format!(
+        "{VCPKG_PORTS}/{}/ports/{name}/vcpkg.json",
+        baseline.unwrap_or("master")
+    );
+    log(LogLevel::Info, &format!("Fetching vcpkg port: {url}"));
+    match registry::get(Registry::Vcpkg, &url) {
+        Ok(response) if response.status().is_success() => response.json::<Value>().ok(),
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!("No vcpkg port found for {name}: HTTP {}", response.status()),
+            );
+            None
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch vcpkg port {name}"), &err);
+            None
+        }
+    }
+}
+
+/// Resolve the ports a `vcpkg.json` manifest depends on
+///
+/// Ports are versioned by the manifest's `overrides`, then by the port
+/// manifests at the `builtin-baseline`. The dependencies of every requested
+/// and default feature are followed up to `max_depth`, and `host`
+/// dependencies are build tools. `platform` expressions are not evaluated,
+/// so dependencies of all platforms are included.
+fn resolve_vcpkg_manifest(
+    project_dir: &Path,
+    max_depth: u32,
+) -> Option<(Vec<CppDependency>, Option<DependencyGraph>)> {
+    let content = fs::read_to_string(project_dir.join("vcpkg.json")).ok()?;
+    let manifest: Value = match serde_json::from_str(&content) {
+        Ok(manifest) => manifest,
+        Err(err) => {
+            log_error("Failed to parse vcpkg.json", &err);
+            return None;
+        }
+    };
+    let baseline = manifest["builtin-baseline"].as_str();
+    let overrides: HashMap<String, String> = manifest["overrides"]
+        .as_array()
+        .into_iter()
+        .flatten()
+        .filter_map(|o| Some((o["name"].as_str()?.to_string(), vcpkg_version(o)?)))
+        .collect();
+
+    let direct = vcpkg_dependencies(&manifest["dependencies"]);
+    let mut manifests: HashMap<String, Option<Value>> = HashMap::new();
+    let mut ports: BTreeMap<String, VcpkgPort> = BTreeMap::new();
+    let mut queue: VecDeque<(VcpkgDependency, u32)> =
+        direct.iter().cloned().map(|dep| (dep, 0)).collect();
+
+    while let Some((dependency, depth)) = queue.pop_front() {
+        let name = dependency.name.clone();
+        let port_manifest = manifests
+            .entry(name.clone())
+            .or_insert_with(|| fetch_vcpkg_port(&name, baseline));
+
+        let mut new_dependencies = Vec::new();
+        let port = ports.entry(name.clone()).or_insert_with(|| {
+            new_dependencies.extend(vcpkg_dependencies(
+                port_manifest
+                    .as_ref()
+                    .map_or(&Value::Null, |m| &m["dependencies"]),
+            ));
+            VcpkgPort {
+                version: overrides
+                    .get(&name)
+                    .cloned()
+                    .or_else(|| port_manifest.as_ref().and_then(vcpkg_version))
+                    .unwrap_or_else(|| "latest".to_string()),
+                // A port without a manifest is looked up again later
+                license: port_manifest.as_ref().map(|m| {
+                    m["license"]
+                        .as_str()
+                        .map(str::to_string)
+                        .unwrap_or_else(|| format!("Unknown license (vcpkg: {name})"))
+                }),
+                dependencies: Vec::new(),
+                features: HashSet::new(),
+            }
+        });
+
+        if let Some(port_manifest) = port_manifest {
+            let mut features = dependency.features.clone();
+            if dependency.default_features {
+                features.extend(vcpkg_feature_names(&port_manifest["default-features"]));
+            }
+            for feature in features {
+                if port.features.insert(feature.clone()) {
+                    new_dependencies.extend(vcpkg_dependencies(
+                        &port_manifest["features"][&feature]["dependencies"],
+                    ));
                 }
             }
+        }
 
-            return Ok(dependencies);
+        for dep in new_dependencies {
+            if dep.name != name && !port.dependencies.contains(&(dep.name.clone(), dep.host)) {
+                port.dependencies.push((dep.name.clone(), dep.host));
+            }
+            if depth < max_depth {
+                queue.push_back((dep, depth + 1));
+            }
         }
     }
+    log(
+        LogLevel::Info,
+        &format!(
+            "Resolved {} vcpkg ports at baseline {}",
+            ports.len(),
+            baseline.unwrap_or("(none)")
+        ),
+    );
 
-    Ok(Vec::new())
+    let scope = |host: bool| {
+        if host {
+            DependencyScope::Build
+        } else {
+            DependencyScope::Runtime
+        }
+    };
+    let mut graph = DependencyGraph::new();
+    for (name, port) in &ports {
+        graph.add_package(name, name, &port.version);
+    }
+    for (name, port) in &ports {
+        for (dep, host) in &port.dependencies {
+            graph.add_dependency_with_scope(name, dep, scope(*host));
+        }
+    }
+    for dep in &direct {
+        graph.add_direct_with_scope(&dep.name, scope(dep.host));
+    }
+
+    let dependencies = ports
+        .into_iter()
+        .map(|(name, port)| CppDependency {
+            license: port.license,
+            ..CppDependency::new(name, port.version, CppPackageManager::Vcpkg)
+        })
+        .collect();
+    Some((dependencies, Some(graph)))
+}
+
+/// Packages pinned in the project's `conan.lock`
+fn read_conan_lock(project_dir: &Path) -> Option<Vec<CppDependency>> {
+    let content = fs::read_to_string(project_dir.join("conan.lock")).ok()?;
+    let dependencies = parse_conan_lock(&content)?;
+    log(
+        LogLevel::Info,
+        &format!("Found {} packages in conan.lock", dependencies.len()),
+    );
+    Some(dependencies)
+}
+
+/// Read the references of a `conan.lock`
+///
+/// Conan 2 lists them under `requires` and `build_requires`. Conan 1 writes a
+/// `graph_lock` whose nodes carry a `ref`, with `"context": "build"` for tool
+/// requirements.
+fn parse_conan_lock(content: &str) -> Option<Vec<CppDependency>> {
+    let lock: Value = match serde_json::from_str(content) {
+        Ok(lock) => lock,
+        Err(err) => {
+            log_error("Failed to parse conan.lock", &err);
+            return None;
+        }
+    };
+
+    let mut references: Vec<(&str, DependencyScope)> = Vec::new();
+    for (key, scope) in [
+        ("requires", DependencyScope::Runtime),
+        ("build_requires", DependencyScope::Build),
+    ] {
+        for reference in lock[key].as_array().into_iter().flatten() {
+            if let Some(reference) = reference.as_str() {
+                references.push((reference, scope));
+            }
+        }
+    }
+    for node in lock["graph_lock"]["nodes"]
+        .as_object()
+        .into_iter()
+        .flat_map(|nodes| nodes.values())
+    {
+        if let Some(reference) = node["ref"].as_str() {
+            let scope = if node["context"] == "build" {
+                DependencyScope::Build
+            } else {
+                DependencyScope::Runtime
+            };
+            references.push((reference, scope));
+        }
+    }
+
+    let mut dependencies: Vec<CppDependency> = Vec::new();
+    for (reference, scope) in references {
+        let Some((name, version)) = parse_conan_reference(reference) else {
+            continue;
+        };
+        match dependencies
+            .iter_mut()
+            .find(|dep| dep.name == name && dep.version == version)
+        {
+            Some(existing) => existing.scope = existing.scope.min(scope),
+            None => dependencies.push(CppDependency {
+                scope,
+                ..CppDependency::new(name, version, CppPackageManager::Conan)
+            }),
+        }
+    }
+    Some(dependencies)
+}
+
+/// Name and version of a reference such as `zlib/1.3.1@user/channel#<revision>%<timestamp>`
+fn parse_conan_reference(reference: &str) -> Option<(String, String)> {
+    let reference = reference.split(['#', '@']).next()?;
+    let (name, version) = reference.split_once('/')?;
+    Some((name.to_string(), version.to_string()))
 }
 
 fn parse_vcpkg_dependencies(
@@ -571,76 +918,36 @@ fn parse_cmake_dependencies(
     Ok(dependencies)
 }
 
-fn parse_bazel_dependencies(
-    project_dir: &Path,
-    _config: &FeludaConfig,
-) -> Result<Vec<(String, String)>, String> {
-    let module_bazel = project_dir.join("MODULE.bazel");
-    let workspace = project_dir.join("WORKSPACE");
-
-    if module_bazel.exists() {
-        parse_module_bazel(&module_bazel)
-    } else if workspace.exists() {
-        parse_workspace_bazel(&workspace)
-    } else {
-        Err("No Bazel build files found".to_string())
-    }
-}
-
-fn parse_module_bazel(module_path: &Path) -> Result<Vec<(String, String)>, String> {
-    let content =
-        fs::read_to_string(module_path).map_err(|e| format!("Failed to read MODULE.bazel: {e}"))?;
-
-    let mut dependencies = Vec::new();
-
-    let bazel_dep_regex =
-        Regex::new(r#"bazel_dep\s*\(\s*name\s*=\s*"([^"]+)"\s*,\s*version\s*=\s*"([^"]+)""#)
-            .map_err(|e| format!("Failed to compile bazel_dep regex: {e}"))?;
-
-    for cap in bazel_dep_regex.captures_iter(&content) {
-        if let (Some(name), Some(version)) = (cap.get(1), cap.get(2)) {
-            dependencies.push((name.as_str().to_string(), version.as_str().to_string()));
-        }
-    }
-
-    Ok(dependencies)
-}
-
-fn parse_workspace_bazel(workspace_path: &Path) -> Result<Vec<(String, String)>, String> {
-    let content =
-        fs::read_to_string(workspace_path).map_err(|e| format!("Failed to read WORKSPACE: {e}"))?;
-
-    let mut dependencies = Vec::new();
-
-    let http_archive_regex = Regex::new(r#"http_archive\s*\(\s*name\s*=\s*"([^"]+)""#)
-        .map_err(|e| format!("Failed to compile http_archive regex: {e}"))?;
+fn fetch_license_for_cpp_dependency(
+    name: &str,
+    version: &str,
+    package_manager: CppPackageManager,
+) -> String {
+    let registry = match (package_manager, version) {
+        (_, "system") => return fetch_license_from_system_package(name),
+        (CppPackageManager::Vcpkg, _) => "vcpkg",
+        (CppPackageManager::Conan, _) => "conan",
+        (_, "latest" | "git") => "vcpkg",
+        (_, v) if v.chars().next().unwrap_or('0').is_ascii_digit() => "conan",
+        _ => return format!("Unknown license for {name}: {version}"),
+    };
 
-    for cap in http_archive_regex.captures_iter(&content) {
-        if let Some(name) = cap.get(1) {
-            dependencies.push((name.as_str().to_string(), "archive".to_string()));
-        }
+    if let Some(license) = get_cached_license(registry, name, version) {
+        return license;
     }
 
-    Ok(dependencies)
-}
-
-fn fetch_license_for_cpp_dependency(name: &str, version: &str) -> String {
-    match version {
-        "latest" | "git" => fetch_license_from_vcpkg_registry(name),
-        v if v.chars().next().unwrap_or('0').is_ascii_digit() => {
-            fetch_license_from_conan_center(name, version)
-        }
-        "system" => fetch_license_from_system_package(name),
-        _ => format!("Unknown license for {name}: {version}"),
-    }
+    let license = match registry {
+        "vcpkg" => fetch_license_from_vcpkg_registry(name),
+        _ => fetch_license_from_conan_center(name, version),
+    };
+    cache_license(registry, name, version, &license);
+    license
 }
 
 fn fetch_license_from_vcpkg_registry(package_name: &str) -> String {
-    let url = format!(
-        "https://raw.githubusercontent.com/microsoft/vcpkg/master/ports/{package_name}/vcpkg.json"
-    );
+    let url = format!("{VCPKG_PORTS}/master/ports/{package_name}/vcpkg.json");
 
-    if let Ok(response) = reqwest::blocking::get(&url) {
+    if let Ok(response) = registry::get(Registry::Vcpkg, &url) {
         if response.status().is_success() {
             if let Ok(json) = response.json::<Value>() {
                 if let Some(license) = json.get("license").and_then(|l| l.as_str()) {
@@ -653,20 +960,70 @@ fn fetch_license_from_vcpkg_registry(package_name: &str) -> String {
     format!("Unknown license (vcpkg: {package_name})")
 }
 
+/// License of a ConanCenter recipe
+///
+/// The recipe's `config.yml` maps each version to the folder of its
+/// `conanfile.py`, which declares the `license`.
 fn fetch_license_from_conan_center(package_name: &str, version: &str) -> String {
-    let url = format!("https://conan.io/center/api/packages/{package_name}/{version}");
-
-    if let Ok(response) = reqwest::blocking::get(&url) {
-        if response.status().is_success() {
-            if let Ok(json) = response.json::<Value>() {
-                if let Some(license) = json.get("license").and_then(|l| l.as_str()) {
-                    return license.to_string();
-                }
-            }
+    let fetch = |url: String| -> Option<String> {
+        log(LogLevel::Info, &format!("Fetching Conan recipe: {url}"));
+        let response = registry::get(Registry::Conan, &url).ok()?;
+        if !response.status().is_success() {
+            return None;
         }
-    }
+        response.text().ok()
+    };
+
+    let folder = fetch(format!("{CONAN_CENTER_INDEX}/{package_name}/config.yml"))
+        .and_then(|config| serde_yaml::from_str::<serde_yaml::Value>(&config).ok())
+        .and_then(|config| {
+            config
+                .get("versions")?
+                .get(version)?
+                .get("folder")?
+                .as_str()
+                .map(str::to_string)
+        })
+        .unwrap_or_else(|| "all".to_string());
+
+    fetch(format!(
+        "{CONAN_CENTER_INDEX}/{package_name}/{folder}/conanfile.py"
+    ))
+    .and_then(|recipe| license_from_conan_recipe(&recipe))
+    .unwrap_or_else(|| format!("Unknown license (conan: {package_name})"))
+}
 
-    format!("Unknown license (conan: {package_name})")
+/// The `license` attribute of a Conan recipe
+///
+/// A tuple lists the licenses of different parts of the package, which all apply.
+fn license_from_conan_recipe(recipe: &str) -> Option<String> {
+    let attribute =
+        Regex::new(r#"(?m)^\s*license\s*=\s*(\([^)]*\)|\[[^\]]*\]|"[^"]*"|'[^']*')"#).ok()?;
+    let quoted = Regex::new(r#"["']([^"']+)["']"#).ok()?;
+
+    let value = attribute.captures(recipe)?;
+    let licenses: Vec<&str> = quoted
+        .captures_iter(&value[1])
+        .filter_map(|c| c.get(1))
+        .map(|m| m.as_str().trim())
+        .collect();
+    match licenses.as_slice() {
+        [] => None,
+        [license] => Some(license.to_string()),
+        _ => Some(
+            licenses
+                .iter()
+                .map(|l| {
+                    if l.contains(' ') {
+                        format!("({l})")
+                    } else {
+                        l.to_string()
+                    }
+                })
+                .collect::<Vec<_>>()
+                .join(" AND "),
+        ),
+    }
 }
 
 fn fetch_license_from_system_package(package_name: &str) -> String {
@@ -797,4 +1154,147 @@ find_package(OpenSSL REQUIRED)
         // Should be empty since no build files exist
         assert!(result.is_empty());
     }
+
+    #[test]
+    fn test_parse_conan_lock() {
+        let v2 = r#"{
+            "version": "0.5",
+            "requires": [
+                "zlib/1.3.1#f52e03ae3d251dec704634230cd806a2%1708593606.497",
+                "openssl/3.2.1@corp/stable#5f4e3b2a%1708593600.0"
+            ],
+            "build_requires": [
+                "cmake/3.28.1#3b8a1d4c%1708593600.0",
+                "zlib/1.3.1#f52e03ae3d251dec704634230cd806a2%1708593606.497"
+            ],
+            "python_requires": []
+        }"#;
+        let deps = parse_conan_lock(v2).unwrap();
+        assert_eq!(deps.len(), 3);
+        assert_eq!(deps[0].name, "zlib");
+        assert_eq!(deps[0].version, "1.3.1");
+        assert_eq!(deps[0].scope, DependencyScope::Runtime);
+        assert_eq!(deps[1].name, "openssl");
+        assert_eq!(deps[1].version, "3.2.1");
+        assert_eq!(deps[2].name, "cmake");
+        assert_eq!(deps[2].scope, DependencyScope::Build);
+        assert!(deps
+            .iter()
+            .all(|d| d.package_manager == CppPackageManager::Conan));
+
+        let v1 = r#"{
+            "graph_lock": {
+                "nodes": {
+                    "0": {"ref": "app/1.0", "requires": ["1"]},
+                    "1": {"ref": "fmt/10.2.1#revision", "context": "host"},
+                    "2": {"ref": "ninja/1.11.1", "context": "build"}
+                }
+            },
+            "version": "0.4"
+        }"#;
+        let deps = parse_conan_lock(v1).unwrap();
+        let fmt = deps.iter().find(|d| d.name == "fmt").unwrap();
+        assert_eq!(fmt.version, "10.2.1");
+        assert_eq!(fmt.scope, DependencyScope::Runtime);
+        let ninja = deps.iter().find(|d| d.name == "ninja").unwrap();
+        assert_eq!(ninja.scope, DependencyScope::Build);
+
+        assert!(parse_conan_lock("not json").is_none());
+    }
+
+    #[test]
+    fn test_license_from_conan_recipe() {
+        let recipe = r#"
+class ZlibConan(ConanFile):
+    name = "zlib"
+    package_type = "library"
+    license = "Zlib"
+    url = "https://github.com/conan-io/conan-center-index"
+"#;
+        assert_eq!(license_from_conan_recipe(recipe).as_deref(), Some("Zlib"));
+
+        let recipe = r#"
+class QtConan(ConanFile):
+    license = ("LGPL-3.0-only", "GPL-2.0-only OR GPL-3.0-only")
+"#;
+        assert_eq!(
+            license_from_conan_recipe(recipe).as_deref(),
+            Some("LGPL-3.0-only AND (GPL-2.0-only OR GPL-3.0-only)")
+        );
+
+        assert!(license_from_conan_recipe("class Empty(ConanFile):\n    pass\n").is_none());
+    }
+
+    #[test]
+    fn test_resolve_vcpkg_manifest() {
+        let project = TempDir::new().unwrap();
+        fs::write(
+            project.path().join("vcpkg.json"),
+            r#"{
+                "name": "app",
+                "dependencies": [
+                    {"name": "curl", "features": ["ssl"]},
+                    {"name": "vcpkg-cmake", "host": true}
+                ],
+                "overrides": [{"name": "zlib", "version": "1.2.13"}]
+            }"#,
+        )
+        .unwrap();
+
+        let root = TempDir::new().unwrap();
+        let port = |name: &str, manifest: &str| {
+            let dir = root.path().join("ports").join(name);
+            fs::create_dir_all(&dir).unwrap();
+            fs::write(dir.join("vcpkg.json"), manifest).unwrap();
+        };
+        port(
+            "curl",
+            r#"{
+                "name": "curl", "version": "8.6.0", "port-version": 2, "license": "curl",
+                "dependencies": [{"name": "vcpkg-cmake", "host": true}],
+                "default-features": ["non-http"],
+                "features": {
+                    "non-http": {"description": "Protocols besides HTTP"},
+                    "ssl": {"dependencies": ["openssl"]},
+                    "zstd": {"dependencies": ["zstd"]}
+                }
+            }"#,
+        );
+        port(
+            "openssl",
+            r#"{"name": "openssl", "version": "3.2.1", "license": "Apache-2.0", "dependencies": ["zlib"]}"#,
+        );
+        port(
+            "zlib",
+            r#"{"name": "zlib", "version": "1.3.1", "license": "Zlib"}"#,
+        );
+        port(
+            "vcpkg-cmake",
+            r#"{"name": "vcpkg-cmake", "version-date": "2024-04-23"}"#,
+        );
+
+        let (deps, graph) = temp_env::with_var("VCPKG_ROOT", Some(root.path()), || {
+            resolve_vcpkg_manifest(project.path(), 10).unwrap()
+        });
+        let find = |name: &str| deps.iter().find(|d| d.name == name).unwrap();
+
+        assert_eq!(deps.len(), 4);
+        assert!(deps.iter().all(|d| d.name != "zstd"));
+        assert_eq!(find("curl").version, "8.6.0#2");
+        assert_eq!(find("curl").license.as_deref(), Some("curl"));
+        assert_eq!(find("zlib").version, "1.2.13");
+        assert_eq!(
+            find("vcpkg-cmake").license.as_deref(),
+            Some("Unknown license (vcpkg: vcpkg-cmake)")
+        );
+
+        let graph = graph.unwrap();
+        let scopes = graph.scopes();
+        assert_eq!(scopes["zlib@1.2.13"], DependencyScope::Runtime);
+        assert_eq!(scopes["vcpkg-cmake@2024-04-23"], DependencyScope::Build);
+        assert_eq!(
+            graph.paths()["zlib@1.2.13"],
+            vec!["curl@8.6.0#2", "openssl@3.2.1", "zlib@1.2.13"]
+        );
+    }
 }
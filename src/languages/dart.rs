@@ -0,0 +1,643 @@
+use rayon::prelude::*;
+use serde::Deserialize;
+use serde_json::Value;
+use std::collections::{BTreeMap, HashMap};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::license_detector::detect_license_in_dir;
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, License,
+    LicenseCompatibility, LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
+use crate::repository_license::fetch_repository_license;
+
+const PUB_DEV: &str = "https://pub.dev";
+
+/// SPDX identifiers in the casing the SPDX list uses, for pub.dev's lowercase `license:` tags
+const SPDX_IDS: [&str; 18] = [
+    "0BSD",
+    "AGPL-3.0",
+    "Apache-2.0",
+    "BSD-2-Clause",
+    "BSD-3-Clause",
+    "BSL-1.0",
+    "CC0-1.0",
+    "EPL-2.0",
+    "GPL-2.0",
+    "GPL-3.0",
+    "ISC",
+    "LGPL-2.1",
+    "LGPL-3.0",
+    "MIT",
+    "MIT-0",
+    "MPL-2.0",
+    "Unlicense",
+    "Zlib",
+];
+
+/// Where pub gets a package from
+#[derive(Debug, Clone, PartialEq)]
+pub enum PubSource {
+    /// A package server, pub.dev unless the package says otherwise
+    Hosted {
+        url: String,
+    },
+    Git {
+        url: String,
+        resolved_ref: String,
+        /// Directory of the package inside the repository
+        path: String,
+    },
+    Path(String),
+}
+
+#[derive(Deserialize)]
+struct PubspecLock {
+    #[serde(default)]
+    packages: BTreeMap<String, LockedPackage>,
+}
+
+#[derive(Deserialize)]
+struct LockedPackage {
+    dependency: Option<String>,
+    /// A map for hosted, git and path packages, the SDK name for SDK packages
+    description: serde_yaml::Value,
+    source: String,
+    version: String,
+}
+
+/// A package pinned in `pubspec.lock`
+#[derive(Debug, Clone, PartialEq)]
+pub struct PubPackage {
+    pub name: String,
+    pub version: String,
+    pub source: PubSource,
+    /// Listed in the project's own pubspec.yaml
+    pub direct: bool,
+    pub scope: DependencyScope,
+}
+
+pub fn analyze_dart_licenses(
+    lock_file_path: &str,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing Dart dependencies from: {lock_file_path}"),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let content = match fs::read_to_string(lock_file_path) {
+        Ok(content) => content,
+        Err(err) => {
+            log_error("Failed to read pubspec.lock", &err);
+            return Vec::new();
+        }
+    };
+
+    let packages = parse_pubspec_lock(&content);
+    log(
+        LogLevel::Info,
+        &format!("Found {} packages in pubspec.lock", packages.len()),
+    );
+    log_debug("Pub packages", &packages);
+
+    let packages: Vec<PubPackage> = if config.dependencies.max_depth <= 1 {
+        packages
+            .into_iter()
+            .filter(|package| package.direct)
+            .collect()
+    } else {
+        packages
+    };
+
+    let project_dir = Path::new(lock_file_path)
+        .parent()
+        .unwrap_or_else(|| Path::new("."));
+
+    let licenses: Vec<LicenseInfo> = packages
+        .into_par_iter()
+        .map(|package| analyze_package(package, project_dir, &known_licenses, config, no_local))
+        .collect();
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} Dart dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+/// Read the `packages` of a `pubspec.lock`, sorted by name
+///
+/// SDK packages such as `flutter` ship with the Dart or Flutter SDK and are skipped.
+fn parse_pubspec_lock(content: &str) -> Vec<PubPackage> {
+    let lock: PubspecLock = match serde_yaml::from_str(content) {
+        Ok(lock) => lock,
+        Err(err) => {
+            log_error("Failed to parse pubspec.lock", &err);
+            return Vec::new();
+        }
+    };
+
+    lock.packages
+        .into_iter()
+        .filter_map(|(name, package)| {
+            let description = &package.description;
+            let text = |key: &str| {
+                description
+                    .get(key)
+                    .and_then(|value| value.as_str())
+                    .unwrap_or_default()
+                    .to_string()
+            };
+
+            let source = match package.source.as_str() {
+                "hosted" => PubSource::Hosted {
+                    url: description
+                        .get("url")
+                        .and_then(|url| url.as_str())
+                        .unwrap_or(PUB_DEV)
+                        .trim_end_matches('/')
+                        .to_string(),
+                },
+                "git" => PubSource::Git {
+                    url: text("url"),
+                    resolved_ref: text("resolved-ref"),
+                    path: text("path"),
+                },
+                "path" => PubSource::Path(text("path")),
+                source => {
+                    log(LogLevel::Info, &format!("Skipping {source} package {name}"));
+                    return None;
+                }
+            };
+
+            let dependency = package.dependency.as_deref().unwrap_or("transitive");
+            Some(PubPackage {
+                name,
+                version: package.version,
+                source,
+                direct: dependency.starts_with("direct"),
+                scope: if dependency == "direct dev" {
+                    DependencyScope::Dev
+                } else {
+                    DependencyScope::Runtime
+                },
+            })
+        })
+        .collect()
+}
+
+fn analyze_package(
+    package: PubPackage,
+    project_dir: &Path,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> LicenseInfo {
+    log(
+        LogLevel::Info,
+        &format!(
+            "Processing pub package: {} ({})",
+            package.name, package.version
+        ),
+    );
+
+    let (license_result, license_confidence) =
+        time_dependency("pub", &package.name, &package.version, || {
+            fetch_license_for_package(&package, project_dir, no_local)
+        });
+    let license = Some(license_result);
+    let is_restrictive = is_license_restrictive(&license, known_licenses, config.strict);
+
+    if is_restrictive {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Restrictive license found: {license:?} for {}",
+                package.name
+            ),
+        );
+    }
+
+    LicenseInfo {
+        name: package.name,
+        version: package.version,
+        license: license.clone(),
+        is_restrictive,
+        compatibility: LicenseCompatibility::Unknown,
+        osi_status: match &license {
+            Some(l) => crate::licenses::get_osi_status(l),
+            None => crate::licenses::OsiStatus::Unknown,
+        },
+        license_confidence,
+        source_file: None,
+        dependency_path: None,
+        tier: None,
+        vulnerabilities: None,
+        copyright: None,
+        legal_files: None,
+        chosen_license: None,
+        requires: None,
+        scope: package.scope,
+        manual_license: None,
+        health: None,
+        obligations: None,
+        explanation: None,
+        repository: None,
+        aliases: None,
+        purl: None,
+        review: None,
+        status: LookupStatus::Ok,
+        error: None,
+    }
+}
+
+/// License of a pub package, classified from its pub cache copy when there is
+/// one, else from pub.dev or its git repository
+fn fetch_license_for_package(
+    package: &PubPackage,
+    project_dir: &Path,
+    no_local: bool,
+) -> (String, Option<f32>) {
+    let local = |dir: Option<PathBuf>| {
+        dir.filter(|_| !no_local)
+            .and_then(|dir| detect_license_in_dir(&dir))
+            .map(|detected| (detected.license, Some(detected.confidence)))
+    };
+
+    let detected = match &package.source {
+        PubSource::Hosted { url } => local(hosted_cache_dir(url, &package.name, &package.version))
+            .or_else(|| {
+                if is_pub_dev(url) {
+                    fetch_license_from_pub_dev(&package.name, &package.version)
+                        .map(|license| (license, None))
+                } else {
+                    log(
+                        LogLevel::Warn,
+                        &format!(
+                            "{} is hosted on {url}, only its pub cache copy can be checked",
+                            package.name
+                        ),
+                    );
+                    None
+                }
+            }),
+        PubSource::Git {
+            url,
+            resolved_ref,
+            path,
+        } => local(git_cache_dir(url, resolved_ref, path)).or_else(|| {
+            fetch_repository_license(url, resolved_ref)
+                .map(|(license, confidence)| (license, Some(confidence)))
+        }),
+        // Path dependencies only exist locally
+        PubSource::Path(path) => detect_license_in_dir(&project_dir.join(path))
+            .map(|detected| (detected.license, Some(detected.confidence))),
+    };
+
+    detected.unwrap_or_else(|| {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "No license found for {} ({})",
+                package.name, package.version
+            ),
+        );
+        ("Unknown".to_string(), None)
+    })
+}
+
+fn is_pub_dev(url: &str) -> bool {
+    matches!(
+        url.trim_end_matches('/'),
+        "https://pub.dev" | "https://pub.dartlang.org"
+    )
+}
+
+/// The pub cache: `PUB_CACHE`, or pub's default location for the platform
+fn pub_cache_dir() -> Option<PathBuf> {
+    if let Ok(dir) = std::env::var("PUB_CACHE") {
+        return Some(PathBuf::from(dir));
+    }
+    if cfg!(windows) {
+        std::env::var("LOCALAPPDATA")
+            .ok()
+            .map(|dir| Path::new(&dir).join("Pub").join("Cache"))
+    } else {
+        std::env::var("HOME")
+            .ok()
+            .map(|home| Path::new(&home).join(".pub-cache"))
+    }
+}
+
+/// Unpacked copy of a hosted package, in `hosted/<server>/<name>-<version>`
+fn hosted_cache_dir(url: &str, name: &str, version: &str) -> Option<PathBuf> {
+    let hosted = pub_cache_dir()?.join("hosted");
+    let server = url
+        .trim_start_matches("https://")
+        .trim_start_matches("http://")
+        .trim_end_matches('/')
+        .replace('/', "%47");
+    // Packages fetched before pub.dev replaced pub.dartlang.org live under the old name
+    let servers = if is_pub_dev(url) {
+        vec!["pub.dev".to_string(), "pub.dartlang.org".to_string()]
+    } else {
+        vec![server]
+    };
+
+    servers
+        .into_iter()
+        .map(|server| hosted.join(server).join(format!("{name}-{version}")))
+        .find(|dir| dir.is_dir())
+}
+
+/// Checkout of a git package at its resolved revision, in `git/<repository>-<ref>`
+fn git_cache_dir(url: &str, resolved_ref: &str, path: &str) -> Option<PathBuf> {
+    let repository = url
+        .trim_end_matches('/')
+        .trim_end_matches(".git")
+        .rsplit(['/', ':'])
+        .next()?;
+    let dir = pub_cache_dir()?
+        .join("git")
+        .join(format!("{repository}-{resolved_ref}"))
+        .join(path);
+    dir.is_dir().then_some(dir)
+}
+
+/// License from the `license:` tags pub.dev's analysis assigns to a package
+///
+/// Tags such as `license:osi-approved` describe the license rather than name
+/// it. A package with several license files gets one tag per license.
+fn license_from_pub_tags(tags: &[String]) -> Option<String> {
+    let licenses: Vec<String> = tags
+        .iter()
+        .filter_map(|tag| tag.strip_prefix("license:"))
+        .filter(|id| !matches!(*id, "osi-approved" | "fsf-libre" | "unknown"))
+        .map(|id| {
+            SPDX_IDS
+                .iter()
+                .find(|spdx| spdx.eq_ignore_ascii_case(id))
+                .map_or_else(|| id.to_string(), |spdx| spdx.to_string())
+        })
+        .collect();
+
+    match licenses.as_slice() {
+        [] => None,
+        [license] => Some(license.clone()),
+        _ => Some(licenses.join(" AND ")),
+    }
+}
+
+/// GitHub repository from the `repository` or `homepage` of a pubspec
+fn pubspec_repository(pubspec: &Value) -> Option<String> {
+    ["repository", "homepage"]
+        .iter()
+        .filter_map(|key| pubspec[key].as_str())
+        .find(|url| url.contains("github.com/"))
+        .map(|url| {
+            // Monorepos link to a package's subdirectory: https://github.com/owner/repo/tree/main/pkg
+            let parts: Vec<&str> = url.trim_end_matches('/').splitn(6, '/').collect();
+            parts.iter().take(5).copied().collect::<Vec<_>>().join("/")
+        })
+}
+
+pub fn fetch_license_from_pub_dev(name: &str, version: &str) -> Option<String> {
+    if let Some(license) = get_cached_license("pub", name, version) {
+        return Some(license);
+    }
+
+    let fetch = |url: &str| -> Option<Value> {
+        log(LogLevel::Info, &format!("Fetching from pub.dev: {url}"));
+        match registry::get(Registry::PubDev, url) {
+            Ok(response) if response.status().is_success() => response.json::<Value>().ok(),
+            Ok(response) => {
+                log(
+                    LogLevel::Error,
+                    &format!(
+                        "Failed to fetch metadata for {name}: HTTP {}",
+                        response.status()
+                    ),
+                );
+                None
+            }
+            Err(err) => {
+                log_error(&format!("Failed to fetch metadata for {name}"), &err);
+                None
+            }
+        }
+    };
+
+    let tags: Vec<String> = fetch(&format!("{PUB_DEV}/api/packages/{name}/score"))
+        .and_then(|score| {
+            score["tags"].as_array().map(|tags| {
+                tags.iter()
+                    .filter_map(|tag| tag.as_str().map(str::to_string))
+                    .collect()
+            })
+        })
+        .unwrap_or_default();
+
+    // pub.dev analyzes the latest version; older versions fall back to the repository
+    let license = license_from_pub_tags(&tags).or_else(|| {
+        let metadata = fetch(&format!("{PUB_DEV}/api/packages/{name}/versions/{version}"))?;
+        let repository = pubspec_repository(&metadata["pubspec"])?;
+        fetch_repository_license(&repository, "").map(|(license, _)| license)
+    });
+
+    match license {
+        Some(license) => {
+            cache_license("pub", name, version, &license);
+            Some(license)
+        }
+        None => {
+            log(
+                LogLevel::Warn,
+                &format!("No license found on pub.dev for {name} ({version})"),
+            );
+            None
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const MIT_LICENSE: &str = "Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the \"Software\"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:\n\nThe above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.\n\nTHE SOFTWARE IS PROVIDED \"AS IS\", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.";
+
+    const PUBSPEC_LOCK: &str = r#"# Generated by pub
+# See https://dart.dev/tools/pub/glossary#lockfile
+packages:
+  async:
+    dependency: transitive
+    description:
+      name: async
+      sha256: "947bfcf187f74dbc5e146c9eb9c0f10c9f8b30743e341481c1e2ed3ecc18c20c"
+      url: "https://pub.dev"
+    source: hosted
+    version: "2.11.0"
+  flutter:
+    dependency: "direct main"
+    description: flutter
+    source: sdk
+    version: "0.0.0"
+  http:
+    dependency: "direct main"
+    description:
+      name: http
+      sha256: "5895291c13fa8a3bd82e76d5627f69e0d85ca6a30dcac95c4ea19a5d555879c2"
+      url: "https://pub.dev"
+    source: hosted
+    version: "0.13.6"
+  lints:
+    dependency: "direct dev"
+    description:
+      name: lints
+      url: "https://dart.cloudsmith.io/acme/private/"
+    source: hosted
+    version: "2.1.1"
+  design_system:
+    dependency: "direct main"
+    description:
+      path: "../design_system"
+      relative: true
+    source: path
+    version: "1.0.0"
+  charts:
+    dependency: "direct main"
+    description:
+      path: "packages/charts"
+      ref: main
+      resolved-ref: "8d5a3c0e1f2b4a6c9e7d1b3a5c7e9f1d3b5a7c9e"
+      url: "https://github.com/acme/flutter-widgets.git"
+    source: git
+    version: "0.4.0"
+sdks:
+  dart: ">=3.0.0 <4.0.0"
+"#;
+
+    #[test]
+    fn test_parse_pubspec_lock() {
+        let packages = parse_pubspec_lock(PUBSPEC_LOCK);
+        let names: Vec<&str> = packages.iter().map(|p| p.name.as_str()).collect();
+        assert_eq!(
+            names,
+            vec!["async", "charts", "design_system", "http", "lints"]
+        );
+
+        assert!(!packages[0].direct);
+        assert_eq!(
+            packages[3].source,
+            PubSource::Hosted {
+                url: PUB_DEV.to_string()
+            }
+        );
+        assert_eq!(packages[4].scope, DependencyScope::Dev);
+        assert_eq!(
+            packages[4].source,
+            PubSource::Hosted {
+                url: "https://dart.cloudsmith.io/acme/private".to_string()
+            }
+        );
+        assert_eq!(
+            packages[2].source,
+            PubSource::Path("../design_system".to_string())
+        );
+        assert_eq!(
+            packages[1].source,
+            PubSource::Git {
+                url: "https://github.com/acme/flutter-widgets.git".to_string(),
+                resolved_ref: "8d5a3c0e1f2b4a6c9e7d1b3a5c7e9f1d3b5a7c9e".to_string(),
+                path: "packages/charts".to_string(),
+            }
+        );
+
+        assert!(parse_pubspec_lock("not: [valid").is_empty());
+    }
+
+    #[test]
+    fn test_license_from_pub_tags() {
+        let tags = |tags: &[&str]| tags.iter().map(|t| t.to_string()).collect::<Vec<_>>();
+
+        assert_eq!(
+            license_from_pub_tags(&tags(&[
+                "sdk:flutter",
+                "license:bsd-3-clause",
+                "license:fsf-libre",
+                "license:osi-approved"
+            ])),
+            Some("BSD-3-Clause".to_string())
+        );
+        assert_eq!(
+            license_from_pub_tags(&tags(&["license:mit", "license:apache-2.0"])),
+            Some("MIT AND Apache-2.0".to_string())
+        );
+        assert_eq!(license_from_pub_tags(&tags(&["license:unknown"])), None);
+        assert_eq!(
+            license_from_pub_tags(&tags(&["license:eupl-1.2"])),
+            Some("eupl-1.2".to_string())
+        );
+    }
+
+    #[test]
+    fn test_pubspec_repository() {
+        let pubspec = serde_json::json!({
+            "homepage": "https://flutter.dev",
+            "repository": "https://github.com/flutter/packages/tree/main/packages/go_router"
+        });
+        assert_eq!(
+            pubspec_repository(&pubspec).as_deref(),
+            Some("https://github.com/flutter/packages")
+        );
+        assert_eq!(pubspec_repository(&serde_json::json!({})), None);
+    }
+
+    #[test]
+    fn test_path_and_cached_packages_use_local_license_files() {
+        let temp_dir = TempDir::new().unwrap();
+        let project_dir = temp_dir.path().join("app");
+        let shared = temp_dir.path().join("design_system");
+        fs::create_dir_all(&project_dir).unwrap();
+        fs::create_dir_all(&shared).unwrap();
+        fs::write(shared.join("LICENSE"), MIT_LICENSE).unwrap();
+
+        let cache = temp_dir.path().join("pub-cache");
+        let hosted = cache.join("hosted/pub.dev/http-0.13.6");
+        fs::create_dir_all(&hosted).unwrap();
+        fs::write(hosted.join("LICENSE"), MIT_LICENSE).unwrap();
+
+        let packages = parse_pubspec_lock(PUBSPEC_LOCK);
+        temp_env::with_var("PUB_CACHE", Some(&cache), || {
+            let (license, confidence) =
+                fetch_license_for_package(&packages[2], &project_dir, false);
+            assert_eq!(license, "MIT");
+            assert!(confidence.is_some());
+
+            let (license, _) = fetch_license_for_package(&packages[3], &project_dir, false);
+            assert_eq!(license, "MIT");
+        });
+    }
+}
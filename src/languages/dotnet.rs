@@ -1,16 +1,24 @@
+use rayon::prelude::*;
 use regex::Regex;
-use reqwest::blocking::Client;
 use serde::{Deserialize, Serialize};
 use std::collections::{HashMap, HashSet};
 use std::fs;
 use std::path::{Path, PathBuf};
 use std::process::Command;
 
+use crate::cache::{cache_license, get_cached_license};
 use crate::config::FeludaConfig;
-use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, DependencyGraph,
+};
+use crate::license_detector::classify_license_text;
 use crate::licenses::{
-    fetch_licenses_from_github, is_license_restrictive, LicenseCompatibility, LicenseInfo,
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
 };
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
 
 #[derive(Debug, Clone)]
 pub struct NuGetPackage {
@@ -54,57 +62,104 @@ pub fn analyze_dotnet_licenses(project_path: &str, config: &FeludaConfig) -> Vec
         }
     };
 
-    let direct_deps = match detect_and_parse_project(project_path) {
-        Ok(deps) => deps,
-        Err(err) => {
-            log_error("Failed to parse .NET project", &err);
-            return Vec::new();
-        }
-    };
-
-    log(
-        LogLevel::Info,
-        &format!("Found {} direct .NET dependencies", direct_deps.len()),
-    );
-    log_debug("Direct .NET dependencies", &direct_deps);
-
     let max_depth = config.dependencies.max_depth;
     log(
         LogLevel::Info,
         &format!("Using max dependency depth: {max_depth}"),
     );
 
-    let all_deps = resolve_dotnet_dependencies(project_path, &direct_deps, max_depth);
+    // Lockfiles already pin the full dependency graph
+    let mut graph = None;
+    let all_deps = if let Some(lock_path) = find_lockfile(project_path) {
+        let parsed = if lock_path.ends_with("paket.lock") {
+            parse_paket_lock(&lock_path)
+        } else {
+            graph = packages_lock_dependency_graph(&lock_path);
+            parse_packages_lock_json(&lock_path, max_depth <= 1)
+        };
+        match parsed {
+            Ok(deps) => deps.into_iter().map(|p| (p.name, p.version)).collect(),
+            Err(err) => {
+                log_error("Failed to parse .NET lockfile", &err);
+                return Vec::new();
+            }
+        }
+    } else {
+        let direct_deps = match detect_and_parse_project(project_path) {
+            Ok(deps) => deps,
+            Err(err) => {
+                log_error("Failed to parse .NET project", &err);
+                return Vec::new();
+            }
+        };
 
-    let mut licenses = Vec::new();
-    for (name, version) in all_deps {
         log(
             LogLevel::Info,
-            &format!("Processing dependency: {name} ({version})"),
+            &format!("Found {} direct .NET dependencies", direct_deps.len()),
         );
+        log_debug("Direct .NET dependencies", &direct_deps);
 
-        let license_result = fetch_license_for_nuget_package(&name, &version);
-        let license = Some(license_result);
-        let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
+        resolve_dotnet_dependencies(project_path, &direct_deps, max_depth)
+    };
 
-        if is_restrictive {
+    let mut licenses: Vec<LicenseInfo> = all_deps
+        .into_par_iter()
+        .map(|(name, version)| {
             log(
-                LogLevel::Warn,
-                &format!("Restrictive license found: {license:?} for {name}"),
+                LogLevel::Info,
+                &format!("Processing dependency: {name} ({version})"),
             );
-        }
 
-        licenses.push(LicenseInfo {
-            name,
-            version,
-            license: license.clone(),
-            is_restrictive,
-            compatibility: LicenseCompatibility::Unknown,
-            osi_status: match &license {
-                Some(l) => crate::licenses::get_osi_status(l),
-                None => crate::licenses::OsiStatus::Unknown,
-            },
-        });
+            let license_result = time_dependency("nuget", &name, &version, || {
+                fetch_license_for_nuget_package(&name, &version)
+            });
+            let license = Some(license_result);
+            let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
+
+            if is_restrictive {
+                log(
+                    LogLevel::Warn,
+                    &format!("Restrictive license found: {license:?} for {name}"),
+                );
+            }
+
+            LicenseInfo {
+                name,
+                version,
+                license: license.clone(),
+                is_restrictive,
+                compatibility: LicenseCompatibility::Unknown,
+                osi_status: match &license {
+                    Some(l) => crate::licenses::get_osi_status(l),
+                    None => crate::licenses::OsiStatus::Unknown,
+                },
+                license_confidence: None,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: DependencyScope::Runtime,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
+            }
+        })
+        .collect();
+
+    if let Some(graph) = graph {
+        attach_dependency_paths(&mut licenses, &graph.paths());
+        attach_dependency_requires(&mut licenses, &graph.requires());
     }
 
     log(
@@ -114,6 +169,30 @@ pub fn analyze_dotnet_licenses(project_path: &str, config: &FeludaConfig) -> Vec
     licenses
 }
 
+/// Lockfile to read instead of the project file, if there is one
+///
+/// `paket.lock` is passed in directly, while `packages.lock.json` sits next to
+/// the project file when `RestorePackagesWithLockFile` is enabled.
+fn find_lockfile(project_path: &str) -> Option<String> {
+    let path = Path::new(project_path);
+    if path.file_name().and_then(|s| s.to_str()) == Some("paket.lock") {
+        return Some(project_path.to_string());
+    }
+
+    let is_project = matches!(
+        path.extension().and_then(|s| s.to_str()),
+        Some("csproj" | "fsproj" | "vbproj")
+    );
+    let dir = if is_project {
+        path.parent()?
+    } else if path.is_dir() {
+        path
+    } else {
+        return None;
+    };
+    find_file_in_dir(dir, "packages.lock.json").ok()
+}
+
 fn detect_and_parse_project(project_path: &str) -> Result<Vec<NuGetPackage>, String> {
     let path = Path::new(project_path);
 
@@ -126,12 +205,7 @@ fn detect_and_parse_project(project_path: &str) -> Result<Vec<NuGetPackage>, Str
             Err(format!("Unsupported .NET file type: {ext}"))
         }
     } else {
-        let parent_dir = path.parent().unwrap_or(path);
-        if let Ok(lock_path) = find_file_in_dir(parent_dir, "packages.lock.json") {
-            parse_packages_lock_json(&lock_path)
-        } else {
-            parse_csproj_file(project_path)
-        }
+        parse_csproj_file(project_path)
     }
 }
 
@@ -195,21 +269,35 @@ fn parse_csproj_file(csproj_path: &str) -> Result<Vec<NuGetPackage>, String> {
     let content =
         fs::read_to_string(csproj_path).map_err(|e| format!("Failed to read .csproj file: {e}"))?;
 
-    let mut packages = Vec::new();
-
-    let pkg_re = Regex::new(r#"<PackageReference\s+Include="([^"]+)"\s+Version="([^"]+)"\s*/?>"#)
-        .map_err(|e| format!("Failed to compile regex: {e}"))?;
-
-    for cap in pkg_re.captures_iter(&content) {
-        let name = cap[1].to_string();
-        let version = cap[2].to_string();
-        packages.push(NuGetPackage { name, version });
-    }
-
     let csproj_dir = Path::new(csproj_path)
         .parent()
         .ok_or("Failed to get parent directory")?;
 
+    let references = parse_package_references(&content)?;
+    // Central Package Management keeps the versions in Directory.Packages.props
+    let central_versions = if references.iter().any(|(_, version)| version.is_none()) {
+        find_central_package_versions(csproj_dir)
+    } else {
+        HashMap::new()
+    };
+
+    let mut packages = Vec::new();
+    for (name, version) in references {
+        let version = version.or_else(|| {
+            central_versions
+                .iter()
+                .find(|(central, _)| central.eq_ignore_ascii_case(&name))
+                .map(|(_, version)| version.clone())
+        });
+        match version {
+            Some(version) => packages.push(NuGetPackage { name, version }),
+            None => log(
+                LogLevel::Warn,
+                &format!("No version found for package reference {name}"),
+            ),
+        }
+    }
+
     if let Ok(project_refs) = parse_project_references(&content, csproj_dir) {
         for ref_path in project_refs {
             match parse_csproj_file(&ref_path) {
@@ -229,6 +317,106 @@ fn parse_csproj_file(csproj_path: &str) -> Result<Vec<NuGetPackage>, String> {
     Ok(packages)
 }
 
+/// `PackageReference` items as (name, version) pairs
+///
+/// Attributes may come in any order, and the version may be a `VersionOverride`
+/// attribute or a nested `<Version>` element. It is `None` when the project
+/// relies on Central Package Management.
+fn parse_package_references(content: &str) -> Result<Vec<(String, Option<String>)>, String> {
+    let re = Regex::new(r"(?s)<PackageReference\b([^>]*?)(?:/>|>(.*?)</PackageReference>)")
+        .map_err(|e| format!("Failed to compile regex: {e}"))?;
+    let version_re = Regex::new(r"<Version>\s*([^<]+?)\s*</Version>")
+        .map_err(|e| format!("Failed to compile regex: {e}"))?;
+
+    let mut references = Vec::new();
+    for cap in re.captures_iter(content) {
+        let attributes = parse_xml_attributes(&cap[1]);
+        // `Update` items only change references declared elsewhere
+        let Some(name) = attributes.get("Include") else {
+            continue;
+        };
+        let version = attributes
+            .get("VersionOverride")
+            .or_else(|| attributes.get("Version"))
+            .cloned()
+            .or_else(|| {
+                cap.get(2)
+                    .and_then(|body| version_re.captures(body.as_str()))
+                    .map(|v| v[1].to_string())
+            });
+        references.push((name.clone(), version.map(|v| normalize_version_range(&v))));
+    }
+
+    Ok(references)
+}
+
+/// Package versions from the nearest `Directory.Packages.props`
+fn find_central_package_versions(project_dir: &Path) -> HashMap<String, String> {
+    let Some(props_path) = project_dir
+        .ancestors()
+        .map(|dir| dir.join("Directory.Packages.props"))
+        .find(|path| path.is_file())
+    else {
+        return HashMap::new();
+    };
+
+    log(
+        LogLevel::Info,
+        &format!("Reading central package versions: {}", props_path.display()),
+    );
+    match fs::read_to_string(&props_path) {
+        Ok(content) => parse_central_package_versions(&content),
+        Err(err) => {
+            log_error("Failed to read Directory.Packages.props", &err);
+            HashMap::new()
+        }
+    }
+}
+
+fn parse_central_package_versions(content: &str) -> HashMap<String, String> {
+    let Ok(re) = Regex::new(r"<PackageVersion\b([^>]*?)/?>") else {
+        return HashMap::new();
+    };
+
+    re.captures_iter(content)
+        .filter_map(|cap| {
+            let mut attributes = parse_xml_attributes(&cap[1]);
+            let name = attributes.remove("Include")?;
+            let version = attributes.remove("Version")?;
+            Some((name, normalize_version_range(&version)))
+        })
+        .collect()
+}
+
+fn parse_xml_attributes(tag: &str) -> HashMap<String, String> {
+    let Ok(re) = Regex::new(r#"([\w.:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')"#) else {
+        return HashMap::new();
+    };
+
+    re.captures_iter(tag)
+        .map(|cap| {
+            let value = cap.get(2).or_else(|| cap.get(3)).map_or("", |m| m.as_str());
+            (cap[1].to_string(), value.trim().to_string())
+        })
+        .collect()
+}
+
+/// The lowest version a NuGet version range allows, e.g. `[1.2.0, 2.0)` to `1.2.0`
+fn normalize_version_range(version: &str) -> String {
+    let version = version.trim();
+    if !version.starts_with(['[', '(']) {
+        return version.to_string();
+    }
+    version
+        .trim_matches(|c| matches!(c, '[' | ']' | '(' | ')'))
+        .split(',')
+        .next()
+        .map(str::trim)
+        .filter(|lower| !lower.is_empty())
+        .unwrap_or(version)
+        .to_string()
+}
+
 fn parse_project_references(content: &str, base_dir: &Path) -> Result<Vec<String>, String> {
     let re = Regex::new(r#"<ProjectReference\s+Include="([^"]+)"\s*/?>"#)
         .map_err(|e| format!("Failed to compile regex: {e}"))?;
@@ -246,7 +434,14 @@ fn parse_project_references(content: &str, base_dir: &Path) -> Result<Vec<String
     Ok(references)
 }
 
-fn parse_packages_lock_json(lock_path: &str) -> Result<Vec<NuGetPackage>, String> {
+/// Packages pinned in `packages.lock.json`
+///
+/// Project references carry no resolved version and are skipped. With
+/// `direct_only`, transitive packages are left out too.
+fn parse_packages_lock_json(
+    lock_path: &str,
+    direct_only: bool,
+) -> Result<Vec<NuGetPackage>, String> {
     log(
         LogLevel::Info,
         &format!("Parsing packages.lock.json: {lock_path}"),
@@ -259,14 +454,27 @@ fn parse_packages_lock_json(lock_path: &str) -> Result<Vec<NuGetPackage>, String
         .map_err(|e| format!("Failed to parse packages.lock.json: {e}"))?;
 
     let mut packages = Vec::new();
+    let mut seen = HashSet::new();
 
-    if let Some(dependencies) = lock_data.dependencies {
-        for (_framework, packages_map) in dependencies {
-            for (name, info) in packages_map {
-                if let Some(resolved) = &info.resolved {
+    // Each target framework lists its own copy of the graph
+    let mut frameworks: Vec<_> = lock_data
+        .dependencies
+        .unwrap_or_default()
+        .into_iter()
+        .collect();
+    frameworks.sort_by(|a, b| a.0.cmp(&b.0));
+    for (_framework, packages_map) in frameworks {
+        let mut entries: Vec<_> = packages_map.into_iter().collect();
+        entries.sort_by(|a, b| a.0.cmp(&b.0));
+        for (name, info) in entries {
+            if direct_only && info.package_type.as_deref() != Some("Direct") {
+                continue;
+            }
+            if let Some(resolved) = info.resolved {
+                if seen.insert(format!("{}@{resolved}", name.to_lowercase())) {
                     packages.push(NuGetPackage {
-                        name: name.clone(),
-                        version: resolved.clone(),
+                        name,
+                        version: resolved,
                     });
                 }
             }
@@ -280,6 +488,89 @@ fn parse_packages_lock_json(lock_path: &str) -> Result<Vec<NuGetPackage>, String
     Ok(packages)
 }
 
+/// Graph of `packages.lock.json`, entered from the `Direct` packages
+///
+/// Each target framework can resolve other versions, so packages are identified
+/// by framework and name; NuGet names are case-insensitive.
+fn packages_lock_dependency_graph(lock_path: &str) -> Option<DependencyGraph> {
+    let content = fs::read_to_string(lock_path).ok()?;
+    let lock_data: PackagesLockJson = serde_json::from_str(&content).ok()?;
+    let id = |framework: &str, name: &str| format!("{framework}/{}", name.to_lowercase());
+
+    // Sorted so that ties between equally short paths are broken the same way every run
+    let mut entries: Vec<(&String, &String, &PackageLockInfo)> = lock_data
+        .dependencies
+        .iter()
+        .flatten()
+        .flat_map(|(framework, packages)| {
+            packages
+                .iter()
+                .map(move |(name, info)| (framework, name, info))
+        })
+        .collect();
+    entries.sort_by(|a, b| (a.0, a.1).cmp(&(b.0, b.1)));
+
+    let mut graph = DependencyGraph::new();
+    for (framework, name, info) in &entries {
+        if let Some(resolved) = &info.resolved {
+            graph.add_package(&id(framework, name), name, resolved);
+        }
+    }
+    for (framework, name, info) in &entries {
+        let mut required: Vec<_> = info.dependencies.iter().flatten().map(|(n, _)| n).collect();
+        required.sort();
+        for required in required {
+            graph.add_dependency(&id(framework, name), &id(framework, required));
+        }
+        if info.package_type.as_deref() == Some("Direct") {
+            graph.add_direct(&id(framework, name));
+        }
+    }
+    Some(graph)
+}
+
+/// Packages pinned in a Paket `paket.lock`
+///
+/// Only `NUGET` sections are read; `GITHUB`, `HTTP` and `GIT` sources are not
+/// NuGet packages. Resolved packages are indented by four spaces, their own
+/// dependency constraints by six.
+fn parse_paket_lock(lock_path: &str) -> Result<Vec<NuGetPackage>, String> {
+    log(LogLevel::Info, &format!("Parsing paket.lock: {lock_path}"));
+
+    let content =
+        fs::read_to_string(lock_path).map_err(|e| format!("Failed to read paket.lock: {e}"))?;
+
+    let package_re = Regex::new(r"^    ([^\s(]+) \(([^)]+)\)")
+        .map_err(|e| format!("Failed to compile regex: {e}"))?;
+
+    let mut packages = Vec::new();
+    let mut seen = HashSet::new();
+    let mut in_nuget = false;
+
+    for line in content.lines() {
+        if !line.starts_with(' ') {
+            // Section headers (NUGET, GITHUB, GROUP <name>, ...) and group options
+            in_nuget = line.trim_end() == "NUGET";
+            continue;
+        }
+        if !in_nuget {
+            continue;
+        }
+        if let Some(cap) = package_re.captures(line) {
+            let (name, version) = (cap[1].to_string(), cap[2].to_string());
+            if seen.insert(format!("{}@{version}", name.to_lowercase())) {
+                packages.push(NuGetPackage { name, version });
+            }
+        }
+    }
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} packages in paket.lock", packages.len()),
+    );
+    Ok(packages)
+}
+
 fn resolve_dotnet_dependencies(
     project_path: &str,
     direct_deps: &[NuGetPackage],
@@ -355,12 +646,22 @@ fn parse_dotnet_list_output(output: &str) -> Result<Vec<(String, String)>, Strin
     Ok(packages)
 }
 
-fn fetch_license_for_nuget_package(name: &str, version: &str) -> String {
+pub fn fetch_license_for_nuget_package(name: &str, version: &str) -> String {
+    let version = normalize_nuget_version(version);
+    let version = version.as_str();
+
     if let Ok(license) = fetch_from_local_nuget_cache(name, version) {
         return license;
     }
 
+    // NuGet package IDs are case-insensitive
+    let cache_name = name.to_lowercase();
+    if let Some(license) = get_cached_license("nuget", &cache_name, version) {
+        return license;
+    }
+
     if let Ok(license) = fetch_from_nuget_api(name, version) {
+        cache_license("nuget", &cache_name, version, &license);
         return license;
     }
 
@@ -371,35 +672,65 @@ fn fetch_license_for_nuget_package(name: &str, version: &str) -> String {
     "Unknown".to_string()
 }
 
+/// Normalize a version the way NuGet does for package paths
+///
+/// Build metadata is dropped, `1.0` becomes `1.0.0`, and a zero fourth part
+/// is removed, so `1.0.0.0` becomes `1.0.0`.
+fn normalize_nuget_version(version: &str) -> String {
+    let version = version.trim().split('+').next().unwrap_or_default();
+    let (release, prerelease) = match version.split_once('-') {
+        Some((release, prerelease)) => (release, Some(prerelease)),
+        None => (version, None),
+    };
+
+    let mut parts: Vec<String> = Vec::new();
+    for part in release.split('.') {
+        match part.parse::<u64>() {
+            Ok(number) => parts.push(number.to_string()),
+            // Not a plain version, leave it alone
+            Err(_) => return version.to_lowercase(),
+        }
+    }
+    while parts.len() < 3 {
+        parts.push("0".to_string());
+    }
+    if parts.len() == 4 && parts[3] == "0" {
+        parts.pop();
+    }
+
+    let mut normalized = parts.join(".");
+    if let Some(prerelease) = prerelease {
+        normalized.push('-');
+        normalized.push_str(prerelease);
+    }
+    normalized.to_lowercase()
+}
+
 fn fetch_from_local_nuget_cache(name: &str, version: &str) -> Result<String, String> {
     let home = std::env::var("HOME")
         .or_else(|_| std::env::var("USERPROFILE"))
         .map_err(|_| "Cannot determine home directory")?;
 
-    let nuget_cache = PathBuf::from(home)
+    let package_dir = PathBuf::from(home)
         .join(".nuget")
         .join("packages")
         .join(name.to_lowercase())
-        .join(version)
-        .join(format!("{}.nuspec", name.to_lowercase()));
+        .join(version);
+    let nuspec_path = package_dir.join(format!("{}.nuspec", name.to_lowercase()));
 
-    if nuget_cache.exists() {
+    if nuspec_path.exists() {
         let content =
-            fs::read_to_string(&nuget_cache).map_err(|e| format!("Failed to read nuspec: {e}"))?;
-        return parse_license_from_nuspec(&content);
+            fs::read_to_string(&nuspec_path).map_err(|e| format!("Failed to read nuspec: {e}"))?;
+        return resolve_nuspec_license(&parse_license_from_nuspec(&content), Some(&package_dir));
     }
 
     Err("Not found in local cache".to_string())
 }
 
 fn fetch_from_nuget_api(name: &str, version: &str) -> Result<String, String> {
-    let client = Client::builder()
-        .timeout(std::time::Duration::from_secs(10))
-        .build()
-        .map_err(|e| format!("Failed to create HTTP client: {e}"))?;
-
     let nuspec_url = format!(
-        "https://api.nuget.org/v3-flatcontainer/{}/{}/{}.nuspec",
+        "{}/{}/{}/{}.nuspec",
+        registry::nuget_flat_container(),
         name.to_lowercase(),
         version.to_lowercase(),
         name.to_lowercase()
@@ -410,9 +741,7 @@ fn fetch_from_nuget_api(name: &str, version: &str) -> Result<String, String> {
         &format!("Fetching from NuGet: {nuspec_url}"),
     );
 
-    let response = client
-        .get(&nuspec_url)
-        .send()
+    let response = registry::get(Registry::NuGet, &nuspec_url)
         .map_err(|e| format!("Failed to fetch nuspec: {e}"))?;
 
     if !response.status().is_success() {
@@ -423,35 +752,174 @@ fn fetch_from_nuget_api(name: &str, version: &str) -> Result<String, String> {
         .text()
         .map_err(|e| format!("Failed to read response: {e}"))?;
 
-    parse_license_from_nuspec(&content)
+    resolve_nuspec_license(&parse_license_from_nuspec(&content), None)
+}
+
+/// License metadata declared in a `.nuspec`
+#[derive(Debug, Default, PartialEq)]
+struct NuspecLicense {
+    /// SPDX expression from `<license type="expression">`
+    expression: Option<String>,
+    /// Path inside the package from `<license type="file">`
+    file: Option<String>,
+    /// The deprecated `<licenseUrl>`
+    url: Option<String>,
 }
 
-fn parse_license_from_nuspec(content: &str) -> Result<String, String> {
-    if let Ok(re) = Regex::new(r"<license[^>]*>([^<]+)</license>") {
+fn parse_license_from_nuspec(content: &str) -> NuspecLicense {
+    let mut license = NuspecLicense::default();
+
+    if let Ok(re) = Regex::new(r"<license\b([^>]*)>([^<]+)</license>") {
         if let Some(cap) = re.captures(content) {
-            return Ok(cap[1].trim().to_string());
+            let value = cap[2].trim().to_string();
+            match parse_xml_attributes(&cap[1])
+                .get("type")
+                .map(String::as_str)
+            {
+                Some("file") => license.file = Some(value),
+                _ => license.expression = Some(value),
+            }
         }
     }
 
-    if let Ok(re) = Regex::new(r#"<licenseUrl>([^<]+)</licenseUrl>"#) {
+    if let Ok(re) = Regex::new(r"<licenseUrl>([^<]+)</licenseUrl>") {
         if let Some(cap) = re.captures(content) {
-            let url = cap[1].trim();
-            if url.contains("MIT") {
-                return Ok("MIT".to_string());
-            } else if url.contains("Apache") {
-                return Ok("Apache-2.0".to_string());
-            } else if url.contains("BSD") {
-                return Ok("BSD".to_string());
-            } else if url.contains("GPL") {
-                return Ok("GPL".to_string());
+            license.url = Some(cap[1].trim().to_string());
+        }
+    }
+
+    license
+}
+
+/// Turn nuspec license metadata into a license identifier
+///
+/// A license file can only be classified when the package is in the local
+/// cache, otherwise the `licenseUrl` is used. URLs that do not point at a
+/// known license are returned as they are.
+fn resolve_nuspec_license(
+    license: &NuspecLicense,
+    package_dir: Option<&Path>,
+) -> Result<String, String> {
+    if let Some(expression) = &license.expression {
+        return Ok(expression.clone());
+    }
+
+    if let (Some(file), Some(dir)) = (&license.file, package_dir) {
+        let path = dir.join(file.replace('\\', "/"));
+        match fs::read_to_string(&path) {
+            Ok(text) => {
+                if let Some(detected) = classify_license_text(&text) {
+                    log(
+                        LogLevel::Info,
+                        &format!(
+                            "Classified {} as {} with confidence {:.2}",
+                            path.display(),
+                            detected.license,
+                            detected.confidence
+                        ),
+                    );
+                    return Ok(detected.license);
+                }
             }
-            return Ok(url.to_string());
+            Err(err) => log_error(
+                &format!("Failed to read license file {}", path.display()),
+                &err,
+            ),
+        }
+    }
+
+    if let Some(url) = &license.url {
+        if let Some(id) = license_from_url(url) {
+            return Ok(id);
+        }
+        // Packages with a license file point licenseUrl at a placeholder
+        if !url.contains("aka.ms/deprecateLicenseUrl") {
+            return Ok(url.clone());
         }
     }
 
     Err("No license found in nuspec".to_string())
 }
 
+/// SPDX identifier for well-known license URLs
+fn license_from_url(url: &str) -> Option<String> {
+    let url = url.trim().trim_end_matches('/');
+    let lower = url.to_lowercase();
+    let path = lower
+        .trim_start_matches("https://")
+        .trim_start_matches("http://")
+        .trim_start_matches("www.");
+
+    if path.starts_with("licenses.nuget.org/") {
+        // The expression itself keeps its case
+        let start = lower.find("licenses.nuget.org/")? + "licenses.nuget.org/".len();
+        let expression = percent_decode(&url[start..]);
+        let expression = expression.trim();
+        let expression = expression
+            .strip_prefix('(')
+            .and_then(|e| e.strip_suffix(')'))
+            .unwrap_or(expression);
+        return (!expression.is_empty()).then(|| expression.to_string());
+    }
+
+    if path.starts_with("apache.org/licenses/license-2.0") {
+        return Some("Apache-2.0".to_string());
+    }
+
+    let name = path
+        .strip_prefix("opensource.org/licenses/")
+        .or_else(|| path.strip_prefix("gnu.org/licenses/"))?;
+    let name = name
+        .trim_end_matches(".php")
+        .trim_end_matches(".html")
+        .trim_end_matches(".txt");
+    let id = match name {
+        "mit" | "mit-license" => "MIT",
+        "apache-2.0" | "apache2.0" => "Apache-2.0",
+        "bsd-2-clause" | "bsd-license" => "BSD-2-Clause",
+        "bsd-3-clause" => "BSD-3-Clause",
+        "isc" | "isc-license" => "ISC",
+        "ms-pl" => "MS-PL",
+        "ms-rl" => "MS-RL",
+        "mpl-2.0" => "MPL-2.0",
+        "zlib" | "zlib-license" => "Zlib",
+        "gpl-2.0" | "old-licenses/gpl-2.0" => "GPL-2.0",
+        "gpl-3.0" | "gpl" => "GPL-3.0",
+        "lgpl-2.1" | "old-licenses/lgpl-2.1" => "LGPL-2.1",
+        "lgpl-3.0" | "lgpl" => "LGPL-3.0",
+        "agpl-3.0" | "agpl" => "AGPL-3.0",
+        _ => return None,
+    };
+    Some(id.to_string())
+}
+
+fn percent_decode(text: &str) -> String {
+    let bytes = text.as_bytes();
+    let mut decoded = Vec::with_capacity(bytes.len());
+    let mut i = 0;
+    while i < bytes.len() {
+        match bytes[i] {
+            b'%' if i + 2 < bytes.len() => {
+                match std::str::from_utf8(&bytes[i + 1..i + 3])
+                    .ok()
+                    .and_then(|hex| u8::from_str_radix(hex, 16).ok())
+                {
+                    Some(byte) => {
+                        decoded.push(byte);
+                        i += 3;
+                        continue;
+                    }
+                    None => decoded.push(b'%'),
+                }
+            }
+            b'+' => decoded.push(b' '),
+            byte => decoded.push(byte),
+        }
+        i += 1;
+    }
+    String::from_utf8_lossy(&decoded).into_owned()
+}
+
 fn find_file_in_dir(dir: &Path, filename: &str) -> Result<String, String> {
     let file_path = dir.join(filename);
     if file_path.exists() {
@@ -463,3 +931,207 @@ fn find_file_in_dir(dir: &Path, filename: &str) -> Result<String, String> {
         Err(format!("{filename} not found in directory"))
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_parse_csproj_package_references() {
+        let temp_dir = TempDir::new().unwrap();
+        fs::write(
+            temp_dir.path().join("Directory.Packages.props"),
+            r#"<Project>
+  <ItemGroup>
+    <PackageVersion Include="Serilog" Version="3.1.1" />
+  </ItemGroup>
+</Project>"#,
+        )
+        .unwrap();
+        let project_dir = temp_dir.path().join("src").join("App");
+        fs::create_dir_all(&project_dir).unwrap();
+        let csproj = project_dir.join("App.csproj");
+        fs::write(
+            &csproj,
+            r#"<Project Sdk="Microsoft.NET.Sdk">
+  <ItemGroup>
+    <PackageReference Include="Newtonsoft.Json" Version="13.0.3" />
+    <PackageReference Version="7.0.0" Include="Dapper" />
+    <PackageReference Include="Polly">
+      <Version>8.2.0</Version>
+    </PackageReference>
+    <PackageReference Include="xunit" Version="[2.6.1, 3.0)" PrivateAssets="all" />
+    <PackageReference Include="serilog" />
+    <PackageReference Update="Dapper" Version="9.9.9" />
+  </ItemGroup>
+</Project>"#,
+        )
+        .unwrap();
+
+        let packages = parse_csproj_file(csproj.to_str().unwrap()).unwrap();
+        let found: Vec<_> = packages
+            .iter()
+            .map(|p| (p.name.as_str(), p.version.as_str()))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("Newtonsoft.Json", "13.0.3"),
+                ("Dapper", "7.0.0"),
+                ("Polly", "8.2.0"),
+                ("xunit", "2.6.1"),
+                ("serilog", "3.1.1"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_lockfiles() {
+        let temp_dir = TempDir::new().unwrap();
+        let lock = temp_dir.path().join("packages.lock.json");
+        fs::write(
+            &lock,
+            r#"{
+  "version": 1,
+  "dependencies": {
+    "net6.0": {
+      "Newtonsoft.Json": {"type": "Direct", "requested": "[13.0.3, )", "resolved": "13.0.3"},
+      "System.Memory": {"type": "Transitive", "resolved": "4.5.5"},
+      "Lib": {"type": "Project"}
+    },
+    "net8.0": {
+      "Newtonsoft.Json": {"type": "Direct", "requested": "[13.0.3, )", "resolved": "13.0.3"}
+    }
+  }
+}"#,
+        )
+        .unwrap();
+        let lock = lock.to_str().unwrap();
+        assert_eq!(parse_packages_lock_json(lock, false).unwrap().len(), 2);
+        let direct = parse_packages_lock_json(lock, true).unwrap();
+        assert_eq!(direct.len(), 1);
+        assert_eq!(direct[0].name, "Newtonsoft.Json");
+
+        let paket = temp_dir.path().join("paket.lock");
+        fs::write(
+            &paket,
+            "STORAGE: NONE
+NUGET
+  remote: https://api.nuget.org/v3/index.json
+    FSharp.Core (8.0.100)
+    Newtonsoft.Json (13.0.3) - restriction: >= netstandard2.0
+      Microsoft.CSharp (>= 4.3)
+GITHUB
+  remote: fsprojects/FAKE
+    src/app/FakeLib/Globbing/Globbing.fs (0341a2e614eb2a7f34607cec914eb0ed83ce9add)
+
+GROUP Test
+NUGET
+  remote: https://api.nuget.org/v3/index.json
+    FSharp.Core (8.0.100)
+    xunit (2.6.1)
+",
+        )
+        .unwrap();
+        let packages = parse_paket_lock(paket.to_str().unwrap()).unwrap();
+        let names: Vec<_> = packages.iter().map(|p| p.name.as_str()).collect();
+        assert_eq!(names, vec!["FSharp.Core", "Newtonsoft.Json", "xunit"]);
+        assert_eq!(packages[1].version, "13.0.3");
+    }
+
+    #[test]
+    fn test_packages_lock_dependency_graph() {
+        let temp_dir = TempDir::new().unwrap();
+        let lock = temp_dir.path().join("packages.lock.json");
+        fs::write(
+            &lock,
+            r#"{
+  "version": 1,
+  "dependencies": {
+    "net8.0": {
+      "Serilog.Sinks.File": {"type": "Direct", "resolved": "5.0.0",
+        "dependencies": {"serilog": "2.10.0"}},
+      "Serilog": {"type": "Transitive", "resolved": "2.10.0"}
+    }
+  }
+}"#,
+        )
+        .unwrap();
+
+        let graph = packages_lock_dependency_graph(lock.to_str().unwrap()).unwrap();
+        assert_eq!(
+            graph.paths()["Serilog@2.10.0"],
+            vec!["Serilog.Sinks.File@5.0.0", "Serilog@2.10.0"]
+        );
+        assert_eq!(
+            graph.requires()["Serilog.Sinks.File@5.0.0"],
+            vec!["Serilog@2.10.0"]
+        );
+    }
+
+    #[test]
+    fn test_nuspec_license() {
+        let expression = parse_license_from_nuspec(
+            r#"<metadata><license type="expression">MIT OR Apache-2.0</license>
+<licenseUrl>https://licenses.nuget.org/MIT%20OR%20Apache-2.0</licenseUrl></metadata>"#,
+        );
+        assert_eq!(
+            resolve_nuspec_license(&expression, None).unwrap(),
+            "MIT OR Apache-2.0"
+        );
+
+        let temp_dir = TempDir::new().unwrap();
+        fs::write(
+            temp_dir.path().join("LICENSE.txt"),
+            "MIT License\n\nPermission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the \"Software\"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:\n\nThe above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.\n\nTHE SOFTWARE IS PROVIDED \"AS IS\", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.",
+        )
+        .unwrap();
+        let file = parse_license_from_nuspec(
+            r#"<license type="file">LICENSE.txt</license>
+<licenseUrl>https://aka.ms/deprecateLicenseUrl</licenseUrl>"#,
+        );
+        assert_eq!(file.file.as_deref(), Some("LICENSE.txt"));
+        assert_eq!(
+            resolve_nuspec_license(&file, Some(temp_dir.path())).unwrap(),
+            "MIT"
+        );
+        assert!(resolve_nuspec_license(&file, None).is_err());
+    }
+
+    #[test]
+    fn test_license_from_url() {
+        assert_eq!(
+            license_from_url("https://licenses.nuget.org/(MIT%20OR%20Apache-2.0)").as_deref(),
+            Some("MIT OR Apache-2.0")
+        );
+        assert_eq!(
+            license_from_url("http://www.apache.org/licenses/LICENSE-2.0.txt").as_deref(),
+            Some("Apache-2.0")
+        );
+        assert_eq!(
+            license_from_url("https://opensource.org/licenses/MIT").as_deref(),
+            Some("MIT")
+        );
+        assert_eq!(
+            license_from_url("https://www.gnu.org/licenses/lgpl-3.0.html").as_deref(),
+            Some("LGPL-3.0")
+        );
+        assert_eq!(
+            license_from_url("https://github.com/JamesNK/Newtonsoft.Json/blob/master/LICENSE.md"),
+            None
+        );
+    }
+
+    #[test]
+    fn test_normalize_nuget_version() {
+        assert_eq!(normalize_nuget_version("1.0"), "1.0.0");
+        assert_eq!(normalize_nuget_version("1.0.0.0"), "1.0.0");
+        assert_eq!(normalize_nuget_version("4.5.0.1"), "4.5.0.1");
+        assert_eq!(
+            normalize_nuget_version("01.2.3-Beta.1+sha.5"),
+            "1.2.3-beta.1"
+        );
+        assert_eq!(normalize_nuget_version("$(Version)"), "$(version)");
+    }
+}
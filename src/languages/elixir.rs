@@ -0,0 +1,854 @@
+use rayon::prelude::*;
+use regex::Regex;
+use serde_json::Value;
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, attach_dependency_scopes, DependencyGraph,
+};
+use crate::languages::ruby::license_from_gem_licenses;
+use crate::license_detector::detect_license_in_dir;
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, License,
+    LicenseCompatibility, LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
+use crate::repository_license::fetch_repository_license;
+
+/// Where Mix gets a dependency from
+#[derive(Debug, Clone, PartialEq)]
+pub enum MixSource {
+    Hex {
+        /// Package name on Hex, which may differ from the dependency's name
+        package: String,
+        /// `hexpm`, or `hexpm:<organization>` for private packages
+        repo: String,
+    },
+    Git {
+        url: String,
+        revision: String,
+    },
+}
+
+/// A dependency pinned in `mix.lock`
+#[derive(Debug, Clone, PartialEq)]
+pub struct MixPackage {
+    pub name: String,
+    pub version: String,
+    pub source: MixSource,
+    /// Dependencies of the package, by name
+    pub requires: Vec<String>,
+}
+
+/// A dependency declared in the `deps` of a `mix.exs`
+#[derive(Debug, Clone, PartialEq)]
+struct MixDependency {
+    name: String,
+    scope: DependencyScope,
+}
+
+/// An Elixir term as written in `mix.lock`
+#[derive(Debug, Clone, PartialEq)]
+enum Term {
+    Atom(String),
+    String(String),
+    List(Vec<Term>),
+    Tuple(Vec<Term>),
+    Map(Vec<(Term, Term)>),
+}
+
+impl Term {
+    fn text(&self) -> Option<&str> {
+        match self {
+            Term::Atom(text) | Term::String(text) => Some(text),
+            _ => None,
+        }
+    }
+}
+
+/// Reader for the subset of Elixir literals Mix writes to `mix.lock`
+///
+/// Commas are treated as whitespace, which is enough for the lockfile's
+/// maps, tuples, lists, keyword lists, strings and atoms.
+struct TermParser<'a> {
+    input: &'a str,
+    pos: usize,
+}
+
+impl<'a> TermParser<'a> {
+    fn new(input: &'a str) -> Self {
+        Self { input, pos: 0 }
+    }
+
+    fn peek(&self) -> Option<char> {
+        self.input[self.pos..].chars().next()
+    }
+
+    fn bump(&mut self) -> Option<char> {
+        let c = self.peek()?;
+        self.pos += c.len_utf8();
+        Some(c)
+    }
+
+    fn skip_whitespace(&mut self) {
+        while let Some(c) = self.peek() {
+            if c == '#' {
+                while self.peek().is_some_and(|c| c != '\n') {
+                    self.bump();
+                }
+            } else if c.is_whitespace() || c == ',' {
+                self.bump();
+            } else {
+                break;
+            }
+        }
+    }
+
+    fn expect(&mut self, expected: char) -> Option<()> {
+        self.skip_whitespace();
+        (self.bump()? == expected).then_some(())
+    }
+
+    /// The key of a `key: value` or `"key": value` entry, if one comes next
+    fn keyword_key(&mut self) -> Option<String> {
+        self.skip_whitespace();
+        let start = self.pos;
+        let key = match self.peek()? {
+            '"' => {
+                self.bump();
+                self.string()
+            }
+            c if c.is_alphabetic() || c == '_' => Some(self.word()),
+            _ => None,
+        };
+        let rest = &self.input[self.pos..];
+        if key.is_some() && rest.starts_with(':') && rest[1..].starts_with(char::is_whitespace) {
+            self.bump();
+            return key;
+        }
+        self.pos = start;
+        None
+    }
+
+    fn word(&mut self) -> String {
+        let start = self.pos;
+        while self
+            .peek()
+            .is_some_and(|c| c.is_alphanumeric() || "_.?!@".contains(c))
+        {
+            self.bump();
+        }
+        self.input[start..self.pos].to_string()
+    }
+
+    fn string(&mut self) -> Option<String> {
+        let mut text = String::new();
+        loop {
+            match self.bump()? {
+                '"' => return Some(text),
+                '\\' => text.push(self.bump()?),
+                c => text.push(c),
+            }
+        }
+    }
+
+    /// A term, or a `key: value` keyword entry as a two-element tuple
+    fn element(&mut self) -> Option<Term> {
+        match self.keyword_key() {
+            Some(key) => Some(Term::Tuple(vec![Term::Atom(key), self.term()?])),
+            None => self.term(),
+        }
+    }
+
+    fn sequence(&mut self, close: char) -> Option<Vec<Term>> {
+        let mut items = Vec::new();
+        loop {
+            self.skip_whitespace();
+            if self.peek()? == close {
+                self.bump();
+                return Some(items);
+            }
+            items.push(self.element()?);
+        }
+    }
+
+    fn term(&mut self) -> Option<Term> {
+        self.skip_whitespace();
+        match self.bump()? {
+            '"' => self.string().map(Term::String),
+            ':' => {
+                if self.peek()? == '"' {
+                    self.bump();
+                    self.string().map(Term::Atom)
+                } else {
+                    Some(Term::Atom(self.word()))
+                }
+            }
+            '[' => self.sequence(']').map(Term::List),
+            '{' => self.sequence('}').map(Term::Tuple),
+            '%' => {
+                self.expect('{')?;
+                let mut entries = Vec::new();
+                loop {
+                    self.skip_whitespace();
+                    if self.peek()? == '}' {
+                        self.bump();
+                        return Some(Term::Map(entries));
+                    }
+                    let key = match self.keyword_key() {
+                        Some(key) => Term::Atom(key),
+                        // "name" => value
+                        None => {
+                            let key = self.term()?;
+                            self.expect('=')?;
+                            self.expect('>')?;
+                            key
+                        }
+                    };
+                    entries.push((key, self.term()?));
+                }
+            }
+            c if c.is_alphanumeric() || c == '_' => {
+                self.pos -= c.len_utf8();
+                Some(Term::Atom(self.word()))
+            }
+            _ => None,
+        }
+    }
+}
+
+pub fn analyze_elixir_licenses(
+    lock_file_path: &str,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing Elixir dependencies from: {lock_file_path}"),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let project_dir = Path::new(lock_file_path)
+        .parent()
+        .unwrap_or_else(|| Path::new("."));
+    let apps = umbrella_apps(project_dir);
+    if !apps.is_empty() {
+        log(
+            LogLevel::Info,
+            &format!("Found umbrella project with {} apps", apps.len()),
+        );
+    }
+
+    // Umbrella apps normally share the umbrella's lockfile, but may keep their own
+    let mut packages: BTreeMap<String, MixPackage> = BTreeMap::new();
+    let lockfiles = std::iter::once(PathBuf::from(lock_file_path))
+        .chain(apps.iter().map(|app| app.join("mix.lock")))
+        .filter(|path| path.is_file());
+    for lockfile in lockfiles {
+        let content = match fs::read_to_string(&lockfile) {
+            Ok(content) => content,
+            Err(err) => {
+                log_error(&format!("Failed to read {}", lockfile.display()), &err);
+                continue;
+            }
+        };
+        for package in parse_mix_lock(&content) {
+            packages.entry(package.name.clone()).or_insert(package);
+        }
+    }
+    log(
+        LogLevel::Info,
+        &format!("Found {} packages in mix.lock", packages.len()),
+    );
+    log_debug("Mix packages", &packages);
+
+    let umbrella_names: HashSet<String> = apps
+        .iter()
+        .filter_map(|app| app.file_name())
+        .map(|name| name.to_string_lossy().to_string())
+        .collect();
+    let direct: Vec<MixDependency> = std::iter::once(project_dir.to_path_buf())
+        .chain(apps)
+        .filter_map(|dir| fs::read_to_string(dir.join("mix.exs")).ok())
+        .flat_map(|mix_exs| parse_mix_exs_deps(&mix_exs))
+        .filter(|dep| !umbrella_names.contains(&dep.name))
+        .collect();
+
+    let graph = mix_dependency_graph(&packages, &direct);
+    let direct_names: HashSet<&str> = direct.iter().map(|dep| dep.name.as_str()).collect();
+    let packages: Vec<MixPackage> = if config.dependencies.max_depth <= 1 {
+        packages
+            .into_values()
+            .filter(|package| direct_names.contains(package.name.as_str()))
+            .collect()
+    } else {
+        packages.into_values().collect()
+    };
+
+    let mut licenses: Vec<LicenseInfo> = packages
+        .into_par_iter()
+        .map(|package| analyze_package(package, project_dir, &known_licenses, config, no_local))
+        .collect();
+
+    attach_dependency_paths(&mut licenses, &graph.paths());
+    attach_dependency_requires(&mut licenses, &graph.requires());
+    attach_dependency_scopes(&mut licenses, &graph.scopes());
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} Elixir dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+/// Read the hex and git dependencies of a `mix.lock`
+///
+/// Hex entries are `{:hex, package, version, hash, build_tools, deps, repo,
+/// outer_hash}`; older lockfiles leave out the trailing fields. Git entries
+/// are `{:git, url, revision, options}` and carry no version, so the
+/// revision stands in for one.
+fn parse_mix_lock(content: &str) -> Vec<MixPackage> {
+    let Some(Term::Map(entries)) = TermParser::new(content).term() else {
+        log(LogLevel::Error, "Failed to parse mix.lock");
+        return Vec::new();
+    };
+
+    entries
+        .into_iter()
+        .filter_map(|(name, entry)| {
+            let name = name.text()?.to_string();
+            let Term::Tuple(fields) = entry else {
+                return None;
+            };
+            let text = |index: usize| fields.get(index).and_then(Term::text).map(str::to_string);
+
+            match fields.first().and_then(Term::text)? {
+                "hex" => {
+                    let requires = match fields.get(5) {
+                        Some(Term::List(deps)) => deps
+                            .iter()
+                            .filter_map(|dep| match dep {
+                                Term::Tuple(dep) => dep.first()?.text().map(str::to_string),
+                                _ => None,
+                            })
+                            .collect(),
+                        _ => Vec::new(),
+                    };
+                    Some(MixPackage {
+                        name,
+                        version: text(2)?,
+                        source: MixSource::Hex {
+                            package: text(1)?,
+                            repo: text(6).unwrap_or_else(|| "hexpm".to_string()),
+                        },
+                        requires,
+                    })
+                }
+                "git" => Some(MixPackage {
+                    name,
+                    version: text(2)?,
+                    source: MixSource::Git {
+                        url: text(1)?,
+                        revision: text(2)?,
+                    },
+                    requires: Vec::new(),
+                }),
+                source => {
+                    log(LogLevel::Info, &format!("Skipping {source} package {name}"));
+                    None
+                }
+            }
+        })
+        .collect()
+}
+
+/// Dependencies declared in the `deps` function of a `mix.exs`
+///
+/// Sibling apps of an umbrella (`in_umbrella: true`) are not dependencies.
+/// Dependencies restricted with `only:` to environments other than `:prod`
+/// are dev or test dependencies, and `runtime: false` ones are build tools.
+fn parse_mix_exs_deps(mix_exs: &str) -> Vec<MixDependency> {
+    let Some(start) = mix_exs
+        .find("defp deps")
+        .or_else(|| mix_exs.find("def deps"))
+    else {
+        return Vec::new();
+    };
+    let body = &mix_exs[start..];
+    let body = body[1..]
+        .find("\n  def")
+        .map_or(body, |end| &body[..end + 1]);
+
+    let (Ok(dep_regex), Ok(only_regex)) = (
+        Regex::new(r"\{\s*:([a-z_][A-Za-z0-9_]*)\s*(,[^{}]*)?\}"),
+        Regex::new(r"only:\s*(\[[^\]]*\]|:\w+)"),
+    ) else {
+        return Vec::new();
+    };
+
+    dep_regex
+        .captures_iter(body)
+        .filter_map(|captures| {
+            let options = captures.get(2).map_or("", |m| m.as_str());
+            if options.contains("in_umbrella: true") {
+                return None;
+            }
+            let scope = match only_regex.captures(options).map(|c| c[1].to_string()) {
+                Some(envs) if !envs.contains(":prod") && envs.contains(":dev") => {
+                    DependencyScope::Dev
+                }
+                Some(envs) if !envs.contains(":prod") => DependencyScope::Test,
+                _ if options.contains("runtime: false") => DependencyScope::Build,
+                _ => DependencyScope::Runtime,
+            };
+            Some(MixDependency {
+                name: captures[1].to_string(),
+                scope,
+            })
+        })
+        .collect()
+}
+
+/// Apps of an umbrella project: the directories under its `apps_path` with a `mix.exs`
+fn umbrella_apps(project_dir: &Path) -> Vec<PathBuf> {
+    let Ok(mix_exs) = fs::read_to_string(project_dir.join("mix.exs")) else {
+        return Vec::new();
+    };
+    let Some(apps_path) = Regex::new(r#"apps_path:\s*"([^"]+)""#)
+        .ok()
+        .and_then(|regex| regex.captures(&mix_exs).map(|c| c[1].to_string()))
+    else {
+        return Vec::new();
+    };
+
+    let mut apps: Vec<PathBuf> = fs::read_dir(project_dir.join(apps_path))
+        .map(|entries| {
+            entries
+                .filter_map(|e| e.ok())
+                .map(|e| e.path())
+                .filter(|path| path.join("mix.exs").is_file())
+                .collect()
+        })
+        .unwrap_or_default();
+    apps.sort();
+    apps
+}
+
+fn mix_dependency_graph(
+    packages: &BTreeMap<String, MixPackage>,
+    direct: &[MixDependency],
+) -> DependencyGraph {
+    let mut graph = DependencyGraph::new();
+    for package in packages.values() {
+        graph.add_package(&package.name, &package.name, &package.version);
+    }
+    for package in packages.values() {
+        for required in &package.requires {
+            graph.add_dependency(&package.name, required);
+        }
+    }
+    for dep in direct {
+        graph.add_direct_with_scope(&dep.name, dep.scope);
+    }
+    graph
+}
+
+fn analyze_package(
+    package: MixPackage,
+    project_dir: &Path,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> LicenseInfo {
+    log(
+        LogLevel::Info,
+        &format!(
+            "Processing Mix package: {} ({})",
+            package.name, package.version
+        ),
+    );
+
+    let (license_result, license_confidence) =
+        time_dependency("hex", &package.name, &package.version, || {
+            fetch_license_for_package(&package, project_dir, no_local)
+        });
+    let license = Some(license_result);
+    let is_restrictive = is_license_restrictive(&license, known_licenses, config.strict);
+
+    if is_restrictive {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Restrictive license found: {license:?} for {}",
+                package.name
+            ),
+        );
+    }
+
+    LicenseInfo {
+        name: package.name,
+        version: package.version,
+        license: license.clone(),
+        is_restrictive,
+        compatibility: LicenseCompatibility::Unknown,
+        osi_status: match &license {
+            Some(l) => crate::licenses::get_osi_status(l),
+            None => crate::licenses::OsiStatus::Unknown,
+        },
+        license_confidence,
+        source_file: None,
+        dependency_path: None,
+        tier: None,
+        vulnerabilities: None,
+        copyright: None,
+        legal_files: None,
+        chosen_license: None,
+        requires: None,
+        scope: DependencyScope::Runtime,
+        manual_license: None,
+        health: None,
+        obligations: None,
+        explanation: None,
+        repository: None,
+        aliases: None,
+        purl: None,
+        review: None,
+        status: LookupStatus::Ok,
+        error: None,
+    }
+}
+
+/// License of a mix dependency, from its hex metadata or else its license file
+///
+/// `mix deps.get` unpacks dependencies into `deps/`, where hex packages keep
+/// their metadata in `hex_metadata.config`. The confidence is only set for a
+/// classified license file.
+fn fetch_license_for_package(
+    package: &MixPackage,
+    project_dir: &Path,
+    no_local: bool,
+) -> (String, Option<f32>) {
+    let checkout = Some(project_dir.join("deps").join(&package.name)).filter(|_| !no_local);
+
+    let detected = match &package.source {
+        MixSource::Hex {
+            package: name,
+            repo,
+        } => checkout
+            .as_ref()
+            .and_then(|dir| fs::read_to_string(dir.join("hex_metadata.config")).ok())
+            .and_then(|metadata| license_from_hex_metadata(&metadata))
+            .or_else(|| fetch_license_from_hex_repo(name, &package.version, repo))
+            .map(|license| (license, None))
+            .or_else(|| {
+                checkout
+                    .as_ref()
+                    .and_then(|dir| detect_license_in_dir(dir))
+                    .map(|detected| (detected.license, Some(detected.confidence)))
+            }),
+        MixSource::Git { url, revision } => checkout
+            .as_ref()
+            .and_then(|dir| detect_license_in_dir(dir))
+            .map(|detected| (detected.license, detected.confidence))
+            .or_else(|| fetch_repository_license(url, revision))
+            .map(|(license, confidence)| (license, Some(confidence))),
+    };
+
+    detected.unwrap_or_else(|| {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "No license found for {} ({})",
+                package.name, package.version
+            ),
+        );
+        ("Unknown".to_string(), None)
+    })
+}
+
+/// `licenses` of an unpacked package's `hex_metadata.config`
+///
+/// The file holds Erlang terms such as `{<<"licenses">>,[<<"MIT">>]}.`
+fn license_from_hex_metadata(metadata: &str) -> Option<String> {
+    let list_regex = Regex::new(r#"\{<<"licenses">>\s*,\s*\[([^\]]*)\]\s*\}"#).ok()?;
+    let binary_regex = Regex::new(r#"<<"([^"]*)">>"#).ok()?;
+    let list = list_regex.captures(metadata)?;
+    let licenses: Vec<String> = binary_regex
+        .captures_iter(&list[1])
+        .map(|c| c[1].to_string())
+        .collect();
+    // Hex lists the licenses a package may be used under, like a gemspec
+    license_from_gem_licenses(&licenses)
+}
+
+pub fn fetch_license_from_hex(name: &str, version: &str) -> Option<String> {
+    fetch_license_from_hex_repo(name, version, "hexpm")
+}
+
+/// Fetch the `licenses` of a package from the Hex API
+///
+/// Packages of a private organization (`hexpm:<organization>`) are read from
+/// the organization's repository; other repositories cannot be looked up.
+fn fetch_license_from_hex_repo(name: &str, version: &str, repo: &str) -> Option<String> {
+    let hex_api = registry::hex_api_url();
+    let url = match repo.split_once(':') {
+        None if repo == "hexpm" => format!("{hex_api}/packages/{name}"),
+        Some(("hexpm", organization)) => {
+            format!("{hex_api}/repos/{organization}/packages/{name}")
+        }
+        _ => {
+            log(
+                LogLevel::Warn,
+                &format!("{name} is from the {repo} repository, which cannot be looked up"),
+            );
+            return None;
+        }
+    };
+
+    let cache_key = format!("{repo}/{name}");
+    if let Some(license) = get_cached_license("hex", &cache_key, version) {
+        return Some(license);
+    }
+
+    log(LogLevel::Info, &format!("Fetching license from Hex: {url}"));
+    let response = match registry::get(Registry::Hex, &url) {
+        Ok(response) => response,
+        Err(err) => {
+            log_error(&format!("Failed to fetch metadata for {name}"), &err);
+            return None;
+        }
+    };
+    let status = response.status();
+    if !status.is_success() {
+        log(
+            LogLevel::Error,
+            &format!("Failed to fetch metadata for {name}: HTTP {status}"),
+        );
+        return None;
+    }
+
+    let json = match response.json::<Value>() {
+        Ok(json) => json,
+        Err(err) => {
+            log_error(&format!("Failed to parse JSON for {name}: {version}"), &err);
+            return None;
+        }
+    };
+    let declared: Vec<String> = json["meta"]["licenses"]
+        .as_array()
+        .map(|licenses| {
+            licenses
+                .iter()
+                .filter_map(|l| l.as_str().map(str::to_string))
+                .collect()
+        })
+        .unwrap_or_default();
+
+    match license_from_gem_licenses(&declared) {
+        Some(license) => {
+            cache_license("hex", &cache_key, version, &license);
+            Some(license)
+        }
+        None => {
+            log(
+                LogLevel::Warn,
+                &format!("No license declared for {name} ({version})"),
+            );
+            None
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const MIX_LOCK: &str = r#"%{
+  "castore": {:hex, :castore, "1.0.5", "9eeebb394cc9a0f3ae56b813459f990abb0a3dedee1be6b27fdb50301930502f", [:mix], [], "hexpm", "8d7c597c3e4a64c395980882d4bca3cebb8d74197c590dc272cfd3b6a6310578"},
+  "jason": {:hex, :jason, "1.4.1", "af1504e35f629ddcdd6addb3513c3853991f694921b1b9368b0bd32beb9f1b63", [:mix], [{:decimal, "~> 1.0 or ~> 2.0", [hex: :decimal, repo: "hexpm", optional: true]}], "hexpm", "fbb01ecdfd565b56261302f7e1fcc27c4fb8f32d56eab74db621fc154604a7a1"},
+  "decimal": {:hex, :decimal, "2.1.1", "5611dca5d4b2c3dd497dec8f68751f1f1a54755e8ed2a966c2633cf885973ad6", [:mix], [], "hexpm", "53cfe5f497ed0e7771ae1a475575603d77425099ba5faef9394932b35020ffcc"},
+  "credo": {:hex, :credo, "1.7.5", "643213503b1c766ec0496d828c90c424471ea54da77c8a168c725686377b9545", [:mix], [{:jason, "~> 1.0", [hex: :jason, repo: "hexpm", optional: false]}], "hexpm", "f799e9b5cd1891577d8c773d245668aa74a2fcd15eb277f51a0131690ebfb3fd"},
+  "billing": {:hex, :billing_client, "0.3.0", "aa", [:mix], [], "hexpm:acme", "bb"},
+  "legacy": {:hex, :legacy, "0.1.0", "cc", [:rebar3], []},
+  "phoenix_live_view": {:git, "https://github.com/phoenixframework/phoenix_live_view.git", "3c9c3a1bc1f7d2a1c7c1b3e6fa3c4d0f6f2e9b1a", [branch: "main"]},
+}
+"#;
+
+    const MIX_EXS: &str = r#"defmodule MyApp.MixProject do
+  use Mix.Project
+
+  def project do
+    [app: :my_app, version: "0.1.0", deps: deps()]
+  end
+
+  def application do
+    [mod: {MyApp.Application, []}, extra_applications: [:logger]]
+  end
+
+  defp deps do
+    [
+      {:jason, "~> 1.4"},
+      {:phoenix_live_view, github: "phoenixframework/phoenix_live_view", branch: "main"},
+      {:credo, "~> 1.7", only: [:dev, :test], runtime: false},
+      {:castore, "~> 1.0", runtime: false},
+      {:billing, "~> 0.3", hex: :billing_client, organization: "acme", only: :test},
+      {:my_core, in_umbrella: true}
+    ]
+  end
+end
+"#;
+
+    #[test]
+    fn test_parse_mix_lock() {
+        let packages = parse_mix_lock(MIX_LOCK);
+        assert_eq!(packages.len(), 7);
+
+        let jason = &packages[1];
+        assert_eq!(jason.name, "jason");
+        assert_eq!(jason.version, "1.4.1");
+        assert_eq!(
+            jason.source,
+            MixSource::Hex {
+                package: "jason".to_string(),
+                repo: "hexpm".to_string()
+            }
+        );
+        assert_eq!(jason.requires, vec!["decimal".to_string()]);
+
+        // Private packages keep their Hex name and organization
+        assert_eq!(
+            packages[4].source,
+            MixSource::Hex {
+                package: "billing_client".to_string(),
+                repo: "hexpm:acme".to_string()
+            }
+        );
+        // Older lockfiles have no repository field
+        assert_eq!(
+            packages[5].source,
+            MixSource::Hex {
+                package: "legacy".to_string(),
+                repo: "hexpm".to_string()
+            }
+        );
+        assert_eq!(
+            packages[6].source,
+            MixSource::Git {
+                url: "https://github.com/phoenixframework/phoenix_live_view.git".to_string(),
+                revision: "3c9c3a1bc1f7d2a1c7c1b3e6fa3c4d0f6f2e9b1a".to_string()
+            }
+        );
+
+        // The map syntax of old Mix versions
+        let old = parse_mix_lock(r#"%{"plug" => {:hex, :plug, "1.5.0", "abc"}}"#);
+        assert_eq!(old.len(), 1);
+        assert_eq!(old[0].version, "1.5.0");
+
+        assert!(parse_mix_lock("%{\"broken\": {:hex").is_empty());
+    }
+
+    #[test]
+    fn test_parse_mix_exs_deps() {
+        let deps = parse_mix_exs_deps(MIX_EXS);
+        let scope = |name: &str| {
+            deps.iter()
+                .find(|dep| dep.name == name)
+                .map(|dep| dep.scope)
+        };
+
+        assert_eq!(deps.len(), 5);
+        assert_eq!(scope("jason"), Some(DependencyScope::Runtime));
+        assert_eq!(scope("phoenix_live_view"), Some(DependencyScope::Runtime));
+        assert_eq!(scope("credo"), Some(DependencyScope::Dev));
+        assert_eq!(scope("castore"), Some(DependencyScope::Build));
+        assert_eq!(scope("billing"), Some(DependencyScope::Test));
+        assert_eq!(scope("my_core"), None);
+    }
+
+    #[test]
+    fn test_license_from_hex_metadata() {
+        let metadata = r#"{<<"app">>,<<"jason">>}.
+{<<"licenses">>,[<<"Apache-2.0">>]}.
+{<<"name">>,<<"jason">>}.
+"#;
+        assert_eq!(
+            license_from_hex_metadata(metadata),
+            Some("Apache-2.0".to_string())
+        );
+        assert_eq!(
+            license_from_hex_metadata(r#"{<<"licenses">>,[<<"MIT">>,<<"Apache-2.0">>]}."#),
+            Some("MIT OR Apache-2.0".to_string())
+        );
+        assert_eq!(license_from_hex_metadata(r#"{<<"licenses">>,[]}."#), None);
+    }
+
+    #[test]
+    fn test_umbrella_apps_are_aggregated() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::write(
+            root.join("mix.exs"),
+            "defmodule Umbrella.MixProject do\n  def project do\n    [apps_path: \"apps\", deps: deps()]\n  end\n\n  defp deps do\n    [{:credo, \"~> 1.7\", only: :dev}]\n  end\nend\n",
+        )
+        .unwrap();
+        fs::write(root.join("mix.lock"), MIX_LOCK).unwrap();
+        for (app, mix_exs) in [
+            ("web", MIX_EXS),
+            (
+                "my_core",
+                "defmodule MyCore.MixProject do\n  defp deps do\n    [{:decimal, \"~> 2.0\"}]\n  end\nend\n",
+            ),
+        ] {
+            fs::create_dir_all(root.join("apps").join(app)).unwrap();
+            fs::write(root.join("apps").join(app).join("mix.exs"), mix_exs).unwrap();
+        }
+        fs::create_dir_all(root.join("apps/docs")).unwrap();
+
+        let apps = umbrella_apps(root);
+        assert_eq!(apps, vec![root.join("apps/my_core"), root.join("apps/web")]);
+
+        let packages: BTreeMap<String, MixPackage> = parse_mix_lock(MIX_LOCK)
+            .into_iter()
+            .map(|package| (package.name.clone(), package))
+            .collect();
+        let direct: Vec<MixDependency> = std::iter::once(root.to_path_buf())
+            .chain(apps)
+            .flat_map(|dir| parse_mix_exs_deps(&fs::read_to_string(dir.join("mix.exs")).unwrap()))
+            .collect();
+        let graph = mix_dependency_graph(&packages, &direct);
+
+        // decimal is a direct dependency of one app and pulled in by jason for another
+        let paths = graph.paths();
+        assert_eq!(paths["decimal@2.1.1"], vec!["decimal@2.1.1"]);
+        assert_eq!(paths["credo@1.7.5"], vec!["credo@1.7.5"]);
+        assert_eq!(
+            graph.requires()["credo@1.7.5"],
+            vec!["jason@1.4.1".to_string()]
+        );
+
+        let scopes = graph.scopes();
+        assert_eq!(scopes["credo@1.7.5"], DependencyScope::Dev);
+        assert_eq!(scopes["decimal@2.1.1"], DependencyScope::Runtime);
+        assert!(!paths.contains_key("legacy@0.1.0"));
+    }
+}
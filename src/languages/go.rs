@@ -1,18 +1,30 @@
+use rayon::prelude::*;
 use regex::Regex;
-use reqwest::blocking::Client;
 use scraper::{Html, Selector};
+use sha2::{Digest, Sha256};
 use std::collections::{HashMap, HashSet};
 use std::fs;
+use std::io::{Cursor, Read};
 use std::path::{Path, PathBuf};
 use std::process::Command;
-use std::thread::sleep;
-use std::time::Duration;
+use std::sync::OnceLock;
+use zip::ZipArchive;
 
+use crate::cache::{cache_license, get_cached_license};
 use crate::config::FeludaConfig;
-use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::credentials::encode_base64;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, DependencyGraph,
+};
+use crate::license_detector::detect_license_in_dir;
 use crate::licenses::{
-    fetch_licenses_from_github, is_license_restrictive, LicenseCompatibility, LicenseInfo,
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, License,
+    LicenseCompatibility, LicenseInfo,
 };
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
+use crate::repository_license::fetch_repository_license;
 
 /// Go module names to exclude from dependency analysis
 /// These are special Go directives and built-in modules, not actual dependencies
@@ -25,6 +37,24 @@ pub struct GoPackages {
     pub version: String,
 }
 
+/// A `replace` directive from go.mod
+#[derive(Debug, Clone, PartialEq)]
+pub struct GoReplace {
+    pub old_name: String,
+    /// Only this version is replaced when set, otherwise every version is
+    pub old_version: Option<String>,
+    pub new_name: String,
+    /// None when the replacement is a local directory
+    pub new_version: Option<String>,
+}
+
+/// `replace` and `exclude` directives from go.mod
+#[derive(Debug, Default)]
+pub struct GoModDirectives {
+    pub replaces: Vec<GoReplace>,
+    pub excludes: HashSet<(String, String)>,
+}
+
 /// Analyze the licenses of Go dependencies
 pub fn analyze_go_licenses(go_mod_path: &str, config: &FeludaConfig) -> Vec<LicenseInfo> {
     log(
@@ -32,19 +62,7 @@ pub fn analyze_go_licenses(go_mod_path: &str, config: &FeludaConfig) -> Vec<Lice
         &format!("Analyzing Go dependencies from: {go_mod_path}"),
     );
 
-    let known_licenses = match fetch_licenses_from_github() {
-        Ok(licenses) => {
-            log(
-                LogLevel::Info,
-                &format!("Fetched {} known licenses from GitHub", licenses.len()),
-            );
-            licenses
-        }
-        Err(err) => {
-            log_error("Failed to fetch licenses from GitHub", &err);
-            HashMap::new()
-        }
-    };
+    let known_licenses = known_licenses();
 
     let content = match fs::read_to_string(go_mod_path) {
         Ok(content) => content,
@@ -54,6 +72,9 @@ pub fn analyze_go_licenses(go_mod_path: &str, config: &FeludaConfig) -> Vec<Lice
         }
     };
 
+    let directives = parse_go_mod_directives(&content);
+    log_debug("Go module directives", &directives);
+
     let direct_dependencies = get_go_dependencies(content);
     log(
         LogLevel::Info,
@@ -67,38 +88,59 @@ pub fn analyze_go_licenses(go_mod_path: &str, config: &FeludaConfig) -> Vec<Lice
         LogLevel::Info,
         &format!("Using max dependency depth: {max_depth}"),
     );
-    let all_deps = resolve_go_dependencies(go_mod_path, &direct_dependencies, max_depth);
+    let (resolved, graph_output) =
+        resolve_go_dependencies(go_mod_path, &direct_dependencies, max_depth);
+    let graph = graph_output.map(|output| go_dependency_graph(&output, &resolved, &directives));
+    let all_deps = apply_go_mod_directives(resolved, &directives);
+    let project_dir = Path::new(go_mod_path).parent().unwrap_or(Path::new("."));
+    let test_only = go_test_only_modules(project_dir);
 
     // Process all resolved dependencies
-    let mut licenses = Vec::new();
-    for (name, version) in all_deps {
-        log(
-            LogLevel::Info,
-            &format!("Processing dependency: {name} ({version})"),
-        );
-
-        let license_result = fetch_license_for_go_dependency(name.as_str(), version.as_str());
-        let license = Some(license_result);
-        let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
-
-        if is_restrictive {
+    let mut licenses: Vec<LicenseInfo> = all_deps
+        .into_par_iter()
+        .map(|(name, version)| {
             log(
-                LogLevel::Warn,
-                &format!("Restrictive license found: {license:?} for {name}"),
+                LogLevel::Info,
+                &format!("Processing dependency: {name} ({version})"),
             );
-        }
 
-        licenses.push(LicenseInfo {
-            name,
-            version,
-            license: license.clone(),
-            is_restrictive,
-            compatibility: LicenseCompatibility::Unknown,
-            osi_status: match &license {
-                Some(l) => crate::licenses::get_osi_status(l),
-                None => crate::licenses::OsiStatus::Unknown,
-            },
-        });
+            // Local directory replacements carry their path in place of a version. The
+            // published module was replaced, so its license doesn't apply.
+            let (license_result, license_confidence) = if is_local_go_path(&version) {
+                read_license_from_dir(&project_dir.join(&version)).unwrap_or_else(|| {
+                    log(
+                        LogLevel::Warn,
+                        &format!("No license file found in local replacement {version} of {name}"),
+                    );
+                    ("Unknown".to_string(), None)
+                })
+            } else {
+                time_dependency("go", &name, &version, || {
+                    fetch_license_for_go_dependency(name.as_str(), version.as_str())
+                })
+            };
+
+            let scope = if test_only.contains(&name) {
+                DependencyScope::Test
+            } else {
+                DependencyScope::Runtime
+            };
+
+            go_license_info(
+                name,
+                version,
+                license_result,
+                license_confidence,
+                scope,
+                &known_licenses,
+                config,
+            )
+        })
+        .collect();
+
+    if let Some(graph) = graph {
+        attach_dependency_paths(&mut licenses, &graph.paths());
+        attach_dependency_requires(&mut licenses, &graph.requires());
     }
 
     log(
@@ -108,6 +150,158 @@ pub fn analyze_go_licenses(go_mod_path: &str, config: &FeludaConfig) -> Vec<Lice
     licenses
 }
 
+/// Analyze the licenses of already resolved Go modules, e.g. those embedded in a binary
+///
+/// Modules replaced by a local directory carry its path in place of a version.
+/// Their sources aren't available, so the license is unknown.
+pub fn analyze_go_modules(
+    modules: Vec<(String, String)>,
+    config: &FeludaConfig,
+) -> Vec<LicenseInfo> {
+    let known_licenses = known_licenses();
+
+    modules
+        .into_par_iter()
+        .map(|(name, version)| {
+            log(
+                LogLevel::Info,
+                &format!("Processing module: {name} ({version})"),
+            );
+            let (license, license_confidence) = if is_local_go_path(&version) {
+                ("Unknown".to_string(), None)
+            } else {
+                time_dependency("go", &name, &version, || {
+                    fetch_license_for_go_dependency(name.as_str(), version.as_str())
+                })
+            };
+            go_license_info(
+                name,
+                version,
+                license,
+                license_confidence,
+                DependencyScope::Runtime,
+                &known_licenses,
+                config,
+            )
+        })
+        .collect()
+}
+
+fn known_licenses() -> HashMap<String, License> {
+    match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    }
+}
+
+fn go_license_info(
+    name: String,
+    version: String,
+    license: String,
+    license_confidence: Option<f32>,
+    scope: DependencyScope,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+) -> LicenseInfo {
+    let license = Some(license);
+    let is_restrictive = is_license_restrictive(&license, known_licenses, config.strict);
+
+    if is_restrictive {
+        log(
+            LogLevel::Warn,
+            &format!("Restrictive license found: {license:?} for {name}"),
+        );
+    }
+
+    LicenseInfo {
+        name,
+        version,
+        license: license.clone(),
+        is_restrictive,
+        compatibility: LicenseCompatibility::Unknown,
+        osi_status: match &license {
+            Some(l) => crate::licenses::get_osi_status(l),
+            None => crate::licenses::OsiStatus::Unknown,
+        },
+        license_confidence,
+        source_file: None,
+        dependency_path: None,
+        tier: None,
+        vulnerabilities: None,
+        copyright: None,
+        legal_files: None,
+        chosen_license: None,
+        requires: None,
+        scope,
+        manual_license: None,
+        health: None,
+        obligations: None,
+        explanation: None,
+        repository: None,
+        aliases: None,
+        purl: None,
+        review: None,
+        status: LookupStatus::Ok,
+        error: None,
+    }
+}
+
+/// Modules that only the project's tests import
+///
+/// Compares the modules providing packages to `go list -deps ./...` with and
+/// without `-test`. If either listing fails nothing is marked, so a broken
+/// toolchain never hides a runtime dependency.
+fn go_test_only_modules(project_dir: &Path) -> HashSet<String> {
+    let list_modules = |with_tests: bool| -> Option<HashSet<String>> {
+        let mut args = vec!["list", "-deps"];
+        if with_tests {
+            args.push("-test");
+        }
+        args.extend(["-f", "{{with .Module}}{{.Path}}{{end}}", "./..."]);
+
+        let output = Command::new("go")
+            .args(&args)
+            .current_dir(project_dir)
+            .output()
+            .ok()?;
+        if !output.status.success() {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "go list failed, not marking test-only modules: {}",
+                    String::from_utf8_lossy(&output.stderr).trim()
+                ),
+            );
+            return None;
+        }
+        let stdout = String::from_utf8_lossy(&output.stdout);
+        Some(
+            stdout
+                .lines()
+                .map(str::trim)
+                .filter(|line| !line.is_empty())
+                .map(String::from)
+                .collect(),
+        )
+    };
+
+    let (Some(build), Some(test)) = (list_modules(false), list_modules(true)) else {
+        return HashSet::new();
+    };
+    let test_only: HashSet<String> = test.difference(&build).cloned().collect();
+    log_debug("Test-only Go modules", &test_only);
+    test_only
+}
+
 /// Parse Go dependencies from go.mod content
 pub fn get_go_dependencies(content_string: String) -> Vec<GoPackages> {
     log(LogLevel::Info, "Parsing Go dependencies");
@@ -174,19 +368,19 @@ pub fn get_go_dependencies(content_string: String) -> Vec<GoPackages> {
     dependency
 }
 
-/// Resolve all Go dependencies
+/// Resolve all Go dependencies, with the `go mod graph` output when it was used
 fn resolve_go_dependencies(
     go_mod_path: &str,
     direct_deps: &[GoPackages],
     max_depth: u32,
-) -> Vec<(String, String)> {
+) -> (Vec<(String, String)>, Option<String>) {
     log(
         LogLevel::Info,
         &format!("Resolving Go dependencies (including transitive up to depth {max_depth})"),
     );
 
     // go mod graph for complete dependency resolution
-    if let Ok(go_deps) = resolve_with_go_mod_graph(go_mod_path, max_depth) {
+    if let Ok((go_deps, output)) = resolve_with_go_mod_graph(go_mod_path, max_depth) {
         if !go_deps.is_empty() {
             log(
                 LogLevel::Info,
@@ -196,26 +390,44 @@ fn resolve_go_dependencies(
                     max_depth
                 ),
             );
-            return go_deps;
+            return (go_deps, Some(output));
+        }
+    }
+
+    // go.sum lists every module in the build graph, so it is the next best source
+    let go_sum_path = Path::new(go_mod_path).with_file_name("go.sum");
+    if let Ok(go_sum) = fs::read_to_string(&go_sum_path) {
+        let go_sum_deps = parse_go_sum(&go_sum);
+        if !go_sum_deps.is_empty() {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Resolved {} dependencies from {} (go mod graph not available)",
+                    go_sum_deps.len(),
+                    go_sum_path.display()
+                ),
+            );
+            return (go_sum_deps, None);
         }
     }
 
     // Direct dependencies in case go mod graph fails
     log(
         LogLevel::Info,
-        "Falling back to direct dependencies only (go mod graph not available)",
+        "Falling back to direct dependencies only (go mod graph and go.sum not available)",
     );
-    direct_deps
+    let deps = direct_deps
         .iter()
         .map(|dep| (dep.name.clone(), dep.version.clone()))
-        .collect()
+        .collect();
+    (deps, None)
 }
 
-/// Resolve dependencies using go mod graph with depth limit
+/// Resolve dependencies using go mod graph with depth limit, returning its output too
 fn resolve_with_go_mod_graph(
     go_mod_path: &str,
     max_depth: u32,
-) -> Result<Vec<(String, String)>, String> {
+) -> Result<(Vec<(String, String)>, String), String> {
     let project_dir = Path::new(go_mod_path)
         .parent()
         .ok_or("Cannot determine project directory")?;
@@ -237,7 +449,7 @@ fn resolve_with_go_mod_graph(
         return Err(format!("go mod graph failed: {stderr}"));
     }
 
-    let stdout_str = String::from_utf8_lossy(&output.stdout);
+    let stdout_str = String::from_utf8_lossy(&output.stdout).into_owned();
     let deps = parse_go_mod_graph_output(&stdout_str, max_depth);
 
     log(
@@ -248,7 +460,49 @@ fn resolve_with_go_mod_graph(
         ),
     );
 
-    Ok(deps)
+    Ok((deps, stdout_str))
+}
+
+/// Dependency graph of the modules selected from `go mod graph` output
+///
+/// `go mod graph` lists the requirements of every version of a module that was
+/// considered. Only those of the version minimal version selection picked are
+/// edges, so paths follow the modules that are actually built. Nodes are
+/// labelled after `replace` and `exclude` directives are applied, like the
+/// dependencies they describe.
+fn go_dependency_graph(
+    output: &str,
+    modules: &[(String, String)],
+    directives: &GoModDirectives,
+) -> DependencyGraph {
+    let mut graph = DependencyGraph::new();
+    let mut selected = HashMap::new();
+    for (name, version) in modules {
+        if let Some((resolved_name, resolved_version)) =
+            apply_go_mod_directive(name, version, directives)
+        {
+            graph.add_package(name, &resolved_name, &resolved_version);
+            selected.insert(name.as_str(), version.as_str());
+        }
+    }
+
+    for line in output.lines() {
+        let Some((from, to)) = line.trim().split_once(' ') else {
+            continue;
+        };
+        let Some((to_name, _)) = parse_go_module_version(to.trim()) else {
+            continue;
+        };
+        if !from.contains('@') {
+            // The main module is listed without a version
+            graph.add_direct(&to_name);
+        } else if let Some((from_name, from_version)) = parse_go_module_version(from) {
+            if selected.get(from_name.as_str()) == Some(&from_version.as_str()) {
+                graph.add_dependency(&from_name, &to_name);
+            }
+        }
+    }
+    graph
 }
 
 /// Parse go mod graph output to extract dependencies with depth awareness
@@ -273,13 +527,16 @@ fn parse_go_mod_graph_output(output: &str, max_depth: u32) -> Vec<(String, Strin
             let from = from.trim();
             let to = to.trim();
 
-            // Parse module name and version
-            if let Some((from_name, from_version)) = parse_go_module_version(from) {
-                all_deps.insert(from_name.clone(), from_version);
+            // Parse module name and version, keeping the highest version seen (MVS).
+            // The main module has no version and is not a dependency of itself.
+            if from.contains('@') {
+                if let Some((from_name, from_version)) = parse_go_module_version(from) {
+                    insert_max_version(&mut all_deps, from_name, from_version);
+                }
             }
 
             if let Some((to_name, to_version)) = parse_go_module_version(to) {
-                all_deps.insert(to_name.clone(), to_version);
+                insert_max_version(&mut all_deps, to_name, to_version);
 
                 // Track edges for depth calculation
                 edges
@@ -386,6 +643,202 @@ fn parse_go_mod_graph_output(output: &str, max_depth: u32) -> Vec<(String, Strin
     filtered_deps
 }
 
+/// Record a module version, keeping the higher one if the module was already seen
+///
+/// This is the core of Go's minimal version selection: the build list contains
+/// the maximum of all versions required anywhere in the graph.
+fn insert_max_version(modules: &mut HashMap<String, String>, name: String, version: String) {
+    match modules.get(&name) {
+        Some(existing) if compare_go_versions(existing, &version) != std::cmp::Ordering::Less => {}
+        _ => {
+            modules.insert(name, version);
+        }
+    }
+}
+
+/// Compare two Go module versions using semantic versioning rules
+///
+/// Pseudo-versions are valid semver pre-releases, so they sort correctly. Versions
+/// that fail to parse fall back to plain string comparison.
+fn compare_go_versions(a: &str, b: &str) -> std::cmp::Ordering {
+    let parse = |v: &str| semver::Version::parse(v.trim_start_matches('v'));
+    match (parse(a), parse(b)) {
+        (Ok(a), Ok(b)) => a.cmp(&b),
+        _ => a.cmp(b),
+    }
+}
+
+/// Parse go.sum content into the selected version of every module it lists
+fn parse_go_sum(content: &str) -> Vec<(String, String)> {
+    let mut modules = HashMap::new();
+
+    for line in content.lines() {
+        let mut parts = line.split_whitespace();
+        let (Some(name), Some(version)) = (parts.next(), parts.next()) else {
+            continue;
+        };
+
+        if is_excluded_go_module(name) {
+            continue;
+        }
+
+        let version = version.trim_end_matches("/go.mod");
+        insert_max_version(&mut modules, name.to_string(), version.to_string());
+    }
+
+    let mut deps: Vec<(String, String)> = modules.into_iter().collect();
+    deps.sort();
+
+    log(
+        LogLevel::Info,
+        &format!("Parsed {} modules from go.sum", deps.len()),
+    );
+    deps
+}
+
+/// Parse `replace` and `exclude` directives from go.mod content
+pub fn parse_go_mod_directives(content: &str) -> GoModDirectives {
+    let mut directives = GoModDirectives::default();
+    let mut block: Option<&str> = None;
+
+    for line in content.lines() {
+        let line = line.split("//").next().unwrap_or("").trim();
+        if line.is_empty() {
+            continue;
+        }
+
+        let entry = if let Some(current) = block {
+            if line == ")" {
+                block = None;
+                continue;
+            }
+            (current, line)
+        } else if let Some((keyword, rest)) = line.split_once(char::is_whitespace) {
+            let rest = rest.trim();
+            if !matches!(keyword, "replace" | "exclude") {
+                continue;
+            }
+            if rest == "(" {
+                block = Some(keyword);
+                continue;
+            }
+            (keyword, rest)
+        } else {
+            continue;
+        };
+
+        match entry {
+            ("replace", spec) => {
+                if let Some(replace) = parse_go_replace(spec) {
+                    directives.replaces.push(replace);
+                }
+            }
+            ("exclude", spec) => {
+                let mut parts = spec.split_whitespace();
+                if let (Some(name), Some(version)) = (parts.next(), parts.next()) {
+                    directives
+                        .excludes
+                        .insert((name.to_string(), version.to_string()));
+                }
+            }
+            _ => {}
+        }
+    }
+
+    directives
+}
+
+/// Parse a single replace spec such as `old v1.0.0 => new v1.1.0` or `old => ../local`
+fn parse_go_replace(spec: &str) -> Option<GoReplace> {
+    let (old, new) = spec.split_once("=>")?;
+    let mut old_parts = old.split_whitespace();
+    let mut new_parts = new.split_whitespace();
+
+    let old_name = old_parts.next()?.to_string();
+    let old_version = old_parts.next().map(String::from);
+    let new_name = new_parts.next()?.to_string();
+    let new_version = new_parts.next().map(String::from);
+
+    Some(GoReplace {
+        old_name,
+        old_version,
+        new_name,
+        new_version,
+    })
+}
+
+/// Check if a replacement target or version refers to a local directory
+fn is_local_go_path(path: &str) -> bool {
+    path.starts_with("./") || path.starts_with("../") || path.starts_with('/')
+}
+
+/// Drop excluded module versions and substitute replaced modules
+fn apply_go_mod_directives(
+    deps: Vec<(String, String)>,
+    directives: &GoModDirectives,
+) -> Vec<(String, String)> {
+    let mut result: Vec<(String, String)> = Vec::with_capacity(deps.len());
+
+    for (name, version) in deps {
+        let Some(resolved) = apply_go_mod_directive(&name, &version, directives) else {
+            log(
+                LogLevel::Info,
+                &format!("Skipping excluded Go module version: {name} ({version})"),
+            );
+            continue;
+        };
+        if resolved != (name, version) {
+            log(
+                LogLevel::Info,
+                &format!("Applied replace directive: {} ({})", resolved.0, resolved.1),
+            );
+        }
+        if !result.contains(&resolved) {
+            result.push(resolved);
+        }
+    }
+
+    result
+}
+
+/// The module that is built in place of `name` at `version`, or None when it is excluded
+fn apply_go_mod_directive(
+    name: &str,
+    version: &str,
+    directives: &GoModDirectives,
+) -> Option<(String, String)> {
+    if directives
+        .excludes
+        .contains(&(name.to_string(), version.to_string()))
+    {
+        return None;
+    }
+
+    // A version-specific replace wins over one that covers all versions
+    let replace = directives
+        .replaces
+        .iter()
+        .find(|r| r.old_name == name && r.old_version.as_deref() == Some(version))
+        .or_else(|| {
+            directives
+                .replaces
+                .iter()
+                .find(|r| r.old_name == name && r.old_version.is_none())
+        });
+
+    let resolved = match replace {
+        Some(GoReplace {
+            new_name,
+            new_version: Some(new_version),
+            ..
+        }) => (new_name.clone(), new_version.clone()),
+        // Local directory replacements keep the module name and carry the path
+        Some(GoReplace { new_name, .. }) => (name.to_string(), new_name.clone()),
+        None => (name.to_string(), version.to_string()),
+    };
+    Some(resolved)
+}
+
 /// Check if a module name should be excluded from dependency analysis
 fn is_excluded_go_module(module_name: &str) -> bool {
     EXCLUDED_GO_MODULES.contains(&module_name)
@@ -418,10 +871,13 @@ fn parse_go_module_version(module_str: &str) -> Option<(String, String)> {
 }
 
 /// Fetch the license for a Go dependency, trying local sources first, then pkg.go.dev
+///
+/// The second value is the classifier confidence when the license was detected
+/// from a LICENSE file in the module cache.
 pub fn fetch_license_for_go_dependency(
     name: impl Into<String>,
     version: impl Into<String>,
-) -> String {
+) -> (String, Option<f32>) {
     let name = name.into();
     let version = version.into();
 
@@ -430,18 +886,492 @@ pub fn fetch_license_for_go_dependency(
             LogLevel::Info,
             &format!("Found license in local go.mod for {name}: {license}"),
         );
-        return license;
+        return (license, None);
     }
 
-    if let Some(license) = get_license_from_go_module_cache(&name, &version) {
+    if let Some((license, confidence)) = get_license_from_go_module_cache(&name, &version) {
         log(
             LogLevel::Info,
             &format!("Found license in Go module cache for {name}: {license}"),
         );
-        return license;
+        return (license, confidence);
+    }
+
+    if let Some(license) = get_cached_license("go", &name, &version) {
+        return (license, None);
+    }
+
+    // Private modules and custom proxies are reached through the go command,
+    // which brings GOPROXY, netrc and git credentials along
+    let private = is_private_go_module(&name);
+    if private || go_env().custom_proxy || registry::go_proxies().is_some() {
+        if let Some((license, confidence)) =
+            download_go_module(&name, &version).and_then(|dir| read_license_from_dir(&dir))
+        {
+            cache_license("go", &name, &version, &license);
+            return (license, confidence);
+        }
+        if private {
+            // pkg.go.dev knows nothing about private modules, and shouldn't learn their names
+            log(
+                LogLevel::Warn,
+                &format!("Unable to download private Go module {name}@{version}"),
+            );
+            return ("Unknown".into(), None);
+        }
+    }
+
+    if let Some((license, confidence)) = fetch_license_from_module_proxy(&name, &version) {
+        cache_license("go", &name, &version, &license);
+        return (license, confidence);
+    }
+
+    // Pseudo-versions name an untagged commit, which is where the license is read from
+    if let Some(revision) = pseudo_version_revision(&version) {
+        if let Some((license, confidence)) = fetch_license_at_revision(&name, revision) {
+            cache_license("go", &name, &version, &license);
+            return (license, Some(confidence));
+        }
+    }
+
+    let license = fetch_license_from_pkg_go_dev(&name, &version);
+    cache_license("go", &name, &version, &license);
+    (license, None)
+}
+
+const GO_PROXY: &str = "https://proxy.golang.org";
+const GO_SUMDB: &str = "https://sum.golang.org";
+
+/// Variables read by [`go_env`], in order
+const GO_ENV_VARS: [&str; 6] = [
+    "GOPRIVATE",
+    "GONOPROXY",
+    "GOPROXY",
+    "GONOSUMDB",
+    "GONOSUMCHECK",
+    "GOSUMDB",
+];
+
+/// Go environment settings that decide where modules come from
+#[derive(Debug, Default, PartialEq)]
+struct GoEnv {
+    /// `GOPRIVATE` and `GONOPROXY` patterns
+    private_patterns: Vec<String>,
+    /// Whether `GOPROXY` points somewhere other than proxy.golang.org
+    custom_proxy: bool,
+    /// Proxies of `GOPROXY` to download module zips from, without `direct`
+    proxies: Vec<String>,
+    /// `GOPRIVATE`, `GONOSUMDB` and `GONOSUMCHECK` patterns of modules not checked against the checksum database
+    nosumdb_patterns: Vec<String>,
+    /// URL of the checksum database, `None` with `GOSUMDB=off`
+    sumdb: Option<String>,
+}
+
+fn go_env() -> &'static GoEnv {
+    static GO_ENV: OnceLock<GoEnv> = OnceLock::new();
+    GO_ENV.get_or_init(|| {
+        // `go env` also sees values written with `go env -w`
+        let from_go = Command::new("go")
+            .arg("env")
+            .args(GO_ENV_VARS)
+            .output()
+            .ok()
+            .filter(|output| output.status.success())
+            .map(|output| {
+                String::from_utf8_lossy(&output.stdout)
+                    .lines()
+                    .map(|line| line.trim().to_string())
+                    .collect::<Vec<_>>()
+            });
+        let values = from_go.unwrap_or_else(|| {
+            GO_ENV_VARS
+                .iter()
+                .map(|name| std::env::var(name).unwrap_or_default())
+                .collect()
+        });
+        parse_go_env(&values)
+    })
+}
+
+/// Settings from the values of [`GO_ENV_VARS`]
+fn parse_go_env(values: &[String]) -> GoEnv {
+    let value = |index: usize| {
+        values
+            .get(index)
+            .map(|value| value.trim())
+            .unwrap_or_default()
+    };
+    let patterns = |indices: &[usize]| {
+        indices
+            .iter()
+            .flat_map(|&index| value(index).split(','))
+            .map(str::trim)
+            .filter(|pattern| !pattern.is_empty())
+            .map(String::from)
+            .collect::<Vec<_>>()
+    };
+
+    let proxy = value(2);
+    let custom_proxy = proxy
+        .split([',', '|'])
+        .next()
+        .map(str::trim)
+        .is_some_and(|first| {
+            !first.is_empty()
+                && !matches!(first, "direct" | "off")
+                && first.trim_end_matches('/') != GO_PROXY
+        });
+    let proxies = if proxy.is_empty() {
+        vec![GO_PROXY.to_string()]
+    } else {
+        proxy
+            .split([',', '|'])
+            .map(str::trim)
+            .take_while(|entry| *entry != "off")
+            .filter(|entry| !entry.is_empty() && *entry != "direct")
+            .map(|entry| entry.trim_end_matches('/').to_string())
+            .collect()
+    };
+
+    // GOSUMDB is `off`, a database name with an optional `+key`, or `name+key url`
+    let sumdb = match value(5) {
+        "" => Some(GO_SUMDB.to_string()),
+        "off" => None,
+        sumdb => match sumdb.split_whitespace().nth(1) {
+            Some(url) => Some(url.trim_end_matches('/').to_string()),
+            None => sumdb
+                .split('+')
+                .next()
+                .map(|name| format!("https://{name}")),
+        },
+    };
+
+    GoEnv {
+        private_patterns: patterns(&[0, 1]),
+        custom_proxy,
+        proxies,
+        nosumdb_patterns: patterns(&[0, 3, 4]),
+        sumdb,
+    }
+}
+
+/// Whether `module` matches one of the comma-separated glob patterns of `GOPRIVATE`
+///
+/// As in the go command, a pattern matches a module path prefix made of whole
+/// path elements, so `example.com/internal` covers `example.com/internal/api`.
+fn matches_go_private_pattern(pattern: &str, module: &str) -> bool {
+    let pattern_parts: Vec<&str> = pattern.trim_end_matches('/').split('/').collect();
+    let module_parts: Vec<&str> = module.split('/').collect();
+    module_parts.len() >= pattern_parts.len()
+        && pattern_parts
+            .iter()
+            .zip(&module_parts)
+            .all(|(pattern, part)| glob_match(pattern, part))
+}
+
+/// Match a single path element against a glob with `*` and `?`
+fn glob_match(pattern: &str, text: &str) -> bool {
+    match pattern.split_once('*') {
+        None => {
+            pattern.len() == text.len()
+                && pattern
+                    .chars()
+                    .zip(text.chars())
+                    .all(|(p, t)| p == '?' || p == t)
+        }
+        Some((prefix, rest)) => {
+            text.len() >= prefix.len()
+                && glob_match(prefix, &text[..prefix.len()])
+                && (prefix.len()..=text.len())
+                    .filter(|&i| text.is_char_boundary(i))
+                    .any(|i| glob_match(rest, &text[i..]))
+        }
+    }
+}
+
+fn is_private_go_module(module: &str) -> bool {
+    go_env()
+        .private_patterns
+        .iter()
+        .any(|pattern| matches_go_private_pattern(pattern, module))
+}
+
+/// Download a module version into the module cache and return its directory
+fn download_go_module(module: &str, version: &str) -> Option<PathBuf> {
+    // The go command would still contact the module proxy after the scan was stopped
+    if crate::limits::abort_reason().is_some() {
+        return None;
+    }
+    log(
+        LogLevel::Info,
+        &format!("Downloading Go module {module}@{version}"),
+    );
+    let mut command = Command::new("go");
+    command.args(["mod", "download", "-json", &format!("{module}@{version}")]);
+    if let Some(proxies) = registry::go_proxies() {
+        // `[registries.sources] go` takes precedence over the GOPROXY of the environment
+        command.env("GOPROXY", proxies);
+    }
+    let output = command.output();
+    let output = match output {
+        Ok(output) => output,
+        Err(err) => {
+            log_error("Failed to run go mod download", &err);
+            return None;
+        }
+    };
+
+    let info: serde_json::Value = serde_json::from_slice(&output.stdout).ok()?;
+    if let Some(error) = info.get("Error").and_then(|e| e.as_str()) {
+        log(
+            LogLevel::Warn,
+            &format!("go mod download failed for {module}@{version}: {error}"),
+        );
+        return None;
+    }
+    info.get("Dir")
+        .and_then(|dir| dir.as_str())
+        .map(PathBuf::from)
+}
+
+/// Read the license of a module version from its zip on the module proxy
+///
+/// The zip is checked against the checksum database unless `GOSUMDB=off` or the
+/// module matches `GONOSUMDB`, `GONOSUMCHECK` or `GOPRIVATE`, and the license
+/// files at its root are classified like those of the module cache.
+fn fetch_license_from_module_proxy(module: &str, version: &str) -> Option<(String, Option<f32>)> {
+    // Later sources of `[registries.sources] go` are tried by the registry client
+    let proxies = match registry::go_proxy_url() {
+        Some(url) => vec![url],
+        None => go_env().proxies.clone(),
+    };
+    let path = format!(
+        "/{}/@v/{}.zip",
+        escape_go_module_path(module),
+        escape_go_module_path(version)
+    );
+
+    let zip = proxies.iter().find_map(|proxy| {
+        let url = format!("{proxy}{path}");
+        log(LogLevel::Info, &format!("Downloading module zip {url}"));
+        match registry::get(Registry::GoProxy, &url) {
+            Ok(response) if response.status().is_success() => response.bytes().ok(),
+            Ok(response) => {
+                log(
+                    LogLevel::Warn,
+                    &format!("{url} returned {}", response.status()),
+                );
+                None
+            }
+            Err(err) => {
+                log_error(&format!("Failed to download {url}"), &err);
+                None
+            }
+        }
+    })?;
+
+    let files = read_zip(&zip, MAX_MODULE_ZIP_SIZE)?;
+    if !verify_module_zip(module, version, &files) {
+        return None;
+    }
+
+    // Files in a module zip are all under `<module>@<version>/`
+    let prefix = format!("{module}@{version}/");
+    let dir = tempfile::tempdir().ok()?;
+    for (name, content) in &files {
+        let Some(file_name) = name.strip_prefix(&prefix) else {
+            continue;
+        };
+        if file_name.contains('/') || !is_license_file_name(file_name) {
+            continue;
+        }
+        fs::write(dir.path().join(file_name), content).ok()?;
+    }
+    read_license_from_dir(dir.path())
+}
+
+/// Whether a file at the root of a module holds its license
+fn is_license_file_name(file_name: &str) -> bool {
+    let upper = file_name.to_uppercase();
+    ["LICENSE", "LICENCE", "COPYING", "UNLICENSE"]
+        .iter()
+        .any(|name| upper.starts_with(name))
+}
+
+/// Check a module zip against the `h1:` hash of the checksum database
+///
+/// Always passes for modules the checksum database isn't asked about.
+fn verify_module_zip(module: &str, version: &str, files: &[(String, Vec<u8>)]) -> bool {
+    let env = go_env();
+    let Some(sumdb) = &env.sumdb else {
+        return true;
+    };
+    if env
+        .nosumdb_patterns
+        .iter()
+        .any(|pattern| matches_go_private_pattern(pattern, module))
+    {
+        return true;
+    }
+
+    let url = format!(
+        "{sumdb}/lookup/{}@{}",
+        escape_go_module_path(module),
+        escape_go_module_path(version)
+    );
+    let expected = registry::get(Registry::GoSumDb, &url)
+        .ok()
+        .filter(|response| response.status().is_success())
+        .and_then(|response| response.text().ok())
+        .and_then(|record| sumdb_hash(&record, module, version));
+    let Some(expected) = expected else {
+        log(
+            LogLevel::Warn,
+            &format!("No checksum for {module}@{version} in {sumdb}, not using its zip"),
+        );
+        return false;
+    };
+
+    let actual = module_zip_hash(files);
+    if actual != expected {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Checksum mismatch for {module}@{version}: the zip hashes to {actual}, {sumdb} has {expected}"
+            ),
+        );
+        return false;
+    }
+    true
+}
+
+/// The `h1:` hash of a module zip in a checksum database record
+fn sumdb_hash(record: &str, module: &str, version: &str) -> Option<String> {
+    record.lines().find_map(|line| {
+        let mut parts = line.split_whitespace();
+        match (parts.next(), parts.next(), parts.next()) {
+            (Some(name), Some(v), Some(hash))
+                if name == module && v == version && hash.starts_with("h1:") =>
+            {
+                Some(hash.to_string())
+            }
+            _ => None,
+        }
+    })
+}
+
+/// The `h1:` hash of the files of a module zip, as recorded in go.sum
+///
+/// The base64 SHA-256 of a summary with one `<sha256>  <name>` line per file,
+/// sorted by name.
+fn module_zip_hash(files: &[(String, Vec<u8>)]) -> String {
+    let mut files: Vec<_> = files.iter().collect();
+    files.sort_by(|a, b| a.0.cmp(&b.0));
+    let summary: String = files
+        .iter()
+        .map(|(name, content)| format!("{:x}  {name}\n", Sha256::digest(content)))
+        .collect();
+    let summary = Sha256::digest(summary.as_bytes());
+    format!("h1:{}", encode_base64(&summary))
+}
+
+/// Largest total size of the files of a module zip, as in the go command
+const MAX_MODULE_ZIP_SIZE: u64 = 500 << 20;
+
+/// Read the files of a module zip, leaving out directories
+///
+/// Gives up on zips whose files add up to more than `max_size` bytes. Each
+/// file is cut off at what is left of that budget while it is inflated, so an
+/// entry claiming a small size can't blow up before it is hashed.
+fn read_zip(data: &[u8], max_size: u64) -> Option<Vec<(String, Vec<u8>)>> {
+    let mut archive = match ZipArchive::new(Cursor::new(data)) {
+        Ok(archive) => archive,
+        Err(err) => {
+            log(LogLevel::Warn, &format!("Invalid module zip: {err}"));
+            return None;
+        }
+    };
+
+    let mut remaining = max_size;
+    let mut files = Vec::new();
+    for index in 0..archive.len() {
+        let mut file = match archive.by_index(index) {
+            Ok(file) => file,
+            Err(err) => {
+                log(LogLevel::Warn, &format!("Invalid module zip: {err}"));
+                return None;
+            }
+        };
+        if file.is_dir() {
+            continue;
+        }
+        let name = file.name().to_string();
+        let too_large = || {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Module zip is larger than {max_size} bytes unzipped at {name}, not using it"
+                ),
+            );
+        };
+        if file.size() > remaining {
+            too_large();
+            return None;
+        }
+
+        let mut content = Vec::new();
+        if let Err(err) = file.by_ref().take(remaining + 1).read_to_end(&mut content) {
+            log(
+                LogLevel::Warn,
+                &format!("Failed to read {name} from module zip: {err}"),
+            );
+            return None;
+        }
+        let size = content.len() as u64;
+        if size > remaining {
+            too_large();
+            return None;
+        }
+        remaining -= size;
+        files.push((name, content));
+    }
+    Some(files)
+}
+
+/// Commit of a pseudo-version such as `v0.0.0-20210101000000-abcdef123456`
+///
+/// Covers all three forms: `vX.0.0-<time>-<rev>`, `vX.Y.Z-pre.0.<time>-<rev>`
+/// and `vX.Y.Z-0.<time>-<rev>`, with or without `+incompatible`.
+fn pseudo_version_revision(version: &str) -> Option<&str> {
+    let version = version.trim_end_matches("+incompatible");
+    let (rest, revision) = version.rsplit_once('-')?;
+    let timestamp = rest.rsplit(['-', '.']).next()?;
+
+    let is_revision = revision.len() == 12 && revision.bytes().all(|b| b.is_ascii_hexdigit());
+    let is_timestamp = timestamp.len() == 14 && timestamp.bytes().all(|b| b.is_ascii_digit());
+    (version.starts_with('v') && is_revision && is_timestamp).then_some(revision)
+}
+
+/// GitHub repository hosting a module, for modules served straight from GitHub
+///
+/// `golang.org/x/...` modules are mirrored on GitHub under the `golang` organisation.
+fn go_module_github_repository(module: &str) -> Option<String> {
+    let mut parts = module.split('/');
+    match (parts.next()?, parts.next()?) {
+        ("github.com", owner) => Some(format!("https://github.com/{owner}/{}", parts.next()?)),
+        ("golang.org", "x") => Some(format!("https://github.com/golang/{}", parts.next()?)),
+        _ => None,
     }
+}
 
-    fetch_license_from_pkg_go_dev(&name)
+/// Classify the license file of a module's repository at a commit
+fn fetch_license_at_revision(module: &str, revision: &str) -> Option<(String, f32)> {
+    let repository = go_module_github_repository(module)?;
+    log(
+        LogLevel::Info,
+        &format!("Resolving pseudo-version of {module} to commit {revision}"),
+    );
+    fetch_repository_license(&repository, revision)
 }
 
 fn get_license_from_local_go_mod(package_name: &str) -> Option<String> {
@@ -465,7 +1395,10 @@ fn get_license_from_local_go_mod(package_name: &str) -> Option<String> {
     None
 }
 
-fn get_license_from_go_module_cache(package_name: &str, version: &str) -> Option<String> {
+fn get_license_from_go_module_cache(
+    package_name: &str,
+    version: &str,
+) -> Option<(String, Option<f32>)> {
     let module_cache = get_gomodcache_path()?;
     let exact_path = build_module_cache_path(&module_cache, package_name, version);
     if let Some(license) = read_license_from_dir(&exact_path) {
@@ -474,6 +1407,12 @@ fn get_license_from_go_module_cache(package_name: &str, version: &str) -> Option
     find_license_in_any_version(&module_cache, package_name)
 }
 
+/// Directory of a module version in the local module cache, if downloaded
+pub fn module_cache_dir(package_name: &str, version: &str) -> Option<PathBuf> {
+    let dir = build_module_cache_path(&get_gomodcache_path()?, package_name, version);
+    dir.is_dir().then_some(dir)
+}
+
 fn get_gomodcache_path() -> Option<PathBuf> {
     if let Ok(output) = Command::new("go").args(["env", "GOMODCACHE"]).output() {
         if output.status.success() {
@@ -520,11 +1459,16 @@ fn build_module_cache_path(root: &Path, module: &str, version: &str) -> PathBuf
     root.join(format!("{escaped}@{version}"))
 }
 
-fn read_license_from_dir(dir: &Path) -> Option<String> {
+/// Read a module's license from its directory, preferring full text classification
+fn read_license_from_dir(dir: &Path) -> Option<(String, Option<f32>)> {
     if !dir.exists() {
         return None;
     }
 
+    if let Some(detected) = detect_license_in_dir(dir) {
+        return Some((detected.license, Some(detected.confidence)));
+    }
+
     let license_files = [
         "LICENSE",
         "LICENSE.txt",
@@ -537,7 +1481,7 @@ fn read_license_from_dir(dir: &Path) -> Option<String> {
         if license_path.exists() {
             if let Ok(content) = fs::read_to_string(&license_path) {
                 if let Some(license) = detect_license_from_content(&content) {
-                    return Some(license);
+                    return Some((license, None));
                 }
             }
         }
@@ -545,7 +1489,7 @@ fn read_license_from_dir(dir: &Path) -> Option<String> {
     None
 }
 
-fn find_license_in_any_version(root: &Path, module: &str) -> Option<String> {
+fn find_license_in_any_version(root: &Path, module: &str) -> Option<(String, Option<f32>)> {
     let escaped = escape_go_module_path(module);
     let prefix = format!("{escaped}@");
     if let Ok(entries) = fs::read_dir(root) {
@@ -586,32 +1530,21 @@ fn detect_license_from_content(content: &str) -> Option<String> {
     None
 }
 
-fn fetch_license_from_pkg_go_dev(name: &str) -> String {
-    let api_url = format!("https://pkg.go.dev/{name}?tab=licenses");
+fn fetch_license_from_pkg_go_dev(name: &str, version: &str) -> String {
+    // Licenses can change between versions, so ask for the one in use when it is known
+    let api_url = if version.starts_with('v') {
+        format!("https://pkg.go.dev/{name}@{version}?tab=licenses")
+    } else {
+        format!("https://pkg.go.dev/{name}?tab=licenses")
+    };
     log(
         LogLevel::Info,
         &format!("Fetching license from Go Package Index: {api_url}"),
     );
 
-    let client = match Client::builder()
-        .user_agent("feluda.anirudha.dev/1")
-        .connect_timeout(Duration::from_secs(60))
-        .timeout(Duration::from_secs(10))
-        .build()
-    {
-        Ok(client) => client,
-        Err(err) => {
-            log_error("Failed to build HTTP client", &err);
-            return "Unknown".into();
-        }
-    };
-
-    let mut attempts = 0;
-    let max_attempts = 7; // Retry max 7 times. Thala for a reason 🙌
-    let wait_time = 12;
-
-    while attempts < max_attempts {
-        let response = client
+    // 429 responses are retried with backoff by the registry client
+    let response = registry::send(Registry::PkgGoDev, |client| {
+        client
             .get(&api_url)
             .header(
                 "User-Agent",
@@ -622,69 +1555,51 @@ fn fetch_license_from_pkg_go_dev(name: &str) -> String {
                 "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
             )
             .header("Referer", "https://pkg.go.dev/")
-            .send();
+    });
 
-        match response {
-            Ok(response) => {
-                let status = response.status();
-                log(
-                    LogLevel::Info,
-                    &format!("Go Package Index API response status: {status}"),
-                );
-
-                if status.as_u16() == 429 {
-                    log(
-                        LogLevel::Warn,
-                        &format!(
-                            "Received 429 Too Many Requests, retrying... (attempt {}/{})",
-                            attempts + 1,
-                            max_attempts
-                        ),
-                    );
-                    sleep(Duration::from_secs(wait_time));
-                    attempts += 1;
-                    continue;
-                }
+    match response {
+        Ok(response) => {
+            let status = response.status();
+            log(
+                LogLevel::Info,
+                &format!("Go Package Index API response status: {status}"),
+            );
 
-                if status.is_success() {
-                    match response.text() {
-                        Ok(html_content) => {
-                            if let Some(license) = extract_license_from_html(&html_content) {
-                                log(
-                                    LogLevel::Info,
-                                    &format!("License found for {name}: {license}"),
-                                );
-                                return license;
-                            } else {
-                                log(
-                                    LogLevel::Warn,
-                                    &format!("No license found in HTML for {name}"),
-                                );
-                            }
-                        }
-                        Err(err) => {
-                            log_error(&format!("Failed to extract HTML content for {name}"), &err);
+            if status.is_success() {
+                match response.text() {
+                    Ok(html_content) => {
+                        if let Some(license) = extract_license_from_html(&html_content) {
+                            log(
+                                LogLevel::Info,
+                                &format!("License found for {name}: {license}"),
+                            );
+                            return license;
+                        } else {
+                            log(
+                                LogLevel::Warn,
+                                &format!("No license found in HTML for {name}"),
+                            );
                         }
                     }
-                } else {
-                    log(
-                        LogLevel::Error,
-                        &format!("Unexpected HTTP status: {status} for {name}"),
-                    );
+                    Err(err) => {
+                        log_error(&format!("Failed to extract HTML content for {name}"), &err);
+                    }
                 }
-
-                break;
-            }
-            Err(err) => {
-                log_error(&format!("Failed to fetch metadata for {name}"), &err);
-                break;
+            } else {
+                log(
+                    LogLevel::Error,
+                    &format!("Unexpected HTTP status: {status} for {name}"),
+                );
             }
         }
+        Err(err) => {
+            log_error(&format!("Failed to fetch metadata for {name}"), &err);
+        }
     }
 
     log(
         LogLevel::Warn,
-        &format!("Unable to determine license for {name} after {attempts} attempts"),
+        &format!("Unable to determine license for {name}"),
     );
     "Unknown".into()
 }
@@ -828,8 +1743,10 @@ mod tests {
     #[test]
     fn test_fetch_license_for_go_dependency_error_handling() {
         // Test with invalid package name
-        let result = fetch_license_for_go_dependency("invalid/package/name", "v1.0.0");
+        let (result, confidence) =
+            fetch_license_for_go_dependency("invalid/package/name", "v1.0.0");
         assert_eq!(result, "Unknown");
+        assert_eq!(confidence, None);
     }
 
     #[test]
@@ -920,8 +1837,10 @@ github.com/level2@v1.0.0 github.com/level3@v1.0.0"#;
         ];
 
         // This should fall back to direct dependencies when go mod graph fails
-        let result = resolve_go_dependencies("/nonexistent/go.mod", &direct_deps, 5);
+        let (result, graph_output) =
+            resolve_go_dependencies("/nonexistent/go.mod", &direct_deps, 5);
 
+        assert_eq!(graph_output, None);
         assert_eq!(result.len(), 2);
         assert_eq!(
             result[0],
@@ -975,4 +1894,333 @@ github.com/level2@v1.0.0 github.com/level3@v1.0.0"#;
         assert_eq!(name, "github.com/user/repo");
         assert_eq!(version, "v1.2.3");
     }
+
+    #[test]
+    fn test_parse_go_mod_graph_output_selects_max_version() {
+        let graph_output = r#"github.com/myproject github.com/a@v1.2.0
+github.com/myproject github.com/b@v1.0.0
+github.com/b@v1.0.0 github.com/a@v1.10.0
+github.com/b@v1.0.0 github.com/c@v0.0.0-20230101000000-abcdef123456
+github.com/a@v1.2.0 github.com/c@v0.1.0"#;
+
+        let deps: HashMap<String, String> = parse_go_mod_graph_output(graph_output, 5)
+            .into_iter()
+            .collect();
+
+        assert_eq!(deps.get("github.com/a"), Some(&"v1.10.0".to_string()));
+        assert_eq!(deps.get("github.com/c"), Some(&"v0.1.0".to_string()));
+        // The main module is not a dependency of itself
+        assert!(!deps.contains_key("github.com/myproject"));
+    }
+
+    #[test]
+    fn test_go_dependency_graph() {
+        let graph_output = r#"github.com/myproject github.com/a@v1.2.0
+github.com/myproject github.com/b@v1.0.0
+github.com/b@v1.0.0 github.com/a@v1.10.0
+github.com/b@v1.0.0 github.com/c@v0.1.0
+github.com/a@v1.2.0 github.com/e@v1.0.0
+github.com/a@v1.10.0 github.com/e@v1.1.0"#;
+        let modules = parse_go_mod_graph_output(graph_output, 5);
+        let directives = parse_go_mod_directives("replace github.com/c => github.com/d v2.0.0\n");
+
+        let graph = go_dependency_graph(graph_output, &modules, &directives);
+        let paths = graph.paths();
+        assert_eq!(paths["github.com/a@v1.10.0"], vec!["github.com/a@v1.10.0"]);
+        // Replaced modules are reported under their replacement
+        assert_eq!(
+            paths["github.com/d@v2.0.0"],
+            vec!["github.com/b@v1.0.0", "github.com/d@v2.0.0"]
+        );
+        assert_eq!(
+            paths["github.com/e@v1.1.0"],
+            vec!["github.com/a@v1.10.0", "github.com/e@v1.1.0"]
+        );
+        // Only the requirements of the selected version of a count
+        assert_eq!(
+            graph.requires()["github.com/a@v1.10.0"],
+            vec!["github.com/e@v1.1.0"]
+        );
+    }
+
+    #[test]
+    fn test_compare_go_versions() {
+        use std::cmp::Ordering;
+
+        assert_eq!(compare_go_versions("v1.10.0", "v1.9.0"), Ordering::Greater);
+        assert_eq!(
+            compare_go_versions("v0.0.0-20230101000000-abcdef123456", "v0.1.0"),
+            Ordering::Less
+        );
+        assert_eq!(
+            compare_go_versions("v2.0.0+incompatible", "v1.5.0"),
+            Ordering::Greater
+        );
+        assert_eq!(compare_go_versions("v1.0.0", "v1.0.0"), Ordering::Equal);
+    }
+
+    #[test]
+    fn test_parse_go_sum() {
+        let go_sum = r#"github.com/spf13/cobra v1.8.0 h1:7aJaZx1B85qltLMc546zn58BxxfZdR/W22ej9CFoEf0=
+github.com/spf13/cobra v1.8.0/go.mod h1:WXLWApfZ71AjXPya3WOlMsY9yMs7YeiHhFVlvLyhcho=
+github.com/spf13/pflag v1.0.3/go.mod h1:DYY7MBk1bdzusC3SYhjObp+wFpr4gzcvqqNjLnInEg4=
+github.com/spf13/pflag v1.0.5/go.mod h1:McXfInJRrz4CZXVZOBLb0bTZqETkiAhM9Iw0y3An2Bg=
+"#;
+
+        let deps = parse_go_sum(go_sum);
+        assert_eq!(
+            deps,
+            vec![
+                ("github.com/spf13/cobra".to_string(), "v1.8.0".to_string()),
+                ("github.com/spf13/pflag".to_string(), "v1.0.5".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_resolve_go_dependencies_from_go_sum() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let go_mod = temp_dir.path().join("go.mod");
+        fs::write(&go_mod, "module example.com/app\n").unwrap();
+        fs::write(
+            temp_dir.path().join("go.sum"),
+            "github.com/davecgh/go-spew v1.1.1/go.mod h1:J7Y8YcW2NihsgmVo/mv3lAwl/skON4iLHjSsI+c5H38=\n",
+        )
+        .unwrap();
+
+        // go.mod has no requirements, so go mod graph yields nothing and go.sum is used
+        let (result, _) = resolve_go_dependencies(go_mod.to_str().unwrap(), &[], 5);
+        assert!(result.contains(&(
+            "github.com/davecgh/go-spew".to_string(),
+            "v1.1.1".to_string()
+        )));
+    }
+
+    #[test]
+    fn test_pseudo_version_revision() {
+        assert_eq!(
+            pseudo_version_revision("v0.0.0-20210101000000-abcdef123456"),
+            Some("abcdef123456")
+        );
+        assert_eq!(
+            pseudo_version_revision("v1.2.4-0.20230518184743-7afd39499903"),
+            Some("7afd39499903")
+        );
+        assert_eq!(
+            pseudo_version_revision("v2.0.0-beta.1.0.20191204190536-9bdfabe68543+incompatible"),
+            Some("9bdfabe68543")
+        );
+        assert_eq!(pseudo_version_revision("v1.9.1"), None);
+        assert_eq!(pseudo_version_revision("v1.0.0-rc.1"), None);
+        assert_eq!(pseudo_version_revision("../local"), None);
+    }
+
+    #[test]
+    fn test_matches_go_private_pattern() {
+        assert!(matches_go_private_pattern(
+            "github.com/acme",
+            "github.com/acme/billing"
+        ));
+        assert!(matches_go_private_pattern(
+            "*.corp.example.com",
+            "git.corp.example.com/platform/auth"
+        ));
+        assert!(matches_go_private_pattern(
+            "github.com/acme/svc-?",
+            "github.com/acme/svc-a/v2"
+        ));
+        assert!(!matches_go_private_pattern(
+            "github.com/acme",
+            "github.com/acme-labs/tool"
+        ));
+        assert!(!matches_go_private_pattern(
+            "github.com/acme/billing",
+            "github.com/acme"
+        ));
+    }
+
+    #[test]
+    fn test_parse_go_env() {
+        let values = |values: [&str; 6]| values.map(String::from);
+
+        let defaults = parse_go_env(&values(["", "", "", "", "", ""]));
+        assert_eq!(defaults.proxies, vec![GO_PROXY.to_string()]);
+        assert_eq!(defaults.sumdb.as_deref(), Some(GO_SUMDB));
+        assert!(!defaults.custom_proxy);
+
+        let env = parse_go_env(&values([
+            "github.com/acme",
+            "",
+            "https://goproxy.acme.dev/,direct|https://proxy.golang.org,off,https://unused.example",
+            "git.corp.example.com",
+            "github.com/vendored",
+            "sum.golang.google.cn https://sum.golang.google.cn/",
+        ]));
+        assert_eq!(env.private_patterns, vec!["github.com/acme"]);
+        assert!(env.custom_proxy);
+        assert_eq!(
+            env.proxies,
+            vec!["https://goproxy.acme.dev", "https://proxy.golang.org"]
+        );
+        assert_eq!(
+            env.nosumdb_patterns,
+            vec![
+                "github.com/acme",
+                "git.corp.example.com",
+                "github.com/vendored"
+            ]
+        );
+        assert_eq!(env.sumdb.as_deref(), Some("https://sum.golang.google.cn"));
+
+        let off = parse_go_env(&values(["", "", "off", "", "", "off"]));
+        assert!(off.proxies.is_empty());
+        assert_eq!(off.sumdb, None);
+    }
+
+    #[test]
+    fn test_read_module_zip() {
+        let mut zip = crate::spreadsheet::ZipWriter::new();
+        zip.add("example.com/mod@v1.0.0/go.mod", b"module example.com/mod\n")
+            .unwrap();
+        zip.add("example.com/mod@v1.0.0/LICENSE", b"MIT License")
+            .unwrap();
+        let zip = zip.finish();
+        let files = read_zip(&zip, MAX_MODULE_ZIP_SIZE).unwrap();
+        assert_eq!(
+            files,
+            vec![
+                (
+                    "example.com/mod@v1.0.0/go.mod".to_string(),
+                    b"module example.com/mod\n".to_vec()
+                ),
+                (
+                    "example.com/mod@v1.0.0/LICENSE".to_string(),
+                    b"MIT License".to_vec()
+                ),
+            ]
+        );
+
+        // The hash doesn't depend on the order of the entries
+        let hash = module_zip_hash(&files);
+        let reversed: Vec<_> = files.iter().rev().cloned().collect();
+        assert_eq!(module_zip_hash(&reversed), hash);
+        assert!(hash.starts_with("h1:") && hash.ends_with('='));
+        assert_eq!(hash.len(), 47);
+
+        assert!(is_license_file_name("LICENSE.md"));
+        assert!(is_license_file_name("COPYING"));
+        assert!(!is_license_file_name("go.mod"));
+        assert_eq!(read_zip(b"not a zip", MAX_MODULE_ZIP_SIZE), None);
+
+        // 34 bytes of files in all
+        assert!(read_zip(&zip, 34).is_some());
+        assert_eq!(read_zip(&zip, 33), None);
+    }
+
+    #[test]
+    fn test_sumdb_hash() {
+        let record = "1234567\n\
+            golang.org/x/text v0.3.0 h1:g61tztE5qeGQ89tm6NTjjM9VPIm088od1l6aSorWRWg=\n\
+            golang.org/x/text v0.3.0/go.mod h1:NqM8EUOU14njkJ3fqMW+pc6Ldnwhi/IjpwHt7yyuwOQ=\n\n\
+            go.sum database tree\n";
+        assert_eq!(
+            sumdb_hash(record, "golang.org/x/text", "v0.3.0").as_deref(),
+            Some("h1:g61tztE5qeGQ89tm6NTjjM9VPIm088od1l6aSorWRWg=")
+        );
+        assert_eq!(sumdb_hash(record, "golang.org/x/text", "v0.4.0"), None);
+    }
+
+    #[test]
+    fn test_go_module_github_repository() {
+        assert_eq!(
+            go_module_github_repository("github.com/gin-gonic/gin/v2").as_deref(),
+            Some("https://github.com/gin-gonic/gin")
+        );
+        assert_eq!(
+            go_module_github_repository("golang.org/x/sys").as_deref(),
+            Some("https://github.com/golang/sys")
+        );
+        assert_eq!(go_module_github_repository("github.com/owner"), None);
+        assert_eq!(go_module_github_repository("gopkg.in/yaml.v3"), None);
+    }
+
+    #[test]
+    fn test_parse_go_mod_directives() {
+        let content = r#"module example.com/app
+
+require github.com/old/lib v1.0.0
+
+replace github.com/old/lib => github.com/new/lib v1.2.0
+
+replace (
+    github.com/pinned/lib v0.3.0 => github.com/fork/lib v0.3.1 // security fix
+    github.com/internal/lib => ../internal
+)
+
+exclude github.com/bad/lib v1.1.0
+exclude (
+    github.com/bad/lib v1.1.1
+)
+"#;
+
+        let directives = parse_go_mod_directives(content);
+        assert_eq!(directives.replaces.len(), 3);
+        assert_eq!(
+            directives.replaces[0],
+            GoReplace {
+                old_name: "github.com/old/lib".to_string(),
+                old_version: None,
+                new_name: "github.com/new/lib".to_string(),
+                new_version: Some("v1.2.0".to_string()),
+            }
+        );
+        assert_eq!(
+            directives.replaces[1].old_version,
+            Some("v0.3.0".to_string())
+        );
+        assert_eq!(directives.replaces[2].new_name, "../internal");
+        assert_eq!(directives.replaces[2].new_version, None);
+        assert!(directives
+            .excludes
+            .contains(&("github.com/bad/lib".to_string(), "v1.1.0".to_string())));
+        assert!(directives
+            .excludes
+            .contains(&("github.com/bad/lib".to_string(), "v1.1.1".to_string())));
+    }
+
+    #[test]
+    fn test_apply_go_mod_directives() {
+        let directives = parse_go_mod_directives(
+            r#"replace github.com/old/lib => github.com/new/lib v1.2.0
+replace github.com/pinned/lib v0.3.0 => github.com/fork/lib v0.3.1
+replace github.com/internal/lib => ../internal
+exclude github.com/bad/lib v1.1.0
+"#,
+        );
+        let deps = vec![
+            ("github.com/old/lib".to_string(), "v1.0.0".to_string()),
+            ("github.com/pinned/lib".to_string(), "v0.3.0".to_string()),
+            ("github.com/pinned/lib".to_string(), "v0.4.0".to_string()),
+            ("github.com/internal/lib".to_string(), "v0.0.0".to_string()),
+            ("github.com/bad/lib".to_string(), "v1.1.0".to_string()),
+            ("github.com/good/lib".to_string(), "v1.0.0".to_string()),
+        ];
+
+        let result = apply_go_mod_directives(deps, &directives);
+        assert_eq!(
+            result,
+            vec![
+                ("github.com/new/lib".to_string(), "v1.2.0".to_string()),
+                ("github.com/fork/lib".to_string(), "v0.3.1".to_string()),
+                ("github.com/pinned/lib".to_string(), "v0.4.0".to_string()),
+                (
+                    "github.com/internal/lib".to_string(),
+                    "../internal".to_string()
+                ),
+                ("github.com/good/lib".to_string(), "v1.0.0".to_string()),
+            ]
+        );
+        assert!(is_local_go_path("../internal"));
+        assert!(!is_local_go_path("v1.0.0"));
+    }
 }
@@ -0,0 +1,409 @@
+//! Guix manifests
+//!
+//! `manifest.scm` lists the packages of a profile, usually with
+//! `specifications->manifest`. A `guix.scm` defines the project's own
+//! package, whose inputs `guix shell -D -f guix.scm --export-manifest` lists
+//! the same way. Guix has no registry of its own, so versions and licenses are
+//! read with `guix show` from the channels of the host.
+
+use rayon::prelude::*;
+use regex::Regex;
+use std::collections::{BTreeMap, HashMap};
+use std::fs;
+use std::path::Path;
+use std::process::Command;
+use std::sync::OnceLock;
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::languages::{license_info, GUIX_PATHS};
+use crate::licenses::{fetch_licenses_from_github, LicenseInfo};
+
+/// SPDX identifiers of the license names of `(guix licenses)`
+const GUIX_LICENSES: [(&str, &str); 36] = [
+    ("Expat", "MIT"),
+    ("X11", "X11"),
+    ("ASL 2.0", "Apache-2.0"),
+    ("ISC", "ISC"),
+    ("Zlib", "Zlib"),
+    ("Modified BSD", "BSD-3-Clause"),
+    ("FreeBSD", "BSD-2-Clause"),
+    ("Original BSD", "BSD-4-Clause"),
+    ("Boost 1.0", "BSL-1.0"),
+    ("CC0", "CC0-1.0"),
+    ("Unlicense", "Unlicense"),
+    ("WTFPL 2", "WTFPL"),
+    ("Public Domain", "LicenseRef-PublicDomain"),
+    ("Python Software Foundation License", "PSF-2.0"),
+    ("Artistic License 2.0", "Artistic-2.0"),
+    ("OpenSSL", "OpenSSL"),
+    ("MPL 1.1", "MPL-1.1"),
+    ("MPL 2.0", "MPL-2.0"),
+    ("EPL 1.0", "EPL-1.0"),
+    ("EPL 2.0", "EPL-2.0"),
+    ("CDDL 1.0", "CDDL-1.0"),
+    ("GPL 2", "GPL-2.0-only"),
+    ("GPL 2+", "GPL-2.0-or-later"),
+    ("GPL 3", "GPL-3.0-only"),
+    ("GPL 3+", "GPL-3.0-or-later"),
+    ("LGPL 2.0", "LGPL-2.0-only"),
+    ("LGPL 2.0+", "LGPL-2.0-or-later"),
+    ("LGPL 2.1", "LGPL-2.1-only"),
+    ("LGPL 2.1+", "LGPL-2.1-or-later"),
+    ("LGPL 3", "LGPL-3.0-only"),
+    ("LGPL 3+", "LGPL-3.0-or-later"),
+    ("AGPL 3", "AGPL-3.0-only"),
+    ("AGPL 3+", "AGPL-3.0-or-later"),
+    ("GFDL 1.3+", "GFDL-1.3-or-later"),
+    ("FDL 1.3+", "GFDL-1.3-or-later"),
+    ("non-copyleft", "LicenseRef-Guix-non-copyleft"),
+];
+
+/// A package of a manifest, from a specification such as `openssl@3:out`
+#[derive(Debug, Clone, PartialEq)]
+pub struct GuixPackage {
+    pub name: String,
+    /// Version prefix of the specification, if it has one
+    pub version: Option<String>,
+}
+
+/// The file dependencies are reported from, in order of preference
+pub fn find_manifest(project_dir: &Path) -> Option<String> {
+    GUIX_PATHS
+        .iter()
+        .find(|file| project_dir.join(file).is_file())
+        .map(|file| file.to_string())
+}
+
+pub fn analyze_guix_licenses(
+    project_dir: &Path,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing Guix dependencies in: {}", project_dir.display()),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let manifest = match find_manifest(project_dir).as_deref() {
+        Some("manifest.scm") => fs::read_to_string(project_dir.join("manifest.scm"))
+            .map_err(|err| log_error("Failed to read manifest.scm", &err))
+            .ok(),
+        Some(_) if !no_local => export_manifest(project_dir),
+        _ => None,
+    };
+    let packages = manifest
+        .map(|manifest| parse_specifications(&manifest))
+        .unwrap_or_default();
+    log(
+        LogLevel::Info,
+        &format!("Found {} Guix packages", packages.len()),
+    );
+    log_debug("Guix packages", &packages);
+
+    let licenses: Vec<LicenseInfo> = packages
+        .into_par_iter()
+        .map(|package| {
+            let requested = package.version.clone().unwrap_or_default();
+            let (version, license) = if no_local {
+                (None, None)
+            } else {
+                time_dependency("guix", &package.name, &requested, || guix_show(&package))
+            };
+            let version = version
+                .or(package.version.clone())
+                .unwrap_or_else(|| "unknown".to_string());
+            license_info(
+                package.name,
+                version,
+                license,
+                None,
+                &known_licenses,
+                config,
+            )
+        })
+        .collect();
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} Guix dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+/// The inputs of the package defined in `guix.scm`, as a manifest
+fn export_manifest(project_dir: &Path) -> Option<String> {
+    let output = Command::new("guix")
+        .args(["shell", "-D", "-f", "guix.scm", "--export-manifest"])
+        .current_dir(project_dir)
+        .output();
+    match output {
+        Ok(output) if output.status.success() => {
+            Some(String::from_utf8_lossy(&output.stdout).to_string())
+        }
+        Ok(output) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Failed to list the inputs of guix.scm: {}",
+                    String::from_utf8_lossy(&output.stderr).trim()
+                ),
+            );
+            None
+        }
+        Err(_) => {
+            log(
+                LogLevel::Warn,
+                "guix is not installed, the inputs of guix.scm can't be listed",
+            );
+            None
+        }
+    }
+}
+
+/// Packages of the `specifications->manifest` lists and `specification->package` calls of a manifest
+///
+/// The output of a specification, as in `glib:bin`, is dropped: outputs of a
+/// package share its license.
+fn parse_specifications(manifest: &str) -> Vec<GuixPackage> {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    let pattern = PATTERN.get_or_init(|| {
+        Regex::new(r#"specification->package(?:\+output)?\s+"([^"]+)""#)
+            .expect("valid specification pattern")
+    });
+
+    // Comments start with `;` outside of strings
+    let code: String = manifest
+        .lines()
+        .map(|line| {
+            let mut in_string = false;
+            for (index, c) in line.char_indices() {
+                match c {
+                    '"' => in_string = !in_string,
+                    ';' if !in_string => return &line[..index],
+                    _ => {}
+                }
+            }
+            line
+        })
+        .collect::<Vec<_>>()
+        .join("\n");
+
+    let mut specifications: Vec<String> = Vec::new();
+    let mut rest = code.as_str();
+    while let Some(start) = rest.find("specifications->manifest") {
+        rest = &rest[start + "specifications->manifest".len()..];
+        let Some(open) = rest.find('(') else {
+            break;
+        };
+        let mut depth = 0;
+        let mut end = rest.len();
+        for (index, c) in rest[open..].char_indices() {
+            match c {
+                '(' => depth += 1,
+                ')' => {
+                    depth -= 1;
+                    if depth == 0 {
+                        end = open + index;
+                        break;
+                    }
+                }
+                _ => {}
+            }
+        }
+        specifications.extend(
+            rest[open..end]
+                .split('"')
+                .skip(1)
+                .step_by(2)
+                .map(str::to_string),
+        );
+        rest = &rest[end..];
+    }
+    specifications.extend(
+        pattern
+            .captures_iter(&code)
+            .map(|captures| captures[1].to_string()),
+    );
+
+    let mut packages: BTreeMap<String, GuixPackage> = BTreeMap::new();
+    for specification in specifications {
+        let specification = specification
+            .split_once(':')
+            .map_or(specification.as_str(), |(package, _)| package);
+        let (name, version) = match specification.split_once('@') {
+            Some((name, version)) => (name, Some(version.to_string())),
+            None => (specification, None),
+        };
+        if name.trim().is_empty() {
+            continue;
+        }
+        packages.entry(name.to_string()).or_insert(GuixPackage {
+            name: name.to_string(),
+            version,
+        });
+    }
+    packages.into_values().collect()
+}
+
+/// Version and license of a package, read with `guix show`
+fn guix_show(package: &GuixPackage) -> (Option<String>, Option<String>) {
+    let specification = match &package.version {
+        Some(version) => format!("{}@{version}", package.name),
+        None => package.name.clone(),
+    };
+    match Command::new("guix").args(["show", &specification]).output() {
+        Ok(output) if output.status.success() => {
+            parse_guix_show(&String::from_utf8_lossy(&output.stdout))
+        }
+        Ok(output) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "guix show {specification} failed: {}",
+                    String::from_utf8_lossy(&output.stderr).trim()
+                ),
+            );
+            (None, None)
+        }
+        Err(_) => {
+            log(
+                LogLevel::Warn,
+                &format!("guix is not installed, no license for {specification}"),
+            );
+            (None, None)
+        }
+    }
+}
+
+/// Version and license of the first record `guix show` prints, the newest version
+fn parse_guix_show(output: &str) -> (Option<String>, Option<String>) {
+    let record = output.split("\n\n").next().unwrap_or_default();
+    let field = |name: &str| {
+        record.lines().find_map(|line| {
+            line.strip_prefix(name)
+                .and_then(|value| value.strip_prefix(':'))
+                .map(|value| value.trim().to_string())
+                .filter(|value| !value.is_empty())
+        })
+    };
+    (
+        field("version"),
+        field("license").map(|license| guix_license_expression(&license)),
+    )
+}
+
+/// SPDX expression of a `license:` field, where several licenses all apply
+fn guix_license_expression(license: &str) -> String {
+    let mut ids: Vec<String> = Vec::new();
+    for name in license
+        .split(',')
+        .map(str::trim)
+        .filter(|name| !name.is_empty())
+    {
+        let id = GUIX_LICENSES
+            .iter()
+            .find(|(guix, _)| guix.eq_ignore_ascii_case(name))
+            .map(|(_, spdx)| spdx.to_string())
+            .unwrap_or_else(|| {
+                if name.contains(' ') {
+                    format!("LicenseRef-Guix-{}", name.replace(' ', "-"))
+                } else {
+                    name.to_string()
+                }
+            });
+        if !ids.contains(&id) {
+            ids.push(id);
+        }
+    }
+    ids.join(" AND ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_specifications() {
+        let manifest = r#";; What follows is a "manifest" equivalent to the command line you gave.
+(use-modules (guix profiles))
+
+(concatenate-manifests
+ (list (specifications->manifest
+        (list "openssl@3"
+              "glib:bin"   ; for gdbus-codegen
+              "python-requests"))
+       (packages->manifest
+        (list (specification->package "curl")))))
+"#;
+        assert_eq!(
+            parse_specifications(manifest),
+            vec![
+                GuixPackage {
+                    name: "curl".to_string(),
+                    version: None
+                },
+                GuixPackage {
+                    name: "glib".to_string(),
+                    version: None
+                },
+                GuixPackage {
+                    name: "openssl".to_string(),
+                    version: Some("3".to_string())
+                },
+                GuixPackage {
+                    name: "python-requests".to_string(),
+                    version: None
+                },
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_guix_show() {
+        let output = "name: openssl
+version: 3.0.8
+outputs:
++ out: everything
++ doc: documentation
+systems: x86_64-linux i686-linux
+dependencies: perl@5.36.0
+location: gnu/packages/tls.scm:410:2
+homepage: https://www.openssl.org/
+license: ASL 2.0
+synopsis: SSL/TLS implementation
+description: OpenSSL is an implementation of SSL/TLS.
+
+name: openssl
+version: 1.1.1u
+license: OpenSSL
+";
+        assert_eq!(
+            parse_guix_show(output),
+            (Some("3.0.8".to_string()), Some("Apache-2.0".to_string()))
+        );
+        assert_eq!(
+            guix_license_expression("GPL 3+, LGPL 2.1+, GPL 3+"),
+            "GPL-3.0-or-later AND LGPL-2.1-or-later"
+        );
+        assert_eq!(
+            guix_license_expression("Some Custom License"),
+            "LicenseRef-Guix-Some-Custom-License"
+        );
+        assert_eq!(parse_guix_show("name: hello\n"), (None, None));
+    }
+}
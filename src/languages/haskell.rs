@@ -0,0 +1,922 @@
+//! Haskell packages of Cabal and Stack projects
+//!
+//! `cabal.project.freeze` pins every package of the build plan. Stack pins its
+//! snapshot and the extra-deps in `stack.yaml.lock`; the packages the project
+//! takes from the snapshot are the ones its `.cabal` or `package.yaml` files
+//! depend on, at the version the snapshot lists. Licenses are read from the
+//! `.cabal` file of each release on Hackage.
+
+use rayon::prelude::*;
+use serde::Deserialize;
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::languages::{license_info, HASKELL_PATHS};
+use crate::licenses::{fetch_licenses_from_github, DependencyScope, LicenseInfo};
+use crate::registry::{self, Registry};
+use crate::repository_license::fetch_repository_license;
+
+/// SPDX identifiers of the license names of `cabal-version` 2.0 and older
+const LEGACY_LICENSES: [(&str, &str); 16] = [
+    ("BSD2", "BSD-2-Clause"),
+    ("BSD3", "BSD-3-Clause"),
+    ("BSD4", "BSD-4-Clause"),
+    ("MIT", "MIT"),
+    ("ISC", "ISC"),
+    ("MPL-2.0", "MPL-2.0"),
+    ("Apache", "Apache-2.0"),
+    ("Apache-2", "Apache-2.0"),
+    ("Apache-2.0", "Apache-2.0"),
+    ("GPL-2", "GPL-2.0-only"),
+    ("GPL-3", "GPL-3.0-only"),
+    ("LGPL-2.1", "LGPL-2.1-only"),
+    ("LGPL-3", "LGPL-3.0-only"),
+    ("AGPL-3", "AGPL-3.0-only"),
+    ("PublicDomain", "LicenseRef-PublicDomain"),
+    ("AllRightsReserved", "No License"),
+];
+
+/// Where a package comes from
+#[derive(Debug, Clone, PartialEq)]
+pub enum HaskellSource {
+    Hackage,
+    Git {
+        url: String,
+        commit: String,
+    },
+    /// A package that ships with GHC and isn't listed by the snapshot
+    Compiler,
+}
+
+/// A package of the build plan
+#[derive(Debug, Clone, PartialEq)]
+pub struct HaskellPackage {
+    pub name: String,
+    pub version: String,
+    pub source: HaskellSource,
+    pub scope: DependencyScope,
+}
+
+impl HaskellPackage {
+    fn new(name: impl Into<String>, version: impl Into<String>, source: HaskellSource) -> Self {
+        Self {
+            name: name.into(),
+            version: version.into(),
+            source,
+            scope: DependencyScope::Runtime,
+        }
+    }
+}
+
+/// `stack.yaml.lock`
+#[derive(Debug, Default, Deserialize)]
+struct StackLock {
+    #[serde(default)]
+    packages: Vec<LockedPackage>,
+    #[serde(default)]
+    snapshots: Vec<LockedPackage>,
+}
+
+#[derive(Debug, Default, Deserialize)]
+struct LockedPackage {
+    #[serde(default)]
+    completed: Completed,
+}
+
+/// The `completed` half of a lock entry, the pinned source
+#[derive(Debug, Default, Deserialize)]
+struct Completed {
+    hackage: Option<String>,
+    git: Option<String>,
+    commit: Option<String>,
+    name: Option<String>,
+    version: Option<String>,
+    url: Option<String>,
+}
+
+/// A Stackage snapshot, with the compiler at the top level in older snapshots
+#[derive(Debug, Default, Deserialize)]
+struct Snapshot {
+    #[serde(default)]
+    packages: Vec<Completed>,
+    resolver: Option<Resolver>,
+    compiler: Option<String>,
+}
+
+#[derive(Debug, Default, Deserialize)]
+struct Resolver {
+    compiler: Option<String>,
+}
+
+#[derive(Debug, Default, Deserialize)]
+struct StackConfig {
+    #[serde(default)]
+    packages: Vec<String>,
+}
+
+/// An hpack `package.yaml`, or one of its components
+#[derive(Debug, Default, Deserialize)]
+struct Hpack {
+    #[serde(default)]
+    name: String,
+    dependencies: Option<HpackDependencies>,
+    library: Option<Box<Hpack>>,
+    executable: Option<Box<Hpack>>,
+    #[serde(default, rename = "internal-libraries")]
+    internal_libraries: BTreeMap<String, Hpack>,
+    #[serde(default)]
+    executables: BTreeMap<String, Hpack>,
+    #[serde(default)]
+    tests: BTreeMap<String, Hpack>,
+    #[serde(default)]
+    benchmarks: BTreeMap<String, Hpack>,
+}
+
+/// hpack takes dependencies as a list, a map keyed by package or one string
+#[derive(Debug, Deserialize)]
+#[serde(untagged)]
+enum HpackDependencies {
+    List(Vec<String>),
+    Map(BTreeMap<String, serde_yaml::Value>),
+    One(String),
+}
+
+impl HpackDependencies {
+    fn names(&self) -> Vec<String> {
+        match self {
+            Self::List(items) => items.iter().flat_map(|item| build_depends(item)).collect(),
+            Self::Map(map) => map.keys().cloned().collect(),
+            Self::One(item) => build_depends(item),
+        }
+    }
+}
+
+/// The lockfile dependencies are read from, in order of preference
+pub fn find_manifest(project_dir: &Path) -> Option<String> {
+    HASKELL_PATHS
+        .iter()
+        .find(|file| project_dir.join(file).is_file())
+        .map(|file| file.to_string())
+}
+
+pub fn analyze_haskell_licenses(project_dir: &Path, config: &FeludaConfig) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!(
+            "Analyzing Haskell dependencies in: {}",
+            project_dir.display()
+        ),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let local = local_packages(project_dir);
+    let direct = direct_dependencies(&local);
+    log_debug("Direct Haskell dependencies", &direct);
+    let local_names: HashSet<&str> = local.iter().map(|package| package.name.as_str()).collect();
+
+    let packages = match find_manifest(project_dir).as_deref() {
+        Some("cabal.project.freeze") => {
+            read(&project_dir.join("cabal.project.freeze")).map(|content| {
+                parse_cabal_freeze(&content)
+                    .into_iter()
+                    .map(|(name, version)| {
+                        let mut package =
+                            HaskellPackage::new(name, version, HaskellSource::Hackage);
+                        // Test-only direct dependencies are in the plan when tests are enabled
+                        if let Some(scope) = direct.get(&package.name) {
+                            package.scope = *scope;
+                        }
+                        package
+                    })
+                    .collect()
+            })
+        }
+        Some(_) => read(&project_dir.join("stack.yaml.lock"))
+            .map(|content| stack_packages(&content, &direct)),
+        None => None,
+    }
+    .unwrap_or_default();
+
+    let packages: Vec<HaskellPackage> = packages
+        .into_iter()
+        .filter(|package| !local_names.contains(package.name.as_str()))
+        .filter(|package| config.dependencies.max_depth > 1 || direct.contains_key(&package.name))
+        .collect();
+    log(
+        LogLevel::Info,
+        &format!("Found {} Haskell packages", packages.len()),
+    );
+    log_debug("Haskell packages", &packages);
+
+    let licenses: Vec<LicenseInfo> = packages
+        .into_par_iter()
+        .map(|package| {
+            let (license, confidence) =
+                time_dependency("hackage", &package.name, &package.version, || {
+                    fetch_license_for_package(&package)
+                });
+            LicenseInfo {
+                scope: package.scope,
+                ..license_info(
+                    package.name,
+                    package.version,
+                    license,
+                    confidence,
+                    &known_licenses,
+                    config,
+                )
+            }
+        })
+        .collect();
+
+    log(
+        LogLevel::Info,
+        &format!(
+            "Found {} Haskell dependencies with licenses",
+            licenses.len()
+        ),
+    );
+    licenses
+}
+
+fn read(path: &Path) -> Option<String> {
+    match fs::read_to_string(path) {
+        Ok(content) => Some(content),
+        Err(err) => {
+            log_error(&format!("Failed to read {}", path.display()), &err);
+            None
+        }
+    }
+}
+
+/// `name ==version` constraints of a `cabal.project.freeze`
+///
+/// Flag assignments and `installed` constraints carry no version and are skipped.
+fn parse_cabal_freeze(content: &str) -> Vec<(String, String)> {
+    let constraints = cabal_fields(content)
+        .into_iter()
+        .filter(|field| field.section.is_empty() && field.name == "constraints")
+        .map(|field| field.value)
+        .collect::<Vec<_>>()
+        .join(",");
+
+    let mut packages: Vec<(String, String)> = constraints
+        .split(',')
+        .filter_map(|constraint| {
+            let (name, version) = constraint.trim().split_once("==")?;
+            let name = name.trim();
+            let name = name.strip_prefix("any.").unwrap_or(name);
+            let version = version.trim();
+            (!name.is_empty() && !version.is_empty())
+                .then(|| (name.to_string(), version.to_string()))
+        })
+        .collect();
+    packages.sort();
+    packages.dedup();
+    packages
+}
+
+/// Extra-deps of a `stack.yaml.lock` and the snapshot packages the project depends on
+fn stack_packages(
+    lockfile: &str,
+    direct: &BTreeMap<String, DependencyScope>,
+) -> Vec<HaskellPackage> {
+    let lock: StackLock = match serde_yaml::from_str(lockfile) {
+        Ok(lock) => lock,
+        Err(err) => {
+            log_error("Failed to parse stack.yaml.lock", &err);
+            return Vec::new();
+        }
+    };
+
+    let mut packages = parse_stack_extra_deps(&lock);
+    let pinned: HashSet<String> = packages.iter().map(|p| p.name.clone()).collect();
+    let wanted: Vec<(&String, &DependencyScope)> = direct
+        .iter()
+        .filter(|(name, _)| !pinned.contains(*name))
+        .collect();
+    if wanted.is_empty() {
+        return packages;
+    }
+
+    let Some(snapshot) = lock
+        .snapshots
+        .first()
+        .and_then(|snapshot| snapshot.completed.url.as_deref())
+        .and_then(fetch_snapshot)
+    else {
+        log(
+            LogLevel::Warn,
+            "Cannot read the Stack snapshot, only extra-deps are reported",
+        );
+        return packages;
+    };
+    let (compiler, versions) = parse_snapshot(&snapshot);
+
+    for (name, scope) in wanted {
+        let mut package = match versions.get(name) {
+            Some(version) => HaskellPackage::new(name, version, HaskellSource::Hackage),
+            None => HaskellPackage::new(name, &compiler, HaskellSource::Compiler),
+        };
+        package.scope = *scope;
+        packages.push(package);
+    }
+    packages
+}
+
+/// The `packages` of a `stack.yaml.lock`, from Hackage or git
+fn parse_stack_extra_deps(lock: &StackLock) -> Vec<HaskellPackage> {
+    lock.packages
+        .iter()
+        .filter_map(|entry| {
+            let completed = &entry.completed;
+            if let Some(hackage) = &completed.hackage {
+                let (name, version) = parse_package_id(hackage)?;
+                return Some(HaskellPackage::new(name, version, HaskellSource::Hackage));
+            }
+            let name = completed.name.as_deref()?;
+            let version = completed.version.as_deref().unwrap_or_default();
+            match (&completed.git, &completed.commit) {
+                (Some(url), Some(commit)) => Some(HaskellPackage::new(
+                    name,
+                    version,
+                    HaskellSource::Git {
+                        url: url.clone(),
+                        commit: commit.clone(),
+                    },
+                )),
+                _ => {
+                    log(
+                        LogLevel::Warn,
+                        &format!("Cannot look up licenses for archive extra-dep {name}"),
+                    );
+                    None
+                }
+            }
+        })
+        .collect()
+}
+
+/// Name and version of a package identifier such as `aeson-2.2.1.0@sha256:...,6142`
+fn parse_package_id(id: &str) -> Option<(String, String)> {
+    let id = id.split('@').next().unwrap_or(id);
+    let (name, version) = id.rsplit_once('-')?;
+    version
+        .starts_with(|c: char| c.is_ascii_digit())
+        .then(|| (name.to_string(), version.to_string()))
+}
+
+fn fetch_snapshot(url: &str) -> Option<String> {
+    log(LogLevel::Info, &format!("Fetching Stack snapshot: {url}"));
+    match registry::get(Registry::GitHub, url) {
+        Ok(response) if response.status().is_success() => response.text().ok(),
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!("{url} returned {}", response.status()),
+            );
+            None
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch {url}"), &err);
+            None
+        }
+    }
+}
+
+/// Compiler and package versions of a Stackage snapshot
+fn parse_snapshot(content: &str) -> (String, HashMap<String, String>) {
+    let snapshot: Snapshot = match serde_yaml::from_str(content) {
+        Ok(snapshot) => snapshot,
+        Err(err) => {
+            log_error("Failed to parse the Stack snapshot", &err);
+            return (String::new(), HashMap::new());
+        }
+    };
+    let compiler = snapshot
+        .resolver
+        .and_then(|resolver| resolver.compiler)
+        .or(snapshot.compiler)
+        .unwrap_or_default();
+    let versions = snapshot
+        .packages
+        .iter()
+        .filter_map(|package| parse_package_id(package.hackage.as_deref()?))
+        .collect();
+    (compiler, versions)
+}
+
+/// A package of the project, with the dependencies of each of its components
+#[derive(Debug, Clone, PartialEq)]
+struct LocalPackage {
+    name: String,
+    dependencies: Vec<(String, DependencyScope)>,
+}
+
+/// The project's own packages: the directories listed under `packages` in
+/// `stack.yaml` or `cabal.project`, the project directory otherwise
+fn local_packages(project_dir: &Path) -> Vec<LocalPackage> {
+    let mut dirs = vec![PathBuf::from(".")];
+    if let Some(stack) = fs::read_to_string(project_dir.join("stack.yaml"))
+        .ok()
+        .and_then(|content| serde_yaml::from_str::<StackConfig>(&content).ok())
+    {
+        dirs.extend(stack.packages.iter().map(PathBuf::from));
+    }
+    if let Ok(content) = fs::read_to_string(project_dir.join("cabal.project")) {
+        dirs.extend(
+            cabal_fields(&content)
+                .into_iter()
+                .filter(|field| field.section.is_empty() && field.name == "packages")
+                .flat_map(|field| {
+                    field
+                        .value
+                        .split_whitespace()
+                        .map(|entry| {
+                            // `lib/foo.cabal` and `lib/*.cabal` name the package directory's files
+                            let path = Path::new(entry);
+                            if entry.ends_with(".cabal") {
+                                path.parent().unwrap_or(Path::new(".")).to_path_buf()
+                            } else {
+                                path.to_path_buf()
+                            }
+                        })
+                        .collect::<Vec<_>>()
+                }),
+        );
+    }
+
+    let mut seen = HashSet::new();
+    dirs.into_iter()
+        .map(|dir| project_dir.join(dir))
+        .filter(|dir| !dir.to_string_lossy().contains('*') && dir.is_dir())
+        .filter(|dir| seen.insert(dir.canonicalize().unwrap_or_else(|_| dir.clone())))
+        .filter_map(|dir| read_local_package(&dir))
+        .collect()
+}
+
+/// The `.cabal` file of a package directory, or its hpack `package.yaml`
+fn read_local_package(dir: &Path) -> Option<LocalPackage> {
+    let cabal_file = fs::read_dir(dir)
+        .ok()?
+        .filter_map(|e| e.ok())
+        .find(|entry| {
+            entry.path().extension().is_some_and(|ext| ext == "cabal") && entry.path().is_file()
+        });
+    if let Some(entry) = cabal_file {
+        let content = fs::read_to_string(entry.path()).ok()?;
+        let fields = cabal_fields(&content);
+        let name = fields
+            .iter()
+            .find(|field| field.section.is_empty() && field.name == "name")
+            .map(|field| field.value.clone())
+            .or_else(|| {
+                entry
+                    .path()
+                    .file_stem()
+                    .map(|stem| stem.to_string_lossy().to_string())
+            })?;
+        let dependencies = fields
+            .iter()
+            .filter(|field| field.name == "build-depends")
+            .flat_map(|field| {
+                let scope = section_scope(&field.section);
+                build_depends(&field.value)
+                    .into_iter()
+                    .map(move |name| (name, scope))
+            })
+            .collect();
+        return Some(LocalPackage { name, dependencies });
+    }
+
+    let content = fs::read_to_string(dir.join("package.yaml")).ok()?;
+    let package: Hpack = serde_yaml::from_str(&content).ok()?;
+    Some(parse_package_yaml(&package))
+}
+
+/// Dependencies of an hpack `package.yaml`, top-level and per component
+fn parse_package_yaml(package: &Hpack) -> LocalPackage {
+    let names = |component: &Hpack| -> Vec<String> {
+        component
+            .dependencies
+            .as_ref()
+            .map(HpackDependencies::names)
+            .unwrap_or_default()
+    };
+
+    let mut dependencies: Vec<(String, DependencyScope)> = names(package)
+        .into_iter()
+        .map(|name| (name, DependencyScope::Runtime))
+        .collect();
+    let components = package
+        .library
+        .iter()
+        .chain(&package.executable)
+        .map(|component| (component.as_ref(), DependencyScope::Runtime))
+        .chain(
+            package
+                .internal_libraries
+                .values()
+                .chain(package.executables.values())
+                .map(|component| (component, DependencyScope::Runtime)),
+        )
+        .chain(package.tests.values().map(|c| (c, DependencyScope::Test)))
+        .chain(
+            package
+                .benchmarks
+                .values()
+                .map(|c| (c, DependencyScope::Dev)),
+        );
+    for (component, scope) in components {
+        dependencies.extend(names(component).into_iter().map(|name| (name, scope)));
+    }
+
+    LocalPackage {
+        name: package.name.clone(),
+        dependencies,
+    }
+}
+
+/// Scope of the dependencies of a `.cabal` section such as `test-suite spec`
+fn section_scope(section: &str) -> DependencyScope {
+    match section.split_whitespace().next() {
+        Some("test-suite") => DependencyScope::Test,
+        Some("benchmark") => DependencyScope::Dev,
+        _ => DependencyScope::Runtime,
+    }
+}
+
+/// Package names of a `build-depends` list such as `base >=4 && <5, text ^>=2.0`
+fn build_depends(value: &str) -> Vec<String> {
+    value
+        .split(',')
+        .filter_map(|item| {
+            let name: String = item
+                .trim()
+                .chars()
+                .take_while(|c| c.is_ascii_alphanumeric() || *c == '-')
+                .collect();
+            (!name.is_empty()).then_some(name)
+        })
+        .collect()
+}
+
+/// External dependencies of the local packages, with the widest scope they are used in
+fn direct_dependencies(local: &[LocalPackage]) -> BTreeMap<String, DependencyScope> {
+    let local_names: HashSet<&str> = local.iter().map(|package| package.name.as_str()).collect();
+    let rank = |scope: &DependencyScope| match scope {
+        DependencyScope::Runtime => 0,
+        DependencyScope::Build => 1,
+        DependencyScope::Test => 2,
+        DependencyScope::Dev => 3,
+    };
+
+    let mut direct: BTreeMap<String, DependencyScope> = BTreeMap::new();
+    for (name, scope) in local.iter().flat_map(|package| &package.dependencies) {
+        if local_names.contains(name.as_str()) {
+            continue;
+        }
+        direct
+            .entry(name.clone())
+            .and_modify(|current| {
+                if rank(scope) < rank(current) {
+                    *current = *scope;
+                }
+            })
+            .or_insert(*scope);
+    }
+    direct
+}
+
+/// A field of a `.cabal` or `cabal.project` file
+#[derive(Debug, Clone, PartialEq)]
+struct CabalField {
+    /// Header of the enclosing section such as `library` or `test-suite spec`,
+    /// empty for top-level fields
+    section: String,
+    /// Field name in lowercase
+    name: String,
+    /// Value with its continuation lines joined by spaces
+    value: String,
+}
+
+/// Fields of a `.cabal` or `cabal.project` file, in the layout-based syntax
+fn cabal_fields(content: &str) -> Vec<CabalField> {
+    let mut fields: Vec<CabalField> = Vec::new();
+    let mut section = String::new();
+    // Indentation of the field whose value may continue on the next lines
+    let mut open: Option<usize> = None;
+
+    for line in content.lines() {
+        let trimmed = line.trim();
+        if trimmed.is_empty() || trimmed.starts_with("--") {
+            continue;
+        }
+        let indent = line.len() - line.trim_start().len();
+
+        if let (Some(field_indent), Some(field)) = (open, fields.last_mut()) {
+            if indent > field_indent {
+                if !field.value.is_empty() {
+                    field.value.push(' ');
+                }
+                field.value.push_str(trimmed);
+                continue;
+            }
+        }
+        open = None;
+
+        let field = trimmed.split_once(':').filter(|(name, _)| {
+            !name.is_empty()
+                && name
+                    .chars()
+                    .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+        });
+        match field {
+            Some((name, value)) => {
+                if indent == 0 {
+                    section.clear();
+                }
+                fields.push(CabalField {
+                    section: section.clone(),
+                    name: name.to_lowercase(),
+                    value: value.trim().to_string(),
+                });
+                open = Some(indent);
+            }
+            // Conditionals such as `if flag(dev)` keep the enclosing section
+            None if indent == 0 => section = trimmed.to_lowercase(),
+            None => {}
+        }
+    }
+    fields
+}
+
+/// SPDX expression of the `license` field of a `.cabal` file
+fn cabal_license(value: &str) -> Option<String> {
+    let value = value.trim();
+    if value.is_empty() || value == "UnspecifiedLicense" || value == "OtherLicense" {
+        return None;
+    }
+    Some(
+        LEGACY_LICENSES
+            .iter()
+            .find(|(legacy, _)| *legacy == value)
+            .map_or(value, |(_, spdx)| spdx)
+            .to_string(),
+    )
+}
+
+/// License of a package on Hackage, or of the license file of its git repository
+fn fetch_license_for_package(package: &HaskellPackage) -> (Option<String>, Option<f32>) {
+    match &package.source {
+        HaskellSource::Git { url, commit } => match fetch_repository_license(url, commit) {
+            Some((license, confidence)) => (Some(license), Some(confidence)),
+            None => (None, None),
+        },
+        // Boot packages are looked up at their latest release
+        HaskellSource::Compiler => (fetch_license_from_hackage(&package.name, None), None),
+        HaskellSource::Hackage => (
+            fetch_license_from_hackage(&package.name, Some(&package.version)),
+            None,
+        ),
+    }
+}
+
+/// License of a Hackage release, from the latest revision of its `.cabal` file
+pub fn fetch_license_from_hackage(name: &str, version: Option<&str>) -> Option<String> {
+    let cache_version = version.unwrap_or("latest");
+    if let Some(license) = get_cached_license("hackage", name, cache_version) {
+        return Some(license);
+    }
+
+    let package = match version {
+        Some(version) => format!("{name}-{version}"),
+        None => name.to_string(),
+    };
+    let url = format!("{}/package/{package}/{name}.cabal", registry::hackage_url());
+    log(LogLevel::Info, &format!("Fetching Hackage metadata: {url}"));
+    let content = match registry::get(Registry::Hackage, &url) {
+        Ok(response) if response.status().is_success() => response.text().ok()?,
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!("Hackage returned {} for {package}", response.status()),
+            );
+            return None;
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch {package} from Hackage"), &err);
+            return None;
+        }
+    };
+
+    let license = cabal_fields(&content)
+        .into_iter()
+        .find(|field| field.section.is_empty() && field.name == "license")
+        .and_then(|field| cabal_license(&field.value))?;
+    cache_license("hackage", name, cache_version, &license);
+    Some(license)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const FREEZE: &str = "active-repositories: hackage.haskell.org:merge
+constraints: any.aeson ==2.2.1.0,
+             aeson +ordered-keymap,
+             any.base ==4.18.2.0,
+             any.hspec ==2.11.7,
+             any.myapp ==0.1.0.0,
+             any.rts ==1.0.2,
+             any.text ==2.0.2
+index-state: hackage.haskell.org 2024-01-15T10:00:00Z
+";
+
+    const CABAL_FILE: &str = "cabal-version:      3.0
+name:               myapp
+version:            0.1.0.0
+license:            BSD-3-Clause
+
+common warnings
+    ghc-options: -Wall
+
+library
+    import:           warnings
+    exposed-modules:  MyLib
+    build-depends:    base ^>=4.18.0.0,
+                      aeson >=2.0 && <2.3,
+                      text
+    hs-source-dirs:   src
+
+test-suite myapp-test
+    type:             exitcode-stdio-1.0
+    build-depends:
+        base ^>=4.18.0.0,
+        myapp,
+        hspec
+";
+
+    const STACK_LOCK: &str = "packages:
+- completed:
+    hackage: acme-missiles-0.3@sha256:2ba66a092a32593880a87fb00f3213762d7bca65a687d45965778deb8694c5d1,613
+    pantry-tree:
+      sha256: 614bc0cca76937507ea0a5ccc17a504c997ce458d7f2f9e43b15a10c8eaeb033
+      size: 226
+  original:
+    hackage: acme-missiles-0.3
+- completed:
+    commit: 6a92e5ab1d1be1e50b6d5e9e21d4d9b4e733ad8b
+    git: https://github.com/haskell/text-short
+    name: text-short
+    pantry-tree:
+      sha256: 0000
+      size: 100
+    version: 0.1.6
+  original:
+    commit: 6a92e5ab1d1be1e50b6d5e9e21d4d9b4e733ad8b
+    git: https://github.com/haskell/text-short
+snapshots:
+- completed:
+    sha256: 1b4c2669e26fa828451830ed4725e4d406acc25a1fa24fcc039465dd13d7a575
+    size: 714100
+    url: https://raw.githubusercontent.com/commercialhaskell/stackage-snapshots/master/lts/22/7.yaml
+  original: lts-22.7
+";
+
+    const SNAPSHOT: &str = "packages:
+- hackage: aeson-2.1.2.1@sha256:5b8d62a7963a6ec3f6b1a0a4a8f5c2e4a4c4b9c3d2a1f0e9d8c7b6a5f4e3d2c1,6142
+  pantry-tree:
+    sha256: 0000
+    size: 100
+- hackage: hspec-2.10.10@sha256:abc,1000
+resolver:
+  compiler: ghc-9.6.4
+";
+
+    #[test]
+    fn test_parse_cabal_freeze() {
+        assert_eq!(
+            parse_cabal_freeze(FREEZE),
+            vec![
+                ("aeson".to_string(), "2.2.1.0".to_string()),
+                ("base".to_string(), "4.18.2.0".to_string()),
+                ("hspec".to_string(), "2.11.7".to_string()),
+                ("myapp".to_string(), "0.1.0.0".to_string()),
+                ("rts".to_string(), "1.0.2".to_string()),
+                ("text".to_string(), "2.0.2".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_cabal_fields_and_license() {
+        let fields = cabal_fields(CABAL_FILE);
+        let depends: Vec<_> = fields
+            .iter()
+            .filter(|field| field.name == "build-depends")
+            .map(|field| (field.section.as_str(), build_depends(&field.value)))
+            .collect();
+        assert_eq!(
+            depends,
+            vec![
+                (
+                    "library",
+                    vec!["base".into(), "aeson".into(), "text".into()]
+                ),
+                (
+                    "test-suite myapp-test",
+                    vec!["base".into(), "myapp".into(), "hspec".into()]
+                ),
+            ]
+        );
+        assert_eq!(
+            section_scope("test-suite myapp-test"),
+            DependencyScope::Test
+        );
+
+        assert_eq!(cabal_license("BSD3"), Some("BSD-3-Clause".to_string()));
+        assert_eq!(cabal_license("GPL-3"), Some("GPL-3.0-only".to_string()));
+        assert_eq!(
+            cabal_license("MIT OR Apache-2.0"),
+            Some("MIT OR Apache-2.0".to_string())
+        );
+        assert_eq!(cabal_license("OtherLicense"), None);
+    }
+
+    #[test]
+    fn test_direct_dependencies() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::write(root.join("myapp.cabal"), CABAL_FILE).unwrap();
+        fs::create_dir_all(root.join("tools")).unwrap();
+        fs::write(
+            root.join("tools/package.yaml"),
+            "name: tools\ndependencies:\n  - base\n  - myapp\nbenchmarks:\n  bench:\n    dependencies: criterion >= 1.6\n",
+        )
+        .unwrap();
+        fs::write(root.join("stack.yaml"), "packages:\n- .\n- tools\n").unwrap();
+
+        let local = local_packages(root);
+        let names: Vec<_> = local.iter().map(|package| package.name.as_str()).collect();
+        assert_eq!(names, vec!["myapp", "tools"]);
+
+        let direct = direct_dependencies(&local);
+        assert_eq!(
+            direct.into_iter().collect::<Vec<_>>(),
+            vec![
+                ("aeson".to_string(), DependencyScope::Runtime),
+                ("base".to_string(), DependencyScope::Runtime),
+                ("criterion".to_string(), DependencyScope::Dev),
+                ("hspec".to_string(), DependencyScope::Test),
+                ("text".to_string(), DependencyScope::Runtime),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_stack_lock() {
+        let lock: StackLock = serde_yaml::from_str(STACK_LOCK).unwrap();
+        assert_eq!(
+            parse_stack_extra_deps(&lock),
+            vec![
+                HaskellPackage::new("acme-missiles", "0.3", HaskellSource::Hackage),
+                HaskellPackage::new(
+                    "text-short",
+                    "0.1.6",
+                    HaskellSource::Git {
+                        url: "https://github.com/haskell/text-short".to_string(),
+                        commit: "6a92e5ab1d1be1e50b6d5e9e21d4d9b4e733ad8b".to_string(),
+                    }
+                ),
+            ]
+        );
+
+        let (compiler, versions) = parse_snapshot(SNAPSHOT);
+        assert_eq!(compiler, "ghc-9.6.4");
+        assert_eq!(versions["aeson"], "2.1.2.1");
+        assert_eq!(versions["hspec"], "2.10.10");
+        assert_eq!(
+            parse_package_id("unordered-containers-0.2.19.1@sha256:abc,10"),
+            Some(("unordered-containers".to_string(), "0.2.19.1".to_string()))
+        );
+    }
+}
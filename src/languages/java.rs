@@ -0,0 +1,2069 @@
+use regex::Regex;
+use std::collections::{HashMap, HashSet, VecDeque};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
+
+/// Maximum number of parent POMs followed before giving up
+const MAX_PARENT_DEPTH: u32 = 10;
+
+/// A fully qualified Maven artifact
+#[derive(Debug, Clone, Default, PartialEq, Eq, Hash)]
+pub struct MavenCoordinate {
+    pub group_id: String,
+    pub artifact_id: String,
+    pub version: String,
+}
+
+impl MavenCoordinate {
+    fn new(group_id: &str, artifact_id: &str, version: &str) -> Self {
+        Self {
+            group_id: group_id.to_string(),
+            artifact_id: artifact_id.to_string(),
+            version: version.to_string(),
+        }
+    }
+
+    fn name(&self) -> String {
+        format!("{}:{}", self.group_id, self.artifact_id)
+    }
+
+    fn pom_path(&self) -> PathBuf {
+        let mut path: PathBuf = self.group_id.split('.').collect();
+        path.push(&self.artifact_id);
+        path.push(&self.version);
+        path.push(format!("{}-{}.pom", self.artifact_id, self.version));
+        path
+    }
+
+    fn pom_url(&self, repository: &str) -> String {
+        format!(
+            "{repository}/{}/{}/{}/{}-{}.pom",
+            self.group_id.replace('.', "/"),
+            self.artifact_id,
+            self.version,
+            self.artifact_id,
+            self.version
+        )
+    }
+}
+
+/// A `<dependency>` entry as written in a POM
+#[derive(Debug, Clone, Default, PartialEq)]
+struct MavenDependency {
+    group_id: String,
+    artifact_id: String,
+    version: Option<String>,
+    scope: Option<String>,
+    dep_type: Option<String>,
+    optional: bool,
+}
+
+/// The `<parent>` reference of a POM
+#[derive(Debug, Clone, Default, PartialEq)]
+struct PomParent {
+    group_id: String,
+    artifact_id: String,
+    version: String,
+    relative_path: Option<String>,
+}
+
+/// A POM as written on disk, before inheritance and interpolation
+#[derive(Debug, Clone, Default)]
+struct Pom {
+    group_id: Option<String>,
+    artifact_id: Option<String>,
+    version: Option<String>,
+    parent: Option<PomParent>,
+    properties: HashMap<String, String>,
+    managed: Vec<MavenDependency>,
+    dependencies: Vec<MavenDependency>,
+    licenses: Vec<String>,
+}
+
+/// A POM after parent inheritance, BOM imports and property interpolation
+#[derive(Debug, Clone, Default)]
+struct EffectivePom {
+    coordinate: MavenCoordinate,
+    properties: HashMap<String, String>,
+    managed_versions: HashMap<(String, String), String>,
+    dependencies: Vec<MavenDependency>,
+    licenses: Vec<String>,
+}
+
+pub fn analyze_java_licenses(project_path: &str, config: &FeludaConfig) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing Java dependencies from: {project_path}"),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let path = Path::new(project_path);
+    let file_name = path.file_name().and_then(|n| n.to_str()).unwrap_or("");
+    let project_dir = path.parent().unwrap_or(Path::new("."));
+    let max_depth = config.dependencies.max_depth;
+    let mut resolver = PomResolver::new();
+
+    let resolved: Vec<(MavenCoordinate, Vec<String>, DependencyScope)> = match file_name {
+        "pom.xml" => match fs::read_to_string(path) {
+            Ok(content) => {
+                let root = resolver.effective_pom(&content, Some(project_dir), 0);
+                log(
+                    LogLevel::Info,
+                    &format!(
+                        "Resolving dependencies of {}:{}",
+                        root.coordinate.name(),
+                        root.coordinate.version
+                    ),
+                );
+                log_debug("Effective POM dependencies", &root.dependencies);
+                resolve_maven_dependencies(&mut resolver, &root, max_depth)
+            }
+            Err(err) => {
+                log_error("Failed to read pom.xml", &err);
+                return Vec::new();
+            }
+        },
+        _ => {
+            let coordinates = if file_name == "gradle.lockfile" {
+                fs::read_to_string(path)
+                    .map(|content| parse_gradle_lockfile(&content))
+                    .unwrap_or_else(|err| {
+                        log_error("Failed to read gradle.lockfile", &err);
+                        Vec::new()
+                    })
+            } else {
+                let resolved = resolve_with_gradle(project_dir);
+                if resolved.is_empty() {
+                    declared_gradle_dependencies(project_dir)
+                } else {
+                    resolved
+                }
+            };
+            let coordinates = collapse_platform_variants(coordinates);
+
+            // Gradle already resolved the graph, so POMs are only needed for licenses
+            coordinates
+                .into_iter()
+                .map(|(coordinate, scope)| {
+                    let name = coordinate.name();
+                    if let Some(license) = get_cached_license("maven", &name, &coordinate.version) {
+                        return (coordinate, vec![license], scope);
+                    }
+
+                    let licenses = time_dependency("maven", &name, &coordinate.version, || {
+                        resolver
+                            .resolve_coordinate(&coordinate, 0)
+                            .map(|pom| pom.licenses)
+                            .unwrap_or_default()
+                    });
+                    if !licenses.is_empty() {
+                        cache_license("maven", &name, &coordinate.version, &licenses.join(" OR "));
+                    }
+                    (coordinate, licenses, scope)
+                })
+                .collect()
+        }
+    };
+
+    log(
+        LogLevel::Info,
+        &format!("Resolved {} Java dependencies", resolved.len()),
+    );
+
+    resolved
+        .into_iter()
+        .flat_map(|(coordinate, licenses, scope)| {
+            let license = if licenses.is_empty() {
+                log(
+                    LogLevel::Warn,
+                    &format!("No license found in POM for {}", coordinate.name()),
+                );
+                None
+            } else {
+                Some(licenses.join(" OR "))
+            };
+            let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
+
+            if is_restrictive {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "Restrictive license found: {license:?} for {}",
+                        coordinate.name()
+                    ),
+                );
+            }
+
+            let info = LicenseInfo {
+                name: coordinate.name(),
+                version: coordinate.version.clone(),
+                osi_status: match &license {
+                    Some(l) => crate::licenses::get_osi_status(l),
+                    None => crate::licenses::OsiStatus::Unknown,
+                },
+                license,
+                is_restrictive,
+                compatibility: LicenseCompatibility::Unknown,
+                license_confidence: None,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
+            };
+
+            // Native libraries bundled in an AAR ship under the license of the AAR
+            let natives = gradle_cached_aar(&coordinate)
+                .map(|aar| aar_native_libraries(&aar))
+                .unwrap_or_default();
+            let parent = format!("{}@{}", info.name, info.version);
+            let mut infos: Vec<LicenseInfo> = natives
+                .into_iter()
+                .map(|library| LicenseInfo {
+                    dependency_path: Some(vec![
+                        parent.clone(),
+                        format!("{library}@{}", info.version),
+                    ]),
+                    name: library,
+                    ..info.clone()
+                })
+                .collect();
+            infos.insert(0, info);
+            infos
+        })
+        .collect()
+}
+
+/// Walk the dependency graph breadth first so the nearest declaration of an artifact wins
+///
+/// Test-scoped dependencies of the project and everything they pull in are
+/// walked after the runtime graph, so an artifact also needed at runtime keeps
+/// the runtime scope.
+fn resolve_maven_dependencies(
+    resolver: &mut PomResolver,
+    root: &EffectivePom,
+    max_depth: u32,
+) -> Vec<(MavenCoordinate, Vec<String>, DependencyScope)> {
+    let mut resolved = Vec::new();
+    let mut seen = HashSet::new();
+
+    let (test, runtime): (Vec<_>, Vec<_>) = root
+        .dependencies
+        .iter()
+        .partition(|dep| dep.scope.as_deref() == Some("test"));
+    for (roots, scope) in [
+        (runtime, DependencyScope::Runtime),
+        (test, DependencyScope::Test),
+    ] {
+        walk_maven_dependencies(
+            resolver,
+            root,
+            &roots,
+            scope,
+            max_depth,
+            &mut seen,
+            &mut resolved,
+        );
+    }
+
+    resolved
+}
+
+fn walk_maven_dependencies(
+    resolver: &mut PomResolver,
+    root: &EffectivePom,
+    roots: &[&MavenDependency],
+    scope: DependencyScope,
+    max_depth: u32,
+    seen: &mut HashSet<String>,
+    resolved: &mut Vec<(MavenCoordinate, Vec<String>, DependencyScope)>,
+) {
+    let mut queue: VecDeque<(MavenCoordinate, u32)> = roots
+        .iter()
+        .filter_map(|dep| {
+            let version = dep.version.as_ref()?;
+            Some((
+                MavenCoordinate::new(&dep.group_id, &dep.artifact_id, version),
+                0,
+            ))
+        })
+        .collect();
+
+    while let Some((coordinate, depth)) = queue.pop_front() {
+        if !seen.insert(coordinate.name()) {
+            continue;
+        }
+
+        let effective = time_dependency("maven", &coordinate.name(), &coordinate.version, || {
+            resolver.resolve_coordinate(&coordinate, 0)
+        });
+
+        if depth < max_depth {
+            if let Some(effective) = &effective {
+                for dep in effective.dependencies.iter().filter(|d| is_transitive(d)) {
+                    // The root's dependencyManagement pins transitive versions too
+                    let key = (dep.group_id.clone(), dep.artifact_id.clone());
+                    let Some(version) = root.managed_versions.get(&key).or(dep.version.as_ref())
+                    else {
+                        continue;
+                    };
+                    queue.push_back((
+                        MavenCoordinate::new(&dep.group_id, &dep.artifact_id, version),
+                        depth + 1,
+                    ));
+                }
+            }
+        }
+
+        let licenses = effective.map(|pom| pom.licenses).unwrap_or_default();
+        resolved.push((coordinate, licenses, scope));
+    }
+}
+
+/// License of a published artifact, from the cache, the local repository or Maven Central
+pub fn fetch_license_for_maven_artifact(
+    group_id: &str,
+    artifact_id: &str,
+    version: &str,
+) -> Option<String> {
+    let coordinate = MavenCoordinate::new(group_id, artifact_id, version);
+    let name = coordinate.name();
+    if let Some(license) = get_cached_license("maven", &name, version) {
+        return Some(license);
+    }
+
+    let licenses = PomResolver::new()
+        .resolve_coordinate(&coordinate, 0)
+        .map(|pom| pom.licenses)
+        .unwrap_or_default();
+    if licenses.is_empty() {
+        return None;
+    }
+    let license = licenses.join(" OR ");
+    cache_license("maven", &name, version, &license);
+    Some(license)
+}
+
+/// Whether a dependency of a dependency ends up on the runtime classpath
+fn is_transitive(dep: &MavenDependency) -> bool {
+    !dep.optional && matches!(dep.scope.as_deref(), None | Some("compile" | "runtime"))
+}
+
+/// Builds effective POMs, fetching parents and BOMs from the local repository or Maven Central
+struct PomResolver {
+    local_repository: Option<PathBuf>,
+    remote: bool,
+    cache: HashMap<MavenCoordinate, Option<EffectivePom>>,
+}
+
+impl PomResolver {
+    fn new() -> Self {
+        let local_repository = std::env::var("HOME")
+            .or_else(|_| std::env::var("USERPROFILE"))
+            .ok()
+            .map(|home| Path::new(&home).join(".m2").join("repository"));
+
+        Self {
+            local_repository,
+            remote: true,
+            cache: HashMap::new(),
+        }
+    }
+
+    /// Resolve the effective POM of a published artifact
+    fn resolve_coordinate(
+        &mut self,
+        coordinate: &MavenCoordinate,
+        depth: u32,
+    ) -> Option<EffectivePom> {
+        if let Some(cached) = self.cache.get(coordinate) {
+            return cached.clone();
+        }
+        // Guard against cycles while this POM is being resolved
+        self.cache.insert(coordinate.clone(), None);
+
+        let effective = self
+            .fetch_pom(coordinate)
+            .map(|content| self.effective_pom(&content, None, depth));
+
+        self.cache.insert(coordinate.clone(), effective.clone());
+        effective
+    }
+
+    fn fetch_pom(&self, coordinate: &MavenCoordinate) -> Option<String> {
+        if let Some(repository) = &self.local_repository {
+            let local_path = repository.join(coordinate.pom_path());
+            if let Ok(content) = fs::read_to_string(&local_path) {
+                log(
+                    LogLevel::Info,
+                    &format!("Found POM in local repository: {}", local_path.display()),
+                );
+                return Some(content);
+            }
+        }
+
+        if !self.remote {
+            return None;
+        }
+
+        // Configured repositories come first, Maven Central and Google's repository last.
+        // With `[registries.sources] maven`, the registry client falls back through its list.
+        registry::maven_repositories()
+            .iter()
+            .find_map(|repository| {
+                let url = coordinate.pom_url(repository);
+                log(LogLevel::Info, &format!("Fetching POM: {url}"));
+
+                match registry::get(Registry::Maven, &url) {
+                    Ok(response) if response.status().is_success() => response.text().ok(),
+                    Ok(response) => {
+                        log(
+                            LogLevel::Warn,
+                            &format!(
+                                "{} returned {} for {}",
+                                response.url(),
+                                response.status(),
+                                coordinate.name()
+                            ),
+                        );
+                        None
+                    }
+                    Err(err) => {
+                        log_error(
+                            &format!("Failed to fetch POM for {}", coordinate.name()),
+                            &err,
+                        );
+                        None
+                    }
+                }
+            })
+    }
+
+    /// Build the effective POM from POM content
+    ///
+    /// `base_dir` is the directory of a POM on disk, used to find a parent through
+    /// `<relativePath>` before looking it up in a repository.
+    fn effective_pom(
+        &mut self,
+        content: &str,
+        base_dir: Option<&Path>,
+        depth: u32,
+    ) -> EffectivePom {
+        let pom = parse_pom(content);
+
+        let parent = match &pom.parent {
+            Some(parent) if depth < MAX_PARENT_DEPTH => {
+                self.resolve_parent(parent, base_dir, depth)
+            }
+            _ => None,
+        };
+        let parent = parent.unwrap_or_default();
+
+        let mut properties = parent.properties.clone();
+        properties.extend(pom.properties.clone());
+
+        let group_id = pom
+            .group_id
+            .clone()
+            .or_else(|| pom.parent.as_ref().map(|p| p.group_id.clone()))
+            .unwrap_or_default();
+        let artifact_id = pom.artifact_id.clone().unwrap_or_default();
+        let version = pom
+            .version
+            .clone()
+            .or_else(|| pom.parent.as_ref().map(|p| p.version.clone()))
+            .unwrap_or_default();
+
+        properties.insert("project.groupId".to_string(), group_id.clone());
+        properties.insert("project.artifactId".to_string(), artifact_id.clone());
+        properties.insert("project.version".to_string(), version.clone());
+        properties.insert("pom.version".to_string(), version.clone());
+        if let Some(p) = &pom.parent {
+            properties.insert("project.parent.groupId".to_string(), p.group_id.clone());
+            properties.insert("project.parent.version".to_string(), p.version.clone());
+        }
+
+        let coordinate = MavenCoordinate::new(
+            &interpolate(&group_id, &properties),
+            &interpolate(&artifact_id, &properties),
+            &interpolate(&version, &properties),
+        );
+
+        // Explicit entries win over imported BOMs, and both win over the parent
+        let mut own_managed = HashMap::new();
+        let mut imports = Vec::new();
+        for dep in &pom.managed {
+            let dep = interpolate_dependency(dep, &properties);
+            let Some(version) = dep.version.clone() else {
+                continue;
+            };
+            if dep.scope.as_deref() == Some("import") && dep.dep_type.as_deref() == Some("pom") {
+                imports.push(MavenCoordinate::new(
+                    &dep.group_id,
+                    &dep.artifact_id,
+                    &version,
+                ));
+            } else {
+                own_managed.insert((dep.group_id, dep.artifact_id), version);
+            }
+        }
+        for bom in imports {
+            log(
+                LogLevel::Info,
+                &format!("Importing BOM {}:{}", bom.name(), bom.version),
+            );
+            if let Some(bom_pom) = self.resolve_coordinate(&bom, depth + 1) {
+                for (key, version) in bom_pom.managed_versions {
+                    own_managed.entry(key).or_insert(version);
+                }
+            }
+        }
+        let mut managed_versions = parent.managed_versions.clone();
+        managed_versions.extend(own_managed);
+
+        let mut dependencies = parent.dependencies.clone();
+        for dep in &pom.dependencies {
+            let mut dep = interpolate_dependency(dep, &properties);
+            if dep.version.is_none() {
+                dep.version = managed_versions
+                    .get(&(dep.group_id.clone(), dep.artifact_id.clone()))
+                    .cloned();
+            }
+            dependencies.push(dep);
+        }
+
+        let licenses = if pom.licenses.is_empty() {
+            parent.licenses.clone()
+        } else {
+            pom.licenses.clone()
+        };
+
+        EffectivePom {
+            coordinate,
+            properties,
+            managed_versions,
+            dependencies,
+            licenses,
+        }
+    }
+
+    fn resolve_parent(
+        &mut self,
+        parent: &PomParent,
+        base_dir: Option<&Path>,
+        depth: u32,
+    ) -> Option<EffectivePom> {
+        if let Some(base_dir) = base_dir {
+            let relative = parent.relative_path.as_deref().unwrap_or("../pom.xml");
+            let mut parent_path = base_dir.join(relative);
+            if parent_path.is_dir() {
+                parent_path = parent_path.join("pom.xml");
+            }
+
+            if let Ok(content) = fs::read_to_string(&parent_path) {
+                if parse_pom(&content).artifact_id.as_deref() == Some(parent.artifact_id.as_str()) {
+                    log(
+                        LogLevel::Info,
+                        &format!("Using parent POM from {}", parent_path.display()),
+                    );
+                    return Some(self.effective_pom(&content, parent_path.parent(), depth + 1));
+                }
+            }
+        }
+
+        let coordinate =
+            MavenCoordinate::new(&parent.group_id, &parent.artifact_id, &parent.version);
+        self.resolve_coordinate(&coordinate, depth + 1)
+    }
+}
+
+/// Parse the parts of a POM relevant to dependency and license resolution
+fn parse_pom(content: &str) -> Pom {
+    let content = remove_xml_blocks(content, "!--");
+    // Plugin dependencies and profiles don't contribute to the project's dependencies
+    let content = ["build", "reporting", "profiles"]
+        .iter()
+        .fold(content, |acc, tag| remove_xml_blocks(&acc, tag));
+
+    let parent = xml_blocks(&content, "parent")
+        .first()
+        .map(|block| PomParent {
+            group_id: xml_child_text(block, "groupId").unwrap_or_default(),
+            artifact_id: xml_child_text(block, "artifactId").unwrap_or_default(),
+            version: xml_child_text(block, "version").unwrap_or_default(),
+            relative_path: xml_child_text(block, "relativePath"),
+        });
+
+    let managed_block = xml_blocks(&content, "dependencyManagement")
+        .first()
+        .map(|block| block.to_string())
+        .unwrap_or_default();
+    let managed = parse_dependency_blocks(&managed_block);
+
+    let content = remove_xml_blocks(&content, "dependencyManagement");
+    let dependencies = xml_blocks(&content, "dependencies")
+        .first()
+        .map(|block| parse_dependency_blocks(block))
+        .unwrap_or_default();
+
+    let licenses = xml_blocks(&content, "license")
+        .iter()
+        .filter_map(|block| {
+            let name = xml_child_text(block, "name");
+            let url = xml_child_text(block, "url");
+            spdx_from_maven_license(name.as_deref(), url.as_deref())
+        })
+        .collect();
+
+    let mut properties = HashMap::new();
+    if let Some(block) = xml_blocks(&content, "properties").first() {
+        if let Ok(re) = Regex::new(r"<([A-Za-z0-9_.\-]+)>([^<]*)</([A-Za-z0-9_.\-]+)>") {
+            for cap in re.captures_iter(block) {
+                if cap[1] == cap[3] {
+                    properties.insert(cap[1].to_string(), cap[2].trim().to_string());
+                }
+            }
+        }
+    }
+
+    // Whatever is left at the top level describes the project itself
+    let project = [
+        "parent",
+        "dependencies",
+        "properties",
+        "licenses",
+        "developers",
+        "contributors",
+        "organization",
+        "scm",
+        "distributionManagement",
+        "modules",
+        "repositories",
+        "pluginRepositories",
+        "issueManagement",
+        "ciManagement",
+        "mailingLists",
+    ]
+    .iter()
+    .fold(content, |acc, tag| remove_xml_blocks(&acc, tag));
+
+    Pom {
+        group_id: xml_child_text(&project, "groupId"),
+        artifact_id: xml_child_text(&project, "artifactId"),
+        version: xml_child_text(&project, "version"),
+        parent,
+        properties,
+        managed,
+        dependencies,
+        licenses,
+    }
+}
+
+fn parse_dependency_blocks(content: &str) -> Vec<MavenDependency> {
+    xml_blocks(content, "dependency")
+        .iter()
+        .filter_map(|block| {
+            let block = remove_xml_blocks(block, "exclusions");
+            Some(MavenDependency {
+                group_id: xml_child_text(&block, "groupId")?,
+                artifact_id: xml_child_text(&block, "artifactId")?,
+                version: xml_child_text(&block, "version"),
+                scope: xml_child_text(&block, "scope"),
+                dep_type: xml_child_text(&block, "type"),
+                optional: xml_child_text(&block, "optional").as_deref() == Some("true"),
+            })
+        })
+        .collect()
+}
+
+fn interpolate_dependency(
+    dep: &MavenDependency,
+    properties: &HashMap<String, String>,
+) -> MavenDependency {
+    MavenDependency {
+        group_id: interpolate(&dep.group_id, properties),
+        artifact_id: interpolate(&dep.artifact_id, properties),
+        version: dep.version.as_ref().map(|v| interpolate(v, properties)),
+        scope: dep.scope.as_ref().map(|s| interpolate(s, properties)),
+        dep_type: dep.dep_type.clone(),
+        optional: dep.optional,
+    }
+}
+
+/// Replace `${property}` references, following properties that refer to other properties
+fn interpolate(value: &str, properties: &HashMap<String, String>) -> String {
+    let Ok(re) = Regex::new(r"\$\{([^}]+)\}") else {
+        return value.to_string();
+    };
+
+    let mut result = value.to_string();
+    for _ in 0..MAX_PARENT_DEPTH {
+        if !re.is_match(&result) {
+            break;
+        }
+        let replaced = re
+            .replace_all(&result, |cap: &regex::Captures| {
+                properties
+                    .get(&cap[1])
+                    .cloned()
+                    .unwrap_or_else(|| cap[0].to_string())
+            })
+            .to_string();
+        if replaced == result {
+            log(
+                LogLevel::Warn,
+                &format!("Unresolved Maven property in: {value}"),
+            );
+            break;
+        }
+        result = replaced;
+    }
+    result
+}
+
+/// Inner content of each `<tag>...</tag>` element, assuming the tag isn't nested in itself
+///
+/// The pseudo tag `!--` matches XML comments.
+fn xml_blocks(content: &str, tag: &str) -> Vec<String> {
+    let pattern = if tag == "!--" {
+        r"(?s)<!--(.*?)-->".to_string()
+    } else {
+        format!(r"(?s)<{tag}(?:\s[^>]*)?>(.*?)</{tag}>")
+    };
+    match Regex::new(&pattern) {
+        Ok(re) => re
+            .captures_iter(content)
+            .map(|cap| cap[1].to_string())
+            .collect(),
+        Err(_) => Vec::new(),
+    }
+}
+
+fn remove_xml_blocks(content: &str, tag: &str) -> String {
+    let pattern = if tag == "!--" {
+        r"(?s)<!--.*?-->".to_string()
+    } else {
+        format!(r"(?s)<{tag}(?:\s[^>]*)?>.*?</{tag}>|<{tag}\s*/>")
+    };
+    match Regex::new(&pattern) {
+        Ok(re) => re.replace_all(content, "").to_string(),
+        Err(_) => content.to_string(),
+    }
+}
+
+fn xml_child_text(content: &str, tag: &str) -> Option<String> {
+    let re = Regex::new(&format!(r"<{tag}>\s*([^<]*?)\s*</{tag}>")).ok()?;
+    re.captures(content)
+        .map(|cap| cap[1].to_string())
+        .filter(|text| !text.is_empty())
+}
+
+/// Map the free-form license names used in POMs to SPDX identifiers
+fn spdx_from_maven_license(name: Option<&str>, url: Option<&str>) -> Option<String> {
+    let name_lower = name.unwrap_or("").to_lowercase();
+    let url_lower = url.unwrap_or("").to_lowercase();
+    let either = |needle: &str| name_lower.contains(needle) || url_lower.contains(needle);
+
+    let spdx = if either("apache") && (either("2.0") || either("license-2")) {
+        "Apache-2.0"
+    } else if either("mit") && !name_lower.contains("limit") {
+        "MIT"
+    } else if either("lesser") || either("lgpl") {
+        if either("2.1") {
+            "LGPL-2.1"
+        } else {
+            "LGPL-3.0"
+        }
+    } else if either("affero") || either("agpl") {
+        "AGPL-3.0"
+    } else if either("gpl") || either("general public license") {
+        if either("classpath") {
+            "GPL-2.0-with-classpath-exception"
+        } else if either("v3") || either("3.0") {
+            "GPL-3.0"
+        } else {
+            "GPL-2.0"
+        }
+    } else if either("eclipse public license") || either("epl") {
+        if either("2.0") {
+            "EPL-2.0"
+        } else {
+            "EPL-1.0"
+        }
+    } else if either("eclipse distribution license") || either("edl") {
+        "BSD-3-Clause"
+    } else if either("mozilla") || either("mpl") {
+        "MPL-2.0"
+    } else if either("cddl") || either("common development and distribution") {
+        "CDDL-1.0"
+    } else if either("bsd") {
+        if either("2-clause") || either("simplified") {
+            "BSD-2-Clause"
+        } else {
+            "BSD-3-Clause"
+        }
+    } else if either("public domain") || either("cc0") {
+        "CC0-1.0"
+    } else {
+        return name.map(|n| n.trim().to_string()).filter(|n| !n.is_empty());
+    };
+
+    Some(spdx.to_string())
+}
+
+/// Parse a Gradle dependency lockfile
+///
+/// Entries only used by test configurations are skipped.
+fn parse_gradle_lockfile(content: &str) -> Vec<(MavenCoordinate, DependencyScope)> {
+    content
+        .lines()
+        .map(str::trim)
+        .filter(|line| !line.is_empty() && !line.starts_with('#'))
+        .filter_map(|line| {
+            let (coordinate, configurations) = line.split_once('=')?;
+            let only_tests = configurations.split(',').all(is_test_configuration);
+            let scope = if only_tests {
+                DependencyScope::Test
+            } else {
+                DependencyScope::Runtime
+            };
+
+            let mut parts = coordinate.split(':');
+            let group_id = parts.next()?;
+            let artifact_id = parts.next()?;
+            let version = parts.next()?;
+            Some((MavenCoordinate::new(group_id, artifact_id, version), scope))
+        })
+        .collect()
+}
+
+/// Run `gradle dependencies` for the project and its modules and parse the runtime classpaths
+fn resolve_with_gradle(project_dir: &Path) -> Vec<(MavenCoordinate, DependencyScope)> {
+    let wrapper = project_dir.join(if cfg!(windows) {
+        "gradlew.bat"
+    } else {
+        "gradlew"
+    });
+    let program = if wrapper.exists() {
+        wrapper.to_string_lossy().to_string()
+    } else {
+        "gradle".to_string()
+    };
+
+    let mut tasks = vec!["dependencies".to_string()];
+    tasks.extend(
+        gradle_modules(project_dir)
+            .iter()
+            .map(|module| format!("{module}:dependencies")),
+    );
+
+    log(
+        LogLevel::Info,
+        &format!(
+            "Running {program} {} in {}",
+            tasks.join(" "),
+            project_dir.display()
+        ),
+    );
+
+    match Command::new(&program)
+        .args(&tasks)
+        .arg("-q")
+        .current_dir(project_dir)
+        .output()
+    {
+        Ok(output) if output.status.success() => {
+            parse_gradle_runtime_configurations(&String::from_utf8_lossy(&output.stdout))
+        }
+        Ok(output) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "gradle dependencies failed: {}",
+                    String::from_utf8_lossy(&output.stderr).trim()
+                ),
+            );
+            Vec::new()
+        }
+        Err(err) => {
+            log_error("Failed to run gradle", &err);
+            Vec::new()
+        }
+    }
+}
+
+/// Whether a configuration printed by `gradle dependencies` holds what ships with the build
+///
+/// Covers `runtimeClasspath`, Android variants such as `releaseRuntimeClasspath`,
+/// Kotlin Multiplatform targets such as `jvmRuntimeClasspath`, and the
+/// `*CompileKlibraries` of native targets, which have no runtime classpath.
+fn is_runtime_configuration(name: &str) -> bool {
+    !is_test_configuration(name)
+        && (name == "runtimeClasspath"
+            || name.ends_with("RuntimeClasspath")
+            || name.ends_with("CompileKlibraries"))
+}
+
+/// Parse the runtime configurations in the output of `gradle dependencies`
+///
+/// Dependencies only found in debug variants are in the dev scope.
+fn parse_gradle_runtime_configurations(output: &str) -> Vec<(MavenCoordinate, DependencyScope)> {
+    let Ok(header) = Regex::new(r"^([A-Za-z]\w*) - ") else {
+        return Vec::new();
+    };
+
+    let mut coordinates = Vec::new();
+    let mut current: Option<(DependencyScope, String)> = None;
+    let mut flush = |section: Option<(DependencyScope, String)>| {
+        if let Some((scope, tree)) = section {
+            coordinates.extend(
+                parse_gradle_dependencies_output(&tree)
+                    .into_iter()
+                    .map(|coordinate| (coordinate, scope)),
+            );
+        }
+    };
+
+    for line in output.lines() {
+        if let Some(cap) = header.captures(line) {
+            let name = &cap[1];
+            let section = is_runtime_configuration(name).then(|| {
+                let scope = if name.starts_with("debug") {
+                    DependencyScope::Dev
+                } else {
+                    DependencyScope::Runtime
+                };
+                (scope, String::new())
+            });
+            flush(std::mem::replace(&mut current, section));
+        } else if let Some((_, tree)) = current.as_mut() {
+            tree.push_str(line);
+            tree.push('\n');
+        }
+    }
+    flush(current);
+
+    merge_scoped(coordinates)
+}
+
+/// Parse the tree printed by `gradle dependencies`
+///
+/// Handles version conflict arrows (`1.0 -> 1.1`), omitted repeats `(*)`, and skips
+/// constraints `(c)`, unresolvable entries `(n)` and project dependencies.
+fn parse_gradle_dependencies_output(output: &str) -> Vec<MavenCoordinate> {
+    let Ok(re) = Regex::new(r"[+\\]--- (\S+)(?: -> (\S+))?(?: \(([*cn])\))?") else {
+        return Vec::new();
+    };
+
+    let mut seen = HashSet::new();
+    let mut coordinates = Vec::new();
+
+    for cap in re.captures_iter(output) {
+        if matches!(cap.get(3).map(|m| m.as_str()), Some("c" | "n")) {
+            continue;
+        }
+
+        let mut parts = cap[1].split(':');
+        let (Some(group_id), Some(artifact_id)) = (parts.next(), parts.next()) else {
+            continue;
+        };
+        let Some(version) = cap.get(2).map(|m| m.as_str()).or_else(|| parts.next()) else {
+            continue;
+        };
+
+        if seen.insert(format!("{group_id}:{artifact_id}")) {
+            coordinates.push(MavenCoordinate::new(group_id, artifact_id, version));
+        }
+    }
+
+    coordinates
+}
+
+/// Kotlin Multiplatform targets that platform variants append to the artifact id,
+/// e.g. `kotlinx-coroutines-core-iosarm64`
+const KMP_TARGET_SUFFIXES: [&str; 25] = [
+    "jvm",
+    "android",
+    "androidnativearm32",
+    "androidnativearm64",
+    "androidnativex64",
+    "androidnativex86",
+    "iosarm64",
+    "iosx64",
+    "iossimulatorarm64",
+    "js",
+    "wasm-js",
+    "wasm-wasi",
+    "linuxx64",
+    "linuxarm64",
+    "macosx64",
+    "macosarm64",
+    "mingwx64",
+    "tvosarm64",
+    "tvosx64",
+    "tvossimulatorarm64",
+    "watchosarm32",
+    "watchosarm64",
+    "watchosx64",
+    "watchossimulatorarm64",
+    "watchosdevicearm64",
+];
+
+/// Whether a Gradle configuration only feeds tests
+fn is_test_configuration(name: &str) -> bool {
+    name.to_ascii_lowercase().contains("test")
+}
+
+/// Keep the first entry of every artifact, preferring runtime over any other scope
+fn merge_scoped(
+    coordinates: impl IntoIterator<Item = (MavenCoordinate, DependencyScope)>,
+) -> Vec<(MavenCoordinate, DependencyScope)> {
+    let mut merged: Vec<(MavenCoordinate, DependencyScope)> = Vec::new();
+    let mut index: HashMap<String, usize> = HashMap::new();
+    for (coordinate, scope) in coordinates {
+        match index.get(&coordinate.name()) {
+            Some(&i) => {
+                if scope == DependencyScope::Runtime {
+                    merged[i].1 = DependencyScope::Runtime;
+                }
+            }
+            None => {
+                index.insert(coordinate.name(), merged.len());
+                merged.push((coordinate, scope));
+            }
+        }
+    }
+    merged
+}
+
+/// Drop Kotlin Multiplatform platform variants of modules that are listed themselves
+///
+/// The root module and its variants are published with the same POM licenses,
+/// so only the root module is reported.
+fn collapse_platform_variants(
+    coordinates: Vec<(MavenCoordinate, DependencyScope)>,
+) -> Vec<(MavenCoordinate, DependencyScope)> {
+    let modules: HashSet<(String, String)> = coordinates
+        .iter()
+        .map(|(coordinate, _)| (coordinate.group_id.clone(), coordinate.artifact_id.clone()))
+        .collect();
+
+    coordinates
+        .into_iter()
+        .filter(|(coordinate, _)| {
+            !KMP_TARGET_SUFFIXES.iter().any(|target| {
+                coordinate
+                    .artifact_id
+                    .strip_suffix(target)
+                    .and_then(|base| base.strip_suffix('-'))
+                    .is_some_and(|base| {
+                        modules.contains(&(coordinate.group_id.clone(), base.to_string()))
+                    })
+            })
+        })
+        .collect()
+}
+
+/// Modules included in `settings.gradle(.kts)`, as Gradle paths like `:feature:login`
+fn gradle_modules(project_dir: &Path) -> Vec<String> {
+    let Some(content) = ["settings.gradle.kts", "settings.gradle"]
+        .iter()
+        .find_map(|name| fs::read_to_string(project_dir.join(name)).ok())
+    else {
+        return Vec::new();
+    };
+    let Ok(re) = Regex::new(r#"["'](:?[\w.\-:]+)["']"#) else {
+        return Vec::new();
+    };
+
+    let mut modules = Vec::new();
+    for line in content.lines().map(str::trim) {
+        if !line.starts_with("include") {
+            continue;
+        }
+        for cap in re.captures_iter(line) {
+            let module = format!(":{}", cap[1].trim_start_matches(':'));
+            if !modules.contains(&module) {
+                modules.push(module);
+            }
+        }
+    }
+    modules
+}
+
+/// Directory of a module given as a Gradle path, following the default layout
+fn gradle_module_dir(project_dir: &Path, module: &str) -> PathBuf {
+    project_dir.join(module.trim_start_matches(':').replace(':', "/"))
+}
+
+/// Libraries and bundles of a Gradle version catalog (`gradle/libs.versions.toml`)
+#[derive(Debug, Default)]
+struct VersionCatalog {
+    /// Coordinates by accessor, e.g. `androidx.core.ktx` for `androidx-core-ktx`
+    libraries: HashMap<String, MavenCoordinate>,
+    bundles: HashMap<String, Vec<String>>,
+}
+
+/// Accessor of a catalog alias: `-` and `_` separate segments like `.`
+fn catalog_accessor(alias: &str) -> String {
+    alias.replace(['-', '_'], ".")
+}
+
+/// Version of a catalog entry, either a literal or a rich version with `strictly`, `require` or `prefer`
+fn catalog_version(value: &toml::Value) -> Option<String> {
+    match value {
+        toml::Value::String(version) => Some(version.clone()),
+        toml::Value::Table(table) => ["strictly", "require", "prefer"]
+            .iter()
+            .find_map(|key| table.get(*key)?.as_str().map(str::to_string)),
+        _ => None,
+    }
+}
+
+fn parse_version_catalog(content: &str) -> VersionCatalog {
+    let catalog = match toml::from_str::<toml::Value>(content) {
+        Ok(catalog) => catalog,
+        Err(err) => {
+            log_error("Failed to parse version catalog", &err);
+            return VersionCatalog::default();
+        }
+    };
+
+    let versions: HashMap<String, String> = catalog
+        .get("versions")
+        .and_then(|versions| versions.as_table())
+        .map(|versions| {
+            versions
+                .iter()
+                .filter_map(|(name, value)| Some((name.clone(), catalog_version(value)?)))
+                .collect()
+        })
+        .unwrap_or_default();
+
+    let mut libraries = HashMap::new();
+    for (alias, entry) in catalog
+        .get("libraries")
+        .and_then(|libraries| libraries.as_table())
+        .into_iter()
+        .flatten()
+    {
+        let coordinate = match entry {
+            toml::Value::String(notation) => parse_dependency_notation(notation),
+            toml::Value::Table(table) => {
+                let module = match table.get("module").and_then(|m| m.as_str()) {
+                    Some(module) => module.split_once(':'),
+                    None => table
+                        .get("group")
+                        .and_then(|g| g.as_str())
+                        .zip(table.get("name").and_then(|n| n.as_str())),
+                };
+                // `version.ref = "x"` and `version = { ref = "x" }` parse to the same table
+                let version = table.get("version").and_then(|version| {
+                    match version.get("ref").and_then(|r| r.as_str()) {
+                        Some(reference) => versions.get(reference).cloned(),
+                        None => catalog_version(version),
+                    }
+                });
+                match (module, version) {
+                    (Some((group_id, artifact_id)), Some(version)) => {
+                        Some(MavenCoordinate::new(group_id, artifact_id, &version))
+                    }
+                    _ => None,
+                }
+            }
+            _ => None,
+        };
+
+        match coordinate {
+            Some(coordinate) => {
+                libraries.insert(catalog_accessor(alias), coordinate);
+            }
+            None => log(
+                LogLevel::Warn,
+                &format!("Skipping catalog library '{alias}' without a resolvable version"),
+            ),
+        }
+    }
+
+    let bundles = catalog
+        .get("bundles")
+        .and_then(|bundles| bundles.as_table())
+        .map(|bundles| {
+            bundles
+                .iter()
+                .map(|(name, aliases)| {
+                    let aliases = aliases
+                        .as_array()
+                        .into_iter()
+                        .flatten()
+                        .filter_map(|alias| alias.as_str())
+                        .map(catalog_accessor)
+                        .collect();
+                    (catalog_accessor(name), aliases)
+                })
+                .collect()
+        })
+        .unwrap_or_default();
+
+    VersionCatalog { libraries, bundles }
+}
+
+/// The `libs` catalog of the build, looked up in the project directory and its parents
+fn find_version_catalog(project_dir: &Path) -> Option<VersionCatalog> {
+    project_dir.ancestors().take(4).find_map(|dir| {
+        let path = dir.join("gradle").join("libs.versions.toml");
+        let content = fs::read_to_string(&path).ok()?;
+        log(
+            LogLevel::Info,
+            &format!("Using version catalog {}", path.display()),
+        );
+        Some(parse_version_catalog(&content))
+    })
+}
+
+/// Parse `group:artifact:version[:classifier][@extension]`, e.g. `com.example:native:1.0@aar`
+fn parse_dependency_notation(notation: &str) -> Option<MavenCoordinate> {
+    let notation = notation.split('@').next()?;
+    let mut parts = notation.split(':');
+    let group_id = parts.next()?;
+    let artifact_id = parts.next()?;
+    let version = parts.next()?;
+    // Versions taken from build script variables can't be resolved without Gradle
+    if group_id.is_empty() || artifact_id.is_empty() || version.is_empty() || version.contains('$')
+    {
+        return None;
+    }
+    Some(MavenCoordinate::new(group_id, artifact_id, version))
+}
+
+/// Scope of a dependency declared in `configuration`, `None` for anything that isn't a dependency
+///
+/// `in_test` is set inside test source sets such as `commonTest` or `androidUnitTest`.
+fn declaration_scope(configuration: &str, in_test: bool) -> Option<DependencyScope> {
+    let lower = configuration.to_ascii_lowercase();
+    let is_processor =
+        lower.starts_with("kapt") || lower.starts_with("ksp") || lower == "annotationprocessor";
+    let is_dependency = is_processor
+        || ["implementation", "api", "compileonly", "runtimeonly"]
+            .iter()
+            .any(|suffix| lower.ends_with(suffix));
+    if !is_dependency {
+        return None;
+    }
+
+    Some(if in_test || is_test_configuration(&lower) {
+        DependencyScope::Test
+    } else if is_processor || lower.ends_with("compileonly") {
+        DependencyScope::Build
+    } else if lower.starts_with("debug") {
+        DependencyScope::Dev
+    } else {
+        DependencyScope::Runtime
+    })
+}
+
+/// Dependencies declared in a `build.gradle` or `build.gradle.kts` file
+///
+/// Handles string and map notation, `libs.*` accessors and bundles of the
+/// version catalog, and the `dependencies` blocks of Kotlin Multiplatform
+/// source sets. Platforms (BOMs), project and file dependencies are skipped.
+/// Only direct dependencies are found this way.
+fn parse_gradle_build_script(
+    content: &str,
+    catalog: Option<&VersionCatalog>,
+) -> Vec<(MavenCoordinate, DependencyScope)> {
+    let (Ok(declaration), Ok(map_notation)) = (
+        Regex::new(r"^(\w+)\s*\(?\s*(.*)$"),
+        Regex::new(
+            r#"group\s*[:=]\s*["']([^"']+)["']\s*,\s*name\s*[:=]\s*["']([^"']+)["']\s*,\s*version\s*[:=]\s*["']([^"']+)["']"#,
+        ),
+    ) else {
+        return Vec::new();
+    };
+
+    let mut blocks: Vec<String> = Vec::new();
+    let mut coordinates = Vec::new();
+
+    for line in content.lines() {
+        let line = line.trim();
+        let in_dependencies = blocks
+            .iter()
+            .any(|block| block == "dependencies" || block.ends_with(".dependencies"));
+        let in_test = blocks.iter().any(|block| is_test_configuration(block));
+
+        if in_dependencies {
+            if let Some(cap) = declaration.captures(line) {
+                if let Some(scope) = declaration_scope(&cap[1], in_test) {
+                    let argument = cap[2].trim();
+                    let declared: Vec<MavenCoordinate> = if argument.starts_with("platform(")
+                        || argument.starts_with("enforcedPlatform(")
+                    {
+                        Vec::new()
+                    } else if let Some(notation) = argument
+                        .strip_prefix(['"', '\''])
+                        .and_then(|rest| rest.split(['"', '\'']).next())
+                    {
+                        parse_dependency_notation(notation).into_iter().collect()
+                    } else if let Some(accessor) = argument.strip_prefix("libs.") {
+                        let accessor: String = accessor
+                            .chars()
+                            .take_while(|c| c.is_alphanumeric() || matches!(c, '.' | '_'))
+                            .collect();
+                        let accessor = accessor.trim_end_matches(".get").trim_end_matches('.');
+                        catalog_coordinates(catalog, accessor)
+                    } else if let Some(cap) = map_notation.captures(argument) {
+                        vec![MavenCoordinate::new(&cap[1], &cap[2], &cap[3])]
+                    } else {
+                        Vec::new()
+                    };
+                    coordinates.extend(declared.into_iter().map(|c| (c, scope)));
+                }
+            }
+        }
+
+        let mut start = 0;
+        for (i, c) in line.char_indices() {
+            match c {
+                '{' => {
+                    blocks.push(line[start..i].trim().to_string());
+                    start = i + 1;
+                }
+                '}' => {
+                    blocks.pop();
+                    start = i + 1;
+                }
+                _ => {}
+            }
+        }
+    }
+
+    merge_scoped(coordinates)
+}
+
+/// Coordinates behind a `libs.` accessor, expanding `libs.bundles.*`
+fn catalog_coordinates(catalog: Option<&VersionCatalog>, accessor: &str) -> Vec<MavenCoordinate> {
+    let Some(catalog) = catalog else {
+        log(
+            LogLevel::Warn,
+            &format!("No version catalog found for libs.{accessor}"),
+        );
+        return Vec::new();
+    };
+    let aliases = match accessor.strip_prefix("bundles.") {
+        Some(bundle) => catalog.bundles.get(bundle).cloned().unwrap_or_default(),
+        None => vec![accessor.to_string()],
+    };
+    aliases
+        .iter()
+        .filter_map(|alias| catalog.libraries.get(alias).cloned())
+        .collect()
+}
+
+/// Dependencies declared in the build scripts of the project and its modules
+fn declared_gradle_dependencies(project_dir: &Path) -> Vec<(MavenCoordinate, DependencyScope)> {
+    log(
+        LogLevel::Warn,
+        "Reading dependencies declared in Gradle build scripts; transitive dependencies need Gradle or a gradle.lockfile",
+    );
+    let catalog = find_version_catalog(project_dir);
+
+    let module_dirs = std::iter::once(project_dir.to_path_buf()).chain(
+        gradle_modules(project_dir)
+            .into_iter()
+            .map(|module| gradle_module_dir(project_dir, &module)),
+    );
+    let declared = module_dirs.flat_map(|dir| {
+        ["build.gradle.kts", "build.gradle"]
+            .iter()
+            .find_map(|name| fs::read_to_string(dir.join(name)).ok())
+            .map(|content| parse_gradle_build_script(&content, catalog.as_ref()))
+            .unwrap_or_default()
+    });
+    merge_scoped(declared)
+}
+
+/// Directory of Gradle's caches, `$GRADLE_USER_HOME` or `~/.gradle`
+fn gradle_user_home() -> Option<PathBuf> {
+    if let Ok(home) = std::env::var("GRADLE_USER_HOME") {
+        return Some(PathBuf::from(home));
+    }
+    std::env::var("HOME")
+        .or_else(|_| std::env::var("USERPROFILE"))
+        .ok()
+        .map(|home| Path::new(&home).join(".gradle"))
+}
+
+/// The AAR of an Android library in the Gradle cache, when it was downloaded
+fn gradle_cached_aar(coordinate: &MavenCoordinate) -> Option<PathBuf> {
+    let dir = gradle_user_home()?
+        .join("caches")
+        .join("modules-2")
+        .join("files-2.1")
+        .join(&coordinate.group_id)
+        .join(&coordinate.artifact_id)
+        .join(&coordinate.version);
+    let file_name = format!("{}-{}.aar", coordinate.artifact_id, coordinate.version);
+    // Each file sits in a directory named after its checksum
+    fs::read_dir(dir)
+        .ok()?
+        .flatten()
+        .map(|entry| entry.path().join(&file_name))
+        .find(|path| path.is_file())
+}
+
+/// Names of the entries in a ZIP archive, read from its central directory
+fn zip_entry_names(data: &[u8]) -> Vec<String> {
+    let u16_at = |pos: usize| {
+        data.get(pos..pos + 2)
+            .map(|b| u16::from_le_bytes([b[0], b[1]]) as usize)
+    };
+    let u32_at = |pos: usize| {
+        data.get(pos..pos + 4)
+            .map(|b| u32::from_le_bytes([b[0], b[1], b[2], b[3]]) as usize)
+    };
+
+    // The end of central directory record is followed by a comment of at most 64 KiB
+    let search_start = data.len().saturating_sub(22 + u16::MAX as usize);
+    let Some(end) = (search_start..data.len().saturating_sub(21))
+        .rev()
+        .find(|&pos| data[pos..pos + 4] == [0x50, 0x4b, 0x05, 0x06])
+    else {
+        return Vec::new();
+    };
+    let (Some(count), Some(mut pos)) = (u16_at(end + 10), u32_at(end + 16)) else {
+        return Vec::new();
+    };
+
+    let mut names = Vec::new();
+    for _ in 0..count {
+        if data.get(pos..pos + 4) != Some(&[0x50, 0x4b, 0x01, 0x02][..]) {
+            break;
+        }
+        let (Some(name_len), Some(extra_len), Some(comment_len)) =
+            (u16_at(pos + 28), u16_at(pos + 30), u16_at(pos + 32))
+        else {
+            break;
+        };
+        let Some(name) = data.get(pos + 46..pos + 46 + name_len) else {
+            break;
+        };
+        names.push(String::from_utf8_lossy(name).to_string());
+        pos += 46 + name_len + extra_len + comment_len;
+    }
+    names
+}
+
+/// Native libraries (`jni/<abi>/*.so`) bundled in an AAR, once per library name
+fn aar_native_libraries(aar: &Path) -> Vec<String> {
+    let data = match fs::read(aar) {
+        Ok(data) => data,
+        Err(err) => {
+            log_error(&format!("Failed to read {}", aar.display()), &err);
+            return Vec::new();
+        }
+    };
+
+    let mut libraries: Vec<String> = zip_entry_names(&data)
+        .iter()
+        .filter(|name| name.starts_with("jni/") && name.ends_with(".so"))
+        .filter_map(|name| name.rsplit('/').next().map(str::to_string))
+        .collect();
+    libraries.sort();
+    libraries.dedup();
+    libraries
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn offline_resolver(local_repository: &Path) -> PomResolver {
+        PomResolver {
+            local_repository: Some(local_repository.to_path_buf()),
+            remote: false,
+            cache: HashMap::new(),
+        }
+    }
+
+    #[test]
+    fn test_parse_pom() {
+        let pom = parse_pom(
+            r#"<?xml version="1.0" encoding="UTF-8"?>
+<project>
+  <modelVersion>4.0.0</modelVersion>
+  <!-- <version>9.9.9</version> -->
+  <groupId>com.example</groupId>
+  <artifactId>app</artifactId>
+  <version>1.0.0</version>
+  <properties>
+    <jackson.version>2.15.2</jackson.version>
+  </properties>
+  <licenses>
+    <license>
+      <name>The Apache Software License, Version 2.0</name>
+      <url>https://www.apache.org/licenses/LICENSE-2.0.txt</url>
+    </license>
+  </licenses>
+  <dependencies>
+    <dependency>
+      <groupId>com.fasterxml.jackson.core</groupId>
+      <artifactId>jackson-databind</artifactId>
+      <version>${jackson.version}</version>
+      <exclusions>
+        <exclusion>
+          <groupId>org.excluded</groupId>
+          <artifactId>excluded</artifactId>
+        </exclusion>
+      </exclusions>
+    </dependency>
+    <dependency>
+      <groupId>junit</groupId>
+      <artifactId>junit</artifactId>
+      <version>4.13.2</version>
+      <scope>test</scope>
+    </dependency>
+  </dependencies>
+  <build>
+    <plugins>
+      <plugin>
+        <artifactId>maven-compiler-plugin</artifactId>
+        <version>3.11.0</version>
+      </plugin>
+    </plugins>
+  </build>
+</project>"#,
+        );
+
+        assert_eq!(pom.group_id.as_deref(), Some("com.example"));
+        assert_eq!(pom.artifact_id.as_deref(), Some("app"));
+        assert_eq!(pom.version.as_deref(), Some("1.0.0"));
+        assert_eq!(pom.licenses, vec!["Apache-2.0".to_string()]);
+        assert_eq!(
+            pom.properties.get("jackson.version").map(String::as_str),
+            Some("2.15.2")
+        );
+        assert_eq!(pom.dependencies.len(), 2);
+        assert_eq!(pom.dependencies[0].group_id, "com.fasterxml.jackson.core");
+        assert_eq!(pom.dependencies[1].scope.as_deref(), Some("test"));
+    }
+
+    #[test]
+    fn test_effective_pom_with_local_parent_and_bom() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        let repository = root.join("repository");
+
+        let bom = MavenCoordinate::new("org.example", "example-bom", "3.0.0");
+        let bom_path = repository.join(bom.pom_path());
+        std::fs::create_dir_all(bom_path.parent().unwrap()).unwrap();
+        std::fs::write(
+            &bom_path,
+            r#"<project>
+  <groupId>org.example</groupId>
+  <artifactId>example-bom</artifactId>
+  <version>3.0.0</version>
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>org.example</groupId>
+        <artifactId>managed-lib</artifactId>
+        <version>3.1.4</version>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+</project>"#,
+        )
+        .unwrap();
+
+        std::fs::write(
+            root.join("pom.xml"),
+            r#"<project>
+  <groupId>com.example</groupId>
+  <artifactId>parent</artifactId>
+  <version>2.0.0</version>
+  <packaging>pom</packaging>
+  <properties>
+    <guava.version>32.1.2-jre</guava.version>
+    <bom.version>3.0.0</bom.version>
+  </properties>
+  <dependencyManagement>
+    <dependencies>
+      <dependency>
+        <groupId>com.google.guava</groupId>
+        <artifactId>guava</artifactId>
+        <version>${guava.version}</version>
+      </dependency>
+      <dependency>
+        <groupId>org.example</groupId>
+        <artifactId>example-bom</artifactId>
+        <version>${bom.version}</version>
+        <type>pom</type>
+        <scope>import</scope>
+      </dependency>
+    </dependencies>
+  </dependencyManagement>
+</project>"#,
+        )
+        .unwrap();
+
+        let module_dir = root.join("module");
+        std::fs::create_dir_all(&module_dir).unwrap();
+        let module_pom = r#"<project>
+  <parent>
+    <groupId>com.example</groupId>
+    <artifactId>parent</artifactId>
+    <version>2.0.0</version>
+  </parent>
+  <artifactId>module</artifactId>
+  <dependencies>
+    <dependency>
+      <groupId>com.google.guava</groupId>
+      <artifactId>guava</artifactId>
+    </dependency>
+    <dependency>
+      <groupId>org.example</groupId>
+      <artifactId>managed-lib</artifactId>
+    </dependency>
+    <dependency>
+      <groupId>${project.groupId}</groupId>
+      <artifactId>sibling</artifactId>
+      <version>${project.version}</version>
+    </dependency>
+  </dependencies>
+</project>"#;
+
+        let mut resolver = offline_resolver(&repository);
+        let effective = resolver.effective_pom(module_pom, Some(&module_dir), 0);
+
+        assert_eq!(
+            effective.coordinate,
+            MavenCoordinate::new("com.example", "module", "2.0.0")
+        );
+        let versions: Vec<(String, Option<String>)> = effective
+            .dependencies
+            .iter()
+            .map(|d| (d.artifact_id.clone(), d.version.clone()))
+            .collect();
+        assert_eq!(
+            versions,
+            vec![
+                ("guava".to_string(), Some("32.1.2-jre".to_string())),
+                ("managed-lib".to_string(), Some("3.1.4".to_string())),
+                ("sibling".to_string(), Some("2.0.0".to_string())),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_test_scope_dependencies_are_scoped() {
+        let temp_dir = TempDir::new().unwrap();
+        let repository = temp_dir.path().join("repository");
+        let write_pom = |coordinate: &MavenCoordinate, dependencies: &str| {
+            let path = repository.join(coordinate.pom_path());
+            std::fs::create_dir_all(path.parent().unwrap()).unwrap();
+            std::fs::write(
+                path,
+                format!(
+                    "<project><groupId>{}</groupId><artifactId>{}</artifactId><version>{}</version>\
+                     <dependencies>{dependencies}</dependencies></project>",
+                    coordinate.group_id, coordinate.artifact_id, coordinate.version
+                ),
+            )
+            .unwrap();
+        };
+        let hamcrest = "<dependency><groupId>org.hamcrest</groupId>\
+            <artifactId>hamcrest-core</artifactId><version>1.3</version></dependency>";
+        write_pom(&MavenCoordinate::new("junit", "junit", "4.13.2"), hamcrest);
+        write_pom(
+            &MavenCoordinate::new("com.example", "lib", "1.0.0"),
+            hamcrest,
+        );
+        write_pom(
+            &MavenCoordinate::new("org.hamcrest", "hamcrest-core", "1.3"),
+            "",
+        );
+        write_pom(&MavenCoordinate::new("org.mockito", "mockito", "5.0.0"), "");
+
+        let project = r#"<project>
+  <groupId>com.example</groupId>
+  <artifactId>app</artifactId>
+  <version>1.0.0</version>
+  <dependencies>
+    <dependency>
+      <groupId>junit</groupId>
+      <artifactId>junit</artifactId>
+      <version>4.13.2</version>
+      <scope>test</scope>
+    </dependency>
+    <dependency>
+      <groupId>org.mockito</groupId>
+      <artifactId>mockito</artifactId>
+      <version>5.0.0</version>
+      <scope>test</scope>
+    </dependency>
+    <dependency>
+      <groupId>com.example</groupId>
+      <artifactId>lib</artifactId>
+      <version>1.0.0</version>
+    </dependency>
+  </dependencies>
+</project>"#;
+
+        let mut resolver = offline_resolver(&repository);
+        let root = resolver.effective_pom(project, None, 0);
+        let scopes: Vec<(String, DependencyScope)> =
+            resolve_maven_dependencies(&mut resolver, &root, 10)
+                .into_iter()
+                .map(|(coordinate, _, scope)| (coordinate.artifact_id, scope))
+                .collect();
+
+        assert_eq!(
+            scopes,
+            vec![
+                ("lib".to_string(), DependencyScope::Runtime),
+                // Also pulled in by junit, but needed at runtime through lib
+                ("hamcrest-core".to_string(), DependencyScope::Runtime),
+                ("junit".to_string(), DependencyScope::Test),
+                ("mockito".to_string(), DependencyScope::Test),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_spdx_from_maven_license() {
+        assert_eq!(
+            spdx_from_maven_license(Some("Apache License, Version 2.0"), None),
+            Some("Apache-2.0".to_string())
+        );
+        assert_eq!(
+            spdx_from_maven_license(Some("MIT License"), None),
+            Some("MIT".to_string())
+        );
+        assert_eq!(
+            spdx_from_maven_license(Some("Eclipse Public License - v 2.0"), None),
+            Some("EPL-2.0".to_string())
+        );
+        assert_eq!(
+            spdx_from_maven_license(
+                Some("GNU General Public License, version 2 with the Classpath Exception"),
+                None
+            ),
+            Some("GPL-2.0-with-classpath-exception".to_string())
+        );
+        assert_eq!(
+            spdx_from_maven_license(Some("Custom License"), None),
+            Some("Custom License".to_string())
+        );
+        assert_eq!(spdx_from_maven_license(None, None), None);
+    }
+
+    #[test]
+    fn test_parse_gradle_lockfile() {
+        let content = "# This is a Gradle generated file for dependency locking.\n\
+# Manual edits can break the build and are not advised.\n\
+com.google.guava:guava:32.1.2-jre=compileClasspath,runtimeClasspath\n\
+junit:junit:4.13.2=testCompileClasspath,testRuntimeClasspath\n\
+empty=annotationProcessor\n";
+
+        assert_eq!(
+            parse_gradle_lockfile(content),
+            vec![
+                (
+                    MavenCoordinate::new("com.google.guava", "guava", "32.1.2-jre"),
+                    DependencyScope::Runtime
+                ),
+                (
+                    MavenCoordinate::new("junit", "junit", "4.13.2"),
+                    DependencyScope::Test
+                ),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_gradle_dependencies_output() {
+        let output = r"
+runtimeClasspath - Runtime classpath of source set 'main'.
++--- org.springframework.boot:spring-boot-starter-web -> 3.1.0
+|    +--- org.springframework:spring-web:6.0.9
+|    \--- com.fasterxml.jackson.core:jackson-databind:2.14.0 -> 2.15.0 (*)
++--- com.google.guava:guava:32.1.2-jre
++--- project :shared
++--- org.slf4j:slf4j-api:2.0.7 (c)
+\--- org.example:missing:1.0 (n)
+";
+
+        let coordinates = parse_gradle_dependencies_output(output);
+        assert_eq!(
+            coordinates,
+            vec![
+                MavenCoordinate::new(
+                    "org.springframework.boot",
+                    "spring-boot-starter-web",
+                    "3.1.0"
+                ),
+                MavenCoordinate::new("org.springframework", "spring-web", "6.0.9"),
+                MavenCoordinate::new("com.fasterxml.jackson.core", "jackson-databind", "2.15.0"),
+                MavenCoordinate::new("com.google.guava", "guava", "32.1.2-jre"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_declared_gradle_dependencies_with_catalog() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::create_dir_all(root.join("gradle")).unwrap();
+        fs::write(
+            root.join("gradle/libs.versions.toml"),
+            r#"
+[versions]
+coroutines = "1.8.0"
+okhttp = { strictly = "4.12.0" }
+
+[libraries]
+androidx-core-ktx = "androidx.core:core-ktx:1.13.1"
+coroutines-core = { module = "org.jetbrains.kotlinx:kotlinx-coroutines-core", version.ref = "coroutines" }
+coroutines-test = { group = "org.jetbrains.kotlinx", name = "kotlinx-coroutines-test", version = { ref = "coroutines" } }
+okhttp = { module = "com.squareup.okhttp3:okhttp", version.ref = "okhttp" }
+compose-bom = { module = "androidx.compose:compose-bom", version = "2024.06.00" }
+compose-ui = { module = "androidx.compose.ui:ui" }
+
+[bundles]
+network = ["okhttp", "coroutines-core"]
+"#,
+        )
+        .unwrap();
+        fs::write(
+            root.join("settings.gradle.kts"),
+            "rootProject.name = \"app\"\ninclude(\":app\", \":shared\")\n",
+        )
+        .unwrap();
+        fs::write(
+            root.join("build.gradle.kts"),
+            "plugins {\n    id(\"com.android.application\") version \"8.4.0\" apply false\n}\n",
+        )
+        .unwrap();
+        fs::create_dir_all(root.join("app")).unwrap();
+        fs::write(
+            root.join("app/build.gradle.kts"),
+            r#"
+android {
+    testOptions { unitTests.isIncludeAndroidResources = true }
+}
+dependencies {
+    implementation(platform(libs.compose.bom))
+    implementation(libs.androidx.core.ktx)
+    implementation(libs.compose.ui)
+    implementation(libs.bundles.network)
+    implementation("net.zetetic:sqlcipher-android:4.5.6@aar")
+    implementation(project(":shared"))
+    debugImplementation("com.squareup.leakcanary:leakcanary-android:2.14")
+    kapt("com.google.dagger:hilt-compiler:2.51")
+    testImplementation(libs.coroutines.test)
+}
+"#,
+        )
+        .unwrap();
+        fs::create_dir_all(root.join("shared")).unwrap();
+        fs::write(
+            root.join("shared/build.gradle"),
+            r#"
+kotlin {
+    sourceSets {
+        commonMain.dependencies {
+            implementation libs.coroutines.core
+            api group: 'io.ktor', name: 'ktor-client-core', version: '2.3.11'
+        }
+        commonTest.dependencies {
+            implementation 'org.jetbrains.kotlin:kotlin-test:2.0.0'
+        }
+    }
+}
+"#,
+        )
+        .unwrap();
+
+        let dependencies = declared_gradle_dependencies(root);
+        assert_eq!(
+            dependencies,
+            vec![
+                (
+                    MavenCoordinate::new("androidx.core", "core-ktx", "1.13.1"),
+                    DependencyScope::Runtime
+                ),
+                (
+                    MavenCoordinate::new("com.squareup.okhttp3", "okhttp", "4.12.0"),
+                    DependencyScope::Runtime
+                ),
+                (
+                    MavenCoordinate::new(
+                        "org.jetbrains.kotlinx",
+                        "kotlinx-coroutines-core",
+                        "1.8.0"
+                    ),
+                    DependencyScope::Runtime
+                ),
+                (
+                    MavenCoordinate::new("net.zetetic", "sqlcipher-android", "4.5.6"),
+                    DependencyScope::Runtime
+                ),
+                (
+                    MavenCoordinate::new("com.squareup.leakcanary", "leakcanary-android", "2.14"),
+                    DependencyScope::Dev
+                ),
+                (
+                    MavenCoordinate::new("com.google.dagger", "hilt-compiler", "2.51"),
+                    DependencyScope::Build
+                ),
+                (
+                    MavenCoordinate::new(
+                        "org.jetbrains.kotlinx",
+                        "kotlinx-coroutines-test",
+                        "1.8.0"
+                    ),
+                    DependencyScope::Test
+                ),
+                (
+                    MavenCoordinate::new("io.ktor", "ktor-client-core", "2.3.11"),
+                    DependencyScope::Runtime
+                ),
+                (
+                    MavenCoordinate::new("org.jetbrains.kotlin", "kotlin-test", "2.0.0"),
+                    DependencyScope::Test
+                ),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_gradle_runtime_configurations() {
+        let output = r"
+------------------------------------------------------------
+Project ':app'
+------------------------------------------------------------
+
+debugRuntimeClasspath - Resolved configuration for runtime for variant: debug
++--- androidx.core:core-ktx:1.13.1
+\--- com.squareup.leakcanary:leakcanary-android:2.14
+
+releaseRuntimeClasspath - Resolved configuration for runtime for variant: release
+\--- androidx.core:core-ktx:1.13.1
+
+releaseUnitTestRuntimeClasspath - Resolved configuration for runtime for variant: releaseUnitTest
+\--- junit:junit:4.13.2
+
+iosArm64CompileKlibraries - Dependencies used to compile klibs for 'iosArm64'
++--- org.jetbrains.kotlinx:kotlinx-coroutines-core:1.8.0
+\--- org.jetbrains.kotlinx:kotlinx-coroutines-core-iosarm64:1.8.0
+
+kapt - Annotation processors
+\--- com.google.dagger:hilt-compiler:2.51
+";
+
+        let coordinates = collapse_platform_variants(parse_gradle_runtime_configurations(output));
+        assert_eq!(
+            coordinates,
+            vec![
+                (
+                    MavenCoordinate::new("androidx.core", "core-ktx", "1.13.1"),
+                    DependencyScope::Runtime
+                ),
+                (
+                    MavenCoordinate::new("com.squareup.leakcanary", "leakcanary-android", "2.14"),
+                    DependencyScope::Dev
+                ),
+                (
+                    MavenCoordinate::new(
+                        "org.jetbrains.kotlinx",
+                        "kotlinx-coroutines-core",
+                        "1.8.0"
+                    ),
+                    DependencyScope::Runtime
+                ),
+            ]
+        );
+    }
+
+    /// A ZIP archive made of just a central directory, enough to list entry names
+    fn zip_listing(names: &[&str]) -> Vec<u8> {
+        let mut data = b"local file data".to_vec();
+        let offset = data.len() as u32;
+        for name in names {
+            let mut entry = vec![0u8; 46];
+            entry[..4].copy_from_slice(&[0x50, 0x4b, 0x01, 0x02]);
+            entry[28..30].copy_from_slice(&(name.len() as u16).to_le_bytes());
+            entry.extend_from_slice(name.as_bytes());
+            data.extend(entry);
+        }
+        let mut end = vec![0u8; 22];
+        end[..4].copy_from_slice(&[0x50, 0x4b, 0x05, 0x06]);
+        end[10..12].copy_from_slice(&(names.len() as u16).to_le_bytes());
+        end[16..20].copy_from_slice(&offset.to_le_bytes());
+        data.extend(end);
+        data
+    }
+
+    #[test]
+    fn test_aar_native_libraries() {
+        let temp_dir = TempDir::new().unwrap();
+        let aar = temp_dir.path().join("sqlcipher-android-4.5.6.aar");
+        fs::write(
+            &aar,
+            zip_listing(&[
+                "AndroidManifest.xml",
+                "classes.jar",
+                "jni/arm64-v8a/libsqlcipher.so",
+                "jni/x86_64/libsqlcipher.so",
+                "jni/arm64-v8a/libc++_shared.so",
+                "res/values/values.xml",
+            ]),
+        )
+        .unwrap();
+
+        assert_eq!(
+            aar_native_libraries(&aar),
+            vec!["libc++_shared.so", "libsqlcipher.so"]
+        );
+        assert!(zip_entry_names(b"not a zip").is_empty());
+    }
+}
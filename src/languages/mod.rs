@@ -1,15 +1,30 @@
 //! Language-specific parsing and license analysis modules
 
+pub mod bazel;
 pub mod c;
 pub mod cpp;
+pub mod dart;
 pub mod dotnet;
+pub mod elixir;
 pub mod go;
+pub mod guix;
+pub mod haskell;
+pub mod java;
+pub mod nix;
 pub mod node;
+pub mod ocaml;
+pub mod php;
 pub mod python;
 pub mod r;
+pub mod ruby;
 pub mod rust;
+pub mod swift;
+pub mod terraform;
 
-use crate::licenses::LicenseInfo;
+use crate::config::FeludaConfig;
+use crate::debug::{log, LogLevel};
+use crate::licenses::{get_osi_status, is_license_restrictive, License, LicenseInfo};
+use std::collections::HashMap;
 use std::path::Path;
 
 /// Common trait for language-specific dependency parsers
@@ -31,14 +46,26 @@ pub trait LanguageParser {
 /// Language identification
 #[derive(Debug, PartialEq, Clone, Copy)]
 pub enum Language {
+    Bazel(&'static [&'static str]),
     C(&'static [&'static str]),
     Cpp(&'static [&'static str]),
     DotNet(&'static [&'static str]),
     Rust(&'static str),
     Node(&'static str),
     Go(&'static str),
+    Java(&'static [&'static str]),
     Python(&'static [&'static str]),
     R(&'static [&'static str]),
+    Ruby(&'static str),
+    Php(&'static str),
+    Dart(&'static str),
+    Elixir(&'static str),
+    Swift(&'static [&'static str]),
+    Terraform(&'static [&'static str]),
+    Haskell(&'static [&'static str]),
+    OCaml(&'static [&'static str]),
+    Nix(&'static [&'static str]),
+    Guix(&'static [&'static str]),
 }
 
 impl Language {
@@ -47,13 +74,26 @@ impl Language {
             "Cargo.toml" => Some(Language::Rust("Cargo.toml")),
             "package.json" => Some(Language::Node("package.json")),
             "go.mod" => Some(Language::Go("go.mod")),
+            "Gemfile.lock" => Some(Language::Ruby("Gemfile.lock")),
+            "composer.lock" => Some(Language::Php("composer.lock")),
+            "pubspec.lock" => Some(Language::Dart("pubspec.lock")),
+            "mix.lock" => Some(Language::Elixir("mix.lock")),
+            "Package.resolved" | "Package.swift" => Some(Language::Swift(&SWIFT_PATHS[..])),
             "vcpkg.json" => Some(Language::Cpp(&CPP_PATHS[..])),
-            "conanfile.txt" | "conanfile.py" => Some(Language::Cpp(&CPP_PATHS[..])),
-            "MODULE.bazel" => Some(Language::Cpp(&CPP_PATHS[..])),
+            "conanfile.txt" | "conanfile.py" | "conan.lock" => Some(Language::Cpp(&CPP_PATHS[..])),
+            "MODULE.bazel" | "WORKSPACE.bazel" | "WORKSPACE" => {
+                Some(Language::Bazel(&BAZEL_PATHS[..]))
+            }
             "configure.ac" | "configure.in" | "Makefile" => Some(Language::C(&C_PATHS[..])),
             "CMakeLists.txt" => Some(Language::Cpp(&CPP_PATHS[..])),
+            "cabal.project.freeze" | "stack.yaml.lock" => {
+                Some(Language::Haskell(&HASKELL_PATHS[..]))
+            }
+            "flake.lock" | "flake.nix" => Some(Language::Nix(&NIX_PATHS[..])),
+            "manifest.scm" | "guix.scm" => Some(Language::Guix(&GUIX_PATHS[..])),
             _ => {
-                if file_name.ends_with(".csproj")
+                if file_name == "paket.lock"
+                    || file_name.ends_with(".csproj")
                     || file_name.ends_with(".fsproj")
                     || file_name.ends_with(".vbproj")
                     || file_name.ends_with(".slnx")
@@ -61,8 +101,16 @@ impl Language {
                     Some(Language::DotNet(&DOTNET_PATHS[..]))
                 } else if PYTHON_PATHS.contains(&file_name) {
                     Some(Language::Python(&PYTHON_PATHS[..]))
+                } else if JAVA_PATHS.contains(&file_name) {
+                    Some(Language::Java(&JAVA_PATHS[..]))
                 } else if R_PATHS.contains(&file_name) {
                     Some(Language::R(&R_PATHS[..]))
+                } else if swift::is_xcode_bundle(file_name) {
+                    Some(Language::Swift(&SWIFT_PATHS[..]))
+                } else if file_name == terraform::TERRAFORM_LOCKFILE || file_name.ends_with(".tf") {
+                    Some(Language::Terraform(&TERRAFORM_PATHS[..]))
+                } else if file_name.ends_with(ocaml::OPAM_LOCKFILE_SUFFIX) {
+                    Some(Language::OCaml(&OCAML_PATHS[..]))
                 } else {
                     None
                 }
@@ -79,20 +127,90 @@ pub const CPP_PATHS: [&str; 5] = [
     "vcpkg.json",
     "conanfile.txt",
     "conanfile.py",
+    "conan.lock",
     "CMakeLists.txt",
-    "MODULE.bazel",
 ];
 
+/// Bazel workspace files, in order of preference
+pub const BAZEL_PATHS: [&str; 3] = ["MODULE.bazel", "WORKSPACE.bazel", "WORKSPACE"];
+
 /// Python project file patterns
-pub const PYTHON_PATHS: [&str; 4] = [
+pub const PYTHON_PATHS: [&str; 5] = [
     "requirements.txt",
     "Pipfile.lock",
+    "poetry.lock",
     "pip_freeze.txt",
     "pyproject.toml",
 ];
 
+/// Java project file patterns, in order of preference
+pub const JAVA_PATHS: [&str; 6] = [
+    "pom.xml",
+    "gradle.lockfile",
+    "build.gradle.kts",
+    "build.gradle",
+    "settings.gradle.kts",
+    "settings.gradle",
+];
+
 /// R project file patterns
 pub const R_PATHS: [&str; 2] = ["DESCRIPTION", "renv.lock"];
 
-/// .NET project file patterns
-pub const DOTNET_PATHS: [&str; 4] = [".csproj", ".fsproj", ".vbproj", ".slnx"];
+/// Swift project file patterns; Xcode projects are found by their bundle directories
+pub const SWIFT_PATHS: [&str; 2] = ["Package.resolved", "Package.swift"];
+
+/// Terraform and OpenTofu configuration files; any `.tf` file makes a configuration
+pub const TERRAFORM_PATHS: [&str; 2] = [terraform::TERRAFORM_LOCKFILE, ".tf"];
+
+/// .NET project file patterns, in order of preference
+pub const DOTNET_PATHS: [&str; 5] = ["paket.lock", ".csproj", ".fsproj", ".vbproj", ".slnx"];
+
+/// Haskell lockfiles, in order of preference
+pub const HASKELL_PATHS: [&str; 2] = ["cabal.project.freeze", "stack.yaml.lock"];
+
+/// OCaml lockfiles written by `opam lock`, one `<package>.opam.locked` per package
+pub const OCAML_PATHS: [&str; 1] = [ocaml::OPAM_LOCKFILE_SUFFIX];
+
+/// Nix flake files, in order of preference
+pub const NIX_PATHS: [&str; 2] = ["flake.lock", "flake.nix"];
+
+/// Guix manifests and package definitions, in order of preference
+pub const GUIX_PATHS: [&str; 2] = ["manifest.scm", "guix.scm"];
+
+/// The dependency `name` at `version` with the license found for it, or
+/// "Unknown" with a warning when there was none
+fn license_info(
+    name: String,
+    version: String,
+    license: Option<String>,
+    license_confidence: Option<f32>,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+) -> LicenseInfo {
+    let license = license.unwrap_or_else(|| {
+        log(
+            LogLevel::Warn,
+            &format!("No license found for {name} ({version})"),
+        );
+        "Unknown".to_string()
+    });
+    let osi_status = get_osi_status(&license);
+    let license = Some(license);
+    let is_restrictive = is_license_restrictive(&license, known_licenses, config.strict);
+    if is_restrictive {
+        log(
+            LogLevel::Warn,
+            &format!("Restrictive license found: {license:?} for {name}"),
+        );
+    }
+
+    LicenseInfo {
+        name,
+        version,
+        license,
+        is_restrictive,
+        osi_status,
+        license_confidence,
+        ..LicenseInfo::default()
+    }
+}
@@ -0,0 +1,751 @@
+//! Nix flakes
+//!
+//! Two kinds of dependencies are reported for a flake. Its inputs are pinned
+//! in `flake.lock`, and their licenses are read from the license file of each
+//! repository at the locked revision. The packages it builds on are found by
+//! evaluating the flake with `nix eval`: the inputs of its `packages` and
+//! `devShells` with their `meta.license`, following `propagatedBuildInputs`.
+//! Without `nix`, or with `--no-local`, the package lists of `flake.nix` are
+//! read instead, and licenses come from the `pkgs/by-name` expressions of the
+//! locked nixpkgs revision.
+
+use rayon::prelude::*;
+use regex::Regex;
+use serde::Deserialize;
+use serde_json::Value;
+use std::collections::{BTreeMap, HashMap, HashSet, VecDeque};
+use std::fs;
+use std::path::Path;
+use std::process::Command;
+use std::sync::OnceLock;
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, attach_dependency_scopes, DependencyGraph,
+};
+use crate::languages::{license_info, NIX_PATHS};
+use crate::licenses::{fetch_licenses_from_github, DependencyScope, LicenseInfo};
+use crate::offline::is_offline;
+use crate::registry::{self, Registry};
+use crate::repository_license::fetch_repository_license;
+
+/// Expressions of the nixpkgs repository
+const NIXPKGS: &str = "https://raw.githubusercontent.com/NixOS/nixpkgs";
+
+/// SPDX identifiers of the attributes of `lib.licenses` in nixpkgs
+const NIXPKGS_LICENSES: [(&str, &str); 40] = [
+    ("mit", "MIT"),
+    ("mit0", "MIT-0"),
+    ("asl20", "Apache-2.0"),
+    ("bsd0", "0BSD"),
+    ("bsd2", "BSD-2-Clause"),
+    ("bsd3", "BSD-3-Clause"),
+    ("bsdOriginal", "BSD-4-Clause"),
+    ("isc", "ISC"),
+    ("zlib", "Zlib"),
+    ("unlicense", "Unlicense"),
+    ("cc0", "CC0-1.0"),
+    ("wtfpl", "WTFPL"),
+    ("boost", "BSL-1.0"),
+    ("psfl", "PSF-2.0"),
+    ("artistic2", "Artistic-2.0"),
+    ("publicDomain", "LicenseRef-PublicDomain"),
+    ("mpl20", "MPL-2.0"),
+    ("epl20", "EPL-2.0"),
+    ("cddl", "CDDL-1.0"),
+    ("gpl2Only", "GPL-2.0-only"),
+    ("gpl2Plus", "GPL-2.0-or-later"),
+    ("gpl2", "GPL-2.0-only"),
+    ("gpl3Only", "GPL-3.0-only"),
+    ("gpl3Plus", "GPL-3.0-or-later"),
+    ("gpl3", "GPL-3.0-only"),
+    ("lgpl2Only", "LGPL-2.0-only"),
+    ("lgpl2Plus", "LGPL-2.0-or-later"),
+    ("lgpl21Only", "LGPL-2.1-only"),
+    ("lgpl21Plus", "LGPL-2.1-or-later"),
+    ("lgpl21", "LGPL-2.1-only"),
+    ("lgpl3Only", "LGPL-3.0-only"),
+    ("lgpl3Plus", "LGPL-3.0-or-later"),
+    ("lgpl3", "LGPL-3.0-only"),
+    ("agpl3Only", "AGPL-3.0-only"),
+    ("agpl3Plus", "AGPL-3.0-or-later"),
+    ("sspl", "SSPL-1.0"),
+    ("bsl11", "BUSL-1.1"),
+    ("openssl", "OpenSSL"),
+    ("curl", "curl"),
+    ("unfree", "LicenseRef-nixpkgs-unfree"),
+];
+
+/// Inputs of the flake's packages and dev shells, with the propagated ones
+/// they bring along; `@FLAKE@` is replaced by the flake's directory
+const EVAL_EXPRESSION: &str = r#"
+let
+  flake = builtins.getFlake "@FLAKE@";
+  system = builtins.currentSystem;
+  isDrv = x: builtins.isAttrs x && (x.type or null) == "derivation";
+  inputs = kind: drv:
+    let list = drv.${kind} or [ ]; in
+    if builtins.isList list then builtins.filter isDrv list else [ ];
+  item = scope: parent: drv: { key = drv.name; inherit drv scope parent; };
+  from = scope: kinds: roots: builtins.concatMap
+    (root: builtins.concatMap (kind: map (item scope null) (inputs kind root)) kinds)
+    roots;
+  outputs = name:
+    builtins.filter isDrv (builtins.attrValues (flake.outputs.${name}.${system} or { }));
+  packages = outputs "packages";
+  shells = outputs "devShells";
+  own = map (drv: drv.name) (packages ++ shells);
+  closure = builtins.genericClosure {
+    startSet = from "runtime" [ "buildInputs" "propagatedBuildInputs" ] packages
+      ++ from "build" [ "nativeBuildInputs" "propagatedNativeBuildInputs" ] packages
+      ++ from "dev" [ "buildInputs" "nativeBuildInputs" ] shells;
+    operator = i: map (item i.scope i.key) (inputs "propagatedBuildInputs" i.drv);
+  };
+  spdx = l:
+    if builtins.isString l then l else l.spdxId or l.shortName or l.fullName or "Unknown";
+  licenses = drv:
+    let l = drv.meta.license or [ ]; in
+    map spdx (if builtins.isList l then l else [ l ]);
+  parsed = drv: builtins.parseDrvName drv.name;
+in
+map (i: {
+  inherit (i) key scope parent;
+  name = i.drv.pname or (parsed i.drv).name;
+  version = i.drv.version or (parsed i.drv).version;
+  licenses = licenses i.drv;
+}) (builtins.filter (i: !(builtins.elem i.key own)) closure)
+"#;
+
+/// An input of `flake.lock`
+#[derive(Debug, Clone, PartialEq)]
+pub struct FlakeInput {
+    /// Node of the lockfile, e.g. `nixpkgs_2`
+    pub id: String,
+    /// Name the input is referred to by
+    pub name: String,
+    /// Short locked revision
+    pub version: String,
+    /// Repository and full revision, for inputs fetched from git
+    pub source: Option<(String, String)>,
+    /// Inputs of this input, by node
+    pub inputs: Vec<String>,
+}
+
+/// A package the flake builds on, as evaluated by [`EVAL_EXPRESSION`]
+#[derive(Debug, Clone, PartialEq, Deserialize)]
+pub struct NixPackage {
+    /// Derivation name, e.g. `openssl-3.0.13`
+    pub key: String,
+    pub name: String,
+    pub version: String,
+    #[serde(default)]
+    pub licenses: Vec<String>,
+    pub scope: DependencyScope,
+    /// Package that propagated this one
+    #[serde(default)]
+    pub parent: Option<String>,
+}
+
+/// The file dependencies are reported from, in order of preference
+pub fn find_manifest(project_dir: &Path) -> Option<String> {
+    NIX_PATHS
+        .iter()
+        .find(|file| project_dir.join(file).is_file())
+        .map(|file| file.to_string())
+}
+
+pub fn analyze_nix_licenses(
+    project_dir: &Path,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing Nix dependencies in: {}", project_dir.display()),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+    let direct_only = config.dependencies.max_depth <= 1;
+
+    let (roots, inputs) = fs::read_to_string(project_dir.join("flake.lock"))
+        .ok()
+        .and_then(|content| parse_flake_lock(&content))
+        .unwrap_or_default();
+    let nixpkgs_revision = inputs
+        .iter()
+        .find(|input| roots.contains(&input.id) && input.name == "nixpkgs")
+        .and_then(|input| input.source.as_ref().map(|(_, rev)| rev.clone()));
+
+    let mut graph = DependencyGraph::new();
+    let inputs: Vec<FlakeInput> = inputs
+        .into_iter()
+        .filter(|input| !direct_only || roots.contains(&input.id))
+        .collect();
+    for input in &inputs {
+        graph.add_package(&input.id, &input.name, &input.version);
+    }
+    for input in &inputs {
+        if roots.contains(&input.id) {
+            graph.add_direct_with_scope(&input.id, DependencyScope::Build);
+        }
+        for dependency in &input.inputs {
+            graph.add_dependency(&input.id, dependency);
+        }
+    }
+    log_debug("Flake inputs", &inputs);
+
+    let evaluated = if no_local {
+        None
+    } else {
+        evaluate_flake(project_dir)
+    };
+    let packages = match evaluated {
+        Some(packages) => packages,
+        None => fs::read_to_string(project_dir.join("flake.nix"))
+            .map(|content| {
+                parse_package_lists(&content)
+                    .into_par_iter()
+                    .map(|(name, scope)| {
+                        let (version, licenses) = match &nixpkgs_revision {
+                            Some(revision) => time_dependency("nixpkgs", &name, revision, || {
+                                fetch_package_from_nixpkgs(&name, revision)
+                            }),
+                            None => (None, Vec::new()),
+                        };
+                        NixPackage {
+                            key: name.clone(),
+                            name,
+                            version: version.unwrap_or_else(|| "unknown".to_string()),
+                            licenses,
+                            scope,
+                            parent: None,
+                        }
+                    })
+                    .collect()
+            })
+            .unwrap_or_default(),
+    };
+    let packages: Vec<NixPackage> = packages
+        .into_iter()
+        .filter(|package| !direct_only || package.parent.is_none())
+        .collect();
+    for package in &packages {
+        graph.add_package(&package.key, &package.name, &package.version);
+    }
+    for package in &packages {
+        match &package.parent {
+            Some(parent) => graph.add_dependency(parent, &package.key),
+            None => graph.add_direct_with_scope(&package.key, package.scope),
+        }
+    }
+    log(
+        LogLevel::Info,
+        &format!(
+            "Found {} flake inputs and {} Nix packages",
+            inputs.len(),
+            packages.len()
+        ),
+    );
+    log_debug("Nix packages", &packages);
+
+    let mut licenses: Vec<LicenseInfo> = inputs
+        .into_par_iter()
+        .map(|input| {
+            let (license, confidence) = match &input.source {
+                Some((repository, revision)) => {
+                    time_dependency("nix", &input.name, &input.version, || {
+                        fetch_repository_license(repository, revision)
+                    })
+                    .map_or((None, None), |(license, confidence)| {
+                        (Some(license), Some(confidence))
+                    })
+                }
+                None => (None, None),
+            };
+            LicenseInfo {
+                repository: input.source.map(|(repository, _)| repository),
+                ..license_info(
+                    input.name,
+                    input.version,
+                    license,
+                    confidence,
+                    &known_licenses,
+                    config,
+                )
+            }
+        })
+        .collect();
+    licenses.extend(packages.into_iter().map(|package| {
+        let license = license_expression(&package.licenses);
+        license_info(
+            package.name,
+            package.version,
+            license,
+            None,
+            &known_licenses,
+            config,
+        )
+    }));
+
+    attach_dependency_paths(&mut licenses, &graph.paths());
+    attach_dependency_requires(&mut licenses, &graph.requires());
+    attach_dependency_scopes(&mut licenses, &graph.scopes());
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} Nix dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+/// The inputs of the root node and every input of the lockfile, in the order they are reached
+///
+/// Inputs that `follow` another one are the same node and not repeated, and
+/// local `path` inputs are part of the project.
+pub fn parse_flake_lock(content: &str) -> Option<(HashSet<String>, Vec<FlakeInput>)> {
+    let lock: Value = serde_json::from_str(content)
+        .map_err(|err| log_error("Failed to parse flake.lock", &err))
+        .ok()?;
+    let nodes = lock["nodes"].as_object()?;
+    let root = lock["root"].as_str().unwrap_or("root");
+
+    // An input is a node name, or the path of inputs it follows from the root
+    let resolve = |reference: &Value| -> Option<String> {
+        match reference {
+            Value::String(node) => Some(node.clone()),
+            Value::Array(path) => {
+                let mut node = root.to_string();
+                for name in path {
+                    node = nodes.get(&node)?["inputs"][name.as_str()?]
+                        .as_str()?
+                        .to_string();
+                }
+                Some(node)
+            }
+            _ => None,
+        }
+    };
+    let inputs_of = |node: &str| -> Vec<(String, String)> {
+        nodes
+            .get(node)
+            .and_then(|node| node["inputs"].as_object())
+            .map(|inputs| {
+                inputs
+                    .iter()
+                    .filter_map(|(name, reference)| Some((name.clone(), resolve(reference)?)))
+                    .collect()
+            })
+            .unwrap_or_default()
+    };
+
+    let roots: HashSet<String> = inputs_of(root).into_iter().map(|(_, id)| id).collect();
+    let mut queue: VecDeque<(String, String)> = inputs_of(root).into_iter().collect();
+    let mut seen = HashSet::new();
+    let mut inputs = Vec::new();
+    while let Some((name, id)) = queue.pop_front() {
+        if !seen.insert(id.clone()) {
+            continue;
+        }
+        let Some(node) = nodes.get(&id) else {
+            continue;
+        };
+        let locked = &node["locked"];
+        let kind = locked["type"].as_str().unwrap_or_default();
+        if kind == "path" {
+            continue;
+        }
+        let revision = locked["rev"].as_str().unwrap_or_default();
+        let source = match kind {
+            "github" => locked["owner"]
+                .as_str()
+                .zip(locked["repo"].as_str())
+                .map(|(owner, repo)| format!("https://github.com/{owner}/{repo}")),
+            "git" => locked["url"].as_str().map(str::to_string),
+            _ => None,
+        }
+        .filter(|_| !revision.is_empty())
+        .map(|repository| (repository, revision.to_string()));
+        let version = if revision.is_empty() {
+            locked["narHash"]
+                .as_str()
+                .map(|hash| {
+                    hash.trim_start_matches("sha256-")
+                        .chars()
+                        .take(12)
+                        .collect()
+                })
+                .unwrap_or_else(|| "unknown".to_string())
+        } else {
+            revision.chars().take(7).collect()
+        };
+
+        let dependencies = inputs_of(&id);
+        queue.extend(dependencies.iter().cloned());
+        inputs.push(FlakeInput {
+            id: id.clone(),
+            name,
+            version,
+            source,
+            inputs: dependencies.into_iter().map(|(_, id)| id).collect(),
+        });
+    }
+    Some((roots, inputs))
+}
+
+/// Run `nix eval` on the flake, `None` when nix is missing or evaluation fails
+fn evaluate_flake(project_dir: &Path) -> Option<Vec<NixPackage>> {
+    let directory = project_dir.canonicalize().ok()?;
+    let expression = EVAL_EXPRESSION.replace("@FLAKE@", &nix_string(&directory.to_string_lossy()));
+    let mut command = Command::new("nix");
+    command.args([
+        "--extra-experimental-features",
+        "nix-command flakes",
+        "eval",
+        "--json",
+        "--impure",
+        "--expr",
+        &expression,
+    ]);
+    if is_offline() {
+        command.arg("--offline");
+    }
+
+    log(
+        LogLevel::Info,
+        &format!("Evaluating flake {}", directory.display()),
+    );
+    let output = match command.output() {
+        Ok(output) => output,
+        Err(_) => {
+            log(
+                LogLevel::Warn,
+                "nix is not installed, reading the package lists of flake.nix",
+            );
+            return None;
+        }
+    };
+    if !output.status.success() {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "nix eval failed, reading the package lists of flake.nix: {}",
+                String::from_utf8_lossy(&output.stderr).trim()
+            ),
+        );
+        return None;
+    }
+    serde_json::from_slice(&output.stdout)
+        .map_err(|err| log_error("Failed to parse the output of nix eval", &err))
+        .ok()
+}
+
+/// Nix string contents: quotes, backslashes and interpolations escaped
+fn nix_string(value: &str) -> String {
+    value
+        .replace('\\', "\\\\")
+        .replace('"', "\\\"")
+        .replace("${", "\\${")
+}
+
+/// nixpkgs attributes listed in the package lists of a Nix file
+///
+/// Attributes are only taken from `pkgs.name` or from lists under
+/// `with pkgs;`. Packages of `packages` (`mkShell`) are dev dependencies, and
+/// those of `nativeBuildInputs` build dependencies.
+fn parse_package_lists(content: &str) -> Vec<(String, DependencyScope)> {
+    let content: String = content
+        .lines()
+        .map(|line| line.split_once('#').map_or(line, |(code, _)| code))
+        .collect::<Vec<_>>()
+        .join("\n");
+
+    // e.g. `buildInputs = with pkgs; [ openssl ];`
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    let pattern = PATTERN.get_or_init(|| {
+        Regex::new(
+            r"\b(buildInputs|propagatedBuildInputs|nativeBuildInputs|packages)\s*=\s*(with\s+pkgs\s*;\s*)?\[([^\]]*)\]",
+        )
+        .expect("valid package list pattern")
+    });
+
+    let mut packages: BTreeMap<String, DependencyScope> = BTreeMap::new();
+    for captures in pattern.captures_iter(&content) {
+        let scope = match &captures[1] {
+            "packages" => DependencyScope::Dev,
+            "nativeBuildInputs" => DependencyScope::Build,
+            _ => DependencyScope::Runtime,
+        };
+        let with_pkgs = captures.get(2).is_some();
+        for token in captures[3].split_whitespace() {
+            let name = match token.strip_prefix("pkgs.") {
+                Some(name) => name,
+                None if with_pkgs => token,
+                None => continue,
+            };
+            let is_attribute = name
+                .chars()
+                .next()
+                .is_some_and(|c| c.is_ascii_alphabetic() || c == '_')
+                && name
+                    .chars()
+                    .all(|c| c.is_ascii_alphanumeric() || matches!(c, '_' | '-' | '\''));
+            if !is_attribute {
+                continue;
+            }
+            packages
+                .entry(name.to_string())
+                .and_modify(|existing| {
+                    if scope.is_runtime()
+                        || (scope == DependencyScope::Build && !existing.is_runtime())
+                    {
+                        *existing = scope;
+                    }
+                })
+                .or_insert(scope);
+        }
+    }
+    packages.into_iter().collect()
+}
+
+/// Version and licenses of a package in `pkgs/by-name` of a nixpkgs revision
+fn fetch_package_from_nixpkgs(attribute: &str, revision: &str) -> (Option<String>, Vec<String>) {
+    let shard: String = attribute.chars().take(2).collect::<String>().to_lowercase();
+    let url = format!("{NIXPKGS}/{revision}/pkgs/by-name/{shard}/{attribute}/package.nix");
+    log(LogLevel::Info, &format!("Fetching Nix expression: {url}"));
+    match registry::get(Registry::GitHub, &url) {
+        Ok(response) if response.status().is_success() => response
+            .text()
+            .map(|expression| parse_package_expression(&expression))
+            .unwrap_or_default(),
+        Ok(_) => {
+            log(
+                LogLevel::Warn,
+                &format!("{attribute} is not in pkgs/by-name of nixpkgs, install nix to evaluate its license"),
+            );
+            (None, Vec::new())
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch {attribute}"), &err);
+            (None, Vec::new())
+        }
+    }
+}
+
+/// The `version` and `meta.license` of a package expression
+fn parse_package_expression(expression: &str) -> (Option<String>, Vec<String>) {
+    static VERSION: OnceLock<Regex> = OnceLock::new();
+    static LICENSE: OnceLock<Regex> = OnceLock::new();
+    let version = VERSION
+        .get_or_init(|| Regex::new(r#"\bversion\s*=\s*"([^"$]+)""#).expect("valid version pattern"))
+        .captures(expression)
+        .map(|captures| captures[1].to_string());
+    let licenses = LICENSE
+        .get_or_init(|| {
+            Regex::new(r"\blicense\s*=\s*((?:with\s+[\w.]+\s*;)?[^;]+);")
+                .expect("valid license pattern")
+        })
+        .captures(expression)
+        .map(|captures| {
+            captures[1]
+                .replace("with lib.licenses", "")
+                .split(|c: char| c.is_whitespace() || matches!(c, '[' | ']' | '(' | ')' | ';'))
+                .filter_map(|token| {
+                    let attribute = token.rsplit('.').next()?;
+                    NIXPKGS_LICENSES
+                        .iter()
+                        .find(|(name, _)| *name == attribute)
+                        .map(|(_, spdx)| spdx.to_string())
+                })
+                .collect()
+        })
+        .unwrap_or_default();
+    (version, licenses)
+}
+
+/// SPDX expression of the licenses of a package; a list means all of them apply
+fn license_expression(licenses: &[String]) -> Option<String> {
+    let mut unique: Vec<&str> = Vec::new();
+    for license in licenses {
+        if !license.is_empty() && license != "Unknown" && !unique.contains(&license.as_str()) {
+            unique.push(license);
+        }
+    }
+    (!unique.is_empty()).then(|| unique.join(" AND "))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const FLAKE_LOCK: &str = r#"{
+  "nodes": {
+    "flake-utils": {
+      "inputs": { "systems": "systems" },
+      "locked": {
+        "lastModified": 1710146030,
+        "narHash": "sha256-SZ5L6eA7HJ/nmkzGG7/ISclqe6oZdOZTNoesiInkXPQ=",
+        "owner": "numtide",
+        "repo": "flake-utils",
+        "rev": "b1d9ab70662946ef0850d488da1c9019f3a9752a",
+        "type": "github"
+      }
+    },
+    "nixpkgs": {
+      "locked": {
+        "lastModified": 1712791164,
+        "narHash": "sha256-3sbWO1mbpWsLepZGbWaMovSO7ndZeFqDSdX0hZ9nVyw=",
+        "owner": "NixOS",
+        "repo": "nixpkgs",
+        "rev": "1042fd8b148a9105f3c0aca3a6177fd1d9360ba5",
+        "type": "github"
+      }
+    },
+    "root": {
+      "inputs": {
+        "flake-utils": "flake-utils",
+        "nixpkgs": "nixpkgs",
+        "overlay": "overlay",
+        "tools": ["flake-utils"]
+      }
+    },
+    "overlay": {
+      "locked": { "path": "./overlay", "type": "path" }
+    },
+    "systems": {
+      "locked": {
+        "narHash": "sha256-Vy1rq5AaRuLzOxct8nz4T6wlgyUR7zLU309k9mBC768=",
+        "type": "tarball",
+        "url": "https://github.com/nix-systems/default/archive/main.tar.gz"
+      }
+    }
+  },
+  "root": "root",
+  "version": 7
+}"#;
+
+    const FLAKE_NIX: &str = r#"{
+  outputs = { self, nixpkgs, flake-utils }:
+    flake-utils.lib.eachDefaultSystem (system:
+      let pkgs = nixpkgs.legacyPackages.${system}; in {
+        packages.default = pkgs.stdenv.mkDerivation {
+          pname = "app";
+          version = "0.1.0";
+          buildInputs = [ pkgs.openssl pkgs.zlib ];
+          nativeBuildInputs = with pkgs; [ pkg-config cmake ];
+        };
+        devShells.default = pkgs.mkShell {
+          # Tools for working on the project
+          packages = with pkgs; [ ripgrep openssl (python3.withPackages (ps: [ ps.requests ])) ];
+        };
+      });
+}"#;
+
+    #[test]
+    fn test_parse_flake_lock() {
+        let (roots, inputs) = parse_flake_lock(FLAKE_LOCK).unwrap();
+        let found: Vec<(&str, &str)> = inputs
+            .iter()
+            .map(|input| (input.name.as_str(), input.version.as_str()))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                ("flake-utils", "b1d9ab7"),
+                ("nixpkgs", "1042fd8"),
+                ("systems", "Vy1rq5AaRuLz"),
+            ]
+        );
+        assert_eq!(
+            roots,
+            HashSet::from([
+                "flake-utils".to_string(),
+                "nixpkgs".to_string(),
+                "overlay".to_string()
+            ])
+        );
+        assert_eq!(
+            inputs[1].source,
+            Some((
+                "https://github.com/NixOS/nixpkgs".to_string(),
+                "1042fd8b148a9105f3c0aca3a6177fd1d9360ba5".to_string()
+            ))
+        );
+        assert_eq!(inputs[0].inputs, vec!["systems"]);
+        assert_eq!(inputs[2].source, None);
+        assert!(parse_flake_lock("not json").is_none());
+    }
+
+    #[test]
+    fn test_parse_package_lists() {
+        assert_eq!(
+            parse_package_lists(FLAKE_NIX),
+            vec![
+                ("cmake".to_string(), DependencyScope::Build),
+                ("openssl".to_string(), DependencyScope::Runtime),
+                ("pkg-config".to_string(), DependencyScope::Build),
+                ("ripgrep".to_string(), DependencyScope::Dev),
+                ("zlib".to_string(), DependencyScope::Runtime),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_package_expression() {
+        let expression = r#"{ lib, rustPlatform, fetchFromGitHub }:
+rustPlatform.buildRustPackage rec {
+  pname = "ripgrep";
+  version = "14.1.0";
+  src = fetchFromGitHub { owner = "BurntSushi"; repo = pname; rev = version; };
+  meta = {
+    description = "A utility that combines the usability of The Silver Searcher with the raw speed of grep";
+    license = with lib.licenses; [ unlicense mit ];
+  };
+}"#;
+        assert_eq!(
+            parse_package_expression(expression),
+            (
+                Some("14.1.0".to_string()),
+                vec!["Unlicense".to_string(), "MIT".to_string()]
+            )
+        );
+        assert_eq!(
+            parse_package_expression("meta.license = lib.licenses.gpl3Plus;").1,
+            vec!["GPL-3.0-or-later"]
+        );
+    }
+
+    #[test]
+    fn test_evaluated_packages() {
+        let output = r#"[
+  {"key": "openssl-3.0.13", "name": "openssl", "version": "3.0.13", "licenses": ["Apache-2.0"], "scope": "runtime", "parent": null},
+  {"key": "pkg-config-wrapper-0.29.2", "name": "pkg-config-wrapper", "version": "0.29.2", "licenses": ["GPL-2.0-or-later", "GPL-2.0-or-later"], "scope": "build", "parent": null},
+  {"key": "zstd-1.5.5", "name": "zstd", "version": "1.5.5", "licenses": ["BSD-3-Clause", "GPL-2.0-only"], "scope": "runtime", "parent": "curl-8.6.0"}
+]"#;
+        let packages: Vec<NixPackage> = serde_json::from_str(output).unwrap();
+        assert_eq!(packages[1].scope, DependencyScope::Build);
+        assert_eq!(packages[2].parent.as_deref(), Some("curl-8.6.0"));
+        assert_eq!(
+            license_expression(&packages[1].licenses).as_deref(),
+            Some("GPL-2.0-or-later")
+        );
+        assert_eq!(
+            license_expression(&packages[2].licenses).as_deref(),
+            Some("BSD-3-Clause AND GPL-2.0-only")
+        );
+        assert_eq!(license_expression(&["Unknown".to_string()]), None);
+        assert_eq!(nix_string(r#"/src/"a"/${x}"#), r#"/src/\"a\"/\${x}"#);
+    }
+}
@@ -6,10 +6,18 @@ use std::fs;
 use std::path::{Path, PathBuf};
 use std::process::Command;
 
-use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::cache::{cache_license, get_cached_license};
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, attach_dependency_scopes, DependencyGraph,
+};
+use crate::license_detector::detect_license_in_dir;
 use crate::licenses::{
-    fetch_licenses_from_github, is_license_restrictive, LicenseCompatibility, LicenseInfo,
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
 };
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
 
 /// Type alias for dependency detection
 type DependencyDetector = fn(&Path) -> Result<HashMap<String, String>, String>;
@@ -147,14 +155,15 @@ impl DependencyResolver {
         version_spec: &str,
     ) -> Result<PackageMetadata, String> {
         let clean_version = clean_version_string(version_spec);
+        let registry_url = registry::npm_registry(name);
         let url = if clean_version == "latest" || clean_version.is_empty() {
-            format!("https://registry.npmjs.org/{name}")
+            format!("{registry_url}/{name}")
         } else {
-            format!("https://registry.npmjs.org/{name}/{clean_version}")
+            format!("{registry_url}/{name}/{clean_version}")
         };
 
-        let response =
-            reqwest::blocking::get(&url).map_err(|e| format!("Registry request failed: {e}"))?;
+        let response = registry::get(Registry::Npm, &url)
+            .map_err(|e| format!("Registry request failed: {e}"))?;
 
         if !response.status().is_success() {
             return Err(format!("Registry returned status: {}", response.status()));
@@ -275,6 +284,7 @@ pub fn analyze_js_licenses_with_config(
     let project_root = Path::new(package_json_path)
         .parent()
         .unwrap_or(Path::new("."));
+    crate::credentials::load_project_npmrc(project_root);
 
     let all_dependencies = if project_root.join("pnpm-lock.yaml").exists() {
         log(
@@ -319,10 +329,12 @@ pub fn analyze_js_licenses_with_config(
     };
 
     // Process dependencies in parallel
-    all_dependencies
+    let mut licenses: Vec<LicenseInfo> = all_dependencies
         .par_iter()
         .map(|(name, version)| {
-            let license = get_license_for_package(project_root, name, version, no_local);
+            let (license, license_confidence) = time_dependency("npm", name, version, || {
+                get_license_for_package(project_root, name, version, no_local)
+            });
             let is_restrictive =
                 is_license_restrictive(&Some(license.clone()), &known_licenses, config.strict);
 
@@ -340,9 +352,36 @@ pub fn analyze_js_licenses_with_config(
                 is_restrictive,
                 compatibility: LicenseCompatibility::Unknown,
                 osi_status: crate::licenses::get_osi_status(&license),
+                license_confidence,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: DependencyScope::Runtime,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
             }
         })
-        .collect()
+        .collect();
+
+    if let Some(graph) = npm_lock_dependency_graph(project_root) {
+        attach_dependency_paths(&mut licenses, &graph.paths());
+        attach_dependency_requires(&mut licenses, &graph.requires());
+        attach_dependency_scopes(&mut licenses, &graph.scopes());
+    }
+    licenses
 }
 
 fn try_all_dependency_detection_methods(
@@ -849,30 +888,83 @@ fn parse_pnpm_lockfile(project_root: &Path) -> Option<HashMap<String, String>> {
 
     log(LogLevel::Info, "Parsing pnpm-lock.yaml");
 
-    if let Ok(content) = fs::read_to_string(&lockfile_path) {
-        let mut deps = HashMap::new();
+    let content = fs::read_to_string(&lockfile_path).ok()?;
+    let deps = parse_pnpm_lock_content(&content);
 
-        for line in content.lines() {
-            if line.trim().starts_with('/') && line.contains(':') {
-                if let Some(pkg_info) = line.trim().strip_prefix('/') {
-                    if let Some(colon_pos) = pkg_info.find(':') {
-                        let pkg_with_version = &pkg_info[..colon_pos];
-                        if let Some((pkg_name, version)) = pkg_with_version.rsplit_once('@') {
-                            deps.insert(pkg_name.to_string(), version.to_string());
-                        }
-                    }
-                }
+    log(
+        LogLevel::Info,
+        &format!("Parsed {} dependencies from pnpm-lock.yaml", deps.len()),
+    );
+    Some(deps)
+}
+
+/// Parse the `packages` and `snapshots` sections of a pnpm-lock.yaml
+///
+/// Handles the key formats of lockfile v5 (`/name/1.0.0_peer`), v6
+/// (`/name@1.0.0(peer)`) and v9 (`name@1.0.0`, `'@scope/name@1.0.0'`).
+pub(crate) fn parse_pnpm_lock_content(content: &str) -> HashMap<String, String> {
+    let mut deps = HashMap::new();
+    let mut lockfile_major = 6;
+    let mut section = "";
+
+    for line in content.lines() {
+        if line.trim().is_empty() || line.trim_start().starts_with('#') {
+            continue;
+        }
+
+        if !line.starts_with(' ') {
+            if let Some(version) = line.strip_prefix("lockfileVersion:") {
+                lockfile_major = version
+                    .trim()
+                    .trim_matches(|c| c == '\'' || c == '"')
+                    .split('.')
+                    .next()
+                    .and_then(|major| major.parse().ok())
+                    .unwrap_or(lockfile_major);
             }
+            section = line.trim_end_matches(':').trim();
+            continue;
         }
 
-        log(
-            LogLevel::Info,
-            &format!("Parsed {} dependencies from pnpm-lock.yaml", deps.len()),
-        );
-        Some(deps)
+        if !matches!(section, "packages" | "snapshots") {
+            continue;
+        }
+
+        // Package keys sit exactly one level below the section
+        let indent = line.len() - line.trim_start().len();
+        if indent != 2 || !line.trim_end().ends_with(':') {
+            continue;
+        }
+
+        let key = line.trim().trim_end_matches(':');
+        if let Some((name, version)) = parse_pnpm_package_key(key, lockfile_major) {
+            deps.insert(name, version);
+        }
+    }
+
+    deps
+}
+
+/// Split a pnpm-lock.yaml package key into name and exact version
+fn parse_pnpm_package_key(key: &str, lockfile_major: u32) -> Option<(String, String)> {
+    let key = key.trim_matches(|c| c == '\'' || c == '"');
+    let key = key.strip_prefix('/').unwrap_or(key);
+
+    let (name, version) = if lockfile_major < 6 {
+        // v5: /name/version or /@scope/name/version, peers appended after '_'
+        let (name, version) = key.rsplit_once('/')?;
+        (name, version.split('_').next().unwrap_or(version))
     } else {
-        None
+        // v6+: name@version, peers appended in parentheses
+        let key = key.split('(').next().unwrap_or(key);
+        key.rsplit_once('@')?
+    };
+
+    if name.is_empty() || !version.chars().next().is_some_and(|c| c.is_ascii_digit()) {
+        return None;
     }
+
+    Some((name.to_string(), version.to_string()))
 }
 
 fn parse_yarn_lockfile(project_root: &Path) -> Option<HashMap<String, String>> {
@@ -883,40 +975,66 @@ fn parse_yarn_lockfile(project_root: &Path) -> Option<HashMap<String, String>> {
 
     log(LogLevel::Info, "Parsing yarn.lock");
 
-    if let Ok(content) = fs::read_to_string(&lockfile_path) {
-        let mut deps = HashMap::new();
-        let mut current_package = None;
-
-        for line in content.lines() {
-            let trimmed = line.trim();
-
-            if !trimmed.is_empty()
-                && !trimmed.starts_with(' ')
-                && trimmed.contains('@')
-                && trimmed.ends_with(':')
-            {
-                let package_line = trimmed.trim_end_matches(':');
-                if let Some((name, _range)) = package_line.split_once('@') {
-                    current_package = Some(name.trim_matches('"').to_string());
-                }
-            }
+    let content = fs::read_to_string(&lockfile_path).ok()?;
+    let deps = parse_yarn_lock_content(&content);
 
-            if let Some(version_line) = trimmed.strip_prefix("version ") {
-                if let Some(ref pkg_name) = current_package {
-                    let version = version_line.trim_matches('"');
-                    deps.insert(pkg_name.clone(), version.to_string());
-                    current_package = None;
-                }
-            }
+    log(
+        LogLevel::Info,
+        &format!("Parsed {} dependencies from yarn.lock", deps.len()),
+    );
+    Some(deps)
+}
+
+/// Parse a yarn.lock in either the classic (v1) or Berry (v2+) format
+fn parse_yarn_lock_content(content: &str) -> HashMap<String, String> {
+    let mut deps = HashMap::new();
+    let mut current_package: Option<String> = None;
+
+    for line in content.lines() {
+        if line.trim().is_empty() || line.starts_with('#') {
+            continue;
         }
 
-        log(
-            LogLevel::Info,
-            &format!("Parsed {} dependencies from yarn.lock", deps.len()),
-        );
-        Some(deps)
-    } else {
+        // Entry headers are unindented, e.g. `"@babel/core@^7.0.0", "@babel/core@^7.1.0":`
+        if !line.starts_with(' ') {
+            current_package = line
+                .trim_end()
+                .strip_suffix(':')
+                .and_then(|header| header.split(',').next())
+                .and_then(yarn_descriptor_name);
+            continue;
+        }
+
+        let trimmed = line.trim();
+        let version = trimmed
+            .strip_prefix("version ")
+            .or_else(|| trimmed.strip_prefix("version:"));
+
+        if let (Some(version), Some(name)) = (version, current_package.take()) {
+            deps.insert(name, version.trim().trim_matches('"').to_string());
+        }
+    }
+
+    deps
+}
+
+/// Extract the package name from a yarn descriptor such as `@scope/pkg@npm:^1.0.0`
+fn yarn_descriptor_name(descriptor: &str) -> Option<String> {
+    let descriptor = descriptor.trim().trim_matches('"');
+
+    // Workspace and patch entries describe local code, not installed packages
+    if descriptor.contains("@workspace:") || descriptor.contains("@patch:") {
+        return None;
+    }
+
+    // Skip the leading '@' of scoped packages when looking for the range separator
+    let separator = descriptor.get(1..)?.find('@')? + 1;
+    let name = &descriptor[..separator];
+
+    if name.is_empty() {
         None
+    } else {
+        Some(name.to_string())
     }
 }
 
@@ -928,34 +1046,148 @@ fn parse_npm_lockfile(project_root: &Path) -> Option<HashMap<String, String>> {
 
     log(LogLevel::Info, "Parsing package-lock.json");
 
-    if let Ok(content) = fs::read_to_string(&lockfile_path) {
-        if let Ok(json) = serde_json::from_str::<Value>(&content) {
-            let mut deps = HashMap::new();
+    let content = fs::read_to_string(&lockfile_path).ok()?;
+    let json = serde_json::from_str::<Value>(&content).ok()?;
+    let deps = parse_npm_lock_content(&json);
 
-            if let Some(packages) = json.get("packages").and_then(|p| p.as_object()) {
-                for (path, info) in packages {
-                    if !path.is_empty() && !path.starts_with("node_modules/") {
-                        continue;
-                    }
+    log(
+        LogLevel::Info,
+        &format!("Parsed {} dependencies from package-lock.json", deps.len()),
+    );
+    Some(deps)
+}
 
-                    if let Some(name) = info.get("name").and_then(|n| n.as_str()) {
-                        if let Some(version) = info.get("version").and_then(|v| v.as_str()) {
-                            deps.insert(name.to_string(), version.to_string());
-                        }
-                    }
+/// Collect installed packages from a package-lock.json (lockfile v1, v2 and v3)
+fn parse_npm_lock_content(json: &Value) -> HashMap<String, String> {
+    let mut deps = HashMap::new();
+
+    if let Some(packages) = json.get("packages").and_then(|p| p.as_object()) {
+        // v2/v3: keys are install paths like node_modules/a/node_modules/b
+        for (path, info) in packages {
+            let Some((_, install_name)) = path.rsplit_once("node_modules/") else {
+                // The root package and workspace sources are not dependencies
+                continue;
+            };
+
+            if info.get("link").and_then(|l| l.as_bool()).unwrap_or(false) {
+                continue;
+            }
+
+            let name = info
+                .get("name")
+                .and_then(|n| n.as_str())
+                .unwrap_or(install_name);
+
+            if let Some(version) = info.get("version").and_then(|v| v.as_str()) {
+                // Hoisted copies win over nested ones when several versions are installed
+                if path.matches("node_modules/").count() == 1 {
+                    deps.insert(name.to_string(), version.to_string());
+                } else {
+                    deps.entry(name.to_string())
+                        .or_insert_with(|| version.to_string());
                 }
             }
+        }
+    } else if let Some(dependencies) = json.get("dependencies").and_then(|d| d.as_object()) {
+        // v1: nested dependency tree
+        collect_npm_v1_dependencies(dependencies, &mut deps);
+    }
 
-            log(
-                LogLevel::Info,
-                &format!("Parsed {} dependencies from package-lock.json", deps.len()),
-            );
-            Some(deps)
-        } else {
-            None
+    deps
+}
+
+/// Dependency graph from the install tree of a package-lock.json (v2 and v3)
+///
+/// Packages reached only through `devDependencies` get the `dev` scope.
+fn npm_lock_dependency_graph(project_root: &Path) -> Option<DependencyGraph> {
+    let content = fs::read_to_string(project_root.join("package-lock.json")).ok()?;
+    let json = serde_json::from_str::<Value>(&content).ok()?;
+    parse_npm_lock_dependency_graph(&json)
+}
+
+fn parse_npm_lock_dependency_graph(json: &Value) -> Option<DependencyGraph> {
+    let packages = json.get("packages")?.as_object()?;
+
+    let mut graph = DependencyGraph::new();
+    for (path, info) in packages {
+        let Some((_, install_name)) = path.rsplit_once("node_modules/") else {
+            continue;
+        };
+        let name = info
+            .get("name")
+            .and_then(|n| n.as_str())
+            .unwrap_or(install_name);
+        if let Some(version) = info.get("version").and_then(|v| v.as_str()) {
+            graph.add_package(path, name, version);
+        }
+    }
+
+    // Node resolves a dependency from the nearest node_modules directory upwards
+    let resolve = |from: &str, name: &str| -> Option<String> {
+        let mut base = from;
+        loop {
+            let candidate = if base.is_empty() {
+                format!("node_modules/{name}")
+            } else {
+                format!("{base}/node_modules/{name}")
+            };
+            if packages.contains_key(&candidate) {
+                return Some(candidate);
+            }
+            if base.is_empty() {
+                return None;
+            }
+            base = match base.rfind("/node_modules/") {
+                Some(index) => &base[..index],
+                None => "",
+            };
+        }
+    };
+
+    for (path, info) in packages {
+        for section in [
+            "dependencies",
+            "devDependencies",
+            "optionalDependencies",
+            "peerDependencies",
+        ] {
+            let Some(deps) = info.get(section).and_then(|d| d.as_object()) else {
+                continue;
+            };
+            let scope = if section == "devDependencies" {
+                DependencyScope::Dev
+            } else {
+                DependencyScope::Runtime
+            };
+            for name in deps.keys() {
+                let Some(target) = resolve(path, name) else {
+                    continue;
+                };
+                if path.is_empty() {
+                    graph.add_direct_with_scope(&target, scope);
+                } else {
+                    graph.add_dependency_with_scope(path, &target, scope);
+                }
+            }
+        }
+    }
+
+    Some(graph)
+}
+
+fn collect_npm_v1_dependencies(
+    dependencies: &serde_json::Map<String, Value>,
+    deps: &mut HashMap<String, String>,
+) {
+    for (name, info) in dependencies {
+        if let Some(version) = info.get("version").and_then(|v| v.as_str()) {
+            deps.entry(name.clone())
+                .or_insert_with(|| version.to_string());
+        }
+
+        if let Some(nested) = info.get("dependencies").and_then(|d| d.as_object()) {
+            collect_npm_v1_dependencies(nested, deps);
         }
-    } else {
-        None
     }
 }
 
@@ -1297,12 +1529,14 @@ fn read_package_version_from_path(path: &str) -> Option<String> {
 // LICENSE DETECTION
 // =============================================================================
 
-fn get_license_for_package(
+/// Find the license of a package, along with the classifier confidence when it
+/// was detected from the package's LICENSE file
+pub(crate) fn get_license_for_package(
     project_root: &Path,
     name: &str,
     version: &str,
     no_local: bool,
-) -> String {
+) -> (String, Option<f32>) {
     #[cfg(windows)]
     const NPM: &str = "npm.cmd";
     #[cfg(not(windows))]
@@ -1311,14 +1545,28 @@ fn get_license_for_package(
     let mut result = get_license_from_package_json(project_root, name, version);
 
     if result.is_none() && !no_local {
+        let detected = local_package_dirs(project_root, name)
+            .iter()
+            .filter(|dir| dir.is_dir())
+            .find_map(|dir| detect_license_in_dir(dir));
+        if let Some(detected) = detected {
+            return (detected.license, Some(detected.confidence));
+        }
+
         result = get_license_from_local_license_file(project_root, name);
     }
 
-    result
+    let license = result
         .or_else(|| get_license_from_pnpm_metadata(project_root, name, version))
-        .or_else(|| get_license_from_npm_view(NPM, name, version))
-        .or_else(|| get_license_from_npm_registry_api(name, version))
-        .unwrap_or_else(|| "Unknown (failed to retrieve)".to_string())
+        .or_else(|| get_cached_license("npm", name, version))
+        .or_else(|| {
+            let license = get_license_from_npm_view(NPM, name, version)
+                .or_else(|| get_license_from_npm_registry_api(name, version))?;
+            cache_license("npm", name, version, &license);
+            Some(license)
+        })
+        .unwrap_or_else(|| "Unknown (failed to retrieve)".to_string());
+    (license, None)
 }
 
 fn get_license_from_package_json(
@@ -1411,6 +1659,10 @@ fn get_license_from_package_json(
 }
 
 fn get_license_from_npm_view(npm_cmd: &str, package_name: &str, version: &str) -> Option<String> {
+    // npm would still contact the registry after the scan was stopped
+    if crate::limits::abort_reason().is_some() {
+        return None;
+    }
     let clean_version = clean_version_string(version);
     let package_spec = if clean_version == "latest" || clean_version.is_empty() {
         package_name.to_string()
@@ -1451,7 +1703,7 @@ fn get_license_from_npm_view(npm_cmd: &str, package_name: &str, version: &str) -
     }
 }
 
-fn get_license_from_npm_registry_api(package_name: &str, version: &str) -> Option<String> {
+pub fn get_license_from_npm_registry_api(package_name: &str, version: &str) -> Option<String> {
     log(
         LogLevel::Info,
         &format!("Trying npm registry API for {package_name}"),
@@ -1463,14 +1715,15 @@ fn get_license_from_npm_registry_api(package_name: &str, version: &str) -> Optio
         vec![version, "latest"]
     };
 
+    let registry_url = registry::npm_registry(package_name);
     for ver in versions_to_try {
         let url = if ver == "latest" {
-            format!("https://registry.npmjs.org/{package_name}")
+            format!("{registry_url}/{package_name}")
         } else {
-            format!("https://registry.npmjs.org/{package_name}/{ver}")
+            format!("{registry_url}/{package_name}/{ver}")
         };
 
-        if let Ok(response) = reqwest::blocking::get(&url) {
+        if let Ok(response) = registry::get(Registry::Npm, &url) {
             if response.status().is_success() {
                 if let Ok(json) = response.json::<Value>() {
                     let license_paths = [
@@ -1542,8 +1795,9 @@ fn get_license_from_pnpm_metadata(
     None
 }
 
-fn get_license_from_local_license_file(project_root: &Path, package_name: &str) -> Option<String> {
-    let package_dirs = if package_name.starts_with('@') {
+/// Directories a package may be installed in, for npm/yarn and pnpm layouts
+fn local_package_dirs(project_root: &Path, package_name: &str) -> Vec<PathBuf> {
+    if package_name.starts_with('@') {
         let parts: Vec<&str> = package_name.splitn(2, '/').collect();
         if parts.len() == 2 {
             vec![
@@ -1559,7 +1813,7 @@ fn get_license_from_local_license_file(project_root: &Path, package_name: &str)
                     .join(parts[1]),
             ]
         } else {
-            return None;
+            Vec::new()
         }
     } else {
         vec![
@@ -1570,7 +1824,18 @@ fn get_license_from_local_license_file(project_root: &Path, package_name: &str)
                 .join("node_modules")
                 .join(package_name),
         ]
-    };
+    }
+}
+
+/// Installed directory of a package under the project's `node_modules`, if present
+pub fn local_package_dir(project_root: &Path, package_name: &str) -> Option<PathBuf> {
+    local_package_dirs(project_root, package_name)
+        .into_iter()
+        .find(|dir| dir.is_dir())
+}
+
+fn get_license_from_local_license_file(project_root: &Path, package_name: &str) -> Option<String> {
+    let package_dirs = local_package_dirs(project_root, package_name);
 
     let license_filenames = [
         "LICENSE",
@@ -1865,41 +2130,7 @@ fn parse_pnpm_lockfile_comprehensive(
     let content = fs::read_to_string(&lockfile_path)
         .map_err(|e| format!("Failed to read pnpm-lock.yaml: {e}"))?;
 
-    let mut deps = HashMap::new();
-    let mut in_packages_section = false;
-
-    for line in content.lines() {
-        let trimmed = line.trim();
-
-        if trimmed == "packages:" {
-            in_packages_section = true;
-            continue;
-        }
-
-        if !trimmed.is_empty()
-            && !trimmed.starts_with(' ')
-            && trimmed.ends_with(':')
-            && in_packages_section
-            && trimmed != "packages:"
-        {
-            in_packages_section = false;
-            continue;
-        }
-
-        if in_packages_section && trimmed.starts_with('/') && trimmed.contains(':') {
-            if let Some(pkg_info) = trimmed.strip_prefix('/').and_then(|s| s.strip_suffix(':')) {
-                if let Some((pkg_name, version)) = parse_pnpm_package_entry(pkg_info) {
-                    deps.insert(pkg_name, version);
-                }
-            }
-        }
-
-        if trimmed.contains('@') && trimmed.contains(':') && !trimmed.starts_with('#') {
-            if let Some((pkg_name, version)) = extract_package_from_lockfile_line(trimmed) {
-                deps.insert(pkg_name, version);
-            }
-        }
-    }
+    let deps = parse_pnpm_lock_content(&content);
 
     log(
         LogLevel::Info,
@@ -1931,35 +2162,6 @@ fn parse_pnpm_package_entry(pkg_info: &str) -> Option<(String, String)> {
     None
 }
 
-fn extract_package_from_lockfile_line(line: &str) -> Option<(String, String)> {
-    if line.contains("resolution:") {
-        return None;
-    }
-
-    if let Some(colon_pos) = line.find(':') {
-        let name_part = line[..colon_pos].trim();
-        let version_part = line[colon_pos + 1..].trim();
-
-        if name_part.is_empty() || version_part.is_empty() {
-            return None;
-        }
-
-        if name_part.contains('/') && !name_part.starts_with('@') {
-            return None;
-        }
-
-        if version_part
-            .chars()
-            .next()
-            .is_some_and(|c| c.is_ascii_digit())
-        {
-            return Some((name_part.to_string(), version_part.to_string()));
-        }
-    }
-
-    None
-}
-
 fn try_pnpm_list_comprehensive(project_root: &Path) -> Result<HashMap<String, String>, String> {
     log(
         LogLevel::Info,
@@ -2304,7 +2506,7 @@ fn parse_pnpm_lockfile_enhanced(project_root: &Path) -> Result<HashMap<String, S
     for line in content.lines() {
         let trimmed = line.trim();
 
-        if trimmed.ends_with(':') && !trimmed.starts_with(' ') {
+        if trimmed.ends_with(':') && !line.starts_with(' ') {
             current_section = Some(trimmed.trim_end_matches(':').to_string());
             continue;
         }
@@ -2505,6 +2707,62 @@ mod tests {
     use std::fs;
     use tempfile::TempDir;
 
+    #[test]
+    fn test_parse_npm_lock_dependency_graph_nested() {
+        let lock = serde_json::json!({
+            "lockfileVersion": 3,
+            "packages": {
+                "": { "name": "app", "dependencies": { "express": "^4.18.0" } },
+                "node_modules/express": {
+                    "version": "4.18.2",
+                    "dependencies": { "qs": "6.11.0", "debug": "2.6.9" }
+                },
+                "node_modules/qs": { "version": "6.13.0" },
+                "node_modules/express/node_modules/qs": { "version": "6.11.0" },
+                "node_modules/debug": {
+                    "version": "2.6.9",
+                    "dependencies": { "ms": "2.0.0" }
+                },
+                "node_modules/ms": { "version": "2.0.0" }
+            }
+        });
+
+        let paths = parse_npm_lock_dependency_graph(&lock).unwrap().paths();
+        assert_eq!(paths["express@4.18.2"], vec!["express@4.18.2"]);
+        assert_eq!(paths["qs@6.11.0"], vec!["express@4.18.2", "qs@6.11.0"]);
+        assert_eq!(
+            paths["ms@2.0.0"],
+            vec!["express@4.18.2", "debug@2.6.9", "ms@2.0.0"]
+        );
+        // Hoisted but not required by anything reachable from the project
+        assert!(!paths.contains_key("qs@6.13.0"));
+    }
+
+    #[test]
+    fn test_parse_npm_lock_dev_dependency_scopes() {
+        let lock = serde_json::json!({
+            "lockfileVersion": 3,
+            "packages": {
+                "": {
+                    "name": "app",
+                    "dependencies": { "chalk": "^5.0.0" },
+                    "devDependencies": { "jest": "^29.0.0" }
+                },
+                "node_modules/chalk": { "version": "5.3.0" },
+                "node_modules/jest": {
+                    "version": "29.7.0",
+                    "dependencies": { "chalk": "^5.0.0", "expect": "29.7.0" }
+                },
+                "node_modules/expect": { "version": "29.7.0" }
+            }
+        });
+
+        let scopes = parse_npm_lock_dependency_graph(&lock).unwrap().scopes();
+        assert_eq!(scopes["chalk@5.3.0"], DependencyScope::Runtime);
+        assert_eq!(scopes["jest@29.7.0"], DependencyScope::Dev);
+        assert_eq!(scopes["expect@29.7.0"], DependencyScope::Dev);
+    }
+
     #[test]
     fn test_detect_license_from_content_mit() {
         let mit_content = "MIT License\n\nCopyright (c) 2024";
@@ -2592,4 +2850,192 @@ mod tests {
         let result = get_license_from_local_license_file(temp_dir.path(), "test-pkg");
         assert_eq!(result, Some("BSD".to_string()));
     }
+
+    #[test]
+    fn test_get_license_for_package_classifies_license_text() {
+        let temp_dir = TempDir::new().unwrap();
+        let package_dir = temp_dir
+            .path()
+            .join("node_modules")
+            .join("no-license-field");
+        fs::create_dir_all(&package_dir).unwrap();
+        fs::write(
+            package_dir.join("package.json"),
+            r#"{"name": "no-license-field", "version": "1.0.0"}"#,
+        )
+        .unwrap();
+        fs::write(
+            package_dir.join("LICENSE"),
+            "ISC License\n\nCopyright (c) 2021 Someone\n\n\
+Permission to use, copy, modify, and/or distribute this software for any purpose with or without fee is hereby granted, provided that the above copyright notice and this permission notice appear in all copies.\n\n\
+THE SOFTWARE IS PROVIDED \"AS IS\" AND THE AUTHOR DISCLAIMS ALL WARRANTIES WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.\n",
+        )
+        .unwrap();
+
+        let (license, confidence) =
+            get_license_for_package(temp_dir.path(), "no-license-field", "1.0.0", false);
+        assert_eq!(license, "ISC");
+        assert!(confidence.unwrap() > 0.9);
+    }
+
+    #[test]
+    fn test_parse_npm_lock_content_v3() {
+        let json: Value = serde_json::from_str(
+            r#"{
+                "name": "app",
+                "lockfileVersion": 3,
+                "packages": {
+                    "": { "name": "app", "version": "1.0.0" },
+                    "node_modules/@babel/core": { "version": "7.22.0", "license": "MIT" },
+                    "node_modules/debug": { "version": "4.3.4" },
+                    "node_modules/send/node_modules/debug": { "version": "2.6.9" },
+                    "node_modules/send/node_modules/ms": { "version": "2.0.0" },
+                    "node_modules/shared-ui": { "resolved": "packages/ui", "link": true },
+                    "packages/ui": { "name": "shared-ui", "version": "0.1.0" }
+                }
+            }"#,
+        )
+        .unwrap();
+
+        let deps = parse_npm_lock_content(&json);
+        assert_eq!(deps.len(), 3);
+        assert_eq!(deps.get("@babel/core"), Some(&"7.22.0".to_string()));
+        assert_eq!(deps.get("debug"), Some(&"4.3.4".to_string()));
+        assert_eq!(deps.get("ms"), Some(&"2.0.0".to_string()));
+        assert!(!deps.contains_key("shared-ui"));
+        assert!(!deps.contains_key("app"));
+    }
+
+    #[test]
+    fn test_parse_npm_lock_content_v1() {
+        let json: Value = serde_json::from_str(
+            r#"{
+                "lockfileVersion": 1,
+                "dependencies": {
+                    "express": {
+                        "version": "4.18.2",
+                        "dependencies": {
+                            "cookie": { "version": "0.5.0" }
+                        }
+                    }
+                }
+            }"#,
+        )
+        .unwrap();
+
+        let deps = parse_npm_lock_content(&json);
+        assert_eq!(deps.get("express"), Some(&"4.18.2".to_string()));
+        assert_eq!(deps.get("cookie"), Some(&"0.5.0".to_string()));
+    }
+
+    #[test]
+    fn test_parse_yarn_lock_content_classic() {
+        let content = r#"# THIS IS AN AUTOGENERATED FILE. DO NOT EDIT THIS FILE DIRECTLY.
+# yarn lockfile v1
+
+
+"@babel/code-frame@^7.0.0", "@babel/code-frame@^7.22.5":
+  version "7.22.5"
+  resolved "https://registry.yarnpkg.com/@babel/code-frame/-/code-frame-7.22.5.tgz"
+  dependencies:
+    "@babel/highlight" "^7.22.5"
+
+lodash@^4.17.21:
+  version "4.17.21"
+"#;
+
+        let deps = parse_yarn_lock_content(content);
+        assert_eq!(deps.len(), 2);
+        assert_eq!(deps.get("@babel/code-frame"), Some(&"7.22.5".to_string()));
+        assert_eq!(deps.get("lodash"), Some(&"4.17.21".to_string()));
+    }
+
+    #[test]
+    fn test_parse_yarn_lock_content_berry() {
+        let content = r#"__metadata:
+  version: 6
+  cacheKey: 8
+
+"@types/node@npm:*, @types/node@npm:^20.0.0":
+  version: 20.4.2
+  resolution: "@types/node@npm:20.4.2"
+
+"my-app@workspace:.":
+  version: 0.0.0-use.local
+  resolution: "my-app@workspace:."
+"#;
+
+        let deps = parse_yarn_lock_content(content);
+        assert_eq!(deps.len(), 1);
+        assert_eq!(deps.get("@types/node"), Some(&"20.4.2".to_string()));
+    }
+
+    #[test]
+    fn test_parse_pnpm_lock_content_versions() {
+        let v5 = r#"lockfileVersion: 5.4
+
+specifiers:
+  react-dom: ^18.2.0
+
+packages:
+
+  /@babel/runtime/7.22.6:
+    resolution: {integrity: sha512-abc}
+    dev: false
+
+  /react-dom/18.2.0_react@18.2.0:
+    resolution: {integrity: sha512-def}
+
+  /string_decoder/1.3.0:
+    resolution: {integrity: sha512-ghi}
+"#;
+        let deps = parse_pnpm_lock_content(v5);
+        assert_eq!(deps.get("@babel/runtime"), Some(&"7.22.6".to_string()));
+        assert_eq!(deps.get("react-dom"), Some(&"18.2.0".to_string()));
+        assert_eq!(deps.get("string_decoder"), Some(&"1.3.0".to_string()));
+
+        let v6 = r#"lockfileVersion: '6.0'
+
+importers:
+  .:
+    dependencies:
+      react-dom:
+        specifier: ^18.2.0
+        version: 18.2.0(react@18.2.0)
+
+packages:
+
+  /@babel/runtime@7.22.6:
+    resolution: {integrity: sha512-abc}
+
+  /react-dom@18.2.0(react@18.2.0):
+    resolution: {integrity: sha512-def}
+"#;
+        let deps = parse_pnpm_lock_content(v6);
+        assert_eq!(deps.len(), 2);
+        assert_eq!(deps.get("@babel/runtime"), Some(&"7.22.6".to_string()));
+        assert_eq!(deps.get("react-dom"), Some(&"18.2.0".to_string()));
+
+        let v9 = r#"lockfileVersion: '9.0'
+
+packages:
+
+  '@babel/runtime@7.22.6':
+    resolution: {integrity: sha512-abc}
+
+  react@18.2.0:
+    resolution: {integrity: sha512-jkl}
+
+snapshots:
+
+  react-dom@18.2.0(react@18.2.0):
+    dependencies:
+      react: 18.2.0
+"#;
+        let deps = parse_pnpm_lock_content(v9);
+        assert_eq!(deps.len(), 3);
+        assert_eq!(deps.get("@babel/runtime"), Some(&"7.22.6".to_string()));
+        assert_eq!(deps.get("react"), Some(&"18.2.0".to_string()));
+        assert_eq!(deps.get("react-dom"), Some(&"18.2.0".to_string()));
+    }
 }
@@ -0,0 +1,536 @@
+//! OCaml packages of opam projects
+//!
+//! `opam lock` writes a `<package>.opam.locked` file next to each opam file,
+//! whose `depends` pin every package of the solution with `{= "version"}`.
+//! Licenses are read from the `opam` file of each release: the copy opam
+//! keeps in the project's local switch (`_opam`) or the active switch, then
+//! the one in the opam repository. Pinned packages are read from their
+//! repository at the pinned commit.
+
+use rayon::prelude::*;
+use std::collections::{BTreeMap, HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::languages::license_info;
+use crate::licenses::{fetch_licenses_from_github, DependencyScope, LicenseInfo};
+use crate::registry::{self, Registry};
+use crate::repository_license::fetch_repository_license;
+
+pub const OPAM_LOCKFILE_SUFFIX: &str = ".opam.locked";
+
+/// Package files of the default opam repository
+const OPAM_REPOSITORY: &str =
+    "https://raw.githubusercontent.com/ocaml/opam-repository/master/packages";
+
+/// Prefixes of virtual packages and of packages that only check for a system library
+const PLACEHOLDER_PREFIXES: [&str; 4] = ["base-", "conf-", "host-arch-", "host-system-"];
+
+/// A package pinned in an `.opam.locked` file
+#[derive(Debug, Clone, PartialEq)]
+pub struct OpamPackage {
+    pub name: String,
+    pub version: String,
+    pub scope: DependencyScope,
+    /// Repository and commit of a `pin-depends` entry
+    pub pin: Option<(String, String)>,
+}
+
+/// The lockfiles of a project, sorted by name
+fn lockfiles(project_dir: &Path) -> Vec<PathBuf> {
+    let mut files: Vec<PathBuf> = fs::read_dir(project_dir)
+        .map(|entries| {
+            entries
+                .filter_map(|e| e.ok())
+                .map(|e| e.path())
+                .filter(|path| {
+                    path.is_file()
+                        && path
+                            .file_name()
+                            .and_then(|name| name.to_str())
+                            .is_some_and(|name| name.ends_with(OPAM_LOCKFILE_SUFFIX))
+                })
+                .collect()
+        })
+        .unwrap_or_default();
+    files.sort();
+    files
+}
+
+/// The first lockfile of a project, which its dependencies are reported from
+pub fn find_manifest(project_dir: &Path) -> Option<String> {
+    lockfiles(project_dir)
+        .first()
+        .and_then(|file| file.file_name())
+        .map(|name| name.to_string_lossy().to_string())
+}
+
+pub fn analyze_ocaml_licenses(
+    project_dir: &Path,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing OCaml dependencies in: {}", project_dir.display()),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    // Several packages of one project are locked separately and share dependencies
+    let mut local = HashSet::new();
+    let mut packages: BTreeMap<String, OpamPackage> = BTreeMap::new();
+    for lockfile in lockfiles(project_dir) {
+        let content = match fs::read_to_string(&lockfile) {
+            Ok(content) => content,
+            Err(err) => {
+                log_error(&format!("Failed to read {}", lockfile.display()), &err);
+                continue;
+            }
+        };
+        let name = opam_string_field(&content, "name").or_else(|| {
+            lockfile
+                .file_name()
+                .and_then(|name| name.to_str())
+                .and_then(|name| name.strip_suffix(OPAM_LOCKFILE_SUFFIX))
+                .map(str::to_string)
+        });
+        local.extend(name);
+        for package in parse_opam_lock(&content) {
+            packages
+                .entry(package.name.clone())
+                .and_modify(|existing| {
+                    if package.scope.is_runtime() {
+                        existing.scope = package.scope;
+                    }
+                })
+                .or_insert(package);
+        }
+    }
+
+    let packages: Vec<OpamPackage> = packages
+        .into_values()
+        .filter(|package| !local.contains(&package.name))
+        .collect();
+    log(
+        LogLevel::Info,
+        &format!("Found {} opam packages", packages.len()),
+    );
+    log_debug("opam packages", &packages);
+
+    let licenses: Vec<LicenseInfo> = packages
+        .into_par_iter()
+        .map(|package| {
+            let (license, confidence) =
+                time_dependency("opam", &package.name, &package.version, || {
+                    fetch_license_for_package(&package, project_dir, no_local)
+                });
+            LicenseInfo {
+                scope: package.scope,
+                ..license_info(
+                    package.name,
+                    package.version,
+                    license,
+                    confidence,
+                    &known_licenses,
+                    config,
+                )
+            }
+        })
+        .collect();
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} OCaml dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+/// The pinned `depends` of an `.opam.locked` file
+///
+/// Placeholder packages such as `base-unix` or `conf-libssl` have no code of
+/// their own and are skipped.
+fn parse_opam_lock(content: &str) -> Vec<OpamPackage> {
+    let pins: HashMap<String, (String, String)> = opam_list_field(content, "pin-depends")
+        .and_then(|pins| parse_pins(&pins))
+        .unwrap_or_default();
+
+    let Some(depends) = opam_list_field(content, "depends") else {
+        return Vec::new();
+    };
+
+    let mut packages = Vec::new();
+    let mut rest = depends.as_str();
+    while let Some((name, after)) = next_string(rest) {
+        rest = after.trim_start();
+        // Filters follow the package name in braces, e.g. {= "1.2.0" & with-test}
+        let filter = match rest.strip_prefix('{') {
+            Some(inner) => {
+                let end = inner.find('}').unwrap_or(inner.len());
+                rest = inner.get(end + 1..).unwrap_or_default();
+                &inner[..end]
+            }
+            None => "",
+        };
+
+        if PLACEHOLDER_PREFIXES
+            .iter()
+            .any(|prefix| name.starts_with(prefix))
+        {
+            continue;
+        }
+        let Some(version) = filter
+            .split_once('=')
+            .filter(|(before, _)| !before.ends_with(['<', '>', '!']))
+            .and_then(|(_, after)| next_string(after))
+            .map(|(version, _)| version)
+        else {
+            log(
+                LogLevel::Warn,
+                &format!("Skipping {name}, its version is not pinned"),
+            );
+            continue;
+        };
+
+        let words: Vec<&str> = filter
+            .split(|c: char| !(c.is_ascii_alphanumeric() || c == '-'))
+            .collect();
+        let scope = if words.contains(&"with-test") {
+            DependencyScope::Test
+        } else if words.contains(&"with-doc") || words.contains(&"with-dev-setup") {
+            DependencyScope::Dev
+        } else if words.contains(&"build") {
+            DependencyScope::Build
+        } else {
+            DependencyScope::Runtime
+        };
+
+        packages.push(OpamPackage {
+            pin: pins.get(&format!("{name}.{version}")).cloned(),
+            name,
+            version,
+            scope,
+        });
+    }
+    packages
+}
+
+/// `pin-depends` entries, `["name.version" "git+https://host/repo#commit"]`
+fn parse_pins(list: &str) -> Option<HashMap<String, (String, String)>> {
+    let mut pins = HashMap::new();
+    let mut rest = list;
+    while let Some((package, after)) = next_string(rest) {
+        let (url, after) = next_string(after)?;
+        rest = after;
+        let url = url.strip_prefix("git+").unwrap_or(&url);
+        let (repository, commit) = url.split_once('#').unwrap_or((url, ""));
+        pins.insert(package, (repository.to_string(), commit.to_string()));
+    }
+    Some(pins)
+}
+
+/// The first string literal of `text` and the text after it
+fn next_string(text: &str) -> Option<(String, &str)> {
+    let start = text.find('"')?;
+    let mut value = String::new();
+    let mut chars = text[start + 1..].char_indices();
+    while let Some((index, c)) = chars.next() {
+        match c {
+            '\\' => value.extend(chars.next().map(|(_, escaped)| escaped)),
+            '"' => return Some((value, &text[start + 1 + index + 1..])),
+            _ => value.push(c),
+        }
+    }
+    None
+}
+
+/// Start of the value of a top-level `field:` of an opam file
+fn field_value<'a>(content: &'a str, field: &str) -> Option<&'a str> {
+    let prefix = format!("{field}:");
+    let mut offset = 0;
+    for line in content.split_inclusive('\n') {
+        if line.starts_with(&prefix) {
+            return Some(content[offset + prefix.len()..].trim_start());
+        }
+        offset += line.len();
+    }
+    None
+}
+
+/// Text between the brackets of a list field such as `depends: [ ... ]`
+fn opam_list_field(content: &str, field: &str) -> Option<String> {
+    let value = field_value(content, field)?.strip_prefix('[')?;
+    let mut depth = 0;
+    let mut in_string = false;
+    let mut escaped = false;
+    for (index, c) in value.char_indices() {
+        if in_string {
+            match c {
+                _ if escaped => escaped = false,
+                '\\' => escaped = true,
+                '"' => in_string = false,
+                _ => {}
+            }
+            continue;
+        }
+        match c {
+            '"' => in_string = true,
+            '[' => depth += 1,
+            ']' if depth == 0 => return Some(value[..index].to_string()),
+            ']' => depth -= 1,
+            _ => {}
+        }
+    }
+    None
+}
+
+/// Value of a string field such as `name: "myproject"`
+fn opam_string_field(content: &str, field: &str) -> Option<String> {
+    let value = field_value(content, field)?;
+    value
+        .starts_with('"')
+        .then(|| next_string(value).map(|(value, _)| value))
+        .flatten()
+}
+
+/// SPDX expression of the `license` field of an opam file
+///
+/// A list names several licenses that all apply to parts of the package.
+fn opam_license(content: &str) -> Option<String> {
+    let licenses: Vec<String> = match opam_list_field(content, "license") {
+        Some(list) => {
+            let mut licenses = Vec::new();
+            let mut rest = list.as_str();
+            while let Some((license, after)) = next_string(rest) {
+                licenses.push(license);
+                rest = after;
+            }
+            licenses
+        }
+        None => opam_string_field(content, "license").into_iter().collect(),
+    };
+    let licenses: Vec<String> = licenses
+        .into_iter()
+        .filter(|license| !license.trim().is_empty())
+        .collect();
+    match licenses.len() {
+        0 => None,
+        1 => licenses.into_iter().next(),
+        _ => Some(
+            licenses
+                .iter()
+                .map(|license| {
+                    if license.contains(' ') {
+                        format!("({license})")
+                    } else {
+                        license.clone()
+                    }
+                })
+                .collect::<Vec<_>>()
+                .join(" AND "),
+        ),
+    }
+}
+
+/// The `opam` files opam keeps for the packages installed in a switch
+fn switch_opam_files(project_dir: &Path, name: &str, version: &str) -> Vec<PathBuf> {
+    let package = format!("{name}.{version}");
+    let mut switches = vec![project_dir.join("_opam")];
+    if let Ok(prefix) = std::env::var("OPAM_SWITCH_PREFIX") {
+        switches.push(PathBuf::from(prefix));
+    }
+    switches
+        .into_iter()
+        .map(|switch| {
+            switch
+                .join(".opam-switch")
+                .join("packages")
+                .join(&package)
+                .join("opam")
+        })
+        .collect()
+}
+
+/// The `license` of the package's opam file in the local switch, else the
+/// license file of its pinned repository, else the opam repository's entry
+fn fetch_license_for_package(
+    package: &OpamPackage,
+    project_dir: &Path,
+    no_local: bool,
+) -> (Option<String>, Option<f32>) {
+    if !no_local {
+        if let Some(license) = switch_opam_files(project_dir, &package.name, &package.version)
+            .iter()
+            .filter_map(|file| fs::read_to_string(file).ok())
+            .find_map(|content| opam_license(&content))
+        {
+            return (Some(license), None);
+        }
+    }
+
+    if let Some((repository, commit)) = &package.pin {
+        return match fetch_repository_license(repository, commit) {
+            Some((license, confidence)) => (Some(license), Some(confidence)),
+            None => (None, None),
+        };
+    }
+
+    (
+        fetch_license_from_opam_repository(&package.name, &package.version),
+        None,
+    )
+}
+
+/// License of a release in the opam repository
+pub fn fetch_license_from_opam_repository(name: &str, version: &str) -> Option<String> {
+    if let Some(license) = get_cached_license("opam", name, version) {
+        return Some(license);
+    }
+
+    let url = format!("{OPAM_REPOSITORY}/{name}/{name}.{version}/opam");
+    log(LogLevel::Info, &format!("Fetching opam file: {url}"));
+    let content = match registry::get(Registry::Opam, &url) {
+        Ok(response) if response.status().is_success() => response.text().ok()?,
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "opam repository returned {} for {name}.{version}",
+                    response.status()
+                ),
+            );
+            return None;
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch {name}.{version}"), &err);
+            return None;
+        }
+    };
+
+    let license = opam_license(&content)?;
+    cache_license("opam", name, version, &license);
+    Some(license)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const LOCKFILE: &str = r#"opam-version: "2.0"
+name: "myproject"
+version: "dev"
+synopsis: "A project [with brackets]"
+license: "ISC"
+depends: [
+  "astring" {= "0.8.5"}
+  "base-threads" {= "base"}
+  "cmdliner" {= "1.2.0"}
+  "conf-pkg-config" {= "3"}
+  "dune" {= "3.14.0"}
+  "alcotest" {= "1.7.0" & with-test}
+  "odoc" {= "2.4.1" & with-doc}
+  "ocaml" {= "5.1.1"}
+  "mylib" {= "0.3.0"}
+]
+build: [
+  ["dune" "build" "-p" name "-j" jobs]
+]
+pin-depends: [
+  ["mylib.0.3.0" "git+https://github.com/example/mylib#3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a"]
+]
+"#;
+
+    const OPAM_FILE: &str = r#"opam-version: "2.0"
+maintainer: "Daniel Bünzli <daniel.buenzl i@erratique.ch>"
+license: ["ISC" "LGPL-2.1-only WITH OCaml-LGPL-linking-exception"]
+depends: [
+  "ocaml" {>= "4.08.0"}
+]
+"#;
+
+    fn found(packages: &[OpamPackage]) -> Vec<(&str, &str, DependencyScope)> {
+        packages
+            .iter()
+            .map(|p| (p.name.as_str(), p.version.as_str(), p.scope))
+            .collect()
+    }
+
+    #[test]
+    fn test_parse_opam_lock() {
+        let packages = parse_opam_lock(LOCKFILE);
+        assert_eq!(
+            found(&packages),
+            vec![
+                ("astring", "0.8.5", DependencyScope::Runtime),
+                ("cmdliner", "1.2.0", DependencyScope::Runtime),
+                ("dune", "3.14.0", DependencyScope::Runtime),
+                ("alcotest", "1.7.0", DependencyScope::Test),
+                ("odoc", "2.4.1", DependencyScope::Dev),
+                ("ocaml", "5.1.1", DependencyScope::Runtime),
+                ("mylib", "0.3.0", DependencyScope::Runtime),
+            ]
+        );
+        assert_eq!(
+            packages.last().unwrap().pin,
+            Some((
+                "https://github.com/example/mylib".to_string(),
+                "3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a".to_string()
+            ))
+        );
+        assert_eq!(
+            opam_string_field(LOCKFILE, "name"),
+            Some("myproject".to_string())
+        );
+    }
+
+    #[test]
+    fn test_opam_license() {
+        assert_eq!(opam_license(LOCKFILE), Some("ISC".to_string()));
+        assert_eq!(
+            opam_license(OPAM_FILE),
+            Some("ISC AND (LGPL-2.1-only WITH OCaml-LGPL-linking-exception)".to_string())
+        );
+        assert_eq!(opam_license("opam-version: \"2.0\"\n"), None);
+    }
+
+    #[test]
+    fn test_license_from_local_switch() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        let package_dir = root.join("_opam/.opam-switch/packages/astring.0.8.5");
+        fs::create_dir_all(&package_dir).unwrap();
+        fs::write(package_dir.join("opam"), OPAM_FILE).unwrap();
+        fs::write(root.join("myproject.opam.locked"), LOCKFILE).unwrap();
+
+        assert_eq!(
+            find_manifest(root),
+            Some("myproject.opam.locked".to_string())
+        );
+        let package = OpamPackage {
+            name: "astring".to_string(),
+            version: "0.8.5".to_string(),
+            scope: DependencyScope::Runtime,
+            pin: None,
+        };
+        assert_eq!(
+            fetch_license_for_package(&package, root, false).0,
+            Some("ISC AND (LGPL-2.1-only WITH OCaml-LGPL-linking-exception)".to_string())
+        );
+    }
+}
@@ -0,0 +1,344 @@
+use serde::Deserialize;
+use std::collections::{BTreeMap, HashMap};
+use std::fs;
+use std::path::Path;
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, DependencyGraph,
+};
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+
+#[derive(Deserialize, Debug, Default)]
+struct ComposerLock {
+    #[serde(default)]
+    packages: Vec<ComposerPackage>,
+    #[serde(default, rename = "packages-dev")]
+    packages_dev: Vec<ComposerPackage>,
+}
+
+#[derive(Deserialize, Debug)]
+struct ComposerPackage {
+    name: String,
+    version: String,
+    #[serde(default)]
+    license: Vec<String>,
+    /// Constraints by package name, including platform packages such as `php`
+    #[serde(default)]
+    require: BTreeMap<String, String>,
+}
+
+/// The requirements of `composer.json`, the entry points of the lockfile
+#[derive(Deserialize, Debug, Default)]
+struct ComposerJson {
+    #[serde(default)]
+    require: BTreeMap<String, String>,
+    #[serde(default, rename = "require-dev")]
+    require_dev: BTreeMap<String, String>,
+}
+
+/// Analyze the packages pinned in `composer.lock`
+///
+/// The lockfile already records each package's licenses, so no registry is
+/// queried. Packages from `packages-dev`, installed for `require-dev`, get the
+/// `dev` scope.
+pub fn analyze_php_licenses(lock_file_path: &str, config: &FeludaConfig) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing PHP dependencies from: {lock_file_path}"),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let lock = match parse_composer_lock(lock_file_path) {
+        Ok(lock) => lock,
+        Err(err) => {
+            log_error("Failed to parse composer.lock", &err);
+            return Vec::new();
+        }
+    };
+    log(
+        LogLevel::Info,
+        &format!(
+            "Found {} packages and {} dev packages in composer.lock",
+            lock.packages.len(),
+            lock.packages_dev.len()
+        ),
+    );
+    log_debug("Composer packages", &lock);
+    let manifest = Path::new(lock_file_path).with_file_name("composer.json");
+    let graph = composer_dependency_graph(&lock, &parse_composer_json(&manifest));
+
+    let packages = lock
+        .packages
+        .into_iter()
+        .map(|package| (package, DependencyScope::Runtime));
+    let dev_packages = lock
+        .packages_dev
+        .into_iter()
+        .map(|package| (package, DependencyScope::Dev));
+
+    let mut licenses: Vec<LicenseInfo> = packages
+        .chain(dev_packages)
+        .map(|(package, scope)| {
+            let license = license_from_composer(&package.license);
+            let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
+
+            if is_restrictive {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "Restrictive license found: {license:?} for {}",
+                        package.name
+                    ),
+                );
+            }
+
+            LicenseInfo {
+                name: package.name,
+                version: normalize_version(&package.version),
+                license: license.clone(),
+                is_restrictive,
+                compatibility: LicenseCompatibility::Unknown,
+                osi_status: match &license {
+                    Some(l) => crate::licenses::get_osi_status(l),
+                    None => crate::licenses::OsiStatus::Unknown,
+                },
+                license_confidence: None,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
+            }
+        })
+        .collect();
+    attach_dependency_paths(&mut licenses, &graph.paths());
+    attach_dependency_requires(&mut licenses, &graph.requires());
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} PHP dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+fn parse_composer_lock(lock_file_path: &str) -> Result<ComposerLock, String> {
+    let content = fs::read_to_string(lock_file_path)
+        .map_err(|e| format!("Failed to read composer.lock: {e}"))?;
+    serde_json::from_str(&content).map_err(|e| format!("Invalid composer.lock: {e}"))
+}
+
+/// Read `composer.json` next to the lockfile; without one no paths are recorded
+fn parse_composer_json(path: &Path) -> ComposerJson {
+    let Ok(content) = fs::read_to_string(path) else {
+        return ComposerJson::default();
+    };
+    serde_json::from_str(&content).unwrap_or_else(|err| {
+        log_error(&format!("Invalid {}", path.display()), &err);
+        ComposerJson::default()
+    })
+}
+
+/// Graph of the locked packages, entered from the requirements of `composer.json`
+///
+/// Composer locks a single version of every package, so packages are
+/// identified by name. Platform requirements such as `php` or `ext-json` are
+/// not locked and drop out.
+fn composer_dependency_graph(lock: &ComposerLock, manifest: &ComposerJson) -> DependencyGraph {
+    let mut graph = DependencyGraph::new();
+    let packages = lock.packages.iter().chain(&lock.packages_dev);
+    for package in packages.clone() {
+        graph.add_package(
+            &package.name,
+            &package.name,
+            &normalize_version(&package.version),
+        );
+    }
+    for package in packages {
+        for required in package.require.keys() {
+            graph.add_dependency(&package.name, required);
+        }
+    }
+    for name in manifest.require.keys() {
+        graph.add_direct(name);
+    }
+    for name in manifest.require_dev.keys() {
+        graph.add_direct_with_scope(name, DependencyScope::Dev);
+    }
+    graph
+}
+
+/// Combine a package's `license` array into one expression
+///
+/// Composer lists the licenses of a dual-licensed package side by side, and
+/// the package may be used under any of them.
+pub fn license_from_composer(licenses: &[String]) -> Option<String> {
+    let licenses: Vec<&str> = licenses
+        .iter()
+        .map(|l| l.trim())
+        .filter(|l| !l.is_empty())
+        .collect();
+
+    match licenses.as_slice() {
+        [] => None,
+        [license] => Some(license.to_string()),
+        _ => Some(
+            licenses
+                .iter()
+                .map(|l| {
+                    if l.contains(' ') {
+                        format!("({l})")
+                    } else {
+                        l.to_string()
+                    }
+                })
+                .collect::<Vec<_>>()
+                .join(" OR "),
+        ),
+    }
+}
+
+/// Drop the `v` prefix of tagged releases, e.g. `v6.4.1` to `6.4.1`
+pub fn normalize_version(version: &str) -> String {
+    match version.strip_prefix('v') {
+        Some(rest) if rest.starts_with(|c: char| c.is_ascii_digit()) => rest.to_string(),
+        _ => version.to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_analyze_composer_lock() {
+        let temp_dir = TempDir::new().unwrap();
+        let lock_path = temp_dir.path().join("composer.lock");
+        fs::write(
+            &lock_path,
+            r#"{
+  "content-hash": "abc",
+  "packages": [
+    {"name": "monolog/monolog", "version": "3.5.0", "license": ["MIT"]},
+    {"name": "symfony/console", "version": "v6.4.1", "license": ["MIT"]},
+    {"name": "phpseclib/phpseclib", "version": "2.0.47", "license": []},
+    {"name": "php-di/invoker", "version": "dev-master"}
+  ],
+  "packages-dev": [
+    {"name": "phpunit/phpunit", "version": "10.5.3", "license": ["BSD-3-Clause"]},
+    {"name": "squizlabs/php_codesniffer", "version": "3.8.0", "license": ["GPL-2.0-or-later", "LGPL-2.1-only"]}
+  ]
+}"#,
+        )
+        .unwrap();
+
+        let deps = analyze_php_licenses(lock_path.to_str().unwrap(), &FeludaConfig::default());
+        assert_eq!(deps.len(), 6);
+
+        assert_eq!(deps[0].license.as_deref(), Some("MIT"));
+        assert_eq!(deps[0].scope, DependencyScope::Runtime);
+        assert_eq!(deps[1].version, "6.4.1");
+        assert_eq!(deps[2].license, None);
+        assert_eq!(deps[3].version, "dev-master");
+
+        assert_eq!(deps[4].scope, DependencyScope::Dev);
+        assert_eq!(
+            deps[5].license.as_deref(),
+            Some("GPL-2.0-or-later OR LGPL-2.1-only")
+        );
+    }
+
+    #[test]
+    fn test_composer_dependency_graph() {
+        let temp_dir = TempDir::new().unwrap();
+        let lock_path = temp_dir.path().join("composer.lock");
+        fs::write(
+            temp_dir.path().join("composer.json"),
+            r#"{"require": {"php": ">=8.1", "symfony/console": "^6.4"},
+  "require-dev": {"phpunit/phpunit": "^10.5"}}"#,
+        )
+        .unwrap();
+        fs::write(
+            &lock_path,
+            r#"{
+  "packages": [
+    {"name": "symfony/console", "version": "v6.4.1", "license": ["MIT"],
+     "require": {"php": ">=8.1", "symfony/string": "^6.4"}},
+    {"name": "symfony/string", "version": "v6.4.0", "license": ["MIT"]}
+  ],
+  "packages-dev": [
+    {"name": "phpunit/phpunit", "version": "10.5.3", "license": ["BSD-3-Clause"],
+     "require": {"symfony/string": "^6.0"}}
+  ]
+}"#,
+        )
+        .unwrap();
+
+        let deps = analyze_php_licenses(lock_path.to_str().unwrap(), &FeludaConfig::default());
+        assert_eq!(
+            deps[1].dependency_path,
+            Some(vec![
+                "symfony/console@6.4.1".to_string(),
+                "symfony/string@6.4.0".to_string()
+            ])
+        );
+        assert_eq!(
+            deps[0].requires,
+            Some(vec!["symfony/string@6.4.0".to_string()])
+        );
+        assert_eq!(
+            deps[2].dependency_path,
+            Some(vec!["phpunit/phpunit@10.5.3".to_string()])
+        );
+    }
+
+    #[test]
+    fn test_license_from_composer() {
+        assert_eq!(license_from_composer(&[]), None);
+        assert_eq!(
+            license_from_composer(&["(LGPL-2.1-only or GPL-3.0-or-later)".to_string()]).as_deref(),
+            Some("(LGPL-2.1-only or GPL-3.0-or-later)")
+        );
+        assert_eq!(
+            license_from_composer(&[
+                "MIT".to_string(),
+                "Apache-2.0 WITH LLVM-exception".to_string()
+            ])
+            .as_deref(),
+            Some("MIT OR (Apache-2.0 WITH LLVM-exception)")
+        );
+    }
+}
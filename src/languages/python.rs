@@ -1,3 +1,4 @@
+use rayon::prelude::*;
 use serde_json::Value;
 use std::collections::{HashMap, HashSet};
 use std::fs;
@@ -7,11 +8,19 @@ use std::path::Path;
 use std::process::Command;
 use toml::Value as TomlValue;
 
+use crate::cache::{cache_license, get_cached_license};
 use crate::config::FeludaConfig;
-use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, DependencyGraph,
+};
+use crate::license_detector::{detect_license_in_dir, DetectedLicense};
 use crate::licenses::{
-    fetch_licenses_from_github, is_license_restrictive, LicenseCompatibility, LicenseInfo,
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
 };
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
 
 /// Represents an environment marker in a Python requirement
 /// Environment markers follow PEP 508 and are used to specify conditional dependencies
@@ -64,6 +73,31 @@ impl EnvironmentMarker {
         descriptions.join(" and ")
     }
 
+    /// Extras this marker is gated on, e.g. `extra == "socks"`
+    ///
+    /// A requirement with such a marker is only installed when one of these
+    /// extras was requested for the package that declares it.
+    pub fn required_extras(&self) -> Vec<String> {
+        let mut extras = Vec::new();
+        let mut rest = self.raw.as_str();
+
+        while let Some(pos) = rest.find("extra") {
+            rest = &rest[pos + "extra".len()..];
+            let Some(value) = rest.trim_start().strip_prefix("==") else {
+                continue;
+            };
+            let value = value.trim_start();
+            let Some(quote) = value.chars().next().filter(|c| *c == '\'' || *c == '"') else {
+                continue;
+            };
+            if let Some(end) = value[1..].find(quote) {
+                extras.push(normalize_package_name(&value[1..=end]));
+            }
+        }
+
+        extras
+    }
+
     /// Check if this marker applies to a specific environment
     /// For now, we assume all markers apply (conservative approach)
     /// In production, you'd evaluate against actual environment
@@ -118,7 +152,6 @@ fn parse_marker_components(marker_str: &str) -> Vec<MarkerComponent> {
 
 /// Analyze the licenses of Python dependencies with transitive resolution
 pub fn analyze_python_licenses(package_file_path: &str, config: &FeludaConfig) -> Vec<LicenseInfo> {
-    let mut licenses = Vec::new();
     log(
         LogLevel::Info,
         &format!("Analyzing Python dependencies from: {package_file_path}"),
@@ -138,242 +171,598 @@ pub fn analyze_python_licenses(package_file_path: &str, config: &FeludaConfig) -
         }
     };
 
-    // Check if it's a pyproject.toml file
-    if package_file_path.ends_with("pyproject.toml") {
-        match fs::read_to_string(package_file_path) {
-            Ok(content) => match toml::from_str::<TomlValue>(&content) {
-                Ok(toml_config) => {
-                    if let Some(project) = toml_config.as_table().and_then(|t| t.get("project")) {
-                        if let Some(deps) = project
-                            .as_table()
-                            .and_then(|t| t.get("dependencies"))
-                            .and_then(|d| d.as_array())
-                        {
-                            log(
-                                LogLevel::Info,
-                                &format!("Found {} Python dependencies", deps.len()),
-                            );
-                            log_debug("Dependencies", deps);
-
-                            // First collect direct dependencies
-                            let mut direct_deps = Vec::new();
-                            for dep in deps {
-                                if let Some(dep_str) = dep.as_str() {
-                                    let (name, version) = if let Some((n, v)) = dep_str
-                                        .split_once("==")
-                                        .or_else(|| dep_str.split_once(">="))
-                                        .or_else(|| dep_str.split_once(">"))
-                                        .or_else(|| dep_str.split_once("~="))
-                                        .or_else(|| dep_str.split_once("<="))
-                                        .or_else(|| dep_str.split_once("<"))
-                                    {
-                                        (n.trim(), v.trim())
-                                    } else {
-                                        (dep_str.trim(), "latest")
-                                    };
-
-                                    direct_deps.push((name.to_string(), version.to_string()));
-                                }
-                            }
-
-                            // Try to resolve all dependencies (direct + transitive) using uv or fallback to PyPI
-                            let max_depth = config.dependencies.max_depth;
-                            log(
-                                LogLevel::Info,
-                                &format!("Using max dependency depth: {max_depth}"),
-                            );
-                            let all_deps = resolve_python_dependencies(
-                                &direct_deps,
-                                package_file_path,
-                                max_depth,
-                            );
+    let max_depth = config.dependencies.max_depth;
 
-                            // Process all resolved dependencies
-                            for (name, version) in all_deps {
-                                log(
-                                    LogLevel::Info,
-                                    &format!("Processing dependency: {name} ({version})"),
-                                );
-
-                                let license_result =
-                                    fetch_license_for_python_dependency(&name, &version);
-                                let license = Some(license_result);
-                                let is_restrictive = is_license_restrictive(
-                                    &license,
-                                    &known_licenses,
-                                    config.strict,
-                                );
-
-                                if is_restrictive {
-                                    log(
-                                        LogLevel::Warn,
-                                        &format!(
-                                            "Restrictive license found: {license:?} for {name}"
-                                        ),
-                                    );
-                                }
-
-                                licenses.push(LicenseInfo {
-                                    name,
-                                    version,
-                                    license: license.clone(),
-                                    is_restrictive,
-                                    compatibility: LicenseCompatibility::Unknown,
-                                    osi_status: match &license {
-                                        Some(l) => crate::licenses::get_osi_status(l),
-                                        None => crate::licenses::OsiStatus::Unknown,
-                                    },
-                                });
-                            }
-                        } else {
-                            log(
-                                LogLevel::Warn,
-                                "Failed to find dependencies in pyproject.toml",
-                            );
-                        }
-                    } else {
-                        log(
-                            LogLevel::Warn,
-                            "No 'project' section found in pyproject.toml",
-                        );
-                    }
-                }
-                Err(err) => {
-                    log_error("Failed to parse pyproject.toml", &err);
-                }
-            },
-            Err(err) => {
-                log_error("Failed to read pyproject.toml file", &err);
-            }
-        }
+    // Lockfiles already pin the full dependency closure, so no resolution is needed
+    let all_deps = if package_file_path.ends_with("Pipfile.lock") {
+        parse_pipfile_lock(package_file_path)
+    } else if package_file_path.ends_with("poetry.lock") {
+        parse_poetry_lock(package_file_path)
+    } else if package_file_path.ends_with("pyproject.toml") {
+        let direct_deps = parse_pyproject_dependencies(package_file_path);
+        log(
+            LogLevel::Info,
+            &format!("Using max dependency depth: {max_depth}"),
+        );
+        direct_deps.map(|(direct_deps, extras)| {
+            resolve_python_dependencies(&direct_deps, &extras, package_file_path, max_depth)
+        })
     } else {
         log(LogLevel::Info, "Processing requirements.txt format");
+        let direct_deps = parse_requirements_file(package_file_path);
+        log(
+            LogLevel::Info,
+            &format!("Using max dependency depth: {max_depth}"),
+        );
+        direct_deps.map(|(direct_deps, extras)| {
+            resolve_python_dependencies(&direct_deps, &extras, package_file_path, max_depth)
+        })
+    };
 
-        match File::open(package_file_path) {
-            Ok(file) => {
-                let reader = BufReader::new(file);
-                let mut direct_deps = Vec::new();
-
-                // Direct dependencies
-                for line_result in reader.lines() {
-                    match line_result {
-                        Ok(line) => {
-                            let line = line.trim();
-                            if line.is_empty() || line.starts_with('#') {
-                                continue;
-                            }
-
-                            // Parse requirement line (supporting various formats)
-                            if let Some((name, version)) = parse_requirement_line(line) {
-                                direct_deps.push((name, version));
-                            } else {
-                                log(LogLevel::Warn, &format!("Invalid requirement line: {line}"));
-                            }
-                        }
-                        Err(err) => {
-                            log_error("Failed to read line from requirements.txt", &err);
-                        }
-                    }
-                }
+    // Process all resolved dependencies
+    let mut licenses: Vec<LicenseInfo> = all_deps
+        .unwrap_or_default()
+        .into_par_iter()
+        .map(|(name, version)| {
+            log(
+                LogLevel::Info,
+                &format!("Processing dependency: {name} ({version})"),
+            );
 
-                log(
-                    LogLevel::Info,
-                    &format!(
-                        "Found {} direct requirements in requirements.txt",
-                        direct_deps.len()
-                    ),
-                );
+            let (license_result, license_confidence) =
+                time_dependency("pypi", &name, &version, || {
+                    fetch_license_for_python_dependency(&name, &version)
+                });
+            let license = Some(license_result);
+            let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
 
-                // Try to resolve all dependencies (direct + transitive)
-                let max_depth = config.dependencies.max_depth;
+            if is_restrictive {
                 log(
-                    LogLevel::Info,
-                    &format!("Using max dependency depth: {max_depth}"),
+                    LogLevel::Warn,
+                    &format!("Restrictive license found: {license:?} for {name}"),
                 );
-                let all_deps =
-                    resolve_python_dependencies(&direct_deps, package_file_path, max_depth);
+            }
 
-                // Process all resolved dependencies
-                for (name, version) in all_deps {
-                    log(
-                        LogLevel::Info,
-                        &format!("Processing dependency: {name} ({version})"),
-                    );
+            LicenseInfo {
+                name,
+                version,
+                license: license.clone(),
+                is_restrictive,
+                compatibility: LicenseCompatibility::Unknown,
+                osi_status: match &license {
+                    Some(l) => crate::licenses::get_osi_status(l),
+                    None => crate::licenses::OsiStatus::Unknown,
+                },
+                license_confidence,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: DependencyScope::Runtime,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
+            }
+        })
+        .collect();
 
-                    let license_result = fetch_license_for_python_dependency(&name, &version);
-                    let license = Some(license_result);
-                    let is_restrictive =
-                        is_license_restrictive(&license, &known_licenses, config.strict);
+    if let Some(graph) = python_lock_dependency_graph(Path::new(package_file_path)) {
+        attach_dependency_paths(&mut licenses, &graph.paths());
+        attach_dependency_requires(&mut licenses, &graph.requires());
+    }
 
-                    if is_restrictive {
-                        log(
-                            LogLevel::Warn,
-                            &format!("Restrictive license found: {license:?} for {name}"),
-                        );
-                    }
+    log(
+        LogLevel::Info,
+        &format!("Found {} Python dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
 
-                    licenses.push(LicenseInfo {
-                        name,
-                        version,
-                        license: license.clone(),
-                        is_restrictive,
-                        compatibility: LicenseCompatibility::Unknown,
-                        osi_status: match &license {
-                            Some(l) => crate::licenses::get_osi_status(l),
-                            None => crate::licenses::OsiStatus::Unknown,
-                        },
-                    });
-                }
+/// Extras requested for direct requirements, keyed by normalized package name
+type RequestedExtras = HashMap<String, Vec<String>>;
 
-                log(
-                    LogLevel::Info,
-                    &format!(
-                        "Processed {} total dependencies (including transitive)",
-                        licenses.len()
-                    ),
-                );
+/// Read the `[project].dependencies` list of a pyproject.toml
+fn parse_pyproject_dependencies(
+    package_file_path: &str,
+) -> Option<(Vec<(String, String)>, RequestedExtras)> {
+    let content = match fs::read_to_string(package_file_path) {
+        Ok(content) => content,
+        Err(err) => {
+            log_error("Failed to read pyproject.toml file", &err);
+            return None;
+        }
+    };
+
+    let toml_config = match toml::from_str::<TomlValue>(&content) {
+        Ok(toml_config) => toml_config,
+        Err(err) => {
+            log_error("Failed to parse pyproject.toml", &err);
+            return None;
+        }
+    };
+
+    let Some(project) = toml_config.as_table().and_then(|t| t.get("project")) else {
+        log(
+            LogLevel::Warn,
+            "No 'project' section found in pyproject.toml",
+        );
+        return None;
+    };
+
+    let Some(deps) = project
+        .as_table()
+        .and_then(|t| t.get("dependencies"))
+        .and_then(|d| d.as_array())
+    else {
+        log(
+            LogLevel::Warn,
+            "Failed to find dependencies in pyproject.toml",
+        );
+        return None;
+    };
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} Python dependencies", deps.len()),
+    );
+    log_debug("Dependencies", deps);
+
+    let mut direct_deps = Vec::new();
+    let mut extras = RequestedExtras::new();
+    for dep_str in deps.iter().filter_map(|dep| dep.as_str()) {
+        if let Some((name, version)) = parse_pypi_requirement(dep_str) {
+            let requested = requirement_extras(dep_str);
+            if !requested.is_empty() {
+                extras.insert(normalize_package_name(&name), requested);
             }
+            direct_deps.push((name, version));
+        }
+    }
+
+    Some((direct_deps, extras))
+}
+
+/// Read the direct requirements of a requirements.txt style file
+fn parse_requirements_file(
+    package_file_path: &str,
+) -> Option<(Vec<(String, String)>, RequestedExtras)> {
+    let file = match File::open(package_file_path) {
+        Ok(file) => file,
+        Err(err) => {
+            log_error("Failed to open requirements.txt file", &err);
+            return None;
+        }
+    };
+
+    let mut direct_deps = Vec::new();
+    let mut extras = RequestedExtras::new();
+    let mut pending = String::new();
+
+    for line_result in BufReader::new(file).lines() {
+        let line = match line_result {
+            Ok(line) => line,
             Err(err) => {
-                log_error("Failed to open requirements.txt file", &err);
+                log_error("Failed to read line from requirements.txt", &err);
+                continue;
             }
+        };
+
+        // Join backslash continuations into a single logical line
+        if let Some(continued) = line.trim_end().strip_suffix('\\') {
+            pending.push_str(continued);
+            pending.push(' ');
+            continue;
+        }
+        pending.push_str(&line);
+        let logical_line = std::mem::take(&mut pending);
+
+        let Some(requirement) = clean_requirement_line(&logical_line) else {
+            continue;
+        };
+
+        // Parse requirement line (supporting various formats)
+        if let Some((name, version)) = parse_requirement_line(requirement) {
+            let requested = requirement_extras(requirement);
+            if !requested.is_empty() {
+                extras.insert(normalize_package_name(&name), requested);
+            }
+            direct_deps.push((name, version));
+        } else {
+            log(
+                LogLevel::Warn,
+                &format!("Invalid requirement line: {requirement}"),
+            );
         }
     }
 
     log(
         LogLevel::Info,
-        &format!("Found {} Python dependencies with licenses", licenses.len()),
+        &format!(
+            "Found {} direct requirements in requirements.txt",
+            direct_deps.len()
+        ),
     );
-    licenses
+
+    Some((direct_deps, extras))
+}
+
+/// Strip comments, pip options and hashes from a requirements.txt line
+///
+/// Returns None for lines that carry no requirement, such as `-r other.txt`,
+/// `--index-url ...` or editable installs.
+fn clean_requirement_line(line: &str) -> Option<&str> {
+    let line = match line.find(" #") {
+        Some(pos) => &line[..pos],
+        None => line,
+    };
+    let line = line.trim();
+
+    if line.is_empty() || line.starts_with('#') || line.starts_with('-') {
+        return None;
+    }
+
+    // Per-requirement options like --hash follow the requirement itself
+    let line = match line.find(" --") {
+        Some(pos) => line[..pos].trim(),
+        None => line,
+    };
+
+    Some(line)
+}
+
+/// Parse a Pipfile.lock, covering both the `default` and `develop` groups
+fn parse_pipfile_lock(package_file_path: &str) -> Option<Vec<(String, String)>> {
+    let content = match fs::read_to_string(package_file_path) {
+        Ok(content) => content,
+        Err(err) => {
+            log_error("Failed to read Pipfile.lock", &err);
+            return None;
+        }
+    };
+
+    let json: Value = match serde_json::from_str(&content) {
+        Ok(json) => json,
+        Err(err) => {
+            log_error("Failed to parse Pipfile.lock", &err);
+            return None;
+        }
+    };
+
+    let mut deps = Vec::new();
+    for group in ["default", "develop"] {
+        if let Some(packages) = json.get(group).and_then(|g| g.as_object()) {
+            for (name, info) in packages {
+                if let Some(marker) = info
+                    .get("markers")
+                    .and_then(|m| m.as_str())
+                    .and_then(EnvironmentMarker::parse)
+                {
+                    log_debug(
+                        "Environment Marker (Pipfile.lock)",
+                        &format!("{name}: {}", marker.describe()),
+                    );
+                }
+
+                // Packages from VCS or paths have no pinned version
+                let version = info
+                    .get("version")
+                    .and_then(|v| v.as_str())
+                    .map(|v| v.trim_start_matches("==").to_string())
+                    .unwrap_or_else(|| "latest".to_string());
+
+                if !deps.iter().any(|(n, _)| n == name) {
+                    deps.push((name.clone(), version));
+                }
+            }
+        }
+    }
+
+    log(
+        LogLevel::Info,
+        &format!("Parsed {} packages from Pipfile.lock", deps.len()),
+    );
+    Some(deps)
+}
+
+/// Parse a poetry.lock file into its pinned packages
+fn parse_poetry_lock(package_file_path: &str) -> Option<Vec<(String, String)>> {
+    let content = match fs::read_to_string(package_file_path) {
+        Ok(content) => content,
+        Err(err) => {
+            log_error("Failed to read poetry.lock", &err);
+            return None;
+        }
+    };
+
+    let lock_data: TomlValue = match toml::from_str(&content) {
+        Ok(lock_data) => lock_data,
+        Err(err) => {
+            log_error("Failed to parse poetry.lock", &err);
+            return None;
+        }
+    };
+
+    let deps: Vec<(String, String)> = lock_data
+        .get("package")
+        .and_then(|p| p.as_array())
+        .map(|packages| {
+            packages
+                .iter()
+                .filter_map(|package| {
+                    let name = package.get("name")?.as_str()?;
+                    let version = package.get("version")?.as_str()?;
+                    Some((name.to_string(), version.to_string()))
+                })
+                .collect()
+        })
+        .unwrap_or_default();
+
+    log(
+        LogLevel::Info,
+        &format!("Parsed {} packages from poetry.lock", deps.len()),
+    );
+    Some(deps)
+}
+
+/// Dependency graph of a poetry.lock, or of the uv.lock next to a pyproject.toml
+///
+/// Both lockfiles record the requirements of every package; Pipfile.lock and
+/// requirements files don't, so they get no paths.
+fn python_lock_dependency_graph(package_file_path: &Path) -> Option<DependencyGraph> {
+    let read = |path: &Path| {
+        let content = fs::read_to_string(path).ok()?;
+        toml::from_str::<TomlValue>(&content).ok()
+    };
+    match package_file_path.file_name()?.to_str()? {
+        "poetry.lock" => {
+            let lock = read(package_file_path)?;
+            let pyproject = read(&package_file_path.with_file_name("pyproject.toml"));
+            Some(poetry_dependency_graph(&lock, pyproject.as_ref()))
+        }
+        "pyproject.toml" => read(&package_file_path.with_file_name("uv.lock"))
+            .map(|lock| uv_dependency_graph(&lock)),
+        _ => None,
+    }
+}
+
+/// `[[package]]` entries of a TOML lockfile with their name and version
+fn lock_packages(lock: &TomlValue) -> Vec<(&str, &str, &TomlValue)> {
+    lock.get("package")
+        .and_then(|p| p.as_array())
+        .map(|packages| {
+            packages
+                .iter()
+                .filter_map(|package| {
+                    let name = package.get("name")?.as_str()?;
+                    let version = package.get("version")?.as_str()?;
+                    Some((name, version, package))
+                })
+                .collect()
+        })
+        .unwrap_or_default()
+}
+
+/// Graph of poetry.lock, entered from the dependencies declared in pyproject.toml
+///
+/// Both `[project].dependencies` and Poetry's own dependency tables, including
+/// groups, count as direct dependencies.
+fn poetry_dependency_graph(lock: &TomlValue, pyproject: Option<&TomlValue>) -> DependencyGraph {
+    let mut graph = DependencyGraph::new();
+    let packages = lock_packages(lock);
+    for (name, version, _) in &packages {
+        graph.add_package(&normalize_package_name(name), name, version);
+    }
+    for (name, _, package) in &packages {
+        let requires = package.get("dependencies").and_then(|d| d.as_table());
+        for required in requires.into_iter().flat_map(|table| table.keys()) {
+            graph.add_dependency(
+                &normalize_package_name(name),
+                &normalize_package_name(required),
+            );
+        }
+    }
+
+    let Some(pyproject) = pyproject else {
+        return graph;
+    };
+    let project = pyproject
+        .get("project")
+        .and_then(|p| p.get("dependencies"))
+        .and_then(|d| d.as_array());
+    for requirement in project.into_iter().flatten().filter_map(|r| r.as_str()) {
+        if let Some((name, _)) = parse_pypi_requirement(requirement) {
+            graph.add_direct(&normalize_package_name(&name));
+        }
+    }
+    let poetry = pyproject.get("tool").and_then(|t| t.get("poetry"));
+    let groups = poetry
+        .and_then(|p| p.get("group"))
+        .and_then(|g| g.as_table())
+        .into_iter()
+        .flat_map(|groups| groups.values())
+        .filter_map(|group| group.get("dependencies"));
+    let tables = ["dependencies", "dev-dependencies"]
+        .into_iter()
+        .filter_map(|key| poetry.and_then(|p| p.get(key)))
+        .chain(groups)
+        .filter_map(|table| table.as_table());
+    for table in tables {
+        // `python` is the interpreter constraint, not a package
+        for name in table.keys().filter(|name| *name != "python") {
+            graph.add_direct(&normalize_package_name(name));
+        }
+    }
+    graph
+}
+
+/// Graph of uv.lock, entered from the dependencies of the project's own package
+///
+/// uv locks the project itself as a package with an `editable` or `virtual`
+/// source; its dependencies, optional dependencies and dev groups are direct.
+fn uv_dependency_graph(lock: &TomlValue) -> DependencyGraph {
+    let mut graph = DependencyGraph::new();
+    let packages = lock_packages(lock);
+    let is_project = |package: &TomlValue| {
+        package.get("source").is_some_and(|source| {
+            source.get("editable").is_some() || source.get("virtual").is_some()
+        })
+    };
+    let requirements = |package: &TomlValue| -> Vec<String> {
+        let grouped = ["optional-dependencies", "dev-dependencies"]
+            .into_iter()
+            .filter_map(|key| package.get(key).and_then(|g| g.as_table()))
+            .flat_map(|groups| groups.values());
+        package
+            .get("dependencies")
+            .into_iter()
+            .chain(grouped)
+            .filter_map(|list| list.as_array())
+            .flatten()
+            .filter_map(|dep| dep.get("name")?.as_str())
+            .map(normalize_package_name)
+            .collect()
+    };
+
+    for (name, version, package) in &packages {
+        if !is_project(package) {
+            graph.add_package(&normalize_package_name(name), name, version);
+        }
+    }
+    for (name, _, package) in &packages {
+        for required in requirements(package) {
+            if is_project(package) {
+                graph.add_direct(&required);
+            } else {
+                graph.add_dependency(&normalize_package_name(name), &required);
+            }
+        }
+    }
+    graph
+}
+
+/// Normalize a Python package name as described in PEP 503
+fn normalize_package_name(name: &str) -> String {
+    let mut normalized = String::with_capacity(name.len());
+    let mut last_was_separator = false;
+    for ch in name.chars() {
+        if matches!(ch, '-' | '_' | '.') {
+            if !last_was_separator {
+                normalized.push('-');
+            }
+            last_was_separator = true;
+        } else {
+            normalized.extend(ch.to_lowercase());
+            last_was_separator = false;
+        }
+    }
+    normalized
+}
+
+/// Extract the extras requested by a requirement, e.g. `requests[socks,security]`
+fn requirement_extras(req_str: &str) -> Vec<String> {
+    let base_req = req_str.split(';').next().unwrap_or(req_str);
+    let Some(start) = base_req.find('[') else {
+        return Vec::new();
+    };
+    let Some(end) = base_req[start..].find(']') else {
+        return Vec::new();
+    };
+
+    base_req[start + 1..start + end]
+        .split(',')
+        .map(|extra| normalize_package_name(extra.trim()))
+        .filter(|extra| !extra.is_empty())
+        .collect()
 }
 
 /// Fetch the license for a Python dependency, trying local sources first, then PyPI
-pub fn fetch_license_for_python_dependency(name: &str, version: &str) -> String {
-    if let Some(license) = get_license_from_local_site_packages(name) {
+///
+/// The second value is the classifier confidence when the license was detected
+/// from a LICENSE file rather than package metadata.
+pub fn fetch_license_for_python_dependency(name: &str, version: &str) -> (String, Option<f32>) {
+    if let Some((license, confidence)) = get_license_from_local_site_packages(name) {
         log(
             LogLevel::Info,
             &format!("Found license in local site-packages for {name}: {license}"),
         );
-        return license;
+        return (license, confidence);
     }
 
-    fetch_license_from_pypi(name, version)
+    let cache_name = normalize_package_name(name);
+    if let Some(license) = get_cached_license("pypi", &cache_name, version) {
+        return (license, None);
+    }
+
+    let license = fetch_license_from_pypi(name, version);
+    cache_license("pypi", &cache_name, version, &license);
+    (license, None)
 }
 
-fn get_license_from_local_site_packages(package_name: &str) -> Option<String> {
+fn get_license_from_local_site_packages(package_name: &str) -> Option<(String, Option<f32>)> {
     let python_paths = get_python_site_packages_paths();
 
     for site_packages in python_paths {
         if let Some(license) = check_site_package_metadata(&site_packages, package_name) {
-            return Some(license);
+            return Some((license, None));
+        }
+
+        if let Some(detected) = detect_site_package_license_text(&site_packages, package_name) {
+            return Some((detected.license, Some(detected.confidence)));
         }
 
         if let Some(license) = check_site_package_license_file(&site_packages, package_name) {
-            return Some(license);
+            return Some((license, None));
         }
     }
     None
 }
 
+/// Classify the license files shipped with an installed package
+///
+/// Wheels keep license files in the `.dist-info` directory (under `licenses/`
+/// since PEP 639); older installs keep them in the package directory.
+fn detect_site_package_license_text(
+    site_packages: &Path,
+    package_name: &str,
+) -> Option<DetectedLicense> {
+    let normalized = normalize_package_name(package_name).replace('-', "_");
+    let mut dirs = vec![
+        site_packages.join(package_name),
+        site_packages.join(&normalized),
+    ];
+
+    if let Ok(entries) = fs::read_dir(site_packages) {
+        for entry in entries.filter_map(|e| e.ok()) {
+            let dir_name = entry.file_name().to_string_lossy().to_lowercase();
+            let is_dist_info = dir_name
+                .strip_suffix(".dist-info")
+                .and_then(|stem| stem.rsplit_once('-'))
+                .is_some_and(|(name, _version)| {
+                    normalize_package_name(name) == normalize_package_name(package_name)
+                });
+            if is_dist_info {
+                dirs.push(entry.path().join("licenses"));
+                dirs.push(entry.path());
+            }
+        }
+    }
+
+    dirs.iter()
+        .filter(|dir| dir.is_dir())
+        .find_map(|dir| detect_license_in_dir(dir))
+}
+
 fn get_python_site_packages_paths() -> Vec<std::path::PathBuf> {
     let mut paths = Vec::new();
 
@@ -513,13 +902,13 @@ fn detect_license_from_content(content: &str) -> Option<String> {
 }
 
 fn fetch_license_from_pypi(name: &str, version: &str) -> String {
-    let api_url = format!("https://pypi.org/pypi/{name}/{version}/json");
+    let api_url = format!("{}/pypi/{name}/{version}/json", registry::pypi_url());
     log(
         LogLevel::Info,
         &format!("Fetching license from PyPI: {api_url}"),
     );
 
-    match reqwest::blocking::get(&api_url) {
+    match registry::get(Registry::PyPi, &api_url) {
         Ok(response) => {
             let status = response.status();
             log(
@@ -529,15 +918,15 @@ fn fetch_license_from_pypi(name: &str, version: &str) -> String {
 
             if status.is_success() {
                 match response.json::<Value>() {
-                    Ok(json) => match json["info"]["license"].as_str() {
-                        Some(license_str) if !license_str.is_empty() => {
+                    Ok(json) => match license_from_pypi_info(&json["info"]) {
+                        Some(license_str) => {
                             log(
                                 LogLevel::Info,
                                 &format!("License found for {name}: {license_str}"),
                             );
-                            license_str.to_string()
+                            license_str
                         }
-                        _ => {
+                        None => {
                             log(
                                 LogLevel::Warn,
                                 &format!("No license found for {name} ({version})"),
@@ -565,6 +954,82 @@ fn fetch_license_from_pypi(name: &str, version: &str) -> String {
     }
 }
 
+/// Determine a package license from the `info` block of the PyPI JSON API
+///
+/// Prefers the PEP 639 `license_expression`, then a short `license` field, then
+/// the trove classifiers. Projects often paste their full license text into
+/// `license`, in which case the classifiers are more useful.
+pub fn license_from_pypi_info(info: &Value) -> Option<String> {
+    if let Some(expression) = info["license_expression"].as_str() {
+        if !expression.trim().is_empty() {
+            return Some(expression.trim().to_string());
+        }
+    }
+
+    let license_field = info["license"]
+        .as_str()
+        .map(str::trim)
+        .filter(|l| !l.is_empty() && !l.eq_ignore_ascii_case("UNKNOWN"));
+
+    if let Some(license) = license_field {
+        if license.len() <= 100 && !license.contains('\n') {
+            return Some(license.to_string());
+        }
+    }
+
+    let classifier_licenses: Vec<String> = info["classifiers"]
+        .as_array()
+        .map(|classifiers| {
+            classifiers
+                .iter()
+                .filter_map(|c| c.as_str())
+                .filter_map(license_from_classifier)
+                .collect()
+        })
+        .unwrap_or_default();
+
+    if !classifier_licenses.is_empty() {
+        return Some(classifier_licenses.join(" OR "));
+    }
+
+    license_field.and_then(detect_license_from_content)
+}
+
+/// Map a `License :: ...` trove classifier to an SPDX identifier where one is known
+fn license_from_classifier(classifier: &str) -> Option<String> {
+    let name = classifier
+        .strip_prefix("License :: ")?
+        .rsplit(" :: ")
+        .next()?;
+
+    let spdx = match name {
+        "OSI Approved" | "Other/Proprietary License" => return None,
+        "MIT License" => "MIT",
+        "MIT No Attribution License (MIT-0)" => "MIT-0",
+        "Apache Software License" => "Apache-2.0",
+        "ISC License (ISCL)" => "ISC",
+        "Mozilla Public License 2.0 (MPL 2.0)" => "MPL-2.0",
+        "GNU General Public License v2 (GPLv2)" => "GPL-2.0",
+        "GNU General Public License v2 or later (GPLv2+)" => "GPL-2.0-or-later",
+        "GNU General Public License v3 (GPLv3)" => "GPL-3.0",
+        "GNU General Public License v3 or later (GPLv3+)" => "GPL-3.0-or-later",
+        "GNU Lesser General Public License v2 (LGPLv2)" => "LGPL-2.0",
+        "GNU Lesser General Public License v2 or later (LGPLv2+)" => "LGPL-2.0-or-later",
+        "GNU Lesser General Public License v3 (LGPLv3)" => "LGPL-3.0",
+        "GNU Lesser General Public License v3 or later (LGPLv3+)" => "LGPL-3.0-or-later",
+        "GNU Affero General Public License v3" => "AGPL-3.0",
+        "GNU Affero General Public License v3 or later (AGPLv3+)" => "AGPL-3.0-or-later",
+        "Eclipse Public License 2.0 (EPL-2.0)" => "EPL-2.0",
+        "Python Software Foundation License" => "PSF-2.0",
+        "The Unlicense (Unlicense)" => "Unlicense",
+        "Zope Public License" => "ZPL-2.1",
+        "Boost Software License 1.0 (BSL-1.0)" => "BSL-1.0",
+        other => other,
+    };
+
+    Some(spdx.to_string())
+}
+
 /// Parse a requirement line from requirements.txt supporting various formats
 /// Handles requirements.txt format with optional environment markers
 /// Examples:
@@ -590,16 +1055,23 @@ fn parse_requirement_line(line: &str) -> Option<(String, String)> {
         );
     }
 
+    // Direct references (`name @ https://...`) have no version to report
+    if let Some((name, _url)) = base_req.split_once(" @ ") {
+        return Some((strip_extras(name), "latest".to_string()));
+    }
+
     // Handle various requirement formats on the base requirement
     if let Some((name, version)) = base_req
-        .split_once("==")
+        .split_once("===")
+        .or_else(|| base_req.split_once("=="))
         .or_else(|| base_req.split_once(">="))
         .or_else(|| base_req.split_once(">"))
         .or_else(|| base_req.split_once("~="))
         .or_else(|| base_req.split_once("<="))
         .or_else(|| base_req.split_once("<"))
+        .or_else(|| base_req.split_once("!="))
     {
-        let name = name.trim();
+        let name = strip_extras(name);
         let version = version
             .trim()
             .trim_matches('"')
@@ -609,13 +1081,19 @@ fn parse_requirement_line(line: &str) -> Option<(String, String)> {
         Some((name.to_string(), version))
     } else {
         // Package name without version (with or without marker)
-        Some((base_req.to_string(), "latest".to_string()))
+        Some((strip_extras(base_req), "latest".to_string()))
     }
 }
 
+/// Drop an extras suffix such as `[security]` from a requirement name
+fn strip_extras(name: &str) -> String {
+    name.split('[').next().unwrap_or(name).trim().to_string()
+}
+
 /// Resolve all Python dependencies (direct + transitive) with configurable depth
 fn resolve_python_dependencies(
     direct_deps: &[(String, String)],
+    direct_extras: &RequestedExtras,
     package_file_path: &str,
     max_depth: u32,
 ) -> Vec<(String, String)> {
@@ -644,7 +1122,7 @@ fn resolve_python_dependencies(
         LogLevel::Info,
         "Falling back to PyPI-based transitive dependency resolution",
     );
-    resolve_with_pypi(direct_deps, max_depth)
+    resolve_with_pypi(direct_deps, direct_extras, max_depth)
 }
 
 /// Try to resolve dependencies using uv tool with depth limit
@@ -765,12 +1243,22 @@ fn parse_pip_compile_output(output: &str) -> Vec<(String, String)> {
 }
 
 /// Resolve transitive dependencies using PyPI API with configurable depth limit
-fn resolve_with_pypi(direct_deps: &[(String, String)], max_depth: u32) -> Vec<(String, String)> {
+fn resolve_with_pypi(
+    direct_deps: &[(String, String)],
+    direct_extras: &RequestedExtras,
+    max_depth: u32,
+) -> Vec<(String, String)> {
     let mut all_deps = HashMap::new();
     let mut processed = HashSet::new();
-    let mut to_process: Vec<(String, String, u32)> = direct_deps
+    let mut to_process: Vec<(String, String, Vec<String>, u32)> = direct_deps
         .iter()
-        .map(|(name, version)| (name.clone(), version.clone(), 0))
+        .map(|(name, version)| {
+            let extras = direct_extras
+                .get(&normalize_package_name(name))
+                .cloned()
+                .unwrap_or_default();
+            (name.clone(), version.clone(), extras, 0)
+        })
         .collect();
 
     log(
@@ -785,8 +1273,8 @@ fn resolve_with_pypi(direct_deps: &[(String, String)], max_depth: u32) -> Vec<(S
     let mut depth_stats = HashMap::new();
 
     // Iteratively resolve dependencies with depth tracking
-    while let Some((name, version, depth)) = to_process.pop() {
-        let key = format!("{name}@{version}");
+    while let Some((name, version, extras, depth)) = to_process.pop() {
+        let key = format!("{name}@{version}[{}]", extras.join(","));
         if processed.contains(&key) {
             continue;
         }
@@ -812,7 +1300,7 @@ fn resolve_with_pypi(direct_deps: &[(String, String)], max_depth: u32) -> Vec<(S
         );
 
         // Fetch dependencies for this package
-        if let Ok(transitive_deps) = fetch_pypi_dependencies(&name, &version) {
+        if let Ok(transitive_deps) = fetch_pypi_dependencies(&name, &version, &extras) {
             log(
                 LogLevel::Info,
                 &format!(
@@ -823,10 +1311,10 @@ fn resolve_with_pypi(direct_deps: &[(String, String)], max_depth: u32) -> Vec<(S
                 ),
             );
 
-            for (dep_name, dep_version) in transitive_deps {
-                let dep_key = format!("{dep_name}@{dep_version}");
+            for (dep_name, dep_version, dep_extras) in transitive_deps {
+                let dep_key = format!("{dep_name}@{dep_version}[{}]", dep_extras.join(","));
                 if !processed.contains(&dep_key) {
-                    to_process.push((dep_name, dep_version, depth + 1));
+                    to_process.push((dep_name, dep_version, dep_extras, depth + 1));
                 }
             }
         }
@@ -855,29 +1343,25 @@ fn resolve_with_pypi(direct_deps: &[(String, String)], max_depth: u32) -> Vec<(S
 }
 
 /// Fetch dependencies from PyPI for a specific package
-fn fetch_pypi_dependencies(name: &str, version: &str) -> Result<Vec<(String, String)>, String> {
-    let api_url = format!("https://pypi.org/pypi/{name}/{version}/json");
-
-    match reqwest::blocking::get(&api_url) {
+///
+/// Requirements gated on an extra are only followed when that extra was requested.
+fn fetch_pypi_dependencies(
+    name: &str,
+    version: &str,
+    extras: &[String],
+) -> Result<Vec<(String, String, Vec<String>)>, String> {
+    let api_url = format!("{}/pypi/{name}/{version}/json", registry::pypi_url());
+
+    match registry::get(Registry::PyPi, &api_url) {
         Ok(response) => {
             if response.status().is_success() {
                 if let Ok(json) = response.json::<Value>() {
-                    let mut deps = Vec::new();
-
-                    // Extract requires_dist information
-                    if let Some(requires_dist) = json["info"]["requires_dist"].as_array() {
-                        for req in requires_dist {
-                            if let Some(req_str) = req.as_str() {
-                                if let Some((dep_name, dep_version)) =
-                                    parse_pypi_requirement(req_str)
-                                {
-                                    deps.push((dep_name, dep_version));
-                                }
-                            }
-                        }
-                    }
+                    let requires_dist: Vec<&str> = json["info"]["requires_dist"]
+                        .as_array()
+                        .map(|reqs| reqs.iter().filter_map(|r| r.as_str()).collect())
+                        .unwrap_or_default();
 
-                    return Ok(deps);
+                    return Ok(select_requirements(&requires_dist, extras));
                 }
             }
         }
@@ -889,6 +1373,33 @@ fn fetch_pypi_dependencies(name: &str, version: &str) -> Result<Vec<(String, Str
     Ok(Vec::new())
 }
 
+/// Pick the requirements from requires_dist that apply given the requested extras
+fn select_requirements(
+    requires_dist: &[&str],
+    extras: &[String],
+) -> Vec<(String, String, Vec<String>)> {
+    let mut deps = Vec::new();
+
+    for req_str in requires_dist {
+        let gated_on = req_str
+            .split_once(';')
+            .and_then(|(_, marker)| EnvironmentMarker::parse(marker))
+            .map(|marker| marker.required_extras())
+            .unwrap_or_default();
+
+        if !gated_on.is_empty() && !gated_on.iter().any(|extra| extras.contains(extra)) {
+            log_debug("Skipping requirement for unrequested extra", req_str);
+            continue;
+        }
+
+        if let Some((dep_name, dep_version)) = parse_pypi_requirement(req_str) {
+            deps.push((dep_name, dep_version, requirement_extras(req_str)));
+        }
+    }
+
+    deps
+}
+
 /// Parse a PyPI requires_dist requirement string with full PEP 508 support
 /// Handles requirements like:
 /// - "requests>=2.20.0"
@@ -1082,7 +1593,7 @@ mod tests {
     #[test]
     fn test_fetch_license_for_python_dependency_error_handling() {
         // Test with a definitely non-existent package
-        let result =
+        let (result, _) =
             fetch_license_for_python_dependency("definitely_nonexistent_package_12345", "1.0.0");
         assert!(result.contains("Unknown") || result.contains("nonexistent"));
     }
@@ -1228,4 +1739,239 @@ mod tests {
         let marker2 = EnvironmentMarker::parse("sys_platform == 'darwin'");
         assert!(marker2.unwrap().applies_to_environment());
     }
+
+    #[test]
+    fn test_parse_pipfile_lock() {
+        let temp_dir = TempDir::new().unwrap();
+        let lock_path = temp_dir.path().join("Pipfile.lock");
+        std::fs::write(
+            &lock_path,
+            r#"{
+    "_meta": {"hash": {"sha256": "abc"}},
+    "default": {
+        "requests": {"version": "==2.31.0", "markers": "python_version >= '3.7'"},
+        "mylib": {"git": "https://github.com/example/mylib.git", "ref": "abc123"}
+    },
+    "develop": {
+        "pytest": {"version": "==7.4.0"}
+    }
+}"#,
+        )
+        .unwrap();
+
+        let deps = parse_pipfile_lock(lock_path.to_str().unwrap()).unwrap();
+        assert_eq!(deps.len(), 3);
+        assert!(deps.contains(&("requests".to_string(), "2.31.0".to_string())));
+        assert!(deps.contains(&("mylib".to_string(), "latest".to_string())));
+        assert!(deps.contains(&("pytest".to_string(), "7.4.0".to_string())));
+    }
+
+    #[test]
+    fn test_parse_poetry_lock() {
+        let temp_dir = TempDir::new().unwrap();
+        let lock_path = temp_dir.path().join("poetry.lock");
+        std::fs::write(
+            &lock_path,
+            r#"[[package]]
+name = "certifi"
+version = "2024.2.2"
+description = "Python package for providing Mozilla's CA Bundle."
+optional = false
+
+[[package]]
+name = "requests"
+version = "2.31.0"
+
+[package.dependencies]
+certifi = ">=2017.4.17"
+
+[metadata]
+lock-version = "2.0"
+"#,
+        )
+        .unwrap();
+
+        let deps = parse_poetry_lock(lock_path.to_str().unwrap()).unwrap();
+        assert_eq!(
+            deps,
+            vec![
+                ("certifi".to_string(), "2024.2.2".to_string()),
+                ("requests".to_string(), "2.31.0".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_poetry_dependency_graph() {
+        let lock: TomlValue = toml::from_str(
+            r#"[[package]]
+name = "certifi"
+version = "2024.2.2"
+
+[[package]]
+name = "requests"
+version = "2.31.0"
+
+[package.dependencies]
+certifi = ">=2017.4.17"
+
+[[package]]
+name = "pytest"
+version = "8.0.0"
+"#,
+        )
+        .unwrap();
+        let pyproject: TomlValue = toml::from_str(
+            r#"[tool.poetry.dependencies]
+python = "^3.11"
+Requests = "^2.31"
+
+[tool.poetry.group.test.dependencies]
+pytest = "^8.0"
+"#,
+        )
+        .unwrap();
+
+        let graph = poetry_dependency_graph(&lock, Some(&pyproject));
+        let paths = graph.paths();
+        assert_eq!(
+            paths["certifi@2024.2.2"],
+            vec!["requests@2.31.0", "certifi@2024.2.2"]
+        );
+        assert_eq!(paths["pytest@8.0.0"], vec!["pytest@8.0.0"]);
+        assert_eq!(
+            graph.requires()["requests@2.31.0"],
+            vec!["certifi@2024.2.2"]
+        );
+    }
+
+    #[test]
+    fn test_uv_dependency_graph() {
+        let lock: TomlValue = toml::from_str(
+            r#"version = 1
+
+[[package]]
+name = "app"
+version = "0.1.0"
+source = { editable = "." }
+dependencies = [{ name = "httpx" }]
+
+[package.dev-dependencies]
+dev = [{ name = "pytest" }]
+
+[[package]]
+name = "httpx"
+version = "0.27.0"
+source = { registry = "https://pypi.org/simple" }
+dependencies = [{ name = "idna" }]
+
+[[package]]
+name = "idna"
+version = "3.7"
+source = { registry = "https://pypi.org/simple" }
+
+[[package]]
+name = "pytest"
+version = "8.0.0"
+source = { registry = "https://pypi.org/simple" }
+"#,
+        )
+        .unwrap();
+
+        let paths = uv_dependency_graph(&lock).paths();
+        assert_eq!(paths["idna@3.7"], vec!["httpx@0.27.0", "idna@3.7"]);
+        assert_eq!(paths["pytest@8.0.0"], vec!["pytest@8.0.0"]);
+        assert!(!paths.contains_key("app@0.1.0"));
+    }
+
+    #[test]
+    fn test_clean_requirement_line() {
+        assert_eq!(clean_requirement_line("# comment"), None);
+        assert_eq!(clean_requirement_line("-r base.txt"), None);
+        assert_eq!(clean_requirement_line("--index-url https://x"), None);
+        assert_eq!(clean_requirement_line("-e ."), None);
+        assert_eq!(
+            clean_requirement_line("requests==2.31.0  # pinned"),
+            Some("requests==2.31.0")
+        );
+        assert_eq!(
+            clean_requirement_line("flask==2.0.0 --hash=sha256:abc --hash=sha256:def"),
+            Some("flask==2.0.0")
+        );
+
+        assert_eq!(
+            parse_requirement_line("requests[socks]==2.31.0"),
+            Some(("requests".to_string(), "2.31.0".to_string()))
+        );
+        assert_eq!(
+            parse_requirement_line("pip @ https://github.com/pypa/pip/archive/1.3.1.zip"),
+            Some(("pip".to_string(), "latest".to_string()))
+        );
+    }
+
+    #[test]
+    fn test_requirement_extras_and_normalization() {
+        assert_eq!(normalize_package_name("Zope.Interface"), "zope-interface");
+        assert_eq!(
+            normalize_package_name("typing__extensions"),
+            "typing-extensions"
+        );
+        assert_eq!(
+            requirement_extras("requests[Socks, security]>=2.0; python_version >= '3.7'"),
+            vec!["socks".to_string(), "security".to_string()]
+        );
+        assert!(requirement_extras("requests>=2.0").is_empty());
+
+        let marker = EnvironmentMarker::parse("python_version >= '3.7' and extra == \"socks\"");
+        assert_eq!(marker.unwrap().required_extras(), vec!["socks".to_string()]);
+    }
+
+    #[test]
+    fn test_select_requirements_filters_extras() {
+        let requires_dist = [
+            "charset-normalizer<4,>=2",
+            "PySocks!=1.5.7,>=1.5.6; extra == \"socks\"",
+            "chardet<6,>=3.0.2; extra == 'use-chardet-on-py3'",
+        ];
+
+        let deps = select_requirements(&requires_dist, &[]);
+        assert_eq!(deps.len(), 1);
+        assert_eq!(deps[0].0, "charset-normalizer");
+
+        let deps = select_requirements(&requires_dist, &["socks".to_string()]);
+        assert_eq!(deps.len(), 2);
+        assert!(deps.iter().any(|(name, _, _)| name == "PySocks"));
+    }
+
+    #[test]
+    fn test_license_from_pypi_info() {
+        let info = serde_json::json!({"license_expression": "MIT OR Apache-2.0", "license": "MIT"});
+        assert_eq!(
+            license_from_pypi_info(&info),
+            Some("MIT OR Apache-2.0".to_string())
+        );
+
+        let info = serde_json::json!({"license": "BSD-3-Clause", "classifiers": []});
+        assert_eq!(
+            license_from_pypi_info(&info),
+            Some("BSD-3-Clause".to_string())
+        );
+
+        // Full license text in the license field falls back to classifiers
+        let info = serde_json::json!({
+            "license": "Copyright (c) 2024\n\nPermission is hereby granted, free of charge...",
+            "classifiers": [
+                "Programming Language :: Python :: 3",
+                "License :: OSI Approved :: Apache Software License",
+                "License :: OSI Approved :: MIT License"
+            ]
+        });
+        assert_eq!(
+            license_from_pypi_info(&info),
+            Some("Apache-2.0 OR MIT".to_string())
+        );
+
+        let info = serde_json::json!({"license": "UNKNOWN", "classifiers": []});
+        assert_eq!(license_from_pypi_info(&info), None);
+    }
 }
@@ -1,12 +1,17 @@
+use rayon::prelude::*;
 use serde_json::Value;
 use std::collections::HashMap;
 use std::fs;
 
+use crate::cache::{cache_license, get_cached_license};
 use crate::config::FeludaConfig;
-use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
 use crate::licenses::{
-    fetch_licenses_from_github, is_license_restrictive, License, LicenseCompatibility, LicenseInfo,
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, License,
+    LicenseCompatibility, LicenseInfo,
 };
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
 
 pub fn analyze_r_licenses(package_file_path: &str, config: &FeludaConfig) -> Vec<LicenseInfo> {
     let mut licenses = Vec::new();
@@ -70,41 +75,20 @@ fn parse_renv_lock(
                     );
                     log_debug("Packages", packages);
 
-                    for (name, pkg_info) in packages {
-                        let version = pkg_info["Version"]
-                            .as_str()
-                            .unwrap_or("unknown")
-                            .to_string();
-
-                        log(
-                            LogLevel::Info,
-                            &format!("Processing R package: {name} ({version})"),
-                        );
-
-                        let license_result = fetch_license_for_r_dependency(name, &version);
-                        let license = Some(license_result);
-                        let is_restrictive =
-                            is_license_restrictive(&license, known_licenses, config.strict);
-
-                        if is_restrictive {
-                            log(
-                                LogLevel::Warn,
-                                &format!("Restrictive license found: {license:?} for {name}"),
-                            );
-                        }
-
-                        licenses.push(LicenseInfo {
-                            name: name.clone(),
-                            version,
-                            license: license.clone(),
-                            is_restrictive,
-                            compatibility: LicenseCompatibility::Unknown,
-                            osi_status: match &license {
-                                Some(l) => crate::licenses::get_osi_status(l),
-                                None => crate::licenses::OsiStatus::Unknown,
-                            },
-                        });
-                    }
+                    let deps: Vec<(String, String)> = packages
+                        .iter()
+                        .map(|(name, pkg_info)| {
+                            let version = pkg_info["Version"].as_str().unwrap_or("unknown");
+                            (name.clone(), version.to_string())
+                        })
+                        .collect();
+
+                    licenses = deps
+                        .into_par_iter()
+                        .map(|(name, version)| {
+                            analyze_r_package(name, version, known_licenses, config)
+                        })
+                        .collect();
                 } else {
                     log(LogLevel::Warn, "No 'Packages' section found in renv.lock");
                 }
@@ -148,36 +132,10 @@ fn parse_description_file(
 
             let all_deps = direct_deps;
 
-            for (name, version) in all_deps {
-                log(
-                    LogLevel::Info,
-                    &format!("Processing R package: {name} ({version})"),
-                );
-
-                let license_result = fetch_license_for_r_dependency(&name, &version);
-                let license = Some(license_result);
-                let is_restrictive =
-                    is_license_restrictive(&license, known_licenses, config.strict);
-
-                if is_restrictive {
-                    log(
-                        LogLevel::Warn,
-                        &format!("Restrictive license found: {license:?} for {name}"),
-                    );
-                }
-
-                licenses.push(LicenseInfo {
-                    name,
-                    version,
-                    license: license.clone(),
-                    is_restrictive,
-                    compatibility: LicenseCompatibility::Unknown,
-                    osi_status: match &license {
-                        Some(l) => crate::licenses::get_osi_status(l),
-                        None => crate::licenses::OsiStatus::Unknown,
-                    },
-                });
-            }
+            licenses = all_deps
+                .into_par_iter()
+                .map(|(name, version)| analyze_r_package(name, version, known_licenses, config))
+                .collect();
         }
         Err(err) => {
             log_error("Failed to read DESCRIPTION file", &err);
@@ -187,6 +145,63 @@ fn parse_description_file(
     licenses
 }
 
+fn analyze_r_package(
+    name: String,
+    version: String,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+) -> LicenseInfo {
+    log(
+        LogLevel::Info,
+        &format!("Processing R package: {name} ({version})"),
+    );
+
+    let license_result = time_dependency("cran", &name, &version, || {
+        fetch_license_for_r_dependency(&name, &version)
+    });
+    let license = Some(license_result);
+    let is_restrictive = is_license_restrictive(&license, known_licenses, config.strict);
+
+    if is_restrictive {
+        log(
+            LogLevel::Warn,
+            &format!("Restrictive license found: {license:?} for {name}"),
+        );
+    }
+
+    LicenseInfo {
+        name,
+        version,
+        license: license.clone(),
+        is_restrictive,
+        compatibility: LicenseCompatibility::Unknown,
+        osi_status: match &license {
+            Some(l) => crate::licenses::get_osi_status(l),
+            None => crate::licenses::OsiStatus::Unknown,
+        },
+        license_confidence: None,
+        source_file: None,
+        dependency_path: None,
+        tier: None,
+        vulnerabilities: None,
+        copyright: None,
+        legal_files: None,
+        chosen_license: None,
+        requires: None,
+        scope: DependencyScope::Runtime,
+        manual_license: None,
+        health: None,
+        obligations: None,
+        explanation: None,
+        repository: None,
+        aliases: None,
+        purl: None,
+        review: None,
+        status: LookupStatus::Ok,
+        error: None,
+    }
+}
+
 fn parse_dcf_dependencies(content: &str) -> Vec<(String, String)> {
     let mut deps = Vec::new();
     let mut current_field = String::new();
@@ -247,13 +262,23 @@ fn process_dependency_field(field: &str, value: &str, deps: &mut Vec<(String, St
 }
 
 pub fn fetch_license_for_r_dependency(name: &str, version: &str) -> String {
+    if let Some(license) = get_cached_license("cran", name, version) {
+        return license;
+    }
+
+    let license = fetch_license_from_r_universe(name, version);
+    cache_license("cran", name, version, &license);
+    license
+}
+
+fn fetch_license_from_r_universe(name: &str, version: &str) -> String {
     let search_url = format!("https://r-universe.dev/api/search?q={name}&limit=1");
     log(
         LogLevel::Info,
         &format!("Fetching license from R-universe: {search_url}"),
     );
 
-    match reqwest::blocking::get(&search_url) {
+    match registry::get(Registry::RUniverse, &search_url) {
         Ok(response) => {
             let status = response.status();
             log(
@@ -275,7 +300,9 @@ pub fn fetch_license_for_r_dependency(name: &str, version: &str) -> String {
                                         &format!("Fetching package details from: {package_url}"),
                                     );
 
-                                    if let Ok(pkg_response) = reqwest::blocking::get(&package_url) {
+                                    if let Ok(pkg_response) =
+                                        registry::get(Registry::RUniverse, &package_url)
+                                    {
                                         if let Ok(pkg_json) = pkg_response.json::<Value>() {
                                             if let Some(license) = pkg_json["License"].as_str() {
                                                 if !license.is_empty() {
@@ -0,0 +1,568 @@
+use rayon::prelude::*;
+use serde_json::Value;
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, DependencyGraph,
+};
+use crate::license_detector::detect_license_in_dir;
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, License,
+    LicenseCompatibility, LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
+use crate::repository_license::fetch_repository_license;
+
+/// Where Bundler installs a gem from
+#[derive(Debug, Clone, PartialEq)]
+pub enum GemSource {
+    RubyGems,
+    Git { remote: String, revision: String },
+    Path(String),
+}
+
+/// A gem pinned in `Gemfile.lock`
+#[derive(Debug, Clone, PartialEq)]
+pub struct Gem {
+    pub name: String,
+    pub version: String,
+    /// Platform of a native gem, e.g. `x86_64-linux`
+    pub platform: Option<String>,
+    pub source: GemSource,
+}
+
+#[derive(Debug, Default)]
+struct GemfileLock {
+    gems: Vec<Gem>,
+    /// Gems listed in the Gemfile itself
+    dependencies: HashSet<String>,
+    /// Requirements of each locked gem, as (gem, required gem) names
+    requirements: Vec<(String, String)>,
+}
+
+pub fn analyze_ruby_licenses(lock_file_path: &str, config: &FeludaConfig) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!("Analyzing Ruby dependencies from: {lock_file_path}"),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let content = match fs::read_to_string(lock_file_path) {
+        Ok(content) => content,
+        Err(err) => {
+            log_error("Failed to read Gemfile.lock", &err);
+            return Vec::new();
+        }
+    };
+
+    let lock = parse_gemfile_lock(&content);
+    log(
+        LogLevel::Info,
+        &format!("Found {} gems in Gemfile.lock", lock.gems.len()),
+    );
+    log_debug("Gems", &lock.gems);
+    let graph = gem_dependency_graph(&lock);
+
+    let gems: Vec<Gem> = if config.dependencies.max_depth <= 1 {
+        lock.gems
+            .into_iter()
+            .filter(|gem| lock.dependencies.contains(&gem.name))
+            .collect()
+    } else {
+        lock.gems
+    };
+
+    let project_dir = Path::new(lock_file_path)
+        .parent()
+        .unwrap_or_else(|| Path::new("."));
+
+    let mut licenses: Vec<LicenseInfo> = gems
+        .into_par_iter()
+        .map(|gem| analyze_gem(gem, project_dir, &known_licenses, config))
+        .collect();
+    attach_dependency_paths(&mut licenses, &graph.paths());
+    attach_dependency_requires(&mut licenses, &graph.requires());
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} Ruby dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+/// Read the `GEM`, `GIT` and `PATH` specs and the `DEPENDENCIES` of a lockfile
+///
+/// Specs are indented by four spaces and their own requirements by six. A gem
+/// locked for several platforms is listed once.
+fn parse_gemfile_lock(content: &str) -> GemfileLock {
+    let mut lock = GemfileLock::default();
+    let mut seen = HashSet::new();
+
+    let mut section = "";
+    let mut remote = String::new();
+    let mut revision = String::new();
+    // The spec whose requirements are being read
+    let mut current: Option<String> = None;
+
+    for line in content.lines() {
+        if line.trim().is_empty() {
+            continue;
+        }
+        if !line.starts_with(' ') {
+            section = line.trim();
+            remote.clear();
+            revision.clear();
+            current = None;
+            continue;
+        }
+
+        if section == "DEPENDENCIES" {
+            if let Some(name) = line.split_whitespace().next() {
+                lock.dependencies
+                    .insert(name.trim_end_matches('!').to_string());
+            }
+            continue;
+        }
+        if !matches!(section, "GEM" | "GIT" | "PATH") {
+            continue;
+        }
+
+        if let Some(value) = line.strip_prefix("  remote: ") {
+            remote = value.trim().to_string();
+        } else if let Some(value) = line.strip_prefix("  revision: ") {
+            revision = value.trim().to_string();
+        } else if let Some(spec) = line.strip_prefix("    ") {
+            if spec.starts_with(' ') {
+                if let (Some(gem), Some(required)) = (&current, spec.split_whitespace().next()) {
+                    lock.requirements.push((gem.clone(), required.to_string()));
+                }
+                continue;
+            }
+            current = None;
+            let Some((name, version)) = parse_spec(spec) else {
+                continue;
+            };
+            let source = match section {
+                "GIT" => GemSource::Git {
+                    remote: remote.clone(),
+                    revision: revision.clone(),
+                },
+                // The gem being developed, not a dependency
+                "PATH" if remote == "." => continue,
+                "PATH" => GemSource::Path(remote.clone()),
+                _ => GemSource::RubyGems,
+            };
+
+            let (version, platform) = match version.split_once('-') {
+                Some((version, platform)) => (version, Some(platform.to_string())),
+                None => (version, None),
+            };
+            current = Some(name.to_string());
+            if seen.insert(format!("{name}@{version}")) {
+                lock.gems.push(Gem {
+                    name: name.to_string(),
+                    version: version.to_string(),
+                    platform,
+                    source,
+                });
+            }
+        }
+    }
+
+    lock
+}
+
+/// Graph of the locked gems, entered from the gems listed in the Gemfile
+///
+/// Bundler locks a single version of every gem, so gems are identified by name.
+fn gem_dependency_graph(lock: &GemfileLock) -> DependencyGraph {
+    let mut graph = DependencyGraph::new();
+    for gem in &lock.gems {
+        graph.add_package(&gem.name, &gem.name, &gem.version);
+    }
+    for (gem, required) in &lock.requirements {
+        graph.add_dependency(gem, required);
+    }
+    // Sorted so that ties between equally short paths are broken the same way every run
+    let mut direct: Vec<_> = lock.dependencies.iter().collect();
+    direct.sort();
+    for name in direct {
+        graph.add_direct(name);
+    }
+    graph
+}
+
+/// Split a `name (version)` spec line
+fn parse_spec(spec: &str) -> Option<(&str, &str)> {
+    let (name, rest) = spec.trim().split_once(" (")?;
+    let version = rest.strip_suffix(')')?;
+    Some((name, version))
+}
+
+fn analyze_gem(
+    gem: Gem,
+    project_dir: &Path,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+) -> LicenseInfo {
+    log(
+        LogLevel::Info,
+        &format!("Processing gem: {} ({})", gem.name, gem.version),
+    );
+
+    let (license_result, license_confidence) =
+        time_dependency("gem", &gem.name, &gem.version, || {
+            fetch_license_for_gem(&gem, project_dir)
+        });
+    let license = Some(license_result);
+    let is_restrictive = is_license_restrictive(&license, known_licenses, config.strict);
+
+    if is_restrictive {
+        log(
+            LogLevel::Warn,
+            &format!("Restrictive license found: {license:?} for {}", gem.name),
+        );
+    }
+
+    LicenseInfo {
+        name: gem.name,
+        version: gem.version,
+        license: license.clone(),
+        is_restrictive,
+        compatibility: LicenseCompatibility::Unknown,
+        osi_status: match &license {
+            Some(l) => crate::licenses::get_osi_status(l),
+            None => crate::licenses::OsiStatus::Unknown,
+        },
+        license_confidence,
+        source_file: None,
+        dependency_path: None,
+        tier: None,
+        vulnerabilities: None,
+        copyright: None,
+        legal_files: None,
+        chosen_license: None,
+        requires: None,
+        scope: DependencyScope::Runtime,
+        manual_license: None,
+        health: None,
+        obligations: None,
+        explanation: None,
+        repository: None,
+        aliases: None,
+        purl: None,
+        review: None,
+        status: LookupStatus::Ok,
+        error: None,
+    }
+}
+
+/// License of a gem, with the classifier confidence when it was read from a license file
+fn fetch_license_for_gem(gem: &Gem, project_dir: &Path) -> (String, Option<f32>) {
+    let detected = match &gem.source {
+        GemSource::RubyGems => {
+            return (
+                fetch_license_from_rubygems(&gem.name, &gem.version, gem.platform.as_deref()),
+                None,
+            )
+        }
+        GemSource::Git { remote, revision } => find_git_checkout(project_dir, remote, revision)
+            .and_then(|checkout| {
+                // Repositories holding several gems keep each in its own directory
+                [checkout.join(&gem.name), checkout]
+                    .iter()
+                    .find_map(|dir| detect_license_in_dir(dir))
+            })
+            .map(|detected| (detected.license, detected.confidence))
+            .or_else(|| fetch_repository_license(remote, revision)),
+        GemSource::Path(path) => detect_license_in_dir(&project_dir.join(path))
+            .map(|detected| (detected.license, detected.confidence)),
+    };
+
+    match detected {
+        Some((license, confidence)) => (license, Some(confidence)),
+        None => {
+            log(
+                LogLevel::Warn,
+                &format!("No license found for {} ({})", gem.name, gem.version),
+            );
+            ("Unknown".to_string(), None)
+        }
+    }
+}
+
+pub fn fetch_license_from_rubygems(name: &str, version: &str, platform: Option<&str>) -> String {
+    if let Some(license) = get_cached_license("rubygems", name, version) {
+        return license;
+    }
+
+    let mut url = format!(
+        "{}/api/v2/rubygems/{name}/versions/{version}.json",
+        registry::rubygems_url()
+    );
+    if let Some(platform) = platform {
+        url.push_str(&format!("?platform={platform}"));
+    }
+    log(
+        LogLevel::Info,
+        &format!("Fetching license from RubyGems: {url}"),
+    );
+
+    let response = match registry::get(Registry::RubyGems, &url) {
+        Ok(response) => response,
+        Err(err) => {
+            log_error(&format!("Failed to fetch metadata for {name}"), &err);
+            return "Unknown".to_string();
+        }
+    };
+
+    let status = response.status();
+    if !status.is_success() {
+        log(
+            LogLevel::Error,
+            &format!("Failed to fetch metadata for {name}: HTTP {status}"),
+        );
+        return "Unknown".to_string();
+    }
+
+    match response.json::<Value>() {
+        Ok(json) => {
+            let declared: Vec<String> = json["licenses"]
+                .as_array()
+                .map(|licenses| {
+                    licenses
+                        .iter()
+                        .filter_map(|l| l.as_str().map(str::to_string))
+                        .collect()
+                })
+                .unwrap_or_default();
+
+            match license_from_gem_licenses(&declared) {
+                Some(license) => {
+                    cache_license("rubygems", name, version, &license);
+                    license
+                }
+                None => {
+                    log(
+                        LogLevel::Warn,
+                        &format!("No license declared for {name} ({version})"),
+                    );
+                    "Unknown".to_string()
+                }
+            }
+        }
+        Err(err) => {
+            log_error(&format!("Failed to parse JSON for {name}: {version}"), &err);
+            "Unknown".to_string()
+        }
+    }
+}
+
+/// Combine the `licenses` of a gemspec into one expression
+///
+/// A gem that lists several licenses may be used under any of them.
+pub fn license_from_gem_licenses(licenses: &[String]) -> Option<String> {
+    let licenses: Vec<&str> = licenses
+        .iter()
+        .map(|l| l.trim())
+        .filter(|l| !l.is_empty())
+        .collect();
+
+    match licenses.as_slice() {
+        [] => None,
+        [license] => Some(license.to_string()),
+        _ => Some(
+            licenses
+                .iter()
+                .map(|l| {
+                    if l.contains(' ') {
+                        format!("({l})")
+                    } else {
+                        l.to_string()
+                    }
+                })
+                .collect::<Vec<_>>()
+                .join(" OR "),
+        ),
+    }
+}
+
+/// Bundler's checkout of a git-sourced gem, if it has been installed
+///
+/// Checkouts live in `bundler/gems/<repository>-<revision[..12]>` under
+/// `vendor/bundle/ruby/<version>` or `GEM_HOME`.
+fn find_git_checkout(project_dir: &Path, remote: &str, revision: &str) -> Option<PathBuf> {
+    let repository = remote
+        .trim_end_matches('/')
+        .trim_end_matches(".git")
+        .rsplit(['/', ':'])
+        .next()?;
+    let short_revision = revision.get(..12).unwrap_or(revision);
+    let checkout_name = format!("{repository}-{short_revision}");
+
+    let mut gem_dirs: Vec<PathBuf> = fs::read_dir(project_dir.join("vendor/bundle/ruby"))
+        .map(|entries| entries.filter_map(|e| e.ok()).map(|e| e.path()).collect())
+        .unwrap_or_default();
+    if let Ok(gem_home) = std::env::var("GEM_HOME") {
+        gem_dirs.push(PathBuf::from(gem_home));
+    }
+
+    gem_dirs
+        .into_iter()
+        .map(|dir| dir.join("bundler").join("gems").join(&checkout_name))
+        .find(|checkout| checkout.is_dir())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const GEMFILE_LOCK: &str = "GIT
+  remote: https://github.com/rails/rails.git
+  revision: 1f0262aa2b0ab5bd12346d4e5e3ea8d5e5b1a1c9
+  branch: main
+  specs:
+    actioncable (7.2.0.alpha)
+      actionpack (= 7.2.0.alpha)
+
+PATH
+  remote: .
+  specs:
+    myapp (0.1.0)
+
+PATH
+  remote: engines/billing
+  specs:
+    billing (1.0.0)
+
+GEM
+  remote: https://rubygems.org/
+  specs:
+    nokogiri (1.16.0-arm64-darwin)
+      racc (~> 1.4)
+    nokogiri (1.16.0-x86_64-linux)
+      racc (~> 1.4)
+    racc (1.7.3)
+    rake (13.1.0)
+
+PLATFORMS
+  arm64-darwin
+  x86_64-linux
+
+DEPENDENCIES
+  actioncable!
+  billing!
+  nokogiri (~> 1.16)
+  rake
+
+BUNDLED WITH
+   2.5.3
+";
+
+    #[test]
+    fn test_parse_gemfile_lock() {
+        let lock = parse_gemfile_lock(GEMFILE_LOCK);
+        let names: Vec<_> = lock.gems.iter().map(|g| g.name.as_str()).collect();
+        assert_eq!(
+            names,
+            vec!["actioncable", "billing", "nokogiri", "racc", "rake"]
+        );
+
+        assert_eq!(
+            lock.gems[0].source,
+            GemSource::Git {
+                remote: "https://github.com/rails/rails.git".to_string(),
+                revision: "1f0262aa2b0ab5bd12346d4e5e3ea8d5e5b1a1c9".to_string(),
+            }
+        );
+        assert_eq!(
+            lock.gems[1].source,
+            GemSource::Path("engines/billing".to_string())
+        );
+        assert_eq!(lock.gems[2].version, "1.16.0");
+        assert_eq!(lock.gems[2].platform.as_deref(), Some("arm64-darwin"));
+        assert_eq!(lock.gems[4].source, GemSource::RubyGems);
+
+        assert!(lock.dependencies.contains("actioncable"));
+        assert!(lock.dependencies.contains("nokogiri"));
+        assert!(!lock.dependencies.contains("racc"));
+    }
+
+    #[test]
+    fn test_gem_dependency_graph() {
+        let lock = parse_gemfile_lock(GEMFILE_LOCK);
+        let graph = gem_dependency_graph(&lock);
+
+        let paths = graph.paths();
+        assert_eq!(paths["racc@1.7.3"], vec!["nokogiri@1.16.0", "racc@1.7.3"]);
+        assert_eq!(paths["rake@13.1.0"], vec!["rake@13.1.0"]);
+        // actionpack is required but not locked in this excerpt
+        assert_eq!(
+            graph.requires()["actioncable@7.2.0.alpha"],
+            Vec::<String>::new()
+        );
+        assert_eq!(graph.requires()["nokogiri@1.16.0"], vec!["racc@1.7.3"]);
+    }
+
+    #[test]
+    fn test_license_from_gem_licenses() {
+        assert_eq!(license_from_gem_licenses(&[]), None);
+        assert_eq!(
+            license_from_gem_licenses(&["MIT".to_string()]).as_deref(),
+            Some("MIT")
+        );
+        assert_eq!(
+            license_from_gem_licenses(&[
+                "Ruby".to_string(),
+                "BSD-2-Clause".to_string(),
+                "GPL-2.0 WITH Classpath-exception-2.0".to_string(),
+            ])
+            .as_deref(),
+            Some("Ruby OR BSD-2-Clause OR (GPL-2.0 WITH Classpath-exception-2.0)")
+        );
+    }
+
+    #[test]
+    fn test_git_and_path_gem_licenses() {
+        let temp_dir = TempDir::new().unwrap();
+        let checkout = temp_dir
+            .path()
+            .join("vendor/bundle/ruby/3.3.0/bundler/gems/rails-1f0262aa2b0a");
+        fs::create_dir_all(checkout.join("actioncable")).unwrap();
+        fs::write(
+            checkout.join("actioncable").join("LICENSE"),
+            "Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the \"Software\"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:\n\nThe above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.\n\nTHE SOFTWARE IS PROVIDED \"AS IS\", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.",
+        )
+        .unwrap();
+
+        let lock = parse_gemfile_lock(GEMFILE_LOCK);
+        let (license, confidence) = fetch_license_for_gem(&lock.gems[0], temp_dir.path());
+        assert_eq!(license, "MIT");
+        assert!(confidence.is_some());
+
+        // The path gem has no license file
+        let (license, confidence) = fetch_license_for_gem(&lock.gems[1], temp_dir.path());
+        assert_eq!(license, "Unknown");
+        assert_eq!(confidence, None);
+    }
+}
@@ -1,11 +1,31 @@
-use cargo_metadata::Package;
+use cargo_metadata::{DepKindInfo, DependencyKind, Metadata, Package};
 use rayon::prelude::*;
-use std::collections::HashMap;
-
-use crate::debug::{log, log_error, LogLevel};
+use serde_json::Value;
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, DependencyGraph,
+};
+use crate::license_detector::detect_license_in_dir;
 use crate::licenses::{
-    fetch_licenses_from_github, is_license_restrictive, LicenseCompatibility, LicenseInfo,
+    detect_project_license, fetch_licenses_from_github, is_license_restrictive, DependencyScope,
+    LicenseCompatibility, LicenseInfo,
 };
+use crate::lookup_errors::LookupStatus;
+use crate::registry::{self, Registry};
+
+/// A resolved package entry from Cargo.lock
+#[derive(Debug, Clone, PartialEq)]
+pub struct CargoLockPackage {
+    pub name: String,
+    pub version: String,
+    /// Registry or git source; `None` for workspace members and path dependencies
+    pub source: Option<String>,
+}
 
 /// Analyze the licenses of Rust dependencies from Cargo packages
 #[allow(dead_code)]
@@ -62,13 +82,20 @@ pub fn analyze_rust_licenses_with_config(
                 &format!("Analyzing package: {} ({})", package.name, package.version),
             );
 
-            let license = package.license.clone().or_else(|| {
-                if no_local {
-                    None
-                } else {
-                    get_license_from_manifest(&package.manifest_path)
-                }
-            });
+            let (license, license_confidence) = match &package.license {
+                Some(license) => (Some(license.clone()), None),
+                None if no_local => (None, None),
+                None => match get_license_from_manifest(&package.manifest_path) {
+                    Some(license) => (Some(license), None),
+                    None => package
+                        .manifest_path
+                        .parent()
+                        .and_then(|dir| get_license_from_crate_dir(dir.as_std_path()))
+                        .map_or((None, None), |(license, confidence)| {
+                            (Some(license), confidence)
+                        }),
+                },
+            };
 
             let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
 
@@ -92,11 +119,444 @@ pub fn analyze_rust_licenses_with_config(
                     Some(license) => crate::licenses::get_osi_status(license),
                     None => crate::licenses::OsiStatus::Unknown,
                 },
+                license_confidence,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: DependencyScope::Runtime,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
             }
         })
         .collect()
 }
 
+/// Analyze Rust dependencies straight from Cargo.lock
+///
+/// Used when `cargo metadata` is unavailable, e.g. without a Rust toolchain.
+/// Workspace members and path dependencies are skipped since they are part of
+/// the project itself.
+pub fn analyze_cargo_lock(project_path: &Path, no_local: bool) -> Vec<LicenseInfo> {
+    let config = crate::config::load_config().unwrap_or_default();
+
+    let Some(lock_path) = find_cargo_lock(project_path) else {
+        log(
+            LogLevel::Warn,
+            &format!("No Cargo.lock found for {}", project_path.display()),
+        );
+        return Vec::new();
+    };
+
+    let content = match fs::read_to_string(&lock_path) {
+        Ok(content) => content,
+        Err(err) => {
+            log_error("Failed to read Cargo.lock", &err);
+            return Vec::new();
+        }
+    };
+
+    let workspace_root = lock_path.parent().unwrap_or(project_path);
+    let members = workspace_member_names(workspace_root);
+    log_debug("Workspace members", &members);
+
+    let packages: Vec<CargoLockPackage> = parse_cargo_lock_content(&content)
+        .into_iter()
+        .filter(|package| package.source.is_some() && !members.contains(&package.name))
+        .collect();
+
+    log(
+        LogLevel::Info,
+        &format!(
+            "Found {} registry packages in {}",
+            packages.len(),
+            lock_path.display()
+        ),
+    );
+
+    let known_licenses = fetch_licenses_from_github().unwrap_or_else(|err| {
+        log_error("Failed to fetch licenses from GitHub", &err);
+        HashMap::new()
+    });
+
+    let mut licenses: Vec<LicenseInfo> = packages
+        .par_iter()
+        .map(|package| {
+            let (license, license_confidence) =
+                time_dependency("cargo", &package.name, &package.version, || {
+                    match fetch_license_from_crates_io(&package.name, &package.version) {
+                        Some(license) => (Some(license), None),
+                        None if no_local => (None, None),
+                        None => get_license_from_registry_source(&package.name, &package.version)
+                            .map_or((None, None), |(license, confidence)| {
+                                (Some(license), confidence)
+                            }),
+                    }
+                });
+
+            let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
+
+            LicenseInfo {
+                name: package.name.clone(),
+                version: package.version.clone(),
+                osi_status: match &license {
+                    Some(license) => crate::licenses::get_osi_status(license),
+                    None => crate::licenses::OsiStatus::Unknown,
+                },
+                license,
+                is_restrictive,
+                compatibility: LicenseCompatibility::Unknown,
+                license_confidence,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: DependencyScope::Runtime,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
+            }
+        })
+        .collect();
+
+    if let Some(graph) = cargo_lock_dependency_graph(&content, &members) {
+        attach_dependency_paths(&mut licenses, &graph.paths());
+        attach_dependency_requires(&mut licenses, &graph.requires());
+    }
+    licenses
+}
+
+/// The resolved graph of `cargo metadata`, with dev and build dependencies scoped
+pub fn metadata_dependency_graph(metadata: &Metadata) -> DependencyGraph {
+    let mut graph = DependencyGraph::new();
+    for package in &metadata.packages {
+        graph.add_package(
+            &package.id.repr,
+            &package.name,
+            &package.version.to_string(),
+        );
+    }
+
+    let Some(resolve) = &metadata.resolve else {
+        return graph;
+    };
+    for node in &resolve.nodes {
+        let is_member = metadata.workspace_members.contains(&node.id);
+        for dep in &node.deps {
+            let scope = dependency_kind_scope(&dep.dep_kinds);
+            graph.add_dependency_with_scope(&node.id.repr, &dep.pkg.repr, scope);
+            if is_member && !metadata.workspace_members.contains(&dep.pkg) {
+                graph.add_direct_with_scope(&dep.pkg.repr, scope);
+            }
+        }
+    }
+
+    graph
+}
+
+/// Narrowest scope among the ways a crate depends on another
+///
+/// Old Cargo versions don't report `dep_kinds`, in which case the dependency is
+/// treated as a normal one.
+fn dependency_kind_scope(kinds: &[DepKindInfo]) -> DependencyScope {
+    kinds
+        .iter()
+        .map(|info| match info.kind {
+            DependencyKind::Development => DependencyScope::Dev,
+            DependencyKind::Build => DependencyScope::Build,
+            _ => DependencyScope::Runtime,
+        })
+        .min()
+        .unwrap_or_default()
+}
+
+/// Dependency paths from the `dependencies` lists in Cargo.lock
+///
+/// Entries are `name`, or `name version` when several versions of a crate are locked.
+fn cargo_lock_dependency_graph(
+    content: &str,
+    members: &HashSet<String>,
+) -> Option<DependencyGraph> {
+    let lock = toml::from_str::<toml::Value>(content).ok()?;
+    let packages = lock.get("package").and_then(|p| p.as_array())?;
+
+    let mut graph = DependencyGraph::new();
+    let mut versions_by_name: HashMap<&str, Vec<&str>> = HashMap::new();
+    for package in packages {
+        let (Some(name), Some(version)) = (
+            package.get("name").and_then(|n| n.as_str()),
+            package.get("version").and_then(|v| v.as_str()),
+        ) else {
+            continue;
+        };
+        graph.add_package(&format!("{name} {version}"), name, version);
+        versions_by_name.entry(name).or_default().push(version);
+    }
+
+    let resolve_dep = |entry: &str| -> Option<String> {
+        let mut parts = entry.split_whitespace();
+        let name = parts.next()?;
+        let version = match parts.next() {
+            Some(version) => version,
+            None => match versions_by_name.get(name)?.as_slice() {
+                [version] => version,
+                _ => return None,
+            },
+        };
+        Some(format!("{name} {version}"))
+    };
+
+    for package in packages {
+        let (Some(name), Some(version)) = (
+            package.get("name").and_then(|n| n.as_str()),
+            package.get("version").and_then(|v| v.as_str()),
+        ) else {
+            continue;
+        };
+        let id = format!("{name} {version}");
+        let is_member = package.get("source").is_none() && members.contains(name);
+
+        let deps = package
+            .get("dependencies")
+            .and_then(|d| d.as_array())
+            .into_iter()
+            .flatten()
+            .filter_map(|d| d.as_str())
+            .filter_map(&resolve_dep);
+        for dep in deps {
+            graph.add_dependency(&id, &dep);
+            let dep_name = dep.split(' ').next().unwrap_or_default();
+            if is_member && !members.contains(dep_name) {
+                graph.add_direct(&dep);
+            }
+        }
+    }
+
+    Some(graph)
+}
+
+/// Parse the `[[package]]` entries of a Cargo.lock file
+pub fn parse_cargo_lock_content(content: &str) -> Vec<CargoLockPackage> {
+    let lock: toml::Value = match toml::from_str(content) {
+        Ok(lock) => lock,
+        Err(err) => {
+            log_error("Failed to parse Cargo.lock", &err);
+            return Vec::new();
+        }
+    };
+
+    lock.get("package")
+        .and_then(|packages| packages.as_array())
+        .map(|packages| {
+            packages
+                .iter()
+                .filter_map(|package| {
+                    Some(CargoLockPackage {
+                        name: package.get("name")?.as_str()?.to_string(),
+                        version: package.get("version")?.as_str()?.to_string(),
+                        source: package
+                            .get("source")
+                            .and_then(|s| s.as_str())
+                            .map(String::from),
+                    })
+                })
+                .collect()
+        })
+        .unwrap_or_default()
+}
+
+/// Locate the Cargo.lock for a crate, which lives at the workspace root
+fn find_cargo_lock(project_path: &Path) -> Option<PathBuf> {
+    project_path
+        .ancestors()
+        .map(|dir| dir.join("Cargo.lock"))
+        .find(|lock_path| lock_path.exists())
+}
+
+/// Collect the package names of a workspace root and its members
+///
+/// Member entries may use a trailing `*` glob, as in `members = ["crates/*"]`.
+fn workspace_member_names(workspace_root: &Path) -> HashSet<String> {
+    let mut names = HashSet::new();
+
+    let Some(manifest) = read_manifest(&workspace_root.join("Cargo.toml")) else {
+        return names;
+    };
+
+    if let Some(name) = manifest_package_name(&manifest) {
+        names.insert(name);
+    }
+
+    let string_list = |key: &str| -> Vec<String> {
+        manifest
+            .get("workspace")
+            .and_then(|ws| ws.get(key))
+            .and_then(|list| list.as_array())
+            .map(|list| {
+                list.iter()
+                    .filter_map(|m| m.as_str().map(String::from))
+                    .collect()
+            })
+            .unwrap_or_default()
+    };
+    let excluded: Vec<PathBuf> = string_list("exclude")
+        .iter()
+        .map(|e| workspace_root.join(e))
+        .collect();
+
+    for member in string_list("members") {
+        let member_dirs: Vec<PathBuf> = match member.strip_suffix('*') {
+            Some(prefix) => fs::read_dir(workspace_root.join(prefix))
+                .map(|entries| {
+                    entries
+                        .filter_map(|e| e.ok())
+                        .map(|e| e.path())
+                        .filter(|p| p.is_dir())
+                        .collect()
+                })
+                .unwrap_or_default(),
+            None => vec![workspace_root.join(&member)],
+        };
+
+        for dir in member_dirs {
+            if excluded.contains(&dir) {
+                continue;
+            }
+            if let Some(name) =
+                read_manifest(&dir.join("Cargo.toml")).and_then(|m| manifest_package_name(&m))
+            {
+                names.insert(name);
+            }
+        }
+    }
+
+    names
+}
+
+fn read_manifest(path: &Path) -> Option<toml::Value> {
+    let content = fs::read_to_string(path).ok()?;
+    toml::from_str(&content).ok()
+}
+
+fn manifest_package_name(manifest: &toml::Value) -> Option<String> {
+    manifest
+        .get("package")?
+        .get("name")?
+        .as_str()
+        .map(String::from)
+}
+
+/// Fetch the license expression for a crate version from crates.io
+pub fn fetch_license_from_crates_io(name: &str, version: &str) -> Option<String> {
+    if let Some(license) = get_cached_license("crates.io", name, version) {
+        return Some(license);
+    }
+
+    let url = format!(
+        "{}/api/v1/crates/{name}/{version}",
+        registry::crates_io_url()
+    );
+    let response = match registry::get(Registry::CratesIo, &url) {
+        Ok(response) if response.status().is_success() => response,
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "crates.io returned {} for {name}@{version}",
+                    response.status()
+                ),
+            );
+            return None;
+        }
+        Err(err) => {
+            log_error(&format!("Failed to query crates.io for {name}"), &err);
+            return None;
+        }
+    };
+
+    let json: Value = response.json().ok()?;
+    let license = json["version"]["license"]
+        .as_str()
+        .filter(|license| !license.is_empty())?;
+    cache_license("crates.io", name, version, license);
+    Some(license.to_string())
+}
+
+/// Read a crate's license from its unpacked source in the local cargo registry
+fn get_license_from_registry_source(name: &str, version: &str) -> Option<(String, Option<f32>)> {
+    let crate_dir = registry_source_dir(name, version)?;
+
+    if let Some(license) = get_license_from_manifest(crate_dir.join("Cargo.toml")) {
+        return Some((license, None));
+    }
+    get_license_from_crate_dir(&crate_dir)
+}
+
+/// Directory of a crate's unpacked source in the local cargo registry, if downloaded
+pub fn registry_source_dir(name: &str, version: &str) -> Option<PathBuf> {
+    let cargo_home = std::env::var("CARGO_HOME")
+        .map(PathBuf::from)
+        .or_else(|_| std::env::var("HOME").map(|home| Path::new(&home).join(".cargo")))
+        .ok()?;
+
+    let registries = fs::read_dir(cargo_home.join("registry").join("src")).ok()?;
+    registries
+        .filter_map(|e| e.ok())
+        .map(|registry| registry.path().join(format!("{name}-{version}")))
+        .find(|crate_dir| crate_dir.is_dir())
+}
+
+/// Detect a license from the LICENSE files shipped in a crate directory
+///
+/// The license texts are classified first, with the classifier confidence returned
+/// alongside the license. Rust crates are commonly dual-licensed with `LICENSE-MIT`
+/// and `LICENSE-APACHE`, so those file names are trusted when the text is not
+/// recognized.
+fn get_license_from_crate_dir(crate_dir: &Path) -> Option<(String, Option<f32>)> {
+    if let Some(detected) = detect_license_in_dir(crate_dir) {
+        return Some((detected.license, Some(detected.confidence)));
+    }
+
+    let mut licenses = Vec::new();
+    if crate_dir.join("LICENSE-MIT").exists() {
+        licenses.push("MIT");
+    }
+    if crate_dir.join("LICENSE-APACHE").exists() {
+        licenses.push("Apache-2.0");
+    }
+    if !licenses.is_empty() {
+        return Some((licenses.join(" OR "), None));
+    }
+
+    detect_project_license(&crate_dir.to_string_lossy())
+        .ok()
+        .flatten()
+        .map(|license| (license, None))
+}
+
 fn get_license_from_manifest<P: AsRef<std::path::Path>>(manifest_path: P) -> Option<String> {
     use std::fs;
     use toml::Value;
@@ -140,6 +600,50 @@ mod tests {
         tempfile::tempdir().unwrap()
     }
 
+    #[test]
+    fn test_cargo_lock_dependency_graph() {
+        let lock = r#"
+version = 3
+
+[[package]]
+name = "app"
+version = "0.1.0"
+dependencies = ["reqwest", "serde"]
+
+[[package]]
+name = "reqwest"
+version = "0.11.0"
+dependencies = ["hyper 0.14.0"]
+
+[[package]]
+name = "hyper"
+version = "0.14.0"
+
+[[package]]
+name = "hyper"
+version = "1.0.0"
+
+[[package]]
+name = "serde"
+version = "1.0.0"
+"#;
+        let members = HashSet::from(["app".to_string()]);
+        let graph = cargo_lock_dependency_graph(lock, &members).unwrap();
+        let paths = graph.paths();
+
+        assert_eq!(paths["serde@1.0.0"], vec!["serde@1.0.0"]);
+        assert_eq!(
+            paths["hyper@0.14.0"],
+            vec!["reqwest@0.11.0", "hyper@0.14.0"]
+        );
+        assert!(!paths.contains_key("hyper@1.0.0"));
+        assert!(!paths.contains_key("app@0.1.0"));
+
+        let requires = graph.requires();
+        assert_eq!(requires["reqwest@0.11.0"], vec!["hyper@0.14.0"]);
+        assert!(requires["serde@1.0.0"].is_empty());
+    }
+
     #[test]
     fn test_analyze_rust_licenses_empty() {
         let packages = vec![];
@@ -232,6 +736,79 @@ version = "0.1.0"
         assert_eq!(result, None);
     }
 
+    #[test]
+    fn test_parse_cargo_lock_content() {
+        let content = r#"# This file is automatically @generated by Cargo.
+version = 3
+
+[[package]]
+name = "my-app"
+version = "0.1.0"
+dependencies = ["serde"]
+
+[[package]]
+name = "serde"
+version = "1.0.193"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+checksum = "25dd9975e68d0cb5aa1120c288333fc98731bd1dd12f561e468ea4728c042b89"
+"#;
+
+        let packages = parse_cargo_lock_content(content);
+        assert_eq!(packages.len(), 2);
+        assert_eq!(packages[0].name, "my-app");
+        assert_eq!(packages[0].source, None);
+        assert_eq!(packages[1].name, "serde");
+        assert_eq!(packages[1].version, "1.0.193");
+        assert!(packages[1].source.is_some());
+    }
+
+    #[test]
+    fn test_workspace_member_names() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        std::fs::write(
+            root.join("Cargo.toml"),
+            "[workspace]\nmembers = [\"crates/*\", \"tools/cli\"]\nexclude = [\"crates/old\"]\n",
+        )
+        .unwrap();
+        for (dir, name) in [
+            ("crates/core", "ws-core"),
+            ("crates/old", "ws-old"),
+            ("tools/cli", "ws-cli"),
+        ] {
+            std::fs::create_dir_all(root.join(dir)).unwrap();
+            std::fs::write(
+                root.join(dir).join("Cargo.toml"),
+                format!("[package]\nname = \"{name}\"\nversion = \"0.1.0\"\n"),
+            )
+            .unwrap();
+        }
+
+        let members = workspace_member_names(root);
+        assert_eq!(members.len(), 2);
+        assert!(members.contains("ws-core"));
+        assert!(members.contains("ws-cli"));
+
+        // A member directory resolves to the lockfile at the workspace root
+        std::fs::write(root.join("Cargo.lock"), "version = 3\n").unwrap();
+        assert_eq!(
+            find_cargo_lock(&root.join("crates/core")),
+            Some(root.join("Cargo.lock"))
+        );
+    }
+
+    #[test]
+    fn test_get_license_from_crate_dir_dual_license() {
+        let temp_dir = TempDir::new().unwrap();
+        std::fs::write(temp_dir.path().join("LICENSE-MIT"), "MIT License").unwrap();
+        std::fs::write(temp_dir.path().join("LICENSE-APACHE"), "Apache License").unwrap();
+
+        assert_eq!(
+            get_license_from_crate_dir(temp_dir.path()),
+            Some(("MIT OR Apache-2.0".to_string(), None))
+        );
+    }
+
     #[test]
     fn test_get_license_from_manifest_not_found() {
         let temp_dir = TempDir::new().unwrap();
@@ -0,0 +1,597 @@
+use rayon::prelude::*;
+use regex::Regex;
+use serde::Deserialize;
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::license_detector::detect_license_in_dir;
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, License,
+    LicenseCompatibility, LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::repository_license::fetch_repository_license;
+
+/// Where SwiftPM keeps `Package.resolved` inside an Xcode workspace
+const XCODE_RESOLVED_PATH: &str = "xcshareddata/swiftpm/Package.resolved";
+
+/// Directories holding package checkouts: SwiftPM's `.build` and the
+/// `-clonedSourcePackagesDirPath` CI setups of Xcode commonly point at
+const CHECKOUT_DIRS: [&str; 2] = [".build/checkouts", "SourcePackages/checkouts"];
+
+/// Where SwiftPM gets a package from
+#[derive(Debug, Clone, PartialEq)]
+pub enum SwiftSource {
+    /// A git repository
+    Remote { url: String, revision: String },
+    /// A git repository on the local disk
+    Local(String),
+    /// A package registry, by `scope.name`
+    Registry,
+}
+
+/// A package pinned in `Package.resolved`
+#[derive(Debug, Clone, PartialEq)]
+pub struct SwiftPackage {
+    /// SwiftPM's identity: the lowercased last component of the package URL
+    pub name: String,
+    pub version: String,
+    pub source: SwiftSource,
+}
+
+/// `Package.resolved` in all its versions: v1 nests the pins under `object`
+#[derive(Deserialize)]
+struct PackageResolved {
+    #[serde(default)]
+    pins: Vec<Pin>,
+    object: Option<PinsObject>,
+}
+
+#[derive(Deserialize)]
+struct PinsObject {
+    #[serde(default)]
+    pins: Vec<Pin>,
+}
+
+#[derive(Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct Pin {
+    identity: Option<String>,
+    kind: Option<String>,
+    location: Option<String>,
+    /// v1 only
+    #[serde(rename = "repositoryURL")]
+    repository_url: Option<String>,
+    #[serde(default)]
+    state: PinState,
+}
+
+#[derive(Deserialize, Default)]
+struct PinState {
+    version: Option<String>,
+    branch: Option<String>,
+    revision: Option<String>,
+}
+
+/// Whether a directory is an Xcode project or workspace bundle
+pub fn is_xcode_bundle(name: &str) -> bool {
+    name.ends_with(".xcodeproj") || name.ends_with(".xcworkspace")
+}
+
+/// The `Package.resolved` of a SwiftPM package or Xcode project
+///
+/// A workspace's file takes precedence over the one of a project it contains.
+pub fn find_package_resolved(project_dir: &Path) -> Option<PathBuf> {
+    let resolved = project_dir.join("Package.resolved");
+    if resolved.is_file() {
+        return Some(resolved);
+    }
+
+    let mut bundles: Vec<PathBuf> = fs::read_dir(project_dir)
+        .ok()?
+        .filter_map(|e| e.ok())
+        .map(|e| e.path())
+        .filter(|path| {
+            path.is_dir()
+                && path
+                    .file_name()
+                    .and_then(|name| name.to_str())
+                    .is_some_and(is_xcode_bundle)
+        })
+        .collect();
+    bundles.sort_by_key(|path| {
+        (
+            path.extension().is_some_and(|ext| ext == "xcodeproj"),
+            path.clone(),
+        )
+    });
+
+    bundles.into_iter().find_map(|bundle| {
+        let resolved = if bundle.extension().is_some_and(|ext| ext == "xcodeproj") {
+            bundle.join("project.xcworkspace").join(XCODE_RESOLVED_PATH)
+        } else {
+            bundle.join(XCODE_RESOLVED_PATH)
+        };
+        resolved.is_file().then_some(resolved)
+    })
+}
+
+pub fn analyze_swift_licenses(
+    project_path: &str,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> Vec<LicenseInfo> {
+    let project_dir = Path::new(project_path);
+    let Some(resolved_path) = find_package_resolved(project_dir) else {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "No Package.resolved found in {project_path}, run `swift package resolve` or resolve packages in Xcode first"
+            ),
+        );
+        return Vec::new();
+    };
+    log(
+        LogLevel::Info,
+        &format!(
+            "Analyzing Swift dependencies from: {}",
+            resolved_path.display()
+        ),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let content = match fs::read_to_string(&resolved_path) {
+        Ok(content) => content,
+        Err(err) => {
+            log_error("Failed to read Package.resolved", &err);
+            return Vec::new();
+        }
+    };
+
+    let packages = parse_package_resolved(&content);
+    log(
+        LogLevel::Info,
+        &format!("Found {} packages in Package.resolved", packages.len()),
+    );
+    log_debug("Swift packages", &packages);
+
+    // Package.resolved does not tell direct and transitive packages apart
+    let direct = direct_package_identities(project_dir);
+    let packages: Vec<SwiftPackage> = if config.dependencies.max_depth <= 1 && !direct.is_empty() {
+        packages
+            .into_iter()
+            .filter(|package| direct.contains(&package.name))
+            .collect()
+    } else {
+        packages
+    };
+
+    let licenses: Vec<LicenseInfo> = packages
+        .into_par_iter()
+        .map(|package| analyze_package(package, project_dir, &known_licenses, config, no_local))
+        .collect();
+
+    log(
+        LogLevel::Info,
+        &format!("Found {} Swift dependencies with licenses", licenses.len()),
+    );
+    licenses
+}
+
+/// Read the pins of a `Package.resolved`
+///
+/// Packages pinned to a branch or revision have no version; their revision
+/// stands in for one.
+fn parse_package_resolved(content: &str) -> Vec<SwiftPackage> {
+    let resolved: PackageResolved = match serde_json::from_str(content) {
+        Ok(resolved) => resolved,
+        Err(err) => {
+            log_error("Failed to parse Package.resolved", &err);
+            return Vec::new();
+        }
+    };
+
+    let pins = match resolved.object {
+        Some(object) => object.pins,
+        None => resolved.pins,
+    };
+    pins.into_iter()
+        .filter_map(|pin| {
+            let location = pin.location.or(pin.repository_url).unwrap_or_default();
+            let name = pin.identity.unwrap_or_else(|| package_identity(&location));
+            let revision = pin.state.revision.unwrap_or_default();
+            let version = pin
+                .state
+                .version
+                .or_else(|| (!revision.is_empty()).then(|| revision.clone()))
+                .or(pin.state.branch)?;
+
+            let source = match pin.kind.as_deref() {
+                Some("localSourceControl") => SwiftSource::Local(location),
+                Some("registry") => SwiftSource::Registry,
+                // v1 pins are all remote repositories
+                _ => SwiftSource::Remote {
+                    url: location,
+                    revision,
+                },
+            };
+            Some(SwiftPackage {
+                name,
+                version,
+                source,
+            })
+        })
+        .collect()
+}
+
+/// Last component of a package URL or path, e.g. `swift-nio` for
+/// `https://github.com/apple/swift-nio.git`, which names its checkout
+fn repository_name(location: &str) -> &str {
+    let location = location.trim_end_matches('/').trim_end_matches(".git");
+    location.rsplit(['/', ':']).next().unwrap_or(location)
+}
+
+/// SwiftPM's identity of a package URL or path: its lowercased repository name
+fn package_identity(location: &str) -> String {
+    repository_name(location).to_lowercase()
+}
+
+/// Identities of the packages the project depends on itself
+///
+/// Read from the `.package(...)` entries of `Package.swift` and the
+/// `XCRemoteSwiftPackageReference`s of Xcode projects.
+fn direct_package_identities(project_dir: &Path) -> HashSet<String> {
+    let mut identities = HashSet::new();
+    let (Ok(package_regex), Ok(xcode_regex)) = (
+        Regex::new(r#"\.package\(\s*(?:name:\s*"[^"]*"\s*,\s*)?(url|id):\s*"([^"]+)""#),
+        Regex::new(r#"repositoryURL\s*=\s*"([^"]+)""#),
+    ) else {
+        return identities;
+    };
+
+    if let Ok(manifest) = fs::read_to_string(project_dir.join("Package.swift")) {
+        for captures in package_regex.captures_iter(&manifest) {
+            identities.insert(match &captures[1] {
+                "id" => captures[2].to_lowercase(),
+                _ => package_identity(&captures[2]),
+            });
+        }
+    }
+
+    let projects = fs::read_dir(project_dir)
+        .map(|entries| {
+            entries
+                .filter_map(|e| e.ok())
+                .map(|e| e.path().join("project.pbxproj"))
+                .filter(|path| path.is_file())
+                .collect::<Vec<_>>()
+        })
+        .unwrap_or_default();
+    for project in projects {
+        if let Ok(pbxproj) = fs::read_to_string(project) {
+            for captures in xcode_regex.captures_iter(&pbxproj) {
+                identities.insert(package_identity(&captures[1]));
+            }
+        }
+    }
+
+    identities
+}
+
+fn analyze_package(
+    package: SwiftPackage,
+    project_dir: &Path,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> LicenseInfo {
+    log(
+        LogLevel::Info,
+        &format!(
+            "Processing Swift package: {} ({})",
+            package.name, package.version
+        ),
+    );
+
+    let (license_result, license_confidence) =
+        time_dependency("swift", &package.name, &package.version, || {
+            fetch_license_for_package(&package, project_dir, no_local)
+        });
+    let license = Some(license_result);
+    let repository = match &package.source {
+        SwiftSource::Remote { url, .. } => Some(url.clone()),
+        _ => None,
+    };
+    let is_restrictive = is_license_restrictive(&license, known_licenses, config.strict);
+
+    if is_restrictive {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Restrictive license found: {license:?} for {}",
+                package.name
+            ),
+        );
+    }
+
+    LicenseInfo {
+        name: package.name,
+        version: package.version,
+        license: license.clone(),
+        is_restrictive,
+        compatibility: LicenseCompatibility::Unknown,
+        osi_status: match &license {
+            Some(l) => crate::licenses::get_osi_status(l),
+            None => crate::licenses::OsiStatus::Unknown,
+        },
+        license_confidence,
+        source_file: None,
+        dependency_path: None,
+        tier: None,
+        vulnerabilities: None,
+        copyright: None,
+        legal_files: None,
+        chosen_license: None,
+        requires: None,
+        scope: DependencyScope::Runtime,
+        manual_license: None,
+        health: None,
+        obligations: None,
+        explanation: None,
+        repository,
+        aliases: None,
+        purl: None,
+        review: None,
+        status: LookupStatus::Ok,
+        error: None,
+    }
+}
+
+/// License of a package, classified from the license file of its repository
+///
+/// SwiftPM manifests have no license field, so the checkout's license file is
+/// read when the packages have been resolved locally, and otherwise the one
+/// of the GitHub repository at the pinned revision.
+fn fetch_license_for_package(
+    package: &SwiftPackage,
+    project_dir: &Path,
+    no_local: bool,
+) -> (String, Option<f32>) {
+    let detected = match &package.source {
+        SwiftSource::Remote { url, revision } => {
+            let checkout_name = repository_name(url);
+            CHECKOUT_DIRS
+                .iter()
+                .filter(|_| !no_local && !checkout_name.is_empty())
+                .map(|dir| project_dir.join(dir).join(checkout_name))
+                .find_map(|checkout| detect_license_in_dir(&checkout))
+                .map(|detected| (detected.license, detected.confidence))
+                .or_else(|| fetch_repository_license(url, revision))
+        }
+        // Local repositories only exist on this machine
+        SwiftSource::Local(path) => detect_license_in_dir(&project_dir.join(path))
+            .map(|detected| (detected.license, detected.confidence)),
+        SwiftSource::Registry => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "{} comes from a package registry, which cannot be looked up",
+                    package.name
+                ),
+            );
+            None
+        }
+    };
+
+    match detected {
+        Some((license, confidence)) => (license, Some(confidence)),
+        None => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "No license found for {} ({})",
+                    package.name, package.version
+                ),
+            );
+            ("Unknown".to_string(), None)
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const MIT_LICENSE: &str = "Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the \"Software\"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:\n\nThe above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.\n\nTHE SOFTWARE IS PROVIDED \"AS IS\", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.";
+
+    const RESOLVED_V2: &str = r#"{
+  "originHash" : "5a1b2c",
+  "pins" : [
+    {
+      "identity" : "alamofire",
+      "kind" : "remoteSourceControl",
+      "location" : "https://github.com/Alamofire/Alamofire.git",
+      "state" : {
+        "revision" : "3dc6a42c7727c49bf26508e29b0a0b35f9c7e1ad",
+        "version" : "5.8.1"
+      }
+    },
+    {
+      "identity" : "swift-collections",
+      "kind" : "remoteSourceControl",
+      "location" : "https://github.com/apple/swift-collections",
+      "state" : {
+        "branch" : "main",
+        "revision" : "94cf62b3ba8d4bed62680a282d4c25f9c63c2efb"
+      }
+    },
+    {
+      "identity" : "design-kit",
+      "kind" : "localSourceControl",
+      "location" : "Packages/DesignKit",
+      "state" : {
+        "revision" : "0e1f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b",
+        "version" : "1.0.0"
+      }
+    },
+    {
+      "identity" : "mona.linkedlist",
+      "kind" : "registry",
+      "location" : "",
+      "state" : {
+        "version" : "1.2.0"
+      }
+    }
+  ],
+  "version" : 3
+}"#;
+
+    #[test]
+    fn test_parse_package_resolved_v2() {
+        let packages = parse_package_resolved(RESOLVED_V2);
+        assert_eq!(packages.len(), 4);
+        assert_eq!(packages[0].name, "alamofire");
+        assert_eq!(packages[0].version, "5.8.1");
+        assert_eq!(
+            packages[0].source,
+            SwiftSource::Remote {
+                url: "https://github.com/Alamofire/Alamofire.git".to_string(),
+                revision: "3dc6a42c7727c49bf26508e29b0a0b35f9c7e1ad".to_string(),
+            }
+        );
+        // Branch pins are reported at their revision
+        assert_eq!(
+            packages[1].version,
+            "94cf62b3ba8d4bed62680a282d4c25f9c63c2efb"
+        );
+        assert_eq!(
+            packages[2].source,
+            SwiftSource::Local("Packages/DesignKit".to_string())
+        );
+        assert_eq!(packages[3].source, SwiftSource::Registry);
+
+        assert!(parse_package_resolved("not json").is_empty());
+    }
+
+    #[test]
+    fn test_parse_package_resolved_v1() {
+        let content = r#"{
+  "object": {
+    "pins": [
+      {
+        "package": "SnapKit",
+        "repositoryURL": "https://github.com/SnapKit/SnapKit.git",
+        "state": {
+          "branch": null,
+          "revision": "f222cbdf325885926566172f6f5f06af95473158",
+          "version": "5.6.0"
+        }
+      }
+    ]
+  },
+  "version": 1
+}"#;
+        let packages = parse_package_resolved(content);
+        assert_eq!(packages.len(), 1);
+        assert_eq!(packages[0].name, "snapkit");
+        assert_eq!(packages[0].version, "5.6.0");
+        assert!(matches!(packages[0].source, SwiftSource::Remote { .. }));
+    }
+
+    #[test]
+    fn test_direct_package_identities() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::write(
+            root.join("Package.swift"),
+            r#"let package = Package(
+    name: "App",
+    dependencies: [
+        .package(url: "https://github.com/apple/swift-argument-parser", from: "1.2.0"),
+        .package(name: "Alamofire", url: "https://github.com/Alamofire/Alamofire.git", .upToNextMajor(from: "5.8.0")),
+        .package(id: "mona.LinkedList", from: "1.2.0"),
+        .package(path: "../Shared"),
+    ]
+)"#,
+        )
+        .unwrap();
+        fs::create_dir_all(root.join("App.xcodeproj")).unwrap();
+        fs::write(
+            root.join("App.xcodeproj/project.pbxproj"),
+            "\t\tF1 /* XCRemoteSwiftPackageReference \"SnapKit\" */ = {\n\t\t\tisa = XCRemoteSwiftPackageReference;\n\t\t\trepositoryURL = \"https://github.com/SnapKit/SnapKit\";\n\t\t};\n",
+        )
+        .unwrap();
+
+        let identities = direct_package_identities(root);
+        let mut identities: Vec<&str> = identities.iter().map(String::as_str).collect();
+        identities.sort();
+        assert_eq!(
+            identities,
+            vec![
+                "alamofire",
+                "mona.linkedlist",
+                "snapkit",
+                "swift-argument-parser"
+            ]
+        );
+    }
+
+    #[test]
+    fn test_xcode_project_resolved_and_checkouts() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        assert!(find_package_resolved(root).is_none());
+
+        let swiftpm = root.join("App.xcodeproj/project.xcworkspace/xcshareddata/swiftpm");
+        fs::create_dir_all(&swiftpm).unwrap();
+        fs::write(swiftpm.join("Package.resolved"), RESOLVED_V2).unwrap();
+        assert_eq!(
+            find_package_resolved(root),
+            Some(swiftpm.join("Package.resolved"))
+        );
+
+        // The workspace's file wins over the project's
+        let workspace = root.join("App.xcworkspace/xcshareddata/swiftpm");
+        fs::create_dir_all(&workspace).unwrap();
+        fs::write(workspace.join("Package.resolved"), RESOLVED_V2).unwrap();
+        assert_eq!(
+            find_package_resolved(root),
+            Some(workspace.join("Package.resolved"))
+        );
+
+        let checkout = root.join("SourcePackages/checkouts/Alamofire");
+        fs::create_dir_all(&checkout).unwrap();
+        fs::write(checkout.join("LICENSE"), MIT_LICENSE).unwrap();
+        let local = root.join("Packages/DesignKit");
+        fs::create_dir_all(&local).unwrap();
+        fs::write(local.join("LICENSE"), MIT_LICENSE).unwrap();
+
+        let packages = parse_package_resolved(RESOLVED_V2);
+        let (license, confidence) = fetch_license_for_package(&packages[0], root, false);
+        assert_eq!(license, "MIT");
+        assert!(confidence.is_some());
+        let (license, _) = fetch_license_for_package(&packages[2], root, true);
+        assert_eq!(license, "MIT");
+        assert_eq!(
+            fetch_license_for_package(&packages[3], root, false).0,
+            "Unknown"
+        );
+    }
+}
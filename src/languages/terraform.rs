@@ -0,0 +1,735 @@
+//! Terraform and OpenTofu providers and modules
+//!
+//! Providers are pinned in `.terraform.lock.hcl`. Modules are read from
+//! `.terraform/modules/modules.json` after `terraform init`, which lists every
+//! module call with its resolved version, and from the `module` blocks of the
+//! configuration otherwise. Local modules are part of the project and are not
+//! reported.
+
+use regex::Regex;
+use serde::Deserialize;
+use serde_json::Value;
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::cache::{cache_license, get_cached_license};
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_debug, log_error, time_dependency, LogLevel};
+use crate::languages::license_info;
+use crate::license_detector::detect_license_in_dir;
+use crate::licenses::{fetch_licenses_from_github, LicenseInfo};
+use crate::registry::{self, Registry};
+use crate::repository_license::fetch_repository_license;
+
+pub const TERRAFORM_LOCKFILE: &str = ".terraform.lock.hcl";
+
+/// The file dependencies are reported from: the lockfile, or the first
+/// configuration file of a configuration that was never initialized
+pub fn find_manifest(project_dir: &Path) -> Option<String> {
+    if project_dir.join(TERRAFORM_LOCKFILE).exists() {
+        return Some(TERRAFORM_LOCKFILE.to_string());
+    }
+    configuration_files(project_dir)
+        .first()
+        .and_then(|file| file.file_name())
+        .map(|name| name.to_string_lossy().to_string())
+}
+
+/// The `.tf` files of a configuration, sorted by name
+fn configuration_files(project_dir: &Path) -> Vec<PathBuf> {
+    let mut files: Vec<PathBuf> = fs::read_dir(project_dir)
+        .map(|entries| {
+            entries
+                .filter_map(|e| e.ok())
+                .map(|e| e.path())
+                .filter(|path| path.extension().is_some_and(|ext| ext == "tf"))
+                .collect()
+        })
+        .unwrap_or_default();
+    files.sort();
+    files
+}
+
+/// Registry the provider and module addresses without a host refer to
+const DEFAULT_REGISTRY: &str = "registry.terraform.io";
+
+const OPENTOFU_REGISTRY: &str = "registry.opentofu.org";
+
+/// A provider pinned in `.terraform.lock.hcl`
+#[derive(Debug, Clone, PartialEq)]
+pub struct TerraformProvider {
+    /// Source address, `<host>/<namespace>/<type>`
+    pub source: String,
+    pub version: String,
+}
+
+/// Where a module call gets its code from
+#[derive(Debug, Clone, PartialEq)]
+pub enum ModuleSource {
+    Registry {
+        host: String,
+        namespace: String,
+        name: String,
+        provider: String,
+    },
+    Git {
+        url: String,
+        git_ref: Option<String>,
+    },
+    Local,
+    /// Archives, buckets and other sources that can't be looked up
+    Other(String),
+}
+
+/// A module call, from `modules.json` or a `module` block
+#[derive(Debug, Clone, PartialEq)]
+pub struct TerraformModule {
+    /// Source address without its `?ref=` or `//subdir` suffix, registry
+    /// modules with their host like providers
+    pub name: String,
+    /// Resolved version, or the version constraint of a `module` block
+    pub version: Option<String>,
+    pub source: ModuleSource,
+    /// Directory the module was downloaded to by `terraform init`
+    pub dir: Option<PathBuf>,
+}
+
+#[derive(Deserialize)]
+struct ModulesManifest {
+    #[serde(rename = "Modules", default)]
+    modules: Vec<ModuleManifestEntry>,
+}
+
+#[derive(Deserialize)]
+struct ModuleManifestEntry {
+    #[serde(rename = "Key", default)]
+    key: String,
+    #[serde(rename = "Source", default)]
+    source: String,
+    #[serde(rename = "Version", default)]
+    version: Option<String>,
+    #[serde(rename = "Dir", default)]
+    dir: String,
+}
+
+pub fn analyze_terraform_licenses(
+    project_dir: &Path,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> Vec<LicenseInfo> {
+    log(
+        LogLevel::Info,
+        &format!(
+            "Analyzing Terraform dependencies in: {}",
+            project_dir.display()
+        ),
+    );
+
+    let known_licenses = match fetch_licenses_from_github() {
+        Ok(licenses) => {
+            log(
+                LogLevel::Info,
+                &format!("Fetched {} known licenses from GitHub", licenses.len()),
+            );
+            licenses
+        }
+        Err(err) => {
+            log_error("Failed to fetch licenses from GitHub", &err);
+            HashMap::new()
+        }
+    };
+
+    let providers = match fs::read_to_string(project_dir.join(TERRAFORM_LOCKFILE)) {
+        Ok(content) => parse_lockfile(&content),
+        Err(_) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "No {TERRAFORM_LOCKFILE} in {}, run `terraform init` to pin providers",
+                    project_dir.display()
+                ),
+            );
+            Vec::new()
+        }
+    };
+    let modules: Vec<TerraformModule> = read_modules(project_dir)
+        .into_iter()
+        .filter(|module| module.source != ModuleSource::Local)
+        .collect();
+    log(
+        LogLevel::Info,
+        &format!(
+            "Found {} providers and {} modules",
+            providers.len(),
+            modules.len()
+        ),
+    );
+    log_debug("Terraform providers", &providers);
+    log_debug("Terraform modules", &modules);
+
+    let provider_licenses = providers.into_iter().map(|provider| {
+        let (license, confidence) =
+            time_dependency("terraform", &provider.source, &provider.version, || {
+                provider_license(&provider, project_dir, no_local)
+            });
+        license_info(
+            provider.source,
+            provider.version,
+            license,
+            confidence,
+            &known_licenses,
+            config,
+        )
+    });
+    let module_licenses: Vec<LicenseInfo> = modules
+        .into_iter()
+        .map(|module| {
+            let version = module.version.clone().unwrap_or_default();
+            let (license, confidence) =
+                time_dependency("terraform", &module.name, &version, || {
+                    module_license(&module, no_local)
+                });
+            license_info(
+                module.name,
+                version,
+                license,
+                confidence,
+                &known_licenses,
+                config,
+            )
+        })
+        .collect();
+
+    let licenses: Vec<LicenseInfo> = provider_licenses.chain(module_licenses).collect();
+    log(
+        LogLevel::Info,
+        &format!(
+            "Found {} Terraform dependencies with licenses",
+            licenses.len()
+        ),
+    );
+    licenses
+}
+
+/// Read the `provider` blocks of a `.terraform.lock.hcl`
+fn parse_lockfile(content: &str) -> Vec<TerraformProvider> {
+    let (Ok(provider_regex), Ok(version_regex)) = (
+        Regex::new(r#"^\s*provider\s+"([^"]+)"\s*\{"#),
+        Regex::new(r#"^\s*version\s*=\s*"([^"]+)""#),
+    ) else {
+        return Vec::new();
+    };
+
+    let mut providers = Vec::new();
+    let mut current: Option<String> = None;
+    for line in content.lines() {
+        if let Some(captures) = provider_regex.captures(line) {
+            current = Some(captures[1].to_string());
+        } else if let Some(captures) = version_regex.captures(line) {
+            if let Some(source) = current.take() {
+                providers.push(TerraformProvider {
+                    source,
+                    version: captures[1].to_string(),
+                });
+            }
+        }
+    }
+    providers
+}
+
+/// Module calls of a configuration, resolved by `terraform init` when it has run
+fn read_modules(project_dir: &Path) -> Vec<TerraformModule> {
+    let manifest = project_dir
+        .join(".terraform")
+        .join("modules")
+        .join("modules.json");
+    if let Ok(content) = fs::read_to_string(&manifest) {
+        match serde_json::from_str::<ModulesManifest>(&content) {
+            Ok(manifest) => return modules_from_manifest(manifest, project_dir),
+            Err(err) => log_error(&format!("Failed to parse {}", manifest.display()), &err),
+        }
+    }
+
+    configuration_files(project_dir)
+        .iter()
+        .filter_map(|file| {
+            let content = fs::read_to_string(file).ok()?;
+            Some(parse_module_blocks(&content))
+        })
+        .flatten()
+        .collect()
+}
+
+fn modules_from_manifest(manifest: ModulesManifest, project_dir: &Path) -> Vec<TerraformModule> {
+    manifest
+        .modules
+        .into_iter()
+        // The root module has an empty key
+        .filter(|entry| !entry.key.is_empty())
+        .map(|entry| {
+            let (name, source) = parse_module_source(&entry.source);
+            TerraformModule {
+                name,
+                version: entry
+                    .version
+                    .filter(|version| !version.is_empty())
+                    .or_else(|| git_ref(&source)),
+                source,
+                dir: Some(project_dir.join(&entry.dir)),
+            }
+        })
+        .collect()
+}
+
+/// Read the `source` and `version` of the `module` blocks in a `.tf` file
+fn parse_module_blocks(content: &str) -> Vec<TerraformModule> {
+    let (Ok(module_regex), Ok(attribute_regex)) = (
+        Regex::new(r#"^\s*module\s+"[^"]+"\s*\{"#),
+        Regex::new(r#"^\s*(source|version)\s*=\s*"([^"]*)""#),
+    ) else {
+        return Vec::new();
+    };
+
+    let mut modules = Vec::new();
+    let mut lines = content.lines();
+    while let Some(line) = lines.next() {
+        if !module_regex.is_match(line) {
+            continue;
+        }
+
+        let (mut source, mut version) = (None, None);
+        let mut depth = 1;
+        for line in lines.by_ref() {
+            // Only attributes of the module block itself, not of nested blocks
+            if depth == 1 {
+                if let Some(captures) = attribute_regex.captures(line) {
+                    let value = captures[2].to_string();
+                    match &captures[1] {
+                        "source" => source = Some(value),
+                        _ => version = Some(value),
+                    }
+                }
+            }
+            depth += line.matches('{').count();
+            depth -= line.matches('}').count().min(depth);
+            if depth == 0 {
+                break;
+            }
+        }
+
+        if let Some(source) = source {
+            let (name, source) = parse_module_source(&source);
+            modules.push(TerraformModule {
+                name,
+                version: version.or_else(|| git_ref(&source)),
+                source,
+                dir: None,
+            });
+        }
+    }
+    modules
+}
+
+/// Classify a module source address, returning it without `?ref=` and `//subdir`
+fn parse_module_source(address: &str) -> (String, ModuleSource) {
+    if address.starts_with("./") || address.starts_with("../") || address.starts_with('/') {
+        return (address.to_string(), ModuleSource::Local);
+    }
+
+    let (address, query) = address.split_once('?').unwrap_or((address, ""));
+    let git_ref = query
+        .split('&')
+        .find_map(|pair| pair.strip_prefix("ref="))
+        .map(str::to_string);
+
+    let forced_git = address.strip_prefix("git::");
+    let is_git = forced_git.is_some()
+        || address.starts_with("github.com/")
+        || address.starts_with("git@github.com:");
+    if is_git {
+        let url = forced_git.unwrap_or(address);
+        let url = strip_subdir(url);
+        let url = match url.strip_prefix("github.com/") {
+            Some(path) => format!("https://github.com/{path}"),
+            None => url.to_string(),
+        };
+        return (url.clone(), ModuleSource::Git { url, git_ref });
+    }
+    if address.contains("::") || address.contains("://") {
+        return (
+            address.to_string(),
+            ModuleSource::Other(address.to_string()),
+        );
+    }
+
+    let address = strip_subdir(address);
+    let parts: Vec<&str> = address.split('/').collect();
+    let (host, rest) = match parts.as_slice() {
+        [host, rest @ ..] if rest.len() == 3 && host.contains('.') => (*host, rest),
+        rest if rest.len() == 3 => (DEFAULT_REGISTRY, rest),
+        _ => {
+            return (
+                address.to_string(),
+                ModuleSource::Other(address.to_string()),
+            )
+        }
+    };
+    (
+        format!("{host}/{}", rest.join("/")),
+        ModuleSource::Registry {
+            host: host.to_string(),
+            namespace: rest[0].to_string(),
+            name: rest[1].to_string(),
+            provider: rest[2].to_string(),
+        },
+    )
+}
+
+/// The ref a git module is pinned to, which stands in for a version
+fn git_ref(source: &ModuleSource) -> Option<String> {
+    match source {
+        ModuleSource::Git { git_ref, .. } => git_ref.clone(),
+        _ => None,
+    }
+}
+
+/// The part of a source address before a `//subdir`, keeping a scheme's `://`
+fn strip_subdir(address: &str) -> &str {
+    let search_from = address.find("://").map_or(0, |scheme| scheme + 3);
+    match address[search_from..].find("//") {
+        Some(subdir) => &address[..search_from + subdir],
+        None => address,
+    }
+}
+
+/// Whether a module version is a single release rather than a constraint
+fn is_exact_version(version: &str) -> bool {
+    let version = version.trim().trim_start_matches('=').trim();
+    !version.is_empty()
+        && version
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '.' | '-' | '+'))
+}
+
+/// License of a provider, from the unpacked plugin or its source repository
+///
+/// Plugins are installed to `.terraform/providers/<source>/<version>/<os_arch>`,
+/// and some ship their license next to the binary.
+fn provider_license(
+    provider: &TerraformProvider,
+    project_dir: &Path,
+    no_local: bool,
+) -> (Option<String>, Option<f32>) {
+    if !no_local {
+        let installed = project_dir
+            .join(".terraform")
+            .join("providers")
+            .join(&provider.source)
+            .join(&provider.version);
+        let detected = fs::read_dir(&installed).ok().and_then(|platforms| {
+            platforms
+                .filter_map(|e| e.ok())
+                .find_map(|platform| detect_license_in_dir(&platform.path()))
+        });
+        if let Some(detected) = detected {
+            return (Some(detected.license), Some(detected.confidence));
+        }
+    }
+
+    if let Some(license) = get_cached_license("terraform", &provider.source, &provider.version) {
+        return (Some(license), None);
+    }
+
+    let parts: Vec<&str> = provider.source.split('/').collect();
+    let [host, namespace, provider_type] = parts.as_slice() else {
+        log(
+            LogLevel::Warn,
+            &format!("Unexpected provider address {}", provider.source),
+        );
+        return (None, None);
+    };
+    // Both registries require providers to be published from a repository
+    // named terraform-provider-<type>, tagged v<version>
+    let (repository, tag) = registry_source(
+        host,
+        &format!("providers/{namespace}/{provider_type}/{}", provider.version),
+    )
+    .unwrap_or_else(|| {
+        (
+            format!("https://github.com/{namespace}/terraform-provider-{provider_type}"),
+            format!("v{}", provider.version),
+        )
+    });
+    cached_github_license(&provider.source, &provider.version, &repository, &tag)
+}
+
+/// License of a module, from its download in `.terraform/modules` or its repository
+fn module_license(module: &TerraformModule, no_local: bool) -> (Option<String>, Option<f32>) {
+    let downloaded = module
+        .dir
+        .as_deref()
+        .filter(|dir| !no_local && dir.is_dir());
+    if let Some(detected) = downloaded.and_then(detect_license_in_dir) {
+        return (Some(detected.license), Some(detected.confidence));
+    }
+
+    let version = module.version.as_deref().filter(|v| is_exact_version(v));
+    match &module.source {
+        ModuleSource::Registry {
+            host,
+            namespace,
+            name,
+            provider,
+        } => {
+            let version_key = version.unwrap_or("latest");
+            if let Some(license) = get_cached_license("terraform", &module.name, version_key) {
+                return (Some(license), None);
+            }
+            let path = match version {
+                Some(version) => format!("modules/{namespace}/{name}/{provider}/{version}"),
+                None => format!("modules/{namespace}/{name}/{provider}"),
+            };
+            // Registry modules are published from terraform-<provider>-<name> repositories
+            let (repository, tag) = registry_source(host, &path).unwrap_or_else(|| {
+                (
+                    format!("https://github.com/{namespace}/terraform-{provider}-{name}"),
+                    version.map(|v| format!("v{v}")).unwrap_or_default(),
+                )
+            });
+            cached_github_license(&module.name, version_key, &repository, &tag)
+        }
+        ModuleSource::Git { url, git_ref } => {
+            let (license, confidence) =
+                fetch_repository_license(url, git_ref.as_deref().unwrap_or_default()).unzip();
+            (license, confidence)
+        }
+        ModuleSource::Local => (None, None),
+        ModuleSource::Other(address) => {
+            log(
+                LogLevel::Warn,
+                &format!("Cannot look up licenses for module source {address}"),
+            );
+            (None, None)
+        }
+    }
+}
+
+/// Repository and tag of a provider or module release on the Terraform registry
+///
+/// Only registry.terraform.io serves this metadata; OpenTofu's registry
+/// implements the download protocol only.
+fn registry_source(host: &str, path: &str) -> Option<(String, String)> {
+    if host != DEFAULT_REGISTRY {
+        if host != OPENTOFU_REGISTRY {
+            log(
+                LogLevel::Warn,
+                &format!("Assuming a GitHub repository for {host}/{path}"),
+            );
+        }
+        return None;
+    }
+
+    let url = format!("https://{DEFAULT_REGISTRY}/v1/{path}");
+    log(
+        LogLevel::Info,
+        &format!("Fetching metadata from the Terraform registry: {url}"),
+    );
+    let response = match registry::get(Registry::Terraform, &url) {
+        Ok(response) if response.status().is_success() => response,
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Terraform registry returned {} for {path}",
+                    response.status()
+                ),
+            );
+            return None;
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch metadata for {path}"), &err);
+            return None;
+        }
+    };
+    let json: Value = match response.json() {
+        Ok(json) => json,
+        Err(err) => {
+            log_error(&format!("Failed to parse metadata for {path}"), &err);
+            return None;
+        }
+    };
+    let source = json["source"].as_str()?.to_string();
+    let tag = json["tag"].as_str().unwrap_or_default().to_string();
+    Some((source, tag))
+}
+
+fn cached_github_license(
+    name: &str,
+    version: &str,
+    repository: &str,
+    tag: &str,
+) -> (Option<String>, Option<f32>) {
+    match fetch_repository_license(repository, tag) {
+        Some((license, confidence)) => {
+            cache_license("terraform", name, version, &license);
+            (Some(license), Some(confidence))
+        }
+        None => (None, None),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    const MIT_LICENSE: &str = "Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the \"Software\"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:\n\nThe above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.\n\nTHE SOFTWARE IS PROVIDED \"AS IS\", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.";
+
+    const LOCKFILE: &str = r#"# This file is maintained automatically by "terraform init".
+# Manual edits may be lost in future updates.
+
+provider "registry.terraform.io/hashicorp/aws" {
+  version     = "5.31.0"
+  constraints = "~> 5.0"
+  hashes = [
+    "h1:ltxyuBWIy9cq0kIKDJH1jeWJy/y7XJLjS4QrsQK4plA=",
+  ]
+}
+
+provider "registry.opentofu.org/integrations/github" {
+  version = "6.0.0"
+  hashes = [
+    "h1:abc=",
+  ]
+}
+"#;
+
+    const MAIN_TF: &str = r#"
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "~> 5.1"
+
+  tags = {
+    source = "not-a-module-source"
+  }
+}
+
+module "network" {
+  source = "./modules/network"
+}
+
+module "dns" {
+  source = "git::https://github.com/acme/terraform-dns.git//modules/zone?ref=v1.2.0"
+}
+
+module "bucket" {
+  source = "app.terraform.io/acme/bucket/aws"
+  version = "2.0.1"
+}
+"#;
+
+    #[test]
+    fn test_parse_lockfile() {
+        let providers = parse_lockfile(LOCKFILE);
+        assert_eq!(
+            providers,
+            vec![
+                TerraformProvider {
+                    source: "registry.terraform.io/hashicorp/aws".to_string(),
+                    version: "5.31.0".to_string(),
+                },
+                TerraformProvider {
+                    source: "registry.opentofu.org/integrations/github".to_string(),
+                    version: "6.0.0".to_string(),
+                },
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_module_blocks() {
+        let modules = parse_module_blocks(MAIN_TF);
+        assert_eq!(modules.len(), 4);
+
+        assert_eq!(
+            modules[0].name,
+            "registry.terraform.io/terraform-aws-modules/vpc/aws"
+        );
+        assert_eq!(modules[0].version.as_deref(), Some("~> 5.1"));
+        assert_eq!(
+            modules[0].source,
+            ModuleSource::Registry {
+                host: "registry.terraform.io".to_string(),
+                namespace: "terraform-aws-modules".to_string(),
+                name: "vpc".to_string(),
+                provider: "aws".to_string(),
+            }
+        );
+        assert_eq!(modules[1].source, ModuleSource::Local);
+        assert_eq!(modules[2].version.as_deref(), Some("v1.2.0"));
+        assert_eq!(
+            modules[2].source,
+            ModuleSource::Git {
+                url: "https://github.com/acme/terraform-dns.git".to_string(),
+                git_ref: Some("v1.2.0".to_string()),
+            }
+        );
+        assert!(matches!(
+            &modules[3].source,
+            ModuleSource::Registry { host, .. } if host == "app.terraform.io"
+        ));
+    }
+
+    #[test]
+    fn test_parse_module_source() {
+        assert_eq!(
+            parse_module_source("github.com/acme/modules//s3?ref=main"),
+            (
+                "https://github.com/acme/modules".to_string(),
+                ModuleSource::Git {
+                    url: "https://github.com/acme/modules".to_string(),
+                    git_ref: Some("main".to_string()),
+                }
+            )
+        );
+        assert!(matches!(
+            parse_module_source("s3::https://s3.amazonaws.com/bucket/vpc.zip").1,
+            ModuleSource::Other(_)
+        ));
+        assert!(is_exact_version("5.1.2"));
+        assert!(is_exact_version("= 5.1.2"));
+        assert!(!is_exact_version("~> 5.1"));
+    }
+
+    #[test]
+    fn test_read_modules_from_manifest() {
+        let temp_dir = TempDir::new().unwrap();
+        fs::write(temp_dir.path().join("main.tf"), MAIN_TF).unwrap();
+        let modules_dir = temp_dir.path().join(".terraform").join("modules");
+        fs::create_dir_all(modules_dir.join("vpc")).unwrap();
+        fs::write(
+            modules_dir.join("modules.json"),
+            r#"{"Modules":[
+                {"Key":"","Source":"","Dir":"."},
+                {"Key":"vpc","Source":"registry.terraform.io/terraform-aws-modules/vpc/aws","Version":"5.1.2","Dir":".terraform/modules/vpc"},
+                {"Key":"network","Source":"./modules/network","Dir":"modules/network"}
+            ]}"#,
+        )
+        .unwrap();
+        fs::write(modules_dir.join("vpc").join("LICENSE"), MIT_LICENSE).unwrap();
+
+        let modules = read_modules(temp_dir.path());
+        assert_eq!(modules.len(), 2);
+        assert_eq!(
+            modules[0].name,
+            "registry.terraform.io/terraform-aws-modules/vpc/aws"
+        );
+        assert_eq!(modules[0].version.as_deref(), Some("5.1.2"));
+        assert_eq!(modules[1].source, ModuleSource::Local);
+
+        let (license, confidence) = module_license(&modules[0], false);
+        assert_eq!(license.as_deref(), Some("MIT"));
+        assert!(confidence.is_some());
+    }
+}
@@ -0,0 +1,450 @@
+//! Legal files besides the license (`--legal-files`)
+//!
+//! A permissive LICENSE can sit next to terms that matter as much: a PATENTS
+//! file whose patent grant ends when you sue the author, an end-user license
+//! agreement, a commercial license covering some files or uses, or a
+//! contributor license agreement. These files are found in installed packages
+//! by their name (`PATENTS`, `EULA.txt`, `LICENSE-COMMERCIAL`, `CLA.md`), at the
+//! top of the package or in a `legal` or `licenses` directory, and by telltale
+//! phrases in the license, NOTICE, README and CONTRIBUTING files, e.g. "End User
+//! License Agreement" in a LICENSE file.
+//!
+//! Each dependency lists them in `legal_files`. `[policy.legal_files]` decides
+//! per kind whether they are ignored, reported or fail the scan.
+
+use colored::*;
+use rayon::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::fs::{self, File};
+use std::io::Read;
+use std::path::Path;
+
+use crate::attributions::local_package_dir;
+use crate::config::{HealthAction, LegalFilesPolicy};
+use crate::debug::{log, LogLevel};
+use crate::license_detector::LICENSE_FILE_PREFIXES;
+use crate::licenses::LicenseInfo;
+use crate::reporter::TableFormatter;
+
+/// Directories of a package, compared case-insensitively, whose files are legal texts
+const LEGAL_DIRS: [&str; 4] = ["legal", "licenses", "licences", "license"];
+
+/// Extensions of text documents, which are stripped before looking at the name
+const DOCUMENT_EXTENSIONS: [&str; 8] =
+    ["txt", "md", "markdown", "rst", "adoc", "html", "htm", "pdf"];
+
+/// Files searched for telltale phrases besides license files, by name prefix
+const SEARCHED_PREFIXES: [&str; 3] = ["NOTICE", "README", "CONTRIBUTING"];
+
+/// Bytes read from each file searched for telltale phrases
+const MAX_TEXT_BYTES: u64 = 64 * 1024;
+
+/// Phrases that give away the terms in a file, compared in lowercase
+const TELLTALE_PHRASES: [(LegalFileKind, &str); 8] = [
+    (LegalFileKind::Patents, "additional grant of patent rights"),
+    (LegalFileKind::Eula, "end user license agreement"),
+    (LegalFileKind::Eula, "end-user license agreement"),
+    (LegalFileKind::Eula, "licensed, not sold"),
+    (LegalFileKind::Commercial, "commercial license agreement"),
+    (LegalFileKind::Commercial, "requires a commercial license"),
+    (LegalFileKind::Commercial, "purchase a commercial license"),
+    (LegalFileKind::Cla, "contributor license agreement"),
+];
+
+/// Kinds of legal files besides the license
+#[derive(Serialize, Deserialize, Debug, Clone, Copy, PartialEq, Eq, Hash, PartialOrd, Ord)]
+#[serde(rename_all = "lowercase")]
+pub enum LegalFileKind {
+    /// Patent grant or patent terms, e.g. a PATENTS file
+    Patents,
+    /// End-user license agreement
+    Eula,
+    /// Commercial or proprietary license terms
+    Commercial,
+    /// Contributor license agreement
+    Cla,
+}
+
+impl LegalFileKind {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            LegalFileKind::Patents => "patents",
+            LegalFileKind::Eula => "eula",
+            LegalFileKind::Commercial => "commercial",
+            LegalFileKind::Cla => "cla",
+        }
+    }
+
+    /// What the file holds, for terminal output
+    pub fn describe(&self) -> &'static str {
+        match self {
+            LegalFileKind::Patents => "patent terms",
+            LegalFileKind::Eula => "end-user license agreement",
+            LegalFileKind::Commercial => "commercial license",
+            LegalFileKind::Cla => "contributor license agreement",
+        }
+    }
+}
+
+impl std::fmt::Display for LegalFileKind {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// A legal file found in a dependency
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq, Eq)]
+pub struct LegalFile {
+    pub kind: LegalFileKind,
+    /// Path inside the package, e.g. `PATENTS` or `legal/EULA.txt`
+    pub file: String,
+    /// Phrase the file was recognized by, when its name doesn't tell
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub matched: Option<String>,
+}
+
+/// The kind of legal file a name stands for, e.g. `LICENSE-COMMERCIAL.md`
+pub fn kind_from_file_name(file_name: &str) -> Option<LegalFileKind> {
+    let stem = match file_name.rsplit_once('.') {
+        Some((stem, extension))
+            if DOCUMENT_EXTENSIONS.contains(&extension.to_ascii_lowercase().as_str()) =>
+        {
+            stem
+        }
+        _ => file_name,
+    };
+    let stem = stem.to_ascii_uppercase();
+    let words: Vec<&str> = stem
+        .split(['-', '_', '.', ' '])
+        .filter(|word| !word.is_empty())
+        .collect();
+    let has = |word: &str| words.contains(&word);
+
+    if words.iter().any(|word| word.starts_with("PATENT")) {
+        Some(LegalFileKind::Patents)
+    } else if has("EULA") || has("ENDUSER") || (has("END") && has("USER")) {
+        Some(LegalFileKind::Eula)
+    } else if has("COMMERCIAL") || has("PROPRIETARY") {
+        Some(LegalFileKind::Commercial)
+    } else if has("CLA") || (has("CONTRIBUTOR") && has("AGREEMENT")) {
+        Some(LegalFileKind::Cla)
+    } else {
+        None
+    }
+}
+
+/// Kinds of terms a text gives away, with the first phrase found for each
+pub fn telltale_phrases(text: &str) -> Vec<(LegalFileKind, &'static str)> {
+    // Phrases may be wrapped over several lines
+    let text = text
+        .split_whitespace()
+        .collect::<Vec<_>>()
+        .join(" ")
+        .to_lowercase();
+    let mut found: Vec<(LegalFileKind, &'static str)> = Vec::new();
+    for (kind, phrase) in TELLTALE_PHRASES {
+        if !found.iter().any(|(seen, _)| *seen == kind) && text.contains(phrase) {
+            found.push((kind, phrase));
+        }
+    }
+    found
+}
+
+fn is_document(file_name: &str) -> bool {
+    let upper = file_name.to_ascii_uppercase();
+    match file_name.rsplit_once('.') {
+        None => true,
+        Some((_, extension)) => {
+            DOCUMENT_EXTENSIONS.contains(&extension.to_ascii_lowercase().as_str())
+                || ["LICENSE", "LICENCE"]
+                    .iter()
+                    .any(|prefix| upper.starts_with(prefix))
+        }
+    }
+}
+
+fn is_searched_for_phrases(file_name: &str) -> bool {
+    let upper = file_name.to_ascii_uppercase();
+    LICENSE_FILE_PREFIXES
+        .iter()
+        .chain(&SEARCHED_PREFIXES)
+        .any(|prefix| upper.starts_with(prefix))
+}
+
+/// The start of a file, `None` unless it is text
+fn read_start(path: &Path) -> Option<String> {
+    let mut bytes = Vec::new();
+    File::open(path)
+        .ok()?
+        .take(MAX_TEXT_BYTES)
+        .read_to_end(&mut bytes)
+        .ok()?;
+    // A multi-byte character may be cut at the end
+    let text = String::from_utf8_lossy(&bytes);
+    (!text.contains('\0')).then(|| text.into_owned())
+}
+
+/// Documents at the top of `dir` and in its legal directories, with their
+/// path inside the package and whether every one of them is a legal text
+fn candidate_files(dir: &Path) -> Vec<(std::path::PathBuf, String, bool)> {
+    let mut files = Vec::new();
+    let Ok(entries) = fs::read_dir(dir) else {
+        return files;
+    };
+    let mut entries: Vec<_> = entries.flatten().collect();
+    entries.sort_by_key(|entry| entry.file_name());
+
+    for entry in entries {
+        let name = entry.file_name().to_string_lossy().to_string();
+        let Ok(file_type) = entry.file_type() else {
+            continue;
+        };
+        if file_type.is_file() && is_document(&name) {
+            files.push((entry.path(), name, false));
+        } else if file_type.is_dir() && LEGAL_DIRS.contains(&name.to_lowercase().as_str()) {
+            let Ok(inner) = fs::read_dir(entry.path()) else {
+                continue;
+            };
+            let mut inner: Vec<_> = inner
+                .flatten()
+                .filter(|inner| inner.file_type().is_ok_and(|t| t.is_file()))
+                .collect();
+            inner.sort_by_key(|inner| inner.file_name());
+            for inner in inner {
+                let inner_name = inner.file_name().to_string_lossy().to_string();
+                if is_document(&inner_name) {
+                    files.push((inner.path(), format!("{name}/{inner_name}"), true));
+                }
+            }
+        }
+    }
+    files
+}
+
+/// Legal files of the package installed in `dir`, ordered by kind
+pub fn find_legal_files(dir: &Path) -> Vec<LegalFile> {
+    let mut found = Vec::new();
+    for (path, relative, in_legal_dir) in candidate_files(dir) {
+        let file_name = relative.rsplit('/').next().unwrap_or(&relative);
+        if let Some(kind) = kind_from_file_name(file_name) {
+            found.push(LegalFile {
+                kind,
+                file: relative,
+                matched: None,
+            });
+            continue;
+        }
+        if !in_legal_dir && !is_searched_for_phrases(file_name) {
+            continue;
+        }
+        let Some(text) = read_start(&path) else {
+            continue;
+        };
+        for (kind, phrase) in telltale_phrases(&text) {
+            found.push(LegalFile {
+                kind,
+                file: relative.clone(),
+                matched: Some(phrase.to_string()),
+            });
+        }
+    }
+    found.sort_by_key(|file| file.kind);
+    found
+}
+
+/// Set [`LicenseInfo::legal_files`] for every dependency installed locally
+///
+/// Kinds that `[policy.legal_files]` ignores are left out. Dependencies that
+/// are not installed below `project_root`, in the cargo registry or in the Go
+/// module cache are left without.
+pub fn attach_legal_files(
+    project_root: &Path,
+    dependencies: &mut [LicenseInfo],
+    policy: &LegalFilesPolicy,
+) {
+    log(
+        LogLevel::Info,
+        &format!(
+            "Looking for legal files in {} dependencies",
+            dependencies.len()
+        ),
+    );
+
+    dependencies.par_iter_mut().for_each(|info| {
+        let Some(dir) = local_package_dir(project_root, &info.name, &info.version) else {
+            return;
+        };
+        let mut files = find_legal_files(&dir);
+        files.retain(|file| policy.action(file.kind) != HealthAction::Ignore);
+        for file in &files {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "{}@{} ships {}: {}",
+                    info.name,
+                    info.version,
+                    file.kind.describe(),
+                    file.file
+                ),
+            );
+        }
+        info.legal_files = Some(files);
+    });
+}
+
+/// Print the legal files found besides the licenses
+pub fn print_legal_files(dependencies: &[LicenseInfo]) {
+    let rows: Vec<Vec<String>> = dependencies
+        .iter()
+        .flat_map(|info| {
+            info.legal_files.iter().flatten().map(move |file| {
+                vec![
+                    info.name.clone(),
+                    info.version.clone(),
+                    file.kind.describe().to_string(),
+                    file.file.clone(),
+                ]
+            })
+        })
+        .collect();
+
+    if rows.is_empty() {
+        println!(
+            "\n{}\n",
+            "✅ No patent, EULA, commercial or CLA files found"
+                .green()
+                .bold()
+        );
+        return;
+    }
+
+    println!(
+        "\n{} {}\n",
+        "📜".bold(),
+        format!("Legal files besides the license: {}", rows.len())
+            .yellow()
+            .bold()
+    );
+
+    let headers = ["Package", "Version", "Terms", "File"];
+    let mut formatter = TableFormatter::new(headers.iter().map(|h| h.to_string()).collect());
+    for row in &rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+    for row in &rows {
+        println!("{}", formatter.render_row(row, true));
+    }
+    println!("{}\n", formatter.render_footer());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_kind_from_file_name() {
+        let cases = [
+            ("PATENTS", Some(LegalFileKind::Patents)),
+            ("PATENT_GRANT.md", Some(LegalFileKind::Patents)),
+            ("ADDITIONAL-PATENT-GRANT.txt", Some(LegalFileKind::Patents)),
+            ("EULA.txt", Some(LegalFileKind::Eula)),
+            ("End-User-License.pdf", Some(LegalFileKind::Eula)),
+            ("LICENSE-COMMERCIAL", Some(LegalFileKind::Commercial)),
+            ("LICENSE.commercial", Some(LegalFileKind::Commercial)),
+            (
+                "LicenseRef-Proprietary.txt",
+                Some(LegalFileKind::Commercial),
+            ),
+            ("CLA.md", Some(LegalFileKind::Cla)),
+            (
+                "contributor_license_agreement.rst",
+                Some(LegalFileKind::Cla),
+            ),
+            ("LICENSE", None),
+            ("CLASSES.md", None),
+            ("README.md", None),
+        ];
+        for (name, kind) in cases {
+            assert_eq!(kind_from_file_name(name), kind, "{name}");
+        }
+    }
+
+    #[test]
+    fn test_telltale_phrases() {
+        let text = "Use of this SDK is governed by the End User\n   License Agreement below.\n\
+            THIS SOFTWARE IS LICENSED, NOT SOLD.";
+        assert_eq!(
+            telltale_phrases(text),
+            vec![(LegalFileKind::Eula, "end user license agreement")]
+        );
+        assert!(telltale_phrases("Permission is hereby granted, free of charge").is_empty());
+    }
+
+    #[test]
+    fn test_find_legal_files() {
+        let temp_dir = TempDir::new().unwrap();
+        let dir = temp_dir.path();
+        fs::write(
+            dir.join("LICENSE"),
+            "BSD License\n\nCopyright (c) 2013-present\n",
+        )
+        .unwrap();
+        fs::write(
+            dir.join("PATENTS"),
+            "Additional Grant of Patent Rights Version 2\n",
+        )
+        .unwrap();
+        fs::write(
+            dir.join("README.md"),
+            "# SDK\n\nContributions require signing our Contributor License Agreement.\n",
+        )
+        .unwrap();
+        fs::create_dir(dir.join("legal")).unwrap();
+        fs::write(
+            dir.join("legal").join("terms.txt"),
+            "This END-USER LICENSE AGREEMENT is a legal agreement",
+        )
+        .unwrap();
+        // Source files aren't legal texts, whatever their name
+        fs::write(dir.join("patents.js"), "// End User License Agreement").unwrap();
+        fs::create_dir(dir.join("src")).unwrap();
+        fs::write(dir.join("src").join("EULA.txt"), "nested too deep").unwrap();
+
+        assert_eq!(
+            find_legal_files(dir),
+            vec![
+                LegalFile {
+                    kind: LegalFileKind::Patents,
+                    file: "PATENTS".to_string(),
+                    matched: None,
+                },
+                LegalFile {
+                    kind: LegalFileKind::Eula,
+                    file: "legal/terms.txt".to_string(),
+                    matched: Some("end-user license agreement".to_string()),
+                },
+                LegalFile {
+                    kind: LegalFileKind::Cla,
+                    file: "README.md".to_string(),
+                    matched: Some("contributor license agreement".to_string()),
+                },
+            ]
+        );
+    }
+
+    #[test]
+    fn test_legal_file_serialization() {
+        let file = LegalFile {
+            kind: LegalFileKind::Commercial,
+            file: "LICENSE-COMMERCIAL".to_string(),
+            matched: None,
+        };
+        assert_eq!(
+            serde_json::to_string(&file).unwrap(),
+            r#"{"kind":"commercial","file":"LICENSE-COMMERCIAL"}"#
+        );
+    }
+}
@@ -0,0 +1,125 @@
+//! Feluda checks the licenses of a project's dependencies.
+//!
+//! Besides the `feluda` binary, the crate can be used as a library to embed
+//! license checking in other tools:
+//!
+//! ```no_run
+//! use feluda::{scan, ScanOptions};
+//!
+//! let options = ScanOptions {
+//!     project_license: Some("MIT".to_string()),
+//!     ..ScanOptions::default()
+//! };
+//! let report = scan("./", &options)?;
+//! if report.has_incompatible() || !report.policy_violations.is_empty() {
+//!     eprintln!("license issues found");
+//! }
+//! # Ok::<(), feluda::FeludaError>(())
+//! ```
+
+mod aggregate;
+mod app;
+mod attributions;
+mod baseline;
+mod binary;
+mod bitbucket;
+mod bundle;
+mod cache;
+mod canonical;
+mod cli;
+mod completion;
+pub mod config;
+mod copyright;
+mod credentials;
+mod custom_licenses;
+mod debug;
+mod dependency_graph;
+mod dependency_submission;
+mod deps_dev;
+mod diff;
+mod exit_code;
+mod generate;
+mod gitlab;
+mod golden;
+mod graph_export;
+mod health;
+mod hook;
+mod html_report;
+mod i18n;
+mod image;
+mod languages;
+mod legal_files;
+mod license_detector;
+mod license_expression;
+mod license_text;
+mod licenses;
+mod limits;
+mod linking;
+mod lookup;
+mod lookup_errors;
+mod manpage;
+mod notify;
+mod obligations;
+mod offline;
+mod overrides;
+mod parser;
+mod plugins;
+mod policy;
+mod policy_server;
+mod progress;
+mod registry;
+mod remediation;
+mod report_json;
+mod reporter;
+mod repository_license;
+mod reuse;
+mod reviews;
+mod sarif;
+mod sbom;
+mod scan;
+mod score;
+mod server;
+mod shared_lookups;
+mod signing;
+mod source_headers;
+mod spreadsheet;
+mod store;
+mod table;
+mod template;
+mod tickets;
+mod tiers;
+mod utils;
+mod vendored;
+mod vulns;
+mod watch;
+
+#[doc(hidden)]
+pub use app::main;
+
+pub use cache::set_refresh;
+pub use cli::OutputFormat;
+pub use config::FeludaConfig;
+pub use debug::{FeludaError, FeludaResult};
+pub use licenses::{
+    is_license_compatible, set_github_token, DependencyScope, LicenseCompatibility, LicenseInfo,
+    ManualLicense, OsiStatus,
+};
+pub use policy::{check_policy, PolicyDecision, PolicyExplanation, PolicyViolation, ViolationKind};
+pub use report_json::{
+    render_json_report, write_json_report, write_ndjson, write_ndjson_report, NdjsonWriter,
+    LATEST_SCHEMA_VERSION, REPORT_SCHEMA_V2,
+};
+pub use reporter::generate_format_report;
+pub use scan::{
+    scan, DependencyCallback, ProgressCallback, ProjectSummary, Report, ScanOptions, ScanProgress,
+};
+pub use tiers::TierSummary;
+
+// Types of the fields of `LicenseInfo`
+pub use canonical::Alias;
+pub use health::PackageHealth;
+pub use legal_files::LegalFile;
+pub use lookup_errors::LookupStatus;
+pub use obligations::Obligations;
+pub use reviews::Review;
+pub use vulns::Vulnerability;
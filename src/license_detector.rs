@@ -0,0 +1,449 @@
+//! License classification from license file text
+//!
+//! Used when package metadata declares no license. The text of a LICENSE, COPYING
+//! or NOTICE file is normalized and compared against reference texts of common
+//! SPDX licenses using word bigrams. The score for a reference is the share of its
+//! bigrams found in the file, so a LICENSE file with an extra header or appendix
+//! still matches; ties are broken with the Sørensen–Dice coefficient, which tells
+//! apart licenses whose text contains another (ISC contains 0BSD, BSD-3-Clause
+//! contains BSD-2-Clause).
+//!
+//! Long licenses are represented by their distinctive opening sections and by the
+//! standard per-file notice, either of which identifies them. Licenses registered
+//! in `[licenses.custom]` are matched as well, see [`crate::custom_licenses`].
+
+use std::collections::HashSet;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::custom_licenses::CustomMatcher;
+use crate::debug::{log, LogLevel};
+
+/// Minimum score for a classification to be reported
+pub const MIN_CONFIDENCE: f32 = 0.8;
+
+/// A license classified from license text
+#[derive(Debug, Clone, PartialEq)]
+pub struct DetectedLicense {
+    pub license: String,
+    /// Share of the reference text found in the file, from 0.0 to 1.0
+    pub confidence: f32,
+}
+
+/// File names, compared case-insensitively, that may hold license text
+pub const LICENSE_FILE_PREFIXES: [&str; 4] = ["LICENSE", "LICENCE", "COPYING", "UNLICENSE"];
+
+const MIT_TEXT: &str = r#"Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE."#;
+
+const ISC_DISCLAIMER: &str = r#"THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE."#;
+
+const BSD_2_CLAUSES: &str = r#"Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution."#;
+
+const BSD_3_CLAUSE: &str = r#"3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission."#;
+
+const BSD_DISCLAIMER: &str = r#"THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE."#;
+
+const ZLIB_TEXT: &str = r#"This software is provided 'as-is', without any express or implied warranty. In no event will the authors be held liable for any damages arising from the use of this software.
+Permission is granted to anyone to use this software for any purpose, including commercial applications, and to alter it and redistribute it freely, subject to the following restrictions:
+1. The origin of this software must not be misrepresented; you must not claim that you wrote the original software. If you use this software in a product, an acknowledgment in the product documentation would be appreciated but is not required.
+2. Altered source versions must be plainly marked as such, and must not be misrepresented as being the original software.
+3. This notice may not be removed or altered from any source distribution."#;
+
+const UNLICENSE_TEXT: &str = r#"This is free and unencumbered software released into the public domain.
+Anyone is free to copy, modify, publish, use, compile, sell, or distribute this software, either in source code form or as a compiled binary, for any purpose, commercial or non-commercial, and by any means.
+In jurisdictions that recognize copyright laws, the author or authors of this software dedicate any and all copyright interest in the software to the public domain. We make this dedication for the benefit of the public at large and to the detriment of our heirs and successors. We intend this dedication to be an overt act of relinquishment in perpetuity of all present and future rights to this software under copyright law."#;
+
+const APACHE_2_TEXT: &str = r#"Apache License Version 2.0, January 2004 http://www.apache.org/licenses/
+TERMS AND CONDITIONS FOR USE, REPRODUCTION, AND DISTRIBUTION
+1. Definitions.
+"License" shall mean the terms and conditions for use, reproduction, and distribution as defined by Sections 1 through 9 of this document.
+"Licensor" shall mean the copyright owner or entity authorized by the copyright owner that is granting the License."#;
+
+const APACHE_2_NOTICE: &str = r#"Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License."#;
+
+const GPL_VERBATIM: &str = "Everyone is permitted to copy and distribute verbatim copies of this license document, but changing it is not allowed.";
+
+const GPL_3_TEXT: &str = r#"GNU GENERAL PUBLIC LICENSE Version 3, 29 June 2007
+Preamble
+The GNU General Public License is a free, copyleft license for software and other kinds of works.
+The licenses for most software and other practical works are designed to take away your freedom to share and change the works. By contrast, the GNU General Public License is intended to guarantee your freedom to share and change all versions of a program--to make sure it remains free software for all its users."#;
+
+const GPL_3_NOTICE: &str = "This program is free software: you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation, either version 3 of the License, or (at your option) any later version.";
+
+const GPL_2_TEXT: &str = r#"GNU GENERAL PUBLIC LICENSE Version 2, June 1991
+Preamble
+The licenses for most software are designed to take away your freedom to share and change it. By contrast, the GNU General Public License is intended to guarantee your freedom to share and change free software--to make sure the software is free for all its users."#;
+
+const GPL_2_NOTICE: &str = "This program is free software; you can redistribute it and/or modify it under the terms of the GNU General Public License as published by the Free Software Foundation; either version 2 of the License, or (at your option) any later version.";
+
+const LGPL_3_TEXT: &str = r#"GNU LESSER GENERAL PUBLIC LICENSE Version 3, 29 June 2007
+This version of the GNU Lesser General Public License incorporates the terms and conditions of version 3 of the GNU General Public License, supplemented by the additional permissions listed below."#;
+
+const LGPL_2_1_TEXT: &str = r#"GNU LESSER GENERAL PUBLIC LICENSE Version 2.1, February 1999
+[This is the first released version of the Lesser GPL. It also counts as the successor of the GNU Library Public License, version 2, hence the version number 2.1.]"#;
+
+const AGPL_3_TEXT: &str = r#"GNU AFFERO GENERAL PUBLIC LICENSE Version 3, 19 November 2007
+Preamble
+The GNU Affero General Public License is a free, copyleft license for software and other kinds of works, specifically designed to ensure cooperation with the community in the case of network server software."#;
+
+const MPL_2_TEXT: &str = r#"Mozilla Public License Version 2.0
+1. Definitions
+1.1. "Contributor" means each individual or legal entity that creates, contributes to the creation of, or owns Covered Software."#;
+
+const MPL_2_NOTICE: &str = "This Source Code Form is subject to the terms of the Mozilla Public License, v. 2.0. If a copy of the MPL was not distributed with this file, You can obtain one at http://mozilla.org/MPL/2.0/.";
+
+const EPL_2_TEXT: &str = r#"Eclipse Public License - v 2.0
+THE ACCOMPANYING PROGRAM IS PROVIDED UNDER THE TERMS OF THIS ECLIPSE PUBLIC LICENSE ("AGREEMENT"). ANY USE, REPRODUCTION OR DISTRIBUTION OF THE PROGRAM CONSTITUTES RECIPIENT'S ACCEPTANCE OF THIS AGREEMENT."#;
+
+/// Reference texts per SPDX identifier; a license may have several variants
+fn reference_texts() -> Vec<(&'static str, Vec<String>)> {
+    vec![
+        ("MIT", vec![MIT_TEXT.to_string()]),
+        (
+            "ISC",
+            vec![format!(
+                "Permission to use, copy, modify, and/or distribute this software for any purpose with or without fee is hereby granted, provided that the above copyright notice and this permission notice appear in all copies.\n{ISC_DISCLAIMER}"
+            )],
+        ),
+        (
+            "0BSD",
+            vec![format!(
+                "Permission to use, copy, modify, and/or distribute this software for any purpose with or without fee is hereby granted.\n{ISC_DISCLAIMER}"
+            )],
+        ),
+        (
+            "BSD-2-Clause",
+            vec![format!("{BSD_2_CLAUSES}\n{BSD_DISCLAIMER}")],
+        ),
+        (
+            "BSD-3-Clause",
+            vec![format!("{BSD_2_CLAUSES}\n{BSD_3_CLAUSE}\n{BSD_DISCLAIMER}")],
+        ),
+        ("Zlib", vec![ZLIB_TEXT.to_string()]),
+        ("Unlicense", vec![UNLICENSE_TEXT.to_string()]),
+        (
+            "Apache-2.0",
+            vec![APACHE_2_TEXT.to_string(), APACHE_2_NOTICE.to_string()],
+        ),
+        (
+            "GPL-3.0",
+            vec![
+                format!("{GPL_3_TEXT}\n{GPL_VERBATIM}"),
+                GPL_3_NOTICE.to_string(),
+            ],
+        ),
+        (
+            "GPL-2.0",
+            vec![
+                format!("{GPL_2_TEXT}\n{GPL_VERBATIM}"),
+                GPL_2_NOTICE.to_string(),
+            ],
+        ),
+        ("LGPL-3.0", vec![format!("{LGPL_3_TEXT}\n{GPL_VERBATIM}")]),
+        ("LGPL-2.1", vec![format!("{LGPL_2_1_TEXT}\n{GPL_VERBATIM}")]),
+        ("AGPL-3.0", vec![format!("{AGPL_3_TEXT}\n{GPL_VERBATIM}")]),
+        (
+            "MPL-2.0",
+            vec![MPL_2_TEXT.to_string(), MPL_2_NOTICE.to_string()],
+        ),
+        ("EPL-2.0", vec![EPL_2_TEXT.to_string()]),
+    ]
+}
+
+/// Classify license text against the reference texts
+///
+/// Returns the best match if it reaches [`MIN_CONFIDENCE`].
+pub fn classify_license_text(text: &str) -> Option<DetectedLicense> {
+    classify_with_custom_licenses(text, crate::custom_licenses::configured())
+}
+
+/// Classify license text, matching the custom licenses first
+///
+/// A text matching a pattern of a custom license is classified with full
+/// confidence; reference texts of custom licenses are scored like the others.
+fn classify_with_custom_licenses(text: &str, custom: &[CustomMatcher]) -> Option<DetectedLicense> {
+    if let Some(matcher) = custom.iter().find(|matcher| matcher.matches_text(text)) {
+        log(
+            LogLevel::Info,
+            &format!("License text matches a pattern of {}", matcher.id),
+        );
+        return Some(DetectedLicense {
+            license: matcher.id.clone(),
+            confidence: 1.0,
+        });
+    }
+
+    let text_bigrams = bigrams(&normalize(text));
+    if text_bigrams.is_empty() {
+        return None;
+    }
+
+    let mut references: Vec<(&str, Vec<String>)> = reference_texts();
+    references.extend(custom.iter().filter_map(|matcher| {
+        let text = matcher.text.clone()?;
+        Some((matcher.id.as_str(), vec![text]))
+    }));
+
+    let mut best: Option<(&str, f32, f32)> = None;
+    for (license, variants) in references {
+        for variant in variants {
+            let reference = bigrams(&normalize(&variant));
+            let shared = reference.intersection(&text_bigrams).count() as f32;
+            let containment = shared / reference.len() as f32;
+            let dice = 2.0 * shared / (reference.len() + text_bigrams.len()) as f32;
+
+            let better = match best {
+                None => true,
+                Some((_, best_containment, best_dice)) => {
+                    containment > best_containment
+                        || (containment == best_containment && dice > best_dice)
+                }
+            };
+            if better {
+                best = Some((license, containment, dice));
+            }
+        }
+    }
+
+    let (license, confidence, _) = best?;
+    if confidence < MIN_CONFIDENCE {
+        log(
+            LogLevel::Info,
+            &format!("Closest license match {license} at {confidence:.2} is below the threshold"),
+        );
+        return None;
+    }
+
+    log(
+        LogLevel::Info,
+        &format!("Classified license text as {license} (confidence {confidence:.2})"),
+    );
+    Some(DetectedLicense {
+        license: license.to_string(),
+        confidence,
+    })
+}
+
+/// Classify the license files found directly in a package directory
+///
+/// NOTICE files are only consulted when there are no LICENSE or COPYING files.
+/// Several files with different licenses (e.g. `LICENSE-MIT` and `LICENSE-APACHE`)
+/// are all reported with `AND`, since the files alone don't say whether the
+/// licenses are alternatives, with the lowest confidence among them.
+pub fn detect_license_in_dir(dir: &Path) -> Option<DetectedLicense> {
+    let (license_files, notice_files) = find_license_files(dir);
+
+    let candidates = if license_files.is_empty() {
+        notice_files
+    } else {
+        license_files
+    };
+
+    let mut detected: Vec<DetectedLicense> = Vec::new();
+    for path in candidates {
+        let Ok(content) = fs::read_to_string(&path) else {
+            continue;
+        };
+        if let Some(license) = classify_license_text(&content) {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Detected {} in {} (confidence {:.2})",
+                    license.license,
+                    path.display(),
+                    license.confidence
+                ),
+            );
+            if !detected.iter().any(|d| d.license == license.license) {
+                detected.push(license);
+            }
+        }
+    }
+
+    if detected.is_empty() {
+        return None;
+    }
+
+    Some(DetectedLicense {
+        license: detected
+            .iter()
+            .map(|d| d.license.as_str())
+            .collect::<Vec<_>>()
+            .join(" AND "),
+        confidence: detected.iter().map(|d| d.confidence).fold(1.0, f32::min),
+    })
+}
+
+/// LICENSE/COPYING files and NOTICE files directly in a directory, each sorted by path
+pub fn find_license_files(dir: &Path) -> (Vec<PathBuf>, Vec<PathBuf>) {
+    let mut license_files = Vec::new();
+    let mut notice_files = Vec::new();
+
+    let Ok(entries) = fs::read_dir(dir) else {
+        return (license_files, notice_files);
+    };
+    for entry in entries.filter_map(|e| e.ok()) {
+        let path = entry.path();
+        if !path.is_file() {
+            continue;
+        }
+        let file_name = entry.file_name().to_string_lossy().to_uppercase();
+        if LICENSE_FILE_PREFIXES
+            .iter()
+            .any(|prefix| file_name.starts_with(prefix))
+        {
+            license_files.push(path);
+        } else if file_name.starts_with("NOTICE") {
+            notice_files.push(path);
+        }
+    }
+
+    license_files.sort();
+    notice_files.sort();
+    (license_files, notice_files)
+}
+
+/// Lowercase, drop copyright lines and reduce the text to plain words
+fn normalize(text: &str) -> Vec<String> {
+    text.lines()
+        .filter(|line| !line.trim_start().to_lowercase().starts_with("copyright"))
+        .flat_map(|line| {
+            line.split(|c: char| !c.is_alphanumeric())
+                .filter(|word| !word.is_empty())
+                .map(|word| word.to_lowercase())
+                .collect::<Vec<_>>()
+        })
+        .map(|word| match word.as_str() {
+            // British spelling is common in otherwise verbatim copies
+            "licence" => "license".to_string(),
+            _ => word,
+        })
+        .collect()
+}
+
+fn bigrams(words: &[String]) -> HashSet<(String, String)> {
+    words
+        .windows(2)
+        .map(|pair| (pair[0].clone(), pair[1].clone()))
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_classify_common_licenses() {
+        let mit = format!("MIT License\n\nCopyright (c) 2024 Jane Doe\n\n{MIT_TEXT}");
+        let detected = classify_license_text(&mit).unwrap();
+        assert_eq!(detected.license, "MIT");
+        assert!(detected.confidence > 0.99);
+
+        let bsd3 = format!(
+            "Copyright (c) 2020, Example Corp.\nAll rights reserved.\n{BSD_2_CLAUSES}\n{BSD_3_CLAUSE}\n{BSD_DISCLAIMER}"
+        );
+        assert_eq!(
+            classify_license_text(&bsd3).unwrap().license,
+            "BSD-3-Clause"
+        );
+
+        let bsd2 = format!("{BSD_2_CLAUSES}\n{BSD_DISCLAIMER}");
+        assert_eq!(
+            classify_license_text(&bsd2).unwrap().license,
+            "BSD-2-Clause"
+        );
+    }
+
+    #[test]
+    fn test_classify_contained_licenses_and_notices() {
+        let isc = format!(
+            "ISC License\n\nPermission to use, copy, modify, and/or distribute this software for any purpose with or without fee is hereby granted, provided that the above copyright notice and this permission notice appear in all copies.\n\n{ISC_DISCLAIMER}"
+        );
+        assert_eq!(classify_license_text(&isc).unwrap().license, "ISC");
+
+        let apache_header = format!("Copyright 2023 The Authors\n\n{APACHE_2_NOTICE}");
+        assert_eq!(
+            classify_license_text(&apache_header).unwrap().license,
+            "Apache-2.0"
+        );
+
+        let agpl = format!("{AGPL_3_TEXT}\n\n{GPL_VERBATIM}\n\n0. Definitions.");
+        assert_eq!(classify_license_text(&agpl).unwrap().license, "AGPL-3.0");
+    }
+
+    #[test]
+    fn test_classify_rejects_unrelated_text() {
+        assert_eq!(classify_license_text(""), None);
+        assert_eq!(
+            classify_license_text("This project is dedicated to my cat. All rights reserved."),
+            None
+        );
+        // Heavily edited text falls below the threshold
+        assert_eq!(
+            classify_license_text("Permission is hereby granted, free of charge, to any person."),
+            None
+        );
+    }
+
+    #[test]
+    fn test_classify_custom_licenses() {
+        let acme = crate::config::CustomLicense {
+            text: Some(
+                "This software is the confidential property of ACME Corp. It may only be used by employees and contractors of ACME Corp. for internal purposes and must not be distributed to third parties.".to_string(),
+            ),
+            ..Default::default()
+        };
+        let patterned = crate::config::CustomLicense {
+            patterns: vec!["(?i)initech proprietary".to_string()],
+            ..Default::default()
+        };
+        let custom = vec![
+            CustomMatcher::new("LicenseRef-ACME-Internal", &acme),
+            CustomMatcher::new("LicenseRef-Initech", &patterned),
+        ];
+
+        let text = format!(
+            "Copyright (c) 2024 ACME Corp.\n{}\nQuestions: legal@acme.example",
+            acme.text.as_deref().unwrap()
+        );
+        let detected = classify_with_custom_licenses(&text, &custom).unwrap();
+        assert_eq!(detected.license, "LicenseRef-ACME-Internal");
+        assert!(detected.confidence > 0.99);
+
+        let detected =
+            classify_with_custom_licenses("INITECH PROPRIETARY LICENSE v2", &custom).unwrap();
+        assert_eq!(detected.license, "LicenseRef-Initech");
+        assert_eq!(detected.confidence, 1.0);
+
+        let detected = classify_with_custom_licenses(MIT_TEXT, &custom).unwrap();
+        assert_eq!(detected.license, "MIT");
+    }
+
+    #[test]
+    fn test_detect_license_in_dir() {
+        let temp_dir = TempDir::new().unwrap();
+        std::fs::write(
+            temp_dir.path().join("NOTICE"),
+            "This product includes software developed by Example.",
+        )
+        .unwrap();
+        assert_eq!(detect_license_in_dir(temp_dir.path()), None);
+
+        std::fs::write(temp_dir.path().join("LICENSE-MIT"), MIT_TEXT).unwrap();
+        std::fs::write(
+            temp_dir.path().join("LICENSE-APACHE"),
+            format!("{APACHE_2_TEXT}\n...\n{APACHE_2_NOTICE}"),
+        )
+        .unwrap();
+
+        let detected = detect_license_in_dir(temp_dir.path()).unwrap();
+        assert_eq!(detected.license, "Apache-2.0 AND MIT");
+        assert!(detected.confidence >= MIN_CONFIDENCE);
+    }
+}
@@ -0,0 +1,478 @@
+//! SPDX license expression parsing
+//!
+//! Parses license fields such as `MIT OR Apache-2.0` or
+//! `GPL-2.0-only WITH Classpath-exception-2.0` into an expression tree.
+//! `WITH` binds tighter than `AND`, which binds tighter than `OR`, as described in
+//! the SPDX specification. Lowercase operators and the legacy `/` separator used by
+//! older crates are accepted as well.
+//!
+//! License fields come from package metadata anyone can publish, so parentheses
+//! may nest at most [`MAX_DEPTH`] deep and expressions with more than
+//! [`MAX_ALTERNATIVES`] alternatives aren't expanded.
+
+use std::fmt;
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+
+/// Deepest nesting of parentheses the parser accepts
+pub const MAX_DEPTH: usize = 16;
+
+/// Most alternatives [`LicenseExpression::alternatives`] expands an expression into
+pub const MAX_ALTERNATIVES: usize = 256;
+
+/// A single license, optionally with an exception attached
+#[derive(Debug, Clone, PartialEq, Eq, Hash)]
+pub struct LicenseTerm {
+    /// SPDX identifier or `LicenseRef-` reference, without a trailing `+`
+    pub id: String,
+    /// Whether the identifier ended in `+` ("or any later version")
+    pub or_later: bool,
+    /// Exception from a `WITH` clause
+    pub exception: Option<String>,
+}
+
+impl LicenseTerm {
+    /// The license identifier without any exception, e.g. `GPL-2.0+`
+    pub fn license_id(&self) -> String {
+        if self.or_later {
+            format!("{}+", self.id)
+        } else {
+            self.id.clone()
+        }
+    }
+}
+
+impl fmt::Display for LicenseTerm {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{}", self.license_id())?;
+        if let Some(exception) = &self.exception {
+            write!(f, " WITH {exception}")?;
+        }
+        Ok(())
+    }
+}
+
+/// A parsed SPDX license expression
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum LicenseExpression {
+    License(LicenseTerm),
+    And(Vec<LicenseExpression>),
+    Or(Vec<LicenseExpression>),
+}
+
+impl LicenseExpression {
+    pub fn parse(input: &str) -> FeludaResult<Self> {
+        let tokens = tokenize(input)?;
+        if tokens.is_empty() {
+            return Err(FeludaError::Parser("Empty license expression".to_string()));
+        }
+
+        let mut parser = ExpressionParser {
+            tokens,
+            pos: 0,
+            depth: 0,
+        };
+        let expression = parser.parse_or()?;
+        if let Some(token) = parser.tokens.get(parser.pos) {
+            return Err(FeludaError::Parser(format!(
+                "Unexpected {token:?} in license expression: {input}"
+            )));
+        }
+        Ok(expression)
+    }
+
+    /// Expand the expression into its alternatives
+    ///
+    /// Each alternative is a set of licenses that must all be complied with, so
+    /// `MIT AND (Apache-2.0 OR BSD-3-Clause)` yields `[MIT, Apache-2.0]` and
+    /// `[MIT, BSD-3-Clause]`.
+    ///
+    /// Past [`MAX_ALTERNATIVES`] the only alternative is every license of the
+    /// expression, which a policy accepts only if it would accept each branch.
+    pub fn alternatives(&self) -> Vec<Vec<LicenseTerm>> {
+        if self.alternative_count() > MAX_ALTERNATIVES {
+            log(
+                LogLevel::Warn,
+                &format!("Not expanding {self}: more than {MAX_ALTERNATIVES} alternatives"),
+            );
+            let mut terms: Vec<LicenseTerm> = Vec::new();
+            for term in self.terms() {
+                if !terms.contains(term) {
+                    terms.push(term.clone());
+                }
+            }
+            return vec![terms];
+        }
+        self.expand()
+    }
+
+    /// How many alternatives [`Self::expand`] yields, saturating
+    fn alternative_count(&self) -> usize {
+        match self {
+            LicenseExpression::License(_) => 1,
+            LicenseExpression::Or(operands) => operands
+                .iter()
+                .fold(0, |count, op| count.saturating_add(op.alternative_count())),
+            LicenseExpression::And(operands) => operands
+                .iter()
+                .fold(1, |count, op| count.saturating_mul(op.alternative_count())),
+        }
+    }
+
+    fn expand(&self) -> Vec<Vec<LicenseTerm>> {
+        match self {
+            LicenseExpression::License(term) => vec![vec![term.clone()]],
+            LicenseExpression::Or(operands) => operands.iter().flat_map(|op| op.expand()).collect(),
+            LicenseExpression::And(operands) => {
+                operands.iter().fold(vec![Vec::new()], |acc, op| {
+                    let op_alternatives = op.expand();
+                    acc.iter()
+                        .flat_map(|prefix| {
+                            op_alternatives.iter().map(move |alternative| {
+                                let mut combined = prefix.clone();
+                                combined.extend(alternative.iter().cloned());
+                                combined
+                            })
+                        })
+                        .collect()
+                })
+            }
+        }
+    }
+
+    /// All licenses mentioned anywhere in the expression
+    pub fn terms(&self) -> Vec<&LicenseTerm> {
+        match self {
+            LicenseExpression::License(term) => vec![term],
+            LicenseExpression::And(operands) | LicenseExpression::Or(operands) => {
+                operands.iter().flat_map(|op| op.terms()).collect()
+            }
+        }
+    }
+}
+
+impl fmt::Display for LicenseExpression {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let write_operands =
+            |f: &mut fmt::Formatter<'_>, operands: &[LicenseExpression], op: &str| {
+                for (i, operand) in operands.iter().enumerate() {
+                    if i > 0 {
+                        write!(f, " {op} ")?;
+                    }
+                    // AND binds tighter than OR, so only OR needs parentheses inside AND
+                    match operand {
+                        LicenseExpression::Or(_) if op == "AND" => write!(f, "({operand})")?,
+                        _ => write!(f, "{operand}")?,
+                    }
+                }
+                Ok(())
+            };
+
+        match self {
+            LicenseExpression::License(term) => write!(f, "{term}"),
+            LicenseExpression::And(operands) => write_operands(f, operands, "AND"),
+            LicenseExpression::Or(operands) => write_operands(f, operands, "OR"),
+        }
+    }
+}
+
+#[derive(Debug, Clone, PartialEq)]
+enum Token {
+    Id(String),
+    And,
+    Or,
+    With,
+    Open,
+    Close,
+}
+
+fn tokenize(input: &str) -> FeludaResult<Vec<Token>> {
+    let mut tokens = Vec::new();
+    let mut chars = input.chars().peekable();
+
+    while let Some(&ch) = chars.peek() {
+        match ch {
+            c if c.is_whitespace() => {
+                chars.next();
+            }
+            '(' => {
+                chars.next();
+                tokens.push(Token::Open);
+            }
+            ')' => {
+                chars.next();
+                tokens.push(Token::Close);
+            }
+            '/' => {
+                chars.next();
+                tokens.push(Token::Or);
+            }
+            _ => {
+                let mut word = String::new();
+                while let Some(&c) = chars.peek() {
+                    if c.is_whitespace() || matches!(c, '(' | ')' | '/') {
+                        break;
+                    }
+                    word.push(c);
+                    chars.next();
+                }
+
+                let token = match word.to_uppercase().as_str() {
+                    "AND" => Token::And,
+                    "OR" => Token::Or,
+                    "WITH" => Token::With,
+                    _ if word.chars().all(|c| {
+                        c.is_ascii_alphanumeric() || matches!(c, '-' | '.' | '+' | ':')
+                    }) =>
+                    {
+                        Token::Id(word)
+                    }
+                    _ => {
+                        return Err(FeludaError::Parser(format!(
+                            "Invalid license identifier '{word}' in: {input}"
+                        )))
+                    }
+                };
+                tokens.push(token);
+            }
+        }
+    }
+
+    Ok(tokens)
+}
+
+struct ExpressionParser {
+    tokens: Vec<Token>,
+    pos: usize,
+    /// Parentheses open at `pos`
+    depth: usize,
+}
+
+impl ExpressionParser {
+    fn peek(&self) -> Option<&Token> {
+        self.tokens.get(self.pos)
+    }
+
+    fn next(&mut self) -> Option<Token> {
+        let token = self.tokens.get(self.pos).cloned();
+        self.pos += 1;
+        token
+    }
+
+    fn parse_or(&mut self) -> FeludaResult<LicenseExpression> {
+        let mut operands = Vec::new();
+        loop {
+            // Parenthesized ORs inside an OR are merged: (A OR B) OR C
+            match self.parse_and()? {
+                LicenseExpression::Or(inner) => operands.extend(inner),
+                operand => operands.push(operand),
+            }
+            if self.peek() != Some(&Token::Or) {
+                break;
+            }
+            self.next();
+        }
+        Ok(combine(operands, LicenseExpression::Or))
+    }
+
+    fn parse_and(&mut self) -> FeludaResult<LicenseExpression> {
+        let mut operands = Vec::new();
+        loop {
+            match self.parse_primary()? {
+                LicenseExpression::And(inner) => operands.extend(inner),
+                operand => operands.push(operand),
+            }
+            if self.peek() != Some(&Token::And) {
+                break;
+            }
+            self.next();
+        }
+        Ok(combine(operands, LicenseExpression::And))
+    }
+
+    fn parse_primary(&mut self) -> FeludaResult<LicenseExpression> {
+        match self.next() {
+            Some(Token::Open) => {
+                self.depth += 1;
+                if self.depth > MAX_DEPTH {
+                    return Err(FeludaError::Parser(format!(
+                        "License expression nested more than {MAX_DEPTH} parentheses deep"
+                    )));
+                }
+                let expression = self.parse_or()?;
+                self.depth -= 1;
+                match self.next() {
+                    Some(Token::Close) => Ok(expression),
+                    _ => Err(FeludaError::Parser(
+                        "Missing closing parenthesis in license expression".to_string(),
+                    )),
+                }
+            }
+            Some(Token::Id(id)) => {
+                let (id, or_later) = match id.strip_suffix('+') {
+                    Some(base) => (base.to_string(), true),
+                    None => (id, false),
+                };
+
+                let exception = if self.peek() == Some(&Token::With) {
+                    self.next();
+                    match self.next() {
+                        Some(Token::Id(exception)) => Some(exception),
+                        _ => {
+                            return Err(FeludaError::Parser(format!(
+                                "Expected an exception after '{id} WITH'"
+                            )))
+                        }
+                    }
+                } else {
+                    None
+                };
+
+                Ok(LicenseExpression::License(LicenseTerm {
+                    id,
+                    or_later,
+                    exception,
+                }))
+            }
+            other => Err(FeludaError::Parser(format!(
+                "Expected a license identifier, found {other:?}"
+            ))),
+        }
+    }
+}
+
+/// Wrap operands in an operator unless there is only one
+fn combine(
+    mut operands: Vec<LicenseExpression>,
+    operator: fn(Vec<LicenseExpression>) -> LicenseExpression,
+) -> LicenseExpression {
+    match operands.len() {
+        1 => operands.remove(0),
+        _ => operator(operands),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn term(id: &str) -> LicenseTerm {
+        LicenseTerm {
+            id: id.to_string(),
+            or_later: false,
+            exception: None,
+        }
+    }
+
+    #[test]
+    fn test_parse_simple_and_compound_expressions() {
+        assert_eq!(
+            LicenseExpression::parse("MIT").unwrap(),
+            LicenseExpression::License(term("MIT"))
+        );
+
+        let expression = LicenseExpression::parse("MIT OR Apache-2.0 OR BSD-3-Clause").unwrap();
+        assert_eq!(
+            expression,
+            LicenseExpression::Or(vec![
+                LicenseExpression::License(term("MIT")),
+                LicenseExpression::License(term("Apache-2.0")),
+                LicenseExpression::License(term("BSD-3-Clause")),
+            ])
+        );
+
+        // AND binds tighter than OR
+        let expression = LicenseExpression::parse("MIT AND Zlib OR Apache-2.0").unwrap();
+        assert_eq!(expression.to_string(), "MIT AND Zlib OR Apache-2.0");
+        assert_eq!(
+            expression.alternatives(),
+            vec![vec![term("MIT"), term("Zlib")], vec![term("Apache-2.0")]]
+        );
+    }
+
+    #[test]
+    fn test_parse_with_exception_and_or_later() {
+        let expression =
+            LicenseExpression::parse("GPL-2.0-only WITH Classpath-exception-2.0").unwrap();
+        let LicenseExpression::License(license) = &expression else {
+            panic!("expected a single license");
+        };
+        assert_eq!(license.id, "GPL-2.0-only");
+        assert_eq!(
+            license.exception.as_deref(),
+            Some("Classpath-exception-2.0")
+        );
+        assert_eq!(
+            expression.to_string(),
+            "GPL-2.0-only WITH Classpath-exception-2.0"
+        );
+
+        let expression = LicenseExpression::parse("LGPL-2.1+").unwrap();
+        assert_eq!(expression.terms()[0].license_id(), "LGPL-2.1+");
+        assert!(expression.terms()[0].or_later);
+    }
+
+    #[test]
+    fn test_alternatives_distribute_over_and() {
+        let expression =
+            LicenseExpression::parse("(MIT OR Apache-2.0) AND (BSD-2-Clause OR ISC)").unwrap();
+        assert_eq!(expression.alternatives().len(), 4);
+        assert_eq!(
+            expression.to_string(),
+            "(MIT OR Apache-2.0) AND (BSD-2-Clause OR ISC)"
+        );
+    }
+
+    #[test]
+    fn test_legacy_and_lowercase_syntax() {
+        let expected = LicenseExpression::Or(vec![
+            LicenseExpression::License(term("MIT")),
+            LicenseExpression::License(term("Apache-2.0")),
+        ]);
+        assert_eq!(
+            LicenseExpression::parse("MIT/Apache-2.0").unwrap(),
+            expected
+        );
+        assert_eq!(
+            LicenseExpression::parse("MIT or Apache-2.0").unwrap(),
+            expected
+        );
+    }
+
+    #[test]
+    fn test_parse_errors() {
+        assert!(LicenseExpression::parse("").is_err());
+        assert!(LicenseExpression::parse("MIT OR").is_err());
+        assert!(LicenseExpression::parse("(MIT").is_err());
+        assert!(LicenseExpression::parse("GPL-2.0 WITH").is_err());
+        assert!(LicenseExpression::parse("Apache License, Version 2.0").is_err());
+    }
+
+    #[test]
+    fn test_nesting_limit() {
+        let nested = |depth: usize| format!("{}MIT{}", "(".repeat(depth), ")".repeat(depth));
+        assert!(LicenseExpression::parse(&nested(MAX_DEPTH)).is_ok());
+        assert!(LicenseExpression::parse(&nested(MAX_DEPTH + 1)).is_err());
+        // Deep enough to overflow the stack without the limit
+        assert!(LicenseExpression::parse(&nested(100_000)).is_err());
+    }
+
+    #[test]
+    fn test_alternatives_limit() {
+        // 2^8 alternatives are expanded, 2^40 are not
+        let product = |factors: usize| {
+            (0..factors)
+                .map(|i| format!("(A{i} OR B{i})"))
+                .collect::<Vec<_>>()
+                .join(" AND ")
+        };
+        let expression = LicenseExpression::parse(&product(8)).unwrap();
+        assert_eq!(expression.alternatives().len(), MAX_ALTERNATIVES);
+
+        let expression = LicenseExpression::parse(&format!("{} AND A0", product(40))).unwrap();
+        let alternatives = expression.alternatives();
+        assert_eq!(alternatives.len(), 1);
+        assert_eq!(alternatives[0].len(), 80);
+        assert_eq!(alternatives[0][0], term("A0"));
+    }
+}
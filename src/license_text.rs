@@ -0,0 +1,573 @@
+//! Full license texts (`feluda license-text`)
+//!
+//! An SPDX identifier is looked up in the SPDX license list. For
+//! `package@version` the texts shipped with the installed package are used
+//! (`node_modules`, the cargo registry, the Go module cache), and otherwise
+//! fetched from the package's registry or repository, as for attribution
+//! files. Texts are cached under the user cache directory; a published version
+//! doesn't change its license text, so entries only go away with
+//! `feluda cache --clear` and are fetched again with `--refresh`.
+//!
+//! SPDX texts are also bundled for air-gapped use: builds with the
+//! `embedded-license-texts` feature carry the whole license list, and the
+//! license database written by `feluda db download` includes it. Attribution
+//! files fall back to these standard texts for packages that ship none.
+
+use rayon::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::attributions::{local_package_dir, read_files};
+use crate::cache::{self, cache_dir_path};
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::generate::fetch_actual_license_content;
+use crate::license_detector::find_license_files;
+use crate::license_expression::LicenseExpression;
+use crate::registry::{self, Registry};
+use crate::sbom::ingest::parse_purl;
+
+const LICENSE_TEXTS_DIR: &str = "license-texts";
+const SPDX_LICENSE_LIST_DATA: &str =
+    "https://raw.githubusercontent.com/spdx/license-list-data/main";
+
+/// The pack written by `feluda db texts`, copied in by `build.rs`
+#[cfg(feature = "embedded-license-texts")]
+const EMBEDDED_LICENSE_TEXTS: &str = include_str!(concat!(env!("OUT_DIR"), "/license-texts.json"));
+
+/// The texts of the SPDX license list
+#[derive(Serialize, Deserialize, Debug, Default, Clone, PartialEq)]
+pub struct LicenseTextPack {
+    /// Version of the SPDX license list, e.g. `3.25`
+    #[serde(default)]
+    pub license_list_version: String,
+    /// License and exception texts keyed by SPDX identifier
+    #[serde(default)]
+    pub texts: BTreeMap<String, String>,
+}
+
+impl LicenseTextPack {
+    pub fn is_empty(&self) -> bool {
+        self.texts.is_empty()
+    }
+
+    /// Text of `id`, matched regardless of case
+    pub fn get(&self, id: &str) -> Option<&str> {
+        self.texts
+            .get(id)
+            .or_else(|| {
+                self.texts
+                    .iter()
+                    .find(|(key, _)| key.eq_ignore_ascii_case(id))
+                    .map(|(_, text)| text)
+            })
+            .map(String::as_str)
+    }
+
+    pub fn save(&self, path: &Path) -> FeludaResult<()> {
+        let content = serde_json::to_string(self).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize license texts: {e}"))
+        })?;
+        fs::write(path, content).map_err(|e| {
+            FeludaError::FileWrite(format!(
+                "Failed to write license texts {}: {e}",
+                path.display()
+            ))
+        })
+    }
+}
+
+/// The texts compiled in with the `embedded-license-texts` feature, if any
+pub fn embedded_license_texts() -> Option<&'static LicenseTextPack> {
+    #[cfg(feature = "embedded-license-texts")]
+    {
+        static EMBEDDED: std::sync::OnceLock<LicenseTextPack> = std::sync::OnceLock::new();
+        let pack = EMBEDDED
+            .get_or_init(|| serde_json::from_str(EMBEDDED_LICENSE_TEXTS).unwrap_or_default());
+        if !pack.is_empty() {
+            return Some(pack);
+        }
+    }
+    None
+}
+
+/// What to print the license text of
+#[derive(Debug, Clone, PartialEq)]
+pub enum LicenseTextTarget {
+    /// An SPDX license identifier such as `Apache-2.0`
+    License(String),
+    /// A dependency, e.g. `serde@1.0.200` or `@babel/core@7.24.0`
+    Package { name: String, version: String },
+}
+
+impl LicenseTextTarget {
+    /// Parse `<spdx-id>`, `<package>@<version>` or a package URL
+    pub fn parse(input: &str) -> FeludaResult<Self> {
+        let input = input.trim();
+        if input.is_empty() {
+            return Err(FeludaError::InvalidData(
+                "Specify an SPDX license identifier or <package>@<version>".to_string(),
+            ));
+        }
+        if input.starts_with("pkg:") {
+            let purl = parse_purl(input)
+                .ok_or_else(|| FeludaError::InvalidData(format!("Invalid package URL {input}")))?;
+            let version = purl.version.clone().ok_or_else(|| {
+                FeludaError::InvalidData(format!(
+                    "Missing version in '{input}', use {input}@<version>"
+                ))
+            })?;
+            return Ok(LicenseTextTarget::Package {
+                name: purl.package_name(),
+                version,
+            });
+        }
+
+        match input.rsplit_once('@') {
+            Some((name, version)) if !name.is_empty() && !version.is_empty() => {
+                Ok(LicenseTextTarget::Package {
+                    name: name.to_string(),
+                    version: version.to_string(),
+                })
+            }
+            Some(_) => Err(FeludaError::InvalidData(format!(
+                "Missing version in '{input}', use <package>@<version>"
+            ))),
+            None => Ok(LicenseTextTarget::License(input.to_string())),
+        }
+    }
+
+    /// File name of the cached text
+    fn cache_file_name(&self) -> String {
+        let key = match self {
+            LicenseTextTarget::License(id) => format!("spdx-{id}"),
+            LicenseTextTarget::Package { name, version } => format!("pkg-{name}@{version}"),
+        };
+        let sanitized: String = key
+            .chars()
+            .map(|c| {
+                if c.is_ascii_alphanumeric() || matches!(c, '.' | '-' | '_' | '+' | '@') {
+                    c
+                } else {
+                    '_'
+                }
+            })
+            .collect();
+        format!("{sanitized}.txt")
+    }
+}
+
+/// A license text and where it came from
+#[derive(Debug, Clone, PartialEq)]
+pub struct LicenseText {
+    pub text: String,
+    /// File, URL or `cache` the text was read from
+    pub source: String,
+}
+
+fn cache_path(target: &LicenseTextTarget) -> FeludaResult<PathBuf> {
+    Ok(cache_dir_path()?
+        .join(LICENSE_TEXTS_DIR)
+        .join(target.cache_file_name()))
+}
+
+fn read_cached(target: &LicenseTextTarget) -> Option<String> {
+    if cache::is_refresh() && !crate::offline::is_offline() {
+        return None;
+    }
+    fs::read_to_string(cache_path(target).ok()?).ok()
+}
+
+fn write_cached(target: &LicenseTextTarget, text: &str) {
+    let result = cache_path(target).and_then(|path| {
+        if let Some(dir) = path.parent() {
+            fs::create_dir_all(dir)?;
+        }
+        fs::write(&path, text)?;
+        Ok(path)
+    });
+    match result {
+        Ok(path) => log(
+            LogLevel::Info,
+            &format!("Cached license text at {}", path.display()),
+        ),
+        Err(err) => log_error("Failed to cache license text", &err),
+    }
+}
+
+/// Delete all cached license texts
+pub fn clear_license_text_cache() -> FeludaResult<()> {
+    let dir = cache_dir_path()?.join(LICENSE_TEXTS_DIR);
+    if dir.exists() {
+        fs::remove_dir_all(&dir)
+            .inspect_err(|e| log_error("Failed to clear license text cache", e))?;
+        log(LogLevel::Info, "Cleared license text cache");
+    }
+    Ok(())
+}
+
+#[derive(Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct SpdxLicenseList {
+    #[serde(default)]
+    license_list_version: String,
+    licenses: Vec<SpdxLicenseEntry>,
+}
+
+#[derive(Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct SpdxLicenseEntry {
+    license_id: String,
+}
+
+#[derive(Deserialize)]
+struct SpdxExceptionList {
+    exceptions: Vec<SpdxExceptionEntry>,
+}
+
+#[derive(Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct SpdxExceptionEntry {
+    license_exception_id: String,
+}
+
+fn get_text(url: &str) -> Option<String> {
+    log(LogLevel::Info, &format!("Fetching license text: {url}"));
+    match registry::get(Registry::GitHub, url) {
+        Ok(response) if response.status().is_success() => response.text().ok(),
+        Ok(response) => {
+            log(
+                LogLevel::Warn,
+                &format!("{url} returned {}", response.status()),
+            );
+            None
+        }
+        Err(err) => {
+            log_error(&format!("Failed to fetch {url}"), &err);
+            None
+        }
+    }
+}
+
+/// Identifier in the SPDX license list matching `id` regardless of case
+fn canonical_spdx_id(id: &str) -> Option<String> {
+    let list = get_text(&format!("{SPDX_LICENSE_LIST_DATA}/json/licenses.json"))?;
+    let list: SpdxLicenseList = serde_json::from_str(&list).ok()?;
+    list.licenses
+        .into_iter()
+        .map(|entry| entry.license_id)
+        .find(|license_id| license_id.eq_ignore_ascii_case(id))
+}
+
+fn fetch_spdx_text(id: &str) -> Option<LicenseText> {
+    let fetch = |id: &str| {
+        let url = format!("{SPDX_LICENSE_LIST_DATA}/text/{id}.txt");
+        get_text(&url).map(|text| LicenseText { text, source: url })
+    };
+    fetch(id).or_else(|| {
+        let canonical = canonical_spdx_id(id).filter(|canonical| canonical != id)?;
+        fetch(&canonical)
+    })
+}
+
+/// Download the texts of every license and exception in the SPDX license list
+pub fn fetch_license_text_pack() -> FeludaResult<LicenseTextPack> {
+    let list = get_text(&format!("{SPDX_LICENSE_LIST_DATA}/json/licenses.json"))
+        .ok_or_else(|| FeludaError::License("Failed to fetch the SPDX license list".to_string()))?;
+    let list: SpdxLicenseList = serde_json::from_str(&list)
+        .map_err(|e| FeludaError::Parser(format!("Invalid SPDX license list: {e}")))?;
+    let exceptions = get_text(&format!("{SPDX_LICENSE_LIST_DATA}/json/exceptions.json"))
+        .and_then(|content| serde_json::from_str::<SpdxExceptionList>(&content).ok())
+        .map(|list| list.exceptions)
+        .unwrap_or_default();
+
+    let ids: Vec<String> = list
+        .licenses
+        .into_iter()
+        .map(|entry| entry.license_id)
+        .chain(
+            exceptions
+                .into_iter()
+                .map(|entry| entry.license_exception_id),
+        )
+        .collect();
+    let texts: BTreeMap<String, String> = ids
+        .par_iter()
+        .filter_map(|id| {
+            get_text(&format!("{SPDX_LICENSE_LIST_DATA}/text/{id}.txt"))
+                .map(|text| (id.clone(), text))
+        })
+        .collect();
+    if texts.len() < ids.len() {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Fetched {} of {} SPDX license texts",
+                texts.len(),
+                ids.len()
+            ),
+        );
+    }
+
+    Ok(LicenseTextPack {
+        license_list_version: list.license_list_version,
+        texts,
+    })
+}
+
+/// Text of an SPDX license or exception bundled with Feluda or the license database
+fn bundled_spdx_text(id: &str) -> Option<LicenseText> {
+    if let Some(text) = embedded_license_texts().and_then(|pack| pack.get(id)) {
+        return Some(LicenseText {
+            text: text.to_string(),
+            source: "embedded SPDX license list".to_string(),
+        });
+    }
+    let text = crate::offline::license_db()?.license_texts.get(id)?;
+    Some(LicenseText {
+        text: text.to_string(),
+        source: "license database".to_string(),
+    })
+}
+
+/// Whether `id` is on the bundled SPDX license list, `None` when no list is bundled
+pub fn is_bundled_spdx_id(id: &str) -> Option<bool> {
+    let pack = embedded_license_texts().or_else(|| {
+        crate::offline::license_db()
+            .map(|db| &db.license_texts)
+            .filter(|pack| !pack.is_empty())
+    })?;
+    Some(pack.get(id).is_some())
+}
+
+/// Standard text of an SPDX license or exception, fetched from the license list when not bundled
+pub fn spdx_license_text(id: &str) -> Option<LicenseText> {
+    if id.starts_with("LicenseRef-") {
+        return None;
+    }
+    bundled_spdx_text(id).or_else(|| {
+        if crate::offline::is_offline() {
+            return None;
+        }
+        fetch_spdx_text(id)
+    })
+}
+
+/// Standard texts of all licenses and exceptions in a license expression
+///
+/// `None` unless every text is found, so a partial text never passes for the whole.
+pub fn expression_license_text(expression: &str) -> Option<String> {
+    let expression = LicenseExpression::parse(expression).ok()?;
+    let mut ids: Vec<String> = Vec::new();
+    for term in expression.terms() {
+        for id in std::iter::once(term.license_id()).chain(term.exception.clone()) {
+            if !ids.contains(&id) {
+                ids.push(id);
+            }
+        }
+    }
+
+    let texts = ids
+        .iter()
+        .map(|id| spdx_license_text(id).map(|found| found.text.trim_end().to_string()))
+        .collect::<Option<Vec<_>>>()?;
+    Some(texts.join("\n\n"))
+}
+
+/// Whether an installed package directory holds `version`, when its manifest says
+fn is_installed_version(dir: &Path, version: &str) -> bool {
+    fs::read_to_string(dir.join("package.json"))
+        .ok()
+        .and_then(|content| serde_json::from_str::<serde_json::Value>(&content).ok())
+        .and_then(|manifest| manifest["version"].as_str().map(|v| v == version))
+        .unwrap_or(true)
+}
+
+fn find_package_text(project_root: &Path, name: &str, version: &str) -> Option<LicenseText> {
+    let installed = local_package_dir(project_root, name, version)
+        .filter(|dir| is_installed_version(dir, version));
+    if let Some(dir) = installed {
+        let (license_files, _) = find_license_files(&dir);
+        if let Some(text) = read_files(&license_files) {
+            return Some(LicenseText {
+                text,
+                source: dir.display().to_string(),
+            });
+        }
+    }
+    fetch_actual_license_content(name, version).map(|text| LicenseText {
+        text,
+        source: "package registry".to_string(),
+    })
+}
+
+/// Look up the full license text of `target`
+///
+/// Installed packages are searched for below `project_root`.
+pub fn license_text(target: &LicenseTextTarget, project_root: &Path) -> FeludaResult<LicenseText> {
+    if let LicenseTextTarget::License(id) = target {
+        if let Some(found) = bundled_spdx_text(id) {
+            return Ok(found);
+        }
+    }
+    if let Some(text) = read_cached(target) {
+        return Ok(LicenseText {
+            text,
+            source: "cache".to_string(),
+        });
+    }
+
+    let found = match target {
+        LicenseTextTarget::License(id) => fetch_spdx_text(id),
+        LicenseTextTarget::Package { name, version } => {
+            find_package_text(project_root, name, version)
+        }
+    };
+
+    let found = found.ok_or_else(|| {
+        FeludaError::License(match target {
+            LicenseTextTarget::License(id) => format!(
+                "No license text found for '{id}'. Use an SPDX identifier, or <package>@<version> for a dependency"
+            ),
+            LicenseTextTarget::Package { name, version } => {
+                format!("No license text found for {name}@{version}")
+            }
+        })
+    })?;
+    write_cached(target, &found.text);
+    Ok(found)
+}
+
+/// Entry point for the license-text command
+pub fn handle_license_text_command(
+    target: String,
+    path: String,
+    output: Option<String>,
+) -> FeludaResult<()> {
+    let target = LicenseTextTarget::parse(&target)?;
+    log(
+        LogLevel::Info,
+        &format!("Looking up license text for {target:?}"),
+    );
+
+    let found = license_text(&target, Path::new(&path))?;
+    log(
+        LogLevel::Info,
+        &format!("License text read from {}", found.source),
+    );
+
+    match output {
+        Some(file) => fs::write(&file, &found.text)
+            .map_err(|e| FeludaError::FileWrite(format!("Failed to write {file}: {e}")))?,
+        None => println!("{}", found.text.trim_end()),
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_parse_target() {
+        assert_eq!(
+            LicenseTextTarget::parse("Apache-2.0").unwrap(),
+            LicenseTextTarget::License("Apache-2.0".to_string())
+        );
+        assert_eq!(
+            LicenseTextTarget::parse("serde@1.0.200").unwrap(),
+            LicenseTextTarget::Package {
+                name: "serde".to_string(),
+                version: "1.0.200".to_string()
+            }
+        );
+        assert_eq!(
+            LicenseTextTarget::parse("@babel/core@7.24.0").unwrap(),
+            LicenseTextTarget::Package {
+                name: "@babel/core".to_string(),
+                version: "7.24.0".to_string()
+            }
+        );
+        assert_eq!(
+            LicenseTextTarget::parse("pkg:npm/%40babel/core@7.24.0").unwrap(),
+            LicenseTextTarget::Package {
+                name: "@babel/core".to_string(),
+                version: "7.24.0".to_string()
+            }
+        );
+        assert!(LicenseTextTarget::parse("pkg:npm/lodash").is_err());
+        assert!(LicenseTextTarget::parse("@babel/core").is_err());
+        assert!(LicenseTextTarget::parse("express@").is_err());
+        assert!(LicenseTextTarget::parse(" ").is_err());
+    }
+
+    #[test]
+    fn test_cache_file_name() {
+        assert_eq!(
+            LicenseTextTarget::License("GPL-2.0+".to_string()).cache_file_name(),
+            "spdx-GPL-2.0+.txt"
+        );
+        assert_eq!(
+            LicenseTextTarget::parse("@babel/core@7.24.0")
+                .unwrap()
+                .cache_file_name(),
+            "pkg-@babel_core@7.24.0.txt"
+        );
+        assert_eq!(
+            LicenseTextTarget::parse("../../etc/passwd@1")
+                .unwrap()
+                .cache_file_name(),
+            "pkg-.._.._etc_passwd@1.txt"
+        );
+    }
+
+    #[test]
+    fn test_license_text_pack() {
+        let temp_dir = TempDir::new().unwrap();
+        let pack = LicenseTextPack {
+            license_list_version: "3.25".to_string(),
+            texts: BTreeMap::from([
+                ("MIT".to_string(), "MIT License".to_string()),
+                ("Apache-2.0".to_string(), "Apache License".to_string()),
+            ]),
+        };
+        let path = temp_dir.path().join("license-texts.json");
+        pack.save(&path).unwrap();
+        let loaded: LicenseTextPack =
+            serde_json::from_str(&fs::read_to_string(&path).unwrap()).unwrap();
+        assert_eq!(loaded, pack);
+
+        assert_eq!(loaded.get("MIT"), Some("MIT License"));
+        assert_eq!(loaded.get("apache-2.0"), Some("Apache License"));
+        assert_eq!(loaded.get("GPL-3.0"), None);
+        assert!(LicenseTextPack::default().is_empty());
+
+        // Custom licenses have no standard text to fall back on
+        assert_eq!(spdx_license_text("LicenseRef-Proprietary"), None);
+        assert_eq!(
+            expression_license_text("LicenseRef-Proprietary OR MIT"),
+            None
+        );
+    }
+
+    #[test]
+    fn test_installed_package_text() {
+        let temp_dir = TempDir::new().unwrap();
+        let package_dir = temp_dir.path().join("node_modules/left-pad");
+        fs::create_dir_all(&package_dir).unwrap();
+        fs::write(
+            package_dir.join("package.json"),
+            r#"{"name": "left-pad", "version": "1.3.0"}"#,
+        )
+        .unwrap();
+        fs::write(package_dir.join("LICENSE"), "WTFPL text\n").unwrap();
+
+        let found = find_package_text(temp_dir.path(), "left-pad", "1.3.0").unwrap();
+        assert_eq!(found.text, "WTFPL text");
+        assert_eq!(found.source, package_dir.display().to_string());
+
+        assert!(!is_installed_version(&package_dir, "1.1.0"));
+    }
+}
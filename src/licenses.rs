@@ -2,7 +2,7 @@
 
 use serde::{Deserialize, Serialize};
 use serde_json::Value;
-use std::collections::HashMap;
+use std::collections::{BTreeMap, HashMap};
 use std::fs;
 use std::path::Path;
 use std::sync::Arc;
@@ -15,6 +15,7 @@ use crate::cache;
 use crate::cli;
 use crate::config;
 use crate::debug::{log, log_debug, log_error, FeludaResult, LogLevel};
+use crate::offline;
 
 static GITHUB_TOKEN: OnceLock<Option<String>> = OnceLock::new();
 
@@ -24,15 +25,16 @@ pub fn set_github_token(token: Option<String>) {
 }
 
 /// Get the GitHub API token if set
-fn get_github_token() -> Option<&'static str> {
+pub(crate) fn get_github_token() -> Option<&'static str> {
     GITHUB_TOKEN.get().and_then(|t| t.as_deref())
 }
 
 /// License compatibility enum
-#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
 pub enum LicenseCompatibility {
     Compatible,
     Incompatible,
+    #[default]
     Unknown,
 }
 
@@ -89,10 +91,11 @@ struct LicenseEntry {
 static COMPATIBILITY_MATRIX: OnceLock<HashMap<String, Vec<String>>> = OnceLock::new();
 
 /// OSI license status
-#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
 pub enum OsiStatus {
     Approved,
     NotApproved,
+    #[default]
     Unknown,
 }
 
@@ -106,6 +109,54 @@ impl std::fmt::Display for OsiStatus {
     }
 }
 
+/// Where a dependency is needed, from the manifest section or scope declaring it
+///
+/// Only runtime dependencies ship with the product; the others can be left out
+/// of the scan (`--scope`, `--exclude-dev`) or of the license policy.
+#[derive(
+    Debug,
+    Clone,
+    Copy,
+    Default,
+    PartialEq,
+    Eq,
+    PartialOrd,
+    Ord,
+    Hash,
+    Serialize,
+    Deserialize,
+    clap::ValueEnum,
+)]
+#[serde(rename_all = "lowercase")]
+pub enum DependencyScope {
+    /// Needed when the product runs
+    #[default]
+    Runtime,
+    /// Only needed to build the product, e.g. Cargo `build-dependencies`
+    Build,
+    /// Only needed to run the tests, e.g. Maven `test` scope or Go test imports
+    Test,
+    /// Only needed for development, e.g. npm `devDependencies` or Composer `require-dev`
+    Dev,
+}
+
+impl DependencyScope {
+    pub fn is_runtime(&self) -> bool {
+        *self == Self::Runtime
+    }
+}
+
+impl std::fmt::Display for DependencyScope {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Runtime => write!(f, "runtime"),
+            Self::Build => write!(f, "build"),
+            Self::Test => write!(f, "test"),
+            Self::Dev => write!(f, "dev"),
+        }
+    }
+}
+
 /// OSI license information
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct OsiLicenseInfo {
@@ -115,7 +166,7 @@ pub struct OsiLicenseInfo {
 }
 
 /// License Info of dependencies
-#[derive(Serialize, Debug, Clone)]
+#[derive(Serialize, Deserialize, Debug, Clone, Default)]
 pub struct LicenseInfo {
     pub name: String,                        // The name of the software or library
     pub version: String,                     // The version of the software or library
@@ -123,9 +174,99 @@ pub struct LicenseInfo {
     pub is_restrictive: bool,    // A boolean indicating whether the license is restrictive or not
     pub compatibility: LicenseCompatibility, // Compatibility with project license
     pub osi_status: OsiStatus,   // OSI approval status
+    /// Set when the license was classified from a LICENSE file rather than package metadata
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub license_confidence: Option<f32>,
+    /// Manifest or lockfile the dependency was found in, relative to the scanned directory
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub source_file: Option<String>,
+    /// Chain from a direct dependency down to this one, e.g. `["express@4.18.2", "qs@6.11.0"]`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub dependency_path: Option<Vec<String>>,
+    /// Risk tier from `[risk]` in `.feluda.toml`, when tiers are configured
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub tier: Option<String>,
+    /// Known vulnerabilities from OSV.dev, set when scanning with `--vulns`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub vulnerabilities: Option<Vec<crate::vulns::Vulnerability>>,
+    /// Copyright statements from the license files and source headers, set when scanning with `--copyright`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub copyright: Option<Vec<String>>,
+    /// PATENTS, EULA, commercial license and CLA files, set when scanning with `--legal-files`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub legal_files: Option<Vec<crate::legal_files::LegalFile>>,
+    /// Alternative of an `OR` license picked by `[policy] dual_license` or `[[policy.choices]]`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub chosen_license: Option<String>,
+    /// Packages this dependency depends on directly, as `name@version`, when the resolved graph is known
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub requires: Option<Vec<String>>,
+    /// Scope the dependency is declared in, omitted for runtime dependencies
+    #[serde(default, skip_serializing_if = "DependencyScope::is_runtime")]
+    pub scope: DependencyScope,
+    /// Set when the license was asserted in `[overrides]` rather than detected
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub manual_license: Option<ManualLicense>,
+    /// Deprecation, yank and archival signals, set when scanning with `--health`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub health: Option<crate::health::PackageHealth>,
+    /// What the license asks of users, set when scanning with `--obligations`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub obligations: Option<crate::obligations::Obligations>,
+    /// Why the configured policy passed or failed the dependency
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub explanation: Option<crate::policy::PolicyExplanation>,
+    /// Source repository, e.g. `https://github.com/apple/swift-nio`, when the manifest records one
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub repository: Option<String>,
+    /// The same component found again under another name or ecosystem, see [`crate::canonical`]
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub aliases: Option<Vec<crate::canonical::Alias>>,
+    /// Package URL, e.g. `pkg:golang/github.com/gin-gonic/gin@v1.9.1`, see [`crate::canonical::purl`]
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub purl: Option<String>,
+    /// Decision of a reviewer, see [`crate::reviews`]
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub review: Option<crate::reviews::Review>,
+    /// `error` when a registry lookup failed and the license stayed unknown
+    #[serde(
+        default,
+        skip_serializing_if = "crate::lookup_errors::LookupStatus::is_ok"
+    )]
+    pub status: crate::lookup_errors::LookupStatus,
+    /// Cause of the failed lookup, e.g. `https://crates.io/api/v1/crates/serde returned 503`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+}
+
+/// A license determination recorded by a reviewer, see [`crate::overrides`]
+#[derive(Serialize, Deserialize, Debug, Clone, Default, PartialEq)]
+pub struct ManualLicense {
+    /// License the scanner reported before the override
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub detected: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub reviewed_by: Option<String>,
+    /// Date of the review (YYYY-MM-DD)
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub date: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub reason: Option<String>,
 }
 
 impl LicenseInfo {
+    /// A dependency for tests, everything but its name, version and license
+    /// left at the defaults
+    #[cfg(test)]
+    pub fn test(name: &str, version: &str, license: Option<&str>) -> Self {
+        Self {
+            name: name.to_string(),
+            version: version.to_string(),
+            license: license.map(String::from),
+            ..Self::default()
+        }
+    }
+
     pub fn get_license(&self) -> String {
         match &self.license {
             Some(license_name) => String::from(license_name),
@@ -153,6 +294,30 @@ impl LicenseInfo {
         &self.osi_status
     }
 
+    /// Whether the license was asserted by a reviewer in `[overrides]`
+    pub fn is_manually_asserted(&self) -> bool {
+        self.manual_license.is_some()
+    }
+
+    /// Whether no license could be determined for the dependency
+    pub fn has_unknown_license(&self) -> bool {
+        is_unknown_license(self.license.as_deref())
+    }
+
+    /// Whether the license is missing or unrecognized, `None` for a usable license
+    pub fn unknown_license(&self) -> Option<UnknownLicense> {
+        unknown_license_kind(self.license.as_deref())
+    }
+
+    /// Direct and intermediate dependencies that pulled in an indirect dependency,
+    /// e.g. `express@4.18.2 → body-parser@1.20.1`
+    pub fn introduced_by(&self) -> Option<String> {
+        match self.dependency_path.as_deref() {
+            Some([chain @ .., _]) if !chain.is_empty() => Some(chain.join(" → ")),
+            _ => None,
+        }
+    }
+
     #[allow(dead_code)]
     pub fn osi_info(&self) -> Option<OsiLicenseInfo> {
         self.license.as_ref().map(|license| OsiLicenseInfo {
@@ -163,6 +328,67 @@ impl LicenseInfo {
     }
 }
 
+/// Whether a reported license means that none could be determined
+pub fn is_unknown_license(license: Option<&str>) -> bool {
+    match license.map(str::trim) {
+        None | Some("") | Some("No License") | Some("NOASSERTION") => true,
+        Some(license) => license.starts_with("Unknown"),
+    }
+}
+
+/// Why a dependency has no usable license, see [`unknown_license_kind`]
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum UnknownLicense {
+    /// No license was found, so all rights may be reserved
+    Missing,
+    /// A license is declared but it is not an SPDX expression
+    Unrecognized,
+}
+
+impl std::fmt::Display for UnknownLicense {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            UnknownLicense::Missing => write!(f, "missing"),
+            UnknownLicense::Unrecognized => write!(f, "unrecognized"),
+        }
+    }
+}
+
+/// Tell a missing license from a declared one that isn't recognized
+///
+/// A license is missing when none could be determined or the package declares
+/// `UNLICENSED` or `NONE`. A declared license is unrecognized when it doesn't
+/// parse as an SPDX expression, e.g. `See LICENSE file`, or names an identifier
+/// that is not on the SPDX license list bundled with Feluda or the license
+/// database. `LicenseRef-` identifiers are always recognized.
+pub fn unknown_license_kind(license: Option<&str>) -> Option<UnknownLicense> {
+    if is_unknown_license(license) {
+        return Some(UnknownLicense::Missing);
+    }
+    let license = license?.trim();
+    if license.eq_ignore_ascii_case("UNLICENSED") || license.eq_ignore_ascii_case("NONE") {
+        return Some(UnknownLicense::Missing);
+    }
+
+    let Ok(expression) = crate::license_expression::LicenseExpression::parse(license) else {
+        return Some(UnknownLicense::Unrecognized);
+    };
+    let recognized = |id: &str| {
+        if id.starts_with("LicenseRef-") || id.starts_with("DocumentRef-") {
+            return true;
+        }
+        id.chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '.'))
+            && crate::license_text::is_bundled_spdx_id(id).unwrap_or(true)
+    };
+    let all_recognized = expression
+        .terms()
+        .into_iter()
+        .all(|term| recognized(&term.id) && term.exception.as_deref().is_none_or(recognized));
+    (!all_recognized).then_some(UnknownLicense::Unrecognized)
+}
+
 /// License Info structure for GitHub API data
 #[derive(Debug, Clone, serde::Deserialize, serde::Serialize)]
 pub struct License {
@@ -175,7 +401,19 @@ pub struct License {
 
 /// Fetch license data from GitHub's official Licenses API
 /// Attempts to load from cache first, falls back to GitHub API if cache miss or stale
+/// In offline mode the license database snapshot is used instead of the API
 pub fn fetch_licenses_from_github() -> FeludaResult<HashMap<String, License>> {
+    if let Some(db) = offline::license_db().filter(|db| !db.github_licenses.is_empty()) {
+        log(
+            LogLevel::Info,
+            &format!(
+                "Using licenses from the license database ({})",
+                db.github_licenses.len()
+            ),
+        );
+        return Ok(db.github_licenses.clone());
+    }
+
     log(LogLevel::Info, "Fetching licenses from GitHub Licenses API");
 
     match cache::load_github_licenses_from_cache() {
@@ -197,6 +435,14 @@ pub fn fetch_licenses_from_github() -> FeludaResult<HashMap<String, License>> {
         }
     }
 
+    if offline::is_offline() {
+        log(
+            LogLevel::Warn,
+            "Offline and no GitHub licenses cached, run `feluda db download` to create a license database",
+        );
+        return Ok(HashMap::new());
+    }
+
     let licenses_map = cli::with_spinner("Fetching licenses from GitHub API", |indicator| {
         // Use tokio runtime for async operations
         let rt = match tokio::runtime::Runtime::new() {
@@ -233,7 +479,10 @@ async fn fetch_licenses_concurrent(
     // Create async HTTP client with optional authentication
     let mut client_builder = reqwest::Client::builder()
         .user_agent("feluda-license-checker/1.0")
-        .timeout(Duration::from_secs(30));
+        .timeout(crate::registry::request_timeout());
+    if let Some(proxy) = crate::registry::configured_proxy() {
+        client_builder = client_builder.proxy(proxy);
+    }
 
     if let Some(token) = get_github_token() {
         log(
@@ -461,6 +710,25 @@ static OSI_LICENSES: OnceLock<HashMap<String, OsiStatus>> = OnceLock::new();
 
 /// Fetch OSI approved licenses from official API
 pub fn fetch_osi_licenses() -> FeludaResult<HashMap<String, OsiStatus>> {
+    if offline::is_offline() {
+        let osi_map: HashMap<String, OsiStatus> = offline::license_db()
+            .map(|db| {
+                db.osi_licenses
+                    .iter()
+                    .map(|id| (id.clone(), OsiStatus::Approved))
+                    .collect()
+            })
+            .unwrap_or_default();
+        log(
+            LogLevel::Info,
+            &format!(
+                "Offline, using {} OSI approved licenses from the license database",
+                osi_map.len()
+            ),
+        );
+        return Ok(osi_map);
+    }
+
     log(LogLevel::Info, "Fetching OSI approved licenses");
 
     let osi_map = cli::with_spinner("Fetching OSI approved licenses", |indicator| {
@@ -486,11 +754,13 @@ async fn fetch_osi_licenses_async(
     let mut osi_map = HashMap::new();
 
     // Create async HTTP client
-    let client = match reqwest::Client::builder()
+    let mut client_builder = reqwest::Client::builder()
         .user_agent("feluda-license-checker/1.0")
-        .timeout(Duration::from_secs(30))
-        .build()
-    {
+        .timeout(crate::registry::request_timeout());
+    if let Some(proxy) = crate::registry::configured_proxy() {
+        client_builder = client_builder.proxy(proxy);
+    }
+    let client = match client_builder.build() {
         Ok(client) => client,
         Err(err) => {
             log_error("Failed to create HTTP client", &err);
@@ -641,6 +911,21 @@ pub fn is_license_restrictive(
         return true;
     }
 
+    if let Some(custom) = license
+        .as_ref()
+        .and_then(|license_str| config.licenses.custom.get(license_str))
+    {
+        log(
+            LogLevel::Info,
+            &format!(
+                "License {} is a custom license (restrictive={})",
+                license.as_deref().unwrap_or_default(),
+                custom.restrictive
+            ),
+        );
+        return custom.restrictive;
+    }
+
     if let Some(license_str) = license {
         log_debug(
             "Checking against known licenses",
@@ -921,6 +1206,57 @@ pub fn is_license_compatible(
     dependency_license: &str,
     project_license: &str,
     strict: bool,
+) -> LicenseCompatibility {
+    is_license_compatible_with_overrides(
+        dependency_license,
+        project_license,
+        strict,
+        &BTreeMap::new(),
+    )
+}
+
+/// Compatible licenses for a project license, after applying `[compatibility]` overrides
+fn compatible_licenses(
+    norm_project_license: &str,
+    overrides: &BTreeMap<String, config::CompatibilityOverride>,
+) -> Option<Vec<String>> {
+    let built_in = get_compatibility_matrix()
+        .get(norm_project_license)
+        .cloned();
+    let Some(entry) = overrides
+        .iter()
+        .find(|(license, _)| normalize_license_id(license) == norm_project_license)
+        .map(|(_, entry)| entry)
+    else {
+        return built_in;
+    };
+
+    log(
+        LogLevel::Info,
+        &format!("Applying compatibility overrides for project license {norm_project_license}"),
+    );
+    let removed: Vec<String> = entry
+        .incompatible_with
+        .iter()
+        .map(|license| normalize_license_id(license))
+        .collect();
+    let mut licenses = built_in.unwrap_or_default();
+    licenses.retain(|license| !removed.contains(license));
+    for license in &entry.compatible_with {
+        let license = normalize_license_id(license);
+        if !licenses.contains(&license) {
+            licenses.push(license);
+        }
+    }
+    Some(licenses)
+}
+
+/// Check compatibility using the built-in matrix adjusted by `[compatibility]` overrides
+pub fn is_license_compatible_with_overrides(
+    dependency_license: &str,
+    project_license: &str,
+    strict: bool,
+    overrides: &BTreeMap<String, config::CompatibilityOverride>,
 ) -> LicenseCompatibility {
     log(
         LogLevel::Info,
@@ -929,7 +1265,6 @@ pub fn is_license_compatible(
         ),
     );
 
-    let compatibility_matrix = get_compatibility_matrix();
     let norm_dependency_license = normalize_license_id(dependency_license);
     let norm_project_license = normalize_license_id(project_license);
 
@@ -940,7 +1275,7 @@ pub fn is_license_compatible(
         ),
     );
 
-    match compatibility_matrix.get(&norm_project_license) {
+    match compatible_licenses(&norm_project_license, overrides) {
         Some(compatible_licenses) => {
             if compatible_licenses.contains(&norm_dependency_license) {
                 log(
@@ -1052,6 +1387,18 @@ pub fn detect_project_license(project_path: &str) -> FeludaResult<Option<String>
 
             match fs::read_to_string(license_path) {
                 Ok(content) => {
+                    if let Some(detected) = crate::license_detector::classify_license_text(&content)
+                    {
+                        log(
+                            LogLevel::Info,
+                            &format!(
+                                "Classified {} license with confidence {:.2}",
+                                detected.license, detected.confidence
+                            ),
+                        );
+                        return Ok(Some(detected.license));
+                    }
+
                     // Check for MIT license
                     if content.contains("MIT License")
                         || content.contains("Permission is hereby granted, free of charge")
@@ -1268,12 +1615,9 @@ mod tests {
     #[test]
     fn test_license_info_methods() {
         let info = LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         };
 
         assert_eq!(info.name(), "test_package");
@@ -1286,17 +1630,56 @@ mod tests {
     #[test]
     fn test_license_info_no_license() {
         let info = LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: None,
             is_restrictive: true,
-            compatibility: LicenseCompatibility::Unknown,
-            osi_status: OsiStatus::Unknown,
+            ..LicenseInfo::test("test_package", "1.0.0", None)
         };
 
         assert_eq!(info.get_license(), "No License");
     }
 
+    #[test]
+    fn test_license_info_introduced_by() {
+        let mut info = LicenseInfo {
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            ..LicenseInfo::test("ms", "2.0.0", Some("MIT"))
+        };
+        assert_eq!(info.introduced_by(), None);
+
+        info.dependency_path = Some(vec!["ms@2.0.0".to_string()]);
+        assert_eq!(info.introduced_by(), None);
+
+        info.dependency_path = Some(vec![
+            "express@4.18.2".to_string(),
+            "debug@2.6.9".to_string(),
+            "ms@2.0.0".to_string(),
+        ]);
+        assert_eq!(
+            info.introduced_by().as_deref(),
+            Some("express@4.18.2 → debug@2.6.9")
+        );
+    }
+
+    #[test]
+    fn test_unknown_license_kind() {
+        let missing = Some(UnknownLicense::Missing);
+        let unrecognized = Some(UnknownLicense::Unrecognized);
+        assert_eq!(unknown_license_kind(None), missing);
+        assert_eq!(
+            unknown_license_kind(Some("Unknown (registry error)")),
+            missing
+        );
+        assert_eq!(unknown_license_kind(Some("UNLICENSED")), missing);
+        assert_eq!(unknown_license_kind(Some("See LICENSE file")), unrecognized);
+        assert_eq!(unknown_license_kind(Some("MIT & Apache")), unrecognized);
+        assert_eq!(unknown_license_kind(Some("MIT OR Apache-2.0")), None);
+        assert_eq!(
+            unknown_license_kind(Some("GPL-2.0-only WITH Classpath-exception-2.0")),
+            None
+        );
+        assert_eq!(unknown_license_kind(Some("LicenseRef-ACME-Internal")), None);
+    }
+
     #[test]
     fn test_normalize_license_id() {
         assert_eq!(normalize_license_id("MIT"), "MIT");
@@ -0,0 +1,274 @@
+//! Interrupting a scan and guarding it against pathological projects
+//!
+//! Ctrl-C during `feluda` doesn't lose the work done so far: registry requests
+//! fail at once, including those already on the wire, so the remaining lookups
+//! are marked as failed (see [`crate::lookup_errors`]) and the report is
+//! written with what was resolved. The partial report isn't recorded in the
+//! store, sent as notifications or submitted, and Feluda exits with status 130.
+//! A second Ctrl-C quits immediately.
+//!
+//! `--max-deps` fails the scan once more dependencies than allowed are looked
+//! up, counting every project of the scan, and `--max-memory` ends Feluda as
+//! soon as its memory use goes over the limit, so a runaway lockfile fails the
+//! CI job instead of exhausting the runner.
+
+use std::sync::atomic::{AtomicU8, AtomicUsize, Ordering};
+use std::thread;
+use std::time::{Duration, Instant};
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::exit_code::{EXIT_INTERRUPTED, EXIT_SCAN_ERROR};
+use crate::i18n::tr;
+
+const NOT_ABORTED: u8 = 0;
+const INTERRUPTED: u8 = 1;
+const TOO_MANY_DEPENDENCIES: u8 = 2;
+
+// Why the running scan stops looking up dependencies, if it does
+static ABORT: AtomicU8 = AtomicU8::new(NOT_ABORTED);
+
+// --max-deps, 0 when unlimited
+static MAX_DEPENDENCIES: AtomicUsize = AtomicUsize::new(0);
+
+// Dependencies looked up since the scan started
+static LOOKED_UP: AtomicUsize = AtomicUsize::new(0);
+
+/// How often memory use is checked against `--max-memory`
+const MEMORY_CHECK_INTERVAL: Duration = Duration::from_millis(50);
+
+/// Resource limits from `--max-memory` and `--max-deps`
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct Limits {
+    /// Bytes of memory Feluda may use
+    pub max_memory: Option<u64>,
+    /// Dependencies a scan may look up
+    pub max_dependencies: Option<usize>,
+}
+
+/// Apply the limits, starting the memory watchdog when `max_memory` is set
+pub fn set_limits(limits: Limits) {
+    MAX_DEPENDENCIES.store(limits.max_dependencies.unwrap_or(0), Ordering::Relaxed);
+    if let Some(max_memory) = limits.max_memory {
+        watch_memory(max_memory);
+    }
+}
+
+/// Stop the scan at Ctrl-C instead of killing Feluda, see the module documentation
+pub fn install_interrupt_handler() {
+    let spawned = thread::Builder::new()
+        .name("feluda-interrupt".to_string())
+        .spawn(|| {
+            let Ok(runtime) = tokio::runtime::Builder::new_current_thread()
+                .enable_all()
+                .build()
+            else {
+                return;
+            };
+            runtime.block_on(async {
+                if tokio::signal::ctrl_c().await.is_err() {
+                    return;
+                }
+                ABORT.store(INTERRUPTED, Ordering::Relaxed);
+                log(LogLevel::Warn, "Interrupted, finishing the partial report");
+                eprintln!("\n{}", tr("limits.interrupted"));
+
+                if tokio::signal::ctrl_c().await.is_ok() {
+                    std::process::exit(EXIT_INTERRUPTED);
+                }
+            });
+        });
+    if let Err(err) = spawned {
+        log(
+            LogLevel::Warn,
+            &format!("Ctrl-C will end Feluda without a report: {err}"),
+        );
+    }
+}
+
+/// Whether the scan was interrupted with Ctrl-C
+pub fn is_interrupted() -> bool {
+    ABORT.load(Ordering::Relaxed) == INTERRUPTED
+}
+
+/// Why no more registry requests are sent, if the scan was stopped
+pub fn abort_reason() -> Option<String> {
+    match ABORT.load(Ordering::Relaxed) {
+        INTERRUPTED => Some("scan interrupted".to_string()),
+        TOO_MANY_DEPENDENCIES => Some(format!(
+            "more than {} dependencies",
+            MAX_DEPENDENCIES.load(Ordering::Relaxed)
+        )),
+        _ => None,
+    }
+}
+
+/// Sleep for `duration`, waking up early when the scan is stopped
+pub fn sleep(duration: Duration) {
+    let deadline = Instant::now() + duration;
+    loop {
+        let now = Instant::now();
+        if now >= deadline || abort_reason().is_some() {
+            return;
+        }
+        thread::sleep((deadline - now).min(Duration::from_millis(100)));
+    }
+}
+
+/// Start counting the dependencies of a new scan against `--max-deps`
+pub fn begin_scan() {
+    LOOKED_UP.store(0, Ordering::Relaxed);
+    let _ = ABORT.compare_exchange(
+        TOO_MANY_DEPENDENCIES,
+        NOT_ABORTED,
+        Ordering::Relaxed,
+        Ordering::Relaxed,
+    );
+}
+
+/// Count a dependency lookup, stopping the scan once there are too many
+pub fn count_dependency() {
+    let max = MAX_DEPENDENCIES.load(Ordering::Relaxed);
+    if max > 0 && LOOKED_UP.fetch_add(1, Ordering::Relaxed) >= max {
+        let _ = ABORT.compare_exchange(
+            NOT_ABORTED,
+            TOO_MANY_DEPENDENCIES,
+            Ordering::Relaxed,
+            Ordering::Relaxed,
+        );
+    }
+}
+
+/// Fail the scan when it found more dependencies than `--max-deps` allows
+pub fn check_dependency_count(found: usize) -> FeludaResult<()> {
+    dependency_limit_error(
+        MAX_DEPENDENCIES.load(Ordering::Relaxed),
+        found,
+        LOOKED_UP.load(Ordering::Relaxed),
+    )
+    .map_or(Ok(()), Err)
+}
+
+fn dependency_limit_error(max: usize, found: usize, looked_up: usize) -> Option<FeludaError> {
+    (max > 0 && (found > max || looked_up > max)).then(|| {
+        FeludaError::Validation(format!(
+            "Found more than {max} dependencies (--max-deps), {} looked up",
+            found.max(looked_up)
+        ))
+    })
+}
+
+/// Parse a size like `512M`, `2G` or `1.5GiB`, in bytes with binary units
+pub fn parse_size(value: &str) -> Result<u64, String> {
+    let value = value.trim();
+    let split = value
+        .find(|c: char| !c.is_ascii_digit() && c != '.')
+        .unwrap_or(value.len());
+    let (number, unit) = value.split_at(split);
+    let number: f64 = number
+        .parse()
+        .map_err(|_| format!("invalid size '{value}', expected e.g. 512M or 2G"))?;
+    let multiplier: u64 = match unit.trim().to_ascii_lowercase().as_str() {
+        "" | "b" => 1,
+        "k" | "kb" | "kib" => 1 << 10,
+        "m" | "mb" | "mib" => 1 << 20,
+        "g" | "gb" | "gib" => 1 << 30,
+        "t" | "tb" | "tib" => 1 << 40,
+        _ => return Err(format!("unknown unit in '{value}', expected K, M, G or T")),
+    };
+    let bytes = number * multiplier as f64;
+    if bytes < 1.0 {
+        return Err(format!("size '{value}' must be at least one byte"));
+    }
+    Ok(bytes as u64)
+}
+
+/// End Feluda once its memory use goes over `max_memory`
+fn watch_memory(max_memory: u64) {
+    if peak_memory().is_none() {
+        log(
+            LogLevel::Warn,
+            "--max-memory is not supported on this platform, ignoring it",
+        );
+        return;
+    }
+
+    let spawned = thread::Builder::new()
+        .name("feluda-memory".to_string())
+        .spawn(move || loop {
+            if let Some(used) = peak_memory().filter(|used| *used > max_memory) {
+                FeludaError::Validation(format!(
+                    "Memory use of {} MiB is over --max-memory {} MiB",
+                    used >> 20,
+                    max_memory >> 20
+                ))
+                .report();
+                std::process::exit(EXIT_SCAN_ERROR);
+            }
+            thread::sleep(MEMORY_CHECK_INTERVAL);
+        });
+    if let Err(err) = spawned {
+        log(
+            LogLevel::Warn,
+            &format!("Could not watch memory use for --max-memory: {err}"),
+        );
+    }
+}
+
+/// The most memory Feluda has used so far, in bytes
+#[cfg(unix)]
+fn peak_memory() -> Option<u64> {
+    let mut usage = std::mem::MaybeUninit::<libc::rusage>::uninit();
+    // SAFETY: getrusage only writes the struct it is given
+    if unsafe { libc::getrusage(libc::RUSAGE_SELF, usage.as_mut_ptr()) } != 0 {
+        return None;
+    }
+    // SAFETY: initialized by the successful call above
+    let max_rss = u64::try_from(unsafe { usage.assume_init() }.ru_maxrss).ok()?;
+    // Bytes on macOS, kilobytes elsewhere
+    if cfg!(target_os = "macos") {
+        Some(max_rss)
+    } else {
+        Some(max_rss * 1024)
+    }
+}
+
+#[cfg(not(unix))]
+fn peak_memory() -> Option<u64> {
+    None
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_size() {
+        assert_eq!(parse_size("1024"), Ok(1024));
+        assert_eq!(parse_size("512M"), Ok(512 << 20));
+        assert_eq!(parse_size("2g"), Ok(2 << 30));
+        assert_eq!(parse_size("1.5GiB"), Ok(3 << 29));
+        assert_eq!(parse_size("64 KB"), Ok(64 << 10));
+        assert!(parse_size("lots").is_err());
+        assert!(parse_size("5X").is_err());
+        assert!(parse_size("0").is_err());
+    }
+
+    #[test]
+    fn test_dependency_limit_error() {
+        assert!(dependency_limit_error(0, 1000, 1000).is_none());
+        assert!(dependency_limit_error(2, 2, 2).is_none());
+        // Found after deduplication, or looked up across the projects of the scan
+        assert!(dependency_limit_error(2, 3, 0).is_some());
+        let error = dependency_limit_error(2, 1, 5).unwrap();
+        assert_eq!(
+            error.to_string(),
+            "Validation error: Found more than 2 dependencies (--max-deps), 5 looked up"
+        );
+    }
+
+    #[test]
+    #[cfg(unix)]
+    fn test_peak_memory() {
+        assert!(peak_memory().is_some_and(|used| used > 0));
+    }
+}
@@ -0,0 +1,172 @@
+//! Linkage-aware classification of weak-copyleft licenses
+//!
+//! The obligations of weak-copyleft licenses such as LGPL, MPL and EPL depend
+//! on how the library is used. Linked dynamically, it stays a separate,
+//! replaceable component and the product may be under any license. Linked
+//! statically, LGPL additionally requires handing out the object files needed
+//! to relink the product against a modified library.
+//!
+//! `[project] linking` and `[project.ecosystem_linking]` record how the
+//! project's dependencies are linked. Dynamically linked weak-copyleft
+//! dependencies are then neither restrictive nor incompatible, while
+//! statically linked ones keep their classification. Without either setting
+//! the linkage is unknown and nothing changes. `[policy.linking]` adds policy
+//! rules per linkage, see [`PolicyConfig::for_linkage`](crate::config::PolicyConfig::for_linkage).
+
+use std::path::Path;
+
+use crate::config::{Linkage, ProjectConfig};
+use crate::debug::{log, LogLevel};
+use crate::languages::Language;
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::parser::matches_language;
+use crate::policy::{copyleft_rank, license_alternatives};
+
+/// Licenses whose copyleft stops at the library or file boundary
+const WEAK_COPYLEFT: &[&str] = &["LGPL", "MPL", "EPL", "CDDL", "CPL", "MS-RL"];
+
+/// How a dependency is linked into the product, if configured
+///
+/// `[project.ecosystem_linking]` takes precedence over `[project] linking`.
+pub fn linkage(info: &LicenseInfo, project: &ProjectConfig) -> Option<Linkage> {
+    let language = info
+        .source_file
+        .as_deref()
+        .and_then(|source_file| Path::new(source_file).file_name()?.to_str())
+        .and_then(Language::from_file_name);
+    language
+        .and_then(|language| {
+            project
+                .ecosystem_linking
+                .iter()
+                .find(|(ecosystem, _)| matches_language(language, ecosystem.trim()))
+                .map(|(_, linkage)| *linkage)
+        })
+        .or(project.linking)
+}
+
+/// Whether a license identifier is a weak copyleft license, e.g. `LGPL-2.1-or-later`
+pub fn is_weak_copyleft(license_id: &str) -> bool {
+    let id = license_id.to_uppercase();
+    WEAK_COPYLEFT.iter().any(|prefix| id.starts_with(prefix))
+}
+
+/// Whether a license expression can be satisfied with weak-copyleft and permissive licenses,
+/// at least one of them weak copyleft
+fn is_weak_copyleft_expression(license: &str) -> bool {
+    license_alternatives(license).iter().any(|terms| {
+        terms.iter().any(|term| is_weak_copyleft(&term.id))
+            && terms
+                .iter()
+                .all(|term| is_weak_copyleft(&term.id) || copyleft_rank(&term.id) <= 1)
+    })
+}
+
+/// Reclassify weak-copyleft dependencies by how they are linked
+///
+/// Dynamically linked ones are no longer restrictive, and no longer
+/// incompatible with the project license.
+pub fn apply_linking(dependencies: &mut [LicenseInfo], project: &ProjectConfig) {
+    if project.linking.is_none() && project.ecosystem_linking.is_empty() {
+        return;
+    }
+
+    for info in dependencies {
+        let Some(license) = info.chosen_license.as_ref().or(info.license.as_ref()) else {
+            continue;
+        };
+        if !is_weak_copyleft_expression(license) {
+            continue;
+        }
+        let Some(linkage) = linkage(info, project) else {
+            continue;
+        };
+        log(
+            LogLevel::Info,
+            &format!(
+                "{}@{} ({license}) is linked {linkage}",
+                info.name, info.version
+            ),
+        );
+        if linkage == Linkage::Dynamic {
+            info.is_restrictive = false;
+            if info.compatibility == LicenseCompatibility::Incompatible {
+                info.compatibility = LicenseCompatibility::Compatible;
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+    use std::collections::BTreeMap;
+
+    fn dep(name: &str, license: &str, source_file: &str) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: true,
+            compatibility: LicenseCompatibility::Incompatible,
+            osi_status: OsiStatus::Approved,
+            source_file: Some(source_file.to_string()),
+            ..LicenseInfo::test(name, "1.0.0", Some(license))
+        }
+    }
+
+    fn project() -> ProjectConfig {
+        ProjectConfig {
+            linking: Some(Linkage::Dynamic),
+            ecosystem_linking: BTreeMap::from([("go".to_string(), Linkage::Static)]),
+            ..ProjectConfig::default()
+        }
+    }
+
+    #[test]
+    fn test_linkage() {
+        let project = project();
+        assert_eq!(
+            linkage(&dep("a", "LGPL-3.0", "services/api/go.mod"), &project),
+            Some(Linkage::Static)
+        );
+        assert_eq!(
+            linkage(&dep("b", "LGPL-3.0", "web/package.json"), &project),
+            Some(Linkage::Dynamic)
+        );
+        assert_eq!(
+            linkage(&dep("c", "LGPL-3.0", "go.mod"), &ProjectConfig::default()),
+            None
+        );
+    }
+
+    #[test]
+    fn test_weak_copyleft_expression() {
+        assert!(is_weak_copyleft_expression("LGPL-2.1-or-later"));
+        assert!(is_weak_copyleft_expression("MPL-2.0 AND MIT"));
+        assert!(is_weak_copyleft_expression("GPL-3.0-only OR EPL-2.0"));
+        assert!(!is_weak_copyleft_expression(
+            "LGPL-2.1-only AND GPL-2.0-only"
+        ));
+        assert!(!is_weak_copyleft_expression("MIT"));
+    }
+
+    #[test]
+    fn test_apply_linking() {
+        let mut data = vec![
+            dep("static-lgpl", "LGPL-2.1-only", "go.mod"),
+            dep("dynamic-lgpl", "LGPL-2.1-only", "package.json"),
+            dep("dynamic-gpl", "GPL-3.0-only", "package.json"),
+        ];
+
+        apply_linking(&mut data, &project());
+        assert!(data[0].is_restrictive);
+        assert_eq!(data[0].compatibility, LicenseCompatibility::Incompatible);
+        assert!(!data[1].is_restrictive);
+        assert_eq!(data[1].compatibility, LicenseCompatibility::Compatible);
+        // Strong copyleft applies however the library is linked
+        assert!(data[2].is_restrictive);
+
+        let mut data = vec![dep("unknown", "LGPL-2.1-only", "package.json")];
+        apply_linking(&mut data, &ProjectConfig::default());
+        assert!(data[0].is_restrictive);
+    }
+}
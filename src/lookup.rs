@@ -0,0 +1,184 @@
+//! Ad-hoc lookup of a single package (`feluda lookup`)
+//!
+//! Answers "can I use this?" before a dependency is added: the package is
+//! resolved in the registry of its ecosystem, at its latest version unless
+//! one is given, and goes through the same checks as a scanned dependency.
+//! Its license, obligations and classification are printed, along with the
+//! policy decision when `.feluda.toml` configures a policy. No project needs
+//! to be on disk; the current directory is only read for the configuration
+//! and the project license.
+
+use colored::*;
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::dependency_submission::format_package_url;
+use crate::deps_dev::{default_version, purl_system};
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::policy::PolicyDecision;
+use crate::scan::{scan, ScanOptions};
+use crate::spreadsheet::classification;
+
+/// Ecosystems `feluda lookup` resolves, as package URL type and accepted names
+const ECOSYSTEMS: [(&str, &[&str]); 9] = [
+    ("npm", &["npm", "node", "javascript", "js"]),
+    ("pypi", &["pypi", "python", "pip"]),
+    ("cargo", &["cargo", "rust", "crates.io", "crates"]),
+    ("golang", &["go", "golang"]),
+    ("gem", &["gem", "ruby", "rubygems"]),
+    ("pub", &["pub", "dart", "flutter"]),
+    ("hex", &["hex", "elixir"]),
+    ("nuget", &["nuget", "dotnet", ".net", "csharp"]),
+    ("maven", &["maven", "java", "kotlin"]),
+];
+
+/// Package URL type of an ecosystem name such as `python` or `crates.io`
+pub fn ecosystem_purl_type(ecosystem: &str) -> Option<&'static str> {
+    let ecosystem = ecosystem.to_lowercase();
+    ECOSYSTEMS
+        .iter()
+        .find(|(_, names)| names.contains(&ecosystem.as_str()))
+        .map(|(purl_type, _)| *purl_type)
+}
+
+/// Package URL of `name` at `version`, the latest version known to deps.dev when none is given
+pub fn resolve_package(ecosystem: &str, name: &str, version: Option<&str>) -> FeludaResult<String> {
+    let purl_type = ecosystem_purl_type(ecosystem).ok_or_else(|| {
+        let supported: Vec<&str> = ECOSYSTEMS.iter().map(|(_, names)| names[0]).collect();
+        FeludaError::InvalidData(format!(
+            "Unknown ecosystem '{ecosystem}', use one of: {}",
+            supported.join(", ")
+        ))
+    })?;
+
+    let version = match version {
+        Some(version) => version.to_string(),
+        None => {
+            let latest = purl_system(purl_type).and_then(|system| default_version(system, name));
+            let latest = latest.ok_or_else(|| {
+                FeludaError::InvalidData(format!(
+                    "Could not resolve the latest version of {name}, give the version to look up"
+                ))
+            })?;
+            log(
+                LogLevel::Info,
+                &format!("Resolved the latest version of {name}: {latest}"),
+            );
+            latest
+        }
+    };
+    format_package_url(purl_type, name, &version)
+        .ok_or_else(|| FeludaError::InvalidData(format!("Invalid package name '{name}'")))
+}
+
+pub fn handle_lookup_command(
+    ecosystem: String,
+    name: String,
+    version: Option<String>,
+    project_license: Option<String>,
+    json: bool,
+) -> FeludaResult<()> {
+    let purl = resolve_package(&ecosystem, &name, version.as_deref())?;
+    log(LogLevel::Info, &format!("Looking up {purl}"));
+
+    let report = scan(
+        "./",
+        &ScanOptions {
+            project_license,
+            packages: vec![purl.clone()],
+            obligations: true,
+            ..Default::default()
+        },
+    )?;
+    let info = report
+        .dependencies
+        .into_iter()
+        .next()
+        .ok_or_else(|| FeludaError::License(format!("No license information for {purl}")))?;
+
+    if json {
+        let output = serde_json::to_string_pretty(&info).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize the package: {e}"))
+        })?;
+        println!("{output}");
+    } else {
+        print_lookup(&info, report.project_license.as_deref());
+    }
+    Ok(())
+}
+
+/// Print what was found about a package, one field per line
+fn print_lookup(info: &LicenseInfo, project_license: Option<&str>) {
+    println!(
+        "\n{} {} {}\n",
+        info.name.as_str().bold(),
+        info.version,
+        format!("({})", info.purl.as_deref().unwrap_or_default()).dimmed()
+    );
+
+    let class = classification(info);
+    let class = match class.as_str() {
+        "restrictive" => class.red().bold(),
+        "unknown" => class.yellow(),
+        "permissive" => class.green(),
+        _ => class.normal(),
+    };
+    let field = |label: &str, value: &dyn std::fmt::Display| {
+        println!("  {:<16}{value}", format!("{label}:"));
+    };
+    field("License", &info.get_license());
+    field("Classification", &class);
+    field("OSI status", &info.osi_status);
+    if let Some(obligations) = &info.obligations {
+        field("Obligations", &obligations.summary());
+    }
+    if let Some(project_license) = project_license {
+        let compatibility = match info.compatibility {
+            LicenseCompatibility::Compatible => "compatible".green(),
+            LicenseCompatibility::Incompatible => "incompatible".red().bold(),
+            LicenseCompatibility::Unknown => "unknown".yellow(),
+        };
+        field(
+            "Compatibility",
+            &format!("{compatibility} with {project_license}"),
+        );
+    }
+    if let Some(explanation) = &info.explanation {
+        let decision = match explanation.decision {
+            PolicyDecision::Fail => explanation.decision.as_str().red().bold(),
+            _ => explanation.decision.as_str().green(),
+        };
+        field("Policy", &format!("{decision}, {}", explanation.reason));
+    }
+    if let Some(error) = &info.error {
+        field("Lookup error", error);
+    }
+    println!();
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_ecosystem_purl_type() {
+        assert_eq!(ecosystem_purl_type("npm"), Some("npm"));
+        assert_eq!(ecosystem_purl_type("Python"), Some("pypi"));
+        assert_eq!(ecosystem_purl_type("crates.io"), Some("cargo"));
+        assert_eq!(ecosystem_purl_type("go"), Some("golang"));
+        assert_eq!(ecosystem_purl_type("java"), Some("maven"));
+        assert_eq!(ecosystem_purl_type("cobol"), None);
+    }
+
+    #[test]
+    fn test_resolve_package_with_version() {
+        assert_eq!(
+            resolve_package("node", "@babel/core", Some("7.24.0")).unwrap(),
+            "pkg:npm/%40babel/core@7.24.0"
+        );
+        assert_eq!(
+            resolve_package("maven", "org.slf4j:slf4j-api", Some("2.0.9")).unwrap(),
+            "pkg:maven/org.slf4j/slf4j-api@2.0.9"
+        );
+        assert!(resolve_package("cobol", "payroll", Some("1.0")).is_err());
+    }
+}
@@ -0,0 +1,209 @@
+//! Per-dependency license lookup errors
+//!
+//! A registry that is down or rate limiting doesn't fail the scan. While
+//! [`time_dependency`](crate::debug::time_dependency) runs the lookup of a
+//! dependency, requests that still fail after their retries are recorded for
+//! it. Once every project is analyzed, dependencies whose license stayed
+//! unknown are marked with [`LookupStatus::Error`] and the cause, and the rest
+//! of the report is unaffected. `--fail-fast` fails the scan on the first one
+//! instead.
+
+use colored::*;
+use serde::{Deserialize, Serialize};
+use std::cell::RefCell;
+use std::collections::HashMap;
+use std::sync::{Mutex, OnceLock};
+
+use crate::debug::{log, LogLevel};
+use crate::licenses::LicenseInfo;
+use crate::reporter::TableFormatter;
+
+/// Whether the license of a dependency could be looked up
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum LookupStatus {
+    #[default]
+    Ok,
+    /// A registry request failed and no license was found elsewhere
+    Error,
+}
+
+impl LookupStatus {
+    pub fn is_ok(&self) -> bool {
+        *self == Self::Ok
+    }
+}
+
+impl std::fmt::Display for LookupStatus {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            Self::Ok => write!(f, "ok"),
+            Self::Error => write!(f, "error"),
+        }
+    }
+}
+
+thread_local! {
+    /// Failed requests of the lookup running on this thread, if any
+    static CURRENT: RefCell<Option<Vec<String>>> = const { RefCell::new(None) };
+}
+
+/// Cause of the last failed lookup of each `(name, version)`
+static FAILURES: OnceLock<Mutex<HashMap<(String, String), String>>> = OnceLock::new();
+
+fn failures() -> &'static Mutex<HashMap<(String, String), String>> {
+    FAILURES.get_or_init(|| Mutex::new(HashMap::new()))
+}
+
+/// Run the license lookup of a dependency, remembering the requests that failed
+pub(crate) fn capture<T>(name: &str, version: &str, lookup: impl FnOnce() -> T) -> T {
+    let outer = CURRENT.with(|current| current.replace(Some(Vec::new())));
+    let result = lookup();
+    let failed = CURRENT
+        .with(|current| current.replace(outer))
+        .unwrap_or_default();
+
+    if let Ok(mut failures) = failures().lock() {
+        let key = (name.to_string(), version.to_string());
+        // A later successful lookup clears the error of an earlier scan
+        match failed.into_iter().last() {
+            Some(cause) => failures.insert(key, cause),
+            None => failures.remove(&key),
+        };
+    }
+    result
+}
+
+/// Record a request that failed for good, for the lookup running on this thread
+pub(crate) fn record_failure(cause: String) {
+    CURRENT.with(|current| {
+        if let Some(failed) = current.borrow_mut().as_mut() {
+            failed.push(cause);
+        }
+    });
+}
+
+/// Mark the dependencies whose license is unknown because their lookup failed
+///
+/// Returns the number of dependencies marked.
+pub fn apply_lookup_errors(dependencies: &mut [LicenseInfo]) -> usize {
+    let Ok(failures) = failures().lock() else {
+        return 0;
+    };
+
+    let mut marked = 0;
+    for info in dependencies {
+        if !info.has_unknown_license() || info.is_manually_asserted() {
+            continue;
+        }
+        if let Some(cause) = failures.get(&(info.name.clone(), info.version.clone())) {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "License lookup failed for {}@{}: {cause}",
+                    info.name, info.version
+                ),
+            );
+            info.status = LookupStatus::Error;
+            info.error = Some(cause.clone());
+            marked += 1;
+        }
+    }
+    marked
+}
+
+/// The first dependency whose lookup failed, for `--fail-fast`
+pub fn first_lookup_error(dependencies: &[LicenseInfo]) -> Option<&LicenseInfo> {
+    dependencies
+        .iter()
+        .find(|info| info.status == LookupStatus::Error)
+}
+
+/// Print a table of the dependencies whose license lookup failed
+pub fn print_lookup_errors(dependencies: &[LicenseInfo]) {
+    let rows: Vec<Vec<String>> = dependencies
+        .iter()
+        .filter(|info| info.status == LookupStatus::Error)
+        .map(|info| {
+            vec![
+                info.name.clone(),
+                info.version.clone(),
+                info.error.clone().unwrap_or_default(),
+            ]
+        })
+        .collect();
+    if rows.is_empty() {
+        return;
+    }
+
+    println!(
+        "\n{} {}\n",
+        "⚠️".bold(),
+        format!(
+            "License lookup failed for {} dependencies, results are partial",
+            rows.len()
+        )
+        .yellow()
+        .bold()
+    );
+
+    let headers = ["Package", "Version", "Error"];
+    let mut formatter = TableFormatter::new(headers.iter().map(|h| h.to_string()).collect());
+    for row in &rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+    for row in &rows {
+        println!("{}", formatter.render_row(row, true));
+    }
+    println!("{}\n", formatter.render_footer());
+    println!("Run again to retry them, or use --fail-fast to stop on the first failure.\n");
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_lookup_errors_mark_unknown_licenses() {
+        let license = capture("lookup-errors-down", "1.0.0", || {
+            record_failure("https://registry.example.com returned 503".to_string());
+            "Unknown".to_string()
+        });
+        // A fallback that found the license leaves the dependency alone
+        capture("lookup-errors-fallback", "1.0.0", || {
+            record_failure("first mirror timed out".to_string());
+        });
+        // Failures outside a lookup are not recorded
+        record_failure("ignored".to_string());
+
+        let mut deps = vec![
+            LicenseInfo::test("lookup-errors-down", "1.0.0", Some(license.as_str())),
+            LicenseInfo::test("lookup-errors-fallback", "1.0.0", Some("MIT")),
+            LicenseInfo::test("lookup-errors-unrelated", "1.0.0", Some("Unknown")),
+        ];
+        assert_eq!(apply_lookup_errors(&mut deps), 1);
+        assert_eq!(deps[0].status, LookupStatus::Error);
+        assert_eq!(
+            deps[0].error.as_deref(),
+            Some("https://registry.example.com returned 503")
+        );
+        assert!(deps[1..]
+            .iter()
+            .all(|d| d.status.is_ok() && d.error.is_none()));
+        assert_eq!(
+            first_lookup_error(&deps).map(|d| d.name.as_str()),
+            Some("lookup-errors-down")
+        );
+
+        // A successful lookup in a later scan clears the error
+        capture("lookup-errors-down", "1.0.0", || ());
+        let mut deps = vec![LicenseInfo::test(
+            "lookup-errors-down",
+            "1.0.0",
+            Some("Unknown"),
+        )];
+        assert_eq!(apply_lookup_errors(&mut deps), 0);
+    }
+}
@@ -0,0 +1,196 @@
+//! Man pages
+//!
+//! `feluda docs man` writes `feluda.1` and a page for every subcommand, e.g.
+//! `feluda-db-update.1`, rendered by clap_mangen from the same clap definition
+//! as `--help`, so a system-wide install can put them in `/usr/share/man/man1`
+//! next to the binary. Global flags are only documented in `feluda(1)`, which
+//! also lists the exit statuses.
+
+use std::fs;
+use std::path::Path;
+
+use clap::{Command, CommandFactory};
+use clap_mangen::roff::{bold, roman, Roff};
+use clap_mangen::Man;
+
+use crate::cli::Cli;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::exit_code::{
+    EXIT_CLEAN, EXIT_INTERRUPTED, EXIT_SCAN_ERROR, EXIT_UNKNOWN_LICENSES, EXIT_VIOLATIONS,
+};
+
+/// Exit statuses of a scan, for the EXIT STATUS section of `feluda(1)`
+const EXIT_STATUSES: [(i32, &str); 5] = [
+    (EXIT_CLEAN, "No failing findings, or no more than --max-violations."),
+    (
+        EXIT_VIOLATIONS,
+        "Policy violations, or restrictive, incompatible or vulnerable dependencies selected with --fail-on.",
+    ),
+    (
+        EXIT_UNKNOWN_LICENSES,
+        "Only dependencies without a known license, with --fail-on unknown.",
+    ),
+    (EXIT_SCAN_ERROR, "The scan itself failed."),
+    (
+        EXIT_INTERRUPTED,
+        "The scan was interrupted with Ctrl-C, the report is partial.",
+    ),
+];
+
+/// A man page in section 1
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct ManPage {
+    /// `feluda-db-update` for `feluda db update`
+    pub name: String,
+    /// The page in roff
+    pub content: String,
+}
+
+impl ManPage {
+    pub fn file_name(&self) -> String {
+        format!("{}.1", self.name)
+    }
+}
+
+/// Write the man pages of every command to `output`
+pub fn handle_man_command(output: &str) -> FeludaResult<()> {
+    let output = Path::new(output);
+    fs::create_dir_all(output).map_err(|e| {
+        FeludaError::FileWrite(format!("Failed to create {}: {e}", output.display()))
+    })?;
+
+    let pages = man_pages()?;
+    for page in &pages {
+        let path = output.join(page.file_name());
+        log(
+            LogLevel::Info,
+            &format!("Writing man page {}", path.display()),
+        );
+        fs::write(&path, &page.content).map_err(|e| {
+            FeludaError::FileWrite(format!("Failed to write {}: {e}", path.display()))
+        })?;
+    }
+    println!("✓ Wrote {} man pages to {}", pages.len(), output.display());
+    Ok(())
+}
+
+/// The pages of `feluda` and of each subcommand, hidden ones left out
+pub fn man_pages() -> FeludaResult<Vec<ManPage>> {
+    let mut root = Cli::command();
+    root.build();
+    let mut pages = Vec::new();
+    collect_pages(&root, &[], &mut pages)?;
+    Ok(pages)
+}
+
+fn collect_pages(
+    command: &Command,
+    parents: &[&str],
+    pages: &mut Vec<ManPage>,
+) -> FeludaResult<()> {
+    let mut path = parents.to_vec();
+    path.push(command.get_name());
+    let name = path.join("-");
+
+    // clap_mangen refers to subcommands as `<name>-<subcommand>(1)`
+    let mut page = command.clone().name(name.clone());
+    if !parents.is_empty() {
+        // Global options are documented in feluda(1)
+        page = page.mut_args(|arg| {
+            let global = arg.is_global_set();
+            arg.hide(global)
+        });
+    }
+    let mut content = Vec::new();
+    Man::new(page).render(&mut content)?;
+    if parents.is_empty() {
+        exit_status_section().render(&mut content)?;
+    }
+    pages.push(ManPage {
+        content: String::from_utf8(content)
+            .map_err(|e| FeludaError::InvalidData(format!("Invalid man page {name}: {e}")))?,
+        name,
+    });
+
+    for subcommand in visible_subcommands(command) {
+        collect_pages(subcommand, &path, pages)?;
+    }
+    Ok(())
+}
+
+fn visible_subcommands(command: &Command) -> impl Iterator<Item = &Command> {
+    command
+        .get_subcommands()
+        .filter(|subcommand| !subcommand.is_hide_set() && subcommand.get_name() != "help")
+}
+
+/// The EXIT STATUS section of `feluda(1)`, which clap_mangen has no source for
+fn exit_status_section() -> Roff {
+    let mut section = Roff::new();
+    section.control("SH", ["EXIT STATUS"]);
+    for (code, meaning) in EXIT_STATUSES {
+        section.control("TP", []);
+        section.text([bold(code.to_string())]);
+        section.text([roman(meaning)]);
+    }
+    section.text([
+        roman("Exit codes of "),
+        bold("[risk]"),
+        roman(" tiers in the configuration take precedence over these."),
+    ]);
+    section
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn page(name: &str) -> ManPage {
+        man_pages()
+            .unwrap()
+            .into_iter()
+            .find(|page| page.name == name)
+            .unwrap_or_else(|| panic!("no man page {name}"))
+    }
+
+    #[test]
+    fn test_man_pages() {
+        let pages = man_pages().unwrap();
+        let names: Vec<_> = pages.iter().map(|page| page.name.as_str()).collect();
+        assert_eq!(names[0], "feluda");
+        assert!(names.contains(&"feluda-sbom"));
+        assert!(names.contains(&"feluda-db-update"));
+        assert!(names.contains(&"feluda-docs-man"));
+        assert!(!names.iter().any(|name| name.ends_with("-help")));
+        assert_eq!(pages[1].file_name(), format!("{}.1", pages[1].name));
+    }
+
+    #[test]
+    fn test_root_page() {
+        let content = page("feluda").content;
+        assert!(content.contains("\\-\\-debug"));
+        assert!(content.contains("feluda\\-sbom(1)"));
+        assert!(content.contains("EXIT STATUS"));
+        assert!(content.contains("\\fB130\\fR"));
+    }
+
+    #[test]
+    fn test_subcommand_page() {
+        let content = page("feluda-docs-man").content;
+        assert!(content.contains("\\-\\-output"));
+        // Global options are documented in feluda(1)
+        assert!(!content.contains("\\-\\-debug"));
+
+        let content = page("feluda-db").content;
+        assert!(content.contains("feluda\\-db\\-update(1)"));
+    }
+
+    #[test]
+    fn test_handle_man_command() {
+        let dir = tempfile::TempDir::new().unwrap();
+        let output = dir.path().join("man1");
+        handle_man_command(output.to_str().unwrap()).unwrap();
+        assert!(output.join("feluda.1").exists());
+        assert!(output.join("feluda-db-update.1").exists());
+    }
+}
@@ -0,0 +1,560 @@
+//! Notifications of scan results (`[[notifications]]`)
+//!
+//! `feluda serve` and scans run with `--notify` post their results to Slack,
+//! Microsoft Teams or any webhook. Each notification counts the findings it is
+//! configured for, leaving out violations accepted in the baseline, and is only
+//! sent once there are `min_findings` of them:
+//!
+//! ```toml
+//! [[notifications]]
+//! kind = "slack"
+//! url_env = "SLACK_WEBHOOK_URL"
+//! on = ["restrictive"]
+//! only_new = true
+//! ```
+//!
+//! With `only_new`, a finding only counts when the previous scan of the project
+//! had no dependency of that name under that license: the last scan recorded
+//! with `--store`, or for `feluda serve` the last scan of the same path. Without
+//! a previous scan, every finding is new.
+//!
+//! Messages are rendered by a [template](crate::template) when one is
+//! configured. It sees the `--format json --schema 2` document, with the
+//! project, its findings and the default message under `.notification`.
+
+use serde::{Deserialize, Serialize};
+use serde_json::{json, Value};
+use std::collections::BTreeSet;
+use std::fs;
+use std::path::Path;
+
+use crate::aggregate::project_name;
+use crate::baseline::{Baseline, BaselineKind};
+use crate::config::NotificationConfig;
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::policy::PolicyViolation;
+use crate::registry::{self, Registry};
+use crate::report_json::build_report_v2;
+use crate::template::Template;
+
+/// Findings listed in the default message, the rest are counted
+const MAX_LISTED_FINDINGS: usize = 20;
+
+/// Service a notification is posted to
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum NotificationKind {
+    /// A Slack incoming webhook
+    Slack,
+    /// A Microsoft Teams incoming webhook or workflow, sent as an Adaptive Card
+    Teams,
+    /// Any URL, posted the scan as JSON
+    Webhook,
+}
+
+/// Kinds of findings a notification is sent for
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum FindingKind {
+    Restrictive,
+    Incompatible,
+    /// Dependencies without a known license
+    Unknown,
+    /// Dependencies with known vulnerabilities
+    Vulns,
+    /// Violations of the `[policy]` section
+    Policy,
+}
+
+impl FindingKind {
+    fn label(self) -> &'static str {
+        match self {
+            FindingKind::Restrictive => "restrictive",
+            FindingKind::Incompatible => "incompatible",
+            FindingKind::Unknown => "unknown license",
+            FindingKind::Vulns => "vulnerable",
+            FindingKind::Policy => "policy violation",
+        }
+    }
+}
+
+/// Dependency names and licenses of a scan, to tell which findings are new
+pub type KnownLicenses = BTreeSet<(String, Option<String>)>;
+
+/// Names and licenses of the dependencies of a scan
+pub fn known_licenses(dependencies: &[LicenseInfo]) -> KnownLicenses {
+    dependencies
+        .iter()
+        .map(|info| (info.name.clone(), info.license.clone()))
+        .collect()
+}
+
+/// A finished scan to notify about
+#[derive(Debug, Clone, Copy)]
+pub struct ScanResult<'a> {
+    pub path: &'a Path,
+    pub project_license: Option<&'a str>,
+    pub dependencies: &'a [LicenseInfo],
+    pub policy_violations: &'a [PolicyViolation],
+    /// Violations accepted for the project, never notified about
+    pub baseline: Option<&'a Baseline>,
+    /// Dependencies of the previous scan, for `only_new`
+    pub previous: Option<&'a KnownLicenses>,
+}
+
+/// A finding counted by a notification
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Finding {
+    pub kind: FindingKind,
+    pub name: String,
+    pub version: String,
+    pub license: Option<String>,
+    pub reason: String,
+}
+
+/// Findings of a scan that count for `notification`, in the order of its `on` list
+pub fn findings(notification: &NotificationConfig, scan: &ScanResult) -> Vec<Finding> {
+    let counts = |name: &str, license: Option<&str>, kind: Option<BaselineKind>| {
+        let accepted = kind.is_some_and(|kind| {
+            scan.baseline
+                .is_some_and(|baseline| baseline.suppresses(name, license, kind))
+        });
+        let known = notification.only_new
+            && scan.previous.is_some_and(|previous| {
+                previous.contains(&(name.to_string(), license.map(str::to_string)))
+            });
+        !accepted && !known
+    };
+    let finding = |kind, info: &LicenseInfo, reason: String| Finding {
+        kind,
+        name: info.name.clone(),
+        version: info.version.clone(),
+        license: info.license.clone(),
+        reason,
+    };
+
+    let mut findings = Vec::new();
+    for &kind in &notification.on {
+        match kind {
+            FindingKind::Policy => {
+                findings.extend(
+                    scan.policy_violations
+                        .iter()
+                        .filter(|v| {
+                            counts(&v.name, v.license.as_deref(), Some(BaselineKind::Policy))
+                        })
+                        .map(|v| Finding {
+                            kind,
+                            name: v.name.clone(),
+                            version: v.version.clone(),
+                            license: v.license.clone(),
+                            reason: v.kind.describe().to_string(),
+                        }),
+                );
+            }
+            _ => {
+                for info in scan.dependencies {
+                    let (matches, baseline_kind, reason) = match kind {
+                        FindingKind::Restrictive => (
+                            info.is_restrictive,
+                            Some(BaselineKind::Restrictive),
+                            "restrictive license".to_string(),
+                        ),
+                        FindingKind::Incompatible => (
+                            info.compatibility == LicenseCompatibility::Incompatible,
+                            Some(BaselineKind::Incompatible),
+                            format!(
+                                "incompatible with {}",
+                                scan.project_license.unwrap_or("the project license")
+                            ),
+                        ),
+                        FindingKind::Unknown => (
+                            info.has_unknown_license(),
+                            None,
+                            "no known license".to_string(),
+                        ),
+                        FindingKind::Vulns => {
+                            let count = info.vulnerabilities.as_ref().map_or(0, Vec::len);
+                            (count > 0, None, format!("{count} known vulnerabilities"))
+                        }
+                        FindingKind::Policy => unreachable!(),
+                    };
+                    if matches && counts(&info.name, info.license.as_deref(), baseline_kind) {
+                        findings.push(finding(kind, info, reason));
+                    }
+                }
+            }
+        }
+    }
+    findings
+}
+
+/// Message listing the findings, or summarizing the scan when there are none
+fn default_message(
+    project: &str,
+    scan: &ScanResult,
+    findings: &[Finding],
+    only_new: bool,
+) -> String {
+    if findings.is_empty() {
+        return format!(
+            "Feluda scanned {project}: {} dependencies, no license findings",
+            scan.dependencies.len()
+        );
+    }
+
+    let mut counts: Vec<(FindingKind, usize)> = Vec::new();
+    for finding in findings {
+        match counts.iter_mut().find(|(kind, _)| *kind == finding.kind) {
+            Some((_, count)) => *count += 1,
+            None => counts.push((finding.kind, 1)),
+        }
+    }
+    let counts: Vec<String> = counts
+        .iter()
+        .map(|(kind, count)| format!("{count} {}", kind.label()))
+        .collect();
+
+    let mut message = format!(
+        "Feluda found {} {}license finding{} in {project}: {}",
+        findings.len(),
+        if only_new { "new " } else { "" },
+        if findings.len() == 1 { "" } else { "s" },
+        counts.join(", ")
+    );
+    for finding in findings.iter().take(MAX_LISTED_FINDINGS) {
+        message.push_str(&format!(
+            "\n• {}@{} ({}): {}",
+            finding.name,
+            finding.version,
+            finding.license.as_deref().unwrap_or("No License"),
+            finding.reason
+        ));
+    }
+    if findings.len() > MAX_LISTED_FINDINGS {
+        message.push_str(&format!(
+            "\n… and {} more",
+            findings.len() - MAX_LISTED_FINDINGS
+        ));
+    }
+    message
+}
+
+/// Request body: the message for Slack and Teams, the scan for webhooks
+fn payload(kind: NotificationKind, message: &str, notification: &Value, report: Value) -> Value {
+    match kind {
+        NotificationKind::Slack => json!({ "text": message }),
+        NotificationKind::Teams => json!({
+            "type": "message",
+            "attachments": [{
+                "contentType": "application/vnd.microsoft.card.adaptive",
+                "content": {
+                    "$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+                    "type": "AdaptiveCard",
+                    "version": "1.4",
+                    "body": [{ "type": "TextBlock", "text": message, "wrap": true }],
+                },
+            }],
+        }),
+        NotificationKind::Webhook => {
+            let mut body = notification.clone();
+            body["report"] = report;
+            body
+        }
+    }
+}
+
+/// URL from `url`, or from the environment variable named by `url_env`
+fn webhook_url(notification: &NotificationConfig) -> FeludaResult<String> {
+    if let Some(url) = &notification.url {
+        return Ok(url.clone());
+    }
+    let name = notification.url_env.as_deref().unwrap_or_default();
+    match std::env::var(name) {
+        Ok(url) if !url.trim().is_empty() => Ok(url),
+        _ => Err(FeludaError::Config(format!(
+            "Environment variable {name} with the {:?} webhook URL is not set",
+            notification.kind
+        ))),
+    }
+}
+
+/// Send one notification if its threshold is reached, returning whether it was sent
+fn send_notification(notification: &NotificationConfig, scan: &ScanResult) -> FeludaResult<bool> {
+    let findings = findings(notification, scan);
+    if findings.len() < notification.min_findings {
+        log(
+            LogLevel::Info,
+            &format!(
+                "Not sending {:?} notification: {} of {} findings",
+                notification.kind,
+                findings.len(),
+                notification.min_findings
+            ),
+        );
+        return Ok(false);
+    }
+    let url = webhook_url(notification)?;
+
+    let project = project_name(scan.path);
+    let path = scan.path.display().to_string();
+    let message = default_message(&project, scan, &findings, notification.only_new);
+    let details = json!({
+        "project": project,
+        "path": path,
+        "only_new": notification.only_new,
+        "message": message,
+        "findings": findings,
+    });
+    let report = serde_json::to_value(build_report_v2(
+        &path,
+        scan.dependencies,
+        scan.project_license,
+        scan.policy_violations,
+    ))
+    .map_err(|e| {
+        FeludaError::Serialization(format!("Failed to serialize report for notification: {e}"))
+    })?;
+
+    let response = match &notification.template {
+        Some(template_path) => {
+            let source = fs::read_to_string(template_path).map_err(|e| {
+                FeludaError::Template(format!("Failed to read template {template_path}: {e}"))
+            })?;
+            let mut data = report.clone();
+            data["notification"] = details;
+            let rendered = Template::parse(&source)
+                .and_then(|template| template.render(&data))
+                .map_err(|e| FeludaError::Template(format!("{template_path}: {e}")))?;
+
+            if notification.kind == NotificationKind::Webhook {
+                let content_type = if serde_json::from_str::<Value>(&rendered).is_ok() {
+                    "application/json"
+                } else {
+                    "text/plain; charset=utf-8"
+                };
+                registry::send(Registry::Notifications, |client| {
+                    client
+                        .post(&url)
+                        .header(reqwest::header::CONTENT_TYPE, content_type)
+                        .body(rendered.clone())
+                })
+            } else {
+                let body = payload(notification.kind, rendered.trim_end(), &Value::Null, report);
+                registry::post_json(Registry::Notifications, &url, &body)
+            }
+        }
+        None => {
+            let body = payload(notification.kind, &message, &details, report);
+            registry::post_json(Registry::Notifications, &url, &body)
+        }
+    };
+
+    let response = response.map_err(|e| {
+        FeludaError::InvalidData(format!(
+            "Failed to send {:?} notification: {e}",
+            notification.kind
+        ))
+    })?;
+    let status = response.status();
+    if !status.is_success() {
+        return Err(FeludaError::InvalidData(format!(
+            "{:?} rejected the notification: HTTP {status}",
+            notification.kind
+        )));
+    }
+    log(
+        LogLevel::Info,
+        &format!(
+            "Sent {:?} notification about {} findings in {project}",
+            notification.kind,
+            findings.len()
+        ),
+    );
+    Ok(true)
+}
+
+/// Send the configured notifications about a scan
+///
+/// A notification that can't be sent is logged and doesn't stop the others or
+/// fail the scan. Returns the number of notifications sent.
+pub fn send_notifications(notifications: &[NotificationConfig], scan: &ScanResult) -> usize {
+    if notifications.is_empty() {
+        return 0;
+    }
+    if crate::offline::is_offline() {
+        log(LogLevel::Warn, "Offline, not sending notifications");
+        return 0;
+    }
+    notifications
+        .iter()
+        .filter(|notification| match send_notification(notification, scan) {
+            Ok(sent) => sent,
+            Err(err) => {
+                log_error("Failed to send notification", &err);
+                false
+            }
+        })
+        .count()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::baseline::BaselineEntry;
+    use crate::licenses::OsiStatus;
+    use crate::policy::ViolationKind;
+
+    fn dep(name: &str, license: &str, restrictive: bool) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            ..LicenseInfo::test(name, "1.0.0", Some(license))
+        }
+    }
+
+    fn notification(toml: &str) -> NotificationConfig {
+        toml::from_str(&format!(
+            "kind = \"slack\"\nurl = \"http://localhost/\"\n{toml}"
+        ))
+        .unwrap()
+    }
+
+    #[test]
+    fn test_findings_respect_baseline_and_previous_scan() {
+        let dependencies = vec![
+            dep("gpl-lib", "GPL-3.0", true),
+            dep("agpl-lib", "AGPL-3.0", true),
+            dep("accepted", "GPL-2.0", true),
+            dep("mit-lib", "MIT", false),
+        ];
+        let violations = vec![PolicyViolation {
+            name: "agpl-lib".to_string(),
+            version: "1.0.0".to_string(),
+            license: Some("AGPL-3.0".to_string()),
+            kind: ViolationKind::Denied,
+            introduced_by: None,
+        }];
+        let baseline = Baseline {
+            version: 1,
+            created: "2026-01-01T00:00:00Z".to_string(),
+            violations: vec![BaselineEntry {
+                name: "accepted".to_string(),
+                version: "0.9.0".to_string(),
+                license: Some("GPL-2.0".to_string()),
+                kind: BaselineKind::Restrictive,
+            }],
+        };
+        let previous = known_licenses(&[dep("gpl-lib", "GPL-3.0", true)]);
+        let scan = ScanResult {
+            path: Path::new("."),
+            project_license: None,
+            dependencies: &dependencies,
+            policy_violations: &violations,
+            baseline: Some(&baseline),
+            previous: Some(&previous),
+        };
+
+        let defaults = notification("");
+        assert_eq!(
+            defaults.on,
+            vec![
+                FindingKind::Restrictive,
+                FindingKind::Incompatible,
+                FindingKind::Policy
+            ]
+        );
+        let all: Vec<(FindingKind, String)> = findings(&defaults, &scan)
+            .into_iter()
+            .map(|f| (f.kind, f.name))
+            .collect();
+        assert_eq!(
+            all,
+            vec![
+                (FindingKind::Restrictive, "gpl-lib".to_string()),
+                (FindingKind::Restrictive, "agpl-lib".to_string()),
+                (FindingKind::Policy, "agpl-lib".to_string()),
+            ]
+        );
+
+        let new_restrictive = notification("on = [\"restrictive\"]\nonly_new = true");
+        let new: Vec<String> = findings(&new_restrictive, &scan)
+            .into_iter()
+            .map(|f| f.name)
+            .collect();
+        assert_eq!(new, vec!["agpl-lib"]);
+
+        // Without a previous scan every finding is new
+        let first = ScanResult {
+            previous: None,
+            ..scan
+        };
+        assert_eq!(findings(&new_restrictive, &first).len(), 2);
+    }
+
+    #[test]
+    fn test_default_message() {
+        let dependencies = vec![dep("gpl-lib", "GPL-3.0", true)];
+        let scan = ScanResult {
+            path: Path::new("."),
+            project_license: None,
+            dependencies: &dependencies,
+            policy_violations: &[],
+            baseline: None,
+            previous: None,
+        };
+        let found = findings(&notification(""), &scan);
+        assert_eq!(
+            default_message("api", &scan, &found, true),
+            "Feluda found 1 new license finding in api: 1 restrictive\n\
+             • gpl-lib@1.0.0 (GPL-3.0): restrictive license"
+        );
+        assert_eq!(
+            default_message("api", &scan, &[], false),
+            "Feluda scanned api: 1 dependencies, no license findings"
+        );
+
+        let many: Vec<Finding> = (0..25).map(|_| found[0].clone()).collect();
+        let message = default_message("api", &scan, &many, false);
+        assert!(message.starts_with("Feluda found 25 license findings in api: 25 restrictive"));
+        assert!(message.ends_with("\n… and 5 more"));
+    }
+
+    #[test]
+    fn test_payloads() {
+        let details = json!({ "project": "api", "findings": [] });
+        let report = json!({ "schema_version": 2 });
+
+        let slack = payload(NotificationKind::Slack, "hello", &details, report.clone());
+        assert_eq!(slack, json!({ "text": "hello" }));
+
+        let teams = payload(NotificationKind::Teams, "hello", &details, report.clone());
+        let card = &teams["attachments"][0];
+        assert_eq!(
+            card["contentType"],
+            "application/vnd.microsoft.card.adaptive"
+        );
+        assert_eq!(card["content"]["body"][0]["text"], "hello");
+
+        let webhook = payload(NotificationKind::Webhook, "hello", &details, report);
+        assert_eq!(webhook["project"], "api");
+        assert_eq!(webhook["report"]["schema_version"], 2);
+    }
+
+    #[test]
+    fn test_min_findings_threshold() {
+        let dependencies = vec![dep("mit-lib", "MIT", false)];
+        let scan = ScanResult {
+            path: Path::new("."),
+            project_license: None,
+            dependencies: &dependencies,
+            policy_violations: &[],
+            baseline: None,
+            previous: None,
+        };
+        // Below the threshold nothing is sent
+        assert!(!send_notification(&notification(""), &scan).unwrap());
+    }
+}
@@ -0,0 +1,234 @@
+//! What a license asks of the people using the dependency
+//!
+//! An SPDX identifier doesn't tell a reader who isn't a lawyer what a finding
+//! means. With `--obligations` each dependency gets a summary from a built-in
+//! table: whether copies must carry the notice, whether the source must be
+//! made available, whether the license grants its contributors' patents and
+//! whether derived works must stay under the same license.
+//!
+//! For an SPDX expression the obligations of `AND` terms add up, and the `OR`
+//! alternative with the fewest obligations is used, unless the policy picked
+//! one. Licenses missing from the table get no summary.
+
+use serde::{Deserialize, Serialize};
+
+use crate::i18n::tr;
+use crate::licenses::LicenseInfo;
+use crate::policy::license_alternatives;
+
+/// Obligations of a license, see the module documentation
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Obligations {
+    /// Copies must keep the copyright notice and license text
+    pub attribution: bool,
+    /// The source code must be offered to those receiving the software,
+    /// for AGPL and SSPL also to users over a network
+    pub source_disclosure: bool,
+    /// Contributors grant a license to the patents their contributions use
+    pub patent_grant: bool,
+    /// Modified copies, or the works including the dependency, must use the same license
+    pub same_license: bool,
+}
+
+impl Obligations {
+    const fn new(
+        attribution: bool,
+        source_disclosure: bool,
+        patent_grant: bool,
+        same_license: bool,
+    ) -> Self {
+        Self {
+            attribution,
+            source_disclosure,
+            patent_grant,
+            same_license,
+        }
+    }
+
+    /// Requirements on the user, the patent grant being a right rather than a duty
+    fn burden(&self) -> usize {
+        [self.attribution, self.source_disclosure, self.same_license]
+            .iter()
+            .filter(|required| **required)
+            .count()
+    }
+
+    fn union(self, other: Self) -> Self {
+        Self {
+            attribution: self.attribution || other.attribution,
+            source_disclosure: self.source_disclosure || other.source_disclosure,
+            patent_grant: self.patent_grant || other.patent_grant,
+            same_license: self.same_license || other.same_license,
+        }
+    }
+
+    /// Short labels of the obligations that apply, e.g. `["attribution", "patent grant"]`
+    pub fn labels(&self) -> Vec<&'static str> {
+        [
+            (self.attribution, "attribution"),
+            (self.source_disclosure, "source disclosure"),
+            (self.patent_grant, "patent grant"),
+            (self.same_license, "same license"),
+        ]
+        .into_iter()
+        .filter_map(|(applies, label)| applies.then_some(label))
+        .collect()
+    }
+
+    /// Labels joined for a table cell, `none` for public-domain-like licenses
+    ///
+    /// Unlike [`Obligations::labels`] the summary is in the language picked with `--lang`.
+    pub fn summary(&self) -> String {
+        let labels = self.labels();
+        if labels.is_empty() {
+            tr("obligation.none")
+        } else {
+            labels
+                .iter()
+                .map(|label| tr(&format!("obligation.{}", label.replace(' ', "_"))))
+                .collect::<Vec<_>>()
+                .join(", ")
+        }
+    }
+}
+
+const NONE: Obligations = Obligations::new(false, false, false, false);
+const NOTICE: Obligations = Obligations::new(true, false, false, false);
+const NOTICE_PATENTS: Obligations = Obligations::new(true, false, true, false);
+const SHARE_ALIKE: Obligations = Obligations::new(true, false, false, true);
+const COPYLEFT: Obligations = Obligations::new(true, true, false, true);
+const COPYLEFT_PATENTS: Obligations = Obligations::new(true, true, true, true);
+
+/// Built-in obligations by SPDX identifier, without `-only`/`-or-later`
+const OBLIGATIONS: [(&str, Obligations); 52] = [
+    ("0BSD", NONE),
+    ("CC0-1.0", NONE),
+    ("MIT-0", NONE),
+    ("Unlicense", NONE),
+    ("WTFPL", NONE),
+    ("AFL-3.0", NOTICE_PATENTS),
+    ("Apache-1.1", NOTICE),
+    ("Apache-2.0", NOTICE_PATENTS),
+    ("Artistic-2.0", NOTICE_PATENTS),
+    ("BlueOak-1.0.0", NOTICE_PATENTS),
+    ("BSD-2-Clause", NOTICE),
+    ("BSD-2-Clause-Patent", NOTICE_PATENTS),
+    ("BSD-3-Clause", NOTICE),
+    ("BSD-3-Clause-Clear", NOTICE),
+    ("BSD-4-Clause", NOTICE),
+    ("BSL-1.0", NOTICE),
+    ("CC-BY-3.0", NOTICE),
+    ("CC-BY-4.0", NOTICE),
+    ("ECL-2.0", NOTICE_PATENTS),
+    ("ISC", NOTICE),
+    ("MIT", NOTICE),
+    ("MS-PL", NOTICE_PATENTS),
+    ("NCSA", NOTICE),
+    ("OpenSSL", NOTICE),
+    ("PostgreSQL", NOTICE),
+    ("PSF-2.0", NOTICE),
+    ("Python-2.0", NOTICE),
+    ("UPL-1.0", NOTICE_PATENTS),
+    ("X11", NOTICE),
+    ("Zlib", NOTICE),
+    ("CC-BY-SA-3.0", SHARE_ALIKE),
+    ("CC-BY-SA-4.0", SHARE_ALIKE),
+    ("OFL-1.1", SHARE_ALIKE),
+    ("AGPL-3.0", COPYLEFT_PATENTS),
+    ("CDDL-1.0", COPYLEFT_PATENTS),
+    ("CDDL-1.1", COPYLEFT_PATENTS),
+    ("CECILL-2.1", COPYLEFT),
+    ("CPL-1.0", COPYLEFT_PATENTS),
+    ("EPL-1.0", COPYLEFT_PATENTS),
+    ("EPL-2.0", COPYLEFT_PATENTS),
+    ("EUPL-1.1", COPYLEFT_PATENTS),
+    ("EUPL-1.2", COPYLEFT_PATENTS),
+    ("GPL-2.0", COPYLEFT),
+    ("GPL-3.0", COPYLEFT_PATENTS),
+    ("LGPL-2.0", COPYLEFT),
+    ("LGPL-2.1", COPYLEFT),
+    ("LGPL-3.0", COPYLEFT_PATENTS),
+    ("MPL-1.1", COPYLEFT_PATENTS),
+    ("MPL-2.0", COPYLEFT_PATENTS),
+    ("MS-RL", COPYLEFT_PATENTS),
+    ("OSL-3.0", COPYLEFT_PATENTS),
+    ("SSPL-1.0", COPYLEFT_PATENTS),
+];
+
+/// SPDX identifiers of the licenses whose obligations are known
+pub fn known_licenses() -> impl Iterator<Item = &'static str> {
+    OBLIGATIONS.iter().map(|(id, _)| *id)
+}
+
+/// Obligations of a single license identifier, e.g. `GPL-2.0-or-later`
+pub fn license_obligations(license_id: &str) -> Option<Obligations> {
+    let id = license_id.trim().trim_end_matches('+');
+    let id = id
+        .strip_suffix("-only")
+        .or_else(|| id.strip_suffix("-or-later"))
+        .unwrap_or(id);
+    OBLIGATIONS
+        .iter()
+        .find(|(known, _)| known.eq_ignore_ascii_case(id))
+        .map(|(_, obligations)| *obligations)
+}
+
+/// Obligations of a license expression, `None` when every alternative
+/// includes a license missing from the table
+pub fn expression_obligations(license: &str) -> Option<Obligations> {
+    license_alternatives(license)
+        .iter()
+        .filter_map(|terms| {
+            terms.iter().try_fold(NONE, |obligations, term| {
+                license_obligations(&term.id).map(|term| obligations.union(term))
+            })
+        })
+        .min_by_key(Obligations::burden)
+}
+
+/// Set the obligations of every dependency, from the license the policy chose if any
+pub fn assign_obligations(dependencies: &mut [LicenseInfo]) {
+    for info in dependencies {
+        info.obligations = info
+            .chosen_license
+            .as_ref()
+            .or(info.license.as_ref())
+            .and_then(|license| expression_obligations(license));
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_license_obligations() {
+        assert_eq!(license_obligations("MIT"), Some(NOTICE));
+        assert_eq!(license_obligations("apache-2.0"), Some(NOTICE_PATENTS));
+        assert_eq!(license_obligations("GPL-2.0-or-later"), Some(COPYLEFT));
+        assert_eq!(license_obligations("LGPL-3.0+"), Some(COPYLEFT_PATENTS));
+        assert_eq!(license_obligations("LicenseRef-Proprietary"), None);
+        assert_eq!(
+            license_obligations("Apache-2.0").unwrap().summary(),
+            "attribution, patent grant"
+        );
+        assert_eq!(license_obligations("CC0-1.0").unwrap().summary(), "none");
+    }
+
+    #[test]
+    fn test_expression_obligations() {
+        // The least demanding alternative of an OR
+        assert_eq!(expression_obligations("GPL-3.0-only OR MIT"), Some(NOTICE));
+        // Terms of an AND add up
+        assert_eq!(
+            expression_obligations("MIT AND MPL-2.0"),
+            Some(COPYLEFT_PATENTS)
+        );
+        // An alternative with an unknown license is skipped
+        assert_eq!(
+            expression_obligations("LicenseRef-Custom OR LGPL-2.1-only"),
+            Some(COPYLEFT)
+        );
+        assert_eq!(expression_obligations("No License"), None);
+    }
+}
@@ -0,0 +1,487 @@
+//! Offline mode and the license database snapshot
+//!
+//! With `--offline` Feluda never opens a network connection. Licenses are
+//! resolved from lockfile metadata, vendored sources and the package cache,
+//! and anything a registry would normally answer is looked up in a license
+//! database snapshot instead. `feluda db download` writes that snapshot on a
+//! connected machine so it can be copied into an air-gapped environment.
+//!
+//! Each release also publishes a snapshot of the most popular packages of
+//! every ecosystem, signed by the release workflow. `feluda db update`
+//! installs it after checking the signature with cosign. An installed
+//! snapshot answers for the versions it knows in online scans too, which
+//! saves most registry requests.
+
+use rayon::prelude::*;
+use std::collections::{BTreeMap, HashMap};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Mutex, OnceLock};
+use std::time::SystemTime;
+
+use crate::cache;
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::license_text::{fetch_license_text_pack, LicenseTextPack};
+use crate::licenses::License;
+use crate::registry::{self, Registry};
+use crate::sbom::ingest::{fetch_purl_license, parse_purl, PackageUrl};
+use crate::signing::{verify_blob, Signer};
+
+const LICENSE_DB_FILE: &str = "license-db.json";
+const LICENSE_DB_VERSION: u32 = 1;
+
+/// Snapshot published with the latest release, see `feluda db update`
+pub const LICENSE_DB_URL: &str =
+    "https://github.com/anistark/feluda/releases/latest/download/license-db.json";
+
+/// Certificate identity of the release workflow that signs the published snapshot
+pub const RELEASE_SIGNER_IDENTITY: &str =
+    r"^https://github\.com/anistark/feluda/\.github/workflows/release-binaries\.yml@refs/tags/";
+
+/// OIDC issuer of GitHub Actions, for keyless signatures made in workflows
+pub const GITHUB_ACTIONS_ISSUER: &str = "https://token.actions.githubusercontent.com";
+
+/// Environment variables that keep package manager subprocesses off the network
+const OFFLINE_ENV: &[(&str, &str)] = &[
+    ("CARGO_NET_OFFLINE", "true"),
+    ("GOPROXY", "off"),
+    ("npm_config_offline", "true"),
+    ("UV_OFFLINE", "1"),
+    ("PIP_NO_INDEX", "1"),
+];
+
+static OFFLINE: AtomicBool = AtomicBool::new(false);
+static LICENSE_DB: OnceLock<LicenseDatabase> = OnceLock::new();
+
+/// Snapshot of everything Feluda otherwise fetches over the network
+#[derive(serde::Serialize, serde::Deserialize, Debug, Default)]
+pub struct LicenseDatabase {
+    #[serde(default)]
+    pub version: u32,
+    /// Unix timestamp of when the snapshot was taken
+    #[serde(default)]
+    pub created: u64,
+    /// The GitHub license catalogue, keyed by SPDX identifier
+    #[serde(default)]
+    pub github_licenses: HashMap<String, License>,
+    /// SPDX identifiers of OSI approved licenses
+    #[serde(default)]
+    pub osi_licenses: Vec<String>,
+    /// Registry licenses keyed by `ecosystem:name:version`, as in the package cache
+    #[serde(default)]
+    pub packages: BTreeMap<String, String>,
+    /// Licenses of the latest release keyed by `ecosystem:name`, for versions
+    /// missing from `packages` in offline scans
+    #[serde(default)]
+    pub latest: BTreeMap<String, String>,
+    /// The SPDX license list texts, for attribution files written offline
+    #[serde(default)]
+    pub license_texts: LicenseTextPack,
+}
+
+impl LicenseDatabase {
+    pub fn new() -> Self {
+        Self {
+            version: LICENSE_DB_VERSION,
+            created: SystemTime::now()
+                .duration_since(SystemTime::UNIX_EPOCH)
+                .map(|d| d.as_secs())
+                .unwrap_or(0),
+            ..Self::default()
+        }
+    }
+
+    pub fn load(path: &Path) -> FeludaResult<Self> {
+        let content = fs::read_to_string(path).map_err(|e| {
+            FeludaError::Config(format!(
+                "Failed to read license database {}: {e}",
+                path.display()
+            ))
+        })?;
+        let db: Self = serde_json::from_str(&content).map_err(|e| {
+            FeludaError::Parser(format!("Invalid license database {}: {e}", path.display()))
+        })?;
+        if db.version != LICENSE_DB_VERSION {
+            return Err(FeludaError::Parser(format!(
+                "Unsupported license database version {} in {} (expected {LICENSE_DB_VERSION}), run `feluda db download` again",
+                db.version,
+                path.display()
+            )));
+        }
+        Ok(db)
+    }
+
+    pub fn save(&self, path: &Path) -> FeludaResult<()> {
+        if let Some(parent) = path.parent().filter(|p| !p.as_os_str().is_empty()) {
+            fs::create_dir_all(parent)?;
+        }
+        let content = serde_json::to_string_pretty(self).map_err(|e| {
+            FeludaError::Parser(format!("Failed to serialize license database: {e}"))
+        })?;
+        fs::write(path, content).map_err(|e| {
+            FeludaError::FileWrite(format!(
+                "Failed to write license database {}: {e}",
+                path.display()
+            ))
+        })
+    }
+
+    fn package_license(&self, key: &str) -> Option<&str> {
+        self.packages.get(key).map(String::as_str)
+    }
+
+    fn latest_license(&self, ecosystem: &str, name: &str) -> Option<&str> {
+        self.latest
+            .get(&format!("{ecosystem}:{name}"))
+            .map(String::as_str)
+    }
+}
+
+/// Forbid all network access for the rest of the run (`--offline`)
+pub fn set_offline(offline: bool) {
+    OFFLINE.store(offline, Ordering::Relaxed);
+    if offline {
+        for (key, value) in OFFLINE_ENV {
+            if std::env::var_os(key).is_none() {
+                std::env::set_var(key, value);
+            }
+        }
+    }
+}
+
+pub fn is_offline() -> bool {
+    OFFLINE.load(Ordering::Relaxed)
+}
+
+/// Where `feluda db download` writes the snapshot unless told otherwise
+pub fn default_license_db_path() -> FeludaResult<PathBuf> {
+    Ok(cache::cache_dir_path()?.join(LICENSE_DB_FILE))
+}
+
+/// Load the license database snapshot
+///
+/// An explicit `path` (`--license-db`) must exist. Without one, the snapshot
+/// in the cache directory is used if `feluda db download` or `feluda db update`
+/// wrote one there.
+pub fn load_license_db(path: Option<&str>) -> FeludaResult<()> {
+    let path = match path {
+        Some(path) => PathBuf::from(path),
+        None => match default_license_db_path() {
+            Ok(path) if path.exists() => path,
+            _ => {
+                log(
+                    LogLevel::Info,
+                    "No license database found, relying on lockfile metadata and the cache",
+                );
+                return Ok(());
+            }
+        },
+    };
+
+    let db = LicenseDatabase::load(&path)?;
+    log(
+        LogLevel::Info,
+        &format!(
+            "Loaded license database {} ({} licenses, {} packages, {} license texts)",
+            path.display(),
+            db.github_licenses.len(),
+            db.packages.len(),
+            db.license_texts.texts.len()
+        ),
+    );
+    if LICENSE_DB.set(db).is_err() {
+        log(LogLevel::Warn, "License database already loaded, ignoring");
+    }
+    Ok(())
+}
+
+/// The license database loaded with [`load_license_db`], if any
+pub fn license_db() -> Option<&'static LicenseDatabase> {
+    LICENSE_DB.get()
+}
+
+/// Look up a registry license by its package cache key in the license database
+pub fn db_package_license(key: &str) -> Option<String> {
+    license_db()?.package_license(key).map(String::from)
+}
+
+/// The license of the latest release of a package in the license database
+pub fn db_latest_license(ecosystem: &str, name: &str) -> Option<String> {
+    license_db()?
+        .latest_license(ecosystem, name)
+        .map(String::from)
+}
+
+/// Read a list of packages to snapshot, one package URL per line, most popular first
+///
+/// Only the first `top` packages of each ecosystem are kept. Blank lines and
+/// lines starting with `#` are skipped.
+pub fn read_package_list(path: &Path, top: usize) -> FeludaResult<Vec<PackageUrl>> {
+    let content = fs::read_to_string(path).map_err(|e| {
+        FeludaError::Config(format!(
+            "Failed to read package list {}: {e}",
+            path.display()
+        ))
+    })?;
+
+    let mut per_type: HashMap<String, usize> = HashMap::new();
+    let mut packages = Vec::new();
+    for (index, line) in content.lines().enumerate() {
+        let line = line.trim();
+        if line.is_empty() || line.starts_with('#') {
+            continue;
+        }
+        let Some(purl) = parse_purl(line).filter(|purl| purl.cache_key().is_some()) else {
+            return Err(FeludaError::Config(format!(
+                "{}:{}: expected the package URL of a supported ecosystem, e.g. pkg:npm/react, found '{line}'",
+                path.display(),
+                index + 1
+            )));
+        };
+        let count = per_type.entry(purl.package_type.clone()).or_default();
+        if *count < top {
+            *count += 1;
+            packages.push(purl);
+        }
+    }
+    Ok(packages)
+}
+
+/// Look up the licenses of `packages`, so that a snapshot built next includes them
+///
+/// Packages without a version are resolved to their latest release on
+/// deps.dev, whose license is returned keyed by `ecosystem:name` for
+/// [`LicenseDatabase::latest`].
+pub fn fetch_package_licenses(packages: &[PackageUrl]) -> BTreeMap<String, String> {
+    let latest = Mutex::new(BTreeMap::new());
+    packages.par_iter().for_each(|purl| {
+        let Some((ecosystem, name)) = purl.cache_key() else {
+            return;
+        };
+        let version = match &purl.version {
+            Some(version) => version.clone(),
+            None => {
+                let Some(version) = crate::deps_dev::purl_system(&purl.package_type)
+                    .and_then(|system| crate::deps_dev::default_version(system, &name))
+                else {
+                    log(
+                        LogLevel::Warn,
+                        &format!("No latest version found for {ecosystem} package {name}"),
+                    );
+                    return;
+                };
+                version
+            }
+        };
+
+        match fetch_purl_license(purl, &version) {
+            Some(license) if purl.version.is_none() => {
+                if let Ok(mut latest) = latest.lock() {
+                    latest.insert(format!("{ecosystem}:{name}"), license);
+                }
+            }
+            Some(_) => {}
+            None => log(
+                LogLevel::Warn,
+                &format!("No license found for {ecosystem} package {name}@{version}"),
+            ),
+        }
+    });
+    latest.into_inner().unwrap_or_default()
+}
+
+/// Build a snapshot from the license catalogues and the package cache
+///
+/// Used by `feluda db download`; the caller scans any projects first so their
+/// registry licenses are in the package cache. Packages of the snapshot in use
+/// are kept, since lookups it answered never reached the cache.
+pub fn build_license_db() -> LicenseDatabase {
+    let mut db = LicenseDatabase::new();
+
+    match crate::licenses::fetch_licenses_from_github() {
+        Ok(licenses) => db.github_licenses = licenses,
+        Err(e) => log_error("Failed to fetch licenses from GitHub", &e),
+    }
+    match crate::licenses::fetch_osi_licenses() {
+        Ok(osi) => {
+            db.osi_licenses = osi.into_keys().collect();
+            db.osi_licenses.sort();
+        }
+        Err(e) => log_error("Failed to fetch OSI licenses", &e),
+    }
+    match fetch_license_text_pack() {
+        Ok(pack) => db.license_texts = pack,
+        Err(e) => log_error("Failed to fetch SPDX license texts", &e),
+    }
+    if let Some(current) = license_db() {
+        db.packages = current.packages.clone();
+        db.latest = current.latest.clone();
+        if db.license_texts.is_empty() {
+            db.license_texts = current.license_texts.clone();
+        }
+    }
+    db.packages.extend(cache::cached_package_licenses());
+
+    db
+}
+
+/// Where `feluda db update` gets a snapshot from, and who must have signed it
+#[derive(Debug, Clone)]
+pub struct UpdateOptions {
+    pub url: String,
+    pub output: PathBuf,
+    /// `None` installs the snapshot without checking its signature
+    pub signer: Option<Signer>,
+}
+
+fn download(url: &str) -> FeludaResult<Vec<u8>> {
+    let response = registry::get(Registry::LicenseDb, url)
+        .map_err(|e| FeludaError::Unknown(format!("Failed to download {url}: {e}")))?;
+    if !response.status().is_success() {
+        return Err(FeludaError::Unknown(format!(
+            "Failed to download {url}: {}",
+            response.status()
+        )));
+    }
+    response
+        .bytes()
+        .map(|bytes| bytes.to_vec())
+        .map_err(|e| FeludaError::Unknown(format!("Failed to download {url}: {e}")))
+}
+
+/// Download a published snapshot, verify its cosign bundle (`<url>.sigstore.json`)
+/// and install it at `output`
+///
+/// Returns the installed snapshot and whether it replaced an older one; a
+/// snapshot that isn't newer than the installed one is left alone.
+pub fn update_license_db(options: &UpdateOptions) -> FeludaResult<(LicenseDatabase, bool)> {
+    let dir = options
+        .output
+        .parent()
+        .filter(|dir| !dir.as_os_str().is_empty())
+        .unwrap_or(Path::new("."));
+    fs::create_dir_all(dir)?;
+
+    log(
+        LogLevel::Info,
+        &format!("Downloading license database from {}", options.url),
+    );
+    let snapshot = tempfile::NamedTempFile::new_in(dir)?;
+    fs::write(snapshot.path(), download(&options.url)?)?;
+
+    match &options.signer {
+        Some(signer) => {
+            let bundle = tempfile::NamedTempFile::new_in(dir)?;
+            fs::write(
+                bundle.path(),
+                download(&format!("{}.sigstore.json", options.url))?,
+            )?;
+            verify_blob(snapshot.path(), bundle.path(), signer)?;
+            log(LogLevel::Info, "License database signature verified");
+        }
+        None => log(
+            LogLevel::Warn,
+            "Installing the license database without verifying its signature",
+        ),
+    }
+
+    let db = LicenseDatabase::load(snapshot.path())?;
+    if let Ok(installed) = LicenseDatabase::load(&options.output) {
+        if installed.created >= db.created {
+            return Ok((installed, false));
+        }
+    }
+    snapshot.persist(&options.output).map_err(|e| {
+        FeludaError::FileWrite(format!(
+            "Failed to write license database {}: {e}",
+            options.output.display()
+        ))
+    })?;
+    Ok((db, true))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_license_db_round_trip() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("nested").join("license-db.json");
+
+        let mut db = LicenseDatabase::new();
+        db.osi_licenses = vec!["MIT".to_string()];
+        db.packages
+            .insert("npm:left-pad:1.3.0".to_string(), "WTFPL".to_string());
+        db.save(&path).unwrap();
+
+        let loaded = LicenseDatabase::load(&path).unwrap();
+        assert_eq!(loaded.osi_licenses, vec!["MIT"]);
+        assert_eq!(loaded.package_license("npm:left-pad:1.3.0"), Some("WTFPL"));
+        assert_eq!(loaded.package_license("npm:left-pad:1.2.0"), None);
+    }
+
+    #[test]
+    fn test_latest_license_of_package() {
+        let mut db = LicenseDatabase::new();
+        db.latest.insert(
+            "crates.io:serde".to_string(),
+            "MIT OR Apache-2.0".to_string(),
+        );
+        assert_eq!(
+            db.latest_license("crates.io", "serde"),
+            Some("MIT OR Apache-2.0")
+        );
+        assert_eq!(db.latest_license("npm", "serde"), None);
+
+        // Snapshots written before `latest` existed still load
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("license-db.json");
+        fs::write(
+            &path,
+            r#"{"version": 1, "packages": {"npm:a:1.0.0": "MIT"}}"#,
+        )
+        .unwrap();
+        assert!(LicenseDatabase::load(&path).unwrap().latest.is_empty());
+    }
+
+    #[test]
+    fn test_read_package_list() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("packages.txt");
+        fs::write(
+            &path,
+            "# Most downloaded first\npkg:npm/react\npkg:cargo/serde\n\npkg:npm/%40types/node@20.1.0\npkg:npm/lodash\n",
+        )
+        .unwrap();
+
+        let packages = read_package_list(&path, 2).unwrap();
+        let names: Vec<String> = packages
+            .iter()
+            .filter_map(|purl| {
+                purl.cache_key()
+                    .map(|(ecosystem, name)| format!("{ecosystem}:{name}"))
+            })
+            .collect();
+        assert_eq!(
+            names,
+            vec!["npm:react", "crates.io:serde", "npm:@types/node"]
+        );
+        assert_eq!(packages[2].version.as_deref(), Some("20.1.0"));
+
+        fs::write(&path, "pkg:npm/react\nreact\n").unwrap();
+        let err = read_package_list(&path, 10).unwrap_err().to_string();
+        assert!(err.contains(":2:"), "{err}");
+    }
+
+    #[test]
+    fn test_license_db_rejects_other_versions() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("license-db.json");
+        fs::write(&path, r#"{"version": 99, "packages": {}}"#).unwrap();
+
+        assert!(LicenseDatabase::load(&path).is_err());
+    }
+}
@@ -0,0 +1,139 @@
+//! Manual license determinations
+//!
+//! When the license of a dependency cannot be detected, a reviewer can record
+//! it in the `[overrides]` section of `.feluda.toml`:
+//!
+//! ```toml
+//! [overrides."left-pad@1.3.0"]
+//! license = "WTFPL"
+//! reviewed_by = "jane.doe@example.com"
+//! date = "2025-03-14"
+//! ```
+//!
+//! The asserted license replaces the detected one before ignore rules,
+//! compatibility and policy are evaluated, and the dependency carries a
+//! [`ManualLicense`] so reports can tell it apart from detected licenses.
+
+use std::collections::HashMap;
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_error, LogLevel};
+use crate::licenses::{
+    fetch_licenses_from_github, get_osi_status, is_license_restrictive, LicenseInfo, ManualLicense,
+};
+
+/// Replace the license of every dependency that has an entry in `[overrides]`
+pub fn apply_license_overrides(dependencies: &mut [LicenseInfo], config: &FeludaConfig) {
+    if config.overrides.is_empty() {
+        return;
+    }
+
+    let mut known_licenses = None;
+    for info in dependencies.iter_mut() {
+        let Some(entry) = config.license_override_for(&info.name, &info.version) else {
+            continue;
+        };
+
+        if !info.has_unknown_license() && info.license.as_deref() != Some(entry.license.as_str()) {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Override for {}@{} replaces the detected license {}",
+                    info.name,
+                    info.version,
+                    info.get_license()
+                ),
+            );
+        } else {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Using manually asserted license {} for {}@{}",
+                    entry.license, info.name, info.version
+                ),
+            );
+        }
+
+        let known = known_licenses.get_or_insert_with(|| {
+            fetch_licenses_from_github().unwrap_or_else(|err| {
+                log_error("Failed to fetch licenses from GitHub", &err);
+                HashMap::new()
+            })
+        });
+        info.manual_license = Some(ManualLicense {
+            detected: info.license.take(),
+            reviewed_by: entry.reviewed_by.clone(),
+            date: entry.date.clone(),
+            reason: entry.reason.clone(),
+        });
+        info.license = Some(entry.license.clone());
+        info.license_confidence = None;
+        info.is_restrictive = is_license_restrictive(&info.license, known, config.strict);
+        info.osi_status = get_osi_status(&entry.license);
+    }
+
+    for package in config.overrides.keys() {
+        let matched = dependencies.iter().any(|info| {
+            info.name == *package || format!("{}@{}", info.name, info.version) == *package
+        });
+        if !matched {
+            log(
+                LogLevel::Info,
+                &format!("No dependency matched [overrides.\"{package}\"]"),
+            );
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::LicenseOverride;
+    use crate::licenses::OsiStatus;
+
+    fn dep(name: &str, version: &str, license: Option<&str>) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: license.is_none(),
+            license_confidence: Some(0.5),
+            ..LicenseInfo::test(name, version, license)
+        }
+    }
+
+    #[test]
+    fn test_apply_license_overrides() {
+        let mut config = FeludaConfig::default();
+        config.overrides.insert(
+            "left-pad@1.3.0".to_string(),
+            LicenseOverride {
+                license: "MIT".to_string(),
+                reviewed_by: Some("jane.doe@example.com".to_string()),
+                date: Some("2025-03-14".to_string()),
+                reason: None,
+            },
+        );
+
+        let mut dependencies = vec![
+            dep("left-pad", "1.3.0", Some("Unknown license (npm: left-pad)")),
+            dep("left-pad", "1.3.1", None),
+        ];
+        apply_license_overrides(&mut dependencies, &config);
+
+        let reviewed = &dependencies[0];
+        assert_eq!(reviewed.license.as_deref(), Some("MIT"));
+        assert!(reviewed.is_manually_asserted());
+        assert!(!reviewed.has_unknown_license());
+        assert!(!reviewed.is_restrictive);
+        assert_eq!(reviewed.license_confidence, None);
+        assert_eq!(reviewed.osi_status, OsiStatus::Approved);
+        let manual = reviewed.manual_license.as_ref().unwrap();
+        assert_eq!(
+            manual.detected.as_deref(),
+            Some("Unknown license (npm: left-pad)")
+        );
+        assert_eq!(manual.reviewed_by.as_deref(), Some("jane.doe@example.com"));
+
+        // A new version is not covered by the review
+        assert!(!dependencies[1].is_manually_asserted());
+        assert!(dependencies[1].has_unknown_license());
+    }
+}
@@ -1,20 +1,52 @@
 //! Core parsing coordination and project discovery functionality
 
 use crate::cli;
-use crate::debug::{log, log_debug, FeludaResult, LogLevel};
+use crate::config::WorkspaceConfig;
+use crate::debug::{log, log_debug, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, attach_dependency_scopes,
+};
+use crate::image::analyze_image_filesystem;
+use crate::languages::{
+    bazel::{self, analyze_bazel_licenses},
+    c::analyze_c_licenses,
+    cpp::analyze_cpp_licenses,
+    dart::analyze_dart_licenses,
+    dotnet::analyze_dotnet_licenses,
+    elixir::analyze_elixir_licenses,
+    go::analyze_go_licenses,
+    guix::{self, analyze_guix_licenses},
+    haskell::{self, analyze_haskell_licenses},
+    java::analyze_java_licenses,
+    nix::{self, analyze_nix_licenses},
+    node::analyze_js_licenses_with_no_local,
+    ocaml::{self, analyze_ocaml_licenses},
+    php::analyze_php_licenses,
+    python::analyze_python_licenses,
+    r::analyze_r_licenses,
+    ruby::analyze_ruby_licenses,
+    rust::{analyze_cargo_lock, analyze_rust_licenses_with_no_local, metadata_dependency_graph},
+    swift::{self, analyze_swift_licenses},
+    terraform::{self, analyze_terraform_licenses},
+};
 use crate::languages::{
-    c::analyze_c_licenses, cpp::analyze_cpp_licenses, dotnet::analyze_dotnet_licenses,
-    go::analyze_go_licenses, node::analyze_js_licenses_with_no_local,
-    python::analyze_python_licenses, r::analyze_r_licenses,
-    rust::analyze_rust_licenses_with_no_local,
+    Language, CPP_PATHS, C_PATHS, DOTNET_PATHS, JAVA_PATHS, PYTHON_PATHS, R_PATHS,
 };
-use crate::languages::{Language, CPP_PATHS, C_PATHS, DOTNET_PATHS, PYTHON_PATHS, R_PATHS};
 use crate::licenses::{
-    detect_project_license, is_license_compatible, LicenseCompatibility, LicenseInfo,
+    detect_project_license, is_license_compatible_with_overrides, LicenseCompatibility, LicenseInfo,
 };
+use crate::plugins::{analyze_plugin_project, find_plugin_projects, PluginProject};
+use crate::sbom::ingest::{analyze_purls, analyze_sbom};
+use crate::scan::{with_dependency_progress, ProgressCallback, ScanProgress};
+use crate::vendored::analyze_vendored_dependencies;
 use cargo_metadata::MetadataCommand;
+use ignore::gitignore::{Gitignore, GitignoreBuilder};
+use ignore::WalkBuilder;
 use rayon::prelude::*;
 use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::Mutex;
+use std::time::Instant;
 
 /// Project root information
 #[derive(Debug)]
@@ -24,7 +56,12 @@ struct ProjectRoot {
 }
 
 /// Find project files only in the root directory (not recursive)
-fn find_project_roots(root_path: impl AsRef<Path>) -> FeludaResult<Vec<ProjectRoot>> {
+///
+/// Manifests matching an `exclude` pattern are skipped.
+fn find_project_roots(
+    root_path: impl AsRef<Path>,
+    exclude: &Gitignore,
+) -> FeludaResult<Vec<ProjectRoot>> {
     let mut project_roots = Vec::new();
     let root = root_path.as_ref();
 
@@ -37,7 +74,13 @@ fn find_project_roots(root_path: impl AsRef<Path>) -> FeludaResult<Vec<ProjectRo
     if let Ok(entries) = std::fs::read_dir(root) {
         for entry in entries.filter_map(|e| e.ok()) {
             if let Ok(file_type) = entry.file_type() {
-                if !file_type.is_file() {
+                // Xcode projects and workspaces are directories
+                let is_xcode_bundle = file_type.is_dir()
+                    && entry
+                        .file_name()
+                        .to_str()
+                        .is_some_and(swift::is_xcode_bundle);
+                if !file_type.is_file() && !is_xcode_bundle {
                     continue;
                 }
             } else {
@@ -47,6 +90,14 @@ fn find_project_roots(root_path: impl AsRef<Path>) -> FeludaResult<Vec<ProjectRo
             let path = entry.path();
             let file_name = path.file_name().and_then(|n| n.to_str()).unwrap_or("");
 
+            if exclude.matched(&path, !path.is_file()).is_ignore() {
+                log(
+                    LogLevel::Info,
+                    &format!("Skipping excluded project file: {}", path.display()),
+                );
+                continue;
+            }
+
             if let Some(project_type) = Language::from_file_name(file_name) {
                 log(
                     LogLevel::Info,
@@ -56,6 +107,13 @@ fn find_project_roots(root_path: impl AsRef<Path>) -> FeludaResult<Vec<ProjectRo
                         project_type
                     ),
                 );
+                // Several manifests of one ecosystem (e.g. pom.xml and build.gradle) are one project
+                if project_roots
+                    .iter()
+                    .any(|r: &ProjectRoot| r.project_type == project_type)
+                {
+                    continue;
+                }
                 project_roots.push(ProjectRoot {
                     path: root.to_path_buf(),
                     project_type,
@@ -73,6 +131,195 @@ fn find_project_roots(root_path: impl AsRef<Path>) -> FeludaResult<Vec<ProjectRo
     Ok(project_roots)
 }
 
+/// Dependency and virtual environment folders never searched for projects
+pub const SKIPPED_DIRS: [&str; 6] = [
+    "node_modules",
+    "bower_components",
+    "target",
+    "vendor",
+    "venv",
+    "__pycache__",
+];
+
+/// Lockfiles that make a nested package.json a project of its own
+const NODE_LOCKFILES: [&str; 4] = [
+    "package-lock.json",
+    "yarn.lock",
+    "pnpm-lock.yaml",
+    "bun.lock",
+];
+
+/// Find projects in the root directory, or in all subdirectories when `workspace.recursive` is set
+fn discover_project_roots(
+    root_path: impl AsRef<Path>,
+    workspace: &WorkspaceConfig,
+) -> FeludaResult<Vec<ProjectRoot>> {
+    let root = root_path.as_ref();
+    let exclude = workspace_patterns(root, &workspace.exclude)?;
+    if !workspace.recursive {
+        return find_project_roots(root, &exclude);
+    }
+
+    log(
+        LogLevel::Info,
+        &format!("Recursively discovering projects in: {}", root.display()),
+    );
+
+    let mut project_roots: Vec<ProjectRoot> = Vec::new();
+    for dir in workspace_dirs(root, workspace)? {
+        for project in find_project_roots(&dir, &exclude)? {
+            if is_workspace_member(&project, &project_roots) {
+                log(
+                    LogLevel::Info,
+                    &format!(
+                        "Skipping {:?} project in {}, covered by an enclosing project",
+                        project.project_type,
+                        project.path.display()
+                    ),
+                );
+                continue;
+            }
+            project_roots.push(project);
+        }
+    }
+
+    log(
+        LogLevel::Info,
+        &format!("Discovered {} projects", project_roots.len()),
+    );
+    Ok(project_roots)
+}
+
+/// Find the manifests of the configured parser plugins, see [`crate::plugins`]
+fn discover_plugin_projects(
+    root: &Path,
+    config: &crate::config::FeludaConfig,
+) -> FeludaResult<Vec<PluginProject>> {
+    if config.plugins.is_empty() {
+        return Ok(Vec::new());
+    }
+    let dirs = if config.workspace.recursive {
+        workspace_dirs(root, &config.workspace)?
+    } else {
+        vec![root.to_path_buf()]
+    };
+    Ok(dirs
+        .iter()
+        .flat_map(|dir| find_plugin_projects(dir, &config.plugins))
+        .collect())
+}
+
+/// Directories searched for projects by a recursive scan, parents first
+fn workspace_dirs(root: &Path, workspace: &WorkspaceConfig) -> FeludaResult<Vec<PathBuf>> {
+    let include = workspace_patterns(root, &workspace.include)?;
+    let exclude = workspace_patterns(root, &workspace.exclude)?;
+
+    let walker = WalkBuilder::new(root)
+        .filter_entry(move |entry| {
+            let name = entry.file_name().to_str().unwrap_or_default();
+            entry
+                .file_type()
+                .is_some_and(|file_type| file_type.is_dir())
+                && !SKIPPED_DIRS.contains(&name)
+                && !exclude.matched(entry.path(), true).is_ignore()
+        })
+        .build();
+
+    let mut dirs = Vec::new();
+    for entry in walker {
+        let entry = match entry {
+            Ok(entry) => entry,
+            Err(err) => {
+                log_error("Failed to read directory", &err);
+                continue;
+            }
+        };
+        let dir = entry.path();
+        if !include.is_empty() && !include.matched_path_or_any_parents(dir, true).is_ignore() {
+            continue;
+        }
+        dirs.push(dir.to_path_buf());
+    }
+    Ok(dirs)
+}
+
+pub(crate) fn workspace_patterns(root: &Path, patterns: &[String]) -> FeludaResult<Gitignore> {
+    let mut builder = GitignoreBuilder::new(root);
+    for pattern in patterns {
+        builder.add_line(None, pattern).map_err(|e| {
+            FeludaError::Config(format!("Invalid workspace pattern '{pattern}': {e}"))
+        })?;
+    }
+    builder
+        .build()
+        .map_err(|e| FeludaError::Config(format!("Invalid workspace patterns: {e}")))
+}
+
+/// Whether a nested project belongs to an enclosing project of the same ecosystem
+///
+/// Cargo and npm workspace members share the lockfile of the workspace root,
+/// which already covers their dependencies. Nested Maven or Gradle modules and
+/// C/C++ build files and Bazel modules are treated as part of the outer build.
+fn is_workspace_member(project: &ProjectRoot, found: &[ProjectRoot]) -> bool {
+    let enclosed = found.iter().any(|outer| {
+        outer.project_type == project.project_type
+            && outer.path != project.path
+            && project.path.starts_with(&outer.path)
+    });
+    if !enclosed {
+        return false;
+    }
+
+    match project.project_type {
+        Language::Rust(_) => !project.path.join("Cargo.lock").exists(),
+        Language::Node(_) => !NODE_LOCKFILES
+            .iter()
+            .any(|lockfile| project.path.join(lockfile).exists()),
+        Language::C(_) | Language::Cpp(_) | Language::Java(_) => true,
+        // Projects under a paket.lock are already covered by it
+        Language::DotNet(_) => found.iter().any(|outer| {
+            outer.project_type == project.project_type
+                && outer.path != project.path
+                && project.path.starts_with(&outer.path)
+                && outer.path.join("paket.lock").exists()
+        }),
+        // Umbrella apps are aggregated into the umbrella's report, and
+        // projects under deps/ are dependencies fetched by Mix
+        Language::Elixir(_) => true,
+        // Nested Swift projects are package checkouts under .build or the
+        // workspace inside an Xcode project
+        Language::Swift(_) => true,
+        // Local modules share the providers locked by the root configuration
+        Language::Terraform(_) => !project.path.join(terraform::TERRAFORM_LOCKFILE).exists(),
+        // Nested modules are overrides or examples of the enclosing workspace
+        Language::Bazel(_) => true,
+        _ => false,
+    }
+}
+
+/// Check which Java build file exists in the given path
+fn check_which_java_file_exists(project_path: impl AsRef<Path>) -> Option<String> {
+    for &path in JAVA_PATHS.iter() {
+        let full_path = Path::new(project_path.as_ref()).join(path);
+        if full_path.exists() {
+            log(
+                LogLevel::Info,
+                &format!("Found Java build file: {}", full_path.display()),
+            );
+            return Some(path.to_string());
+        }
+    }
+
+    log(
+        LogLevel::Warn,
+        &format!(
+            "No Java build file found in: {}",
+            project_path.as_ref().display()
+        ),
+    );
+    None
+}
+
 /// Check which C project file exists in the given path
 fn check_which_c_file_exists(project_path: impl AsRef<Path>) -> Option<String> {
     for &path in C_PATHS.iter() {
@@ -221,6 +468,17 @@ pub fn parse_root_with_config(
     language: Option<&str>,
     config: &crate::config::FeludaConfig,
     no_local: bool,
+) -> FeludaResult<Vec<LicenseInfo>> {
+    parse_root_with_progress(root_path, language, config, no_local, None)
+}
+
+/// Parse project dependencies, reporting every analyzed project to `progress`
+pub fn parse_root_with_progress(
+    root_path: impl AsRef<Path>,
+    language: Option<&str>,
+    config: &crate::config::FeludaConfig,
+    no_local: bool,
+    progress: Option<&ProgressCallback>,
 ) -> FeludaResult<Vec<LicenseInfo>> {
     log(
         LogLevel::Info,
@@ -230,71 +488,99 @@ pub fn parse_root_with_config(
         log(LogLevel::Info, &format!("Filtering by language: {lang}"));
     }
 
-    let project_roots = find_project_roots(&root_path)?;
+    let licenses = if config.dependencies.vendored {
+        log(LogLevel::Info, "Reading vendored dependencies only");
+        analyze_vendored_dependencies(root_path.as_ref(), config)
+    } else {
+        match parse_project_roots(root_path.as_ref(), language, config, no_local, progress)? {
+            Some(licenses) => licenses,
+            None => return Ok(Vec::new()),
+        }
+    };
 
-    if project_roots.is_empty() {
-        log(
-            LogLevel::Warn,
-            "No project files found in the specified path",
-        );
-        println!(
-            "❌ No supported project files found.\n\
-            Feluda supports: C, C++, .NET, Rust, Node.js, Go, Python, R"
-        );
-        return Ok(Vec::new());
-    }
+    Ok(finish_dependencies(licenses, root_path.as_ref(), config))
+}
 
-    let licenses: Vec<LicenseInfo> = project_roots
-        .into_par_iter()
-        .filter_map(|root| {
-            if let Some(language) = language {
-                if !matches_language(root.project_type, language) {
-                    log(
-                        LogLevel::Info,
-                        &format!(
-                            "Skipping {:?} project (language filter: {})",
-                            root.project_type, language
-                        ),
-                    );
-                    return None;
-                }
-            }
+/// Analyze the packages installed in a container image's root filesystem
+///
+/// Ignore rules, scope filters and compatibility checks apply as for projects.
+pub fn parse_image_root_with_config(
+    root_path: impl AsRef<Path>,
+    config: &crate::config::FeludaConfig,
+) -> FeludaResult<Vec<LicenseInfo>> {
+    log(
+        LogLevel::Info,
+        &format!("Parsing image filesystem: {}", root_path.as_ref().display()),
+    );
+    let licenses = analyze_image_filesystem(root_path.as_ref(), config);
+    Ok(finish_dependencies(licenses, root_path.as_ref(), config))
+}
 
-            match parse_dependencies(&root, config, no_local) {
-                Ok(deps) => {
-                    log(
-                        LogLevel::Info,
-                        &format!(
-                            "Found {} dependencies in {}",
-                            deps.len(),
-                            root.path.display()
-                        ),
-                    );
-                    Some(deps)
-                }
-                Err(err) => {
-                    log(
-                        LogLevel::Error,
-                        &format!(
-                            "Error parsing dependencies in {}: {}",
-                            root.path.display(),
-                            err
-                        ),
-                    );
-                    None
-                }
-            }
-        })
-        .flatten()
-        .collect();
+/// Analyze the Go modules compiled into `binary` instead of scanning `root_path`
+pub fn parse_binary_with_config(
+    root_path: impl AsRef<Path>,
+    binary: impl AsRef<Path>,
+    config: &crate::config::FeludaConfig,
+) -> FeludaResult<Vec<LicenseInfo>> {
+    let licenses = crate::binary::analyze_go_binary(binary.as_ref(), config)?;
+    Ok(finish_dependencies(licenses, root_path.as_ref(), config))
+}
 
+/// Analyze the libraries bundled into the JavaScript at `bundle` instead of scanning `root_path`
+pub fn parse_bundle_with_config(
+    root_path: impl AsRef<Path>,
+    bundle: impl AsRef<Path>,
+    config: &crate::config::FeludaConfig,
+) -> FeludaResult<Vec<LicenseInfo>> {
+    let licenses = crate::bundle::analyze_bundles(bundle.as_ref(), root_path.as_ref(), config)?;
+    Ok(finish_dependencies(licenses, root_path.as_ref(), config))
+}
+
+/// Analyze the components of an existing SBOM instead of scanning `root_path`
+pub fn parse_sbom_with_config(
+    root_path: impl AsRef<Path>,
+    sbom_path: impl AsRef<Path>,
+    config: &crate::config::FeludaConfig,
+) -> FeludaResult<Vec<LicenseInfo>> {
+    log(
+        LogLevel::Info,
+        &format!(
+            "Reading dependencies from SBOM: {}",
+            sbom_path.as_ref().display()
+        ),
+    );
+    let licenses = analyze_sbom(sbom_path.as_ref(), config)?;
+    Ok(finish_dependencies(licenses, root_path.as_ref(), config))
+}
+
+/// Look up the packages given by their package URL instead of scanning `root_path`
+pub fn parse_packages_with_config(
+    root_path: impl AsRef<Path>,
+    purls: &[String],
+    config: &crate::config::FeludaConfig,
+) -> FeludaResult<Vec<LicenseInfo>> {
+    let licenses = analyze_purls(purls, config)?;
+    Ok(finish_dependencies(licenses, root_path.as_ref(), config))
+}
+
+/// Fall back to deps.dev, apply custom licenses, overrides, ignore rules and
+/// scope filters, then check compatibility
+fn finish_dependencies(
+    licenses: Vec<LicenseInfo>,
+    root_path: &Path,
+    config: &crate::config::FeludaConfig,
+) -> Vec<LicenseInfo> {
     log(
         LogLevel::Info,
         &format!("Total dependencies found: {}", licenses.len()),
     );
 
-    // Filter out ignored licenses
     let mut licenses = licenses;
+    crate::deps_dev::apply_deps_dev_fallback(&mut licenses, config);
+    crate::custom_licenses::apply_custom_licenses(&mut licenses, config);
+    crate::overrides::apply_license_overrides(&mut licenses, config);
+
+    // Filter out ignored licenses
     let ignored_count = licenses.len();
     licenses.retain(|license| !crate::licenses::is_license_ignored(license.license.as_deref()));
     let filtered_count = licenses.len();
@@ -328,29 +614,252 @@ pub fn parse_root_with_config(
         );
     }
 
+    if config.dependencies.exclude_dev || !config.dependencies.scopes.is_empty() {
+        let before = licenses.len();
+        licenses.retain(|dep| config.dependencies.includes_scope(dep.scope));
+        if licenses.len() != before {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Filtered out {} dependencies by scope, {} remaining",
+                    before - licenses.len(),
+                    licenses.len()
+                ),
+            );
+        }
+    }
+
     // Set license compatibility based on project license
-    let project_license =
-        detect_project_license(root_path.as_ref().to_str().unwrap_or("")).unwrap_or(None);
+    let project_license = config
+        .project
+        .license
+        .clone()
+        .or_else(|| detect_project_license(root_path.to_str().unwrap_or("")).unwrap_or(None));
 
-    set_license_compatibility(&mut licenses, &project_license);
+    set_license_compatibility(&mut licenses, &project_license, config);
 
-    Ok(licenses)
+    if let Err(err) = crate::cache::save_package_cache() {
+        log_error("Failed to save package license cache", &err);
+    }
+    if let Err(err) = crate::repository_license::save_response_cache() {
+        log_error("Failed to save repository license cache", &err);
+    }
+
+    licenses
+}
+
+/// Analyze every project found under `root_path`, or `None` when there is none
+fn parse_project_roots(
+    root_path: &Path,
+    language: Option<&str>,
+    config: &crate::config::FeludaConfig,
+    no_local: bool,
+    progress: Option<&ProgressCallback>,
+) -> FeludaResult<Option<Vec<LicenseInfo>>> {
+    let project_roots = discover_project_roots(root_path, &config.workspace)?;
+    let plugin_projects = discover_plugin_projects(root_path, config)?;
+
+    if project_roots.is_empty() && plugin_projects.is_empty() {
+        log(
+            LogLevel::Warn,
+            "No project files found in the specified path",
+        );
+        println!(
+            "❌ No supported project files found.\n\
+            Feluda supports: C, C++, .NET, Rust, Node.js, Go, Java, Python, R, Ruby, PHP, Dart, Elixir, Swift, Terraform, Bazel, Haskell, OCaml, Nix, Guix"
+        );
+        return Ok(None);
+    }
+
+    let project_roots: Vec<_> = project_roots
+        .into_iter()
+        .filter(|root| match language {
+            Some(language) if !matches_language(root.project_type, language) => {
+                log(
+                    LogLevel::Info,
+                    &format!(
+                        "Skipping {:?} project (language filter: {})",
+                        root.project_type, language
+                    ),
+                );
+                false
+            }
+            _ => true,
+        })
+        .collect();
+    // A plugin's name is its language
+    let plugin_projects: Vec<_> = plugin_projects
+        .into_iter()
+        .filter(|project| language.is_none_or(|language| project.plugin == language))
+        .collect();
+
+    let total = project_roots.len() + plugin_projects.len();
+    // Projects resolve the packages they have in common only once
+    let _shared_lookups = crate::shared_lookups::begin_scan();
+    if let Some(progress) = progress {
+        progress.report(&ScanProgress::Started { projects: total });
+    }
+    let completed = AtomicUsize::new(0);
+    // With `fail_fast` the first failed project fails the scan
+    let first_error: Mutex<Option<String>> = Mutex::new(None);
+
+    let finish_project = |dir: &Path,
+                          manifest: Option<&Path>,
+                          started: Instant,
+                          result: FeludaResult<Vec<LicenseInfo>>| {
+        let source_file = manifest.map(|manifest| {
+            manifest
+                .strip_prefix(root_path)
+                .unwrap_or(manifest)
+                .to_string_lossy()
+                .replace('\\', "/")
+        });
+
+        let result = result.map(|mut deps| {
+            for dep in &mut deps {
+                // Files named by the parser itself are relative to the project
+                dep.source_file = match dep.source_file.take() {
+                    Some(file) => {
+                        let path = dir.join(file);
+                        let path = path.strip_prefix(root_path).unwrap_or(&path);
+                        Some(path.to_string_lossy().replace('\\', "/"))
+                    }
+                    None => source_file.clone(),
+                };
+            }
+            deps
+        });
+
+        if let Some(progress) = progress {
+            let (dependencies, error) = match &result {
+                Ok(deps) => (deps.as_slice(), None),
+                Err(err) => (&[][..], Some(err.to_string())),
+            };
+            progress.report(&ScanProgress::ProjectScanned {
+                manifest: source_file.as_deref(),
+                dependencies,
+                error,
+                duration: started.elapsed(),
+                completed: completed.fetch_add(1, Ordering::SeqCst) + 1,
+                total,
+            });
+        }
+
+        match result {
+            Ok(deps) => {
+                log(
+                    LogLevel::Info,
+                    &format!("Found {} dependencies in {}", deps.len(), dir.display()),
+                );
+                Some(deps)
+            }
+            Err(err) => {
+                log(
+                    LogLevel::Error,
+                    &format!("Error parsing dependencies in {}: {}", dir.display(), err),
+                );
+                if let Ok(mut first_error) = first_error.lock() {
+                    first_error.get_or_insert_with(|| format!("{}: {err}", dir.display()));
+                }
+                None
+            }
+        }
+    };
+
+    let analyze = || {
+        let mut licenses: Vec<LicenseInfo> = project_roots
+            .into_par_iter()
+            .filter_map(|root| {
+                let manifest = manifest_file_name(&root).map(|file_name| root.path.join(file_name));
+                let started = Instant::now();
+                let result = parse_dependencies(&root, config, no_local);
+                finish_project(&root.path, manifest.as_deref(), started, result)
+            })
+            .flatten()
+            .collect();
+
+        let plugin_licenses: Vec<LicenseInfo> = plugin_projects
+            .into_par_iter()
+            .filter_map(|project| {
+                let started = Instant::now();
+                let result = analyze_plugin_project(&project, config, no_local);
+                finish_project(project.dir(), Some(&project.manifest), started, result)
+            })
+            .flatten()
+            .collect();
+        licenses.extend(plugin_licenses);
+        licenses
+    };
+    // Dependencies are reported as they resolve when someone is listening
+    let licenses = match progress {
+        Some(progress) => with_dependency_progress(progress, analyze),
+        None => analyze(),
+    };
+
+    if config.fail_fast {
+        if let Some(err) = first_error.into_inner().ok().flatten() {
+            return Err(FeludaError::Parser(format!(
+                "Error parsing dependencies in {err}"
+            )));
+        }
+    }
+
+    Ok(Some(licenses))
+}
+
+/// Name of the manifest or lockfile the dependencies of a project root are read from
+fn manifest_file_name(root: &ProjectRoot) -> Option<String> {
+    match root.project_type {
+        Language::Rust(file_name)
+        | Language::Node(file_name)
+        | Language::Go(file_name)
+        | Language::Ruby(file_name)
+        | Language::Php(file_name)
+        | Language::Dart(file_name)
+        | Language::Elixir(file_name) => Some(file_name.to_string()),
+        Language::C(_) => check_which_c_file_exists(&root.path),
+        Language::Cpp(_) => check_which_cpp_file_exists(&root.path),
+        Language::DotNet(_) => check_which_dotnet_file_exists(&root.path),
+        Language::Java(_) => check_which_java_file_exists(&root.path),
+        Language::Python(_) => check_which_python_file_exists(&root.path),
+        Language::R(_) => check_which_r_file_exists(&root.path),
+        Language::Swift(_) => swift::find_package_resolved(&root.path).map(|resolved| {
+            resolved
+                .strip_prefix(&root.path)
+                .unwrap_or(&resolved)
+                .to_string_lossy()
+                .to_string()
+        }),
+        Language::Terraform(_) => terraform::find_manifest(&root.path),
+        Language::Bazel(_) => bazel::find_manifest(&root.path),
+        Language::Haskell(_) => haskell::find_manifest(&root.path),
+        Language::OCaml(_) => ocaml::find_manifest(&root.path),
+        Language::Nix(_) => nix::find_manifest(&root.path),
+        Language::Guix(_) => guix::find_manifest(&root.path),
+    }
 }
 
 /// Set license compatibility for all dependencies
-fn set_license_compatibility(licenses: &mut [LicenseInfo], project_license: &Option<String>) {
+fn set_license_compatibility(
+    licenses: &mut [LicenseInfo],
+    project_license: &Option<String>,
+    config: &crate::config::FeludaConfig,
+) {
     for license in licenses {
         license.compatibility = match (project_license, &license.license) {
-            (Some(proj_license), Some(dep_license)) => {
-                is_license_compatible(dep_license, proj_license, false)
-            }
+            (Some(proj_license), Some(dep_license)) => is_license_compatible_with_overrides(
+                dep_license,
+                proj_license,
+                false,
+                &config.compatibility,
+            ),
             _ => LicenseCompatibility::Unknown,
         };
     }
 }
 
 /// Check if a project type matches the given language filter
-fn matches_language(project_type: Language, language: &str) -> bool {
+pub(crate) fn matches_language(project_type: Language, language: &str) -> bool {
     matches!(
         (project_type, language.to_lowercase().as_str()),
         (Language::C(_), "c")
@@ -362,11 +871,70 @@ fn matches_language(project_type: Language, language: &str) -> bool {
             | (Language::Rust(_), "rust")
             | (Language::Node(_), "node")
             | (Language::Go(_), "go")
+            | (Language::Java(_), "java" | "maven" | "gradle")
             | (Language::Python(_), "python")
             | (Language::R(_), "r")
+            | (Language::Ruby(_), "ruby" | "bundler")
+            | (Language::Php(_), "php" | "composer")
+            | (Language::Dart(_), "dart" | "flutter" | "pub")
+            | (Language::Elixir(_), "elixir" | "hex" | "mix")
+            | (Language::Swift(_), "swift" | "swiftpm" | "spm")
+            | (Language::Terraform(_), "terraform" | "opentofu" | "tofu")
+            | (Language::Bazel(_), "bazel" | "bzlmod")
+            | (Language::Haskell(_), "haskell" | "cabal" | "stack")
+            | (Language::OCaml(_), "ocaml" | "opam")
+            | (Language::Nix(_), "nix" | "flake" | "flakes")
+            | (Language::Guix(_), "guix")
     )
 }
 
+/// Names [`matches_language`] accepts, for shell completion
+///
+/// `c++`, `c#` and `f#` are left out, shells would need them quoted.
+pub(crate) const LANGUAGE_NAMES: [&str; 41] = [
+    "c",
+    "cpp",
+    "dotnet",
+    ".net",
+    "csharp",
+    "fsharp",
+    "rust",
+    "node",
+    "go",
+    "java",
+    "maven",
+    "gradle",
+    "python",
+    "r",
+    "ruby",
+    "bundler",
+    "php",
+    "composer",
+    "dart",
+    "flutter",
+    "pub",
+    "elixir",
+    "hex",
+    "mix",
+    "swift",
+    "swiftpm",
+    "spm",
+    "terraform",
+    "opentofu",
+    "tofu",
+    "bazel",
+    "bzlmod",
+    "haskell",
+    "cabal",
+    "stack",
+    "ocaml",
+    "opam",
+    "nix",
+    "flake",
+    "flakes",
+    "guix",
+];
+
 /// Parse dependencies based on the project type
 fn parse_dependencies(
     root: &ProjectRoot,
@@ -401,14 +969,30 @@ fn parse_dependencies(
                             metadata.packages.len()
                         ));
 
-                        analyze_rust_licenses_with_no_local(metadata.packages, no_local)
+                        let graph = metadata_dependency_graph(&metadata);
+
+                        // Workspace members are the project itself, not dependencies
+                        let packages = metadata
+                            .packages
+                            .into_iter()
+                            .filter(|package| !metadata.workspace_members.contains(&package.id))
+                            .collect();
+
+                        let mut deps = analyze_rust_licenses_with_no_local(packages, no_local);
+                        attach_dependency_paths(&mut deps, &graph.paths());
+                        attach_dependency_requires(&mut deps, &graph.requires());
+                        attach_dependency_scopes(&mut deps, &graph.scopes());
+                        deps
                     }
                     Err(err) => {
                         log(
-                            LogLevel::Error,
-                            &format!("Failed to fetch cargo metadata: {err}"),
+                            LogLevel::Warn,
+                            &format!(
+                                "Failed to fetch cargo metadata, falling back to Cargo.lock: {err}"
+                            ),
                         );
-                        Vec::new()
+                        indicator.update_progress("reading Cargo.lock");
+                        analyze_cargo_lock(root.path.as_path(), no_local)
                     }
                 }
             }
@@ -454,6 +1038,34 @@ fn parse_dependencies(
                     }
                 }
             }
+            Language::Java(_) => match check_which_java_file_exists(project_path) {
+                Some(java_build_file) => {
+                    let project_path = Path::new(project_path).join(&java_build_file);
+                    log(
+                        LogLevel::Info,
+                        &format!("Parsing Java project: {}", project_path.display()),
+                    );
+
+                    indicator.update_progress(&format!("analyzing {java_build_file}"));
+
+                    match project_path.to_str() {
+                        Some(path_str) => {
+                            let deps = analyze_java_licenses(path_str, config);
+                            indicator
+                                .update_progress(&format!("found {} dependencies", deps.len()));
+                            deps
+                        }
+                        None => {
+                            log(LogLevel::Error, "Failed to convert Java path to string");
+                            Vec::new()
+                        }
+                    }
+                }
+                None => {
+                    log(LogLevel::Error, "Java build file not found");
+                    Vec::new()
+                }
+            },
             Language::Python(_) => match check_which_python_file_exists(project_path) {
                 Some(python_package_file) => {
                     let project_path = Path::new(project_path).join(&python_package_file);
@@ -594,6 +1206,187 @@ fn parse_dependencies(
                     Vec::new()
                 }
             },
+            Language::Ruby(_) => {
+                let project_path = Path::new(project_path).join("Gemfile.lock");
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing Ruby project: {}", project_path.display()),
+                );
+
+                indicator.update_progress("analyzing Gemfile.lock");
+
+                match project_path.to_str() {
+                    Some(path_str) => {
+                        let deps = analyze_ruby_licenses(path_str, config);
+                        indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                        deps
+                    }
+                    None => {
+                        log(LogLevel::Error, "Failed to convert Ruby path to string");
+                        Vec::new()
+                    }
+                }
+            }
+            Language::Php(_) => {
+                let project_path = Path::new(project_path).join("composer.lock");
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing PHP project: {}", project_path.display()),
+                );
+
+                indicator.update_progress("analyzing composer.lock");
+
+                match project_path.to_str() {
+                    Some(path_str) => {
+                        let deps = analyze_php_licenses(path_str, config);
+                        indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                        deps
+                    }
+                    None => {
+                        log(LogLevel::Error, "Failed to convert PHP path to string");
+                        Vec::new()
+                    }
+                }
+            }
+            Language::Dart(_) => {
+                let project_path = Path::new(project_path).join("pubspec.lock");
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing Dart project: {}", project_path.display()),
+                );
+
+                indicator.update_progress("analyzing pubspec.lock");
+
+                match project_path.to_str() {
+                    Some(path_str) => {
+                        let deps = analyze_dart_licenses(path_str, config, no_local);
+                        indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                        deps
+                    }
+                    None => {
+                        log(LogLevel::Error, "Failed to convert Dart path to string");
+                        Vec::new()
+                    }
+                }
+            }
+            Language::Elixir(_) => {
+                let project_path = Path::new(project_path).join("mix.lock");
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing Elixir project: {}", project_path.display()),
+                );
+
+                indicator.update_progress("analyzing mix.lock");
+
+                match project_path.to_str() {
+                    Some(path_str) => {
+                        let deps = analyze_elixir_licenses(path_str, config, no_local);
+                        indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                        deps
+                    }
+                    None => {
+                        log(LogLevel::Error, "Failed to convert Elixir path to string");
+                        Vec::new()
+                    }
+                }
+            }
+            Language::Swift(_) => {
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing Swift project: {}", project_path.display()),
+                );
+
+                indicator.update_progress("analyzing Package.resolved");
+
+                match project_path.to_str() {
+                    Some(path_str) => {
+                        let deps = analyze_swift_licenses(path_str, config, no_local);
+                        indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                        deps
+                    }
+                    None => {
+                        log(LogLevel::Error, "Failed to convert Swift path to string");
+                        Vec::new()
+                    }
+                }
+            }
+            Language::Terraform(_) => {
+                log(
+                    LogLevel::Info,
+                    &format!(
+                        "Parsing Terraform configuration: {}",
+                        project_path.display()
+                    ),
+                );
+
+                indicator.update_progress("analyzing .terraform.lock.hcl");
+
+                let deps = analyze_terraform_licenses(project_path, config, no_local);
+                indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                deps
+            }
+            Language::Bazel(_) => {
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing Bazel workspace: {}", project_path.display()),
+                );
+
+                indicator.update_progress("analyzing MODULE.bazel and WORKSPACE");
+
+                let deps = analyze_bazel_licenses(project_path, config);
+                indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                deps
+            }
+            Language::Haskell(_) => {
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing Haskell project: {}", project_path.display()),
+                );
+
+                let lockfile = haskell::find_manifest(project_path).unwrap_or_default();
+                indicator.update_progress(&format!("analyzing {lockfile}"));
+
+                let deps = analyze_haskell_licenses(project_path, config);
+                indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                deps
+            }
+            Language::OCaml(_) => {
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing OCaml project: {}", project_path.display()),
+                );
+
+                indicator.update_progress("analyzing opam lockfiles");
+
+                let deps = analyze_ocaml_licenses(project_path, config, no_local);
+                indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                deps
+            }
+            Language::Nix(_) => {
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing Nix flake: {}", project_path.display()),
+                );
+
+                indicator.update_progress("evaluating flake");
+
+                let deps = analyze_nix_licenses(project_path, config, no_local);
+                indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                deps
+            }
+            Language::Guix(_) => {
+                log(
+                    LogLevel::Info,
+                    &format!("Parsing Guix manifest: {}", project_path.display()),
+                );
+
+                let manifest = guix::find_manifest(project_path).unwrap_or_default();
+                indicator.update_progress(&format!("analyzing {manifest}"));
+
+                let deps = analyze_guix_licenses(project_path, config, no_local);
+                indicator.update_progress(&format!("found {} dependencies", deps.len()));
+                deps
+            }
         }
     });
 
@@ -625,10 +1418,49 @@ mod tests {
         assert!(matches_language(Language::Go("go.mod"), "GO"));
         assert!(matches_language(Language::Go("go.mod"), "Go"));
 
+        assert!(matches_language(Language::Java(&JAVA_PATHS), "java"));
+        assert!(matches_language(Language::Java(&JAVA_PATHS), "maven"));
+        assert!(matches_language(Language::Java(&JAVA_PATHS), "gradle"));
+
         assert!(matches_language(Language::Python(&PYTHON_PATHS), "python"));
         assert!(matches_language(Language::Python(&PYTHON_PATHS), "PYTHON"));
         assert!(matches_language(Language::Python(&PYTHON_PATHS), "Python"));
 
+        assert!(matches_language(Language::Ruby("Gemfile.lock"), "ruby"));
+        assert!(matches_language(Language::Ruby("Gemfile.lock"), "bundler"));
+
+        assert!(matches_language(Language::Php("composer.lock"), "php"));
+        assert!(matches_language(Language::Php("composer.lock"), "composer"));
+
+        assert!(matches_language(Language::Dart("pubspec.lock"), "dart"));
+        assert!(matches_language(Language::Dart("pubspec.lock"), "flutter"));
+        assert!(matches_language(Language::Elixir("mix.lock"), "elixir"));
+        assert!(matches_language(Language::Elixir("mix.lock"), "hex"));
+        assert!(matches_language(
+            Language::Swift(&crate::languages::SWIFT_PATHS),
+            "swift"
+        ));
+        assert!(matches_language(
+            Language::Terraform(&crate::languages::TERRAFORM_PATHS),
+            "opentofu"
+        ));
+        assert!(matches_language(
+            Language::Haskell(&crate::languages::HASKELL_PATHS),
+            "stack"
+        ));
+        assert!(matches_language(
+            Language::OCaml(&crate::languages::OCAML_PATHS),
+            "opam"
+        ));
+        assert!(matches_language(
+            Language::Nix(&crate::languages::NIX_PATHS),
+            "flake"
+        ));
+        assert!(matches_language(
+            Language::Guix(&crate::languages::GUIX_PATHS),
+            "guix"
+        ));
+
         assert!(!matches_language(Language::Rust("Cargo.toml"), "node"));
         assert!(!matches_language(Language::Node("package.json"), "python"));
         assert!(!matches_language(Language::Go("go.mod"), "rust"));
@@ -638,6 +1470,49 @@ mod tests {
 
         assert!(!matches_language(Language::Rust("Cargo.toml"), "java"));
         assert!(!matches_language(Language::Node("package.json"), "java"));
+        assert!(!matches_language(Language::Ruby("Gemfile.lock"), "r"));
+    }
+
+    #[test]
+    fn test_language_names() {
+        use crate::languages::*;
+
+        let project_types = [
+            Language::Bazel(&BAZEL_PATHS),
+            Language::C(&C_PATHS),
+            Language::Cpp(&CPP_PATHS),
+            Language::DotNet(&DOTNET_PATHS),
+            Language::Rust("Cargo.toml"),
+            Language::Node("package.json"),
+            Language::Go("go.mod"),
+            Language::Java(&JAVA_PATHS),
+            Language::Python(&PYTHON_PATHS),
+            Language::R(&R_PATHS),
+            Language::Ruby("Gemfile.lock"),
+            Language::Php("composer.lock"),
+            Language::Dart("pubspec.lock"),
+            Language::Elixir("mix.lock"),
+            Language::Swift(&SWIFT_PATHS),
+            Language::Terraform(&TERRAFORM_PATHS),
+            Language::Haskell(&HASKELL_PATHS),
+            Language::OCaml(&OCAML_PATHS),
+            Language::Nix(&NIX_PATHS),
+            Language::Guix(&GUIX_PATHS),
+        ];
+        for name in LANGUAGE_NAMES {
+            assert!(
+                project_types
+                    .iter()
+                    .any(|project_type| matches_language(*project_type, name)),
+                "--language {name} matches a project type"
+            );
+        }
+        // Every project type can be completed
+        for project_type in project_types {
+            assert!(LANGUAGE_NAMES
+                .iter()
+                .any(|name| matches_language(project_type, name)));
+        }
     }
 
     #[test]
@@ -667,7 +1542,7 @@ mod tests {
     #[test]
     fn test_find_project_roots_empty_directory() {
         let temp_dir = tempfile::TempDir::new().unwrap();
-        let result = find_project_roots(temp_dir.path().to_str().unwrap()).unwrap();
+        let result = find_project_roots(temp_dir.path(), &Gitignore::empty()).unwrap();
         assert!(result.is_empty());
     }
 
@@ -679,7 +1554,7 @@ mod tests {
         // Create a single Rust project
         std::fs::write(root_path.join("Cargo.toml"), "[package]\nname = \"test\"").unwrap();
 
-        let result = find_project_roots(root_path.to_str().unwrap()).unwrap();
+        let result = find_project_roots(root_path, &Gitignore::empty()).unwrap();
         assert_eq!(result.len(), 1);
         assert_eq!(result[0].project_type, Language::Rust("Cargo.toml"));
         assert_eq!(result[0].path, root_path);
@@ -780,7 +1655,7 @@ mod tests {
         std::fs::write(node_dir.join("package.json"), "{}").unwrap();
         std::fs::write(root_path.join("go.mod"), "module test").unwrap();
 
-        let result = find_project_roots(root_path.to_str().unwrap()).unwrap();
+        let result = find_project_roots(root_path, &Gitignore::empty()).unwrap();
         // Only finds go.mod in root directory (non-recursive scanning)
         assert_eq!(result.len(), 1);
 
@@ -788,6 +1663,105 @@ mod tests {
         assert!(project_types.contains(&Language::Go("go.mod")));
     }
 
+    #[test]
+    fn test_discover_project_roots_recursive() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let root = temp_dir.path();
+        let write = |path: &str, content: &str| {
+            let path = root.join(path);
+            std::fs::create_dir_all(path.parent().unwrap()).unwrap();
+            std::fs::write(path, content).unwrap();
+        };
+
+        write("go.mod", "module test");
+        write("services/api/package.json", "{}");
+        write("services/api/package-lock.json", "{}");
+        write("services/api/node_modules/dep/package.json", "{}");
+        write("services/web/package.json", "{}");
+        write("services/web/packages/ui/package.json", "{}");
+        write("libs/core/Cargo.toml", "[package]\nname = \"core\"");
+        write("examples/demo/go.mod", "module demo");
+
+        let workspace = WorkspaceConfig::default();
+        assert_eq!(discover_project_roots(root, &workspace).unwrap().len(), 1);
+
+        let mut workspace = WorkspaceConfig {
+            recursive: true,
+            ..WorkspaceConfig::default()
+        };
+        let found = |workspace: &WorkspaceConfig| {
+            let mut dirs: Vec<_> = discover_project_roots(root, workspace)
+                .unwrap()
+                .iter()
+                .map(|r| {
+                    r.path
+                        .strip_prefix(root)
+                        .unwrap()
+                        .to_string_lossy()
+                        .replace('\\', "/")
+                })
+                .collect();
+            dirs.sort();
+            dirs
+        };
+
+        // node_modules is skipped and the npm workspace member is covered by its root
+        assert_eq!(
+            found(&workspace),
+            vec![
+                "",
+                "examples/demo",
+                "libs/core",
+                "services/api",
+                "services/web"
+            ]
+        );
+
+        workspace.exclude = vec!["examples/".to_string()];
+        workspace.include = vec!["services/*".to_string()];
+        assert_eq!(found(&workspace), vec!["services/api", "services/web"]);
+
+        // Patterns also match manifests, with or without --recursive. Without
+        // the root of the npm workspace its member is a project of its own.
+        workspace.exclude = vec!["services/web/package.json".to_string()];
+        assert_eq!(
+            found(&workspace),
+            vec!["services/api", "services/web/packages/ui"]
+        );
+        let workspace = WorkspaceConfig {
+            exclude: vec!["/go.mod".to_string()],
+            ..WorkspaceConfig::default()
+        };
+        assert!(found(&workspace).is_empty());
+    }
+
+    #[test]
+    fn test_is_workspace_member() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let outer = ProjectRoot {
+            path: temp_dir.path().to_path_buf(),
+            project_type: Language::Rust("Cargo.toml"),
+        };
+        let member_dir = temp_dir.path().join("crates").join("member");
+        std::fs::create_dir_all(&member_dir).unwrap();
+        let member = ProjectRoot {
+            path: member_dir.clone(),
+            project_type: Language::Rust("Cargo.toml"),
+        };
+        let go_module = ProjectRoot {
+            path: member_dir.clone(),
+            project_type: Language::Go("go.mod"),
+        };
+
+        let found = [outer];
+        assert!(is_workspace_member(&member, &found));
+        assert!(!is_workspace_member(&go_module, &found));
+
+        // A crate with its own lockfile is a separate workspace
+        std::fs::write(member_dir.join("Cargo.lock"), "").unwrap();
+        assert!(!is_workspace_member(&member, &found));
+    }
+
     #[test]
     fn test_parse_dependencies_error_handling() {
         let temp_dir = tempfile::TempDir::new().unwrap();
@@ -850,6 +1824,47 @@ mod tests {
         assert!(licenses.is_empty());
     }
 
+    #[cfg(unix)]
+    #[test]
+    fn test_parse_root_with_plugin() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let service = temp_dir.path().join("services/api");
+        std::fs::create_dir_all(&service).unwrap();
+        std::fs::write(service.join("acme.lock"), "widget 2.1.0\n").unwrap();
+        let script = temp_dir.path().join("feluda-acme.sh");
+        std::fs::write(
+            &script,
+            r#"read -r name version < acme.lock
+echo "{\"dependencies\": [{\"name\": \"$name\", \"version\": \"$version\", \"license\": \"MIT\"}]}"
+"#,
+        )
+        .unwrap();
+
+        let mut config = crate::config::FeludaConfig::default();
+        config.workspace.recursive = true;
+        config.plugins.insert(
+            "acme".to_string(),
+            crate::config::PluginConfig {
+                command: vec!["sh".to_string(), script.to_string_lossy().to_string()],
+                files: vec!["acme.lock".to_string()],
+                timeout: 10,
+            },
+        );
+
+        let licenses = parse_root_with_config(temp_dir.path(), None, &config, false).unwrap();
+        assert_eq!(licenses.len(), 1);
+        assert_eq!(licenses[0].name, "widget");
+        assert_eq!(licenses[0].version, "2.1.0");
+        assert_eq!(
+            licenses[0].source_file.as_deref(),
+            Some("services/api/acme.lock")
+        );
+
+        let licenses =
+            parse_root_with_config(temp_dir.path(), Some("rust"), &config, false).unwrap();
+        assert!(licenses.is_empty());
+    }
+
     #[test]
     fn test_parse_root_invalid_path() {
         let result = parse_root("/definitely/nonexistent/path", None, false, false);
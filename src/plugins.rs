@@ -0,0 +1,485 @@
+//! External parser plugins
+//!
+//! Package managers Feluda doesn't support can be added without forking it. A
+//! plugin is any executable that reads a request as JSON on stdin and writes
+//! the dependencies it found as JSON on stdout. Plugins are declared in
+//! `.feluda.toml` with the files they read:
+//!
+//! ```toml
+//! [plugins.acme]
+//! command = ["feluda-acme", "--offline"]
+//! files = ["acme.lock", "*.acmepkg"]
+//! ```
+//!
+//! For every directory containing one of the files, Feluda runs the command in
+//! that directory and writes a request:
+//!
+//! ```json
+//! {"protocol": 1, "plugin": "acme", "manifest": "/src/app/acme.lock",
+//!  "project_dir": "/src/app", "no_local": false, "max_depth": 10}
+//! ```
+//!
+//! The plugin answers with the resolved dependencies:
+//!
+//! ```json
+//! {"dependencies": [
+//!   {"name": "widget", "version": "2.1.0", "license": "MIT", "direct": true, "requires": ["gear"]},
+//!   {"name": "gear", "version": "0.3.0", "license": "Apache-2.0 OR MIT", "scope": "build"}
+//! ]}
+//! ```
+//!
+//! `license` is an SPDX expression and may be left out when it is unknown.
+//! When the plugin marks direct dependencies, dependency paths and scopes are
+//! derived from `requires` as for the built-in ecosystems; otherwise `scope`
+//! (`runtime`, `build`, `test` or `dev`) is taken as is. Feluda evaluates
+//! restrictiveness, compatibility and the policy itself. A non-zero exit status
+//! fails the project, with the plugin's stderr in the error message.
+
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap};
+use std::io::{Read, Write};
+use std::path::{Path, PathBuf};
+use std::process::{Child, Command, Stdio};
+use std::thread;
+use std::time::{Duration, Instant};
+
+use crate::config::{FeludaConfig, PluginConfig};
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::dependency_graph::{
+    attach_dependency_paths, attach_dependency_requires, attach_dependency_scopes, DependencyGraph,
+};
+use crate::licenses::{
+    fetch_licenses_from_github, get_osi_status, is_license_restrictive, DependencyScope,
+    LicenseCompatibility, LicenseInfo, OsiStatus,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::tiers::pattern_matches;
+
+/// Version of the request and response format
+pub const PROTOCOL_VERSION: u32 = 1;
+
+/// A manifest that a plugin is responsible for
+#[derive(Debug, Clone, PartialEq)]
+pub struct PluginProject {
+    pub plugin: String,
+    pub manifest: PathBuf,
+}
+
+impl PluginProject {
+    pub fn dir(&self) -> &Path {
+        self.manifest.parent().unwrap_or(Path::new("."))
+    }
+}
+
+#[derive(Serialize)]
+struct PluginRequest<'a> {
+    protocol: u32,
+    plugin: &'a str,
+    manifest: &'a Path,
+    project_dir: &'a Path,
+    no_local: bool,
+    max_depth: u32,
+}
+
+#[derive(Deserialize, Debug)]
+struct PluginResponse {
+    dependencies: Vec<PluginDependency>,
+}
+
+#[derive(Deserialize, Debug)]
+struct PluginDependency {
+    name: String,
+    version: String,
+    #[serde(default)]
+    license: Option<String>,
+    #[serde(default)]
+    scope: DependencyScope,
+    #[serde(default)]
+    direct: bool,
+    /// Names of the dependencies this one needs
+    #[serde(default)]
+    requires: Vec<String>,
+}
+
+/// Manifests in `dir` handled by the configured plugins, one per plugin
+///
+/// A plugin listing several files gets the first one present, in the order of
+/// its `files` list.
+pub fn find_plugin_projects(
+    dir: &Path,
+    plugins: &BTreeMap<String, PluginConfig>,
+) -> Vec<PluginProject> {
+    if plugins.is_empty() {
+        return Vec::new();
+    }
+    let Ok(entries) = std::fs::read_dir(dir) else {
+        return Vec::new();
+    };
+    let mut file_names: Vec<String> = entries
+        .filter_map(Result::ok)
+        .filter(|entry| entry.file_type().is_ok_and(|file_type| file_type.is_file()))
+        .filter_map(|entry| entry.file_name().to_str().map(str::to_string))
+        .collect();
+    file_names.sort();
+
+    plugins
+        .iter()
+        .filter_map(|(name, plugin)| {
+            let file_name = plugin.files.iter().find_map(|pattern| {
+                file_names
+                    .iter()
+                    .find(|file_name| pattern_matches(pattern, file_name))
+            })?;
+            let manifest = dir.join(file_name);
+            log(
+                LogLevel::Info,
+                &format!("Found {} for plugin {name}", manifest.display()),
+            );
+            Some(PluginProject {
+                plugin: name.clone(),
+                manifest,
+            })
+        })
+        .collect()
+}
+
+/// Run the plugin responsible for `project` and turn its answer into dependencies
+pub fn analyze_plugin_project(
+    project: &PluginProject,
+    config: &FeludaConfig,
+    no_local: bool,
+) -> FeludaResult<Vec<LicenseInfo>> {
+    let name = project.plugin.as_str();
+    let plugin = config
+        .plugins
+        .get(name)
+        .ok_or_else(|| FeludaError::Config(format!("Unknown plugin {name}")))?;
+
+    let request = serde_json::to_vec(&PluginRequest {
+        protocol: PROTOCOL_VERSION,
+        plugin: name,
+        manifest: &project.manifest,
+        project_dir: project.dir(),
+        no_local,
+        max_depth: config.dependencies.max_depth,
+    })
+    .map_err(|e| FeludaError::Serialization(format!("Failed to encode plugin request: {e}")))?;
+
+    let output = run_plugin(name, plugin, project.dir(), &request)?;
+    let response: PluginResponse = serde_json::from_slice(&output)
+        .map_err(|e| FeludaError::Parser(format!("Invalid response from plugin {name}: {e}")))?;
+    log(
+        LogLevel::Info,
+        &format!(
+            "Plugin {name} found {} dependencies in {}",
+            response.dependencies.len(),
+            project.manifest.display()
+        ),
+    );
+
+    let known_licenses = fetch_licenses_from_github().unwrap_or_else(|err| {
+        log_error("Failed to fetch licenses from GitHub", &err);
+        HashMap::new()
+    });
+    Ok(plugin_dependencies(response.dependencies, |license| {
+        is_license_restrictive(license, &known_licenses, config.strict)
+    }))
+}
+
+fn plugin_dependencies(
+    dependencies: Vec<PluginDependency>,
+    is_restrictive: impl Fn(&Option<String>) -> bool,
+) -> Vec<LicenseInfo> {
+    let mut graph = DependencyGraph::new();
+    for dep in &dependencies {
+        graph.add_package(&dep.name, &dep.name, &dep.version);
+    }
+    for dep in &dependencies {
+        for required in &dep.requires {
+            graph.add_dependency(&dep.name, required);
+        }
+        if dep.direct {
+            graph.add_direct_with_scope(&dep.name, dep.scope);
+        }
+    }
+    let has_direct = dependencies.iter().any(|dep| dep.direct);
+
+    let mut licenses: Vec<LicenseInfo> = dependencies
+        .into_iter()
+        .map(|dep| {
+            let license = dep.license.filter(|license| !license.trim().is_empty());
+            LicenseInfo {
+                is_restrictive: is_restrictive(&license),
+                osi_status: license
+                    .as_deref()
+                    .map(get_osi_status)
+                    .unwrap_or(OsiStatus::Unknown),
+                name: dep.name,
+                version: dep.version,
+                license,
+                compatibility: LicenseCompatibility::Unknown,
+                license_confidence: None,
+                source_file: None,
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: dep.scope,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: None,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
+            }
+        })
+        .collect();
+
+    attach_dependency_requires(&mut licenses, &graph.requires());
+    for dep in &mut licenses {
+        if dep.requires.as_ref().is_some_and(Vec::is_empty) {
+            dep.requires = None;
+        }
+    }
+    if has_direct {
+        attach_dependency_paths(&mut licenses, &graph.paths());
+        attach_dependency_scopes(&mut licenses, &graph.scopes());
+    }
+    licenses
+}
+
+/// Run `plugin` in `dir` with `request` on stdin, returning its stdout
+fn run_plugin(
+    name: &str,
+    plugin: &PluginConfig,
+    dir: &Path,
+    request: &[u8],
+) -> FeludaResult<Vec<u8>> {
+    let Some((program, args)) = plugin.command.split_first() else {
+        return Err(FeludaError::Config(format!(
+            "Missing command in [plugins.{name}]"
+        )));
+    };
+    log(
+        LogLevel::Info,
+        &format!("Running plugin {name}: {}", plugin.command.join(" ")),
+    );
+
+    let mut child = Command::new(program)
+        .args(args)
+        .current_dir(dir)
+        .stdin(Stdio::piped())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::piped())
+        .spawn()
+        .map_err(|e| {
+            FeludaError::Unknown(format!("Failed to run plugin {name} ({program}): {e}"))
+        })?;
+
+    let stdout = read_in_background(child.stdout.take());
+    let stderr = read_in_background(child.stderr.take());
+    write_in_background(name, child.stdin.take(), request.to_vec());
+
+    let status =
+        wait_with_timeout(&mut child, Duration::from_secs(plugin.timeout))?.ok_or_else(|| {
+            FeludaError::Unknown(format!(
+                "Plugin {name} did not finish within {} seconds",
+                plugin.timeout
+            ))
+        })?;
+    let stdout = stdout.join().unwrap_or_default();
+    let stderr = String::from_utf8_lossy(&stderr.join().unwrap_or_default()).to_string();
+
+    for line in stderr.lines() {
+        log(LogLevel::Info, &format!("[plugin {name}] {line}"));
+    }
+    if !status.success() {
+        return Err(FeludaError::Unknown(format!(
+            "Plugin {name} failed ({status}): {}",
+            stderr.trim()
+        )));
+    }
+    Ok(stdout)
+}
+
+/// Drain a pipe on its own thread so a chatty plugin never blocks on a full pipe
+fn read_in_background(pipe: Option<impl Read + Send + 'static>) -> thread::JoinHandle<Vec<u8>> {
+    thread::spawn(move || {
+        let mut content = Vec::new();
+        if let Some(mut pipe) = pipe {
+            let _ = pipe.read_to_end(&mut content);
+        }
+        content
+    })
+}
+
+/// Write the request on its own thread so a plugin that doesn't read it still
+/// runs into its timeout; killing the plugin ends the write
+fn write_in_background(name: &str, pipe: Option<impl Write + Send + 'static>, request: Vec<u8>) {
+    let Some(mut pipe) = pipe else {
+        return;
+    };
+    let name = name.to_string();
+    thread::spawn(move || {
+        // A plugin that only looks at the manifest may exit without reading the request
+        if let Err(err) = pipe.write_all(&request) {
+            log(
+                LogLevel::Info,
+                &format!("Plugin {name} did not read the request: {err}"),
+            );
+        }
+    });
+}
+
+/// Wait for `child` to exit, killing it once `timeout` has passed
+fn wait_with_timeout(
+    child: &mut Child,
+    timeout: Duration,
+) -> FeludaResult<Option<std::process::ExitStatus>> {
+    let deadline = Instant::now() + timeout;
+    loop {
+        if let Some(status) = child.try_wait()? {
+            return Ok(Some(status));
+        }
+        if Instant::now() >= deadline {
+            let _ = child.kill();
+            let _ = child.wait();
+            return Ok(None);
+        }
+        thread::sleep(Duration::from_millis(20));
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn plugin(command: &[&str], files: &[&str]) -> PluginConfig {
+        PluginConfig {
+            command: command.iter().map(|s| s.to_string()).collect(),
+            files: files.iter().map(|s| s.to_string()).collect(),
+            timeout: 5,
+        }
+    }
+
+    #[test]
+    fn test_find_plugin_projects() {
+        let temp_dir = TempDir::new().unwrap();
+        std::fs::write(temp_dir.path().join("acme.lock"), "").unwrap();
+        std::fs::write(temp_dir.path().join("app.acmepkg"), "").unwrap();
+        std::fs::write(temp_dir.path().join("package.json"), "{}").unwrap();
+
+        let plugins = BTreeMap::from([
+            (
+                "acme".to_string(),
+                plugin(&["feluda-acme"], &["*.acmepkg", "acme.lock"]),
+            ),
+            (
+                "other".to_string(),
+                plugin(&["feluda-other"], &["other.lock"]),
+            ),
+        ]);
+        let projects = find_plugin_projects(temp_dir.path(), &plugins);
+        assert_eq!(
+            projects,
+            vec![PluginProject {
+                plugin: "acme".to_string(),
+                manifest: temp_dir.path().join("app.acmepkg"),
+            }]
+        );
+        assert_eq!(projects[0].dir(), temp_dir.path());
+    }
+
+    #[test]
+    fn test_plugin_dependencies() {
+        let response: PluginResponse = serde_json::from_str(
+            r#"{"dependencies": [
+                {"name": "widget", "version": "2.1.0", "license": "MIT", "direct": true, "requires": ["gear"]},
+                {"name": "gear", "version": "0.3.0", "license": "GPL-3.0", "scope": "build", "extra": 1},
+                {"name": "tool", "version": "1.0.0", "direct": true, "scope": "dev"}
+            ]}"#,
+        )
+        .unwrap();
+        let deps = plugin_dependencies(response.dependencies, |license| {
+            license.as_deref() == Some("GPL-3.0")
+        });
+
+        assert_eq!(deps.len(), 3);
+        assert_eq!(deps[0].license.as_deref(), Some("MIT"));
+        assert_eq!(deps[0].osi_status, OsiStatus::Approved);
+        assert_eq!(deps[0].requires, Some(vec!["gear@0.3.0".to_string()]));
+        assert!(deps[1].is_restrictive);
+        // gear is pulled in by a runtime dependency, so it is needed at runtime
+        assert_eq!(deps[1].scope, DependencyScope::Runtime);
+        assert_eq!(
+            deps[1].dependency_path,
+            Some(vec!["widget@2.1.0".to_string(), "gear@0.3.0".to_string()])
+        );
+        assert!(deps[2].has_unknown_license());
+        assert_eq!(deps[2].scope, DependencyScope::Dev);
+        assert_eq!(deps[2].requires, None);
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_run_plugin() {
+        let temp_dir = TempDir::new().unwrap();
+        let script = temp_dir.path().join("plugin.sh");
+        std::fs::write(
+            &script,
+            r#"read request
+case "$request" in
+  *'"protocol":1'*) echo '{"dependencies": [{"name": "widget", "version": "2.1.0"}]}' ;;
+  *) echo "unexpected request: $request" >&2; exit 3 ;;
+esac
+"#,
+        )
+        .unwrap();
+        let script = script.to_str().unwrap();
+
+        let output = run_plugin(
+            "acme",
+            &plugin(&["sh", script], &["acme.lock"]),
+            temp_dir.path(),
+            br#"{"protocol":1}"#,
+        )
+        .unwrap();
+        let response: PluginResponse = serde_json::from_slice(&output).unwrap();
+        assert_eq!(response.dependencies[0].name, "widget");
+
+        let err = run_plugin(
+            "acme",
+            &plugin(&["sh", script], &["acme.lock"]),
+            temp_dir.path(),
+            b"{}",
+        )
+        .unwrap_err();
+        assert!(err.to_string().contains("unexpected request"));
+
+        let mut slow = plugin(&["sleep", "10"], &["acme.lock"]);
+        slow.timeout = 1;
+        let err = run_plugin("slow", &slow, temp_dir.path(), b"{}").unwrap_err();
+        assert!(err.to_string().contains("did not finish"));
+
+        // A request larger than the pipe buffer that is never read
+        let request = vec![b' '; 1 << 20];
+        let err = run_plugin("slow", &slow, temp_dir.path(), &request).unwrap_err();
+        assert!(err.to_string().contains("did not finish"));
+
+        assert!(run_plugin(
+            "missing",
+            &plugin(&["feluda-plugin-that-does-not-exist"], &["acme.lock"]),
+            temp_dir.path(),
+            b"{}"
+        )
+        .is_err());
+    }
+}
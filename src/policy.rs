@@ -0,0 +1,1592 @@
+//! License policy enforcement
+//!
+//! Evaluates scanned dependencies against the `[policy]` section of `.feluda.toml`.
+//! A dependency violates the policy when its license is denied, or when an allow
+//! list is configured and its license is not on it. Exceptions waive violations
+//! for specific dependencies until they expire. For dual-licensed dependencies
+//! a license can be chosen per package or by a global strategy, and only the
+//! chosen license is checked. Dependencies with a known linkage are checked
+//! against the general lists combined with the rules for that linkage.
+//! `[policy.health]` can also fail deprecated, yanked and archived packages,
+//! `[policy.legal_files]` packages shipping a PATENTS, EULA, commercial license
+//! or CLA file, and `[policy.unknown]` decides separately on missing and
+//! unrecognized licenses.
+//!
+//! Every decision is recorded as a [`PolicyExplanation`] on the dependency, so
+//! JSON reports show which rule matched, which alternative of a license
+//! expression was accepted and which exception waived a violation.
+
+use chrono::NaiveDate;
+use colored::*;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+
+use crate::config::{
+    DualLicenseStrategy, HealthAction, HealthPolicy, LegalFilesPolicy, Linkage, PolicyConfig,
+    PolicyException, ProjectConfig,
+};
+use crate::debug::{log, log_error, LogLevel};
+use crate::health::HealthSignal;
+use crate::legal_files::LegalFileKind;
+use crate::license_expression::{LicenseExpression, LicenseTerm};
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, LicenseInfo, UnknownLicense,
+};
+use crate::linking::linkage;
+use crate::reporter::TableFormatter;
+
+/// Why a dependency failed the policy
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub enum ViolationKind {
+    /// The license is on the deny list
+    Denied,
+    /// An allow list is configured and the license is not on it
+    NotAllowed,
+    /// The dependency offers several licenses and none was chosen under `require-explicit-choice`
+    ChoiceRequired,
+    /// The package is deprecated and `[policy.health] deprecated = "fail"`
+    Deprecated,
+    /// The version was yanked and `[policy.health] yanked = "fail"`
+    Yanked,
+    /// The source repository is archived and `[policy.health] archived = "fail"`
+    Archived,
+    /// No license was found and `[policy.unknown] missing = "fail"`
+    MissingLicense,
+    /// The license is not recognized and `[policy.unknown] unrecognized = "fail"`
+    UnrecognizedLicense,
+    /// The package ships patent terms and `[policy.legal_files] patents = "fail"`
+    PatentTerms,
+    /// The package ships an end-user license agreement and `[policy.legal_files] eula = "fail"`
+    Eula,
+    /// The package ships commercial license terms and `[policy.legal_files] commercial = "fail"`
+    CommercialLicense,
+    /// The package asks for a contributor license agreement and `[policy.legal_files] cla = "fail"`
+    ContributorAgreement,
+}
+
+impl ViolationKind {
+    /// Why the dependency violates the policy, for terminal output
+    pub fn describe(&self) -> &'static str {
+        match self {
+            ViolationKind::Denied => "denied by policy",
+            ViolationKind::NotAllowed => "not in allowed licenses",
+            ViolationKind::ChoiceRequired => {
+                "dual-licensed, choose a license in [[policy.choices]]"
+            }
+            ViolationKind::Deprecated => "deprecated package",
+            ViolationKind::Yanked => "yanked version",
+            ViolationKind::Archived => "source repository is archived",
+            ViolationKind::MissingLicense => "no license found",
+            ViolationKind::UnrecognizedLicense => "license not recognized",
+            ViolationKind::PatentTerms => "ships patent terms besides the license",
+            ViolationKind::Eula => "ships an end-user license agreement",
+            ViolationKind::CommercialLicense => "ships commercial license terms",
+            ViolationKind::ContributorAgreement => "asks for a contributor license agreement",
+        }
+    }
+}
+
+/// A dependency that does not satisfy the license policy
+#[derive(Debug, Clone, Serialize)]
+pub struct PolicyViolation {
+    pub name: String,
+    pub version: String,
+    pub license: Option<String>,
+    pub kind: ViolationKind,
+    /// Dependencies that pulled in an indirect dependency, see [`LicenseInfo::introduced_by`]
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub introduced_by: Option<String>,
+}
+
+/// Outcome of the policy for one dependency
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum PolicyDecision {
+    /// The license and health of the dependency satisfy the policy
+    Pass,
+    /// The dependency violates the policy
+    Fail,
+    /// The dependency violates the policy, but an exception or the baseline accepts it
+    Waived,
+    /// `[policy] scopes` leaves out the scope of the dependency
+    Skipped,
+}
+
+impl PolicyDecision {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            PolicyDecision::Pass => "pass",
+            PolicyDecision::Fail => "fail",
+            PolicyDecision::Waived => "waived",
+            PolicyDecision::Skipped => "skipped",
+        }
+    }
+}
+
+/// Policy list an entry belongs to
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum RuleList {
+    Allow,
+    Deny,
+}
+
+impl RuleList {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            RuleList::Allow => "allow",
+            RuleList::Deny => "deny",
+        }
+    }
+}
+
+/// A policy entry that matched a license term
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct RuleMatch {
+    pub list: RuleList,
+    /// The entry as written in `.feluda.toml`
+    pub entry: String,
+    /// The term of the license expression it matched, e.g. `MIT`
+    pub term: String,
+}
+
+/// How the license of a dual-licensed dependency was chosen, see [`choose_license`]
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum ChoiceSource {
+    /// Chosen for the package in `[[policy.choices]]`
+    Explicit,
+    /// Picked by the `prefer-permissive` strategy
+    PreferPermissive,
+}
+
+impl ChoiceSource {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            ChoiceSource::Explicit => "explicit",
+            ChoiceSource::PreferPermissive => "prefer-permissive",
+        }
+    }
+}
+
+/// Why the policy passed or failed a dependency
+///
+/// ```json
+/// {
+///   "decision": "pass",
+///   "linkage": null,
+///   "expression": "MIT OR GPL-3.0",
+///   "chosen_by": null,
+///   "branch": "MIT",
+///   "matched": [{ "list": "allow", "entry": "MIT", "term": "MIT" }],
+///   "violations": [],
+///   "overridden": false,
+///   "exception": null,
+///   "baseline": false,
+///   "reason": "MIT of MIT OR GPL-3.0 is on the allow list"
+/// }
+/// ```
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct PolicyExplanation {
+    pub decision: PolicyDecision,
+    /// Linkage whose `[policy.linking]` rules were combined with the general lists
+    pub linkage: Option<Linkage>,
+    /// License expression that was evaluated: the chosen license, or the license
+    pub expression: Option<String>,
+    /// How the evaluated license was chosen when the dependency is dual-licensed
+    pub chosen_by: Option<ChoiceSource>,
+    /// Alternative of the expression the policy accepted
+    pub branch: Option<String>,
+    /// Allow and deny entries that decided the outcome
+    pub matched: Vec<RuleMatch>,
+    pub violations: Vec<ViolationKind>,
+    /// The license was asserted in `[overrides]`, see [`LicenseInfo::manual_license`]
+    pub overridden: bool,
+    /// Exception in `[[policy.exceptions]]` that waived the violations
+    pub exception: Option<PolicyException>,
+    /// The violations are accepted in the baseline, see [`crate::baseline`]
+    pub baseline: bool,
+    /// The decision in words, e.g. `GPL-3.0 is on the deny list`
+    pub reason: String,
+}
+
+impl PolicyExplanation {
+    /// Mark a failed decision as accepted by the baseline
+    pub fn waive_by_baseline(&mut self) {
+        if self.decision != PolicyDecision::Fail {
+            return;
+        }
+        self.decision = PolicyDecision::Waived;
+        self.baseline = true;
+        self.reason.push_str(", accepted in the baseline");
+    }
+}
+
+/// Evaluate dependencies against the policy using today's date for exception expiry
+///
+/// `project` gives the linkage of each dependency, see [`crate::linking`].
+pub fn check_policy(
+    data: &[LicenseInfo],
+    policy: &PolicyConfig,
+    project: &ProjectConfig,
+) -> Vec<PolicyViolation> {
+    evaluate_policy(data, policy, project, chrono::Utc::now().date_naive())
+}
+
+/// Evaluate dependencies against the policy and record the explanation on each
+///
+/// Dependencies keep no explanation when no policy is configured.
+pub fn apply_policy(
+    data: &mut [LicenseInfo],
+    policy: &PolicyConfig,
+    project: &ProjectConfig,
+) -> Vec<PolicyViolation> {
+    let explanations = explain_policy(data, policy, project, chrono::Utc::now().date_naive());
+    let violations = collect_violations(data, &explanations);
+    for (info, explanation) in data.iter_mut().zip(explanations) {
+        info.explanation = Some(explanation);
+    }
+    violations
+}
+
+/// Evaluate dependencies against the policy as of the given date
+pub fn evaluate_policy(
+    data: &[LicenseInfo],
+    policy: &PolicyConfig,
+    project: &ProjectConfig,
+    today: NaiveDate,
+) -> Vec<PolicyViolation> {
+    let explanations = explain_policy(data, policy, project, today);
+    collect_violations(data, &explanations)
+}
+
+fn collect_violations(
+    data: &[LicenseInfo],
+    explanations: &[PolicyExplanation],
+) -> Vec<PolicyViolation> {
+    if explanations.is_empty() {
+        return Vec::new();
+    }
+
+    let violations: Vec<_> = data
+        .iter()
+        .zip(explanations)
+        .filter(|(_, explanation)| explanation.decision == PolicyDecision::Fail)
+        .flat_map(|(info, explanation)| {
+            explanation.violations.iter().map(|kind| PolicyViolation {
+                name: info.name.clone(),
+                version: info.version.clone(),
+                license: info.license.clone(),
+                kind: kind.clone(),
+                introduced_by: info.introduced_by(),
+            })
+        })
+        .collect();
+
+    log(
+        LogLevel::Info,
+        &format!("Policy check found {} violations", violations.len()),
+    );
+
+    violations
+}
+
+/// Explain the policy decision for every dependency as of the given date
+///
+/// Gives one explanation per dependency in order, or none when no policy is configured.
+pub fn explain_policy(
+    data: &[LicenseInfo],
+    policy: &PolicyConfig,
+    project: &ProjectConfig,
+    today: NaiveDate,
+) -> Vec<PolicyExplanation> {
+    if policy.is_empty() {
+        return Vec::new();
+    }
+
+    let static_policy = policy.for_linkage(Linkage::Static);
+    let dynamic_policy = policy.for_linkage(Linkage::Dynamic);
+
+    data.iter()
+        .map(|info| {
+            let linkage = linkage(info, project);
+            let policy = match linkage {
+                Some(Linkage::Static) => &static_policy,
+                Some(Linkage::Dynamic) => &dynamic_policy,
+                None => policy,
+            };
+            explain_dependency(info, policy, linkage, today)
+        })
+        .collect()
+}
+
+fn explain_dependency(
+    info: &LicenseInfo,
+    policy: &PolicyConfig,
+    linkage: Option<Linkage>,
+    today: NaiveDate,
+) -> PolicyExplanation {
+    let expression = info.chosen_license.clone().or_else(|| info.license.clone());
+    let mut explanation = PolicyExplanation {
+        decision: PolicyDecision::Pass,
+        linkage,
+        expression: expression.clone(),
+        chosen_by: chosen_by(info, policy),
+        branch: None,
+        matched: Vec::new(),
+        violations: Vec::new(),
+        overridden: info.manual_license.is_some(),
+        exception: None,
+        baseline: false,
+        reason: String::new(),
+    };
+    if !policy.applies_to(info.scope) {
+        explanation.decision = PolicyDecision::Skipped;
+        explanation.reason = format!("the policy does not apply to {} dependencies", info.scope);
+        return explanation;
+    }
+
+    let unknown = info
+        .unknown_license()
+        .and_then(|kind| Some((kind, policy.unknown.action(kind)?)));
+    if let Some((kind, action)) = unknown {
+        if action == HealthAction::Fail {
+            explanation.violations.push(match kind {
+                UnknownLicense::Missing => ViolationKind::MissingLicense,
+                UnknownLicense::Unrecognized => ViolationKind::UnrecognizedLicense,
+            });
+        }
+    } else if requires_choice(info, policy) {
+        explanation.violations.push(ViolationKind::ChoiceRequired);
+    } else {
+        let decision = license_decision(expression.as_deref(), policy);
+        explanation.branch = decision.branch;
+        explanation.matched = decision.matched;
+        explanation.violations.extend(decision.kind);
+    }
+    explanation
+        .violations
+        .extend(health_violations(info, &policy.health));
+    explanation
+        .violations
+        .extend(legal_file_violations(info, &policy.legal_files));
+
+    if explanation.violations.is_empty() {
+        explanation.reason = match unknown {
+            Some((kind, action)) => unknown_reason(info, kind, action),
+            None => accepted_reason(&explanation, policy),
+        };
+        return explanation;
+    }
+
+    explanation.reason = explanation
+        .violations
+        .iter()
+        .map(|kind| kind.describe())
+        .collect::<Vec<_>>()
+        .join(", ");
+    explanation.decision = match active_exception(&policy.exceptions, info, today) {
+        Some(exception) => {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Policy violation for {}@{} waived by exception: {}",
+                    info.name, info.version, exception.reason
+                ),
+            );
+            explanation.reason = format!(
+                "{}, waived by exception: {}",
+                explanation.reason, exception.reason
+            );
+            explanation.exception = Some(exception.clone());
+            PolicyDecision::Waived
+        }
+        None => PolicyDecision::Fail,
+    };
+    explanation
+}
+
+/// Why a dependency with an unknown license passed, e.g. `no license found, a warning under [policy.unknown] missing`
+fn unknown_reason(info: &LicenseInfo, kind: UnknownLicense, action: HealthAction) -> String {
+    let found = match kind {
+        UnknownLicense::Missing => "no license found".to_string(),
+        UnknownLicense::Unrecognized => format!("{} is not recognized", info.get_license()),
+    };
+    let handled = match action {
+        HealthAction::Ignore => "ignored",
+        _ => "a warning",
+    };
+    format!("{found}, {handled} under [policy.unknown] {kind}")
+}
+
+/// Why an accepted dependency passed, e.g. `MIT of MIT OR GPL-3.0 is on the allow list`
+fn accepted_reason(explanation: &PolicyExplanation, policy: &PolicyConfig) -> String {
+    let Some(expression) = &explanation.expression else {
+        return "no license information and no allow list".to_string();
+    };
+    let license = match &explanation.branch {
+        Some(branch) if branch != expression => format!("{branch} of {expression}"),
+        _ => expression.clone(),
+    };
+    if policy.allow.is_empty() {
+        format!("{license} is not on the deny list")
+    } else {
+        format!("{license} is on the allow list")
+    }
+}
+
+/// How the chosen license of a dependency was picked, `None` without a choice
+fn chosen_by(info: &LicenseInfo, policy: &PolicyConfig) -> Option<ChoiceSource> {
+    let chosen = info.chosen_license.as_deref()?;
+    let explicit = policy
+        .choice_for(&info.name, &info.version)
+        .and_then(|choice| choice.license.as_deref())
+        .is_some_and(|license| license.trim().eq_ignore_ascii_case(chosen));
+    Some(if explicit {
+        ChoiceSource::Explicit
+    } else {
+        ChoiceSource::PreferPermissive
+    })
+}
+
+/// Health signals of a dependency that `[policy.health]` fails on
+fn health_violations(info: &LicenseInfo, policy: &HealthPolicy) -> Vec<ViolationKind> {
+    let Some(health) = &info.health else {
+        return Vec::new();
+    };
+    health
+        .signals()
+        .into_iter()
+        .filter(|signal| policy.action(*signal) == HealthAction::Fail)
+        .map(|signal| match signal {
+            HealthSignal::Deprecated => ViolationKind::Deprecated,
+            HealthSignal::Yanked => ViolationKind::Yanked,
+            HealthSignal::Archived => ViolationKind::Archived,
+        })
+        .collect()
+}
+
+/// Kinds of legal files of a dependency that `[policy.legal_files]` fails on
+fn legal_file_violations(info: &LicenseInfo, policy: &LegalFilesPolicy) -> Vec<ViolationKind> {
+    let mut kinds: Vec<LegalFileKind> = info
+        .legal_files
+        .iter()
+        .flatten()
+        .map(|file| file.kind)
+        .filter(|kind| policy.action(*kind) == HealthAction::Fail)
+        .collect();
+    kinds.sort();
+    kinds.dedup();
+    kinds
+        .into_iter()
+        .map(|kind| match kind {
+            LegalFileKind::Patents => ViolationKind::PatentTerms,
+            LegalFileKind::Eula => ViolationKind::Eula,
+            LegalFileKind::Commercial => ViolationKind::CommercialLicense,
+            LegalFileKind::Cla => ViolationKind::ContributorAgreement,
+        })
+        .collect()
+}
+
+/// Find an unexpired exception covering the dependency
+fn active_exception<'a>(
+    exceptions: &'a [PolicyException],
+    info: &LicenseInfo,
+    today: NaiveDate,
+) -> Option<&'a PolicyException> {
+    exceptions
+        .iter()
+        .filter(|exception| exception.matches(&info.name, &info.version))
+        .find(|exception| match exception.expiry_date() {
+            Ok(Some(expires)) if expires < today => {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "Policy exception for {} expired on {expires}",
+                        exception.name
+                    ),
+                );
+                false
+            }
+            Ok(_) => true,
+            // Invalid dates are rejected when the config is validated
+            Err(_) => false,
+        })
+}
+
+/// Decide whether a license expression violates the policy
+///
+/// For `OR` expressions it is enough for one alternative to be acceptable; an
+/// `AND` alternative is only acceptable if every term in it is.
+pub(crate) fn violation_kind(
+    license: Option<&str>,
+    policy: &PolicyConfig,
+) -> Option<ViolationKind> {
+    license_decision(license, policy).kind
+}
+
+/// Outcome of a license expression with the rules behind it
+struct LicenseDecision {
+    kind: Option<ViolationKind>,
+    /// The accepted alternative
+    branch: Option<String>,
+    matched: Vec<RuleMatch>,
+}
+
+fn license_decision(license: Option<&str>, policy: &PolicyConfig) -> LicenseDecision {
+    let license = match license {
+        Some(license) if !license.trim().is_empty() => license,
+        _ => {
+            // Without license information only an allow list can be violated
+            return LicenseDecision {
+                kind: (!policy.allow.is_empty()).then_some(ViolationKind::NotAllowed),
+                branch: None,
+                matched: Vec::new(),
+            };
+        }
+    };
+
+    let alternatives = license_alternatives(license);
+    let denied_terms = || {
+        let mut matched: Vec<RuleMatch> = Vec::new();
+        for term in alternatives.iter().flatten() {
+            let Some(rule) = rule_for(term, policy).filter(|rule| rule.list == RuleList::Deny)
+            else {
+                continue;
+            };
+            if !matched.contains(&rule) {
+                matched.push(rule);
+            }
+        }
+        matched
+    };
+
+    let all_denied = alternatives
+        .iter()
+        .all(|terms| terms.iter().any(|term| is_denied(term, policy)));
+    if all_denied {
+        return LicenseDecision {
+            kind: Some(ViolationKind::Denied),
+            branch: None,
+            matched: denied_terms(),
+        };
+    }
+
+    match select_alternative(&alternatives, policy) {
+        Some(selected) => {
+            if alternatives.len() > 1 {
+                log(
+                    LogLevel::Info,
+                    &format!("Policy accepts {license} under {}", join_terms(selected)),
+                );
+            }
+            LicenseDecision {
+                kind: None,
+                branch: Some(join_terms(selected)),
+                matched: selected
+                    .iter()
+                    .filter_map(|term| rule_for(term, policy))
+                    .collect(),
+            }
+        }
+        None => LicenseDecision {
+            kind: Some(ViolationKind::NotAllowed),
+            branch: None,
+            matched: denied_terms(),
+        },
+    }
+}
+
+/// The deny entry that rejects a term, or else the allow entry that accepts it
+fn rule_for(term: &LicenseTerm, policy: &PolicyConfig) -> Option<RuleMatch> {
+    let (list, entry) = if is_denied(term, policy) {
+        (RuleList::Deny, listed_entry(&policy.deny, term)?)
+    } else {
+        (RuleList::Allow, listed_entry(&policy.allow, term)?)
+    };
+    Some(RuleMatch {
+        list,
+        entry: entry.trim().to_string(),
+        term: term.to_string(),
+    })
+}
+
+/// Strategy that applies to a dependency, its own in `[[policy.choices]]` first
+fn strategy_for(info: &LicenseInfo, policy: &PolicyConfig) -> Option<DualLicenseStrategy> {
+    policy
+        .choice_for(&info.name, &info.version)
+        .and_then(|choice| choice.strategy)
+        .or(policy.dual_license)
+}
+
+/// The license to use for a dual- or multi-licensed dependency
+///
+/// A license chosen in `[[policy.choices]]` wins when it is one of the
+/// alternatives. Otherwise `prefer-permissive` picks the most permissive
+/// alternative the policy accepts, or the most permissive one overall when none
+/// is. Single licenses and `require-explicit-choice` without a choice give `None`.
+pub fn choose_license(info: &LicenseInfo, policy: &PolicyConfig) -> Option<String> {
+    let license = info.license.as_deref()?;
+    let alternatives = license_alternatives(license);
+    if alternatives.len() < 2 {
+        return None;
+    }
+
+    let explicit = policy
+        .choice_for(&info.name, &info.version)
+        .and_then(|choice| choice.license.as_deref());
+    if let Some(chosen) = explicit {
+        let found = alternatives
+            .iter()
+            .map(|terms| join_terms(terms))
+            .find(|alternative| alternative.eq_ignore_ascii_case(chosen.trim()));
+        if found.is_none() {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Chosen license {chosen} for {}@{} is not one of {license}",
+                    info.name, info.version
+                ),
+            );
+        }
+        return found;
+    }
+
+    match strategy_for(info, policy)? {
+        DualLicenseStrategy::PreferPermissive => select_alternative(&alternatives, policy)
+            .or_else(|| {
+                alternatives
+                    .iter()
+                    .min_by_key(|terms| permissiveness(terms))
+            })
+            .map(|terms| join_terms(terms)),
+        DualLicenseStrategy::RequireExplicitChoice => None,
+    }
+}
+
+/// Whether a dependency fails `require-explicit-choice` for lack of a chosen license
+fn requires_choice(info: &LicenseInfo, policy: &PolicyConfig) -> bool {
+    info.chosen_license.is_none()
+        && strategy_for(info, policy) == Some(DualLicenseStrategy::RequireExplicitChoice)
+        && info
+            .license
+            .as_deref()
+            .is_some_and(|license| license_alternatives(license).len() > 1)
+}
+
+/// Record the chosen license of every dual-licensed dependency
+///
+/// Restrictiveness is re-evaluated against the chosen license, so
+/// `MIT OR GPL-2.0` resolved to `MIT` is no longer flagged.
+pub fn apply_license_choices(
+    dependencies: &mut [LicenseInfo],
+    policy: &PolicyConfig,
+    strict: bool,
+) {
+    if policy.dual_license.is_none() && policy.choices.is_empty() {
+        return;
+    }
+
+    let mut known_licenses = None;
+    for info in dependencies {
+        info.chosen_license = choose_license(info, policy);
+        let Some(chosen) = &info.chosen_license else {
+            continue;
+        };
+        log(
+            LogLevel::Info,
+            &format!(
+                "Using {chosen} for {}@{} ({})",
+                info.name,
+                info.version,
+                info.get_license()
+            ),
+        );
+        let known = known_licenses.get_or_insert_with(|| {
+            fetch_licenses_from_github().unwrap_or_else(|err| {
+                log_error("Failed to fetch licenses from GitHub", &err);
+                HashMap::new()
+            })
+        });
+        info.is_restrictive = is_license_restrictive(&Some(chosen.clone()), known, strict);
+    }
+}
+
+/// The acceptable alternative the policy chooses, if any
+///
+/// Among the acceptable alternatives the most permissive one wins, so
+/// `GPL-3.0 OR MIT` resolves to `MIT` when both are allowed.
+fn select_alternative<'a>(
+    alternatives: &'a [Vec<LicenseTerm>],
+    policy: &PolicyConfig,
+) -> Option<&'a Vec<LicenseTerm>> {
+    alternatives
+        .iter()
+        .filter(|terms| terms.iter().all(|term| is_accepted(term, policy)))
+        .min_by_key(|terms| permissiveness(terms))
+}
+
+/// Copyleft rank of the most restrictive term of an alternative
+fn permissiveness(terms: &[LicenseTerm]) -> u8 {
+    terms
+        .iter()
+        .map(|term| copyleft_rank(&term.id))
+        .max()
+        .unwrap_or(0)
+}
+
+fn join_terms(terms: &[LicenseTerm]) -> String {
+    terms
+        .iter()
+        .map(|term| term.to_string())
+        .collect::<Vec<_>>()
+        .join(" AND ")
+}
+
+/// Expand a license field into alternatives, tolerating strings that aren't valid SPDX
+pub fn license_alternatives(license: &str) -> Vec<Vec<LicenseTerm>> {
+    match LicenseExpression::parse(license) {
+        Ok(expression) => expression.alternatives(),
+        Err(err) => {
+            log(
+                LogLevel::Info,
+                &format!("Treating '{license}' as plain license text: {err}"),
+            );
+            license
+                .split(" OR ")
+                .map(|alternative| {
+                    alternative
+                        .split(" AND ")
+                        .map(|term| LicenseTerm {
+                            id: term
+                                .trim()
+                                .trim_matches(|c| c == '(' || c == ')')
+                                .trim()
+                                .to_string(),
+                            or_later: false,
+                            exception: None,
+                        })
+                        .collect()
+                })
+                .collect()
+        }
+    }
+}
+
+/// Whether a policy list names the term
+///
+/// An entry with an exception (`GPL-2.0-only WITH Classpath-exception-2.0`) only
+/// matches that exact combination; a bare license entry matches the license with
+/// or without an exception.
+fn is_listed(list: &[String], term: &LicenseTerm) -> bool {
+    listed_entry(list, term).is_some()
+}
+
+fn listed_entry<'a>(list: &'a [String], term: &LicenseTerm) -> Option<&'a String> {
+    list.iter().find(|entry| {
+        let entry = entry.trim();
+        entry.eq_ignore_ascii_case(&term.to_string())
+            || (!entry.to_uppercase().contains(" WITH ")
+                && entry.eq_ignore_ascii_case(&term.license_id()))
+    })
+}
+
+/// Explicitly allowing a license with an exception overrides a deny on the bare license
+fn is_denied(term: &LicenseTerm, policy: &PolicyConfig) -> bool {
+    let allowed_with_exception = term.exception.is_some()
+        && policy
+            .allow
+            .iter()
+            .any(|entry| entry.trim().eq_ignore_ascii_case(&term.to_string()));
+
+    !allowed_with_exception && is_listed(&policy.deny, term)
+}
+
+fn is_accepted(term: &LicenseTerm, policy: &PolicyConfig) -> bool {
+    !is_denied(term, policy) && (policy.allow.is_empty() || is_listed(&policy.allow, term))
+}
+
+/// Rough ordering of licenses from most to least permissive
+pub(crate) fn copyleft_rank(license_id: &str) -> u8 {
+    let id = license_id.to_uppercase();
+
+    if ["CC0", "UNLICENSE", "0BSD", "WTFPL"]
+        .iter()
+        .any(|p| id.starts_with(p))
+    {
+        0
+    } else if [
+        "MIT", "BSD", "ISC", "APACHE", "ZLIB", "BSL", "PSF", "X11", "PYTHON",
+    ]
+    .iter()
+    .any(|p| id.starts_with(p))
+    {
+        1
+    } else if ["LGPL", "MPL", "EPL", "CDDL", "EUPL", "OSL", "CECILL"]
+        .iter()
+        .any(|p| id.starts_with(p))
+    {
+        2
+    } else if id.starts_with("GPL") {
+        3
+    } else if id.starts_with("AGPL") || id.starts_with("SSPL") {
+        4
+    } else {
+        // Unknown licenses are the least attractive choice
+        5
+    }
+}
+
+/// Print policy violations to stderr so structured output on stdout stays intact
+pub fn print_policy_violations(violations: &[PolicyViolation]) {
+    eprintln!(
+        "\n{} {}",
+        "⛔".bold(),
+        format!("License policy violations: {}", violations.len())
+            .red()
+            .bold()
+    );
+
+    for violation in violations {
+        let reason = violation.kind.describe();
+        eprintln!(
+            "  {}@{} ({}): {}{}",
+            violation.name,
+            violation.version,
+            violation.license.as_deref().unwrap_or("No License"),
+            reason,
+            violation
+                .introduced_by
+                .as_deref()
+                .map(|chain| format!(", introduced by {chain}"))
+                .unwrap_or_default()
+        );
+    }
+}
+
+/// Print the dependencies whose missing or unrecognized license `[policy.unknown]` warns about
+pub fn print_unknown_licenses(dependencies: &[LicenseInfo], policy: &PolicyConfig) {
+    let rows: Vec<Vec<String>> = dependencies
+        .iter()
+        .filter(|info| policy.applies_to(info.scope))
+        .filter_map(|info| {
+            let kind = info.unknown_license()?;
+            (policy.unknown.action(kind) == Some(HealthAction::Warn)).then(|| {
+                vec![
+                    info.name.clone(),
+                    info.version.clone(),
+                    kind.to_string(),
+                    info.get_license(),
+                ]
+            })
+        })
+        .collect();
+    if rows.is_empty() {
+        return;
+    }
+
+    println!(
+        "\n{} {}\n",
+        "⚠️".bold(),
+        format!("Unknown licenses: {}", rows.len()).yellow().bold()
+    );
+
+    let headers = ["Package", "Version", "Kind", "License"];
+    let mut formatter = TableFormatter::new(headers.iter().map(|h| h.to_string()).collect());
+    for row in &rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+    for row in &rows {
+        println!("{}", formatter.render_row(row, true));
+    }
+    println!("{}\n", formatter.render_footer());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::{
+        HealthAction, HealthPolicy, LegalFilesPolicy, LicenseChoice, LinkageRules, LinkingPolicy,
+        RemotePolicyConfig, UnknownLicensePolicy,
+    };
+    use crate::health::PackageHealth;
+    use crate::legal_files::LegalFile;
+    use crate::licenses::DependencyScope;
+    use std::collections::BTreeMap;
+
+    fn date(s: &str) -> NaiveDate {
+        NaiveDate::parse_from_str(s, "%Y-%m-%d").unwrap()
+    }
+
+    #[test]
+    fn test_empty_policy_has_no_violations() {
+        let data = vec![
+            LicenseInfo::test("a", "1.0.0", Some("GPL-3.0")),
+            LicenseInfo::test("b", "1.0.0", None),
+        ];
+        let violations = evaluate_policy(
+            &data,
+            &PolicyConfig::default(),
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        assert!(violations.is_empty());
+    }
+
+    #[test]
+    fn test_deny_and_allow_lists() {
+        let policy = PolicyConfig {
+            allow: vec!["MIT".to_string(), "Apache-2.0".to_string()],
+            deny: vec!["GPL-3.0".to_string()],
+            exceptions: Vec::new(),
+            scopes: Vec::new(),
+            dual_license: None,
+            choices: Vec::new(),
+            linking: LinkingPolicy::default(),
+            health: HealthPolicy::default(),
+            unknown: UnknownLicensePolicy::default(),
+            legal_files: LegalFilesPolicy::default(),
+            remote: RemotePolicyConfig::default(),
+        };
+        let data = vec![
+            LicenseInfo::test("ok", "1.0.0", Some("MIT")),
+            LicenseInfo::test("denied", "1.0.0", Some("GPL-3.0")),
+            LicenseInfo::test("unlisted", "1.0.0", Some("BSD-3-Clause")),
+            LicenseInfo::test("unknown", "1.0.0", None),
+            LicenseInfo::test("dual", "1.0.0", Some("MIT OR GPL-3.0")),
+        ];
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        assert_eq!(violations.len(), 3);
+        assert_eq!(violations[0].name, "denied");
+        assert_eq!(violations[0].kind, ViolationKind::Denied);
+        assert_eq!(violations[1].name, "unlisted");
+        assert_eq!(violations[1].kind, ViolationKind::NotAllowed);
+        assert_eq!(violations[2].name, "unknown");
+        assert_eq!(violations[2].kind, ViolationKind::NotAllowed);
+    }
+
+    #[test]
+    fn test_and_expression_requires_all_terms() {
+        let policy = PolicyConfig {
+            allow: Vec::new(),
+            deny: vec!["AGPL-3.0".to_string()],
+            exceptions: Vec::new(),
+            scopes: Vec::new(),
+            dual_license: None,
+            choices: Vec::new(),
+            linking: LinkingPolicy::default(),
+            health: HealthPolicy::default(),
+            unknown: UnknownLicensePolicy::default(),
+            legal_files: LegalFilesPolicy::default(),
+            remote: RemotePolicyConfig::default(),
+        };
+        let data = vec![LicenseInfo::test(
+            "combo",
+            "1.0.0",
+            Some("(MIT AND AGPL-3.0)"),
+        )];
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        assert_eq!(violations.len(), 1);
+        assert_eq!(violations[0].kind, ViolationKind::Denied);
+    }
+
+    #[test]
+    fn test_or_selects_most_permissive_allowed_branch() {
+        let policy = PolicyConfig {
+            allow: vec![
+                "MIT".to_string(),
+                "GPL-3.0-only".to_string(),
+                "Apache-2.0".to_string(),
+            ],
+            deny: Vec::new(),
+            exceptions: Vec::new(),
+            scopes: Vec::new(),
+            dual_license: None,
+            choices: Vec::new(),
+            linking: LinkingPolicy::default(),
+            health: HealthPolicy::default(),
+            unknown: UnknownLicensePolicy::default(),
+            legal_files: LegalFilesPolicy::default(),
+            remote: RemotePolicyConfig::default(),
+        };
+
+        let branch = |license| license_decision(Some(license), &policy).branch;
+        assert_eq!(branch("GPL-3.0-only OR MIT"), Some("MIT".to_string()));
+        assert_eq!(
+            branch("(MIT OR GPL-3.0-only) AND Apache-2.0"),
+            Some("MIT AND Apache-2.0".to_string())
+        );
+        assert_eq!(branch("BSD-3-Clause OR ISC"), None);
+    }
+
+    #[test]
+    fn test_with_exceptions() {
+        let policy = PolicyConfig {
+            allow: vec!["GPL-2.0-only WITH Classpath-exception-2.0".to_string()],
+            deny: vec!["GPL-2.0-only".to_string()],
+            exceptions: Vec::new(),
+            scopes: Vec::new(),
+            dual_license: None,
+            choices: Vec::new(),
+            linking: LinkingPolicy::default(),
+            health: HealthPolicy::default(),
+            unknown: UnknownLicensePolicy::default(),
+            legal_files: LegalFilesPolicy::default(),
+            remote: RemotePolicyConfig::default(),
+        };
+        let data = vec![
+            LicenseInfo::test(
+                "classpath",
+                "1.0.0",
+                Some("GPL-2.0-only WITH Classpath-exception-2.0"),
+            ),
+            LicenseInfo::test("plain", "1.0.0", Some("GPL-2.0-only")),
+            LicenseInfo::test(
+                "other-exception",
+                "1.0.0",
+                Some("GPL-2.0-only WITH GCC-exception-3.1"),
+            ),
+        ];
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        assert_eq!(violations.len(), 2);
+        assert_eq!(violations[0].name, "plain");
+        assert_eq!(violations[0].kind, ViolationKind::Denied);
+        assert_eq!(violations[1].name, "other-exception");
+        assert_eq!(violations[1].kind, ViolationKind::Denied);
+    }
+
+    #[test]
+    fn test_exceptions_and_expiry() {
+        let policy = PolicyConfig {
+            allow: Vec::new(),
+            deny: vec!["GPL-3.0".to_string()],
+            exceptions: vec![
+                PolicyException {
+                    name: "any-version".to_string(),
+                    version: String::new(),
+                    expires: None,
+                    reason: "Approved by legal".to_string(),
+                },
+                PolicyException {
+                    name: "pinned".to_string(),
+                    version: "1.0.0".to_string(),
+                    expires: Some("2025-06-30".to_string()),
+                    reason: "Temporary".to_string(),
+                },
+            ],
+            scopes: Vec::new(),
+            dual_license: None,
+            choices: Vec::new(),
+            linking: LinkingPolicy::default(),
+            health: HealthPolicy::default(),
+            unknown: UnknownLicensePolicy::default(),
+            legal_files: LegalFilesPolicy::default(),
+            remote: RemotePolicyConfig::default(),
+        };
+        let data = vec![
+            LicenseInfo::test("any-version", "3.2.1", Some("GPL-3.0")),
+            LicenseInfo::test("pinned", "1.0.0", Some("GPL-3.0")),
+            LicenseInfo::test("pinned", "2.0.0", Some("GPL-3.0")),
+        ];
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-06-30"),
+        );
+        assert_eq!(violations.len(), 1);
+        assert_eq!(violations[0].version, "2.0.0");
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-07-01"),
+        );
+        assert_eq!(violations.len(), 2);
+        assert!(violations.iter().all(|v| v.name == "pinned"));
+    }
+
+    #[test]
+    fn test_choose_license() {
+        let gpl_or_mit = LicenseInfo::test("jszip", "3.10.1", Some("GPL-3.0-or-later OR MIT"));
+        let single = LicenseInfo::test("left-pad", "1.3.0", Some("MIT"));
+
+        // Without a strategy nothing is chosen
+        assert_eq!(choose_license(&gpl_or_mit, &PolicyConfig::default()), None);
+
+        let policy = PolicyConfig {
+            dual_license: Some(DualLicenseStrategy::PreferPermissive),
+            ..PolicyConfig::default()
+        };
+        assert_eq!(
+            choose_license(&gpl_or_mit, &policy),
+            Some("MIT".to_string())
+        );
+        assert_eq!(choose_license(&single, &policy), None);
+
+        // The allow list narrows the alternatives
+        let policy = PolicyConfig {
+            allow: vec!["GPL-3.0-or-later".to_string()],
+            dual_license: Some(DualLicenseStrategy::PreferPermissive),
+            ..PolicyConfig::default()
+        };
+        assert_eq!(
+            choose_license(&gpl_or_mit, &policy),
+            Some("GPL-3.0-or-later".to_string())
+        );
+
+        let policy = PolicyConfig {
+            dual_license: Some(DualLicenseStrategy::RequireExplicitChoice),
+            choices: vec![
+                LicenseChoice {
+                    name: "jszip".to_string(),
+                    license: Some("gpl-3.0-or-later".to_string()),
+                    ..LicenseChoice::default()
+                },
+                LicenseChoice {
+                    name: "dompurify".to_string(),
+                    license: Some("BSD-3-Clause".to_string()),
+                    ..LicenseChoice::default()
+                },
+                LicenseChoice {
+                    name: "ace".to_string(),
+                    strategy: Some(DualLicenseStrategy::PreferPermissive),
+                    ..LicenseChoice::default()
+                },
+            ],
+            ..PolicyConfig::default()
+        };
+        assert_eq!(
+            choose_license(&gpl_or_mit, &policy),
+            Some("GPL-3.0-or-later".to_string())
+        );
+        // A choice that isn't one of the alternatives is ignored
+        assert_eq!(
+            choose_license(
+                &LicenseInfo::test("dompurify", "3.1.0", Some("MPL-2.0 OR Apache-2.0")),
+                &policy
+            ),
+            None
+        );
+        assert_eq!(
+            choose_license(
+                &LicenseInfo::test("ace", "1.0.0", Some("GPL-2.0-only OR BSD-2-Clause")),
+                &policy
+            ),
+            Some("BSD-2-Clause".to_string())
+        );
+        assert_eq!(
+            choose_license(
+                &LicenseInfo::test("other", "1.0.0", Some("GPL-2.0-only OR BSD-2-Clause")),
+                &policy
+            ),
+            None
+        );
+    }
+
+    #[test]
+    fn test_require_explicit_choice() {
+        let policy = PolicyConfig {
+            deny: vec!["GPL-3.0-or-later".to_string()],
+            dual_license: Some(DualLicenseStrategy::RequireExplicitChoice),
+            choices: vec![LicenseChoice {
+                name: "chosen".to_string(),
+                license: Some("GPL-3.0-or-later".to_string()),
+                ..LicenseChoice::default()
+            }],
+            ..PolicyConfig::default()
+        };
+        let mut data = vec![
+            LicenseInfo::test("unchosen", "1.0.0", Some("MIT OR Apache-2.0")),
+            LicenseInfo::test("chosen", "1.0.0", Some("MIT OR GPL-3.0-or-later")),
+            LicenseInfo::test("single", "1.0.0", Some("MIT")),
+        ];
+        for info in &mut data {
+            info.chosen_license = choose_license(info, &policy);
+        }
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        let kinds: Vec<_> = violations
+            .iter()
+            .map(|v| (v.name.as_str(), v.kind.clone()))
+            .collect();
+        // The explicit choice is checked, so choosing a denied license fails
+        assert_eq!(
+            kinds,
+            vec![
+                ("unchosen", ViolationKind::ChoiceRequired),
+                ("chosen", ViolationKind::Denied),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_linking_rules() {
+        let policy = PolicyConfig {
+            deny: vec!["MPL-2.0".to_string()],
+            linking: LinkingPolicy {
+                static_linking: LinkageRules {
+                    deny: vec!["LGPL-2.1-only".to_string()],
+                    ..LinkageRules::default()
+                },
+                dynamic_linking: LinkageRules {
+                    allow: vec!["MPL-2.0".to_string()],
+                    ..LinkageRules::default()
+                },
+            },
+            ..PolicyConfig::default()
+        };
+        let project = ProjectConfig {
+            linking: Some(Linkage::Dynamic),
+            ecosystem_linking: BTreeMap::from([("rust".to_string(), Linkage::Static)]),
+            ..ProjectConfig::default()
+        };
+        let in_manifest = |name, license, source_file: &str| {
+            let mut info = LicenseInfo::test(name, "1.0.0", Some(license));
+            info.source_file = Some(source_file.to_string());
+            info
+        };
+        let data = vec![
+            in_manifest("static-lgpl", "LGPL-2.1-only", "Cargo.toml"),
+            in_manifest("dynamic-lgpl", "LGPL-2.1-only", "package.json"),
+            in_manifest("static-mpl", "MPL-2.0", "Cargo.toml"),
+            in_manifest("dynamic-mpl", "MPL-2.0", "package.json"),
+            LicenseInfo::test("unlinked-mpl", "1.0.0", Some("MPL-2.0")),
+        ];
+
+        let violations = evaluate_policy(&data, &policy, &project, date("2025-01-01"));
+        let names: Vec<_> = violations.iter().map(|v| v.name.as_str()).collect();
+        // Without a source file the dependency falls back to `[project] linking`
+        assert_eq!(names, vec!["static-lgpl", "static-mpl"]);
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        let names: Vec<_> = violations.iter().map(|v| v.name.as_str()).collect();
+        assert_eq!(names, vec!["static-mpl", "dynamic-mpl", "unlinked-mpl"]);
+    }
+
+    #[test]
+    fn test_health_violations() {
+        let policy = PolicyConfig {
+            deny: vec!["GPL-3.0".to_string()],
+            health: HealthPolicy {
+                yanked: HealthAction::Fail,
+                archived: HealthAction::Fail,
+                ..HealthPolicy::default()
+            },
+            exceptions: vec![PolicyException {
+                name: "waived".to_string(),
+                version: String::new(),
+                expires: None,
+                reason: "Replacement scheduled".to_string(),
+            }],
+            ..PolicyConfig::default()
+        };
+        let with_health = |name, license, health: PackageHealth| {
+            let mut info = LicenseInfo::test(name, "1.0.0", Some(license));
+            info.health = Some(health);
+            info
+        };
+        let yanked_and_archived = PackageHealth {
+            yanked: true,
+            archived: true,
+            ..PackageHealth::default()
+        };
+        let data = vec![
+            with_health("yanked-gpl", "GPL-3.0", yanked_and_archived.clone()),
+            with_health(
+                "deprecated",
+                "MIT",
+                PackageHealth {
+                    deprecated: Some("Use something else".to_string()),
+                    ..PackageHealth::default()
+                },
+            ),
+            with_health("waived", "MIT", yanked_and_archived),
+            LicenseInfo::test("unchecked", "1.0.0", Some("MIT")),
+        ];
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        let found: Vec<_> = violations
+            .iter()
+            .map(|v| (v.name.as_str(), v.kind.clone()))
+            .collect();
+        // Deprecation only warns by default
+        assert_eq!(
+            found,
+            vec![
+                ("yanked-gpl", ViolationKind::Denied),
+                ("yanked-gpl", ViolationKind::Yanked),
+                ("yanked-gpl", ViolationKind::Archived),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_legal_file_violations() {
+        let policy = PolicyConfig {
+            legal_files: LegalFilesPolicy {
+                eula: HealthAction::Fail,
+                cla: HealthAction::Fail,
+                ..LegalFilesPolicy::default()
+            },
+            ..PolicyConfig::default()
+        };
+        let file = |kind, file: &str| LegalFile {
+            kind,
+            file: file.to_string(),
+            matched: None,
+        };
+        let mut eula = LicenseInfo::test("eula", "1.0.0", Some("MIT"));
+        eula.legal_files = Some(vec![
+            file(LegalFileKind::Eula, "EULA.txt"),
+            file(LegalFileKind::Eula, "legal/terms.txt"),
+            file(LegalFileKind::Patents, "PATENTS"),
+        ]);
+        let mut cla = LicenseInfo::test("cla", "1.0.0", Some("Apache-2.0"));
+        cla.legal_files = Some(vec![file(LegalFileKind::Cla, "CLA.md")]);
+        let data = vec![eula, cla, LicenseInfo::test("plain", "1.0.0", Some("MIT"))];
+
+        let violations = evaluate_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        let found: Vec<_> = violations
+            .iter()
+            .map(|v| (v.name.as_str(), v.kind.clone()))
+            .collect();
+        // One violation per kind, and patent terms only warn by default
+        assert_eq!(
+            found,
+            vec![
+                ("eula", ViolationKind::Eula),
+                ("cla", ViolationKind::ContributorAgreement),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_unknown_license_policy() {
+        let data = vec![
+            LicenseInfo::test("missing", "1.0.0", None),
+            LicenseInfo::test("proprietary", "1.0.0", Some("UNLICENSED")),
+            LicenseInfo::test("custom", "1.0.0", Some("See LICENSE file")),
+            LicenseInfo::test("listed", "1.0.0", Some("MIT")),
+        ];
+        let explain = |policy: &PolicyConfig| {
+            explain_policy(&data, policy, &ProjectConfig::default(), date("2025-01-01"))
+        };
+
+        // Missing licenses fail while unrecognized ones only warn
+        let policy = PolicyConfig {
+            allow: vec!["MIT".to_string()],
+            unknown: UnknownLicensePolicy {
+                missing: Some(HealthAction::Fail),
+                unrecognized: Some(HealthAction::Warn),
+            },
+            ..PolicyConfig::default()
+        };
+        let explanations = explain(&policy);
+        let decisions: Vec<_> = explanations
+            .iter()
+            .map(|explanation| (explanation.decision, explanation.violations.clone()))
+            .collect();
+        assert_eq!(
+            decisions,
+            vec![
+                (PolicyDecision::Fail, vec![ViolationKind::MissingLicense]),
+                (PolicyDecision::Fail, vec![ViolationKind::MissingLicense]),
+                (PolicyDecision::Pass, vec![]),
+                (PolicyDecision::Pass, vec![]),
+            ]
+        );
+        assert_eq!(
+            explanations[2].reason,
+            "See LICENSE file is not recognized, a warning under [policy.unknown] unrecognized"
+        );
+
+        // Without an action the allow list decides, as before
+        let policy = PolicyConfig {
+            allow: vec!["MIT".to_string()],
+            unknown: UnknownLicensePolicy {
+                unrecognized: Some(HealthAction::Fail),
+                ..UnknownLicensePolicy::default()
+            },
+            ..PolicyConfig::default()
+        };
+        let violations: Vec<_> = explain(&policy)
+            .into_iter()
+            .map(|explanation| explanation.violations)
+            .collect();
+        assert_eq!(
+            violations,
+            vec![
+                vec![ViolationKind::NotAllowed],
+                vec![ViolationKind::NotAllowed],
+                vec![ViolationKind::UnrecognizedLicense],
+                vec![],
+            ]
+        );
+    }
+
+    #[test]
+    fn test_explain_policy() {
+        let policy = PolicyConfig {
+            allow: vec!["MIT".to_string(), "GPL-3.0".to_string()],
+            deny: vec!["AGPL-3.0".to_string()],
+            exceptions: vec![PolicyException {
+                name: "waived".to_string(),
+                version: "1.0.0".to_string(),
+                expires: None,
+                reason: "Approved by legal".to_string(),
+            }],
+            scopes: vec![DependencyScope::Runtime],
+            dual_license: Some(DualLicenseStrategy::PreferPermissive),
+            choices: vec![LicenseChoice {
+                name: "chosen".to_string(),
+                license: Some("GPL-3.0".to_string()),
+                ..LicenseChoice::default()
+            }],
+            ..PolicyConfig::default()
+        };
+        let mut data = vec![
+            LicenseInfo::test("dual", "1.0.0", Some("GPL-3.0 OR MIT")),
+            LicenseInfo::test("chosen", "1.0.0", Some("GPL-3.0 OR MIT")),
+            LicenseInfo::test("denied", "1.0.0", Some("AGPL-3.0")),
+            LicenseInfo::test("waived", "1.0.0", Some("AGPL-3.0")),
+            LicenseInfo::test("unlisted", "1.0.0", Some("ISC")),
+            LicenseInfo::test("tooling", "1.0.0", Some("AGPL-3.0")),
+        ];
+        data[5].scope = DependencyScope::Dev;
+        for info in &mut data {
+            info.chosen_license = choose_license(info, &policy);
+        }
+
+        let explanations = explain_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        );
+        let decisions: Vec<_> = explanations.iter().map(|e| e.decision).collect();
+        assert_eq!(
+            decisions,
+            vec![
+                PolicyDecision::Pass,
+                PolicyDecision::Pass,
+                PolicyDecision::Fail,
+                PolicyDecision::Waived,
+                PolicyDecision::Fail,
+                PolicyDecision::Skipped,
+            ]
+        );
+
+        let dual = &explanations[0];
+        assert_eq!(dual.expression.as_deref(), Some("MIT"));
+        assert_eq!(dual.chosen_by, Some(ChoiceSource::PreferPermissive));
+        assert_eq!(dual.branch.as_deref(), Some("MIT"));
+        assert_eq!(
+            dual.matched,
+            vec![RuleMatch {
+                list: RuleList::Allow,
+                entry: "MIT".to_string(),
+                term: "MIT".to_string(),
+            }]
+        );
+        assert_eq!(dual.reason, "MIT is on the allow list");
+
+        assert_eq!(explanations[1].chosen_by, Some(ChoiceSource::Explicit));
+        assert_eq!(explanations[1].branch.as_deref(), Some("GPL-3.0"));
+
+        let denied = &explanations[2];
+        assert_eq!(denied.violations, vec![ViolationKind::Denied]);
+        assert_eq!(denied.matched[0].list, RuleList::Deny);
+        assert_eq!(denied.reason, "denied by policy");
+
+        let waived = &explanations[3];
+        assert_eq!(
+            waived.exception.as_ref().unwrap().reason,
+            "Approved by legal"
+        );
+        assert_eq!(
+            waived.reason,
+            "denied by policy, waived by exception: Approved by legal"
+        );
+
+        assert!(explanations[4].matched.is_empty());
+        assert_eq!(explanations[4].violations, vec![ViolationKind::NotAllowed]);
+
+        // The recorded decisions give the same violations as the policy check
+        let violations = apply_policy(&mut data, &policy, &ProjectConfig::default());
+        let names: Vec<_> = violations.iter().map(|v| v.name.as_str()).collect();
+        assert_eq!(names, vec!["denied", "unlisted"]);
+        assert!(data.iter().all(|info| info.explanation.is_some()));
+
+        let mut explanation = data[2].explanation.clone().unwrap();
+        explanation.waive_by_baseline();
+        assert_eq!(explanation.decision, PolicyDecision::Waived);
+        assert!(explanation.baseline);
+    }
+
+    #[test]
+    fn test_explain_unchosen_dual_license() {
+        let policy = PolicyConfig {
+            deny: vec!["GPL-3.0".to_string()],
+            ..PolicyConfig::default()
+        };
+        let data = vec![LicenseInfo::test("dual", "1.0.0", Some("GPL-3.0 OR MIT"))];
+
+        let explanation = &explain_policy(
+            &data,
+            &policy,
+            &ProjectConfig::default(),
+            date("2025-01-01"),
+        )[0];
+        assert_eq!(explanation.decision, PolicyDecision::Pass);
+        assert_eq!(explanation.chosen_by, None);
+        assert_eq!(explanation.branch.as_deref(), Some("MIT"));
+        assert!(explanation.matched.is_empty());
+        assert_eq!(
+            explanation.reason,
+            "MIT of GPL-3.0 OR MIT is not on the deny list"
+        );
+    }
+}
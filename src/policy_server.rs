@@ -0,0 +1,378 @@
+//! Centrally managed policies (`[policy.remote]`)
+//!
+//! A compliance team publishes one Feluda configuration file with the
+//! organization's `[policy]` and `[licenses]`, signs it with cosign, and every
+//! project points `[policy.remote] url` at it. The policy is fetched on every
+//! run, so a change reaches the CI of every repository on its next scan:
+//!
+//! - The document is only applied once its cosign bundle
+//!   (`<url>.sigstore.json`) has been checked with [`verify_blob`], against
+//!   the configured key or keyless signer.
+//! - A verified policy is cached in the user cache directory. It is reused
+//!   without asking the server for `ttl_minutes`, then revalidated with its
+//!   `ETag`, so an unchanged policy isn't downloaded again.
+//! - When the server can't be reached, or with `--offline`, the cached policy
+//!   is used with a warning. Without one the configuration fails to load
+//!   rather than the scan running without the organization's rules.
+//!
+//! Only `[policy]` and `[licenses]` are taken from the document. Its
+//! `[policy.remote]` and every other table are ignored, so a policy server
+//! can't change where Feluda fetches from or which commands it runs.
+
+use reqwest::header::{ETAG, IF_NONE_MATCH};
+use reqwest::StatusCode;
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::sync::{Mutex, OnceLock};
+use std::time::{Duration, SystemTime};
+use tempfile::NamedTempFile;
+
+use crate::cache::cache_dir_path;
+use crate::config::RemotePolicyConfig;
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::registry::{self, Registry};
+use crate::signing::{verify_blob, Signer};
+
+/// Subdirectory of the cache directory holding fetched policies
+const POLICY_CACHE_DIR: &str = "policies";
+
+/// Tables of a remote policy that are applied
+const POLICY_TABLES: [&str; 2] = ["policy", "licenses"];
+
+/// Policies fetched by this process, by URL, so the server is asked once per run
+static FETCHED: OnceLock<Mutex<HashMap<String, Result<toml::Table, String>>>> = OnceLock::new();
+
+/// The `[policy]` and `[licenses]` tables of the remote policy of `config`
+pub fn fetch_policy(config: &RemotePolicyConfig) -> FeludaResult<toml::Table> {
+    let url = config
+        .url
+        .as_deref()
+        .ok_or_else(|| FeludaError::Config("[policy.remote] has no url".to_string()))?;
+    let fetched = FETCHED.get_or_init(Default::default);
+    if let Some(result) = fetched.lock().unwrap().get(url) {
+        return result.clone().map_err(FeludaError::Config);
+    }
+
+    let result = cache_dir_path()
+        .and_then(|dir| load_policy(config, url, &dir.join(POLICY_CACHE_DIR)))
+        .map_err(|e| match e {
+            FeludaError::Config(message) => message,
+            e => format!("Failed to load the remote policy {url}: {e}"),
+        });
+    fetched
+        .lock()
+        .unwrap()
+        .insert(url.to_string(), result.clone());
+    result.map_err(FeludaError::Config)
+}
+
+/// Who must have signed the policy, `None` when `verify` is turned off
+fn signer(config: &RemotePolicyConfig) -> FeludaResult<Option<Signer>> {
+    if !config.verify {
+        return Ok(None);
+    }
+    match (
+        &config.key,
+        &config.certificate_identity,
+        &config.certificate_oidc_issuer,
+    ) {
+        (Some(key), _, _) => Ok(Some(Signer::Key(key.clone()))),
+        (None, Some(identity), Some(issuer)) => Ok(Some(Signer::Identity {
+            identity_regexp: identity.clone(),
+            oidc_issuer: issuer.clone(),
+        })),
+        _ => Err(FeludaError::Config(
+            "[policy.remote] needs a key, or a certificate_identity and certificate_oidc_issuer, \
+             to verify the policy; set verify = false to use it unsigned"
+                .to_string(),
+        )),
+    }
+}
+
+/// Files of the cached copy of one remote policy
+#[derive(Debug, Clone, PartialEq)]
+struct CachedPolicy {
+    document: PathBuf,
+    bundle: PathBuf,
+    etag: PathBuf,
+}
+
+impl CachedPolicy {
+    fn new(dir: &Path, url: &str) -> Self {
+        let digest: String = Sha256::digest(url.as_bytes())
+            .iter()
+            .take(8)
+            .map(|byte| format!("{byte:02x}"))
+            .collect();
+        Self {
+            document: dir.join(format!("{digest}.toml")),
+            bundle: dir.join(format!("{digest}.toml.sigstore.json")),
+            etag: dir.join(format!("{digest}.etag")),
+        }
+    }
+
+    fn exists(&self) -> bool {
+        self.document.is_file()
+    }
+
+    /// Whether the copy was fetched or revalidated less than `ttl_minutes` ago
+    fn is_fresh(&self, ttl_minutes: u64) -> bool {
+        let age = fs::metadata(&self.document)
+            .and_then(|metadata| metadata.modified())
+            .ok()
+            .and_then(|modified| SystemTime::now().duration_since(modified).ok());
+        age.is_some_and(|age| age < Duration::from_secs(ttl_minutes.saturating_mul(60)))
+    }
+
+    /// Verify the cached copy and return its policy tables
+    fn read(&self, signer: Option<&Signer>) -> FeludaResult<toml::Table> {
+        if let Some(signer) = signer {
+            verify_blob(&self.document, &self.bundle, signer)?;
+        }
+        policy_tables(&fs::read_to_string(&self.document)?)
+    }
+}
+
+fn load_policy(config: &RemotePolicyConfig, url: &str, dir: &Path) -> FeludaResult<toml::Table> {
+    let signer = signer(config)?;
+    if signer.is_none() {
+        log(
+            LogLevel::Warn,
+            &format!("Using the policy {url} without verifying its signature"),
+        );
+    }
+    let cached = CachedPolicy::new(dir, url);
+    if cached.exists() && cached.is_fresh(config.ttl_minutes) {
+        log(LogLevel::Info, &format!("Using the cached policy {url}"));
+        return cached.read(signer.as_ref());
+    }
+
+    match download(url, &cached, signer.as_ref()) {
+        Ok(Some(policy)) => Ok(policy),
+        Ok(None) => cached.read(signer.as_ref()),
+        Err(e) if cached.exists() => {
+            log(
+                LogLevel::Warn,
+                &format!("Could not fetch the policy {url} ({e}), using the cached copy"),
+            );
+            cached.read(signer.as_ref())
+        }
+        Err(e) => Err(e),
+    }
+}
+
+fn get(url: &str, etag: Option<&str>) -> FeludaResult<reqwest::blocking::Response> {
+    let response = registry::send(Registry::PolicyServer, |client| match etag {
+        Some(etag) => client.get(url).header(IF_NONE_MATCH, etag),
+        None => client.get(url),
+    })
+    .map_err(|e| FeludaError::Unknown(format!("Failed to download {url}: {e}")))?;
+    if response.status() != StatusCode::NOT_MODIFIED && !response.status().is_success() {
+        return Err(FeludaError::Unknown(format!(
+            "Failed to download {url}: {}",
+            response.status()
+        )));
+    }
+    Ok(response)
+}
+
+/// Fetch the policy into the cache, `None` when the cached copy is still current
+fn download(
+    url: &str,
+    cached: &CachedPolicy,
+    signer: Option<&Signer>,
+) -> FeludaResult<Option<toml::Table>> {
+    let dir = cached.document.parent().unwrap_or(Path::new("."));
+    fs::create_dir_all(dir)?;
+
+    let etag = fs::read_to_string(&cached.etag)
+        .ok()
+        .filter(|_| cached.exists());
+    let response = get(url, etag.as_deref().map(str::trim))?;
+    if response.status() == StatusCode::NOT_MODIFIED {
+        log(LogLevel::Info, &format!("The policy {url} hasn't changed"));
+        fs::File::options()
+            .append(true)
+            .open(&cached.document)?
+            .set_modified(SystemTime::now())?;
+        return Ok(None);
+    }
+
+    log(LogLevel::Info, &format!("Downloaded the policy {url}"));
+    let etag = response
+        .headers()
+        .get(ETAG)
+        .and_then(|etag| etag.to_str().ok())
+        .map(String::from);
+    let content = response
+        .text()
+        .map_err(|e| FeludaError::Unknown(format!("Failed to download {url}: {e}")))?;
+    let document = NamedTempFile::new_in(dir)?;
+    fs::write(document.path(), &content)?;
+
+    if let Some(signer) = signer {
+        let bundle_url = format!("{url}.sigstore.json");
+        let bundle = NamedTempFile::new_in(dir)?;
+        let signature = get(&bundle_url, None)?
+            .bytes()
+            .map_err(|e| FeludaError::Unknown(format!("Failed to download {bundle_url}: {e}")))?;
+        fs::write(bundle.path(), signature)?;
+        verify_blob(document.path(), bundle.path(), signer)?;
+        log(LogLevel::Info, "Remote policy signature verified");
+        persist(bundle, &cached.bundle)?;
+    }
+
+    let policy = policy_tables(&content)?;
+    persist(document, &cached.document)?;
+    match etag {
+        Some(etag) => fs::write(&cached.etag, etag)?,
+        None if cached.etag.exists() => fs::remove_file(&cached.etag)?,
+        None => {}
+    }
+    Ok(Some(policy))
+}
+
+/// Remove the cached remote policies, for `feluda cache --clear`
+pub fn clear_policy_cache() -> FeludaResult<()> {
+    let dir = cache_dir_path()?.join(POLICY_CACHE_DIR);
+    if dir.exists() {
+        fs::remove_dir_all(&dir)
+            .inspect_err(|e| log_error("Failed to clear remote policy cache", e))?;
+        log(LogLevel::Info, "Cleared remote policy cache");
+    }
+    Ok(())
+}
+
+fn persist(file: NamedTempFile, path: &Path) -> FeludaResult<()> {
+    file.persist(path)
+        .map(|_| ())
+        .map_err(|e| FeludaError::FileWrite(format!("Failed to write {}: {e}", path.display())))
+}
+
+/// The tables of a remote policy document that are applied
+fn policy_tables(content: &str) -> FeludaResult<toml::Table> {
+    let mut document: toml::Table = toml::from_str(content)
+        .map_err(|e| FeludaError::Config(format!("Failed to parse the remote policy: {e}")))?;
+
+    let mut policy = toml::Table::new();
+    for key in POLICY_TABLES {
+        if let Some(value) = document.remove(key) {
+            policy.insert(key.to_string(), value);
+        }
+    }
+    if let Some(toml::Value::Table(table)) = policy.get_mut("policy") {
+        if table.remove("remote").is_some() {
+            log(
+                LogLevel::Warn,
+                "Ignoring [policy.remote] of the remote policy",
+            );
+        }
+    }
+    if !document.is_empty() {
+        let ignored: Vec<&str> = document.keys().map(String::as_str).collect();
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Ignoring {} of the remote policy, only [policy] and [licenses] apply",
+                ignored.join(", ")
+            ),
+        );
+    }
+    Ok(policy)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_policy_tables() {
+        let policy = policy_tables(
+            r#"
+strict = true
+
+[licenses]
+ignore = ["MIT"]
+
+[policy]
+deny = ["AGPL-3.0"]
+
+[policy.remote]
+url = "https://attacker.example.com/policy.toml"
+
+[plugins.evil]
+command = ["sh", "-c", "true"]
+"#,
+        )
+        .unwrap();
+        assert_eq!(
+            policy.keys().collect::<Vec<_>>(),
+            vec!["licenses", "policy"]
+        );
+        let deny = policy["policy"].get("deny").unwrap();
+        assert_eq!(deny.as_array().unwrap()[0].as_str(), Some("AGPL-3.0"));
+        assert!(policy["policy"].get("remote").is_none());
+
+        assert!(policy_tables("[policy\ndeny = ").is_err());
+    }
+
+    #[test]
+    fn test_signer() {
+        let mut config = RemotePolicyConfig {
+            url: Some("https://compliance.example.com/policy.toml".to_string()),
+            ..RemotePolicyConfig::default()
+        };
+        assert!(signer(&config).is_err());
+
+        config.certificate_identity = Some("^https://github.com/acme/".to_string());
+        config.certificate_oidc_issuer =
+            Some("https://token.actions.githubusercontent.com".to_string());
+        assert!(matches!(
+            signer(&config).unwrap(),
+            Some(Signer::Identity { .. })
+        ));
+
+        config.key = Some("cosign.pub".to_string());
+        assert_eq!(
+            signer(&config).unwrap(),
+            Some(Signer::Key("cosign.pub".to_string()))
+        );
+
+        config.verify = false;
+        assert_eq!(signer(&config).unwrap(), None);
+    }
+
+    #[test]
+    fn test_cached_policy() {
+        let dir = TempDir::new().unwrap();
+        let url = "https://compliance.example.com/policy.toml";
+        let cached = CachedPolicy::new(dir.path(), url);
+        assert_eq!(cached, CachedPolicy::new(dir.path(), url));
+        assert_ne!(
+            cached.document,
+            CachedPolicy::new(dir.path(), "https://other.example.com/policy.toml").document
+        );
+        assert!(!cached.exists());
+        assert!(!cached.is_fresh(60));
+
+        fs::write(&cached.document, "[policy]\nallow = [\"MIT\"]\n").unwrap();
+        assert!(cached.is_fresh(60));
+        assert!(!cached.is_fresh(0));
+
+        // A fresh copy is used without contacting the server
+        let config = RemotePolicyConfig {
+            url: Some(url.to_string()),
+            verify: false,
+            ttl_minutes: 60,
+            ..RemotePolicyConfig::default()
+        };
+        let policy = load_policy(&config, url, dir.path()).unwrap();
+        assert_eq!(
+            policy["policy"]["allow"].as_array().unwrap()[0].as_str(),
+            Some("MIT")
+        );
+    }
+}
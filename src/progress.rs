@@ -1,85 +1,105 @@
+//! Aggregate progress of a multi-project scan
+//!
+//! The projects of a workspace are analyzed concurrently, and their spinners
+//! would overwrite each other. While a [`ProgressTracker`] runs, it draws one
+//! progress bar for the whole scan on stderr and the per-project spinners of
+//! [`with_spinner`](crate::cli::with_spinner) stay quiet.
+//! [`terminal_progress`] connects a tracker to the [`ScanProgress`] events of
+//! a scan.
+
+use colored::*;
+use std::io::{self, IsTerminal, Write};
+use std::sync::atomic::{AtomicBool, AtomicUsize, Ordering};
 use std::sync::{Arc, Mutex};
-use std::sync::atomic::{AtomicUsize, Ordering};
-use std::io::{self, Write};
 use std::thread;
-use std::time::Duration;
-use colored::*;
+use std::time::{Duration, Instant};
+
+use crate::debug::is_debug_mode;
+use crate::scan::{ProgressCallback, ScanProgress};
+use crate::shared_lookups::reused_lookups;
+
+const BAR_WIDTH: usize = 24;
+const SPINNER_FRAMES: [&str; 10] = ["⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"];
 
-/// TODO: Global progress tracker for coordinating multiple concurrent operations.
-/// Will be used when implementing support for analyzing multiple root projects
-/// simultaneously with per-project progress indicators.
-#[allow(dead_code)]
+/// Trackers currently drawing
+static ACTIVE: AtomicUsize = AtomicUsize::new(0);
+
+/// Whether a progress bar is drawn, so other indicators should stay quiet
+pub fn is_active() -> bool {
+    ACTIVE.load(Ordering::Relaxed) > 0
+}
+
+/// Progress bar of the projects analyzed so far
 pub struct ProgressTracker {
-    #[allow(dead_code)]
     total: usize,
     completed: Arc<AtomicUsize>,
-    #[allow(dead_code)]
+    dependencies: Arc<AtomicUsize>,
     current_task: Arc<Mutex<String>>,
-    running: Arc<Mutex<bool>>,
-    handle: Arc<Mutex<Option<thread::JoinHandle<()>>>>,
+    running: Arc<AtomicBool>,
+    handle: Mutex<Option<thread::JoinHandle<()>>>,
 }
 
 impl ProgressTracker {
-    /// TODO: Create a new progress tracker. Will be used when implementing
-    /// multi-project analysis mode with detailed progress tracking per project.
-    #[allow(dead_code)]
     pub fn new(total: usize) -> Self {
         Self {
             total,
             completed: Arc::new(AtomicUsize::new(0)),
+            dependencies: Arc::new(AtomicUsize::new(0)),
             current_task: Arc::new(Mutex::new(String::new())),
-            running: Arc::new(Mutex::new(false)),
-            handle: Arc::new(Mutex::new(None)),
+            running: Arc::new(AtomicBool::new(false)),
+            handle: Mutex::new(None),
         }
     }
 
-    /// TODO: Start the progress indicator thread. Will be used for displaying
-    /// concurrent progress updates when analyzing multiple projects in parallel.
-    #[allow(dead_code)]
+    /// Start drawing the progress bar on stderr
     pub fn start(&self) {
-        let total = self.total;
-
-        *self.running.lock().unwrap() = true;
+        if self.running.swap(true, Ordering::SeqCst) {
+            return;
+        }
+        ACTIVE.fetch_add(1, Ordering::SeqCst);
 
-        let spinner_frames = vec!["⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"];
-        let completed_for_thread = Arc::clone(&self.completed);
-        let current_task_for_thread = Arc::clone(&self.current_task);
-        let running_for_thread = Arc::clone(&self.running);
+        let total = self.total;
+        let completed = Arc::clone(&self.completed);
+        let dependencies = Arc::clone(&self.dependencies);
+        let current_task = Arc::clone(&self.current_task);
+        let running = Arc::clone(&self.running);
+        let started = Instant::now();
+        let reused_before = reused_lookups();
 
         let handle = thread::spawn(move || {
-            let mut frame_idx = 0;
-            while *running_for_thread.lock().unwrap() {
-                frame_idx = (frame_idx + 1) % spinner_frames.len();
-
-                let completed_count = completed_for_thread.load(Ordering::Relaxed);
-                let current = current_task_for_thread.lock().unwrap().clone();
-
-                // Clear line and show progress
-                print!("\x1B[2K\r");
-                let spinner = spinner_frames[frame_idx].cyan();
-                let progress_text = format!("[{}/{}]", completed_count, total);
-
-                print!("{} {} ", spinner, "Analyzing projects".bright_white().bold());
-                print!("{} ", progress_text.bright_cyan());
-
-                if !current.is_empty() {
-                    print!("({})", current.yellow());
-                }
-
-                io::stdout().flush().unwrap();
+            let mut frame = 0;
+            while running.load(Ordering::Relaxed) {
+                let current = current_task.lock().map(|t| t.clone()).unwrap_or_default();
+                let line = render_progress(
+                    SPINNER_FRAMES[frame % SPINNER_FRAMES.len()],
+                    completed.load(Ordering::Relaxed),
+                    total,
+                    dependencies.load(Ordering::Relaxed),
+                    &current,
+                );
+                eprint!("\x1B[2K\r{line}");
+                let _ = io::stderr().flush();
+                frame += 1;
                 thread::sleep(Duration::from_millis(80));
             }
 
-            // Final message
-            print!("\x1B[2K\r");
-            println!(
-                "{} {} {} {}",
+            eprintln!(
+                "\x1B[2K\r{} {} {}",
                 "✓".green().bold(),
-                "Analyzed".bright_white().bold(),
-                format!("{} projects", total).bright_cyan().bold(),
-                "✅"
+                format!(
+                    "Analyzed {}/{total} projects",
+                    completed.load(Ordering::Relaxed)
+                )
+                .bright_white()
+                .bold(),
+                format!(
+                    "({} dependencies, {} lookups shared, {:.1}s)",
+                    dependencies.load(Ordering::Relaxed),
+                    reused_lookups().saturating_sub(reused_before),
+                    started.elapsed().as_secs_f64()
+                )
+                .dimmed()
             );
-            io::stdout().flush().unwrap();
         });
 
         if let Ok(mut h) = self.handle.lock() {
@@ -87,36 +107,36 @@ impl ProgressTracker {
         }
     }
 
-    /// TODO: Update the current task being worked on. Will be used to display
-    /// which specific project or analysis step is currently executing.
-    #[allow(dead_code)]
+    /// Show the project that was worked on last
     pub fn set_current_task(&self, task: impl Into<String>) {
         if let Ok(mut guard) = self.current_task.lock() {
             *guard = task.into();
         }
     }
 
-    /// TODO: Mark a task as completed. Will be called to update progress counters
-    /// as each project analysis completes in multi-project scenarios.
-    #[allow(dead_code)]
     pub fn inc_completed(&self) {
         self.completed.fetch_add(1, Ordering::Relaxed);
     }
 
-    /// Stop the progress indicator
+    pub fn add_dependencies(&self, count: usize) {
+        self.dependencies.fetch_add(count, Ordering::Relaxed);
+    }
+
+    /// Stop the progress indicator, printing a summary line
     pub fn stop(&self) {
-        if let Ok(mut guard) = self.running.lock() {
-            *guard = false;
+        if !self.running.swap(false, Ordering::SeqCst) {
+            return;
         }
         if let Ok(mut h) = self.handle.lock() {
             if let Some(handle) = h.take() {
                 let _ = handle.join();
             }
         }
+        ACTIVE.fetch_sub(1, Ordering::SeqCst);
     }
 
     /// Get the current completion count
-    #[allow(dead_code)]
+    #[cfg(test)]
     pub fn get_completed(&self) -> usize {
         self.completed.load(Ordering::Relaxed)
     }
@@ -128,6 +148,75 @@ impl Drop for ProgressTracker {
     }
 }
 
+/// One frame of the progress bar
+fn render_progress(
+    spinner: &str,
+    completed: usize,
+    total: usize,
+    dependencies: usize,
+    current: &str,
+) -> String {
+    let filled = (completed * BAR_WIDTH).checked_div(total).unwrap_or(0);
+    let bar = format!(
+        "{}{}",
+        "█".repeat(filled),
+        "░".repeat(BAR_WIDTH - filled.min(BAR_WIDTH))
+    );
+    let mut line = format!(
+        "{} {} {} {} {}",
+        spinner.cyan(),
+        "Analyzing projects".bright_white().bold(),
+        bar.cyan(),
+        format!("{completed}/{total}").bright_cyan(),
+        format!("· {dependencies} dependencies").dimmed()
+    );
+    if !current.is_empty() {
+        line.push_str(&format!(" {}", format!("· {current}").yellow()));
+    }
+    line
+}
+
+/// Progress callback drawing a [`ProgressTracker`] when several projects are scanned
+///
+/// Nothing is drawn when stderr is not a terminal or in debug mode.
+pub fn terminal_progress() -> ProgressCallback {
+    let tracker: Mutex<Option<ProgressTracker>> = Mutex::new(None);
+    ProgressCallback::new(move |event| {
+        let Ok(mut tracker) = tracker.lock() else {
+            return;
+        };
+        match event {
+            ScanProgress::Started { projects } => {
+                if *projects > 1 && io::stderr().is_terminal() && !is_debug_mode() {
+                    let started = ProgressTracker::new(*projects);
+                    started.start();
+                    *tracker = Some(started);
+                }
+            }
+            // Counted per project below, with the dependencies found without a lookup
+            ScanProgress::DependencyResolved { .. } => {}
+            ScanProgress::ProjectScanned {
+                manifest,
+                dependencies,
+                completed,
+                total,
+                ..
+            } => {
+                let Some(current) = tracker.as_ref() else {
+                    return;
+                };
+                current.add_dependencies(dependencies.len());
+                current.set_current_task(manifest.unwrap_or_default());
+                current.inc_completed();
+                if completed >= total {
+                    // Dropping the tracker prints the summary
+                    *tracker = None;
+                }
+            }
+        }
+    })
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -154,4 +243,18 @@ mod tests {
         let task = tracker.current_task.lock().unwrap().clone();
         assert_eq!(task, "test task");
     }
+
+    #[test]
+    fn test_render_progress() {
+        colored::control::set_override(false);
+        assert_eq!(
+            render_progress("⠋", 3, 4, 120, "api/package-lock.json"),
+            format!(
+                "⠋ Analyzing projects {}{} 3/4 · 120 dependencies · api/package-lock.json",
+                "█".repeat(18),
+                "░".repeat(6)
+            )
+        );
+        assert!(render_progress("⠋", 0, 0, 0, "").ends_with("0/0 · 0 dependencies"));
+    }
 }
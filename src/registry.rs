@@ -0,0 +1,1104 @@
+//! Shared HTTP access to package registries
+//!
+//! Analyzers fetch metadata in parallel, so requests go through a single client
+//! that spaces out requests per registry and retries transient failures
+//! (timeouts, 429 and 5xx responses) with exponential backoff. A `Retry-After`
+//! header from the registry takes precedence over the computed backoff.
+//!
+//! Public registries can be replaced with private ones under `[registries]` in
+//! `.feluda.toml`. Requests carry the credentials found by
+//! [`crate::credentials`] for their URL, and the client trusts the CA
+//! certificates in `ca_cert` (or `$SSL_CERT_FILE`) in addition to the
+//! built-in roots.
+//!
+//! Requests go through the proxy in `[registries] proxy`, or the one in
+//! `$HTTPS_PROXY`/`$HTTP_PROXY`, with hosts in `$NO_PROXY` reached directly.
+//! The timeout and number of retries come from `--timeout` and `--retries`,
+//! then `[registries]`.
+//!
+//! `[registries.sources]` lists several sources for an ecosystem, e.g. an
+//! Artifactory remote first and the public registry after it. A request that
+//! fails, gets a 429 or 5xx response or isn't found is sent to the next source,
+//! each with its own timeout and retries. A source that failed
+//! [`FAILURE_THRESHOLD`] requests in a row is skipped for [`COOLDOWN`], so one
+//! flaky mirror doesn't stall a scan.
+
+use reqwest::blocking::{Client, ClientBuilder, RequestBuilder, Response};
+use reqwest::{ResponseBuilderExt, StatusCode};
+use std::collections::HashMap;
+use std::fs;
+use std::io::{self, Read, Write};
+use std::sync::mpsc::{self, RecvTimeoutError};
+use std::sync::{Mutex, OnceLock};
+use std::thread;
+use std::time::{Duration, Instant};
+
+use crate::config::{RegistriesConfig, RegistrySource};
+use crate::credentials::{self, Auth};
+use crate::debug::{duration_ms, log, log_enabled, log_error, log_event, LogLevel};
+use crate::lookup_errors::record_failure;
+
+const USER_AGENT: &str = "feluda-license-checker/1.0";
+const REQUEST_TIMEOUT: Duration = Duration::from_secs(30);
+const BASE_BACKOFF: Duration = Duration::from_millis(500);
+const MAX_BACKOFF: Duration = Duration::from_secs(30);
+/// How often a request in flight checks whether the scan was stopped
+const ABORT_CHECK_INTERVAL: Duration = Duration::from_millis(100);
+/// Consecutive failed requests after which a source is skipped
+pub const FAILURE_THRESHOLD: u32 = 3;
+/// How long a failing source is skipped before it is tried again
+pub const COOLDOWN: Duration = Duration::from_secs(60);
+
+const NPM_REGISTRY: &str = "https://registry.npmjs.org";
+const PYPI: &str = "https://pypi.org";
+const MAVEN_CENTRAL: &str = "https://repo1.maven.org/maven2";
+/// Google's Maven repository, which hosts AndroidX and the Android Gradle plugin
+const GOOGLE_MAVEN: &str = "https://dl.google.com/dl/android/maven2";
+const NUGET_FLAT_CONTAINER: &str = "https://api.nuget.org/v3-flatcontainer";
+const CRATES_IO: &str = "https://crates.io";
+const RUBYGEMS: &str = "https://rubygems.org";
+const HEX_API: &str = "https://hex.pm/api";
+const HACKAGE: &str = "https://hackage.haskell.org";
+
+static CLIENT: OnceLock<Client> = OnceLock::new();
+static NEXT_REQUEST: OnceLock<Mutex<HashMap<Registry, Instant>>> = OnceLock::new();
+static REGISTRIES: OnceLock<RegistriesConfig> = OnceLock::new();
+static STATS: OnceLock<Mutex<HashMap<Registry, RegistryStats>>> = OnceLock::new();
+static NETWORK_OVERRIDES: OnceLock<NetworkOptions> = OnceLock::new();
+static SOURCE_HEALTH: OnceLock<Mutex<HashMap<String, SourceHealth>>> = OnceLock::new();
+
+/// Network settings given on the command line, taking precedence over `[registries]`
+#[derive(Debug, Clone, Copy, Default)]
+pub struct NetworkOptions {
+    pub timeout: Option<Duration>,
+    pub retries: Option<u32>,
+}
+
+/// Override the configured timeout and retries, before the first request
+pub fn set_network_options(options: NetworkOptions) {
+    let _ = NETWORK_OVERRIDES.set(options);
+}
+
+/// Package registries Feluda queries for license metadata
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum Registry {
+    Npm,
+    PyPi,
+    CratesIo,
+    PkgGoDev,
+    /// The Go module proxy, for the zips of module versions
+    GoProxy,
+    /// The Go checksum database, for verifying module zips
+    GoSumDb,
+    NuGet,
+    Maven,
+    RUniverse,
+    Vcpkg,
+    Conan,
+    RubyGems,
+    PubDev,
+    Hex,
+    /// The GitHub API and raw files, e.g. licenses of git-sourced gems
+    GitHub,
+    /// The API of GitLab instances, for licenses of repositories hosted there
+    GitLab,
+    /// OSV.dev, queried for known vulnerabilities with `--vulns`
+    Osv,
+    /// OCI container registries, pulled from by `feluda image`
+    Oci,
+    /// registry.terraform.io, for the repositories of providers and modules
+    Terraform,
+    /// The Bazel Central Registry, for the repositories of `bazel_dep` modules
+    Bcr,
+    Hackage,
+    /// The opam repository, for the `opam` files of OCaml packages
+    Opam,
+    /// deps.dev, the last resort of ecosystems configured to fall back to it
+    DepsDev,
+    /// Where `feluda db update` downloads license database snapshots from
+    LicenseDb,
+    /// Slack, Microsoft Teams and other webhooks of `[[notifications]]`
+    Notifications,
+    /// Jira sites of `[tickets]`, for `--sync-tickets`
+    Jira,
+    /// The organization's policy server of `[policy.remote]`
+    PolicyServer,
+}
+
+impl Registry {
+    /// Minimum time between the start of two requests to this registry
+    fn min_interval(self) -> Duration {
+        match self {
+            // crates.io asks crawlers for at most one request per second
+            Registry::CratesIo => Duration::from_secs(1),
+            // pkg.go.dev is quick to answer with 429 under load
+            Registry::PkgGoDev => Duration::from_millis(250),
+            // rubygems.org allows 10 API requests per second
+            Registry::RubyGems => Duration::from_millis(100),
+            // hex.pm allows 100 API requests per minute without an API key
+            Registry::Hex => Duration::from_millis(600),
+            _ => Duration::from_millis(50),
+        }
+    }
+
+    /// Name used in metrics
+    pub fn label(self) -> &'static str {
+        match self {
+            Registry::Npm => "npm",
+            Registry::PyPi => "pypi",
+            Registry::CratesIo => "crates.io",
+            Registry::PkgGoDev => "pkg.go.dev",
+            Registry::GoProxy => "go-proxy",
+            Registry::GoSumDb => "go-sumdb",
+            Registry::NuGet => "nuget",
+            Registry::Maven => "maven",
+            Registry::RUniverse => "r-universe",
+            Registry::Vcpkg => "vcpkg",
+            Registry::Conan => "conan",
+            Registry::RubyGems => "rubygems",
+            Registry::PubDev => "pub.dev",
+            Registry::Hex => "hex",
+            Registry::GitHub => "github",
+            Registry::GitLab => "gitlab",
+            Registry::Osv => "osv",
+            Registry::Oci => "oci",
+            Registry::Terraform => "terraform",
+            Registry::Bcr => "bcr",
+            Registry::Hackage => "hackage",
+            Registry::Opam => "opam",
+            Registry::DepsDev => "deps.dev",
+            Registry::LicenseDb => "license-db",
+            Registry::Notifications => "notifications",
+            Registry::Jira => "jira",
+            Registry::PolicyServer => "policy-server",
+        }
+    }
+
+    fn max_attempts(self) -> u32 {
+        if let Some(retries) = retries() {
+            return retries.saturating_add(1);
+        }
+        match self {
+            Registry::PkgGoDev => 7, // Retry max 7 times. Thala for a reason 🙌
+            _ => 4,
+        }
+    }
+
+    /// Key of the registry's ecosystem in `[registries.sources]`
+    fn sources_key(self) -> Option<&'static str> {
+        match self {
+            Registry::Npm => Some("npm"),
+            Registry::PyPi => Some("pypi"),
+            Registry::Maven => Some("maven"),
+            Registry::NuGet => Some("nuget"),
+            Registry::CratesIo => Some("crates_io"),
+            Registry::RubyGems => Some("rubygems"),
+            Registry::Hex => Some("hex"),
+            Registry::Hackage => Some("hackage"),
+            Registry::GoProxy => Some("go"),
+            _ => None,
+        }
+    }
+}
+
+/// One step of the fallback chain of a registry
+#[derive(Debug, Clone, PartialEq)]
+struct Source {
+    url: String,
+    timeout: Option<Duration>,
+    retries: Option<u32>,
+}
+
+impl Source {
+    fn max_attempts(&self, registry: Registry) -> u32 {
+        let cli_retries = NETWORK_OVERRIDES.get().and_then(|options| options.retries);
+        match cli_retries.or(self.retries) {
+            Some(retries) => retries.saturating_add(1),
+            None => registry.max_attempts(),
+        }
+    }
+
+    /// Timeout of this source, unless `--timeout` was given
+    fn timeout(&self) -> Option<Duration> {
+        match NETWORK_OVERRIDES.get().and_then(|options| options.timeout) {
+            Some(_) => None,
+            None => self.timeout,
+        }
+    }
+}
+
+fn to_sources(configured: &[RegistrySource]) -> Vec<Source> {
+    configured
+        .iter()
+        .filter(|source| !source.is_deps_dev())
+        .map(|source| Source {
+            url: source.url().trim_end_matches('/').to_string(),
+            timeout: source.timeout().map(Duration::from_secs),
+            retries: source.retries(),
+        })
+        .collect()
+}
+
+/// The sources of `[registries.sources]` for the registry, in order
+fn sources(registry: Registry) -> Vec<Source> {
+    registry
+        .sources_key()
+        .and_then(|key| registries().sources.get(key))
+        .map(|configured| to_sources(configured))
+        .unwrap_or_default()
+}
+
+fn primary_source(registry: Registry) -> Option<String> {
+    sources(registry)
+        .into_iter()
+        .next()
+        .map(|source| source.url)
+}
+
+/// Whether `[registries.sources]` ends the list of `ecosystem` with deps.dev
+pub fn falls_back_to_deps_dev(ecosystem: &str) -> bool {
+    registries()
+        .sources
+        .get(ecosystem)
+        .and_then(|sources| sources.last())
+        .is_some_and(RegistrySource::is_deps_dev)
+}
+
+/// Go module proxies of `[registries.sources] go`, as a `GOPROXY` value
+///
+/// The go command downloads modules itself, so it gets the whole list and
+/// moves on to the next proxy after any error.
+pub fn go_proxies() -> Option<String> {
+    let proxies = registries()
+        .sources
+        .get("go")
+        .map(|configured| to_sources(configured))
+        .unwrap_or_default();
+    (!proxies.is_empty()).then(|| {
+        proxies
+            .into_iter()
+            .map(|source| source.url)
+            .collect::<Vec<_>>()
+            .join("|")
+    })
+}
+
+/// The first Go module proxy of `[registries.sources] go`, later ones are
+/// tried by [`get`] when it fails
+pub fn go_proxy_url() -> Option<String> {
+    primary_source(Registry::GoProxy)
+}
+
+fn registries() -> &'static RegistriesConfig {
+    REGISTRIES.get_or_init(|| {
+        crate::config::load_local_config()
+            .map(|config| config.registries)
+            .unwrap_or_default()
+    })
+}
+
+/// Trust the CA certificates of `[registries] ca_cert` or `$SSL_CERT_FILE`
+fn add_ca_certificates(builder: ClientBuilder) -> ClientBuilder {
+    let Some(path) = registries()
+        .ca_cert
+        .clone()
+        .or_else(|| std::env::var("SSL_CERT_FILE").ok())
+    else {
+        return builder;
+    };
+
+    let certificates = fs::read(&path)
+        .map_err(|e| e.to_string())
+        .and_then(|pem| reqwest::Certificate::from_pem_bundle(&pem).map_err(|e| e.to_string()));
+    match certificates {
+        Ok(certificates) => {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "Trusting {} CA certificates from {path}",
+                    certificates.len()
+                ),
+            );
+            certificates
+                .into_iter()
+                .fold(builder, |builder, cert| builder.add_root_certificate(cert))
+        }
+        Err(err) => {
+            log_error(&format!("Failed to load CA certificates from {path}"), &err);
+            builder
+        }
+    }
+}
+
+/// Timeout of a request: `--timeout`, then `[registries] timeout`, then 30 seconds
+pub fn request_timeout() -> Duration {
+    NETWORK_OVERRIDES
+        .get()
+        .and_then(|options| options.timeout)
+        .or_else(|| registries().timeout.map(Duration::from_secs))
+        .unwrap_or(REQUEST_TIMEOUT)
+}
+
+/// Retries of a failed request: `--retries`, then `[registries] retries`
+fn retries() -> Option<u32> {
+    NETWORK_OVERRIDES
+        .get()
+        .and_then(|options| options.retries)
+        .or(registries().retries)
+}
+
+/// The proxy of `[registries] proxy`, honoring `$NO_PROXY`
+///
+/// Without it reqwest picks up the proxy environment variables by itself.
+pub fn configured_proxy() -> Option<reqwest::Proxy> {
+    let url = registries().proxy.as_deref()?;
+    match reqwest::Proxy::all(url) {
+        Ok(proxy) => Some(proxy.no_proxy(reqwest::NoProxy::from_env())),
+        Err(err) => {
+            log_error(&format!("Ignoring invalid proxy {url}"), &err);
+            None
+        }
+    }
+}
+
+/// The proxy URL of `[registries] proxy`, for git
+pub fn proxy_url() -> Option<&'static str> {
+    registries().proxy.as_deref()
+}
+
+fn client() -> &'static Client {
+    CLIENT.get_or_init(|| {
+        let mut builder = add_ca_certificates(Client::builder())
+            .user_agent(USER_AGENT)
+            .timeout(request_timeout());
+        if let Some(proxy) = configured_proxy() {
+            builder = builder.proxy(proxy);
+        }
+        builder.build().unwrap_or_else(|err| {
+            log_error("Failed to create HTTP client", &err);
+            Client::new()
+        })
+    })
+}
+
+/// Registry URL for an npm package: the scope's registry from `.npmrc`, then
+/// `[registries.sources] npm` or `[registries] npm`, then the `.npmrc` default,
+/// then registry.npmjs.org
+pub fn npm_registry(package_name: &str) -> String {
+    credentials::npm_scope_registry(package_name)
+        .or_else(|| primary_source(Registry::Npm))
+        .or_else(|| registries().npm.clone())
+        .or_else(credentials::npm_default_registry)
+        .unwrap_or_else(|| NPM_REGISTRY.to_string())
+        .trim_end_matches('/')
+        .to_string()
+}
+
+/// Base URL of the PyPI JSON API: `[registries.sources] pypi` or
+/// `[registries] pypi`, then the index in
+/// `$PIP_INDEX_URL` without its `/simple` suffix, then pypi.org
+pub fn pypi_url() -> String {
+    primary_source(Registry::PyPi)
+        .or_else(|| registries().pypi.clone())
+        .or_else(|| {
+            std::env::var("PIP_INDEX_URL").ok().map(|index| {
+                let index = index.trim_end_matches('/');
+                index.strip_suffix("/simple").unwrap_or(index).to_string()
+            })
+        })
+        .unwrap_or_else(|| PYPI.to_string())
+        .trim_end_matches('/')
+        .to_string()
+}
+
+/// Maven repositories to fetch POMs from, Maven Central and Google's Maven repository last
+///
+/// With `[registries.sources] maven` only its first source is returned, [`get`]
+/// moves on to the others.
+pub fn maven_repositories() -> Vec<String> {
+    if let Some(primary) = primary_source(Registry::Maven) {
+        return vec![primary];
+    }
+    registries()
+        .maven
+        .iter()
+        .map(|url| url.trim_end_matches('/').to_string())
+        .chain([MAVEN_CENTRAL.to_string(), GOOGLE_MAVEN.to_string()])
+        .collect()
+}
+
+/// NuGet flat container to fetch `.nuspec` files from
+pub fn nuget_flat_container() -> String {
+    base_url(Registry::NuGet, &registries().nuget, NUGET_FLAT_CONTAINER)
+}
+
+/// Base URL of the crates.io API: `[registries] crates_io`, then crates.io
+pub fn crates_io_url() -> String {
+    base_url(Registry::CratesIo, &registries().crates_io, CRATES_IO)
+}
+
+/// Base URL of the RubyGems API: `[registries] rubygems`, then rubygems.org
+pub fn rubygems_url() -> String {
+    base_url(Registry::RubyGems, &registries().rubygems, RUBYGEMS)
+}
+
+/// Base URL of the Hex API: `[registries] hex`, then hex.pm
+pub fn hex_api_url() -> String {
+    base_url(Registry::Hex, &registries().hex, HEX_API)
+}
+
+/// Base URL of Hackage: `[registries] hackage`, then hackage.haskell.org
+pub fn hackage_url() -> String {
+    base_url(Registry::Hackage, &registries().hackage, HACKAGE)
+}
+
+/// The first of `[registries.sources]`, then the single configured mirror, then `default`
+fn base_url(registry: Registry, configured: &Option<String>, default: &str) -> String {
+    primary_source(registry).unwrap_or_else(|| mirror(configured, default))
+}
+
+fn mirror(configured: &Option<String>, default: &str) -> String {
+    configured
+        .as_deref()
+        .unwrap_or(default)
+        .trim_end_matches('/')
+        .to_string()
+}
+
+/// Add the configured credentials for `url`, unless the request brings its own
+fn authenticate(builder: RequestBuilder) -> reqwest::Result<RequestBuilder> {
+    let (client, request) = builder.build_split();
+    let request = request?;
+    let auth = if request
+        .headers()
+        .contains_key(reqwest::header::AUTHORIZATION)
+    {
+        None
+    } else {
+        credentials::authorization(request.url())
+    };
+
+    let builder = RequestBuilder::from_parts(client, request);
+    Ok(match auth {
+        Some(Auth::Basic { username, password }) => builder.basic_auth(username, password),
+        Some(Auth::Bearer(token)) => builder.bearer_auth(token),
+        Some(Auth::EncodedBasic(encoded)) => {
+            builder.header(reqwest::header::AUTHORIZATION, format!("Basic {encoded}"))
+        }
+        None => builder,
+    })
+}
+
+/// Wait until the registry's rate limit allows another request
+fn throttle(registry: Registry) {
+    let slots = NEXT_REQUEST.get_or_init(|| Mutex::new(HashMap::new()));
+    let wait = {
+        let Ok(mut slots) = slots.lock() else {
+            return;
+        };
+        let now = Instant::now();
+        let slot = slots.get(&registry).copied().unwrap_or(now).max(now);
+        slots.insert(registry, slot + registry.min_interval());
+        slot - now
+    };
+
+    if !wait.is_zero() {
+        crate::limits::sleep(wait);
+    }
+}
+
+fn is_retryable(status: StatusCode) -> bool {
+    status == StatusCode::TOO_MANY_REQUESTS || status.is_server_error()
+}
+
+/// Backoff before retry number `attempt` (starting at 1)
+fn backoff(attempt: u32, retry_after: Option<Duration>) -> Duration {
+    retry_after
+        .unwrap_or_else(|| BASE_BACKOFF.saturating_mul(2u32.saturating_pow(attempt - 1)))
+        .min(MAX_BACKOFF)
+}
+
+/// Requests sent to a registry since the process started, every retry included
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+pub struct RegistryStats {
+    pub requests: u64,
+    /// Requests that failed to connect, timed out or got a 429 or 5xx response
+    pub errors: u64,
+    pub duration: Duration,
+}
+
+fn record_request(registry: Registry, duration: Duration, failed: bool) {
+    let stats = STATS.get_or_init(|| Mutex::new(HashMap::new()));
+    if let Ok(mut stats) = stats.lock() {
+        let stats = stats.entry(registry).or_default();
+        stats.requests += 1;
+        stats.errors += u64::from(failed);
+        stats.duration += duration;
+    }
+}
+
+/// Health of a source in `[registries.sources]`
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+pub struct SourceHealth {
+    /// Requests sent to the source, each counted once however many retries it took
+    pub requests: u64,
+    pub failures: u64,
+    /// Failed requests since the last one that succeeded
+    pub consecutive_failures: u32,
+    skipped_until: Option<Instant>,
+}
+
+impl SourceHealth {
+    /// Whether requests are sent to the source, rather than skipping it
+    pub fn is_up(&self) -> bool {
+        self.skipped_until
+            .is_none_or(|until| Instant::now() >= until)
+    }
+}
+
+fn source_health_map() -> &'static Mutex<HashMap<String, SourceHealth>> {
+    SOURCE_HEALTH.get_or_init(|| Mutex::new(HashMap::new()))
+}
+
+fn record_source_result(url: &str, failed: bool) {
+    let Ok(mut health) = source_health_map().lock() else {
+        return;
+    };
+    let health = health.entry(url.to_string()).or_default();
+    health.requests += 1;
+    if !failed {
+        health.consecutive_failures = 0;
+        health.skipped_until = None;
+        return;
+    }
+
+    health.failures += 1;
+    health.consecutive_failures += 1;
+    if health.consecutive_failures >= FAILURE_THRESHOLD && health.is_up() {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Skipping {url} for {}s after {} failed requests in a row",
+                COOLDOWN.as_secs(),
+                health.consecutive_failures
+            ),
+        );
+        health.skipped_until = Some(Instant::now() + COOLDOWN);
+    }
+}
+
+fn is_skipped(url: &str) -> bool {
+    source_health_map()
+        .lock()
+        .ok()
+        .and_then(|health| health.get(url).map(|health| !health.is_up()))
+        .unwrap_or(false)
+}
+
+/// Health of every source of `[registries.sources]` contacted so far, by URL
+pub fn source_health() -> Vec<(String, SourceHealth)> {
+    let mut health: Vec<_> = source_health_map()
+        .lock()
+        .map(|health| health.iter().map(|(k, v)| (k.clone(), *v)).collect())
+        .unwrap_or_default();
+    health.sort_by(|a, b| a.0.cmp(&b.0));
+    health
+}
+
+/// Statistics of every registry contacted so far, for `feluda serve` metrics
+pub fn registry_stats() -> Vec<(Registry, RegistryStats)> {
+    let mut stats: Vec<_> = STATS
+        .get()
+        .and_then(|stats| stats.lock().ok())
+        .map(|stats| stats.iter().map(|(k, v)| (*k, *v)).collect())
+        .unwrap_or_default();
+    stats.sort_by_key(|(registry, _)| registry.label());
+    stats
+}
+
+fn retry_after(response: &Response) -> Option<Duration> {
+    response
+        .headers()
+        .get(reqwest::header::RETRY_AFTER)?
+        .to_str()
+        .ok()?
+        .trim()
+        .parse::<u64>()
+        .ok()
+        .map(Duration::from_secs)
+}
+
+/// Send a request built by `build`, throttled and retried for `registry`
+///
+/// The last response is returned once retries run out, so callers still see
+/// the final status code. Such failures are recorded for the dependency being
+/// looked up, see [`crate::lookup_errors`].
+pub fn send(
+    registry: Registry,
+    build: impl Fn(&Client) -> RequestBuilder,
+) -> reqwest::Result<Response> {
+    send_with(registry, false, build)
+}
+
+/// [`send`] for large downloads, whose body is read by the caller while it
+/// arrives; [`copy_body`] reads it until the scan is stopped
+pub fn send_streamed(
+    registry: Registry,
+    build: impl Fn(&Client) -> RequestBuilder,
+) -> reqwest::Result<Response> {
+    send_with(registry, true, build)
+}
+
+fn send_with(
+    registry: Registry,
+    stream: bool,
+    build: impl Fn(&Client) -> RequestBuilder,
+) -> reqwest::Result<Response> {
+    if let Some(result) = offline_response(registry) {
+        return result;
+    }
+    if let Some(result) = aborted_response(registry) {
+        return result;
+    }
+    let result = send_attempts(registry, registry.max_attempts(), stream, build);
+    record_lookup_failure(&result);
+    result
+}
+
+/// Copy the body of a [`send_streamed`] response to `writer`, giving up when
+/// the scan is stopped
+pub fn copy_body(response: &mut Response, writer: &mut impl Write) -> io::Result<u64> {
+    let mut buffer = vec![0; 64 * 1024];
+    let mut copied = 0;
+    loop {
+        if let Some(reason) = crate::limits::abort_reason() {
+            return Err(io::Error::other(reason));
+        }
+        let read = response.read(&mut buffer)?;
+        if read == 0 {
+            return Ok(copied);
+        }
+        writer.write_all(&buffer[..read])?;
+        copied += read as u64;
+    }
+}
+
+/// The failed response of a request in offline mode
+fn offline_response(registry: Registry) -> Option<reqwest::Result<Response>> {
+    if !crate::offline::is_offline() {
+        return None;
+    }
+    log(
+        LogLevel::Info,
+        &format!("Offline, not contacting {registry:?}"),
+    );
+    // A request with an unsupported scheme fails before any connection is made
+    Some(client().get("offline:").send())
+}
+
+/// The failed response of a request after the scan was stopped, see [`crate::limits`]
+fn aborted_response(registry: Registry) -> Option<reqwest::Result<Response>> {
+    let reason = crate::limits::abort_reason()?;
+    log(
+        LogLevel::Debug,
+        &format!("{reason}, not contacting {registry:?}"),
+    );
+    record_failure(reason);
+    Some(client().get("aborted:").send())
+}
+
+fn record_lookup_failure(result: &reqwest::Result<Response>) {
+    match result {
+        Ok(response) if is_retryable(response.status()) => {
+            record_failure(format!("{} returned {}", response.url(), response.status()))
+        }
+        // Already recorded with the reason the scan was stopped
+        Err(_) if crate::limits::abort_reason().is_some() => {}
+        Err(err) => record_failure(err.to_string()),
+        Ok(_) => {}
+    }
+}
+
+/// Send a request up to `max_attempts` times, backing off between attempts
+fn send_attempts(
+    registry: Registry,
+    max_attempts: u32,
+    stream: bool,
+    build: impl Fn(&Client) -> RequestBuilder,
+) -> reqwest::Result<Response> {
+    let mut attempt = 1;
+
+    loop {
+        throttle(registry);
+        // The scan may have been stopped while waiting
+        if let Some(result) = aborted_response(registry) {
+            return result;
+        }
+        let started = Instant::now();
+        let result = authenticate(build(client()))
+            .and_then(|request| send_interruptible(registry, request, stream));
+        let failed = match &result {
+            Ok(response) => is_retryable(response.status()),
+            Err(_) => true,
+        };
+        record_request(registry, started.elapsed(), failed);
+        if log_enabled(LogLevel::Debug) {
+            log_request(registry, attempt, started, &result);
+        }
+
+        let retry_delay = match &result {
+            Ok(response) if is_retryable(response.status()) => {
+                Some(backoff(attempt, retry_after(response)))
+            }
+            Err(err) if err.is_timeout() || err.is_connect() => Some(backoff(attempt, None)),
+            _ => None,
+        };
+
+        match retry_delay {
+            Some(delay) if attempt < max_attempts => {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "{registry:?} request failed, retrying in {}ms (attempt {attempt}/{max_attempts})",
+                        delay.as_millis()
+                    ),
+                );
+                crate::limits::sleep(delay);
+                attempt += 1;
+            }
+            _ => return result,
+        }
+    }
+}
+
+/// Send `request` on its own thread and wait for it, giving up when the scan
+/// is stopped
+///
+/// Unless `stream` is set the body is read on that thread too, so Ctrl-C also
+/// ends a slow download. An abandoned request runs on until it completes or
+/// times out, and its response is dropped.
+fn send_interruptible(
+    registry: Registry,
+    request: RequestBuilder,
+    stream: bool,
+) -> reqwest::Result<Response> {
+    let (sender, receiver) = mpsc::channel();
+    let request = thread::spawn(move || {
+        let result = request.send();
+        let result = if stream {
+            result
+        } else {
+            result.and_then(buffer_body)
+        };
+        // Nobody waits for it any more once the scan was stopped
+        let _ = sender.send(result);
+    });
+    loop {
+        match receiver.recv_timeout(ABORT_CHECK_INTERVAL) {
+            Ok(result) => return result,
+            Err(RecvTimeoutError::Timeout) => {
+                if let Some(result) = aborted_response(registry) {
+                    return result;
+                }
+            }
+            Err(RecvTimeoutError::Disconnected) => match request.join() {
+                Err(panic) => std::panic::resume_unwind(panic),
+                Ok(()) => unreachable!("the request thread always sends its result"),
+            },
+        }
+    }
+}
+
+/// `response` with its body read into memory
+fn buffer_body(response: Response) -> reqwest::Result<Response> {
+    let status = response.status();
+    let version = response.version();
+    let headers = response.headers().clone();
+    let url = response.url().clone();
+    let body = response.bytes()?;
+
+    let mut buffered = http::Response::builder()
+        .url(url)
+        .body(body)
+        .expect("a response with only a URL is valid");
+    *buffered.status_mut() = status;
+    *buffered.version_mut() = version;
+    *buffered.headers_mut() = headers;
+    Ok(Response::from(buffered))
+}
+
+fn log_request(
+    registry: Registry,
+    attempt: u32,
+    started: Instant,
+    result: &reqwest::Result<Response>,
+) {
+    let mut fields = vec![
+        ("registry", registry.label().into()),
+        ("attempt", attempt.into()),
+        ("duration_ms", duration_ms(started).into()),
+    ];
+    match result {
+        Ok(response) => {
+            fields.push(("url", response.url().as_str().into()));
+            fields.push(("status", response.status().as_u16().into()));
+        }
+        Err(err) => {
+            if let Some(url) = err.url() {
+                fields.push(("url", url.as_str().into()));
+            }
+            fields.push(("error", err.to_string().into()));
+        }
+    }
+    log_event(LogLevel::Debug, "Registry request", &fields);
+}
+
+/// GET `url` from `registry`
+///
+/// When `url` belongs to one of the `[registries.sources]` of the registry,
+/// the sources after it are tried in turn until one has the resource. Sources
+/// that keep failing are skipped, the last one is tried regardless.
+pub fn get(registry: Registry, url: &str) -> reqwest::Result<Response> {
+    let chain = sources(registry);
+    let Some((start, path)) = chain
+        .iter()
+        .enumerate()
+        .find_map(|(index, source)| source_path(url, &source.url).map(|path| (index, path)))
+    else {
+        return send(registry, |client| client.get(url));
+    };
+    if let Some(result) = offline_response(registry).or_else(|| aborted_response(registry)) {
+        return result;
+    }
+
+    let candidates = &chain[start..];
+    let mut healthy: Vec<&Source> = candidates
+        .iter()
+        .filter(|source| !is_skipped(&source.url))
+        .collect();
+    if healthy.is_empty() {
+        healthy.extend(candidates.last());
+    }
+    let Some((last, fallbacks)) = healthy.split_last() else {
+        return send(registry, |client| client.get(url));
+    };
+
+    for source in fallbacks {
+        let result = get_from_source(registry, source, path);
+        if matches!(&result, Ok(response) if response.status().is_success()) {
+            return result;
+        }
+        let outcome = match &result {
+            Ok(response) => response.status().to_string(),
+            Err(err) => err.to_string(),
+        };
+        log(
+            LogLevel::Warn,
+            &format!(
+                "{}{path} failed ({outcome}), falling back to the next source",
+                source.url
+            ),
+        );
+    }
+
+    let result = get_from_source(registry, last, path);
+    record_lookup_failure(&result);
+    result
+}
+
+/// The rest of `url` after the base URL of a source, if it starts with it
+fn source_path<'a>(url: &'a str, base: &str) -> Option<&'a str> {
+    url.strip_prefix(base)
+        .filter(|path| path.is_empty() || path.starts_with(['/', '?']))
+}
+
+fn get_from_source(registry: Registry, source: &Source, path: &str) -> reqwest::Result<Response> {
+    let url = format!("{}{path}", source.url);
+    let result = send_attempts(registry, source.max_attempts(registry), false, |client| {
+        let request = client.get(&url);
+        match source.timeout() {
+            Some(timeout) => request.timeout(timeout),
+            None => request,
+        }
+    });
+    let failed = match &result {
+        Ok(response) => is_retryable(response.status()),
+        Err(_) => true,
+    };
+    record_source_result(&source.url, failed);
+    result
+}
+
+/// POST `body` as JSON to `url` on `registry`
+pub fn post_json<T: serde::Serialize + ?Sized>(
+    registry: Registry,
+    url: &str,
+    body: &T,
+) -> reqwest::Result<Response> {
+    send(registry, |client| client.post(url).json(body))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_record_request() {
+        record_request(Registry::Conan, Duration::from_millis(200), false);
+        record_request(Registry::Conan, Duration::from_millis(300), true);
+        let stats = registry_stats();
+        let (_, conan) = stats
+            .iter()
+            .find(|(registry, _)| *registry == Registry::Conan)
+            .unwrap();
+        assert!(conan.requests >= 2);
+        assert!(conan.errors >= 1);
+        assert!(conan.duration >= Duration::from_millis(500));
+        assert!(stats.windows(2).all(|w| w[0].0.label() <= w[1].0.label()));
+    }
+
+    #[test]
+    fn test_backoff_grows_and_is_capped() {
+        assert_eq!(backoff(1, None), Duration::from_millis(500));
+        assert_eq!(backoff(2, None), Duration::from_secs(1));
+        assert_eq!(backoff(3, None), Duration::from_secs(2));
+        assert_eq!(backoff(20, None), MAX_BACKOFF);
+        assert_eq!(
+            backoff(1, Some(Duration::from_secs(5))),
+            Duration::from_secs(5)
+        );
+        assert_eq!(backoff(1, Some(Duration::from_secs(600))), MAX_BACKOFF);
+    }
+
+    #[test]
+    fn test_mirror() {
+        assert_eq!(mirror(&None, CRATES_IO), "https://crates.io");
+        assert_eq!(
+            mirror(
+                &Some("https://artifactory.example.com/api/cargo/crates-remote/".to_string()),
+                CRATES_IO
+            ),
+            "https://artifactory.example.com/api/cargo/crates-remote"
+        );
+    }
+
+    #[test]
+    fn test_source_path() {
+        let base = "https://artifactory.example.com/api/npm/npm-remote";
+        assert_eq!(
+            source_path(&format!("{base}/left-pad/1.3.0"), base),
+            Some("/left-pad/1.3.0")
+        );
+        assert_eq!(source_path(base, base), Some(""));
+        assert_eq!(
+            source_path(&format!("{base}-internal/left-pad"), base),
+            None
+        );
+        assert_eq!(
+            source_path("https://registry.npmjs.org/left-pad", base),
+            None
+        );
+    }
+
+    #[test]
+    fn test_to_sources() {
+        let sources = to_sources(&[
+            RegistrySource::Detailed {
+                url: "https://nexus.example.com/repository/pypi/".to_string(),
+                timeout: Some(5),
+                retries: Some(0),
+            },
+            RegistrySource::Url("https://pypi.org".to_string()),
+            RegistrySource::Url("deps.dev".to_string()),
+        ]);
+        assert_eq!(
+            sources,
+            vec![
+                Source {
+                    url: "https://nexus.example.com/repository/pypi".to_string(),
+                    timeout: Some(Duration::from_secs(5)),
+                    retries: Some(0),
+                },
+                Source {
+                    url: "https://pypi.org".to_string(),
+                    timeout: None,
+                    retries: None,
+                },
+            ]
+        );
+        assert_eq!(sources[0].max_attempts(Registry::PyPi), 1);
+    }
+
+    #[test]
+    fn test_failing_source_is_skipped_until_it_recovers() {
+        let url = "https://flaky.example.com/npm";
+        for _ in 1..FAILURE_THRESHOLD {
+            record_source_result(url, true);
+            assert!(!is_skipped(url));
+        }
+        record_source_result(url, true);
+        assert!(is_skipped(url));
+
+        let health = source_health();
+        let (_, flaky) = health.iter().find(|(source, _)| source == url).unwrap();
+        assert_eq!(flaky.requests, u64::from(FAILURE_THRESHOLD));
+        assert_eq!(flaky.consecutive_failures, FAILURE_THRESHOLD);
+        assert!(!flaky.is_up());
+
+        // A source tried as the last resort comes back with its first success
+        record_source_result(url, false);
+        assert!(!is_skipped(url));
+        assert_eq!(
+            source_health()
+                .iter()
+                .find(|(source, _)| source == url)
+                .unwrap()
+                .1
+                .failures,
+            u64::from(FAILURE_THRESHOLD)
+        );
+    }
+
+    #[test]
+    fn test_retryable_statuses() {
+        assert!(is_retryable(StatusCode::TOO_MANY_REQUESTS));
+        assert!(is_retryable(StatusCode::SERVICE_UNAVAILABLE));
+        assert!(!is_retryable(StatusCode::NOT_FOUND));
+        assert!(!is_retryable(StatusCode::OK));
+    }
+
+    #[test]
+    fn test_throttle_spaces_requests_per_registry() {
+        // Conan is not queried by any other test
+        let start = Instant::now();
+        throttle(Registry::Conan);
+        throttle(Registry::Conan);
+        throttle(Registry::Conan);
+        assert!(start.elapsed() >= Registry::Conan.min_interval() * 2);
+    }
+
+    #[test]
+    fn test_buffer_body() {
+        let url = reqwest::Url::parse("https://registry.example/pkg").unwrap();
+        let response = http::Response::builder()
+            .status(StatusCode::NOT_FOUND)
+            .header("x-registry", "example")
+            .url(url.clone())
+            .body("missing")
+            .unwrap();
+        let buffered = buffer_body(Response::from(response)).unwrap();
+        assert_eq!(buffered.status(), StatusCode::NOT_FOUND);
+        assert_eq!(buffered.headers()["x-registry"], "example");
+        assert_eq!(buffered.url(), &url);
+        assert_eq!(buffered.text().unwrap(), "missing");
+    }
+
+    #[test]
+    fn test_copy_body() {
+        let response = http::Response::builder().body(vec![7u8; 100_000]).unwrap();
+        let mut copied = Vec::new();
+        let length = copy_body(&mut Response::from(response), &mut copied).unwrap();
+        assert_eq!(length, 100_000);
+        assert_eq!(copied, vec![7u8; 100_000]);
+    }
+}
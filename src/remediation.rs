@@ -0,0 +1,724 @@
+//! Suggested fixes for findings (`feluda remediate`)
+//!
+//! Every dependency that violates the license policy, has a restrictive
+//! license or is incompatible with the project license gets up to three kinds
+//! of suggestion:
+//!
+//! - a replacement from a curated list of permissively-licensed packages,
+//!   `config/alternatives.toml`
+//! - the nearest older and newer release under an acceptable license, for the
+//!   registries that record the license of every version (npm, crates.io and
+//!   RubyGems)
+//! - the `.feluda.toml` entries that accept the dependency after a review
+//!
+//! A license is acceptable when it is permissive, allowed by the policy and
+//! compatible with the project license. With `--interactive` the findings are
+//! shown one at a time and the accepted exceptions are appended to
+//! `.feluda.toml`.
+
+use chrono::{Days, NaiveDate, Utc};
+use colored::*;
+use rayon::prelude::*;
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::fs::OpenOptions;
+use std::io::{self, BufRead, Write};
+use std::path::Path;
+use std::sync::OnceLock;
+
+use crate::config::{is_yaml, load_config, project_config_path, FeludaConfig};
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::health::get_json;
+use crate::licenses::{is_license_compatible_with_overrides, LicenseCompatibility, LicenseInfo};
+use crate::policy::{copyleft_rank, license_alternatives, violation_kind, PolicyViolation};
+use crate::registry::{self, Registry};
+use crate::scan::{scan, ScanOptions};
+use crate::vulns::osv_ecosystem;
+
+const ALTERNATIVES: &str = include_str!("../config/alternatives.toml");
+
+/// Configuration file accepted exceptions are appended to, as read by [`load_config`]
+const CONFIG_FILE: &str = ".feluda.toml";
+
+/// Reason written into suggested exceptions until someone reviews them
+const PLACEHOLDER_REASON: &str = "TODO: why this dependency is acceptable";
+
+/// How long a policy exception recorded by `feluda remediate` lasts
+const EXCEPTION_DAYS: u64 = 365;
+
+/// A curated replacement for a package
+#[derive(Debug, Clone, Deserialize)]
+struct Alternative {
+    /// OSV ecosystem name, see [`osv_ecosystem`]
+    ecosystem: String,
+    package: String,
+    replacement: String,
+    license: String,
+    #[serde(default)]
+    note: String,
+}
+
+#[derive(Debug, Deserialize)]
+struct AlternativeList {
+    #[serde(default)]
+    alternative: Vec<Alternative>,
+}
+
+fn alternatives() -> &'static [Alternative] {
+    static LIST: OnceLock<Vec<Alternative>> = OnceLock::new();
+    LIST.get_or_init(|| match toml::from_str::<AlternativeList>(ALTERNATIVES) {
+        Ok(list) => list.alternative,
+        Err(err) => {
+            log_error("Failed to parse the list of alternative packages", &err);
+            Vec::new()
+        }
+    })
+}
+
+/// A way to resolve a finding
+#[derive(Debug, Clone, PartialEq, Serialize)]
+#[serde(tag = "kind", rename_all = "kebab-case")]
+pub enum Remediation {
+    /// Replace the dependency with another package
+    Replace {
+        package: String,
+        license: String,
+        note: String,
+    },
+    /// Move to another release of the dependency
+    ChangeVersion {
+        version: String,
+        license: String,
+        /// The release is newer than the one in use
+        newer: bool,
+    },
+    /// Accept the dependency with these `.feluda.toml` entries
+    Exception { config: String },
+}
+
+/// A dependency that needs attention, with the ways to resolve it
+#[derive(Debug, Clone, Serialize)]
+pub struct Finding {
+    pub name: String,
+    pub version: String,
+    pub license: Option<String>,
+    /// Why the dependency needs attention
+    pub problems: Vec<String>,
+    pub remediations: Vec<Remediation>,
+    /// The dependency violates the license policy
+    #[serde(skip)]
+    violates_policy: bool,
+    /// The dependency is restrictive or incompatible with the project license
+    #[serde(skip)]
+    conflicts: bool,
+}
+
+/// Whether a license is permissive, allowed by the policy and compatible with the project license
+fn is_acceptable(license: &str, project_license: Option<&str>, config: &FeludaConfig) -> bool {
+    let compatible = |id: &str| {
+        project_license.is_none_or(|project| {
+            is_license_compatible_with_overrides(id, project, config.strict, &config.compatibility)
+                != LicenseCompatibility::Incompatible
+        })
+    };
+    violation_kind(Some(license), &config.policy).is_none()
+        && license_alternatives(license).iter().any(|terms| {
+            terms
+                .iter()
+                .all(|term| copyleft_rank(&term.id) <= 1 && compatible(&term.id))
+        })
+}
+
+/// Numeric components of a release version; pre-releases and other schemes have none
+fn version_parts(version: &str) -> Option<Vec<u64>> {
+    version
+        .trim()
+        .trim_start_matches(['v', '='])
+        .split('.')
+        .map(|part| part.parse().ok())
+        .collect()
+}
+
+/// The closest older and newer releases whose license is acceptable
+fn nearest_versions(
+    current: &str,
+    releases: &[(String, String)],
+    acceptable: impl Fn(&str) -> bool,
+) -> Vec<Remediation> {
+    let Some(current) = version_parts(current) else {
+        return Vec::new();
+    };
+
+    let mut older: Option<(Vec<u64>, &(String, String))> = None;
+    let mut newer: Option<(Vec<u64>, &(String, String))> = None;
+    for release in releases {
+        let Some(parts) = version_parts(&release.0) else {
+            continue;
+        };
+        if parts == current || !acceptable(&release.1) {
+            continue;
+        }
+        let best = if parts < current {
+            &mut older
+        } else {
+            &mut newer
+        };
+        let closer = best.as_ref().is_none_or(|(best, _)| {
+            if parts < current {
+                parts > *best
+            } else {
+                parts < *best
+            }
+        });
+        if closer {
+            *best = Some((parts, release));
+        }
+    }
+
+    [(older, false), (newer, true)]
+        .into_iter()
+        .filter_map(|(release, newer)| {
+            let (_, (version, license)) = release?;
+            Some(Remediation::ChangeVersion {
+                version: version.clone(),
+                license: license.clone(),
+                newer,
+            })
+        })
+        .collect()
+}
+
+/// Releases of a package with their licenses, for registries that record the
+/// license of every version
+fn release_licenses(ecosystem: &str, name: &str) -> Option<Vec<(String, String)>> {
+    match ecosystem {
+        "npm" => {
+            let url = format!("{}/{name}", registry::npm_registry(name));
+            let metadata = get_json(Registry::Npm, &url)?;
+            let releases = metadata
+                .get("versions")?
+                .as_object()?
+                .iter()
+                .filter_map(|(version, release)| {
+                    let license = release.get("license")?;
+                    let license = license.as_str().or_else(|| license.get("type")?.as_str())?;
+                    Some((version.clone(), license.to_string()))
+                })
+                .collect();
+            Some(releases)
+        }
+        "crates.io" => {
+            let url = format!("{}/api/v1/crates/{name}", registry::crates_io_url());
+            let metadata = get_json(Registry::CratesIo, &url)?;
+            let releases = metadata
+                .get("versions")?
+                .as_array()?
+                .iter()
+                .filter(|release| release.get("yanked").and_then(Value::as_bool) != Some(true))
+                .filter_map(|release| {
+                    Some((
+                        release.get("num")?.as_str()?.to_string(),
+                        release.get("license")?.as_str()?.to_string(),
+                    ))
+                })
+                .collect();
+            Some(releases)
+        }
+        "RubyGems" => {
+            let url = format!("{}/api/v1/versions/{name}.json", registry::rubygems_url());
+            let releases = get_json(Registry::RubyGems, &url)?
+                .as_array()?
+                .iter()
+                .filter_map(|release| {
+                    let licenses: Vec<&str> = release
+                        .get("licenses")?
+                        .as_array()?
+                        .iter()
+                        .filter_map(Value::as_str)
+                        .collect();
+                    if licenses.is_empty() {
+                        return None;
+                    }
+                    Some((
+                        release.get("number")?.as_str()?.to_string(),
+                        licenses.join(" OR "),
+                    ))
+                })
+                .collect();
+            Some(releases)
+        }
+        _ => None,
+    }
+}
+
+fn toml_string(value: &str) -> String {
+    toml::Value::String(value.to_string()).to_string()
+}
+
+/// The `.feluda.toml` entries that accept the dependency of a finding
+///
+/// Policy violations get a `[[policy.exceptions]]` entry that expires after a
+/// year, restrictive and incompatible licenses a `[[dependencies.ignore]]` entry.
+fn exception_config(finding: &Finding, reason: &str, today: NaiveDate) -> String {
+    let mut config = String::new();
+    let entry = format!(
+        "name = {}\nversion = {}\nreason = {}\n",
+        toml_string(&finding.name),
+        toml_string(&finding.version),
+        toml_string(reason)
+    );
+    if finding.violates_policy {
+        let expires = today
+            .checked_add_days(Days::new(EXCEPTION_DAYS))
+            .unwrap_or(today)
+            .format("%Y-%m-%d");
+        config.push_str(&format!(
+            "[[policy.exceptions]]\n{entry}expires = \"{expires}\"\n"
+        ));
+    }
+    if finding.conflicts {
+        if !config.is_empty() {
+            config.push('\n');
+        }
+        config.push_str(&format!("[[dependencies.ignore]]\n{entry}"));
+    }
+    config
+}
+
+/// The finding of a dependency, without the suggestions that need a registry
+fn finding(
+    info: &LicenseInfo,
+    violations: &[PolicyViolation],
+    project_license: Option<&str>,
+) -> Option<Finding> {
+    let mut problems: Vec<String> = violations
+        .iter()
+        .filter(|violation| violation.name == info.name && violation.version == info.version)
+        .map(|violation| violation.kind.describe().to_string())
+        .collect();
+    let violates_policy = !problems.is_empty();
+    let conflicts = info.is_restrictive || info.compatibility == LicenseCompatibility::Incompatible;
+    if info.compatibility == LicenseCompatibility::Incompatible {
+        problems.push(format!(
+            "incompatible with {}",
+            project_license.unwrap_or("the project license")
+        ));
+    }
+    if info.is_restrictive {
+        problems.push("restrictive license".to_string());
+    }
+    if problems.is_empty() {
+        return None;
+    }
+
+    Some(Finding {
+        name: info.name.clone(),
+        version: info.version.clone(),
+        license: info.license.clone(),
+        problems,
+        remediations: Vec::new(),
+        violates_policy,
+        conflicts,
+    })
+}
+
+/// Suggest how to resolve every dependency that violates the policy, is
+/// restrictive or is incompatible with the project license
+///
+/// Releases are only looked up online.
+pub fn suggest_remediations(
+    dependencies: &[LicenseInfo],
+    violations: &[PolicyViolation],
+    project_license: Option<&str>,
+    config: &FeludaConfig,
+) -> Vec<Finding> {
+    let today = Utc::now().date_naive();
+    let findings: Vec<_> = dependencies
+        .iter()
+        .filter_map(|info| Some((info, finding(info, violations, project_license)?)))
+        .collect();
+    log(
+        LogLevel::Info,
+        &format!(
+            "Suggesting remediations for {} dependencies",
+            findings.len()
+        ),
+    );
+
+    findings
+        .into_par_iter()
+        .map(|(info, mut finding)| {
+            let acceptable = |license: &str| is_acceptable(license, project_license, config);
+            let ecosystem = info.source_file.as_deref().and_then(osv_ecosystem);
+
+            finding.remediations.extend(
+                alternatives()
+                    .iter()
+                    .filter(|alternative| {
+                        Some(alternative.ecosystem.as_str()) == ecosystem
+                            && alternative.package.eq_ignore_ascii_case(&info.name)
+                            && acceptable(&alternative.license)
+                    })
+                    .map(|alternative| Remediation::Replace {
+                        package: alternative.replacement.clone(),
+                        license: alternative.license.clone(),
+                        note: alternative.note.clone(),
+                    }),
+            );
+            if let Some(releases) = ecosystem
+                .filter(|_| !crate::offline::is_offline())
+                .and_then(|ecosystem| release_licenses(ecosystem, &info.name))
+            {
+                finding
+                    .remediations
+                    .extend(nearest_versions(&info.version, &releases, acceptable));
+            }
+            let config = exception_config(&finding, PLACEHOLDER_REASON, today);
+            finding.remediations.push(Remediation::Exception { config });
+            finding
+        })
+        .collect()
+}
+
+fn render_finding(finding: &Finding) -> String {
+    let mut output = format!(
+        "{} {}@{} ({}): {}\n",
+        "●".red(),
+        finding.name.as_str().bold(),
+        finding.version,
+        finding.license.as_deref().unwrap_or("No License"),
+        finding.problems.join(", ")
+    );
+    for remediation in &finding.remediations {
+        let line = match remediation {
+            Remediation::Replace {
+                package,
+                license,
+                note,
+            } => {
+                let note = if note.is_empty() {
+                    String::new()
+                } else {
+                    format!(": {note}")
+                };
+                format!(
+                    "Replace with {} ({license}){note}",
+                    package.as_str().green()
+                )
+            }
+            Remediation::ChangeVersion {
+                version,
+                license,
+                newer,
+            } => format!(
+                "{} to {} ({license})",
+                if *newer { "Upgrade" } else { "Downgrade" },
+                version.as_str().green()
+            ),
+            Remediation::Exception { config } => {
+                let config: Vec<_> = config
+                    .lines()
+                    .map(|line| {
+                        if line.is_empty() {
+                            String::new()
+                        } else {
+                            format!("      {}", line.dimmed())
+                        }
+                    })
+                    .collect();
+                format!(
+                    "After a review, accept it in {CONFIG_FILE}:\n{}",
+                    config.join("\n")
+                )
+            }
+        };
+        output.push_str(&format!("  → {line}\n"));
+    }
+    output
+}
+
+/// Print the findings with their suggested remediations
+pub fn print_remediations(findings: &[Finding]) {
+    if findings.is_empty() {
+        println!("\n{}\n", "✅ Nothing to remediate".green().bold());
+        return;
+    }
+
+    println!(
+        "\n{} {}\n",
+        "🛠".bold(),
+        format!(
+            "Remediation suggestions for {} dependencies",
+            findings.len()
+        )
+        .yellow()
+        .bold()
+    );
+    for finding in findings {
+        println!("{}", render_finding(finding));
+    }
+}
+
+/// Show the findings one at a time and collect the exceptions accepted on `input`
+///
+/// Returns the `.feluda.toml` entries to append. Reading stops at `q` or the
+/// end of the input.
+fn review(
+    findings: &[Finding],
+    input: &mut impl BufRead,
+    output: &mut impl Write,
+    today: NaiveDate,
+) -> io::Result<Vec<String>> {
+    let mut read_answer = |output: &mut dyn Write, prompt: &str| -> io::Result<Option<String>> {
+        write!(output, "{prompt}")?;
+        output.flush()?;
+        let mut answer = String::new();
+        if input.read_line(&mut answer)? == 0 {
+            return Ok(None);
+        }
+        Ok(Some(answer.trim().to_string()))
+    };
+
+    let mut entries = Vec::new();
+    for (index, finding) in findings.iter().enumerate() {
+        writeln!(
+            output,
+            "\n[{}/{}] {}",
+            index + 1,
+            findings.len(),
+            render_finding(finding)
+        )?;
+        let prompt = format!("Accept {} in {CONFIG_FILE}? [y/N/q] ", finding.name);
+        let Some(answer) = read_answer(output, &prompt)? else {
+            break;
+        };
+        match answer.to_lowercase().as_str() {
+            "y" | "yes" => {
+                let Some(reason) = read_answer(output, "Reason: ")? else {
+                    break;
+                };
+                let reason = if reason.is_empty() {
+                    PLACEHOLDER_REASON
+                } else {
+                    &reason
+                };
+                entries.push(exception_config(finding, reason, today));
+            }
+            "q" | "quit" => break,
+            _ => {}
+        }
+    }
+    Ok(entries)
+}
+
+fn append_exceptions(path: &Path, entries: &[String]) -> FeludaResult<()> {
+    let mut file = OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(path)
+        .map_err(|e| FeludaError::FileWrite(format!("Failed to open {}: {e}", path.display())))?;
+    for entry in entries {
+        write!(file, "\n{entry}").map_err(|e| {
+            FeludaError::FileWrite(format!("Failed to write {}: {e}", path.display()))
+        })?;
+    }
+    Ok(())
+}
+
+/// Scan the project in `path` and suggest remediations for its findings
+pub fn handle_remediate_command(
+    path: &Path,
+    json: bool,
+    interactive: bool,
+    options: &ScanOptions,
+) -> FeludaResult<()> {
+    let report = scan(path, options)?;
+    let config = match &options.config {
+        Some(config) => config.clone(),
+        None => load_config()?,
+    };
+    let findings = suggest_remediations(
+        &report.dependencies,
+        &report.policy_violations,
+        report.project_license.as_deref(),
+        &config,
+    );
+
+    if json {
+        let output = serde_json::to_string_pretty(&findings).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize remediations: {e}"))
+        })?;
+        println!("{output}");
+        return Ok(());
+    }
+    if !interactive || findings.is_empty() {
+        print_remediations(&findings);
+        return Ok(());
+    }
+    if let Some(path) = project_config_path().filter(|path| is_yaml(path)) {
+        return Err(FeludaError::Config(format!(
+            "--interactive records exceptions in {CONFIG_FILE}, which would take precedence over {}",
+            path.display()
+        )));
+    }
+
+    let entries = review(
+        &findings,
+        &mut io::stdin().lock(),
+        &mut io::stdout(),
+        Utc::now().date_naive(),
+    )?;
+    if entries.is_empty() {
+        println!("\nNo exceptions recorded");
+        return Ok(());
+    }
+    append_exceptions(Path::new(CONFIG_FILE), &entries)?;
+    println!(
+        "\n✓ {} exceptions added to {CONFIG_FILE}, rescan to confirm",
+        entries.len()
+    );
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+    use crate::policy::ViolationKind;
+    use std::io::Cursor;
+
+    fn dep(name: &str, license: &str, source_file: Option<&str>) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: true,
+            compatibility: LicenseCompatibility::Incompatible,
+            osi_status: OsiStatus::Approved,
+            source_file: source_file.map(String::from),
+            ..LicenseInfo::test(name, "2.0.0", Some(license))
+        }
+    }
+
+    fn today() -> NaiveDate {
+        NaiveDate::from_ymd_opt(2026, 3, 1).unwrap()
+    }
+
+    #[test]
+    fn test_curated_alternatives() {
+        let config = FeludaConfig::default();
+        assert!(alternatives().len() > 10);
+        for alternative in alternatives() {
+            assert!(
+                is_acceptable(&alternative.license, Some("MIT"), &config),
+                "{} is not permissive",
+                alternative.replacement
+            );
+        }
+    }
+
+    #[test]
+    fn test_is_acceptable() {
+        let config = FeludaConfig::default();
+        assert!(is_acceptable("MIT", Some("MIT"), &config));
+        assert!(is_acceptable("GPL-3.0 OR MIT", Some("MIT"), &config));
+        assert!(!is_acceptable("GPL-3.0", None, &config));
+        assert!(!is_acceptable("LGPL-2.1", Some("MIT"), &config));
+    }
+
+    #[test]
+    fn test_nearest_versions() {
+        let releases: Vec<(String, String)> = [
+            ("1.0.0", "MIT"),
+            ("1.5.0", "MIT"),
+            ("1.9.0", "GPL-3.0"),
+            ("2.0.0", "GPL-3.0"),
+            ("2.1.0-beta.1", "MIT"),
+            ("3.1.0", "Apache-2.0"),
+            ("3.0.0", "Apache-2.0"),
+        ]
+        .iter()
+        .map(|(version, license)| (version.to_string(), license.to_string()))
+        .collect();
+        let acceptable = |license: &str| is_acceptable(license, None, &FeludaConfig::default());
+
+        assert_eq!(
+            nearest_versions("2.0.0", &releases, acceptable),
+            vec![
+                Remediation::ChangeVersion {
+                    version: "1.5.0".to_string(),
+                    license: "MIT".to_string(),
+                    newer: false,
+                },
+                Remediation::ChangeVersion {
+                    version: "3.0.0".to_string(),
+                    license: "Apache-2.0".to_string(),
+                    newer: true,
+                },
+            ]
+        );
+        assert!(nearest_versions("latest", &releases, acceptable).is_empty());
+    }
+
+    #[test]
+    fn test_suggest_remediations() {
+        let violation = PolicyViolation {
+            name: "mysqlclient".to_string(),
+            version: "2.0.0".to_string(),
+            license: Some("GPL-2.0".to_string()),
+            kind: ViolationKind::Denied,
+            introduced_by: None,
+        };
+        let mut fine = dep("requests", "Apache-2.0", None);
+        fine.is_restrictive = false;
+        fine.compatibility = LicenseCompatibility::Compatible;
+        let findings = suggest_remediations(
+            &[
+                dep("mysqlclient", "GPL-2.0", Some("requirements.txt")),
+                fine,
+            ],
+            &[violation],
+            Some("MIT"),
+            &FeludaConfig::default(),
+        );
+
+        assert_eq!(findings.len(), 1);
+        let finding = &findings[0];
+        assert_eq!(
+            finding.problems,
+            vec![
+                "denied by policy".to_string(),
+                "incompatible with MIT".to_string(),
+                "restrictive license".to_string(),
+            ]
+        );
+        assert!(finding.remediations.contains(&Remediation::Replace {
+            package: "PyMySQL".to_string(),
+            license: "MIT".to_string(),
+            note: "Pure-Python MySQL driver with the same DB-API 2.0 interface".to_string(),
+        }));
+
+        let config = exception_config(finding, "Used in an internal tool", today());
+        assert_eq!(
+            config,
+            "[[policy.exceptions]]\nname = \"mysqlclient\"\nversion = \"2.0.0\"\nreason = \"Used in an internal tool\"\nexpires = \"2027-03-01\"\n\n[[dependencies.ignore]]\nname = \"mysqlclient\"\nversion = \"2.0.0\"\nreason = \"Used in an internal tool\"\n"
+        );
+        let parsed: toml::Table = toml::from_str(&config).unwrap();
+        assert!(parsed.contains_key("policy") && parsed.contains_key("dependencies"));
+    }
+
+    #[test]
+    fn test_review() {
+        let findings: Vec<_> = ["a", "b", "c"]
+            .iter()
+            .filter_map(|name| finding(&dep(name, "GPL-3.0", None), &[], Some("MIT")))
+            .collect();
+        let mut input = Cursor::new("y\nReviewed by legal\nn\nq\n");
+        let mut output = Vec::new();
+
+        let entries = review(&findings, &mut input, &mut output, today()).unwrap();
+        assert_eq!(
+            entries,
+            vec!["[[dependencies.ignore]]\nname = \"a\"\nversion = \"2.0.0\"\nreason = \"Reviewed by legal\"\n".to_string()]
+        );
+        let output = String::from_utf8(output).unwrap();
+        assert!(output.contains("[2/3]") && output.contains("Accept c in .feluda.toml?"));
+    }
+}
@@ -0,0 +1,995 @@
+//! Versioned JSON report (`--format json`)
+//!
+//! Unlike `--json`, which serializes [`LicenseInfo`] as it is, this output goes
+//! through its own structs so internal changes cannot leak into it. Within a
+//! schema version fields are never renamed or removed, and every field is always
+//! present, `null` when there is no value. The JSON Schema is published in
+//! `config/report-schema-v2.json`.
+//!
+//! Schema versions:
+//! - 1: the array of dependencies printed by `--json`
+//! - 2: an object with tool, project, summary, dependencies and policy violations
+//!
+//! `--format ndjson` writes the dependency objects of schema version 2 one per
+//! line instead, each as soon as the scan passes it on (see
+//! [`crate::scan::DependencyCallback`]) and flushed right away. Each object is
+//! serialized on its own, so the report is never built as a single string.
+
+use serde::{Deserialize, Serialize};
+use std::fs::File;
+use std::io::{self, Write};
+use std::sync::{Arc, Mutex};
+
+use crate::canonical::{purl, Alias};
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::legal_files::LegalFile;
+use crate::licenses::{
+    DependencyScope, LicenseCompatibility, LicenseInfo, ManualLicense, OsiStatus,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::obligations::Obligations;
+use crate::policy::{PolicyExplanation, PolicyViolation, ViolationKind};
+use crate::reviews::Review;
+use crate::scan::DependencyCallback;
+
+/// Schema version used when `--schema` is not given
+pub const LATEST_SCHEMA_VERSION: u8 = 2;
+
+/// JSON Schema describing schema version 2
+pub const REPORT_SCHEMA_V2: &str = include_str!("../config/report-schema-v2.json");
+
+#[derive(Serialize, Debug)]
+pub struct ReportV2 {
+    pub schema_version: u8,
+    pub tool: ToolV2,
+    pub project: ProjectV2,
+    pub summary: SummaryV2,
+    pub dependencies: Vec<DependencyV2>,
+    pub policy_violations: Vec<PolicyViolationV2>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ToolV2 {
+    pub name: &'static str,
+    pub version: &'static str,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ProjectV2 {
+    pub name: String,
+    pub path: String,
+    pub license: Option<String>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct SummaryV2 {
+    pub total: usize,
+    pub restrictive: usize,
+    pub incompatible: usize,
+    pub unlicensed: usize,
+    pub policy_violations: usize,
+    pub vulnerable: usize,
+}
+
+#[derive(Serialize, Debug)]
+pub struct DependencyV2 {
+    pub name: String,
+    pub version: String,
+    pub purl: String,
+    pub license: Option<String>,
+    pub chosen_license: Option<String>,
+    pub is_restrictive: bool,
+    pub compatibility: &'static str,
+    pub osi_status: &'static str,
+    pub license_confidence: Option<f32>,
+    pub source_file: Option<String>,
+    pub dependency_path: Vec<String>,
+    pub tier: Option<String>,
+    pub scope: &'static str,
+    pub vulnerabilities: Vec<VulnerabilityV2>,
+    pub copyright: Vec<String>,
+    pub legal_files: Vec<LegalFile>,
+    pub manual_license: Option<ManualLicenseV2>,
+    pub health: Option<HealthV2>,
+    pub obligations: Option<ObligationsV2>,
+    pub status: &'static str,
+    pub error: Option<String>,
+    pub explanation: Option<ExplanationV2>,
+    pub repository: Option<String>,
+    pub aliases: Vec<AliasV2>,
+    pub review: Option<ReviewV2>,
+}
+
+#[derive(Serialize, Deserialize, Debug)]
+pub struct AliasV2 {
+    pub name: String,
+    pub version: String,
+    pub source_file: Option<String>,
+    pub purl: Option<String>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ReviewV2 {
+    pub status: &'static str,
+    pub version: String,
+    pub license: Option<String>,
+    pub comment: Option<String>,
+    pub reviewer: Option<String>,
+    pub date: String,
+    pub changed: bool,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ExplanationV2 {
+    pub decision: &'static str,
+    pub linkage: Option<String>,
+    pub expression: Option<String>,
+    pub chosen_by: Option<&'static str>,
+    pub branch: Option<String>,
+    pub matched: Vec<RuleMatchV2>,
+    pub violations: Vec<&'static str>,
+    pub overridden: bool,
+    pub exception: Option<ExceptionV2>,
+    pub baseline: bool,
+    pub reason: String,
+}
+
+#[derive(Serialize, Debug)]
+pub struct RuleMatchV2 {
+    pub list: &'static str,
+    pub entry: String,
+    pub term: String,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ExceptionV2 {
+    pub name: String,
+    pub version: Option<String>,
+    pub expires: Option<String>,
+    pub reason: String,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ObligationsV2 {
+    pub attribution: bool,
+    pub source_disclosure: bool,
+    pub patent_grant: bool,
+    pub same_license: bool,
+}
+
+#[derive(Serialize, Debug)]
+pub struct HealthV2 {
+    pub deprecated: Option<String>,
+    pub yanked: bool,
+    pub yanked_reason: Option<String>,
+    pub archived: bool,
+    pub repository: Option<String>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct ManualLicenseV2 {
+    pub detected: Option<String>,
+    pub reviewed_by: Option<String>,
+    pub date: Option<String>,
+    pub reason: Option<String>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct VulnerabilityV2 {
+    pub id: String,
+    pub aliases: Vec<String>,
+    pub summary: Option<String>,
+    pub severity: Option<String>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct PolicyViolationV2 {
+    pub name: String,
+    pub version: String,
+    pub license: Option<String>,
+    pub kind: &'static str,
+    pub introduced_by: Option<String>,
+}
+
+pub(crate) fn compatibility_name(compatibility: LicenseCompatibility) -> &'static str {
+    match compatibility {
+        LicenseCompatibility::Compatible => "compatible",
+        LicenseCompatibility::Incompatible => "incompatible",
+        LicenseCompatibility::Unknown => "unknown",
+    }
+}
+
+fn osi_status_name(status: OsiStatus) -> &'static str {
+    match status {
+        OsiStatus::Approved => "approved",
+        OsiStatus::NotApproved => "not-approved",
+        OsiStatus::Unknown => "unknown",
+    }
+}
+
+fn scope_name(scope: DependencyScope) -> &'static str {
+    match scope {
+        DependencyScope::Runtime => "runtime",
+        DependencyScope::Build => "build",
+        DependencyScope::Test => "test",
+        DependencyScope::Dev => "dev",
+    }
+}
+
+pub(crate) fn violation_kind_name(kind: &ViolationKind) -> &'static str {
+    match kind {
+        ViolationKind::Denied => "denied",
+        ViolationKind::NotAllowed => "not-allowed",
+        ViolationKind::ChoiceRequired => "choice-required",
+        ViolationKind::Deprecated => "deprecated",
+        ViolationKind::Yanked => "yanked",
+        ViolationKind::Archived => "archived",
+        ViolationKind::MissingLicense => "missing-license",
+        ViolationKind::UnrecognizedLicense => "unrecognized-license",
+        ViolationKind::PatentTerms => "patent-terms",
+        ViolationKind::Eula => "eula",
+        ViolationKind::CommercialLicense => "commercial-license",
+        ViolationKind::ContributorAgreement => "contributor-agreement",
+    }
+}
+
+impl From<&LicenseInfo> for DependencyV2 {
+    fn from(info: &LicenseInfo) -> Self {
+        Self {
+            name: info.name.clone(),
+            version: info.version.clone(),
+            purl: purl(info),
+            license: info.license.clone(),
+            chosen_license: info.chosen_license.clone(),
+            is_restrictive: info.is_restrictive,
+            compatibility: compatibility_name(info.compatibility),
+            osi_status: osi_status_name(info.osi_status),
+            license_confidence: info.license_confidence,
+            source_file: info.source_file.clone(),
+            dependency_path: info.dependency_path.clone().unwrap_or_default(),
+            tier: info.tier.clone(),
+            scope: scope_name(info.scope),
+            vulnerabilities: info
+                .vulnerabilities
+                .iter()
+                .flatten()
+                .map(|v| VulnerabilityV2 {
+                    id: v.id.clone(),
+                    aliases: v.aliases.clone(),
+                    summary: v.summary.clone(),
+                    severity: v.severity.clone(),
+                })
+                .collect(),
+            copyright: info.copyright.clone().unwrap_or_default(),
+            legal_files: info.legal_files.clone().unwrap_or_default(),
+            manual_license: info.manual_license.as_ref().map(|m| ManualLicenseV2 {
+                detected: m.detected.clone(),
+                reviewed_by: m.reviewed_by.clone(),
+                date: m.date.clone(),
+                reason: m.reason.clone(),
+            }),
+            health: info.health.as_ref().map(|h| HealthV2 {
+                deprecated: h.deprecated.clone(),
+                yanked: h.yanked,
+                yanked_reason: h.yanked_reason.clone(),
+                archived: h.archived,
+                repository: h.repository.clone(),
+            }),
+            obligations: info.obligations.map(|o| ObligationsV2 {
+                attribution: o.attribution,
+                source_disclosure: o.source_disclosure,
+                patent_grant: o.patent_grant,
+                same_license: o.same_license,
+            }),
+            status: match info.status {
+                LookupStatus::Ok => "ok",
+                LookupStatus::Error => "error",
+            },
+            error: info.error.clone(),
+            explanation: info.explanation.as_ref().map(ExplanationV2::from),
+            repository: info.repository.clone(),
+            aliases: info
+                .aliases
+                .iter()
+                .flatten()
+                .map(|alias| AliasV2 {
+                    name: alias.name.clone(),
+                    version: alias.version.clone(),
+                    source_file: alias.source_file.clone(),
+                    purl: alias.purl.clone(),
+                })
+                .collect(),
+            review: info.review.as_ref().map(|review| ReviewV2 {
+                status: review.status.as_str(),
+                version: review.version.clone(),
+                license: review.license.clone(),
+                comment: review.comment.clone(),
+                reviewer: review.reviewer.clone(),
+                date: review.date.clone(),
+                changed: review.changed,
+            }),
+        }
+    }
+}
+
+impl From<&PolicyExplanation> for ExplanationV2 {
+    fn from(explanation: &PolicyExplanation) -> Self {
+        Self {
+            decision: explanation.decision.as_str(),
+            linkage: explanation.linkage.map(|linkage| linkage.to_string()),
+            expression: explanation.expression.clone(),
+            chosen_by: explanation.chosen_by.map(|source| source.as_str()),
+            branch: explanation.branch.clone(),
+            matched: explanation
+                .matched
+                .iter()
+                .map(|rule| RuleMatchV2 {
+                    list: rule.list.as_str(),
+                    entry: rule.entry.clone(),
+                    term: rule.term.clone(),
+                })
+                .collect(),
+            violations: explanation
+                .violations
+                .iter()
+                .map(violation_kind_name)
+                .collect(),
+            overridden: explanation.overridden,
+            exception: explanation.exception.as_ref().map(|e| ExceptionV2 {
+                name: e.name.clone(),
+                version: Some(e.version.clone()).filter(|version| !version.is_empty()),
+                expires: e.expires.clone(),
+                reason: e.reason.clone(),
+            }),
+            baseline: explanation.baseline,
+            reason: explanation.reason.clone(),
+        }
+    }
+}
+
+impl From<&PolicyViolation> for PolicyViolationV2 {
+    fn from(violation: &PolicyViolation) -> Self {
+        Self {
+            name: violation.name.clone(),
+            version: violation.version.clone(),
+            license: violation.license.clone(),
+            kind: violation_kind_name(&violation.kind),
+            introduced_by: violation.introduced_by.clone(),
+        }
+    }
+}
+
+/// A schema version 2 report as read back by `feluda diff` and `feluda aggregate`
+#[derive(Deserialize)]
+struct ParsedReportV2 {
+    project: ParsedProjectV2,
+    dependencies: Vec<ParsedDependencyV2>,
+}
+
+#[derive(Deserialize)]
+struct ParsedProjectV2 {
+    name: String,
+}
+
+#[derive(Deserialize)]
+struct ParsedDependencyV2 {
+    name: String,
+    version: String,
+    #[serde(default)]
+    purl: Option<String>,
+    license: Option<String>,
+    chosen_license: Option<String>,
+    is_restrictive: bool,
+    compatibility: String,
+    osi_status: String,
+    license_confidence: Option<f32>,
+    source_file: Option<String>,
+    dependency_path: Vec<String>,
+    tier: Option<String>,
+    scope: DependencyScope,
+    copyright: Vec<String>,
+    #[serde(default)]
+    legal_files: Vec<LegalFile>,
+    manual_license: Option<ManualLicense>,
+    #[serde(default)]
+    obligations: Option<Obligations>,
+    #[serde(default)]
+    status: LookupStatus,
+    #[serde(default)]
+    error: Option<String>,
+    #[serde(default)]
+    repository: Option<String>,
+    #[serde(default)]
+    aliases: Vec<AliasV2>,
+    #[serde(default)]
+    review: Option<Review>,
+}
+
+/// Read the project name and dependencies back from a schema version 2 report
+///
+/// Vulnerabilities and policy explanations are not restored.
+pub fn parse_report_v2(content: &str) -> Result<(String, Vec<LicenseInfo>), String> {
+    let report: ParsedReportV2 = serde_json::from_str(content).map_err(|e| e.to_string())?;
+
+    let dependencies = report
+        .dependencies
+        .into_iter()
+        .map(|dep| LicenseInfo {
+            name: dep.name,
+            version: dep.version,
+            license: dep.license,
+            is_restrictive: dep.is_restrictive,
+            compatibility: [
+                LicenseCompatibility::Compatible,
+                LicenseCompatibility::Incompatible,
+            ]
+            .into_iter()
+            .find(|c| compatibility_name(*c) == dep.compatibility)
+            .unwrap_or(LicenseCompatibility::Unknown),
+            osi_status: [OsiStatus::Approved, OsiStatus::NotApproved]
+                .into_iter()
+                .find(|s| osi_status_name(*s) == dep.osi_status)
+                .unwrap_or(OsiStatus::Unknown),
+            license_confidence: dep.license_confidence,
+            source_file: dep.source_file,
+            dependency_path: Some(dep.dependency_path).filter(|path| !path.is_empty()),
+            tier: dep.tier,
+            vulnerabilities: None,
+            copyright: Some(dep.copyright).filter(|copyright| !copyright.is_empty()),
+            legal_files: Some(dep.legal_files).filter(|files| !files.is_empty()),
+            chosen_license: dep.chosen_license,
+            requires: None,
+            scope: dep.scope,
+            manual_license: dep.manual_license,
+            health: None,
+            obligations: dep.obligations,
+            explanation: None,
+            repository: dep.repository,
+            aliases: Some(
+                dep.aliases
+                    .into_iter()
+                    .map(|alias| Alias {
+                        name: alias.name,
+                        version: alias.version,
+                        source_file: alias.source_file,
+                        purl: alias.purl,
+                    })
+                    .collect::<Vec<_>>(),
+            )
+            .filter(|aliases| !aliases.is_empty()),
+            purl: dep.purl,
+            review: dep.review,
+            status: dep.status,
+            error: dep.error,
+        })
+        .collect();
+    Ok((report.project.name, dependencies))
+}
+
+/// Build the schema version 2 document
+pub fn build_report_v2(
+    project_path: &str,
+    data: &[LicenseInfo],
+    project_license: Option<&str>,
+    policy_violations: &[PolicyViolation],
+) -> ReportV2 {
+    let dependencies: Vec<DependencyV2> = data.iter().map(DependencyV2::from).collect();
+
+    ReportV2 {
+        schema_version: 2,
+        tool: ToolV2 {
+            name: env!("CARGO_PKG_NAME"),
+            version: env!("CARGO_PKG_VERSION"),
+        },
+        project: ProjectV2 {
+            name: crate::sbom::project_name_from_path(project_path).to_string(),
+            path: project_path.to_string(),
+            license: project_license.map(String::from),
+        },
+        summary: SummaryV2 {
+            total: dependencies.len(),
+            restrictive: dependencies.iter().filter(|d| d.is_restrictive).count(),
+            incompatible: dependencies
+                .iter()
+                .filter(|d| d.compatibility == "incompatible")
+                .count(),
+            unlicensed: dependencies.iter().filter(|d| d.license.is_none()).count(),
+            policy_violations: policy_violations.len(),
+            vulnerable: dependencies
+                .iter()
+                .filter(|d| !d.vulnerabilities.is_empty())
+                .count(),
+        },
+        dependencies,
+        policy_violations: policy_violations
+            .iter()
+            .map(PolicyViolationV2::from)
+            .collect(),
+    }
+}
+
+/// Serialize the report in the requested schema version
+pub fn render_json_report(
+    schema_version: u8,
+    project_path: &str,
+    data: &[LicenseInfo],
+    project_license: Option<&str>,
+    policy_violations: &[PolicyViolation],
+) -> FeludaResult<String> {
+    let result = match schema_version {
+        1 => serde_json::to_string_pretty(data),
+        2 => serde_json::to_string_pretty(&build_report_v2(
+            project_path,
+            data,
+            project_license,
+            policy_violations,
+        )),
+        other => {
+            return Err(FeludaError::Config(format!(
+                "Unsupported JSON schema version {other}, expected 1 to {LATEST_SCHEMA_VERSION}"
+            )))
+        }
+    };
+    result.map_err(|e| FeludaError::Serialization(format!("Failed to serialize JSON report: {e}")))
+}
+
+/// Write the JSON report to `output_file`, or print it to stdout
+pub fn write_json_report(
+    schema_version: u8,
+    project_path: &str,
+    data: &[LicenseInfo],
+    project_license: Option<&str>,
+    policy_violations: &[PolicyViolation],
+    output_file: Option<&str>,
+) -> FeludaResult<()> {
+    let content = render_json_report(
+        schema_version,
+        project_path,
+        data,
+        project_license,
+        policy_violations,
+    )?;
+
+    match output_file {
+        Some(file_path) => {
+            std::fs::write(file_path, &content)
+                .map_err(|e| FeludaError::FileWrite(format!("Failed to write JSON report: {e}")))?;
+            log(
+                LogLevel::Info,
+                &format!("JSON report (schema {schema_version}) written to: {file_path}"),
+            );
+        }
+        None => println!("{content}"),
+    }
+
+    Ok(())
+}
+
+/// Write one schema version 2 dependency object per line
+pub fn write_ndjson<W: Write>(mut writer: W, data: &[LicenseInfo]) -> io::Result<()> {
+    for info in data {
+        write_ndjson_line(&mut writer, info)?;
+    }
+    Ok(())
+}
+
+/// Write the line of one dependency and flush it, so readers see it right away
+fn write_ndjson_line<W: Write>(writer: &mut W, info: &LicenseInfo) -> io::Result<()> {
+    let mut line = serde_json::to_vec(&DependencyV2::from(info))?;
+    line.push(b'\n');
+    writer.write_all(&line)?;
+    writer.flush()
+}
+
+/// NDJSON report written one dependency at a time while the scan runs
+///
+/// Pass [`NdjsonWriter::callback`] as [`crate::ScanOptions::on_dependency`].
+/// The first write error stops the report and is returned by
+/// [`NdjsonWriter::finish`].
+pub struct NdjsonWriter {
+    output: Mutex<NdjsonOutput>,
+    output_file: Option<String>,
+}
+
+struct NdjsonOutput {
+    writer: Box<dyn Write + Send>,
+    written: usize,
+    error: Option<io::Error>,
+}
+
+impl NdjsonWriter {
+    pub fn new(writer: impl Write + Send + 'static) -> Self {
+        Self {
+            output: Mutex::new(NdjsonOutput {
+                writer: Box::new(writer),
+                written: 0,
+                error: None,
+            }),
+            output_file: None,
+        }
+    }
+
+    /// Write the report to `output_file`, or to stdout
+    pub fn create(output_file: Option<&str>) -> FeludaResult<Self> {
+        let Some(file_path) = output_file else {
+            return Ok(Self::new(io::stdout()));
+        };
+        let file = File::create(file_path)
+            .map_err(|e| FeludaError::FileWrite(format!("Failed to write NDJSON report: {e}")))?;
+        Ok(Self {
+            output_file: Some(file_path.to_string()),
+            ..Self::new(file)
+        })
+    }
+
+    /// Write the line of `info`
+    pub fn write(&self, info: &LicenseInfo) {
+        let Ok(mut output) = self.output.lock() else {
+            return;
+        };
+        if output.error.is_some() {
+            return;
+        }
+        match write_ndjson_line(&mut output.writer, info) {
+            Ok(()) => output.written += 1,
+            Err(err) => output.error = Some(err),
+        }
+    }
+
+    /// Callback for [`crate::ScanOptions::on_dependency`] writing each dependency
+    pub fn callback(self: &Arc<Self>) -> DependencyCallback {
+        let writer = Arc::clone(self);
+        DependencyCallback::new(move |info| writer.write(info))
+    }
+
+    /// Report the first write error, if any, once the scan is complete
+    pub fn finish(&self) -> FeludaResult<()> {
+        let mut output = self
+            .output
+            .lock()
+            .map_err(|_| FeludaError::FileWrite("Failed to write NDJSON report".to_string()))?;
+        if let Some(err) = output.error.take() {
+            return Err(FeludaError::FileWrite(format!(
+                "Failed to write NDJSON report: {err}"
+            )));
+        }
+        if let Some(file_path) = &self.output_file {
+            log(
+                LogLevel::Info,
+                &format!(
+                    "NDJSON report of {} dependencies written to: {file_path}",
+                    output.written
+                ),
+            );
+        }
+        Ok(())
+    }
+}
+
+/// Write the NDJSON report to `output_file`, or to stdout
+pub fn write_ndjson_report(data: &[LicenseInfo], output_file: Option<&str>) -> FeludaResult<()> {
+    let result = match output_file {
+        Some(file_path) => File::create(file_path).and_then(|file| write_ndjson(file, data)),
+        None => write_ndjson(io::stdout().lock(), data),
+    };
+    result.map_err(|e| FeludaError::FileWrite(format!("Failed to write NDJSON report: {e}")))?;
+    if let Some(file_path) = output_file {
+        log(
+            LogLevel::Info,
+            &format!(
+                "NDJSON report of {} dependencies written to: {file_path}",
+                data.len()
+            ),
+        );
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::Value;
+
+    /// Check `value` against the parts of JSON Schema the published schema uses
+    fn check(schema: &Value, defs: &Value, value: &Value, path: &str) {
+        if let Some(reference) = schema.get("$ref").and_then(Value::as_str) {
+            let name = reference.trim_start_matches("#/$defs/");
+            return check(&defs[name], defs, value, path);
+        }
+        if let Some(variants) = schema.get("oneOf").and_then(Value::as_array) {
+            // Only nullable objects use `oneOf`
+            if value.is_null() {
+                return;
+            }
+            let variant = variants.iter().find(|v| v["type"] != "null").unwrap();
+            return check(variant, defs, value, path);
+        }
+        if let Some(constant) = schema.get("const") {
+            assert_eq!(value, constant, "{path}");
+        }
+        if let Some(allowed) = schema.get("enum").and_then(Value::as_array) {
+            assert!(
+                allowed.contains(value),
+                "{path}: {value} not in {allowed:?}"
+            );
+        }
+        if let Some(required) = schema.get("required").and_then(Value::as_array) {
+            let object = value
+                .as_object()
+                .unwrap_or_else(|| panic!("{path}: not an object"));
+            for key in required {
+                assert!(
+                    object.contains_key(key.as_str().unwrap()),
+                    "{path}: missing {key}"
+                );
+            }
+        }
+        if let Some(properties) = schema.get("properties").and_then(Value::as_object) {
+            for (key, field) in value.as_object().unwrap() {
+                let field_schema = properties
+                    .get(key)
+                    .unwrap_or_else(|| panic!("{path}: undocumented field {key}"));
+                check(field_schema, defs, field, &format!("{path}.{key}"));
+            }
+        }
+        if let Some(items) = schema.get("items") {
+            for (index, item) in value.as_array().unwrap().iter().enumerate() {
+                check(items, defs, item, &format!("{path}[{index}]"));
+            }
+        }
+    }
+
+    #[test]
+    fn test_report_v2_matches_published_schema() {
+        let mut gpl = LicenseInfo::test("copyleft", "1.0.0", Some("GPL-3.0"));
+        gpl.is_restrictive = true;
+        gpl.compatibility = LicenseCompatibility::Incompatible;
+        gpl.dependency_path = Some(vec!["app".to_string(), "copyleft".to_string()]);
+        gpl.vulnerabilities = Some(vec![crate::vulns::Vulnerability {
+            id: "GHSA-1234".to_string(),
+            aliases: vec!["CVE-2024-1".to_string()],
+            summary: None,
+            severity: Some("HIGH".to_string()),
+        }]);
+        let violation = PolicyViolation {
+            name: "copyleft".to_string(),
+            version: "1.0.0".to_string(),
+            license: Some("GPL-3.0".to_string()),
+            kind: ViolationKind::Denied,
+            introduced_by: Some("app".to_string()),
+        };
+        let mut reviewed = LicenseInfo::test("left-pad", "1.0.0", Some("WTFPL"));
+        reviewed.manual_license = Some(crate::licenses::ManualLicense {
+            detected: None,
+            reviewed_by: Some("jane.doe@example.com".to_string()),
+            date: Some("2025-03-14".to_string()),
+            reason: None,
+        });
+        reviewed.review = Some(Review {
+            status: crate::reviews::ReviewStatus::Approved,
+            version: "1.0.0".to_string(),
+            license: Some("WTFPL".to_string()),
+            comment: None,
+            reviewer: Some("jane.doe@example.com".to_string()),
+            date: "2026-05-01".to_string(),
+            changed: false,
+        });
+        let mut serde = LicenseInfo::test("serde", "1.0.0", Some("MIT"));
+        serde.repository = Some("https://github.com/serde-rs/serde".to_string());
+        serde.aliases = Some(vec![Alias {
+            name: "github.com/serde-rs/serde".to_string(),
+            version: "v1.0.0".to_string(),
+            source_file: Some("go.mod".to_string()),
+            purl: Some("pkg:golang/github.com/serde-rs/serde@v1.0.0".to_string()),
+        }]);
+        let mut data = vec![
+            serde,
+            LicenseInfo::test("mystery", "1.0.0", None),
+            gpl,
+            reviewed,
+        ];
+        let policy = crate::config::PolicyConfig {
+            deny: vec!["GPL-3.0".to_string(), "WTFPL".to_string()],
+            exceptions: vec![crate::config::PolicyException {
+                name: "left-pad".to_string(),
+                version: String::new(),
+                expires: None,
+                reason: "Reviewed".to_string(),
+            }],
+            ..Default::default()
+        };
+        let explanations = crate::policy::explain_policy(
+            &data,
+            &policy,
+            &Default::default(),
+            chrono::NaiveDate::from_ymd_opt(2025, 1, 1).unwrap(),
+        );
+        for (info, explanation) in data.iter_mut().zip(explanations) {
+            info.explanation = Some(explanation);
+        }
+        data[0].explanation = None;
+
+        let json = render_json_report(2, "./demo", &data, Some("MIT"), &[violation]).unwrap();
+        let report: Value = serde_json::from_str(&json).unwrap();
+        let schema: Value = serde_json::from_str(REPORT_SCHEMA_V2).unwrap();
+        check(&schema, &schema["$defs"], &report, "$");
+
+        assert_eq!(report["schema_version"], 2);
+        assert_eq!(report["project"]["name"], "demo");
+        assert_eq!(report["summary"]["restrictive"], 1);
+        assert_eq!(report["summary"]["unlicensed"], 1);
+        assert_eq!(report["summary"]["vulnerable"], 1);
+        assert_eq!(report["dependencies"][1]["license"], Value::Null);
+        assert_eq!(report["dependencies"][2]["compatibility"], "incompatible");
+        assert_eq!(report["dependencies"][0]["manual_license"], Value::Null);
+        assert_eq!(
+            report["dependencies"][3]["manual_license"]["reviewed_by"],
+            "jane.doe@example.com"
+        );
+        assert_eq!(report["policy_violations"][0]["kind"], "denied");
+        assert_eq!(report["dependencies"][0]["explanation"], Value::Null);
+        let explanation = &report["dependencies"][2]["explanation"];
+        assert_eq!(explanation["decision"], "fail");
+        assert_eq!(explanation["matched"][0]["list"], "deny");
+        assert_eq!(explanation["violations"][0], "denied");
+        let explanation = &report["dependencies"][3]["explanation"];
+        assert_eq!(explanation["decision"], "waived");
+        assert_eq!(explanation["overridden"], true);
+        assert_eq!(explanation["exception"]["version"], Value::Null);
+        assert_eq!(
+            report["dependencies"][0]["aliases"][0]["source_file"],
+            "go.mod"
+        );
+        assert_eq!(report["dependencies"][1]["aliases"], Value::Array(vec![]));
+        assert_eq!(report["dependencies"][1]["repository"], Value::Null);
+        assert_eq!(report["dependencies"][1]["review"], Value::Null);
+        assert_eq!(report["dependencies"][3]["review"]["status"], "approved");
+        assert_eq!(report["dependencies"][3]["review"]["comment"], Value::Null);
+        assert_eq!(
+            report["dependencies"][1]["purl"],
+            "pkg:generic/mystery@1.0.0"
+        );
+    }
+
+    #[test]
+    fn test_schema_versions() {
+        let data = vec![LicenseInfo::test("serde", "1.0.0", Some("MIT"))];
+
+        let v1: Value =
+            serde_json::from_str(&render_json_report(1, "./", &data, None, &[]).unwrap()).unwrap();
+        assert!(v1.is_array());
+        assert_eq!(v1[0]["name"], "serde");
+
+        assert!(render_json_report(3, "./", &data, None, &[]).is_err());
+    }
+
+    #[test]
+    fn test_write_ndjson() {
+        let data = vec![
+            LicenseInfo::test("serde", "1.0.0", Some("MIT")),
+            LicenseInfo::test("mystery", "1.0.0", None),
+        ];
+        let mut output = Vec::new();
+        write_ndjson(&mut output, &data).unwrap();
+
+        let output = String::from_utf8(output).unwrap();
+        let lines: Vec<Value> = output
+            .lines()
+            .map(|line| serde_json::from_str(line).unwrap())
+            .collect();
+        assert_eq!(lines.len(), 2);
+        assert_eq!(lines[0]["name"], "serde");
+        assert_eq!(lines[1]["license"], Value::Null);
+
+        let schema: Value = serde_json::from_str(REPORT_SCHEMA_V2).unwrap();
+        for line in &lines {
+            check(&schema["$defs"]["dependency"], &schema["$defs"], line, "$");
+        }
+    }
+
+    /// Output that only shows what was flushed
+    struct Flushed {
+        pending: Vec<u8>,
+        flushed: Arc<Mutex<Vec<u8>>>,
+    }
+
+    impl Write for Flushed {
+        fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+            self.pending.extend_from_slice(buf);
+            Ok(buf.len())
+        }
+
+        fn flush(&mut self) -> io::Result<()> {
+            self.flushed.lock().unwrap().append(&mut self.pending);
+            Ok(())
+        }
+    }
+
+    #[test]
+    fn test_ndjson_writer() {
+        let flushed = Arc::new(Mutex::new(Vec::new()));
+        let writer = Arc::new(NdjsonWriter::new(Flushed {
+            pending: Vec::new(),
+            flushed: Arc::clone(&flushed),
+        }));
+        let callback = writer.callback();
+
+        // Every line is flushed as soon as it is written
+        callback.report(&LicenseInfo::test("serde", "1.0.0", Some("MIT")));
+        let output = String::from_utf8(flushed.lock().unwrap().clone()).unwrap();
+        assert_eq!(output.lines().count(), 1);
+        assert!(output.ends_with('\n'));
+
+        callback.report(&LicenseInfo::test("mystery", "1.0.0", None));
+        writer.finish().unwrap();
+        let output = String::from_utf8(flushed.lock().unwrap().clone()).unwrap();
+        let lines: Vec<Value> = output
+            .lines()
+            .map(|line| serde_json::from_str(line).unwrap())
+            .collect();
+        assert_eq!(lines[0]["name"], "serde");
+        assert_eq!(lines[1]["name"], "mystery");
+    }
+
+    #[test]
+    fn test_ndjson_writer_error() {
+        struct Broken;
+        impl Write for Broken {
+            fn write(&mut self, _: &[u8]) -> io::Result<usize> {
+                Err(io::Error::new(io::ErrorKind::BrokenPipe, "closed"))
+            }
+
+            fn flush(&mut self) -> io::Result<()> {
+                Ok(())
+            }
+        }
+
+        let writer = NdjsonWriter::new(Broken);
+        writer.write(&LicenseInfo::test("serde", "1.0.0", Some("MIT")));
+        let err = writer.finish().unwrap_err();
+        assert!(err.to_string().contains("closed"));
+    }
+
+    #[test]
+    fn test_parse_report_v2_round_trip() {
+        let mut gpl = LicenseInfo::test("gpl-lib", "1.0.0", Some("GPL-3.0"));
+        gpl.is_restrictive = true;
+        gpl.compatibility = LicenseCompatibility::Incompatible;
+        gpl.dependency_path = Some(vec!["app@1.0.0".to_string(), "gpl-lib@1.0.0".to_string()]);
+        gpl.scope = DependencyScope::Dev;
+        gpl.aliases = Some(vec![Alias {
+            name: "gpl-lib-vendored".to_string(),
+            version: "1.0.0".to_string(),
+            source_file: None,
+            purl: None,
+        }]);
+        gpl.review = Some(Review {
+            status: crate::reviews::ReviewStatus::NeedsLegal,
+            version: "0.9.0".to_string(),
+            license: Some("GPL-3.0".to_string()),
+            comment: Some("Only linked by the CLI".to_string()),
+            reviewer: None,
+            date: "2026-05-01".to_string(),
+            changed: true,
+        });
+        let data = vec![LicenseInfo::test("serde", "1.0.0", Some("MIT")), gpl];
+
+        let content = render_json_report(2, "/src/web-app", &data, Some("MIT"), &[]).unwrap();
+        let (project, parsed) = parse_report_v2(&content).unwrap();
+        assert_eq!(project, "web-app");
+        assert_eq!(parsed.len(), 2);
+        assert_eq!(parsed[0].osi_status, data[0].osi_status);
+        assert_eq!(parsed[0].dependency_path, None);
+        assert_eq!(parsed[1].compatibility, LicenseCompatibility::Incompatible);
+        assert_eq!(parsed[1].dependency_path, data[1].dependency_path);
+        assert_eq!(parsed[1].scope, DependencyScope::Dev);
+        assert!(parsed[1].is_restrictive);
+        assert_eq!(parsed[0].aliases, None);
+        assert_eq!(parsed[1].aliases, data[1].aliases);
+        assert_eq!(parsed[0].review, None);
+        assert_eq!(parsed[1].review, data[1].review);
+        assert_eq!(parsed[0].purl.as_deref(), Some("pkg:generic/serde@1.0.0"));
+
+        assert!(parse_report_v2("[]").is_err());
+    }
+}
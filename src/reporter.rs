@@ -1,9 +1,13 @@
-use crate::cli::{CiFormat, OsiFilter};
-use crate::debug::{log, log_debug, log_error, LogLevel};
+use crate::cli::{CiFormat, OsiFilter, OutputFormat};
+use crate::debug::{log, log_debug, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::i18n::{tr, tr_with};
 use crate::licenses::{LicenseCompatibility, LicenseInfo, OsiStatus};
+use crate::policy::PolicyViolation;
+use crate::scan::ProjectSummary;
 use colored::*;
 use std::collections::HashMap;
 use std::fs;
+use unicode_width::UnicodeWidthStr;
 
 // ReportConfig struct
 #[derive(Debug)]
@@ -49,34 +53,40 @@ impl ReportConfig {
     }
 }
 
-struct TableFormatter {
+/// `text` padded with spaces to `width` terminal columns, counting wide characters twice
+fn pad(text: &str, width: usize) -> String {
+    format!("{text}{}", " ".repeat(width.saturating_sub(text.width())))
+}
+
+/// Box-drawn table shared by the text reports
+pub struct TableFormatter {
     column_widths: Vec<usize>,
     headers: Vec<String>,
 }
 
 impl TableFormatter {
-    fn new(headers: Vec<String>) -> Self {
-        let column_widths = headers.iter().map(|h| h.len()).collect();
+    pub fn new(headers: Vec<String>) -> Self {
+        let column_widths = headers.iter().map(|h| h.width()).collect();
         Self {
             column_widths,
             headers,
         }
     }
 
-    fn add_row(&mut self, row: &[String]) {
+    pub fn add_row(&mut self, row: &[String]) {
         for (i, item) in row.iter().enumerate() {
             if i < self.column_widths.len() {
-                self.column_widths[i] = self.column_widths[i].max(item.len());
+                self.column_widths[i] = self.column_widths[i].max(item.width());
             }
         }
     }
 
-    fn render_header(&self) -> String {
+    pub fn render_header(&self) -> String {
         let header_row = self
             .headers
             .iter()
             .enumerate()
-            .map(|(i, header)| format!("{:width$}", header, width = self.column_widths[i]))
+            .map(|(i, header)| pad(header, self.column_widths[i]))
             .collect::<Vec<_>>()
             .join(" │ ");
 
@@ -91,13 +101,13 @@ impl TableFormatter {
         )
     }
 
-    fn render_row(&self, row: &[String], is_problematic: bool) -> String {
+    pub fn render_row(&self, row: &[String], is_problematic: bool) -> String {
         let formatted_row = row
             .iter()
             .enumerate()
             .map(|(i, item)| {
                 if i < self.column_widths.len() {
-                    format!("{:width$}", item, width = self.column_widths[i])
+                    pad(item, self.column_widths[i])
                 } else {
                     item.clone()
                 }
@@ -112,7 +122,7 @@ impl TableFormatter {
         }
     }
 
-    fn render_footer(&self) -> String {
+    pub fn render_footer(&self) -> String {
         let footer_width =
             self.column_widths.iter().sum::<usize>() + (3 * self.column_widths.len()) - 1;
         format!("└{}┘", "─".repeat(footer_width))
@@ -215,7 +225,13 @@ pub fn generate_report(data: Vec<LicenseInfo>, config: ReportConfig) -> (bool, b
     );
     log_debug("Filtered license data", &filtered_data);
 
-    if filtered_data.is_empty() {
+    // Code scanning and merge request reports are expected even when there is nothing to report
+    if filtered_data.is_empty()
+        && !matches!(
+            config.ci_format,
+            Some(CiFormat::Sarif | CiFormat::Gitlab | CiFormat::Bitbucket)
+        )
+    {
         println!(
             "\n{}\n",
             "🎉 All dependencies passed the license check! No restrictive or incompatible licenses found."
@@ -237,6 +253,17 @@ pub fn generate_report(data: Vec<LicenseInfo>, config: ReportConfig) -> (bool, b
                 config.output_file.as_deref(),
                 config.project_license.as_deref(),
             ),
+            CiFormat::Sarif => output_sarif_format(
+                &filtered_data,
+                config.output_file.as_deref(),
+                config.project_license.as_deref(),
+            ),
+            CiFormat::Gitlab => output_gitlab_format(&filtered_data, config.output_file.as_deref()),
+            CiFormat::Bitbucket => output_bitbucket_format(
+                &filtered_data,
+                config.output_file.as_deref(),
+                config.project_license.as_deref(),
+            ),
         }
     } else if config.json {
         // JSON output
@@ -279,6 +306,83 @@ pub fn generate_report(data: Vec<LicenseInfo>, config: ReportConfig) -> (bool, b
     (has_restrictive, has_incompatible)
 }
 
+/// Render the scan in a structured format selected with `--format`
+///
+/// Structured formats always describe every dependency, so the restrictive and
+/// incompatible filters used by the table output are not applied here.
+pub fn generate_format_report(
+    data: &[LicenseInfo],
+    format: &OutputFormat,
+    project_path: &str,
+    project_license: Option<&str>,
+    policy_violations: &[PolicyViolation],
+    schema: Option<u8>,
+    output_file: Option<&str>,
+) -> FeludaResult<(bool, bool)> {
+    if schema.is_some() && *format != OutputFormat::Json {
+        return Err(FeludaError::Config(
+            "--schema only applies to --format json".to_string(),
+        ));
+    }
+
+    let has_restrictive = data.iter().any(|info| *info.is_restrictive());
+    let has_incompatible = data
+        .iter()
+        .any(|info| info.compatibility == LicenseCompatibility::Incompatible);
+
+    let project_name = crate::sbom::project_name_from_path(project_path);
+
+    match format {
+        OutputFormat::Cyclonedx | OutputFormat::CyclonedxXml => {
+            let spdx_doc = crate::sbom::build_spdx_document(project_name, data);
+            crate::sbom::cyclonedx::write_cyclonedx_report(
+                &spdx_doc,
+                *format == OutputFormat::CyclonedxXml,
+                output_file,
+            )?;
+        }
+        OutputFormat::SpdxJson | OutputFormat::SpdxTv => {
+            let spdx_doc = crate::sbom::build_spdx_document(project_name, data);
+            crate::sbom::spdx::write_spdx_report(
+                &spdx_doc,
+                *format == OutputFormat::SpdxTv,
+                output_file,
+            )?;
+        }
+        OutputFormat::Json => {
+            crate::report_json::write_json_report(
+                schema.unwrap_or(crate::report_json::LATEST_SCHEMA_VERSION),
+                project_path,
+                data,
+                project_license,
+                policy_violations,
+                output_file,
+            )?;
+        }
+        OutputFormat::Ndjson => {
+            crate::report_json::write_ndjson_report(data, output_file)?;
+        }
+        OutputFormat::Html => {
+            crate::html_report::write_html_report(
+                project_name,
+                data,
+                project_license,
+                policy_violations,
+                output_file,
+            )?;
+        }
+        OutputFormat::Csv | OutputFormat::Xlsx => {
+            crate::spreadsheet::write_spreadsheet_report(
+                data,
+                *format == OutputFormat::Xlsx,
+                output_file,
+            )?;
+        }
+    }
+
+    Ok((has_restrictive, has_incompatible))
+}
+
 fn print_verbose_table(
     license_info: &[LicenseInfo],
     restrictive: bool,
@@ -287,19 +391,31 @@ fn print_verbose_table(
     log(LogLevel::Info, "Printing verbose table");
 
     let mut headers = vec![
-        "Name".to_string(),
-        "Version".to_string(),
-        "License".to_string(),
-        "Restrictive".to_string(),
+        tr("report.name"),
+        tr("report.version"),
+        tr("report.license"),
+        tr("report.restrictive"),
     ];
 
     // Add compatibility column if project license is available
     if project_license.is_some() {
-        headers.push("Compatibility".to_string());
+        headers.push(tr("report.compatibility"));
     }
 
     // Always add OSI status column in verbose mode
-    headers.push("OSI Status".to_string());
+    headers.push(tr("report.osi_status"));
+
+    // Add tier column if risk tiers are configured
+    let has_tiers = license_info.iter().any(|info| info.tier.is_some());
+    if has_tiers {
+        headers.push(tr("report.tier"));
+    }
+
+    // Add obligations column when scanning with --obligations
+    let has_obligations = license_info.iter().any(|info| info.obligations.is_some());
+    if has_obligations {
+        headers.push(tr("report.obligations"));
+    }
 
     let mut formatter = TableFormatter::new(headers);
 
@@ -309,7 +425,7 @@ fn print_verbose_table(
             let mut row = vec![
                 info.name().to_string(),
                 info.version().to_string(),
-                info.get_license(),
+                license_cell(info),
                 info.is_restrictive().to_string(),
             ];
 
@@ -321,6 +437,14 @@ fn print_verbose_table(
             // Always add OSI status in verbose mode
             row.push(info.osi_status().to_string());
 
+            if has_tiers {
+                row.push(info.tier.clone().unwrap_or_else(|| "-".to_string()));
+            }
+
+            if has_obligations {
+                row.push(obligations_cell(info));
+            }
+
             row
         })
         .collect();
@@ -365,7 +489,7 @@ fn print_summary_table(
         println!(
             "\n{} {}",
             "📄".bold(),
-            format!("Project License: {license}").bold()
+            tr_with("report.project_license", &[("license", &license)]).bold()
         );
     }
 
@@ -426,7 +550,7 @@ fn print_summary_table(
     }
 
     // License summary
-    let headers = vec!["License Type".to_string(), "Count".to_string()];
+    let headers = vec![tr("report.license_type"), tr("report.count")];
 
     let mut formatter = TableFormatter::new(headers);
 
@@ -442,7 +566,7 @@ fn print_summary_table(
     println!(
         "\n{} {}\n",
         "🔍".bold(),
-        "License Summary".bold().underline()
+        tr("report.license_summary").bold().underline()
     );
 
     println!("{}", formatter.render_header());
@@ -458,7 +582,7 @@ fn print_summary_table(
     println!(
         "\n{} {}",
         "📦".bold(),
-        format!("Total dependencies scanned: {total_packages}").bold()
+        tr_with("report.total_scanned", &[("count", &total_packages)]).bold()
     );
 
     if !restrictive_licenses.is_empty() {
@@ -466,7 +590,9 @@ fn print_summary_table(
     } else {
         println!(
             "\n{}\n",
-            "✅ No restrictive licenses found! 🎉".green().bold()
+            format!("✅ {} 🎉", tr("report.no_restrictive"))
+                .green()
+                .bold()
         );
     }
 
@@ -478,7 +604,9 @@ fn print_summary_table(
     } else if project_license.is_some() {
         println!(
             "\n{}\n",
-            "✅ No incompatible licenses found! 🎉".green().bold()
+            format!("✅ {} 🎉", tr("report.no_incompatible"))
+                .green()
+                .bold()
         );
     }
 }
@@ -495,38 +623,66 @@ fn print_restrictive_licenses_table(restrictive_licenses: &[&LicenseInfo]) {
     println!(
         "\n{} {}\n",
         "⚠️".bold(),
-        "Warning: Restrictive licenses found!".yellow().bold()
+        tr("report.restrictive_found").yellow().bold()
+    );
+
+    let (headers, rows) = violation_table(restrictive_licenses);
+    let mut formatter = TableFormatter::new(headers);
+
+    for row in &rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+
+    for row in &rows {
+        println!("{}", formatter.render_row(row, false));
+    }
+
+    println!("{}\n", formatter.render_footer());
+}
+
+/// Print one row per scanned project, for scans covering several projects
+pub fn print_project_summary(projects: &[ProjectSummary]) {
+    log(
+        LogLevel::Info,
+        &format!("Printing summary for {} projects", projects.len()),
+    );
+
+    println!(
+        "{} {}\n",
+        "🗂️".bold(),
+        tr_with("report.projects_scanned", &[("count", &projects.len())]).bold()
     );
 
     let headers = vec![
-        "Package".to_string(),
-        "Version".to_string(),
-        "License".to_string(),
+        tr("report.project"),
+        tr("report.dependencies"),
+        tr("report.restrictive"),
+        tr("report.incompatible"),
     ];
-
     let mut formatter = TableFormatter::new(headers);
 
-    let rows: Vec<_> = restrictive_licenses
+    let rows: Vec<_> = projects
         .iter()
-        .map(|info| {
+        .map(|project| {
             vec![
-                info.name().to_string(),
-                info.version().to_string(),
-                info.get_license(),
+                project.manifest.clone(),
+                project.dependencies.to_string(),
+                project.restrictive.to_string(),
+                project.incompatible.to_string(),
             ]
         })
         .collect();
-
     for row in &rows {
         formatter.add_row(row);
     }
 
     println!("{}", formatter.render_header());
-
-    for row in &rows {
-        println!("{}", formatter.render_row(row, false));
+    for (project, row) in projects.iter().zip(&rows) {
+        let has_issues = project.restrictive > 0 || project.incompatible > 0;
+        println!("{}", formatter.render_row(row, has_issues));
     }
-
     println!("{}\n", formatter.render_footer());
 }
 
@@ -545,41 +701,148 @@ fn print_incompatible_licenses_table(
     println!(
         "\n{} {}\n",
         "❌".bold(),
-        format!("Warning: Licenses incompatible with {project_license} found!")
-            .red()
-            .bold()
+        tr_with(
+            "report.incompatible_found",
+            &[("license", &project_license)]
+        )
+        .red()
+        .bold()
     );
 
-    let headers = vec![
-        "Package".to_string(),
-        "Version".to_string(),
-        "License".to_string(),
-    ];
-
+    let (headers, rows) = violation_table(incompatible_licenses);
     let mut formatter = TableFormatter::new(headers);
 
-    let rows: Vec<_> = incompatible_licenses
+    for row in &rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+
+    for row in &rows {
+        println!("{}", formatter.render_row(row, false));
+    }
+
+    println!("{}\n", formatter.render_footer());
+}
+
+/// Headers and rows for a table of flagged dependencies
+///
+/// An "Introduced By" column is added when the dependency graph is known for
+/// any of them, so indirect dependencies can be traced to a direct one, and an
+/// "Obligations" column when scanning with `--obligations`.
+fn violation_table(licenses: &[&LicenseInfo]) -> (Vec<String>, Vec<Vec<String>>) {
+    let show_path = licenses.iter().any(|info| info.dependency_path.is_some());
+    let show_obligations = licenses.iter().any(|info| info.obligations.is_some());
+
+    let mut headers = vec![
+        tr("report.package"),
+        tr("report.version"),
+        tr("report.license"),
+    ];
+    if show_path {
+        headers.push(tr("report.introduced_by"));
+    }
+    if show_obligations {
+        headers.push(tr("report.obligations"));
+    }
+
+    let rows = licenses
         .iter()
         .map(|info| {
-            vec![
+            let mut row = vec![
                 info.name().to_string(),
                 info.version().to_string(),
                 info.get_license(),
-            ]
+            ];
+            if show_path {
+                row.push(info.introduced_by().unwrap_or_else(|| {
+                    if info.dependency_path.is_some() {
+                        tr("report.direct")
+                    } else {
+                        "-".to_string()
+                    }
+                }));
+            }
+            if show_obligations {
+                row.push(obligations_cell(info));
+            }
+            row
         })
         .collect();
 
-    for row in &rows {
-        formatter.add_row(row);
+    (headers, rows)
+}
+
+/// Summary of the license's obligations, `unknown` for licenses missing from the table
+fn obligations_cell(info: &LicenseInfo) -> String {
+    info.obligations
+        .map(|obligations| obligations.summary())
+        .unwrap_or_else(|| tr("obligation.unknown"))
+}
+
+/// The license, marked when it was asserted in `[overrides]` rather than detected
+fn license_cell(info: &LicenseInfo) -> String {
+    if info.is_manually_asserted() {
+        format!("{} {}", info.get_license(), tr("report.manual"))
+    } else {
+        info.get_license()
     }
+}
 
-    println!("{}", formatter.render_header());
+/// ` (via a@1.0.0 → b@2.0.0)` for indirect dependencies, empty otherwise
+pub fn introduced_by_suffix(info: &LicenseInfo) -> String {
+    info.introduced_by()
+        .map(|chain| format!(" (via {chain})"))
+        .unwrap_or_default()
+}
 
-    for row in &rows {
-        println!("{}", formatter.render_row(row, false));
+/// Why a dependency is reported by the code scanning formats
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum LicenseViolation {
+    Restrictive,
+    Incompatible,
+}
+
+impl LicenseViolation {
+    /// What is wrong with the dependency, without the path it was pulled in by
+    pub fn message(self, info: &LicenseInfo, project_license: Option<&str>) -> String {
+        match self {
+            LicenseViolation::Restrictive => format!(
+                "Dependency '{}@{}' has restrictive license: {}",
+                info.name,
+                info.version,
+                info.get_license()
+            ),
+            LicenseViolation::Incompatible => format!(
+                "Dependency '{}@{}' has license {} which may be incompatible with project license {}",
+                info.name,
+                info.version,
+                info.get_license(),
+                project_license.unwrap_or_default()
+            ),
+        }
     }
+}
 
-    println!("{}\n", formatter.render_footer());
+/// The restrictive and incompatible dependencies, in order, for the code
+/// scanning formats
+///
+/// A dependency that is both is listed twice. Incompatibility is only reported
+/// when the project license is known.
+pub fn license_violations<'a>(
+    license_info: &'a [LicenseInfo],
+    project_license: Option<&str>,
+) -> Vec<(LicenseViolation, &'a LicenseInfo)> {
+    let mut violations = Vec::new();
+    for info in license_info {
+        if info.is_restrictive {
+            violations.push((LicenseViolation::Restrictive, info));
+        }
+        if project_license.is_some() && info.compatibility == LicenseCompatibility::Incompatible {
+            violations.push((LicenseViolation::Incompatible, info));
+        }
+    }
+    violations
 }
 
 fn print_summary_footer(license_info: &[LicenseInfo], project_license: Option<&str>) {
@@ -609,16 +872,16 @@ fn print_summary_footer(license_info: &[LicenseInfo], project_license: Option<&s
         (0, 0, 0)
     };
 
-    println!("{}", "🔍 License Summary:".bold());
+    println!("🔍 {}", tr("report.summary").bold());
     println!(
         "  • {} {}",
         permissive_count.to_string().green().bold(),
-        "permissive licenses".green()
+        tr("report.permissive_licenses").green()
     );
     println!(
         "  • {} {}",
         restrictive_count.to_string().yellow().bold(),
-        "restrictive licenses".yellow()
+        tr("report.restrictive_licenses").yellow()
     );
 
     // Print compatibility info if project license is available
@@ -626,42 +889,61 @@ fn print_summary_footer(license_info: &[LicenseInfo], project_license: Option<&s
         println!(
             "  • {} {}",
             compatible_count.to_string().green().bold(),
-            "compatible licenses".green()
+            tr("report.compatible_licenses").green()
         );
         println!(
             "  • {} {}",
             incompatible_count.to_string().red().bold(),
-            "incompatible licenses".red()
+            tr("report.incompatible_licenses").red()
         );
         println!(
             "  • {} {}",
             unknown_count.to_string().blue().bold(),
-            "unknown compatibility".blue()
+            tr("report.unknown_compatibility").blue()
         );
     }
 
-    println!("  • {total} total dependencies");
+    let manual_count = license_info
+        .iter()
+        .filter(|i| i.is_manually_asserted())
+        .count();
+    if manual_count > 0 {
+        println!(
+            "  • {} {}",
+            manual_count.to_string().cyan().bold(),
+            tr("report.manual_licenses").cyan()
+        );
+    }
+
+    println!(
+        "  • {}",
+        tr_with("report.total_dependencies", &[("count", &total)])
+    );
 
     if restrictive_count > 0 {
-        println!("\n{} {}: Review these dependencies for compliance with your project's licensing requirements.",
+        println!(
+            "\n{} {}: {}",
             "⚠️".yellow().bold(),
-            "Recommendation".yellow().bold()
+            tr("report.recommendation").yellow().bold(),
+            tr("report.review_restrictive")
         );
     } else {
         println!(
-            "\n{} {}: All dependencies have permissive licenses compatible with most projects.",
+            "\n{} {}: {}",
             "✅".green().bold(),
-            "Status".green().bold()
+            tr("report.status").green().bold(),
+            tr("report.all_permissive")
         );
     }
 
     // Add compatibility recommendation if project license is available
     if let Some(license) = project_license {
         if incompatible_count > 0 {
-            println!("\n{} {}: Some dependencies have licenses that may be incompatible with your project's {} license. Review for legal compliance.",
+            println!(
+                "\n{} {}: {}",
                 "❌".red().bold(),
-                "Warning".red().bold(),
-                license
+                tr("report.warning").red().bold(),
+                tr_with("report.review_incompatible", &[("license", &license)])
             );
         }
     }
@@ -691,12 +973,21 @@ fn output_github_format(
 
     // GitHub Actions workflow commands format for restrictive licenses
     for info in license_info {
+        // Annotate the manifest the dependency was declared in when known
+        let file = info
+            .source_file
+            .as_deref()
+            .map(|file| format!("file={},", escape_workflow_property(file)))
+            .unwrap_or_default();
+
         if *info.is_restrictive() {
             let warning = format!(
-                "::warning title=Restrictive License::Dependency '{}@{}' has restrictive license: {}\n",
+                "::warning {}title=Restrictive License::Dependency '{}@{}' has restrictive license: {}{}\n",
+                file,
                 info.name(),
                 info.version(),
-                info.get_license()
+                escape_workflow_data(&info.get_license()),
+                escape_workflow_data(&introduced_by_suffix(info))
             );
             output.push_str(&warning);
 
@@ -710,11 +1001,13 @@ fn output_github_format(
         if let Some(license) = project_license {
             if info.compatibility == LicenseCompatibility::Incompatible {
                 let warning = format!(
-                    "::error title=Incompatible License::Dependency '{}@{}' has license {} which may be incompatible with project license {}\n",
+                    "::error {}title=Incompatible License::Dependency '{}@{}' has license {} which may be incompatible with project license {}{}\n",
+                    file,
                     info.name(),
                     info.version(),
-                    info.get_license(),
-                    license
+                    escape_workflow_data(&info.get_license()),
+                    license,
+                    escape_workflow_data(&introduced_by_suffix(info))
                 );
                 output.push_str(&warning);
 
@@ -787,6 +1080,99 @@ fn output_github_format(
     }
 }
 
+/// Escape the message of a GitHub Actions workflow command
+fn escape_workflow_data(value: &str) -> String {
+    value
+        .replace('%', "%25")
+        .replace('\r', "%0D")
+        .replace('\n', "%0A")
+}
+
+/// Escape a property value (such as `file=`) of a GitHub Actions workflow command
+fn escape_workflow_property(value: &str) -> String {
+    escape_workflow_data(value)
+        .replace(':', "%3A")
+        .replace(',', "%2C")
+}
+
+/// Append a Markdown summary of the scan to the GitHub Actions job summary
+///
+/// `summary_path` is the file named by `$GITHUB_STEP_SUMMARY`. The whole scan is
+/// summarized regardless of the restrictive and incompatible filters.
+pub fn write_github_step_summary(
+    summary_path: &std::path::Path,
+    license_info: &[LicenseInfo],
+    project_license: Option<&str>,
+) -> FeludaResult<()> {
+    use std::io::Write;
+
+    log(
+        LogLevel::Info,
+        &format!("Writing GitHub step summary to: {}", summary_path.display()),
+    );
+
+    let summary = github_step_summary(license_info, project_license);
+    let mut file = fs::OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(summary_path)?;
+    file.write_all(summary.as_bytes())?;
+    Ok(())
+}
+
+fn github_step_summary(license_info: &[LicenseInfo], project_license: Option<&str>) -> String {
+    let violations: Vec<(&LicenseInfo, &str)> = license_info
+        .iter()
+        .filter_map(|info| {
+            let incompatible = project_license.is_some()
+                && info.compatibility == LicenseCompatibility::Incompatible;
+            match (*info.is_restrictive(), incompatible) {
+                (true, true) => Some((info, "Restrictive, incompatible")),
+                (true, false) => Some((info, "Restrictive")),
+                (false, true) => Some((info, "Incompatible")),
+                (false, false) => None,
+            }
+        })
+        .collect();
+
+    let mut summary = String::from("## Feluda License Check\n\n");
+    if let Some(license) = project_license {
+        summary.push_str(&format!("Project license: `{license}`\n\n"));
+    }
+
+    if violations.is_empty() {
+        summary.push_str(&format!(
+            "✅ All {} dependencies passed the license check.\n\n",
+            license_info.len()
+        ));
+        return summary;
+    }
+
+    summary.push_str(&format!(
+        "❌ {} of {} dependencies have license issues.\n\n",
+        violations.len(),
+        license_info.len()
+    ));
+    summary.push_str("| Dependency | Version | License | Issue | Manifest |\n");
+    summary.push_str("|---|---|---|---|---|\n");
+    for (info, issue) in violations {
+        summary.push_str(&format!(
+            "| {} | {} | {} | {} | {} |\n",
+            escape_markdown_cell(info.name()),
+            escape_markdown_cell(info.version()),
+            escape_markdown_cell(&license_cell(info)),
+            issue,
+            escape_markdown_cell(info.source_file.as_deref().unwrap_or("-"))
+        ));
+    }
+    summary.push('\n');
+    summary
+}
+
+fn escape_markdown_cell(value: &str) -> String {
+    value.replace('|', "\\|")
+}
+
 fn output_jenkins_format(
     license_info: &[LicenseInfo],
     output_path: Option<&str>,
@@ -822,11 +1208,12 @@ fn output_jenkins_format(
         if *info.is_restrictive() {
             failures.push(format!(
                 r#"<failure message="Restrictive license found" type="restrictive">
-            Dependency '{}@{}' has restrictive license: {}
+            Dependency '{}@{}' has restrictive license: {}{}
         </failure>"#,
                 info.name(),
                 info.version(),
-                info.get_license()
+                info.get_license(),
+                introduced_by_suffix(info)
             ));
 
             log(
@@ -843,12 +1230,13 @@ fn output_jenkins_format(
             if info.compatibility == LicenseCompatibility::Incompatible {
                 failures.push(format!(
                     r#"<failure message="Incompatible license found" type="incompatible">
-            Dependency '{}@{}' has license {} which may be incompatible with project license {}
+            Dependency '{}@{}' has license {} which may be incompatible with project license {}{}
         </failure>"#,
                     info.name(),
                     info.version(),
                     info.get_license(),
-                    license
+                    license,
+                    introduced_by_suffix(info)
                 ));
 
                 log(
@@ -933,6 +1321,120 @@ fn output_jenkins_format(
     }
 }
 
+fn output_sarif_format(
+    license_info: &[LicenseInfo],
+    output_path: Option<&str>,
+    project_license: Option<&str>,
+) {
+    log(LogLevel::Info, "Generating SARIF 2.1.0 output");
+
+    let sarif_log = crate::sarif::build_sarif_log(license_info, project_license);
+    log(
+        LogLevel::Info,
+        &format!(
+            "SARIF results: {}, rules: {}",
+            sarif_log.runs[0].results.len(),
+            sarif_log.runs[0].tool.driver.rules.len()
+        ),
+    );
+
+    let sarif_json = match serde_json::to_string_pretty(&sarif_log) {
+        Ok(json) => json,
+        Err(err) => {
+            log_error("Failed to serialize SARIF output", &err);
+            println!("Error: Failed to generate SARIF output");
+            return;
+        }
+    };
+
+    // Output to file or stdout
+    if let Some(path) = output_path {
+        log(
+            LogLevel::Info,
+            &format!("Writing SARIF output to file: {path}"),
+        );
+
+        match fs::write(path, &sarif_json) {
+            Ok(_) => println!("SARIF output written to: {path}"),
+            Err(err) => {
+                log_error(&format!("Failed to write SARIF output file: {path}"), &err);
+                println!("Error: Failed to write SARIF output file");
+                println!("{sarif_json}"); // Fallback to stdout
+            }
+        }
+    } else {
+        log(LogLevel::Info, "Writing SARIF output to stdout");
+        println!("{sarif_json}");
+    }
+}
+
+fn output_gitlab_format(license_info: &[LicenseInfo], output_path: Option<&str>) {
+    log(LogLevel::Info, "Generating GitLab license scanning report");
+
+    let report = crate::gitlab::build_license_scanning_report(license_info);
+    log(
+        LogLevel::Info,
+        &format!(
+            "GitLab report dependencies: {}, licenses: {}",
+            report.dependencies.len(),
+            report.licenses.len()
+        ),
+    );
+
+    match serde_json::to_string_pretty(&report) {
+        Ok(json) => write_ci_report("GitLab license scanning report", &json, output_path),
+        Err(err) => {
+            log_error("Failed to serialize GitLab license scanning report", &err);
+            println!("Error: Failed to generate GitLab license scanning report");
+        }
+    }
+}
+
+fn output_bitbucket_format(
+    license_info: &[LicenseInfo],
+    output_path: Option<&str>,
+    project_license: Option<&str>,
+) {
+    log(LogLevel::Info, "Generating Bitbucket Code Insights report");
+
+    let insights = crate::bitbucket::build_code_insights(license_info, project_license);
+    log(
+        LogLevel::Info,
+        &format!(
+            "Bitbucket report result: {}, annotations: {}",
+            insights.report.result,
+            insights.annotations.len()
+        ),
+    );
+
+    match serde_json::to_string_pretty(&insights) {
+        Ok(json) => write_ci_report("Bitbucket Code Insights report", &json, output_path),
+        Err(err) => {
+            log_error("Failed to serialize Bitbucket Code Insights report", &err);
+            println!("Error: Failed to generate Bitbucket Code Insights report");
+        }
+    }
+}
+
+/// Write a CI report to the output file, falling back to stdout when it can't be written
+fn write_ci_report(kind: &str, content: &str, output_path: Option<&str>) {
+    if let Some(path) = output_path {
+        log(LogLevel::Info, &format!("Writing {kind} to file: {path}"));
+
+        match fs::write(path, content) {
+            Ok(_) => println!("{kind} written to: {path}"),
+            Err(err) => {
+                log_error(&format!("Failed to write {kind} file: {path}"), &err);
+                println!("Error: Failed to write {kind} file");
+                println!("{content}"); // Fallback to stdout
+            }
+        }
+    } else {
+        log(LogLevel::Info, &format!("Writing {kind} to stdout"));
+        println!("{content}");
+    }
+}
+
 // Add gist report function to reporter.rs
 fn print_gist_summary(
     license_info: &[LicenseInfo],
@@ -947,19 +1449,20 @@ fn print_gist_summary(
         .filter(|i| i.compatibility == LicenseCompatibility::Incompatible)
         .count();
 
-    let project_license_display = project_license.unwrap_or("Not detected");
+    let not_detected = tr("report.not_detected");
+    let project_license_display = project_license.unwrap_or(&not_detected);
 
     println!("\n{}", "🦀 FELUDA GIST".bold().cyan());
     println!("{}", "━".repeat(50).cyan());
 
     println!(
         "│ {:30} │ {}",
-        "Project License".bold(),
+        tr("report.project_license_label").bold(),
         project_license_display.cyan()
     );
     println!(
         "│ {:30} │ {}",
-        "Total Dependencies Scanned".bold(),
+        tr("report.dependencies_scanned").bold(),
         total_packages.to_string().cyan()
     );
 
@@ -991,24 +1494,32 @@ fn print_gist_summary(
 
     println!(
         "│ {:30} │ {}",
-        "Restrictive dependencies".bold(),
+        tr("report.restrictive_dependencies").bold(),
         restrictive_status
     );
     println!(
         "│ {:30} │ {}",
-        "Incompatible dependencies".bold(),
+        tr("report.incompatible_dependencies").bold(),
         incompatible_status
     );
 
     println!("{}", "━".repeat(50).cyan());
 
     let overall_status = if restrictive_count > 0 || incompatible_count > 0 {
-        format!("{} {}", "⚠️".yellow(), "NEEDS ATTENTION".yellow().bold())
+        format!(
+            "{} {}",
+            "⚠️".yellow(),
+            tr("report.needs_attention").yellow().bold()
+        )
     } else {
-        format!("{} {}", "✨".green(), "ALL GOOD".green().bold())
+        format!("{} {}", "✨".green(), tr("report.all_good").green().bold())
     };
 
-    println!("│ {:30} │ {}", "Recommendation".bold(), overall_status);
+    println!(
+        "│ {:30} │ {}",
+        tr("report.recommendation").bold(),
+        overall_status
+    );
 
     println!("{}\n", "━".repeat(50).cyan());
 }
@@ -1026,61 +1537,75 @@ mod tests {
     fn get_test_data() -> Vec<LicenseInfo> {
         vec![
             LicenseInfo {
-                name: "crate1".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("crate1", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "crate2".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("crate2", "2.0.0", Some("GPL-3.0"))
             },
             LicenseInfo {
-                name: "crate3".to_string(),
-                version: "3.0.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("crate3", "3.0.0", Some("Apache-2.0"))
             },
-            LicenseInfo {
-                name: "crate4".to_string(),
-                version: "4.0.0".to_string(),
-                license: Some("Unknown".to_string()),
-                is_restrictive: false,
-                compatibility: LicenseCompatibility::Unknown,
-                osi_status: crate::licenses::OsiStatus::Unknown,
-            },
+            LicenseInfo::test("crate4", "4.0.0", Some("Unknown")),
         ]
     }
 
     fn get_test_data_with_unknown_compatibility() -> Vec<LicenseInfo> {
         vec![
             LicenseInfo {
-                name: "crate1".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
-                compatibility: LicenseCompatibility::Unknown,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("crate1", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "crate2".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
-                compatibility: LicenseCompatibility::Unknown,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("crate2", "2.0.0", Some("GPL-3.0"))
             },
         ]
     }
 
+    #[test]
+    fn test_license_violations() {
+        let dep =
+            |name: &str, restrictive: bool, compatibility: LicenseCompatibility| LicenseInfo {
+                is_restrictive: restrictive,
+                compatibility,
+                ..LicenseInfo::test(name, "1.0.0", Some("GPL-3.0"))
+            };
+        let data = vec![
+            dep("both", true, LicenseCompatibility::Incompatible),
+            dep("fine", false, LicenseCompatibility::Compatible),
+            dep("incompatible", false, LicenseCompatibility::Incompatible),
+        ];
+
+        let violations: Vec<_> = license_violations(&data, Some("MIT"))
+            .into_iter()
+            .map(|(kind, info)| (kind, info.name.as_str()))
+            .collect();
+        assert_eq!(
+            violations,
+            vec![
+                (LicenseViolation::Restrictive, "both"),
+                (LicenseViolation::Incompatible, "both"),
+                (LicenseViolation::Incompatible, "incompatible"),
+            ]
+        );
+        assert_eq!(
+            LicenseViolation::Incompatible.message(&data[2], Some("MIT")),
+            "Dependency 'incompatible@1.0.0' has license GPL-3.0 which may be incompatible with project license MIT"
+        );
+
+        // Incompatibility needs a project license
+        let violations = license_violations(&data, None);
+        assert_eq!(violations.len(), 1);
+        assert_eq!(violations[0].0, LicenseViolation::Restrictive);
+    }
     #[test]
     fn test_generate_report_empty_data() {
         let data = vec![];
@@ -1265,6 +1790,162 @@ mod tests {
         assert!(content.contains("Project is using MIT license"));
     }
 
+    #[test]
+    fn test_github_output_annotates_manifest_file() {
+        let mut data = get_test_data();
+        for info in &mut data {
+            info.source_file = Some("Cargo.toml".to_string());
+        }
+        let temp_dir = setup();
+        let output_path = temp_dir.path().join("github_output.txt");
+        let config = ReportConfig::new(
+            false,
+            false,
+            false,
+            false,
+            false,
+            Some(CiFormat::Github),
+            Some(output_path.to_str().unwrap().to_string()),
+            Some("MIT".to_string()),
+            false,
+            None,
+        );
+
+        generate_report(data, config);
+
+        let content = fs::read_to_string(&output_path).unwrap();
+        assert!(content.contains(
+            "::warning file=Cargo.toml,title=Restrictive License::Dependency 'crate2@2.0.0'"
+        ));
+        assert!(content.contains("::error file=Cargo.toml,title=Incompatible License::"));
+    }
+
+    #[test]
+    fn test_escape_workflow_command_values() {
+        assert_eq!(escape_workflow_data("50%\nnext"), "50%25%0Anext");
+        assert_eq!(escape_workflow_property("dir,a/pkg:1"), "dir%2Ca/pkg%3A1");
+    }
+
+    #[test]
+    fn test_write_github_step_summary() {
+        let temp_dir = setup();
+        let summary_path = temp_dir.path().join("step_summary.md");
+        fs::write(&summary_path, "## Previous step\n\n").unwrap();
+
+        let mut data = get_test_data();
+        data[1].source_file = Some("Cargo.toml".to_string());
+        write_github_step_summary(&summary_path, &data, Some("MIT")).unwrap();
+
+        let content = fs::read_to_string(&summary_path).unwrap();
+        assert!(content.starts_with("## Previous step"));
+        assert!(content.contains("## Feluda License Check"));
+        assert!(content.contains("Project license: `MIT`"));
+        assert!(content
+            .contains("| crate2 | 2.0.0 | GPL-3.0 | Restrictive, incompatible | Cargo.toml |"));
+        assert!(!content.contains("| crate1 |"));
+
+        let clean = github_step_summary(&data[..1], None);
+        assert!(clean.contains("All 1 dependencies passed"));
+        assert!(!clean.contains("| Dependency |"));
+    }
+
+    #[test]
+    fn test_sarif_output_format() {
+        let data = get_test_data();
+        let temp_dir = setup();
+        let output_path = temp_dir.path().join("feluda.sarif");
+        let config = ReportConfig::new(
+            false,
+            false,
+            false,
+            false,
+            false,
+            Some(CiFormat::Sarif),
+            Some(output_path.to_str().unwrap().to_string()),
+            Some("MIT".to_string()),
+            false,
+            None,
+        );
+
+        let result = generate_report(data, config);
+        assert_eq!(result, (true, true));
+
+        let content = fs::read_to_string(&output_path).unwrap();
+        let sarif: serde_json::Value = serde_json::from_str(&content).unwrap();
+        assert_eq!(sarif["version"], "2.1.0");
+        let results = sarif["runs"][0]["results"].as_array().unwrap();
+        assert!(results.iter().any(|r| r["ruleId"]
+            .as_str()
+            .unwrap()
+            .starts_with("restrictive-license/")));
+        assert!(results.iter().any(|r| r["ruleId"]
+            .as_str()
+            .unwrap()
+            .starts_with("incompatible-license/")));
+    }
+
+    #[test]
+    fn test_sarif_output_format_without_dependencies() {
+        let temp_dir = setup();
+        let output_path = temp_dir.path().join("feluda.sarif");
+        let config = ReportConfig::new(
+            false,
+            false,
+            false,
+            false,
+            false,
+            Some(CiFormat::Sarif),
+            Some(output_path.to_str().unwrap().to_string()),
+            None,
+            false,
+            None,
+        );
+
+        assert_eq!(generate_report(Vec::new(), config), (false, false));
+
+        let content = fs::read_to_string(&output_path).unwrap();
+        let sarif: serde_json::Value = serde_json::from_str(&content).unwrap();
+        assert!(sarif["runs"][0]["results"].as_array().unwrap().is_empty());
+    }
+
+    #[test]
+    fn test_merge_request_formats_without_dependencies() {
+        let temp_dir = setup();
+        for (format, file_name, pointer, expected) in [
+            (
+                CiFormat::Gitlab,
+                "gl-license-scanning-report.json",
+                "/version",
+                "2.1",
+            ),
+            (
+                CiFormat::Bitbucket,
+                "feluda-insights.json",
+                "/report/result",
+                "PASSED",
+            ),
+        ] {
+            let output_path = temp_dir.path().join(file_name);
+            let config = ReportConfig::new(
+                false,
+                false,
+                false,
+                false,
+                false,
+                Some(format),
+                Some(output_path.to_str().unwrap().to_string()),
+                None,
+                false,
+                None,
+            );
+
+            assert_eq!(generate_report(Vec::new(), config), (false, false));
+            let content = fs::read_to_string(&output_path).unwrap();
+            let report: serde_json::Value = serde_json::from_str(&content).unwrap();
+            assert_eq!(report.pointer(pointer).unwrap(), expected);
+        }
+    }
+
     #[test]
     fn test_jenkins_output_format_no_project_license() {
         let data = get_test_data_with_unknown_compatibility();
@@ -1404,20 +2085,14 @@ mod tests {
     fn test_generate_report_all_permissive() {
         let data = vec![
             LicenseInfo {
-                name: "package1".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package1", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "package2".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("BSD-3-Clause".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package2", "2.0.0", Some("BSD-3-Clause"))
             },
         ];
 
@@ -1443,20 +2118,15 @@ mod tests {
     fn test_generate_report_mixed_licenses() {
         let data = vec![
             LicenseInfo {
-                name: "good_package".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("good_package", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "bad_package".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("bad_package", "2.0.0", Some("GPL-3.0"))
             },
         ];
 
@@ -1482,20 +2152,15 @@ mod tests {
     fn test_generate_report_strict_mode_filters() {
         let data = vec![
             LicenseInfo {
-                name: "permissive_package".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("permissive_package", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "restrictive_package".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("restrictive_package", "2.0.0", Some("GPL-3.0"))
             },
         ];
 
@@ -1520,12 +2185,9 @@ mod tests {
     #[test]
     fn test_generate_report_json_output() {
         let data = vec![LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         }];
 
         let config = ReportConfig::new(
@@ -1540,12 +2202,9 @@ mod tests {
     #[test]
     fn test_generate_report_yaml_output() {
         let data = vec![LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         }];
 
         let config = ReportConfig::new(
@@ -1560,12 +2219,9 @@ mod tests {
     #[test]
     fn test_generate_report_verbose_output() {
         let data = vec![LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         }];
 
         let config = ReportConfig::new(
@@ -1589,12 +2245,10 @@ mod tests {
     #[test]
     fn test_github_output_format_stdout() {
         let data = vec![LicenseInfo {
-            name: "restrictive_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("GPL-3.0".to_string()),
             is_restrictive: true,
             compatibility: LicenseCompatibility::Incompatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("restrictive_package", "1.0.0", Some("GPL-3.0"))
         }];
 
         let config = ReportConfig::new(
@@ -1618,12 +2272,9 @@ mod tests {
     #[test]
     fn test_output_github_format_file_write_error() {
         let data = vec![LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         }];
 
         output_github_format(
@@ -1636,12 +2287,9 @@ mod tests {
     #[test]
     fn test_output_jenkins_format_file_write_error() {
         let data = vec![LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         }];
 
         output_jenkins_format(
@@ -1655,20 +2303,16 @@ mod tests {
     fn test_print_restrictive_licenses_table() {
         let data = [
             LicenseInfo {
-                name: "restrictive1".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("restrictive1", "1.0.0", Some("GPL-3.0"))
             },
             LicenseInfo {
-                name: "restrictive2".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("AGPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("restrictive2", "2.0.0", Some("AGPL-3.0"))
             },
         ];
 
@@ -0,0 +1,720 @@
+//! Licenses of GitHub and GitLab repositories
+//!
+//! Dependencies installed straight from a git repository (git gems, Swift
+//! packages, Go pseudo-versions, Bazel archives) have no registry metadata, so
+//! their license is classified from the repository's license file. The file is
+//! looked up through the GitHub and GitLab APIs:
+//!
+//! - GitHub: `GET /repos/{owner}/{repo}/license?ref={revision}`, authenticated
+//!   with `--github-token` or `$GITHUB_TOKEN`
+//! - GitLab: `GET /api/v4/projects/{path}/repository/files/{file}/raw?ref={revision}`
+//!   on gitlab.com and `gitlab.*` hosts, authenticated with `--gitlab-token` or
+//!   `$GITLAB_TOKEN`
+//!
+//! Responses are remembered with their `ETag` in the cache directory and
+//! revalidated with `If-None-Match`, so an unchanged license costs a `304`
+//! that GitHub does not count against the rate limit. Licenses at a full commit
+//! hash never change and are reused without a request.
+//!
+//! The client follows the `x-ratelimit-remaining`/`ratelimit-remaining` and
+//! reset headers. Once the limit is used up it waits for the reset if that is
+//! less than [`MAX_RATE_LIMIT_WAIT`] away, and otherwise falls back to the raw
+//! files on raw.githubusercontent.com for the rest of the scan.
+
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use std::collections::HashMap;
+use std::fs;
+use std::sync::{Mutex, OnceLock};
+use std::thread::sleep;
+use std::time::{Duration, SystemTime};
+
+use crate::cache::cache_dir_path;
+use crate::credentials::decode_base64;
+use crate::debug::{log, log_error, FeludaResult, LogLevel};
+use crate::license_detector::classify_license_text;
+use crate::licenses::get_github_token;
+use crate::registry::{self, Registry};
+
+const GITHUB_API_URL: &str = "https://api.github.com";
+const GITHUB_RAW_URL: &str = "https://raw.githubusercontent.com";
+const RESPONSE_CACHE_FILE: &str = "repository_licenses.json";
+const RESPONSE_CACHE_VERSION: u32 = 1;
+/// Longest wait for an exhausted rate limit to reset before falling back
+pub const MAX_RATE_LIMIT_WAIT: Duration = Duration::from_secs(60);
+/// Confidence of a license GitHub detected when its text could not be classified
+const GITHUB_DETECTION_CONFIDENCE: f32 = 0.9;
+
+/// License files tried in a repository, in order
+const LICENSE_FILES: [&str; 6] = [
+    "LICENSE",
+    "LICENSE.txt",
+    "LICENSE.md",
+    "MIT-LICENSE",
+    "LICENSE-MIT",
+    "COPYING",
+];
+
+static GITLAB_TOKEN: OnceLock<Option<String>> = OnceLock::new();
+static RATE_LIMITS: OnceLock<Mutex<HashMap<Registry, RateLimit>>> = OnceLock::new();
+static RESPONSE_CACHE: OnceLock<Mutex<ResponseCache>> = OnceLock::new();
+
+/// Set the GitLab token once (from CLI or env)
+pub fn set_gitlab_token(token: Option<String>) {
+    let _ = GITLAB_TOKEN.set(token);
+}
+
+fn gitlab_token() -> Option<&'static str> {
+    GITLAB_TOKEN.get().and_then(|t| t.as_deref())
+}
+
+/// A repository on a supported forge
+#[derive(Debug, Clone, PartialEq)]
+enum Repository {
+    GitHub {
+        owner: String,
+        name: String,
+    },
+    /// `path` is the full project path, nested groups included
+    GitLab {
+        host: String,
+        path: String,
+    },
+}
+
+impl Repository {
+    /// Parse an HTTPS, SSH or `git://` remote URL
+    fn parse(remote: &str) -> Option<Self> {
+        let remote = remote.trim().trim_start_matches("git+");
+        let location = remote
+            .strip_prefix("https://")
+            .or_else(|| remote.strip_prefix("http://"))
+            .or_else(|| remote.strip_prefix("git://"))
+            .or_else(|| remote.strip_prefix("ssh://"))
+            .map(|rest| match rest.split_once('@') {
+                // Drop the user of `ssh://git@host/...`, but keep `@` in paths
+                Some((user, host)) if !user.contains('/') => host,
+                _ => rest,
+            })
+            .map(str::to_string)
+            .or_else(|| {
+                // scp-like syntax: git@github.com:owner/repo.git
+                let (user_host, path) = remote.split_once(':')?;
+                let host = user_host.split_once('@').map_or(user_host, |(_, h)| h);
+                Some(format!("{host}/{path}"))
+            })?;
+        let (host, path) = location.split_once('/')?;
+        let host = host.split(':').next()?.to_lowercase();
+        let path = path
+            .split(['#', '?'])
+            .next()?
+            .trim_end_matches('/')
+            .trim_end_matches(".git");
+
+        if host == "github.com" || host == "www.github.com" {
+            let (owner, name) = path.split_once('/')?;
+            let name = name.split('/').next()?;
+            if owner.is_empty() || name.is_empty() {
+                return None;
+            }
+            return Some(Repository::GitHub {
+                owner: owner.to_string(),
+                name: name.to_string(),
+            });
+        }
+        if host == "gitlab.com" || host.starts_with("gitlab.") {
+            // Everything after `/-/` is a page of the project, not part of its path
+            let path = path.split("/-/").next()?;
+            if !path.contains('/') {
+                return None;
+            }
+            return Some(Repository::GitLab {
+                host,
+                path: path.to_string(),
+            });
+        }
+        None
+    }
+}
+
+/// Classify the license file of a repository at `revision`, the default branch when empty
+pub fn fetch_repository_license(remote: &str, revision: &str) -> Option<(String, f32)> {
+    let Some(repository) = Repository::parse(remote) else {
+        log(
+            LogLevel::Warn,
+            &format!("Cannot look up licenses for git remote {remote}"),
+        );
+        return None;
+    };
+
+    match repository {
+        Repository::GitHub { owner, name } => {
+            let from_api = if api_available(Registry::GitHub) {
+                github_license(&owner, &name, revision)
+            } else {
+                Fetch::Unavailable
+            };
+            match from_api {
+                Fetch::Found(license) => Some(license),
+                Fetch::Missing => None,
+                Fetch::Unavailable => github_raw_license(&owner, &name, revision),
+            }
+        }
+        Repository::GitLab { host, path } => gitlab_license(&host, &path, revision),
+    }
+}
+
+/// Outcome of an API lookup
+enum Fetch {
+    Found((String, f32)),
+    /// The repository has no license file the API knows of
+    Missing,
+    /// The API could not be asked, e.g. because the rate limit is used up
+    Unavailable,
+}
+
+fn github_license(owner: &str, name: &str, revision: &str) -> Fetch {
+    let mut url = format!("{GITHUB_API_URL}/repos/{owner}/{name}/license");
+    if !revision.is_empty() {
+        url.push_str(&format!("?ref={}", url_encode(revision)));
+    }
+    let response = match conditional_get(Registry::GitHub, &url, revision, get_github_token()) {
+        Conditional::Cached(entry) => return cached_fetch(entry),
+        Conditional::Response(response) => response,
+        Conditional::Failed => return Fetch::Unavailable,
+    };
+
+    let status = response.status();
+    if status == reqwest::StatusCode::NOT_FOUND {
+        return Fetch::Missing;
+    }
+    if !status.is_success() {
+        log(
+            LogLevel::Warn,
+            &format!("GitHub returned {status} for the license of {owner}/{name}"),
+        );
+        return Fetch::Unavailable;
+    }
+
+    let etag = etag(&response);
+    let Ok(body) = response.json::<Value>() else {
+        return Fetch::Unavailable;
+    };
+    let license = github_license_from_body(&body);
+    remember(&url, etag, license.clone());
+    match license {
+        Some(license) => Fetch::Found(license),
+        None => Fetch::Missing,
+    }
+}
+
+/// The license in a response of `/repos/{owner}/{repo}/license`
+///
+/// The text is classified like a local license file; GitHub's own detection
+/// is used when the text doesn't match any known license.
+fn github_license_from_body(body: &Value) -> Option<(String, f32)> {
+    let text = body
+        .get("content")
+        .and_then(Value::as_str)
+        .and_then(|content| decode_base64(&content.split_whitespace().collect::<String>()));
+    if let Some(detected) = text.as_deref().and_then(classify_license_text) {
+        return Some((detected.license, detected.confidence));
+    }
+    body.pointer("/license/spdx_id")
+        .and_then(Value::as_str)
+        .filter(|id| !id.is_empty() && *id != "NOASSERTION")
+        .map(|id| (id.to_string(), GITHUB_DETECTION_CONFIDENCE))
+}
+
+/// Classify the raw license files of a GitHub repository, without the API
+fn github_raw_license(owner: &str, name: &str, revision: &str) -> Option<(String, f32)> {
+    let revision = if revision.is_empty() {
+        "HEAD"
+    } else {
+        revision
+    };
+
+    for file in LICENSE_FILES {
+        let url = format!("{GITHUB_RAW_URL}/{owner}/{name}/{revision}/{file}");
+        log(LogLevel::Info, &format!("Fetching license file: {url}"));
+
+        let Ok(response) = registry::get(Registry::GitHub, &url) else {
+            continue;
+        };
+        if !response.status().is_success() {
+            continue;
+        }
+        if let Some(detected) = response.text().ok().and_then(|t| classify_license_text(&t)) {
+            return Some((detected.license, detected.confidence));
+        }
+    }
+
+    None
+}
+
+fn gitlab_license(host: &str, path: &str, revision: &str) -> Option<(String, f32)> {
+    let revision = if revision.is_empty() {
+        "HEAD"
+    } else {
+        revision
+    };
+    let project = url_encode(path);
+
+    for file in LICENSE_FILES {
+        if !api_available(Registry::GitLab) {
+            return None;
+        }
+        let url = format!(
+            "https://{host}/api/v4/projects/{project}/repository/files/{file}/raw?ref={}",
+            url_encode(revision)
+        );
+        let response = match conditional_get(Registry::GitLab, &url, revision, gitlab_token()) {
+            Conditional::Cached(CachedResponse {
+                license: Some(license),
+                ..
+            }) => return Some(license),
+            Conditional::Cached(_) | Conditional::Failed => continue,
+            Conditional::Response(response) => response,
+        };
+        if !response.status().is_success() {
+            continue;
+        }
+
+        let etag = etag(&response);
+        let license = response
+            .text()
+            .ok()
+            .and_then(|text| classify_license_text(&text))
+            .map(|detected| (detected.license, detected.confidence));
+        remember(&url, etag, license.clone());
+        if license.is_some() {
+            return license;
+        }
+    }
+
+    None
+}
+
+fn cached_fetch(entry: CachedResponse) -> Fetch {
+    match entry.license {
+        Some(license) => Fetch::Found(license),
+        None => Fetch::Missing,
+    }
+}
+
+/// Outcome of a request revalidated against the response cache
+enum Conditional {
+    /// The cached response is still valid
+    Cached(CachedResponse),
+    Response(reqwest::blocking::Response),
+    Failed,
+}
+
+/// GET `url`, sending the cached `ETag` and recording the rate limit headers
+///
+/// A cached response for a full commit hash is returned without a request.
+fn conditional_get(
+    registry: Registry,
+    url: &str,
+    revision: &str,
+    token: Option<&str>,
+) -> Conditional {
+    let cached = cached_response(url);
+    if let Some(entry) = cached.clone().filter(|_| is_commit_hash(revision)) {
+        log(
+            LogLevel::Info,
+            &format!("Using cached repository license for {url}"),
+        );
+        return Conditional::Cached(entry);
+    }
+
+    log(LogLevel::Info, &format!("Fetching license file: {url}"));
+    let etag = cached.as_ref().and_then(|entry| entry.etag.clone());
+    let result = registry::send(registry, |client| {
+        let mut request = client.get(url);
+        if registry == Registry::GitHub {
+            request = request.header(reqwest::header::ACCEPT, "application/vnd.github+json");
+        }
+        if let Some(etag) = &etag {
+            request = request.header(reqwest::header::IF_NONE_MATCH, etag);
+        }
+        match token {
+            Some(token) => request.bearer_auth(token),
+            None => request,
+        }
+    });
+    let response = match result {
+        Ok(response) => response,
+        Err(err) => {
+            log_error(&format!("Failed to fetch {url}"), &err);
+            return Conditional::Failed;
+        }
+    };
+
+    record_rate_limit(registry, response.headers());
+    let status = response.status();
+    if status == reqwest::StatusCode::NOT_MODIFIED {
+        if let Some(entry) = cached {
+            log(
+                LogLevel::Info,
+                &format!("Repository license for {url} is unchanged"),
+            );
+            return Conditional::Cached(entry);
+        }
+    }
+    if is_rate_limited(&response) {
+        log(
+            LogLevel::Warn,
+            &format!("{} rate limit reached fetching {url}", registry.label()),
+        );
+        return Conditional::Failed;
+    }
+    Conditional::Response(response)
+}
+
+fn is_commit_hash(revision: &str) -> bool {
+    revision.len() == 40 && revision.chars().all(|c| c.is_ascii_hexdigit())
+}
+
+fn etag(response: &reqwest::blocking::Response) -> Option<String> {
+    response
+        .headers()
+        .get(reqwest::header::ETAG)?
+        .to_str()
+        .ok()
+        .map(str::to_string)
+}
+
+/// Percent-encode everything but unreserved characters, as GitLab wants for project paths
+fn url_encode(value: &str) -> String {
+    value
+        .bytes()
+        .map(|byte| match byte {
+            b'A'..=b'Z' | b'a'..=b'z' | b'0'..=b'9' | b'-' | b'_' | b'.' | b'~' => {
+                (byte as char).to_string()
+            }
+            _ => format!("%{byte:02X}"),
+        })
+        .collect()
+}
+
+/// What the last response said about the rate limit of an API
+#[derive(Debug, Clone, Copy, PartialEq)]
+struct RateLimit {
+    remaining: u64,
+    /// When the limit resets, in seconds since the Unix epoch
+    reset: u64,
+    /// Whether the fallback for an exhausted limit has been logged
+    warned: bool,
+}
+
+fn now_secs() -> u64 {
+    SystemTime::now()
+        .duration_since(SystemTime::UNIX_EPOCH)
+        .map(|elapsed| elapsed.as_secs())
+        .unwrap_or_default()
+}
+
+/// Read `x-ratelimit-*` (GitHub) or `ratelimit-*` (GitLab) headers
+fn rate_limit(headers: &reqwest::header::HeaderMap) -> Option<(u64, u64)> {
+    let number = |names: [&str; 2]| {
+        names.iter().find_map(|name| {
+            headers
+                .get(*name)?
+                .to_str()
+                .ok()?
+                .trim()
+                .parse::<u64>()
+                .ok()
+        })
+    };
+    Some((
+        number(["x-ratelimit-remaining", "ratelimit-remaining"])?,
+        number(["x-ratelimit-reset", "ratelimit-reset"])?,
+    ))
+}
+
+fn record_rate_limit(registry: Registry, headers: &reqwest::header::HeaderMap) {
+    let Some((remaining, reset)) = rate_limit(headers) else {
+        return;
+    };
+    let limits = RATE_LIMITS.get_or_init(|| Mutex::new(HashMap::new()));
+    if let Ok(mut limits) = limits.lock() {
+        let warned = limits.get(&registry).is_some_and(|limit| limit.warned);
+        limits.insert(
+            registry,
+            RateLimit {
+                remaining,
+                reset,
+                warned: warned && remaining == 0,
+            },
+        );
+    }
+}
+
+/// A 403 or 429 caused by the rate limit rather than by permissions
+fn is_rate_limited(response: &reqwest::blocking::Response) -> bool {
+    let status = response.status();
+    (status == reqwest::StatusCode::FORBIDDEN || status == reqwest::StatusCode::TOO_MANY_REQUESTS)
+        && rate_limit(response.headers()).is_some_and(|(remaining, _)| remaining == 0)
+}
+
+/// Whether the API can be asked, waiting for a rate limit that resets soon
+fn api_available(registry: Registry) -> bool {
+    let limits = RATE_LIMITS.get_or_init(|| Mutex::new(HashMap::new()));
+    let wait = {
+        let Ok(mut limits) = limits.lock() else {
+            return true;
+        };
+        let Some(limit) = limits.get_mut(&registry) else {
+            return true;
+        };
+        let now = now_secs();
+        if limit.remaining > 0 || limit.reset <= now {
+            return true;
+        }
+        let wait = Duration::from_secs(limit.reset - now);
+        if wait > MAX_RATE_LIMIT_WAIT {
+            if !limit.warned {
+                limit.warned = true;
+                let hint = match registry {
+                    Registry::GitHub => ", set GITHUB_TOKEN for a higher limit",
+                    _ => ", set GITLAB_TOKEN for a higher limit",
+                };
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "{} API rate limit used up for another {}s{hint}",
+                        registry.label(),
+                        wait.as_secs()
+                    ),
+                );
+            }
+            return false;
+        }
+        // Other threads wait for the same reset
+        limit.remaining = 1;
+        wait
+    };
+
+    log(
+        LogLevel::Info,
+        &format!(
+            "Waiting {}s for the {} API rate limit to reset",
+            wait.as_secs(),
+            registry.label()
+        ),
+    );
+    sleep(wait);
+    true
+}
+
+/// License found in a response, keyed by request URL
+#[derive(Debug, Default, Serialize, Deserialize)]
+struct ResponseCache {
+    #[serde(default)]
+    version: u32,
+    #[serde(default)]
+    entries: HashMap<String, CachedResponse>,
+    #[serde(skip)]
+    dirty: bool,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+struct CachedResponse {
+    etag: Option<String>,
+    license: Option<(String, f32)>,
+    timestamp: u64,
+}
+
+fn response_cache() -> &'static Mutex<ResponseCache> {
+    RESPONSE_CACHE.get_or_init(|| {
+        let cache = cache_dir_path()
+            .ok()
+            .and_then(|dir| fs::read_to_string(dir.join(RESPONSE_CACHE_FILE)).ok())
+            .and_then(|content| serde_json::from_str::<ResponseCache>(&content).ok())
+            .filter(|cache| cache.version == RESPONSE_CACHE_VERSION)
+            .unwrap_or_default();
+        Mutex::new(cache)
+    })
+}
+
+fn cached_response(url: &str) -> Option<CachedResponse> {
+    if crate::cache::is_refresh() {
+        return None;
+    }
+    response_cache().lock().ok()?.entries.get(url).cloned()
+}
+
+fn remember(url: &str, etag: Option<String>, license: Option<(String, f32)>) {
+    // Without an ETag or a fixed revision the response cannot be revalidated
+    if etag.is_none() && !url.split("ref=").nth(1).is_some_and(is_commit_hash) {
+        return;
+    }
+    if let Ok(mut cache) = response_cache().lock() {
+        cache.entries.insert(
+            url.to_string(),
+            CachedResponse {
+                etag,
+                license,
+                timestamp: now_secs(),
+            },
+        );
+        cache.dirty = true;
+    }
+}
+
+/// Write the repository responses back to the cache directory if anything changed
+pub fn save_response_cache() -> FeludaResult<()> {
+    let Some(cache) = RESPONSE_CACHE.get() else {
+        return Ok(());
+    };
+    let Ok(mut cache) = cache.lock() else {
+        return Ok(());
+    };
+    if !cache.dirty {
+        return Ok(());
+    }
+
+    cache.version = RESPONSE_CACHE_VERSION;
+    let dir = cache_dir_path()?;
+    fs::create_dir_all(&dir)?;
+    let content = serde_json::to_string(&*cache).map_err(|e| {
+        crate::debug::FeludaError::Serialization(format!(
+            "Failed to serialize repository licenses: {e}"
+        ))
+    })?;
+    fs::write(dir.join(RESPONSE_CACHE_FILE), content)?;
+    cache.dirty = false;
+    Ok(())
+}
+
+/// Forget the cached repository responses, for `feluda cache --clear`
+pub fn clear_response_cache() -> FeludaResult<()> {
+    let path = cache_dir_path()?.join(RESPONSE_CACHE_FILE);
+    if path.exists() {
+        fs::remove_file(&path)
+            .inspect_err(|e| log_error("Failed to clear repository license cache", e))?;
+        log(LogLevel::Info, "Cleared repository license cache");
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use reqwest::header::{HeaderMap, HeaderValue};
+
+    #[test]
+    fn test_parse_repository() {
+        let github = |owner: &str, name: &str| Repository::GitHub {
+            owner: owner.to_string(),
+            name: name.to_string(),
+        };
+        assert_eq!(
+            Repository::parse("https://github.com/rails/rails.git"),
+            Some(github("rails", "rails"))
+        );
+        assert_eq!(
+            Repository::parse("git@github.com:rack/rack"),
+            Some(github("rack", "rack"))
+        );
+        assert_eq!(
+            Repository::parse("git+https://github.com/apple/swift-nio/tree/main"),
+            Some(github("apple", "swift-nio"))
+        );
+        assert_eq!(
+            Repository::parse("https://gitlab.com/foo/bar.git"),
+            Some(Repository::GitLab {
+                host: "gitlab.com".to_string(),
+                path: "foo/bar".to_string(),
+            })
+        );
+        assert_eq!(
+            Repository::parse("ssh://git@gitlab.example.com:2222/group/sub/project.git"),
+            Some(Repository::GitLab {
+                host: "gitlab.example.com".to_string(),
+                path: "group/sub/project".to_string(),
+            })
+        );
+        assert_eq!(
+            Repository::parse("https://gitlab.com/group/project/-/tree/main"),
+            Some(Repository::GitLab {
+                host: "gitlab.com".to_string(),
+                path: "group/project".to_string(),
+            })
+        );
+        assert_eq!(
+            Repository::parse("https://github.com/org/project@v1.2.0"),
+            Some(github("org", "project@v1.2.0"))
+        );
+        assert_eq!(Repository::parse("https://github.com/rails"), None);
+        assert_eq!(Repository::parse("https://bitbucket.org/foo/bar"), None);
+    }
+
+    #[test]
+    fn test_github_license_from_body() {
+        let mit = "MIT License\n\nCopyright (c) 2024 Example\n\nPermission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the \"Software\"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:\n\nThe above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.\n\nTHE SOFTWARE IS PROVIDED \"AS IS\", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.\n";
+        // GitHub wraps the base64 content every 60 characters
+        let encoded = base64_encode(mit.as_bytes())
+            .as_bytes()
+            .chunks(60)
+            .map(|chunk| String::from_utf8_lossy(chunk).into_owned())
+            .collect::<Vec<_>>()
+            .join("\n");
+        let body = serde_json::json!({
+            "content": encoded,
+            "encoding": "base64",
+            "license": { "spdx_id": "MIT" }
+        });
+        let (license, _) = github_license_from_body(&body).unwrap();
+        assert_eq!(license, "MIT");
+
+        let body = serde_json::json!({
+            "content": base64_encode(b"Custom terms"),
+            "license": { "spdx_id": "Apache-2.0" }
+        });
+        assert_eq!(
+            github_license_from_body(&body),
+            Some(("Apache-2.0".to_string(), GITHUB_DETECTION_CONFIDENCE))
+        );
+
+        let body = serde_json::json!({ "license": { "spdx_id": "NOASSERTION" } });
+        assert_eq!(github_license_from_body(&body), None);
+    }
+
+    #[test]
+    fn test_rate_limit_headers() {
+        let mut headers = HeaderMap::new();
+        assert_eq!(rate_limit(&headers), None);
+
+        headers.insert("x-ratelimit-remaining", HeaderValue::from_static("0"));
+        headers.insert("x-ratelimit-reset", HeaderValue::from_static("1735689600"));
+        assert_eq!(rate_limit(&headers), Some((0, 1735689600)));
+
+        let mut headers = HeaderMap::new();
+        headers.insert("RateLimit-Remaining", HeaderValue::from_static("1999"));
+        headers.insert("RateLimit-Reset", HeaderValue::from_static("1735689600"));
+        assert_eq!(rate_limit(&headers), Some((1999, 1735689600)));
+
+        assert!(is_commit_hash("1f0262aa2b0ab5bd12346d4e5e3ea8d5e5b1a1c9"));
+        assert!(!is_commit_hash("v1.2.0"));
+        assert_eq!(url_encode("group/sub project"), "group%2Fsub%20project");
+    }
+
+    fn base64_encode(bytes: &[u8]) -> String {
+        const ALPHABET: &[u8] = b"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+        let mut encoded = String::new();
+        for chunk in bytes.chunks(3) {
+            let n = chunk
+                .iter()
+                .enumerate()
+                .fold(0u32, |n, (i, b)| n | u32::from(*b) << (16 - 8 * i));
+            for i in 0..=chunk.len() {
+                encoded.push(ALPHABET[(n >> (18 - 6 * i)) as usize & 63] as char);
+            }
+        }
+        encoded.push_str(&"=".repeat((3 - bytes.len() % 3) % 3));
+        encoded
+    }
+}
@@ -0,0 +1,881 @@
+//! REUSE compliance of the project itself (`feluda reuse`)
+//!
+//! The [REUSE specification](https://reuse.software/spec-3.3/) asks that
+//! every file of a project states its copyright and license, and that the
+//! text of every license used is in `LICENSES/<identifier>.txt`. A file gets
+//! this information from `SPDX-FileCopyrightText` (or `Copyright`) and
+//! `SPDX-License-Identifier` tags in its comments, from an adjacent
+//! `<file>.license`, or from an annotation in `REUSE.toml` or the older
+//! `.reuse/dep5`. Text between `REUSE-IgnoreStart` and `REUSE-IgnoreEnd` is
+//! not read.
+//!
+//! Files ignored by `.gitignore`, the `.git`, `LICENSES` and `.reuse`
+//! directories, license files such as `LICENSE` or `COPYING` and empty files
+//! are not covered. Only the `REUSE.toml` at the project root is read.
+//!
+//! With `--generate`, the files lacking information are annotated with the
+//! project license and copyright, and missing license texts are downloaded
+//! from the SPDX license list into `LICENSES/`.
+
+use colored::*;
+use ignore::WalkBuilder;
+use regex::Regex;
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeSet;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process;
+use std::sync::OnceLock;
+
+use crate::cli::ReuseFormat;
+use crate::config::load_config;
+use crate::copyright::extract_copyright_lines;
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::diff::print_table;
+use crate::license_expression::LicenseExpression;
+use crate::license_text::{license_text, LicenseTextTarget};
+use crate::licenses::detect_project_license;
+
+const REUSE_TOML: &str = "REUSE.toml";
+const DEP5: &str = ".reuse/dep5";
+const LICENSES_DIR: &str = "LICENSES";
+const DEP5_FORMAT: &str = "https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/";
+
+/// How an annotation combines with the information in the files it covers
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+enum Precedence {
+    /// Information in the file wins, the annotation fills in what is missing
+    #[default]
+    Closest,
+    /// Information of the file and the annotation add up
+    Aggregate,
+    /// Only the annotation counts, the file isn't read
+    Override,
+}
+
+#[derive(Debug, Deserialize)]
+#[serde(untagged)]
+enum OneOrMany {
+    One(String),
+    Many(Vec<String>),
+}
+
+impl OneOrMany {
+    fn into_vec(self) -> Vec<String> {
+        match self {
+            OneOrMany::One(value) => vec![value],
+            OneOrMany::Many(values) => values,
+        }
+    }
+}
+
+#[derive(Debug, Deserialize)]
+struct ReuseToml {
+    #[serde(default)]
+    annotations: Vec<TomlAnnotation>,
+}
+
+#[derive(Debug, Deserialize)]
+struct TomlAnnotation {
+    path: OneOrMany,
+    #[serde(default)]
+    precedence: Precedence,
+    #[serde(rename = "SPDX-FileCopyrightText")]
+    copyright: Option<OneOrMany>,
+    #[serde(rename = "SPDX-License-Identifier")]
+    license: Option<OneOrMany>,
+}
+
+/// Copyright and licensing information of a file
+#[derive(Debug, Clone, Default, PartialEq)]
+struct ReuseInfo {
+    copyrights: Vec<String>,
+    licenses: Vec<String>,
+}
+
+/// Information a `REUSE.toml` annotation or a dep5 paragraph gives the files it matches
+#[derive(Debug)]
+struct Annotation {
+    patterns: Vec<Regex>,
+    precedence: Precedence,
+    info: ReuseInfo,
+}
+
+impl Annotation {
+    fn matches(&self, path: &str) -> bool {
+        self.patterns.iter().any(|pattern| pattern.is_match(path))
+    }
+}
+
+/// A license expression that doesn't parse
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct InvalidLicense {
+    pub path: PathBuf,
+    pub license: String,
+}
+
+/// Result of checking a project against the REUSE specification
+#[derive(Debug, Clone, Default, PartialEq, Serialize)]
+pub struct ReuseReport {
+    /// Number of files the specification covers
+    pub files: usize,
+    /// Files without copyright information, relative to the project directory
+    pub missing_copyright: Vec<PathBuf>,
+    /// Files without licensing information
+    pub missing_license: Vec<PathBuf>,
+    pub invalid_licenses: Vec<InvalidLicense>,
+    /// Licenses in use without a text in `LICENSES/`
+    pub missing_license_texts: Vec<String>,
+    /// Texts in `LICENSES/` of licenses no file uses
+    pub unused_license_texts: Vec<String>,
+}
+
+impl ReuseReport {
+    pub fn is_compliant(&self) -> bool {
+        self.missing_copyright.is_empty()
+            && self.missing_license.is_empty()
+            && self.invalid_licenses.is_empty()
+            && self.missing_license_texts.is_empty()
+            && self.unused_license_texts.is_empty()
+    }
+
+    /// Files missing copyright or licensing information, or both
+    fn incomplete_files(&self) -> BTreeSet<&PathBuf> {
+        self.missing_copyright
+            .iter()
+            .chain(&self.missing_license)
+            .collect()
+    }
+}
+
+fn license_tag_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| {
+        Regex::new(r#"SPDX-License-Identifier:\s*([^\r\n]+?)\s*(?:\*/|-->|\*\)|"|$)"#)
+            .expect("valid SPDX tag pattern")
+    })
+}
+
+fn copyright_tag_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| {
+        Regex::new(
+            r#"(?:^|[^\w-])(SPDX-(?:File|Snippet)CopyrightText:|Copyright\s|©)\s*([^\r\n]+?)\s*(?:\*/|-->|\*\)|"|$)"#,
+        )
+        .expect("valid copyright tag pattern")
+    })
+}
+
+/// Copyright and license tags in the text of a file
+fn extract_info(text: &str) -> ReuseInfo {
+    let mut info = ReuseInfo::default();
+    let mut ignoring = false;
+    for line in text.lines() {
+        if line.contains("REUSE-IgnoreStart") {
+            ignoring = true;
+        }
+        if !ignoring {
+            if let Some(captures) = license_tag_pattern().captures(line) {
+                info.licenses.push(captures[1].trim().to_string());
+            } else if let Some(captures) = copyright_tag_pattern().captures(line) {
+                info.copyrights
+                    .push(format!("{} {}", captures[1].trim(), &captures[2]));
+            }
+        }
+        if line.contains("REUSE-IgnoreEnd") {
+            ignoring = false;
+        }
+    }
+    info
+}
+
+/// Information in a file, or in its `.license` file when there is one
+///
+/// Binary files can only get theirs from a `.license` file or an annotation.
+fn file_info(path: &Path) -> ReuseInfo {
+    let mut sidecar = path.as_os_str().to_owned();
+    sidecar.push(".license");
+    let sidecar = PathBuf::from(sidecar);
+    let source = if sidecar.is_file() {
+        sidecar.as_path()
+    } else {
+        path
+    };
+    fs::read(source)
+        .ok()
+        .and_then(|bytes| String::from_utf8(bytes).ok())
+        .map(|text| extract_info(&text))
+        .unwrap_or_default()
+}
+
+/// Regex for a `REUSE.toml` path, where `*` stays within a directory, or a
+/// dep5 pattern, where it doesn't
+fn glob_regex(pattern: &str, dep5: bool) -> Option<Regex> {
+    let mut regex = String::from("^");
+    let mut chars = pattern.trim_start_matches("./").chars().peekable();
+    while let Some(c) = chars.next() {
+        match c {
+            '\\' if !dep5 => {
+                if let Some(escaped) = chars.next() {
+                    regex.push_str(&regex::escape(&escaped.to_string()));
+                }
+            }
+            '*' if dep5 => regex.push_str(".*"),
+            '*' if chars.peek() == Some(&'*') => {
+                chars.next();
+                regex.push_str(".*");
+            }
+            '*' => regex.push_str("[^/]*"),
+            '?' if dep5 => regex.push('.'),
+            _ => regex.push_str(&regex::escape(&c.to_string())),
+        }
+    }
+    regex.push('$');
+    Regex::new(&regex).ok()
+}
+
+fn parse_reuse_toml(content: &str) -> FeludaResult<Vec<Annotation>> {
+    let reuse: ReuseToml = toml::from_str(content)
+        .map_err(|e| FeludaError::Config(format!("Invalid {REUSE_TOML}: {e}")))?;
+    Ok(reuse
+        .annotations
+        .into_iter()
+        .map(|annotation| Annotation {
+            patterns: annotation
+                .path
+                .into_vec()
+                .iter()
+                .filter_map(|path| glob_regex(path, false))
+                .collect(),
+            precedence: annotation.precedence,
+            info: ReuseInfo {
+                copyrights: annotation
+                    .copyright
+                    .map(OneOrMany::into_vec)
+                    .unwrap_or_default(),
+                licenses: annotation
+                    .license
+                    .map(OneOrMany::into_vec)
+                    .unwrap_or_default(),
+            },
+        })
+        .collect())
+}
+
+/// `Files` paragraphs of a Debian copyright file
+///
+/// Continuation lines of the `Copyright` field each hold a copyright, the
+/// first line of the `License` field is the license expression.
+fn parse_dep5(content: &str) -> Vec<Annotation> {
+    let mut annotations = Vec::new();
+    for paragraph in content.split("\n\n") {
+        let mut files = Vec::new();
+        let mut info = ReuseInfo::default();
+        let mut field = "";
+        for line in paragraph.lines() {
+            if let Some(continuation) = line.strip_prefix([' ', '\t']) {
+                let value = continuation.trim();
+                match field {
+                    "Files" => files.extend(value.split_whitespace().map(str::to_string)),
+                    "Copyright" if !value.is_empty() => info.copyrights.push(value.to_string()),
+                    _ => {}
+                }
+                continue;
+            }
+            let Some((name, value)) = line.split_once(':') else {
+                continue;
+            };
+            field = name.trim();
+            let value = value.trim();
+            match field {
+                "Files" => files.extend(value.split_whitespace().map(str::to_string)),
+                "Copyright" if !value.is_empty() => info.copyrights.push(value.to_string()),
+                "License" if !value.is_empty() => info.licenses.push(value.to_string()),
+                _ => {}
+            }
+        }
+        if !files.is_empty() {
+            annotations.push(Annotation {
+                patterns: files
+                    .iter()
+                    .filter_map(|pattern| glob_regex(pattern, true))
+                    .collect(),
+                precedence: Precedence::Aggregate,
+                info,
+            });
+        }
+    }
+    annotations
+}
+
+/// Annotations of the project, `REUSE.toml` taking precedence over `.reuse/dep5`
+fn read_annotations(root: &Path) -> FeludaResult<Vec<Annotation>> {
+    if let Ok(content) = fs::read_to_string(root.join(REUSE_TOML)) {
+        return parse_reuse_toml(&content);
+    }
+    Ok(fs::read_to_string(root.join(DEP5))
+        .map(|content| parse_dep5(&content))
+        .unwrap_or_default())
+}
+
+/// License files and REUSE metadata the specification doesn't cover
+fn is_exempt_file(name: &str) -> bool {
+    let exempt_prefix = |prefix: &str| {
+        name.strip_prefix(prefix)
+            .is_some_and(|rest| rest.is_empty() || rest.starts_with(['.', '-']))
+    };
+    exempt_prefix("LICENSE")
+        || exempt_prefix("LICENCE")
+        || exempt_prefix("COPYING")
+        || name.ends_with(".license")
+        || name == REUSE_TOML
+        || name.ends_with(".spdx")
+}
+
+/// Files below `root` the specification covers, relative to it
+fn covered_files(root: &Path) -> Vec<PathBuf> {
+    let root_owned = root.to_path_buf();
+    let mut files: Vec<PathBuf> = WalkBuilder::new(root)
+        .hidden(false)
+        .filter_entry(move |entry| {
+            let name = entry.file_name().to_str().unwrap_or_default();
+            let is_dir = entry
+                .file_type()
+                .is_some_and(|file_type| file_type.is_dir());
+            let at_root = entry.path().parent() == Some(root_owned.as_path());
+            !(is_dir && (name == ".git" || (at_root && matches!(name, LICENSES_DIR | ".reuse"))))
+        })
+        .build()
+        .flatten()
+        .filter(|entry| entry.file_type().is_some_and(|t| t.is_file()))
+        .filter(|entry| {
+            !is_exempt_file(entry.file_name().to_str().unwrap_or_default())
+                && fs::metadata(entry.path()).is_ok_and(|metadata| metadata.len() > 0)
+        })
+        .map(|entry| {
+            entry
+                .path()
+                .strip_prefix(root)
+                .unwrap_or(entry.path())
+                .to_path_buf()
+        })
+        .collect();
+    files.sort();
+    files
+}
+
+/// Information of a file after applying the annotation covering it
+fn resolve_info(root: &Path, path: &Path, annotation: Option<&Annotation>) -> ReuseInfo {
+    let Some(annotation) = annotation else {
+        return file_info(&root.join(path));
+    };
+    if annotation.precedence == Precedence::Override {
+        return annotation.info.clone();
+    }
+
+    let mut info = file_info(&root.join(path));
+    let aggregate = annotation.precedence == Precedence::Aggregate;
+    if aggregate || info.copyrights.is_empty() {
+        info.copyrights
+            .extend(annotation.info.copyrights.iter().cloned());
+    }
+    if aggregate || info.licenses.is_empty() {
+        info.licenses
+            .extend(annotation.info.licenses.iter().cloned());
+    }
+    info
+}
+
+/// Identifiers of the license texts in `LICENSES/`
+fn license_text_ids(root: &Path) -> BTreeSet<String> {
+    fs::read_dir(root.join(LICENSES_DIR))
+        .map(|entries| {
+            entries
+                .flatten()
+                .filter(|entry| entry.path().is_file())
+                .filter_map(|entry| {
+                    entry
+                        .path()
+                        .file_stem()
+                        .and_then(|stem| stem.to_str())
+                        .map(str::to_string)
+                })
+                .collect()
+        })
+        .unwrap_or_default()
+}
+
+/// Check the project in `root` against the REUSE specification
+pub fn check_reuse(root: &Path) -> FeludaResult<ReuseReport> {
+    let annotations = read_annotations(root)?;
+    let files = covered_files(root);
+    log(
+        LogLevel::Info,
+        &format!(
+            "Checking {} files in {} against the REUSE specification ({} annotations)",
+            files.len(),
+            root.display(),
+            annotations.len()
+        ),
+    );
+
+    let mut report = ReuseReport {
+        files: files.len(),
+        ..ReuseReport::default()
+    };
+    let mut used = BTreeSet::new();
+    for path in files {
+        let key = path.to_string_lossy().replace('\\', "/");
+        // Later annotations take precedence over earlier ones
+        let annotation = annotations.iter().rev().find(|a| a.matches(&key));
+        let info = resolve_info(root, &path, annotation);
+
+        for license in &info.licenses {
+            match LicenseExpression::parse(license) {
+                Ok(expression) => {
+                    for term in expression.terms() {
+                        used.insert(term.id.clone());
+                        used.extend(term.exception.clone());
+                    }
+                }
+                Err(_) => report.invalid_licenses.push(InvalidLicense {
+                    path: path.clone(),
+                    license: license.clone(),
+                }),
+            }
+        }
+        if info.copyrights.is_empty() {
+            report.missing_copyright.push(path.clone());
+        }
+        if info.licenses.is_empty() {
+            report.missing_license.push(path);
+        }
+    }
+
+    let texts = license_text_ids(root);
+    report.missing_license_texts = used.difference(&texts).cloned().collect();
+    report.unused_license_texts = texts.difference(&used).cloned().collect();
+    Ok(report)
+}
+
+/// Print what keeps the project from being REUSE compliant
+pub fn print_reuse_report(report: &ReuseReport) {
+    let status = if report.is_compliant() {
+        "compliant".green().bold()
+    } else {
+        "not compliant".red().bold()
+    };
+    println!(
+        "\n{} {} files checked, {} without copyright, {} without license: {}\n",
+        "REUSE:".bold(),
+        report.files,
+        report.missing_copyright.len(),
+        report.missing_license.len(),
+        status
+    );
+
+    let incomplete = report.incomplete_files();
+    if !incomplete.is_empty() {
+        let yes_no = |missing: &[PathBuf], path: &PathBuf| {
+            if missing.contains(path) {
+                "missing"
+            } else {
+                "ok"
+            }
+            .to_string()
+        };
+        let rows: Vec<_> = incomplete
+            .iter()
+            .map(|path| {
+                (
+                    vec![
+                        path.display().to_string(),
+                        yes_no(&report.missing_copyright, path),
+                        yes_no(&report.missing_license, path),
+                    ],
+                    true,
+                )
+            })
+            .collect();
+        print_table(
+            "Files without REUSE information",
+            &["File", "Copyright", "License"],
+            &rows,
+        );
+    }
+
+    if !report.invalid_licenses.is_empty() {
+        let rows: Vec<_> = report
+            .invalid_licenses
+            .iter()
+            .map(|invalid| {
+                (
+                    vec![invalid.path.display().to_string(), invalid.license.clone()],
+                    true,
+                )
+            })
+            .collect();
+        print_table("Invalid license expressions", &["File", "License"], &rows);
+    }
+
+    let texts: Vec<_> = report
+        .missing_license_texts
+        .iter()
+        .map(|id| {
+            (
+                vec![id.clone(), format!("add {LICENSES_DIR}/{id}.txt")],
+                true,
+            )
+        })
+        .chain(report.unused_license_texts.iter().map(|id| {
+            (
+                vec![id.clone(), format!("remove {LICENSES_DIR}/{id}.txt")],
+                true,
+            )
+        }))
+        .collect();
+    if !texts.is_empty() {
+        print_table("License texts", &["License", "Fix"], &texts);
+    }
+}
+
+fn toml_string(value: &str) -> String {
+    // JSON string escapes are valid in TOML basic strings
+    serde_json::to_string(value).unwrap_or_else(|_| format!("\"{value}\""))
+}
+
+/// `REUSE.toml` annotation covering `files`
+fn toml_annotation(files: &[String], license: &str, copyright: &str) -> String {
+    let paths: Vec<String> = files
+        .iter()
+        .map(|file| format!("    {},", toml_string(&file.replace('*', "\\*"))))
+        .collect();
+    format!(
+        "[[annotations]]\npath = [\n{}\n]\nSPDX-FileCopyrightText = {}\nSPDX-License-Identifier = {}\n",
+        paths.join("\n"),
+        toml_string(copyright),
+        toml_string(license)
+    )
+}
+
+/// dep5 paragraph covering `files`
+fn dep5_paragraph(files: &[String], license: &str, copyright: &str) -> String {
+    format!(
+        "Files: {}\nCopyright: {copyright}\nLicense: {license}\n",
+        files.join("\n "),
+    )
+}
+
+/// Append `section` to the file at `path`, starting it with `header` if it's new
+fn append_section(path: &Path, header: &str, section: &str) -> FeludaResult<()> {
+    let existing = fs::read_to_string(path).unwrap_or_default();
+    let content = if existing.trim().is_empty() {
+        format!("{header}\n{section}")
+    } else {
+        format!("{}\n\n{section}", existing.trim_end())
+    };
+    if let Some(parent) = path.parent() {
+        fs::create_dir_all(parent)?;
+    }
+    fs::write(path, content)
+        .map_err(|e| FeludaError::FileWrite(format!("Failed to write {}: {e}", path.display())))
+}
+
+/// Annotate the files lacking REUSE information and download missing license texts
+///
+/// Returns the number of files annotated.
+pub fn generate_reuse_info(
+    root: &Path,
+    report: &ReuseReport,
+    format: ReuseFormat,
+    license: &str,
+    copyright: &str,
+) -> FeludaResult<usize> {
+    LicenseExpression::parse(license)
+        .map_err(|e| FeludaError::License(format!("Invalid project license '{license}': {e}")))?;
+
+    let files: Vec<String> = report
+        .incomplete_files()
+        .iter()
+        .map(|path| path.to_string_lossy().replace('\\', "/"))
+        .collect();
+    if !files.is_empty() {
+        let written = match format {
+            ReuseFormat::Toml => {
+                append_section(
+                    &root.join(REUSE_TOML),
+                    "version = 1\n",
+                    &toml_annotation(&files, license, copyright),
+                )?;
+                REUSE_TOML
+            }
+            ReuseFormat::Dep5 => {
+                let name = root
+                    .canonicalize()
+                    .ok()
+                    .and_then(|dir| dir.file_name().map(|n| n.to_string_lossy().to_string()))
+                    .unwrap_or_default();
+                append_section(
+                    &root.join(DEP5),
+                    &format!("Format: {DEP5_FORMAT}\nUpstream-Name: {name}\n"),
+                    &dep5_paragraph(&files, license, copyright),
+                )?;
+                DEP5
+            }
+        };
+        log(
+            LogLevel::Info,
+            &format!("Annotated {} files in {written}", files.len()),
+        );
+    }
+
+    // The license given to the annotated files may be new too
+    let mut missing: BTreeSet<String> = report.missing_license_texts.iter().cloned().collect();
+    if let Ok(expression) = LicenseExpression::parse(license) {
+        for term in expression.terms() {
+            missing.insert(term.id.clone());
+            missing.extend(term.exception.clone());
+        }
+    }
+    let texts = license_text_ids(root);
+    for id in missing.difference(&texts) {
+        if id.starts_with("LicenseRef-") {
+            log(
+                LogLevel::Warn,
+                &format!("Add the text of {id} to {LICENSES_DIR}/{id}.txt yourself"),
+            );
+            continue;
+        }
+        match license_text(&LicenseTextTarget::License(id.clone()), root) {
+            Ok(text) => {
+                let path = root.join(LICENSES_DIR).join(format!("{id}.txt"));
+                fs::create_dir_all(root.join(LICENSES_DIR))?;
+                fs::write(&path, text.text).map_err(|e| {
+                    FeludaError::FileWrite(format!("Failed to write {}: {e}", path.display()))
+                })?;
+                log(LogLevel::Info, &format!("Wrote {}", path.display()));
+            }
+            Err(err) => log_error(&format!("Failed to download the text of {id}"), &err),
+        }
+    }
+    Ok(files.len())
+}
+
+/// Copyright for generated annotations, from the project's LICENSE file
+fn project_copyright(root: &Path) -> Option<String> {
+    ["LICENSE", "LICENSE.txt", "LICENSE.md", "COPYING"]
+        .iter()
+        .filter_map(|name| fs::read_to_string(root.join(name)).ok())
+        .find_map(|text| extract_copyright_lines(&text).into_iter().next())
+}
+
+/// Entry point for the reuse command
+pub fn handle_reuse_command(
+    path: String,
+    json: bool,
+    generate: Option<ReuseFormat>,
+    license: Option<String>,
+    copyright: Option<String>,
+) -> FeludaResult<()> {
+    let root = Path::new(&path);
+    let mut report = check_reuse(root)?;
+
+    if let Some(format) = generate {
+        let config = load_config()?;
+        let license = match license.or_else(|| config.project.license.clone()) {
+            Some(license) => license,
+            None => detect_project_license(&path)?.ok_or_else(|| {
+                FeludaError::License(
+                    "No project license specified or detected, pass --project-license".to_string(),
+                )
+            })?,
+        };
+        let copyright = copyright
+            .or_else(|| project_copyright(root))
+            .ok_or_else(|| {
+                FeludaError::InvalidData(
+                    "No copyright found in the LICENSE file, pass --copyright".to_string(),
+                )
+            })?;
+
+        let annotated = generate_reuse_info(root, &report, format, &license, &copyright)?;
+        if !json {
+            println!("Annotated {annotated} files with {license} and \"{copyright}\"");
+        }
+        report = check_reuse(root)?;
+    }
+
+    if json {
+        let output = serde_json::to_string_pretty(&report).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize REUSE report: {e}"))
+        })?;
+        println!("{output}");
+    } else {
+        print_reuse_report(&report);
+    }
+
+    if !report.is_compliant() {
+        log(
+            LogLevel::Warn,
+            "Project is not REUSE compliant, exiting with status 1",
+        );
+        process::exit(1);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn write(root: &Path, path: &str, content: &str) {
+        let path = root.join(path);
+        fs::create_dir_all(path.parent().unwrap()).unwrap();
+        fs::write(path, content).unwrap();
+    }
+
+    #[test]
+    fn test_extract_info() {
+        let info = extract_info(
+            "// SPDX-FileCopyrightText: 2024 Jane Doe <jane@example.com>\n\
+             /* SPDX-License-Identifier: MIT OR Apache-2.0 */\n\
+             # Copyright (c) 2019 Acme Inc.\n\
+             // REUSE-IgnoreStart\n\
+             let tag = \"SPDX-License-Identifier: GPL-3.0-only\";\n\
+             // REUSE-IgnoreEnd\n",
+        );
+        assert_eq!(info.licenses, vec!["MIT OR Apache-2.0".to_string()]);
+        assert_eq!(
+            info.copyrights,
+            vec![
+                "SPDX-FileCopyrightText: 2024 Jane Doe <jane@example.com>".to_string(),
+                "Copyright (c) 2019 Acme Inc.".to_string(),
+            ]
+        );
+        assert_eq!(extract_info("fn main() {}\n"), ReuseInfo::default());
+    }
+
+    #[test]
+    fn test_glob_regex() {
+        let toml = |pattern| glob_regex(pattern, false).unwrap();
+        assert!(toml("docs/*.png").is_match("docs/logo.png"));
+        assert!(!toml("docs/*.png").is_match("docs/img/logo.png"));
+        assert!(toml("docs/**").is_match("docs/img/logo.png"));
+        assert!(toml("\\*.txt").is_match("*.txt"));
+        assert!(!toml("\\*.txt").is_match("a.txt"));
+        assert!(glob_regex("docs/*", true)
+            .unwrap()
+            .is_match("docs/img/logo.png"));
+    }
+
+    #[test]
+    fn test_parse_dep5() {
+        let annotations = parse_dep5(
+            "Format: https://www.debian.org/doc/packaging-manuals/copyright-format/1.0/\n\
+             Upstream-Name: demo\n\n\
+             Files: assets/* data.json\n\
+             Copyright: 2020 Jane Doe\n 2021 Acme Inc.\n\
+             License: CC-BY-4.0\n",
+        );
+        assert_eq!(annotations.len(), 1);
+        assert!(annotations[0].matches("assets/icons/a.svg"));
+        assert!(annotations[0].matches("data.json"));
+        assert_eq!(
+            annotations[0].info,
+            ReuseInfo {
+                copyrights: vec!["2020 Jane Doe".to_string(), "2021 Acme Inc.".to_string()],
+                licenses: vec!["CC-BY-4.0".to_string()],
+            }
+        );
+    }
+
+    #[test]
+    fn test_check_reuse() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        write(
+            root,
+            "src/main.rs",
+            "// SPDX-FileCopyrightText: 2024 Jane Doe\n// SPDX-License-Identifier: MIT\n",
+        );
+        write(root, "src/lib.rs", "// SPDX-License-Identifier: MIT\n");
+        write(root, "logo.png", "\u{89}PNG");
+        write(
+            root,
+            "logo.png.license",
+            "SPDX-FileCopyrightText: 2024 Jane Doe\nSPDX-License-Identifier: CC0-1.0\n",
+        );
+        write(root, "data/fixture.json", "{}");
+        write(root, "notes.txt", "Some notes");
+        write(root, "LICENSE", "MIT License");
+        write(root, "LICENSES/MIT.txt", "MIT License");
+        write(root, "LICENSES/GPL-3.0-only.txt", "GPL");
+        write(
+            root,
+            "REUSE.toml",
+            r#"version = 1
+
+[[annotations]]
+path = "data/**"
+SPDX-FileCopyrightText = "2024 Jane Doe"
+SPDX-License-Identifier = "MIT AND BSD-3-Clause"
+
+[[annotations]]
+path = "src/lib.rs"
+SPDX-FileCopyrightText = "2024 Jane Doe"
+"#,
+        );
+
+        let report = check_reuse(root).unwrap();
+        assert_eq!(report.files, 5);
+        assert_eq!(report.missing_copyright, vec![PathBuf::from("notes.txt")]);
+        assert_eq!(report.missing_license, vec![PathBuf::from("notes.txt")]);
+        assert_eq!(
+            report.missing_license_texts,
+            vec!["BSD-3-Clause".to_string(), "CC0-1.0".to_string()]
+        );
+        assert_eq!(
+            report.unused_license_texts,
+            vec!["GPL-3.0-only".to_string()]
+        );
+        assert!(!report.is_compliant());
+
+        // Generated annotations cover the files lacking information
+        write(root, "LICENSES/BSD-3-Clause.txt", "BSD");
+        write(root, "LICENSES/CC0-1.0.txt", "CC0");
+        fs::remove_file(root.join("LICENSES/GPL-3.0-only.txt")).unwrap();
+        let annotated =
+            generate_reuse_info(root, &report, ReuseFormat::Toml, "MIT", "2024 Jane Doe").unwrap();
+        assert_eq!(annotated, 1);
+        let report = check_reuse(root).unwrap();
+        assert!(report.is_compliant(), "{report:?}");
+    }
+
+    #[test]
+    fn test_generate_dep5() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        write(root, "config.yml", "key: value\n");
+        write(root, "LICENSES/Apache-2.0.txt", "Apache");
+
+        let report = check_reuse(root).unwrap();
+        assert_eq!(report.missing_license, vec![PathBuf::from("config.yml")]);
+        generate_reuse_info(
+            root,
+            &report,
+            ReuseFormat::Dep5,
+            "Apache-2.0",
+            "2024 Acme Inc.",
+        )
+        .unwrap();
+
+        let dep5 = fs::read_to_string(root.join(DEP5)).unwrap();
+        assert!(dep5.starts_with(&format!("Format: {DEP5_FORMAT}")));
+        assert!(
+            dep5.contains("Files: config.yml\nCopyright: 2024 Acme Inc.\nLicense: Apache-2.0\n")
+        );
+        assert!(check_reuse(root).unwrap().is_compliant());
+    }
+}
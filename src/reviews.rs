@@ -0,0 +1,522 @@
+//! Manual review state carried across scans (`feluda review`)
+//!
+//! Reviewers record a decision for a package at a version: approved, rejected or
+//! needs legal review, with an optional comment. The decisions are kept in
+//! `.feluda-reviews.json` next to the project, meant to be committed, and each
+//! scan merges them into its dependencies. A review applies to the reviewed
+//! version with the reviewed license; when the version or the license changes,
+//! the dependency keeps the earlier review but is marked as changed, so only
+//! unreviewed and changed dependencies need attention (`--unreviewed`).
+
+use chrono::Utc;
+use colored::*;
+use serde::{Deserialize, Serialize};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::LicenseInfo;
+use crate::reporter::TableFormatter;
+use crate::sbom::ingest::parse_purl;
+
+/// Reviews read from the project directory when `--reviews` is not given
+pub const DEFAULT_REVIEWS_FILE: &str = ".feluda-reviews.json";
+
+const REVIEWS_VERSION: u32 = 1;
+
+/// Decision of a reviewer
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize, clap::ValueEnum)]
+#[serde(rename_all = "kebab-case")]
+pub enum ReviewStatus {
+    Approved,
+    Rejected,
+    /// Waiting for the legal team
+    NeedsLegal,
+}
+
+impl ReviewStatus {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            ReviewStatus::Approved => "approved",
+            ReviewStatus::Rejected => "rejected",
+            ReviewStatus::NeedsLegal => "needs-legal",
+        }
+    }
+}
+
+/// A decision recorded in the reviews file, keyed by package and version
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct ReviewEntry {
+    pub name: String,
+    pub version: String,
+    /// License that was reviewed; without one only version changes are noticed
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub license: Option<String>,
+    pub status: ReviewStatus,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub comment: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub reviewer: Option<String>,
+    /// Date of the review (YYYY-MM-DD)
+    pub date: String,
+}
+
+/// The review merged into a scanned dependency
+#[derive(Serialize, Deserialize, Debug, Clone, PartialEq)]
+pub struct Review {
+    pub status: ReviewStatus,
+    /// Version that was reviewed
+    pub version: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub license: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub comment: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub reviewer: Option<String>,
+    pub date: String,
+    /// Whether the version or the license changed since the review
+    #[serde(default, skip_serializing_if = "std::ops::Not::not")]
+    pub changed: bool,
+}
+
+/// Whether a dependency has no review, or changed since its review
+pub fn needs_review(info: &LicenseInfo) -> bool {
+    info.review.as_ref().is_none_or(|review| review.changed)
+}
+
+/// Review decisions for a project
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Reviews {
+    pub version: u32,
+    pub reviews: Vec<ReviewEntry>,
+}
+
+impl Default for Reviews {
+    fn default() -> Self {
+        Self {
+            version: REVIEWS_VERSION,
+            reviews: Vec::new(),
+        }
+    }
+}
+
+impl Reviews {
+    /// Read a reviews file
+    pub fn load(path: &Path) -> FeludaResult<Self> {
+        let content = fs::read_to_string(path).map_err(|e| {
+            FeludaError::FileWrite(format!("Failed to read reviews {}: {e}", path.display()))
+        })?;
+        let reviews: Reviews = serde_json::from_str(&content).map_err(|e| {
+            FeludaError::InvalidData(format!("Invalid reviews {}: {e}", path.display()))
+        })?;
+        if reviews.version != REVIEWS_VERSION {
+            return Err(FeludaError::InvalidData(format!(
+                "Unsupported reviews version {} in {}",
+                reviews.version,
+                path.display()
+            )));
+        }
+        Ok(reviews)
+    }
+
+    /// Write the reviews as pretty-printed JSON, sorted so diffs stay small
+    pub fn save(&mut self, path: &Path) -> FeludaResult<()> {
+        self.reviews
+            .sort_by(|a, b| (&a.name, &a.version).cmp(&(&b.name, &b.version)));
+        let content = serde_json::to_string_pretty(self)
+            .map_err(|e| FeludaError::Serialization(format!("Failed to serialize reviews: {e}")))?;
+        fs::write(path, format!("{content}\n")).map_err(|e| {
+            FeludaError::FileWrite(format!("Failed to write reviews {}: {e}", path.display()))
+        })
+    }
+
+    /// Record a decision, replacing an earlier one for the same package and version
+    pub fn set(&mut self, entry: ReviewEntry) {
+        self.remove(&entry.name, &entry.version);
+        self.reviews.push(entry);
+    }
+
+    /// Remove the decision for a package and version, returning whether there was one
+    pub fn remove(&mut self, name: &str, version: &str) -> bool {
+        let before = self.reviews.len();
+        self.reviews
+            .retain(|entry| !(entry.name == name && entry.version == version));
+        self.reviews.len() != before
+    }
+
+    /// Review that applies to a dependency
+    ///
+    /// The entry for its version is used when there is one; otherwise the most
+    /// recent review of another version, marked as changed.
+    pub fn find(&self, name: &str, version: &str, license: Option<&str>) -> Option<Review> {
+        let exact = self
+            .reviews
+            .iter()
+            .find(|entry| entry.name == name && entry.version == version);
+        let entry = exact.or_else(|| {
+            self.reviews
+                .iter()
+                .filter(|entry| entry.name == name)
+                .max_by(|a, b| a.date.cmp(&b.date))
+        })?;
+
+        let license_changed = entry
+            .license
+            .as_deref()
+            .is_some_and(|reviewed| Some(reviewed) != license);
+        Some(Review {
+            status: entry.status,
+            version: entry.version.clone(),
+            license: entry.license.clone(),
+            comment: entry.comment.clone(),
+            reviewer: entry.reviewer.clone(),
+            date: entry.date.clone(),
+            changed: exact.is_none() || license_changed,
+        })
+    }
+
+    /// Merge the reviews into scanned dependencies, returning how many have a current review
+    pub fn apply(&self, dependencies: &mut [LicenseInfo]) -> usize {
+        for info in dependencies.iter_mut() {
+            info.review = self.find(&info.name, &info.version, info.license.as_deref());
+        }
+        dependencies
+            .iter()
+            .filter(|info| !needs_review(info))
+            .count()
+    }
+}
+
+/// Reviews for a scan: `file` when given, otherwise the default file in the project
+///
+/// A missing default file means no reviews; a missing `file` is an error.
+pub fn find_reviews(project_path: &Path, file: Option<&str>) -> FeludaResult<Option<Reviews>> {
+    let path = match file {
+        Some(file) => PathBuf::from(file),
+        None => {
+            let path = project_path.join(DEFAULT_REVIEWS_FILE);
+            if !path.is_file() {
+                return Ok(None);
+            }
+            path
+        }
+    };
+
+    let reviews = Reviews::load(&path)?;
+    log(
+        LogLevel::Info,
+        &format!(
+            "Using reviews {} with {} decisions",
+            path.display(),
+            reviews.reviews.len()
+        ),
+    );
+    Ok(Some(reviews))
+}
+
+/// Split `name@version` or a package URL into name and version
+///
+/// The last `@` separates the version, so scoped npm packages like
+/// `@babel/core@7.24.0` keep their scope.
+pub fn parse_package(package: &str) -> FeludaResult<(String, String)> {
+    if package.starts_with("pkg:") {
+        let purl = parse_purl(package)
+            .ok_or_else(|| FeludaError::InvalidData(format!("Invalid package URL '{package}'")))?;
+        let version = purl.version.clone().ok_or_else(|| {
+            FeludaError::InvalidData(format!("Package URL '{package}' has no version"))
+        })?;
+        return Ok((purl.package_name(), version));
+    }
+
+    match package.rsplit_once('@') {
+        Some((name, version)) if !name.is_empty() && !version.is_empty() => {
+            Ok((name.to_string(), version.to_string()))
+        }
+        _ => Err(FeludaError::InvalidData(format!(
+            "Expected <name>@<version> or a package URL, got '{package}'"
+        ))),
+    }
+}
+
+fn reviews_path(project_path: &Path, file: Option<String>) -> PathBuf {
+    file.map(PathBuf::from)
+        .unwrap_or_else(|| project_path.join(DEFAULT_REVIEWS_FILE))
+}
+
+/// Entry point for `feluda review set`
+pub fn handle_review_set_command(
+    project_path: &Path,
+    file: Option<String>,
+    package: &str,
+    status: ReviewStatus,
+    license: Option<String>,
+    comment: Option<String>,
+    reviewer: Option<String>,
+) -> FeludaResult<()> {
+    let (name, version) = parse_package(package)?;
+    let path = reviews_path(project_path, file);
+    let mut reviews = if path.is_file() {
+        Reviews::load(&path)?
+    } else {
+        Reviews::default()
+    };
+
+    reviews.set(ReviewEntry {
+        name: name.clone(),
+        version: version.clone(),
+        license,
+        status,
+        comment,
+        reviewer,
+        date: Utc::now().format("%Y-%m-%d").to_string(),
+    });
+    reviews.save(&path)?;
+
+    println!(
+        "✓ Marked {name}@{version} as {} in {}",
+        status.as_str(),
+        path.display()
+    );
+    Ok(())
+}
+
+/// Entry point for `feluda review remove`
+pub fn handle_review_remove_command(
+    project_path: &Path,
+    file: Option<String>,
+    package: &str,
+) -> FeludaResult<()> {
+    let (name, version) = parse_package(package)?;
+    let path = reviews_path(project_path, file);
+    let mut reviews = Reviews::load(&path)?;
+    if !reviews.remove(&name, &version) {
+        return Err(FeludaError::InvalidData(format!(
+            "No review for {name}@{version} in {}",
+            path.display()
+        )));
+    }
+    reviews.save(&path)?;
+    println!("✓ Removed the review of {name}@{version}");
+    Ok(())
+}
+
+/// Entry point for `feluda review list`
+pub fn handle_review_list_command(
+    project_path: &Path,
+    file: Option<String>,
+    json: bool,
+) -> FeludaResult<()> {
+    let path = reviews_path(project_path, file);
+    let reviews = if path.is_file() {
+        Reviews::load(&path)?
+    } else {
+        Reviews::default()
+    };
+
+    if json {
+        let output = serde_json::to_string_pretty(&reviews.reviews)
+            .map_err(|e| FeludaError::Serialization(format!("Failed to serialize reviews: {e}")))?;
+        println!("{output}");
+        return Ok(());
+    }
+    if reviews.reviews.is_empty() {
+        println!("No reviews recorded in {}", path.display());
+        return Ok(());
+    }
+
+    let rows: Vec<Vec<String>> = reviews
+        .reviews
+        .iter()
+        .map(|entry| {
+            vec![
+                entry.name.clone(),
+                entry.version.clone(),
+                entry.status.as_str().to_string(),
+                entry.reviewer.clone().unwrap_or_default(),
+                entry.date.clone(),
+                entry.comment.clone().unwrap_or_default(),
+            ]
+        })
+        .collect();
+    print_table(
+        &[
+            "Package", "Version", "Status", "Reviewer", "Date", "Comment",
+        ],
+        &rows,
+    );
+    Ok(())
+}
+
+/// Print the dependencies without a current review after a scan
+pub fn print_reviews_needed(dependencies: &[LicenseInfo]) {
+    let rows: Vec<Vec<String>> = dependencies
+        .iter()
+        .filter(|info| needs_review(info))
+        .map(|info| {
+            let reason = match &info.review {
+                None => "not reviewed".to_string(),
+                Some(review) if review.version != info.version => format!(
+                    "{} at {}, now {}",
+                    review.status.as_str(),
+                    review.version,
+                    info.version
+                ),
+                Some(review) => format!(
+                    "{} as {}, now {}",
+                    review.status.as_str(),
+                    review.license.as_deref().unwrap_or_default(),
+                    info.get_license()
+                ),
+            };
+            vec![
+                info.name.clone(),
+                info.version.clone(),
+                info.get_license(),
+                reason,
+            ]
+        })
+        .collect();
+    if rows.is_empty() {
+        println!(
+            "\n{} {}\n",
+            "✓".bold(),
+            "All dependencies are reviewed".green().bold()
+        );
+        return;
+    }
+
+    println!(
+        "\n{} {}\n",
+        "🔎".bold(),
+        format!("{} dependencies need a review", rows.len())
+            .yellow()
+            .bold()
+    );
+    print_table(&["Package", "Version", "License", "Review"], &rows);
+    println!("Record decisions with `feluda review set <name>@<version> <status>`.\n");
+}
+
+fn print_table(headers: &[&str], rows: &[Vec<String>]) {
+    let mut formatter = TableFormatter::new(headers.iter().map(|h| h.to_string()).collect());
+    for row in rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+    for row in rows {
+        println!("{}", formatter.render_row(row, true));
+    }
+    println!("{}\n", formatter.render_footer());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn entry(name: &str, version: &str, license: Option<&str>, date: &str) -> ReviewEntry {
+        ReviewEntry {
+            name: name.to_string(),
+            version: version.to_string(),
+            license: license.map(str::to_string),
+            status: ReviewStatus::Approved,
+            comment: None,
+            reviewer: Some("jane.doe@example.com".to_string()),
+            date: date.to_string(),
+        }
+    }
+
+    #[test]
+    fn test_find_review() {
+        let mut reviews = Reviews::default();
+        reviews.set(entry("serde", "1.0.0", Some("MIT"), "2026-01-10"));
+        reviews.set(entry("serde", "1.1.0", Some("MIT"), "2026-03-02"));
+        reviews.set(entry("left-pad", "1.3.0", None, "2026-02-01"));
+
+        // The reviewed version with the reviewed license is current
+        let review = reviews.find("serde", "1.0.0", Some("MIT")).unwrap();
+        assert!(!review.changed);
+        assert_eq!(review.version, "1.0.0");
+
+        // Another version carries the latest review forward as changed
+        let review = reviews.find("serde", "1.2.0", Some("MIT")).unwrap();
+        assert!(review.changed);
+        assert_eq!(review.version, "1.1.0");
+
+        // So does a change of license
+        assert!(
+            reviews
+                .find("serde", "1.1.0", Some("GPL-3.0"))
+                .unwrap()
+                .changed
+        );
+        // A review without a license only notices version changes
+        assert!(
+            !reviews
+                .find("left-pad", "1.3.0", Some("WTFPL"))
+                .unwrap()
+                .changed
+        );
+
+        assert!(reviews.find("tokio", "1.0.0", Some("MIT")).is_none());
+    }
+
+    #[test]
+    fn test_set_and_remove_review() {
+        let mut reviews = Reviews::default();
+        reviews.set(entry("serde", "1.0.0", Some("MIT"), "2026-01-10"));
+        let mut rejected = entry("serde", "1.0.0", Some("MIT"), "2026-01-11");
+        rejected.status = ReviewStatus::Rejected;
+        reviews.set(rejected.clone());
+        assert_eq!(reviews.reviews, vec![rejected]);
+
+        assert!(reviews.remove("serde", "1.0.0"));
+        assert!(!reviews.remove("serde", "1.0.0"));
+        assert!(reviews.reviews.is_empty());
+    }
+
+    #[test]
+    fn test_parse_package() {
+        assert_eq!(
+            parse_package("serde@1.0.0").unwrap(),
+            ("serde".to_string(), "1.0.0".to_string())
+        );
+        assert_eq!(
+            parse_package("@babel/core@7.24.0").unwrap(),
+            ("@babel/core".to_string(), "7.24.0".to_string())
+        );
+        assert_eq!(
+            parse_package("pkg:maven/org.slf4j/slf4j-api@2.0.9").unwrap(),
+            ("org.slf4j:slf4j-api".to_string(), "2.0.9".to_string())
+        );
+        assert!(parse_package("serde").is_err());
+        assert!(parse_package("@babel/core").is_err());
+        assert!(parse_package("pkg:npm/lodash").is_err());
+    }
+
+    #[test]
+    fn test_reviews_round_trip() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        assert!(find_reviews(root, None).unwrap().is_none());
+        assert!(find_reviews(root, Some("missing.json")).is_err());
+
+        let mut reviews = Reviews::default();
+        let mut legal = entry("readline", "8.2.0", Some("GPL-3.0"), "2026-05-01");
+        legal.status = ReviewStatus::NeedsLegal;
+        legal.comment = Some("Only linked by the CLI".to_string());
+        reviews.set(legal);
+        reviews.set(entry("anyhow", "1.0.0", Some("MIT"), "2026-05-01"));
+        reviews.save(&root.join(DEFAULT_REVIEWS_FILE)).unwrap();
+
+        let loaded = find_reviews(root, None).unwrap().unwrap();
+        assert_eq!(loaded, reviews);
+        assert_eq!(loaded.reviews[0].name, "anyhow");
+        let content = fs::read_to_string(root.join(DEFAULT_REVIEWS_FILE)).unwrap();
+        assert!(content.contains("\"status\": \"needs-legal\""));
+
+        fs::write(root.join("future.json"), r#"{"version": 9, "reviews": []}"#).unwrap();
+        let future = root.join("future.json");
+        assert!(find_reviews(root, future.to_str()).is_err());
+    }
+}
@@ -0,0 +1,298 @@
+//! SARIF 2.1.0 output for code scanning integrations
+//!
+//! Every restrictive or incompatible dependency becomes a result with a rule per
+//! license, e.g. `restrictive-license/GPL-3.0`, located at the manifest the
+//! dependency was found in.
+
+use serde::Serialize;
+use std::collections::BTreeMap;
+
+use crate::canonical::purl;
+use crate::licenses::LicenseInfo;
+use crate::reporter::{introduced_by_suffix, license_violations, LicenseViolation};
+
+const SARIF_SCHEMA: &str = "https://json.schemastore.org/sarif-2.1.0.json";
+const SARIF_VERSION: &str = "2.1.0";
+
+/// Relative locations are resolved against the scanned directory
+const SRCROOT: &str = "%SRCROOT%";
+
+#[derive(Serialize, Debug)]
+pub struct SarifLog {
+    #[serde(rename = "$schema")]
+    pub schema: String,
+    pub version: String,
+    pub runs: Vec<SarifRun>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct SarifRun {
+    pub tool: SarifTool,
+    pub results: Vec<SarifResult>,
+}
+
+#[derive(Serialize, Debug)]
+pub struct SarifTool {
+    pub driver: SarifDriver,
+}
+
+#[derive(Serialize, Debug)]
+#[serde(rename_all = "camelCase")]
+pub struct SarifDriver {
+    pub name: String,
+    pub version: String,
+    pub information_uri: String,
+    pub rules: Vec<SarifRule>,
+}
+
+#[derive(Serialize, Debug)]
+#[serde(rename_all = "camelCase")]
+pub struct SarifRule {
+    pub id: String,
+    pub name: String,
+    pub short_description: SarifMessage,
+    pub default_configuration: SarifConfiguration,
+}
+
+#[derive(Serialize, Debug)]
+pub struct SarifConfiguration {
+    pub level: String,
+}
+
+#[derive(Serialize, Debug, PartialEq)]
+pub struct SarifMessage {
+    pub text: String,
+}
+
+#[derive(Serialize, Debug)]
+#[serde(rename_all = "camelCase")]
+pub struct SarifResult {
+    pub rule_id: String,
+    pub rule_index: usize,
+    pub level: String,
+    pub message: SarifMessage,
+    pub locations: Vec<SarifLocation>,
+    pub properties: SarifResultProperties,
+}
+
+/// Property bag of a result, identifying the dependency it is about
+#[derive(Serialize, Debug)]
+pub struct SarifResultProperties {
+    pub purl: String,
+}
+
+#[derive(Serialize, Debug)]
+#[serde(rename_all = "camelCase")]
+pub struct SarifLocation {
+    pub physical_location: SarifPhysicalLocation,
+}
+
+#[derive(Serialize, Debug)]
+#[serde(rename_all = "camelCase")]
+pub struct SarifPhysicalLocation {
+    pub artifact_location: SarifArtifactLocation,
+}
+
+#[derive(Serialize, Debug)]
+#[serde(rename_all = "camelCase")]
+pub struct SarifArtifactLocation {
+    pub uri: String,
+    pub uri_base_id: String,
+}
+
+/// Each kind of violation has its own rule namespace
+impl LicenseViolation {
+    fn rule_prefix(self) -> &'static str {
+        match self {
+            LicenseViolation::Restrictive => "restrictive-license",
+            LicenseViolation::Incompatible => "incompatible-license",
+        }
+    }
+
+    fn level(self) -> &'static str {
+        match self {
+            LicenseViolation::Restrictive => "warning",
+            LicenseViolation::Incompatible => "error",
+        }
+    }
+}
+
+/// Build a SARIF log from the [`license_violations`] of analyzed dependencies
+pub fn build_sarif_log(license_info: &[LicenseInfo], project_license: Option<&str>) -> SarifLog {
+    let violations = license_violations(license_info, project_license);
+
+    // Rules are sorted so the index of each rule is stable between runs
+    let mut rule_ids: BTreeMap<(LicenseViolation, String), usize> = BTreeMap::new();
+    for (kind, info) in &violations {
+        rule_ids.insert((*kind, info.get_license()), 0);
+    }
+    let rules: Vec<SarifRule> = rule_ids
+        .iter_mut()
+        .enumerate()
+        .map(|(index, ((kind, license), rule_index))| {
+            *rule_index = index;
+            let short_description = match kind {
+                LicenseViolation::Restrictive => {
+                    format!("Dependency uses the restrictive {license} license")
+                }
+                LicenseViolation::Incompatible => format!(
+                    "Dependency license {license} may be incompatible with the project license"
+                ),
+            };
+            SarifRule {
+                id: rule_id(*kind, license),
+                name: rule_name(*kind, license),
+                short_description: SarifMessage {
+                    text: short_description,
+                },
+                default_configuration: SarifConfiguration {
+                    level: kind.level().to_string(),
+                },
+            }
+        })
+        .collect();
+
+    let results = violations
+        .into_iter()
+        .map(|(kind, info)| {
+            let license = info.get_license();
+            let text = format!(
+                "{}{}",
+                kind.message(info, project_license),
+                introduced_by_suffix(info)
+            );
+            let rule_index = rule_ids[&(kind, license.clone())];
+
+            SarifResult {
+                rule_id: rule_id(kind, &license),
+                rule_index,
+                level: kind.level().to_string(),
+                message: SarifMessage { text },
+                locations: vec![SarifLocation {
+                    physical_location: SarifPhysicalLocation {
+                        artifact_location: SarifArtifactLocation {
+                            uri: info.source_file.clone().unwrap_or_else(|| ".".to_string()),
+                            uri_base_id: SRCROOT.to_string(),
+                        },
+                    },
+                }],
+                properties: SarifResultProperties { purl: purl(info) },
+            }
+        })
+        .collect();
+
+    SarifLog {
+        schema: SARIF_SCHEMA.to_string(),
+        version: SARIF_VERSION.to_string(),
+        runs: vec![SarifRun {
+            tool: SarifTool {
+                driver: SarifDriver {
+                    name: "feluda".to_string(),
+                    version: env!("CARGO_PKG_VERSION").to_string(),
+                    information_uri: env!("CARGO_PKG_REPOSITORY").to_string(),
+                    rules,
+                },
+            },
+            results,
+        }],
+    }
+}
+
+fn rule_id(kind: LicenseViolation, license: &str) -> String {
+    format!("{}/{}", kind.rule_prefix(), license.replace(' ', "-"))
+}
+
+/// PascalCase rule name as recommended by SARIF, e.g. `RestrictiveLicenseGPL30`
+fn rule_name(kind: LicenseViolation, license: &str) -> String {
+    let prefix = match kind {
+        LicenseViolation::Restrictive => "RestrictiveLicense",
+        LicenseViolation::Incompatible => "IncompatibleLicense",
+    };
+    let license: String = license
+        .chars()
+        .filter(|c| c.is_ascii_alphanumeric())
+        .collect();
+    format!("{prefix}{license}")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::{LicenseCompatibility, OsiStatus};
+
+    fn dep(name: &str, license: &str, restrictive: bool, source_file: &str) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            source_file: Some(source_file.to_string()),
+            ..LicenseInfo::test(name, "1.0.0", Some(license))
+        }
+    }
+
+    #[test]
+    fn test_build_sarif_log_maps_violations_to_rules() {
+        let mut incompatible = dep("copyleft", "AGPL-3.0", true, "package.json");
+        incompatible.compatibility = LicenseCompatibility::Incompatible;
+        let data = vec![
+            dep("serde", "MIT", false, "Cargo.toml"),
+            dep("readline", "GPL-3.0", true, "Cargo.toml"),
+            dep("other-gpl", "GPL-3.0", true, "go.mod"),
+            incompatible,
+        ];
+
+        let log = build_sarif_log(&data, Some("MIT"));
+        let run = &log.runs[0];
+
+        let rule_ids: Vec<&str> = run
+            .tool
+            .driver
+            .rules
+            .iter()
+            .map(|r| r.id.as_str())
+            .collect();
+        assert_eq!(
+            rule_ids,
+            vec![
+                "restrictive-license/AGPL-3.0",
+                "restrictive-license/GPL-3.0",
+                "incompatible-license/AGPL-3.0"
+            ]
+        );
+
+        assert_eq!(run.results.len(), 4);
+        let readline = &run.results[0];
+        assert_eq!(readline.rule_id, "restrictive-license/GPL-3.0");
+        assert_eq!(readline.rule_index, 1);
+        assert_eq!(readline.level, "warning");
+        assert_eq!(
+            readline.locations[0]
+                .physical_location
+                .artifact_location
+                .uri,
+            "Cargo.toml"
+        );
+        assert_eq!(run.results[3].rule_id, "incompatible-license/AGPL-3.0");
+        assert_eq!(run.results[3].level, "error");
+    }
+
+    #[test]
+    fn test_sarif_log_serialization() {
+        let data = vec![dep("readline", "GPL-3.0", true, "Cargo.toml")];
+        let json = serde_json::to_value(build_sarif_log(&data, None)).unwrap();
+
+        assert_eq!(json["version"], "2.1.0");
+        assert!(json["$schema"].as_str().unwrap().contains("sarif-2.1.0"));
+        let result = &json["runs"][0]["results"][0];
+        assert_eq!(result["ruleId"], "restrictive-license/GPL-3.0");
+        assert_eq!(result["properties"]["purl"], "pkg:cargo/readline@1.0.0");
+        assert_eq!(
+            result["locations"][0]["physicalLocation"]["artifactLocation"]["uriBaseId"],
+            "%SRCROOT%"
+        );
+        assert_eq!(
+            json["runs"][0]["tool"]["driver"]["rules"][0]["shortDescription"]["text"],
+            "Dependency uses the restrictive GPL-3.0 license"
+        );
+    }
+}
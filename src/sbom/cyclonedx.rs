@@ -214,6 +214,169 @@ impl CycloneDxBom {
     pub fn add_component(&mut self, component: CycloneDxComponent) {
         self.components.push(component);
     }
+
+    /// Serialize the BOM as a CycloneDX 1.5 XML document
+    pub fn to_xml(&self) -> String {
+        let mut xml = String::from("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n");
+
+        xml.push_str(&format!(
+            "<bom xmlns=\"http://cyclonedx.org/schema/bom/{}\"",
+            escape_xml(&self.spec_version)
+        ));
+        if let Some(ref serial_number) = self.serial_number {
+            xml.push_str(&format!(" serialNumber=\"{}\"", escape_xml(serial_number)));
+        }
+        xml.push_str(&format!(" version=\"{}\">\n", self.version.unwrap_or(1)));
+
+        if let Some(ref metadata) = self.metadata {
+            xml.push_str("  <metadata>\n");
+            if let Some(timestamp) = metadata.timestamp {
+                xml.push_str(&format!(
+                    "    <timestamp>{}</timestamp>\n",
+                    timestamp.to_rfc3339_opts(chrono::SecondsFormat::Secs, true)
+                ));
+            }
+            if let Some(ref tools) = metadata.tools {
+                xml.push_str("    <tools>\n      <components>\n");
+                for tool in &tools.components {
+                    xml.push_str(&format!(
+                        "        <component type=\"{}\">\n",
+                        escape_xml(&tool.component_type)
+                    ));
+                    xml.push_str(&format!(
+                        "          <name>{}</name>\n",
+                        escape_xml(&tool.name)
+                    ));
+                    if let Some(ref version) = tool.version {
+                        xml.push_str(&format!(
+                            "          <version>{}</version>\n",
+                            escape_xml(version)
+                        ));
+                    }
+                    xml.push_str("        </component>\n");
+                }
+                xml.push_str("      </components>\n    </tools>\n");
+            }
+            if let Some(ref component) = metadata.component {
+                push_component_xml(&mut xml, component, 4);
+            }
+            xml.push_str("  </metadata>\n");
+        }
+
+        if !self.components.is_empty() {
+            xml.push_str("  <components>\n");
+            for component in &self.components {
+                push_component_xml(&mut xml, component, 4);
+            }
+            xml.push_str("  </components>\n");
+        }
+
+        xml.push_str("</bom>\n");
+        xml
+    }
+}
+
+/// Escape text for use in XML element content and attribute values
+pub(crate) fn escape_xml(value: &str) -> String {
+    let mut escaped = String::with_capacity(value.len());
+    for c in value.chars() {
+        match c {
+            '&' => escaped.push_str("&amp;"),
+            '<' => escaped.push_str("&lt;"),
+            '>' => escaped.push_str("&gt;"),
+            '"' => escaped.push_str("&quot;"),
+            '\'' => escaped.push_str("&apos;"),
+            _ => escaped.push(c),
+        }
+    }
+    escaped
+}
+
+/// Append a component element, keeping the child order required by the CycloneDX XSD
+fn push_component_xml(xml: &mut String, component: &CycloneDxComponent, indent: usize) {
+    let pad = " ".repeat(indent);
+    let inner = " ".repeat(indent + 2);
+
+    xml.push_str(&format!(
+        "{pad}<component type=\"{}\">\n",
+        escape_xml(&component.component_type)
+    ));
+    xml.push_str(&format!(
+        "{inner}<name>{}</name>\n",
+        escape_xml(&component.name)
+    ));
+    if let Some(ref version) = component.version {
+        xml.push_str(&format!(
+            "{inner}<version>{}</version>\n",
+            escape_xml(version)
+        ));
+    }
+    if let Some(ref description) = component.description {
+        xml.push_str(&format!(
+            "{inner}<description>{}</description>\n",
+            escape_xml(description)
+        ));
+    }
+    if let Some(ref scope) = component.scope {
+        xml.push_str(&format!("{inner}<scope>{}</scope>\n", escape_xml(scope)));
+    }
+    if !component.licenses.is_empty() {
+        xml.push_str(&format!("{inner}<licenses>\n"));
+        for choice in &component.licenses {
+            match choice {
+                CycloneDxLicenseChoice::License { license } => {
+                    xml.push_str(&format!("{inner}  <license>\n"));
+                    if let Some(ref id) = license.id {
+                        xml.push_str(&format!("{inner}    <id>{}</id>\n", escape_xml(id)));
+                    } else if let Some(ref name) = license.name {
+                        xml.push_str(&format!("{inner}    <name>{}</name>\n", escape_xml(name)));
+                    }
+                    if let Some(ref url) = license.url {
+                        xml.push_str(&format!("{inner}    <url>{}</url>\n", escape_xml(url)));
+                    }
+                    xml.push_str(&format!("{inner}  </license>\n"));
+                }
+                CycloneDxLicenseChoice::Expression { expression } => {
+                    xml.push_str(&format!(
+                        "{inner}  <expression>{}</expression>\n",
+                        escape_xml(expression)
+                    ));
+                }
+            }
+        }
+        xml.push_str(&format!("{inner}</licenses>\n"));
+    }
+    if let Some(ref copyright) = component.copyright {
+        xml.push_str(&format!(
+            "{inner}<copyright>{}</copyright>\n",
+            escape_xml(copyright)
+        ));
+    }
+    if let Some(ref purl) = component.purl {
+        xml.push_str(&format!("{inner}<purl>{}</purl>\n", escape_xml(purl)));
+    }
+    if !component.external_references.is_empty() {
+        xml.push_str(&format!("{inner}<externalReferences>\n"));
+        for reference in &component.external_references {
+            xml.push_str(&format!(
+                "{inner}  <reference type=\"{}\">\n",
+                escape_xml(&reference.ref_type)
+            ));
+            xml.push_str(&format!(
+                "{inner}    <url>{}</url>\n",
+                escape_xml(&reference.url)
+            ));
+            if let Some(ref comment) = reference.comment {
+                xml.push_str(&format!(
+                    "{inner}    <comment>{}</comment>\n",
+                    escape_xml(comment)
+                ));
+            }
+            xml.push_str(&format!("{inner}  </reference>\n"));
+        }
+        xml.push_str(&format!("{inner}</externalReferences>\n"));
+    }
+    xml.push_str(&format!("{pad}</component>\n"));
 }
 
 impl Default for CycloneDxBom {
@@ -267,7 +430,11 @@ pub fn convert_spdx_to_cyclonedx(spdx_doc: &SpdxDocument) -> CycloneDxBom {
             scope: Some("required".to_string()), // Default scope
             licenses: Vec::new(),
             copyright: spdx_package.copyright_text.clone(),
-            purl: None, // Could be enhanced in the future
+            purl: spdx_package
+                .external_refs
+                .iter()
+                .find(|external_ref| external_ref.reference_type == "purl")
+                .map(|external_ref| external_ref.reference_locator.clone()),
             external_references: Vec::new(),
         };
 
@@ -296,10 +463,11 @@ pub fn convert_spdx_to_cyclonedx(spdx_doc: &SpdxDocument) -> CycloneDxBom {
     bom
 }
 
+/// Write the CycloneDX BOM next to `output_file`, or print it; returns the file written
 pub fn generate_cyclonedx_output(
     spdx_doc: &SpdxDocument,
     output_file: Option<String>,
-) -> FeludaResult<()> {
+) -> FeludaResult<Option<String>> {
     log(LogLevel::Info, "Generating CycloneDX 1.5 BOM output");
 
     // Convert SPDX document to CycloneDX BOM
@@ -329,9 +497,46 @@ pub fn generate_cyclonedx_output(
             LogLevel::Info,
             &format!("CycloneDX BOM written to: {cyclonedx_file}"),
         );
+        Ok(Some(cyclonedx_file))
     } else {
         println!("=== CycloneDX BOM (EXPERIMENTAL) ===");
         println!("{json_output}");
+        Ok(None)
+    }
+}
+
+/// Write a CycloneDX BOM for `--format cyclonedx` / `--format cyclonedx-xml` scans
+///
+/// Unlike the `sbom` subcommand, nothing but the document itself is printed to
+/// stdout so the output can be piped straight into SBOM consumers.
+pub fn write_cyclonedx_report(
+    spdx_doc: &SpdxDocument,
+    xml: bool,
+    output_file: Option<&str>,
+) -> FeludaResult<()> {
+    let cyclonedx_bom = convert_spdx_to_cyclonedx(spdx_doc);
+
+    let content = if xml {
+        log(LogLevel::Info, "Serializing CycloneDX BOM as XML");
+        cyclonedx_bom.to_xml()
+    } else {
+        log(LogLevel::Info, "Serializing CycloneDX BOM as JSON");
+        serde_json::to_string_pretty(&cyclonedx_bom).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize CycloneDX BOM: {e}"))
+        })?
+    };
+
+    match output_file {
+        Some(file_path) => {
+            std::fs::write(file_path, &content).map_err(|e| {
+                FeludaError::FileWrite(format!("Failed to write CycloneDX file: {e}"))
+            })?;
+            log(
+                LogLevel::Info,
+                &format!("CycloneDX BOM written to: {file_path}"),
+            );
+        }
+        None => println!("{}", content.trim_end()),
     }
 
     Ok(())
@@ -415,7 +620,12 @@ mod tests {
         // Add a test package
         let package = SpdxPackage::new("test-package".to_string(), &spdx_doc.document_namespace)
             .with_version("1.0.0".to_string())
-            .with_license("MIT".to_string());
+            .with_license("MIT".to_string())
+            .add_external_ref(
+                "PACKAGE-MANAGER".to_string(),
+                "purl".to_string(),
+                "pkg:npm/test-package@1.0.0".to_string(),
+            );
 
         spdx_doc.add_package(package);
 
@@ -431,6 +641,10 @@ mod tests {
         assert_eq!(component.component_type, "library");
         assert_eq!(component.scope, Some("required".to_string()));
         assert!(!component.licenses.is_empty());
+        assert_eq!(
+            component.purl.as_deref(),
+            Some("pkg:npm/test-package@1.0.0")
+        );
     }
 
     #[test]
@@ -582,4 +796,73 @@ mod tests {
             }
         }
     }
+
+    #[test]
+    fn test_cyclonedx_xml_serialization() {
+        let mut spdx_doc = SpdxDocument::new("test-project");
+        let package = SpdxPackage::new("test-package".to_string(), &spdx_doc.document_namespace)
+            .with_version("1.0.0".to_string())
+            .with_license("MIT".to_string());
+        spdx_doc.add_package(package);
+
+        let xml = convert_spdx_to_cyclonedx(&spdx_doc).to_xml();
+
+        assert!(xml.starts_with("<?xml version=\"1.0\" encoding=\"UTF-8\"?>"));
+        assert!(xml.contains("<bom xmlns=\"http://cyclonedx.org/schema/bom/1.5\""));
+        assert!(xml.contains("serialNumber=\"urn:uuid:"));
+        assert!(xml.contains("<component type=\"library\">"));
+        assert!(xml.contains("<name>test-package</name>"));
+        assert!(xml.contains("<version>1.0.0</version>"));
+        assert!(xml.contains("<license>"));
+        assert!(xml.contains("<id>MIT</id>"));
+        assert!(xml.trim_end().ends_with("</bom>"));
+    }
+
+    #[test]
+    fn test_cyclonedx_xml_expression_and_escaping() {
+        let mut bom = CycloneDxBom::new();
+        bom.add_component(CycloneDxComponent {
+            component_type: "library".to_string(),
+            name: "@scope/a&b".to_string(),
+            version: Some("<1.0>".to_string()),
+            description: None,
+            scope: None,
+            licenses: vec![CycloneDxLicenseChoice::Expression {
+                expression: "MIT OR Apache-2.0".to_string(),
+            }],
+            copyright: None,
+            purl: None,
+            external_references: Vec::new(),
+        });
+
+        let xml = bom.to_xml();
+
+        assert!(xml.contains("<name>@scope/a&amp;b</name>"));
+        assert!(xml.contains("<version>&lt;1.0&gt;</version>"));
+        assert!(xml.contains("<expression>MIT OR Apache-2.0</expression>"));
+        assert!(!xml.contains("<scope>"));
+    }
+
+    #[test]
+    fn test_write_cyclonedx_report_to_file() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let mut spdx_doc = SpdxDocument::new("test-project");
+        spdx_doc.add_package(
+            SpdxPackage::new("serde".to_string(), &spdx_doc.document_namespace)
+                .with_version("1.0.0".to_string())
+                .with_license("MIT OR Apache-2.0".to_string()),
+        );
+
+        let json_path = temp_dir.path().join("bom.json");
+        write_cyclonedx_report(&spdx_doc, false, json_path.to_str()).unwrap();
+        let json: serde_json::Value =
+            serde_json::from_str(&std::fs::read_to_string(&json_path).unwrap()).unwrap();
+        assert_eq!(json["bomFormat"], "CycloneDX");
+        assert_eq!(json["components"][0]["name"], "serde");
+
+        let xml_path = temp_dir.path().join("bom.xml");
+        write_cyclonedx_report(&spdx_doc, true, xml_path.to_str()).unwrap();
+        let xml = std::fs::read_to_string(&xml_path).unwrap();
+        assert!(xml.contains("<name>serde</name>"));
+    }
 }
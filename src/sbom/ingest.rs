@@ -0,0 +1,589 @@
+//! Reading an existing SBOM as the dependency list (`--from-sbom`)
+//!
+//! CycloneDX and SPDX documents in JSON, as written by syft, Trivy or
+//! `feluda sbom`, are accepted. Components that carry no license are looked up
+//! in their package registry, found through the component's package URL.
+//!
+//! `feluda check <purl>...` goes through the same lookup for packages given
+//! on the command line.
+
+use rayon::prelude::*;
+use serde_json::Value;
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::path::Path;
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::languages::{dart, dotnet, elixir, go, java, node, python, ruby, rust};
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, LicenseCompatibility,
+    LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+
+/// SPDX values meaning that no license information is available
+const NO_LICENSE: [&str; 2] = ["NOASSERTION", "NONE"];
+
+/// A component listed in an SBOM
+#[derive(Debug, Clone, PartialEq)]
+pub struct SbomComponent {
+    pub name: String,
+    pub version: String,
+    /// Package URL, e.g. `pkg:npm/%40babel/core@7.23.0`
+    pub purl: Option<String>,
+    pub license: Option<String>,
+    pub scope: DependencyScope,
+}
+
+/// A parsed package URL
+#[derive(Debug, Clone, PartialEq)]
+pub struct PackageUrl {
+    pub package_type: String,
+    pub namespace: Option<String>,
+    pub name: String,
+    pub version: Option<String>,
+}
+
+impl PackageUrl {
+    /// Name with its namespace, joined the way the ecosystem writes it
+    fn full_name(&self, separator: &str) -> String {
+        match &self.namespace {
+            Some(namespace) => format!("{namespace}{separator}{}", self.name),
+            None => self.name.clone(),
+        }
+    }
+
+    /// Name as the ecosystem writes it, e.g. `@babel/core` or `org.slf4j:slf4j-api`
+    pub fn package_name(&self) -> String {
+        match self.package_type.as_str() {
+            "maven" => self.full_name(":"),
+            _ => self.full_name("/"),
+        }
+    }
+
+    /// Ecosystem and name the package licenses are cached under
+    pub fn cache_key(&self) -> Option<(&'static str, String)> {
+        let key = match self.package_type.as_str() {
+            "npm" => ("npm", self.full_name("/")),
+            "pypi" => ("pypi", self.name.clone()),
+            "cargo" => ("crates.io", self.name.clone()),
+            "golang" => ("go", self.full_name("/")),
+            "gem" => ("rubygems", self.name.clone()),
+            "pub" => ("pub", self.name.clone()),
+            "hex" => ("hex", self.name.clone()),
+            "nuget" => ("nuget", self.name.clone()),
+            "maven" => ("maven", self.full_name(":")),
+            _ => return None,
+        };
+        Some(key)
+    }
+}
+
+/// Parse a package URL (`pkg:type/namespace/name@version?qualifiers#subpath`)
+pub fn parse_purl(purl: &str) -> Option<PackageUrl> {
+    let rest = purl.strip_prefix("pkg:")?;
+    let rest = rest.split(['?', '#']).next()?;
+    let (package_type, path) = rest.split_once('/')?;
+    let (path, version) = match path.rsplit_once('@') {
+        Some((path, version)) => (path, Some(percent_decode(version))),
+        None => (path, None),
+    };
+    let (namespace, name) = match path.rsplit_once('/') {
+        Some((namespace, name)) => (Some(percent_decode(namespace)), name),
+        None => (None, path),
+    };
+    if package_type.is_empty() || name.is_empty() {
+        return None;
+    }
+    Some(PackageUrl {
+        package_type: package_type.to_ascii_lowercase(),
+        namespace,
+        name: percent_decode(name),
+        version,
+    })
+}
+
+fn percent_decode(value: &str) -> String {
+    let bytes = value.as_bytes();
+    let mut decoded = Vec::with_capacity(bytes.len());
+    let mut i = 0;
+    while i < bytes.len() {
+        if bytes[i] == b'%' && i + 2 < bytes.len() {
+            if let Some(byte) = value
+                .get(i + 1..i + 3)
+                .and_then(|hex| u8::from_str_radix(hex, 16).ok())
+            {
+                decoded.push(byte);
+                i += 3;
+                continue;
+            }
+        }
+        decoded.push(bytes[i]);
+        i += 1;
+    }
+    String::from_utf8_lossy(&decoded).to_string()
+}
+
+/// Read the components of a CycloneDX or SPDX JSON document
+pub fn read_sbom(path: &Path) -> FeludaResult<Vec<SbomComponent>> {
+    let content = fs::read_to_string(path)
+        .map_err(|e| FeludaError::Parser(format!("Failed to read SBOM {}: {e}", path.display())))?;
+    let json: Value = serde_json::from_str(&content).map_err(|e| {
+        FeludaError::Parser(format!(
+            "{} is not a JSON SBOM (CycloneDX XML and SPDX tag-value are not supported): {e}",
+            path.display()
+        ))
+    })?;
+
+    if json.get("bomFormat").and_then(Value::as_str) == Some("CycloneDX") {
+        let mut components = Vec::new();
+        collect_cyclonedx_components(&json["components"], &mut components);
+        Ok(components)
+    } else if json.get("spdxVersion").is_some() {
+        Ok(spdx_packages(&json))
+    } else {
+        Err(FeludaError::Parser(format!(
+            "{} is neither a CycloneDX nor an SPDX document",
+            path.display()
+        )))
+    }
+}
+
+/// Components of a CycloneDX document, including nested ones
+fn collect_cyclonedx_components(components: &Value, found: &mut Vec<SbomComponent>) {
+    for component in components.as_array().into_iter().flatten() {
+        if let Some(name) = component.get("name").and_then(Value::as_str) {
+            let name = match component.get("group").and_then(Value::as_str) {
+                Some(group) if !group.is_empty() => {
+                    // npm scopes are written `@scope/name`, Maven groups `group:artifact`
+                    if group.starts_with('@') {
+                        format!("{group}/{name}")
+                    } else {
+                        format!("{group}:{name}")
+                    }
+                }
+                _ => name.to_string(),
+            };
+            found.push(SbomComponent {
+                name,
+                version: string_field(component, "version").unwrap_or_default(),
+                purl: string_field(component, "purl"),
+                license: cyclonedx_license(component),
+                // Excluded components are documented but not shipped, e.g. test tools
+                scope: if component.get("scope").and_then(Value::as_str) == Some("excluded") {
+                    DependencyScope::Dev
+                } else {
+                    DependencyScope::Runtime
+                },
+            });
+        }
+        collect_cyclonedx_components(&component["components"], found);
+    }
+}
+
+fn string_field(value: &Value, key: &str) -> Option<String> {
+    value
+        .get(key)
+        .and_then(Value::as_str)
+        .map(str::trim)
+        .filter(|s| !s.is_empty())
+        .map(String::from)
+}
+
+/// License of a CycloneDX component
+///
+/// Each entry is an SPDX `expression`, or a `license` with an SPDX `id` or a
+/// free-form `name`. Several entries all apply to the component.
+fn cyclonedx_license(component: &Value) -> Option<String> {
+    let licenses: Vec<String> = component
+        .get("licenses")?
+        .as_array()?
+        .iter()
+        .filter_map(|entry| {
+            string_field(entry, "expression").or_else(|| {
+                let license = entry.get("license")?;
+                string_field(license, "id").or_else(|| string_field(license, "name"))
+            })
+        })
+        .collect();
+    join_licenses(licenses)
+}
+
+fn join_licenses(mut licenses: Vec<String>) -> Option<String> {
+    licenses.dedup();
+    match licenses.len() {
+        0 => None,
+        1 => licenses.pop(),
+        _ => Some(
+            licenses
+                .iter()
+                .map(|l| {
+                    if l.contains(' ') {
+                        format!("({l})")
+                    } else {
+                        l.clone()
+                    }
+                })
+                .collect::<Vec<_>>()
+                .join(" AND "),
+        ),
+    }
+}
+
+/// Packages of an SPDX document, without the packages the document describes
+///
+/// The described package is the scanned project or image itself, not one of its
+/// dependencies.
+fn spdx_packages(json: &Value) -> Vec<SbomComponent> {
+    let mut described: HashSet<&str> = json
+        .get("documentDescribes")
+        .and_then(Value::as_array)
+        .into_iter()
+        .flatten()
+        .filter_map(Value::as_str)
+        .collect();
+    for relationship in json["relationships"].as_array().into_iter().flatten() {
+        if relationship["spdxElementId"] == "SPDXRef-DOCUMENT"
+            && relationship["relationshipType"] == "DESCRIBES"
+        {
+            if let Some(id) = relationship["relatedSpdxElement"].as_str() {
+                described.insert(id);
+            }
+        }
+    }
+
+    let license_field = |package: &Value, key: &str| {
+        string_field(package, key).filter(|license| !NO_LICENSE.contains(&license.as_str()))
+    };
+
+    json["packages"]
+        .as_array()
+        .into_iter()
+        .flatten()
+        .filter(|package| {
+            package["SPDXID"]
+                .as_str()
+                .is_none_or(|id| !described.contains(id))
+        })
+        .filter_map(|package| {
+            let purl = package["externalRefs"]
+                .as_array()
+                .into_iter()
+                .flatten()
+                .find(|reference| reference["referenceType"] == "purl")
+                .and_then(|reference| string_field(reference, "referenceLocator"));
+            Some(SbomComponent {
+                name: string_field(package, "name")?,
+                version: string_field(package, "versionInfo").unwrap_or_default(),
+                purl,
+                license: license_field(package, "licenseConcluded")
+                    .or_else(|| license_field(package, "licenseDeclared")),
+                scope: DependencyScope::Runtime,
+            })
+        })
+        .collect()
+}
+
+/// Look up the license of a component in the registry its package URL points to
+fn fetch_component_license(component: &SbomComponent) -> Option<String> {
+    let purl = parse_purl(component.purl.as_deref()?)?;
+    let version = purl
+        .version
+        .clone()
+        .unwrap_or_else(|| component.version.clone());
+    fetch_purl_license(&purl, &version)
+}
+
+/// Look up the license of `version` of a package in the registry of its ecosystem
+///
+/// Found licenses land in the package cache, like those of scanned dependencies.
+pub fn fetch_purl_license(purl: &PackageUrl, version: &str) -> Option<String> {
+    let namespaced = |separator: &str| purl.full_name(separator);
+    let version = version.to_string();
+
+    let license = match purl.package_type.as_str() {
+        "npm" => node::get_license_from_npm_registry_api(&namespaced("/"), &version),
+        "pypi" => Some(python::fetch_license_for_python_dependency(&purl.name, &version).0),
+        "cargo" => rust::fetch_license_from_crates_io(&purl.name, &version),
+        "golang" => Some(go::fetch_license_for_go_dependency(namespaced("/"), version).0),
+        "gem" => Some(ruby::fetch_license_from_rubygems(
+            &purl.name, &version, None,
+        )),
+        "pub" => dart::fetch_license_from_pub_dev(&purl.name, &version),
+        "hex" => elixir::fetch_license_from_hex(&purl.name, &version),
+        "nuget" => Some(dotnet::fetch_license_for_nuget_package(
+            &purl.name, &version,
+        )),
+        "maven" => {
+            java::fetch_license_for_maven_artifact(purl.namespace.as_deref()?, &purl.name, &version)
+        }
+        other => {
+            log(
+                LogLevel::Info,
+                &format!("No registry lookup for {other} package {}", purl.name),
+            );
+            None
+        }
+    };
+    license.filter(|license| !license.is_empty() && license != "Unknown")
+}
+
+/// Analyze the components of the SBOM at `path`
+pub fn analyze_sbom(path: &Path, config: &FeludaConfig) -> FeludaResult<Vec<LicenseInfo>> {
+    let components = read_sbom(path)?;
+    let missing = components.iter().filter(|c| c.license.is_none()).count();
+    log(
+        LogLevel::Info,
+        &format!(
+            "Read {} components from {}, {missing} without license information",
+            components.len(),
+            path.display()
+        ),
+    );
+    Ok(analyze_components(
+        components,
+        Some(path.to_string_lossy().to_string()),
+        config,
+    ))
+}
+
+/// Components for packages given by their package URL, e.g. `pkg:npm/lodash@4.17.21`
+pub fn purl_components(purls: &[String]) -> FeludaResult<Vec<SbomComponent>> {
+    purls
+        .iter()
+        .map(|purl| {
+            let purl = purl.trim();
+            let parsed = parse_purl(purl).ok_or_else(|| {
+                FeludaError::Parser(format!(
+                    "Invalid package URL {purl}, expected pkg:<type>/<name>@<version>"
+                ))
+            })?;
+            let version = parsed.version.clone().ok_or_else(|| {
+                FeludaError::Parser(format!(
+                    "Package URL {purl} has no version, e.g. {purl}@1.0.0"
+                ))
+            })?;
+            Ok(SbomComponent {
+                name: parsed.package_name(),
+                version,
+                purl: Some(purl.to_string()),
+                license: None,
+                scope: DependencyScope::Runtime,
+            })
+        })
+        .collect()
+}
+
+/// Analyze the packages given by their package URL, looking each up in its registry
+pub fn analyze_purls(purls: &[String], config: &FeludaConfig) -> FeludaResult<Vec<LicenseInfo>> {
+    Ok(analyze_components(purl_components(purls)?, None, config))
+}
+
+/// Look up the components without a license and classify every one
+fn analyze_components(
+    components: Vec<SbomComponent>,
+    source_file: Option<String>,
+    config: &FeludaConfig,
+) -> Vec<LicenseInfo> {
+    let known_licenses = fetch_licenses_from_github().unwrap_or_else(|err| {
+        log_error("Failed to fetch licenses from GitHub", &err);
+        HashMap::new()
+    });
+
+    components
+        .into_par_iter()
+        .map(|component| {
+            let license = component.license.clone().or_else(|| {
+                let license = fetch_component_license(&component)?;
+                log(
+                    LogLevel::Info,
+                    &format!("Enriched {} with license {license}", component.name),
+                );
+                Some(license)
+            });
+            let is_restrictive = is_license_restrictive(&license, &known_licenses, config.strict);
+            if is_restrictive {
+                log(
+                    LogLevel::Warn,
+                    &format!(
+                        "Restrictive license found: {license:?} for {}",
+                        component.name
+                    ),
+                );
+            }
+
+            LicenseInfo {
+                name: component.name,
+                version: component.version,
+                osi_status: match &license {
+                    Some(l) => crate::licenses::get_osi_status(l),
+                    None => crate::licenses::OsiStatus::Unknown,
+                },
+                license,
+                is_restrictive,
+                compatibility: LicenseCompatibility::Unknown,
+                license_confidence: None,
+                source_file: source_file.clone(),
+                dependency_path: None,
+                tier: None,
+                vulnerabilities: None,
+                copyright: None,
+                legal_files: None,
+                chosen_license: None,
+                requires: None,
+                scope: component.scope,
+                manual_license: None,
+                health: None,
+                obligations: None,
+                explanation: None,
+                repository: None,
+                aliases: None,
+                purl: component.purl,
+                review: None,
+                status: LookupStatus::Ok,
+                error: None,
+            }
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_parse_purl() {
+        assert_eq!(
+            parse_purl("pkg:npm/%40babel/core@7.23.0"),
+            Some(PackageUrl {
+                package_type: "npm".to_string(),
+                namespace: Some("@babel".to_string()),
+                name: "core".to_string(),
+                version: Some("7.23.0".to_string()),
+            })
+        );
+        assert_eq!(
+            parse_purl("pkg:golang/github.com/pkg/errors@v0.9.1?type=module"),
+            Some(PackageUrl {
+                package_type: "golang".to_string(),
+                namespace: Some("github.com/pkg".to_string()),
+                name: "errors".to_string(),
+                version: Some("v0.9.1".to_string()),
+            })
+        );
+        assert_eq!(parse_purl("pkg:cargo/serde").unwrap().version, None);
+        assert_eq!(parse_purl("npm/left-pad"), None);
+    }
+
+    #[test]
+    fn test_purl_cache_key() {
+        let key = |purl: &str| parse_purl(purl).and_then(|purl| purl.cache_key());
+        assert_eq!(
+            key("pkg:npm/%40babel/core@7.23.0"),
+            Some(("npm", "@babel/core".to_string()))
+        );
+        assert_eq!(
+            key("pkg:maven/org.slf4j/slf4j-api@2.0.9"),
+            Some(("maven", "org.slf4j:slf4j-api".to_string()))
+        );
+        assert_eq!(
+            key("pkg:cargo/serde"),
+            Some(("crates.io", "serde".to_string()))
+        );
+        assert_eq!(key("pkg:deb/debian/curl@7.88.1"), None);
+    }
+
+    #[test]
+    fn test_purl_components() {
+        let components = purl_components(&[
+            "pkg:golang/github.com/gin-gonic/gin@v1.9.1".to_string(),
+            " pkg:maven/org.slf4j/slf4j-api@2.0.9".to_string(),
+        ])
+        .unwrap();
+        assert_eq!(components[0].name, "github.com/gin-gonic/gin");
+        assert_eq!(components[0].version, "v1.9.1");
+        assert_eq!(
+            components[0].purl.as_deref(),
+            Some("pkg:golang/github.com/gin-gonic/gin@v1.9.1")
+        );
+        assert_eq!(components[1].name, "org.slf4j:slf4j-api");
+
+        assert!(purl_components(&["lodash@4.17.21".to_string()]).is_err());
+        assert!(purl_components(&["pkg:npm/lodash".to_string()]).is_err());
+    }
+
+    #[test]
+    fn test_read_cyclonedx() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("bom.json");
+        fs::write(
+            &path,
+            r#"{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "metadata": {"component": {"name": "app", "version": "1.0.0"}},
+  "components": [
+    {"type": "library", "group": "@babel", "name": "core", "version": "7.23.0",
+     "purl": "pkg:npm/%40babel/core@7.23.0", "licenses": [{"license": {"id": "MIT"}}]},
+    {"type": "library", "group": "org.slf4j", "name": "slf4j-api", "version": "2.0.9",
+     "licenses": [{"expression": "MIT OR Apache-2.0"}, {"license": {"name": "Custom"}}],
+     "components": [{"type": "library", "name": "shaded", "version": "0.1"}]},
+    {"type": "library", "name": "pytest", "version": "7.4.0", "scope": "excluded"}
+  ]
+}"#,
+        )
+        .unwrap();
+
+        let components = read_sbom(&path).unwrap();
+        assert_eq!(components.len(), 4);
+        assert_eq!(components[0].name, "@babel/core");
+        assert_eq!(components[0].license.as_deref(), Some("MIT"));
+        assert_eq!(components[1].name, "org.slf4j:slf4j-api");
+        assert_eq!(
+            components[1].license.as_deref(),
+            Some("(MIT OR Apache-2.0) AND Custom")
+        );
+        assert_eq!(components[2].name, "shaded");
+        assert_eq!(components[2].license, None);
+        assert_eq!(components[3].scope, DependencyScope::Dev);
+    }
+
+    #[test]
+    fn test_read_spdx() {
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("sbom.spdx.json");
+        fs::write(
+            &path,
+            r#"{
+  "spdxVersion": "SPDX-2.3",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "packages": [
+    {"SPDXID": "SPDXRef-root", "name": "my-image", "licenseConcluded": "NOASSERTION"},
+    {"SPDXID": "SPDXRef-1", "name": "serde", "versionInfo": "1.0.193",
+     "licenseConcluded": "NOASSERTION", "licenseDeclared": "MIT OR Apache-2.0",
+     "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl",
+                       "referenceLocator": "pkg:cargo/serde@1.0.193"}]},
+    {"SPDXID": "SPDXRef-2", "name": "mystery", "versionInfo": "0.1.0", "licenseConcluded": "NONE"}
+  ],
+  "relationships": [
+    {"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-root"}
+  ]
+}"#,
+        )
+        .unwrap();
+
+        let components = read_sbom(&path).unwrap();
+        assert_eq!(components.len(), 2);
+        assert_eq!(components[0].license.as_deref(), Some("MIT OR Apache-2.0"));
+        assert_eq!(
+            components[0].purl.as_deref(),
+            Some("pkg:cargo/serde@1.0.193")
+        );
+        assert_eq!(components[1].license, None);
+
+        fs::write(&path, r#"{"name": "not an sbom"}"#).unwrap();
+        assert!(read_sbom(&path).is_err());
+    }
+}
@@ -1,11 +1,15 @@
 pub mod cyclonedx;
+pub mod ingest;
 pub mod spdx;
 pub mod validate;
 
+use crate::canonical::purl;
 use crate::cli::SbomFormat;
 use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
-use crate::licenses::LicenseCompatibility;
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
 use crate::parser::parse_root;
+use crate::signing::{sign_artifacts, SigningOptions};
+use std::path::{Path, PathBuf};
 
 use cyclonedx::generate_cyclonedx_output;
 use spdx::{generate_spdx_output, SpdxDocument, SpdxPackage};
@@ -14,6 +18,7 @@ pub fn handle_sbom_command(
     path: String,
     format: &SbomFormat,
     output_file: Option<String>,
+    signing: &SigningOptions,
 ) -> FeludaResult<()> {
     log(LogLevel::Info, &format!("Generating SBOM for path: {path}"));
 
@@ -26,18 +31,44 @@ pub fn handle_sbom_command(
         &format!("Found {} dependencies", analyzed_data.len()),
     );
 
-    // Extract project name from path
-    let project_name = std::path::Path::new(&path)
+    let project_name = project_name_from_path(&path);
+    let spdx_doc = build_spdx_document(project_name, &analyzed_data);
+
+    // Generate output based on format
+    let written = match format {
+        SbomFormat::Spdx => vec![generate_spdx_output(&spdx_doc, output_file)?],
+        SbomFormat::Cyclonedx => vec![generate_cyclonedx_output(&spdx_doc, output_file)?],
+        SbomFormat::All => vec![
+            generate_spdx_output(&spdx_doc, output_file.clone())?,
+            generate_cyclonedx_output(&spdx_doc, output_file)?,
+        ],
+    };
+
+    let artifacts: Vec<PathBuf> = written.into_iter().flatten().map(PathBuf::from).collect();
+    sign_artifacts(&artifacts, Path::new(&path), signing)
+}
+
+/// Extract a project name from the scanned path, falling back to "project"
+pub fn project_name_from_path(path: &str) -> &str {
+    std::path::Path::new(path)
         .file_name()
         .and_then(|name| name.to_str())
-        .unwrap_or("project");
+        .unwrap_or("project")
+}
 
+/// Build an SPDX document from analyzed dependencies
+pub fn build_spdx_document(project_name: &str, analyzed_data: &[LicenseInfo]) -> SpdxDocument {
     // Convert to SPDX-compliant format
     let mut spdx_doc = SpdxDocument::new(project_name);
 
     for dependency in analyzed_data {
         let mut package = SpdxPackage::new(dependency.name.clone(), &spdx_doc.document_namespace)
-            .with_version(dependency.version.clone());
+            .with_version(dependency.version.clone())
+            .add_external_ref(
+                "PACKAGE-MANAGER".to_string(),
+                "purl".to_string(),
+                purl(dependency),
+            );
 
         let force_noassertion = std::env::var("FELUDA_FORCE_NOASSERTION_LICENSES")
             .map(|v| v.eq_ignore_ascii_case("true"))
@@ -79,19 +110,5 @@ pub fn handle_sbom_command(
         ),
     );
 
-    // Generate output based on format
-    match format {
-        SbomFormat::Spdx => {
-            generate_spdx_output(&spdx_doc, output_file)?;
-        }
-        SbomFormat::Cyclonedx => {
-            generate_cyclonedx_output(&spdx_doc, output_file)?;
-        }
-        SbomFormat::All => {
-            generate_spdx_output(&spdx_doc, output_file.clone())?;
-            generate_cyclonedx_output(&spdx_doc, output_file)?;
-        }
-    }
-
-    Ok(())
+    spdx_doc
 }
@@ -442,6 +442,99 @@ impl SpdxDocument {
 
         self.annotations.push(annotation);
     }
+
+    /// Render the document in the SPDX 2.3 tag-value format
+    pub fn to_tag_value(&self) -> String {
+        let mut out = String::new();
+
+        out.push_str(&format!("SPDXVersion: {}\n", self.spdx_version));
+        out.push_str(&format!("DataLicense: {}\n", self.data_license));
+        out.push_str(&format!("SPDXID: {}\n", self.spdx_id));
+        out.push_str(&format!("DocumentName: {}\n", self.name));
+        out.push_str(&format!("DocumentNamespace: {}\n", self.document_namespace));
+        for creator in &self.creation_info.creators {
+            out.push_str(&format!("Creator: {creator}\n"));
+        }
+        out.push_str(&format!(
+            "Created: {}\n",
+            self.creation_info.created.format("%Y-%m-%dT%H:%M:%SZ")
+        ));
+        if let Some(version) = &self.creation_info.license_list_version {
+            out.push_str(&format!("LicenseListVersion: {version}\n"));
+        }
+
+        for relationship in &self.relationships {
+            out.push_str(&format!(
+                "Relationship: {} {} {}\n",
+                relationship.spdx_element_id,
+                relationship.relationship_type,
+                relationship.related_spdx_element
+            ));
+        }
+
+        for package in &self.packages {
+            out.push('\n');
+            out.push_str(&format!("PackageName: {}\n", package.name));
+            out.push_str(&format!("SPDXID: {}\n", package.spdx_id));
+            if let Some(version) = &package.version_info {
+                out.push_str(&format!("PackageVersion: {version}\n"));
+            }
+            out.push_str(&format!(
+                "PackageDownloadLocation: {}\n",
+                package.download_location
+            ));
+            out.push_str(&format!("FilesAnalyzed: {}\n", package.files_analyzed));
+            if let Some(license) = &package.license_concluded {
+                out.push_str(&format!("PackageLicenseConcluded: {license}\n"));
+            }
+            if let Some(license) = &package.license_declared {
+                out.push_str(&format!("PackageLicenseDeclared: {license}\n"));
+            }
+            if let Some(comments) = &package.license_comments {
+                out.push_str(&format!(
+                    "PackageLicenseComments: <text>{comments}</text>\n"
+                ));
+            }
+            if let Some(copyright) = &package.copyright_text {
+                if copyright == "NOASSERTION" || copyright == "NONE" {
+                    out.push_str(&format!("PackageCopyrightText: {copyright}\n"));
+                } else {
+                    out.push_str(&format!("PackageCopyrightText: <text>{copyright}</text>\n"));
+                }
+            }
+            if let Some(comment) = &package.comment {
+                out.push_str(&format!("PackageComment: <text>{comment}</text>\n"));
+            }
+            for external_ref in &package.external_refs {
+                out.push_str(&format!(
+                    "ExternalRef: {} {} {}\n",
+                    external_ref.reference_category,
+                    external_ref.reference_type,
+                    external_ref.reference_locator
+                ));
+            }
+        }
+
+        for annotation in &self.annotations {
+            out.push('\n');
+            out.push_str(&format!("Annotator: {}\n", annotation.annotator));
+            out.push_str(&format!(
+                "AnnotationDate: {}\n",
+                annotation.annotation_date.format("%Y-%m-%dT%H:%M:%SZ")
+            ));
+            out.push_str(&format!("AnnotationType: {}\n", annotation.annotation_type));
+            out.push_str(&format!(
+                "SPDXREF: {}\n",
+                annotation.spdx_identifier_reference
+            ));
+            out.push_str(&format!(
+                "AnnotationComment: <text>{}</text>\n",
+                annotation.comment
+            ));
+        }
+
+        out
+    }
 }
 
 impl SpdxPackage {
@@ -504,6 +597,17 @@ impl SpdxPackage {
             spdx_license
         };
 
+        // Keep a record of the original text whenever it had to be rewritten,
+        // so reviewers can see why the declared expression differs from the manifest
+        if final_license != license
+            && !license.trim().is_empty()
+            && !spdx_charset::contains_forbidden_chars(&license)
+            && license.is_ascii()
+            && license.len() <= 500
+        {
+            self.license_comments = Some(format!("Declared license text: {license}"));
+        }
+
         self.license_declared = Some(final_license.clone());
         self.license_concluded = Some(final_license);
 
@@ -619,7 +723,6 @@ impl SpdxPackage {
     ///     "lodash@4.17.21".to_string()
     /// );
     /// ```
-    #[allow(dead_code)]
     pub fn add_external_ref(mut self, category: String, ref_type: String, locator: String) -> Self {
         // Validate external reference fields
         let is_valid = !spdx_charset::contains_forbidden_chars(&category)
@@ -832,12 +935,8 @@ fn validate_and_sanitize_spdx_package(package: &mut SpdxPackage) -> bool {
     needs_fix
 }
 
-pub fn generate_spdx_output(
-    spdx_doc: &SpdxDocument,
-    output_file: Option<String>,
-) -> FeludaResult<()> {
-    log(LogLevel::Info, "Generating SPDX 2.3 compliant output");
-
+/// Clone the document and sanitize every package before serialization
+fn sanitized_document(spdx_doc: &SpdxDocument) -> SpdxDocument {
     let mut safe_doc = spdx_doc.clone();
 
     let mut total_fixes = 0;
@@ -854,6 +953,18 @@ pub fn generate_spdx_output(
         );
     }
 
+    safe_doc
+}
+
+/// Write the SPDX document to `output_file`, or print it; returns the file written
+pub fn generate_spdx_output(
+    spdx_doc: &SpdxDocument,
+    output_file: Option<String>,
+) -> FeludaResult<Option<String>> {
+    log(LogLevel::Info, "Generating SPDX 2.3 compliant output");
+
+    let safe_doc = sanitized_document(spdx_doc);
+
     let json_output = serde_json::to_string_pretty(&safe_doc).map_err(|e| {
         FeludaError::Serialization(format!("Failed to serialize SPDX document: {e}"))
     })?;
@@ -879,9 +990,45 @@ pub fn generate_spdx_output(
             LogLevel::Info,
             &format!("SPDX SBOM written to: {spdx_file}"),
         );
+        Ok(Some(spdx_file))
     } else {
         println!("=== SPDX SBOM ===");
         println!("{json_output}");
+        Ok(None)
+    }
+}
+
+/// Write an SPDX document as the scan report, either as JSON or tag-value
+///
+/// Unlike `generate_spdx_output`, nothing but the document itself is printed
+/// to stdout so the result can be piped straight into other tools.
+pub fn write_spdx_report(
+    spdx_doc: &SpdxDocument,
+    tag_value: bool,
+    output_file: Option<&str>,
+) -> FeludaResult<()> {
+    let safe_doc = sanitized_document(spdx_doc);
+
+    let content = if tag_value {
+        log(LogLevel::Info, "Serializing SPDX document as tag-value");
+        safe_doc.to_tag_value()
+    } else {
+        log(LogLevel::Info, "Serializing SPDX document as JSON");
+        serde_json::to_string_pretty(&safe_doc).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize SPDX document: {e}"))
+        })?
+    };
+
+    match output_file {
+        Some(file_path) => {
+            std::fs::write(file_path, &content)
+                .map_err(|e| FeludaError::FileWrite(format!("Failed to write SPDX file: {e}")))?;
+            log(
+                LogLevel::Info,
+                &format!("SPDX document written to: {file_path}"),
+            );
+        }
+        None => println!("{}", content.trim_end()),
     }
 
     Ok(())
@@ -1663,4 +1810,70 @@ mod tests {
         assert!(spdx_charset::contains_problematic_chars("test[bracket]"));
         assert!(!spdx_charset::contains_problematic_chars("test-string"));
     }
+
+    #[test]
+    fn test_tag_value_output() {
+        let mut doc = SpdxDocument::new("tag-value-project");
+        let package = SpdxPackage::new("serde".to_string(), &doc.document_namespace)
+            .with_version("1.0.0".to_string())
+            .with_license("MIT OR Apache-2.0".to_string());
+        let package_id = package.spdx_id.clone();
+        doc.add_package(package);
+
+        let output = doc.to_tag_value();
+
+        assert!(output.starts_with("SPDXVersion: SPDX-2.3\n"));
+        assert!(output.contains("DataLicense: CC0-1.0\n"));
+        assert!(output.contains("SPDXID: SPDXRef-DOCUMENT\n"));
+        assert!(output.contains(&format!("DocumentNamespace: {}\n", doc.document_namespace)));
+        assert!(output.contains("Creator: Tool: Feluda-"));
+        assert!(output.contains("PackageName: serde\n"));
+        assert!(output.contains(&format!("SPDXID: {package_id}\n")));
+        assert!(output.contains("PackageVersion: 1.0.0\n"));
+        assert!(output.contains("PackageDownloadLocation: NOASSERTION\n"));
+        assert!(output.contains("FilesAnalyzed: false\n"));
+        assert!(output.contains("PackageLicenseConcluded: MIT OR Apache-2.0\n"));
+        assert!(output.contains("PackageLicenseDeclared: MIT OR Apache-2.0\n"));
+        assert!(output.contains("PackageCopyrightText: NOASSERTION\n"));
+        assert!(output.contains(&format!(
+            "Relationship: SPDXRef-DOCUMENT DESCRIBES {package_id}\n"
+        )));
+    }
+
+    #[test]
+    fn test_license_comments_record_original_text() {
+        let package = SpdxPackage::new("legacy".to_string(), "https://example.com/test")
+            .with_license("MIT/Apache-2.0".to_string());
+        assert_eq!(
+            package.license_comments,
+            Some("Declared license text: MIT/Apache-2.0".to_string())
+        );
+
+        let package = SpdxPackage::new("clean".to_string(), "https://example.com/test")
+            .with_license("MIT".to_string());
+        assert_eq!(package.license_comments, None);
+    }
+
+    #[test]
+    fn test_write_spdx_report_to_file() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let mut doc = SpdxDocument::new("report-project");
+        doc.add_package(
+            SpdxPackage::new("left-pad".to_string(), &doc.document_namespace)
+                .with_version("1.3.0".to_string())
+                .with_license("WTFPL".to_string()),
+        );
+
+        let json_path = temp_dir.path().join("report.spdx.json");
+        write_spdx_report(&doc, false, json_path.to_str()).unwrap();
+        let json: serde_json::Value =
+            serde_json::from_str(&std::fs::read_to_string(&json_path).unwrap()).unwrap();
+        assert_eq!(json["spdxVersion"], "SPDX-2.3");
+        assert_eq!(json["packages"][0]["licenseDeclared"], "WTFPL");
+
+        let tv_path = temp_dir.path().join("report.spdx");
+        write_spdx_report(&doc, true, tv_path.to_str()).unwrap();
+        let tag_value = std::fs::read_to_string(&tv_path).unwrap();
+        assert!(tag_value.contains("PackageName: left-pad"));
+    }
 }
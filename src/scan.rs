@@ -0,0 +1,856 @@
+//! Programmatic scanning API
+//!
+//! `scan` runs the same pipeline as `feluda` on the command line: detect the
+//! project license, parse and analyze dependencies, merge the ones found more
+//! than once (see [`crate::canonical`]), check compatibility,
+//! optionally look up vulnerabilities, copyright statements, legal files and license obligations, evaluate the `[policy]` section of
+//! `.feluda.toml` and assign `[risk]` tiers. The result is returned as
+//! data instead of being printed, so other tools can embed license checking.
+
+use serde::Serialize;
+use std::cell::RefCell;
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicBool, AtomicUsize, Ordering};
+use std::sync::Arc;
+use std::time::Duration;
+
+use crate::canonical::{assign_purls, deduplicate};
+use crate::config::{load_config, FeludaConfig};
+use crate::copyright::attach_copyrights;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::deps_dev::enrich_with_deps_dev;
+use crate::health::enrich_with_health;
+use crate::legal_files::attach_legal_files;
+use crate::licenses::{
+    detect_project_license, is_license_compatible_with_overrides, DependencyScope,
+    LicenseCompatibility, LicenseInfo,
+};
+use crate::linking::apply_linking;
+use crate::lookup_errors::{apply_lookup_errors, first_lookup_error};
+use crate::obligations::assign_obligations;
+use crate::parser::{
+    parse_binary_with_config, parse_bundle_with_config, parse_image_root_with_config,
+    parse_packages_with_config, parse_root_with_progress, parse_sbom_with_config,
+};
+use crate::policy::{apply_license_choices, apply_policy, PolicyViolation};
+use crate::tiers::{assign_tiers, summarize_tiers, tier_exit_code, TierSummary};
+use crate::vulns::{enrich_with_vulnerabilities, has_vulnerabilities};
+
+/// Options for [`scan`], mirroring the analysis flags of the CLI
+#[derive(Debug, Clone, Default)]
+pub struct ScanOptions {
+    /// Only analyze projects of this language (e.g. `rust`, `node`)
+    pub language: Option<String>,
+    /// Project license to check compatibility against; falls back to
+    /// `[project] license` in the configuration, then to detection
+    pub project_license: Option<String>,
+    /// Treat dependencies without license information as incompatible
+    pub strict: bool,
+    /// Fail on the first project or license lookup error, in addition to `fail_fast` in the configuration
+    pub fail_fast: bool,
+    /// Skip local sources such as `node_modules` and always query registries
+    pub no_local: bool,
+    /// Also scan projects in subdirectories, in addition to `[workspace] recursive`
+    pub recursive: bool,
+    /// Project directory patterns added to `[workspace] include`
+    pub include: Vec<String>,
+    /// Directory patterns added to `[workspace] exclude`
+    pub exclude: Vec<String>,
+    /// Leave out dev, test and build dependencies, in addition to `[dependencies] exclude_dev`
+    pub exclude_dev: bool,
+    /// Only keep dependencies in these scopes, replacing `[dependencies] scopes` when non-empty
+    pub scopes: Vec<DependencyScope>,
+    /// Scan vendored sources only, in addition to `[dependencies] vendored`
+    pub vendored: bool,
+    /// Read the dependencies from this CycloneDX or SPDX document; `path` is
+    /// still used to find the project license
+    pub from_sbom: Option<PathBuf>,
+    /// Treat `path` as the root filesystem of a container image, see [`crate::image`]
+    pub container: bool,
+    /// Read the Go modules compiled into this binary, see [`crate::binary`];
+    /// `path` is still used to find the project license
+    pub binary: Option<PathBuf>,
+    /// Read the libraries bundled into this JavaScript file or build directory,
+    /// see [`crate::bundle`]; `path` is still used to find installed packages
+    /// and the project license
+    pub bundle: Option<PathBuf>,
+    /// Check these packages, given by their package URL (e.g.
+    /// `pkg:npm/lodash@4.17.21`), instead of scanning; `path` is still used to
+    /// find the project license
+    pub packages: Vec<String>,
+    /// Look up known vulnerabilities of each dependency on OSV.dev
+    pub vulns: bool,
+    /// Look up deprecated, yanked and archived packages, see [`crate::health`]
+    pub health: bool,
+    /// Enrich dependencies from deps.dev, in addition to `[registries] deps_dev`,
+    /// see [`crate::deps_dev`]
+    pub deps_dev: bool,
+    /// Collect copyright statements from installed packages, see [`crate::copyright`]
+    pub copyright: bool,
+    /// Look for PATENTS, EULA, commercial license and CLA files, see [`crate::legal_files`]
+    pub legal_files: bool,
+    /// Summarize what each license asks of users, see [`crate::obligations`]
+    pub obligations: bool,
+    /// Configuration to use instead of loading `.feluda.toml` and `FELUDA_*`
+    pub config: Option<FeludaConfig>,
+    /// Called as projects are analyzed, e.g. to stream results to a client
+    pub progress: Option<ProgressCallback>,
+    /// Called with every dependency, as soon as its project is analyzed when
+    /// possible, e.g. to write each one out, see [`DependencyCallback`]
+    pub on_dependency: Option<DependencyCallback>,
+}
+
+/// Progress of a running scan, see [`ScanOptions::progress`]
+#[derive(Debug)]
+pub enum ScanProgress<'a> {
+    /// Projects were discovered and are about to be analyzed
+    Started { projects: usize },
+    /// The license of a dependency was looked up. Sent while its project is
+    /// still being analyzed; the result is part of the project's `ProjectScanned`.
+    DependencyResolved {
+        /// Registry or package manager, e.g. `npm` or `cargo`
+        ecosystem: &'a str,
+        name: &'a str,
+        version: &'a str,
+        /// Dependencies resolved so far, including this one
+        resolved: usize,
+    },
+    /// A project was analyzed. Ignore rules, overrides, compatibility and the
+    /// policy are applied to the [`Report`] only, once every project is done.
+    ProjectScanned {
+        /// Manifest or lockfile relative to the scanned directory
+        manifest: Option<&'a str>,
+        dependencies: &'a [LicenseInfo],
+        /// Set when the project could not be analyzed
+        error: Option<String>,
+        /// Time spent analyzing the project
+        duration: Duration,
+        /// Projects analyzed so far, including this one
+        completed: usize,
+        total: usize,
+    },
+}
+
+/// Receiver of [`ScanProgress`] events, called from the threads analyzing projects
+#[derive(Clone)]
+pub struct ProgressCallback(Arc<dyn Fn(&ScanProgress) + Send + Sync>);
+
+impl ProgressCallback {
+    pub fn new(callback: impl Fn(&ScanProgress) + Send + Sync + 'static) -> Self {
+        Self(Arc::new(callback))
+    }
+
+    pub fn report(&self, progress: &ScanProgress) {
+        (self.0)(progress)
+    }
+}
+
+impl std::fmt::Debug for ProgressCallback {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str("ProgressCallback")
+    }
+}
+
+/// Receiver of the dependencies of a scan, see [`ScanOptions::on_dependency`]
+///
+/// The dependencies of a project are passed on once it is analyzed, with
+/// package URLs, lookup errors, license choices, compatibility, linking, the
+/// policy explanation and the risk tier already applied; a dependency found in
+/// several projects is passed once for each. Scans that don't analyze projects,
+/// e.g. of an SBOM or of vendored sources, and scans looking up
+/// vulnerabilities, health, deps.dev, copyrights, legal files or obligations,
+/// which need every dependency first, pass the dependencies of the [`Report`]
+/// once it is complete instead.
+#[derive(Clone)]
+pub struct DependencyCallback(Arc<dyn Fn(&LicenseInfo) + Send + Sync>);
+
+impl DependencyCallback {
+    pub fn new(callback: impl Fn(&LicenseInfo) + Send + Sync + 'static) -> Self {
+        Self(Arc::new(callback))
+    }
+
+    pub fn report(&self, info: &LicenseInfo) {
+        (self.0)(info)
+    }
+}
+
+impl std::fmt::Debug for DependencyCallback {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.write_str("DependencyCallback")
+    }
+}
+
+/// Where the threads of a scan report the dependencies they resolve
+#[derive(Clone)]
+struct DependencyListener {
+    progress: ProgressCallback,
+    resolved: Arc<AtomicUsize>,
+}
+
+thread_local! {
+    // Set on the threads of the pool a scan analyzes its projects on
+    static DEPENDENCY_LISTENER: RefCell<Option<DependencyListener>> = const { RefCell::new(None) };
+}
+
+/// Run `analyze` on a thread pool of its own, whose threads send a
+/// [`ScanProgress::DependencyResolved`] event to `progress` for every lookup
+///
+/// Analyzers resolve their dependencies in parallel, so the events can't be
+/// told apart by the thread that started the scan. A pool per scan keeps
+/// scans running at the same time, e.g. in `feluda serve`, from seeing each
+/// other's dependencies. It has as many threads as the global pool.
+pub(crate) fn with_dependency_progress<R: Send>(
+    progress: &ProgressCallback,
+    analyze: impl FnOnce() -> R + Send,
+) -> R {
+    let listener = DependencyListener {
+        progress: progress.clone(),
+        resolved: Arc::new(AtomicUsize::new(0)),
+    };
+    let pool = rayon::ThreadPoolBuilder::new()
+        .num_threads(rayon::current_num_threads())
+        .start_handler(move |_| {
+            DEPENDENCY_LISTENER.with(|current| *current.borrow_mut() = Some(listener.clone()));
+        })
+        .build();
+    match pool {
+        Ok(pool) => pool.install(analyze),
+        Err(err) => {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Could not start the scan's thread pool, not reporting dependencies: {err}"
+                ),
+            );
+            analyze()
+        }
+    }
+}
+
+/// Send a [`ScanProgress::DependencyResolved`] event to the scan running on this thread, if any
+pub(crate) fn report_dependency_resolved(ecosystem: &str, name: &str, version: &str) {
+    let listener = DEPENDENCY_LISTENER.with(|current| current.borrow().clone());
+    if let Some(listener) = listener {
+        listener.progress.report(&ScanProgress::DependencyResolved {
+            ecosystem,
+            name,
+            version,
+            resolved: listener.resolved.fetch_add(1, Ordering::SeqCst) + 1,
+        });
+    }
+}
+
+/// Result of a scan
+#[derive(Debug, Clone, Serialize)]
+pub struct Report {
+    /// Project license used for compatibility checks, if known
+    pub project_license: Option<String>,
+    /// Analyzed dependencies with compatibility information
+    pub dependencies: Vec<LicenseInfo>,
+    /// Dependencies that violate the configured license policy
+    pub policy_violations: Vec<PolicyViolation>,
+    /// Dependency counts per configured risk tier, most severe first
+    pub tiers: Vec<TierSummary>,
+    /// Per-project results, one entry for each manifest that was scanned
+    pub projects: Vec<ProjectSummary>,
+}
+
+/// Dependency counts of one project found during the scan
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct ProjectSummary {
+    /// Manifest or lockfile relative to the scanned directory, e.g. `services/api/package.json`
+    pub manifest: String,
+    pub dependencies: usize,
+    pub restrictive: usize,
+    pub incompatible: usize,
+}
+
+impl Report {
+    /// Whether any dependency has a restrictive license
+    pub fn has_restrictive(&self) -> bool {
+        self.dependencies.iter().any(|info| info.is_restrictive)
+    }
+
+    /// Whether any dependency is incompatible with the project license
+    pub fn has_incompatible(&self) -> bool {
+        self.dependencies
+            .iter()
+            .any(|info| info.compatibility == LicenseCompatibility::Incompatible)
+    }
+
+    /// Whether any dependency has a known vulnerability, see [`ScanOptions::vulns`]
+    pub fn has_vulnerabilities(&self) -> bool {
+        has_vulnerabilities(&self.dependencies)
+    }
+
+    /// Exit code requested by the most severe risk tier with dependencies in it
+    pub fn tier_exit_code(&self) -> Option<i32> {
+        tier_exit_code(&self.tiers)
+    }
+}
+
+/// Scan the project at `path` and return the analyzed dependencies
+///
+/// ```no_run
+/// let report = feluda::scan("./", &feluda::ScanOptions::default())?;
+/// for dep in &report.dependencies {
+///     println!("{} {}: {}", dep.name, dep.version, dep.get_license());
+/// }
+/// # Ok::<(), feluda::FeludaError>(())
+/// ```
+pub fn scan(path: impl AsRef<Path>, options: &ScanOptions) -> FeludaResult<Report> {
+    let path = path.as_ref();
+    crate::limits::begin_scan();
+
+    let mut config = match &options.config {
+        Some(config) => config.clone(),
+        None => load_config()?,
+    };
+    config.strict = options.strict;
+    config.fail_fast |= options.fail_fast;
+    config.workspace.recursive |= options.recursive;
+    config.dependencies.exclude_dev |= options.exclude_dev;
+    config.dependencies.vendored |= options.vendored;
+    config.registries.deps_dev |= options.deps_dev;
+    if !options.scopes.is_empty() {
+        config.dependencies.scopes = options.scopes.clone();
+    }
+    config
+        .workspace
+        .include
+        .extend(options.include.iter().cloned());
+    config
+        .workspace
+        .exclude
+        .extend(options.exclude.iter().cloned());
+
+    let project_license = match options
+        .project_license
+        .as_ref()
+        .or(config.project.license.as_ref())
+    {
+        Some(license) => {
+            log(
+                LogLevel::Info,
+                &format!("Using provided project license: {license}"),
+            );
+            Some(license.clone())
+        }
+        None => {
+            log(
+                LogLevel::Info,
+                "No project license specified, attempting to detect",
+            );
+            match detect_project_license(&path.to_string_lossy()) {
+                Ok(Some(detected)) => {
+                    log(
+                        LogLevel::Info,
+                        &format!("Detected project license: {detected}"),
+                    );
+                    Some(detected)
+                }
+                Ok(None) => {
+                    log(LogLevel::Warn, "Could not detect project license");
+                    None
+                }
+                Err(e) => {
+                    log(
+                        LogLevel::Error,
+                        &format!("Error detecting project license: {e}"),
+                    );
+                    None
+                }
+            }
+        }
+    };
+
+    // Dependencies are passed on per project unless the scan enriches them afterwards
+    let enriches = options.vulns
+        || options.health
+        || config.policy.health.fails()
+        || config.registries.deps_dev
+        || options.copyright
+        || options.legal_files
+        || config.policy.legal_files.fails()
+        || options.obligations;
+    let streamed = Arc::new(AtomicBool::new(false));
+    let progress = match &options.on_dependency {
+        Some(on_dependency) if !enriches => Some(stream_projects(
+            on_dependency.clone(),
+            options.progress.clone(),
+            project_license.clone(),
+            config.clone(),
+            Arc::clone(&streamed),
+        )),
+        _ => options.progress.clone(),
+    };
+
+    let dependencies = if let Some(sbom) = &options.from_sbom {
+        parse_sbom_with_config(path, sbom, &config)
+    } else if let Some(binary) = &options.binary {
+        parse_binary_with_config(path, binary, &config)
+    } else if let Some(bundle) = &options.bundle {
+        parse_bundle_with_config(path, bundle, &config)
+    } else if !options.packages.is_empty() {
+        parse_packages_with_config(path, &options.packages, &config)
+    } else if options.container {
+        parse_image_root_with_config(path, &config)
+    } else {
+        parse_root_with_progress(
+            path,
+            options.language.as_deref(),
+            &config,
+            options.no_local,
+            progress.as_ref(),
+        )
+    };
+    let mut dependencies = dependencies
+        .map_err(|e| FeludaError::Parser(format!("Failed to parse dependencies: {e}")))?;
+
+    deduplicate(&mut dependencies);
+    crate::limits::check_dependency_count(dependencies.len())?;
+    assign_purls(&mut dependencies);
+    apply_lookup_errors(&mut dependencies);
+    if config.fail_fast {
+        if let Some(info) = first_lookup_error(&dependencies) {
+            return Err(FeludaError::License(format!(
+                "License lookup failed for {}@{}: {}",
+                info.name,
+                info.version,
+                info.error.as_deref().unwrap_or_default()
+            )));
+        }
+    }
+
+    apply_license_choices(&mut dependencies, &config.policy, config.strict);
+    assign_compatibility(&mut dependencies, project_license.as_deref(), &config);
+    apply_linking(&mut dependencies, &config.project);
+    if options.vulns {
+        enrich_with_vulnerabilities(&mut dependencies)?;
+    }
+    if options.health || config.policy.health.fails() {
+        enrich_with_health(&mut dependencies, &config.policy.health);
+    }
+    if config.registries.deps_dev {
+        enrich_with_deps_dev(&mut dependencies);
+    }
+    if options.copyright {
+        attach_copyrights(path, &mut dependencies);
+    }
+    if options.legal_files || config.policy.legal_files.fails() {
+        attach_legal_files(path, &mut dependencies, &config.policy.legal_files);
+    }
+    if options.obligations {
+        assign_obligations(&mut dependencies);
+    }
+    let policy_violations = apply_policy(&mut dependencies, &config.policy, &config.project);
+    let risk = config.risk_with_custom_licenses();
+    assign_tiers(&mut dependencies, &risk);
+    let tiers = summarize_tiers(&dependencies, &risk);
+    let projects = summarize_projects(&dependencies);
+    if let Some(on_dependency) = &options.on_dependency {
+        if !streamed.load(Ordering::SeqCst) {
+            for info in &dependencies {
+                on_dependency.report(info);
+            }
+        }
+    }
+
+    Ok(Report {
+        project_license,
+        dependencies,
+        policy_violations,
+        tiers,
+        projects,
+    })
+}
+
+/// Wrap `progress` to pass the dependencies of each analyzed project to `on_dependency`
+///
+/// Only the steps that look at one dependency at a time are applied, the rest
+/// of the scan needs every project first. `streamed` is set once a project is
+/// passed on.
+fn stream_projects(
+    on_dependency: DependencyCallback,
+    progress: Option<ProgressCallback>,
+    project_license: Option<String>,
+    config: FeludaConfig,
+    streamed: Arc<AtomicBool>,
+) -> ProgressCallback {
+    let risk = config.risk_with_custom_licenses();
+    ProgressCallback::new(move |event| {
+        if let ScanProgress::ProjectScanned { dependencies, .. } = event {
+            let mut dependencies = dependencies.to_vec();
+            assign_purls(&mut dependencies);
+            apply_lookup_errors(&mut dependencies);
+            apply_license_choices(&mut dependencies, &config.policy, config.strict);
+            if project_license.is_some() {
+                assign_compatibility(&mut dependencies, project_license.as_deref(), &config);
+            }
+            apply_linking(&mut dependencies, &config.project);
+            apply_policy(&mut dependencies, &config.policy, &config.project);
+            assign_tiers(&mut dependencies, &risk);
+            streamed.store(true, Ordering::SeqCst);
+            for info in &dependencies {
+                on_dependency.report(info);
+            }
+        }
+        if let Some(progress) = &progress {
+            progress.report(event);
+        }
+    })
+}
+
+/// Group dependencies by the manifest they were found in
+pub fn summarize_projects(dependencies: &[LicenseInfo]) -> Vec<ProjectSummary> {
+    let mut projects: BTreeMap<&str, ProjectSummary> = BTreeMap::new();
+    for info in dependencies {
+        let Some(manifest) = info.source_file.as_deref() else {
+            continue;
+        };
+        let project = projects.entry(manifest).or_insert_with(|| ProjectSummary {
+            manifest: manifest.to_string(),
+            dependencies: 0,
+            restrictive: 0,
+            incompatible: 0,
+        });
+        project.dependencies += 1;
+        if info.is_restrictive {
+            project.restrictive += 1;
+        }
+        if info.compatibility == LicenseCompatibility::Incompatible {
+            project.incompatible += 1;
+        }
+    }
+    projects.into_values().collect()
+}
+
+/// Update each dependency with compatibility information against the project license
+///
+/// Uses `strict` and the `[compatibility]` overrides from `config`.
+pub fn assign_compatibility(
+    dependencies: &mut [LicenseInfo],
+    project_license: Option<&str>,
+    config: &FeludaConfig,
+) {
+    let strict = config.strict;
+    let Some(project_license) = project_license else {
+        log(
+            LogLevel::Warn,
+            "No project license specified or detected, marking all dependencies as unknown compatibility",
+        );
+        for info in dependencies {
+            info.compatibility = LicenseCompatibility::Unknown;
+        }
+        return;
+    };
+
+    log(
+        LogLevel::Info,
+        &format!("Checking license compatibility against project license: {project_license}"),
+    );
+
+    for info in dependencies {
+        // A license chosen from an OR expression is the one the project uses
+        if let Some(dep_license) = info.chosen_license.as_ref().or(info.license.as_ref()) {
+            info.compatibility = is_license_compatible_with_overrides(
+                dep_license,
+                project_license,
+                strict,
+                &config.compatibility,
+            );
+
+            log(
+                LogLevel::Info,
+                &format!(
+                    "License compatibility for {} ({}): {:?}",
+                    info.name, dep_license, info.compatibility
+                ),
+            );
+        } else {
+            info.compatibility = if strict {
+                LicenseCompatibility::Incompatible
+            } else {
+                LicenseCompatibility::Unknown
+            };
+
+            log(
+                LogLevel::Info,
+                &format!(
+                    "License compatibility for {} {} (no license info)",
+                    info.name,
+                    if strict { "incompatible" } else { "unknown" }
+                ),
+            );
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_assign_compatibility() {
+        let mut deps = vec![
+            LicenseInfo::test("serde", "1.0.0", Some("MIT")),
+            LicenseInfo::test("mystery", "1.0.0", None),
+        ];
+        let mut config = FeludaConfig::default();
+
+        assign_compatibility(&mut deps, Some("MIT"), &config);
+        assert_eq!(deps[0].compatibility, LicenseCompatibility::Compatible);
+        assert_eq!(deps[1].compatibility, LicenseCompatibility::Unknown);
+
+        config.strict = true;
+        assign_compatibility(&mut deps, Some("MIT"), &config);
+        assert_eq!(deps[1].compatibility, LicenseCompatibility::Incompatible);
+
+        assign_compatibility(&mut deps, None, &config);
+        assert!(deps
+            .iter()
+            .all(|d| d.compatibility == LicenseCompatibility::Unknown));
+    }
+
+    #[test]
+    fn test_assign_compatibility_with_overrides() {
+        let mut deps = vec![
+            LicenseInfo::test("gpl-lib", "1.0.0", Some("GPL-3.0")),
+            LicenseInfo::test("mpl-lib", "1.0.0", Some("MPL-2.0")),
+        ];
+        let mut config = FeludaConfig::default();
+
+        assign_compatibility(&mut deps, Some("Apache-2.0"), &config);
+        assert_eq!(deps[0].compatibility, LicenseCompatibility::Incompatible);
+        assert_eq!(deps[1].compatibility, LicenseCompatibility::Incompatible);
+
+        config.compatibility.insert(
+            "Apache-2.0".to_string(),
+            crate::config::CompatibilityOverride {
+                compatible_with: vec!["MPL-2.0".to_string()],
+                incompatible_with: vec![],
+            },
+        );
+        assign_compatibility(&mut deps, Some("Apache-2.0"), &config);
+        assert_eq!(deps[0].compatibility, LicenseCompatibility::Incompatible);
+        assert_eq!(deps[1].compatibility, LicenseCompatibility::Compatible);
+
+        // Project licenses without a built-in entry can be declared entirely
+        config.compatibility.insert(
+            "LicenseRef-Corp".to_string(),
+            crate::config::CompatibilityOverride {
+                compatible_with: vec!["GPL-3.0".to_string()],
+                incompatible_with: vec![],
+            },
+        );
+        assign_compatibility(&mut deps, Some("LicenseRef-Corp"), &config);
+        assert_eq!(deps[0].compatibility, LicenseCompatibility::Compatible);
+        assert_eq!(deps[1].compatibility, LicenseCompatibility::Incompatible);
+    }
+
+    #[test]
+    fn test_scan_uses_configured_project_license() {
+        let temp_dir = TempDir::new().unwrap();
+        let mut config = FeludaConfig::default();
+        config.project.license = Some("Apache-2.0".to_string());
+        let options = ScanOptions {
+            config: Some(config),
+            ..ScanOptions::default()
+        };
+
+        let report = scan(temp_dir.path(), &options).unwrap();
+        assert_eq!(report.project_license.as_deref(), Some("Apache-2.0"));
+
+        let options = ScanOptions {
+            project_license: Some("MIT".to_string()),
+            ..options
+        };
+        let report = scan(temp_dir.path(), &options).unwrap();
+        assert_eq!(report.project_license.as_deref(), Some("MIT"));
+    }
+
+    #[test]
+    fn test_scan_empty_project() {
+        let temp_dir = TempDir::new().unwrap();
+        let options = ScanOptions {
+            project_license: Some("MIT".to_string()),
+            config: Some(FeludaConfig::default()),
+            ..ScanOptions::default()
+        };
+
+        let report = scan(temp_dir.path(), &options).unwrap();
+        assert_eq!(report.project_license.as_deref(), Some("MIT"));
+        assert!(report.dependencies.is_empty());
+        assert!(report.policy_violations.is_empty());
+        assert!(report.tiers.is_empty());
+        assert!(report.projects.is_empty());
+        assert!(report.tier_exit_code().is_none());
+        assert!(!report.has_restrictive());
+        assert!(!report.has_incompatible());
+    }
+
+    #[test]
+    fn test_scan_reports_progress() {
+        let temp_dir = TempDir::new().unwrap();
+        std::fs::write(temp_dir.path().join("requirements.txt"), "").unwrap();
+
+        let events = Arc::new(std::sync::Mutex::new(Vec::new()));
+        let recorded = Arc::clone(&events);
+        let options = ScanOptions {
+            config: Some(FeludaConfig::default()),
+            progress: Some(ProgressCallback::new(move |progress| {
+                let event = match progress {
+                    ScanProgress::Started { projects } => format!("started {projects}"),
+                    ScanProgress::DependencyResolved { name, .. } => format!("resolved {name}"),
+                    ScanProgress::ProjectScanned {
+                        manifest,
+                        completed,
+                        total,
+                        ..
+                    } => format!("{} {completed}/{total}", manifest.unwrap_or_default()),
+                };
+                recorded.lock().unwrap().push(event);
+            })),
+            ..ScanOptions::default()
+        };
+
+        scan(temp_dir.path(), &options).unwrap();
+        assert_eq!(
+            *events.lock().unwrap(),
+            vec!["started 1".to_string(), "requirements.txt 1/1".to_string()]
+        );
+    }
+
+    #[cfg(unix)]
+    #[test]
+    fn test_scan_passes_dependencies_per_project() {
+        let temp_dir = TempDir::new().unwrap();
+        std::fs::write(temp_dir.path().join("acme.lock"), "").unwrap();
+        let script = temp_dir.path().join("plugin.sh");
+        std::fs::write(
+            &script,
+            r#"read request
+echo '{"dependencies": [{"name": "widget", "version": "2.1.0", "license": "MIT"}]}'
+"#,
+        )
+        .unwrap();
+        let mut config = FeludaConfig::default();
+        config.plugins.insert(
+            "acme".to_string(),
+            crate::config::PluginConfig {
+                command: vec!["sh".to_string(), script.to_string_lossy().to_string()],
+                files: vec!["acme.lock".to_string()],
+                timeout: 5,
+            },
+        );
+
+        let passed = Arc::new(std::sync::Mutex::new(Vec::new()));
+        let at_project = Arc::new(std::sync::Mutex::new(None));
+        let recorded = Arc::clone(&passed);
+        let (seen, snapshot) = (Arc::clone(&passed), Arc::clone(&at_project));
+        let options = ScanOptions {
+            project_license: Some("MIT".to_string()),
+            config: Some(config),
+            on_dependency: Some(DependencyCallback::new(move |info| {
+                let line = format!("{}@{} {:?}", info.name, info.version, info.compatibility);
+                recorded.lock().unwrap().push(line);
+            })),
+            progress: Some(ProgressCallback::new(move |progress| {
+                if let ScanProgress::ProjectScanned { .. } = progress {
+                    *snapshot.lock().unwrap() = Some(seen.lock().unwrap().len());
+                }
+            })),
+            ..ScanOptions::default()
+        };
+
+        // The project's dependencies are passed on before the scan completes
+        let report = scan(temp_dir.path(), &options).unwrap();
+        assert_eq!(report.dependencies.len(), 1);
+        assert_eq!(*at_project.lock().unwrap(), Some(1));
+        assert_eq!(*passed.lock().unwrap(), vec!["widget@2.1.0 Compatible"]);
+
+        // Enriched dependencies are passed on once the scan is complete
+        passed.lock().unwrap().clear();
+        let options = ScanOptions {
+            obligations: true,
+            ..options
+        };
+        let report = scan(temp_dir.path(), &options).unwrap();
+        assert!(report.dependencies[0].obligations.is_some());
+        assert_eq!(*at_project.lock().unwrap(), Some(0));
+        assert_eq!(*passed.lock().unwrap(), vec!["widget@2.1.0 Compatible"]);
+    }
+
+    #[test]
+    fn test_dependency_progress() {
+        let recorder = || {
+            let events = Arc::new(std::sync::Mutex::new(Vec::new()));
+            let recorded = Arc::clone(&events);
+            let progress = ProgressCallback::new(move |progress| {
+                if let ScanProgress::DependencyResolved {
+                    ecosystem,
+                    name,
+                    version,
+                    resolved,
+                } = progress
+                {
+                    let event = format!("{resolved} {ecosystem}:{name}@{version}");
+                    recorded.lock().unwrap().push(event);
+                }
+            });
+            (events, progress)
+        };
+        let (first, first_progress) = recorder();
+        let (second, second_progress) = recorder();
+
+        let resolved = with_dependency_progress(&first_progress, || {
+            report_dependency_resolved("npm", "left-pad", "1.3.0");
+            // A scan running at the same time reports to its own listener
+            with_dependency_progress(&second_progress, || {
+                report_dependency_resolved("cargo", "serde", "1.0.0");
+            });
+            report_dependency_resolved("npm", "is-odd", "3.0.1");
+            2
+        });
+        assert_eq!(resolved, 2);
+        assert_eq!(
+            *first.lock().unwrap(),
+            vec!["1 npm:left-pad@1.3.0", "2 npm:is-odd@3.0.1"]
+        );
+        assert_eq!(*second.lock().unwrap(), vec!["1 cargo:serde@1.0.0"]);
+
+        // Outside a scan nothing is reported
+        report_dependency_resolved("npm", "left-pad", "1.3.0");
+        assert_eq!(first.lock().unwrap().len(), 2);
+    }
+
+    #[test]
+    fn test_scan_from_sbom_applies_policy() {
+        let temp_dir = TempDir::new().unwrap();
+        let sbom = temp_dir.path().join("bom.json");
+        std::fs::write(
+            &sbom,
+            r#"{"bomFormat": "CycloneDX", "specVersion": "1.5", "components": [
+  {"name": "left-pad", "version": "1.3.0", "licenses": [{"license": {"id": "MIT"}}]},
+  {"name": "readline", "version": "8.2", "licenses": [{"license": {"id": "GPL-3.0"}}]}
+]}"#,
+        )
+        .unwrap();
+
+        let mut config = FeludaConfig::default();
+        config.policy.deny = vec!["GPL-3.0".to_string()];
+        let options = ScanOptions {
+            project_license: Some("MIT".to_string()),
+            from_sbom: Some(sbom),
+            config: Some(config),
+            ..ScanOptions::default()
+        };
+
+        let report = scan(temp_dir.path(), &options).unwrap();
+        assert_eq!(report.dependencies.len(), 2);
+        assert_eq!(report.policy_violations.len(), 1);
+        assert_eq!(report.policy_violations[0].name, "readline");
+    }
+}
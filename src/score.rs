@@ -0,0 +1,397 @@
+//! Compliance score and README badges (`--score`, `--badge`)
+//!
+//! Every dependency with a finding costs points out of 100, by its most
+//! severe finding:
+//!
+//! | Finding | Points |
+//! |---------|--------|
+//! | License denied by the policy | 10 |
+//! | Incompatible with the project license, or not on the allow list | 8 |
+//! | Restrictive license | 5 |
+//! | License choice required, deprecated, yanked or archived | 3 |
+//! | Unknown license | 2 |
+//!
+//! Indirect dependencies weigh less the deeper they sit in the graph: a
+//! dependency `n` levels down costs `1/n` of the points. Dependencies without
+//! a known path count as direct.
+//!
+//! The badge says `passing` without any finding, `warnings` when only
+//! restrictive, unknown or health findings remain and `failing` otherwise. It
+//! is written as a shields.io-style SVG, or as the JSON of a shields.io
+//! [endpoint badge](https://shields.io/badges/endpoint-badge), and served by
+//! `feluda serve` at `/badge/{id}`.
+
+use colored::*;
+use serde::Serialize;
+use std::collections::HashMap;
+use std::fs;
+use std::path::Path;
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::policy::{PolicyViolation, ViolationKind};
+
+/// Label on the left of the badge
+pub const BADGE_LABEL: &str = "License check";
+
+const DENIED_POINTS: f64 = 10.0;
+const INCOMPATIBLE_POINTS: f64 = 8.0;
+const RESTRICTIVE_POINTS: f64 = 5.0;
+const REVIEW_POINTS: f64 = 3.0;
+const UNKNOWN_POINTS: f64 = 2.0;
+
+/// Overall outcome shown on the badge
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum BadgeStatus {
+    Passing,
+    Warnings,
+    Failing,
+}
+
+impl BadgeStatus {
+    /// shields.io color name
+    pub fn color(&self) -> &'static str {
+        match self {
+            BadgeStatus::Passing => "brightgreen",
+            BadgeStatus::Warnings => "yellow",
+            BadgeStatus::Failing => "red",
+        }
+    }
+}
+
+impl std::fmt::Display for BadgeStatus {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            BadgeStatus::Passing => write!(f, "passing"),
+            BadgeStatus::Warnings => write!(f, "warnings"),
+            BadgeStatus::Failing => write!(f, "failing"),
+        }
+    }
+}
+
+/// Compliance score of a scan
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct ComplianceScore {
+    /// 0 to 100, 100 without any finding
+    pub score: u8,
+    /// `A` (90 and up) to `F` (below 25)
+    pub grade: char,
+    pub status: BadgeStatus,
+    /// Points lost, before rounding
+    pub penalty: f64,
+    /// Dependencies with at least one finding
+    pub findings: usize,
+}
+
+/// Points a dependency costs before its depth is taken into account
+fn dependency_points(info: &LicenseInfo, violations: &[&PolicyViolation]) -> f64 {
+    let policy = violations.iter().map(|violation| match violation.kind {
+        ViolationKind::Denied => DENIED_POINTS,
+        ViolationKind::NotAllowed => INCOMPATIBLE_POINTS,
+        ViolationKind::MissingLicense | ViolationKind::UnrecognizedLicense => UNKNOWN_POINTS,
+        ViolationKind::ChoiceRequired
+        | ViolationKind::Deprecated
+        | ViolationKind::Yanked
+        | ViolationKind::Archived
+        | ViolationKind::PatentTerms
+        | ViolationKind::Eula
+        | ViolationKind::CommercialLicense
+        | ViolationKind::ContributorAgreement => REVIEW_POINTS,
+    });
+    let license = [
+        (
+            info.compatibility == LicenseCompatibility::Incompatible,
+            INCOMPATIBLE_POINTS,
+        ),
+        (info.is_restrictive, RESTRICTIVE_POINTS),
+        (info.has_unknown_license(), UNKNOWN_POINTS),
+    ]
+    .into_iter()
+    .filter_map(|(found, points)| found.then_some(points));
+    policy.chain(license).fold(0.0, f64::max)
+}
+
+/// Levels between the project and a dependency, 1 for direct dependencies
+fn depth(info: &LicenseInfo) -> usize {
+    info.dependency_path
+        .as_ref()
+        .map_or(1, |path| path.len().max(1))
+}
+
+fn grade(score: u8) -> char {
+    match score {
+        90.. => 'A',
+        75..=89 => 'B',
+        50..=74 => 'C',
+        25..=49 => 'D',
+        _ => 'F',
+    }
+}
+
+/// Score the dependencies and policy violations of a scan
+pub fn compliance_score(
+    dependencies: &[LicenseInfo],
+    violations: &[PolicyViolation],
+) -> ComplianceScore {
+    let mut by_dependency: HashMap<(&str, &str), Vec<&PolicyViolation>> = HashMap::new();
+    for violation in violations {
+        by_dependency
+            .entry((violation.name.as_str(), violation.version.as_str()))
+            .or_default()
+            .push(violation);
+    }
+
+    let mut penalty = 0.0;
+    let mut findings = 0;
+    let mut worst: f64 = 0.0;
+    for info in dependencies {
+        let violations = by_dependency
+            .get(&(info.name.as_str(), info.version.as_str()))
+            .map(Vec::as_slice)
+            .unwrap_or_default();
+        let points = dependency_points(info, violations);
+        if points > 0.0 {
+            findings += 1;
+            worst = worst.max(points);
+            penalty += points / depth(info) as f64;
+        }
+    }
+
+    let score = (100.0 - penalty).round().clamp(0.0, 100.0) as u8;
+    let status = if worst >= INCOMPATIBLE_POINTS {
+        BadgeStatus::Failing
+    } else if findings > 0 {
+        BadgeStatus::Warnings
+    } else {
+        BadgeStatus::Passing
+    };
+    ComplianceScore {
+        score,
+        grade: grade(score),
+        status,
+        penalty,
+        findings,
+    }
+}
+
+/// Print the score to stderr so structured output on stdout stays intact
+pub fn print_compliance_score(score: &ComplianceScore) {
+    let status = match score.status {
+        BadgeStatus::Passing => score.status.to_string().green().bold(),
+        BadgeStatus::Warnings => score.status.to_string().yellow().bold(),
+        BadgeStatus::Failing => score.status.to_string().red().bold(),
+    };
+    eprintln!(
+        "\n{} {}/100 (grade {}), {} dependencies with findings: {}\n",
+        "Compliance score:".bold(),
+        score.score,
+        score.grade,
+        score.findings,
+        status
+    );
+}
+
+/// shields.io endpoint badge, see <https://shields.io/badges/endpoint-badge>
+#[derive(Debug, Clone, PartialEq, Serialize)]
+#[serde(rename_all = "camelCase")]
+pub struct BadgeEndpoint {
+    pub schema_version: u8,
+    pub label: String,
+    pub message: String,
+    pub color: String,
+}
+
+/// Badge message, the status with the score when anything was found
+fn badge_message(score: &ComplianceScore) -> String {
+    match score.status {
+        BadgeStatus::Passing => score.status.to_string(),
+        _ => format!("{} ({}/100)", score.status, score.score),
+    }
+}
+
+pub fn badge_endpoint(score: &ComplianceScore) -> BadgeEndpoint {
+    BadgeEndpoint {
+        schema_version: 1,
+        label: BADGE_LABEL.to_string(),
+        message: badge_message(score),
+        color: score.status.color().to_string(),
+    }
+}
+
+/// A badge with a status of its own, e.g. while the scan behind it is running
+pub fn status_badge_endpoint(message: &str) -> BadgeEndpoint {
+    BadgeEndpoint {
+        schema_version: 1,
+        label: BADGE_LABEL.to_string(),
+        message: message.to_string(),
+        color: "lightgrey".to_string(),
+    }
+}
+
+fn hex_color(color: &str) -> &'static str {
+    match color {
+        "brightgreen" => "#4c1",
+        "yellow" => "#dfb317",
+        "red" => "#e05d44",
+        _ => "#9f9f9f",
+    }
+}
+
+fn escape_xml(text: &str) -> String {
+    text.replace('&', "&amp;")
+        .replace('<', "&lt;")
+        .replace('>', "&gt;")
+        .replace('"', "&quot;")
+}
+
+/// Approximate width of text in 11px Verdana, as shields.io renders it
+fn text_width(text: &str) -> usize {
+    text.chars()
+        .map(|c| match c {
+            'i' | 'l' | 'j' | '.' | ',' | ':' | '(' | ')' | '/' | ' ' => 4,
+            'm' | 'w' | 'M' | 'W' => 10,
+            c if c.is_ascii_uppercase() => 8,
+            _ => 7,
+        })
+        .sum()
+}
+
+/// Flat shields.io-style SVG of an endpoint badge
+pub fn badge_svg(badge: &BadgeEndpoint) -> String {
+    let label_width = text_width(&badge.label) + 10;
+    let message_width = text_width(&badge.message) + 10;
+    let width = label_width + message_width;
+    let label = escape_xml(&badge.label);
+    let message = escape_xml(&badge.message);
+    let color = hex_color(&badge.color);
+    let label_x = label_width / 2;
+    let message_x = label_width + message_width / 2;
+    format!(
+        r##"<svg xmlns="http://www.w3.org/2000/svg" width="{width}" height="20" role="img" aria-label="{label}: {message}">
+  <title>{label}: {message}</title>
+  <linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+  <clipPath id="r"><rect width="{width}" height="20" rx="3" fill="#fff"/></clipPath>
+  <g clip-path="url(#r)">
+    <rect width="{label_width}" height="20" fill="#555"/>
+    <rect x="{label_width}" width="{message_width}" height="20" fill="{color}"/>
+    <rect width="{width}" height="20" fill="url(#s)"/>
+  </g>
+  <g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+    <text x="{label_x}" y="15" fill="#010101" fill-opacity=".3">{label}</text>
+    <text x="{label_x}" y="14">{label}</text>
+    <text x="{message_x}" y="15" fill="#010101" fill-opacity=".3">{message}</text>
+    <text x="{message_x}" y="14">{message}</text>
+  </g>
+</svg>
+"##
+    )
+}
+
+/// Write the badge to `path`: endpoint JSON for a `.json` file, SVG otherwise
+pub fn write_badge(path: &Path, score: &ComplianceScore) -> FeludaResult<()> {
+    let badge = badge_endpoint(score);
+    let is_json = path
+        .extension()
+        .is_some_and(|ext| ext.eq_ignore_ascii_case("json"));
+    let content = if is_json {
+        serde_json::to_string_pretty(&badge)
+            .map_err(|e| FeludaError::Serialization(format!("Failed to serialize badge: {e}")))?
+    } else {
+        badge_svg(&badge)
+    };
+    fs::write(path, content).map_err(|e| {
+        FeludaError::FileWrite(format!("Failed to write badge {}: {e}", path.display()))
+    })?;
+    log(
+        LogLevel::Info,
+        &format!("Wrote {} badge to {}", badge.message, path.display()),
+    );
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+
+    fn dep(name: &str, license: &str, path: Option<&[&str]>) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive: license.starts_with("GPL"),
+            compatibility: if license.starts_with("GPL") {
+                LicenseCompatibility::Incompatible
+            } else {
+                LicenseCompatibility::Compatible
+            },
+            osi_status: OsiStatus::Approved,
+            dependency_path: path.map(|path| path.iter().map(|p| p.to_string()).collect()),
+            ..LicenseInfo::test(name, "1.0.0", Some(license))
+        }
+    }
+
+    #[test]
+    fn test_compliance_score() {
+        assert_eq!(
+            compliance_score(&[dep("serde", "MIT", None)], &[]),
+            ComplianceScore {
+                score: 100,
+                grade: 'A',
+                status: BadgeStatus::Passing,
+                penalty: 0.0,
+                findings: 0,
+            }
+        );
+
+        let deps = [
+            dep("serde", "MIT", None),
+            // Incompatible, two levels down: 8 / 2
+            dep(
+                "readline",
+                "GPL-3.0",
+                Some(&["cli@1.0.0", "readline@1.0.0"]),
+            ),
+            dep("mystery", "Unknown", Some(&["mystery@1.0.0"])),
+            dep("banned", "SSPL-1.0", None),
+        ];
+        let violations = [PolicyViolation {
+            name: "banned".to_string(),
+            version: "1.0.0".to_string(),
+            license: Some("SSPL-1.0".to_string()),
+            kind: ViolationKind::Denied,
+            introduced_by: None,
+        }];
+        let score = compliance_score(&deps, &violations);
+        assert_eq!(score.penalty, 16.0);
+        assert_eq!(score.score, 84);
+        assert_eq!(score.grade, 'B');
+        assert_eq!(score.findings, 3);
+        assert_eq!(score.status, BadgeStatus::Failing);
+
+        let score = compliance_score(&deps[2..3], &[]);
+        assert_eq!(score.status, BadgeStatus::Warnings);
+        assert_eq!(score.score, 98);
+    }
+
+    #[test]
+    fn test_badges() {
+        let score = compliance_score(&[], &[]);
+        let badge = badge_endpoint(&score);
+        assert_eq!(
+            serde_json::to_value(&badge).unwrap(),
+            serde_json::json!({
+                "schemaVersion": 1,
+                "label": "License check",
+                "message": "passing",
+                "color": "brightgreen"
+            })
+        );
+        let svg = badge_svg(&badge);
+        assert!(svg.starts_with("<svg xmlns=\"http://www.w3.org/2000/svg\""));
+        assert!(svg.contains("aria-label=\"License check: passing\""));
+        assert!(svg.contains("fill=\"#4c1\""));
+
+        let failing = compliance_score(&[dep("readline", "GPL-3.0", None)], &[]);
+        assert_eq!(badge_endpoint(&failing).message, "failing (92/100)");
+        assert_eq!(badge_endpoint(&failing).color, "red");
+    }
+}
@@ -0,0 +1,318 @@
+//! gRPC API (`feluda serve --grpc`)
+//!
+//! Implements the `feluda.v1.Feluda` service from `proto/feluda/v1/feluda.proto`
+//! with `tonic`; the build script generates the messages and the service trait.
+//! `Scan` answers with a `ScanStarted` event once projects are discovered, a
+//! `DependencyResolved` event as the license of each dependency is looked up, a
+//! `ProjectScanned` event as each project is analyzed and a final
+//! `ScanCompleted` event with the report.
+
+use std::sync::atomic::Ordering;
+use std::sync::Arc;
+use tokio::net::TcpListener;
+use tokio::sync::mpsc;
+use tokio_stream::wrappers::{TcpListenerStream, UnboundedReceiverStream};
+use tonic::transport::Server;
+use tonic::{Request, Response, Status};
+
+use super::{notify, prepare_scan_dir, run_scan, ScanRequest, ServerState, MAX_BODY_BYTES};
+use crate::debug::FeludaResult;
+use crate::licenses::LicenseInfo;
+use crate::report_json::violation_kind_name;
+use crate::scan::{ProgressCallback, Report, ScanOptions, ScanProgress};
+
+/// Messages and service generated from `proto/feluda/v1/feluda.proto`
+mod proto {
+    tonic::include_proto!("feluda.v1");
+}
+
+use proto::feluda_server::{Feluda, FeludaServer};
+use proto::scan_event::Event;
+use proto::ScanEvent;
+
+/// Serve the gRPC API on `listener` until the process exits
+pub(super) async fn serve(listener: TcpListener, state: Arc<ServerState>) -> FeludaResult<()> {
+    let service =
+        FeludaServer::new(FeludaService { state }).max_decoding_message_size(MAX_BODY_BYTES);
+    Server::builder()
+        .add_service(service)
+        .serve_with_incoming(TcpListenerStream::new(listener))
+        .await
+        .map_err(std::io::Error::other)?;
+    Ok(())
+}
+
+struct FeludaService {
+    state: Arc<ServerState>,
+}
+
+#[tonic::async_trait]
+impl Feluda for FeludaService {
+    type ScanStream = UnboundedReceiverStream<Result<ScanEvent, Status>>;
+
+    async fn scan(
+        &self,
+        request: Request<proto::ScanRequest>,
+    ) -> Result<Response<Self::ScanStream>, Status> {
+        let events = start_scan(&self.state, request.into_inner().into())?;
+        Ok(Response::new(UnboundedReceiverStream::new(events)))
+    }
+}
+
+/// Unset strings are empty in proto3
+fn non_empty(value: String) -> Option<String> {
+    (!value.is_empty()).then_some(value)
+}
+
+impl From<proto::ScanRequest> for ScanRequest {
+    fn from(request: proto::ScanRequest) -> Self {
+        Self {
+            path: non_empty(request.path),
+            files: request.files.into_iter().collect(),
+            language: non_empty(request.language),
+            project_license: non_empty(request.project_license),
+            strict: request.strict,
+            no_local: request.no_local,
+        }
+    }
+}
+
+/// Validate the request and start the scan on a blocking thread, streaming its events
+fn start_scan(
+    state: &Arc<ServerState>,
+    request: ScanRequest,
+) -> Result<mpsc::UnboundedReceiver<Result<ScanEvent, Status>>, Status> {
+    let (scan_dir, upload_dir) =
+        prepare_scan_dir(&request).map_err(|err| Status::invalid_argument(err.to_string()))?;
+
+    if !state.try_start_scan() {
+        state.metrics.scans_rejected.fetch_add(1, Ordering::Relaxed);
+        return Err(Status::resource_exhausted(
+            "Too many scans in progress, retry later",
+        ));
+    }
+
+    let (sender, receiver) = mpsc::unbounded_channel();
+    let progress_sender = sender.clone();
+    let options = ScanOptions {
+        language: request.language,
+        project_license: request.project_license,
+        strict: request.strict,
+        no_local: request.no_local,
+        config: Some(state.config.clone()),
+        progress: Some(ProgressCallback::new(move |progress| {
+            // The client may have gone away; the scan still finishes and frees its slot
+            let _ = progress_sender.send(Ok(progress_event(progress)));
+        })),
+        ..ScanOptions::default()
+    };
+
+    let id = uuid::Uuid::new_v4().to_string();
+    let state = Arc::clone(state);
+    tokio::task::spawn_blocking(move || {
+        match run_scan(&state, &id, &scan_dir, &options) {
+            Ok(report) => {
+                let _ = sender.send(Ok(completed_event(&report)));
+                notify(&state, &scan_dir, &report, upload_dir.is_some());
+            }
+            Err(err) => {
+                let _ = sender.send(Err(Status::internal(err.to_string())));
+            }
+        }
+        // Uploaded files are only needed while scanning
+        drop(upload_dir);
+    });
+
+    Ok(receiver)
+}
+
+/// Counts are `uint32` on the wire
+fn count(value: usize) -> u32 {
+    u32::try_from(value).unwrap_or(u32::MAX)
+}
+
+fn dependency(info: &LicenseInfo) -> proto::Dependency {
+    proto::Dependency {
+        name: info.name.clone(),
+        version: info.version.clone(),
+        license: info.license.clone().unwrap_or_default(),
+        is_restrictive: info.is_restrictive,
+        compatibility: info.compatibility.to_string(),
+        scope: info.scope.to_string(),
+        source_file: info.source_file.clone().unwrap_or_default(),
+        dependency_path: info.dependency_path.clone().unwrap_or_default(),
+        manually_asserted: info.is_manually_asserted(),
+    }
+}
+
+/// `ScanEvent` with `started`, `dependency` or `project` set
+fn progress_event(progress: &ScanProgress) -> ScanEvent {
+    let event = match progress {
+        ScanProgress::Started { projects } => Event::Started(proto::ScanStarted {
+            projects: count(*projects),
+        }),
+        ScanProgress::DependencyResolved {
+            ecosystem,
+            name,
+            version,
+            resolved,
+        } => Event::Dependency(proto::DependencyResolved {
+            ecosystem: ecosystem.to_string(),
+            name: name.to_string(),
+            version: version.to_string(),
+            resolved: count(*resolved),
+        }),
+        ScanProgress::ProjectScanned {
+            manifest,
+            dependencies,
+            error,
+            completed,
+            total,
+            ..
+        } => Event::Project(proto::ProjectScanned {
+            manifest: manifest.unwrap_or_default().to_string(),
+            completed: count(*completed),
+            total: count(*total),
+            dependencies: dependencies.iter().map(dependency).collect(),
+            error: error.clone().unwrap_or_default(),
+        }),
+    };
+    ScanEvent { event: Some(event) }
+}
+
+/// `ScanEvent` with `completed` set
+fn completed_event(report: &Report) -> ScanEvent {
+    let completed = proto::ScanCompleted {
+        project_license: report.project_license.clone().unwrap_or_default(),
+        dependencies: report.dependencies.iter().map(dependency).collect(),
+        policy_violations: report
+            .policy_violations
+            .iter()
+            .map(|violation| proto::PolicyViolation {
+                name: violation.name.clone(),
+                version: violation.version.clone(),
+                license: violation.license.clone().unwrap_or_default(),
+                kind: violation_kind_name(&violation.kind).to_string(),
+            })
+            .collect(),
+    };
+    ScanEvent {
+        event: Some(Event::Completed(completed)),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::FeludaConfig;
+    use tempfile::TempDir;
+    use tokio_stream::StreamExt;
+    use tonic::Code;
+
+    fn service(max_scans: usize) -> FeludaService {
+        FeludaService {
+            state: Arc::new(ServerState::new(FeludaConfig::default(), max_scans)),
+        }
+    }
+
+    #[test]
+    fn test_scan_request_from_proto() {
+        let request = ScanRequest::from(proto::ScanRequest {
+            files: [("Cargo.lock".to_string(), "version = 3".to_string())].into(),
+            language: "rust".to_string(),
+            strict: true,
+            ..Default::default()
+        });
+        assert_eq!(request.path, None);
+        assert_eq!(request.files["Cargo.lock"], "version = 3");
+        assert_eq!(request.language.as_deref(), Some("rust"));
+        assert_eq!(request.project_license, None);
+        assert!(request.strict);
+        assert!(!request.no_local);
+    }
+
+    #[test]
+    fn test_progress_events() {
+        assert_eq!(
+            progress_event(&ScanProgress::Started { projects: 3 }).event,
+            Some(Event::Started(proto::ScanStarted { projects: 3 }))
+        );
+        assert_eq!(
+            progress_event(&ScanProgress::DependencyResolved {
+                ecosystem: "npm",
+                name: "left-pad",
+                version: "1.3.0",
+                resolved: 2,
+            })
+            .event,
+            Some(Event::Dependency(proto::DependencyResolved {
+                ecosystem: "npm".to_string(),
+                name: "left-pad".to_string(),
+                version: "1.3.0".to_string(),
+                resolved: 2,
+            }))
+        );
+        assert_eq!(count(usize::MAX), u32::MAX);
+    }
+
+    #[test]
+    fn test_scan_call() {
+        let temp_dir = TempDir::new().unwrap();
+        std::fs::write(temp_dir.path().join("requirements.txt"), "").unwrap();
+        let runtime = tokio::runtime::Runtime::new().unwrap();
+
+        runtime.block_on(async {
+            let response = service(1)
+                .scan(Request::new(proto::ScanRequest {
+                    path: temp_dir.path().to_string_lossy().into_owned(),
+                    project_license: "MIT".to_string(),
+                    ..Default::default()
+                }))
+                .await;
+            let Ok(response) = response else {
+                panic!("scan was rejected");
+            };
+            let events: Vec<_> = response.into_inner().collect().await;
+            let events: Vec<_> = events
+                .into_iter()
+                .map(|event| event.unwrap().event.unwrap())
+                .collect();
+            assert_eq!(events.len(), 3);
+            assert_eq!(
+                events[0],
+                Event::Started(proto::ScanStarted { projects: 1 })
+            );
+            let Event::Project(project) = &events[1] else {
+                panic!("expected a project event, got {:?}", events[1]);
+            };
+            assert_eq!(project.manifest, "requirements.txt");
+            assert_eq!((project.completed, project.total), (1, 1));
+            let Event::Completed(completed) = &events[2] else {
+                panic!("expected the report, got {:?}", events[2]);
+            };
+            assert_eq!(completed.project_license, "MIT");
+        });
+    }
+
+    #[test]
+    fn test_scan_call_errors() {
+        let runtime = tokio::runtime::Runtime::new().unwrap();
+        runtime.block_on(async {
+            let scan = |service: FeludaService, path: &str| {
+                let request = Request::new(proto::ScanRequest {
+                    path: path.to_string(),
+                    ..Default::default()
+                });
+                async move { service.scan(request).await.err().unwrap() }
+            };
+
+            let status = scan(service(1), "/nonexistent/feluda-grpc-test").await;
+            assert_eq!(status.code(), Code::InvalidArgument);
+            assert!(status.message().contains("Path is not a directory"));
+
+            let temp_dir = TempDir::new().unwrap();
+            let status = scan(service(0), &temp_dir.path().to_string_lossy()).await;
+            assert_eq!(status.code(), Code::ResourceExhausted);
+        });
+    }
+}
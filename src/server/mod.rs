@@ -0,0 +1,1004 @@
+//! HTTP server mode (`feluda serve`)
+//!
+//! An HTTP/1.1 server on top of `hyper` so platforms can request license
+//! reports without running the CLI themselves:
+//!
+//! - `POST /scan` starts a scan of a directory on the server (`{"path": "..."}`)
+//!   or of uploaded manifests and lockfiles (`{"files": {"Cargo.lock": "..."}}`)
+//!   and answers `202 Accepted` with the report id
+//! - `GET /report/{id}` returns the scan status and, once completed, the report
+//! - `GET /badge/{id}` returns a shields.io endpoint badge of the scan's
+//!   [compliance score](crate::score), `GET /badge/{id}.svg` the badge itself
+//! - `GET /healthz` and `GET /readyz` for liveness and readiness probes
+//! - `GET /metrics` exposes Prometheus metrics: scans, package cache lookups and
+//!   registry requests
+//!
+//! Up to `MAX_CONNECTIONS` connections are served at a time, each for at most
+//! `CONNECTION_TIMEOUT`, and requests are handled and scans run on the blocking
+//! threads of the runtime. Reports are kept in memory, up to `MAX_STORED_REPORTS`.
+//!
+//! With `--grpc`, the [`grpc`] service streams the results of a scan as each
+//! dependency is resolved and each project analyzed. It runs on the same tokio
+//! runtime, and both share the scan slots and metrics. Scans are traced with
+//! OpenTelemetry when an OTLP endpoint is configured ([`telemetry`]).
+
+mod grpc;
+mod telemetry;
+
+use http_body_util::{BodyExt, Full, LengthLimitError, Limited};
+use hyper::body::{Body as _, Bytes, Incoming};
+use hyper::server::conn::http1;
+use hyper::service::service_fn;
+use hyper_util::rt::{TokioIo, TokioTimer};
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap, VecDeque};
+use std::convert::Infallible;
+use std::fmt::Write as _;
+use std::fs;
+use std::net::TcpListener;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::{Duration, Instant};
+use tempfile::TempDir;
+use tokio::sync::Semaphore;
+
+use crate::baseline::find_baseline;
+use crate::config::{load_config, FeludaConfig};
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::notify::{known_licenses, send_notifications, KnownLicenses, ScanResult};
+use crate::scan::{scan, Report, ScanOptions};
+use crate::score::{badge_endpoint, badge_svg, compliance_score, status_badge_endpoint};
+use telemetry::{ScanTrace, Tracer};
+
+const MAX_HEADER_BYTES: usize = 64 * 1024;
+const MAX_BODY_BYTES: usize = 16 * 1024 * 1024;
+const MAX_STORED_REPORTS: usize = 1000;
+const MAX_CONNECTIONS: usize = 256;
+/// Time a client has to send the headers and the body of its request
+const READ_TIMEOUT: Duration = Duration::from_secs(30);
+/// Time after which a connection is closed, whether or not it is still in use
+const CONNECTION_TIMEOUT: Duration = Duration::from_secs(60);
+
+/// Body of `POST /scan`
+#[derive(Deserialize, Debug, Default)]
+#[serde(deny_unknown_fields)]
+struct ScanRequest {
+    /// Directory on the server to scan
+    path: Option<String>,
+    /// Uploaded files by name, e.g. `package.json` and `package-lock.json`
+    #[serde(default)]
+    files: BTreeMap<String, String>,
+    language: Option<String>,
+    project_license: Option<String>,
+    #[serde(default)]
+    strict: bool,
+    #[serde(default)]
+    no_local: bool,
+}
+
+/// State of a scan requested through the API
+#[derive(Serialize, Debug, Clone)]
+#[serde(tag = "status", rename_all = "snake_case")]
+enum Job {
+    Running,
+    Completed { report: Report },
+    Failed { error: String },
+}
+
+#[derive(Serialize)]
+struct JobView<'a> {
+    id: &'a str,
+    #[serde(flatten)]
+    job: &'a Job,
+}
+
+#[derive(Default)]
+struct Jobs {
+    by_id: HashMap<String, Job>,
+    /// Insertion order, oldest first, for evicting old reports
+    order: VecDeque<String>,
+}
+
+impl Jobs {
+    fn insert(&mut self, id: String, job: Job) {
+        if self.order.len() >= MAX_STORED_REPORTS {
+            if let Some(oldest) = self.order.pop_front() {
+                self.by_id.remove(&oldest);
+            }
+        }
+        self.order.push_back(id.clone());
+        self.by_id.insert(id, job);
+    }
+
+    /// Record the outcome of a scan unless its entry was already evicted
+    fn finish(&mut self, id: &str, job: Job) {
+        if let Some(entry) = self.by_id.get_mut(id) {
+            *entry = job;
+        }
+    }
+}
+
+#[derive(Default)]
+struct Metrics {
+    scans_completed: AtomicU64,
+    scans_failed: AtomicU64,
+    scans_rejected: AtomicU64,
+    scan_duration_ms: AtomicU64,
+    dependencies_scanned: AtomicU64,
+    http_requests: Mutex<BTreeMap<(&'static str, u16), u64>>,
+}
+
+struct ServerState {
+    config: FeludaConfig,
+    max_scans: usize,
+    running_scans: AtomicUsize,
+    jobs: Mutex<Jobs>,
+    metrics: Metrics,
+    tracer: Option<Tracer>,
+    /// Dependencies of the last scan of each directory, for `only_new` notifications
+    last_scans: Mutex<HashMap<PathBuf, KnownLicenses>>,
+}
+
+impl ServerState {
+    fn new(config: FeludaConfig, max_scans: usize) -> Self {
+        Self {
+            config,
+            max_scans,
+            running_scans: AtomicUsize::new(0),
+            jobs: Mutex::new(Jobs::default()),
+            metrics: Metrics::default(),
+            tracer: None,
+            last_scans: Mutex::new(HashMap::new()),
+        }
+    }
+
+    /// Reserve a slot for a new scan, failing when `max_scans` are already running
+    fn try_start_scan(&self) -> bool {
+        self.running_scans
+            .fetch_update(Ordering::SeqCst, Ordering::SeqCst, |running| {
+                (running < self.max_scans).then_some(running + 1)
+            })
+            .is_ok()
+    }
+
+    fn is_ready(&self) -> bool {
+        self.running_scans.load(Ordering::SeqCst) < self.max_scans
+    }
+}
+
+#[derive(Debug)]
+struct Request {
+    method: String,
+    path: String,
+    body: Vec<u8>,
+}
+
+#[derive(Debug)]
+struct Response {
+    status: u16,
+    content_type: &'static str,
+    headers: Vec<(&'static str, String)>,
+    body: String,
+}
+
+impl Response {
+    fn json(status: u16, value: &impl Serialize) -> Self {
+        match serde_json::to_string_pretty(value) {
+            Ok(body) => Self::with_body(status, "application/json", body),
+            Err(err) => Self::error(500, &format!("Failed to serialize response: {err}")),
+        }
+    }
+
+    fn error(status: u16, message: &str) -> Self {
+        let body = serde_json::json!({ "error": message }).to_string();
+        Self::with_body(status, "application/json", body)
+    }
+
+    fn text(status: u16, body: impl Into<String>) -> Self {
+        Self::with_body(status, "text/plain; charset=utf-8", body.into())
+    }
+
+    fn with_body(status: u16, content_type: &'static str, body: String) -> Self {
+        Self {
+            status,
+            content_type,
+            headers: Vec::new(),
+            body,
+        }
+    }
+}
+
+impl From<Response> for hyper::Response<Full<Bytes>> {
+    fn from(response: Response) -> Self {
+        let mut builder = hyper::Response::builder()
+            .status(response.status)
+            .header(hyper::header::CONTENT_TYPE, response.content_type);
+        for (name, value) in &response.headers {
+            builder = builder.header(*name, value);
+        }
+        builder
+            .body(Full::new(Bytes::from(response.body)))
+            .unwrap_or_else(|err| {
+                let mut response = hyper::Response::new(Full::new(Bytes::from(err.to_string())));
+                *response.status_mut() = hyper::StatusCode::INTERNAL_SERVER_ERROR;
+                response
+            })
+    }
+}
+
+/// Handle `feluda serve`
+pub fn handle_serve_command(
+    addr: &str,
+    grpc_addr: Option<&str>,
+    otlp_endpoint: Option<&str>,
+    max_scans: usize,
+) -> FeludaResult<()> {
+    // Load the configuration once so a broken .feluda.toml fails at startup
+    let config = load_config()?;
+    let listener = TcpListener::bind(addr)?;
+    let grpc_listener = grpc_addr.map(TcpListener::bind).transpose()?;
+    let mut state = ServerState::new(config, max_scans.max(1));
+    state.tracer = Tracer::new(otlp_endpoint);
+    let state = Arc::new(state);
+
+    let runtime = tokio::runtime::Builder::new_multi_thread()
+        .enable_all()
+        .build()?;
+    runtime.block_on(async {
+        if let Some(grpc_listener) = grpc_listener {
+            grpc_listener.set_nonblocking(true)?;
+            let grpc_listener = tokio::net::TcpListener::from_std(grpc_listener)?;
+            println!(
+                "Feluda gRPC server listening on {}",
+                grpc_listener.local_addr()?
+            );
+            let grpc_state = Arc::clone(&state);
+            tokio::spawn(async move {
+                if let Err(err) = grpc::serve(grpc_listener, grpc_state).await {
+                    log_error("gRPC server stopped", &err);
+                }
+            });
+        }
+
+        listener.set_nonblocking(true)?;
+        let listener = tokio::net::TcpListener::from_std(listener)?;
+        println!(
+            "Feluda server listening on http://{}",
+            listener.local_addr()?
+        );
+        log(
+            LogLevel::Info,
+            &format!("Serving scans on {addr} with up to {max_scans} concurrent scans"),
+        );
+        serve(listener, state).await;
+        Ok(())
+    })
+}
+
+/// Accept connections on `listener` until the process exits
+async fn serve(listener: tokio::net::TcpListener, state: Arc<ServerState>) {
+    // Further connections wait in the listen backlog until one is closed
+    let connections = Arc::new(Semaphore::new(MAX_CONNECTIONS));
+    loop {
+        let Ok(permit) = Arc::clone(&connections).acquire_owned().await else {
+            return;
+        };
+        let stream = match listener.accept().await {
+            Ok((stream, _)) => stream,
+            Err(err) => {
+                log_error("Failed to accept connection", &err);
+                continue;
+            }
+        };
+        let state = Arc::clone(&state);
+        tokio::spawn(async move {
+            let service = service_fn(move |request| handle_request(Arc::clone(&state), request));
+            let connection = http1::Builder::new()
+                .timer(TokioTimer::new())
+                .header_read_timeout(READ_TIMEOUT)
+                .max_buf_size(MAX_HEADER_BYTES)
+                .keep_alive(false)
+                .serve_connection(TokioIo::new(stream), service);
+            match tokio::time::timeout(CONNECTION_TIMEOUT, connection).await {
+                Ok(Ok(())) => {}
+                Ok(Err(err)) => log_error("Failed to serve connection", &err),
+                Err(_) => log(LogLevel::Warn, "Closed a connection that timed out"),
+            }
+            drop(permit);
+        });
+    }
+}
+
+async fn handle_request(
+    state: Arc<ServerState>,
+    request: hyper::Request<Incoming>,
+) -> Result<hyper::Response<Full<Bytes>>, Infallible> {
+    let (label, response) = match read_request(request).await {
+        Ok(request) => {
+            let label = route_label(&request.path);
+            let route_state = Arc::clone(&state);
+            // Routes write uploads and serialize reports, which would hold up other connections
+            let response = tokio::task::spawn_blocking(move || route(&route_state, &request))
+                .await
+                .unwrap_or_else(|err| Response::error(500, &err.to_string()));
+            (label, response)
+        }
+        Err(response) => ("invalid", response),
+    };
+
+    if let Ok(mut requests) = state.metrics.http_requests.lock() {
+        *requests.entry((label, response.status)).or_default() += 1;
+    }
+    Ok(response.into())
+}
+
+/// Read the body of a request, answering with an error response on bad input
+async fn read_request(request: hyper::Request<Incoming>) -> Result<Request, Response> {
+    let method = request.method().to_string();
+    let path = request.uri().path().to_string();
+    let body = request.into_body();
+    // Larger declared lengths are refused before a byte of the body is read
+    if body.size_hint().lower() > MAX_BODY_BYTES as u64 {
+        return Err(Response::error(413, "Request body is too large"));
+    }
+    let body = Limited::new(body, MAX_BODY_BYTES).collect();
+    let body = match tokio::time::timeout(READ_TIMEOUT, body).await {
+        Ok(Ok(body)) => body.to_bytes().to_vec(),
+        Ok(Err(err)) if err.is::<LengthLimitError>() => {
+            return Err(Response::error(413, "Request body is too large"));
+        }
+        Ok(Err(err)) => {
+            return Err(Response::error(
+                400,
+                &format!("Failed to read request body: {err}"),
+            ))
+        }
+        Err(_) => return Err(Response::error(408, "Timed out reading the request body")),
+    };
+    Ok(Request { method, path, body })
+}
+
+/// Route label for metrics, without request-specific parts such as report ids
+fn route_label(path: &str) -> &'static str {
+    match path {
+        "/scan" => "/scan",
+        "/healthz" => "/healthz",
+        "/readyz" => "/readyz",
+        "/metrics" => "/metrics",
+        _ if path.starts_with("/report/") => "/report/{id}",
+        _ if path.starts_with("/badge/") => "/badge/{id}",
+        _ => "other",
+    }
+}
+
+fn route(state: &Arc<ServerState>, request: &Request) -> Response {
+    let method = request.method.as_str();
+    let response = if let Some(id) = request.path.strip_prefix("/report/") {
+        match method {
+            "GET" => get_report(state, id),
+            _ => Response::error(405, "Method not allowed"),
+        }
+    } else if let Some(id) = request.path.strip_prefix("/badge/") {
+        match method {
+            "GET" => get_badge(state, id),
+            _ => Response::error(405, "Method not allowed"),
+        }
+    } else {
+        match (method, request.path.as_str()) {
+            ("POST", "/scan") => start_scan(state, &request.body),
+            ("GET", "/healthz") => Response::text(200, "ok\n"),
+            ("GET", "/readyz") if state.is_ready() => Response::text(200, "ready\n"),
+            ("GET", "/readyz") => Response::text(503, "all scan slots are busy\n"),
+            ("GET", "/metrics") => Response::with_body(
+                200,
+                "text/plain; version=0.0.4; charset=utf-8",
+                render_metrics(state),
+            ),
+            (_, "/scan" | "/healthz" | "/readyz" | "/metrics") => {
+                Response::error(405, "Method not allowed")
+            }
+            _ => Response::error(404, "Not found"),
+        }
+    };
+
+    log(
+        LogLevel::Info,
+        &format!("{} {} -> {}", request.method, request.path, response.status),
+    );
+    response
+}
+
+fn start_scan(state: &Arc<ServerState>, body: &[u8]) -> Response {
+    let request: ScanRequest = match serde_json::from_slice(body) {
+        Ok(request) => request,
+        Err(err) => return Response::error(400, &format!("Invalid scan request: {err}")),
+    };
+
+    let (scan_dir, upload_dir) = match prepare_scan_dir(&request) {
+        Ok(dirs) => dirs,
+        Err(err) => return Response::error(400, &err.to_string()),
+    };
+
+    if !state.try_start_scan() {
+        state.metrics.scans_rejected.fetch_add(1, Ordering::Relaxed);
+        return Response::error(503, "Too many scans in progress, retry later");
+    }
+
+    let id = uuid::Uuid::new_v4().to_string();
+    if let Ok(mut jobs) = state.jobs.lock() {
+        jobs.insert(id.clone(), Job::Running);
+    }
+
+    let options = ScanOptions {
+        language: request.language,
+        project_license: request.project_license,
+        strict: request.strict,
+        no_local: request.no_local,
+        config: Some(state.config.clone()),
+        ..ScanOptions::default()
+    };
+    let job_state = Arc::clone(state);
+    let job_id = id.clone();
+    let uploaded = upload_dir.is_some();
+    tokio::task::spawn_blocking(move || {
+        run_job(&job_state, &job_id, &scan_dir, &options, uploaded);
+        // Uploaded files are only needed while scanning
+        drop(upload_dir);
+    });
+
+    let mut response = Response::json(
+        202,
+        &JobView {
+            id: &id,
+            job: &Job::Running,
+        },
+    );
+    response.headers.push(("Location", format!("/report/{id}")));
+    response
+}
+
+/// Resolve the directory to scan, writing uploaded files to a temporary directory
+fn prepare_scan_dir(request: &ScanRequest) -> FeludaResult<(PathBuf, Option<TempDir>)> {
+    match (&request.path, request.files.is_empty()) {
+        (Some(_), false) => Err(FeludaError::InvalidData(
+            "Specify either 'path' or 'files', not both".to_string(),
+        )),
+        (None, true) => Err(FeludaError::InvalidData(
+            "Specify a 'path' to scan or upload 'files'".to_string(),
+        )),
+        (Some(path), true) => {
+            let path = PathBuf::from(path);
+            if !path.is_dir() {
+                return Err(FeludaError::InvalidData(format!(
+                    "Path is not a directory: {}",
+                    path.display()
+                )));
+            }
+            Ok((path, None))
+        }
+        (None, false) => {
+            let temp_dir = TempDir::new()
+                .map_err(|e| FeludaError::TempDir(format!("Failed to create upload dir: {e}")))?;
+            for (name, content) in &request.files {
+                if !is_plain_file_name(name) {
+                    return Err(FeludaError::InvalidData(format!(
+                        "Invalid file name: {name}"
+                    )));
+                }
+                fs::write(temp_dir.path().join(name), content)?;
+            }
+            Ok((temp_dir.path().to_path_buf(), Some(temp_dir)))
+        }
+    }
+}
+
+/// Uploaded files are written flat into the upload directory
+fn is_plain_file_name(name: &str) -> bool {
+    !name.is_empty()
+        && name != "."
+        && name != ".."
+        && !name.contains(['/', '\\'])
+        && Path::new(name).file_name().is_some()
+}
+
+/// Run a scan in a slot reserved with [`ServerState::try_start_scan`], releasing it afterwards
+fn run_scan(
+    state: &ServerState,
+    id: &str,
+    path: &Path,
+    options: &ScanOptions,
+) -> FeludaResult<Report> {
+    log(
+        LogLevel::Info,
+        &format!("Starting scan {id} of {}", path.display()),
+    );
+    let started = Instant::now();
+    let trace = state.tracer.as_ref().map(|_| ScanTrace::start(id, path));
+    let result = match &trace {
+        Some(trace) => {
+            let mut options = options.clone();
+            options.progress = Some(trace.progress(options.progress.take()));
+            scan(path, &options)
+        }
+        None => scan(path, options),
+    };
+
+    let metrics = &state.metrics;
+    metrics
+        .scan_duration_ms
+        .fetch_add(started.elapsed().as_millis() as u64, Ordering::Relaxed);
+    match &result {
+        Ok(report) => {
+            metrics.scans_completed.fetch_add(1, Ordering::Relaxed);
+            metrics
+                .dependencies_scanned
+                .fetch_add(report.dependencies.len() as u64, Ordering::Relaxed);
+        }
+        Err(err) => {
+            log_error(&format!("Scan {id} failed"), err);
+            metrics.scans_failed.fetch_add(1, Ordering::Relaxed);
+        }
+    }
+    state.running_scans.fetch_sub(1, Ordering::SeqCst);
+
+    if let (Some(tracer), Some(trace)) = (&state.tracer, &trace) {
+        tracer.export(trace, trace.finish(&result));
+    }
+    result
+}
+
+/// Send the `[[notifications]]` of the server configuration about a finished scan
+///
+/// Scans of a directory on the server are compared with the last scan of that
+/// directory and use its baseline, uploaded files have neither.
+fn notify(state: &ServerState, path: &Path, report: &Report, uploaded: bool) {
+    if state.config.notifications.is_empty() {
+        return;
+    }
+    let (previous, baseline) = if uploaded {
+        (None, None)
+    } else {
+        let previous = state.last_scans.lock().ok().and_then(|mut scans| {
+            scans.insert(path.to_path_buf(), known_licenses(&report.dependencies))
+        });
+        let baseline = find_baseline(path, None).unwrap_or_else(|err| {
+            log_error("Failed to read the baseline for notifications", &err);
+            None
+        });
+        (previous, baseline)
+    };
+    send_notifications(
+        &state.config.notifications,
+        &ScanResult {
+            path,
+            project_license: report.project_license.as_deref(),
+            dependencies: &report.dependencies,
+            policy_violations: &report.policy_violations,
+            baseline: baseline.as_ref(),
+            previous: previous.as_ref(),
+        },
+    );
+}
+
+/// Run a scan started through `POST /scan` and store its outcome
+fn run_job(state: &ServerState, id: &str, path: &Path, options: &ScanOptions, uploaded: bool) {
+    let job = match run_scan(state, id, path, options) {
+        Ok(report) => {
+            notify(state, path, &report, uploaded);
+            Job::Completed { report }
+        }
+        Err(err) => Job::Failed {
+            error: err.to_string(),
+        },
+    };
+
+    if let Ok(mut jobs) = state.jobs.lock() {
+        jobs.finish(id, job);
+    }
+}
+
+fn get_report(state: &ServerState, id: &str) -> Response {
+    let Ok(jobs) = state.jobs.lock() else {
+        return Response::error(500, "Report store is unavailable");
+    };
+    match jobs.by_id.get(id) {
+        Some(job) => Response::json(200, &JobView { id, job }),
+        None => Response::error(404, &format!("No report with id {id}")),
+    }
+}
+
+/// Badge of a scan, as shields.io endpoint JSON or, for `{id}.svg`, as SVG
+fn get_badge(state: &ServerState, id: &str) -> Response {
+    let (id, svg) = match id.strip_suffix(".svg") {
+        Some(id) => (id, true),
+        None => (id, false),
+    };
+    let Ok(jobs) = state.jobs.lock() else {
+        return Response::error(500, "Report store is unavailable");
+    };
+    let badge = match jobs.by_id.get(id) {
+        Some(Job::Completed { report }) => badge_endpoint(&compliance_score(
+            &report.dependencies,
+            &report.policy_violations,
+        )),
+        Some(Job::Running) => status_badge_endpoint("scanning"),
+        Some(Job::Failed { .. }) => status_badge_endpoint("error"),
+        None => return Response::error(404, &format!("No report with id {id}")),
+    };
+
+    let mut response = if svg {
+        Response::with_body(200, "image/svg+xml", badge_svg(&badge))
+    } else {
+        Response::json(200, &badge)
+    };
+    // Keep image proxies such as GitHub's from showing a stale status
+    response
+        .headers
+        .push(("Cache-Control", "no-cache, max-age=0".to_string()));
+    response
+}
+
+/// Render metrics in the Prometheus text exposition format
+fn render_metrics(state: &ServerState) -> String {
+    let metrics = &state.metrics;
+    let completed = metrics.scans_completed.load(Ordering::Relaxed);
+    let failed = metrics.scans_failed.load(Ordering::Relaxed);
+    let mut out = String::new();
+
+    let _ = writeln!(out, "# HELP feluda_scans_total Scans finished, by outcome.");
+    let _ = writeln!(out, "# TYPE feluda_scans_total counter");
+    let _ = writeln!(
+        out,
+        "feluda_scans_total{{status=\"completed\"}} {completed}"
+    );
+    let _ = writeln!(out, "feluda_scans_total{{status=\"failed\"}} {failed}");
+    let _ = writeln!(
+        out,
+        "# HELP feluda_scans_rejected_total Scans rejected because all slots were busy."
+    );
+    let _ = writeln!(out, "# TYPE feluda_scans_rejected_total counter");
+    let _ = writeln!(
+        out,
+        "feluda_scans_rejected_total {}",
+        metrics.scans_rejected.load(Ordering::Relaxed)
+    );
+    let _ = writeln!(out, "# HELP feluda_scans_running Scans currently running.");
+    let _ = writeln!(out, "# TYPE feluda_scans_running gauge");
+    let _ = writeln!(
+        out,
+        "feluda_scans_running {}",
+        state.running_scans.load(Ordering::SeqCst)
+    );
+    let _ = writeln!(
+        out,
+        "# HELP feluda_scan_duration_seconds Time spent scanning."
+    );
+    let _ = writeln!(out, "# TYPE feluda_scan_duration_seconds summary");
+    let _ = writeln!(
+        out,
+        "feluda_scan_duration_seconds_sum {}",
+        metrics.scan_duration_ms.load(Ordering::Relaxed) as f64 / 1000.0
+    );
+    let _ = writeln!(
+        out,
+        "feluda_scan_duration_seconds_count {}",
+        completed + failed
+    );
+    let _ = writeln!(
+        out,
+        "# HELP feluda_dependencies_scanned_total Dependencies analyzed by completed scans."
+    );
+    let _ = writeln!(out, "# TYPE feluda_dependencies_scanned_total counter");
+    let _ = writeln!(
+        out,
+        "feluda_dependencies_scanned_total {}",
+        metrics.dependencies_scanned.load(Ordering::Relaxed)
+    );
+    let (cache_hits, cache_misses) = crate::cache::package_cache_stats();
+    let _ = writeln!(
+        out,
+        "# HELP feluda_package_cache_lookups_total Package license cache lookups, by result."
+    );
+    let _ = writeln!(out, "# TYPE feluda_package_cache_lookups_total counter");
+    let _ = writeln!(
+        out,
+        "feluda_package_cache_lookups_total{{result=\"hit\"}} {cache_hits}"
+    );
+    let _ = writeln!(
+        out,
+        "feluda_package_cache_lookups_total{{result=\"miss\"}} {cache_misses}"
+    );
+
+    let registries = crate::registry::registry_stats();
+    let _ = writeln!(
+        out,
+        "# HELP feluda_registry_requests_total Requests sent to package registries, retries included."
+    );
+    let _ = writeln!(out, "# TYPE feluda_registry_requests_total counter");
+    for (registry, stats) in &registries {
+        let _ = writeln!(
+            out,
+            "feluda_registry_requests_total{{registry=\"{}\"}} {}",
+            registry.label(),
+            stats.requests
+        );
+    }
+    let _ = writeln!(
+        out,
+        "# HELP feluda_registry_errors_total Registry requests that failed, timed out or got a 429 or 5xx response."
+    );
+    let _ = writeln!(out, "# TYPE feluda_registry_errors_total counter");
+    for (registry, stats) in &registries {
+        let _ = writeln!(
+            out,
+            "feluda_registry_errors_total{{registry=\"{}\"}} {}",
+            registry.label(),
+            stats.errors
+        );
+    }
+    let _ = writeln!(
+        out,
+        "# HELP feluda_registry_request_duration_seconds Time spent waiting for registries."
+    );
+    let _ = writeln!(
+        out,
+        "# TYPE feluda_registry_request_duration_seconds summary"
+    );
+    for (registry, stats) in &registries {
+        let _ = writeln!(
+            out,
+            "feluda_registry_request_duration_seconds_sum{{registry=\"{}\"}} {}",
+            registry.label(),
+            stats.duration.as_secs_f64()
+        );
+        let _ = writeln!(
+            out,
+            "feluda_registry_request_duration_seconds_count{{registry=\"{}\"}} {}",
+            registry.label(),
+            stats.requests
+        );
+    }
+
+    let sources = crate::registry::source_health();
+    if !sources.is_empty() {
+        let _ = writeln!(
+            out,
+            "# HELP feluda_registry_source_up Whether a source of [registries.sources] is used, 0 while it is skipped after repeated failures."
+        );
+        let _ = writeln!(out, "# TYPE feluda_registry_source_up gauge");
+        for (url, health) in &sources {
+            let _ = writeln!(
+                out,
+                "feluda_registry_source_up{{source=\"{url}\"}} {}",
+                u8::from(health.is_up())
+            );
+        }
+        let _ = writeln!(
+            out,
+            "# HELP feluda_registry_source_failures_total Requests to a source of [registries.sources] that failed after their retries."
+        );
+        let _ = writeln!(out, "# TYPE feluda_registry_source_failures_total counter");
+        for (url, health) in &sources {
+            let _ = writeln!(
+                out,
+                "feluda_registry_source_failures_total{{source=\"{url}\"}} {}",
+                health.failures
+            );
+        }
+    }
+
+    let _ = writeln!(
+        out,
+        "# HELP feluda_http_requests_total HTTP requests, by route and status code."
+    );
+    let _ = writeln!(out, "# TYPE feluda_http_requests_total counter");
+    if let Ok(requests) = metrics.http_requests.lock() {
+        for ((route, code), count) in requests.iter() {
+            let _ = writeln!(
+                out,
+                "feluda_http_requests_total{{route=\"{route}\",code=\"{code}\"}} {count}"
+            );
+        }
+    }
+
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::io::{Read, Write};
+
+    fn state() -> Arc<ServerState> {
+        Arc::new(ServerState::new(FeludaConfig::default(), 2))
+    }
+
+    fn request(method: &str, path: &str, body: &str) -> Request {
+        Request {
+            method: method.to_string(),
+            path: path.to_string(),
+            body: body.as_bytes().to_vec(),
+        }
+    }
+
+    /// Serve on a free local port of a runtime of its own
+    fn start_server(state: &Arc<ServerState>) -> (tokio::runtime::Runtime, std::net::SocketAddr) {
+        let runtime = tokio::runtime::Runtime::new().unwrap();
+        let listener = runtime
+            .block_on(tokio::net::TcpListener::bind("127.0.0.1:0"))
+            .unwrap();
+        let addr = listener.local_addr().unwrap();
+        runtime.spawn(serve(listener, Arc::clone(state)));
+        (runtime, addr)
+    }
+
+    /// Send `raw` as the whole request and read the response until the server closes
+    fn send(addr: std::net::SocketAddr, raw: &str) -> String {
+        let mut stream = std::net::TcpStream::connect(addr).unwrap();
+        stream.write_all(raw.as_bytes()).unwrap();
+        let mut response = String::new();
+        stream.read_to_string(&mut response).unwrap();
+        response
+    }
+
+    #[test]
+    fn test_serve_http() {
+        let state = state();
+        let (_runtime, addr) = start_server(&state);
+
+        let response = send(
+            addr,
+            "GET /healthz?verbose=1 HTTP/1.1\r\nHost: localhost\r\n\r\n",
+        );
+        assert!(response.starts_with("HTTP/1.1 200 OK\r\n"), "{response}");
+        assert!(response
+            .to_ascii_lowercase()
+            .contains("content-length: 3\r\n"));
+        assert!(response.ends_with("\r\n\r\nok\n"));
+
+        // Chunked bodies are read like any other
+        let response = send(
+            addr,
+            "POST /scan HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n2\r\n{}\r\n0\r\n\r\n",
+        );
+        assert!(
+            response.starts_with("HTTP/1.1 400 Bad Request\r\n"),
+            "{response}"
+        );
+        assert!(response.contains("Specify a 'path' to scan or upload 'files'"));
+
+        let too_large = format!(
+            "POST /scan HTTP/1.1\r\nHost: localhost\r\nContent-Length: {}\r\n\r\n",
+            MAX_BODY_BYTES + 1
+        );
+        let response = send(addr, &too_large);
+        assert!(
+            response.starts_with("HTTP/1.1 413 Payload Too Large\r\n"),
+            "{response}"
+        );
+        assert!(send(addr, "garbage\r\n\r\n").starts_with("HTTP/1.1 400 Bad Request\r\n"));
+
+        let body = r#"{"files": {"notes.txt": "no manifest here"}}"#;
+        let response = send(
+            addr,
+            &format!(
+                "POST /scan HTTP/1.1\r\nHost: localhost\r\nContent-Length: {}\r\n\r\n{body}",
+                body.len()
+            ),
+        );
+        assert!(
+            response.starts_with("HTTP/1.1 202 Accepted\r\n"),
+            "{response}"
+        );
+        assert!(response.to_ascii_lowercase().contains("location: /report/"));
+
+        let metrics = render_metrics(&state);
+        assert!(metrics.contains("feluda_http_requests_total{route=\"/healthz\",code=\"200\"} 1"));
+        assert!(metrics.contains("feluda_http_requests_total{route=\"invalid\",code=\"413\"} 1"));
+    }
+
+    #[test]
+    fn test_probes_and_routing() {
+        let state = state();
+        assert_eq!(route(&state, &request("GET", "/healthz", "")).status, 200);
+        assert_eq!(route(&state, &request("GET", "/readyz", "")).status, 200);
+        assert_eq!(route(&state, &request("GET", "/scan", "")).status, 405);
+        assert_eq!(route(&state, &request("GET", "/nope", "")).status, 404);
+        assert_eq!(
+            route(&state, &request("GET", "/report/missing", "")).status,
+            404
+        );
+
+        // Readiness fails while every scan slot is taken
+        assert!(state.try_start_scan());
+        assert!(state.try_start_scan());
+        assert!(!state.try_start_scan());
+        assert_eq!(route(&state, &request("GET", "/readyz", "")).status, 503);
+    }
+
+    #[test]
+    fn test_scan_request_validation() {
+        let state = state();
+        for body in [
+            "not json",
+            "{}",
+            r#"{"path": "/", "files": {"package.json": "{}"}}"#,
+            r#"{"files": {"../package.json": "{}"}}"#,
+            r#"{"path": "/definitely/not/a/dir"}"#,
+            r#"{"path": "/", "unknown": true}"#,
+        ] {
+            let response = route(&state, &request("POST", "/scan", body));
+            assert_eq!(response.status, 400, "body: {body}");
+        }
+        assert_eq!(state.running_scans.load(Ordering::SeqCst), 0);
+    }
+
+    #[test]
+    fn test_scan_uploaded_files_and_fetch_report() {
+        let state = state();
+        // Scans run on the blocking threads of a runtime
+        let runtime = tokio::runtime::Runtime::new().unwrap();
+        let _runtime = runtime.enter();
+        let body = r#"{"files": {"notes.txt": "no manifest here"}, "project_license": "MIT"}"#;
+        let response = route(&state, &request("POST", "/scan", body));
+        assert_eq!(response.status, 202);
+
+        let accepted: serde_json::Value = serde_json::from_str(&response.body).unwrap();
+        let id = accepted["id"].as_str().unwrap().to_string();
+        assert_eq!(accepted["status"], "running");
+
+        let deadline = Instant::now() + Duration::from_secs(30);
+        let report = loop {
+            let response = route(&state, &request("GET", &format!("/report/{id}"), ""));
+            assert_eq!(response.status, 200);
+            let report: serde_json::Value = serde_json::from_str(&response.body).unwrap();
+            if report["status"] != "running" || Instant::now() > deadline {
+                break report;
+            }
+            std::thread::sleep(Duration::from_millis(50));
+        };
+
+        assert_eq!(report["status"], "completed");
+        assert_eq!(report["report"]["project_license"], "MIT");
+        assert_eq!(report["report"]["dependencies"], serde_json::json!([]));
+
+        let badge = route(&state, &request("GET", &format!("/badge/{id}"), ""));
+        assert_eq!(badge.status, 200);
+        let badge: serde_json::Value = serde_json::from_str(&badge.body).unwrap();
+        assert_eq!(badge["message"], "passing");
+        let svg = route(&state, &request("GET", &format!("/badge/{id}.svg"), ""));
+        assert_eq!(svg.content_type, "image/svg+xml");
+        assert!(svg.body.contains("License check: passing"));
+        assert_eq!(
+            route(&state, &request("GET", "/badge/missing.svg", "")).status,
+            404
+        );
+
+        let metrics = render_metrics(&state);
+        assert!(metrics.contains("feluda_scans_total{status=\"completed\"} 1"));
+        assert!(metrics.contains("feluda_scans_running 0"));
+        assert!(metrics.contains("# TYPE feluda_package_cache_lookups_total counter"));
+        assert!(metrics.contains("feluda_package_cache_lookups_total{result=\"miss\"}"));
+        assert!(metrics.contains("# TYPE feluda_registry_errors_total counter"));
+    }
+
+    #[test]
+    fn test_jobs_evict_oldest_reports() {
+        let mut jobs = Jobs::default();
+        for i in 0..=MAX_STORED_REPORTS {
+            jobs.insert(i.to_string(), Job::Running);
+        }
+        assert_eq!(jobs.by_id.len(), MAX_STORED_REPORTS);
+        assert!(!jobs.by_id.contains_key("0"));
+
+        // Finishing an evicted scan does not resurrect it
+        jobs.finish(
+            "0",
+            Job::Failed {
+                error: "late".to_string(),
+            },
+        );
+        assert!(!jobs.by_id.contains_key("0"));
+    }
+}
@@ -0,0 +1,374 @@
+//! OpenTelemetry traces of server scans (`feluda serve --otlp-endpoint`)
+//!
+//! Every scan becomes a `feluda.scan` span with a `feluda.project` child span
+//! for each analyzed manifest, so slow resolutions show up per project. Spans
+//! are exported with OTLP over HTTP using the JSON encoding once the scan
+//! finishes; export failures are logged and never fail the scan.
+//!
+//! The endpoint is the `--otlp-endpoint` option, or the standard
+//! `OTEL_EXPORTER_OTLP_TRACES_ENDPOINT` and `OTEL_EXPORTER_OTLP_ENDPOINT`
+//! variables. `OTEL_SERVICE_NAME` overrides the `feluda` service name.
+
+use reqwest::blocking::Client;
+use serde_json::{json, Value};
+use std::path::Path;
+use std::sync::{Arc, Mutex};
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+use crate::debug::{log, log_error, FeludaResult, LogLevel};
+use crate::scan::{ProgressCallback, Report, ScanProgress};
+
+const EXPORT_TIMEOUT: Duration = Duration::from_secs(10);
+
+// OTLP span kinds and status codes
+const SPAN_KIND_INTERNAL: u32 = 1;
+const SPAN_KIND_SERVER: u32 = 2;
+const STATUS_OK: u32 = 1;
+const STATUS_ERROR: u32 = 2;
+
+/// Resolve the traces URL; a base endpoint gets the `/v1/traces` path appended
+fn traces_endpoint(endpoint: Option<&str>, env: impl Fn(&str) -> Option<String>) -> Option<String> {
+    let base = |url: &str| format!("{}/v1/traces", url.trim_end_matches('/'));
+    match endpoint {
+        Some(endpoint) => Some(base(endpoint)),
+        None => env("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+            .or_else(|| env("OTEL_EXPORTER_OTLP_ENDPOINT").map(|url| base(&url))),
+    }
+    .filter(|url| !url.is_empty())
+}
+
+/// Exports the spans of finished scans
+pub(super) struct Tracer {
+    client: Client,
+    endpoint: String,
+    service_name: String,
+}
+
+impl Tracer {
+    /// Tracer for `--otlp-endpoint` or the `OTEL_*` variables, `None` when neither is set
+    pub(super) fn new(endpoint: Option<&str>) -> Option<Self> {
+        let env = |name: &str| std::env::var(name).ok().filter(|value| !value.is_empty());
+        let endpoint = traces_endpoint(endpoint, env)?;
+        let mut builder = Client::builder().timeout(EXPORT_TIMEOUT);
+        if let Some(proxy) = crate::registry::configured_proxy() {
+            builder = builder.proxy(proxy);
+        }
+        let client = builder.build().unwrap_or_else(|_| Client::new());
+        log(
+            LogLevel::Info,
+            &format!("Exporting scan traces to {endpoint}"),
+        );
+        Some(Self {
+            client,
+            endpoint,
+            service_name: env("OTEL_SERVICE_NAME").unwrap_or_else(|| "feluda".to_string()),
+        })
+    }
+
+    pub(super) fn export(&self, trace: &ScanTrace, spans: Vec<Span>) {
+        let spans: Vec<Value> = spans
+            .iter()
+            .map(|span| span.to_json(&trace.trace_id))
+            .collect();
+        let result = self
+            .client
+            .post(&self.endpoint)
+            .json(&payload(&self.service_name, spans))
+            .send()
+            .and_then(|response| response.error_for_status());
+        match result {
+            Ok(_) => log(
+                LogLevel::Info,
+                &format!("Exported trace {}", trace.trace_id),
+            ),
+            Err(err) => log_error("Failed to export scan trace", &err),
+        }
+    }
+}
+
+/// `ExportTraceServiceRequest` with the spans of one scan
+fn payload(service_name: &str, spans: Vec<Value>) -> Value {
+    json!({
+        "resourceSpans": [{
+            "resource": {
+                "attributes": [
+                    attribute("service.name", json!(service_name)),
+                    attribute("service.version", json!(env!("CARGO_PKG_VERSION"))),
+                ],
+            },
+            "scopeSpans": [{
+                "scope": { "name": "feluda", "version": env!("CARGO_PKG_VERSION") },
+                "spans": spans,
+            }],
+        }],
+    })
+}
+
+/// OTLP `KeyValue`; integers are encoded as strings like any 64-bit protobuf value
+fn attribute(key: &str, value: Value) -> Value {
+    let value = match value {
+        Value::Bool(value) => json!({ "boolValue": value }),
+        Value::Number(value) => json!({ "intValue": value.to_string() }),
+        Value::String(value) => json!({ "stringValue": value }),
+        value => json!({ "stringValue": value.to_string() }),
+    };
+    json!({ "key": key, "value": value })
+}
+
+fn unix_nanos(time: SystemTime) -> String {
+    time.duration_since(UNIX_EPOCH)
+        .unwrap_or_default()
+        .as_nanos()
+        .to_string()
+}
+
+/// Random hex id of `bytes` bytes, 16 for traces and 8 for spans
+fn random_id(bytes: usize) -> String {
+    uuid::Uuid::new_v4().simple().to_string()[..bytes * 2].to_string()
+}
+
+#[derive(Debug, Clone)]
+pub(super) struct Span {
+    name: &'static str,
+    kind: u32,
+    span_id: String,
+    parent_span_id: Option<String>,
+    start: SystemTime,
+    end: SystemTime,
+    attributes: Vec<(&'static str, Value)>,
+    error: Option<String>,
+}
+
+impl Span {
+    fn to_json(&self, trace_id: &str) -> Value {
+        let status = match &self.error {
+            Some(message) => json!({ "code": STATUS_ERROR, "message": message }),
+            None => json!({ "code": STATUS_OK }),
+        };
+        let attributes: Vec<Value> = self
+            .attributes
+            .iter()
+            .map(|(key, value)| attribute(key, value.clone()))
+            .collect();
+        let mut span = json!({
+            "traceId": trace_id,
+            "spanId": self.span_id,
+            "name": self.name,
+            "kind": self.kind,
+            "startTimeUnixNano": unix_nanos(self.start),
+            "endTimeUnixNano": unix_nanos(self.end),
+            "attributes": attributes,
+            "status": status,
+        });
+        if let Some(parent) = &self.parent_span_id {
+            span["parentSpanId"] = json!(parent);
+        }
+        span
+    }
+}
+
+/// Spans of one scan, collected while it runs
+pub(super) struct ScanTrace {
+    trace_id: String,
+    root: Span,
+    projects: Arc<Mutex<Vec<Span>>>,
+}
+
+impl ScanTrace {
+    pub(super) fn start(id: &str, path: &Path) -> Self {
+        let now = SystemTime::now();
+        Self {
+            trace_id: random_id(16),
+            root: Span {
+                name: "feluda.scan",
+                kind: SPAN_KIND_SERVER,
+                span_id: random_id(8),
+                parent_span_id: None,
+                start: now,
+                end: now,
+                attributes: vec![
+                    ("feluda.scan.id", json!(id)),
+                    ("feluda.scan.path", json!(path.display().to_string())),
+                ],
+                error: None,
+            },
+            projects: Arc::new(Mutex::new(Vec::new())),
+        }
+    }
+
+    /// Record a span for every analyzed project, then pass the event on to `forward`
+    pub(super) fn progress(&self, forward: Option<ProgressCallback>) -> ProgressCallback {
+        let projects = Arc::clone(&self.projects);
+        let parent = self.root.span_id.clone();
+        ProgressCallback::new(move |progress| {
+            if let ScanProgress::ProjectScanned {
+                manifest,
+                dependencies,
+                error,
+                duration,
+                ..
+            } = progress
+            {
+                let end = SystemTime::now();
+                let span = Span {
+                    name: "feluda.project",
+                    kind: SPAN_KIND_INTERNAL,
+                    span_id: random_id(8),
+                    parent_span_id: Some(parent.clone()),
+                    start: end.checked_sub(*duration).unwrap_or(end),
+                    end,
+                    attributes: vec![
+                        ("feluda.manifest", json!(manifest.unwrap_or_default())),
+                        ("feluda.dependencies", json!(dependencies.len())),
+                    ],
+                    error: error.clone(),
+                };
+                if let Ok(mut projects) = projects.lock() {
+                    projects.push(span);
+                }
+            }
+            if let Some(forward) = &forward {
+                forward.report(progress);
+            }
+        })
+    }
+
+    /// Close the scan span with the outcome of the scan
+    pub(super) fn finish(&self, result: &FeludaResult<Report>) -> Vec<Span> {
+        let mut root = self.root.clone();
+        root.end = SystemTime::now();
+        match result {
+            Ok(report) => {
+                root.attributes
+                    .push(("feluda.dependencies", json!(report.dependencies.len())));
+                root.attributes.push((
+                    "feluda.policy_violations",
+                    json!(report.policy_violations.len()),
+                ));
+            }
+            Err(err) => root.error = Some(err.to_string()),
+        }
+
+        let mut spans = vec![root];
+        if let Ok(projects) = self.projects.lock() {
+            spans.extend(projects.iter().cloned());
+        }
+        spans
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::LicenseInfo;
+    use std::collections::HashMap;
+    use std::io::{BufRead, BufReader, Read, Write};
+    use std::net::TcpListener;
+
+    #[test]
+    fn test_traces_endpoint() {
+        let env = HashMap::from([
+            ("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/"),
+            (
+                "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+                "http://collector:4318/custom",
+            ),
+        ]);
+        let lookup = |name: &str| env.get(name).map(|value| value.to_string());
+
+        assert_eq!(
+            traces_endpoint(Some("http://localhost:4318"), lookup).as_deref(),
+            Some("http://localhost:4318/v1/traces")
+        );
+        assert_eq!(
+            traces_endpoint(None, lookup).as_deref(),
+            Some("http://collector:4318/custom")
+        );
+        assert_eq!(
+            traces_endpoint(None, |name: &str| lookup(name)
+                .filter(|_| name == "OTEL_EXPORTER_OTLP_ENDPOINT"))
+            .as_deref(),
+            Some("http://collector:4318/v1/traces")
+        );
+        assert_eq!(traces_endpoint(None, |_: &str| None), None);
+    }
+
+    #[test]
+    fn test_scan_trace_export() {
+        let trace = ScanTrace::start("scan-1", Path::new("/srv/app"));
+        let progress = trace.progress(None);
+        let dependencies: Vec<LicenseInfo> = Vec::new();
+        progress.report(&ScanProgress::ProjectScanned {
+            manifest: Some("api/package.json"),
+            dependencies: &dependencies,
+            error: Some("npm failed".to_string()),
+            duration: Duration::from_millis(20),
+            completed: 1,
+            total: 1,
+        });
+        let report = Report {
+            project_license: None,
+            dependencies,
+            policy_violations: Vec::new(),
+            tiers: Vec::new(),
+            projects: Vec::new(),
+        };
+        let spans = trace.finish(&Ok(report));
+        assert_eq!(spans.len(), 2);
+
+        let root = spans[0].to_json(&trace.trace_id);
+        let project = spans[1].to_json(&trace.trace_id);
+        assert_eq!(root["traceId"].as_str().unwrap().len(), 32);
+        assert_eq!(root["spanId"].as_str().unwrap().len(), 16);
+        assert_eq!(root["status"]["code"], STATUS_OK);
+        assert!(root.get("parentSpanId").is_none());
+        assert_eq!(project["parentSpanId"], root["spanId"]);
+        assert_eq!(project["name"], "feluda.project");
+        assert_eq!(project["status"]["message"], "npm failed");
+        assert_eq!(
+            project["attributes"][0],
+            json!({"key": "feluda.manifest", "value": {"stringValue": "api/package.json"}})
+        );
+        assert_eq!(
+            project["attributes"][1],
+            json!({"key": "feluda.dependencies", "value": {"intValue": "0"}})
+        );
+
+        let listener = TcpListener::bind("127.0.0.1:0").unwrap();
+        let tracer =
+            Tracer::new(Some(&format!("http://{}", listener.local_addr().unwrap()))).unwrap();
+        let collector = std::thread::spawn(move || {
+            let (mut stream, _) = listener.accept().unwrap();
+            let mut reader = BufReader::new(stream.try_clone().unwrap());
+            let mut request_line = String::new();
+            reader.read_line(&mut request_line).unwrap();
+            let mut content_length = 0;
+            loop {
+                let mut line = String::new();
+                reader.read_line(&mut line).unwrap();
+                match line.trim_end().split_once(':') {
+                    Some((name, value)) if name.eq_ignore_ascii_case("content-length") => {
+                        content_length = value.trim().parse().unwrap();
+                    }
+                    Some(_) => {}
+                    None => break,
+                }
+            }
+            let mut body = vec![0; content_length];
+            reader.read_exact(&mut body).unwrap();
+            stream
+                .write_all(b"HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\n{}")
+                .unwrap();
+            (request_line, body)
+        });
+        tracer.export(&trace, spans);
+
+        let (request_line, body) = collector.join().unwrap();
+        assert!(request_line.starts_with("POST /v1/traces "));
+        let body: Value = serde_json::from_slice(&body).unwrap();
+        let scope = &body["resourceSpans"][0]["scopeSpans"][0];
+        assert_eq!(scope["scope"]["name"], "feluda");
+        assert_eq!(scope["spans"][0]["name"], "feluda.scan");
+        assert_eq!(scope["spans"].as_array().unwrap().len(), 2);
+    }
+}
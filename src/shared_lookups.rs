@@ -0,0 +1,205 @@
+//! License lookups shared between the projects of a scan
+//!
+//! The projects of a workspace have most of their dependencies in common, and
+//! they are analyzed at the same time. While a scan runs, the result of every
+//! lookup made through [`time_dependency`](crate::debug::time_dependency) is
+//! kept by ecosystem, name and version, so other projects reuse it instead of
+//! resolving the package again. A lookup still running on another thread is
+//! waited for rather than repeated.
+//!
+//! Unlike the package cache in [`crate::cache`], this covers lookups that
+//! found no license and those that failed, and `--refresh` scans. Results are
+//! dropped once the last running scan finishes.
+
+use std::any::{Any, TypeId};
+use std::collections::HashMap;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::{Arc, Condvar, Mutex, MutexGuard, OnceLock};
+use std::thread::{self, ThreadId};
+
+/// Lookups are told apart by their result type too, as analyzers of the same
+/// ecosystem may resolve different things for a package
+type Key = (TypeId, String, String, String);
+
+enum Slot {
+    /// The thread resolving the package
+    Running(ThreadId),
+    Done(Arc<dyn Any + Send + Sync>),
+}
+
+#[derive(Default)]
+struct Lookups {
+    /// Scans currently running
+    scans: usize,
+    slots: HashMap<Key, Slot>,
+}
+
+static LOOKUPS: OnceLock<(Mutex<Lookups>, Condvar)> = OnceLock::new();
+
+/// Lookups answered from another project's result, since startup
+static REUSED: AtomicU64 = AtomicU64::new(0);
+
+fn lookups() -> &'static (Mutex<Lookups>, Condvar) {
+    LOOKUPS.get_or_init(Default::default)
+}
+
+fn lock() -> MutexGuard<'static, Lookups> {
+    lookups()
+        .0
+        .lock()
+        .unwrap_or_else(|poisoned| poisoned.into_inner())
+}
+
+/// Shares lookups between projects until dropped, see [`begin_scan`]
+#[must_use]
+pub struct ScanLookups(());
+
+/// Start sharing lookups for a scan
+///
+/// Scans running at the same time share their lookups as well. The results
+/// are dropped when the last [`ScanLookups`] is.
+pub fn begin_scan() -> ScanLookups {
+    lock().scans += 1;
+    ScanLookups(())
+}
+
+impl Drop for ScanLookups {
+    fn drop(&mut self) {
+        let mut lookups = lock();
+        lookups.scans -= 1;
+        if lookups.scans == 0 {
+            lookups.slots.clear();
+        }
+    }
+}
+
+/// Number of lookups answered with the result of another project
+pub fn reused_lookups() -> u64 {
+    REUSED.load(Ordering::Relaxed)
+}
+
+/// Marks a lookup as no longer running if it panics
+struct Running<'a> {
+    key: Option<&'a Key>,
+}
+
+impl Drop for Running<'_> {
+    fn drop(&mut self) {
+        if let Some(key) = self.key {
+            lock().slots.remove(key);
+            lookups().1.notify_all();
+        }
+    }
+}
+
+/// Resolve a package once per scan, returning the shared result to later callers
+///
+/// Outside of a scan, `lookup` always runs.
+pub(crate) fn resolve_once<T: Clone + Send + Sync + 'static>(
+    ecosystem: &str,
+    name: &str,
+    version: &str,
+    lookup: impl FnOnce() -> T,
+) -> T {
+    let key: Key = (
+        TypeId::of::<T>(),
+        ecosystem.to_string(),
+        name.to_string(),
+        version.to_string(),
+    );
+    let current = thread::current().id();
+
+    let mut state = lock();
+    if state.scans == 0 {
+        drop(state);
+        return lookup();
+    }
+    loop {
+        match state.slots.get(&key) {
+            Some(Slot::Done(result)) => {
+                if let Some(result) = result.downcast_ref::<T>() {
+                    REUSED.fetch_add(1, Ordering::Relaxed);
+                    return result.clone();
+                }
+                break;
+            }
+            // Re-entered from the lookup itself, e.g. through a stolen rayon task
+            Some(Slot::Running(owner)) if *owner == current => {
+                drop(state);
+                return lookup();
+            }
+            Some(Slot::Running(_)) => {
+                state = lookups()
+                    .1
+                    .wait(state)
+                    .unwrap_or_else(|poisoned| poisoned.into_inner());
+            }
+            None => break,
+        }
+    }
+    state.slots.insert(key.clone(), Slot::Running(current));
+    drop(state);
+
+    let mut running = Running { key: Some(&key) };
+    let result = lookup();
+    running.key = None;
+
+    let mut state = lock();
+    if state.scans > 0 {
+        state
+            .slots
+            .insert(key.clone(), Slot::Done(Arc::new(result.clone())));
+    }
+    drop(state);
+    lookups().1.notify_all();
+    result
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::atomic::AtomicUsize;
+
+    #[test]
+    fn test_lookups_are_shared_during_a_scan() {
+        let calls = AtomicUsize::new(0);
+        let lookup = || {
+            calls.fetch_add(1, Ordering::SeqCst);
+            thread::sleep(std::time::Duration::from_millis(20));
+            "MIT".to_string()
+        };
+
+        // Scans of other tests may be running, so only sharing is checked
+        let _scan = begin_scan();
+        let results: Vec<String> = thread::scope(|scope| {
+            let handles: Vec<_> = (0..4)
+                .map(|_| scope.spawn(|| resolve_once("npm", "shared-lookups-a", "1.0.0", lookup)))
+                .collect();
+            handles.into_iter().map(|h| h.join().unwrap()).collect()
+        });
+        assert_eq!(results, vec!["MIT"; 4]);
+        assert_eq!(calls.swap(0, Ordering::SeqCst), 1);
+
+        // Other versions and result types are separate lookups
+        resolve_once("npm", "shared-lookups-a", "2.0.0", lookup);
+        let other: Option<String> =
+            resolve_once("npm", "shared-lookups-a", "1.0.0", || Some("ISC".into()));
+        assert_eq!(other.as_deref(), Some("ISC"));
+        assert_eq!(calls.load(Ordering::SeqCst), 1);
+    }
+
+    #[test]
+    fn test_panicking_lookup_releases_waiters() {
+        let _scan = begin_scan();
+        let panicked = thread::spawn(|| {
+            resolve_once("npm", "shared-lookups-panic", "1.0.0", || -> String {
+                panic!("registry exploded")
+            })
+        })
+        .join();
+        assert!(panicked.is_err());
+
+        let license = resolve_once("npm", "shared-lookups-panic", "1.0.0", || "MIT".to_string());
+        assert_eq!(license, "MIT");
+    }
+}
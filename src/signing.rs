@@ -0,0 +1,340 @@
+//! Report signing and provenance (`--sign`, `--attest`)
+//!
+//! Reports and SBOMs written to a file can be signed with
+//! [cosign](https://docs.sigstore.dev/cosign/), keyless through Sigstore's
+//! OIDC flow or with the key given to `--sign-key`. An in-toto attestation
+//! binds the file to the git commit that was scanned:
+//!
+//! - `<file>.sigstore.json`: cosign bundle with the signature of the file
+//! - `<file>.intoto.json`: in-toto statement with the file's digest as subject
+//!   and the scanned commit in its predicate
+//! - `<file>.intoto.sigstore.json`: the attestation signed by cosign, when
+//!   both options are given
+//!
+//! Signatures are verified with `cosign verify-blob` and
+//! `cosign verify-blob-attestation --type` [`PREDICATE_TYPE`].
+
+use serde_json::{json, Value};
+use sha2::{Digest, Sha256};
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+
+/// `predicateType` of the attestations Feluda emits
+pub const PREDICATE_TYPE: &str = "https://github.com/anistark/feluda/attestation/scan/v1";
+
+const STATEMENT_TYPE: &str = "https://in-toto.io/Statement/v1";
+
+/// What to produce for every report file
+#[derive(Debug, Clone, Default)]
+pub struct SigningOptions {
+    /// Sign the report with cosign
+    pub sign: bool,
+    /// Key for cosign (file, KMS URI or `env://VAR`); keyless signing without one
+    pub key: Option<String>,
+    /// Emit an in-toto attestation binding the report to the scanned commit
+    pub attest: bool,
+}
+
+impl SigningOptions {
+    pub fn is_enabled(&self) -> bool {
+        self.sign || self.attest
+    }
+}
+
+/// The commit a report was generated from
+#[derive(Debug, Clone, PartialEq)]
+pub struct SourceCommit {
+    /// URL of the `origin` remote, if there is one
+    pub uri: Option<String>,
+    pub commit: String,
+    /// Whether the working tree had uncommitted changes
+    pub dirty: bool,
+}
+
+/// Look up the commit checked out in the repository containing `path`
+pub fn source_commit(path: &Path) -> FeludaResult<SourceCommit> {
+    let git_error = |e: git2::Error| {
+        FeludaError::InvalidData(format!(
+            "--attest needs a git repository to bind the report to: {e}"
+        ))
+    };
+
+    let repo = git2::Repository::discover(path).map_err(git_error)?;
+    let commit = repo
+        .head()
+        .and_then(|head| head.peel_to_commit())
+        .map_err(git_error)?;
+    let uri = repo
+        .find_remote("origin")
+        .ok()
+        .and_then(|remote| remote.url().map(str::to_string));
+
+    let mut status = git2::StatusOptions::new();
+    status.include_untracked(false);
+    let dirty = repo
+        .statuses(Some(&mut status))
+        .map(|statuses| !statuses.is_empty())
+        .unwrap_or(false);
+    if dirty {
+        log(
+            LogLevel::Warn,
+            "The working tree has uncommitted changes; the attestation records the HEAD commit",
+        );
+    }
+
+    Ok(SourceCommit {
+        uri,
+        commit: commit.id().to_string(),
+        dirty,
+    })
+}
+
+/// Hex-encoded SHA-256 digest of a file
+pub fn sha256_file(path: &Path) -> FeludaResult<String> {
+    let content = fs::read(path)?;
+    Ok(Sha256::digest(&content)
+        .iter()
+        .map(|byte| format!("{byte:02x}"))
+        .collect())
+}
+
+/// Predicate describing the scan that produced a report
+pub fn scan_predicate(source: &SourceCommit) -> Value {
+    json!({
+        "scanner": {
+            "name": "feluda",
+            "version": env!("CARGO_PKG_VERSION"),
+            "uri": env!("CARGO_PKG_REPOSITORY"),
+        },
+        "source": {
+            "uri": source.uri,
+            "digest": { "gitCommit": source.commit },
+            "dirty": source.dirty,
+        },
+        "scannedAt": chrono::Utc::now().to_rfc3339_opts(chrono::SecondsFormat::Secs, true),
+    })
+}
+
+/// in-toto statement for `artifact`, generated from `source`
+pub fn provenance_statement(artifact: &Path, source: &SourceCommit) -> FeludaResult<Value> {
+    let name = artifact
+        .file_name()
+        .map(|name| name.to_string_lossy().to_string())
+        .unwrap_or_default();
+    Ok(json!({
+        "_type": STATEMENT_TYPE,
+        "subject": [{
+            "name": name,
+            "digest": { "sha256": sha256_file(artifact)? },
+        }],
+        "predicateType": PREDICATE_TYPE,
+        "predicate": scan_predicate(source),
+    }))
+}
+
+/// `report.json` → `report.json<suffix>`
+fn with_suffix(artifact: &Path, suffix: &str) -> PathBuf {
+    let mut name = artifact.as_os_str().to_owned();
+    name.push(suffix);
+    PathBuf::from(name)
+}
+
+/// Who must have signed a blob for [`verify_blob`] to accept it
+#[derive(Debug, Clone, PartialEq)]
+pub enum Signer {
+    /// Public key, KMS URI or `env://VAR` the blob was signed with
+    Key(String),
+    /// Keyless signature whose certificate matches the identity and OIDC issuer
+    Identity {
+        identity_regexp: String,
+        oidc_issuer: String,
+    },
+}
+
+/// Check the cosign bundle of `artifact` with `cosign verify-blob`
+pub fn verify_blob(artifact: &Path, bundle: &Path, signer: &Signer) -> FeludaResult<()> {
+    let mut command = Command::new("cosign");
+    command.arg("verify-blob").arg("--bundle").arg(bundle);
+    match signer {
+        Signer::Key(key) => command.args(["--key", key]),
+        Signer::Identity {
+            identity_regexp,
+            oidc_issuer,
+        } => command.args([
+            "--certificate-identity-regexp",
+            identity_regexp,
+            "--certificate-oidc-issuer",
+            oidc_issuer,
+        ]),
+    };
+    command.arg(artifact);
+    log(LogLevel::Info, &format!("Running {command:?}"));
+
+    let output = command.output().map_err(|e| {
+        FeludaError::Unknown(format!(
+            "Failed to run cosign ({e}); install it from https://docs.sigstore.dev/cosign/system_config/installation/"
+        ))
+    })?;
+    if !output.status.success() {
+        return Err(FeludaError::InvalidData(format!(
+            "Signature of {} could not be verified: {}",
+            artifact.display(),
+            String::from_utf8_lossy(&output.stderr).trim()
+        )));
+    }
+    Ok(())
+}
+
+/// Run cosign with `args`, adding the signing key if one is configured
+fn run_cosign(args: &[&str], options: &SigningOptions) -> FeludaResult<()> {
+    let mut command = Command::new("cosign");
+    command.args(args).arg("--yes");
+    if let Some(key) = &options.key {
+        command.args(["--key", key]);
+    }
+    log(LogLevel::Info, &format!("Running {command:?}"));
+
+    let status = command.status().map_err(|e| {
+        FeludaError::Unknown(format!(
+            "Failed to run cosign ({e}); install it from https://docs.sigstore.dev/cosign/system_config/installation/"
+        ))
+    })?;
+    if !status.success() {
+        return Err(FeludaError::Unknown(format!(
+            "cosign {} failed: {status}",
+            args[0]
+        )));
+    }
+    Ok(())
+}
+
+/// Sign and attest the report files written by a scan of `project_path`
+pub fn sign_artifacts(
+    artifacts: &[PathBuf],
+    project_path: &Path,
+    options: &SigningOptions,
+) -> FeludaResult<()> {
+    if !options.is_enabled() {
+        return Ok(());
+    }
+    if artifacts.is_empty() {
+        return Err(FeludaError::Config(
+            "--sign and --attest need a report file, e.g. --output-file".to_string(),
+        ));
+    }
+
+    let source = if options.attest {
+        Some(source_commit(project_path)?)
+    } else {
+        None
+    };
+
+    for artifact in artifacts {
+        let artifact_name = artifact.to_string_lossy();
+        if options.sign {
+            let bundle = with_suffix(artifact, ".sigstore.json");
+            run_cosign(
+                &[
+                    "sign-blob",
+                    "--bundle",
+                    &bundle.to_string_lossy(),
+                    &artifact_name,
+                ],
+                options,
+            )?;
+            println!("Signature written to: {}", bundle.display());
+        }
+
+        let Some(source) = &source else {
+            continue;
+        };
+        let statement = provenance_statement(artifact, source)?;
+        let statement_file = with_suffix(artifact, ".intoto.json");
+        let content = serde_json::to_string_pretty(&statement).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize attestation: {e}"))
+        })?;
+        fs::write(&statement_file, content)
+            .map_err(|e| FeludaError::FileWrite(format!("Failed to write attestation: {e}")))?;
+        println!("Attestation written to: {}", statement_file.display());
+
+        if options.sign {
+            // cosign wraps the predicate in its own statement about the same subject
+            let predicate = tempfile::NamedTempFile::new()?;
+            fs::write(predicate.path(), statement["predicate"].to_string())?;
+            let bundle = with_suffix(artifact, ".intoto.sigstore.json");
+            run_cosign(
+                &[
+                    "attest-blob",
+                    "--predicate",
+                    &predicate.path().to_string_lossy(),
+                    "--type",
+                    PREDICATE_TYPE,
+                    "--bundle",
+                    &bundle.to_string_lossy(),
+                    &artifact_name,
+                ],
+                options,
+            )?;
+            println!("Signed attestation written to: {}", bundle.display());
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_provenance_statement() {
+        let temp_dir = TempDir::new().unwrap();
+        let source = SourceCommit {
+            uri: Some("https://github.com/acme/app.git".to_string()),
+            commit: "4b825dc642cb6eb9a060e54bf8d69288fbee4904".to_string(),
+            dirty: false,
+        };
+
+        let report = temp_dir.path().join("report.json");
+        fs::write(&report, "hello").unwrap();
+        let statement = provenance_statement(&report, &source).unwrap();
+        assert_eq!(statement["_type"], STATEMENT_TYPE);
+        assert_eq!(statement["predicateType"], PREDICATE_TYPE);
+        assert_eq!(statement["subject"][0]["name"], "report.json");
+        assert_eq!(
+            statement["subject"][0]["digest"]["sha256"],
+            "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+        );
+        assert_eq!(
+            statement["predicate"]["source"]["digest"]["gitCommit"],
+            "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+        );
+        assert_eq!(
+            statement["predicate"]["source"]["uri"],
+            "https://github.com/acme/app.git"
+        );
+        assert_eq!(statement["predicate"]["scanner"]["name"], "feluda");
+    }
+
+    #[test]
+    fn test_sign_artifacts_requires_report_and_repository() {
+        let temp_dir = TempDir::new().unwrap();
+        let options = SigningOptions {
+            attest: true,
+            ..SigningOptions::default()
+        };
+        assert!(sign_artifacts(&[], temp_dir.path(), &options).is_err());
+
+        let report = temp_dir.path().join("report.json");
+        fs::write(&report, "{}").unwrap();
+        let err =
+            sign_artifacts(std::slice::from_ref(&report), temp_dir.path(), &options).unwrap_err();
+        assert!(err.to_string().contains("git repository"));
+        assert!(!with_suffix(&report, ".intoto.json").exists());
+
+        assert!(sign_artifacts(&[], temp_dir.path(), &SigningOptions::default()).is_ok());
+    }
+}
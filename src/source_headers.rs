@@ -0,0 +1,345 @@
+//! License headers of the project's own source files (`feluda headers`)
+//!
+//! Dependency manifests say nothing about code that was copied into the
+//! project by hand. Such files usually keep the header of the project they
+//! came from, so the first lines of every first-party source file are read and
+//! their license is taken from an `SPDX-License-Identifier` tag or, failing
+//! that, classified from the header text like a LICENSE file (the standard
+//! GPL, Apache-2.0 and MPL-2.0 notices are among the reference texts).
+//!
+//! A file conflicts when its license is incompatible with the project license.
+//! Dependency folders, vendored code and files ignored by `.gitignore` are
+//! skipped.
+
+use colored::*;
+use ignore::WalkBuilder;
+use rayon::prelude::*;
+use regex::Regex;
+use serde::Serialize;
+use std::path::{Path, PathBuf};
+use std::process;
+use std::sync::OnceLock;
+
+use crate::config::{load_config, FeludaConfig};
+use crate::copyright::{is_source_file, read_header};
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::diff::print_table;
+use crate::license_detector::classify_license_text;
+use crate::licenses::{
+    detect_project_license, is_license_compatible_with_overrides, LicenseCompatibility,
+};
+use crate::parser::SKIPPED_DIRS;
+use crate::policy::{copyleft_rank, license_alternatives};
+use crate::vendored::VENDOR_DIRS;
+
+/// Words one of which a header has to contain to be classified
+const LICENSE_HINTS: [&str; 3] = ["licen", "free software", "public domain"];
+
+/// How the license of a file was found
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum HeaderSource {
+    /// An `SPDX-License-Identifier:` tag
+    SpdxTag,
+    /// The header text matched a license notice
+    HeaderText,
+}
+
+/// A first-party source file with a license header
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct SourceFileLicense {
+    /// Path relative to the project directory
+    pub path: PathBuf,
+    pub license: String,
+    pub detected_by: HeaderSource,
+    /// Share of the license notice found in the header, for [`HeaderSource::HeaderText`]
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub confidence: Option<f32>,
+    pub compatibility: LicenseCompatibility,
+    /// The license is weak or strong copyleft
+    pub is_copyleft: bool,
+}
+
+impl SourceFileLicense {
+    /// Whether the file's license conflicts with the project license
+    pub fn conflicts(&self) -> bool {
+        self.compatibility == LicenseCompatibility::Incompatible
+    }
+}
+
+fn spdx_tag_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| {
+        Regex::new(r"SPDX-License-Identifier:\s*([^\r\n]+?)\s*(?:\*/|-->|\*\)|$)")
+            .expect("valid SPDX tag pattern")
+    })
+}
+
+/// The license of a source file header, from its SPDX tag or its notice
+pub fn header_license(header: &str) -> Option<(String, HeaderSource, Option<f32>)> {
+    if let Some(tag) = header
+        .lines()
+        .find_map(|line| spdx_tag_pattern().captures(line))
+        .map(|captures| captures[1].trim().to_string())
+        .filter(|tag| !tag.is_empty())
+    {
+        return Some((tag, HeaderSource::SpdxTag, None));
+    }
+
+    let text = header
+        .lines()
+        .map(|line| {
+            line.trim()
+                .trim_start_matches(['#', '*', '/', '-', ';', '!', '<', '%'])
+                .trim_end_matches(['*', '/', '>'])
+                .trim()
+        })
+        .collect::<Vec<_>>()
+        .join("\n");
+    let lowercase = text.to_lowercase();
+    if !LICENSE_HINTS.iter().any(|hint| lowercase.contains(hint)) {
+        return None;
+    }
+    let detected = classify_license_text(&text)?;
+    Some((
+        detected.license,
+        HeaderSource::HeaderText,
+        Some(detected.confidence),
+    ))
+}
+
+/// Whether every alternative of a license expression includes a copyleft license
+fn is_copyleft(license: &str) -> bool {
+    license_alternatives(license)
+        .iter()
+        .all(|terms| terms.iter().any(|term| copyleft_rank(&term.id) >= 2))
+}
+
+/// First-party source files below `root`
+fn source_files(root: &Path) -> Vec<PathBuf> {
+    WalkBuilder::new(root)
+        .filter_entry(|entry| {
+            let name = entry.file_name().to_str().unwrap_or_default();
+            let is_dir = entry
+                .file_type()
+                .is_some_and(|file_type| file_type.is_dir());
+            !(is_dir && (SKIPPED_DIRS.contains(&name) || VENDOR_DIRS.contains(&name)))
+        })
+        .build()
+        .flatten()
+        .filter(|entry| entry.file_type().is_some_and(|t| t.is_file()))
+        .map(|entry| entry.into_path())
+        .filter(|path| is_source_file(path))
+        .collect()
+}
+
+/// Read the license headers of the source files below `root`
+///
+/// Files without a recognizable license header are left out. Without a
+/// project license every file has unknown compatibility.
+pub fn scan_source_headers(
+    root: &Path,
+    project_license: Option<&str>,
+    config: &FeludaConfig,
+) -> Vec<SourceFileLicense> {
+    let files = source_files(root);
+    log(
+        LogLevel::Info,
+        &format!(
+            "Reading license headers of {} source files in {}",
+            files.len(),
+            root.display()
+        ),
+    );
+
+    let mut found: Vec<SourceFileLicense> = files
+        .par_iter()
+        .filter_map(|path| {
+            let (license, detected_by, confidence) = header_license(&read_header(path)?)?;
+            let compatibility = project_license.map_or(LicenseCompatibility::Unknown, |project| {
+                is_license_compatible_with_overrides(
+                    &license,
+                    project,
+                    config.strict,
+                    &config.compatibility,
+                )
+            });
+            Some(SourceFileLicense {
+                path: path.strip_prefix(root).unwrap_or(path).to_path_buf(),
+                is_copyleft: is_copyleft(&license),
+                license,
+                detected_by,
+                confidence,
+                compatibility,
+            })
+        })
+        .collect();
+    found.sort_by(|a, b| a.path.cmp(&b.path));
+    found
+}
+
+/// Print the files under another license than the project's
+pub fn print_source_headers(files: &[SourceFileLicense], project_license: Option<&str>) {
+    let foreign: Vec<_> = files
+        .iter()
+        .filter(|file| Some(file.license.as_str()) != project_license)
+        .collect();
+    let conflicts = files.iter().filter(|file| file.conflicts()).count();
+
+    println!(
+        "\n{} {} source files with a license header, {} under another license than the project, {} conflicting\n",
+        "Source headers:".bold(),
+        files.len(),
+        foreign.len(),
+        conflicts
+    );
+    if foreign.is_empty() {
+        return;
+    }
+
+    let rows: Vec<_> = foreign
+        .iter()
+        .map(|file| {
+            (
+                vec![
+                    file.path.display().to_string(),
+                    file.license.clone(),
+                    match file.detected_by {
+                        HeaderSource::SpdxTag => "SPDX tag".to_string(),
+                        HeaderSource::HeaderText => format!(
+                            "header text ({:.0}%)",
+                            file.confidence.unwrap_or_default() * 100.0
+                        ),
+                    },
+                    file.compatibility.to_string(),
+                ],
+                file.conflicts() || (project_license.is_none() && file.is_copyleft),
+            )
+        })
+        .collect();
+    print_table(
+        "Files under another license",
+        &["File", "License", "Found In", "Compatibility"],
+        &rows,
+    );
+}
+
+/// Scan the source headers of the project in `path` and report conflicts
+pub fn handle_headers_command(
+    path: String,
+    project_license: Option<String>,
+    json: bool,
+    fail_on_conflict: bool,
+) -> FeludaResult<()> {
+    let config = load_config()?;
+    let project_license = match project_license.or_else(|| config.project.license.clone()) {
+        Some(license) => Some(license),
+        None => detect_project_license(&path)?,
+    };
+    if project_license.is_none() {
+        log(
+            LogLevel::Warn,
+            "No project license specified or detected, compatibility of source files is unknown",
+        );
+    }
+
+    let files = scan_source_headers(Path::new(&path), project_license.as_deref(), &config);
+    if json {
+        let output = serde_json::to_string_pretty(&files).map_err(|e| {
+            FeludaError::Serialization(format!("Failed to serialize source headers: {e}"))
+        })?;
+        println!("{output}");
+    } else {
+        print_source_headers(&files, project_license.as_deref());
+    }
+
+    if fail_on_conflict && files.iter().any(SourceFileLicense::conflicts) {
+        log(
+            LogLevel::Warn,
+            "Source files conflict with the project license, exiting with status 1",
+        );
+        process::exit(1);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    const GPL_HEADER: &str = "/*
+ * Copyright (C) 2009 Jane Doe
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ */
+#include <stdio.h>
+";
+
+    #[test]
+    fn test_header_license() {
+        assert_eq!(
+            header_license("// SPDX-License-Identifier: GPL-2.0-only\nfn main() {}"),
+            Some(("GPL-2.0-only".to_string(), HeaderSource::SpdxTag, None))
+        );
+        assert_eq!(
+            header_license("/* SPDX-License-Identifier: MIT OR Apache-2.0 */").map(|h| h.0),
+            Some("MIT OR Apache-2.0".to_string())
+        );
+        assert_eq!(
+            header_license("<!-- SPDX-License-Identifier: MPL-2.0 -->").map(|h| h.0),
+            Some("MPL-2.0".to_string())
+        );
+
+        let (license, source, confidence) = header_license(GPL_HEADER).unwrap();
+        assert_eq!(license, "GPL-3.0");
+        assert_eq!(source, HeaderSource::HeaderText);
+        assert!(confidence.unwrap() >= 0.8);
+
+        assert_eq!(
+            header_license("// Utilities for parsing\nfn parse() {}"),
+            None
+        );
+    }
+
+    #[test]
+    fn test_scan_source_headers() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::create_dir_all(root.join("src/vendor")).unwrap();
+        fs::create_dir_all(root.join("node_modules/lib")).unwrap();
+        fs::write(
+            root.join("src/main.rs"),
+            "// SPDX-License-Identifier: MIT\n",
+        )
+        .unwrap();
+        fs::write(root.join("src/copied.c"), GPL_HEADER).unwrap();
+        fs::write(root.join("src/plain.py"), "print('hello')\n").unwrap();
+        fs::write(root.join("src/vendor/lib.c"), GPL_HEADER).unwrap();
+        fs::write(root.join("node_modules/lib/index.js"), GPL_HEADER).unwrap();
+        fs::write(root.join("NOTES.txt"), GPL_HEADER).unwrap();
+
+        let files = scan_source_headers(root, Some("MIT"), &FeludaConfig::default());
+        let found: Vec<_> = files
+            .iter()
+            .map(|file| (file.path.clone(), file.license.as_str(), file.conflicts()))
+            .collect();
+        assert_eq!(
+            found,
+            vec![
+                (PathBuf::from("src/copied.c"), "GPL-3.0", true),
+                (PathBuf::from("src/main.rs"), "MIT", false),
+            ]
+        );
+        assert!(files[0].is_copyleft);
+
+        let files = scan_source_headers(root, None, &FeludaConfig::default());
+        assert!(files
+            .iter()
+            .all(|file| file.compatibility == LicenseCompatibility::Unknown));
+    }
+}
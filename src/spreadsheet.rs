@@ -0,0 +1,408 @@
+//! Spreadsheet exports (`--format csv`, `--format xlsx`)
+//!
+//! Legal reviews are often done in a spreadsheet, so these formats have one
+//! row per dependency with the columns in [`COLUMNS`]. CSV follows RFC 4180.
+//! The XLSX workbook is a minimal Office Open XML package with a single sheet,
+//! zipped with deflate, so no spreadsheet library is needed to write it.
+
+use flate2::write::DeflateEncoder;
+use flate2::{Compression, Crc};
+use std::io::Write;
+
+use crate::canonical::purl;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::sbom::cyclonedx::escape_xml;
+use crate::vulns::osv_ecosystem;
+
+/// Column headers, in order
+pub const COLUMNS: [&str; 12] = [
+    "Name",
+    "Version",
+    "Ecosystem",
+    "Relationship",
+    "Scope",
+    "License",
+    "Classification",
+    "Compatibility",
+    "OSI Status",
+    "Manifest",
+    "Source URL",
+    "Package URL",
+];
+
+/// `direct` or `transitive`, empty when the dependency graph is unknown
+fn relationship(info: &LicenseInfo) -> &'static str {
+    match info.dependency_path.as_deref() {
+        Some([_]) => "direct",
+        Some([_, _, ..]) => "transitive",
+        _ => "",
+    }
+}
+
+/// The risk tier if tiers are configured, otherwise restrictive, unknown or permissive
+pub(crate) fn classification(info: &LicenseInfo) -> String {
+    if let Some(tier) = &info.tier {
+        return tier.clone();
+    }
+    if info.is_restrictive {
+        "restrictive".to_string()
+    } else if info.has_unknown_license() {
+        "unknown".to_string()
+    } else {
+        "permissive".to_string()
+    }
+}
+
+/// Registry page of the dependency's version, for ecosystems with a public registry
+pub fn source_url(info: &LicenseInfo) -> Option<String> {
+    let ecosystem = info.source_file.as_deref().and_then(osv_ecosystem)?;
+    let (name, version) = (info.name.as_str(), info.version.as_str());
+    let url = match ecosystem {
+        "crates.io" => format!("https://crates.io/crates/{name}/{version}"),
+        "npm" => format!("https://www.npmjs.com/package/{name}/v/{version}"),
+        "Go" => format!("https://pkg.go.dev/{name}@{version}"),
+        "PyPI" => format!("https://pypi.org/project/{name}/{version}/"),
+        "Maven" => {
+            let (group, artifact) = name.split_once(':')?;
+            format!("https://central.sonatype.com/artifact/{group}/{artifact}/{version}")
+        }
+        "CRAN" => format!("https://cran.r-project.org/package={name}"),
+        "RubyGems" => format!("https://rubygems.org/gems/{name}/versions/{version}"),
+        "Packagist" => format!("https://packagist.org/packages/{name}#{version}"),
+        "Pub" => format!("https://pub.dev/packages/{name}/versions/{version}"),
+        "Hex" => format!("https://hex.pm/packages/{name}/{version}"),
+        "NuGet" => format!("https://www.nuget.org/packages/{name}/{version}"),
+        _ => return None,
+    };
+    Some(url)
+}
+
+/// The cells of one dependency, in the order of [`COLUMNS`]
+pub fn row(info: &LicenseInfo) -> [String; 12] {
+    let compatibility = match info.compatibility {
+        LicenseCompatibility::Compatible => "compatible",
+        LicenseCompatibility::Incompatible => "incompatible",
+        LicenseCompatibility::Unknown => "unknown",
+    };
+    [
+        info.name.clone(),
+        info.version.clone(),
+        info.source_file
+            .as_deref()
+            .and_then(osv_ecosystem)
+            .unwrap_or_default()
+            .to_string(),
+        relationship(info).to_string(),
+        info.scope.to_string(),
+        info.get_license(),
+        classification(info),
+        compatibility.to_string(),
+        info.osi_status.to_string(),
+        info.source_file.clone().unwrap_or_default(),
+        source_url(info).unwrap_or_default(),
+        purl(info),
+    ]
+}
+
+fn csv_field(value: &str) -> String {
+    if value.contains([',', '"', '\n', '\r']) {
+        format!("\"{}\"", value.replace('"', "\"\""))
+    } else {
+        value.to_string()
+    }
+}
+
+/// CSV with a header row, lines ending in CRLF as RFC 4180 specifies
+pub fn render_csv(data: &[LicenseInfo]) -> String {
+    let mut csv = COLUMNS.join(",");
+    csv.push_str("\r\n");
+    for info in data {
+        let fields: Vec<String> = row(info).iter().map(|value| csv_field(value)).collect();
+        csv.push_str(&fields.join(","));
+        csv.push_str("\r\n");
+    }
+    csv
+}
+
+/// Column letters of a zero-based index: 0 → A, 25 → Z, 26 → AA
+fn column_name(mut index: usize) -> String {
+    let mut name = Vec::new();
+    loop {
+        name.push(b'A' + (index % 26) as u8);
+        if index < 26 {
+            break;
+        }
+        index = index / 26 - 1;
+    }
+    name.reverse();
+    String::from_utf8(name).unwrap_or_default()
+}
+
+/// An inline string cell; characters XML 1.0 cannot represent are dropped
+fn xlsx_cell(reference: &str, value: &str, style: u8) -> String {
+    let value: String = value
+        .chars()
+        .filter(|c| !c.is_control() || matches!(c, '\t' | '\n' | '\r'))
+        .collect();
+    format!(
+        r#"<c r="{reference}" t="inlineStr" s="{style}"><is><t xml:space="preserve">{}</t></is></c>"#,
+        escape_xml(&value)
+    )
+}
+
+fn worksheet_xml(data: &[LicenseInfo]) -> String {
+    let last_column = column_name(COLUMNS.len() - 1);
+    let mut xml = String::from(
+        r#"<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">"#,
+    );
+    // Keep the header row visible while scrolling
+    xml.push_str(r#"<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>"#);
+    xml.push_str("<cols>");
+    for (index, width) in [30, 14, 10, 13, 9, 28, 14, 14, 13, 30, 50, 45]
+        .iter()
+        .enumerate()
+    {
+        xml.push_str(&format!(
+            r#"<col min="{0}" max="{0}" width="{width}" customWidth="1"/>"#,
+            index + 1
+        ));
+    }
+    xml.push_str("</cols><sheetData>");
+
+    let header = COLUMNS.map(str::to_string);
+    let rows = std::iter::once((header, 1)).chain(data.iter().map(|info| (row(info), 0)));
+    for (number, (cells, style)) in rows.enumerate() {
+        let number = number + 1;
+        xml.push_str(&format!(r#"<row r="{number}">"#));
+        for (index, value) in cells.iter().enumerate() {
+            let reference = format!("{}{number}", column_name(index));
+            xml.push_str(&xlsx_cell(&reference, value, style));
+        }
+        xml.push_str("</row>");
+    }
+
+    xml.push_str(&format!(
+        r#"</sheetData><autoFilter ref="A1:{last_column}{}"/></worksheet>"#,
+        data.len() + 1
+    ));
+    xml
+}
+
+const CONTENT_TYPES_XML: &str = r#"<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>"#;
+
+const ROOT_RELS_XML: &str = r#"<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>"#;
+
+const WORKBOOK_XML: &str = r#"<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Dependencies" sheetId="1" r:id="rId1"/></sheets></workbook>"#;
+
+const WORKBOOK_RELS_XML: &str = r#"<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>"#;
+
+// Style 0 is the default, style 1 the bold header
+const STYLES_XML: &str = r#"<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs></styleSheet>"#;
+
+/// Writes a ZIP archive of deflated entries
+pub(crate) struct ZipWriter {
+    archive: Vec<u8>,
+    central_directory: Vec<u8>,
+    entries: u16,
+}
+
+impl ZipWriter {
+    pub(crate) fn new() -> Self {
+        Self {
+            archive: Vec::new(),
+            central_directory: Vec::new(),
+            entries: 0,
+        }
+    }
+
+    pub(crate) fn add(&mut self, name: &str, content: &[u8]) -> FeludaResult<()> {
+        let mut crc = Crc::new();
+        crc.update(content);
+        let mut encoder = DeflateEncoder::new(Vec::new(), Compression::default());
+        encoder.write_all(content)?;
+        let compressed = encoder.finish()?;
+
+        let offset = self.archive.len() as u32;
+        // Version 2.0, no flags, deflate, modified 1980-01-01 00:00
+        let common = |buffer: &mut Vec<u8>| {
+            buffer.extend_from_slice(&20u16.to_le_bytes());
+            buffer.extend_from_slice(&0u16.to_le_bytes());
+            buffer.extend_from_slice(&8u16.to_le_bytes());
+            buffer.extend_from_slice(&0u16.to_le_bytes());
+            buffer.extend_from_slice(&0x21u16.to_le_bytes());
+            buffer.extend_from_slice(&crc.sum().to_le_bytes());
+            buffer.extend_from_slice(&(compressed.len() as u32).to_le_bytes());
+            buffer.extend_from_slice(&(content.len() as u32).to_le_bytes());
+            buffer.extend_from_slice(&(name.len() as u16).to_le_bytes());
+            buffer.extend_from_slice(&0u16.to_le_bytes());
+        };
+
+        self.archive.extend_from_slice(&0x04034b50u32.to_le_bytes());
+        common(&mut self.archive);
+        self.archive.extend_from_slice(name.as_bytes());
+        self.archive.extend_from_slice(&compressed);
+
+        self.central_directory
+            .extend_from_slice(&0x02014b50u32.to_le_bytes());
+        self.central_directory
+            .extend_from_slice(&20u16.to_le_bytes());
+        common(&mut self.central_directory);
+        // No comment, disk 0, no attributes
+        self.central_directory.extend_from_slice(&[0; 10]);
+        self.central_directory
+            .extend_from_slice(&offset.to_le_bytes());
+        self.central_directory.extend_from_slice(name.as_bytes());
+
+        self.entries += 1;
+        Ok(())
+    }
+
+    pub(crate) fn finish(mut self) -> Vec<u8> {
+        let offset = self.archive.len() as u32;
+        let size = self.central_directory.len() as u32;
+        self.archive.append(&mut self.central_directory);
+        self.archive.extend_from_slice(&0x06054b50u32.to_le_bytes());
+        self.archive.extend_from_slice(&[0; 4]);
+        self.archive.extend_from_slice(&self.entries.to_le_bytes());
+        self.archive.extend_from_slice(&self.entries.to_le_bytes());
+        self.archive.extend_from_slice(&size.to_le_bytes());
+        self.archive.extend_from_slice(&offset.to_le_bytes());
+        self.archive.extend_from_slice(&0u16.to_le_bytes());
+        self.archive
+    }
+}
+
+/// XLSX workbook with a single "Dependencies" sheet
+pub fn render_xlsx(data: &[LicenseInfo]) -> FeludaResult<Vec<u8>> {
+    let mut zip = ZipWriter::new();
+    zip.add("[Content_Types].xml", CONTENT_TYPES_XML.as_bytes())?;
+    zip.add("_rels/.rels", ROOT_RELS_XML.as_bytes())?;
+    zip.add("xl/workbook.xml", WORKBOOK_XML.as_bytes())?;
+    zip.add("xl/_rels/workbook.xml.rels", WORKBOOK_RELS_XML.as_bytes())?;
+    zip.add("xl/styles.xml", STYLES_XML.as_bytes())?;
+    zip.add("xl/worksheets/sheet1.xml", worksheet_xml(data).as_bytes())?;
+    Ok(zip.finish())
+}
+
+/// Write the CSV or XLSX export to `output_file`, CSV also to stdout
+pub fn write_spreadsheet_report(
+    data: &[LicenseInfo],
+    xlsx: bool,
+    output_file: Option<&str>,
+) -> FeludaResult<()> {
+    if xlsx {
+        let Some(file_path) = output_file else {
+            return Err(FeludaError::Config(
+                "--format xlsx writes a binary file; pass --output-file".to_string(),
+            ));
+        };
+        std::fs::write(file_path, render_xlsx(data)?)
+            .map_err(|e| FeludaError::FileWrite(format!("Failed to write XLSX report: {e}")))?;
+        log(
+            LogLevel::Info,
+            &format!("XLSX report written to: {file_path}"),
+        );
+        return Ok(());
+    }
+
+    let content = render_csv(data);
+    match output_file {
+        Some(file_path) => {
+            std::fs::write(file_path, &content)
+                .map_err(|e| FeludaError::FileWrite(format!("Failed to write CSV report: {e}")))?;
+            log(
+                LogLevel::Info,
+                &format!("CSV report written to: {file_path}"),
+            );
+        }
+        None => print!("{content}"),
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+
+    fn dep(name: &str, license: Option<&str>, path: &[&str]) -> LicenseInfo {
+        LicenseInfo {
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            source_file: Some("web/package-lock.json".to_string()),
+            dependency_path: Some(path.iter().map(|p| p.to_string()).collect()),
+            ..LicenseInfo::test(name, "1.0.0", license)
+        }
+    }
+
+    #[test]
+    fn test_render_csv() {
+        let mut gpl = dep("gpl-lib", Some("GPL-3.0"), &["app@1.0.0", "gpl-lib@1.0.0"]);
+        gpl.is_restrictive = true;
+        let data = vec![
+            dep("left,pad", Some("MIT"), &["left,pad@1.0.0"]),
+            gpl,
+            dep("mystery", None, &[]),
+        ];
+
+        let csv = render_csv(&data);
+        let lines: Vec<&str> = csv.split("\r\n").collect();
+        assert_eq!(
+            lines[0],
+            "Name,Version,Ecosystem,Relationship,Scope,License,Classification,Compatibility,OSI Status,Manifest,Source URL,Package URL"
+        );
+        assert_eq!(
+            lines[1],
+            "\"left,pad\",1.0.0,npm,direct,runtime,MIT,permissive,compatible,approved,web/package-lock.json,\"https://www.npmjs.com/package/left,pad/v/1.0.0\",pkg:npm/left%2Cpad@1.0.0"
+        );
+        assert!(lines[2].starts_with("gpl-lib,1.0.0,npm,transitive,runtime,GPL-3.0,restrictive,"));
+        assert!(lines[3].starts_with("mystery,1.0.0,npm,,runtime,No License,unknown,"));
+        assert_eq!(lines.len(), 5);
+    }
+
+    #[test]
+    fn test_source_url() {
+        let mut info = dep("org.slf4j:slf4j-api", Some("MIT"), &[]);
+        info.source_file = Some("pom.xml".to_string());
+        info.version = "2.0.9".to_string();
+        assert_eq!(
+            source_url(&info).as_deref(),
+            Some("https://central.sonatype.com/artifact/org.slf4j/slf4j-api/2.0.9")
+        );
+        info.source_file = Some("acme.lock".to_string());
+        assert_eq!(source_url(&info), None);
+    }
+
+    #[test]
+    fn test_column_name() {
+        assert_eq!(column_name(0), "A");
+        assert_eq!(column_name(10), "K");
+        assert_eq!(column_name(26), "AA");
+        assert_eq!(column_name(27 * 26), "AAA");
+    }
+
+    #[test]
+    fn test_render_xlsx() {
+        let data = vec![dep("<script>", Some("MIT"), &["<script>@1.0.0"])];
+        let xlsx = render_xlsx(&data).unwrap();
+        assert!(xlsx.starts_with(b"PK\x03\x04"));
+
+        // End of central directory: six entries, directory at the recorded offset
+        let end = &xlsx[xlsx.len() - 22..];
+        assert_eq!(&end[..4], b"PK\x05\x06");
+        assert_eq!(u16::from_le_bytes([end[10], end[11]]), 6);
+        let offset = u32::from_le_bytes([end[16], end[17], end[18], end[19]]) as usize;
+        assert_eq!(&xlsx[offset..offset + 4], b"PK\x01\x02");
+
+        let sheet = worksheet_xml(&data);
+        assert!(sheet.contains(r#"<c r="A2" t="inlineStr" s="0"><is><t xml:space="preserve">&lt;script&gt;</t></is></c>"#));
+        assert!(sheet.contains(r#"<autoFilter ref="A1:L2"/>"#));
+    }
+}
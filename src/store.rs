@@ -0,0 +1,690 @@
+//! Scan history in a SQLite database (`--store`, `feluda history`, `feluda trends`)
+//!
+//! With `--store sqlite:<path>` every scan is recorded together with its
+//! dependencies, so license exposure can be followed over time instead of
+//! comparing two reports at a time. `feluda history <package>` lists when a
+//! package was added, upgraded, relicensed or removed, and `feluda trends`
+//! shows how the counts of restrictive and incompatible dependencies changed
+//! from scan to scan.
+//!
+//! Scans are keyed by the project name, the directory name of the scanned
+//! path, so one database can hold the history of many projects. The database
+//! is created on first use; `PRAGMA user_version` records the schema version.
+
+use chrono::{SecondsFormat, Utc};
+use rusqlite::{params, Connection};
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use crate::aggregate::project_name;
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::diff::print_table;
+use crate::licenses::{LicenseCompatibility, LicenseInfo};
+use crate::notify::KnownLicenses;
+use crate::report_json::compatibility_name;
+
+/// Version of the database schema created by this release
+const SCHEMA_VERSION: i64 = 1;
+
+const SCHEMA: &str = "
+CREATE TABLE IF NOT EXISTS scans (
+    id INTEGER PRIMARY KEY,
+    scanned_at TEXT NOT NULL,
+    project TEXT NOT NULL,
+    path TEXT NOT NULL,
+    git_commit TEXT,
+    project_license TEXT,
+    feluda_version TEXT NOT NULL,
+    total INTEGER NOT NULL,
+    restrictive INTEGER NOT NULL,
+    incompatible INTEGER NOT NULL,
+    unlicensed INTEGER NOT NULL,
+    policy_violations INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS scans_project ON scans (project, scanned_at);
+CREATE TABLE IF NOT EXISTS dependencies (
+    scan_id INTEGER NOT NULL REFERENCES scans (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    version TEXT NOT NULL,
+    license TEXT,
+    is_restrictive INTEGER NOT NULL,
+    compatibility TEXT NOT NULL,
+    source_file TEXT
+);
+CREATE INDEX IF NOT EXISTS dependencies_name ON dependencies (name);
+";
+
+const SCAN_COLUMNS: &str = "id, scanned_at, project, path, git_commit, project_license, \
+     total, restrictive, incompatible, unlicensed, policy_violations";
+
+fn store_error(context: &str, err: rusqlite::Error) -> FeludaError {
+    FeludaError::Store(format!("{context}: {err}"))
+}
+
+/// Database file of a `--store` value
+///
+/// Only `sqlite:<path>` is supported. `sqlite://<path>` is accepted too.
+pub fn parse_store_url(url: &str) -> FeludaResult<PathBuf> {
+    let path = match url.split_once(':') {
+        Some(("sqlite", path)) => path.strip_prefix("//").unwrap_or(path),
+        Some((backend, _)) if !backend.is_empty() && !backend.contains(['/', '\\']) => {
+            return Err(FeludaError::Config(format!(
+                "Unsupported store backend '{backend}', use sqlite:<path>"
+            )));
+        }
+        _ => {
+            return Err(FeludaError::Config(format!(
+                "Invalid store '{url}', use sqlite:<path>"
+            )));
+        }
+    };
+    if path.trim().is_empty() {
+        return Err(FeludaError::Config(
+            "Missing database path in --store, use sqlite:<path>".to_string(),
+        ));
+    }
+    Ok(PathBuf::from(path))
+}
+
+/// A scan about to be recorded
+#[derive(Debug, Clone)]
+pub struct ScanRecord<'a> {
+    pub project: String,
+    pub path: String,
+    pub git_commit: Option<String>,
+    pub project_license: Option<String>,
+    /// Time of the scan, as RFC 3339 in UTC
+    pub scanned_at: String,
+    pub dependencies: &'a [LicenseInfo],
+    pub policy_violations: usize,
+}
+
+impl<'a> ScanRecord<'a> {
+    /// A record of a scan of `path` finished now
+    pub fn new(
+        path: &Path,
+        project_license: Option<&str>,
+        dependencies: &'a [LicenseInfo],
+        policy_violations: usize,
+    ) -> Self {
+        Self {
+            project: project_name(path),
+            path: path
+                .canonicalize()
+                .unwrap_or_else(|_| path.to_path_buf())
+                .display()
+                .to_string(),
+            git_commit: head_commit(path),
+            project_license: project_license.map(str::to_string),
+            scanned_at: Utc::now().to_rfc3339_opts(SecondsFormat::Secs, true),
+            dependencies,
+            policy_violations,
+        }
+    }
+}
+
+/// Commit checked out in the git repository containing `path`
+fn head_commit(path: &Path) -> Option<String> {
+    let repo = git2::Repository::discover(path).ok()?;
+    let commit = repo.head().ok()?.peel_to_commit().ok()?;
+    Some(commit.id().to_string())
+}
+
+/// A recorded scan with its summary counts
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct StoredScan {
+    pub id: i64,
+    pub scanned_at: String,
+    pub project: String,
+    pub path: String,
+    pub git_commit: Option<String>,
+    pub project_license: Option<String>,
+    pub total: i64,
+    pub restrictive: i64,
+    pub incompatible: i64,
+    pub unlicensed: i64,
+    pub policy_violations: i64,
+}
+
+/// One version of a package in a recorded scan
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord, Serialize)]
+pub struct StoredVersion {
+    pub version: String,
+    pub license: Option<String>,
+    pub is_restrictive: bool,
+}
+
+/// What changed about a package from one scan of a project to the next
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum ChangeKind {
+    Added,
+    Upgraded,
+    Relicensed,
+    Removed,
+}
+
+impl std::fmt::Display for ChangeKind {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            ChangeKind::Added => write!(f, "added"),
+            ChangeKind::Upgraded => write!(f, "upgraded"),
+            ChangeKind::Relicensed => write!(f, "relicensed"),
+            ChangeKind::Removed => write!(f, "removed"),
+        }
+    }
+}
+
+/// A change of a package in the history of a project
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct PackageChange {
+    pub scanned_at: String,
+    pub project: String,
+    pub git_commit: Option<String>,
+    pub kind: ChangeKind,
+    /// Versions before the change, empty when it was added
+    pub before: Vec<StoredVersion>,
+    /// Versions after the change, empty when it was removed
+    pub after: Vec<StoredVersion>,
+}
+
+fn licenses(versions: &[StoredVersion]) -> Vec<Option<&str>> {
+    let mut licenses: Vec<_> = versions.iter().map(|v| v.license.as_deref()).collect();
+    licenses.sort();
+    licenses.dedup();
+    licenses
+}
+
+/// The changes of a package across the scans of each project
+///
+/// `scans` are ordered by time and paired with the versions of the package
+/// they contain. A change of license takes precedence over a change of
+/// version, and scans without changes are left out.
+pub fn package_changes(scans: &[(StoredScan, Vec<StoredVersion>)]) -> Vec<PackageChange> {
+    let mut previous: BTreeMap<&str, &[StoredVersion]> = BTreeMap::new();
+    let mut changes = Vec::new();
+    for (scan, versions) in scans {
+        let before = previous.insert(&scan.project, versions).unwrap_or_default();
+        let kind = match (before.is_empty(), versions.is_empty()) {
+            (true, true) => continue,
+            (true, false) => ChangeKind::Added,
+            (false, true) => ChangeKind::Removed,
+            _ if licenses(before) != licenses(versions) => ChangeKind::Relicensed,
+            _ if before != versions.as_slice() => ChangeKind::Upgraded,
+            _ => continue,
+        };
+        changes.push(PackageChange {
+            scanned_at: scan.scanned_at.clone(),
+            project: scan.project.clone(),
+            git_commit: scan.git_commit.clone(),
+            kind,
+            before: before.to_vec(),
+            after: versions.clone(),
+        });
+    }
+    changes
+}
+
+/// History database opened from a `--store` value
+pub struct Store {
+    conn: Connection,
+}
+
+impl Store {
+    /// Open the database, creating it and its tables on first use
+    pub fn open(url: &str) -> FeludaResult<Self> {
+        let path = parse_store_url(url)?;
+        if let Some(parent) = path
+            .parent()
+            .filter(|parent| !parent.as_os_str().is_empty())
+        {
+            std::fs::create_dir_all(parent)?;
+        }
+        let conn = Connection::open(&path)
+            .map_err(|e| store_error(&format!("Failed to open {}", path.display()), e))?;
+
+        let version: i64 = conn
+            .query_row("PRAGMA user_version", [], |row| row.get(0))
+            .map_err(|e| store_error("Failed to read the schema version", e))?;
+        if version > SCHEMA_VERSION {
+            return Err(FeludaError::Store(format!(
+                "{} was created by a newer Feluda (schema version {version})",
+                path.display()
+            )));
+        }
+        conn.execute_batch(&format!(
+            "PRAGMA foreign_keys = ON;{SCHEMA}PRAGMA user_version = {SCHEMA_VERSION};"
+        ))
+        .map_err(|e| store_error("Failed to create the tables", e))?;
+        log(
+            LogLevel::Info,
+            &format!("Opened scan history {}", path.display()),
+        );
+        Ok(Self { conn })
+    }
+
+    /// Record a scan and its dependencies, returning the id of the scan
+    pub fn record_scan(&mut self, record: &ScanRecord) -> FeludaResult<i64> {
+        let dependencies = record.dependencies;
+        let count = |predicate: fn(&LicenseInfo) -> bool| -> i64 {
+            dependencies.iter().filter(|info| predicate(info)).count() as i64
+        };
+
+        let tx = self
+            .conn
+            .transaction()
+            .map_err(|e| store_error("Failed to start a transaction", e))?;
+        tx.execute(
+            "INSERT INTO scans (scanned_at, project, path, git_commit, project_license, \
+             feluda_version, total, restrictive, incompatible, unlicensed, policy_violations) \
+             VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11)",
+            params![
+                record.scanned_at,
+                record.project,
+                record.path,
+                record.git_commit,
+                record.project_license,
+                env!("CARGO_PKG_VERSION"),
+                dependencies.len() as i64,
+                count(|info| info.is_restrictive),
+                count(|info| info.compatibility == LicenseCompatibility::Incompatible),
+                count(|info| info.license.is_none()),
+                record.policy_violations as i64,
+            ],
+        )
+        .map_err(|e| store_error("Failed to record the scan", e))?;
+        let scan_id = tx.last_insert_rowid();
+
+        {
+            let mut insert = tx
+                .prepare(
+                    "INSERT INTO dependencies (scan_id, name, version, license, is_restrictive, \
+                     compatibility, source_file) VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)",
+                )
+                .map_err(|e| store_error("Failed to record the dependencies", e))?;
+            for info in dependencies {
+                insert
+                    .execute(params![
+                        scan_id,
+                        info.name,
+                        info.version,
+                        info.license,
+                        info.is_restrictive,
+                        compatibility_name(info.compatibility),
+                        info.source_file,
+                    ])
+                    .map_err(|e| store_error("Failed to record the dependencies", e))?;
+            }
+        }
+        tx.commit()
+            .map_err(|e| store_error("Failed to record the scan", e))?;
+
+        log(
+            LogLevel::Info,
+            &format!(
+                "Recorded scan {scan_id} of {} with {} dependencies",
+                record.project,
+                dependencies.len()
+            ),
+        );
+        Ok(scan_id)
+    }
+
+    /// Recorded scans from oldest to newest, of one project or of all
+    pub fn scans(&self, project: Option<&str>) -> FeludaResult<Vec<StoredScan>> {
+        let mut statement = self
+            .conn
+            .prepare(&format!(
+                "SELECT {SCAN_COLUMNS} FROM scans WHERE ?1 IS NULL OR project = ?1 \
+                 ORDER BY scanned_at, id"
+            ))
+            .map_err(|e| store_error("Failed to query the scans", e))?;
+        let rows = statement
+            .query_map(params![project], |row| {
+                Ok(StoredScan {
+                    id: row.get(0)?,
+                    scanned_at: row.get(1)?,
+                    project: row.get(2)?,
+                    path: row.get(3)?,
+                    git_commit: row.get(4)?,
+                    project_license: row.get(5)?,
+                    total: row.get(6)?,
+                    restrictive: row.get(7)?,
+                    incompatible: row.get(8)?,
+                    unlicensed: row.get(9)?,
+                    policy_violations: row.get(10)?,
+                })
+            })
+            .map_err(|e| store_error("Failed to query the scans", e))?;
+        rows.collect::<Result<_, _>>()
+            .map_err(|e| store_error("Failed to read the scans", e))
+    }
+
+    /// Dependency names and licenses of the last recorded scan of a project
+    pub fn last_licenses(&self, project: &str) -> FeludaResult<Option<KnownLicenses>> {
+        let Some(last) = self.scans(Some(project))?.pop() else {
+            return Ok(None);
+        };
+        let mut statement = self
+            .conn
+            .prepare("SELECT name, license FROM dependencies WHERE scan_id = ?1")
+            .map_err(|e| store_error("Failed to query the dependencies", e))?;
+        let rows = statement
+            .query_map(params![last.id], |row| Ok((row.get(0)?, row.get(1)?)))
+            .map_err(|e| store_error("Failed to query the dependencies", e))?;
+        rows.collect::<Result<_, _>>()
+            .map(Some)
+            .map_err(|e| store_error("Failed to read the dependencies", e))
+    }
+
+    /// Changes of a package in the recorded scans, of one project or of all
+    pub fn package_history(
+        &self,
+        package: &str,
+        project: Option<&str>,
+    ) -> FeludaResult<Vec<PackageChange>> {
+        let mut statement = self
+            .conn
+            .prepare(
+                "SELECT scan_id, version, license, is_restrictive FROM dependencies \
+                 WHERE name = ?1",
+            )
+            .map_err(|e| store_error("Failed to query the package history", e))?;
+        let rows = statement
+            .query_map(params![package], |row| {
+                Ok((
+                    row.get::<_, i64>(0)?,
+                    StoredVersion {
+                        version: row.get(1)?,
+                        license: row.get(2)?,
+                        is_restrictive: row.get(3)?,
+                    },
+                ))
+            })
+            .map_err(|e| store_error("Failed to query the package history", e))?;
+
+        let mut versions: BTreeMap<i64, Vec<StoredVersion>> = BTreeMap::new();
+        for row in rows {
+            let (scan_id, version) =
+                row.map_err(|e| store_error("Failed to read the package history", e))?;
+            versions.entry(scan_id).or_default().push(version);
+        }
+        let scans: Vec<_> = self
+            .scans(project)?
+            .into_iter()
+            .map(|scan| {
+                let mut versions = versions.remove(&scan.id).unwrap_or_default();
+                versions.sort();
+                versions.dedup();
+                (scan, versions)
+            })
+            .collect();
+        Ok(package_changes(&scans))
+    }
+}
+
+/// Record a finished scan in the `--store` database
+pub fn record_scan(
+    url: &str,
+    path: &Path,
+    project_license: Option<&str>,
+    dependencies: &[LicenseInfo],
+    policy_violations: usize,
+) -> FeludaResult<i64> {
+    let record = ScanRecord::new(path, project_license, dependencies, policy_violations);
+    Store::open(url)?.record_scan(&record)
+}
+
+fn describe_versions(versions: &[StoredVersion]) -> String {
+    versions
+        .iter()
+        .map(|v| {
+            format!(
+                "{} ({})",
+                v.version,
+                v.license.as_deref().unwrap_or("No License")
+            )
+        })
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+fn short_commit(commit: &Option<String>) -> String {
+    commit
+        .as_deref()
+        .map(|commit| commit.chars().take(7).collect())
+        .unwrap_or_default()
+}
+
+/// Print the changes of a package as a table
+pub fn print_package_history(package: &str, changes: &[PackageChange]) {
+    if changes.is_empty() {
+        println!("\nNo recorded scan contains {package}\n");
+        return;
+    }
+
+    let rows: Vec<_> = changes
+        .iter()
+        .map(|change| {
+            (
+                vec![
+                    change.scanned_at.clone(),
+                    change.project.clone(),
+                    short_commit(&change.git_commit),
+                    change.kind.to_string(),
+                    describe_versions(&change.before),
+                    describe_versions(&change.after),
+                ],
+                change.after.iter().any(|v| v.is_restrictive),
+            )
+        })
+        .collect();
+    println!();
+    print_table(
+        &format!("History of {package}"),
+        &["Scanned", "Project", "Commit", "Change", "Before", "After"],
+        &rows,
+    );
+}
+
+/// Change from the previous scan of the same project, e.g. `3 (+1)`
+fn with_delta(value: i64, previous: Option<i64>) -> String {
+    match previous.map(|previous| value - previous) {
+        Some(delta) if delta != 0 => format!("{value} ({delta:+})"),
+        _ => value.to_string(),
+    }
+}
+
+/// Print the counts of every scan with the change from the scan before
+pub fn print_trends(scans: &[StoredScan]) {
+    if scans.is_empty() {
+        println!("\nNo scans recorded yet\n");
+        return;
+    }
+
+    let mut previous: BTreeMap<&str, &StoredScan> = BTreeMap::new();
+    let rows: Vec<_> = scans
+        .iter()
+        .map(|scan| {
+            let before = previous.insert(&scan.project, scan);
+            let got_worse = before.is_some_and(|before| {
+                scan.restrictive > before.restrictive || scan.incompatible > before.incompatible
+            });
+            (
+                vec![
+                    scan.scanned_at.clone(),
+                    scan.project.clone(),
+                    short_commit(&scan.git_commit),
+                    with_delta(scan.total, before.map(|b| b.total)),
+                    with_delta(scan.restrictive, before.map(|b| b.restrictive)),
+                    with_delta(scan.incompatible, before.map(|b| b.incompatible)),
+                    with_delta(scan.unlicensed, before.map(|b| b.unlicensed)),
+                    with_delta(scan.policy_violations, before.map(|b| b.policy_violations)),
+                ],
+                got_worse,
+            )
+        })
+        .collect();
+    println!();
+    print_table(
+        "License exposure over time",
+        &[
+            "Scanned",
+            "Project",
+            "Commit",
+            "Dependencies",
+            "Restrictive",
+            "Incompatible",
+            "Unlicensed",
+            "Violations",
+        ],
+        &rows,
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::licenses::OsiStatus;
+    use tempfile::TempDir;
+
+    fn dep(name: &str, version: &str, license: &str, is_restrictive: bool) -> LicenseInfo {
+        LicenseInfo {
+            is_restrictive,
+            compatibility: LicenseCompatibility::Compatible,
+            osi_status: OsiStatus::Approved,
+            source_file: Some("package.json".to_string()),
+            ..LicenseInfo::test(name, version, Some(license))
+        }
+    }
+
+    fn record<'a>(
+        project: &str,
+        scanned_at: &str,
+        dependencies: &'a [LicenseInfo],
+    ) -> ScanRecord<'a> {
+        ScanRecord {
+            project: project.to_string(),
+            path: format!("/src/{project}"),
+            git_commit: Some("0123456789abcdef".to_string()),
+            project_license: Some("MIT".to_string()),
+            scanned_at: scanned_at.to_string(),
+            dependencies,
+            policy_violations: 0,
+        }
+    }
+
+    #[test]
+    fn test_parse_store_url() {
+        assert_eq!(
+            parse_store_url("sqlite:.feluda/history.db").unwrap(),
+            PathBuf::from(".feluda/history.db")
+        );
+        assert_eq!(
+            parse_store_url("sqlite:///var/lib/feluda.db").unwrap(),
+            PathBuf::from("/var/lib/feluda.db")
+        );
+        assert!(parse_store_url("postgres://db/feluda")
+            .unwrap_err()
+            .to_string()
+            .contains("Unsupported store backend 'postgres'"));
+        assert!(parse_store_url("history.db").is_err());
+        assert!(parse_store_url("sqlite:").is_err());
+    }
+
+    #[test]
+    fn test_package_changes() {
+        let scan = |id: i64, project: &str| StoredScan {
+            id,
+            scanned_at: format!("2025-01-0{id}T00:00:00Z"),
+            project: project.to_string(),
+            path: project.to_string(),
+            git_commit: None,
+            project_license: None,
+            total: 1,
+            restrictive: 0,
+            incompatible: 0,
+            unlicensed: 0,
+            policy_violations: 0,
+        };
+        let version = |version: &str, license: &str| StoredVersion {
+            version: version.to_string(),
+            license: Some(license.to_string()),
+            is_restrictive: license.starts_with("GPL"),
+        };
+        let scans = vec![
+            (scan(1, "api"), vec![version("1.0.0", "MIT")]),
+            (scan(2, "web"), vec![]),
+            (scan(3, "api"), vec![version("1.0.0", "MIT")]),
+            (scan(4, "api"), vec![version("1.1.0", "MIT")]),
+            (scan(5, "api"), vec![version("2.0.0", "GPL-3.0")]),
+            (scan(6, "api"), vec![]),
+        ];
+
+        let kinds: Vec<_> = package_changes(&scans)
+            .iter()
+            .map(|change| (change.scanned_at.clone(), change.kind))
+            .collect();
+        assert_eq!(
+            kinds,
+            vec![
+                ("2025-01-01T00:00:00Z".to_string(), ChangeKind::Added),
+                ("2025-01-04T00:00:00Z".to_string(), ChangeKind::Upgraded),
+                ("2025-01-05T00:00:00Z".to_string(), ChangeKind::Relicensed),
+                ("2025-01-06T00:00:00Z".to_string(), ChangeKind::Removed),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_store_round_trip() {
+        let temp_dir = TempDir::new().unwrap();
+        let url = format!("sqlite:{}", temp_dir.path().join("db/history.db").display());
+        let mut store = Store::open(&url).unwrap();
+
+        let first = vec![dep("left-pad", "1.0.0", "MIT", false)];
+        let second = vec![
+            dep("left-pad", "1.3.0", "WTFPL", false),
+            dep("readline", "8.2.0", "GPL-3.0", true),
+        ];
+        store
+            .record_scan(&record("api", "2025-01-01T00:00:00Z", &first))
+            .unwrap();
+        store
+            .record_scan(&record("web", "2025-01-02T00:00:00Z", &first))
+            .unwrap();
+        store
+            .record_scan(&record("api", "2025-01-03T00:00:00Z", &second))
+            .unwrap();
+
+        // Reopening keeps the recorded scans
+        let store = Store::open(&url).unwrap();
+        let scans = store.scans(Some("api")).unwrap();
+        assert_eq!(scans.len(), 2);
+        assert_eq!(scans[1].total, 2);
+        assert_eq!(scans[1].restrictive, 1);
+        assert_eq!(store.scans(None).unwrap().len(), 3);
+
+        let history = store.package_history("left-pad", None).unwrap();
+        let kinds: Vec<_> = history
+            .iter()
+            .map(|change| (change.project.as_str(), change.kind))
+            .collect();
+        assert_eq!(
+            kinds,
+            vec![
+                ("api", ChangeKind::Added),
+                ("web", ChangeKind::Added),
+                ("api", ChangeKind::Relicensed),
+            ]
+        );
+        assert_eq!(history[2].after[0].license.as_deref(), Some("WTFPL"));
+        assert!(store.package_history("unknown", None).unwrap().is_empty());
+
+        let last = store.last_licenses("api").unwrap().unwrap();
+        assert!(last.contains(&("readline".to_string(), Some("GPL-3.0".to_string()))));
+        assert!(!last.contains(&("left-pad".to_string(), Some("MIT".to_string()))));
+        assert!(store.last_licenses("unknown").unwrap().is_none());
+    }
+}
@@ -7,8 +7,8 @@ use ratatui::{
     style::{self, Color, Modifier, Style, Stylize},
     text::Text,
     widgets::{
-        Block, BorderType, Cell, HighlightSpacing, Paragraph, Row, Scrollbar, ScrollbarOrientation,
-        ScrollbarState, Table, TableState,
+        Block, BorderType, Cell, Clear, HighlightSpacing, Paragraph, Row, Scrollbar,
+        ScrollbarOrientation, ScrollbarState, Table, TableState, Wrap,
     },
     DefaultTerminal, Frame,
 };
@@ -16,13 +16,16 @@ use style::palette::tailwind;
 use unicode_width::UnicodeWidthStr;
 
 const INFO_TEXT: [&str; 3] = [
-    "(Esc) quit | (↑) move up | (↓) move down | (←) move left | (→) move right",
-    "(r) restrictive | (i) incompatible | (c) compatible | (a) osi-approved | (n) osi-not-approved | (u) osi-unknown | (x) clear filters | (s) sort mode",
+    "(Esc) quit | (↑) move up | (↓) move down | (←) move left | (→) move right | (Enter) details",
+    "(r) restrictive | (i) incompatible | (c) compatible | (H) high risk | (a) osi-approved | (n) osi-not-approved | (u) osi-unknown | (x) clear filters | (s) sort mode",
     "(In sort mode: ←→ select column, Enter toggle sort, Esc/q exit sort)",
 ];
 
 const ITEM_HEIGHT: usize = 4;
 
+/// Width of the Risk column, fits "Medium"
+const RISK_COLUMN_WIDTH: u16 = 6;
+
 // ============================================================================
 // KEY BINDINGS CONFIGURATION
 // ============================================================================
@@ -58,10 +61,14 @@ pub mod keybindings_normal {
     pub const FILTER_OSI_APPROVED: char = 'a';
     pub const FILTER_OSI_NOT_APPROVED: char = 'n';
     pub const FILTER_OSI_UNKNOWN: char = 'u';
+    pub const FILTER_HIGH_RISK: char = 'H';
     pub const FILTER_CLEAR_ALL: char = 'x';
 
     /// Sort mode
     pub const ENTER_SORT_MODE: char = 's';
+
+    /// Show details of the selected dependency
+    pub const OPEN_DETAILS: KeyCode = KeyCode::Enter;
 }
 
 /// Sort mode key bindings
@@ -84,6 +91,16 @@ pub mod keybindings_sort {
     pub const EXIT_SORT_MODE_CHAR: char = 'q';
 }
 
+/// Details view key bindings
+#[allow(dead_code)]
+pub mod keybindings_details {
+    use ratatui::crossterm::event::KeyCode;
+
+    /// Close the details view
+    pub const CLOSE: &[KeyCode] = &[KeyCode::Esc, KeyCode::Enter];
+    pub const CLOSE_CHAR: char = 'q';
+}
+
 const TABLE_COLOUR: tailwind::Palette = tailwind::RED;
 
 #[derive(Debug, Clone, Default)]
@@ -94,6 +111,7 @@ struct FilterState {
     show_osi_approved_only: bool,
     show_osi_not_approved_only: bool,
     show_osi_unknown_only: bool,
+    show_high_risk_only: bool,
 }
 
 impl FilterState {
@@ -104,6 +122,7 @@ impl FilterState {
             || self.show_osi_approved_only
             || self.show_osi_not_approved_only
             || self.show_osi_unknown_only
+            || self.show_high_risk_only
     }
 
     fn clear_all(&mut self) {
@@ -113,6 +132,7 @@ impl FilterState {
         self.show_osi_approved_only = false;
         self.show_osi_not_approved_only = false;
         self.show_osi_unknown_only = false;
+        self.show_high_risk_only = false;
     }
 
     fn matches(&self, item: &LicenseInfo) -> bool {
@@ -127,6 +147,10 @@ impl FilterState {
             matches = false;
         }
 
+        if self.show_high_risk_only && RiskLevel::of(item) != RiskLevel::High {
+            matches = false;
+        }
+
         if self.show_incompatible_only || self.show_compatible_only {
             let compat_match = match item.compatibility {
                 LicenseCompatibility::Incompatible => self.show_incompatible_only,
@@ -156,6 +180,83 @@ impl FilterState {
     }
 }
 
+/// Triage risk of a dependency, from its license and compatibility
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum RiskLevel {
+    Low,
+    Medium,
+    High,
+}
+
+impl RiskLevel {
+    /// Incompatible licenses are high risk; restrictive or missing licenses need a look
+    pub fn of(info: &LicenseInfo) -> Self {
+        if info.compatibility == LicenseCompatibility::Incompatible {
+            RiskLevel::High
+        } else if info.is_restrictive || has_unknown_license(info) {
+            RiskLevel::Medium
+        } else {
+            RiskLevel::Low
+        }
+    }
+
+    pub fn display_name(&self) -> &'static str {
+        match self {
+            RiskLevel::Low => "Low",
+            RiskLevel::Medium => "Medium",
+            RiskLevel::High => "High",
+        }
+    }
+}
+
+fn has_unknown_license(info: &LicenseInfo) -> bool {
+    info.license
+        .as_deref()
+        .is_none_or(|license| license.trim().is_empty() || license.starts_with("Unknown"))
+}
+
+/// Explain the risk level of a dependency for the details view
+fn risk_reasons(info: &LicenseInfo, project_license: Option<&str>) -> Vec<String> {
+    let mut reasons = Vec::new();
+    let license = info.get_license();
+
+    if info.compatibility == LicenseCompatibility::Incompatible {
+        reasons.push(format!(
+            "{license} may be incompatible with the project license {}",
+            project_license.unwrap_or("(unknown)")
+        ));
+    }
+    if info.is_restrictive {
+        reasons.push(format!("{license} is a restrictive license"));
+    }
+    if has_unknown_license(info) {
+        reasons.push("No license information was found".to_string());
+    }
+    if info.compatibility == LicenseCompatibility::Unknown && project_license.is_none() {
+        reasons.push("Compatibility is unknown without a project license".to_string());
+    }
+    if let Some(manual) = &info.manual_license {
+        let mut note = "License asserted manually".to_string();
+        if let Some(reviewer) = &manual.reviewed_by {
+            note.push_str(&format!(" by {reviewer}"));
+        }
+        if let Some(date) = &manual.date {
+            note.push_str(&format!(" on {date}"));
+        }
+        reasons.push(note);
+    }
+    if let Some(confidence) = info.license_confidence {
+        if confidence < 0.9 {
+            reasons.push(format!(
+                "License detected from a LICENSE file with {:.0}% confidence",
+                confidence * 100.0
+            ));
+        }
+    }
+
+    reasons
+}
+
 struct TableColors {
     buffer_bg: Color,
     header_bg: Color,
@@ -173,6 +274,9 @@ struct TableColors {
     osi_approved_color: Color,
     osi_not_approved_color: Color,
     osi_unknown_color: Color,
+    low_risk_color: Color,
+    medium_risk_color: Color,
+    high_risk_color: Color,
 }
 
 impl TableColors {
@@ -194,6 +298,9 @@ impl TableColors {
             osi_approved_color: tailwind::BLUE.c500,
             osi_not_approved_color: tailwind::ORANGE.c500,
             osi_unknown_color: tailwind::GRAY.c500,
+            low_risk_color: tailwind::GREEN.c500,
+            medium_risk_color: tailwind::YELLOW.c500,
+            high_risk_color: tailwind::RED.c500,
         }
     }
 }
@@ -214,6 +321,7 @@ pub enum SortColumn {
     Restrictive,
     Compatibility,
     OsiStatus,
+    Risk,
 }
 
 impl SortColumn {
@@ -226,6 +334,7 @@ impl SortColumn {
             SortColumn::Restrictive,
             SortColumn::Compatibility,
             SortColumn::OsiStatus,
+            SortColumn::Risk,
         ]
     }
 
@@ -238,6 +347,7 @@ impl SortColumn {
             SortColumn::Restrictive => "Restrictive",
             SortColumn::Compatibility => "Compatibility",
             SortColumn::OsiStatus => "OSI Status",
+            SortColumn::Risk => "Risk",
         }
     }
 }
@@ -247,6 +357,7 @@ impl SortColumn {
 pub enum AppMode {
     Normal,
     Sorting,
+    Details,
 }
 
 pub struct App {
@@ -413,6 +524,16 @@ impl App {
         self.state.select(Some(0));
     }
 
+    pub fn toggle_high_risk_filter(&mut self) {
+        self.filters.show_high_risk_only = !self.filters.show_high_risk_only;
+        log(
+            LogLevel::Info,
+            &format!("High risk filter: {}", self.filters.show_high_risk_only),
+        );
+        self.update_scroll_state();
+        self.state.select(Some(0));
+    }
+
     pub fn clear_filters(&mut self) {
         self.filters.clear_all();
         log(LogLevel::Info, "All filters cleared");
@@ -420,6 +541,28 @@ impl App {
         self.state.select(Some(0));
     }
 
+    /// Dependency under the cursor, if any
+    fn selected_item(&self) -> Option<&LicenseInfo> {
+        let index = self.state.selected()?;
+        self.get_filtered_items().get(index).copied()
+    }
+
+    /// Show details of the selected dependency
+    pub fn open_details(&mut self) {
+        if let Some(item) = self.selected_item() {
+            log(
+                LogLevel::Info,
+                &format!("Showing details for {}@{}", item.name, item.version),
+            );
+            self.mode = AppMode::Details;
+        }
+    }
+
+    pub fn close_details(&mut self) {
+        self.mode = AppMode::Normal;
+        log(LogLevel::Info, "Closed details view");
+    }
+
     /// Enter sort mode
     pub fn enter_sort_mode(&mut self) {
         self.mode = AppMode::Sorting;
@@ -584,6 +727,16 @@ impl App {
                         }
                     });
                 }
+                SortColumn::Risk => {
+                    self.items.sort_by(|a, b| {
+                        let ord = RiskLevel::of(a).cmp(&RiskLevel::of(b));
+                        if ascending {
+                            ord
+                        } else {
+                            ord.reverse()
+                        }
+                    });
+                }
             }
 
             // Reset selection to top when sorting
@@ -656,9 +809,14 @@ impl App {
                             KeyCode::Char(c) if c == keybindings_normal::FILTER_OSI_UNKNOWN => {
                                 self.toggle_osi_unknown_filter()
                             }
+                            KeyCode::Char(c) if c == keybindings_normal::FILTER_HIGH_RISK => {
+                                self.toggle_high_risk_filter()
+                            }
                             KeyCode::Char(c) if c == keybindings_normal::FILTER_CLEAR_ALL => {
                                 self.clear_filters()
                             }
+                            // Details
+                            KeyCode::Enter => self.open_details(),
                             // Sort mode
                             KeyCode::Char(c) if c == keybindings_normal::ENTER_SORT_MODE => {
                                 self.enter_sort_mode()
@@ -684,6 +842,13 @@ impl App {
                             }
                             _ => {}
                         },
+                        AppMode::Details => match key.code {
+                            KeyCode::Esc | KeyCode::Enter => self.close_details(),
+                            KeyCode::Char(c) if c == keybindings_details::CLOSE_CHAR => {
+                                self.close_details()
+                            }
+                            _ => {}
+                        },
                     }
                 }
             }
@@ -715,6 +880,10 @@ impl App {
         self.render_table(frame, rects[1]);
         self.render_scrollbar(frame, rects[1]);
         self.render_footer(frame, rects[2]);
+
+        if self.mode == AppMode::Details {
+            self.render_details(frame, rects[1]);
+        }
     }
 
     fn render_table(&mut self, frame: &mut Frame, area: Rect) {
@@ -793,6 +962,10 @@ impl App {
                 }
             };
 
+            let risk = RiskLevel::of(data);
+            let risk_text =
+                Text::from(format!("\n{}\n", risk.display_name())).fg(self.risk_color(risk));
+
             let row = Row::new([
                 Cell::from(Text::from(format!("\n{}\n", data.name))),
                 Cell::from(Text::from(format!("\n{}\n", data.version))),
@@ -800,6 +973,7 @@ impl App {
                 Cell::from(Text::from(format!("\n{}\n", data.is_restrictive()))),
                 Cell::from(compatibility_text),
                 Cell::from(osi_status_text),
+                Cell::from(risk_text),
             ])
             .style(Style::new().fg(self.colors.row_fg).bg(color))
             .height(4);
@@ -818,6 +992,7 @@ impl App {
                 Constraint::Min(self.longest_item_lens.3),
                 Constraint::Min(self.longest_item_lens.4), // Compatibility column
                 Constraint::Min(self.longest_item_lens.5), // OSI Status column
+                Constraint::Min(RISK_COLUMN_WIDTH),
             ],
         )
         .header(header)
@@ -864,6 +1039,9 @@ impl App {
         if self.filters.show_osi_unknown_only {
             filter_tags.push("OSI-Unknown");
         }
+        if self.filters.show_high_risk_only {
+            filter_tags.push("High-Risk");
+        }
 
         let filter_text = format!("Active Filters: {}", filter_tags.join(", "));
         let filtered_count = self.get_filtered_items().len();
@@ -890,6 +1068,79 @@ impl App {
         frame.render_widget(filter_paragraph, area);
     }
 
+    fn risk_color(&self, risk: RiskLevel) -> Color {
+        match risk {
+            RiskLevel::Low => self.colors.low_risk_color,
+            RiskLevel::Medium => self.colors.medium_risk_color,
+            RiskLevel::High => self.colors.high_risk_color,
+        }
+    }
+
+    /// Lines of the details view for a dependency
+    fn details_lines(&self, item: &LicenseInfo) -> Vec<String> {
+        let risk = RiskLevel::of(item);
+        let mut lines = vec![
+            format!("Name: {}", item.name),
+            format!("Version: {}", item.version),
+            format!("License: {}", item.get_license()),
+            format!("Restrictive: {}", item.is_restrictive),
+            format!(
+                "Compatibility: {} (project license: {})",
+                item.compatibility,
+                self.project_license.as_deref().unwrap_or("unknown")
+            ),
+            format!("OSI Status: {:?}", item.osi_status),
+            format!(
+                "Found in: {}",
+                item.source_file.as_deref().unwrap_or("unknown manifest")
+            ),
+            String::new(),
+            format!("Risk: {}", risk.display_name()),
+        ];
+
+        let reasons = risk_reasons(item, self.project_license.as_deref());
+        if reasons.is_empty() {
+            lines.push("  No license issues found".to_string());
+        }
+        lines.extend(reasons.into_iter().map(|reason| format!("  - {reason}")));
+        lines
+    }
+
+    fn render_details(&self, frame: &mut Frame, area: Rect) {
+        let Some(item) = self.selected_item() else {
+            return;
+        };
+        let lines = self.details_lines(item);
+
+        // Center the popup over the table
+        let width = area.width.saturating_sub(4).min(80);
+        #[allow(clippy::cast_possible_truncation)]
+        let height = area.height.min(lines.len() as u16 + 2);
+        let popup = Rect::new(
+            area.x + (area.width - width) / 2,
+            area.y + (area.height - height) / 2,
+            width,
+            height,
+        );
+
+        let details = Paragraph::new(Text::from(lines.join("\n")))
+            .style(
+                Style::new()
+                    .fg(self.colors.row_fg)
+                    .bg(self.colors.buffer_bg),
+            )
+            .wrap(Wrap { trim: false })
+            .block(
+                Block::bordered()
+                    .title(format!(" {} — (Esc/Enter/q) close ", item.name))
+                    .border_type(BorderType::Rounded)
+                    .border_style(Style::new().fg(self.risk_color(RiskLevel::of(item)))),
+            );
+
+        frame.render_widget(Clear, popup);
+        frame.render_widget(details, popup);
+    }
+
     fn render_scrollbar(&mut self, frame: &mut Frame, area: Rect) {
         frame.render_stateful_widget(
             Scrollbar::default()
@@ -1042,12 +1293,9 @@ mod tests {
     #[test]
     fn test_app_new() {
         let test_data = vec![LicenseInfo {
-            name: "test_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test_package", "1.0.0", Some("MIT"))
         }];
 
         let app = App::new(test_data.clone(), Some("MIT".to_string()));
@@ -1074,28 +1322,20 @@ mod tests {
     fn test_app_navigation() {
         let test_data = vec![
             LicenseInfo {
-                name: "package1".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package1", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "package2".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package2", "2.0.0", Some("Apache-2.0"))
             },
             LicenseInfo {
-                name: "package3".to_string(),
-                version: "3.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package3", "3.0.0", Some("GPL-3.0"))
             },
         ];
 
@@ -1131,12 +1371,9 @@ mod tests {
     #[test]
     fn test_app_navigation_single_item() {
         let test_data = vec![LicenseInfo {
-            name: "single_package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("single_package", "1.0.0", Some("MIT"))
         }];
 
         let mut app = App::new(test_data, None);
@@ -1168,20 +1405,19 @@ mod tests {
     fn test_constraint_len_calculator() {
         let test_data = vec![
             LicenseInfo {
-                name: "very_long_package_name_that_exceeds_normal_length".to_string(),
-                version: "1.0.0-beta.1+build.123".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test(
+                    "very_long_package_name_that_exceeds_normal_length",
+                    "1.0.0-beta.1+build.123",
+                    Some("MIT"),
+                )
             },
             LicenseInfo {
-                name: "short".to_string(),
-                version: "2.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("short", "2.0", Some("Apache-2.0"))
             },
         ];
 
@@ -1214,12 +1450,9 @@ mod tests {
     #[test]
     fn test_constraint_len_calculator_unicode() {
         let test_data = vec![LicenseInfo {
-            name: "package_with_émojis_🚀_and_ünïcödé".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("package_with_émojis_🚀_and_ünïcödé", "1.0.0", Some("MIT"))
         }];
 
         let (name_len, _, _, _, _, _) = constraint_len_calculator(&test_data);
@@ -1231,29 +1464,17 @@ mod tests {
     fn test_constraint_len_calculator_all_compatibility_types() {
         let test_data = vec![
             LicenseInfo {
-                name: "compatible".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("compatible", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "incompatible".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("incompatible", "1.0.0", Some("GPL-3.0"))
             },
-            LicenseInfo {
-                name: "unknown".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("Custom".to_string()),
-                is_restrictive: false,
-                compatibility: LicenseCompatibility::Unknown,
-                osi_status: crate::licenses::OsiStatus::Unknown,
-            },
+            LicenseInfo::test("unknown", "1.0.0", Some("Custom")),
         ];
 
         let (_, _, _, _, compatibility_len, _) = constraint_len_calculator(&test_data);
@@ -1265,20 +1486,15 @@ mod tests {
     fn test_constraint_len_calculator_restrictive_values() {
         let test_data = vec![
             LicenseInfo {
-                name: "package".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
                 is_restrictive: true, // true
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "package2".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("Apache".to_string()),
-                is_restrictive: false, // false
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package2", "1.0.0", Some("Apache"))
             },
         ];
 
@@ -1311,20 +1527,15 @@ mod tests {
     fn test_app_longest_item_lens_calculation() {
         let test_data = vec![
             LicenseInfo {
-                name: "short".to_string(),
-                version: "1.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("short", "1.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "much_longer_name".to_string(),
-                version: "1.0.0-beta".to_string(),
-                license: Some("Apache-2.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("much_longer_name", "1.0.0-beta", Some("Apache-2.0"))
             },
         ];
 
@@ -1341,28 +1552,20 @@ mod tests {
     fn test_sort_by_name() {
         let test_data = vec![
             LicenseInfo {
-                name: "zebra".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("zebra", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "apple".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("apple", "2.0.0", Some("Apache-2.0"))
             },
             LicenseInfo {
-                name: "banana".to_string(),
-                version: "3.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("banana", "3.0.0", Some("GPL-3.0"))
             },
         ];
 
@@ -1383,20 +1586,14 @@ mod tests {
     fn test_sort_by_name_descending() {
         let test_data = vec![
             LicenseInfo {
-                name: "apple".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("apple", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "zebra".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("zebra", "2.0.0", Some("Apache-2.0"))
             },
         ];
 
@@ -1415,20 +1612,15 @@ mod tests {
     fn test_sort_by_restrictive() {
         let test_data = vec![
             LicenseInfo {
-                name: "package1".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package1", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "package2".to_string(),
-                version: "2.0.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package2", "2.0.0", Some("Apache-2.0"))
             },
         ];
 
@@ -1449,12 +1641,9 @@ mod tests {
     #[test]
     fn test_sort_mode_navigation() {
         let test_data = vec![LicenseInfo {
-            name: "test".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test", "1.0.0", Some("MIT"))
         }];
 
         let mut app = App::new(test_data, None);
@@ -1477,12 +1666,9 @@ mod tests {
     #[test]
     fn test_sort_direction_toggle() {
         let test_data = vec![LicenseInfo {
-            name: "package".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("package", "1.0.0", Some("MIT"))
         }];
 
         let mut app = App::new(test_data, None);
@@ -1507,20 +1693,14 @@ mod tests {
     fn test_sort_column_change() {
         let test_data = vec![
             LicenseInfo {
-                name: "zebra".to_string(),
-                version: "1.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("zebra", "1.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "apple".to_string(),
-                version: "5.0.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("apple", "5.0.0", Some("Apache-2.0"))
             },
         ];
 
@@ -1543,12 +1723,9 @@ mod tests {
     #[test]
     fn test_initial_sort_state() {
         let test_data = vec![LicenseInfo {
-            name: "test".to_string(),
-            version: "1.0.0".to_string(),
-            license: Some("MIT".to_string()),
-            is_restrictive: false,
             compatibility: LicenseCompatibility::Compatible,
             osi_status: crate::licenses::OsiStatus::Approved,
+            ..LicenseInfo::test("test", "1.0.0", Some("MIT"))
         }];
 
         let app = App::new(test_data, None);
@@ -1563,28 +1740,20 @@ mod tests {
     fn test_sort_by_version_with_v_prefix() {
         let test_data = vec![
             LicenseInfo {
-                name: "package1".to_string(),
-                version: "v3.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package1", "v3.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "package2".to_string(),
-                version: "v1.0.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package2", "v1.0.0", Some("Apache-2.0"))
             },
             LicenseInfo {
-                name: "package3".to_string(),
-                version: "v2.5.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package3", "v2.5.0", Some("GPL-3.0"))
             },
         ];
 
@@ -1606,28 +1775,20 @@ mod tests {
     fn test_sort_by_version_mixed_prefix() {
         let test_data = vec![
             LicenseInfo {
-                name: "package1".to_string(),
-                version: "3.0.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package1", "3.0.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "package2".to_string(),
-                version: "v1.5.0".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package2", "v1.5.0", Some("Apache-2.0"))
             },
             LicenseInfo {
-                name: "package3".to_string(),
-                version: "v2.0.0".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package3", "v2.0.0", Some("GPL-3.0"))
             },
         ];
 
@@ -1647,28 +1808,20 @@ mod tests {
     fn test_sort_by_version_descending() {
         let test_data = vec![
             LicenseInfo {
-                name: "package1".to_string(),
-                version: "v10.14.0".to_string(),
-                license: Some("MIT".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package1", "v10.14.0", Some("MIT"))
             },
             LicenseInfo {
-                name: "package2".to_string(),
-                version: "0.14".to_string(),
-                license: Some("Apache-2.0".to_string()),
-                is_restrictive: false,
                 compatibility: LicenseCompatibility::Compatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package2", "0.14", Some("Apache-2.0"))
             },
             LicenseInfo {
-                name: "package3".to_string(),
-                version: "2015.7".to_string(),
-                license: Some("GPL-3.0".to_string()),
                 is_restrictive: true,
                 compatibility: LicenseCompatibility::Incompatible,
                 osi_status: crate::licenses::OsiStatus::Approved,
+                ..LicenseInfo::test("package3", "2015.7", Some("GPL-3.0"))
             },
         ];
 
@@ -1690,4 +1843,90 @@ mod tests {
         assert_eq!(app.items[2].version, "v10.14.0");
         assert_eq!(app.sort_direction, SortDirection::Descending);
     }
+
+    fn risk_test_data() -> Vec<LicenseInfo> {
+        let dep = |name: &str, license: Option<&str>, restrictive, compatibility| LicenseInfo {
+            is_restrictive: restrictive,
+            compatibility,
+            osi_status: crate::licenses::OsiStatus::Approved,
+            source_file: Some("package.json".to_string()),
+            ..LicenseInfo::test(name, "1.0.0", license)
+        };
+        vec![
+            dep("low", Some("MIT"), false, LicenseCompatibility::Compatible),
+            dep(
+                "high",
+                Some("GPL-3.0"),
+                true,
+                LicenseCompatibility::Incompatible,
+            ),
+            dep("medium", None, false, LicenseCompatibility::Unknown),
+        ]
+    }
+
+    #[test]
+    fn test_risk_level() {
+        let data = risk_test_data();
+        assert_eq!(RiskLevel::of(&data[0]), RiskLevel::Low);
+        assert_eq!(RiskLevel::of(&data[1]), RiskLevel::High);
+        assert_eq!(RiskLevel::of(&data[2]), RiskLevel::Medium);
+
+        let mut restrictive = data[0].clone();
+        restrictive.is_restrictive = true;
+        assert_eq!(RiskLevel::of(&restrictive), RiskLevel::Medium);
+
+        let reasons = risk_reasons(&data[1], Some("MIT"));
+        assert_eq!(reasons.len(), 2);
+        assert!(reasons[0].contains("incompatible with the project license MIT"));
+        assert!(risk_reasons(&data[0], Some("MIT")).is_empty());
+    }
+
+    #[test]
+    fn test_sort_by_risk_descending() {
+        let mut app = App::new(risk_test_data(), Some("MIT".to_string()));
+        app.enter_sort_mode();
+        app.sort_column_selection = SortColumn::all()
+            .iter()
+            .position(|&c| c == SortColumn::Risk)
+            .unwrap();
+        app.apply_current_sort();
+        app.enter_sort_mode();
+        app.apply_current_sort();
+
+        let names: Vec<&str> = app.items.iter().map(|i| i.name.as_str()).collect();
+        assert_eq!(names, vec!["high", "medium", "low"]);
+    }
+
+    #[test]
+    fn test_high_risk_filter() {
+        let mut app = App::new(risk_test_data(), Some("MIT".to_string()));
+        app.toggle_high_risk_filter();
+        let filtered = app.get_filtered_items();
+        assert_eq!(filtered.len(), 1);
+        assert_eq!(filtered[0].name, "high");
+
+        app.clear_filters();
+        assert_eq!(app.get_filtered_items().len(), 3);
+    }
+
+    #[test]
+    fn test_details_view() {
+        let mut app = App::new(risk_test_data(), Some("MIT".to_string()));
+        app.next_row();
+        app.open_details();
+        assert_eq!(app.mode, AppMode::Details);
+        assert_eq!(app.selected_item().unwrap().name, "high");
+
+        let lines = app.details_lines(app.selected_item().unwrap());
+        assert!(lines.contains(&"Found in: package.json".to_string()));
+        assert!(lines.contains(&"Risk: High".to_string()));
+
+        app.close_details();
+        assert_eq!(app.mode, AppMode::Normal);
+
+        // Nothing to show for an empty table
+        let mut empty = App::new(vec![], None);
+        empty.open_details();
+        assert_eq!(empty.mode, AppMode::Normal);
+    }
 }
@@ -0,0 +1,697 @@
+//! Reports rendered through user templates (`--template`)
+//!
+//! Templates are Go `text/template` templates rendered with gtmpl, so
+//! templates and habits from Go tooling carry over. Actions between `{{` and
+//! `}}` read the versioned JSON report (schema 2) by its JSON field names, e.g.
+//! `{{ range .dependencies }}{{ .name }}{{ end }}`.
+//!
+//! Besides the builtin functions of Go, templates can call a few helpers for
+//! formatting reports (see [`FUNCTIONS`]). `printf` is Feluda's own subset of
+//! Go's, with widths and precisions capped at [`MAX_WIDTH`]. JSON `null` is
+//! Go's `nil`; `default` replaces it.
+
+use chrono::{SecondsFormat, Utc};
+use gtmpl::{Context, Func, FuncError};
+use serde_json::{Number, Value};
+use std::cmp::Ordering;
+use std::fs;
+use std::iter::Peekable;
+use std::str::Chars;
+
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::LicenseInfo;
+use crate::policy::PolicyViolation;
+use crate::report_json::build_report_v2;
+
+/// Largest width or precision `printf` pads or cuts to
+pub const MAX_WIDTH: usize = 1024;
+
+/// Functions templates can call besides Go's builtins
+pub const FUNCTIONS: [(&str, Func); 17] = [
+    ("printf", |args| helper("printf", args)),
+    ("upper", |args| helper("upper", args)),
+    ("lower", |args| helper("lower", args)),
+    ("title", |args| helper("title", args)),
+    ("trim", |args| helper("trim", args)),
+    ("join", |args| helper("join", args)),
+    ("split", |args| helper("split", args)),
+    ("replace", |args| helper("replace", args)),
+    ("contains", |args| helper("contains", args)),
+    ("hasPrefix", |args| helper("hasPrefix", args)),
+    ("hasSuffix", |args| helper("hasSuffix", args)),
+    ("default", |args| helper("default", args)),
+    ("toJson", |args| helper("toJson", args)),
+    ("csv", |args| helper("csv", args)),
+    ("where", |args| helper("where", args)),
+    ("sortBy", |args| helper("sortBy", args)),
+    ("now", |args| helper("now", args)),
+];
+
+static NULL: Value = Value::Null;
+
+/// Run a helper on the JSON form of its arguments
+fn helper(name: &str, args: &[gtmpl::Value]) -> Result<gtmpl::Value, FuncError> {
+    let args = args.iter().map(from_gtmpl).collect();
+    call(name, args)
+        .map(|value| to_gtmpl(&value))
+        .map_err(FuncError::Generic)
+}
+
+/// A JSON value as gtmpl sees it, objects becoming maps
+fn to_gtmpl(value: &Value) -> gtmpl::Value {
+    match value {
+        Value::Null => gtmpl::Value::Nil,
+        Value::Bool(value) => gtmpl::Value::Bool(*value),
+        Value::Number(number) => {
+            if let Some(number) = number.as_u64() {
+                gtmpl::Value::from(number)
+            } else if let Some(number) = number.as_i64() {
+                gtmpl::Value::from(number)
+            } else {
+                gtmpl::Value::from(number.as_f64().unwrap_or_default())
+            }
+        }
+        Value::String(text) => gtmpl::Value::String(text.clone()),
+        Value::Array(items) => gtmpl::Value::Array(items.iter().map(to_gtmpl).collect()),
+        Value::Object(map) => gtmpl::Value::Map(
+            map.iter()
+                .map(|(key, value)| (key.clone(), to_gtmpl(value)))
+                .collect(),
+        ),
+    }
+}
+
+/// The JSON form of a value passed to a helper
+fn from_gtmpl(value: &gtmpl::Value) -> Value {
+    match value {
+        gtmpl::Value::Bool(value) => Value::Bool(*value),
+        gtmpl::Value::Number(number) => match (number.as_u64(), number.as_i64()) {
+            (Some(number), _) => Value::from(number),
+            (_, Some(number)) => Value::from(number),
+            _ => number
+                .as_f64()
+                .and_then(Number::from_f64)
+                .map_or(Value::Null, Value::Number),
+        },
+        gtmpl::Value::String(text) => Value::String(text.clone()),
+        gtmpl::Value::Array(items) => Value::Array(items.iter().map(from_gtmpl).collect()),
+        gtmpl::Value::Object(map) | gtmpl::Value::Map(map) => Value::Object(
+            map.iter()
+                .map(|(key, value)| (key.clone(), from_gtmpl(value)))
+                .collect(),
+        ),
+        _ => Value::Null,
+    }
+}
+
+fn is_identifier_char(c: char) -> bool {
+    c.is_alphanumeric() || c == '_'
+}
+
+/// Go's notion of truth: false, 0, nil and empty strings, lists and maps are false
+fn is_true(value: &Value) -> bool {
+    match value {
+        Value::Null => false,
+        Value::Bool(value) => *value,
+        Value::Number(number) => number.as_f64().is_some_and(|n| n != 0.0),
+        Value::String(text) => !text.is_empty(),
+        Value::Array(items) => !items.is_empty(),
+        Value::Object(map) => !map.is_empty(),
+    }
+}
+
+fn type_name(value: &Value) -> &'static str {
+    match value {
+        Value::Null => "nil",
+        Value::Bool(_) => "bool",
+        Value::Number(_) => "number",
+        Value::String(_) => "string",
+        Value::Array(_) => "list",
+        Value::Object(_) => "map",
+    }
+}
+
+/// The printed form of a value, like Go's `%v`
+fn to_text(value: &Value) -> String {
+    match value {
+        Value::Null => String::new(),
+        Value::Bool(value) => value.to_string(),
+        Value::Number(number) => number.to_string(),
+        Value::String(text) => text.clone(),
+        Value::Array(items) => format!(
+            "[{}]",
+            items.iter().map(to_text).collect::<Vec<_>>().join(" ")
+        ),
+        Value::Object(map) => {
+            let mut entries: Vec<_> = map.iter().collect();
+            entries.sort_by(|a, b| a.0.cmp(b.0));
+            let entries: Vec<_> = entries
+                .into_iter()
+                .map(|(key, value)| format!("{key}:{}", to_text(value)))
+                .collect();
+            format!("map[{}]", entries.join(" "))
+        }
+    }
+}
+
+fn field<'a>(value: &'a Value, fields: &[String]) -> Result<&'a Value, String> {
+    let mut current = value;
+    for name in fields {
+        current = match current {
+            Value::Object(map) => map.get(name).unwrap_or(&NULL),
+            Value::Null => &NULL,
+            other => {
+                return Err(format!(
+                    "can't evaluate field {name} in type {}",
+                    type_name(other)
+                ))
+            }
+        };
+    }
+    Ok(current)
+}
+
+fn equal(a: &Value, b: &Value) -> bool {
+    match (a.as_f64(), b.as_f64()) {
+        (Some(a), Some(b)) => a == b,
+        _ => a == b,
+    }
+}
+
+fn compare(a: &Value, b: &Value) -> Result<Ordering, String> {
+    match (a, b) {
+        (Value::Number(_), Value::Number(_)) => a
+            .as_f64()
+            .zip(b.as_f64())
+            .and_then(|(a, b)| a.partial_cmp(&b))
+            .ok_or_else(|| "invalid number for comparison".to_string()),
+        (Value::String(a), Value::String(b)) => Ok(a.cmp(b)),
+        (a, b) => Err(format!(
+            "incompatible types for comparison: {} and {}",
+            type_name(a),
+            type_name(b)
+        )),
+    }
+}
+
+fn list<'a>(name: &str, value: &'a Value) -> Result<&'a [Value], String> {
+    match value {
+        Value::Array(items) => Ok(items),
+        Value::Null => Ok(&[]),
+        other => Err(format!("{name} expects a list, got {}", type_name(other))),
+    }
+}
+
+/// The width or precision at the start of `chars`, at most [`MAX_WIDTH`]
+fn number_in(chars: &mut Peekable<Chars>) -> usize {
+    let mut number: usize = 0;
+    while let Some(digit) = chars.peek().and_then(|c| c.to_digit(10)) {
+        number = number
+            .checked_mul(10)
+            .and_then(|number| number.checked_add(digit as usize))
+            .map_or(MAX_WIDTH, |number| number.min(MAX_WIDTH));
+        chars.next();
+    }
+    number
+}
+
+/// A subset of Go's `fmt.Sprintf`: the verbs %v %s %q %d %f %t and %%, with
+/// the `-`, `+` and `0` flags, width and precision
+fn sprintf(format: &str, args: &[Value]) -> String {
+    let mut output = String::new();
+    let mut chars = format.chars().peekable();
+    let mut args = args.iter();
+
+    while let Some(c) = chars.next() {
+        if c != '%' {
+            output.push(c);
+            continue;
+        }
+        let (mut left, mut zero, mut plus) = (false, false, false);
+        while let Some(flag) = chars.peek() {
+            match flag {
+                '-' => left = true,
+                '0' => zero = true,
+                '+' => plus = true,
+                _ => break,
+            }
+            chars.next();
+        }
+        let width = number_in(&mut chars);
+        let mut precision = None;
+        if chars.peek() == Some(&'.') {
+            chars.next();
+            precision = Some(number_in(&mut chars));
+        }
+
+        let Some(verb) = chars.next() else {
+            output.push_str("%!(NOVERB)");
+            break;
+        };
+        if verb == '%' {
+            output.push('%');
+            continue;
+        }
+        let Some(arg) = args.next() else {
+            output.push_str(&format!("%!{verb}(MISSING)"));
+            continue;
+        };
+
+        let number = arg.as_f64();
+        let mut text = match (verb, number) {
+            ('v' | 's', _) => {
+                let text = to_text(arg);
+                match precision {
+                    Some(precision) => text.chars().take(precision).collect(),
+                    None => text,
+                }
+            }
+            ('q', _) => Value::String(to_text(arg)).to_string(),
+            ('d', Some(number)) => format!("{}", number.trunc() as i64),
+            ('f', Some(number)) => format!("{:.*}", precision.unwrap_or(6), number),
+            ('t', _) if arg.is_boolean() => to_text(arg),
+            _ => format!("%!{verb}({})", to_text(arg)),
+        };
+        let numeric = matches!(verb, 'd' | 'f') && number.is_some();
+        if numeric && plus && !text.starts_with('-') {
+            text.insert(0, '+');
+        }
+
+        let length = text.chars().count();
+        if length < width {
+            let padding = width - length;
+            if left {
+                text.push_str(&" ".repeat(padding));
+            } else if zero && numeric {
+                let sign = usize::from(text.starts_with(['-', '+']));
+                text.insert_str(sign, &"0".repeat(padding));
+            } else {
+                text.insert_str(0, &" ".repeat(padding));
+            }
+        }
+        output.push_str(&text);
+    }
+
+    let extra: Vec<_> = args.map(to_text).collect();
+    if !extra.is_empty() {
+        output.push_str(&format!("%!(EXTRA {})", extra.join(", ")));
+    }
+    output
+}
+
+fn escape_csv(text: &str) -> String {
+    if text.contains([',', '"', '\n', '\r']) {
+        format!("\"{}\"", text.replace('"', "\"\""))
+    } else {
+        text.to_string()
+    }
+}
+
+fn title_case(text: &str) -> String {
+    let mut output = String::with_capacity(text.len());
+    let mut word_start = true;
+    for c in text.chars() {
+        if word_start {
+            output.extend(c.to_uppercase());
+        } else {
+            output.push(c);
+        }
+        word_start = !is_identifier_char(c);
+    }
+    output
+}
+
+/// The field at a dotted `path` of a list item, for `where` and `sortBy`
+fn path_field<'a>(item: &'a Value, path: &str) -> Result<&'a Value, String> {
+    let fields: Vec<String> = path.split('.').map(String::from).collect();
+    field(item, &fields)
+}
+
+/// Call the helper `name` with `args` in JSON form
+fn call(name: &str, args: Vec<Value>) -> Result<Value, String> {
+    let count = args.len();
+    let want = |expected: usize| {
+        if count == expected {
+            Ok(())
+        } else {
+            Err(format!(
+                "wrong number of args for {name}: want {expected} got {count}"
+            ))
+        }
+    };
+    let want_at_least = |expected: usize| {
+        if count >= expected {
+            Ok(())
+        } else {
+            Err(format!(
+                "wrong number of args for {name}: want at least {expected} got {count}"
+            ))
+        }
+    };
+
+    let value = match name {
+        "printf" => {
+            want_at_least(1)?;
+            let Value::String(format) = &args[0] else {
+                return Err("printf expects a format string".to_string());
+            };
+            Value::String(sprintf(format, &args[1..]))
+        }
+        "upper" | "lower" | "title" | "trim" | "csv" => {
+            want(1)?;
+            let text = to_text(&args[0]);
+            Value::String(match name {
+                "upper" => text.to_uppercase(),
+                "lower" => text.to_lowercase(),
+                "title" => title_case(&text),
+                "trim" => text.trim().to_string(),
+                _ => escape_csv(&text),
+            })
+        }
+        "join" => {
+            want(2)?;
+            let items: Vec<_> = list(name, &args[1])?.iter().map(to_text).collect();
+            Value::String(items.join(&to_text(&args[0])))
+        }
+        "split" => {
+            want(2)?;
+            let text = to_text(&args[1]);
+            let separator = to_text(&args[0]);
+            Value::Array(
+                text.split(separator.as_str())
+                    .map(|part| Value::String(part.to_string()))
+                    .collect(),
+            )
+        }
+        "replace" => {
+            want(3)?;
+            Value::String(to_text(&args[2]).replace(&to_text(&args[0]), &to_text(&args[1])))
+        }
+        "contains" => {
+            want(2)?;
+            Value::Bool(match &args[1] {
+                Value::Array(items) => items.iter().any(|item| equal(item, &args[0])),
+                haystack => to_text(haystack).contains(&to_text(&args[0])),
+            })
+        }
+        "hasPrefix" => {
+            want(2)?;
+            Value::Bool(to_text(&args[1]).starts_with(&to_text(&args[0])))
+        }
+        "hasSuffix" => {
+            want(2)?;
+            Value::Bool(to_text(&args[1]).ends_with(&to_text(&args[0])))
+        }
+        "default" => {
+            want(2)?;
+            let mut args = args;
+            let value = args.pop().unwrap_or_default();
+            if is_true(&value) {
+                value
+            } else {
+                args.pop().unwrap_or_default()
+            }
+        }
+        "toJson" => {
+            want(1)?;
+            Value::String(args[0].to_string())
+        }
+        "where" => {
+            want(3)?;
+            let path = to_text(&args[0]);
+            let mut matching = Vec::new();
+            for item in list(name, &args[2])? {
+                if equal(path_field(item, &path)?, &args[1]) {
+                    matching.push(item.clone());
+                }
+            }
+            Value::Array(matching)
+        }
+        "sortBy" => {
+            want(2)?;
+            let path = to_text(&args[0]);
+            let mut keyed = Vec::new();
+            for item in list(name, &args[1])? {
+                keyed.push((path_field(item, &path)?.clone(), item.clone()));
+            }
+            keyed.sort_by(|(a, _), (b, _)| {
+                compare(a, b).unwrap_or_else(|_| to_text(a).cmp(&to_text(b)))
+            });
+            Value::Array(keyed.into_iter().map(|(_, item)| item).collect())
+        }
+        "now" => {
+            want(0)?;
+            Value::String(Utc::now().to_rfc3339_opts(SecondsFormat::Secs, true))
+        }
+        _ => return Err(format!("function \"{name}\" not defined")),
+    };
+    Ok(value)
+}
+
+/// A parsed template
+pub struct Template {
+    template: gtmpl::Template,
+}
+
+impl Template {
+    /// Parse the source of a template
+    pub fn parse(source: &str) -> FeludaResult<Self> {
+        let mut template = gtmpl::Template::default();
+        template.add_funcs(&FUNCTIONS);
+        template
+            .parse(source)
+            .map_err(|e| FeludaError::Template(e.to_string()))?;
+        Ok(Self { template })
+    }
+
+    /// Render the template with `data` as dot and `$`
+    pub fn render(&self, data: &Value) -> FeludaResult<String> {
+        self.template
+            .render(&Context::from(to_gtmpl(data)))
+            .map_err(|e| FeludaError::Template(e.to_string()))
+    }
+}
+
+/// Render the scan through the template in `template_path` and write it to
+/// `output_file`, or print it to stdout
+///
+/// The template sees the same document as `--format json --schema 2`.
+pub fn write_template_report(
+    template_path: &str,
+    project_path: &str,
+    data: &[LicenseInfo],
+    project_license: Option<&str>,
+    policy_violations: &[PolicyViolation],
+    output_file: Option<&str>,
+) -> FeludaResult<()> {
+    let source = fs::read_to_string(template_path).map_err(|e| {
+        FeludaError::Template(format!("Failed to read template {template_path}: {e}"))
+    })?;
+    let in_template = |e: FeludaError| match e {
+        FeludaError::Template(message) => {
+            FeludaError::Template(format!("{template_path}: {message}"))
+        }
+        other => other,
+    };
+    let template = Template::parse(&source).map_err(in_template)?;
+
+    let report = build_report_v2(project_path, data, project_license, policy_violations);
+    let report = serde_json::to_value(&report).map_err(|e| {
+        FeludaError::Serialization(format!("Failed to serialize report for template: {e}"))
+    })?;
+    let content = template.render(&report).map_err(in_template)?;
+
+    match output_file {
+        Some(file_path) => {
+            fs::write(file_path, &content).map_err(|e| {
+                FeludaError::FileWrite(format!("Failed to write templated report: {e}"))
+            })?;
+            log(
+                LogLevel::Info,
+                &format!("Report rendered with {template_path} written to: {file_path}"),
+            );
+        }
+        None => print!("{content}"),
+    }
+
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn render(source: &str, data: &Value) -> String {
+        Template::parse(source).unwrap().render(data).unwrap()
+    }
+
+    fn report() -> Value {
+        json!({
+            "project": { "name": "demo", "license": "MIT" },
+            "summary": { "total": 3 },
+            "dependencies": [
+                { "name": "serde", "version": "1.0.0", "license": "MIT OR Apache-2.0", "is_restrictive": false },
+                { "name": "gpl-lib", "version": "2.1.0", "license": "GPL-3.0", "is_restrictive": true },
+                { "name": "mystery", "version": "0.1.0", "license": null, "is_restrictive": false }
+            ],
+            "policy_violations": []
+        })
+    }
+
+    #[test]
+    fn test_render_actions() {
+        let data = report();
+        assert_eq!(
+            render(
+                "Project {{ .project.name }} ({{ $.project.license }})",
+                &data
+            ),
+            "Project demo (MIT)"
+        );
+        assert_eq!(
+            render(
+                "{{ range $i, $dep := .dependencies }}{{ $i }}={{ $dep.name }}@{{ .version }} {{ end }}",
+                &data
+            ),
+            "0=serde@1.0.0 1=gpl-lib@2.1.0 2=mystery@0.1.0 "
+        );
+        assert_eq!(
+            render(
+                "{{ range .dependencies -}}\n  {{ if .is_restrictive }}!{{ else }}ok{{ end }}\n{{- end }}",
+                &data
+            ),
+            "ok!ok"
+        );
+        assert_eq!(
+            render(
+                "{{ range .policy_violations }}x{{ else }}none{{ end }}",
+                &data
+            ),
+            "none"
+        );
+        assert_eq!(
+            render(
+                "{{/* a comment */}}{{ with .project }}{{ .name }}{{ end }}",
+                &data
+            ),
+            "demo"
+        );
+        assert_eq!(
+            render(
+                "{{ (index .dependencies 1).name }} {{ index .project \"name\" }}",
+                &data
+            ),
+            "gpl-lib demo"
+        );
+    }
+
+    #[test]
+    fn test_render_functions() {
+        let data = report();
+        assert_eq!(
+            render(
+                r#"{{ printf "%-8s|%5.1f|%03d|%q" "ab" 2.26 7 "x" }}"#,
+                &data
+            ),
+            r#"ab      |  2.3|007|"x""#
+        );
+        assert_eq!(
+            render(
+                r#"{{ range where "is_restrictive" true .dependencies }}{{ .name | upper }}{{ end }}"#,
+                &data
+            ),
+            "GPL-LIB"
+        );
+        assert_eq!(
+            render(
+                r#"{{ range sortBy "name" .dependencies }}{{ .name }},{{ end }}"#,
+                &data
+            ),
+            "gpl-lib,mystery,serde,"
+        );
+        assert_eq!(
+            render(
+                r#"{{ range .dependencies }}{{ .license | default "UNKNOWN" }};{{ end }}"#,
+                &data
+            ),
+            "MIT OR Apache-2.0;GPL-3.0;UNKNOWN;"
+        );
+        assert_eq!(
+            render(
+                r#"{{ split "," "a,b" | join " + " }} {{ "a, \"b\"" | csv }}"#,
+                &data
+            ),
+            r#"a + b "a, ""b""""#
+        );
+        assert_eq!(
+            render(
+                r#"{{ title "mit license" }} {{ contains "GPL" "LGPL-2.1" }} {{ .summary | toJson }}"#,
+                &data
+            ),
+            r#"Mit License true {"total":3}"#
+        );
+    }
+
+    #[test]
+    fn test_sprintf_widths() {
+        assert_eq!(
+            sprintf("%5d|%-4s|", &[json!(42), json!("ab")]),
+            "   42|ab  |"
+        );
+        assert_eq!(sprintf("%.2s", &[json!("abc")]), "ab");
+        // Widths past MAX_WIDTH, even ones overflowing usize, are capped
+        assert_eq!(
+            sprintf("%99999999999999999999999d", &[json!(1)]).len(),
+            MAX_WIDTH
+        );
+        assert_eq!(
+            sprintf("%.99999999999999999999999f", &[json!(1.5)]).len(),
+            MAX_WIDTH + 2
+        );
+        assert_eq!(sprintf("%d %d", &[json!(1)]), "1 %!d(MISSING)");
+    }
+
+    #[test]
+    fn test_template_errors() {
+        let error = |source: &str| match Template::parse(source).and_then(|t| t.render(&report())) {
+            Err(FeludaError::Template(message)) => message,
+            other => panic!("Expected template error, got {other:?}"),
+        };
+        assert!(error("a\n{{ nope . }}").contains("nope"));
+        assert!(!error("{{ if .project }}").is_empty());
+        assert!(error("{{ join \",\" 1 }}").contains("join expects a list"));
+    }
+
+    #[test]
+    fn test_write_template_report() {
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let template_path = temp_dir.path().join("report.tmpl");
+        let output_path = temp_dir.path().join("report.txt");
+        fs::write(
+            &template_path,
+            "{{ .schema_version }} {{ .tool.name }} {{ .project.license }} {{ len .dependencies }}\n",
+        )
+        .unwrap();
+
+        write_template_report(
+            template_path.to_str().unwrap(),
+            ".",
+            &[],
+            Some("MIT"),
+            &[],
+            output_path.to_str(),
+        )
+        .unwrap();
+        assert_eq!(
+            fs::read_to_string(&output_path).unwrap(),
+            "2 feluda MIT 0\n"
+        );
+
+        fs::write(&template_path, "{{ if }}").unwrap();
+        let error =
+            write_template_report(template_path.to_str().unwrap(), ".", &[], None, &[], None)
+                .unwrap_err();
+        assert!(error.to_string().contains("report.tmpl: "));
+    }
+}
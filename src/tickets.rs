@@ -0,0 +1,835 @@
+//! Issue tracker tickets for policy violations (`--sync-tickets`)
+//!
+//! Every policy violation of a scan gets a ticket in GitHub Issues or Jira,
+//! with the dependency path and the suggestions of [`crate::remediation`].
+//! Tickets carry a fingerprint of the project, the dependency, its license and
+//! the kind of violation, so later scans find the ticket again instead of
+//! opening another one: upgrading a dependency keeps its ticket, while a change
+//! of license opens a new one. Tickets whose violation is no longer reported
+//! are commented on and closed.
+//!
+//! Violations accepted in the baseline get no ticket. Only the tickets of the
+//! scanned project are looked at, so several projects can share a tracker.
+//!
+//! ```toml
+//! [tickets]
+//! tracker = "jira"
+//! url = "https://acme.atlassian.net"
+//! project = "LEGAL"
+//! username = "feluda-bot@acme.com"
+//! token_env = "JIRA_API_TOKEN"
+//! ```
+
+use reqwest::blocking::{Client, RequestBuilder, Response};
+use serde::{Deserialize, Serialize};
+use serde_json::{json, Value};
+use sha2::{Digest, Sha256};
+use std::collections::{BTreeMap, BTreeSet};
+use std::env;
+use std::path::Path;
+
+use crate::aggregate::project_name;
+use crate::config::{FeludaConfig, TicketsConfig};
+use crate::debug::{log, FeludaError, FeludaResult, LogLevel};
+use crate::dependency_submission::github_repository;
+use crate::licenses::{get_github_token, LicenseInfo};
+use crate::policy::PolicyViolation;
+use crate::registry::{self, Registry};
+use crate::remediation::{suggest_remediations, Finding, Remediation};
+
+/// Label of every ticket Feluda opens
+const LABEL: &str = "feluda";
+
+const GITHUB_API_URL: &str = "https://api.github.com";
+
+/// Start of the comment identifying GitHub issues opened by Feluda
+const GITHUB_MARKER: &str = "<!-- feluda-violation ";
+
+/// Tickets requested per page when listing the open tickets
+const PAGE_SIZE: usize = 100;
+
+/// Issue tracker tickets are opened in
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum TrackerKind {
+    /// GitHub Issues of a repository
+    GitHub,
+    /// A Jira Cloud or Data Center project
+    Jira,
+}
+
+/// A ticket for a violation, found in the tracker
+#[derive(Debug, Clone, PartialEq)]
+pub struct Ticket {
+    /// Issue number or key, e.g. `42` or `LEGAL-7`
+    pub id: String,
+    pub fingerprint: String,
+}
+
+/// Tickets opened and closed by a sync
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct TicketSync {
+    /// Links or keys of the new tickets
+    pub opened: Vec<String>,
+    pub closed: Vec<String>,
+    /// Tickets left open as their violation is still reported
+    pub kept: usize,
+}
+
+/// Identifies the violations of a dependency across scans
+fn fingerprint(project: &str, violation: &PolicyViolation) -> String {
+    let key = format!(
+        "{project}\0{:?}\0{}\0{}",
+        violation.kind,
+        violation.name,
+        violation.license.as_deref().unwrap_or_default()
+    );
+    Sha256::digest(key.as_bytes())
+        .iter()
+        .take(8)
+        .map(|byte| format!("{byte:02x}"))
+        .collect()
+}
+
+/// Violations without a ticket, grouped by fingerprint, and tickets whose violation is gone
+#[allow(clippy::type_complexity)]
+fn plan<'a>(
+    project: &str,
+    violations: &'a [PolicyViolation],
+    open: &'a [Ticket],
+) -> (Vec<(String, Vec<&'a PolicyViolation>)>, Vec<&'a Ticket>) {
+    let mut groups: BTreeMap<String, Vec<&PolicyViolation>> = BTreeMap::new();
+    for violation in violations {
+        groups
+            .entry(fingerprint(project, violation))
+            .or_default()
+            .push(violation);
+    }
+    let ticketed: BTreeSet<&str> = open.iter().map(|t| t.fingerprint.as_str()).collect();
+    let to_close = open
+        .iter()
+        .filter(|ticket| !groups.contains_key(&ticket.fingerprint))
+        .collect();
+    let to_open = groups
+        .into_iter()
+        .filter(|(fingerprint, _)| !ticketed.contains(fingerprint.as_str()))
+        .collect();
+    (to_open, to_close)
+}
+
+/// Markup of ticket descriptions
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Markup {
+    Markdown,
+    /// Jira wiki markup, as accepted by the v2 REST API
+    Jira,
+}
+
+impl Markup {
+    fn heading(self, text: &str) -> String {
+        match self {
+            Markup::Markdown => format!("### {text}"),
+            Markup::Jira => format!("h3. {text}"),
+        }
+    }
+
+    fn code(self, text: &str) -> String {
+        match self {
+            Markup::Markdown => format!("`{text}`"),
+            Markup::Jira => format!("{{{{{text}}}}}"),
+        }
+    }
+
+    fn code_block(self, text: &str) -> String {
+        match self {
+            Markup::Markdown => format!("```toml\n{}\n```", text.trim_end()),
+            Markup::Jira => format!("{{code}}\n{}\n{{code}}", text.trim_end()),
+        }
+    }
+}
+
+fn ticket_title(project: &str, violation: &PolicyViolation) -> String {
+    format!(
+        "{project}: {} ({}), {}",
+        violation.name,
+        violation.license.as_deref().unwrap_or("No License"),
+        violation.kind.describe()
+    )
+}
+
+fn remediation_line(markup: Markup, remediation: &Remediation) -> String {
+    match remediation {
+        Remediation::Replace {
+            package,
+            license,
+            note,
+        } => {
+            let note = if note.is_empty() {
+                String::new()
+            } else {
+                format!(": {note}")
+            };
+            format!("Replace with {} ({license}){note}", markup.code(package))
+        }
+        Remediation::ChangeVersion {
+            version,
+            license,
+            newer,
+        } => format!(
+            "{} to {} ({license})",
+            if *newer { "Upgrade" } else { "Downgrade" },
+            markup.code(version)
+        ),
+        Remediation::Exception { config } => format!(
+            "After a review, accept it in {}:\n{}",
+            markup.code(".feluda.toml"),
+            markup.code_block(config)
+        ),
+    }
+}
+
+/// Description of a ticket for the violations of one dependency
+fn ticket_body(
+    markup: Markup,
+    project: &str,
+    violations: &[&PolicyViolation],
+    dependencies: &[LicenseInfo],
+    remediations: &[Remediation],
+) -> String {
+    let first = violations[0];
+    let mut lines = vec![
+        format!("Feluda found a dependency that violates the license policy of {project}."),
+        String::new(),
+        format!("* Package: {}", markup.code(&first.name)),
+        format!(
+            "* License: {}",
+            first.license.as_deref().unwrap_or("No License")
+        ),
+        format!("* Violation: {}", first.kind.describe()),
+    ];
+    for violation in violations {
+        let manifest = dependencies
+            .iter()
+            .find(|info| info.name == violation.name && info.version == violation.version)
+            .and_then(|info| info.source_file.as_deref());
+        let mut line = format!("* Version {}", markup.code(&violation.version));
+        if let Some(manifest) = manifest {
+            line.push_str(&format!(" in {}", markup.code(manifest)));
+        }
+        match &violation.introduced_by {
+            Some(path) => line.push_str(&format!(", pulled in by {path}")),
+            None => line.push_str(", a direct dependency"),
+        }
+        lines.push(line);
+    }
+
+    if !remediations.is_empty() {
+        lines.push(String::new());
+        lines.push(markup.heading("Suggested remediation"));
+        lines.push(String::new());
+        for remediation in remediations {
+            lines.push(format!("* {}", remediation_line(markup, remediation)));
+        }
+    }
+
+    lines.push(String::new());
+    lines.push(
+        "This ticket is closed automatically once the violation is no longer reported.".to_string(),
+    );
+    lines.join("\n")
+}
+
+/// Comment identifying a GitHub issue, as the body carries no labels of its own
+fn github_marker(project: &str, fingerprint: &str) -> String {
+    format!(
+        "{GITHUB_MARKER}project=\"{}\" id=\"{fingerprint}\" -->",
+        project.replace('"', "'")
+    )
+}
+
+/// Project and fingerprint of a GitHub issue body with a marker
+fn parse_github_marker(body: &str) -> Option<(String, String)> {
+    let start = body.find(GITHUB_MARKER)? + GITHUB_MARKER.len();
+    let marker = &body[start..start + body[start..].find("-->")?];
+    let attribute = |name: &str| {
+        let prefix = format!("{name}=\"");
+        let value = &marker[marker.find(&prefix)? + prefix.len()..];
+        Some(value[..value.find('"')?].to_string())
+    };
+    Some((attribute("project")?, attribute("id")?))
+}
+
+/// Jira label of the tickets of a project, labels can't contain spaces
+fn jira_project_label(project: &str) -> String {
+    let slug: String = project
+        .chars()
+        .map(|c| {
+            if c.is_ascii_alphanumeric() {
+                c.to_ascii_lowercase()
+            } else {
+                '-'
+            }
+        })
+        .collect();
+    format!("{LABEL}-project-{slug}")
+}
+
+/// Fingerprint of a Jira ticket from its `feluda-<fingerprint>` label
+fn jira_fingerprint(labels: &[Value]) -> Option<String> {
+    labels.iter().filter_map(Value::as_str).find_map(|label| {
+        let fingerprint = label.strip_prefix("feluda-")?;
+        (fingerprint.len() == 16 && fingerprint.chars().all(|c| c.is_ascii_hexdigit()))
+            .then(|| fingerprint.to_string())
+    })
+}
+
+/// Body of a successful response, or an error naming what was attempted
+fn expect_success(response: Response, action: &str) -> FeludaResult<Value> {
+    let status = response.status();
+    let body: Value = response.json().unwrap_or_default();
+    if !status.is_success() {
+        let message = body["message"]
+            .as_str()
+            .or_else(|| body["errorMessages"][0].as_str())
+            .unwrap_or_default();
+        return Err(FeludaError::InvalidData(format!(
+            "Failed to {action}: HTTP {status} {message}"
+        )));
+    }
+    Ok(body)
+}
+
+trait Tracker {
+    fn markup(&self) -> Markup;
+    /// Open tickets of the scanned project
+    fn open_tickets(&self) -> FeludaResult<Vec<Ticket>>;
+    /// Open a ticket, returning its link or key
+    fn create(&self, title: &str, body: &str, fingerprint: &str) -> FeludaResult<String>;
+    fn close(&self, ticket: &Ticket, comment: &str) -> FeludaResult<()>;
+}
+
+struct GitHubTracker {
+    api_url: String,
+    repository: String,
+    token: String,
+    project: String,
+    labels: Vec<String>,
+}
+
+impl GitHubTracker {
+    fn new(config: &TicketsConfig, path: &Path, project: &str) -> FeludaResult<Self> {
+        let var = |name: &str| env::var(name).ok().filter(|value| !value.is_empty());
+        let repository = config
+            .repository
+            .clone()
+            .or_else(|| var("GITHUB_REPOSITORY"))
+            .or_else(|| {
+                let repo = git2::Repository::discover(path).ok()?;
+                let remote = repo.find_remote("origin").ok()?;
+                github_repository(remote.url()?)
+            })
+            .ok_or_else(|| {
+                FeludaError::Config(
+                    "[tickets] needs a repository, GITHUB_REPOSITORY or a GitHub origin remote"
+                        .to_string(),
+                )
+            })?;
+        let token = match &config.token_env {
+            Some(name) => var(name),
+            None => get_github_token().map(str::to_string),
+        }
+        .ok_or_else(|| {
+            FeludaError::Config(format!(
+                "GitHub tickets need a token in {}",
+                config.token_env.as_deref().unwrap_or("GITHUB_TOKEN")
+            ))
+        })?;
+
+        Ok(Self {
+            api_url: var("GITHUB_API_URL")
+                .unwrap_or_else(|| GITHUB_API_URL.to_string())
+                .trim_end_matches('/')
+                .to_string(),
+            repository,
+            token,
+            project: project.to_string(),
+            labels: config.labels.clone(),
+        })
+    }
+
+    fn request(&self, build: impl Fn(&Client) -> RequestBuilder) -> FeludaResult<Response> {
+        Ok(registry::send(Registry::GitHub, |client| {
+            build(client)
+                .bearer_auth(&self.token)
+                .header(reqwest::header::ACCEPT, "application/vnd.github+json")
+                .header("X-GitHub-Api-Version", "2022-11-28")
+        })?)
+    }
+
+    fn issue_url(&self, number: &str) -> String {
+        format!("{}/repos/{}/issues/{number}", self.api_url, self.repository)
+    }
+}
+
+impl Tracker for GitHubTracker {
+    fn markup(&self) -> Markup {
+        Markup::Markdown
+    }
+
+    fn open_tickets(&self) -> FeludaResult<Vec<Ticket>> {
+        let url = format!("{}/repos/{}/issues", self.api_url, self.repository);
+        let mut tickets = Vec::new();
+        for page in 1.. {
+            let response = self.request(|client| {
+                client.get(&url).query(&[
+                    ("state", "open"),
+                    ("labels", LABEL),
+                    ("per_page", &PAGE_SIZE.to_string()),
+                    ("page", &page.to_string()),
+                ])
+            })?;
+            let body = expect_success(response, "list the GitHub issues")?;
+            let issues = body.as_array().cloned().unwrap_or_default();
+            for issue in &issues {
+                // The issues API lists pull requests too
+                if issue.get("pull_request").is_some() {
+                    continue;
+                }
+                let Some((project, fingerprint)) =
+                    issue["body"].as_str().and_then(parse_github_marker)
+                else {
+                    continue;
+                };
+                if project == self.project.replace('"', "'") {
+                    tickets.push(Ticket {
+                        id: issue["number"].to_string(),
+                        fingerprint,
+                    });
+                }
+            }
+            if issues.len() < PAGE_SIZE {
+                break;
+            }
+        }
+        Ok(tickets)
+    }
+
+    fn create(&self, title: &str, body: &str, fingerprint: &str) -> FeludaResult<String> {
+        let url = format!("{}/repos/{}/issues", self.api_url, self.repository);
+        let mut labels = vec![LABEL.to_string()];
+        labels.extend(self.labels.iter().cloned());
+        let issue = json!({
+            "title": title,
+            "body": format!("{body}\n\n{}", github_marker(&self.project, fingerprint)),
+            "labels": labels,
+        });
+        let response = self.request(|client| client.post(&url).json(&issue))?;
+        let created = expect_success(response, "open a GitHub issue")?;
+        Ok(created["html_url"]
+            .as_str()
+            .map(str::to_string)
+            .unwrap_or_else(|| format!("#{}", created["number"])))
+    }
+
+    fn close(&self, ticket: &Ticket, comment: &str) -> FeludaResult<()> {
+        let url = self.issue_url(&ticket.id);
+        let comments = format!("{url}/comments");
+        let response =
+            self.request(|client| client.post(&comments).json(&json!({ "body": comment })))?;
+        expect_success(response, &format!("comment on GitHub issue #{}", ticket.id))?;
+        let response = self.request(|client| {
+            client
+                .patch(&url)
+                .json(&json!({ "state": "closed", "state_reason": "completed" }))
+        })?;
+        expect_success(response, &format!("close GitHub issue #{}", ticket.id))?;
+        Ok(())
+    }
+}
+
+struct JiraTracker {
+    url: String,
+    project_key: String,
+    issue_type: String,
+    username: Option<String>,
+    token: String,
+    project_label: String,
+    labels: Vec<String>,
+}
+
+impl JiraTracker {
+    fn new(config: &TicketsConfig, project: &str) -> FeludaResult<Self> {
+        // Validated with the configuration
+        let token_env = config.token_env.as_deref().unwrap_or_default();
+        let token = env::var(token_env)
+            .ok()
+            .filter(|token| !token.is_empty())
+            .ok_or_else(|| {
+                FeludaError::Config(format!("Jira tickets need a token in {token_env}"))
+            })?;
+        Ok(Self {
+            url: config
+                .url
+                .as_deref()
+                .unwrap_or_default()
+                .trim_end_matches('/')
+                .to_string(),
+            project_key: config.project.clone().unwrap_or_default(),
+            issue_type: config.issue_type.clone(),
+            username: config.username.clone(),
+            token,
+            project_label: jira_project_label(project),
+            labels: config.labels.clone(),
+        })
+    }
+
+    /// Jira Cloud only offers the paginated `search/jql` endpoint
+    fn is_cloud(&self) -> bool {
+        reqwest::Url::parse(&self.url)
+            .ok()
+            .and_then(|url| url.host_str().map(|host| host.ends_with(".atlassian.net")))
+            .unwrap_or(false)
+    }
+
+    fn request(&self, build: impl Fn(&Client) -> RequestBuilder) -> FeludaResult<Response> {
+        Ok(registry::send(Registry::Jira, |client| {
+            let builder = build(client).header(reqwest::header::ACCEPT, "application/json");
+            match &self.username {
+                // Jira Cloud: account email and API token
+                Some(username) => builder.basic_auth(username, Some(&self.token)),
+                // Jira Data Center: personal access token
+                None => builder.bearer_auth(&self.token),
+            }
+        })?)
+    }
+}
+
+impl Tracker for JiraTracker {
+    fn markup(&self) -> Markup {
+        Markup::Jira
+    }
+
+    fn open_tickets(&self) -> FeludaResult<Vec<Ticket>> {
+        let jql = format!(
+            "project = \"{}\" AND labels = \"{}\" AND statusCategory != Done",
+            self.project_key, self.project_label
+        );
+        let cloud = self.is_cloud();
+        let url = if cloud {
+            format!("{}/rest/api/3/search/jql", self.url)
+        } else {
+            format!("{}/rest/api/2/search", self.url)
+        };
+
+        let mut tickets = Vec::new();
+        let mut start_at = 0;
+        let mut next_page: Option<String> = None;
+        loop {
+            let response = self.request(|client| {
+                let mut query = vec![
+                    ("jql", jql.clone()),
+                    ("fields", "labels".to_string()),
+                    ("maxResults", PAGE_SIZE.to_string()),
+                ];
+                match &next_page {
+                    Some(token) => query.push(("nextPageToken", token.clone())),
+                    None if !cloud => query.push(("startAt", start_at.to_string())),
+                    None => {}
+                }
+                client.get(&url).query(&query)
+            })?;
+            let body = expect_success(response, "search the Jira issues")?;
+            let issues = body["issues"].as_array().cloned().unwrap_or_default();
+            for issue in &issues {
+                let labels = issue["fields"]["labels"]
+                    .as_array()
+                    .cloned()
+                    .unwrap_or_default();
+                if let (Some(key), Some(fingerprint)) =
+                    (issue["key"].as_str(), jira_fingerprint(&labels))
+                {
+                    tickets.push(Ticket {
+                        id: key.to_string(),
+                        fingerprint,
+                    });
+                }
+            }
+
+            start_at += issues.len();
+            next_page = body["nextPageToken"].as_str().map(str::to_string);
+            let more = if cloud {
+                next_page.is_some() && !body["isLast"].as_bool().unwrap_or(false)
+            } else {
+                !issues.is_empty() && (start_at as u64) < body["total"].as_u64().unwrap_or(0)
+            };
+            if !more {
+                break;
+            }
+        }
+        Ok(tickets)
+    }
+
+    fn create(&self, title: &str, body: &str, fingerprint: &str) -> FeludaResult<String> {
+        let url = format!("{}/rest/api/2/issue", self.url);
+        let mut labels = vec![
+            LABEL.to_string(),
+            self.project_label.clone(),
+            format!("{LABEL}-{fingerprint}"),
+        ];
+        labels.extend(self.labels.iter().cloned());
+        let issue = json!({
+            "fields": {
+                "project": { "key": self.project_key },
+                "issuetype": { "name": self.issue_type },
+                "summary": title,
+                "description": body,
+                "labels": labels,
+            }
+        });
+        let response = self.request(|client| client.post(&url).json(&issue))?;
+        let created = expect_success(response, "open a Jira issue")?;
+        Ok(created["key"].as_str().unwrap_or_default().to_string())
+    }
+
+    fn close(&self, ticket: &Ticket, comment: &str) -> FeludaResult<()> {
+        let issue_url = format!("{}/rest/api/2/issue/{}", self.url, ticket.id);
+        let comments = format!("{issue_url}/comment");
+        let response =
+            self.request(|client| client.post(&comments).json(&json!({ "body": comment })))?;
+        expect_success(response, &format!("comment on Jira issue {}", ticket.id))?;
+
+        // Workflows differ, so take the first transition to a done status
+        let transitions = format!("{issue_url}/transitions");
+        let response = self.request(|client| client.get(&transitions))?;
+        let body = expect_success(response, &format!("list transitions of {}", ticket.id))?;
+        let done = body["transitions"].as_array().and_then(|transitions| {
+            transitions
+                .iter()
+                .find(|t| t["to"]["statusCategory"]["key"] == "done")
+                .and_then(|t| t["id"].as_str().map(str::to_string))
+        });
+        let Some(transition) = done else {
+            log(
+                LogLevel::Warn,
+                &format!(
+                    "Jira issue {} has no transition to a done status, left open",
+                    ticket.id
+                ),
+            );
+            return Ok(());
+        };
+        let response = self.request(|client| {
+            client
+                .post(&transitions)
+                .json(&json!({ "transition": { "id": transition } }))
+        })?;
+        expect_success(response, &format!("close Jira issue {}", ticket.id))?;
+        Ok(())
+    }
+}
+
+/// Open tickets for new policy violations and close those of violations that are gone
+///
+/// `violations` should already leave out those accepted in the baseline.
+pub fn sync_tickets(
+    config: &FeludaConfig,
+    path: &Path,
+    project_license: Option<&str>,
+    dependencies: &[LicenseInfo],
+    violations: &[PolicyViolation],
+) -> FeludaResult<TicketSync> {
+    let tickets = &config.tickets;
+    let project = project_name(path);
+    let tracker: Box<dyn Tracker> = match tickets.tracker {
+        Some(TrackerKind::GitHub) => Box::new(GitHubTracker::new(tickets, path, &project)?),
+        Some(TrackerKind::Jira) => Box::new(JiraTracker::new(tickets, &project)?),
+        None => {
+            return Err(FeludaError::Config(
+                "--sync-tickets needs a tracker in the [tickets] section".to_string(),
+            ))
+        }
+    };
+
+    let open = tracker.open_tickets()?;
+    let (to_open, to_close) = plan(&project, violations, &open);
+    log(
+        LogLevel::Info,
+        &format!(
+            "{} open tickets for {project}, {} to open and {} to close",
+            open.len(),
+            to_open.len(),
+            to_close.len()
+        ),
+    );
+
+    // Remediations are only looked up for the tickets about to be opened
+    let violating: Vec<LicenseInfo> = dependencies
+        .iter()
+        .filter(|info| {
+            to_open.iter().any(|(_, group)| {
+                group
+                    .iter()
+                    .any(|v| v.name == info.name && v.version == info.version)
+            })
+        })
+        .cloned()
+        .collect();
+    let findings = if violating.is_empty() {
+        Vec::new()
+    } else {
+        suggest_remediations(&violating, violations, project_license, config)
+    };
+
+    let mut sync = TicketSync {
+        kept: open.len() - to_close.len(),
+        ..TicketSync::default()
+    };
+    for (fingerprint, group) in &to_open {
+        let title = ticket_title(&project, group[0]);
+        let remediations = findings
+            .iter()
+            .find(|finding: &&Finding| {
+                group
+                    .iter()
+                    .any(|v| v.name == finding.name && v.version == finding.version)
+            })
+            .map(|finding| finding.remediations.as_slice())
+            .unwrap_or_default();
+        let body = ticket_body(
+            tracker.markup(),
+            &project,
+            group,
+            dependencies,
+            remediations,
+        );
+        let ticket = tracker.create(&title, &body, fingerprint)?;
+        log(LogLevel::Info, &format!("Opened ticket {ticket}: {title}"));
+        sync.opened.push(ticket);
+    }
+    let comment =
+        format!("Feluda no longer reports this violation in {project}, closing the ticket.");
+    for ticket in to_close {
+        tracker.close(ticket, &comment)?;
+        log(LogLevel::Info, &format!("Closed ticket {}", ticket.id));
+        sync.closed.push(ticket.id.clone());
+    }
+    Ok(sync)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::policy::ViolationKind;
+
+    fn violation(name: &str, version: &str, license: &str) -> PolicyViolation {
+        PolicyViolation {
+            name: name.to_string(),
+            version: version.to_string(),
+            license: Some(license.to_string()),
+            kind: ViolationKind::Denied,
+            introduced_by: None,
+        }
+    }
+
+    #[test]
+    fn test_fingerprint() {
+        let gpl = violation("readline", "8.2.0", "GPL-3.0");
+        assert_eq!(fingerprint("api", &gpl).len(), 16);
+        // Upgrades keep the ticket
+        assert_eq!(
+            fingerprint("api", &gpl),
+            fingerprint("api", &violation("readline", "8.3.0", "GPL-3.0"))
+        );
+        assert_ne!(
+            fingerprint("api", &gpl),
+            fingerprint("api", &violation("readline", "8.2.0", "AGPL-3.0"))
+        );
+        assert_ne!(fingerprint("api", &gpl), fingerprint("web", &gpl));
+    }
+
+    #[test]
+    fn test_plan() {
+        let violations = vec![
+            violation("readline", "8.2.0", "GPL-3.0"),
+            violation("readline", "7.0.0", "GPL-3.0"),
+            violation("ghostscript", "10.0", "AGPL-3.0"),
+        ];
+        let open = vec![
+            Ticket {
+                id: "7".to_string(),
+                fingerprint: fingerprint("api", &violations[0]),
+            },
+            Ticket {
+                id: "9".to_string(),
+                fingerprint: "0123456789abcdef".to_string(),
+            },
+        ];
+        let (to_open, to_close) = plan("api", &violations, &open);
+        assert_eq!(to_open.len(), 1);
+        assert_eq!(to_open[0].1[0].name, "ghostscript");
+        assert_eq!(to_close, vec![&open[1]]);
+
+        // Both versions of a dependency share one ticket
+        let (to_open, _) = plan("api", &violations, &[]);
+        assert_eq!(to_open.len(), 2);
+        assert!(to_open.iter().any(|(_, group)| group.len() == 2));
+    }
+
+    #[test]
+    fn test_ticket_body() {
+        let mut indirect = violation("readline", "8.2.0", "GPL-3.0");
+        indirect.introduced_by = Some("cli-kit@2.0.0".to_string());
+        let direct = violation("readline", "7.0.0", "GPL-3.0");
+        let upgrade = Remediation::ChangeVersion {
+            version: "9.0.0".to_string(),
+            license: "MIT".to_string(),
+            newer: true,
+        };
+
+        let body = ticket_body(
+            Markup::Markdown,
+            "api",
+            &[&indirect, &direct],
+            &[],
+            &[upgrade],
+        );
+        assert!(body
+            .contains("* Package: `readline`\n* License: GPL-3.0\n* Violation: denied by policy"));
+        assert!(body.contains("* Version `8.2.0`, pulled in by cli-kit@2.0.0"));
+        assert!(body.contains("* Version `7.0.0`, a direct dependency"));
+        assert!(body.contains("### Suggested remediation\n\n* Upgrade to `9.0.0` (MIT)"));
+
+        let jira = ticket_body(Markup::Jira, "api", &[&direct], &[], &[]);
+        assert!(jira.contains("* Package: {{readline}}"));
+        assert!(!jira.contains("Suggested remediation"));
+        assert_eq!(
+            ticket_title("api", &direct),
+            "api: readline (GPL-3.0), denied by policy"
+        );
+    }
+
+    #[test]
+    fn test_ticket_markers() {
+        let body = format!(
+            "Details\n\n{}",
+            github_marker("my \"app\"", "0123456789abcdef")
+        );
+        assert_eq!(
+            parse_github_marker(&body),
+            Some(("my 'app'".to_string(), "0123456789abcdef".to_string()))
+        );
+        assert_eq!(parse_github_marker("An issue opened by hand"), None);
+
+        assert_eq!(jira_project_label("My App"), "feluda-project-my-app");
+        let labels = vec![
+            json!("feluda"),
+            json!("feluda-project-api"),
+            json!("feluda-0123456789abcdef"),
+        ];
+        assert_eq!(
+            jira_fingerprint(&labels).as_deref(),
+            Some("0123456789abcdef")
+        );
+        assert_eq!(jira_fingerprint(&labels[..2]), None);
+    }
+}
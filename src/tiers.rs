@@ -0,0 +1,235 @@
+//! Custom risk tiers
+//!
+//! The `[risk]` section of `.feluda.toml` groups licenses into named tiers such
+//! as "forbidden", "needs-review" or "allowed", listed from most to least
+//! severe. Every dependency is assigned a tier, and a tier may set the exit
+//! status `feluda` uses when any dependency falls into it.
+
+use colored::*;
+use serde::Serialize;
+
+use crate::config::RiskConfig;
+use crate::license_expression::LicenseTerm;
+use crate::licenses::LicenseInfo;
+use crate::policy::license_alternatives;
+
+/// Number of dependencies in a tier
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct TierSummary {
+    pub name: String,
+    pub count: usize,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub exit_code: Option<i32>,
+}
+
+/// Whether a license identifier matches a tier pattern
+///
+/// Matching ignores case, and `*` matches any run of characters.
+pub fn pattern_matches(pattern: &str, license: &str) -> bool {
+    let pattern = pattern.trim().to_lowercase();
+    let license = license.trim().to_lowercase();
+
+    let mut parts = pattern.split('*');
+    let first = parts.next().unwrap_or_default();
+    let Some(mut rest) = license.strip_prefix(first) else {
+        return false;
+    };
+    if !pattern.contains('*') {
+        return rest.is_empty();
+    }
+
+    let parts: Vec<&str> = parts.collect();
+    let (last, middle) = parts.split_last().expect("pattern contains '*'");
+    for part in middle {
+        match rest.find(part) {
+            Some(index) => rest = &rest[index + part.len()..],
+            None => return false,
+        }
+    }
+    rest.len() >= last.len() && rest.ends_with(last)
+}
+
+/// Index of the tier a license belongs to, `None` when it is unclassified
+///
+/// For an SPDX expression, each alternative of an `OR` is ranked by its most
+/// severe `AND` term, and the least severe alternative wins, since the
+/// dependency may be used under any of them.
+pub fn classify(license: Option<&str>, risk: &RiskConfig) -> Option<usize> {
+    let default = risk
+        .default
+        .as_ref()
+        .and_then(|name| risk.tiers.iter().position(|tier| &tier.name == name));
+
+    let Some(license) = license.filter(|license| !license.trim().is_empty()) else {
+        return default;
+    };
+
+    license_alternatives(license)
+        .iter()
+        .filter_map(|terms| {
+            terms
+                .iter()
+                .filter_map(|term| term_tier(term, risk).or(default))
+                .min()
+        })
+        .max()
+}
+
+fn term_tier(term: &LicenseTerm, risk: &RiskConfig) -> Option<usize> {
+    let full = term.to_string();
+    let id = term.license_id();
+    risk.tiers.iter().position(|tier| {
+        tier.licenses
+            .iter()
+            .any(|pattern| pattern_matches(pattern, &full) || pattern_matches(pattern, &id))
+    })
+}
+
+/// Set `tier` on every dependency; does nothing when no tiers are configured
+pub fn assign_tiers(dependencies: &mut [LicenseInfo], risk: &RiskConfig) {
+    if risk.is_empty() {
+        return;
+    }
+    for info in dependencies {
+        info.tier = classify(info.license.as_deref(), risk).map(|i| risk.tiers[i].name.clone());
+    }
+}
+
+/// Count the dependencies in each tier, in the configured order
+pub fn summarize_tiers(dependencies: &[LicenseInfo], risk: &RiskConfig) -> Vec<TierSummary> {
+    risk.tiers
+        .iter()
+        .map(|tier| TierSummary {
+            name: tier.name.clone(),
+            count: dependencies
+                .iter()
+                .filter(|info| info.tier.as_deref() == Some(tier.name.as_str()))
+                .count(),
+            exit_code: tier.exit_code,
+        })
+        .collect()
+}
+
+/// Exit code of the most severe tier that has an exit code and any dependencies
+pub fn tier_exit_code(summary: &[TierSummary]) -> Option<i32> {
+    summary
+        .iter()
+        .find(|tier| tier.count > 0 && tier.exit_code.is_some())
+        .and_then(|tier| tier.exit_code)
+}
+
+/// Print the tier counts, listing the dependencies of tiers that fail the scan
+pub fn print_tier_summary(summary: &[TierSummary], dependencies: &[LicenseInfo]) {
+    eprintln!("\n{}", "Risk tiers:".bold());
+
+    for tier in summary {
+        let line = format!("  {}: {}", tier.name, tier.count);
+        let Some(exit_code) = tier.exit_code.filter(|_| tier.count > 0) else {
+            eprintln!("{line}");
+            continue;
+        };
+
+        eprintln!(
+            "{} {}",
+            line.red().bold(),
+            format!("(exit code {exit_code})").red()
+        );
+        for info in dependencies
+            .iter()
+            .filter(|info| info.tier.as_deref() == Some(tier.name.as_str()))
+        {
+            eprintln!(
+                "    {}@{} ({})",
+                info.name,
+                info.version,
+                info.get_license()
+            );
+        }
+    }
+
+    let unclassified = dependencies
+        .iter()
+        .filter(|info| info.tier.is_none())
+        .count();
+    if unclassified > 0 {
+        eprintln!("  {}", format!("unclassified: {unclassified}").yellow());
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::RiskTier;
+
+    fn risk(default: Option<&str>) -> RiskConfig {
+        let tier = |name: &str, licenses: &[&str], exit_code| RiskTier {
+            name: name.to_string(),
+            licenses: licenses.iter().map(|l| l.to_string()).collect(),
+            exit_code,
+        };
+        RiskConfig {
+            default: default.map(str::to_string),
+            tiers: vec![
+                tier("forbidden", &["AGPL-*", "SSPL-1.0"], Some(3)),
+                tier("needs-review", &["LGPL-*", "MPL-2.0"], Some(2)),
+                tier("allowed", &["MIT", "Apache-2.0", "BSD-*"], None),
+            ],
+        }
+    }
+
+    #[test]
+    fn test_pattern_matches() {
+        assert!(pattern_matches("MIT", "mit"));
+        assert!(!pattern_matches("MIT", "MIT-0"));
+        assert!(pattern_matches("LGPL-*", "LGPL-2.1-or-later"));
+        assert!(!pattern_matches("LGPL-*", "GPL-3.0"));
+        assert!(pattern_matches("*-only", "GPL-2.0-only"));
+        assert!(pattern_matches("GPL-*-or-later", "GPL-3.0-or-later"));
+        assert!(!pattern_matches("GPL-*-only", "GPL-3.0-or-later"));
+        assert!(pattern_matches("*", "anything"));
+    }
+
+    #[test]
+    fn test_classify_expressions() {
+        let config = risk(None);
+        let tier =
+            |license| classify(Some(license), &config).map(|i| config.tiers[i].name.as_str());
+
+        assert_eq!(tier("AGPL-3.0-only"), Some("forbidden"));
+        assert_eq!(tier("MIT OR AGPL-3.0"), Some("allowed"));
+        assert_eq!(tier("MIT AND LGPL-2.1"), Some("needs-review"));
+        assert_eq!(tier("GPL-3.0"), None);
+        assert_eq!(classify(None, &config), None);
+
+        let config = risk(Some("needs-review"));
+        assert_eq!(classify(Some("GPL-3.0"), &config), Some(1));
+        assert_eq!(classify(None, &config), Some(1));
+    }
+
+    #[test]
+    fn test_tier_summary_and_exit_code() {
+        let risk = risk(None);
+        let mut deps = vec![
+            LicenseInfo::test("serde", "1.0.0", Some("MIT")),
+            LicenseInfo::test("libfoo", "1.0.0", Some("LGPL-3.0")),
+            LicenseInfo::test("mystery", "1.0.0", None),
+        ];
+        assign_tiers(&mut deps, &risk);
+        assert_eq!(deps[0].tier.as_deref(), Some("allowed"));
+        assert_eq!(deps[2].tier, None);
+
+        let summary = summarize_tiers(&deps, &risk);
+        assert_eq!(
+            summary.iter().map(|t| t.count).collect::<Vec<_>>(),
+            vec![0, 1, 1]
+        );
+        assert_eq!(tier_exit_code(&summary), Some(2));
+
+        deps.push(LicenseInfo::test("db", "1.0.0", Some("SSPL-1.0")));
+        assign_tiers(&mut deps, &risk);
+        assert_eq!(tier_exit_code(&summarize_tiers(&deps, &risk)), Some(3));
+
+        deps.retain(|d| d.tier.as_deref() == Some("allowed"));
+        assert_eq!(tier_exit_code(&summarize_tiers(&deps, &risk)), None);
+    }
+}
@@ -95,17 +95,80 @@ fn validate_ssh_key(key_path: &Path) -> Result<(), git2::Error> {
     Ok(())
 }
 
+/// Split a `--repo` value into the repository URL and the ref after a trailing `@`
+///
+/// `https://github.com/org/project@v1.2.0` checks out tag `v1.2.0`. The `@` of a
+/// user name in front of the host, as in `git@github.com:org/project`, is not a ref.
+pub fn split_repo_ref(repo: &str) -> (&str, Option<&str>) {
+    let path_start = repo.find("://").map_or(0, |scheme_end| scheme_end + 3);
+    let Some(first_slash) = repo[path_start..].find('/').map(|i| path_start + i) else {
+        return (repo, None);
+    };
+    match repo.rfind('@') {
+        Some(at) if at > first_slash && at + 1 < repo.len() => (&repo[..at], Some(&repo[at + 1..])),
+        _ => (repo, None),
+    }
+}
+
+/// Fetch only the commit of `git_ref` and check it out into `dest_path`
+///
+/// A shallow fetch skips the history, which a scan never looks at; libgit2
+/// only fetches local repositories in full. Without a ref the default branch
+/// of the remote is checked out, and a tag is peeled to the commit it names.
+/// The proxy is the one in `[registries] proxy`, else the one git is
+/// configured with.
+fn shallow_clone(
+    repo_url: &str,
+    git_ref: Option<&str>,
+    dest_path: &Path,
+    mut fetch_options: git2::FetchOptions<'_>,
+) -> Result<(), git2::Error> {
+    let repo = git2::Repository::init(dest_path)?;
+    let mut remote = repo.remote_anonymous(repo_url)?;
+    let local = repo_url.starts_with("file://") || Path::new(repo_url).exists();
+    if !local {
+        fetch_options.depth(1);
+    }
+    let mut proxy = git2::ProxyOptions::new();
+    match crate::registry::proxy_url() {
+        Some(url) => proxy.url(url),
+        None => proxy.auto(),
+    };
+    fetch_options.proxy_options(proxy);
+    remote.fetch(&[git_ref.unwrap_or("HEAD")], Some(&mut fetch_options), None)?;
+
+    let mut fetched = None;
+    repo.fetchhead_foreach(|_, _, oid, _| {
+        fetched = Some(*oid);
+        false
+    })?;
+    let oid = fetched.ok_or_else(|| {
+        git2::Error::from_str(&format!(
+            "Ref {} not found in the repository",
+            git_ref.unwrap_or("HEAD")
+        ))
+    })?;
+
+    // FETCH_HEAD names the tag object for an annotated tag
+    let commit = repo.find_object(oid, None)?.peel_to_commit()?;
+    let mut checkout = git2::build::CheckoutBuilder::new();
+    checkout.force();
+    repo.checkout_tree(commit.as_object(), Some(&mut checkout))?;
+    repo.set_head_detached(commit.id())
+}
+
 pub fn clone_repository(args: &Cli, dest_path: &Path) -> FeludaResult<()> {
     let token = &args.token;
     let ssh_key = &args.ssh_key;
     let ssh_passphrase = &args.ssh_passphrase;
-    let repo_url = &args.repo.as_deref().unwrap();
+    let (repo_url, git_ref) = split_repo_ref(args.repo.as_deref().unwrap());
 
     log(
         LogLevel::Info,
         &format!(
-            "Initializing clone of {} to {}",
+            "Initializing clone of {} at {} to {}",
             repo_url,
+            git_ref.unwrap_or("HEAD"),
             dest_path.display()
         ),
     );
@@ -168,14 +231,12 @@ pub fn clone_repository(args: &Cli, dest_path: &Path) -> FeludaResult<()> {
 
     let mut fetch_options = git2::FetchOptions::new();
     fetch_options.remote_callbacks(callbacks);
-    let mut builder = git2::build::RepoBuilder::new();
-    builder.fetch_options(fetch_options);
 
     log(
         LogLevel::Info,
         &format!("Cloning {} into {}", repo_url, dest_path.display()),
     );
-    match builder.clone(repo_url, dest_path) {
+    match shallow_clone(repo_url, git_ref, dest_path, fetch_options) {
         Ok(_) => {
             log(LogLevel::Info, "Clone successful");
             Ok(())
@@ -199,14 +260,13 @@ pub fn clone_repository(args: &Cli, dest_path: &Path) -> FeludaResult<()> {
                     });
                     let mut https_fetch_options = git2::FetchOptions::new();
                     https_fetch_options.remote_callbacks(https_callbacks);
-                    let mut https_builder = git2::build::RepoBuilder::new();
-                    https_builder.fetch_options(https_fetch_options);
 
                     log(
                         LogLevel::Info,
                         &format!("Cloning {} into {}", https_url, dest_path.display()),
                     );
-                    return match https_builder.clone(&https_url, dest_path) {
+                    return match shallow_clone(&https_url, git_ref, dest_path, https_fetch_options)
+                    {
                         Ok(_) => {
                             log(LogLevel::Info, "HTTPS clone successful");
                             Ok(())
@@ -231,6 +291,7 @@ pub fn clone_repository(args: &Cli, dest_path: &Path) -> FeludaResult<()> {
 #[cfg(test)]
 mod tests {
     use super::*;
+    use crate::debug::LogFormat;
     use std::fs::File;
     use tempfile::TempDir;
 
@@ -251,6 +312,67 @@ mod tests {
         assert_eq!(result, None);
     }
 
+    #[test]
+    fn test_split_repo_ref() {
+        assert_eq!(
+            split_repo_ref("https://github.com/org/project@v1.2.0"),
+            ("https://github.com/org/project", Some("v1.2.0"))
+        );
+        assert_eq!(
+            split_repo_ref("https://github.com/org/project@feature/login"),
+            ("https://github.com/org/project", Some("feature/login"))
+        );
+        assert_eq!(
+            split_repo_ref("git@github.com:org/project.git@main"),
+            ("git@github.com:org/project.git", Some("main"))
+        );
+        assert_eq!(
+            split_repo_ref("git@github.com:org/project.git"),
+            ("git@github.com:org/project.git", None)
+        );
+        assert_eq!(
+            split_repo_ref("https://user@gitlab.com/org/project"),
+            ("https://user@gitlab.com/org/project", None)
+        );
+        assert_eq!(
+            split_repo_ref("https://github.com/org/project@"),
+            ("https://github.com/org/project@", None)
+        );
+    }
+
+    #[test]
+    fn test_shallow_clone_annotated_tag() {
+        let origin = TempDir::new().unwrap();
+        let repo = git2::Repository::init_bare(origin.path()).unwrap();
+        let signature = git2::Signature::now("Feluda", "feluda@example.com").unwrap();
+        let mut tree = repo.treebuilder(None).unwrap();
+        tree.insert("LICENSE", repo.blob(b"MIT License\n").unwrap(), 0o100644)
+            .unwrap();
+        let tree = repo.find_tree(tree.write().unwrap()).unwrap();
+        let commit = repo
+            .commit(Some("HEAD"), &signature, &signature, "Release", &tree, &[])
+            .unwrap();
+        let target = repo.find_object(commit, None).unwrap();
+        repo.tag("v1.2.3", &target, &signature, "Version 1.2.3", false)
+            .unwrap();
+
+        let dest = TempDir::new().unwrap();
+        shallow_clone(
+            origin.path().to_str().unwrap(),
+            Some("v1.2.3"),
+            dest.path(),
+            git2::FetchOptions::new(),
+        )
+        .unwrap();
+
+        let clone = git2::Repository::open(dest.path()).unwrap();
+        assert_eq!(clone.head().unwrap().peel_to_commit().unwrap().id(), commit);
+        assert_eq!(
+            std::fs::read_to_string(dest.path().join("LICENSE")).unwrap(),
+            "MIT License\n"
+        );
+    }
+
     #[test]
     fn test_ssh_to_https_url_non_ssh() {
         let url = "https://github.com/anistark/feluda.git";
@@ -418,6 +540,8 @@ mod tests {
         // Create CLI args with invalid repository
         let args = Cli {
             debug: false,
+            log_level: None,
+            log_format: LogFormat::Text,
             command: None,
             path: "./".to_string(),
             repo: Some("invalid-repo-url".to_string()),
@@ -441,6 +565,48 @@ mod tests {
             osi: None,
             strict: false,
             no_local: false,
+            format: None,
+            refresh: false,
+            concurrency: None,
+            timeout: None,
+            retries: None,
+            recursive: false,
+            include: Vec::new(),
+            exclude: Vec::new(),
+            vulns: false,
+            fail_on_vulns: false,
+            exclude_dev: false,
+            offline: false,
+            license_db: None,
+            schema: None,
+            scope: Vec::new(),
+            vendored: false,
+            from_sbom: None,
+            copyright: false,
+            submit_github: false,
+            baseline: None,
+            fail_on: Vec::new(),
+            max_violations: 0,
+            sign: false,
+            sign_key: None,
+            attest: false,
+            health: false,
+            store: None,
+            template: None,
+            obligations: false,
+            fail_fast: false,
+            score: false,
+            badge: None,
+            deps_dev: false,
+            notify: false,
+            sync_tickets: false,
+            gitlab_token: None,
+            reviews: None,
+            unreviewed: false,
+            lang: None,
+            max_memory: None,
+            max_deps: None,
+            legal_files: false,
         };
 
         let result = clone_repository(&args, temp_dir.path());
@@ -474,6 +640,8 @@ mod tests {
 
         let args = Cli {
             debug: true,
+            log_level: None,
+            log_format: LogFormat::Text,
             command: None,
             path: "./".to_string(),
             repo: Some("https://github.com/nonexistent/repo.git".to_string()),
@@ -497,6 +665,48 @@ mod tests {
             osi: None,
             strict: false,
             no_local: false,
+            format: None,
+            refresh: false,
+            concurrency: None,
+            timeout: None,
+            retries: None,
+            recursive: false,
+            include: Vec::new(),
+            exclude: Vec::new(),
+            vulns: false,
+            fail_on_vulns: false,
+            exclude_dev: false,
+            offline: false,
+            license_db: None,
+            schema: None,
+            scope: Vec::new(),
+            vendored: false,
+            from_sbom: None,
+            copyright: false,
+            submit_github: false,
+            baseline: None,
+            fail_on: Vec::new(),
+            max_violations: 0,
+            sign: false,
+            sign_key: None,
+            attest: false,
+            health: false,
+            store: None,
+            template: None,
+            obligations: false,
+            fail_fast: false,
+            score: false,
+            badge: None,
+            deps_dev: false,
+            notify: false,
+            sync_tickets: false,
+            gitlab_token: None,
+            reviews: None,
+            unreviewed: false,
+            lang: None,
+            max_memory: None,
+            max_deps: None,
+            legal_files: false,
         };
 
         // Enable debug mode for this test
@@ -529,6 +739,8 @@ mod tests {
 
         let args = Cli {
             debug: false,
+            log_level: None,
+            log_format: LogFormat::Text,
             command: None,
             path: "./".to_string(),
             repo: Some("".to_string()),
@@ -552,6 +764,48 @@ mod tests {
             osi: None,
             strict: false,
             no_local: false,
+            format: None,
+            refresh: false,
+            concurrency: None,
+            timeout: None,
+            retries: None,
+            recursive: false,
+            include: Vec::new(),
+            exclude: Vec::new(),
+            vulns: false,
+            fail_on_vulns: false,
+            exclude_dev: false,
+            offline: false,
+            license_db: None,
+            schema: None,
+            scope: Vec::new(),
+            vendored: false,
+            from_sbom: None,
+            copyright: false,
+            submit_github: false,
+            baseline: None,
+            fail_on: Vec::new(),
+            max_violations: 0,
+            sign: false,
+            sign_key: None,
+            attest: false,
+            health: false,
+            store: None,
+            template: None,
+            obligations: false,
+            fail_fast: false,
+            score: false,
+            badge: None,
+            deps_dev: false,
+            notify: false,
+            sync_tickets: false,
+            gitlab_token: None,
+            reviews: None,
+            unreviewed: false,
+            lang: None,
+            max_memory: None,
+            max_deps: None,
+            legal_files: false,
         };
 
         let result = clone_repository(&args, temp_dir.path());
@@ -0,0 +1,614 @@
+//! Vendored dependency scanning (`--vendored`)
+//!
+//! For projects that commit their dependencies, licenses are read straight
+//! from the vendored copies instead of resolving anything through package
+//! managers or registries:
+//!
+//! - `node_modules/`: every installed package's `package.json`
+//! - `vendor/`: Go's `modules.txt`, Composer's `installed.json`, crates from
+//!   `cargo vendor` and gems installed by Bundler
+//! - `third_party/`: one dependency per subdirectory
+//!
+//! When a package's manifest declares no license, its LICENSE, COPYING or
+//! NOTICE files are classified instead.
+
+use ignore::gitignore::Gitignore;
+use serde_json::Value;
+use std::collections::{HashMap, HashSet};
+use std::fs;
+use std::path::{Path, PathBuf};
+
+use crate::config::FeludaConfig;
+use crate::debug::{log, log_error, LogLevel};
+use crate::languages::php::{license_from_composer, normalize_version};
+use crate::license_detector::detect_license_in_dir;
+use crate::licenses::{
+    fetch_licenses_from_github, is_license_restrictive, DependencyScope, License,
+    LicenseCompatibility, LicenseInfo,
+};
+use crate::lookup_errors::LookupStatus;
+use crate::parser::workspace_patterns;
+
+/// Directories holding vendored dependencies, relative to the project root
+pub const VENDOR_DIRS: [&str; 3] = ["node_modules", "vendor", "third_party"];
+
+/// Version of a vendored package whose manifest doesn't record one
+const UNKNOWN_VERSION: &str = "unknown";
+
+/// A package found in a vendor directory
+#[derive(Debug, Clone, PartialEq)]
+pub struct VendoredPackage {
+    pub name: String,
+    pub version: String,
+    /// License declared in the package manifest
+    pub license: Option<String>,
+    /// Directory of the vendored sources, searched for license files
+    pub dir: PathBuf,
+    /// Manifest the package was read from
+    pub manifest: PathBuf,
+    pub scope: DependencyScope,
+}
+
+/// Analyze the dependencies vendored under `project_dir`
+///
+/// Packages whose directory matches a `[workspace] exclude` pattern are skipped.
+pub fn analyze_vendored_dependencies(
+    project_dir: &Path,
+    config: &FeludaConfig,
+) -> Vec<LicenseInfo> {
+    let exclude = match workspace_patterns(project_dir, &config.workspace.exclude) {
+        Ok(exclude) => exclude,
+        Err(err) => {
+            log_error("Failed to read workspace exclude patterns", &err);
+            Gitignore::empty()
+        }
+    };
+
+    let mut packages = Vec::new();
+    for dir_name in VENDOR_DIRS {
+        let dir = project_dir.join(dir_name);
+        if !dir.is_dir() {
+            continue;
+        }
+        let found = match dir_name {
+            "node_modules" => node_modules_packages(&dir),
+            "vendor" => vendor_packages(&dir),
+            _ => third_party_packages(&dir),
+        };
+        let found: Vec<_> = found
+            .into_iter()
+            .filter(|package| {
+                !exclude
+                    .matched_path_or_any_parents(&package.dir, true)
+                    .is_ignore()
+            })
+            .collect();
+        log(
+            LogLevel::Info,
+            &format!(
+                "Found {} vendored packages in {}",
+                found.len(),
+                dir.display()
+            ),
+        );
+        packages.extend(found);
+    }
+
+    if packages.is_empty() {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "No vendored dependencies found in {} (looked for {})",
+                project_dir.display(),
+                VENDOR_DIRS.join(", ")
+            ),
+        );
+        return Vec::new();
+    }
+
+    analyze_packages(packages, project_dir, config)
+}
+
+/// Turn packages found on disk into license information
+///
+/// Packages found more than once are reported once. Source files are
+/// recorded relative to `root`.
+pub fn analyze_packages(
+    packages: Vec<VendoredPackage>,
+    root: &Path,
+    config: &FeludaConfig,
+) -> Vec<LicenseInfo> {
+    let known_licenses = fetch_licenses_from_github().unwrap_or_else(|err| {
+        log_error("Failed to fetch licenses from GitHub", &err);
+        HashMap::new()
+    });
+
+    let mut seen = HashSet::new();
+    packages
+        .into_iter()
+        .filter(|package| seen.insert((package.name.clone(), package.version.clone())))
+        .map(|package| license_info(package, root, &known_licenses, config))
+        .collect()
+}
+
+fn license_info(
+    package: VendoredPackage,
+    project_dir: &Path,
+    known_licenses: &HashMap<String, License>,
+    config: &FeludaConfig,
+) -> LicenseInfo {
+    let (license, license_confidence) = match package.license {
+        Some(license) => (Some(license), None),
+        None => detect_license_in_dir(&package.dir).map_or((None, None), |detected| {
+            (Some(detected.license), Some(detected.confidence))
+        }),
+    };
+    let is_restrictive = is_license_restrictive(&license, known_licenses, config.strict);
+    if is_restrictive {
+        log(
+            LogLevel::Warn,
+            &format!(
+                "Restrictive license found: {license:?} for {}",
+                package.name
+            ),
+        );
+    }
+
+    let manifest = package
+        .manifest
+        .strip_prefix(project_dir)
+        .unwrap_or(&package.manifest)
+        .to_string_lossy()
+        .replace('\\', "/");
+
+    LicenseInfo {
+        name: package.name,
+        version: package.version,
+        osi_status: match &license {
+            Some(l) => crate::licenses::get_osi_status(l),
+            None => crate::licenses::OsiStatus::Unknown,
+        },
+        license,
+        is_restrictive,
+        compatibility: LicenseCompatibility::Unknown,
+        license_confidence,
+        source_file: Some(manifest),
+        dependency_path: None,
+        tier: None,
+        vulnerabilities: None,
+        copyright: None,
+        legal_files: None,
+        chosen_license: None,
+        requires: None,
+        scope: package.scope,
+        manual_license: None,
+        health: None,
+        obligations: None,
+        explanation: None,
+        repository: None,
+        aliases: None,
+        purl: None,
+        review: None,
+        status: LookupStatus::Ok,
+        error: None,
+    }
+}
+
+/// Subdirectories of `dir`, sorted, skipping hidden ones such as `.bin`
+fn subdirectories(dir: &Path) -> Vec<PathBuf> {
+    let mut dirs: Vec<PathBuf> = fs::read_dir(dir)
+        .into_iter()
+        .flatten()
+        .filter_map(|entry| entry.ok())
+        .filter(|entry| !entry.file_name().to_string_lossy().starts_with('.'))
+        .map(|entry| entry.path())
+        .filter(|path| path.is_dir())
+        .collect();
+    dirs.sort();
+    dirs
+}
+
+/// Packages installed in a `node_modules` tree, including nested copies
+pub fn node_modules_packages(node_modules: &Path) -> Vec<VendoredPackage> {
+    let mut packages = Vec::new();
+    for dir in subdirectories(node_modules) {
+        let is_scope = dir
+            .file_name()
+            .is_some_and(|name| name.to_string_lossy().starts_with('@'));
+        let package_dirs = if is_scope {
+            subdirectories(&dir)
+        } else {
+            vec![dir]
+        };
+
+        for package_dir in package_dirs {
+            if let Some(package) = read_package_json(&package_dir) {
+                packages.push(package);
+            }
+            let nested = package_dir.join("node_modules");
+            if nested.is_dir() {
+                packages.extend(node_modules_packages(&nested));
+            }
+        }
+    }
+    packages
+}
+
+fn vendor_packages(vendor: &Path) -> Vec<VendoredPackage> {
+    let modules_txt = vendor.join("modules.txt");
+    if let Ok(content) = fs::read_to_string(&modules_txt) {
+        return parse_go_modules_txt(&content)
+            .into_iter()
+            .map(|(name, version)| VendoredPackage {
+                dir: vendor.join(&name),
+                manifest: modules_txt.clone(),
+                name,
+                version,
+                license: None,
+                scope: DependencyScope::Runtime,
+            })
+            .collect();
+    }
+
+    let installed_json = vendor.join("composer").join("installed.json");
+    if let Ok(content) = fs::read_to_string(&installed_json) {
+        return parse_composer_installed(&content, vendor, &installed_json);
+    }
+
+    let mut packages = Vec::new();
+    for dir in subdirectories(vendor) {
+        if dir.file_name().is_some_and(|name| name == "bundle") {
+            packages.extend(bundler_packages(&dir));
+        } else if let Some(package) = read_manifest(&dir) {
+            packages.push(package);
+        }
+    }
+    packages
+}
+
+fn third_party_packages(third_party: &Path) -> Vec<VendoredPackage> {
+    subdirectories(third_party)
+        .into_iter()
+        .map(|dir| read_manifest(&dir).unwrap_or_else(|| directory_package(&dir)))
+        .collect()
+}
+
+/// Read whichever package manifest a vendored directory has
+fn read_manifest(dir: &Path) -> Option<VendoredPackage> {
+    read_package_json(dir)
+        .or_else(|| read_cargo_toml(dir))
+        .or_else(|| read_composer_json(dir))
+}
+
+/// A vendored directory without a manifest, named after the directory
+fn directory_package(dir: &Path) -> VendoredPackage {
+    VendoredPackage {
+        name: dir
+            .file_name()
+            .map(|name| name.to_string_lossy().to_string())
+            .unwrap_or_default(),
+        version: UNKNOWN_VERSION.to_string(),
+        license: None,
+        dir: dir.to_path_buf(),
+        manifest: dir.to_path_buf(),
+        scope: DependencyScope::Runtime,
+    }
+}
+
+fn read_package_json(dir: &Path) -> Option<VendoredPackage> {
+    let manifest = dir.join("package.json");
+    let json: Value = serde_json::from_str(&fs::read_to_string(&manifest).ok()?).ok()?;
+    Some(VendoredPackage {
+        name: json.get("name")?.as_str()?.to_string(),
+        version: json
+            .get("version")
+            .and_then(Value::as_str)
+            .unwrap_or(UNKNOWN_VERSION)
+            .to_string(),
+        license: package_json_license(&json),
+        dir: dir.to_path_buf(),
+        manifest,
+        scope: DependencyScope::Runtime,
+    })
+}
+
+/// License of a package.json: `license` as a string or `{ "type": ... }`, or the legacy `licenses` array
+fn package_json_license(json: &Value) -> Option<String> {
+    let license_type = |value: &Value| -> Option<String> {
+        let license = value
+            .as_str()
+            .or_else(|| value.get("type").and_then(Value::as_str))?
+            .trim();
+        (!license.is_empty() && license != "UNLICENSED").then(|| license.to_string())
+    };
+
+    if let Some(license) = json.get("license").and_then(license_type) {
+        return Some(license);
+    }
+    let licenses: Vec<String> = json
+        .get("licenses")?
+        .as_array()?
+        .iter()
+        .filter_map(license_type)
+        .collect();
+    match licenses.len() {
+        0 => None,
+        1 => licenses.into_iter().next(),
+        _ => Some(licenses.join(" OR ")),
+    }
+}
+
+fn read_cargo_toml(dir: &Path) -> Option<VendoredPackage> {
+    let manifest = dir.join("Cargo.toml");
+    let toml: toml::Value = toml::from_str(&fs::read_to_string(&manifest).ok()?).ok()?;
+    let package = toml.get("package")?;
+    Some(VendoredPackage {
+        name: package.get("name")?.as_str()?.to_string(),
+        version: package
+            .get("version")
+            .and_then(|v| v.as_str())
+            .unwrap_or(UNKNOWN_VERSION)
+            .to_string(),
+        license: package
+            .get("license")
+            .and_then(|l| l.as_str())
+            .map(String::from),
+        dir: dir.to_path_buf(),
+        manifest,
+        scope: DependencyScope::Runtime,
+    })
+}
+
+fn read_composer_json(dir: &Path) -> Option<VendoredPackage> {
+    let manifest = dir.join("composer.json");
+    let json: Value = serde_json::from_str(&fs::read_to_string(&manifest).ok()?).ok()?;
+    Some(VendoredPackage {
+        name: json.get("name")?.as_str()?.to_string(),
+        version: json
+            .get("version")
+            .and_then(Value::as_str)
+            .map_or_else(|| UNKNOWN_VERSION.to_string(), normalize_version),
+        license: license_from_composer(&composer_licenses(&json)),
+        dir: dir.to_path_buf(),
+        manifest,
+        scope: DependencyScope::Runtime,
+    })
+}
+
+/// Composer's `license` field, a string or an array of alternatives
+fn composer_licenses(json: &Value) -> Vec<String> {
+    match json.get("license") {
+        Some(Value::String(license)) => vec![license.clone()],
+        Some(Value::Array(licenses)) => licenses
+            .iter()
+            .filter_map(Value::as_str)
+            .map(String::from)
+            .collect(),
+        _ => Vec::new(),
+    }
+}
+
+/// Packages listed in Composer's `vendor/composer/installed.json`
+///
+/// Composer 2 wraps the list in `{"packages": [...]}`, Composer 1 writes the
+/// array itself. Development packages are listed in `dev-package-names`.
+fn parse_composer_installed(content: &str, vendor: &Path, manifest: &Path) -> Vec<VendoredPackage> {
+    let json: Value = match serde_json::from_str(content) {
+        Ok(json) => json,
+        Err(err) => {
+            log_error("Failed to parse vendor/composer/installed.json", &err);
+            return Vec::new();
+        }
+    };
+    let entries = json
+        .get("packages")
+        .and_then(Value::as_array)
+        .or_else(|| json.as_array())
+        .cloned()
+        .unwrap_or_default();
+    let dev_names: HashSet<&str> = json
+        .get("dev-package-names")
+        .and_then(Value::as_array)
+        .into_iter()
+        .flatten()
+        .filter_map(Value::as_str)
+        .collect();
+
+    entries
+        .iter()
+        .filter_map(|entry| {
+            let name = entry.get("name")?.as_str()?;
+            Some(VendoredPackage {
+                name: name.to_string(),
+                version: entry
+                    .get("version")
+                    .and_then(Value::as_str)
+                    .map_or_else(|| UNKNOWN_VERSION.to_string(), normalize_version),
+                license: license_from_composer(&composer_licenses(entry)),
+                dir: vendor.join(name),
+                manifest: manifest.to_path_buf(),
+                scope: if dev_names.contains(name) {
+                    DependencyScope::Dev
+                } else {
+                    DependencyScope::Runtime
+                },
+            })
+        })
+        .collect()
+}
+
+/// Modules listed in Go's `vendor/modules.txt`
+///
+/// Module lines look like `# golang.org/x/text v0.14.0`, optionally followed by
+/// `=> replacement`. The vendored copy always sits under the original path.
+fn parse_go_modules_txt(content: &str) -> Vec<(String, String)> {
+    content
+        .lines()
+        .filter_map(|line| line.strip_prefix("# "))
+        .filter_map(|module| {
+            let module = module.split("=>").next()?.trim();
+            let (name, version) = module.split_once(' ')?;
+            Some((name.to_string(), version.trim().to_string()))
+        })
+        .collect()
+}
+
+/// Gems installed by `bundle install --path vendor/bundle`
+fn bundler_packages(bundle: &Path) -> Vec<VendoredPackage> {
+    let mut packages = Vec::new();
+    for ruby_version in subdirectories(&bundle.join("ruby")) {
+        for gem_dir in subdirectories(&ruby_version.join("gems")) {
+            let dir_name = gem_dir
+                .file_name()
+                .map(|name| name.to_string_lossy().to_string())
+                .unwrap_or_default();
+            // Gem directories are named `<name>-<version>`, and names may contain dashes
+            let Some((name, version)) = dir_name
+                .rsplit_once('-')
+                .filter(|(_, version)| version.starts_with(|c: char| c.is_ascii_digit()))
+            else {
+                continue;
+            };
+            packages.push(VendoredPackage {
+                name: name.to_string(),
+                version: version.to_string(),
+                license: None,
+                manifest: gem_dir.clone(),
+                dir: gem_dir,
+                scope: DependencyScope::Runtime,
+            });
+        }
+    }
+    packages
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    fn write(path: &Path, content: &str) {
+        fs::create_dir_all(path.parent().unwrap()).unwrap();
+        fs::write(path, content).unwrap();
+    }
+
+    #[test]
+    fn test_node_modules_packages() {
+        let temp_dir = TempDir::new().unwrap();
+        let node_modules = temp_dir.path().join("node_modules");
+        write(
+            &node_modules.join("express/package.json"),
+            r#"{"name": "express", "version": "4.18.2", "license": "MIT"}"#,
+        );
+        write(
+            &node_modules.join("express/node_modules/qs/package.json"),
+            r#"{"name": "qs", "version": "6.11.0", "licenses": [{"type": "BSD-3-Clause"}]}"#,
+        );
+        write(
+            &node_modules.join("@babel/core/package.json"),
+            r#"{"name": "@babel/core", "version": "7.23.0", "license": {"type": "MIT"}}"#,
+        );
+        write(&node_modules.join(".bin/tool/package.json"), "{}");
+
+        let packages: Vec<(String, Option<String>)> = node_modules_packages(&node_modules)
+            .into_iter()
+            .map(|p| (format!("{}@{}", p.name, p.version), p.license))
+            .collect();
+        assert_eq!(
+            packages,
+            vec![
+                ("@babel/core@7.23.0".to_string(), Some("MIT".to_string())),
+                ("express@4.18.2".to_string(), Some("MIT".to_string())),
+                ("qs@6.11.0".to_string(), Some("BSD-3-Clause".to_string())),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_go_modules_txt() {
+        let content = "# github.com/pkg/errors v0.9.1\n\
+## explicit\n\
+github.com/pkg/errors\n\
+# golang.org/x/text v0.14.0 => golang.org/x/text v0.13.0\n\
+## explicit; go 1.18\n\
+golang.org/x/text/language\n";
+
+        assert_eq!(
+            parse_go_modules_txt(content),
+            vec![
+                ("github.com/pkg/errors".to_string(), "v0.9.1".to_string()),
+                ("golang.org/x/text".to_string(), "v0.14.0".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_vendor_and_third_party_dirs() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        write(
+            &root.join("vendor/serde/Cargo.toml"),
+            "[package]\nname = \"serde\"\nversion = \"1.0.193\"\nlicense = \"MIT OR Apache-2.0\"\n",
+        );
+        write(
+            &root.join("vendor/bundle/ruby/3.3.0/gems/net-http-0.4.1/README.md"),
+            "",
+        );
+        write(&root.join("third_party/zlib/README"), "zlib 1.3");
+        write(
+            &root.join("third_party/json/composer.json"),
+            r#"{"name": "acme/json", "version": "v2.1.0", "license": ["MIT", "GPL-2.0-only"]}"#,
+        );
+
+        let mut packages: Vec<(String, String, Option<String>)> =
+            vendor_packages(&root.join("vendor"))
+                .into_iter()
+                .chain(third_party_packages(&root.join("third_party")))
+                .map(|p| (p.name, p.version, p.license))
+                .collect();
+        packages.sort();
+
+        assert_eq!(
+            packages,
+            vec![
+                (
+                    "acme/json".to_string(),
+                    "2.1.0".to_string(),
+                    Some("MIT OR GPL-2.0-only".to_string())
+                ),
+                ("net-http".to_string(), "0.4.1".to_string(), None),
+                (
+                    "serde".to_string(),
+                    "1.0.193".to_string(),
+                    Some("MIT OR Apache-2.0".to_string())
+                ),
+                ("zlib".to_string(), "unknown".to_string(), None),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_parse_composer_installed() {
+        let vendor = Path::new("vendor");
+        let manifest = vendor.join("composer/installed.json");
+        let v2 = r#"{
+  "packages": [
+    {"name": "monolog/monolog", "version": "3.5.0", "license": ["MIT"]},
+    {"name": "phpunit/phpunit", "version": "10.5.3", "license": ["BSD-3-Clause"]}
+  ],
+  "dev": true,
+  "dev-package-names": ["phpunit/phpunit"]
+}"#;
+        let v1 = r#"[{"name": "psr/log", "version": "v1.1.4", "license": ["MIT"]}]"#;
+
+        let v2 = parse_composer_installed(v2, vendor, &manifest);
+        assert_eq!(v2.len(), 2);
+        assert_eq!(v2[0].dir, vendor.join("monolog/monolog"));
+        assert_eq!(v2[0].license.as_deref(), Some("MIT"));
+        assert_eq!(v2[0].scope, DependencyScope::Runtime);
+        assert_eq!(v2[1].scope, DependencyScope::Dev);
+
+        let v1 = parse_composer_installed(v1, vendor, &manifest);
+        assert_eq!(v1[0].version, "1.1.4");
+    }
+}
@@ -0,0 +1,377 @@
+//! Vulnerability enrichment from OSV.dev
+//!
+//! With `--vulns`, the exact versions Feluda resolved for license checking are
+//! also looked up in the OSV database. Dependencies are matched in batches via
+//! `/v1/querybatch`, then each advisory found is fetched once for its summary,
+//! aliases (CVE ids for GitHub advisories) and severity.
+
+use colored::*;
+use rayon::prelude::*;
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::path::Path;
+
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::licenses::LicenseInfo;
+use crate::registry::{self, Registry};
+use crate::reporter::TableFormatter;
+
+const OSV_API_URL: &str = "https://api.osv.dev/v1";
+
+/// Maximum number of queries OSV accepts in one batch request
+const OSV_BATCH_SIZE: usize = 1000;
+
+/// A known vulnerability affecting a dependency version
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Vulnerability {
+    /// OSV identifier, e.g. `GHSA-xxxx-xxxx-xxxx` or `RUSTSEC-2023-0001`
+    pub id: String,
+    /// Other identifiers of the same advisory, such as CVE ids
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub aliases: Vec<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub summary: Option<String>,
+    /// Severity rating assigned by the source database (e.g. `HIGH`), if any
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub severity: Option<String>,
+}
+
+impl Vulnerability {
+    /// The first CVE alias, falling back to the OSV id
+    pub fn display_id(&self) -> &str {
+        self.aliases
+            .iter()
+            .find(|alias| alias.starts_with("CVE-"))
+            .unwrap_or(&self.id)
+    }
+}
+
+#[derive(Debug, Serialize)]
+struct OsvQuery {
+    package: OsvPackage,
+    version: String,
+}
+
+#[derive(Debug, Serialize)]
+struct OsvPackage {
+    name: String,
+    ecosystem: &'static str,
+}
+
+#[derive(Debug, Deserialize)]
+struct OsvBatchResponse {
+    #[serde(default)]
+    results: Vec<OsvBatchResult>,
+}
+
+#[derive(Debug, Default, Deserialize)]
+struct OsvBatchResult {
+    #[serde(default)]
+    vulns: Vec<OsvVulnerabilityId>,
+}
+
+#[derive(Debug, Deserialize)]
+struct OsvVulnerabilityId {
+    id: String,
+}
+
+/// Advisory as returned by `/v1/vulns/{id}`, reduced to the fields Feluda reports
+#[derive(Debug, Deserialize)]
+struct OsvVulnerability {
+    id: String,
+    #[serde(default)]
+    aliases: Vec<String>,
+    #[serde(default)]
+    summary: Option<String>,
+    #[serde(default)]
+    database_specific: Option<serde_json::Value>,
+}
+
+impl From<OsvVulnerability> for Vulnerability {
+    fn from(osv: OsvVulnerability) -> Self {
+        let severity = osv
+            .database_specific
+            .as_ref()
+            .and_then(|specific| specific.get("severity"))
+            .and_then(|severity| severity.as_str())
+            .map(str::to_uppercase);
+        Vulnerability {
+            id: osv.id,
+            aliases: osv.aliases,
+            summary: osv.summary.filter(|summary| !summary.trim().is_empty()),
+            severity,
+        }
+    }
+}
+
+/// OSV ecosystem of a dependency, derived from the manifest it was found in
+pub fn osv_ecosystem(source_file: &str) -> Option<&'static str> {
+    let file_name = Path::new(source_file).file_name()?.to_str()?;
+    match file_name {
+        "Cargo.toml" | "Cargo.lock" => Some("crates.io"),
+        "package.json" | "package-lock.json" | "yarn.lock" | "pnpm-lock.yaml" => Some("npm"),
+        "go.mod" | "go.sum" | "modules.txt" => Some("Go"),
+        "requirements.txt" | "Pipfile.lock" | "poetry.lock" | "pip_freeze.txt"
+        | "pyproject.toml" => Some("PyPI"),
+        "pom.xml"
+        | "gradle.lockfile"
+        | "build.gradle"
+        | "build.gradle.kts"
+        | "settings.gradle"
+        | "settings.gradle.kts" => Some("Maven"),
+        "DESCRIPTION" | "renv.lock" => Some("CRAN"),
+        "Gemfile.lock" => Some("RubyGems"),
+        "composer.lock" | "composer.json" | "installed.json" => Some("Packagist"),
+        "pubspec.lock" => Some("Pub"),
+        "mix.lock" => Some("Hex"),
+        "cabal.project.freeze" | "stack.yaml.lock" => Some("Hackage"),
+        "paket.lock" | "packages.lock.json" => Some("NuGet"),
+        _ if file_name.ends_with("proj") || file_name.ends_with(".slnx") => Some("NuGet"),
+        _ if file_name.ends_with(".opam.locked") => Some("opam"),
+        // rules_jvm_external lockfiles, e.g. maven_install.json
+        _ if file_name.ends_with("_install.json") => Some("Maven"),
+        _ => None,
+    }
+}
+
+/// Build one OSV query per dependency with a known ecosystem and exact version
+///
+/// Returns the index of each queried dependency alongside its query.
+fn build_queries(dependencies: &[LicenseInfo]) -> Vec<(usize, OsvQuery)> {
+    dependencies
+        .iter()
+        .enumerate()
+        .filter_map(|(index, info)| {
+            let ecosystem = osv_ecosystem(info.source_file.as_deref()?)?;
+            let version = info.version.trim();
+            if version.is_empty() || version.starts_with(['^', '~', '>', '<', '=', '*']) {
+                return None;
+            }
+            // OSV records Go versions without the `v` prefix
+            let version = match ecosystem {
+                "Go" => version.trim_start_matches('v'),
+                _ => version,
+            };
+            Some((
+                index,
+                OsvQuery {
+                    package: OsvPackage {
+                        name: info.name.clone(),
+                        ecosystem,
+                    },
+                    version: version.to_string(),
+                },
+            ))
+        })
+        .collect()
+}
+
+fn query_batch(queries: &[&OsvQuery]) -> FeludaResult<Vec<Vec<String>>> {
+    let url = format!("{OSV_API_URL}/querybatch");
+    let body = serde_json::json!({ "queries": queries });
+    let batch: OsvBatchResponse = registry::post_json(Registry::Osv, &url, &body)?
+        .error_for_status()?
+        .json()
+        .map_err(|e| FeludaError::InvalidData(format!("Invalid OSV response: {e}")))?;
+
+    Ok(batch
+        .results
+        .into_iter()
+        .map(|result| result.vulns.into_iter().map(|vuln| vuln.id).collect())
+        .collect())
+}
+
+fn fetch_vulnerability(id: &str) -> Vulnerability {
+    let url = format!("{OSV_API_URL}/vulns/{id}");
+    let details = registry::get(Registry::Osv, &url)
+        .and_then(|response| response.error_for_status())
+        .and_then(|response| response.json::<OsvVulnerability>());
+
+    match details {
+        Ok(osv) => osv.into(),
+        Err(err) => {
+            log_error(&format!("Failed to fetch details of {id}"), &err);
+            Vulnerability {
+                id: id.to_string(),
+                aliases: Vec::new(),
+                summary: None,
+                severity: None,
+            }
+        }
+    }
+}
+
+/// Look up known vulnerabilities for every dependency OSV can identify
+///
+/// Dependencies from ecosystems OSV does not cover, or without an exact
+/// version, keep `vulnerabilities` unset.
+pub fn enrich_with_vulnerabilities(dependencies: &mut [LicenseInfo]) -> FeludaResult<()> {
+    let queries = build_queries(dependencies);
+    log(
+        LogLevel::Info,
+        &format!("Querying OSV for {} dependencies", queries.len()),
+    );
+
+    let mut matches: Vec<(usize, Vec<String>)> = Vec::with_capacity(queries.len());
+    for chunk in queries.chunks(OSV_BATCH_SIZE) {
+        let batch: Vec<&OsvQuery> = chunk.iter().map(|(_, query)| query).collect();
+        let results = query_batch(&batch)?;
+        for ((index, _), ids) in chunk.iter().zip(results) {
+            matches.push((*index, ids));
+        }
+    }
+
+    let mut ids: Vec<&String> = matches.iter().flat_map(|(_, ids)| ids).collect();
+    ids.sort();
+    ids.dedup();
+    let details: HashMap<String, Vulnerability> = ids
+        .into_par_iter()
+        .map(|id| (id.clone(), fetch_vulnerability(id)))
+        .collect();
+    log(
+        LogLevel::Info,
+        &format!("Found {} distinct vulnerabilities", details.len()),
+    );
+
+    for (index, ids) in matches {
+        dependencies[index].vulnerabilities = Some(
+            ids.iter()
+                .filter_map(|id| details.get(id).cloned())
+                .collect(),
+        );
+    }
+    Ok(())
+}
+
+/// Whether any dependency has a known vulnerability
+pub fn has_vulnerabilities(dependencies: &[LicenseInfo]) -> bool {
+    dependencies
+        .iter()
+        .any(|info| info.vulnerabilities.as_ref().is_some_and(|v| !v.is_empty()))
+}
+
+/// Print a table of the vulnerable dependencies
+pub fn print_vulnerabilities(dependencies: &[LicenseInfo]) {
+    let rows: Vec<Vec<String>> = dependencies
+        .iter()
+        .flat_map(|info| {
+            info.vulnerabilities.iter().flatten().map(move |vuln| {
+                vec![
+                    info.name.clone(),
+                    info.version.clone(),
+                    vuln.display_id().to_string(),
+                    vuln.severity.clone().unwrap_or_else(|| "-".to_string()),
+                    vuln.summary.clone().unwrap_or_default(),
+                ]
+            })
+        })
+        .collect();
+
+    if rows.is_empty() {
+        println!("\n{}\n", "✅ No known vulnerabilities found".green().bold());
+        return;
+    }
+
+    println!(
+        "\n{} {}\n",
+        "🛡️".bold(),
+        format!("Known vulnerabilities: {}", rows.len())
+            .red()
+            .bold()
+    );
+
+    let headers = ["Package", "Version", "Advisory", "Severity", "Summary"];
+    let mut formatter = TableFormatter::new(headers.iter().map(|h| h.to_string()).collect());
+    for row in &rows {
+        formatter.add_row(row);
+    }
+
+    println!("{}", formatter.render_header());
+    for row in &rows {
+        println!("{}", formatter.render_row(row, true));
+    }
+    println!("{}\n", formatter.render_footer());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn dep(name: &str, version: &str, source_file: Option<&str>) -> LicenseInfo {
+        LicenseInfo {
+            source_file: source_file.map(str::to_string),
+            ..LicenseInfo::test(name, version, Some("MIT"))
+        }
+    }
+
+    #[test]
+    fn test_osv_ecosystem() {
+        assert_eq!(osv_ecosystem("Cargo.toml"), Some("crates.io"));
+        assert_eq!(osv_ecosystem("services/web/package.json"), Some("npm"));
+        assert_eq!(osv_ecosystem("go.mod"), Some("Go"));
+        assert_eq!(osv_ecosystem("backend/pyproject.toml"), Some("PyPI"));
+        assert_eq!(osv_ecosystem("pom.xml"), Some("Maven"));
+        assert_eq!(osv_ecosystem("App/App.csproj"), Some("NuGet"));
+        assert_eq!(osv_ecosystem("Gemfile.lock"), Some("RubyGems"));
+        assert_eq!(osv_ecosystem("composer.lock"), Some("Packagist"));
+        assert_eq!(osv_ecosystem("pubspec.lock"), Some("Pub"));
+        assert_eq!(osv_ecosystem("mix.lock"), Some("Hex"));
+        assert_eq!(osv_ecosystem("CMakeLists.txt"), None);
+    }
+
+    #[test]
+    fn test_build_queries() {
+        let deps = vec![
+            dep("serde", "1.0.200", Some("Cargo.toml")),
+            dep("golang.org/x/net", "v0.17.0", Some("go.mod")),
+            dep("lodash", "^4.17.0", Some("package.json")),
+            dep("zlib", "1.3", Some("vcpkg.json")),
+            dep("unknown", "1.0.0", None),
+        ];
+
+        let queries = build_queries(&deps);
+        assert_eq!(queries.len(), 2);
+        assert_eq!(queries[0].0, 0);
+        assert_eq!(queries[0].1.package.ecosystem, "crates.io");
+        assert_eq!(queries[1].1.version, "0.17.0");
+
+        let json = serde_json::to_value(&queries[1].1).unwrap();
+        assert_eq!(
+            json,
+            serde_json::json!({
+                "package": { "name": "golang.org/x/net", "ecosystem": "Go" },
+                "version": "0.17.0"
+            })
+        );
+    }
+
+    #[test]
+    fn test_parse_osv_responses() {
+        let batch: OsvBatchResponse = serde_json::from_str(
+            r#"{"results": [{"vulns": [{"id": "GHSA-aaaa-bbbb-cccc", "modified": "2024-01-01T00:00:00Z"}]}, {}]}"#,
+        )
+        .unwrap();
+        assert_eq!(batch.results.len(), 2);
+        assert_eq!(batch.results[0].vulns[0].id, "GHSA-aaaa-bbbb-cccc");
+        assert!(batch.results[1].vulns.is_empty());
+
+        let osv: OsvVulnerability = serde_json::from_str(
+            r#"{
+                "id": "GHSA-aaaa-bbbb-cccc",
+                "summary": "Prototype pollution",
+                "aliases": ["CVE-2024-0001"],
+                "database_specific": {"severity": "high"}
+            }"#,
+        )
+        .unwrap();
+        let vuln = Vulnerability::from(osv);
+        assert_eq!(vuln.display_id(), "CVE-2024-0001");
+        assert_eq!(vuln.severity.as_deref(), Some("HIGH"));
+        assert_eq!(vuln.summary.as_deref(), Some("Prototype pollution"));
+
+        let mut deps = vec![dep("serde", "1.0.0", Some("Cargo.toml"))];
+        assert!(!has_vulnerabilities(&deps));
+        deps[0].vulnerabilities = Some(vec![vuln]);
+        assert!(has_vulnerabilities(&deps));
+    }
+}
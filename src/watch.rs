@@ -0,0 +1,276 @@
+//! Re-running scans when dependencies change (`feluda watch`)
+//!
+//! Manifests, lockfiles and `.feluda.toml` are polled for changes to their
+//! modification time, size or presence. After a change the project is scanned
+//! again and only the differences to the previous scan are printed, as with
+//! `feluda diff`. Polling needs no platform support and copes with editors and
+//! package managers that replace files instead of writing to them.
+
+use chrono::Local;
+use colored::*;
+use ignore::WalkBuilder;
+use std::collections::BTreeMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::thread;
+use std::time::{Duration, SystemTime};
+
+use crate::debug::{log, log_error, FeludaError, FeludaResult, LogLevel};
+use crate::diff::{diff_dependencies, print_diff, ScanDiff};
+use crate::languages::Language;
+use crate::parser::SKIPPED_DIRS;
+use crate::scan::{scan, Report, ScanOptions};
+
+/// Lockfiles and manifests that are not project files of their own
+const WATCHED_FILES: [&str; 22] = [
+    ".feluda.toml",
+    ".feluda.yml",
+    ".feluda.yaml",
+    "Cargo.lock",
+    "package-lock.json",
+    "npm-shrinkwrap.json",
+    "yarn.lock",
+    "pnpm-lock.yaml",
+    "bun.lock",
+    "go.sum",
+    "Gemfile",
+    "composer.json",
+    "poetry.lock",
+    "uv.lock",
+    "Pipfile.lock",
+    "pdm.lock",
+    "packages.lock.json",
+    "Directory.Packages.props",
+    "gradle.lockfile",
+    "libs.versions.toml",
+    "renv.lock",
+    "conan.lock",
+];
+
+/// Modification time and size of a watched file
+type FileStamp = (Option<SystemTime>, u64);
+
+/// Watched files below the project directory and their current state
+pub type Snapshot = BTreeMap<PathBuf, FileStamp>;
+
+/// Whether changes to `file_name` can change the scan result
+pub fn is_watched_file(file_name: &str) -> bool {
+    WATCHED_FILES.contains(&file_name) || Language::from_file_name(file_name).is_some()
+}
+
+/// Record the state of every watched file below `root`
+pub fn snapshot(root: &Path) -> Snapshot {
+    let walker = WalkBuilder::new(root)
+        .hidden(false)
+        .filter_entry(|entry| {
+            let name = entry.file_name().to_str().unwrap_or_default();
+            let is_dir = entry
+                .file_type()
+                .is_some_and(|file_type| file_type.is_dir());
+            !(is_dir && (SKIPPED_DIRS.contains(&name) || name == ".git"))
+        })
+        .build();
+
+    let mut files = Snapshot::new();
+    for entry in walker {
+        let entry = match entry {
+            Ok(entry) => entry,
+            Err(err) => {
+                log_error("Failed to read directory", &err);
+                continue;
+            }
+        };
+        if !entry
+            .file_type()
+            .is_some_and(|file_type| file_type.is_file())
+            || !is_watched_file(entry.file_name().to_str().unwrap_or_default())
+        {
+            continue;
+        }
+        if let Ok(metadata) = fs::metadata(entry.path()) {
+            files.insert(
+                entry.path().to_path_buf(),
+                (metadata.modified().ok(), metadata.len()),
+            );
+        }
+    }
+    files
+}
+
+/// Files that were added, removed or modified between two snapshots
+pub fn changed_files(old: &Snapshot, new: &Snapshot) -> Vec<PathBuf> {
+    let mut changed: Vec<PathBuf> = new
+        .iter()
+        .filter(|(path, stamp)| old.get(*path) != Some(*stamp))
+        .map(|(path, _)| path.clone())
+        .collect();
+    changed.extend(old.keys().filter(|path| !new.contains_key(*path)).cloned());
+    changed.sort();
+    changed
+}
+
+/// Options for [`watch`]
+#[derive(Debug, Clone)]
+pub struct WatchOptions {
+    pub scan_options: ScanOptions,
+    /// How often watched files are checked
+    pub interval: Duration,
+    /// Print each set of differences as one line of JSON instead of tables
+    pub json: bool,
+}
+
+/// Scan `path`, then scan it again on every change until interrupted
+pub fn watch(path: &Path, options: &WatchOptions) -> FeludaResult<()> {
+    let mut files = snapshot(path);
+    let mut previous = scan(path, &options.scan_options)?;
+    print_summary(path, &files, &previous, options.json);
+
+    loop {
+        thread::sleep(options.interval);
+
+        let current_files = snapshot(path);
+        let changed = changed_files(&files, &current_files);
+        if changed.is_empty() {
+            continue;
+        }
+        files = current_files;
+
+        for file in &changed {
+            log(
+                LogLevel::Info,
+                &format!("Change detected in {}", file.display()),
+            );
+        }
+        if !options.json {
+            println!(
+                "{} {} changed, rescanning",
+                format!("[{}]", Local::now().format("%H:%M:%S")).dimmed(),
+                describe_changes(path, &changed)
+            );
+        }
+
+        // A half-written lockfile fails to parse; keep watching and retry on the next change
+        let current = match scan(path, &options.scan_options) {
+            Ok(report) => report,
+            Err(err) => {
+                log_error("Scan failed", &err);
+                if !options.json {
+                    println!("{} {err}\n", "❌ Scan failed:".red().bold());
+                }
+                continue;
+            }
+        };
+
+        let diff = diff_dependencies(&previous.dependencies, &current.dependencies);
+        print_changes(&diff, options.json)?;
+        previous = current;
+    }
+}
+
+fn describe_changes(root: &Path, changed: &[PathBuf]) -> String {
+    let mut names: Vec<String> = changed
+        .iter()
+        .take(3)
+        .map(|file| {
+            file.strip_prefix(root)
+                .unwrap_or(file)
+                .display()
+                .to_string()
+        })
+        .collect();
+    if changed.len() > names.len() {
+        names.push(format!("and {} more", changed.len() - names.len()));
+    }
+    names.join(", ")
+}
+
+fn print_summary(root: &Path, files: &Snapshot, report: &Report, json: bool) {
+    if json {
+        return;
+    }
+    let restrictive = report
+        .dependencies
+        .iter()
+        .filter(|info| info.is_restrictive)
+        .count();
+    println!(
+        "\n{} {} dependencies, {} restrictive",
+        "Initial scan:".bold(),
+        report.dependencies.len(),
+        restrictive
+    );
+    println!(
+        "👀 Watching {} files in {} for changes (Ctrl+C to stop)\n",
+        files.len(),
+        root.display()
+    );
+}
+
+fn print_changes(diff: &ScanDiff, json: bool) -> FeludaResult<()> {
+    if json {
+        let output = serde_json::to_string(diff)
+            .map_err(|e| FeludaError::Serialization(format!("Failed to serialize diff: {e}")))?;
+        println!("{output}");
+    } else {
+        print_diff(diff);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_snapshot_finds_manifests_and_lockfiles() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::write(root.join("package.json"), "{}").unwrap();
+        fs::write(root.join("package-lock.json"), "{}").unwrap();
+        fs::write(root.join("index.js"), "").unwrap();
+        fs::write(root.join(".feluda.toml"), "").unwrap();
+        fs::create_dir_all(root.join("services/api")).unwrap();
+        fs::write(root.join("services/api/go.mod"), "module api").unwrap();
+        fs::create_dir_all(root.join("node_modules/left-pad")).unwrap();
+        fs::write(root.join("node_modules/left-pad/package.json"), "{}").unwrap();
+
+        let files = snapshot(root);
+        let mut names: Vec<_> = files
+            .keys()
+            .map(|path| path.strip_prefix(root).unwrap().to_path_buf())
+            .collect();
+        names.sort();
+        assert_eq!(
+            names,
+            vec![
+                PathBuf::from(".feluda.toml"),
+                PathBuf::from("package-lock.json"),
+                PathBuf::from("package.json"),
+                PathBuf::from("services/api/go.mod"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_changed_files() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        fs::write(root.join("Cargo.toml"), "[package]").unwrap();
+        fs::write(root.join("Cargo.lock"), "version = 3").unwrap();
+        let before = snapshot(root);
+        assert!(changed_files(&before, &snapshot(root)).is_empty());
+
+        fs::write(root.join("Cargo.lock"), "version = 4\n").unwrap();
+        fs::remove_file(root.join("Cargo.toml")).unwrap();
+        fs::write(root.join("go.mod"), "module x").unwrap();
+        assert_eq!(
+            changed_files(&before, &snapshot(root)),
+            vec![
+                root.join("Cargo.lock"),
+                root.join("Cargo.toml"),
+                root.join("go.mod")
+            ]
+        );
+    }
+}